@@ -4,20 +4,31 @@
 #include "ui_renderer.h"
 #include <iostream>
 #include <memory>
+#include <map>
 #include <unordered_map>
+#include <unordered_set>
 #include <queue>
+#include <deque>
+#include <limits>
 #include <mutex>
 #include <thread>
+#include <future>
 #include <chrono>
+#include <algorithm>
+#include <cstring>
+#include <cmath>
 #include <SDL3/SDL.h>
 #include <flecs.h>
 #include <glm/glm.hpp>
 #include <glm/gtc/matrix_transform.hpp>
+#include <glm/gtc/quaternion.hpp>
 #include <assimp/Importer.hpp>
 #include <assimp/scene.h>
 #include <assimp/postprocess.h>
+#include <assimp/GltfMaterial.h>
 #include "volk.h"
 #include <shaderc/shaderc.hpp>
+#include <meshoptimizer.h>
 #include <steam/steam_api.h>
 #include <steam/steamnetworkingsockets.h>
 #include <steam/isteamnetworkingutils.h>
@@ -25,6 +36,291 @@
 // Maximum frames that can be processed simultaneously
 constexpr uint32_t MAX_FRAMES_IN_FLIGHT = 3;
 
+// GPU preferences accepted by boulder_set_gpu
+constexpr int GPU_PREFERENCE_DEFAULT = 0;
+constexpr int GPU_PREFERENCE_HIGH_PERFORMANCE = 1;
+constexpr int GPU_PREFERENCE_LOW_POWER = 2;
+
+// Components and event kinds used by boulder_watch_component
+constexpr int COMPONENT_TRANSFORM = 0;
+constexpr int COMPONENT_PHYSICS_BODY = 1;
+constexpr int COMPONENT_MODEL = 2;
+constexpr int COMPONENT_BUOYANCY_VOLUME = 3;
+constexpr int COMPONENT_BUOYANT = 4;
+constexpr int COMPONENT_SOFT_BODY = 5;
+constexpr int COMPONENT_COLLIDER = 6;
+constexpr int COMPONENT_COUNT = 7;
+
+constexpr uint32_t DEFAULT_WORLD = 1; // Created by boulder_init, never destroyed before shutdown
+
+constexpr int COMPONENT_EVENT_ADDED = 0;
+constexpr int COMPONENT_EVENT_REMOVED = 1;
+constexpr int COMPONENT_EVENT_CHANGED = 2;
+constexpr int COMPONENT_TRACK_CHANGES = 1 << 3; // Record change ticks without queuing events
+
+constexpr size_t LOG_QUEUE_LIMIT = 1024; // Oldest lines are dropped while nobody polls
+
+constexpr int COLLISION_EVENT_ENTER = 0;
+constexpr int COLLISION_EVENT_EXIT = 1;
+constexpr int COLLISION_EVENT_TRIGGER_ENTER = 2;
+constexpr int COLLISION_EVENT_TRIGGER_EXIT = 3;
+
+// Entity position in the spatial index used by overlap and nearest queries
+struct SpatialEntry {
+    flecs::entity_t entity;
+    glm::vec3 position;
+    uint32_t layers;
+};
+
+// Two colliders touching, keyed by their entities with the lower ID first
+struct Contact {
+    glm::vec3 point{0.0f};
+    glm::vec3 normal{0.0f}; // From the second entity to the first
+    uint64_t step = 0;      // Physics step they last touched in
+    bool trigger = false;   // One of them is a trigger volume
+};
+
+constexpr uint32_t SPATIAL_DEFAULT_LAYERS = 1;
+constexpr float SPATIAL_DEFAULT_CELL_SIZE = 8.0f;
+
+// Camera projections and pixel snapping used by boulder_render_models
+constexpr int CAMERA_PERSPECTIVE = 0;
+constexpr int CAMERA_ORTHOGRAPHIC = 1;
+
+constexpr int CAMERA_SNAP_NONE = 0;
+constexpr int CAMERA_SNAP_PIXEL = 1; // Screen pixels
+constexpr int CAMERA_SNAP_TEXEL = 2; // Art pixels (1 / pixelsPerUnit)
+
+// Filtering of the sampler textures bound by the engine are read with
+constexpr int TEXTURE_FILTER_LINEAR = 0;
+constexpr int TEXTURE_FILTER_NEAREST = 1;
+
+// Network channels and boulder_send_message_on_channel flags
+constexpr int NETWORK_MAX_CHANNELS = 16;
+constexpr int NETWORK_SEND_RELIABLE = 1;
+constexpr int NETWORK_SEND_NO_NAGLE = 2;
+constexpr int NETWORK_SEND_NO_DELAY = 4;
+
+// How the backdrop is scaled to the screen: whole image with bars in the clear color, or
+// filling the screen and cropping the overflow
+constexpr int BACKDROP_FIT_CONTAIN = 0;
+constexpr int BACKDROP_FIT_COVER = 1;
+
+// Custom materials: pipelines from boulder_create_material_pipeline read an entity's
+// parameter block and textures from descriptor set 1
+constexpr uint32_t MATERIAL_MAX_TEXTURES = 4;
+constexpr uint32_t MATERIAL_MAX_PARAMS = 256;                  // Bytes in a parameter block
+constexpr VkDeviceSize MATERIAL_PARAM_RING_SIZE = 1024 * 1024; // Parameter bytes per frame
+
+// Lights model and material fragment shaders read from set 0, binding 3. Scenes without
+// lights get a default directional light from above, like the old fixed lighting.
+constexpr int LIGHT_DIRECTIONAL = 0;
+constexpr int LIGHT_POINT = 1;
+constexpr int LIGHT_SPOT = 2;
+constexpr uint32_t MAX_LIGHTS = 64; // Nearest the camera win, directional lights first
+
+// Material blend modes and the render queues they draw in by default. Queues draw in
+// ascending order; blended draws within a queue are sorted back to front.
+constexpr int BLEND_MODE_OPAQUE = 0;
+constexpr int BLEND_MODE_ALPHA_TEST = 1; // Opaque, frag shaders discard (constant_id 0 is the mode)
+constexpr int BLEND_MODE_ALPHA_BLEND = 2;
+constexpr int BLEND_MODE_ADDITIVE = 3;
+constexpr int BLEND_MODE_COUNT = 4;
+
+// Present modes, matching VkPresentModeKHR
+constexpr int PRESENT_MODE_IMMEDIATE = 0;    // Uncapped, may tear (default)
+constexpr int PRESENT_MODE_MAILBOX = 1;      // Uncapped, newest frame shown at vblank
+constexpr int PRESENT_MODE_FIFO = 2;         // Vsync
+constexpr int PRESENT_MODE_FIFO_RELAXED = 3; // Vsync, tears when a frame is late
+
+constexpr int RENDER_QUEUE_OPAQUE = 2000;
+constexpr int RENDER_QUEUE_ALPHA_TEST = 2450;
+constexpr int RENDER_QUEUE_TRANSPARENT = 3000;
+
+// Longest boulder_end_frame waits for a present in low latency mode, so a hidden or
+// minimized window can't stall the game
+constexpr uint64_t LOW_LATENCY_WAIT_TIMEOUT = 100'000'000; // Nanoseconds
+
+// How long debug mode waits for a frame's fence before reporting a GPU hang
+constexpr uint64_t GPU_HANG_TIMEOUT = 2'000'000'000; // Nanoseconds
+
+// Push constant bytes of pipelines from boulder_create_graphics_pipeline
+constexpr uint32_t GRAPHICS_PUSH_CONSTANT_SIZE = 64;
+
+// Touch phases of TouchEvent
+constexpr int TOUCH_DOWN = 0;
+constexpr int TOUCH_MOVE = 1;
+constexpr int TOUCH_UP = 2;
+constexpr int TOUCH_CANCEL = 3; // The system took the touch, e.g. for a gesture
+
+// Touch and key events kept until polled; older ones are dropped first
+constexpr size_t MAX_TOUCH_EVENTS = 256;
+constexpr size_t MAX_KEY_EVENTS = 256;
+constexpr size_t MAX_WINDOW_EVENTS = 64;
+
+// Fullscreen modes, see boulder_set_fullscreen
+constexpr int FULLSCREEN_OFF = 0;
+constexpr int FULLSCREEN_BORDERLESS = 1;
+constexpr int FULLSCREEN_EXCLUSIVE = 2;
+
+// Window events, see boulder_poll_window_event
+constexpr int WINDOW_RESIZED = 0;
+constexpr int WINDOW_FOCUS_GAINED = 1;
+constexpr int WINDOW_FOCUS_LOST = 2;
+constexpr int WINDOW_MINIMIZED = 3;
+constexpr int WINDOW_RESTORED = 4;
+constexpr int WINDOW_MAXIMIZED = 5;
+constexpr int WINDOW_FILE_DROPPED = 6;
+
+// Why a call failed, see boulder_get_last_error
+constexpr int ERROR_UNKNOWN = 0;
+constexpr int ERROR_NOT_INITIALIZED = 1;
+constexpr int ERROR_INVALID_ARGUMENT = 2;
+constexpr int ERROR_NOT_FOUND = 3;
+constexpr int ERROR_FILE = 4;
+constexpr int ERROR_INVALID_DATA = 5;
+constexpr int ERROR_UNSUPPORTED = 6;
+constexpr int ERROR_VULKAN = 7;
+constexpr int ERROR_SHADER = 8;
+constexpr int ERROR_PLATFORM = 9;
+constexpr int ERROR_NETWORK = 10;
+constexpr int ERROR_API_MISUSE = 11;
+constexpr int ERROR_NATIVE_EXCEPTION = 12;
+
+// App lifecycle events, sent on Android and iOS
+constexpr int APP_WILL_PAUSE = 0;
+constexpr int APP_PAUSED = 1;
+constexpr int APP_WILL_RESUME = 2;
+constexpr int APP_RESUMED = 3;
+constexpr int APP_LOW_MEMORY = 4;
+constexpr int APP_TERMINATING = 5;
+
+// Where motion readings come from, see boulder_get_motion_source
+constexpr int MOTION_NONE = 0;
+constexpr int MOTION_DEVICE = 1;     // The phone, tablet or handheld itself
+constexpr int MOTION_CONTROLLER = 2; // A controller with a gyro (DualSense, Switch Pro, ...)
+
+// Controller capabilities, see boulder_get_controller_capabilities
+constexpr uint32_t CONTROLLER_RUMBLE = 1;
+constexpr uint32_t CONTROLLER_TRIGGER_RUMBLE = 2;   // Motors in the triggers (Xbox One and later)
+constexpr uint32_t CONTROLLER_LED = 4;              // RGB light (DualShock 4, DualSense)
+constexpr uint32_t CONTROLLER_ADAPTIVE_TRIGGERS = 8; // Trigger resistance (DualSense)
+constexpr uint32_t CONTROLLER_HD_RUMBLE = 16;       // Linear actuators with a low and a high band (Switch)
+constexpr uint32_t CONTROLLER_GYRO = 32;
+constexpr uint32_t CONTROLLER_ACCEL = 64;
+
+// Haptic effect targets
+constexpr int HAPTIC_BODY = 0;
+constexpr int HAPTIC_LEFT_TRIGGER = 1;
+constexpr int HAPTIC_RIGHT_TRIGGER = 2;
+
+// Haptic frequencies map onto the two rumble motors between these: at or below the low one
+// only the low frequency (left) motor runs, at or above the high one only the high
+// frequency (right) motor. They are the bands of the Switch's HD rumble.
+constexpr float HAPTIC_LOW_BAND = 40.0f;   // Hz
+constexpr float HAPTIC_HIGH_BAND = 320.0f; // Hz
+
+// How long each rumble command lasts; playing effects send one at least this often
+constexpr uint32_t HAPTIC_REFRESH_MS = 100;
+
+// Adaptive trigger effects (DualSense), see boulder_set_trigger_effect
+constexpr int TRIGGER_EFFECT_OFF = 0;
+constexpr int TRIGGER_EFFECT_RESISTANCE = 1; // Resists from start to the end of the pull
+constexpr int TRIGGER_EFFECT_SECTION = 2;    // Resists between start and end, then gives like a trigger break
+constexpr int TRIGGER_EFFECT_VIBRATION = 3;  // Vibrates past start
+
+// DualSense output report layout used with SDL_SendGamepadEffect
+constexpr size_t DS5_EFFECT_SIZE = 47;
+constexpr size_t DS5_RIGHT_TRIGGER_OFFSET = 10;
+constexpr size_t DS5_LEFT_TRIGGER_OFFSET = 21;
+constexpr uint8_t DS5_ENABLE_RIGHT_TRIGGER = 0x04;
+constexpr uint8_t DS5_ENABLE_LEFT_TRIGGER = 0x08;
+
+// Longest gap between gyro samples that is integrated; longer ones are a stall or a sensor
+// that was off, not rotation
+constexpr float MAX_GYRO_SAMPLE_GAP = 0.1f; // Seconds
+
+// Problems found by boulder_check_runtime
+constexpr int RUNTIME_NO_VULKAN_LOADER = 1;
+constexpr int RUNTIME_NO_VULKAN_DEVICE = 2;
+constexpr int RUNTIME_NO_MESH_SHADERS = 4;
+constexpr int RUNTIME_NO_VIDEO = 8;
+
+// A haptic effect being played on a controller
+struct PlayingHaptic {
+    uint32_t id;
+    HapticEffect effect;
+    uint64_t start; // SDL_GetTicksNS
+};
+
+// A connected controller
+struct Controller {
+    SDL_Gamepad* pad = nullptr;
+    SDL_JoystickID id = 0;
+    uint32_t capabilities = 0;
+    std::vector<PlayingHaptic> haptics;
+    float low = 0.0f, high = 0.0f;                 // Last rumble sent by effects
+    float leftTrigger = 0.0f, rightTrigger = 0.0f;
+    uint64_t lastRumble = 0;                       // When it was sent, 0 when effects are not rumbling
+};
+
+// RGBA8 texture. Pixels are kept so the image can be uploaded again after a device restart.
+struct Texture {
+    std::vector<uint8_t> pixels; // Every mip level back to back, largest first
+    uint32_t width = 0;
+    uint32_t height = 0;
+    uint32_t levels = 1;
+    VkImage image = VK_NULL_HANDLE;
+    VkDeviceMemory memory = VK_NULL_HANDLE;
+    VkImageView view = VK_NULL_HANDLE;
+    VkFormat format = VK_FORMAT_R8G8B8A8_UNORM; // SRGB for the backdrop on an SRGB swapchain
+};
+
+// View and projection the scene is drawn with. The defaults match the fixed camera the
+// renderer had before cameras could be set.
+struct Camera {
+    int projection = CAMERA_PERSPECTIVE;
+    glm::vec3 position{2.0f, 2.0f, 2.0f};
+    glm::vec3 target{0.0f};
+    glm::vec3 up{0.0f, 1.0f, 0.0f};
+    float fovY = 45.0f;          // Degrees, perspective only
+    float orthoHeight = 10.0f;   // World units visible vertically, orthographic only
+    float nearZ = 0.1f;
+    float farZ = 100.0f;
+    float pixelsPerUnit = 0.0f;  // Art pixels per world unit, 0 when not pixel perfect
+    int zoom = 0;                // Screen pixels per art pixel, 0 picks the largest that fits
+    int snap = CAMERA_SNAP_NONE;
+};
+
+// Model import settings (optimization and generated LODs)
+struct ModelImportSettings {
+    bool optimize = false;
+    std::vector<float> lodRatios; // Fraction of indices kept by each generated LOD
+    std::vector<float> lodErrors; // Maximum simplification error, relative to mesh extents
+};
+
+// When a frame slot's frame started and which present it became, for present stats
+struct FrameTiming {
+    std::chrono::steady_clock::time_point start;
+    uint64_t presentId = 0; // 0 when timed by the slot's fence
+    bool pending = false;   // Submitted and not yet seen on screen
+};
+
+// Running present stats
+struct FrameStats {
+    double latencyMs = 0;
+    double averageLatencyMs = 0;
+    uint64_t framesPresented = 0;
+    uint64_t framesDropped = 0;
+    std::chrono::steady_clock::time_point lastPresent;
+};
+
+// Why a call failed: an ERROR_ code and a message
+struct LastError {
+    int code = ERROR_UNKNOWN;
+    std::string message;
+};
+
 // Global state for the engine
 static struct {
     bool initialized = false;
@@ -32,10 +328,36 @@ static struct {
     bool isRecreatingSwapchain = false;
     bool resizeEventDuringRecreate = false;
     bool shouldClose = false;
+    bool paused = false; // App in the background (mobile); frames are skipped
+
+    // Controllers in the order they connected, opened as they arrive
+    std::vector<Controller> controllers;
+    uint32_t nextHapticID = 1;
+
+    // Motion sensors, see boulder_enable_motion. Gyro readings are in radians per second
+    // with the calibrated bias removed; accelerometer readings in m/s² include gravity.
+    bool motionEnabled = false;
+    SDL_Sensor* gyroSensor = nullptr;
+    SDL_Sensor* accelSensor = nullptr;
+    int motionSource = MOTION_NONE;
+    glm::vec3 gyro{0.0f};
+    glm::vec3 accel{0.0f};
+    glm::vec3 gyroBias{0.0f};
+    glm::vec3 gyroDelta{0.0f}; // Rotation since boulder_take_gyro_delta, in radians
+    float gyroDeltaTime = 0.0f;
+    uint64_t lastGyroTimestamp = 0; // Nanoseconds, 0 before the first sample
+    bool calibratingGyro = false;
+    glm::dvec3 calibrationSum{0.0};
+    uint32_t calibrationSamples = 0;
+    std::string appName;
+    uint32_t appVersion = 0;
     SDL_Window* window = nullptr;
     VkInstance instance = nullptr;
     VkSurfaceKHR surface = nullptr;
     VkPhysicalDevice physicalDevice = nullptr;
+    int physicalDeviceIndex = -1;
+    int requestedGpu = -1;        // Index pinned with boulder_set_gpu, -1 picks by preference
+    int gpuPreference = GPU_PREFERENCE_DEFAULT;
     VkDevice device = nullptr;
     VkQueue graphicsQueue = nullptr;
     VkSwapchainKHR swapchain = nullptr;
@@ -49,6 +371,7 @@ static struct {
     VkImageView depthImageView = nullptr;
     VkDeviceMemory depthImageMemory = nullptr;
     VkFormat depthFormat = VK_FORMAT_D32_SFLOAT;
+    VkFormat stencilFormat = VK_FORMAT_UNDEFINED; // depthFormat if it has stencil (needed for outlines)
 
     VkCommandPool commandPool = nullptr;
     std::vector<VkCommandBuffer> commandBuffers;
@@ -61,6 +384,58 @@ static struct {
     // Per-image fence tracking (which frame is using which image)
     std::vector<VkFence> imagesInFlight; // Initially VK_NULL_HANDLE, set to frame fence when image is acquired
 
+    // API misuse reporting. Misused calls record why in apiError for the Go bindings to
+    // return. Debug mode adds costlier checks and, when set before the instance is created,
+    // the Khronos validation layer, whose errors are recorded too.
+    bool debugMode = false;
+    std::mutex apiErrorMutex; // The validation layer may report from worker threads
+    std::string apiError;
+    std::mutex nativeErrorMutex;
+    std::string nativeError;
+
+    // Log lines queued for boulder_poll_log while watched. Anything may log from any thread.
+    std::mutex logMutex;
+    std::deque<std::pair<int, std::string>> logLines; // Level and message
+    VkDebugUtilsMessengerEXT debugMessenger = VK_NULL_HANDLE;
+    std::unordered_set<uint64_t> destroyedPipelines; // Debug mode, to name destroyed IDs
+    VkPhysicalDeviceMeshShaderPropertiesEXT meshShaderProperties{};
+
+    // Frame pacing. Up to framesInFlight frames are queued at once; in low latency mode
+    // boulder_end_frame waits until its frame is presented (VK_KHR_present_wait) or, without
+    // present wait, rendered. Present stats time each frame from the end of the previous one.
+    uint32_t framesInFlight = MAX_FRAMES_IN_FLIGHT;
+    bool lowLatency = false;
+    VkPresentModeKHR requestedPresentMode = VK_PRESENT_MODE_IMMEDIATE_KHR;
+    VkPresentModeKHR presentMode = VK_PRESENT_MODE_FIFO_KHR; // Used by the swapchain
+    bool presentWaitSupported = false;
+    bool textureCompressionBC = false;
+    uint64_t nextPresentId = 1;
+    float refreshRate = 60.0f;
+    std::chrono::steady_clock::time_point frameStart;
+    FrameTiming frameTimings[MAX_FRAMES_IN_FLIGHT];
+    FrameStats frameStats;
+
+    // Frame times for adaptive quality. The GPU time of a frame slot is read back from its
+    // two timestamps once its fence signals; CPU time excludes waits for the GPU.
+    VkQueryPool timestampPool = nullptr;
+    bool timestampsSupported = false;
+    uint64_t timestampMask = 0;
+    float timestampPeriod = 1.0f; // Nanoseconds per tick
+    bool timestampsWritten[MAX_FRAMES_IN_FLIGHT] = {};
+    double cpuFrameMs = 0;
+    double gpuFrameMs = 0;
+    double frameWaitMs = 0;
+    int lodBias = 0; // Added to every model's LOD
+    SubsystemTimes subsystemTimes{}; // Of the last boulder_update and boulder_render
+
+    // Frame statistics for the performance HUD. Device memory is what the engine allocated
+    // itself through allocateDeviceMemory, not the driver's own.
+    uint32_t frameDrawCalls = 0; // Counted while recording the current frame
+    uint64_t frameTriangles = 0;
+    RenderStats renderStats{}; // Of the last frame recorded
+    uint64_t deviceMemoryBytes = 0;
+    std::unordered_map<VkDeviceMemory, VkDeviceSize> deviceMemorySizes;
+
     uint32_t graphicsQueueFamily = UINT32_MAX;
     VkPipelineLayout pipelineLayout = nullptr;
     VkPipeline cubePipeline = nullptr;
@@ -74,8 +449,21 @@ static struct {
     VkShaderModule modelFragShader = nullptr;
     VkDescriptorSetLayout modelDescriptorSetLayout = nullptr;
     VkDescriptorPool modelDescriptorPools[MAX_FRAMES_IN_FLIGHT] = {}; // One pool per frame-in-flight
-    flecs::world* ecs = nullptr;
+
+    // Outline pipelines: the mask pass marks outlined models in the stencil buffer, the
+    // outline pass draws them expanded where the stencil is unmarked
+    VkPipeline outlineMaskPipeline = nullptr;
+    VkPipeline outlinePipeline = nullptr;
+    VkPipelineLayout outlinePipelineLayout = nullptr;
+    VkShaderModule outlineMeshShader = nullptr;
+    VkShaderModule outlineFragShader = nullptr;
+    flecs::world* ecs = nullptr; // The bound world, see boulder_bind_world
+    std::unordered_map<uint32_t, flecs::world*> worlds;
+    uint32_t boundWorld = 0;
+    uint32_t activeWorld = 0; // Simulated by boulder_update and drawn by boulder_render_models
+    uint32_t nextWorldId = DEFAULT_WORLD;
     std::unique_ptr<Assimp::Importer> importer;
+    ModelImportSettings importSettings;
 
     // Modular rendering state
     std::unordered_map<uint64_t, VkShaderModule> shaderModules;
@@ -83,23 +471,152 @@ static struct {
     std::unordered_map<uint64_t, VkPipelineLayout> pipelineLayouts;
     uint64_t nextShaderModuleId = 1;
     uint64_t nextPipelineId = 1;
+    std::string shaderIncludeRoot; // Directory #include paths are resolved against, empty for the working directory
+    std::unordered_map<std::string, std::vector<uint32_t>> shaderVariantCache; // SPIR-V by preprocessed source and kind
+    std::mutex shaderCacheMutex; // Guards the include root and variant cache, which async compiles read, and the errors
+    std::unordered_map<uint64_t, std::string> shaderErrors; // Compiler output of failed async compiles
+    std::unordered_map<uint64_t, LastError> pipelineErrors; // Why failed async pipeline compiles failed
+    // Shader modules and material pipelines compiling on worker threads, by their reserved
+    // IDs. pollAsyncCompiles moves finished ones into shaderModules and pipelines.
+    std::unordered_map<uint64_t, std::shared_future<VkShaderModule>> pendingShaderModules;
+    std::unordered_map<uint64_t, std::future<std::array<VkPipeline, BLEND_MODE_COUNT>>> pendingPipelines;
     VkPipeline boundPipeline = nullptr;
+    uint64_t boundPipelineId = 0;   // Bound with boulder_bind_pipeline in the current frame
+    std::unordered_set<uint64_t> framePipelines; // Every pipeline bound in the current frame
+    uint32_t activeImageIndex = 0;  // Swapchain image of the current frame
     VkCommandBuffer activeCommandBuffer = nullptr;
     uint32_t currentFrameIndex = 0;
     VkClearColorValue clearColor = {{0.1f, 0.2f, 0.3f, 1.0f}};
+    Camera camera;
+
+    // Image frames start from instead of the clear color alone (splash screens and boot
+    // videos). Its pixels are kept, so it survives boulder_restart.
+    Texture backdrop;
+    int backdropFit = BACKDROP_FIT_CONTAIN;
+
+    // Sampler for textures the engine binds, recreated when the filter changes
+    VkSampler textureSampler = VK_NULL_HANDLE;
+    int textureFilter = TEXTURE_FILTER_LINEAR;
+
+    // Textures and custom materials. Material pipelines share one layout: the model
+    // pipeline's set 0 and push constants, plus the material set. Parameter blocks are
+    // copied into a per-frame ring buffer as entities are drawn.
+    std::unordered_map<uint64_t, Texture> textures;
+    uint64_t nextTextureId = 1;
+    Texture whiteTexture; // Bound to unused texture slots
+    VkDescriptorSetLayout materialDescriptorSetLayout = VK_NULL_HANDLE;
+    VkPipelineLayout materialPipelineLayout = VK_NULL_HANDLE;
+    std::unordered_set<uint64_t> materialPipelines;
+    uint64_t defaultMaterialPipeline = 0; // For materials without a pipeline of their own
+    // Blended and alpha tested versions of the model and material pipelines, by blend mode.
+    // The opaque entry is unused: that is modelPipeline or the material pipeline itself.
+    VkPipeline modelBlendPipelines[BLEND_MODE_COUNT] = {};
+    std::unordered_map<uint64_t, std::array<VkPipeline, BLEND_MODE_COUNT>> materialBlendPipelines;
+    // Named float parameters of material pipelines: byte offsets into the parameter block
+    std::unordered_map<uint64_t, std::unordered_map<std::string, uint32_t>> materialParamNames;
+    VkBuffer materialParamBuffers[MAX_FRAMES_IN_FLIGHT] = {};
+    VkDeviceMemory materialParamMemory[MAX_FRAMES_IN_FLIGHT] = {};
+    uint8_t* materialParamMapped[MAX_FRAMES_IN_FLIGHT] = {};
+    VkDeviceSize materialParamOffset = 0;
+    VkDeviceSize materialParamAlignment = 256;
+
+    // Lights of the active world, written each time models are rendered
+    VkBuffer lightBuffers[MAX_FRAMES_IN_FLIGHT] = {};
+    VkDeviceMemory lightMemory[MAX_FRAMES_IN_FLIGHT] = {};
+    uint8_t* lightMapped[MAX_FRAMES_IN_FLIGHT] = {};
+    glm::vec3 ambientLight{0.2f}; // Color times intensity
+
+    // Screenshot readback: end_frame copies the swapchain image into this buffer when
+    // requested, and the copy is read once that frame's fence signals
+    bool screenshotRequested = false;
+    bool screenshotPending = false;
+    uint32_t screenshotFrame = 0;
+    VkBuffer screenshotBuffer = VK_NULL_HANDLE;
+    VkDeviceMemory screenshotMemory = VK_NULL_HANDLE;
+    VkDeviceSize screenshotSize = 0;
+    VkExtent2D screenshotExtent{};
+
+    // Component events, see boulder_watch_component
+    uint64_t changeTick = 1;
+    int watchedComponents[COMPONENT_COUNT] = {};
+    std::deque<ComponentEvent> componentEvents;
+    std::deque<TouchEvent> touchEvents;
+    std::vector<TouchPoint> touches; // Fingers down, in the order they touched
+    std::deque<int> appEvents;
+    std::deque<KeyEvent> keyEvents;
+    std::deque<std::pair<WindowEvent, std::string>> windowEvents; // With a dropped file's path
+    int fullscreen = FULLSCREEN_OFF;
+    SDL_DisplayMode exclusiveMode{}; // Set by boulder_set_display_mode; w is 0 until then
+    glm::vec2 mouseWheel{0.0f}; // Scrolled during the last boulder_poll_events
+    bool keymapChanged = false; // Keyboard layout changed since boulder_take_keymap_changed
+    std::unordered_map<flecs::entity_t, uint64_t> changeTicks[COMPONENT_COUNT];
+
+    // Colliders touching in the active world, see boulder_watch_collisions
+    uint64_t physicsStep = 0;
+    std::map<std::pair<flecs::entity_t, flecs::entity_t>, Contact> contacts;
+    bool collisionEventsWatched = false;
+    std::deque<CollisionEvent> collisionEvents;
+
+    // Spatial index: a hash grid of entity positions, rebuilt before a query when any
+    // transform or layer changed
+    bool spatialDirty = true;
+    float spatialCellSize = SPATIAL_DEFAULT_CELL_SIZE;
+    std::unordered_map<uint64_t, std::vector<SpatialEntry>> spatialGrid;
 
     // UI System
     std::unique_ptr<boulder::UIRenderer> uiRenderer;
     std::unordered_map<uint64_t, bool> buttonClickStates;
 } g_engine;
 
+// vkAllocateMemory and vkFreeMemory, keeping count of the device memory the engine holds
+static VkResult allocateDeviceMemory(VkDevice device, const VkMemoryAllocateInfo* info,
+                                     const VkAllocationCallbacks* allocator, VkDeviceMemory* memory) {
+    VkResult result = vkAllocateMemory(device, info, allocator, memory);
+    if (result == VK_SUCCESS) {
+        g_engine.deviceMemorySizes[*memory] = info->allocationSize;
+        g_engine.deviceMemoryBytes += info->allocationSize;
+    }
+    return result;
+}
+
+static void freeDeviceMemory(VkDevice device, VkDeviceMemory memory, const VkAllocationCallbacks* allocator) {
+    auto it = g_engine.deviceMemorySizes.find(memory);
+    if (it != g_engine.deviceMemorySizes.end()) {
+        g_engine.deviceMemoryBytes -= it->second;
+        g_engine.deviceMemorySizes.erase(it);
+    }
+    vkFreeMemory(device, memory, allocator);
+}
+
 // Transform component
 struct Transform {
     glm::vec3 position;
-    glm::vec3 rotation;
+    glm::quat rotation; // Unit quaternion
     glm::vec3 scale;
 };
 
+// Euler angles in radians to a quaternion, applied X, then Y, then Z to the model matrix
+static glm::quat eulerToQuat(const glm::vec3& euler) {
+    return glm::angleAxis(euler.x, glm::vec3(1, 0, 0)) *
+           glm::angleAxis(euler.y, glm::vec3(0, 1, 0)) *
+           glm::angleAxis(euler.z, glm::vec3(0, 0, 1));
+}
+
+// The inverse of eulerToQuat. At gimbal lock (Y of +-90 degrees) all remaining rotation
+// is folded into X.
+static glm::vec3 quatToEuler(const glm::quat& q) {
+    glm::mat3 m = glm::mat3_cast(q);
+    float sy = std::clamp(m[2][0], -1.0f, 1.0f);
+    glm::vec3 euler(0.0f, std::asin(sy), 0.0f);
+    if (std::abs(sy) < 0.9999f) {
+        euler.x = std::atan2(-m[2][1], m[2][2]);
+        euler.z = std::atan2(-m[1][0], m[0][0]);
+    } else {
+        euler.x = std::atan2(m[1][2], m[1][1]);
+    }
+    return euler;
+}
+
 // Physics component
 struct PhysicsBody {
     float mass;
@@ -107,6 +624,166 @@ struct PhysicsBody {
     glm::vec3 acceleration;
 };
 
+// Water region: an axis-aligned box centered on the entity's transform, surface at the top
+struct BuoyancyVolume {
+    glm::vec3 halfExtents;
+    float density;    // Fluid density in kg/m^3 (water is 1000)
+    float linearDrag; // Fraction of velocity removed per second when fully submerged
+};
+
+// Makes a physics body float in buoyancy volumes
+struct Buoyant {
+    float volume; // Displaced volume in m^3 when fully submerged
+    float height; // Body height, used to estimate how much of it is under the surface
+};
+
+// Spring-driven wobble of a rendered model, lagging behind the entity's motion
+struct SoftBody {
+    float stiffness;
+    float damping;
+    float amount;
+    glm::vec3 offset{0.0f};
+    glm::vec3 offsetVelocity{0.0f};
+    glm::vec3 lastPosition{0.0f};
+    glm::vec3 lastVelocity{0.0f};
+    bool started = false;
+};
+
+// Collision shapes. Box, sphere and capsule sizes are in world units and turn with the
+// entity's rotation; mesh colliders use the model's triangles under its full transform.
+constexpr int COLLIDER_BOX = 0;
+constexpr int COLLIDER_SPHERE = 1;
+constexpr int COLLIDER_CAPSULE = 2; // Along the entity's Y axis
+constexpr int COLLIDER_MESH = 3;    // Never moved by contacts, even with a physics body
+
+// Makes an entity collide. Entities without a physics body (or with no mass) are static.
+struct Collider {
+    int shape = COLLIDER_BOX;
+    glm::vec3 halfExtents{0.0f}; // Box
+    float radius = 0.0f;         // Sphere and capsule
+    float halfHeight = 0.0f;     // Capsule: from its center to the center of each cap
+    float friction = 0.5f;
+    float restitution = 0.0f;
+    std::vector<glm::vec3> triangles; // Mesh: three model space corners per triangle
+    bool trigger = false;             // Reports overlaps without pushing anything, see boulder_set_collider_trigger
+};
+
+// Query layers an entity is in (entities without one are in SPATIAL_DEFAULT_LAYERS)
+struct SpatialLayers {
+    uint32_t mask;
+};
+
+// Names FindNearest can search for
+struct Tags {
+    std::vector<std::string> names;
+};
+
+// Selection outline drawn around a model, thickness in pixels
+struct Outline {
+    glm::vec4 color;
+    float thickness;
+};
+
+// Light shining from an entity: along its -Z axis for directional and spot lights, from its
+// position for point and spot lights
+struct Light {
+    int type = LIGHT_DIRECTIONAL;
+    glm::vec3 color{1.0f};
+    float intensity = 1.0f;
+    float range = 0.0f;     // 0 has no cutoff
+    float innerCone = 0.0f; // Half angles in degrees, spot lights only
+    float outerCone = 0.0f;
+};
+
+// Light as the fragment shaders read it (std430)
+struct GpuLight {
+    glm::vec4 positionRange;  // w range, 0 for no cutoff
+    glm::vec4 directionType;  // Direction the light travels, w type
+    glm::vec4 colorIntensity;
+    glm::vec4 cone;           // Cosines of the inner and outer half angles
+};
+
+struct GpuLightHeader {
+    glm::vec4 ambient;
+    uint32_t count;
+    uint32_t padding[3];
+};
+static_assert(sizeof(GpuLight) == 64 && sizeof(GpuLightHeader) == 32, "light structs must match the shaders' Lights buffer");
+constexpr VkDeviceSize LIGHT_BUFFER_SIZE = sizeof(GpuLightHeader) + sizeof(GpuLight) * MAX_LIGHTS;
+
+// Per-entity color overrides applied by the model and material shaders
+struct InstanceColor {
+    glm::vec4 tint{1.0f};
+    glm::vec4 emissive{0.0f}; // Color times intensity, w unused
+};
+
+// Push constants of the model and material pipelines. Fragment shaders read the tint and
+// emissive color from offset 144.
+struct ModelPushConstants {
+    glm::mat4 viewProj;
+    glm::mat4 model;
+    uint32_t vertexOffset;
+    uint32_t indexOffset;
+    uint32_t padding[2];
+    glm::vec4 tint;
+    glm::vec4 emissive;
+};
+static_assert(sizeof(ModelPushConstants) == 176, "ModelPushConstants must match the model shaders' push constant block");
+
+// Custom pipeline a model is drawn with and the values it reads
+struct Material {
+    uint64_t pipeline = 0;
+    uint8_t params[MATERIAL_MAX_PARAMS] = {};
+    uint32_t paramSize = 0;
+    uint64_t textures[MATERIAL_MAX_TEXTURES] = {};
+    int blendMode = BLEND_MODE_OPAQUE;
+    int queue = 0; // 0 uses the blend mode's queue
+};
+
+// Texture slots of the standard material (see boulder_cgo.h)
+constexpr int STANDARD_SLOT_ALBEDO = 0;
+constexpr int STANDARD_SLOT_NORMAL = 1;
+constexpr int STANDARD_SLOT_METALLIC_ROUGHNESS = 2;
+constexpr int STANDARD_SLOT_EMISSIVE = 3;
+
+// Voxel worlds are stored in chunks of VOXEL_CHUNK_SIZE^3 blocks. Block 0 is air.
+constexpr int VOXEL_CHUNK_SIZE = 32;
+constexpr int VOXEL_CHUNK_VOLUME = VOXEL_CHUNK_SIZE * VOXEL_CHUNK_SIZE * VOXEL_CHUNK_SIZE;
+constexpr float VOXEL_MATERIAL_STRIDE = 1024.0f; // Material index is packed into texCoord.y
+constexpr uint32_t VOXEL_CHUNK_MAGIC = 0x584F5642; // "BVOX"
+constexpr uint32_t VOXEL_CHUNK_VERSION = 1;
+
+// Appearance and collision of a voxel block type. Materials are indices into the game's
+// texture atlas or array, one for each face direction.
+struct VoxelBlockType {
+    bool solid = true;  // Collides
+    bool opaque = true; // Hides the faces of neighbouring blocks
+    uint16_t top = 0;
+    uint16_t side = 0;
+    uint16_t bottom = 0;
+};
+
+struct VoxelChunk {
+    std::vector<uint16_t> blocks = std::vector<uint16_t>(VOXEL_CHUNK_VOLUME, 0); // x, then y, then z
+    uint32_t filled = 0;                // Non-air blocks
+    bool dirty = true;                  // Needs remeshing
+    flecs::entity_t meshEntity = 0;     // Child entity drawing the chunk
+    std::vector<glm::ivec3> collision;  // Min/max block pairs (max exclusive), in world block coordinates
+};
+
+// An axis-aligned grid of blocks, positioned by its entity's transform
+struct VoxelWorld {
+    float blockSize = 1.0f;
+    std::vector<VoxelBlockType> types{VoxelBlockType{false, false}};
+    std::unordered_map<uint64_t, VoxelChunk> chunks;
+};
+
+constexpr float GRAVITY = 9.81f;
+constexpr float SOFT_BODY_MAX_OFFSET = 0.5f;
+constexpr int COLLISION_ITERATIONS = 4;
+constexpr float RESTITUTION_MIN_SPEED = 1.0f; // Slower impacts don't bounce, so resting bodies settle
+constexpr float CONTACT_SKIN = 0.01f;          // Colliders this close still touch, so resting contacts don't flicker
+
 // Vertex structure for loaded models - matches GLSL std430 layout
 struct Vertex {
     glm::vec3 position;  // 12 bytes, offset 0
@@ -121,6 +798,30 @@ static_assert(offsetof(Vertex, position) == 0, "position offset must be 0");
 static_assert(offsetof(Vertex, normal) == 12, "normal offset must be 12");
 static_assert(offsetof(Vertex, texCoord) == 24, "texCoord offset must be 24");
 
+// Simplified index list of a mesh, sharing the mesh's vertices
+struct MeshLod {
+    std::vector<uint32_t> indices;
+    VkBuffer indexBuffer = VK_NULL_HANDLE;
+    VkDeviceMemory indexBufferMemory = VK_NULL_HANDLE;
+    VkBuffer drawParamsBuffer = VK_NULL_HANDLE;
+    VkDeviceMemory drawParamsBufferMemory = VK_NULL_HANDLE;
+    uint32_t indexCount = 0;
+};
+
+constexpr int MAX_VERTEX_BONES = 4;
+
+// Strongest bone influences on a skinned vertex; unused slots have weight 0
+struct VertexSkin {
+    uint32_t joints[MAX_VERTEX_BONES] = {}; // Into the mesh's bones
+    float weights[MAX_VERTEX_BONES] = {};
+};
+
+// A bone of a skinned mesh: the skeleton node it follows and its offset (inverse bind) matrix
+struct MeshBone {
+    int node; // -1 if the node wasn't found
+    glm::mat4 offset;
+};
+
 // Mesh structure with GPU buffers
 struct Mesh {
     std::vector<Vertex> vertices;
@@ -132,70 +833,349 @@ struct Mesh {
     VkBuffer drawParamsBuffer = VK_NULL_HANDLE;
     VkDeviceMemory drawParamsBufferMemory = VK_NULL_HANDLE;
     uint32_t indexCount = 0;
+    std::vector<MeshLod> lods; // Generated LODs 1..n; LOD 0 is the mesh itself
+
+    // Dynamic meshes keep one vertex buffer per frame in flight so the CPU never writes a
+    // buffer the GPU may still be reading. Updates are copied into a frame's buffer when
+    // that frame is recorded, after its fence has been waited on.
+    bool dynamic = false;
+    VkBuffer frameVertexBuffers[MAX_FRAMES_IN_FLIGHT] = {};
+    VkDeviceMemory frameVertexBufferMemory[MAX_FRAMES_IN_FLIGHT] = {};
+    uint32_t dirtyBegin[MAX_FRAMES_IN_FLIGHT] = {}; // Dirty vertex range per frame buffer
+    uint32_t dirtyEnd[MAX_FRAMES_IN_FLIGHT] = {};
+
+    // Meshes of animated models are dynamic and skinned on the CPU from their bind pose
+    int node = -1; // Skeleton node the mesh hangs from
+    std::vector<MeshBone> bones;
+    std::vector<VertexSkin> skin;     // Per vertex; empty for meshes that only follow their node
+    std::vector<Vertex> bindVertices; // Vertices in the bind pose
+
+    int material = -1; // Index into Model::materials, -1 for the entity's own material
 
     ~Mesh() {
         // Cleanup is handled separately to ensure proper Vulkan device context
     }
 };
 
+// Bind pose bounds of the vertices a bone mostly drives, in model space
+struct BoneBox {
+    std::string name;
+    glm::vec3 min;
+    glm::vec3 max;
+};
+
+constexpr float BONE_BOX_MIN_WEIGHT = 0.5f;
+constexpr double DEFAULT_ANIMATION_TICKS_PER_SECOND = 25.0; // Assimp's default when a file has none
+
+// Node of an animated model's hierarchy. Parents come before their children.
+struct SkeletonNode {
+    std::string name;
+    int parent; // -1 for the root
+    glm::vec3 position; // Bind pose, relative to the parent
+    glm::quat rotation;
+    glm::vec3 scale;
+    glm::mat4 bindGlobal; // Bind pose, in model space
+};
+
+template <typename T>
+struct AnimationKey {
+    float time; // Seconds
+    T value;
+};
+
+// Keys of one node in a clip; nodes without a channel keep their bind pose
+struct AnimationChannel {
+    int node;
+    std::vector<AnimationKey<glm::vec3>> positions;
+    std::vector<AnimationKey<glm::quat>> rotations;
+    std::vector<AnimationKey<glm::vec3>> scales;
+};
+
+struct AnimationClip {
+    std::string name;
+    float duration; // Seconds
+    std::vector<AnimationChannel> channels;
+};
+
+// Node hierarchy and clips copied out of an imported scene, which the importer frees on its
+// next import
+struct Skeleton {
+    std::vector<SkeletonNode> nodes;
+    std::vector<AnimationClip> clips;
+};
+
+// Clip playing on a model and the one it is crossfading out of
+struct AnimationState {
+    int clip = -1; // -1 holds the bind pose
+    float time = 0.0f;
+    bool loop = true;
+    int previousClip = -1;
+    float previousTime = 0.0f;
+    bool previousLoop = true;
+    float fade = 0.0f;         // Seconds into the crossfade
+    float fadeDuration = 0.0f; // 0 when not fading
+    float speed = 1.0f;
+    bool paused = false;
+    bool dirty = false; // Pose changed since the meshes were last skinned
+};
+
+// Texture embedded in a model file: compressed (PNG, JPEG) when width is 0, else RGBA
+struct EmbeddedTexture {
+    std::vector<uint8_t> data;
+    uint32_t width = 0;
+    uint32_t height = 0;
+};
+
+// Material as a model file describes it. Texture paths are relative to the file, or "*N"
+// for embedded texture N.
+struct ModelFileMaterial {
+    std::string name;
+    StandardMaterial values;
+    std::string textures[MATERIAL_MAX_TEXTURES];
+};
+
+// Materials copied out of an imported scene
+struct ModelMaterials {
+    std::vector<ModelFileMaterial> materials;
+    std::vector<EmbeddedTexture> embedded;
+};
+
 // Model component
 struct Model {
     std::string path;
     const aiScene* scene;
     std::vector<Mesh> meshes;
+    int lod = 0; // LOD drawn by the renderer
+    bool visible = true;
+    std::vector<BoneBox> bones;
+    std::shared_ptr<const Skeleton> skeleton; // Only for models with animations
+    AnimationState animation;
+    std::shared_ptr<const ModelMaterials> fileMaterials; // As imported
+    std::vector<Material> materials; // Per file material; only params and textures are used
+};
+
+// Resolves shader #include directives. "file" is looked up next to the including file and
+// then under the include root, <file> only under the include root.
+class ShaderIncluder : public shaderc::CompileOptions::IncluderInterface {
+public:
+    explicit ShaderIncluder(std::string root) : root(root.empty() ? "." : std::move(root)) {}
+
+    shaderc_include_result* GetInclude(const char* requested, shaderc_include_type type,
+                                       const char* requesting, size_t depth) override {
+        auto* include = new Include;
+
+        std::vector<std::filesystem::path> candidates;
+        std::filesystem::path requestingDir = std::filesystem::path(requesting).parent_path();
+        if (type == shaderc_include_type_relative && !requestingDir.empty()) {
+            candidates.push_back(requestingDir / requested);
+        }
+        candidates.push_back(std::filesystem::path(root) / requested);
+
+        if (depth > MAX_INCLUDE_DEPTH) {
+            include->content = "include depth exceeds " + std::to_string(MAX_INCLUDE_DEPTH) + " (recursive #include?)";
+        } else {
+            for (const auto& candidate : candidates) {
+                std::ifstream file(candidate, std::ios::binary);
+                if (file) {
+                    include->name = candidate.lexically_normal().generic_string();
+                    include->content.assign(std::istreambuf_iterator<char>(file), std::istreambuf_iterator<char>());
+                    break;
+                }
+            }
+            if (include->name.empty()) {
+                include->content = std::string("cannot find include file ") + requested;
+            }
+        }
+
+        // An empty source name tells shaderc the include failed, with content as the error
+        include->result = {include->name.c_str(), include->name.size(),
+                           include->content.c_str(), include->content.size(), include};
+        return &include->result;
+    }
+
+    void ReleaseInclude(shaderc_include_result* data) override {
+        delete static_cast<Include*>(data->user_data);
+    }
+
+private:
+    static constexpr size_t MAX_INCLUDE_DEPTH = 32;
+
+    std::string root;
+
+    struct Include {
+        std::string name;
+        std::string content;
+        shaderc_include_result result;
+    };
 };
 
-// Shader compilation helper
-static std::vector<uint32_t> compileShader(const std::string& source, shaderc_shader_kind kind, const char* name) {
+// Why the last exported call on this thread failed, for boulder_get_last_error. Entering
+// an exported function (NATIVE_TRY) clears the code, so a reason never outlives its call.
+static thread_local LastError t_lastError;
+
+// Records why the current call failed without logging it
+static void setLastError(int code, std::string message) {
+    t_lastError.code = code;
+    t_lastError.message = std::move(message);
+}
+
+// Logs an error and records it as why the current call failed
+template<typename... Args>
+static void fail(int code, std::format_string<Args...> fmt, Args&&... args) {
+    std::string message = std::format(fmt, std::forward<Args>(args)...);
+    Logger::get().error("{}", message);
+    setLastError(code, std::move(message));
+}
+
+// Records that an entity lacks the component a call needs
+static void missingComponent(flecs::entity_t entity, const char* component) {
+    setLastError(ERROR_NOT_FOUND, std::format("Entity {} has no {}", entity, component));
+}
+
+// Shader compilation helper. Defines are macro name and value pairs; variants are cached
+// by their preprocessed source, so recompiling an unchanged variant is a lookup. Safe to
+// call from worker threads.
+static std::vector<uint32_t> compileShader(const std::string& source, shaderc_shader_kind kind, const char* name,
+                                           const std::vector<std::pair<std::string, std::string>>& defines = {}) {
     shaderc::Compiler compiler;
     shaderc::CompileOptions options;
+    std::string includeRoot;
+    {
+        std::lock_guard<std::mutex> lock(g_engine.shaderCacheMutex);
+        includeRoot = g_engine.shaderIncludeRoot;
+    }
 
     // Use Vulkan 1.2 for better compatibility with glslang
     options.SetTargetEnvironment(shaderc_target_env_vulkan, shaderc_env_version_vulkan_1_2);
     options.SetTargetSpirv(shaderc_spirv_version_1_5);
+    options.SetIncluder(std::make_unique<ShaderIncluder>(includeRoot));
+    for (const auto& [macro, value] : defines) {
+        options.AddMacroDefinition(macro, value);
+    }
+
+    // The whole preprocessed source is the key, so no two shaders can share an entry
+    std::string cacheKey;
+    if (!defines.empty()) {
+        auto preprocessed = compiler.PreprocessGlsl(source, kind, name, options);
+        if (preprocessed.GetCompilationStatus() != shaderc_compilation_status_success) {
+            fail(ERROR_SHADER, "Shader compilation failed for {}: {}", name, preprocessed.GetErrorMessage());
+            return {};
+        }
+
+        cacheKey.assign(preprocessed.cbegin(), preprocessed.cend());
+        cacheKey += '\0' + std::to_string(kind);
+        std::lock_guard<std::mutex> lock(g_engine.shaderCacheMutex);
+        auto cached = g_engine.shaderVariantCache.find(cacheKey);
+        if (cached != g_engine.shaderVariantCache.end()) {
+            return cached->second;
+        }
+    }
 
     auto result = compiler.CompileGlslToSpv(source, kind, name, options);
 
     if (result.GetCompilationStatus() != shaderc_compilation_status_success) {
-        Logger::get().error("Shader compilation failed for {}: {}", name, result.GetErrorMessage());
+        fail(ERROR_SHADER, "Shader compilation failed for {}: {}", name, result.GetErrorMessage());
         return {};
     }
 
     Logger::get().info("Shader {} compiled successfully", name);
 
-    return {result.cbegin(), result.cend()};
+    std::vector<uint32_t> spirv(result.cbegin(), result.cend());
+    if (!cacheKey.empty()) {
+        std::lock_guard<std::mutex> lock(g_engine.shaderCacheMutex);
+        g_engine.shaderVariantCache[std::move(cacheKey)] = spirv;
+    }
+    return spirv;
 }
 
-extern "C" {
+// Records a misused API call for boulder_take_api_error
+static void apiMisuse(const std::string& message) {
+    Logger::get().error("API misuse: {}", message);
+    setLastError(ERROR_API_MISUSE, message);
+    std::lock_guard<std::mutex> lock(g_engine.apiErrorMutex);
+    g_engine.apiError = message;
+}
 
-int boulder_init(const char* appName, uint version) {
-    if (g_engine.initialized) {
+// Records an exception caught at the C boundary for boulder_take_native_error. Call only
+// from a catch block.
+static void nativeException(const char* function) {
+    std::string message;
+    try {
+        throw;
+    } catch (const std::exception& e) {
+        message = std::string(function) + ": " + e.what();
+    } catch (...) {
+        message = std::string(function) + ": unknown exception";
+    }
+
+    Logger::get().error("Native exception in {}", message);
+    setLastError(ERROR_NATIVE_EXCEPTION, message);
+    std::lock_guard<std::mutex> lock(g_engine.nativeErrorMutex);
+    g_engine.nativeError = message;
+}
+
+// Exported functions run their body between these, so C++ exceptions never unwind into
+// Go. A caught exception is recorded and the function returns fallback (empty for void).
+#define NATIVE_TRY t_lastError.code = ERROR_UNKNOWN; try {
+#define NATIVE_CATCH(fallback) } catch (...) { nativeException(__func__); return fallback; }
+
+// Copies a recorded error message into buffer and clears it, returning its length
+static uint32_t takeErrorMessage(std::mutex& mutex, std::string& message, char* buffer, uint32_t capacity) {
+    std::lock_guard<std::mutex> lock(mutex);
+    uint32_t length = static_cast<uint32_t>(message.size());
+    if (length == 0) {
         return 0;
     }
 
-    setenv("SDL_VIDEODRIVER", "x11", 1);
-    
-    // Try to initialize SDL with just events first
-    if (!SDL_Init(SDL_INIT_EVENTS)) {
-        Logger::get().error( "SDL_Init EVENTS failed: {}", SDL_GetError());
-        return -1;
+    if (buffer && capacity > 0) {
+        uint32_t copied = std::min(length, capacity - 1);
+        memcpy(buffer, message.data(), copied);
+        buffer[copied] = '\0';
     }
+    message.clear();
+    return length;
+}
 
-    // Try to add video subsystem
-    if (!SDL_InitSubSystem(SDL_INIT_VIDEO)) {
-        Logger::get().error("SDL_InitSubSystem VIDEO failed: {}", SDL_GetError());
-        Logger::get().info("Continuing without video subsystem...");
-        // Don't return -1, continue without video
+// Copies a C string into a caller's buffer, truncating it to fit, and returns its full length
+static uint32_t copyString(const char* text, char* buffer, uint32_t capacity) {
+    if (!text) {
+        text = "";
     }
-    
 
-    g_engine.ecs = new flecs::world();
-    g_engine.importer = std::make_unique<Assimp::Importer>();
+    uint32_t length = static_cast<uint32_t>(strlen(text));
+    if (buffer && capacity > 0) {
+        uint32_t copied = std::min(length, capacity - 1);
+        memcpy(buffer, text, copied);
+        buffer[copied] = '\0';
+    }
+    return length;
+}
 
+// Forwards validation layer messages to the log; errors are recorded as API misuse
+static VKAPI_ATTR VkBool32 VKAPI_CALL validationCallback(VkDebugUtilsMessageSeverityFlagBitsEXT severity,
+                                                         VkDebugUtilsMessageTypeFlagsEXT,
+                                                         const VkDebugUtilsMessengerCallbackDataEXT* data, void*) {
+    if (severity & VK_DEBUG_UTILS_MESSAGE_SEVERITY_ERROR_BIT_EXT) {
+        apiMisuse(std::string("Vulkan validation: ") + data->pMessage);
+    } else if (severity & VK_DEBUG_UTILS_MESSAGE_SEVERITY_WARNING_BIT_EXT) {
+        Logger::get().warning("Vulkan validation: {}", data->pMessage);
+    }
+    return VK_FALSE;
+}
+
+static void destroyDebugMessenger() {
+    if (g_engine.debugMessenger) {
+        vkDestroyDebugUtilsMessengerEXT(g_engine.instance, g_engine.debugMessenger, nullptr);
+        g_engine.debugMessenger = VK_NULL_HANDLE;
+    }
+}
+
+// Creates the Vulkan instance for g_engine.appName (used by boulder_init and boulder_restart)
+static int createInstance() {
     VkResult err;
 
     if ( (err = volkInitialize()) != VK_SUCCESS) {
-        Logger::get().error("Volk initialization failed! {}", (int)err);
+        fail(ERROR_VULKAN, "Volk initialization failed! {}", (int)err);
         return -1;
     } else {
         Logger::get().info("Volk initialization successful!");
@@ -204,8 +1184,8 @@ int boulder_init(const char* appName, uint version) {
     VkApplicationInfo appInfo{};
 
     appInfo.sType = VK_STRUCTURE_TYPE_APPLICATION_INFO;
-    appInfo.pApplicationName = appName;
-    appInfo.applicationVersion = version;
+    appInfo.pApplicationName = g_engine.appName.c_str();
+    appInfo.applicationVersion = g_engine.appVersion;
     appInfo.pEngineName = "Boulder Engine";
     appInfo.engineVersion = VK_MAKE_VERSION(0, 0, 1);
     appInfo.apiVersion = VK_API_VERSION_1_4;  // Targeting Vulkan 1.4
@@ -219,11 +1199,11 @@ int boulder_init(const char* appName, uint version) {
 
 
     if (sdlExtensionCount == 0) {
-        Logger::get().error("SDL_Vulkan_GetInstanceExtensions failed: {}", SDL_GetError());
+        fail(ERROR_PLATFORM, "SDL_Vulkan_GetInstanceExtensions failed: {}", SDL_GetError());
         return -1;
     }
     else {
-        for (int i; i < sdlExtensionCount; ++i){
+        for (unsigned int i = 0; i < sdlExtensionCount; ++i){
             Logger::get().info("Instance Extension {}: {}",i,e[i]);
             
             instanceExtensions[i] = e[i];
@@ -235,19 +1215,20 @@ int boulder_init(const char* appName, uint version) {
     uint32_t availableExtensionCount = 0;
     err = vkEnumerateInstanceExtensionProperties(nullptr, &availableExtensionCount, nullptr);
     if (err != VK_SUCCESS) {
-        Logger::get().error("Failed to query instance extension count");
+        fail(ERROR_VULKAN, "Failed to query instance extension count");
         return -1;
     }
 
     bool hasSurfaceCapabilities2 = false;
+    bool portability = false;
 
     if (availableExtensionCount > 0) {
         auto extensionProps = ScopedAlloc<VkExtensionProperties>(availableExtensionCount);
 
         err = vkEnumerateInstanceExtensionProperties(nullptr, &availableExtensionCount, extensionProps.get());
         if (err != VK_SUCCESS) {
-            Logger::get().error("Failed to enumerate instance extensions");
-            return false;
+            fail(ERROR_VULKAN, "Failed to enumerate instance extensions");
+            return -1;
             }
 
         for (uint32_t i = 0; i < availableExtensionCount; ++i) {
@@ -261,114 +1242,533 @@ int boulder_init(const char* appName, uint version) {
                     VK_KHR_GET_SURFACE_CAPABILITIES_2_EXTENSION_NAME;
                 Logger::get().info("Device has surface capabilites 2!");
             }
+
+            // MoltenVK and other layered drivers are only listed with portability enumeration
+            if (strcmp(VK_KHR_PORTABILITY_ENUMERATION_EXTENSION_NAME, extName) == 0) {
+                portability = true;
+                instanceExtensions[sdlExtensionCount + additionalExtensionCount++] =
+                    VK_KHR_PORTABILITY_ENUMERATION_EXTENSION_NAME;
+                Logger::get().info("Portability enumeration enabled");
+            }
         }
 
-        // Enable validation layers for debugging
-        const char* validationLayers[] = {}; //VK_LAYER_KHRONOS_validation
+        // Enable validation layers in debug mode, when installed
+        const char* validationLayers[] = {"VK_LAYER_KHRONOS_validation"};
+        bool validation = false;
+        if (g_engine.debugMode) {
+            uint32_t layerCount = 0;
+            vkEnumerateInstanceLayerProperties(&layerCount, nullptr);
+            std::vector<VkLayerProperties> layers(layerCount);
+            vkEnumerateInstanceLayerProperties(&layerCount, layers.data());
+
+            bool debugUtils = false;
+            for (uint32_t i = 0; i < availableExtensionCount; ++i) {
+                if (strcmp(extensionProps[i].extensionName, VK_EXT_DEBUG_UTILS_EXTENSION_NAME) == 0) {
+                    debugUtils = true;
+                }
+            }
+            for (const auto& layer : layers) {
+                if (strcmp(layer.layerName, validationLayers[0]) == 0) {
+                    validation = debugUtils;
+                }
+            }
+
+            if (validation) {
+                instanceExtensions[sdlExtensionCount + additionalExtensionCount++] = VK_EXT_DEBUG_UTILS_EXTENSION_NAME;
+                Logger::get().info("Debug mode: Vulkan validation enabled");
+            } else {
+                Logger::get().warning("Debug mode: Vulkan validation layer not installed");
+            }
+        }
 
         VkInstanceCreateInfo createInfo{};
         createInfo.sType = VK_STRUCTURE_TYPE_INSTANCE_CREATE_INFO;
         createInfo.pApplicationInfo = &appInfo;
+        createInfo.flags = portability ? VK_INSTANCE_CREATE_ENUMERATE_PORTABILITY_BIT_KHR : 0;
         createInfo.enabledExtensionCount = sdlExtensionCount + additionalExtensionCount;
         createInfo.ppEnabledExtensionNames = instanceExtensions.get();
-        createInfo.enabledLayerCount = 0;
-        createInfo.ppEnabledLayerNames = nullptr;
+        createInfo.enabledLayerCount = validation ? 1 : 0;
+        createInfo.ppEnabledLayerNames = validation ? validationLayers : nullptr;
 
         // Create the Vulkan instance now while pointers are valid
         err = vkCreateInstance(&createInfo, nullptr, &g_engine.instance);
         if (err != VK_SUCCESS) {
-            Logger::get().error("Failed to create Vulkan instance: {}", (int)err);
+            fail(ERROR_VULKAN, "Failed to create Vulkan instance: {}", (int)err);
             return -1;
         }
         Logger::get().info("Vulkan instance created!");
 
         volkLoadInstance(g_engine.instance);
-    }
 
-    g_engine.initialized = true;
+        if (validation) {
+            VkDebugUtilsMessengerCreateInfoEXT messengerInfo{};
+            messengerInfo.sType = VK_STRUCTURE_TYPE_DEBUG_UTILS_MESSENGER_CREATE_INFO_EXT;
+            messengerInfo.messageSeverity = VK_DEBUG_UTILS_MESSAGE_SEVERITY_WARNING_BIT_EXT |
+                                            VK_DEBUG_UTILS_MESSAGE_SEVERITY_ERROR_BIT_EXT;
+            messengerInfo.messageType = VK_DEBUG_UTILS_MESSAGE_TYPE_VALIDATION_BIT_EXT |
+                                        VK_DEBUG_UTILS_MESSAGE_TYPE_PERFORMANCE_BIT_EXT;
+            messengerInfo.pfnUserCallback = validationCallback;
+            if (vkCreateDebugUtilsMessengerEXT(g_engine.instance, &messengerInfo, nullptr, &g_engine.debugMessenger) != VK_SUCCESS) {
+                Logger::get().warning("Failed to create validation messenger");
+            }
+        }
+    }
 
     return 0;
 }
 
-// Forward declaration
-static void destroyDepthResources();
-
-void boulder_shutdown() {
-    if (!g_engine.initialized) {
+static void queueComponentEvent(flecs::entity_t entity, int component, int kind) {
+    if (component == COMPONENT_TRANSFORM) {
+        g_engine.spatialDirty = true;
+    }
+    // Events only cover the active world; IDs of other worlds would mean other entities
+    if (g_engine.boundWorld != g_engine.activeWorld) {
         return;
     }
+    if (g_engine.watchedComponents[component] & (1 << kind)) {
+        g_engine.componentEvents.push_back({entity, component, kind, g_engine.changeTick});
+    }
+}
 
-    Logger::get().info("Shutting down engine...");
+// Records that a component changed; queues at most one change event per entity per tick
+static void markChanged(flecs::entity_t entity, int component) {
+    if (component == COMPONENT_TRANSFORM) {
+        g_engine.spatialDirty = true;
+    }
+    if (!(g_engine.watchedComponents[component] & ((1 << COMPONENT_EVENT_CHANGED) | COMPONENT_TRACK_CHANGES)) ||
+        g_engine.boundWorld != g_engine.activeWorld) {
+        return;
+    }
 
-    // Wait for device to be idle before cleanup
-    if (g_engine.device) {
-        vkDeviceWaitIdle(g_engine.device);
+    uint64_t& tick = g_engine.changeTicks[component][entity];
+    if (tick != g_engine.changeTick) {
+        tick = g_engine.changeTick;
+        queueComponentEvent(entity, component, COMPONENT_EVENT_CHANGED);
     }
+}
 
-    // Cleanup UI system after device is idle
-    boulder_ui_cleanup();
+template <typename T>
+static void observeComponent(int component) {
+    g_engine.ecs->observer<T>().event(flecs::OnAdd).each([component](flecs::entity e, T&) {
+        queueComponentEvent(e.id(), component, COMPONENT_EVENT_ADDED);
+    });
+    g_engine.ecs->observer<T>().event(flecs::OnRemove).each([component](flecs::entity e, T&) {
+        queueComponentEvent(e.id(), component, COMPONENT_EVENT_REMOVED);
+        g_engine.changeTicks[component].erase(e.id());
+    });
+    g_engine.ecs->observer<T>().event(flecs::OnSet).each([component](flecs::entity e, T&) {
+        markChanged(e.id(), component);
+    });
+}
 
-    // Cleanup Vulkan resources
-    if (g_engine.device) {
-        // Cleanup pipeline and shaders
-        if (g_engine.cubePipeline) {
-            vkDestroyPipeline(g_engine.device, g_engine.cubePipeline, nullptr);
-            g_engine.cubePipeline = nullptr;
-        }
-        if (g_engine.pipelineLayout) {
-            vkDestroyPipelineLayout(g_engine.device, g_engine.pipelineLayout, nullptr);
-            g_engine.pipelineLayout = nullptr;
-        }
-        if (g_engine.meshShaderModule) {
-            vkDestroyShaderModule(g_engine.device, g_engine.meshShaderModule, nullptr);
-            g_engine.meshShaderModule = nullptr;
-        }
-        if (g_engine.fragShaderModule) {
-            vkDestroyShaderModule(g_engine.device, g_engine.fragShaderModule, nullptr);
-            g_engine.fragShaderModule = nullptr;
-        }
+// Registers the observers behind component events (called when the ECS world is created)
+static void observeComponents() {
+    observeComponent<Transform>(COMPONENT_TRANSFORM);
+    observeComponent<PhysicsBody>(COMPONENT_PHYSICS_BODY);
+    observeComponent<Model>(COMPONENT_MODEL);
+    observeComponent<BuoyancyVolume>(COMPONENT_BUOYANCY_VOLUME);
+    observeComponent<Buoyant>(COMPONENT_BUOYANT);
+    observeComponent<SoftBody>(COMPONENT_SOFT_BODY);
+    observeComponent<Collider>(COMPONENT_COLLIDER);
+}
 
-        // Cleanup model rendering pipeline and resources
-        for (size_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
-            if (g_engine.modelDescriptorPools[i]) {
-                vkDestroyDescriptorPool(g_engine.device, g_engine.modelDescriptorPools[i], nullptr);
-                g_engine.modelDescriptorPools[i] = nullptr;
-            }
-        }
-        if (g_engine.modelDescriptorSetLayout) {
-            vkDestroyDescriptorSetLayout(g_engine.device, g_engine.modelDescriptorSetLayout, nullptr);
-            g_engine.modelDescriptorSetLayout = nullptr;
-        }
-        if (g_engine.modelPipeline) {
-            vkDestroyPipeline(g_engine.device, g_engine.modelPipeline, nullptr);
-            g_engine.modelPipeline = nullptr;
-        }
-        if (g_engine.modelPipelineLayout) {
-            vkDestroyPipelineLayout(g_engine.device, g_engine.modelPipelineLayout, nullptr);
-            g_engine.modelPipelineLayout = nullptr;
-        }
-        if (g_engine.modelMeshShader) {
-            vkDestroyShaderModule(g_engine.device, g_engine.modelMeshShader, nullptr);
-            g_engine.modelMeshShader = nullptr;
-        }
-        if (g_engine.modelFragShader) {
-            vkDestroyShaderModule(g_engine.device, g_engine.modelFragShader, nullptr);
-            g_engine.modelFragShader = nullptr;
-        }
+static void resetSpatialIndex() {
+    g_engine.spatialDirty = true;
+    g_engine.spatialGrid.clear();
+}
 
-        for (size_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
-            vkDestroySemaphore(g_engine.device, g_engine.imageAvailableSemaphores[i], nullptr);
-            vkDestroySemaphore(g_engine.device, g_engine.renderFinishedSemaphores[i], nullptr);
+static void resetComponentEvents() {
+    g_engine.changeTick = 1;
+    g_engine.componentEvents.clear();
+    for (int i = 0; i < COMPONENT_COUNT; i++) {
+        g_engine.watchedComponents[i] = 0;
+        g_engine.changeTicks[i].clear();
+    }
+}
+
+static void resetCollisionEvents() {
+    g_engine.physicsStep = 0;
+    g_engine.contacts.clear();
+    g_engine.collisionEventsWatched = false;
+    g_engine.collisionEvents.clear();
+}
+
+// Makes API calls act on a world. The spatial index only covers one world at a time.
+static bool bindWorld(uint32_t world) {
+    if (world == g_engine.boundWorld) {
+        return true;
+    }
+    auto it = g_engine.worlds.find(world);
+    if (it == g_engine.worlds.end()) {
+        return false;
+    }
+    g_engine.ecs = it->second;
+    g_engine.boundWorld = world;
+    resetSpatialIndex();
+    return true;
+}
+
+// Binds the active world while it is simulated or drawn, restoring the bound world after
+struct ActiveWorldScope {
+    uint32_t previous = g_engine.boundWorld;
+
+    ActiveWorldScope() { bindWorld(g_engine.activeWorld); }
+    ~ActiveWorldScope() { bindWorld(previous); }
+};
+
+static uint32_t createWorld() {
+    uint32_t id = g_engine.nextWorldId++;
+    g_engine.worlds[id] = new flecs::world();
+
+    uint32_t previous = g_engine.boundWorld;
+    bindWorld(id);
+    observeComponents();
+    bindWorld(previous);
+    return id;
+}
+
+static void destroyWorlds() {
+    for (auto& [id, world] : g_engine.worlds) {
+        delete world;
+    }
+    g_engine.worlds.clear();
+    g_engine.ecs = nullptr;
+    g_engine.boundWorld = 0;
+    g_engine.activeWorld = 0;
+    g_engine.nextWorldId = DEFAULT_WORLD;
+}
+
+extern "C" {
+
+int boulder_init(const char* appName, uint version) {
+    NATIVE_TRY
+    if (g_engine.initialized) {
+        return 0;
+    }
+
+    setenv("SDL_VIDEODRIVER", "x11", 1);
+    
+    // Try to initialize SDL with just events first
+    if (!SDL_Init(SDL_INIT_EVENTS)) {
+        fail(ERROR_PLATFORM, "SDL_Init EVENTS failed: {}", SDL_GetError());
+        return -1;
+    }
+
+    // Try to add video subsystem
+    if (!SDL_InitSubSystem(SDL_INIT_VIDEO)) {
+        fail(ERROR_PLATFORM, "SDL_InitSubSystem VIDEO failed: {}", SDL_GetError());
+        Logger::get().info("Continuing without video subsystem...");
+        // Don't return -1, continue without video
+    }
+
+    // Controllers already connected arrive as SDL_EVENT_GAMEPAD_ADDED and are opened then
+    if (!SDL_InitSubSystem(SDL_INIT_GAMEPAD)) {
+        fail(ERROR_PLATFORM, "SDL_InitSubSystem GAMEPAD failed: {}", SDL_GetError());
+        Logger::get().info("Continuing without controllers...");
+    }
+    
+
+    createWorld();
+    bindWorld(DEFAULT_WORLD);
+    g_engine.activeWorld = DEFAULT_WORLD;
+    g_engine.importer = std::make_unique<Assimp::Importer>();
+
+    g_engine.appName = appName ? appName : "";
+    g_engine.appVersion = version;
+
+    if (createInstance() != 0) {
+        destroyWorlds();
+        g_engine.importer.reset();
+        SDL_Quit();
+        return -1;
+    }
+
+    g_engine.initialized = true;
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+// Returns true if a GPU has the mesh shader extension the renderer needs
+static bool deviceSupportsMeshShaders(VkPhysicalDevice device) {
+    uint32_t extensionCount = 0;
+    vkEnumerateDeviceExtensionProperties(device, nullptr, &extensionCount, nullptr);
+    std::vector<VkExtensionProperties> extensions(extensionCount);
+    vkEnumerateDeviceExtensionProperties(device, nullptr, &extensionCount, extensions.data());
+
+    for (const auto& ext : extensions) {
+        if (strcmp(ext.extensionName, VK_EXT_MESH_SHADER_EXTENSION_NAME) == 0) {
+            return true;
+        }
+    }
+    return false;
+}
+
+// Returns the total size of a GPU's device-local memory heaps
+static uint64_t deviceLocalMemory(VkPhysicalDevice device) {
+    VkPhysicalDeviceMemoryProperties memProperties;
+    vkGetPhysicalDeviceMemoryProperties(device, &memProperties);
+
+    uint64_t total = 0;
+    for (uint32_t i = 0; i < memProperties.memoryHeapCount; i++) {
+        if (memProperties.memoryHeaps[i].flags & VK_MEMORY_HEAP_DEVICE_LOCAL_BIT) {
+            total += memProperties.memoryHeaps[i].size;
+        }
+    }
+    return total;
+}
+
+// Picks the GPU to create the device on: the pinned index if valid, otherwise the first
+// supported GPU matching the preference, otherwise the first supported GPU
+static int selectPhysicalDevice(const std::vector<VkPhysicalDevice>& devices) {
+    int count = static_cast<int>(devices.size());
+    if (g_engine.requestedGpu >= 0) {
+        if (g_engine.requestedGpu < count) {
+            return g_engine.requestedGpu;
+        }
+        Logger::get().warning("Requested GPU {} not found ({} available), selecting automatically",
+                              g_engine.requestedGpu, count);
+    }
+
+    VkPhysicalDeviceType wanted = VK_PHYSICAL_DEVICE_TYPE_MAX_ENUM;
+    if (g_engine.gpuPreference == GPU_PREFERENCE_HIGH_PERFORMANCE) {
+        wanted = VK_PHYSICAL_DEVICE_TYPE_DISCRETE_GPU;
+    } else if (g_engine.gpuPreference == GPU_PREFERENCE_LOW_POWER) {
+        wanted = VK_PHYSICAL_DEVICE_TYPE_INTEGRATED_GPU;
+    }
+
+    int firstSupported = -1;
+    for (int i = 0; i < count; i++) {
+        if (!deviceSupportsMeshShaders(devices[i])) {
+            continue;
+        }
+        if (firstSupported < 0) {
+            firstSupported = i;
+        }
+
+        VkPhysicalDeviceProperties properties;
+        vkGetPhysicalDeviceProperties(devices[i], &properties);
+        if (properties.deviceType == wanted) {
+            return i;
+        }
+    }
+
+    return firstSupported >= 0 ? firstSupported : 0;
+}
+
+// Forward declarations
+static void destroyDepthResources();
+static size_t pollAsyncCompiles(bool wait);
+static void resetFrameTimings();
+static void closeMotionSensors();
+static void closeControllers();
+static VkPipeline createPipeline(VkShaderModule meshModule, VkShaderModule fragModule, VkPipelineLayout layout,
+                                 VkCullModeFlags cullMode, VkFrontFace frontFace, int blendMode = BLEND_MODE_OPAQUE,
+                                 const VkPipelineDepthStencilStateCreateInfo* depthStencilState = nullptr,
+                                 VkColorComponentFlags colorWriteMask = VK_COLOR_COMPONENT_R_BIT | VK_COLOR_COMPONENT_G_BIT |
+                                                                        VK_COLOR_COMPONENT_B_BIT | VK_COLOR_COMPONENT_A_BIT);
+
+// Releases a mesh's GPU buffers, keeping its vertices and indices
+static void destroyMeshBuffers(Mesh& mesh) {
+    if (mesh.vertexBuffer != VK_NULL_HANDLE) {
+        vkDestroyBuffer(g_engine.device, mesh.vertexBuffer, nullptr);
+        mesh.vertexBuffer = VK_NULL_HANDLE;
+    }
+    if (mesh.vertexBufferMemory != VK_NULL_HANDLE) {
+        freeDeviceMemory(g_engine.device, mesh.vertexBufferMemory, nullptr);
+        mesh.vertexBufferMemory = VK_NULL_HANDLE;
+    }
+    if (mesh.indexBuffer != VK_NULL_HANDLE) {
+        vkDestroyBuffer(g_engine.device, mesh.indexBuffer, nullptr);
+        mesh.indexBuffer = VK_NULL_HANDLE;
+    }
+    if (mesh.indexBufferMemory != VK_NULL_HANDLE) {
+        freeDeviceMemory(g_engine.device, mesh.indexBufferMemory, nullptr);
+        mesh.indexBufferMemory = VK_NULL_HANDLE;
+    }
+    if (mesh.drawParamsBuffer != VK_NULL_HANDLE) {
+        vkDestroyBuffer(g_engine.device, mesh.drawParamsBuffer, nullptr);
+        mesh.drawParamsBuffer = VK_NULL_HANDLE;
+    }
+    if (mesh.drawParamsBufferMemory != VK_NULL_HANDLE) {
+        freeDeviceMemory(g_engine.device, mesh.drawParamsBufferMemory, nullptr);
+        mesh.drawParamsBufferMemory = VK_NULL_HANDLE;
+    }
+    for (uint32_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
+        vkDestroyBuffer(g_engine.device, mesh.frameVertexBuffers[i], nullptr);
+        freeDeviceMemory(g_engine.device, mesh.frameVertexBufferMemory[i], nullptr);
+        mesh.frameVertexBuffers[i] = VK_NULL_HANDLE;
+        mesh.frameVertexBufferMemory[i] = VK_NULL_HANDLE;
+    }
+    for (auto& lod : mesh.lods) {
+        vkDestroyBuffer(g_engine.device, lod.indexBuffer, nullptr);
+        freeDeviceMemory(g_engine.device, lod.indexBufferMemory, nullptr);
+        vkDestroyBuffer(g_engine.device, lod.drawParamsBuffer, nullptr);
+        freeDeviceMemory(g_engine.device, lod.drawParamsBufferMemory, nullptr);
+        lod.indexBuffer = VK_NULL_HANDLE;
+        lod.indexBufferMemory = VK_NULL_HANDLE;
+        lod.drawParamsBuffer = VK_NULL_HANDLE;
+        lod.drawParamsBufferMemory = VK_NULL_HANDLE;
+    }
+}
+
+// Releases the GPU buffers of every loaded model. The CPU-side vertices and indices are
+// kept so createModelBuffers can upload them again after a device restart.
+static void destroyModelBuffers(flecs::world& world) {
+    world.query<Model>().each([](Model& model) {
+        for (auto& mesh : model.meshes) {
+            destroyMeshBuffers(mesh);
+        }
+    });
+}
+
+static void destroyModelBuffers() {
+    if (!g_engine.device) {
+        return;
+    }
+
+    for (auto& [id, world] : g_engine.worlds) {
+        destroyModelBuffers(*world);
+    }
+}
+
+// Destroys the window and every Vulkan object created from the instance, leaving the
+// engine as it was right after boulder_init. The device must be idle.
+static void destroyDeviceResources() {
+    // Model buffers belong to the device, so they go before it
+    destroyModelBuffers();
+
+    if (g_engine.device) {
+        // Workers compiling shaders and pipelines use the device
+        pollAsyncCompiles(true);
+
+        if (g_engine.screenshotBuffer) {
+            vkDestroyBuffer(g_engine.device, g_engine.screenshotBuffer, nullptr);
+            freeDeviceMemory(g_engine.device, g_engine.screenshotMemory, nullptr);
+            g_engine.screenshotBuffer = VK_NULL_HANDLE;
+            g_engine.screenshotMemory = VK_NULL_HANDLE;
+            g_engine.screenshotSize = 0;
+        }
+        g_engine.screenshotRequested = false;
+        g_engine.screenshotPending = false;
+
+        destroyMaterialResources();
+        destroyOutlineResources();
+        if (g_engine.textureSampler) {
+            vkDestroySampler(g_engine.device, g_engine.textureSampler, nullptr);
+            g_engine.textureSampler = VK_NULL_HANDLE;
+        }
+
+        // Cleanup pipeline and shaders
+        if (g_engine.cubePipeline) {
+            vkDestroyPipeline(g_engine.device, g_engine.cubePipeline, nullptr);
+            g_engine.cubePipeline = nullptr;
+        }
+        if (g_engine.pipelineLayout) {
+            vkDestroyPipelineLayout(g_engine.device, g_engine.pipelineLayout, nullptr);
+            g_engine.pipelineLayout = nullptr;
+        }
+        if (g_engine.meshShaderModule) {
+            vkDestroyShaderModule(g_engine.device, g_engine.meshShaderModule, nullptr);
+            g_engine.meshShaderModule = nullptr;
+        }
+        if (g_engine.fragShaderModule) {
+            vkDestroyShaderModule(g_engine.device, g_engine.fragShaderModule, nullptr);
+            g_engine.fragShaderModule = nullptr;
+        }
+
+        // Cleanup model rendering pipeline and resources
+        for (size_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
+            if (g_engine.modelDescriptorPools[i]) {
+                vkDestroyDescriptorPool(g_engine.device, g_engine.modelDescriptorPools[i], nullptr);
+                g_engine.modelDescriptorPools[i] = nullptr;
+            }
+        }
+        if (g_engine.modelDescriptorSetLayout) {
+            vkDestroyDescriptorSetLayout(g_engine.device, g_engine.modelDescriptorSetLayout, nullptr);
+            g_engine.modelDescriptorSetLayout = nullptr;
+        }
+        if (g_engine.modelPipeline) {
+            vkDestroyPipeline(g_engine.device, g_engine.modelPipeline, nullptr);
+            g_engine.modelPipeline = nullptr;
+        }
+        for (VkPipeline& pipeline : g_engine.modelBlendPipelines) {
+            if (pipeline) {
+                vkDestroyPipeline(g_engine.device, pipeline, nullptr);
+                pipeline = nullptr;
+            }
+        }
+        if (g_engine.modelPipelineLayout) {
+            vkDestroyPipelineLayout(g_engine.device, g_engine.modelPipelineLayout, nullptr);
+            g_engine.modelPipelineLayout = nullptr;
+        }
+        if (g_engine.modelMeshShader) {
+            vkDestroyShaderModule(g_engine.device, g_engine.modelMeshShader, nullptr);
+            g_engine.modelMeshShader = nullptr;
+        }
+        if (g_engine.modelFragShader) {
+            vkDestroyShaderModule(g_engine.device, g_engine.modelFragShader, nullptr);
+            g_engine.modelFragShader = nullptr;
+        }
+
+        // Cleanup pipelines and shaders created through the modular rendering API
+        for (auto& [id, pipeline] : g_engine.pipelines) {
+            vkDestroyPipeline(g_engine.device, pipeline, nullptr);
+        }
+        for (auto& [id, layout] : g_engine.pipelineLayouts) {
+            vkDestroyPipelineLayout(g_engine.device, layout, nullptr);
+        }
+        for (auto& [id, shaderModule] : g_engine.shaderModules) {
+            vkDestroyShaderModule(g_engine.device, shaderModule, nullptr);
+        }
+        for (auto& [id, variants] : g_engine.materialBlendPipelines) {
+            for (VkPipeline variant : variants) {
+                if (variant) {
+                    vkDestroyPipeline(g_engine.device, variant, nullptr);
+                }
+            }
+        }
+        g_engine.pipelines.clear();
+        g_engine.pipelineLayouts.clear();
+        g_engine.materialPipelines.clear();
+        g_engine.defaultMaterialPipeline = 0;
+        g_engine.materialBlendPipelines.clear();
+        g_engine.materialParamNames.clear();
+        g_engine.shaderModules.clear();
+        g_engine.boundPipeline = nullptr;
+        g_engine.boundPipelineId = 0;
+        g_engine.destroyedPipelines.clear();
+        g_engine.activeCommandBuffer = nullptr;
+
+        for (size_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
+            vkDestroySemaphore(g_engine.device, g_engine.imageAvailableSemaphores[i], nullptr);
+            vkDestroySemaphore(g_engine.device, g_engine.renderFinishedSemaphores[i], nullptr);
             vkDestroyFence(g_engine.device, g_engine.inFlightFences[i], nullptr);
+            g_engine.imageAvailableSemaphores[i] = nullptr;
+            g_engine.renderFinishedSemaphores[i] = nullptr;
+            g_engine.inFlightFences[i] = nullptr;
+            g_engine.timestampsWritten[i] = false;
         }
+        if (g_engine.timestampPool) {
+            vkDestroyQueryPool(g_engine.device, g_engine.timestampPool, nullptr);
+            g_engine.timestampPool = nullptr;
+        }
+        g_engine.cpuFrameMs = 0;
+        g_engine.gpuFrameMs = 0;
+        g_engine.frameWaitMs = 0;
+        g_engine.lodBias = 0;
+        g_engine.subsystemTimes = SubsystemTimes{};
         if (g_engine.commandPool) {
             vkDestroyCommandPool(g_engine.device, g_engine.commandPool, nullptr);
             g_engine.commandPool = nullptr;
         }
+        g_engine.commandBuffers.clear();
         for (auto imageView : g_engine.swapchainImageViews) {
             vkDestroyImageView(g_engine.device, imageView, nullptr);
         }
         g_engine.swapchainImageViews.clear();
+        g_engine.swapchainImages.clear();
+        g_engine.imagesInFlight.clear();
         destroyDepthResources();
         if (g_engine.swapchain) {
             vkDestroySwapchainKHR(g_engine.device, g_engine.swapchain, nullptr);
@@ -376,1156 +1776,7603 @@ void boulder_shutdown() {
         }
         vkDestroyDevice(g_engine.device, nullptr);
         g_engine.device = nullptr;
+        g_engine.graphicsQueue = nullptr;
     }
 
-    if (g_engine.instance) {
-        if (g_engine.surface) {
-            vkDestroySurfaceKHR(g_engine.instance, g_engine.surface, nullptr);
-            g_engine.surface = nullptr;
-        }
-        vkDestroyInstance(g_engine.instance, nullptr);
-        g_engine.instance = nullptr;
+    g_engine.physicalDevice = nullptr;
+    g_engine.physicalDeviceIndex = -1;
+    g_engine.graphicsQueueFamily = UINT32_MAX;
+    g_engine.currentFrameIndex = 0;
+    resetFrameTimings();
+    g_engine.swapchainNeedsRecreate = false;
+    g_engine.isRecreatingSwapchain = false;
+    g_engine.resizeEventDuringRecreate = false;
+
+    if (g_engine.instance && g_engine.surface) {
+        vkDestroySurfaceKHR(g_engine.instance, g_engine.surface, nullptr);
+        g_engine.surface = nullptr;
     }
 
     if (g_engine.window) {
         SDL_DestroyWindow(g_engine.window);
         g_engine.window = nullptr;
     }
+}
 
-    // Cleanup model buffers from all entities before deleting ECS
-    if (g_engine.ecs && g_engine.device) {
-        auto query = g_engine.ecs->query<Model>();
-        query.each([](Model& model) {
-            for (auto& mesh : model.meshes) {
-                if (mesh.vertexBuffer != VK_NULL_HANDLE) {
-                    vkDestroyBuffer(g_engine.device, mesh.vertexBuffer, nullptr);
-                    mesh.vertexBuffer = VK_NULL_HANDLE;
-                }
-                if (mesh.vertexBufferMemory != VK_NULL_HANDLE) {
-                    vkFreeMemory(g_engine.device, mesh.vertexBufferMemory, nullptr);
-                    mesh.vertexBufferMemory = VK_NULL_HANDLE;
-                }
-                if (mesh.indexBuffer != VK_NULL_HANDLE) {
-                    vkDestroyBuffer(g_engine.device, mesh.indexBuffer, nullptr);
-                    mesh.indexBuffer = VK_NULL_HANDLE;
-                }
-                if (mesh.indexBufferMemory != VK_NULL_HANDLE) {
-                    vkFreeMemory(g_engine.device, mesh.indexBufferMemory, nullptr);
-                    mesh.indexBufferMemory = VK_NULL_HANDLE;
-                }
-                if (mesh.drawParamsBuffer != VK_NULL_HANDLE) {
-                    vkDestroyBuffer(g_engine.device, mesh.drawParamsBuffer, nullptr);
-                    mesh.drawParamsBuffer = VK_NULL_HANDLE;
-                }
-                if (mesh.drawParamsBufferMemory != VK_NULL_HANDLE) {
-                    vkFreeMemory(g_engine.device, mesh.drawParamsBufferMemory, nullptr);
-                    mesh.drawParamsBufferMemory = VK_NULL_HANDLE;
-                }
-            }
-        });
+void boulder_shutdown() {
+    NATIVE_TRY
+    if (!g_engine.initialized) {
+        return;
     }
 
-    delete g_engine.ecs;
-    g_engine.ecs = nullptr;
+    Logger::get().info("Shutting down engine...");
+
+    // Wait for device to be idle before cleanup
+    if (g_engine.device) {
+        vkDeviceWaitIdle(g_engine.device);
+    }
+
+    // Cleanup UI system after device is idle
+    boulder_ui_cleanup();
+
+    destroyDeviceResources();
+
+    if (g_engine.instance) {
+        destroyDebugMessenger();
+        vkDestroyInstance(g_engine.instance, nullptr);
+        g_engine.instance = nullptr;
+    }
+
+    destroyWorlds();
+    resetComponentEvents();
+    resetCollisionEvents();
+    g_engine.touchEvents.clear();
+    g_engine.touches.clear();
+    g_engine.appEvents.clear();
+    g_engine.windowEvents.clear();
+    g_engine.keyEvents.clear();
+    g_engine.keymapChanged = false;
+    g_engine.paused = false;
+    closeMotionSensors();
+    closeControllers();
+    resetSpatialIndex();
 
     g_engine.importer.reset();
 
     SDL_Quit();
+    g_engine.shouldClose = false;
     g_engine.initialized = false;
+    NATIVE_CATCH()
 }
 
-int boulder_update(float deltaTime) {
-    if (!g_engine.initialized || !g_engine.ecs) {
-        return -1;
-    }
+// Pushes buoyant bodies up out of any volume they are in and slows them down
+static void updateBuoyancy(float deltaTime) {
+    auto volumes = g_engine.ecs->query<const BuoyancyVolume, const Transform>();
+    auto bodies = g_engine.ecs->query<const Transform, PhysicsBody, const Buoyant>();
 
-    // Update physics system
-    // In Flecs v4, we need to create a query first
-    auto query = g_engine.ecs->query<Transform, PhysicsBody>();
-    query.each([deltaTime](Transform& t, PhysicsBody& pb) {
-        t.position += pb.velocity * deltaTime;
-        pb.velocity += pb.acceleration * deltaTime;
-    });
+    bodies.each([&](flecs::entity e, const Transform& t, PhysicsBody& pb, const Buoyant& b) {
+        if (pb.mass <= 0.0f || b.volume <= 0.0f) {
+            return;
+        }
 
-    return 0;
+        float height = std::max(b.height, 0.001f);
+        glm::vec3 bottom = t.position - glm::vec3(0.0f, height * 0.5f, 0.0f);
+
+        volumes.each([&](const BuoyancyVolume& v, const Transform& vt) {
+            glm::vec3 lo = vt.position - v.halfExtents;
+            glm::vec3 hi = vt.position + v.halfExtents;
+            if (t.position.x < lo.x || t.position.x > hi.x ||
+                t.position.z < lo.z || t.position.z > hi.z ||
+                bottom.y > hi.y || bottom.y + height < lo.y) {
+                return;
+            }
+
+            float submerged = std::clamp((hi.y - bottom.y) / height, 0.0f, 1.0f);
+            float lift = v.density * b.volume * submerged * GRAVITY / pb.mass;
+            pb.velocity.y += lift * deltaTime;
+            pb.velocity *= std::max(0.0f, 1.0f - v.linearDrag * submerged * deltaTime);
+            markChanged(e.id(), COMPONENT_PHYSICS_BODY);
+        });
+    });
 }
 
-// Helper function to find suitable memory type
-static uint32_t findMemoryType(uint32_t typeFilter, VkMemoryPropertyFlags properties) {
-    VkPhysicalDeviceMemoryProperties memProperties;
-    vkGetPhysicalDeviceMemoryProperties(g_engine.physicalDevice, &memProperties);
+// Steps each soft body's spring with the acceleration of its entity
+static void updateSoftBodies(float deltaTime) {
+    if (deltaTime <= 0.0f) {
+        return;
+    }
 
-    for (uint32_t i = 0; i < memProperties.memoryTypeCount; i++) {
-        if ((typeFilter & (1 << i)) &&
-            (memProperties.memoryTypes[i].propertyFlags & properties) == properties) {
-            return i;
+    auto query = g_engine.ecs->query<SoftBody, const Transform>();
+    query.each([deltaTime](flecs::entity e, SoftBody& sb, const Transform& t) {
+        markChanged(e.id(), COMPONENT_SOFT_BODY);
+        glm::vec3 velocity = sb.started ? (t.position - sb.lastPosition) / deltaTime : glm::vec3(0.0f);
+        glm::vec3 acceleration = sb.started ? (velocity - sb.lastVelocity) / deltaTime : glm::vec3(0.0f);
+        sb.lastPosition = t.position;
+        sb.lastVelocity = velocity;
+        sb.started = true;
+
+        // The model lags behind acceleration, then springs back
+        glm::vec3 force = -sb.stiffness * sb.offset - sb.damping * sb.offsetVelocity - acceleration * sb.amount;
+        sb.offsetVelocity += force * deltaTime;
+        sb.offset += sb.offsetVelocity * deltaTime;
+
+        float length = glm::length(sb.offset);
+        if (length > SOFT_BODY_MAX_OFFSET) {
+            sb.offset *= SOFT_BODY_MAX_OFFSET / length;
         }
-    }
+    });
+}
 
-    Logger::get().error("Failed to find suitable memory type");
-    return 0;
+// Marks vertices of a dynamic mesh for copying into every frame buffer before it is drawn again
+static void markVerticesDirty(Mesh& mesh, uint32_t offset, uint32_t count) {
+    for (uint32_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
+        if (mesh.dirtyBegin[i] >= mesh.dirtyEnd[i]) {
+            mesh.dirtyBegin[i] = offset;
+            mesh.dirtyEnd[i] = offset + count;
+        } else {
+            mesh.dirtyBegin[i] = std::min(mesh.dirtyBegin[i], offset);
+            mesh.dirtyEnd[i] = std::max(mesh.dirtyEnd[i], offset + count);
+        }
+    }
 }
 
-// Helper function to create a Vulkan buffer
-static bool createBuffer(VkDeviceSize size, VkBufferUsageFlags usage, VkMemoryPropertyFlags properties,
-                        VkBuffer& buffer, VkDeviceMemory& bufferMemory) {
-    VkBufferCreateInfo bufferInfo{};
-    bufferInfo.sType = VK_STRUCTURE_TYPE_BUFFER_CREATE_INFO;
-    bufferInfo.size = size;
-    bufferInfo.usage = usage;
-    bufferInfo.sharingMode = VK_SHARING_MODE_EXCLUSIVE;
+// Local transform of a skeleton node in a pose
+struct NodePose {
+    glm::vec3 position;
+    glm::quat rotation;
+    glm::vec3 scale;
+};
 
-    if (vkCreateBuffer(g_engine.device, &bufferInfo, nullptr, &buffer) != VK_SUCCESS) {
-        Logger::get().error("Failed to create buffer");
-        return false;
+template <typename T, typename Mix>
+static T sampleKeys(const std::vector<AnimationKey<T>>& keys, float time, const T& fallback, Mix mix) {
+    if (keys.empty()) {
+        return fallback;
+    }
+    if (time <= keys.front().time) {
+        return keys.front().value;
+    }
+    if (time >= keys.back().time) {
+        return keys.back().value;
     }
 
-    VkMemoryRequirements memRequirements;
-    vkGetBufferMemoryRequirements(g_engine.device, buffer, &memRequirements);
+    auto next = std::upper_bound(keys.begin(), keys.end(), time,
+                                 [](float t, const AnimationKey<T>& key) { return t < key.time; });
+    auto prev = next - 1;
+    float span = next->time - prev->time;
+    return mix(prev->value, next->value, span > 0.0f ? (time - prev->time) / span : 0.0f);
+}
 
-    VkMemoryAllocateInfo allocInfo{};
+// Poses every node at a time in a clip; clip -1 is the bind pose
+static void sampleClip(const Skeleton& skeleton, int clip, float time, std::vector<NodePose>& poses) {
+    for (size_t i = 0; i < skeleton.nodes.size(); i++) {
+        const SkeletonNode& node = skeleton.nodes[i];
+        poses[i] = {node.position, node.rotation, node.scale};
+    }
+    if (clip < 0) {
+        return;
+    }
+
+    auto lerp = [](const glm::vec3& a, const glm::vec3& b, float t) { return glm::mix(a, b, t); };
+    auto slerp = [](const glm::quat& a, const glm::quat& b, float t) { return glm::slerp(a, b, t); };
+    for (const AnimationChannel& channel : skeleton.clips[clip].channels) {
+        NodePose& pose = poses[channel.node];
+        pose.position = sampleKeys(channel.positions, time, pose.position, lerp);
+        pose.rotation = sampleKeys(channel.rotations, time, pose.rotation, slerp);
+        pose.scale = sampleKeys(channel.scales, time, pose.scale, lerp);
+    }
+}
+
+// Skins an animated model's meshes from their bind pose into their vertices
+static void poseModel(Model& model) {
+    const Skeleton& skeleton = *model.skeleton;
+    const AnimationState& state = model.animation;
+    size_t nodeCount = skeleton.nodes.size();
+
+    std::vector<NodePose> poses(nodeCount);
+    sampleClip(skeleton, state.clip, state.time, poses);
+    if (state.fadeDuration > 0.0f) {
+        std::vector<NodePose> previous(nodeCount);
+        sampleClip(skeleton, state.previousClip, state.previousTime, previous);
+        float weight = std::clamp(state.fade / state.fadeDuration, 0.0f, 1.0f);
+        for (size_t i = 0; i < nodeCount; i++) {
+            poses[i].position = glm::mix(previous[i].position, poses[i].position, weight);
+            poses[i].rotation = glm::slerp(previous[i].rotation, poses[i].rotation, weight);
+            poses[i].scale = glm::mix(previous[i].scale, poses[i].scale, weight);
+        }
+    }
+
+    std::vector<glm::mat4> globals(nodeCount);
+    for (size_t i = 0; i < nodeCount; i++) {
+        const NodePose& pose = poses[i];
+        glm::mat4 local = glm::translate(glm::mat4(1.0f), pose.position) * glm::mat4_cast(pose.rotation) *
+                          glm::scale(glm::mat4(1.0f), pose.scale);
+        int parent = skeleton.nodes[i].parent;
+        globals[i] = parent >= 0 ? globals[parent] * local : local;
+    }
+
+    std::vector<glm::mat4> matrices;
+    for (Mesh& mesh : model.meshes) {
+        if (mesh.node < 0 || mesh.node >= static_cast<int>(nodeCount) || mesh.bindVertices.size() != mesh.vertices.size()) {
+            continue;
+        }
+
+        // Meshes are drawn in their node's bind space, as they are without animation, so
+        // the bind pose skins to the vertices as loaded
+        glm::mat4 toMesh = glm::inverse(skeleton.nodes[mesh.node].bindGlobal);
+        if (mesh.skin.empty()) {
+            matrices.assign(1, toMesh * globals[mesh.node]);
+        } else {
+            matrices.resize(mesh.bones.size());
+            for (size_t b = 0; b < mesh.bones.size(); b++) {
+                const MeshBone& bone = mesh.bones[b];
+                matrices[b] = bone.node >= 0 ? toMesh * globals[bone.node] * bone.offset : glm::mat4(1.0f);
+            }
+        }
+
+        for (size_t v = 0; v < mesh.vertices.size(); v++) {
+            const Vertex& bind = mesh.bindVertices[v];
+            glm::mat4 m = matrices[0];
+            if (!mesh.skin.empty()) {
+                const VertexSkin& skin = mesh.skin[v];
+                m = glm::mat4(0.0f);
+                for (int i = 0; i < MAX_VERTEX_BONES; i++) {
+                    if (skin.weights[i] > 0.0f) {
+                        m += matrices[skin.joints[i]] * skin.weights[i];
+                    }
+                }
+                if (skin.weights[0] + skin.weights[1] + skin.weights[2] + skin.weights[3] <= 0.0f) {
+                    m = glm::mat4(1.0f);
+                }
+            }
+
+            Vertex& vertex = mesh.vertices[v];
+            vertex.position = glm::vec3(m * glm::vec4(bind.position, 1.0f));
+            glm::vec3 normal = glm::mat3(m) * bind.normal;
+            float length = glm::length(normal);
+            vertex.normal = length > 0.0f ? normal / length : bind.normal;
+        }
+        markVerticesDirty(mesh, 0, static_cast<uint32_t>(mesh.vertices.size()));
+    }
+}
+
+// Moves a time through a clip, wrapping when looping and holding the ends otherwise
+static float advanceClipTime(const Skeleton& skeleton, int clip, float time, float delta, bool loop) {
+    if (clip < 0) {
+        return 0.0f;
+    }
+    float duration = skeleton.clips[clip].duration;
+    if (duration <= 0.0f) {
+        return 0.0f;
+    }
+
+    time += delta;
+    if (loop) {
+        time = std::fmod(time, duration);
+        return time < 0.0f ? time + duration : time;
+    }
+    return std::clamp(time, 0.0f, duration);
+}
+
+// Advances the animations of the active world's models and skins the ones that moved
+static void updateAnimations(float deltaTime) {
+    g_engine.ecs->query<Model>().each([deltaTime](Model& model) {
+        if (!model.skeleton) {
+            return;
+        }
+
+        AnimationState& state = model.animation;
+        if (!state.paused && deltaTime != 0.0f && (state.clip >= 0 || state.fadeDuration > 0.0f)) {
+            float delta = deltaTime * state.speed;
+            state.time = advanceClipTime(*model.skeleton, state.clip, state.time, delta, state.loop);
+            if (state.fadeDuration > 0.0f) {
+                state.previousTime = advanceClipTime(*model.skeleton, state.previousClip, state.previousTime,
+                                                     delta, state.previousLoop);
+                state.fade += deltaTime;
+                if (state.fade >= state.fadeDuration) {
+                    state.fadeDuration = 0.0f;
+                    state.previousClip = -1;
+                }
+            }
+            state.dirty = true;
+        }
+
+        if (state.dirty) {
+            poseModel(model);
+            state.dirty = false;
+        }
+    });
+}
+
+static CollisionEvent collisionEvent(int kind, const std::pair<flecs::entity_t, flecs::entity_t>& pair,
+                                     const Contact& contact) {
+    CollisionEvent event{};
+    event.kind = kind;
+    event.a = pair.first;
+    event.b = pair.second;
+    memcpy(event.point, &contact.point, sizeof(event.point));
+    memcpy(event.normal, &contact.normal, sizeof(event.normal));
+    return event;
+}
+
+// A collider placed in the world for one physics step
+struct CollisionShape {
+    flecs::entity_t entity;
+    const Collider* collider;
+    Transform* transform;
+    PhysicsBody* body;
+    float inverseMass; // 0 for colliders contacts don't move
+    glm::mat3 axes;
+    glm::vec3 reach;                 // Half size of the world bounds around the position
+    std::vector<glm::vec3> triangles; // Mesh colliders, in world space
+    glm::vec3 meshMin, meshMax;
+};
+
+// Rotation of a transform, as the renderer's model matrix applies it
+static glm::mat3 rotationAxes(const glm::quat& rotation) {
+    return glm::mat3_cast(rotation);
+}
+
+static bool isRound(const CollisionShape& s) {
+    return s.collider->shape == COLLIDER_SPHERE || s.collider->shape == COLLIDER_CAPSULE;
+}
+
+static void shapeBounds(const CollisionShape& s, glm::vec3& min, glm::vec3& max) {
+    if (s.collider->shape == COLLIDER_MESH) {
+        min = s.meshMin;
+        max = s.meshMax;
+        return;
+    }
+    min = s.transform->position - s.reach;
+    max = s.transform->position + s.reach;
+}
+
+// The segment a sphere (a point) or capsule is rounded around
+static void roundSegment(const CollisionShape& s, glm::vec3& start, glm::vec3& end) {
+    glm::vec3 half = s.axes[1] * (s.collider->shape == COLLIDER_CAPSULE ? s.collider->halfHeight : 0.0f);
+    start = s.transform->position - half;
+    end = s.transform->position + half;
+}
+
+static glm::vec3 closestOnSegment(const glm::vec3& start, const glm::vec3& end, const glm::vec3& point) {
+    glm::vec3 direction = end - start;
+    float lengthSq = glm::dot(direction, direction);
+    if (lengthSq <= 1e-12f) {
+        return start;
+    }
+    return start + direction * std::clamp(glm::dot(point - start, direction) / lengthSq, 0.0f, 1.0f);
+}
+
+// Closest points between segments p1-q1 and p2-q2 (Ericson, Real-Time Collision Detection 5.1.9)
+static void closestBetweenSegments(const glm::vec3& p1, const glm::vec3& q1, const glm::vec3& p2, const glm::vec3& q2,
+                                   glm::vec3& c1, glm::vec3& c2) {
+    glm::vec3 d1 = q1 - p1;
+    glm::vec3 d2 = q2 - p2;
+    glm::vec3 r = p1 - p2;
+    float a = glm::dot(d1, d1);
+    float e = glm::dot(d2, d2);
+    float f = glm::dot(d2, r);
+    float s = 0.0f;
+    float t = 0.0f;
+
+    if (a <= 1e-12f && e <= 1e-12f) {
+        c1 = p1;
+        c2 = p2;
+        return;
+    }
+    if (a <= 1e-12f) {
+        t = std::clamp(f / e, 0.0f, 1.0f);
+    } else {
+        float c = glm::dot(d1, r);
+        if (e <= 1e-12f) {
+            s = std::clamp(-c / a, 0.0f, 1.0f);
+        } else {
+            float b = glm::dot(d1, d2);
+            float denom = a * e - b * b;
+            s = denom > 1e-12f ? std::clamp((b * f - c * e) / denom, 0.0f, 1.0f) : 0.0f;
+            t = (b * s + f) / e;
+            if (t < 0.0f) {
+                t = 0.0f;
+                s = std::clamp(-c / a, 0.0f, 1.0f);
+            } else if (t > 1.0f) {
+                t = 1.0f;
+                s = std::clamp((b - c) / a, 0.0f, 1.0f);
+            }
+        }
+    }
+    c1 = p1 + d1 * s;
+    c2 = p2 + d2 * t;
+}
+
+static glm::vec3 closestOnBox(const glm::vec3& center, const glm::mat3& axes, const glm::vec3& halfExtents,
+                              const glm::vec3& point) {
+    glm::vec3 local = glm::transpose(axes) * (point - center);
+    return center + axes * glm::clamp(local, -halfExtents, halfExtents);
+}
+
+// Closest point on triangle abc (Ericson 5.1.5)
+static glm::vec3 closestOnTriangle(const glm::vec3& p, const glm::vec3& a, const glm::vec3& b, const glm::vec3& c) {
+    glm::vec3 ab = b - a;
+    glm::vec3 ac = c - a;
+    glm::vec3 ap = p - a;
+    float d1 = glm::dot(ab, ap);
+    float d2 = glm::dot(ac, ap);
+    if (d1 <= 0.0f && d2 <= 0.0f) {
+        return a;
+    }
+
+    glm::vec3 bp = p - b;
+    float d3 = glm::dot(ab, bp);
+    float d4 = glm::dot(ac, bp);
+    if (d3 >= 0.0f && d4 <= d3) {
+        return b;
+    }
+    float vc = d1 * d4 - d3 * d2;
+    if (vc <= 0.0f && d1 >= 0.0f && d3 <= 0.0f) {
+        return a + ab * (d1 / (d1 - d3));
+    }
+
+    glm::vec3 cp = p - c;
+    float d5 = glm::dot(ab, cp);
+    float d6 = glm::dot(ac, cp);
+    if (d6 >= 0.0f && d5 <= d6) {
+        return c;
+    }
+    float vb = d5 * d2 - d1 * d6;
+    if (vb <= 0.0f && d2 >= 0.0f && d6 <= 0.0f) {
+        return a + ac * (d2 / (d2 - d6));
+    }
+    float va = d3 * d6 - d5 * d4;
+    if (va <= 0.0f && d4 - d3 >= 0.0f && d5 - d6 >= 0.0f) {
+        return b + (c - b) * ((d4 - d3) / ((d4 - d3) + (d5 - d6)));
+    }
+
+    float denom = 1.0f / (va + vb + vc);
+    return a + ab * (vb * denom) + ac * (vc * denom);
+}
+
+// Closest points between a segment and a convex shape, found by alternating between them
+template <typename Closest>
+static void closestToSegment(const glm::vec3& start, const glm::vec3& end, Closest closest,
+                             glm::vec3& onSegment, glm::vec3& onShape) {
+    onSegment = closestOnSegment(start, end, closest((start + end) * 0.5f));
+    for (int i = 0; i < 3; i++) {
+        onShape = closest(onSegment);
+        onSegment = closestOnSegment(start, end, onShape);
+    }
+    onShape = closest(onSegment);
+}
+
+// Half the length of a box projected onto an axis
+static float boxExtent(const glm::mat3& axes, const glm::vec3& halfExtents, const glm::vec3& axis) {
+    return std::abs(glm::dot(axes[0], axis)) * halfExtents.x +
+           std::abs(glm::dot(axes[1], axis)) * halfExtents.y +
+           std::abs(glm::dot(axes[2], axis)) * halfExtents.z;
+}
+
+// Records that two colliders touch during this physics step, queuing an enter event when
+// they were apart in the last one
+static void recordContact(const CollisionShape& a, const CollisionShape& b, const glm::vec3& point,
+                          const glm::vec3& normal, bool trigger) {
+    bool flip = a.entity > b.entity;
+    std::pair<flecs::entity_t, flecs::entity_t> pair = flip ? std::make_pair(b.entity, a.entity)
+                                                            : std::make_pair(a.entity, b.entity);
+    auto [it, entered] = g_engine.contacts.try_emplace(pair);
+    it->second.point = point;
+    it->second.normal = flip ? -normal : normal;
+    it->second.step = g_engine.physicsStep;
+    it->second.trigger = trigger;
+    if (entered && g_engine.collisionEventsWatched) {
+        int kind = trigger ? COLLISION_EVENT_TRIGGER_ENTER : COLLISION_EVENT_ENTER;
+        g_engine.collisionEvents.push_back(collisionEvent(kind, pair, it->second));
+    }
+}
+
+// Separates two colliders along normal (pointing from b to a) and takes away the speed they
+// approach each other at, bouncing and applying friction. Colliders within CONTACT_SKIN
+// (depth above -CONTACT_SKIN) touch without being pushed. Trigger volumes only record the
+// overlap, and only once the colliders actually overlap.
+static void resolveContact(CollisionShape& a, CollisionShape& b, const glm::vec3& normal, float depth,
+                           const glm::vec3& point) {
+    float inverseMass = a.inverseMass + b.inverseMass;
+    if (inverseMass <= 0.0f) {
+        return;
+    }
+    if (a.collider->trigger || b.collider->trigger) {
+        if (depth > 0.0f) {
+            recordContact(a, b, point, normal, true);
+        }
+        return;
+    }
+    recordContact(a, b, point, normal, false);
+    if (depth <= 0.0f) {
+        return;
+    }
+
+    glm::vec3 correction = normal * (depth / inverseMass);
+    if (a.inverseMass > 0.0f) {
+        a.transform->position += correction * a.inverseMass;
+        markChanged(a.entity, COMPONENT_TRANSFORM);
+    }
+    if (b.inverseMass > 0.0f) {
+        b.transform->position -= correction * b.inverseMass;
+        markChanged(b.entity, COMPONENT_TRANSFORM);
+    }
+
+    glm::vec3 velocityA = a.inverseMass > 0.0f ? a.body->velocity : glm::vec3(0.0f);
+    glm::vec3 velocityB = b.inverseMass > 0.0f ? b.body->velocity : glm::vec3(0.0f);
+    glm::vec3 relative = velocityA - velocityB;
+    float approach = glm::dot(relative, normal);
+    if (approach >= 0.0f) {
+        return;
+    }
+
+    float restitution = -approach > RESTITUTION_MIN_SPEED
+        ? std::max(a.collider->restitution, b.collider->restitution) : 0.0f;
+    float impulse = -(1.0f + restitution) * approach / inverseMass;
+    glm::vec3 change = normal * impulse;
+
+    glm::vec3 tangent = relative - normal * approach;
+    float slide = glm::length(tangent);
+    if (slide > 1e-6f) {
+        float friction = std::sqrt(a.collider->friction * b.collider->friction);
+        change -= tangent / slide * std::min(slide / inverseMass, friction * impulse);
+    }
+
+    if (a.inverseMass > 0.0f) {
+        a.body->velocity += change * a.inverseMass;
+        markChanged(a.entity, COMPONENT_PHYSICS_BODY);
+    }
+    if (b.inverseMass > 0.0f) {
+        b.body->velocity -= change * b.inverseMass;
+        markChanged(b.entity, COMPONENT_PHYSICS_BODY);
+    }
+}
+
+static void collideRoundRound(CollisionShape& a, CollisionShape& b) {
+    glm::vec3 startA, endA, startB, endB, onA, onB;
+    roundSegment(a, startA, endA);
+    roundSegment(b, startB, endB);
+    closestBetweenSegments(startA, endA, startB, endB, onA, onB);
+
+    float radius = a.collider->radius + b.collider->radius;
+    glm::vec3 offset = onA - onB;
+    float distance = glm::length(offset);
+    if (distance >= radius + CONTACT_SKIN) {
+        return;
+    }
+    glm::vec3 normal = distance > 1e-5f ? offset / distance : glm::vec3(0.0f, 1.0f, 0.0f);
+    resolveContact(a, b, normal, radius - distance, onB + normal * b.collider->radius);
+}
+
+static void collideRoundBox(CollisionShape& a, CollisionShape& b) {
+    glm::vec3 start, end, onSegment, onBox;
+    roundSegment(a, start, end);
+    const glm::vec3 center = b.transform->position;
+    const glm::vec3& halfExtents = b.collider->halfExtents;
+    closestToSegment(start, end, [&](const glm::vec3& p) { return closestOnBox(center, b.axes, halfExtents, p); },
+                     onSegment, onBox);
+
+    float radius = a.collider->radius;
+    glm::vec3 offset = onSegment - onBox;
+    float distance = glm::length(offset);
+    if (distance >= radius + CONTACT_SKIN) {
+        return;
+    }
+    if (distance > 1e-5f) {
+        resolveContact(a, b, offset / distance, radius - distance, onBox);
+        return;
+    }
+
+    // The segment is inside the box: push out through the nearest face
+    glm::vec3 local = glm::transpose(b.axes) * (onSegment - center);
+    glm::vec3 gap = halfExtents - glm::abs(local);
+    int axis = gap.x < gap.y ? (gap.x < gap.z ? 0 : 2) : (gap.y < gap.z ? 1 : 2);
+    glm::vec3 normal = b.axes[axis] * (local[axis] < 0.0f ? -1.0f : 1.0f);
+    resolveContact(a, b, normal, gap[axis] + radius, onSegment);
+}
+
+static void collideRoundTriangle(CollisionShape& a, CollisionShape& b, const glm::vec3* triangle) {
+    glm::vec3 start, end, onSegment, onTriangle;
+    roundSegment(a, start, end);
+    closestToSegment(start, end,
+                     [&](const glm::vec3& p) { return closestOnTriangle(p, triangle[0], triangle[1], triangle[2]); },
+                     onSegment, onTriangle);
+
+    float radius = a.collider->radius;
+    glm::vec3 offset = onSegment - onTriangle;
+    float distance = glm::length(offset);
+    if (distance >= radius + CONTACT_SKIN) {
+        return;
+    }
+    if (distance > 1e-5f) {
+        resolveContact(a, b, offset / distance, radius - distance, onTriangle);
+        return;
+    }
+
+    // The segment crosses the triangle: push out to the side its center is on
+    glm::vec3 normal = glm::normalize(glm::cross(triangle[1] - triangle[0], triangle[2] - triangle[0]));
+    if (glm::dot(a.transform->position - triangle[0], normal) < 0.0f) {
+        normal = -normal;
+    }
+    float below = std::min(glm::dot(start - triangle[0], normal), glm::dot(end - triangle[0], normal));
+    resolveContact(a, b, normal, radius - std::min(below, 0.0f), onTriangle);
+}
+
+// Separating axis test between two boxes, resolving along the axis they overlap least on
+static void collideBoxBox(CollisionShape& a, CollisionShape& b) {
+    glm::vec3 axes[15];
+    int count = 0;
+    for (int i = 0; i < 3; i++) {
+        axes[count++] = a.axes[i];
+        axes[count++] = b.axes[i];
+        for (int j = 0; j < 3; j++) {
+            glm::vec3 axis = glm::cross(a.axes[i], b.axes[j]);
+            if (glm::dot(axis, axis) > 1e-6f) {
+                axes[count++] = glm::normalize(axis);
+            }
+        }
+    }
+
+    glm::vec3 offset = a.transform->position - b.transform->position;
+    float best = std::numeric_limits<float>::max();
+    glm::vec3 normal(0.0f);
+    for (int i = 0; i < count; i++) {
+        float distance = glm::dot(offset, axes[i]);
+        float overlap = boxExtent(a.axes, a.collider->halfExtents, axes[i]) +
+                        boxExtent(b.axes, b.collider->halfExtents, axes[i]) - std::abs(distance);
+        if (overlap <= -CONTACT_SKIN) {
+            return;
+        }
+        if (overlap < best) {
+            best = overlap;
+            normal = distance < 0.0f ? -axes[i] : axes[i];
+        }
+    }
+
+    // Halfway between the closest points of each box to the other's center
+    glm::vec3 onA = closestOnBox(a.transform->position, a.axes, a.collider->halfExtents, b.transform->position);
+    glm::vec3 onB = closestOnBox(b.transform->position, b.axes, b.collider->halfExtents, a.transform->position);
+    resolveContact(a, b, normal, best, (onA + onB) * 0.5f);
+}
+
+// Separating axis test between a box and a triangle
+static void collideBoxTriangle(CollisionShape& a, CollisionShape& b, const glm::vec3* triangle) {
+    glm::vec3 edges[3] = {triangle[1] - triangle[0], triangle[2] - triangle[1], triangle[0] - triangle[2]};
+    glm::vec3 axes[13];
+    int count = 0;
+    axes[count++] = glm::normalize(glm::cross(edges[0], edges[1]));
+    for (int i = 0; i < 3; i++) {
+        axes[count++] = a.axes[i];
+        for (const glm::vec3& edge : edges) {
+            glm::vec3 axis = glm::cross(a.axes[i], edge);
+            if (glm::dot(axis, axis) > 1e-6f) {
+                axes[count++] = glm::normalize(axis);
+            }
+        }
+    }
+
+    const glm::vec3& center = a.transform->position;
+    float best = std::numeric_limits<float>::max();
+    glm::vec3 normal(0.0f);
+    for (int i = 0; i < count; i++) {
+        float c = glm::dot(center, axes[i]);
+        float extent = boxExtent(a.axes, a.collider->halfExtents, axes[i]);
+        float p0 = glm::dot(triangle[0], axes[i]);
+        float p1 = glm::dot(triangle[1], axes[i]);
+        float p2 = glm::dot(triangle[2], axes[i]);
+
+        // Distance the box must move along the axis, either way, to clear the triangle
+        float up = std::max({p0, p1, p2}) - (c - extent);
+        float down = (c + extent) - std::min({p0, p1, p2});
+        if (up <= -CONTACT_SKIN || down <= -CONTACT_SKIN) {
+            return;
+        }
+        if (std::min(up, down) < best) {
+            best = std::min(up, down);
+            normal = up < down ? axes[i] : -axes[i];
+        }
+    }
+    resolveContact(a, b, normal, best, closestOnTriangle(center, triangle[0], triangle[1], triangle[2]));
+}
+
+static void collideMesh(CollisionShape& a, CollisionShape& mesh) {
+    for (size_t i = 0; i + 2 < mesh.triangles.size(); i += 3) {
+        const glm::vec3* triangle = &mesh.triangles[i];
+        glm::vec3 min, max;
+        shapeBounds(a, min, max);
+        glm::vec3 triangleMin = glm::min(glm::min(triangle[0], triangle[1]), triangle[2]);
+        glm::vec3 triangleMax = glm::max(glm::max(triangle[0], triangle[1]), triangle[2]);
+        if (glm::any(glm::lessThan(max + CONTACT_SKIN, triangleMin)) ||
+            glm::any(glm::greaterThan(min - CONTACT_SKIN, triangleMax))) {
+            continue;
+        }
+
+        if (isRound(a)) {
+            collideRoundTriangle(a, mesh, triangle);
+        } else {
+            collideBoxTriangle(a, mesh, triangle);
+        }
+    }
+}
+
+static void collidePair(CollisionShape& a, CollisionShape& b) {
+    if (a.collider->shape == COLLIDER_MESH) {
+        if (b.collider->shape != COLLIDER_MESH) {
+            collideMesh(b, a);
+        }
+    } else if (b.collider->shape == COLLIDER_MESH) {
+        collideMesh(a, b);
+    } else if (isRound(a) && isRound(b)) {
+        collideRoundRound(a, b);
+    } else if (isRound(a)) {
+        collideRoundBox(a, b);
+    } else if (isRound(b)) {
+        collideRoundBox(b, a);
+    } else {
+        collideBoxBox(a, b);
+    }
+}
+
+// Queues exit events for the pairs that stopped touching this physics step
+static void endContacts() {
+    for (auto it = g_engine.contacts.begin(); it != g_engine.contacts.end();) {
+        if (it->second.step == g_engine.physicsStep) {
+            ++it;
+            continue;
+        }
+        if (g_engine.collisionEventsWatched) {
+            int kind = it->second.trigger ? COLLISION_EVENT_TRIGGER_EXIT : COLLISION_EVENT_EXIT;
+            g_engine.collisionEvents.push_back(collisionEvent(kind, it->first, it->second));
+        }
+        it = g_engine.contacts.erase(it);
+    }
+}
+
+// Pushes overlapping colliders apart and stops bodies moving into each other. Every pair
+// with a moving body is tested, a few times over so stacked bodies settle.
+static void updateCollisions() {
+    g_engine.physicsStep++;
+
+    std::vector<flecs::entity> entities;
+    g_engine.ecs->query<const Collider, const Transform>().each(
+        [&entities](flecs::entity e, const Collider&, const Transform&) { entities.push_back(e); });
+    if (entities.size() < 2) {
+        endContacts();
+        return;
+    }
+
+    std::vector<CollisionShape> shapes(entities.size());
+    for (size_t i = 0; i < entities.size(); i++) {
+        CollisionShape& s = shapes[i];
+        s.entity = entities[i].id();
+        s.collider = entities[i].get<Collider>();
+        s.transform = entities[i].get_mut<Transform>();
+        s.body = entities[i].get_mut<PhysicsBody>();
+        s.inverseMass = s.body && s.body->mass > 0.0f && s.collider->shape != COLLIDER_MESH && !s.collider->trigger
+            ? 1.0f / s.body->mass : 0.0f;
+        s.axes = rotationAxes(s.transform->rotation);
+
+        const Collider& c = *s.collider;
+        switch (c.shape) {
+            case COLLIDER_BOX:
+                s.reach = glm::abs(s.axes[0]) * c.halfExtents.x + glm::abs(s.axes[1]) * c.halfExtents.y +
+                          glm::abs(s.axes[2]) * c.halfExtents.z;
+                break;
+            case COLLIDER_CAPSULE:
+                s.reach = glm::abs(s.axes[1]) * c.halfHeight + glm::vec3(c.radius);
+                break;
+            case COLLIDER_MESH:
+                s.triangles.reserve(c.triangles.size());
+                s.meshMin = glm::vec3(std::numeric_limits<float>::max());
+                s.meshMax = glm::vec3(std::numeric_limits<float>::lowest());
+                for (const glm::vec3& corner : c.triangles) {
+                    glm::vec3 world = s.transform->position + s.axes * (corner * s.transform->scale);
+                    s.triangles.push_back(world);
+                    s.meshMin = glm::min(s.meshMin, world);
+                    s.meshMax = glm::max(s.meshMax, world);
+                }
+                break;
+            default:
+                s.reach = glm::vec3(c.radius);
+                break;
+        }
+    }
+
+    for (int iteration = 0; iteration < COLLISION_ITERATIONS; iteration++) {
+        for (size_t i = 0; i < shapes.size(); i++) {
+            for (size_t j = i + 1; j < shapes.size(); j++) {
+                CollisionShape& a = shapes[i];
+                CollisionShape& b = shapes[j];
+                if (a.inverseMass <= 0.0f && b.inverseMass <= 0.0f) {
+                    continue;
+                }
+
+                glm::vec3 minA, maxA, minB, maxB;
+                shapeBounds(a, minA, maxA);
+                shapeBounds(b, minB, maxB);
+                if (glm::any(glm::lessThan(maxA + CONTACT_SKIN, minB)) ||
+                    glm::any(glm::greaterThan(minA - CONTACT_SKIN, maxB))) {
+                    continue;
+                }
+                collidePair(a, b);
+            }
+        }
+    }
+    endContacts();
+}
+
+// Milliseconds since start, which moves on to now, for subsystem times
+static float msSince(std::chrono::steady_clock::time_point& start) {
+    auto now = std::chrono::steady_clock::now();
+    float ms = std::chrono::duration<float, std::milli>(now - start).count();
+    start = now;
+    return ms;
+}
+
+// Sets a subsystem time to how long the scope it is declared in ran
+struct SubsystemTimer {
+    float& ms;
+    std::chrono::steady_clock::time_point start = std::chrono::steady_clock::now();
+    ~SubsystemTimer() { ms = msSince(start); }
+};
+
+int boulder_update(float deltaTime) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs) {
+        return -1;
+    }
+
+    // Update physics system
+    // In Flecs v4, we need to create a query first
+    g_engine.changeTick++;
+    ActiveWorldScope scope;
+    SubsystemTimes& times = g_engine.subsystemTimes;
+    auto start = std::chrono::steady_clock::now();
+
+    auto query = g_engine.ecs->query<Transform, PhysicsBody>();
+    query.each([deltaTime](flecs::entity e, Transform& t, PhysicsBody& pb) {
+        if (pb.velocity != glm::vec3(0.0f) && deltaTime != 0.0f) {
+            markChanged(e.id(), COMPONENT_TRANSFORM);
+        }
+        if (pb.acceleration != glm::vec3(0.0f) && deltaTime != 0.0f) {
+            markChanged(e.id(), COMPONENT_PHYSICS_BODY);
+        }
+        t.position += pb.velocity * deltaTime;
+        pb.velocity += pb.acceleration * deltaTime;
+    });
+    times.physicsMs = msSince(start);
+
+    updateCollisions();
+    times.collisionsMs = msSince(start);
+    updateBuoyancy(deltaTime);
+    times.buoyancyMs = msSince(start);
+    updateSoftBodies(deltaTime);
+    times.softBodiesMs = msSince(start);
+    updateAnimations(deltaTime);
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+// Helper function to find suitable memory type
+static uint32_t findMemoryType(uint32_t typeFilter, VkMemoryPropertyFlags properties) {
+    VkPhysicalDeviceMemoryProperties memProperties;
+    vkGetPhysicalDeviceMemoryProperties(g_engine.physicalDevice, &memProperties);
+
+    for (uint32_t i = 0; i < memProperties.memoryTypeCount; i++) {
+        if ((typeFilter & (1 << i)) &&
+            (memProperties.memoryTypes[i].propertyFlags & properties) == properties) {
+            return i;
+        }
+    }
+
+    fail(ERROR_VULKAN, "Failed to find suitable memory type");
+    return 0;
+}
+
+// Helper function to create a Vulkan buffer
+static bool createBuffer(VkDeviceSize size, VkBufferUsageFlags usage, VkMemoryPropertyFlags properties,
+                        VkBuffer& buffer, VkDeviceMemory& bufferMemory) {
+    VkBufferCreateInfo bufferInfo{};
+    bufferInfo.sType = VK_STRUCTURE_TYPE_BUFFER_CREATE_INFO;
+    bufferInfo.size = size;
+    bufferInfo.usage = usage;
+    bufferInfo.sharingMode = VK_SHARING_MODE_EXCLUSIVE;
+
+    if (vkCreateBuffer(g_engine.device, &bufferInfo, nullptr, &buffer) != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to create buffer");
+        return false;
+    }
+
+    VkMemoryRequirements memRequirements;
+    vkGetBufferMemoryRequirements(g_engine.device, buffer, &memRequirements);
+
+    VkMemoryAllocateInfo allocInfo{};
     allocInfo.sType = VK_STRUCTURE_TYPE_MEMORY_ALLOCATE_INFO;
     allocInfo.allocationSize = memRequirements.size;
     allocInfo.memoryTypeIndex = findMemoryType(memRequirements.memoryTypeBits, properties);
 
-    if (vkAllocateMemory(g_engine.device, &allocInfo, nullptr, &bufferMemory) != VK_SUCCESS) {
-        Logger::get().error("Failed to allocate buffer memory");
+    if (allocateDeviceMemory(g_engine.device, &allocInfo, nullptr, &bufferMemory) != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to allocate buffer memory");
         return false;
     }
 
-    vkBindBufferMemory(g_engine.device, buffer, bufferMemory, 0);
-    return true;
+    vkBindBufferMemory(g_engine.device, buffer, bufferMemory, 0);
+    return true;
+}
+
+// Helper function to copy data to a buffer
+static void copyDataToBuffer(VkDeviceMemory bufferMemory, const void* data, size_t size) {
+    void* mapped;
+    vkMapMemory(g_engine.device, bufferMemory, 0, size, 0, &mapped);
+    memcpy(mapped, data, size);
+    vkUnmapMemory(g_engine.device, bufferMemory);
+}
+
+// Uploads a mesh's vertices and indices into GPU storage buffers
+static void createMeshBuffers(Mesh& mesh) {
+    // Create GPU storage buffers for mesh shaders
+    // NOTE: Mesh shaders read from STORAGE_BUFFER, NOT VERTEX_BUFFER
+    if (!mesh.vertices.empty() && mesh.dynamic) {
+        VkDeviceSize vertexBufferSize = sizeof(Vertex) * mesh.vertices.size();
+        for (uint32_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
+            createBuffer(vertexBufferSize,
+                        VK_BUFFER_USAGE_STORAGE_BUFFER_BIT,
+                        VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT | VK_MEMORY_PROPERTY_HOST_COHERENT_BIT,
+                        mesh.frameVertexBuffers[i], mesh.frameVertexBufferMemory[i]);
+
+            copyDataToBuffer(mesh.frameVertexBufferMemory[i], mesh.vertices.data(), vertexBufferSize);
+            mesh.dirtyBegin[i] = mesh.dirtyEnd[i] = 0;
+        }
+    } else if (!mesh.vertices.empty()) {
+        VkDeviceSize vertexBufferSize = sizeof(Vertex) * mesh.vertices.size();
+        createBuffer(vertexBufferSize,
+                    VK_BUFFER_USAGE_STORAGE_BUFFER_BIT,
+                    VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT | VK_MEMORY_PROPERTY_HOST_COHERENT_BIT,
+                    mesh.vertexBuffer, mesh.vertexBufferMemory);
+
+        copyDataToBuffer(mesh.vertexBufferMemory, mesh.vertices.data(), vertexBufferSize);
+    }
+
+    if (!mesh.indices.empty()) {
+        VkDeviceSize indexBufferSize = sizeof(uint32_t) * mesh.indices.size();
+        createBuffer(indexBufferSize,
+                    VK_BUFFER_USAGE_STORAGE_BUFFER_BIT,
+                    VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT | VK_MEMORY_PROPERTY_HOST_COHERENT_BIT,
+                    mesh.indexBuffer, mesh.indexBufferMemory);
+
+        copyDataToBuffer(mesh.indexBufferMemory, mesh.indices.data(), indexBufferSize);
+    }
+
+    // Create draw params buffer (indexCount, instanceCount)
+    struct DrawParams {
+        uint32_t indexCount;
+        uint32_t instanceCount;
+    };
+    DrawParams drawParams{mesh.indexCount, 1};
+
+    VkDeviceSize drawParamsSize = sizeof(DrawParams);
+    createBuffer(drawParamsSize,
+                VK_BUFFER_USAGE_STORAGE_BUFFER_BIT,
+                VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT | VK_MEMORY_PROPERTY_HOST_COHERENT_BIT,
+                mesh.drawParamsBuffer, mesh.drawParamsBufferMemory);
+
+    copyDataToBuffer(mesh.drawParamsBufferMemory, &drawParams, drawParamsSize);
+
+    for (auto& lod : mesh.lods) {
+        VkDeviceSize lodIndexSize = sizeof(uint32_t) * lod.indices.size();
+        createBuffer(lodIndexSize,
+                    VK_BUFFER_USAGE_STORAGE_BUFFER_BIT,
+                    VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT | VK_MEMORY_PROPERTY_HOST_COHERENT_BIT,
+                    lod.indexBuffer, lod.indexBufferMemory);
+        copyDataToBuffer(lod.indexBufferMemory, lod.indices.data(), lodIndexSize);
+
+        DrawParams lodParams{lod.indexCount, 1};
+        createBuffer(drawParamsSize,
+                    VK_BUFFER_USAGE_STORAGE_BUFFER_BIT,
+                    VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT | VK_MEMORY_PROPERTY_HOST_COHERENT_BIT,
+                    lod.drawParamsBuffer, lod.drawParamsBufferMemory);
+        copyDataToBuffer(lod.drawParamsBufferMemory, &lodParams, drawParamsSize);
+    }
+}
+
+// Copies the vertices changed since a frame buffer was last used into it. Only called for
+// the frame being recorded, whose previous submission has already completed.
+static void flushDynamicVertices(Mesh& mesh, uint32_t frame) {
+    if (mesh.dirtyBegin[frame] >= mesh.dirtyEnd[frame]) {
+        return;
+    }
+
+    VkDeviceSize offset = sizeof(Vertex) * mesh.dirtyBegin[frame];
+    VkDeviceSize size = sizeof(Vertex) * (mesh.dirtyEnd[frame] - mesh.dirtyBegin[frame]);
+
+    void* mapped;
+    vkMapMemory(g_engine.device, mesh.frameVertexBufferMemory[frame], offset, size, 0, &mapped);
+    memcpy(mapped, &mesh.vertices[mesh.dirtyBegin[frame]], size);
+    vkUnmapMemory(g_engine.device, mesh.frameVertexBufferMemory[frame]);
+
+    mesh.dirtyBegin[frame] = mesh.dirtyEnd[frame] = 0;
+}
+
+// Reorders a mesh for the GPU vertex cache and fetch, then builds the LODs requested by
+// the import settings
+static void optimizeMesh(Mesh& mesh) {
+    const ModelImportSettings& settings = g_engine.importSettings;
+    if (mesh.indices.empty() || mesh.vertices.empty()) {
+        return;
+    }
+
+    size_t indexCount = mesh.indices.size();
+    size_t vertexCount = mesh.vertices.size();
+
+    if (settings.optimize) {
+        meshopt_optimizeVertexCache(mesh.indices.data(), mesh.indices.data(), indexCount, vertexCount);
+        meshopt_optimizeOverdraw(mesh.indices.data(), mesh.indices.data(), indexCount,
+                                 &mesh.vertices[0].position.x, vertexCount, sizeof(Vertex), 1.05f);
+        if (mesh.skin.empty()) {
+            meshopt_optimizeVertexFetch(mesh.vertices.data(), mesh.indices.data(), indexCount,
+                                        mesh.vertices.data(), vertexCount, sizeof(Vertex));
+        } else {
+            // Bone weights have to follow their vertices
+            std::vector<unsigned int> remap(vertexCount);
+            size_t unique = meshopt_optimizeVertexFetchRemap(remap.data(), mesh.indices.data(), indexCount, vertexCount);
+            meshopt_remapIndexBuffer(mesh.indices.data(), mesh.indices.data(), indexCount, remap.data());
+            meshopt_remapVertexBuffer(mesh.vertices.data(), mesh.vertices.data(), vertexCount, sizeof(Vertex), remap.data());
+            meshopt_remapVertexBuffer(mesh.skin.data(), mesh.skin.data(), vertexCount, sizeof(VertexSkin), remap.data());
+            mesh.vertices.resize(unique);
+            mesh.skin.resize(unique);
+            vertexCount = unique;
+        }
+    }
+
+    for (size_t i = 0; i < settings.lodRatios.size(); i++) {
+        size_t target = static_cast<size_t>(indexCount * settings.lodRatios[i]) / 3 * 3;
+        float maxError = i < settings.lodErrors.size() ? settings.lodErrors[i] : 0.01f;
+
+        MeshLod lod;
+        lod.indices.resize(indexCount);
+        float resultError = 0.0f;
+        size_t count = meshopt_simplify(lod.indices.data(), mesh.indices.data(), indexCount,
+                                        &mesh.vertices[0].position.x, vertexCount, sizeof(Vertex),
+                                        target, maxError, 0, &resultError);
+        lod.indices.resize(count);
+
+        // Stop once simplification no longer makes progress
+        size_t previous = mesh.lods.empty() ? indexCount : mesh.lods.back().indices.size();
+        if (count == 0 || count >= previous) {
+            break;
+        }
+
+        if (settings.optimize) {
+            meshopt_optimizeVertexCache(lod.indices.data(), lod.indices.data(), count, vertexCount);
+        }
+        lod.indexCount = static_cast<uint32_t>(count);
+        Logger::get().info("  LOD {}: {} -> {} indices (error {:.4f})", mesh.lods.size() + 1, indexCount, count, resultError);
+        mesh.lods.push_back(std::move(lod));
+    }
+}
+
+static glm::mat4 toGlmMatrix(const aiMatrix4x4& m) {
+    // Assimp matrices are row major
+    return glm::mat4(m.a1, m.b1, m.c1, m.d1,
+                     m.a2, m.b2, m.c2, m.d2,
+                     m.a3, m.b3, m.c3, m.d3,
+                     m.a4, m.b4, m.c4, m.d4);
+}
+
+// Nodes of an imported scene by pointer and name, while the meshes of an animated model
+// are extracted
+struct SkeletonImport {
+    std::shared_ptr<Skeleton> skeleton = std::make_shared<Skeleton>();
+    std::unordered_map<const aiNode*, int> nodes;
+    std::unordered_map<std::string, int> byName; // First node with each name
+};
+
+static void collectSkeletonNodes(const aiNode* node, int parent, SkeletonImport& import) {
+    aiVector3D scale, position;
+    aiQuaternion rotation;
+    node->mTransformation.Decompose(scale, rotation, position);
+
+    SkeletonNode entry;
+    entry.name = node->mName.C_Str();
+    entry.parent = parent;
+    entry.position = glm::vec3(position.x, position.y, position.z);
+    entry.rotation = glm::quat(rotation.w, rotation.x, rotation.y, rotation.z);
+    entry.scale = glm::vec3(scale.x, scale.y, scale.z);
+    glm::mat4 local = toGlmMatrix(node->mTransformation);
+    entry.bindGlobal = parent >= 0 ? import.skeleton->nodes[parent].bindGlobal * local : local;
+
+    int index = static_cast<int>(import.skeleton->nodes.size());
+    import.nodes[node] = index;
+    import.byName.emplace(entry.name, index);
+    import.skeleton->nodes.push_back(std::move(entry));
+
+    for (uint32_t i = 0; i < node->mNumChildren; i++) {
+        collectSkeletonNodes(node->mChildren[i], index, import);
+    }
+}
+
+// Copies a scene's animations with their key times converted to seconds
+static void collectAnimationClips(const aiScene* scene, SkeletonImport& import) {
+    for (uint32_t a = 0; a < scene->mNumAnimations; a++) {
+        const aiAnimation* animation = scene->mAnimations[a];
+        double ticksPerSecond = animation->mTicksPerSecond > 0.0 ? animation->mTicksPerSecond
+                                                                  : DEFAULT_ANIMATION_TICKS_PER_SECOND;
+        auto seconds = [ticksPerSecond](double ticks) { return static_cast<float>(ticks / ticksPerSecond); };
+
+        AnimationClip clip;
+        clip.name = animation->mName.length > 0 ? animation->mName.C_Str() : "animation" + std::to_string(a);
+        clip.duration = seconds(animation->mDuration);
+
+        for (uint32_t c = 0; c < animation->mNumChannels; c++) {
+            const aiNodeAnim* source = animation->mChannels[c];
+            auto it = import.byName.find(source->mNodeName.C_Str());
+            if (it == import.byName.end()) {
+                continue;
+            }
+
+            AnimationChannel channel;
+            channel.node = it->second;
+            for (uint32_t k = 0; k < source->mNumPositionKeys; k++) {
+                const aiVectorKey& key = source->mPositionKeys[k];
+                channel.positions.push_back({seconds(key.mTime), glm::vec3(key.mValue.x, key.mValue.y, key.mValue.z)});
+            }
+            for (uint32_t k = 0; k < source->mNumRotationKeys; k++) {
+                const aiQuatKey& key = source->mRotationKeys[k];
+                channel.rotations.push_back({seconds(key.mTime), glm::quat(key.mValue.w, key.mValue.x, key.mValue.y, key.mValue.z)});
+            }
+            for (uint32_t k = 0; k < source->mNumScalingKeys; k++) {
+                const aiVectorKey& key = source->mScalingKeys[k];
+                channel.scales.push_back({seconds(key.mTime), glm::vec3(key.mValue.x, key.mValue.y, key.mValue.z)});
+            }
+            clip.channels.push_back(std::move(channel));
+        }
+
+        import.skeleton->clips.push_back(std::move(clip));
+    }
+}
+
+// Copies the strongest bone influences of each vertex of a skinned mesh
+static void collectSkin(const aiMesh* mesh, const SkeletonImport& import, Mesh& result) {
+    if (!mesh->HasBones()) {
+        return;
+    }
+
+    result.skin.resize(mesh->mNumVertices);
+    for (uint32_t b = 0; b < mesh->mNumBones; b++) {
+        const aiBone* bone = mesh->mBones[b];
+        auto it = import.byName.find(bone->mName.C_Str());
+        result.bones.push_back({it != import.byName.end() ? it->second : -1, toGlmMatrix(bone->mOffsetMatrix)});
+
+        for (uint32_t w = 0; w < bone->mNumWeights; w++) {
+            const aiVertexWeight& weight = bone->mWeights[w];
+            if (weight.mVertexId >= mesh->mNumVertices) {
+                continue;
+            }
+
+            // Replace the weakest influence if this one is stronger
+            VertexSkin& skin = result.skin[weight.mVertexId];
+            int weakest = 0;
+            for (int i = 1; i < MAX_VERTEX_BONES; i++) {
+                if (skin.weights[i] < skin.weights[weakest]) {
+                    weakest = i;
+                }
+            }
+            if (weight.mWeight > skin.weights[weakest]) {
+                skin.joints[weakest] = b;
+                skin.weights[weakest] = weight.mWeight;
+            }
+        }
+    }
+
+    // Dropped influences leave the rest short of 1
+    for (VertexSkin& skin : result.skin) {
+        float total = 0.0f;
+        for (float weight : skin.weights) {
+            total += weight;
+        }
+        if (total > 0.0f) {
+            for (float& weight : skin.weights) {
+                weight /= total;
+            }
+        }
+    }
+}
+
+// Helper function to process a single Assimp mesh. Meshes of animated models are given
+// their skeleton import and the index of the node holding them.
+static Mesh processMesh(aiMesh* mesh, const SkeletonImport* import = nullptr, int node = -1) {
+    Mesh result;
+
+    // Extract vertices
+    for (uint32_t i = 0; i < mesh->mNumVertices; i++) {
+        Vertex vertex;
+
+        // Position
+        vertex.position = glm::vec3(
+            mesh->mVertices[i].x,
+            mesh->mVertices[i].y,
+            mesh->mVertices[i].z
+        );
+
+        // Normal
+        if (mesh->HasNormals()) {
+            vertex.normal = glm::vec3(
+                mesh->mNormals[i].x,
+                mesh->mNormals[i].y,
+                mesh->mNormals[i].z
+            );
+        } else {
+            vertex.normal = glm::vec3(0.0f, 1.0f, 0.0f);
+        }
+
+        // Texture coordinates
+        if (mesh->mTextureCoords[0]) {
+            vertex.texCoord = glm::vec2(
+                mesh->mTextureCoords[0][i].x,
+                mesh->mTextureCoords[0][i].y
+            );
+        } else {
+            vertex.texCoord = glm::vec2(0.0f, 0.0f);
+        }
+
+        result.vertices.push_back(vertex);
+    }
+
+    // Extract indices
+    for (uint32_t i = 0; i < mesh->mNumFaces; i++) {
+        aiFace face = mesh->mFaces[i];
+        for (uint32_t j = 0; j < face.mNumIndices; j++) {
+            result.indices.push_back(face.mIndices[j]);
+        }
+    }
+
+    result.indexCount = static_cast<uint32_t>(result.indices.size());
+    result.material = static_cast<int>(mesh->mMaterialIndex);
+
+    // Animated meshes are skinned on the CPU into per-frame vertex buffers
+    if (import) {
+        result.dynamic = true;
+        result.node = node;
+        collectSkin(mesh, *import, result);
+    }
+
+    optimizeMesh(result);
+    if (import) {
+        result.bindVertices = result.vertices;
+    }
+    createMeshBuffers(result);
+
+    Logger::get().info("Processed mesh: {} vertices, {} indices", result.vertices.size(), result.indices.size());
+
+    return result;
+}
+
+// Helper function to recursively process Assimp nodes
+static void processNode(aiNode* node, const aiScene* scene, std::vector<Mesh>& meshes,
+                        const SkeletonImport* import = nullptr) {
+    // Process all the node's meshes
+    int nodeIndex = import ? import->nodes.at(node) : -1;
+    for (uint32_t i = 0; i < node->mNumMeshes; i++) {
+        aiMesh* mesh = scene->mMeshes[node->mMeshes[i]];
+        meshes.push_back(processMesh(mesh, import, nodeIndex));
+    }
+
+    // Process children
+    for (uint32_t i = 0; i < node->mNumChildren; i++) {
+        processNode(node->mChildren[i], scene, meshes, import);
+    }
+}
+
+// Copies a texture a material references out of the scene if it is embedded, returning the
+// path it goes by afterwards
+static std::string importTexturePath(const aiScene* scene, const aiString& path, ModelMaterials& result,
+                                     std::unordered_map<const aiTexture*, int>& embedded) {
+    const aiTexture* texture = scene->GetEmbeddedTexture(path.C_Str());
+    if (!texture) {
+        return path.C_Str();
+    }
+
+    auto [it, added] = embedded.emplace(texture, static_cast<int>(result.embedded.size()));
+    if (added) {
+        EmbeddedTexture copy;
+        if (texture->mHeight == 0) {
+            const uint8_t* bytes = reinterpret_cast<const uint8_t*>(texture->pcData);
+            copy.data.assign(bytes, bytes + texture->mWidth);
+        } else {
+            copy.width = texture->mWidth;
+            copy.height = texture->mHeight;
+            copy.data.resize(static_cast<size_t>(copy.width) * copy.height * 4);
+            for (size_t i = 0; i < static_cast<size_t>(copy.width) * copy.height; i++) {
+                const aiTexel& texel = texture->pcData[i];
+                copy.data[i * 4 + 0] = texel.r;
+                copy.data[i * 4 + 1] = texel.g;
+                copy.data[i * 4 + 2] = texel.b;
+                copy.data[i * 4 + 3] = texel.a;
+            }
+        }
+        result.embedded.push_back(std::move(copy));
+    }
+    return "*" + std::to_string(it->second);
+}
+
+// Reads the scene's materials as standard materials. Values a file doesn't set keep the
+// glTF defaults, except metallic, which is 0 for formats without it.
+static std::shared_ptr<const ModelMaterials> collectMaterials(const aiScene* scene) {
+    auto result = std::make_shared<ModelMaterials>();
+    std::unordered_map<const aiTexture*, int> embedded;
+
+    // Texture types of each slot, the glTF one first
+    const aiTextureType slotTypes[MATERIAL_MAX_TEXTURES][2] = {
+        {aiTextureType_BASE_COLOR, aiTextureType_DIFFUSE},
+        {aiTextureType_NORMALS, aiTextureType_NORMALS},
+        {aiTextureType_UNKNOWN, aiTextureType_METALNESS}, // glTF imports metallic-roughness as unknown
+        {aiTextureType_EMISSIVE, aiTextureType_EMISSIVE},
+    };
+
+    for (uint32_t i = 0; i < scene->mNumMaterials; i++) {
+        const aiMaterial* source = scene->mMaterials[i];
+        ModelFileMaterial material;
+        material.name = source->GetName().C_Str();
+
+        aiColor4D baseColor(1.0f, 1.0f, 1.0f, 1.0f);
+        if (source->Get(AI_MATKEY_BASE_COLOR, baseColor) != AI_SUCCESS) {
+            source->Get(AI_MATKEY_COLOR_DIFFUSE, baseColor);
+        }
+        aiColor3D emissive(0.0f, 0.0f, 0.0f);
+        source->Get(AI_MATKEY_COLOR_EMISSIVE, emissive);
+
+        StandardMaterial& values = material.values;
+        values = StandardMaterial{{baseColor.r, baseColor.g, baseColor.b, baseColor.a},
+                                  {emissive.r, emissive.g, emissive.b},
+                                  0.0f, 1.0f, 1.0f, 0.5f, BLEND_MODE_OPAQUE};
+        source->Get(AI_MATKEY_METALLIC_FACTOR, values.metallic);
+        source->Get(AI_MATKEY_ROUGHNESS_FACTOR, values.roughness);
+        source->Get(AI_MATKEY_GLTF_TEXTURE_SCALE(aiTextureType_NORMALS, 0), values.normalScale);
+        source->Get(AI_MATKEY_GLTF_ALPHACUTOFF, values.alphaCutoff);
+
+        aiString alphaMode;
+        if (source->Get(AI_MATKEY_GLTF_ALPHAMODE, alphaMode) == AI_SUCCESS) {
+            if (strcmp(alphaMode.C_Str(), "MASK") == 0) {
+                values.alphaMode = BLEND_MODE_ALPHA_TEST;
+            } else if (strcmp(alphaMode.C_Str(), "BLEND") == 0) {
+                values.alphaMode = BLEND_MODE_ALPHA_BLEND;
+            }
+        }
+
+        for (int slot = 0; slot < MATERIAL_MAX_TEXTURES; slot++) {
+            aiString path;
+            if (source->GetTexture(slotTypes[slot][0], 0, &path) == AI_SUCCESS ||
+                source->GetTexture(slotTypes[slot][1], 0, &path) == AI_SUCCESS) {
+                material.textures[slot] = importTexturePath(scene, path, *result, embedded);
+            }
+        }
+
+        result->materials.push_back(std::move(material));
+    }
+    return result;
+}
+
+// Writes standard material values into a parameter block, laid out as in boulder_cgo.h
+static void writeStandardParams(Material& material, const StandardMaterial& values) {
+    const float block[12] = {
+        values.baseColor[0], values.baseColor[1], values.baseColor[2], values.baseColor[3],
+        values.emissive[0], values.emissive[1], values.emissive[2], 0.0f,
+        values.metallic, values.roughness, values.normalScale, values.alphaCutoff,
+    };
+    memset(material.params, 0, sizeof(material.params));
+    memcpy(material.params, block, sizeof(block));
+    material.paramSize = sizeof(block);
+}
+
+// Builds a box per bone around the vertices it drives (used for hitboxes)
+static void collectBoneBoxes(const aiScene* scene, std::vector<BoneBox>& boxes) {
+    std::unordered_map<std::string, size_t> byName;
+
+    for (uint32_t m = 0; m < scene->mNumMeshes; m++) {
+        const aiMesh* mesh = scene->mMeshes[m];
+        for (uint32_t b = 0; b < mesh->mNumBones; b++) {
+            const aiBone* bone = mesh->mBones[b];
+            std::string name(bone->mName.C_Str());
+
+            for (uint32_t w = 0; w < bone->mNumWeights; w++) {
+                const aiVertexWeight& weight = bone->mWeights[w];
+                if (weight.mWeight < BONE_BOX_MIN_WEIGHT || weight.mVertexId >= mesh->mNumVertices) {
+                    continue;
+                }
+
+                const aiVector3D& v = mesh->mVertices[weight.mVertexId];
+                glm::vec3 position(v.x, v.y, v.z);
+
+                auto it = byName.find(name);
+                if (it == byName.end()) {
+                    byName[name] = boxes.size();
+                    boxes.push_back({name, position, position});
+                } else {
+                    BoneBox& box = boxes[it->second];
+                    box.min = glm::min(box.min, position);
+                    box.max = glm::max(box.max, position);
+                }
+            }
+        }
+    }
+}
+
+// Helper function to create depth buffer resources
+static int createDepthResources() {
+    // Prefer a format with stencil for outlines
+    g_engine.depthFormat = VK_FORMAT_D32_SFLOAT;
+    g_engine.stencilFormat = VK_FORMAT_UNDEFINED;
+    for (VkFormat format : {VK_FORMAT_D32_SFLOAT_S8_UINT, VK_FORMAT_D24_UNORM_S8_UINT}) {
+        VkFormatProperties properties;
+        vkGetPhysicalDeviceFormatProperties(g_engine.physicalDevice, format, &properties);
+        if (properties.optimalTilingFeatures & VK_FORMAT_FEATURE_DEPTH_STENCIL_ATTACHMENT_BIT) {
+            g_engine.depthFormat = format;
+            g_engine.stencilFormat = format;
+            break;
+        }
+    }
+    VkImageAspectFlags aspect = VK_IMAGE_ASPECT_DEPTH_BIT;
+    if (g_engine.stencilFormat != VK_FORMAT_UNDEFINED) {
+        aspect |= VK_IMAGE_ASPECT_STENCIL_BIT;
+    }
+
+    // Create depth image
+    VkImageCreateInfo imageInfo{};
+    imageInfo.sType = VK_STRUCTURE_TYPE_IMAGE_CREATE_INFO;
+    imageInfo.imageType = VK_IMAGE_TYPE_2D;
+    imageInfo.extent.width = g_engine.swapchainExtent.width;
+    imageInfo.extent.height = g_engine.swapchainExtent.height;
+    imageInfo.extent.depth = 1;
+    imageInfo.mipLevels = 1;
+    imageInfo.arrayLayers = 1;
+    imageInfo.format = g_engine.depthFormat;
+    imageInfo.tiling = VK_IMAGE_TILING_OPTIMAL;
+    imageInfo.initialLayout = VK_IMAGE_LAYOUT_UNDEFINED;
+    imageInfo.usage = VK_IMAGE_USAGE_DEPTH_STENCIL_ATTACHMENT_BIT;
+    imageInfo.samples = VK_SAMPLE_COUNT_1_BIT;
+    imageInfo.sharingMode = VK_SHARING_MODE_EXCLUSIVE;
+
+    if (vkCreateImage(g_engine.device, &imageInfo, nullptr, &g_engine.depthImage) != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to create depth image");
+        return -1;
+    }
+
+    // Allocate memory for depth image
+    VkMemoryRequirements memRequirements;
+    vkGetImageMemoryRequirements(g_engine.device, g_engine.depthImage, &memRequirements);
+
+    VkMemoryAllocateInfo allocInfo{};
+    allocInfo.sType = VK_STRUCTURE_TYPE_MEMORY_ALLOCATE_INFO;
+    allocInfo.allocationSize = memRequirements.size;
+    allocInfo.memoryTypeIndex = findMemoryType(memRequirements.memoryTypeBits, VK_MEMORY_PROPERTY_DEVICE_LOCAL_BIT);
+
+    if (allocateDeviceMemory(g_engine.device, &allocInfo, nullptr, &g_engine.depthImageMemory) != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to allocate depth image memory");
+        vkDestroyImage(g_engine.device, g_engine.depthImage, nullptr);
+        g_engine.depthImage = nullptr;
+        return -1;
+    }
+
+    vkBindImageMemory(g_engine.device, g_engine.depthImage, g_engine.depthImageMemory, 0);
+
+    // Create depth image view
+    VkImageViewCreateInfo viewInfo{};
+    viewInfo.sType = VK_STRUCTURE_TYPE_IMAGE_VIEW_CREATE_INFO;
+    viewInfo.image = g_engine.depthImage;
+    viewInfo.viewType = VK_IMAGE_VIEW_TYPE_2D;
+    viewInfo.format = g_engine.depthFormat;
+    viewInfo.subresourceRange.aspectMask = aspect;
+    viewInfo.subresourceRange.baseMipLevel = 0;
+    viewInfo.subresourceRange.levelCount = 1;
+    viewInfo.subresourceRange.baseArrayLayer = 0;
+    viewInfo.subresourceRange.layerCount = 1;
+
+    if (vkCreateImageView(g_engine.device, &viewInfo, nullptr, &g_engine.depthImageView) != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to create depth image view");
+        freeDeviceMemory(g_engine.device, g_engine.depthImageMemory, nullptr);
+        vkDestroyImage(g_engine.device, g_engine.depthImage, nullptr);
+        g_engine.depthImage = nullptr;
+        g_engine.depthImageMemory = nullptr;
+        return -1;
+    }
+
+    return 0;
+}
+
+// Helper function to destroy depth buffer resources
+static void destroyDepthResources() {
+    if (g_engine.depthImageView) {
+        vkDestroyImageView(g_engine.device, g_engine.depthImageView, nullptr);
+        g_engine.depthImageView = nullptr;
+    }
+    if (g_engine.depthImage) {
+        vkDestroyImage(g_engine.device, g_engine.depthImage, nullptr);
+        g_engine.depthImage = nullptr;
+    }
+    if (g_engine.depthImageMemory) {
+        freeDeviceMemory(g_engine.device, g_engine.depthImageMemory, nullptr);
+        g_engine.depthImageMemory = nullptr;
+    }
+}
+
+// Picks the requested present mode if the surface supports it, otherwise FIFO (always
+// supported), and records it in g_engine.presentMode
+static VkPresentModeKHR choosePresentMode() {
+    uint32_t presentModeCount;
+    vkGetPhysicalDeviceSurfacePresentModesKHR(g_engine.physicalDevice, g_engine.surface, &presentModeCount, nullptr);
+    std::vector<VkPresentModeKHR> presentModes(presentModeCount);
+    vkGetPhysicalDeviceSurfacePresentModesKHR(g_engine.physicalDevice, g_engine.surface, &presentModeCount, presentModes.data());
+
+    static const char* names[] = {"Immediate (uncapped framerate)", "Mailbox", "FIFO (vsync)", "FIFO relaxed"};
+    VkPresentModeKHR presentMode = VK_PRESENT_MODE_FIFO_KHR;
+    if (std::find(presentModes.begin(), presentModes.end(), g_engine.requestedPresentMode) != presentModes.end()) {
+        presentMode = g_engine.requestedPresentMode;
+    } else {
+        Logger::get().warning("Present mode {} not supported, falling back to FIFO", names[g_engine.requestedPresentMode]);
+    }
+    Logger::get().info("Using {} present mode", names[presentMode]);
+
+    g_engine.presentMode = presentMode;
+    return presentMode;
+}
+
+// Refresh rate of the display the window is on, 60 if unknown
+static float displayRefreshRate() {
+    SDL_DisplayID display = g_engine.window ? SDL_GetDisplayForWindow(g_engine.window) : 0;
+    const SDL_DisplayMode* mode = display ? SDL_GetCurrentDisplayMode(display) : nullptr;
+    return mode && mode->refresh_rate > 0 ? mode->refresh_rate : 60.0f;
+}
+
+// Stops timing frames submitted so far, when the frame slots or swapchain they were
+// presented to are reset
+static void resetFrameTimings() {
+    for (FrameTiming& timing : g_engine.frameTimings) {
+        timing = FrameTiming{};
+    }
+    for (bool& written : g_engine.timestampsWritten) {
+        written = false;
+    }
+}
+
+// Helper function to recreate swapchain
+static int recreate_swapchain() {
+
+    if (!g_engine.device || !g_engine.window || !g_engine.physicalDevice || !g_engine.surface) {
+        return -1;
+    }
+
+    // Prevent re-entry
+    if (g_engine.isRecreatingSwapchain) {
+        fail(ERROR_API_MISUSE, "recreate_swapchain is already recreating swapchain! Aborting...");
+        return 0;
+    }
+    g_engine.isRecreatingSwapchain = true;
+    g_engine.resizeEventDuringRecreate = false;
+
+    // Wait for ALL device operations to complete (including presentation engine)
+    // This ensures semaphores are no longer in use before we destroy them
+    vkDeviceWaitIdle(g_engine.device);
+
+    // Clean up old swapchain resources
+    for (auto imageView : g_engine.swapchainImageViews) {
+        vkDestroyImageView(g_engine.device, imageView, nullptr);
+    }
+    g_engine.swapchainImageViews.clear();
+
+    // Clean up old depth resources
+    destroyDepthResources();
+
+    // Clean up old per-frame-in-flight semaphores
+    for (size_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
+        vkDestroySemaphore(g_engine.device, g_engine.imageAvailableSemaphores[i], nullptr);
+        vkDestroySemaphore(g_engine.device, g_engine.renderFinishedSemaphores[i], nullptr);
+    }
+
+    VkSwapchainKHR oldSwapchain = g_engine.swapchain;
+
+    // Get current window size
+    int width, height;
+    SDL_GetWindowSize(g_engine.window, &width, &height);
+
+    // Handle minimization (width/height = 0) - just skip recreation
+    if (width == 0 || height == 0) {
+        Logger::get().info("Window minimized, skipping swapchain recreation");
+        g_engine.isRecreatingSwapchain = false;
+        return 0;
+    }
+
+    Logger::get().info("Recreating swapchain with size: {}x{}", width, height);
+
+    // Get surface capabilities
+    VkSurfaceCapabilitiesKHR capabilities;
+    vkGetPhysicalDeviceSurfaceCapabilitiesKHR(g_engine.physicalDevice, g_engine.surface, &capabilities);
+
+    // Update swapchain extent
+    g_engine.swapchainExtent = capabilities.currentExtent;
+    if (g_engine.swapchainExtent.width == UINT32_MAX) {
+        g_engine.swapchainExtent.width = std::clamp(static_cast<uint32_t>(width),
+                                                     capabilities.minImageExtent.width,
+                                                     capabilities.maxImageExtent.width);
+        g_engine.swapchainExtent.height = std::clamp(static_cast<uint32_t>(height),
+                                                      capabilities.minImageExtent.height,
+                                                      capabilities.maxImageExtent.height);
+    }
+
+    uint32_t imageCount = capabilities.minImageCount + 1;
+    if (capabilities.maxImageCount > 0 && imageCount > capabilities.maxImageCount) {
+        imageCount = capabilities.maxImageCount;
+    }
+
+    VkPresentModeKHR presentMode = choosePresentMode();
+
+    VkSwapchainCreateInfoKHR swapchainInfo{};
+    swapchainInfo.sType = VK_STRUCTURE_TYPE_SWAPCHAIN_CREATE_INFO_KHR;
+    swapchainInfo.surface = g_engine.surface;
+    swapchainInfo.minImageCount = imageCount;
+    swapchainInfo.imageFormat = g_engine.swapchainFormat;
+    swapchainInfo.imageColorSpace = VK_COLOR_SPACE_SRGB_NONLINEAR_KHR;
+    swapchainInfo.imageExtent = g_engine.swapchainExtent;
+    swapchainInfo.imageArrayLayers = 1;
+    swapchainInfo.imageUsage = VK_IMAGE_USAGE_COLOR_ATTACHMENT_BIT | VK_IMAGE_USAGE_TRANSFER_SRC_BIT |
+                               VK_IMAGE_USAGE_TRANSFER_DST_BIT;
+    swapchainInfo.imageSharingMode = VK_SHARING_MODE_EXCLUSIVE;
+    swapchainInfo.preTransform = capabilities.currentTransform;
+    swapchainInfo.compositeAlpha = VK_COMPOSITE_ALPHA_OPAQUE_BIT_KHR;
+    swapchainInfo.presentMode = presentMode;
+    swapchainInfo.clipped = VK_TRUE;
+    swapchainInfo.oldSwapchain = oldSwapchain;
+
+    if (vkCreateSwapchainKHR(g_engine.device, &swapchainInfo, nullptr, &g_engine.swapchain) != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to recreate swapchain");
+        g_engine.isRecreatingSwapchain = false;
+        return -1;
+    }
+
+    // Destroy old swapchain
+    if (oldSwapchain) {
+        vkDestroySwapchainKHR(g_engine.device, oldSwapchain, nullptr);
+    }
+    resetFrameTimings();
+    g_engine.refreshRate = displayRefreshRate();
+
+    // Get new swapchain images
+    vkGetSwapchainImagesKHR(g_engine.device, g_engine.swapchain, &imageCount, nullptr);
+    g_engine.swapchainImages.resize(imageCount);
+    vkGetSwapchainImagesKHR(g_engine.device, g_engine.swapchain, &imageCount, g_engine.swapchainImages.data());
+
+    // Reset per-image fence tracking (no frame is using any image after recreation)
+    // Use assign() to clear ALL elements, not just resize which keeps old values if size unchanged
+    g_engine.imagesInFlight.assign(imageCount, VK_NULL_HANDLE);
+
+    // Recreate image views
+    g_engine.swapchainImageViews.resize(imageCount);
+    for (size_t i = 0; i < imageCount; i++) {
+        VkImageViewCreateInfo viewInfo{};
+        viewInfo.sType = VK_STRUCTURE_TYPE_IMAGE_VIEW_CREATE_INFO;
+        viewInfo.image = g_engine.swapchainImages[i];
+        viewInfo.viewType = VK_IMAGE_VIEW_TYPE_2D;
+        viewInfo.format = g_engine.swapchainFormat;
+        viewInfo.components.r = VK_COMPONENT_SWIZZLE_IDENTITY;
+        viewInfo.components.g = VK_COMPONENT_SWIZZLE_IDENTITY;
+        viewInfo.components.b = VK_COMPONENT_SWIZZLE_IDENTITY;
+        viewInfo.components.a = VK_COMPONENT_SWIZZLE_IDENTITY;
+        viewInfo.subresourceRange.aspectMask = VK_IMAGE_ASPECT_COLOR_BIT;
+        viewInfo.subresourceRange.baseMipLevel = 0;
+        viewInfo.subresourceRange.levelCount = 1;
+        viewInfo.subresourceRange.baseArrayLayer = 0;
+        viewInfo.subresourceRange.layerCount = 1;
+
+        if (vkCreateImageView(g_engine.device, &viewInfo, nullptr, &g_engine.swapchainImageViews[i]) != VK_SUCCESS) {
+            fail(ERROR_VULKAN, "Failed to recreate image view");
+            g_engine.isRecreatingSwapchain = false;
+            return -1;
+        }
+    }
+
+    // Recreate depth resources
+    if (createDepthResources() != 0) {
+        fail(ERROR_VULKAN, "Failed to recreate depth resources");
+        g_engine.isRecreatingSwapchain = false;
+        return -1;
+    }
+
+    // Recreate per-frame-in-flight semaphores (both imageAvailable and renderFinished)
+    VkSemaphoreCreateInfo semaphoreInfo{};
+    semaphoreInfo.sType = VK_STRUCTURE_TYPE_SEMAPHORE_CREATE_INFO;
+
+    for (size_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
+        if (vkCreateSemaphore(g_engine.device, &semaphoreInfo, nullptr, &g_engine.imageAvailableSemaphores[i]) != VK_SUCCESS ||
+            vkCreateSemaphore(g_engine.device, &semaphoreInfo, nullptr, &g_engine.renderFinishedSemaphores[i]) != VK_SUCCESS) {
+            fail(ERROR_VULKAN, "Failed to recreate semaphores for frame {}", i);
+            g_engine.isRecreatingSwapchain = false;
+            return -1;
+        }
+    }
+
+    // Reset frame index to start fresh
+    g_engine.currentFrameIndex = 0;
+
+    // After vkDeviceWaitIdle, all fences are signaled but we need them in a known state
+    // Since we're resetting currentFrameIndex to 0, we should ensure fence[0] will work correctly
+    // Actually, let's leave fences as-is (signaled) and let normal flow handle them
+
+    // Command buffers are per-frame-in-flight (MAX_FRAMES_IN_FLIGHT), not per-image, so no recreation needed
+
+    Logger::get().info("Swapchain recreated successfully! Frame index reset to 0");
+
+    vkGetPhysicalDeviceSurfaceCapabilitiesKHR(g_engine.physicalDevice, g_engine.surface, &capabilities);
+
+    if (g_engine.swapchainExtent.height != capabilities.currentExtent.height || g_engine.swapchainExtent.width != capabilities.currentExtent.width){
+        g_engine.resizeEventDuringRecreate = true;
+    }
+
+    // Only clear the recreate flag if no resize event happened during recreation
+    if (!g_engine.resizeEventDuringRecreate) {
+        g_engine.swapchainNeedsRecreate = false;
+    } else {
+        Logger::get().info("Resize event occurred during recreation, will recreate again");
+        g_engine.resizeEventDuringRecreate = false;
+    }
+
+    g_engine.isRecreatingSwapchain = false;
+
+    return 0;
+}
+
+// Creates the sampler for textures the engine binds, using the current filter. The
+// previous sampler is destroyed, so the device must be idle when it is replaced.
+static int createTextureSampler() {
+    if (!g_engine.device) {
+        return -1;
+    }
+
+    bool nearest = g_engine.textureFilter == TEXTURE_FILTER_NEAREST;
+    VkSamplerCreateInfo samplerInfo{};
+    samplerInfo.sType = VK_STRUCTURE_TYPE_SAMPLER_CREATE_INFO;
+    samplerInfo.magFilter = nearest ? VK_FILTER_NEAREST : VK_FILTER_LINEAR;
+    samplerInfo.minFilter = nearest ? VK_FILTER_NEAREST : VK_FILTER_LINEAR;
+    samplerInfo.mipmapMode = nearest ? VK_SAMPLER_MIPMAP_MODE_NEAREST : VK_SAMPLER_MIPMAP_MODE_LINEAR;
+    samplerInfo.addressModeU = VK_SAMPLER_ADDRESS_MODE_REPEAT;
+    samplerInfo.addressModeV = VK_SAMPLER_ADDRESS_MODE_REPEAT;
+    samplerInfo.addressModeW = VK_SAMPLER_ADDRESS_MODE_REPEAT;
+    samplerInfo.anisotropyEnable = VK_FALSE;
+    samplerInfo.maxLod = VK_LOD_CLAMP_NONE;
+    samplerInfo.borderColor = VK_BORDER_COLOR_INT_OPAQUE_BLACK;
+
+    VkSampler sampler;
+    if (vkCreateSampler(g_engine.device, &samplerInfo, nullptr, &sampler) != VK_SUCCESS) {
+        return -1;
+    }
+
+    if (g_engine.textureSampler) {
+        vkDestroySampler(g_engine.device, g_engine.textureSampler, nullptr);
+    }
+    g_engine.textureSampler = sampler;
+    return 0;
+}
+
+// Uploads a texture's pixels into a sampled image through a staging buffer. Waits for the
+// upload to finish.
+// Bytes per pixel for RGBA8, or per 4x4 block for BCn; 0 for formats textures can't use
+static uint32_t textureBlockBytes(VkFormat format) {
+    switch (format) {
+        case VK_FORMAT_R8G8B8A8_UNORM:
+        case VK_FORMAT_R8G8B8A8_SRGB:
+            return 4;
+        case VK_FORMAT_BC1_RGB_UNORM_BLOCK:
+        case VK_FORMAT_BC1_RGB_SRGB_BLOCK:
+        case VK_FORMAT_BC1_RGBA_UNORM_BLOCK:
+        case VK_FORMAT_BC1_RGBA_SRGB_BLOCK:
+        case VK_FORMAT_BC4_UNORM_BLOCK:
+            return 8;
+        case VK_FORMAT_BC3_UNORM_BLOCK:
+        case VK_FORMAT_BC3_SRGB_BLOCK:
+        case VK_FORMAT_BC5_UNORM_BLOCK:
+        case VK_FORMAT_BC7_UNORM_BLOCK:
+        case VK_FORMAT_BC7_SRGB_BLOCK:
+            return 16;
+        default:
+            return 0;
+    }
+}
+
+// Size of one mip level of a texture
+static VkDeviceSize textureLevelSize(VkFormat format, uint32_t width, uint32_t height) {
+    VkDeviceSize blockBytes = textureBlockBytes(format);
+    if (blockBytes == 4) {
+        return blockBytes * width * height;
+    }
+    return blockBytes * ((width + 3) / 4) * ((height + 3) / 4);
+}
+
+static bool uploadTexture(Texture& texture) {
+    VkDeviceSize size = texture.pixels.size();
+    VkBuffer staging;
+    VkDeviceMemory stagingMemory;
+    if (!createBuffer(size, VK_BUFFER_USAGE_TRANSFER_SRC_BIT,
+                      VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT | VK_MEMORY_PROPERTY_HOST_COHERENT_BIT,
+                      staging, stagingMemory)) {
+        return false;
+    }
+    copyDataToBuffer(stagingMemory, texture.pixels.data(), size);
+
+    VkImageCreateInfo imageInfo{};
+    imageInfo.sType = VK_STRUCTURE_TYPE_IMAGE_CREATE_INFO;
+    imageInfo.imageType = VK_IMAGE_TYPE_2D;
+    imageInfo.format = texture.format;
+    imageInfo.extent = {texture.width, texture.height, 1};
+    imageInfo.mipLevels = texture.levels;
+    imageInfo.arrayLayers = 1;
+    imageInfo.samples = VK_SAMPLE_COUNT_1_BIT;
+    imageInfo.tiling = VK_IMAGE_TILING_OPTIMAL;
+    imageInfo.usage = VK_IMAGE_USAGE_TRANSFER_SRC_BIT | VK_IMAGE_USAGE_TRANSFER_DST_BIT | VK_IMAGE_USAGE_SAMPLED_BIT;
+    imageInfo.sharingMode = VK_SHARING_MODE_EXCLUSIVE;
+    imageInfo.initialLayout = VK_IMAGE_LAYOUT_UNDEFINED;
+
+    bool ok = vkCreateImage(g_engine.device, &imageInfo, nullptr, &texture.image) == VK_SUCCESS;
+    if (ok) {
+        VkMemoryRequirements memRequirements;
+        vkGetImageMemoryRequirements(g_engine.device, texture.image, &memRequirements);
+
+        VkMemoryAllocateInfo allocInfo{};
+        allocInfo.sType = VK_STRUCTURE_TYPE_MEMORY_ALLOCATE_INFO;
+        allocInfo.allocationSize = memRequirements.size;
+        allocInfo.memoryTypeIndex = findMemoryType(memRequirements.memoryTypeBits, VK_MEMORY_PROPERTY_DEVICE_LOCAL_BIT);
+        ok = allocateDeviceMemory(g_engine.device, &allocInfo, nullptr, &texture.memory) == VK_SUCCESS;
+    }
+    if (ok) {
+        vkBindImageMemory(g_engine.device, texture.image, texture.memory, 0);
+
+        VkCommandBufferAllocateInfo cmdInfo{};
+        cmdInfo.sType = VK_STRUCTURE_TYPE_COMMAND_BUFFER_ALLOCATE_INFO;
+        cmdInfo.commandPool = g_engine.commandPool;
+        cmdInfo.level = VK_COMMAND_BUFFER_LEVEL_PRIMARY;
+        cmdInfo.commandBufferCount = 1;
+
+        VkCommandBuffer cmd;
+        ok = vkAllocateCommandBuffers(g_engine.device, &cmdInfo, &cmd) == VK_SUCCESS;
+        if (ok) {
+            VkCommandBufferBeginInfo beginInfo{};
+            beginInfo.sType = VK_STRUCTURE_TYPE_COMMAND_BUFFER_BEGIN_INFO;
+            beginInfo.flags = VK_COMMAND_BUFFER_USAGE_ONE_TIME_SUBMIT_BIT;
+            vkBeginCommandBuffer(cmd, &beginInfo);
+
+            VkImageMemoryBarrier barrier{};
+            barrier.sType = VK_STRUCTURE_TYPE_IMAGE_MEMORY_BARRIER;
+            barrier.oldLayout = VK_IMAGE_LAYOUT_UNDEFINED;
+            barrier.newLayout = VK_IMAGE_LAYOUT_TRANSFER_DST_OPTIMAL;
+            barrier.srcQueueFamilyIndex = VK_QUEUE_FAMILY_IGNORED;
+            barrier.dstQueueFamilyIndex = VK_QUEUE_FAMILY_IGNORED;
+            barrier.image = texture.image;
+            barrier.subresourceRange = {VK_IMAGE_ASPECT_COLOR_BIT, 0, texture.levels, 0, 1};
+            barrier.srcAccessMask = 0;
+            barrier.dstAccessMask = VK_ACCESS_TRANSFER_WRITE_BIT;
+            vkCmdPipelineBarrier(cmd, VK_PIPELINE_STAGE_TOP_OF_PIPE_BIT, VK_PIPELINE_STAGE_TRANSFER_BIT,
+                                 0, 0, nullptr, 0, nullptr, 1, &barrier);
+
+            std::vector<VkBufferImageCopy> regions(texture.levels);
+            VkDeviceSize offset = 0;
+            for (uint32_t level = 0; level < texture.levels; level++) {
+                uint32_t width = std::max(texture.width >> level, 1u);
+                uint32_t height = std::max(texture.height >> level, 1u);
+                regions[level].bufferOffset = offset;
+                regions[level].imageSubresource = {VK_IMAGE_ASPECT_COLOR_BIT, level, 0, 1};
+                regions[level].imageExtent = {width, height, 1};
+                offset += textureLevelSize(texture.format, width, height);
+            }
+            vkCmdCopyBufferToImage(cmd, staging, texture.image, VK_IMAGE_LAYOUT_TRANSFER_DST_OPTIMAL,
+                                   texture.levels, regions.data());
+
+            barrier.oldLayout = VK_IMAGE_LAYOUT_TRANSFER_DST_OPTIMAL;
+            barrier.newLayout = VK_IMAGE_LAYOUT_SHADER_READ_ONLY_OPTIMAL;
+            barrier.srcAccessMask = VK_ACCESS_TRANSFER_WRITE_BIT;
+            barrier.dstAccessMask = VK_ACCESS_SHADER_READ_BIT;
+            vkCmdPipelineBarrier(cmd, VK_PIPELINE_STAGE_TRANSFER_BIT, VK_PIPELINE_STAGE_FRAGMENT_SHADER_BIT,
+                                 0, 0, nullptr, 0, nullptr, 1, &barrier);
+            vkEndCommandBuffer(cmd);
+
+            VkSubmitInfo submitInfo{};
+            submitInfo.sType = VK_STRUCTURE_TYPE_SUBMIT_INFO;
+            submitInfo.commandBufferCount = 1;
+            submitInfo.pCommandBuffers = &cmd;
+            ok = vkQueueSubmit(g_engine.graphicsQueue, 1, &submitInfo, VK_NULL_HANDLE) == VK_SUCCESS;
+            vkQueueWaitIdle(g_engine.graphicsQueue);
+            vkFreeCommandBuffers(g_engine.device, g_engine.commandPool, 1, &cmd);
+        }
+    }
+    if (ok) {
+        VkImageViewCreateInfo viewInfo{};
+        viewInfo.sType = VK_STRUCTURE_TYPE_IMAGE_VIEW_CREATE_INFO;
+        viewInfo.image = texture.image;
+        viewInfo.viewType = VK_IMAGE_VIEW_TYPE_2D;
+        viewInfo.format = texture.format;
+        viewInfo.subresourceRange = {VK_IMAGE_ASPECT_COLOR_BIT, 0, texture.levels, 0, 1};
+        ok = vkCreateImageView(g_engine.device, &viewInfo, nullptr, &texture.view) == VK_SUCCESS;
+    }
+
+    vkDestroyBuffer(g_engine.device, staging, nullptr);
+    freeDeviceMemory(g_engine.device, stagingMemory, nullptr);
+    if (!ok) {
+        fail(ERROR_VULKAN, "Failed to upload {}x{} texture", texture.width, texture.height);
+    }
+    return ok;
+}
+
+// Destroys a texture's GPU image, keeping its pixels
+static void destroyTextureImage(Texture& texture) {
+    if (texture.view) {
+        vkDestroyImageView(g_engine.device, texture.view, nullptr);
+    }
+    if (texture.image) {
+        vkDestroyImage(g_engine.device, texture.image, nullptr);
+    }
+    if (texture.memory) {
+        freeDeviceMemory(g_engine.device, texture.memory, nullptr);
+    }
+    texture.view = VK_NULL_HANDLE;
+    texture.image = VK_NULL_HANDLE;
+    texture.memory = VK_NULL_HANDLE;
+}
+
+// Uploads the backdrop's pixels. Frames blit it to the swapchain, which converts formats
+// but not colour spaces, so on an SRGB swapchain it is stored as SRGB too.
+static bool uploadBackdrop() {
+    VkFormat swapchainFormat = g_engine.swapchainFormat;
+    bool srgb = swapchainFormat == VK_FORMAT_B8G8R8A8_SRGB || swapchainFormat == VK_FORMAT_R8G8B8A8_SRGB;
+    g_engine.backdrop.format = srgb ? VK_FORMAT_R8G8B8A8_SRGB : VK_FORMAT_R8G8B8A8_UNORM;
+    if (!uploadTexture(g_engine.backdrop)) {
+        destroyTextureImage(g_engine.backdrop);
+        return false;
+    }
+    return true;
+}
+
+// Creates the material layouts and parameter buffers and uploads every texture. Called
+// when the window is created, so textures survive boulder_restart.
+static int createMaterialResources() {
+    VkDescriptorSetLayoutBinding bindings[2] = {};
+    bindings[0].binding = 0;
+    bindings[0].descriptorType = VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER;
+    bindings[0].descriptorCount = 1;
+    bindings[0].stageFlags = VK_SHADER_STAGE_MESH_BIT_EXT | VK_SHADER_STAGE_FRAGMENT_BIT;
+    bindings[1].binding = 1;
+    bindings[1].descriptorType = VK_DESCRIPTOR_TYPE_COMBINED_IMAGE_SAMPLER;
+    bindings[1].descriptorCount = MATERIAL_MAX_TEXTURES;
+    bindings[1].stageFlags = VK_SHADER_STAGE_FRAGMENT_BIT;
+
+    VkDescriptorSetLayoutCreateInfo layoutInfo{};
+    layoutInfo.sType = VK_STRUCTURE_TYPE_DESCRIPTOR_SET_LAYOUT_CREATE_INFO;
+    layoutInfo.bindingCount = 2;
+    layoutInfo.pBindings = bindings;
+    if (vkCreateDescriptorSetLayout(g_engine.device, &layoutInfo, nullptr, &g_engine.materialDescriptorSetLayout) != VK_SUCCESS) {
+        return -1;
+    }
+
+    // Same push constants and set 0 as the model pipeline, so material shaders can start
+    // from model.mesh
+    VkDescriptorSetLayout setLayouts[2] = {g_engine.modelDescriptorSetLayout, g_engine.materialDescriptorSetLayout};
+    VkPushConstantRange pushConstantRange{};
+    pushConstantRange.stageFlags = VK_SHADER_STAGE_MESH_BIT_EXT | VK_SHADER_STAGE_FRAGMENT_BIT;
+    pushConstantRange.offset = 0;
+    pushConstantRange.size = sizeof(ModelPushConstants);
+
+    VkPipelineLayoutCreateInfo pipelineLayoutInfo{};
+    pipelineLayoutInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_LAYOUT_CREATE_INFO;
+    pipelineLayoutInfo.setLayoutCount = 2;
+    pipelineLayoutInfo.pSetLayouts = setLayouts;
+    pipelineLayoutInfo.pushConstantRangeCount = 1;
+    pipelineLayoutInfo.pPushConstantRanges = &pushConstantRange;
+    if (vkCreatePipelineLayout(g_engine.device, &pipelineLayoutInfo, nullptr, &g_engine.materialPipelineLayout) != VK_SUCCESS) {
+        return -1;
+    }
+
+    VkPhysicalDeviceProperties properties;
+    vkGetPhysicalDeviceProperties(g_engine.physicalDevice, &properties);
+    g_engine.materialParamAlignment = std::max<VkDeviceSize>(properties.limits.minUniformBufferOffsetAlignment, 16);
+
+    for (uint32_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
+        if (!createBuffer(MATERIAL_PARAM_RING_SIZE, VK_BUFFER_USAGE_UNIFORM_BUFFER_BIT,
+                          VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT | VK_MEMORY_PROPERTY_HOST_COHERENT_BIT,
+                          g_engine.materialParamBuffers[i], g_engine.materialParamMemory[i])) {
+            return -1;
+        }
+        void* mapped;
+        vkMapMemory(g_engine.device, g_engine.materialParamMemory[i], 0, MATERIAL_PARAM_RING_SIZE, 0, &mapped);
+        g_engine.materialParamMapped[i] = static_cast<uint8_t*>(mapped);
+
+        if (!createBuffer(LIGHT_BUFFER_SIZE, VK_BUFFER_USAGE_STORAGE_BUFFER_BIT,
+                          VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT | VK_MEMORY_PROPERTY_HOST_COHERENT_BIT,
+                          g_engine.lightBuffers[i], g_engine.lightMemory[i])) {
+            return -1;
+        }
+        vkMapMemory(g_engine.device, g_engine.lightMemory[i], 0, LIGHT_BUFFER_SIZE, 0, &mapped);
+        g_engine.lightMapped[i] = static_cast<uint8_t*>(mapped);
+    }
+
+    if (g_engine.whiteTexture.pixels.empty()) {
+        g_engine.whiteTexture.pixels.assign(4, 255);
+        g_engine.whiteTexture.width = 1;
+        g_engine.whiteTexture.height = 1;
+    }
+    if (!uploadTexture(g_engine.whiteTexture)) {
+        return -1;
+    }
+    for (auto& [id, texture] : g_engine.textures) {
+        uploadTexture(texture);
+    }
+    if (!g_engine.backdrop.pixels.empty()) {
+        uploadBackdrop();
+    }
+
+    return 0;
+}
+
+// Destroys what createMaterialResources made. Material pipelines are destroyed with the
+// other modular pipelines.
+static void destroyMaterialResources() {
+    for (auto& [id, texture] : g_engine.textures) {
+        destroyTextureImage(texture);
+    }
+    destroyTextureImage(g_engine.whiteTexture);
+    destroyTextureImage(g_engine.backdrop);
+
+    for (uint32_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
+        if (g_engine.materialParamBuffers[i]) {
+            vkDestroyBuffer(g_engine.device, g_engine.materialParamBuffers[i], nullptr);
+            freeDeviceMemory(g_engine.device, g_engine.materialParamMemory[i], nullptr);
+        }
+        g_engine.materialParamBuffers[i] = VK_NULL_HANDLE;
+        g_engine.materialParamMemory[i] = VK_NULL_HANDLE;
+        g_engine.materialParamMapped[i] = nullptr;
+
+        if (g_engine.lightBuffers[i]) {
+            vkDestroyBuffer(g_engine.device, g_engine.lightBuffers[i], nullptr);
+            freeDeviceMemory(g_engine.device, g_engine.lightMemory[i], nullptr);
+        }
+        g_engine.lightBuffers[i] = VK_NULL_HANDLE;
+        g_engine.lightMemory[i] = VK_NULL_HANDLE;
+        g_engine.lightMapped[i] = nullptr;
+    }
+    if (g_engine.materialPipelineLayout) {
+        vkDestroyPipelineLayout(g_engine.device, g_engine.materialPipelineLayout, nullptr);
+        g_engine.materialPipelineLayout = VK_NULL_HANDLE;
+    }
+    if (g_engine.materialDescriptorSetLayout) {
+        vkDestroyDescriptorSetLayout(g_engine.device, g_engine.materialDescriptorSetLayout, nullptr);
+        g_engine.materialDescriptorSetLayout = VK_NULL_HANDLE;
+    }
+}
+
+// Push constants of the outline shaders: the model push constants plus outline settings
+struct OutlinePushConstants {
+    glm::mat4 viewProj;
+    glm::mat4 model;
+    uint32_t vertexOffset;
+    uint32_t indexOffset;
+    float thickness;
+    float padding;
+    glm::vec4 color;
+    glm::vec2 viewportSize;
+};
+
+// Creates the outline mask and outline pipelines from shaders/outline.mesh and
+// shaders/outline.frag. Outlines need a stencil buffer, so they stay off without one.
+static int createOutlineResources() {
+    if (g_engine.stencilFormat == VK_FORMAT_UNDEFINED) {
+        Logger::get().warning("No depth stencil format - outlines disabled");
+        return -1;
+    }
+
+    std::ifstream meshFile("shaders/outline.mesh");
+    std::string meshSource((std::istreambuf_iterator<char>(meshFile)), std::istreambuf_iterator<char>());
+    std::ifstream fragFile("shaders/outline.frag");
+    std::string fragSource((std::istreambuf_iterator<char>(fragFile)), std::istreambuf_iterator<char>());
+    if (meshSource.empty() || fragSource.empty()) {
+        Logger::get().warning("Outline shader files not found - outlines disabled");
+        return -1;
+    }
+
+    auto meshSpirv = compileShader(meshSource, shaderc_glsl_default_mesh_shader, "outline.mesh");
+    auto fragSpirv = compileShader(fragSource, shaderc_glsl_default_fragment_shader, "outline.frag");
+    if (meshSpirv.empty() || fragSpirv.empty()) {
+        return -1;
+    }
+
+    VkShaderModuleCreateInfo moduleInfo{};
+    moduleInfo.sType = VK_STRUCTURE_TYPE_SHADER_MODULE_CREATE_INFO;
+    moduleInfo.codeSize = meshSpirv.size() * sizeof(uint32_t);
+    moduleInfo.pCode = meshSpirv.data();
+    if (vkCreateShaderModule(g_engine.device, &moduleInfo, nullptr, &g_engine.outlineMeshShader) != VK_SUCCESS) {
+        return -1;
+    }
+    moduleInfo.codeSize = fragSpirv.size() * sizeof(uint32_t);
+    moduleInfo.pCode = fragSpirv.data();
+    if (vkCreateShaderModule(g_engine.device, &moduleInfo, nullptr, &g_engine.outlineFragShader) != VK_SUCCESS) {
+        return -1;
+    }
+
+    VkPushConstantRange pushConstantRange{};
+    pushConstantRange.stageFlags = VK_SHADER_STAGE_MESH_BIT_EXT | VK_SHADER_STAGE_FRAGMENT_BIT;
+    pushConstantRange.offset = 0;
+    pushConstantRange.size = sizeof(OutlinePushConstants);
+
+    VkPipelineLayoutCreateInfo layoutInfo{};
+    layoutInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_LAYOUT_CREATE_INFO;
+    layoutInfo.setLayoutCount = 1;
+    layoutInfo.pSetLayouts = &g_engine.modelDescriptorSetLayout;
+    layoutInfo.pushConstantRangeCount = 1;
+    layoutInfo.pPushConstantRanges = &pushConstantRange;
+    if (vkCreatePipelineLayout(g_engine.device, &layoutInfo, nullptr, &g_engine.outlinePipelineLayout) != VK_SUCCESS) {
+        return -1;
+    }
+
+    // Both passes ignore depth, so outlines show through whatever is in front
+    VkPipelineDepthStencilStateCreateInfo maskState{};
+    maskState.sType = VK_STRUCTURE_TYPE_PIPELINE_DEPTH_STENCIL_STATE_CREATE_INFO;
+    maskState.depthTestEnable = VK_FALSE;
+    maskState.depthWriteEnable = VK_FALSE;
+    maskState.stencilTestEnable = VK_TRUE;
+    maskState.front.failOp = VK_STENCIL_OP_KEEP;
+    maskState.front.passOp = VK_STENCIL_OP_REPLACE;
+    maskState.front.depthFailOp = VK_STENCIL_OP_REPLACE;
+    maskState.front.compareOp = VK_COMPARE_OP_ALWAYS;
+    maskState.front.compareMask = 0xFF;
+    maskState.front.writeMask = 0xFF;
+    maskState.front.reference = 1;
+    maskState.back = maskState.front;
+
+    VkPipelineDepthStencilStateCreateInfo outlineState = maskState;
+    outlineState.front.passOp = VK_STENCIL_OP_KEEP;
+    outlineState.front.depthFailOp = VK_STENCIL_OP_KEEP;
+    outlineState.front.compareOp = VK_COMPARE_OP_NOT_EQUAL;
+    outlineState.front.writeMask = 0;
+    outlineState.back = outlineState.front;
+
+    g_engine.outlineMaskPipeline = createPipeline(g_engine.outlineMeshShader, g_engine.outlineFragShader,
+                                                  g_engine.outlinePipelineLayout, VK_CULL_MODE_NONE,
+                                                  VK_FRONT_FACE_COUNTER_CLOCKWISE, BLEND_MODE_OPAQUE, &maskState, 0);
+    g_engine.outlinePipeline = createPipeline(g_engine.outlineMeshShader, g_engine.outlineFragShader,
+                                              g_engine.outlinePipelineLayout, VK_CULL_MODE_NONE,
+                                              VK_FRONT_FACE_COUNTER_CLOCKWISE, BLEND_MODE_OPAQUE, &outlineState);
+    return g_engine.outlineMaskPipeline && g_engine.outlinePipeline ? 0 : -1;
+}
+
+// Destroys what createOutlineResources made
+static void destroyOutlineResources() {
+    if (g_engine.outlineMaskPipeline) {
+        vkDestroyPipeline(g_engine.device, g_engine.outlineMaskPipeline, nullptr);
+        g_engine.outlineMaskPipeline = nullptr;
+    }
+    if (g_engine.outlinePipeline) {
+        vkDestroyPipeline(g_engine.device, g_engine.outlinePipeline, nullptr);
+        g_engine.outlinePipeline = nullptr;
+    }
+    if (g_engine.outlinePipelineLayout) {
+        vkDestroyPipelineLayout(g_engine.device, g_engine.outlinePipelineLayout, nullptr);
+        g_engine.outlinePipelineLayout = nullptr;
+    }
+    if (g_engine.outlineMeshShader) {
+        vkDestroyShaderModule(g_engine.device, g_engine.outlineMeshShader, nullptr);
+        g_engine.outlineMeshShader = nullptr;
+    }
+    if (g_engine.outlineFragShader) {
+        vkDestroyShaderModule(g_engine.device, g_engine.outlineFragShader, nullptr);
+        g_engine.outlineFragShader = nullptr;
+    }
+}
+
+// Allocates and fills the material set for an entity's draw: its parameter block, copied
+// into this frame's ring, and its textures. Returns VK_NULL_HANDLE when the frame is out of
+// parameter space or descriptor sets.
+static VkDescriptorSet writeMaterialSet(const Material& material) {
+    uint32_t frame = g_engine.currentFrameIndex;
+    // Always bind the whole block, so shaders declaring more than was set read zeros
+    VkDeviceSize range = MATERIAL_MAX_PARAMS;
+    if (!g_engine.materialParamMapped[frame] || !g_engine.whiteTexture.view ||
+        g_engine.materialParamOffset + range > MATERIAL_PARAM_RING_SIZE) {
+        return VK_NULL_HANDLE;
+    }
+
+    VkDescriptorSetAllocateInfo allocInfo{};
+    allocInfo.sType = VK_STRUCTURE_TYPE_DESCRIPTOR_SET_ALLOCATE_INFO;
+    allocInfo.descriptorPool = g_engine.modelDescriptorPools[frame];
+    allocInfo.descriptorSetCount = 1;
+    allocInfo.pSetLayouts = &g_engine.materialDescriptorSetLayout;
+
+    VkDescriptorSet descriptorSet;
+    if (vkAllocateDescriptorSets(g_engine.device, &allocInfo, &descriptorSet) != VK_SUCCESS) {
+        return VK_NULL_HANDLE;
+    }
+
+    VkDeviceSize offset = g_engine.materialParamOffset;
+    memcpy(g_engine.materialParamMapped[frame] + offset, material.params, range);
+    g_engine.materialParamOffset = (offset + range + g_engine.materialParamAlignment - 1) /
+                                   g_engine.materialParamAlignment * g_engine.materialParamAlignment;
+
+    VkDescriptorBufferInfo paramsInfo{};
+    paramsInfo.buffer = g_engine.materialParamBuffers[frame];
+    paramsInfo.offset = offset;
+    paramsInfo.range = range;
+
+    VkDescriptorImageInfo imageInfos[MATERIAL_MAX_TEXTURES] = {};
+    for (uint32_t i = 0; i < MATERIAL_MAX_TEXTURES; i++) {
+        const Texture* texture = &g_engine.whiteTexture;
+        auto it = g_engine.textures.find(material.textures[i]);
+        if (it != g_engine.textures.end() && it->second.view) {
+            texture = &it->second;
+        }
+        imageInfos[i].sampler = g_engine.textureSampler;
+        imageInfos[i].imageView = texture->view;
+        imageInfos[i].imageLayout = VK_IMAGE_LAYOUT_SHADER_READ_ONLY_OPTIMAL;
+    }
+
+    VkWriteDescriptorSet writes[2] = {};
+    writes[0].sType = VK_STRUCTURE_TYPE_WRITE_DESCRIPTOR_SET;
+    writes[0].dstSet = descriptorSet;
+    writes[0].dstBinding = 0;
+    writes[0].descriptorType = VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER;
+    writes[0].descriptorCount = 1;
+    writes[0].pBufferInfo = &paramsInfo;
+    writes[1].sType = VK_STRUCTURE_TYPE_WRITE_DESCRIPTOR_SET;
+    writes[1].dstSet = descriptorSet;
+    writes[1].dstBinding = 1;
+    writes[1].descriptorType = VK_DESCRIPTOR_TYPE_COMBINED_IMAGE_SAMPLER;
+    writes[1].descriptorCount = MATERIAL_MAX_TEXTURES;
+    writes[1].pImageInfo = imageInfos;
+    vkUpdateDescriptorSets(g_engine.device, 2, writes, 0, nullptr);
+
+    return descriptorSet;
+}
+
+// Screen pixels per world unit of the orthographic camera, 0 for perspective. Pixel perfect
+// cameras use a whole number of screen pixels per art pixel.
+static float cameraPixelScale() {
+    const Camera& camera = g_engine.camera;
+    float height = (float)g_engine.swapchainExtent.height;
+    if (camera.projection != CAMERA_ORTHOGRAPHIC || height <= 0.0f) {
+        return 0.0f;
+    }
+    if (camera.pixelsPerUnit <= 0.0f) {
+        return height / camera.orthoHeight;
+    }
+
+    int zoom = camera.zoom;
+    if (zoom <= 0) {
+        zoom = std::max(1, (int)std::floor(height / (camera.orthoHeight * camera.pixelsPerUnit)));
+    }
+    return camera.pixelsPerUnit * zoom;
+}
+
+// Builds the camera's view and projection for the current swapchain. Returns the world
+// distance positions are snapped to, or 0 when they aren't.
+static float cameraMatrices(glm::mat4& view, glm::mat4& proj) {
+    const Camera& camera = g_engine.camera;
+    float width = (float)g_engine.swapchainExtent.width;
+    float height = (float)g_engine.swapchainExtent.height;
+
+    glm::vec3 forward = camera.target - camera.position;
+    if (glm::length(forward) < 1e-6f) {
+        forward = glm::vec3(0.0f, 0.0f, -1.0f);
+    }
+    view = glm::lookAt(camera.position, camera.position + forward, camera.up);
+
+    if (camera.projection != CAMERA_ORTHOGRAPHIC) {
+        float aspect = height > 0.0f ? width / height : 1.0f;
+        proj = glm::perspective(glm::radians(camera.fovY), aspect, camera.nearZ, camera.farZ);
+        proj[1][1] *= -1; // Flip Y for Vulkan
+        return 0.0f;
+    }
+
+    // Edges sit on whole pixels from the view center, so with odd sizes the world grid
+    // still lines up with pixel edges. Top and bottom are swapped to flip Y for Vulkan.
+    float scale = std::max(cameraPixelScale(), 1e-6f);
+    float left = -std::floor(width * 0.5f) / scale;
+    float bottom = -std::floor(height * 0.5f) / scale;
+    proj = glm::orthoRH_ZO(left, left + width / scale, bottom + height / scale, bottom, camera.nearZ, camera.farZ);
+
+    float snapUnit = 0.0f;
+    if (camera.snap == CAMERA_SNAP_PIXEL) {
+        snapUnit = 1.0f / scale;
+    } else if (camera.snap == CAMERA_SNAP_TEXEL) {
+        snapUnit = camera.pixelsPerUnit > 0.0f ? 1.0f / camera.pixelsPerUnit : 1.0f / scale;
+    }
+    if (snapUnit > 0.0f) {
+        view[3][0] = std::round(view[3][0] / snapUnit) * snapUnit;
+        view[3][1] = std::round(view[3][1] / snapUnit) * snapUnit;
+    }
+    return snapUnit;
+}
+
+// Moves a position onto the snapping grid in view space
+static glm::vec3 snapToPixels(const glm::mat4& view, const glm::vec3& position, float snapUnit) {
+    if (snapUnit <= 0.0f) {
+        return position;
+    }
+
+    glm::vec3 viewPosition = glm::vec3(view * glm::vec4(position, 1.0f));
+    glm::vec2 offset = glm::round(glm::vec2(viewPosition) / snapUnit) * snapUnit - glm::vec2(viewPosition);
+    // The view's rotation is orthonormal, so its transpose takes the offset back to world space
+    return position + glm::transpose(glm::mat3(view)) * glm::vec3(offset, 0.0f);
+}
+
+// Fills this frame's light buffer from the active world's lights, the ones nearest the
+// camera first when there are more than MAX_LIGHTS
+static void writeLights() {
+    uint8_t* mapped = g_engine.lightMapped[g_engine.currentFrameIndex];
+    if (!mapped) {
+        return;
+    }
+
+    struct Candidate {
+        GpuLight light;
+        float distance; // Directional lights sort first
+    };
+    std::vector<Candidate> candidates;
+    glm::vec3 cameraPosition = g_engine.camera.position;
+
+    auto query = g_engine.ecs->query<const Light>();
+    query.each([&](flecs::entity e, const Light& light) {
+        glm::vec3 position(0.0f);
+        glm::quat rotation(1.0f, 0.0f, 0.0f, 0.0f);
+        if (const Transform* transform = e.get<Transform>()) {
+            position = transform->position;
+            rotation = transform->rotation;
+        }
+
+        Candidate c;
+        glm::vec3 direction = glm::normalize(rotation * glm::vec3(0.0f, 0.0f, -1.0f));
+        c.light.positionRange = glm::vec4(position, light.range);
+        c.light.directionType = glm::vec4(direction, static_cast<float>(light.type));
+        c.light.colorIntensity = glm::vec4(light.color, light.intensity);
+        c.light.cone = glm::vec4(std::cos(glm::radians(light.innerCone)), std::cos(glm::radians(light.outerCone)), 0.0f, 0.0f);
+        c.distance = light.type == LIGHT_DIRECTIONAL ? -1.0f : glm::distance(position, cameraPosition);
+        candidates.push_back(c);
+    });
+
+    if (candidates.empty()) {
+        Candidate c;
+        c.light.positionRange = glm::vec4(0.0f);
+        c.light.directionType = glm::vec4(-glm::normalize(glm::vec3(0.5f, 1.0f, 0.3f)), static_cast<float>(LIGHT_DIRECTIONAL));
+        c.light.colorIntensity = glm::vec4(1.0f, 1.0f, 1.0f, 0.8f);
+        c.light.cone = glm::vec4(0.0f);
+        candidates.push_back(c);
+    }
+    if (candidates.size() > MAX_LIGHTS) {
+        std::partial_sort(candidates.begin(), candidates.begin() + MAX_LIGHTS, candidates.end(),
+                          [](const Candidate& a, const Candidate& b) { return a.distance < b.distance; });
+        candidates.resize(MAX_LIGHTS);
+    }
+
+    GpuLightHeader header{};
+    header.ambient = glm::vec4(g_engine.ambientLight, 0.0f);
+    header.count = static_cast<uint32_t>(candidates.size());
+    memcpy(mapped, &header, sizeof(header));
+    for (size_t i = 0; i < candidates.size(); i++) {
+        memcpy(mapped + sizeof(header) + i * sizeof(GpuLight), &candidates[i].light, sizeof(GpuLight));
+    }
+}
+
+// Render all models with the Model component
+int boulder_render_models() {
+    NATIVE_TRY
+    SubsystemTimer timer{g_engine.subsystemTimes.modelsMs};
+    if (g_engine.initialized && !g_engine.activeCommandBuffer) {
+        apiMisuse("RenderModels called outside a frame (call BeginFrame first)");
+        return -1;
+    }
+    if (!g_engine.initialized || !g_engine.activeCommandBuffer || !g_engine.modelPipeline || !g_engine.ecs) {
+        return 0;
+    }
+    ActiveWorldScope scope;
+
+    // Models bind their own pipelines, so DrawMesh needs a pipeline bound again afterwards
+    vkCmdBindPipeline(g_engine.activeCommandBuffer, VK_PIPELINE_BIND_POINT_GRAPHICS, g_engine.modelPipeline);
+    g_engine.boundPipeline = nullptr;
+    g_engine.boundPipelineId = 0;
+
+    // Ensure all storage buffer writes are visible to mesh shader reads
+    VkMemoryBarrier memoryBarrier{};
+    memoryBarrier.sType = VK_STRUCTURE_TYPE_MEMORY_BARRIER;
+    memoryBarrier.srcAccessMask = VK_ACCESS_HOST_WRITE_BIT | VK_ACCESS_TRANSFER_WRITE_BIT;
+    memoryBarrier.dstAccessMask = VK_ACCESS_SHADER_READ_BIT;
+
+    vkCmdPipelineBarrier(
+        g_engine.activeCommandBuffer,
+        VK_PIPELINE_STAGE_HOST_BIT | VK_PIPELINE_STAGE_TRANSFER_BIT,
+        VK_PIPELINE_STAGE_MESH_SHADER_BIT_EXT,
+        0,
+        1, &memoryBarrier,
+        0, nullptr,
+        0, nullptr
+    );
+
+    // Set dynamic viewport and scissor
+    boulder_set_viewport(0.0f, 0.0f, (float)g_engine.swapchainExtent.width, (float)g_engine.swapchainExtent.height, 0.0f, 1.0f);
+    boulder_set_scissor(0, 0, g_engine.swapchainExtent.width, g_engine.swapchainExtent.height);
+
+    // Set up view-projection matrix
+    glm::mat4 view, proj;
+    float snapUnit = cameraMatrices(view, proj);
+    glm::mat4 viewProj = proj * view;
+    writeLights();
+
+    // Query all entities with Model and Transform components
+    auto query = g_engine.ecs->query_builder<Model, const Transform>().build();
+
+    static bool logged = false;
+    int entityCount = 0;
+    VkPipeline boundPipeline = g_engine.modelPipeline;
+
+    // Outlined models are drawn again after the scene, with the mesh sets written below
+    struct OutlineMesh {
+        VkDescriptorSet descriptorSet;
+        uint32_t indexCount;
+    };
+    struct OutlineDraw {
+        glm::mat4 model;
+        glm::vec4 color;
+        float thickness;
+        std::vector<OutlineMesh> meshes;
+    };
+    std::vector<OutlineDraw> outlines;
+
+    // Built-in model pipeline for a blend mode
+    auto modelPipelineFor = [](int blendMode) {
+        VkPipeline pipeline = g_engine.modelBlendPipelines[blendMode];
+        return pipeline ? pipeline : g_engine.modelPipeline;
+    };
+
+    // Collect the visible models first to draw them in order: by render queue, then
+    // blended models back to front and the rest grouped by pipeline
+    struct ModelDraw {
+        flecs::entity entity;
+        Model* model;
+        glm::mat4 matrix;
+        const Material* material; // Material to draw with, if its pipeline exists
+        VkPipeline pipeline;
+        int blendMode;
+        int queue;
+        float depth; // View space Z, further is more negative
+    };
+    std::vector<ModelDraw> draws;
+
+    query.each([&](flecs::entity e, Model& model, const Transform& transform) {
+        if (!model.visible) {
+            return;
+        }
+
+        // Build model matrix from transform
+        glm::mat4 modelMatrix = glm::mat4(1.0f);
+        modelMatrix = glm::translate(modelMatrix, snapToPixels(view, transform.position, snapUnit));
+        if (const SoftBody* sb = e.get<SoftBody>()) {
+            // Shear the model so points higher up follow the wobble further
+            glm::mat4 shear(1.0f);
+            shear[1] = glm::vec4(sb->offset.x, 1.0f + sb->offset.y, sb->offset.z, 0.0f);
+            modelMatrix = modelMatrix * shear;
+        }
+        modelMatrix = modelMatrix * glm::mat4_cast(transform.rotation);
+        modelMatrix = glm::scale(modelMatrix, transform.scale);
+
+        const Material* material = e.get<Material>();
+        int blendMode = material ? material->blendMode : BLEND_MODE_OPAQUE;
+        int queue = material ? material->queue : 0;
+        if (queue == 0) {
+            queue = blendMode == BLEND_MODE_OPAQUE ? RENDER_QUEUE_OPAQUE
+                  : blendMode == BLEND_MODE_ALPHA_TEST ? RENDER_QUEUE_ALPHA_TEST
+                  : RENDER_QUEUE_TRANSPARENT;
+        }
+
+        // Materials without a pipeline, the model file's included, use the default one
+        static const Material noMaterial;
+        uint64_t materialPipeline = material ? material->pipeline : 0;
+        if (materialPipeline == 0 && (material || !model.materials.empty())) {
+            materialPipeline = g_engine.defaultMaterialPipeline;
+        }
+
+        VkPipeline pipeline = modelPipelineFor(blendMode);
+        if (g_engine.materialPipelines.count(materialPipeline)) {
+            pipeline = blendMode == BLEND_MODE_OPAQUE ? g_engine.pipelines[materialPipeline]
+                                                      : g_engine.materialBlendPipelines[materialPipeline][blendMode];
+            if (!material) {
+                material = &noMaterial;
+            }
+        } else {
+            material = nullptr;
+        }
+
+        float depth = (view * modelMatrix[3]).z;
+        draws.push_back({e, &model, modelMatrix, material, pipeline, blendMode, queue, depth});
+    });
+
+    std::stable_sort(draws.begin(), draws.end(), [](const ModelDraw& a, const ModelDraw& b) {
+        if (a.queue != b.queue) {
+            return a.queue < b.queue;
+        }
+        bool aBlended = a.blendMode >= BLEND_MODE_ALPHA_BLEND;
+        bool bBlended = b.blendMode >= BLEND_MODE_ALPHA_BLEND;
+        if (aBlended != bBlended) {
+            return bBlended;
+        }
+        if (aBlended) {
+            return a.depth < b.depth;
+        }
+        return a.pipeline < b.pipeline;
+    });
+
+    for (ModelDraw& draw : draws) {
+        flecs::entity e = draw.entity;
+        Model& model = *draw.model;
+        const glm::mat4& modelMatrix = draw.matrix;
+        entityCount++;
+
+        // Entities with a custom material draw with its pipeline and material set, falling
+        // back to the model pipeline if the frame is out of material space
+        VkPipeline pipeline = draw.pipeline;
+        VkPipelineLayout layout = g_engine.modelPipelineLayout;
+        VkDescriptorSet materialSet = VK_NULL_HANDLE;
+        if (draw.material) {
+            materialSet = writeMaterialSet(*draw.material);
+            if (materialSet) {
+                layout = g_engine.materialPipelineLayout;
+            } else {
+                pipeline = modelPipelineFor(draw.blendMode);
+            }
+        }
+        if (pipeline != boundPipeline) {
+            vkCmdBindPipeline(g_engine.activeCommandBuffer, VK_PIPELINE_BIND_POINT_GRAPHICS, pipeline);
+            boundPipeline = pipeline;
+        }
+
+        InstanceColor instanceColor;
+        if (const InstanceColor* color = e.get<InstanceColor>()) {
+            instanceColor = *color;
+        }
+
+        OutlineDraw* outline = nullptr;
+        const Outline* outlineSettings = e.get<Outline>();
+        if (outlineSettings && g_engine.outlinePipeline) {
+            outlines.push_back({modelMatrix, outlineSettings->color, outlineSettings->thickness, {}});
+            outline = &outlines.back();
+        }
+
+        // Meshes with a material from the model file draw with its parameters and textures,
+        // one material set per file material
+        std::vector<VkDescriptorSet> fileMaterialSets(materialSet ? model.materials.size() : 0);
+
+        // Render each mesh in the model
+        int meshIndex = 0;
+        for (auto& mesh : model.meshes) {
+            VkBuffer vertexBuffer = mesh.vertexBuffer;
+            if (mesh.dynamic) {
+                flushDynamicVertices(mesh, g_engine.currentFrameIndex);
+                vertexBuffer = mesh.frameVertexBuffers[g_engine.currentFrameIndex];
+            }
+
+            if (!logged) {
+                Logger::get().info("Processing mesh {}: vbuf={:x} ibuf={:x} indices={}",
+                                  meshIndex, (uint64_t)vertexBuffer, (uint64_t)mesh.indexBuffer, mesh.indexCount);
+            }
+
+            if (vertexBuffer == VK_NULL_HANDLE || mesh.indexBuffer == VK_NULL_HANDLE) {
+                if (!logged) {
+                    Logger::get().error("Skipping mesh {} - null buffers!", meshIndex);
+                }
+                meshIndex++;
+                continue;
+            }
+
+            // Pick the index list of the model's LOD (LOD 0 is the full mesh)
+            VkBuffer indexBuffer = mesh.indexBuffer;
+            VkBuffer drawParamsBuffer = mesh.drawParamsBuffer;
+            uint32_t indexCount = mesh.indexCount;
+            int modelLod = std::max(model.lod + g_engine.lodBias, 0);
+            if (modelLod > 0 && !mesh.lods.empty()) {
+                const MeshLod& lod = mesh.lods[std::min<size_t>(modelLod, mesh.lods.size()) - 1];
+                indexBuffer = lod.indexBuffer;
+                drawParamsBuffer = lod.drawParamsBuffer;
+                indexCount = lod.indexCount;
+            }
+
+            // Allocate descriptor set for this mesh from current frame's pool
+            VkDescriptorSetAllocateInfo allocInfo{};
+            allocInfo.sType = VK_STRUCTURE_TYPE_DESCRIPTOR_SET_ALLOCATE_INFO;
+            allocInfo.descriptorPool = g_engine.modelDescriptorPools[g_engine.currentFrameIndex];
+            allocInfo.descriptorSetCount = 1;
+            allocInfo.pSetLayouts = &g_engine.modelDescriptorSetLayout;
+
+            VkDescriptorSet descriptorSet;
+            if (vkAllocateDescriptorSets(g_engine.device, &allocInfo, &descriptorSet) != VK_SUCCESS) {
+                fail(ERROR_VULKAN, "Failed to allocate descriptor set for model mesh");
+                continue;
+            }
+
+            // Update descriptor set with storage buffer bindings
+            VkDescriptorBufferInfo vertexBufferInfo{};
+            vertexBufferInfo.buffer = vertexBuffer;
+            vertexBufferInfo.offset = 0;
+            vertexBufferInfo.range = VK_WHOLE_SIZE;
+
+            VkDescriptorBufferInfo indexBufferInfo{};
+            indexBufferInfo.buffer = indexBuffer;
+            indexBufferInfo.offset = 0;
+            indexBufferInfo.range = VK_WHOLE_SIZE;
+
+            VkDescriptorBufferInfo drawParamsInfo{};
+            drawParamsInfo.buffer = drawParamsBuffer;
+            drawParamsInfo.offset = 0;
+            drawParamsInfo.range = VK_WHOLE_SIZE;
+
+            VkDescriptorBufferInfo lightsInfo{};
+            lightsInfo.buffer = g_engine.lightBuffers[g_engine.currentFrameIndex];
+            lightsInfo.offset = 0;
+            lightsInfo.range = VK_WHOLE_SIZE;
+
+            VkWriteDescriptorSet descriptorWrites[4] = {};
+
+            descriptorWrites[0].sType = VK_STRUCTURE_TYPE_WRITE_DESCRIPTOR_SET;
+            descriptorWrites[0].dstSet = descriptorSet;
+            descriptorWrites[0].dstBinding = 0;
+            descriptorWrites[0].dstArrayElement = 0;
+            descriptorWrites[0].descriptorType = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
+            descriptorWrites[0].descriptorCount = 1;
+            descriptorWrites[0].pBufferInfo = &vertexBufferInfo;
+
+            descriptorWrites[1].sType = VK_STRUCTURE_TYPE_WRITE_DESCRIPTOR_SET;
+            descriptorWrites[1].dstSet = descriptorSet;
+            descriptorWrites[1].dstBinding = 1;
+            descriptorWrites[1].dstArrayElement = 0;
+            descriptorWrites[1].descriptorType = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
+            descriptorWrites[1].descriptorCount = 1;
+            descriptorWrites[1].pBufferInfo = &indexBufferInfo;
+
+            descriptorWrites[2].sType = VK_STRUCTURE_TYPE_WRITE_DESCRIPTOR_SET;
+            descriptorWrites[2].dstSet = descriptorSet;
+            descriptorWrites[2].dstBinding = 2;
+            descriptorWrites[2].dstArrayElement = 0;
+            descriptorWrites[2].descriptorType = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
+            descriptorWrites[2].descriptorCount = 1;
+            descriptorWrites[2].pBufferInfo = &drawParamsInfo;
+
+            descriptorWrites[3].sType = VK_STRUCTURE_TYPE_WRITE_DESCRIPTOR_SET;
+            descriptorWrites[3].dstSet = descriptorSet;
+            descriptorWrites[3].dstBinding = 3;
+            descriptorWrites[3].dstArrayElement = 0;
+            descriptorWrites[3].descriptorType = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
+            descriptorWrites[3].descriptorCount = 1;
+            descriptorWrites[3].pBufferInfo = &lightsInfo;
+
+            vkUpdateDescriptorSets(g_engine.device, 4, descriptorWrites, 0, nullptr);
+
+            // Bind descriptor sets
+            vkCmdBindDescriptorSets(g_engine.activeCommandBuffer, VK_PIPELINE_BIND_POINT_GRAPHICS,
+                                   layout, 0, 1, &descriptorSet, 0, nullptr);
+            if (materialSet) {
+                VkDescriptorSet meshMaterialSet = materialSet;
+                if (mesh.material >= 0 && mesh.material < static_cast<int>(fileMaterialSets.size())) {
+                    VkDescriptorSet& fileSet = fileMaterialSets[mesh.material];
+                    if (!fileSet) {
+                        Material merged = *draw.material;
+                        const Material& fileMaterial = model.materials[mesh.material];
+                        memcpy(merged.params, fileMaterial.params, sizeof(merged.params));
+                        merged.paramSize = fileMaterial.paramSize;
+                        memcpy(merged.textures, fileMaterial.textures, sizeof(merged.textures));
+                        fileSet = writeMaterialSet(merged);
+                    }
+                    if (fileSet) {
+                        meshMaterialSet = fileSet;
+                    }
+                }
+                vkCmdBindDescriptorSets(g_engine.activeCommandBuffer, VK_PIPELINE_BIND_POINT_GRAPHICS,
+                                       layout, 1, 1, &meshMaterialSet, 0, nullptr);
+            }
+
+            // Set push constants
+            ModelPushConstants pushConstants{};
+            pushConstants.viewProj = viewProj;
+            pushConstants.model = modelMatrix;
+            pushConstants.vertexOffset = 0;
+            pushConstants.indexOffset = 0;
+            pushConstants.tint = instanceColor.tint;
+            pushConstants.emissive = instanceColor.emissive;
+
+            vkCmdPushConstants(g_engine.activeCommandBuffer, layout,
+                             VK_SHADER_STAGE_MESH_BIT_EXT | VK_SHADER_STAGE_FRAGMENT_BIT,
+                             0, sizeof(ModelPushConstants), &pushConstants);
+
+            // Draw mesh with mesh shader
+            // Calculate workgroups needed (30 indices = 10 triangles per workgroup)
+            uint32_t numWorkgroups = (indexCount + 29) / 30;
+
+            if (!logged) {
+                Logger::get().info("Drawing mesh: {} indices, {} workgroups", indexCount, numWorkgroups);
+            }
+
+            vkCmdDrawMeshTasksEXT(g_engine.activeCommandBuffer, numWorkgroups, 1, 1);
+            g_engine.frameDrawCalls++;
+            g_engine.frameTriangles += indexCount / 3;
+
+            if (outline) {
+                outline->meshes.push_back({descriptorSet, indexCount});
+            }
+
+            meshIndex++;
+        }
+    }
+
+    // Mark every outlined model in the stencil buffer first, so outlines never cover
+    // another selected model, then draw the expanded models outside the marks
+    if (!outlines.empty()) {
+        for (VkPipeline pipeline : {g_engine.outlineMaskPipeline, g_engine.outlinePipeline}) {
+            vkCmdBindPipeline(g_engine.activeCommandBuffer, VK_PIPELINE_BIND_POINT_GRAPHICS, pipeline);
+            bool mask = pipeline == g_engine.outlineMaskPipeline;
+
+            for (const OutlineDraw& outline : outlines) {
+                OutlinePushConstants pushConstants{};
+                pushConstants.viewProj = viewProj;
+                pushConstants.model = outline.model;
+                pushConstants.thickness = mask ? 0.0f : outline.thickness;
+                pushConstants.color = outline.color;
+                pushConstants.viewportSize = glm::vec2(g_engine.swapchainExtent.width, g_engine.swapchainExtent.height);
+
+                for (const OutlineMesh& mesh : outline.meshes) {
+                    vkCmdBindDescriptorSets(g_engine.activeCommandBuffer, VK_PIPELINE_BIND_POINT_GRAPHICS,
+                                           g_engine.outlinePipelineLayout, 0, 1, &mesh.descriptorSet, 0, nullptr);
+                    vkCmdPushConstants(g_engine.activeCommandBuffer, g_engine.outlinePipelineLayout,
+                                       VK_SHADER_STAGE_MESH_BIT_EXT | VK_SHADER_STAGE_FRAGMENT_BIT,
+                                       0, sizeof(OutlinePushConstants), &pushConstants);
+                    vkCmdDrawMeshTasksEXT(g_engine.activeCommandBuffer, (mesh.indexCount + 29) / 30, 1, 1);
+                    g_engine.frameDrawCalls++;
+                    g_engine.frameTriangles += mesh.indexCount / 3;
+                }
+            }
+        }
+    }
+
+    // Debug log on first frame
+    if (!logged && entityCount > 0) {
+        Logger::get().info("Rendering {} entities with models", entityCount);
+        logged = true;
+    }
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+// Legacy function - use begin_frame/end_frame instead
+int boulder_render() {
+    NATIVE_TRY
+    uint32_t imageIndex;
+    int result = boulder_begin_frame(&imageIndex);
+
+    if (result == -3) {
+        // Paused in the background; nothing is shown
+        return 0;
+    } else if (result == -2) {
+        // Swapchain needs recreation
+        if (recreate_swapchain() != 0) {
+            return -1;
+        }
+        return 0;
+    } else if (result != 0) {
+        return result;
+    }
+
+    // Draw cube with mesh shader (DISABLED for debugging model rendering)
+    if (false && g_engine.cubePipeline) {
+        vkCmdBindPipeline(g_engine.activeCommandBuffer, VK_PIPELINE_BIND_POINT_GRAPHICS, g_engine.cubePipeline);
+
+        // Set dynamic viewport and scissor
+        boulder_set_viewport(0.0f, 0.0f, (float)g_engine.swapchainExtent.width, (float)g_engine.swapchainExtent.height, 0.0f, 1.0f);
+        boulder_set_scissor(0, 0, g_engine.swapchainExtent.width, g_engine.swapchainExtent.height);
+
+        // Set up view-projection matrix (simple perspective)
+        float aspect = (float)g_engine.swapchainExtent.width / (float)g_engine.swapchainExtent.height;
+        glm::mat4 proj = glm::perspective(glm::radians(90.0f), aspect, 0.1f, 100.0f);
+        proj[1][1] *= -1; // Flip Y for Vulkan
+
+        glm::mat4 view = glm::lookAt(
+            glm::vec3(2.0f, 2.0f, 2.0f),
+            glm::vec3(0.0f, 0.0f, 0.0f),
+            glm::vec3(0.0f, 1.0f, 0.0f)
+        );
+
+        glm::mat4 viewProj = proj * view;
+
+        // Get current time for animation
+        static auto startTime = std::chrono::high_resolution_clock::now();
+        auto currentTime = std::chrono::high_resolution_clock::now();
+        float time = std::chrono::duration<float, std::chrono::seconds::period>(currentTime - startTime).count();
+
+        // Push constants
+        struct PushConstants {
+            glm::mat4 viewProj;
+            float time;
+        } pushConstants;
+        pushConstants.viewProj = viewProj;
+        pushConstants.time = time;
+
+        vkCmdPushConstants(g_engine.activeCommandBuffer, g_engine.pipelineLayout, VK_SHADER_STAGE_MESH_BIT_EXT,
+                           0, sizeof(PushConstants), &pushConstants);
+
+        // Draw mesh shader (1 workgroup = 1 cube)
+        vkCmdDrawMeshTasksEXT(g_engine.activeCommandBuffer, 1, 1, 1);
+        g_engine.frameDrawCalls++;
+        g_engine.frameTriangles += 12;
+    }
+
+    // Render models
+    boulder_render_models();
+
+    // Render UI overlay on top of the scene
+    boulder_ui_render(imageIndex);
+
+    return boulder_end_frame(imageIndex);
+    NATIVE_CATCH(-1)
+}
+
+int boulder_create_window(int width, int height, const char* title) {
+    NATIVE_TRY
+
+    VkResult err;
+
+    if (!g_engine.initialized || !g_engine.instance) {
+        fail(ERROR_NOT_INITIALIZED, "Engine not initialized or no Vulkan instance");
+        return -1;
+    }
+
+    Logger::get().info("Window creation: {} x {} '{}'" , width, height, title);
+
+
+    if (g_engine.window) {
+        SDL_DestroyWindow(g_engine.window);
+    }
+
+    SDL_WindowFlags windowFlags = SDL_WINDOW_VULKAN | SDL_WINDOW_RESIZABLE;
+#if defined(SDL_PLATFORM_ANDROID) || defined(SDL_PLATFORM_IOS)
+    // Mobile windows always cover the screen; width and height are only a hint
+    windowFlags |= SDL_WINDOW_FULLSCREEN | SDL_WINDOW_HIGH_PIXEL_DENSITY;
+#endif
+
+    g_engine.window = SDL_CreateWindow(title, width, height, windowFlags);
+
+    if (!g_engine.window) {
+        fail(ERROR_PLATFORM, "Failed to create window: {}", SDL_GetError());
+        return -1;
+    }
+
+    if(!SDL_Vulkan_CreateSurface(g_engine.window, g_engine.instance, nullptr, &g_engine.surface)){
+        fail(ERROR_PLATFORM, "Failed to create Vulkan surface: {}", SDL_GetError());
+        return -1;
+    } else {
+        Logger::get().info("Vulkan surface created!");
+    }
+
+    // Select physical device
+    uint32_t deviceCount = 0;
+    vkEnumeratePhysicalDevices(g_engine.instance, &deviceCount, nullptr);
+    if (deviceCount == 0) {
+        fail(ERROR_UNSUPPORTED, "No Vulkan physical devices found");
+        return -1;
+    }
+
+    std::vector<VkPhysicalDevice> devices(deviceCount);
+    vkEnumeratePhysicalDevices(g_engine.instance, &deviceCount, devices.data());
+    g_engine.physicalDeviceIndex = selectPhysicalDevice(devices);
+    g_engine.physicalDevice = devices[g_engine.physicalDeviceIndex];
+
+    VkPhysicalDeviceProperties selectedProperties;
+    vkGetPhysicalDeviceProperties(g_engine.physicalDevice, &selectedProperties);
+    Logger::get().info("Using GPU {}: {}", g_engine.physicalDeviceIndex, selectedProperties.deviceName);
+
+    // Find graphics queue family
+    uint32_t queueFamilyCount = 0;
+    vkGetPhysicalDeviceQueueFamilyProperties(g_engine.physicalDevice, &queueFamilyCount, nullptr);
+    std::vector<VkQueueFamilyProperties> queueFamilies(queueFamilyCount);
+    vkGetPhysicalDeviceQueueFamilyProperties(g_engine.physicalDevice, &queueFamilyCount, queueFamilies.data());
+
+    for (uint32_t i = 0; i < queueFamilyCount; i++) {
+        if (queueFamilies[i].queueFlags & VK_QUEUE_GRAPHICS_BIT) {
+            VkBool32 presentSupport = false;
+            vkGetPhysicalDeviceSurfaceSupportKHR(g_engine.physicalDevice, i, g_engine.surface, &presentSupport);
+            if (presentSupport) {
+                g_engine.graphicsQueueFamily = i;
+                break;
+            }
+        }
+    }
+
+    if (g_engine.graphicsQueueFamily == UINT32_MAX) {
+        fail(ERROR_UNSUPPORTED, "No suitable queue family found");
+        return -1;
+    }
+
+    uint32_t timestampBits = queueFamilies[g_engine.graphicsQueueFamily].timestampValidBits;
+    g_engine.timestampsSupported = timestampBits > 0 && selectedProperties.limits.timestampPeriod > 0;
+    g_engine.timestampMask = timestampBits >= 64 ? UINT64_MAX : (uint64_t(1) << timestampBits) - 1;
+    g_engine.timestampPeriod = selectedProperties.limits.timestampPeriod;
+
+    // Create logical device
+    float queuePriority = 1.0f;
+    VkDeviceQueueCreateInfo queueCreateInfo{};
+    queueCreateInfo.sType = VK_STRUCTURE_TYPE_DEVICE_QUEUE_CREATE_INFO;
+    queueCreateInfo.queueFamilyIndex = g_engine.graphicsQueueFamily;
+    queueCreateInfo.queueCount = 1;
+    queueCreateInfo.pQueuePriorities = &queuePriority;
+
+    VkPhysicalDeviceFeatures deviceFeatures{};
+
+    // Check if mesh shader extension is available
+    uint32_t extensionCount = 0;
+    vkEnumerateDeviceExtensionProperties(g_engine.physicalDevice, nullptr, &extensionCount, nullptr);
+    std::vector<VkExtensionProperties> availableExtensions(extensionCount);
+    vkEnumerateDeviceExtensionProperties(g_engine.physicalDevice, nullptr, &extensionCount, availableExtensions.data());
+
+    bool meshShaderSupported = false;
+    for (const auto& ext : availableExtensions) {
+        if (strcmp(ext.extensionName, VK_EXT_MESH_SHADER_EXTENSION_NAME) == 0) {
+            meshShaderSupported = true;
+            Logger::get().info("Mesh shader extension is supported!");
+            break;
+        }
+    }
+
+    if (!meshShaderSupported) {
+        fail(ERROR_UNSUPPORTED, "Mesh shader extension NOT supported on this device!");
+        return -1;
+    }
+
+    // Query mesh shader features to ensure they're actually supported
+    VkPhysicalDeviceMeshShaderFeaturesEXT queriedMeshShaderFeatures{};
+    queriedMeshShaderFeatures.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_MESH_SHADER_FEATURES_EXT;
+
+    VkPhysicalDeviceFeatures2 features2{};
+    features2.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_FEATURES_2;
+    features2.pNext = &queriedMeshShaderFeatures;
+
+    vkGetPhysicalDeviceFeatures2(g_engine.physicalDevice, &features2);
+
+    if (!queriedMeshShaderFeatures.meshShader) {
+        fail(ERROR_UNSUPPORTED, "Mesh shader feature NOT supported on this device!");
+        return -1;
+    }
+
+    Logger::get().info("Mesh shader feature is supported!");
+
+    // BCn textures, e.g. cooked KTX2 files, when the GPU can sample them
+    deviceFeatures.textureCompressionBC = features2.features.textureCompressionBC;
+    g_engine.textureCompressionBC = features2.features.textureCompressionBC == VK_TRUE;
+
+    // Enable mesh shader features for device creation
+    VkPhysicalDeviceMeshShaderFeaturesEXT meshShaderFeatures{};
+    meshShaderFeatures.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_MESH_SHADER_FEATURES_EXT;
+    meshShaderFeatures.meshShader = VK_TRUE;
+    meshShaderFeatures.taskShader = VK_FALSE;
+
+    VkPhysicalDeviceDynamicRenderingFeatures dynamicRenderingFeature{};
+    dynamicRenderingFeature.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_DYNAMIC_RENDERING_FEATURES;
+    dynamicRenderingFeature.pNext = &meshShaderFeatures;
+    dynamicRenderingFeature.dynamicRendering = VK_TRUE;
+
+    std::vector<const char*> deviceExtensions = {
+        VK_KHR_SWAPCHAIN_EXTENSION_NAME,
+        VK_EXT_MESH_SHADER_EXTENSION_NAME
+    };
+
+    // Present id and wait are optional; low latency mode uses them to wait until a frame
+    // is on screen, and present stats to measure when it got there
+    bool presentIdAvailable = false;
+    bool presentWaitAvailable = false;
+    for (const auto& ext : availableExtensions) {
+        if (strcmp(ext.extensionName, VK_KHR_PRESENT_ID_EXTENSION_NAME) == 0) {
+            presentIdAvailable = true;
+        } else if (strcmp(ext.extensionName, VK_KHR_PRESENT_WAIT_EXTENSION_NAME) == 0) {
+            presentWaitAvailable = true;
+        } else if (strcmp(ext.extensionName, VK_KHR_PORTABILITY_SUBSET_EXTENSION_NAME) == 0) {
+            // Required whenever a driver offers it (MoltenVK)
+            deviceExtensions.push_back(VK_KHR_PORTABILITY_SUBSET_EXTENSION_NAME);
+        }
+    }
+
+    VkPhysicalDevicePresentIdFeaturesKHR presentIdFeatures{};
+    presentIdFeatures.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_PRESENT_ID_FEATURES_KHR;
+    VkPhysicalDevicePresentWaitFeaturesKHR presentWaitFeatures{};
+    presentWaitFeatures.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_PRESENT_WAIT_FEATURES_KHR;
+    presentWaitFeatures.pNext = &presentIdFeatures;
+
+    g_engine.presentWaitSupported = false;
+    if (presentIdAvailable && presentWaitAvailable) {
+        VkPhysicalDeviceFeatures2 presentFeatures2{};
+        presentFeatures2.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_FEATURES_2;
+        presentFeatures2.pNext = &presentWaitFeatures;
+        vkGetPhysicalDeviceFeatures2(g_engine.physicalDevice, &presentFeatures2);
+
+        if (presentIdFeatures.presentId && presentWaitFeatures.presentWait) {
+            presentIdFeatures.pNext = &dynamicRenderingFeature;
+            deviceExtensions.push_back(VK_KHR_PRESENT_ID_EXTENSION_NAME);
+            deviceExtensions.push_back(VK_KHR_PRESENT_WAIT_EXTENSION_NAME);
+            g_engine.presentWaitSupported = true;
+            Logger::get().info("Present wait is supported");
+        }
+    }
+
+    VkDeviceCreateInfo deviceCreateInfo{};
+    deviceCreateInfo.sType = VK_STRUCTURE_TYPE_DEVICE_CREATE_INFO;
+    deviceCreateInfo.pNext = g_engine.presentWaitSupported ? static_cast<void*>(&presentWaitFeatures)
+                                                           : static_cast<void*>(&dynamicRenderingFeature);
+    deviceCreateInfo.queueCreateInfoCount = 1;
+    deviceCreateInfo.pQueueCreateInfos = &queueCreateInfo;
+    deviceCreateInfo.pEnabledFeatures = &deviceFeatures;
+    deviceCreateInfo.enabledExtensionCount = static_cast<uint32_t>(deviceExtensions.size());
+    deviceCreateInfo.ppEnabledExtensionNames = deviceExtensions.data();
+
+    if (vkCreateDevice(g_engine.physicalDevice, &deviceCreateInfo, nullptr, &g_engine.device) != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to create logical device");
+        return -1;
+    }
+
+    volkLoadDevice(g_engine.device);
+    vkGetDeviceQueue(g_engine.device, g_engine.graphicsQueueFamily, 0, &g_engine.graphicsQueue);
+    Logger::get().info("Vulkan device created!");
+
+    // Mesh shader limits, for debug mode draw checks
+    g_engine.meshShaderProperties = {};
+    g_engine.meshShaderProperties.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_MESH_SHADER_PROPERTIES_EXT;
+    VkPhysicalDeviceProperties2 properties2{};
+    properties2.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_PROPERTIES_2;
+    properties2.pNext = &g_engine.meshShaderProperties;
+    vkGetPhysicalDeviceProperties2(g_engine.physicalDevice, &properties2);
+
+    // Create swapchain
+    VkSurfaceCapabilitiesKHR capabilities;
+    vkGetPhysicalDeviceSurfaceCapabilitiesKHR(g_engine.physicalDevice, g_engine.surface, &capabilities);
+
+    uint32_t formatCount;
+    vkGetPhysicalDeviceSurfaceFormatsKHR(g_engine.physicalDevice, g_engine.surface, &formatCount, nullptr);
+    std::vector<VkSurfaceFormatKHR> formats(formatCount);
+    vkGetPhysicalDeviceSurfaceFormatsKHR(g_engine.physicalDevice, g_engine.surface, &formatCount, formats.data());
+
+    VkSurfaceFormatKHR surfaceFormat = formats[0];
+    for (const auto& format : formats) {
+        if (format.format == VK_FORMAT_B8G8R8A8_SRGB && format.colorSpace == VK_COLOR_SPACE_SRGB_NONLINEAR_KHR) {
+            surfaceFormat = format;
+            break;
+        }
+    }
+
+    g_engine.swapchainFormat = surfaceFormat.format;
+    g_engine.swapchainExtent = capabilities.currentExtent;
+
+    if (g_engine.swapchainExtent.width == UINT32_MAX) {
+        g_engine.swapchainExtent.width = width;
+        g_engine.swapchainExtent.height = height;
+    }
+
+    uint32_t imageCount = capabilities.minImageCount + 1;
+    if (capabilities.maxImageCount > 0 && imageCount > capabilities.maxImageCount) {
+        imageCount = capabilities.maxImageCount;
+    }
+
+    VkPresentModeKHR presentMode = choosePresentMode();
+
+    VkSwapchainCreateInfoKHR swapchainInfo{};
+    swapchainInfo.sType = VK_STRUCTURE_TYPE_SWAPCHAIN_CREATE_INFO_KHR;
+    swapchainInfo.surface = g_engine.surface;
+    swapchainInfo.minImageCount = imageCount;
+    swapchainInfo.imageFormat = surfaceFormat.format;
+    swapchainInfo.imageColorSpace = surfaceFormat.colorSpace;
+    swapchainInfo.imageExtent = g_engine.swapchainExtent;
+    swapchainInfo.imageArrayLayers = 1;
+    swapchainInfo.imageUsage = VK_IMAGE_USAGE_COLOR_ATTACHMENT_BIT | VK_IMAGE_USAGE_TRANSFER_SRC_BIT |
+                               VK_IMAGE_USAGE_TRANSFER_DST_BIT;
+    swapchainInfo.imageSharingMode = VK_SHARING_MODE_EXCLUSIVE;
+    swapchainInfo.preTransform = capabilities.currentTransform;
+    swapchainInfo.compositeAlpha = VK_COMPOSITE_ALPHA_OPAQUE_BIT_KHR;
+    swapchainInfo.presentMode = presentMode;
+    swapchainInfo.clipped = VK_TRUE;
+
+    if (vkCreateSwapchainKHR(g_engine.device, &swapchainInfo, nullptr, &g_engine.swapchain) != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to create swapchain");
+        return -1;
+    }
+    g_engine.refreshRate = displayRefreshRate();
+
+    vkGetSwapchainImagesKHR(g_engine.device, g_engine.swapchain, &imageCount, nullptr);
+    g_engine.swapchainImages.resize(imageCount);
+    vkGetSwapchainImagesKHR(g_engine.device, g_engine.swapchain, &imageCount, g_engine.swapchainImages.data());
+
+    // Initialize per-image fence tracking (initially no frame is using any image)
+    g_engine.imagesInFlight.resize(imageCount, VK_NULL_HANDLE);
+
+    // Create image views
+    g_engine.swapchainImageViews.resize(imageCount);
+    for (size_t i = 0; i < imageCount; i++) {
+        VkImageViewCreateInfo viewInfo{};
+        viewInfo.sType = VK_STRUCTURE_TYPE_IMAGE_VIEW_CREATE_INFO;
+        viewInfo.image = g_engine.swapchainImages[i];
+        viewInfo.viewType = VK_IMAGE_VIEW_TYPE_2D;
+        viewInfo.format = g_engine.swapchainFormat;
+        viewInfo.components.r = VK_COMPONENT_SWIZZLE_IDENTITY;
+        viewInfo.components.g = VK_COMPONENT_SWIZZLE_IDENTITY;
+        viewInfo.components.b = VK_COMPONENT_SWIZZLE_IDENTITY;
+        viewInfo.components.a = VK_COMPONENT_SWIZZLE_IDENTITY;
+        viewInfo.subresourceRange.aspectMask = VK_IMAGE_ASPECT_COLOR_BIT;
+        viewInfo.subresourceRange.baseMipLevel = 0;
+        viewInfo.subresourceRange.levelCount = 1;
+        viewInfo.subresourceRange.baseArrayLayer = 0;
+        viewInfo.subresourceRange.layerCount = 1;
+
+        if (vkCreateImageView(g_engine.device, &viewInfo, nullptr, &g_engine.swapchainImageViews[i]) != VK_SUCCESS) {
+            fail(ERROR_VULKAN, "Failed to create image view");
+            return -1;
+        }
+    }
+
+    // Create depth resources
+    if (createDepthResources() != 0) {
+        fail(ERROR_VULKAN, "Failed to create depth resources");
+        return -1;
+    }
+
+    // Create command pool
+    VkCommandPoolCreateInfo poolInfo{};
+    poolInfo.sType = VK_STRUCTURE_TYPE_COMMAND_POOL_CREATE_INFO;
+    poolInfo.flags = VK_COMMAND_POOL_CREATE_RESET_COMMAND_BUFFER_BIT;
+    poolInfo.queueFamilyIndex = g_engine.graphicsQueueFamily;
+
+    if (vkCreateCommandPool(g_engine.device, &poolInfo, nullptr, &g_engine.commandPool) != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to create command pool");
+        return -1;
+    }
+
+    // Create command buffers (one per frame in flight)
+    g_engine.commandBuffers.resize(MAX_FRAMES_IN_FLIGHT);
+    VkCommandBufferAllocateInfo allocInfo{};
+    allocInfo.sType = VK_STRUCTURE_TYPE_COMMAND_BUFFER_ALLOCATE_INFO;
+    allocInfo.commandPool = g_engine.commandPool;
+    allocInfo.level = VK_COMMAND_BUFFER_LEVEL_PRIMARY;
+    allocInfo.commandBufferCount = MAX_FRAMES_IN_FLIGHT;
+
+    if (vkAllocateCommandBuffers(g_engine.device, &allocInfo, g_engine.commandBuffers.data()) != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to allocate command buffers");
+        return -1;
+    }
+
+    // Create sync objects
+    VkSemaphoreCreateInfo semaphoreInfo{};
+    semaphoreInfo.sType = VK_STRUCTURE_TYPE_SEMAPHORE_CREATE_INFO;
+
+    VkFenceCreateInfo fenceInfo{};
+    fenceInfo.sType = VK_STRUCTURE_TYPE_FENCE_CREATE_INFO;
+    fenceInfo.flags = VK_FENCE_CREATE_SIGNALED_BIT;
+
+    // Per-frame-in-flight sync (imageAvailable, renderFinished, and fences)
+    for (size_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
+        if (vkCreateSemaphore(g_engine.device, &semaphoreInfo, nullptr, &g_engine.imageAvailableSemaphores[i]) != VK_SUCCESS ||
+            vkCreateSemaphore(g_engine.device, &semaphoreInfo, nullptr, &g_engine.renderFinishedSemaphores[i]) != VK_SUCCESS ||
+            vkCreateFence(g_engine.device, &fenceInfo, nullptr, &g_engine.inFlightFences[i]) != VK_SUCCESS) {
+            fail(ERROR_VULKAN, "Failed to create sync objects for frame {}", i);
+            return -1;
+        }
+    }
+
+    // Two GPU timestamps per frame slot, for the GPU frame time
+    if (g_engine.timestampsSupported) {
+        VkQueryPoolCreateInfo queryPoolInfo{};
+        queryPoolInfo.sType = VK_STRUCTURE_TYPE_QUERY_POOL_CREATE_INFO;
+        queryPoolInfo.queryType = VK_QUERY_TYPE_TIMESTAMP;
+        queryPoolInfo.queryCount = 2 * MAX_FRAMES_IN_FLIGHT;
+        if (vkCreateQueryPool(g_engine.device, &queryPoolInfo, nullptr, &g_engine.timestampPool) != VK_SUCCESS) {
+            Logger::get().warning("Failed to create timestamp query pool, GPU frame time unavailable");
+            g_engine.timestampPool = nullptr;
+        }
+    }
+
+    // Load and compile shaders at runtime
+    std::ifstream meshFile("shaders/cube.mesh");
+    std::string meshSource((std::istreambuf_iterator<char>(meshFile)), std::istreambuf_iterator<char>());
+
+    std::ifstream fragFile("shaders/cube.frag");
+    std::string fragSource((std::istreambuf_iterator<char>(fragFile)), std::istreambuf_iterator<char>());
+
+    if (meshSource.empty() || fragSource.empty()) {
+        fail(ERROR_FILE, "Failed to read shader source files");
+        return -1;
+    }
+
+    auto meshSpirv = compileShader(meshSource, shaderc_glsl_default_mesh_shader, "cube.mesh");
+    auto fragSpirv = compileShader(fragSource, shaderc_glsl_default_fragment_shader, "cube.frag");
+
+    if (meshSpirv.empty() || fragSpirv.empty()) {
+        fail(ERROR_SHADER, "Failed to compile shaders");
+        return -1;
+    }
+
+    // Create shader modules
+    VkShaderModuleCreateInfo meshModuleInfo{};
+    meshModuleInfo.sType = VK_STRUCTURE_TYPE_SHADER_MODULE_CREATE_INFO;
+    meshModuleInfo.codeSize = meshSpirv.size() * sizeof(uint32_t);
+    meshModuleInfo.pCode = meshSpirv.data();
+
+    VkShaderModuleCreateInfo fragModuleInfo{};
+    fragModuleInfo.sType = VK_STRUCTURE_TYPE_SHADER_MODULE_CREATE_INFO;
+    fragModuleInfo.codeSize = fragSpirv.size() * sizeof(uint32_t);
+    fragModuleInfo.pCode = fragSpirv.data();
+
+    if (vkCreateShaderModule(g_engine.device, &meshModuleInfo, nullptr, &g_engine.meshShaderModule) != VK_SUCCESS ||
+        vkCreateShaderModule(g_engine.device, &fragModuleInfo, nullptr, &g_engine.fragShaderModule) != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to create shader modules");
+        return -1;
+    }
+
+    // Create pipeline layout with push constants
+    VkPushConstantRange pushConstantRange{};
+    pushConstantRange.stageFlags = VK_SHADER_STAGE_MESH_BIT_EXT;
+    pushConstantRange.offset = 0;
+    pushConstantRange.size = sizeof(glm::mat4) + sizeof(float); // viewProj + time
+
+    VkPipelineLayoutCreateInfo pipelineLayoutInfo{};
+    pipelineLayoutInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_LAYOUT_CREATE_INFO;
+    pipelineLayoutInfo.pushConstantRangeCount = 1;
+    pipelineLayoutInfo.pPushConstantRanges = &pushConstantRange;
+
+    if (vkCreatePipelineLayout(g_engine.device, &pipelineLayoutInfo, nullptr, &g_engine.pipelineLayout) != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to create pipeline layout");
+        return -1;
+    }
+
+    // Create graphics pipeline
+    VkPipelineShaderStageCreateInfo meshStage{};
+    meshStage.sType = VK_STRUCTURE_TYPE_PIPELINE_SHADER_STAGE_CREATE_INFO;
+    meshStage.stage = VK_SHADER_STAGE_MESH_BIT_EXT;
+    meshStage.module = g_engine.meshShaderModule;
+    meshStage.pName = "main";
+
+    VkPipelineShaderStageCreateInfo fragStage{};
+    fragStage.sType = VK_STRUCTURE_TYPE_PIPELINE_SHADER_STAGE_CREATE_INFO;
+    fragStage.stage = VK_SHADER_STAGE_FRAGMENT_BIT;
+    fragStage.module = g_engine.fragShaderModule;
+    fragStage.pName = "main";
+
+    VkPipelineShaderStageCreateInfo shaderStages[] = {meshStage, fragStage};
+
+    // Dynamic state for viewport and scissor
+    VkDynamicState dynamicStates[] = {
+        VK_DYNAMIC_STATE_VIEWPORT,
+        VK_DYNAMIC_STATE_SCISSOR
+    };
+
+    VkPipelineDynamicStateCreateInfo dynamicState{};
+    dynamicState.sType = VK_STRUCTURE_TYPE_PIPELINE_DYNAMIC_STATE_CREATE_INFO;
+    dynamicState.dynamicStateCount = 2;
+    dynamicState.pDynamicStates = dynamicStates;
+
+    // Viewport state (counts only, actual values set dynamically)
+    VkPipelineViewportStateCreateInfo viewportState{};
+    viewportState.sType = VK_STRUCTURE_TYPE_PIPELINE_VIEWPORT_STATE_CREATE_INFO;
+    viewportState.viewportCount = 1;
+    viewportState.scissorCount = 1;
+
+    VkPipelineRasterizationStateCreateInfo rasterizer{};
+    rasterizer.sType = VK_STRUCTURE_TYPE_PIPELINE_RASTERIZATION_STATE_CREATE_INFO;
+    rasterizer.polygonMode = VK_POLYGON_MODE_FILL;
+    rasterizer.cullMode = VK_CULL_MODE_NONE;  // Disable culling for debugging
+    rasterizer.frontFace = VK_FRONT_FACE_COUNTER_CLOCKWISE;
+    rasterizer.lineWidth = 1.0f;
+
+    VkPipelineMultisampleStateCreateInfo multisampling{};
+    multisampling.sType = VK_STRUCTURE_TYPE_PIPELINE_MULTISAMPLE_STATE_CREATE_INFO;
+    multisampling.rasterizationSamples = VK_SAMPLE_COUNT_1_BIT;
+
+    VkPipelineColorBlendAttachmentState colorBlendAttachment{};
+    colorBlendAttachment.colorWriteMask = VK_COLOR_COMPONENT_R_BIT | VK_COLOR_COMPONENT_G_BIT |
+                                           VK_COLOR_COMPONENT_B_BIT | VK_COLOR_COMPONENT_A_BIT;
+    colorBlendAttachment.blendEnable = VK_FALSE;
+
+    VkPipelineColorBlendStateCreateInfo colorBlending{};
+    colorBlending.sType = VK_STRUCTURE_TYPE_PIPELINE_COLOR_BLEND_STATE_CREATE_INFO;
+    colorBlending.attachmentCount = 1;
+    colorBlending.pAttachments = &colorBlendAttachment;
+
+    // Depth stencil state
+    VkPipelineDepthStencilStateCreateInfo depthStencil{};
+    depthStencil.sType = VK_STRUCTURE_TYPE_PIPELINE_DEPTH_STENCIL_STATE_CREATE_INFO;
+    depthStencil.depthTestEnable = VK_TRUE;
+    depthStencil.depthWriteEnable = VK_TRUE;
+    depthStencil.depthCompareOp = VK_COMPARE_OP_LESS;
+    depthStencil.depthBoundsTestEnable = VK_FALSE;
+    depthStencil.stencilTestEnable = VK_FALSE;
+
+    VkPipelineRenderingCreateInfo pipelineRenderingInfo{};
+    pipelineRenderingInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_RENDERING_CREATE_INFO;
+    pipelineRenderingInfo.colorAttachmentCount = 1;
+    pipelineRenderingInfo.pColorAttachmentFormats = &g_engine.swapchainFormat;
+    pipelineRenderingInfo.depthAttachmentFormat = g_engine.depthFormat;
+    pipelineRenderingInfo.stencilAttachmentFormat = g_engine.stencilFormat;
+
+    VkGraphicsPipelineCreateInfo pipelineInfo{};
+    pipelineInfo.sType = VK_STRUCTURE_TYPE_GRAPHICS_PIPELINE_CREATE_INFO;
+    pipelineInfo.pNext = &pipelineRenderingInfo;
+    pipelineInfo.stageCount = 2;
+    pipelineInfo.pStages = shaderStages;
+    pipelineInfo.pViewportState = &viewportState;
+    pipelineInfo.pRasterizationState = &rasterizer;
+    pipelineInfo.pMultisampleState = &multisampling;
+    pipelineInfo.pColorBlendState = &colorBlending;
+    pipelineInfo.pDepthStencilState = &depthStencil;
+    pipelineInfo.pDynamicState = &dynamicState;
+    pipelineInfo.layout = g_engine.pipelineLayout;
+
+    if (vkCreateGraphicsPipelines(g_engine.device, nullptr, 1, &pipelineInfo, nullptr, &g_engine.cubePipeline) != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to create graphics pipeline");
+        return -1;
+    }
+
+    Logger::get().info("Vulkan rendering setup complete!");
+
+    if (createTextureSampler() != 0) {
+        fail(ERROR_VULKAN, "Failed to create texture sampler");
+    }
+
+    // Create model rendering pipeline for loaded geometry
+    Logger::get().info("Creating model rendering pipeline...");
+
+    // Load model shaders
+    std::ifstream modelMeshFile("shaders/model.mesh");
+    std::string modelMeshSource((std::istreambuf_iterator<char>(modelMeshFile)), std::istreambuf_iterator<char>());
+
+    std::ifstream modelFragFile("shaders/model.frag");
+    std::string modelFragSource((std::istreambuf_iterator<char>(modelFragFile)), std::istreambuf_iterator<char>());
+
+    if (!modelMeshSource.empty() && !modelFragSource.empty()) {
+        auto modelMeshSpirv = compileShader(modelMeshSource, shaderc_glsl_default_mesh_shader, "shaders/model.mesh");
+        auto modelFragSpirv = compileShader(modelFragSource, shaderc_glsl_default_fragment_shader, "shaders/model.frag");
+
+        if (!modelMeshSpirv.empty() && !modelFragSpirv.empty()) {
+            // Create shader modules
+            VkShaderModuleCreateInfo meshModuleInfo{};
+            meshModuleInfo.sType = VK_STRUCTURE_TYPE_SHADER_MODULE_CREATE_INFO;
+            meshModuleInfo.codeSize = modelMeshSpirv.size() * sizeof(uint32_t);
+            meshModuleInfo.pCode = modelMeshSpirv.data();
+            vkCreateShaderModule(g_engine.device, &meshModuleInfo, nullptr, &g_engine.modelMeshShader);
+
+            VkShaderModuleCreateInfo fragModuleInfo{};
+            fragModuleInfo.sType = VK_STRUCTURE_TYPE_SHADER_MODULE_CREATE_INFO;
+            fragModuleInfo.codeSize = modelFragSpirv.size() * sizeof(uint32_t);
+            fragModuleInfo.pCode = modelFragSpirv.data();
+            vkCreateShaderModule(g_engine.device, &fragModuleInfo, nullptr, &g_engine.modelFragShader);
+
+            // Create descriptor set layout for storage buffers
+            VkDescriptorSetLayoutBinding bindings[4] = {};
+
+            // Binding 0: Vertex buffer (SSBO)
+            bindings[0].binding = 0;
+            bindings[0].descriptorType = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
+            bindings[0].descriptorCount = 1;
+            bindings[0].stageFlags = VK_SHADER_STAGE_MESH_BIT_EXT;
+
+            // Binding 1: Index buffer (SSBO)
+            bindings[1].binding = 1;
+            bindings[1].descriptorType = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
+            bindings[1].descriptorCount = 1;
+            bindings[1].stageFlags = VK_SHADER_STAGE_MESH_BIT_EXT;
+
+            // Binding 2: Draw params (SSBO)
+            bindings[2].binding = 2;
+            bindings[2].descriptorType = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
+            bindings[2].descriptorCount = 1;
+            bindings[2].stageFlags = VK_SHADER_STAGE_MESH_BIT_EXT;
+
+            // Binding 3: Lights (SSBO)
+            bindings[3].binding = 3;
+            bindings[3].descriptorType = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
+            bindings[3].descriptorCount = 1;
+            bindings[3].stageFlags = VK_SHADER_STAGE_FRAGMENT_BIT;
+
+            VkDescriptorSetLayoutCreateInfo descriptorLayoutInfo{};
+            descriptorLayoutInfo.sType = VK_STRUCTURE_TYPE_DESCRIPTOR_SET_LAYOUT_CREATE_INFO;
+            descriptorLayoutInfo.bindingCount = 4;
+            descriptorLayoutInfo.pBindings = bindings;
+            vkCreateDescriptorSetLayout(g_engine.device, &descriptorLayoutInfo, nullptr, &g_engine.modelDescriptorSetLayout);
+
+            // Create pipeline layout with push constants
+            VkPushConstantRange modelPushConstant{};
+            modelPushConstant.stageFlags = VK_SHADER_STAGE_MESH_BIT_EXT | VK_SHADER_STAGE_FRAGMENT_BIT;
+            modelPushConstant.offset = 0;
+            modelPushConstant.size = sizeof(ModelPushConstants); // viewProj + model + 2 offsets + tint + emissive
+
+            VkPipelineLayoutCreateInfo modelLayoutInfo{};
+            modelLayoutInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_LAYOUT_CREATE_INFO;
+            modelLayoutInfo.setLayoutCount = 1;
+            modelLayoutInfo.pSetLayouts = &g_engine.modelDescriptorSetLayout;
+            modelLayoutInfo.pushConstantRangeCount = 1;
+            modelLayoutInfo.pPushConstantRanges = &modelPushConstant;
+            vkCreatePipelineLayout(g_engine.device, &modelLayoutInfo, nullptr, &g_engine.modelPipelineLayout);
+
+            // Create model pipeline (similar to cube pipeline but with descriptor sets)
+            VkPipelineShaderStageCreateInfo modelShaderStages[2] = {};
+            modelShaderStages[0].sType = VK_STRUCTURE_TYPE_PIPELINE_SHADER_STAGE_CREATE_INFO;
+            modelShaderStages[0].stage = VK_SHADER_STAGE_MESH_BIT_EXT;
+            modelShaderStages[0].module = g_engine.modelMeshShader;
+            modelShaderStages[0].pName = "main";
+
+            modelShaderStages[1].sType = VK_STRUCTURE_TYPE_PIPELINE_SHADER_STAGE_CREATE_INFO;
+            modelShaderStages[1].stage = VK_SHADER_STAGE_FRAGMENT_BIT;
+            modelShaderStages[1].module = g_engine.modelFragShader;
+            modelShaderStages[1].pName = "main";
+
+            VkGraphicsPipelineCreateInfo modelPipelineInfo{};
+            modelPipelineInfo.sType = VK_STRUCTURE_TYPE_GRAPHICS_PIPELINE_CREATE_INFO;
+            modelPipelineInfo.pNext = &pipelineRenderingInfo;
+            modelPipelineInfo.stageCount = 2;
+            modelPipelineInfo.pStages = modelShaderStages;
+            modelPipelineInfo.pViewportState = &viewportState;
+            modelPipelineInfo.pRasterizationState = &rasterizer;
+            modelPipelineInfo.pMultisampleState = &multisampling;
+            modelPipelineInfo.pColorBlendState = &colorBlending;
+            modelPipelineInfo.pDepthStencilState = &depthStencil;
+            modelPipelineInfo.pDynamicState = &dynamicState;
+            modelPipelineInfo.layout = g_engine.modelPipelineLayout;
+
+            if (vkCreateGraphicsPipelines(g_engine.device, nullptr, 1, &modelPipelineInfo, nullptr, &g_engine.modelPipeline) == VK_SUCCESS) {
+                Logger::get().info("✓ Model rendering pipeline created");
+
+                // Create descriptor pools for model rendering (one per frame-in-flight)
+                // Support up to 1000 mesh descriptor sets with 4 storage buffers each per pool,
+                // plus as many material sets
+                VkDescriptorPoolSize poolSizes[3] = {};
+                poolSizes[0].type = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
+                poolSizes[0].descriptorCount = 4000; // 1000 sets * 4 bindings
+                poolSizes[1].type = VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER;
+                poolSizes[1].descriptorCount = 1000;
+                poolSizes[2].type = VK_DESCRIPTOR_TYPE_COMBINED_IMAGE_SAMPLER;
+                poolSizes[2].descriptorCount = 1000 * MATERIAL_MAX_TEXTURES;
+
+                VkDescriptorPoolCreateInfo poolInfo{};
+                poolInfo.sType = VK_STRUCTURE_TYPE_DESCRIPTOR_POOL_CREATE_INFO;
+                poolInfo.flags = VK_DESCRIPTOR_POOL_CREATE_FREE_DESCRIPTOR_SET_BIT;
+                poolInfo.poolSizeCount = 3;
+                poolInfo.pPoolSizes = poolSizes;
+                poolInfo.maxSets = 2000;
+
+                for (size_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
+                    if (vkCreateDescriptorPool(g_engine.device, &poolInfo, nullptr, &g_engine.modelDescriptorPools[i]) != VK_SUCCESS) {
+                        fail(ERROR_VULKAN, "Failed to create model descriptor pool {}", i);
+                    }
+                }
+                Logger::get().info("✓ Model descriptor pools created ({} pools)", MAX_FRAMES_IN_FLIGHT);
+
+                if (createMaterialResources() != 0) {
+                    Logger::get().error("Failed to create material resources - custom materials disabled");
+                }
+                if (createOutlineResources() == 0) {
+                    Logger::get().info("✓ Outline pipelines created");
+                }
+
+                for (int mode = BLEND_MODE_ALPHA_TEST; mode < BLEND_MODE_COUNT; mode++) {
+                    g_engine.modelBlendPipelines[mode] = createPipeline(g_engine.modelMeshShader, g_engine.modelFragShader,
+                                                                        g_engine.modelPipelineLayout, VK_CULL_MODE_NONE,
+                                                                        VK_FRONT_FACE_COUNTER_CLOCKWISE, mode);
+                    if (!g_engine.modelBlendPipelines[mode]) {
+                        fail(ERROR_VULKAN, "Failed to create model pipeline for blend mode {}", mode);
+                    }
+                }
+            } else {
+                fail(ERROR_VULKAN, "Failed to create model pipeline");
+            }
+        } else {
+            Logger::get().warning("Model shaders not compiled - model rendering disabled");
+        }
+    } else {
+        Logger::get().warning("Model shader files not found - model rendering disabled");
+    }
+
+    // Initialize UI system now that all Vulkan resources are ready
+    if (boulder_ui_init() != 0) {
+        Logger::get().error("Failed to initialize UI system (non-fatal)");
+        // Don't fail window creation if UI init fails
+    }
+
+    return g_engine.window ? 0 : -1;
+
+    NATIVE_CATCH(-1)
+}
+
+int boulder_restart() {
+    NATIVE_TRY
+    if (!g_engine.initialized) {
+        fail(ERROR_NOT_INITIALIZED, "Cannot restart: engine not initialized");
+        return -1;
+    }
+
+    Logger::get().info("Restarting engine graphics...");
+
+    // Remember the window so it can be recreated the same way
+    bool hadWindow = g_engine.window != nullptr;
+    int width = 0, height = 0;
+    std::string title;
+    if (hadWindow) {
+        SDL_GetWindowSize(g_engine.window, &width, &height);
+        title = SDL_GetWindowTitle(g_engine.window);
+    }
+
+    if (g_engine.device) {
+        vkDeviceWaitIdle(g_engine.device);
+    }
+
+    boulder_ui_cleanup();
+    destroyDeviceResources();
+
+    if (g_engine.instance) {
+        destroyDebugMessenger();
+        vkDestroyInstance(g_engine.instance, nullptr);
+        g_engine.instance = nullptr;
+    }
+
+    if (createInstance() != 0) {
+        fail(ERROR_VULKAN, "Restart failed: could not recreate Vulkan instance");
+        return -1;
+    }
+
+    if (!hadWindow) {
+        return 0;
+    }
+
+    if (boulder_create_window(width, height, title.c_str()) != 0) {
+        fail(ERROR_PLATFORM, "Restart failed: could not recreate window");
+        return -1;
+    }
+
+    // Entities survive the restart; give their models buffers on the new device
+    for (auto& [id, world] : g_engine.worlds) {
+        world->query<Model>().each([](Model& model) {
+            for (auto& mesh : model.meshes) {
+                createMeshBuffers(mesh);
+            }
+        });
+    }
+    vkDeviceWaitIdle(g_engine.device);
+
+    Logger::get().info("Engine graphics restarted");
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_gpu_count() {
+    NATIVE_TRY
+    if (!g_engine.instance) {
+        return -1;
+    }
+
+    uint32_t deviceCount = 0;
+    vkEnumeratePhysicalDevices(g_engine.instance, &deviceCount, nullptr);
+    return static_cast<int>(deviceCount);
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_gpu_info(int index, char* name, uint32_t nameSize, int* type,
+                         uint64_t* memory, uint32_t* vendorID, uint32_t* deviceID, int* supported) {
+    NATIVE_TRY
+    if (!g_engine.instance || index < 0) {
+        return -1;
+    }
+
+    uint32_t deviceCount = 0;
+    vkEnumeratePhysicalDevices(g_engine.instance, &deviceCount, nullptr);
+    if (static_cast<uint32_t>(index) >= deviceCount) {
+        return -1;
+    }
+
+    std::vector<VkPhysicalDevice> devices(deviceCount);
+    vkEnumeratePhysicalDevices(g_engine.instance, &deviceCount, devices.data());
+    VkPhysicalDevice device = devices[index];
+
+    VkPhysicalDeviceProperties properties;
+    vkGetPhysicalDeviceProperties(device, &properties);
+
+    if (name && nameSize > 0) {
+        strncpy(name, properties.deviceName, nameSize - 1);
+        name[nameSize - 1] = '\0';
+    }
+    if (type) *type = static_cast<int>(properties.deviceType);
+    if (memory) *memory = deviceLocalMemory(device);
+    if (vendorID) *vendorID = properties.vendorID;
+    if (deviceID) *deviceID = properties.deviceID;
+    if (supported) *supported = deviceSupportsMeshShaders(device) ? 1 : 0;
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_check_runtime() {
+    NATIVE_TRY
+    if (volkInitialize() != VK_SUCCESS) {
+        fail(ERROR_UNSUPPORTED, "Runtime check: Vulkan loader not found");
+        return RUNTIME_NO_VULKAN_LOADER;
+    }
+
+    int problems = 0;
+    if (!SDL_InitSubSystem(SDL_INIT_VIDEO)) {
+        fail(ERROR_PLATFORM, "Runtime check: no video driver: {}", SDL_GetError());
+        problems |= RUNTIME_NO_VIDEO;
+    } else {
+        SDL_QuitSubSystem(SDL_INIT_VIDEO);
+    }
+
+    // Without an engine instance, create a bare one just to list the GPUs
+    VkInstance instance = g_engine.instance;
+    if (!instance) {
+        uint32_t extensionCount = 0;
+        vkEnumerateInstanceExtensionProperties(nullptr, &extensionCount, nullptr);
+        std::vector<VkExtensionProperties> extensions(extensionCount);
+        vkEnumerateInstanceExtensionProperties(nullptr, &extensionCount, extensions.data());
+
+        const char* portabilityExtension = VK_KHR_PORTABILITY_ENUMERATION_EXTENSION_NAME;
+        bool portability = false;
+        for (const auto& ext : extensions) {
+            if (strcmp(ext.extensionName, portabilityExtension) == 0) {
+                portability = true;
+            }
+        }
+
+        VkApplicationInfo appInfo{};
+        appInfo.sType = VK_STRUCTURE_TYPE_APPLICATION_INFO;
+        appInfo.pEngineName = "Boulder Engine";
+        appInfo.apiVersion = VK_API_VERSION_1_4;
+
+        VkInstanceCreateInfo createInfo{};
+        createInfo.sType = VK_STRUCTURE_TYPE_INSTANCE_CREATE_INFO;
+        createInfo.pApplicationInfo = &appInfo;
+        createInfo.flags = portability ? VK_INSTANCE_CREATE_ENUMERATE_PORTABILITY_BIT_KHR : 0;
+        createInfo.enabledExtensionCount = portability ? 1 : 0;
+        createInfo.ppEnabledExtensionNames = portability ? &portabilityExtension : nullptr;
+
+        if (vkCreateInstance(&createInfo, nullptr, &instance) != VK_SUCCESS) {
+            fail(ERROR_VULKAN, "Runtime check: failed to create a Vulkan instance");
+            return problems | RUNTIME_NO_VULKAN_DEVICE;
+        }
+        volkLoadInstance(instance);
+    }
+
+    uint32_t deviceCount = 0;
+    vkEnumeratePhysicalDevices(instance, &deviceCount, nullptr);
+    std::vector<VkPhysicalDevice> devices(deviceCount);
+    vkEnumeratePhysicalDevices(instance, &deviceCount, devices.data());
+
+    if (deviceCount == 0) {
+        fail(ERROR_UNSUPPORTED, "Runtime check: no Vulkan GPU found");
+        problems |= RUNTIME_NO_VULKAN_DEVICE;
+    } else if (std::none_of(devices.begin(), devices.end(), deviceSupportsMeshShaders)) {
+        fail(ERROR_UNSUPPORTED, "Runtime check: no GPU supports mesh shaders");
+        problems |= RUNTIME_NO_MESH_SHADERS;
+    }
+
+    if (instance != g_engine.instance) {
+        vkDestroyInstance(instance, nullptr);
+    }
+    return problems;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_show_message_box(int kind, const char* title, const char* message,
+                             const char* const* buttons, int buttonCount) {
+    NATIVE_TRY
+    if (!buttons || buttonCount <= 0) {
+        return -1;
+    }
+
+    std::vector<SDL_MessageBoxButtonData> buttonData(buttonCount);
+    for (int i = 0; i < buttonCount; i++) {
+        buttonData[i].buttonID = i;
+        buttonData[i].text = buttons[i] ? buttons[i] : "";
+    }
+    buttonData.front().flags |= SDL_MESSAGEBOX_BUTTON_RETURNKEY_DEFAULT;
+    buttonData.back().flags |= SDL_MESSAGEBOX_BUTTON_ESCAPEKEY_DEFAULT;
+
+    SDL_MessageBoxData data{};
+    switch (kind) {
+        case 1:
+            data.flags = SDL_MESSAGEBOX_WARNING;
+            break;
+        case 2:
+            data.flags = SDL_MESSAGEBOX_ERROR;
+            break;
+        default:
+            data.flags = SDL_MESSAGEBOX_INFORMATION;
+            break;
+    }
+    data.flags |= SDL_MESSAGEBOX_BUTTONS_LEFT_TO_RIGHT;
+    data.window = g_engine.window; // Null before a window exists
+    data.title = title ? title : "";
+    data.message = message ? message : "";
+    data.numbuttons = buttonCount;
+    data.buttons = buttonData.data();
+
+    int pressed = -1;
+    if (!SDL_ShowMessageBox(&data, &pressed)) {
+        fail(ERROR_PLATFORM, "Failed to show message box: {}", SDL_GetError());
+        return -1;
+    }
+    // Closing the box some other way counts as the Escape button
+    return pressed < 0 ? buttonCount - 1 : pressed;
+    NATIVE_CATCH(-1)
+}
+
+void boulder_set_gpu(int index, int preference) {
+    NATIVE_TRY
+    g_engine.requestedGpu = index;
+    g_engine.gpuPreference = preference;
+    NATIVE_CATCH()
+}
+
+int boulder_get_selected_gpu() {
+    NATIVE_TRY
+    return g_engine.physicalDeviceIndex;
+    NATIVE_CATCH(0)
+}
+
+void boulder_set_window_size(int width, int height) {
+    NATIVE_TRY
+    if (g_engine.window) {
+        SDL_SetWindowSize(g_engine.window, width, height);
+        g_engine.swapchainNeedsRecreate = true;
+    }
+    NATIVE_CATCH()
+}
+
+// Display by index in SDL's order, -1 for the window's
+static SDL_DisplayID displayAt(int index) {
+    if (index < 0) {
+        return g_engine.window ? SDL_GetDisplayForWindow(g_engine.window) : SDL_GetPrimaryDisplay();
+    }
+
+    int count = 0;
+    SDL_DisplayID* displays = SDL_GetDisplays(&count);
+    SDL_DisplayID id = displays && index < count ? displays[index] : 0;
+    SDL_free(displays);
+    return id;
+}
+
+static void copyDisplayMode(const SDL_DisplayMode& from, DisplayMode* to) {
+    to->width = from.w;
+    to->height = from.h;
+    to->refreshRate = from.refresh_rate;
+    to->pixelDensity = from.pixel_density;
+}
+
+int boulder_get_display_count() {
+    NATIVE_TRY
+    int count = 0;
+    SDL_DisplayID* displays = SDL_GetDisplays(&count);
+    SDL_free(displays);
+    return count;
+    NATIVE_CATCH(0)
+}
+
+int boulder_get_display_name(int display, char* name, uint32_t nameSize) {
+    NATIVE_TRY
+    SDL_DisplayID id = displayAt(display);
+    const char* displayName = id ? SDL_GetDisplayName(id) : nullptr;
+    if (!displayName || !name || nameSize == 0) {
+        return -1;
+    }
+    snprintf(name, nameSize, "%s", displayName);
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_desktop_display_mode(int display, DisplayMode* mode) {
+    NATIVE_TRY
+    SDL_DisplayID id = displayAt(display);
+    const SDL_DisplayMode* desktop = id ? SDL_GetDesktopDisplayMode(id) : nullptr;
+    if (!desktop || !mode) {
+        return -1;
+    }
+    copyDisplayMode(*desktop, mode);
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_display_modes(int display, DisplayMode* modes, uint32_t capacity) {
+    NATIVE_TRY
+    SDL_DisplayID id = displayAt(display);
+    if (!id) {
+        return -1;
+    }
+
+    int count = 0;
+    SDL_DisplayMode** list = SDL_GetFullscreenDisplayModes(id, &count);
+    if (!list) {
+        return -1;
+    }
+    for (int i = 0; i < count && modes && static_cast<uint32_t>(i) < capacity; i++) {
+        copyDisplayMode(*list[i], &modes[i]);
+    }
+    SDL_free(list);
+    return count;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_window_display() {
+    NATIVE_TRY
+    SDL_DisplayID current = g_engine.window ? SDL_GetDisplayForWindow(g_engine.window) : 0;
+    int count = 0;
+    SDL_DisplayID* displays = SDL_GetDisplays(&count);
+    int index = -1;
+    for (int i = 0; displays && i < count; i++) {
+        if (displays[i] == current) {
+            index = i;
+            break;
+        }
+    }
+    SDL_free(displays);
+    return index;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_set_fullscreen(int mode, int display) {
+    NATIVE_TRY
+    if (!g_engine.window || mode < FULLSCREEN_OFF || mode > FULLSCREEN_EXCLUSIVE) {
+        return -1;
+    }
+    SDL_DisplayID id = displayAt(display);
+    if (!id) {
+        return -1;
+    }
+
+    if (mode == FULLSCREEN_OFF) {
+        if (!SDL_SetWindowFullscreen(g_engine.window, false)) {
+            fail(ERROR_PLATFORM, "Failed to leave fullscreen: {}", SDL_GetError());
+            return -1;
+        }
+    } else {
+        // Fullscreen windows cover the display they are on
+        if (id != SDL_GetDisplayForWindow(g_engine.window)) {
+            SDL_SetWindowFullscreen(g_engine.window, false);
+            SDL_SetWindowPosition(g_engine.window, SDL_WINDOWPOS_CENTERED_DISPLAY(id), SDL_WINDOWPOS_CENTERED_DISPLAY(id));
+        }
+
+        SDL_DisplayMode exclusive{};
+        const SDL_DisplayMode* target = nullptr; // Borderless
+        if (mode == FULLSCREEN_EXCLUSIVE) {
+            if (g_engine.exclusiveMode.w > 0 && g_engine.exclusiveMode.displayID == id) {
+                exclusive = g_engine.exclusiveMode;
+            } else {
+                const SDL_DisplayMode* desktop = SDL_GetDesktopDisplayMode(id);
+                if (!desktop || !SDL_GetClosestFullscreenDisplayMode(id, desktop->w, desktop->h, desktop->refresh_rate, true, &exclusive)) {
+                    fail(ERROR_PLATFORM, "No exclusive fullscreen mode: {}", SDL_GetError());
+                    return -1;
+                }
+            }
+            target = &exclusive;
+        }
+
+        if (!SDL_SetWindowFullscreenMode(g_engine.window, target) || !SDL_SetWindowFullscreen(g_engine.window, true)) {
+            fail(ERROR_PLATFORM, "Failed to enter fullscreen: {}", SDL_GetError());
+            return -1;
+        }
+    }
+
+    SDL_SyncWindow(g_engine.window);
+    g_engine.fullscreen = mode;
+    g_engine.swapchainNeedsRecreate = true;
+    Logger::get().info("Fullscreen mode {} on display {}", mode, SDL_GetDisplayName(id));
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_fullscreen() {
+    NATIVE_TRY
+    if (!g_engine.window || !(SDL_GetWindowFlags(g_engine.window) & SDL_WINDOW_FULLSCREEN)) {
+        return FULLSCREEN_OFF;
+    }
+    return g_engine.fullscreen;
+    NATIVE_CATCH(FULLSCREEN_OFF)
+}
+
+int boulder_set_display_mode(int display, int width, int height, float refreshRate, DisplayMode* chosen) {
+    NATIVE_TRY
+    SDL_DisplayID id = displayAt(display);
+    if (!id || width <= 0 || height <= 0 || refreshRate < 0.0f) {
+        return -1;
+    }
+
+    SDL_DisplayMode mode{};
+    if (!SDL_GetClosestFullscreenDisplayMode(id, width, height, refreshRate, true, &mode)) {
+        fail(ERROR_UNSUPPORTED, "No display mode near {}x{}@{}: {}", width, height, refreshRate, SDL_GetError());
+        return -1;
+    }
+    g_engine.exclusiveMode = mode;
+    if (chosen) {
+        copyDisplayMode(mode, chosen);
+    }
+
+    if (g_engine.window && boulder_get_fullscreen() == FULLSCREEN_EXCLUSIVE) {
+        return boulder_set_fullscreen(FULLSCREEN_EXCLUSIVE, display);
+    }
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+void boulder_get_window_size(int* width, int* height) {
+    NATIVE_TRY
+    if (g_engine.window && width && height) {
+        SDL_GetWindowSize(g_engine.window, width, height);
+    }
+    NATIVE_CATCH()
+}
+
+int boulder_should_close() {
+    NATIVE_TRY
+    return g_engine.shouldClose ? 1 : 0;
+    NATIVE_CATCH(0)
+}
+
+// Queues a touch event and updates the fingers that are down
+static void handleTouch(const SDL_TouchFingerEvent& finger, int phase) {
+    int width = 0, height = 0;
+    if (g_engine.window) {
+        SDL_GetWindowSize(g_engine.window, &width, &height);
+    }
+
+    TouchEvent event{};
+    event.id = finger.fingerID;
+    event.phase = phase;
+    event.x = finger.x * width;
+    event.y = finger.y * height;
+    event.dx = finger.dx * width;
+    event.dy = finger.dy * height;
+    event.pressure = finger.pressure;
+
+    if (g_engine.touchEvents.size() >= MAX_TOUCH_EVENTS) {
+        g_engine.touchEvents.pop_front();
+    }
+    g_engine.touchEvents.push_back(event);
+
+    auto& touches = g_engine.touches;
+    auto it = std::find_if(touches.begin(), touches.end(),
+                           [&](const TouchPoint& t) { return t.id == event.id; });
+    if (phase == TOUCH_UP || phase == TOUCH_CANCEL) {
+        if (it != touches.end()) {
+            touches.erase(it);
+        }
+    } else if (it == touches.end()) {
+        touches.push_back({event.id, event.x, event.y, event.x, event.y, event.pressure});
+    } else {
+        it->x = event.x;
+        it->y = event.y;
+        it->pressure = event.pressure;
+    }
+}
+
+// Stops rendering while the app is in the background. Android destroys the window's
+// surface, so the swapchain and surface are released until the app resumes.
+static void pauseRendering() {
+    if (g_engine.paused) {
+        return;
+    }
+    g_engine.paused = true;
+    Logger::get().info("App paused");
+
+    if (!g_engine.device) {
+        return;
+    }
+    vkDeviceWaitIdle(g_engine.device);
+
+#ifdef SDL_PLATFORM_ANDROID
+    for (auto imageView : g_engine.swapchainImageViews) {
+        vkDestroyImageView(g_engine.device, imageView, nullptr);
+    }
+    g_engine.swapchainImageViews.clear();
+
+    if (g_engine.swapchain) {
+        vkDestroySwapchainKHR(g_engine.device, g_engine.swapchain, nullptr);
+        g_engine.swapchain = VK_NULL_HANDLE;
+    }
+    if (g_engine.surface) {
+        vkDestroySurfaceKHR(g_engine.instance, g_engine.surface, nullptr);
+        g_engine.surface = VK_NULL_HANDLE;
+    }
+#endif
+}
+
+// Creates the surface again if it was released and has the swapchain rebuilt
+static void resumeRendering() {
+    if (!g_engine.paused) {
+        return;
+    }
+    g_engine.paused = false;
+    Logger::get().info("App resumed");
+
+    if (g_engine.window && !g_engine.surface) {
+        if (!SDL_Vulkan_CreateSurface(g_engine.window, g_engine.instance, nullptr, &g_engine.surface)) {
+            fail(ERROR_PLATFORM, "Failed to create Vulkan surface on resume: {}", SDL_GetError());
+            return;
+        }
+    }
+    g_engine.swapchainNeedsRecreate = true;
+}
+
+static void queueAppEvent(int event) {
+    g_engine.appEvents.push_back(event);
+}
+
+static void queueWindowEvent(int type, int width = 0, int height = 0, float x = 0.0f, float y = 0.0f, const char* path = nullptr) {
+    if (g_engine.windowEvents.size() >= MAX_WINDOW_EVENTS) {
+        g_engine.windowEvents.pop_front();
+    }
+    g_engine.windowEvents.push_back({{type, width, height, x, y}, path ? path : ""});
+}
+
+static void queueKeyEvent(const SDL_KeyboardEvent& key) {
+    if (g_engine.keyEvents.size() >= MAX_KEY_EVENTS) {
+        g_engine.keyEvents.pop_front();
+    }
+    g_engine.keyEvents.push_back({static_cast<int>(key.scancode), key.key, key.down ? 1 : 0, key.repeat ? 1 : 0});
+}
+
+static Controller* findController(SDL_JoystickID id) {
+    for (auto& controller : g_engine.controllers) {
+        if (controller.id == id) {
+            return &controller;
+        }
+    }
+    return nullptr;
+}
+
+static bool hasMotionController() {
+    for (const auto& controller : g_engine.controllers) {
+        if (controller.capabilities & CONTROLLER_GYRO) {
+            return true;
+        }
+    }
+    return false;
+}
+
+// Turns a controller's gyro and accelerometer on or off
+static void enableControllerMotion(Controller& controller, bool enabled) {
+    if (controller.capabilities & CONTROLLER_GYRO) {
+        SDL_SetGamepadSensorEnabled(controller.pad, SDL_SENSOR_GYRO, enabled);
+    }
+    if (controller.capabilities & CONTROLLER_ACCEL) {
+        SDL_SetGamepadSensorEnabled(controller.pad, SDL_SENSOR_ACCEL, enabled);
+    }
+}
+
+static uint32_t controllerCapabilities(SDL_Gamepad* pad) {
+    uint32_t capabilities = 0;
+    SDL_PropertiesID props = SDL_GetGamepadProperties(pad);
+    if (SDL_GetBooleanProperty(props, SDL_PROP_GAMEPAD_CAP_RUMBLE_BOOLEAN, false)) {
+        capabilities |= CONTROLLER_RUMBLE;
+    }
+    if (SDL_GetBooleanProperty(props, SDL_PROP_GAMEPAD_CAP_TRIGGER_RUMBLE_BOOLEAN, false)) {
+        capabilities |= CONTROLLER_TRIGGER_RUMBLE;
+    }
+    if (SDL_GetBooleanProperty(props, SDL_PROP_GAMEPAD_CAP_RGB_LED_BOOLEAN, false)) {
+        capabilities |= CONTROLLER_LED;
+    }
+    if (SDL_GamepadHasSensor(pad, SDL_SENSOR_GYRO)) {
+        capabilities |= CONTROLLER_GYRO;
+    }
+    if (SDL_GamepadHasSensor(pad, SDL_SENSOR_ACCEL)) {
+        capabilities |= CONTROLLER_ACCEL;
+    }
+
+    switch (SDL_GetGamepadType(pad)) {
+        case SDL_GAMEPAD_TYPE_PS5:
+            capabilities |= CONTROLLER_ADAPTIVE_TRIGGERS;
+            break;
+        case SDL_GAMEPAD_TYPE_NINTENDO_SWITCH_PRO:
+        case SDL_GAMEPAD_TYPE_NINTENDO_SWITCH_JOYCON_LEFT:
+        case SDL_GAMEPAD_TYPE_NINTENDO_SWITCH_JOYCON_RIGHT:
+        case SDL_GAMEPAD_TYPE_NINTENDO_SWITCH_JOYCON_PAIR:
+            if (capabilities & CONTROLLER_RUMBLE) {
+                capabilities |= CONTROLLER_HD_RUMBLE;
+            }
+            break;
+        default:
+            break;
+    }
+    return capabilities;
+}
+
+static void openController(SDL_JoystickID id) {
+    if (findController(id)) {
+        return;
+    }
+
+    SDL_Gamepad* pad = SDL_OpenGamepad(id);
+    if (!pad) {
+        fail(ERROR_PLATFORM, "Failed to open controller: {}", SDL_GetError());
+        return;
+    }
+
+    Controller controller;
+    controller.pad = pad;
+    controller.id = id;
+    controller.capabilities = controllerCapabilities(pad);
+    if (g_engine.motionEnabled) {
+        enableControllerMotion(controller, true);
+        g_engine.lastGyroTimestamp = 0;
+    }
+    g_engine.controllers.push_back(std::move(controller));
+
+    const char* name = SDL_GetGamepadName(pad);
+    Logger::get().info("Controller connected: {}", name ? name : "unknown");
+}
+
+static void closeController(SDL_JoystickID id) {
+    auto& controllers = g_engine.controllers;
+    auto it = std::find_if(controllers.begin(), controllers.end(),
+                           [&](const Controller& c) { return c.id == id; });
+    if (it == controllers.end()) {
+        return;
+    }
+
+    bool motion = it->capabilities & CONTROLLER_GYRO;
+    SDL_CloseGamepad(it->pad);
+    controllers.erase(it);
+
+    if (motion) {
+        g_engine.lastGyroTimestamp = 0;
+        if (!hasMotionController()) {
+            g_engine.motionSource = (g_engine.gyroSensor || g_engine.accelSensor) ? MOTION_DEVICE : MOTION_NONE;
+        }
+    }
+}
+
+static void closeControllers() {
+    for (auto& controller : g_engine.controllers) {
+        SDL_CloseGamepad(controller.pad);
+    }
+    g_engine.controllers.clear();
+}
+
+// Opens the device's own gyro and accelerometer and turns on those of the controllers
+static bool openMotionSensors() {
+    if (!SDL_InitSubSystem(SDL_INIT_SENSOR)) {
+        fail(ERROR_PLATFORM, "SDL_InitSubSystem SENSOR failed: {}", SDL_GetError());
+        return false;
+    }
+
+    int count = 0;
+    SDL_SensorID* sensors = SDL_GetSensors(&count);
+    for (int i = 0; sensors && i < count; i++) {
+        SDL_SensorType type = SDL_GetSensorTypeForID(sensors[i]);
+        if (type == SDL_SENSOR_GYRO && !g_engine.gyroSensor) {
+            g_engine.gyroSensor = SDL_OpenSensor(sensors[i]);
+        } else if (type == SDL_SENSOR_ACCEL && !g_engine.accelSensor) {
+            g_engine.accelSensor = SDL_OpenSensor(sensors[i]);
+        }
+    }
+    SDL_free(sensors);
+
+    for (auto& controller : g_engine.controllers) {
+        enableControllerMotion(controller, true);
+    }
+
+    g_engine.motionSource = (g_engine.gyroSensor || g_engine.accelSensor) ? MOTION_DEVICE : MOTION_NONE;
+    g_engine.motionEnabled = true;
+    return true;
+}
+
+static void closeMotionSensors() {
+    for (auto& controller : g_engine.controllers) {
+        enableControllerMotion(controller, false);
+    }
+    if (g_engine.gyroSensor) {
+        SDL_CloseSensor(g_engine.gyroSensor);
+        g_engine.gyroSensor = nullptr;
+    }
+    if (g_engine.accelSensor) {
+        SDL_CloseSensor(g_engine.accelSensor);
+        g_engine.accelSensor = nullptr;
+    }
+    if (g_engine.motionEnabled) {
+        SDL_QuitSubSystem(SDL_INIT_SENSOR);
+    }
+
+    g_engine.motionEnabled = false;
+    g_engine.motionSource = MOTION_NONE;
+    g_engine.gyro = glm::vec3(0.0f);
+    g_engine.accel = glm::vec3(0.0f);
+    g_engine.gyroDelta = glm::vec3(0.0f);
+    g_engine.gyroDeltaTime = 0.0f;
+    g_engine.lastGyroTimestamp = 0;
+    g_engine.calibratingGyro = false;
+}
+
+// Records a gyro sample, feeds calibration and integrates it into the rotation delta
+static void handleGyro(const float* data, uint64_t timestamp) {
+    glm::vec3 raw(data[0], data[1], data[2]);
+    if (g_engine.calibratingGyro) {
+        g_engine.calibrationSum += glm::dvec3(raw);
+        g_engine.calibrationSamples++;
+    }
+    g_engine.gyro = raw - g_engine.gyroBias;
+
+    if (g_engine.lastGyroTimestamp != 0 && timestamp > g_engine.lastGyroTimestamp) {
+        float dt = static_cast<float>(timestamp - g_engine.lastGyroTimestamp) * 1e-9f;
+        if (dt <= MAX_GYRO_SAMPLE_GAP) {
+            g_engine.gyroDelta += g_engine.gyro * dt;
+            g_engine.gyroDeltaTime += dt;
+        }
+    }
+    g_engine.lastGyroTimestamp = timestamp;
+}
+
+// Handles a sensor event. A controller with a gyro takes over from the device's sensors
+// while it is connected, so the two are never mixed.
+static void handleSensorEvent(const SDL_Event& event) {
+    if (event.type == SDL_EVENT_GAMEPAD_SENSOR_UPDATE) {
+        g_engine.motionSource = MOTION_CONTROLLER;
+        if (event.gsensor.sensor == SDL_SENSOR_GYRO) {
+            handleGyro(event.gsensor.data, event.gsensor.sensor_timestamp);
+        } else if (event.gsensor.sensor == SDL_SENSOR_ACCEL) {
+            g_engine.accel = glm::vec3(event.gsensor.data[0], event.gsensor.data[1], event.gsensor.data[2]);
+        }
+        return;
+    }
+
+    if (hasMotionController()) {
+        return;
+    }
+    if (g_engine.gyroSensor && event.sensor.which == SDL_GetSensorID(g_engine.gyroSensor)) {
+        handleGyro(event.sensor.data, event.sensor.sensor_timestamp);
+    } else if (g_engine.accelSensor && event.sensor.which == SDL_GetSensorID(g_engine.accelSensor)) {
+        g_engine.accel = glm::vec3(event.sensor.data[0], event.sensor.data[1], event.sensor.data[2]);
+    }
+}
+
+// Level of a haptic effect t seconds in, or -1 once it finished
+static float hapticLevel(const HapticEffect& effect, float t) {
+    float duration = effect.duration;
+    if (duration > 0.0f && t >= duration) {
+        return -1.0f;
+    }
+
+    float level = effect.strength;
+    if (effect.attackTime > 0.0f && t < effect.attackTime) {
+        level = effect.attackLevel + (effect.strength - effect.attackLevel) * (t / effect.attackTime);
+    }
+    if (duration > 0.0f && effect.fadeTime > 0.0f && t > duration - effect.fadeTime) {
+        float remaining = (duration - t) / effect.fadeTime;
+        level = effect.fadeLevel + (level - effect.fadeLevel) * remaining;
+    }
+    return std::clamp(level, 0.0f, 1.0f);
+}
+
+// Share of an effect that goes to the high frequency motor
+static float highBandWeight(float frequency) {
+    if (frequency <= 0.0f) {
+        return 0.5f;
+    }
+    float weight = std::log2(frequency / HAPTIC_LOW_BAND) / std::log2(HAPTIC_HIGH_BAND / HAPTIC_LOW_BAND);
+    return std::clamp(weight, 0.0f, 1.0f);
+}
+
+// Mixes the effects playing on each controller into its motors
+static void updateHaptics() {
+    uint64_t now = SDL_GetTicksNS();
+    for (auto& controller : g_engine.controllers) {
+        if (controller.haptics.empty() && controller.lastRumble == 0) {
+            continue;
+        }
+
+        float low = 0.0f, high = 0.0f, left = 0.0f, right = 0.0f;
+        auto& haptics = controller.haptics;
+        for (auto it = haptics.begin(); it != haptics.end();) {
+            float t = static_cast<float>(now - it->start) * 1e-9f;
+            float level = hapticLevel(it->effect, t);
+            if (level < 0.0f) {
+                it = haptics.erase(it);
+                continue;
+            }
+
+            switch (it->effect.target) {
+                case HAPTIC_LEFT_TRIGGER:
+                    left += level;
+                    break;
+                case HAPTIC_RIGHT_TRIGGER:
+                    right += level;
+                    break;
+                default: {
+                    float weight = highBandWeight(it->effect.frequency);
+                    low += level * (1.0f - weight);
+                    high += level * weight;
+                    break;
+                }
+            }
+            ++it;
+        }
+
+        low = std::min(low, 1.0f);
+        high = std::min(high, 1.0f);
+        left = std::min(left, 1.0f);
+        right = std::min(right, 1.0f);
+
+        bool changed = low != controller.low || high != controller.high ||
+                       left != controller.leftTrigger || right != controller.rightTrigger;
+        bool stale = now - controller.lastRumble >= HAPTIC_REFRESH_MS * 1'000'000ull / 2;
+        if (!changed && !stale) {
+            continue;
+        }
+
+        // Commands are sent again halfway through, so effects do not gap between frames
+        uint32_t length = haptics.empty() ? 0 : HAPTIC_REFRESH_MS;
+        SDL_RumbleGamepad(controller.pad, static_cast<Uint16>(low * 0xFFFF), static_cast<Uint16>(high * 0xFFFF), length);
+        if (controller.capabilities & CONTROLLER_TRIGGER_RUMBLE) {
+            SDL_RumbleGamepadTriggers(controller.pad, static_cast<Uint16>(left * 0xFFFF),
+                                      static_cast<Uint16>(right * 0xFFFF), length);
+        }
+
+        controller.low = low;
+        controller.high = high;
+        controller.leftTrigger = left;
+        controller.rightTrigger = right;
+        controller.lastRumble = haptics.empty() ? 0 : now;
+    }
+}
+
+static uint8_t unitToByte(float value) {
+    return static_cast<uint8_t>(std::clamp(value, 0.0f, 1.0f) * 255.0f + 0.5f);
+}
+
+void boulder_poll_events() {
+    NATIVE_TRY
+    g_engine.mouseWheel = glm::vec2(0.0f);
+    SDL_Event event;
+    while (SDL_PollEvent(&event)) {
+        switch (event.type) {
+            case SDL_EVENT_QUIT:
+                g_engine.shouldClose = true;
+                break;
+            case SDL_EVENT_KEY_DOWN:
+            case SDL_EVENT_KEY_UP:
+                queueKeyEvent(event.key);
+                break;
+            case SDL_EVENT_KEYMAP_CHANGED:
+                g_engine.keymapChanged = true;
+                break;
+            case SDL_EVENT_MOUSE_WHEEL: {
+                // "Natural" scrolling reports flipped values; undo it so positive is always away
+                float flip = event.wheel.direction == SDL_MOUSEWHEEL_FLIPPED ? -1.0f : 1.0f;
+                g_engine.mouseWheel += glm::vec2(event.wheel.x, event.wheel.y) * flip;
+                break;
+            }
+            case SDL_EVENT_FINGER_DOWN:
+                handleTouch(event.tfinger, TOUCH_DOWN);
+                break;
+            case SDL_EVENT_FINGER_MOTION:
+                handleTouch(event.tfinger, TOUCH_MOVE);
+                break;
+            case SDL_EVENT_FINGER_UP:
+                handleTouch(event.tfinger, TOUCH_UP);
+                break;
+            case SDL_EVENT_FINGER_CANCELED:
+                handleTouch(event.tfinger, TOUCH_CANCEL);
+                break;
+            case SDL_EVENT_WILL_ENTER_BACKGROUND:
+                queueAppEvent(APP_WILL_PAUSE);
+                break;
+            case SDL_EVENT_DID_ENTER_BACKGROUND:
+                pauseRendering();
+                queueAppEvent(APP_PAUSED);
+                break;
+            case SDL_EVENT_WILL_ENTER_FOREGROUND:
+                queueAppEvent(APP_WILL_RESUME);
+                break;
+            case SDL_EVENT_DID_ENTER_FOREGROUND:
+                resumeRendering();
+                queueAppEvent(APP_RESUMED);
+                break;
+            case SDL_EVENT_LOW_MEMORY:
+                queueAppEvent(APP_LOW_MEMORY);
+                break;
+            case SDL_EVENT_TERMINATING:
+                queueAppEvent(APP_TERMINATING);
+                g_engine.shouldClose = true;
+                break;
+            case SDL_EVENT_GAMEPAD_ADDED:
+                openController(event.gdevice.which);
+                break;
+            case SDL_EVENT_GAMEPAD_REMOVED:
+                closeController(event.gdevice.which);
+                break;
+            case SDL_EVENT_SENSOR_UPDATE:
+            case SDL_EVENT_GAMEPAD_SENSOR_UPDATE:
+                handleSensorEvent(event);
+                break;
+            case SDL_EVENT_WINDOW_RESIZED:
+                queueWindowEvent(WINDOW_RESIZED, event.window.data1, event.window.data2);
+                [[fallthrough]];
+            case SDL_EVENT_WINDOW_PIXEL_SIZE_CHANGED:
+                // Set flag to indicate resize needed
+                g_engine.swapchainNeedsRecreate = true;
+                // Track if this happened during swapchain recreation
+                if (g_engine.isRecreatingSwapchain) {
+                    g_engine.resizeEventDuringRecreate = true;
+                }
+                break;
+            case SDL_EVENT_WINDOW_FOCUS_GAINED:
+                queueWindowEvent(WINDOW_FOCUS_GAINED);
+                break;
+            case SDL_EVENT_WINDOW_FOCUS_LOST:
+                queueWindowEvent(WINDOW_FOCUS_LOST);
+                break;
+            case SDL_EVENT_WINDOW_MINIMIZED:
+                queueWindowEvent(WINDOW_MINIMIZED);
+                break;
+            case SDL_EVENT_WINDOW_RESTORED:
+                queueWindowEvent(WINDOW_RESTORED);
+                break;
+            case SDL_EVENT_WINDOW_MAXIMIZED:
+                queueWindowEvent(WINDOW_MAXIMIZED);
+                break;
+            case SDL_EVENT_DROP_FILE:
+                queueWindowEvent(WINDOW_FILE_DROPPED, 0, 0, event.drop.x, event.drop.y, event.drop.data);
+                break;
+            default:
+                break;
+        }
+    }
+    updateHaptics();
+    NATIVE_CATCH()
+}
+
+WorldID boulder_create_world() {
+    NATIVE_TRY
+    if (!g_engine.initialized) {
+        return 0;
+    }
+    return createWorld();
+    NATIVE_CATCH(0)
+}
+
+int boulder_destroy_world(WorldID world) {
+    NATIVE_TRY
+    auto it = g_engine.worlds.find(world);
+    if (it == g_engine.worlds.end() || world == DEFAULT_WORLD || world == g_engine.activeWorld) {
+        return -1;
+    }
+
+    // Frames in flight may still draw its models if it was active a moment ago
+    if (g_engine.device) {
+        vkDeviceWaitIdle(g_engine.device);
+        destroyModelBuffers(*it->second);
+    }
+    if (world == g_engine.boundWorld) {
+        bindWorld(g_engine.activeWorld);
+    }
+    delete it->second;
+    g_engine.worlds.erase(it);
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_bind_world(WorldID world) {
+    NATIVE_TRY
+    return bindWorld(world) ? 0 : -1;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_set_active_world(WorldID world) {
+    NATIVE_TRY
+    if (!g_engine.worlds.count(world)) {
+        return -1;
+    }
+    if (world == g_engine.activeWorld) {
+        return 0;
+    }
+
+    // Pending events and change ticks name entities of the previous world
+    g_engine.activeWorld = world;
+    g_engine.componentEvents.clear();
+    for (auto& ticks : g_engine.changeTicks) {
+        ticks.clear();
+    }
+    g_engine.contacts.clear();
+    g_engine.collisionEvents.clear();
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+WorldID boulder_get_active_world() {
+    return g_engine.activeWorld;
+}
+
+// Counts the entities games make: components, observers and the other builtins flecs and
+// the engine register are named or polymorphic and left out
+static int userEntityCount(flecs::world& world) {
+    ecs_world_t* w = world.c_ptr();
+    ecs_entities_t entities = ecs_get_entities(w);
+    int count = 0;
+    for (int32_t i = 0; i < entities.alive_count; i++) {
+        ecs_entity_t e = entities.ids[i];
+        if (ecs_get_name(w, e) || ecs_has_id(w, e, ecs_id(EcsComponent)) ||
+            ecs_has_pair(w, e, ecs_id(EcsPoly), EcsWildcard)) {
+            continue;
+        }
+        count++;
+    }
+    return count;
+}
+
+int boulder_world_entity_count(WorldID world) {
+    NATIVE_TRY
+    auto it = g_engine.worlds.find(world);
+    if (it == g_engine.worlds.end()) {
+        return -1;
+    }
+    return userEntityCount(*it->second);
+    NATIVE_CATCH(-1)
+}
+
+template <typename T>
+static void moveComponent(flecs::entity from, flecs::entity to) {
+    if (T* value = from.get_mut<T>()) {
+        to.set<T>(std::move(*value));
+    }
+}
+
+int boulder_move_entity(EntityID entity, WorldID world, EntityID* moved) {
+    NATIVE_TRY
+    auto it = g_engine.worlds.find(world);
+    if (!g_engine.ecs || !moved || it == g_engine.worlds.end() || !g_engine.ecs->is_alive(entity)) {
+        return -1;
+    }
+    if (world == g_engine.boundWorld) {
+        *moved = entity;
+        return 0;
+    }
+
+    flecs::entity from = g_engine.ecs->entity(entity);
+    if (from.has<VoxelWorld>()) {
+        // Its chunks are child entities drawing the meshes
+        fail(ERROR_INVALID_ARGUMENT, "Voxel worlds cannot be moved to another world");
+        return -1;
+    }
+
+    // Every component an entity can have; voxel worlds are refused above
+    flecs::entity to = it->second->entity();
+    moveComponent<Transform>(from, to);
+    moveComponent<PhysicsBody>(from, to);
+    moveComponent<Model>(from, to);
+    moveComponent<BuoyancyVolume>(from, to);
+    moveComponent<Buoyant>(from, to);
+    moveComponent<SoftBody>(from, to);
+    moveComponent<Collider>(from, to);
+    moveComponent<SpatialLayers>(from, to);
+    moveComponent<Tags>(from, to);
+    moveComponent<Outline>(from, to);
+    moveComponent<InstanceColor>(from, to);
+    moveComponent<Material>(from, to);
+    moveComponent<Light>(from, to);
+    from.destruct();
+
+    *moved = to.id();
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+EntityID boulder_create_entity() {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return 0;
+    }
+
+    flecs::entity e = g_engine.ecs->entity();
+    return e.id();
+    NATIVE_CATCH(0)
+}
+
+void boulder_destroy_entity(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    e.destruct();
+    NATIVE_CATCH()
+}
+
+int boulder_watch_component(int component, int kinds) {
+    NATIVE_TRY
+    if (component < 0 || component >= COMPONENT_COUNT) {
+        return -1;
+    }
+
+    g_engine.watchedComponents[component] = kinds;
+    if (!(kinds & ((1 << COMPONENT_EVENT_CHANGED) | COMPONENT_TRACK_CHANGES))) {
+        g_engine.changeTicks[component].clear();
+    }
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_poll_component_event(ComponentEvent* event) {
+    NATIVE_TRY
+    if (!event || g_engine.componentEvents.empty()) {
+        return 0;
+    }
+
+    *event = g_engine.componentEvents.front();
+    g_engine.componentEvents.pop_front();
+    return 1;
+    NATIVE_CATCH(0)
+}
+
+int boulder_watch_collisions(int enabled) {
+    NATIVE_TRY
+    g_engine.collisionEventsWatched = enabled != 0;
+    if (!g_engine.collisionEventsWatched) {
+        g_engine.collisionEvents.clear();
+    }
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_poll_collision_event(CollisionEvent* event) {
+    NATIVE_TRY
+    if (!event || g_engine.collisionEvents.empty()) {
+        return 0;
+    }
+
+    *event = g_engine.collisionEvents.front();
+    g_engine.collisionEvents.pop_front();
+    return 1;
+    NATIVE_CATCH(0)
+}
+
+uint64_t boulder_get_change_tick() {
+    NATIVE_TRY
+    return g_engine.changeTick;
+    NATIVE_CATCH(0)
+}
+
+int boulder_get_component_change_tick(EntityID entity, int component, uint64_t* tick) {
+    NATIVE_TRY
+    if (component < 0 || component >= COMPONENT_COUNT || !tick) {
+        return -1;
+    }
+
+    auto it = g_engine.changeTicks[component].find(entity);
+    if (it == g_engine.changeTicks[component].end()) {
+        return -1;
+    }
+    *tick = it->second;
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_changed_entities(int component, uint64_t tick, EntityID* entities, uint32_t capacity) {
+    NATIVE_TRY
+    if (component < 0 || component >= COMPONENT_COUNT) {
+        return -1;
+    }
+
+    int count = 0;
+    for (const auto& [entity, changed] : g_engine.changeTicks[component]) {
+        if (changed < tick) {
+            continue;
+        }
+        if (entities && static_cast<uint32_t>(count) < capacity) {
+            entities[count] = entity;
+        }
+        count++;
+    }
+    return count;
+    NATIVE_CATCH(-1)
+}
+
+// flecs id of a component number used by the C API, 0 for an unknown one
+static flecs::entity_t componentId(int component) {
+    switch (component) {
+        case COMPONENT_TRANSFORM:
+            return g_engine.ecs->component<Transform>().id();
+        case COMPONENT_PHYSICS_BODY:
+            return g_engine.ecs->component<PhysicsBody>().id();
+        case COMPONENT_MODEL:
+            return g_engine.ecs->component<Model>().id();
+        case COMPONENT_BUOYANCY_VOLUME:
+            return g_engine.ecs->component<BuoyancyVolume>().id();
+        case COMPONENT_BUOYANT:
+            return g_engine.ecs->component<Buoyant>().id();
+        case COMPONENT_SOFT_BODY:
+            return g_engine.ecs->component<SoftBody>().id();
+        case COMPONENT_COLLIDER:
+            return g_engine.ecs->component<Collider>().id();
+        default:
+            return 0;
+    }
+}
+
+int boulder_query_entities(const int* with, int withCount, const int* without, int withoutCount,
+                           EntityID* entities, uint32_t capacity) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !with || withCount <= 0 || (withoutCount > 0 && !without)) {
+        return -1;
+    }
+
+    // Uncached: built per call, which is cheap next to the iteration for ad hoc queries
+    auto builder = g_engine.ecs->query_builder<>();
+    for (int i = 0; i < withCount; i++) {
+        flecs::entity_t id = componentId(with[i]);
+        if (!id) {
+            return -1;
+        }
+        builder.with(id);
+    }
+    for (int i = 0; i < withoutCount; i++) {
+        flecs::entity_t id = componentId(without[i]);
+        if (!id) {
+            return -1;
+        }
+        builder.without(id);
+    }
+
+    int count = 0;
+    builder.build().each([&](flecs::entity e) {
+        if (entities && static_cast<uint32_t>(count) < capacity) {
+            entities[count] = e.id();
+        }
+        count++;
+    });
+    return count;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_revive_entity(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+    if (g_engine.ecs->is_alive(entity)) {
+        return 0;
+    }
+
+    // The ID can only come back if its index hasn't been reused by a newer entity
+    if (g_engine.ecs->get_alive(entity & ECS_ENTITY_MASK).id() != 0) {
+        return -1;
+    }
+
+    g_engine.ecs->make_alive(entity);
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_entity_exists(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return 0;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    return e.is_alive() ? 1 : 0;
+    NATIVE_CATCH(0)
+}
+
+int boulder_add_transform(EntityID entity, float x, float y, float z) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    e.set<Transform>({
+        .position = glm::vec3(x, y, z),
+        .rotation = glm::quat(1.0f, 0.0f, 0.0f, 0.0f),
+        .scale = glm::vec3(1.0f)
+    });
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_transform(EntityID entity, float* x, float* y, float* z) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !x || !y || !z) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const Transform* t = e.get<Transform>();
+    if (!t) {
+        missingComponent(e.id(), "transform");
+        return -1;
+    }
+
+    *x = t->position.x;
+    *y = t->position.y;
+    *z = t->position.z;
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_full_transform(EntityID entity,
+                               float* px, float* py, float* pz,
+                               float* rx, float* ry, float* rz,
+                               float* sx, float* sy, float* sz) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const Transform* t = e.get<Transform>();
+    if (!t) {
+        missingComponent(e.id(), "transform");
+        return -1;
+    }
+
+    if (px) *px = t->position.x;
+    if (py) *py = t->position.y;
+    if (pz) *pz = t->position.z;
+
+    glm::vec3 euler = quatToEuler(t->rotation);
+    if (rx) *rx = euler.x;
+    if (ry) *ry = euler.y;
+    if (rz) *rz = euler.z;
+
+    if (sx) *sx = t->scale.x;
+    if (sy) *sy = t->scale.y;
+    if (sz) *sz = t->scale.z;
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_set_full_transform(EntityID entity,
+                              float px, float py, float pz,
+                              float rx, float ry, float rz,
+                              float sx, float sy, float sz) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    Transform* t = e.get_mut<Transform>();
+    if (!t) {
+        missingComponent(e.id(), "transform");
+        return -1;
+    }
+
+    t->position = glm::vec3(px, py, pz);
+    t->rotation = eulerToQuat(glm::vec3(rx, ry, rz));
+    t->scale = glm::vec3(sx, sy, sz);
+    markChanged(e.id(), COMPONENT_TRANSFORM);
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_set_rotation_quat(EntityID entity, float x, float y, float z, float w) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    glm::quat rotation(w, x, y, z);
+    float length = glm::length(rotation);
+    if (!(length > 0.0f) || !std::isfinite(length)) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    Transform* t = e.get_mut<Transform>();
+    if (!t) {
+        missingComponent(e.id(), "transform");
+        return -1;
+    }
+
+    t->rotation = rotation / length;
+    markChanged(e.id(), COMPONENT_TRANSFORM);
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_rotation_quat(EntityID entity, float* x, float* y, float* z, float* w) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !x || !y || !z || !w) {
+        return -1;
+    }
+
+    const Transform* t = g_engine.ecs->entity(entity).get<Transform>();
+    if (!t) {
+        return -1;
+    }
+
+    *x = t->rotation.x;
+    *y = t->rotation.y;
+    *z = t->rotation.z;
+    *w = t->rotation.w;
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_set_transform(EntityID entity, float x, float y, float z) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    Transform* t = e.get_mut<Transform>();
+    if (!t) {
+        missingComponent(e.id(), "transform");
+        return -1;
+    }
+
+    t->position = glm::vec3(x, y, z);
+    markChanged(e.id(), COMPONENT_TRANSFORM);
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_add_physics_body(EntityID entity, float mass) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    e.set<PhysicsBody>({
+        .mass = mass,
+        .velocity = glm::vec3(0.0f),
+        .acceleration = glm::vec3(0.0f, -9.81f, 0.0f) // gravity
+    });
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_set_velocity(EntityID entity, float vx, float vy, float vz) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    PhysicsBody* pb = e.get_mut<PhysicsBody>();
+    if (!pb) {
+        missingComponent(e.id(), "physics body");
+        return -1;
+    }
+
+    pb->velocity = glm::vec3(vx, vy, vz);
+    markChanged(e.id(), COMPONENT_PHYSICS_BODY);
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_velocity(EntityID entity, float* vx, float* vy, float* vz) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !vx || !vy || !vz) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const PhysicsBody* pb = e.get<PhysicsBody>();
+    if (!pb) {
+        missingComponent(e.id(), "physics body");
+        return -1;
+    }
+
+    *vx = pb->velocity.x;
+    *vy = pb->velocity.y;
+    *vz = pb->velocity.z;
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_remove_physics_body(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    e.remove<PhysicsBody>();
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_mass(EntityID entity, float* mass) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !mass) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const PhysicsBody* pb = e.get<PhysicsBody>();
+    if (!pb) {
+        missingComponent(e.id(), "physics body");
+        return -1;
+    }
+
+    *mass = pb->mass;
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_add_buoyancy_volume(EntityID entity, float hx, float hy, float hz, float density, float linearDrag) {
+    NATIVE_TRY
+    if (!g_engine.ecs || hx <= 0.0f || hy <= 0.0f || hz <= 0.0f || density < 0.0f) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    if (!e.has<Transform>()) {
+        return -1;
+    }
+    e.set<BuoyancyVolume>({glm::vec3(hx, hy, hz), density, std::max(0.0f, linearDrag)});
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_set_buoyancy(EntityID entity, float volume, float height) {
+    NATIVE_TRY
+    if (!g_engine.ecs || volume < 0.0f || height <= 0.0f) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    e.set<Buoyant>({volume, height});
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_add_soft_body(EntityID entity, float stiffness, float damping, float amount) {
+    NATIVE_TRY
+    if (!g_engine.ecs || stiffness <= 0.0f || damping < 0.0f) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    SoftBody sb;
+    sb.stiffness = stiffness;
+    sb.damping = damping;
+    sb.amount = amount;
+    e.set<SoftBody>(sb);
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_remove_soft_body(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    e.remove<SoftBody>();
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+static glm::ivec3 spatialCell(const glm::vec3& position) {
+    // Clamped to the 21 bits per axis spatialKey packs
+    glm::vec3 cell = glm::clamp(glm::floor(position / g_engine.spatialCellSize), glm::vec3(-1048576.0f), glm::vec3(1048575.0f));
+    return glm::ivec3(cell);
+}
+
+static uint64_t spatialKey(const glm::ivec3& cell) {
+    return (static_cast<uint64_t>(cell.x & 0x1FFFFF) << 42) |
+           (static_cast<uint64_t>(cell.y & 0x1FFFFF) << 21) |
+           static_cast<uint64_t>(cell.z & 0x1FFFFF);
+}
+
+static void rebuildSpatialIndex() {
+    if (!g_engine.spatialDirty) {
+        return;
+    }
+
+    g_engine.spatialGrid.clear();
+    auto query = g_engine.ecs->query<const Transform, const SpatialLayers*>();
+    query.each([](flecs::entity e, const Transform& t, const SpatialLayers* layers) {
+        SpatialEntry entry = {e.id(), t.position, layers ? layers->mask : SPATIAL_DEFAULT_LAYERS};
+        g_engine.spatialGrid[spatialKey(spatialCell(t.position))].push_back(entry);
+    });
+    g_engine.spatialDirty = false;
+}
+
+// Calls fn for every indexed entity in cells overlapping the box lo..hi
+template <typename Fn>
+static void forEachSpatialEntry(const glm::vec3& lo, const glm::vec3& hi, Fn fn) {
+    rebuildSpatialIndex();
+
+    glm::ivec3 a = spatialCell(lo);
+    glm::ivec3 b = spatialCell(hi);
+    double cells = (static_cast<double>(b.x) - a.x + 1) * (static_cast<double>(b.y) - a.y + 1) *
+                   (static_cast<double>(b.z) - a.z + 1);
+
+    // Scanning every entry is cheaper than visiting more cells than exist
+    if (cells > static_cast<double>(g_engine.spatialGrid.size())) {
+        for (const auto& [key, entries] : g_engine.spatialGrid) {
+            for (const SpatialEntry& entry : entries) {
+                fn(entry);
+            }
+        }
+        return;
+    }
+
+    for (int x = a.x; x <= b.x; x++) {
+        for (int y = a.y; y <= b.y; y++) {
+            for (int z = a.z; z <= b.z; z++) {
+                auto it = g_engine.spatialGrid.find(spatialKey(glm::ivec3(x, y, z)));
+                if (it == g_engine.spatialGrid.end()) {
+                    continue;
+                }
+                for (const SpatialEntry& entry : it->second) {
+                    fn(entry);
+                }
+            }
+        }
+    }
+}
+
+// Copies up to capacity matches into out and returns the number of matches
+static int writeSpatialResults(const std::vector<flecs::entity_t>& found, EntityID* out, uint32_t capacity) {
+    if (out) {
+        size_t n = std::min<size_t>(found.size(), capacity);
+        for (size_t i = 0; i < n; i++) {
+            out[i] = found[i];
+        }
+    }
+    return static_cast<int>(found.size());
+}
+
+int boulder_set_spatial_cell_size(float size) {
+    NATIVE_TRY
+    if (size <= 0.0f) {
+        return -1;
+    }
+
+    g_engine.spatialCellSize = size;
+    g_engine.spatialDirty = true;
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_set_layers(EntityID entity, uint32_t layers) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    e.set<SpatialLayers>({layers});
+    g_engine.spatialDirty = true;
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+uint32_t boulder_get_layers(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return 0;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const SpatialLayers* layers = e.get<SpatialLayers>();
+    return layers ? layers->mask : SPATIAL_DEFAULT_LAYERS;
+    NATIVE_CATCH(0)
+}
+
+int boulder_add_tag(EntityID entity, const char* tag) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !tag) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    Tags* tags = e.get_mut<Tags>();
+    if (!tags) {
+        e.set<Tags>({{tag}});
+        return 0;
+    }
+    if (std::find(tags->names.begin(), tags->names.end(), tag) == tags->names.end()) {
+        tags->names.push_back(tag);
+    }
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_remove_tag(EntityID entity, const char* tag) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !tag) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    Tags* tags = e.get_mut<Tags>();
+    if (tags) {
+        tags->names.erase(std::remove(tags->names.begin(), tags->names.end(), tag), tags->names.end());
+    }
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+uint32_t boulder_get_tags(EntityID entity, char* buffer, uint32_t capacity) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return copyString("", buffer, capacity);
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const Tags* tags = e.get<Tags>();
+    std::string joined;
+    if (tags) {
+        for (const std::string& name : tags->names) {
+            if (!joined.empty()) {
+                joined += '\n';
+            }
+            joined += name;
+        }
+    }
+    return copyString(joined.c_str(), buffer, capacity);
+    NATIVE_CATCH(0)
+}
+
+int boulder_has_tag(EntityID entity, const char* tag) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !tag) {
+        return 0;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const Tags* tags = e.get<Tags>();
+    if (!tags) {
+        return 0;
+    }
+    return std::find(tags->names.begin(), tags->names.end(), tag) != tags->names.end() ? 1 : 0;
+    NATIVE_CATCH(0)
+}
+
+int boulder_overlap_sphere(float cx, float cy, float cz, float radius, uint32_t layerMask,
+                           EntityID* entities, uint32_t capacity) {
+    NATIVE_TRY
+    if (!g_engine.ecs || radius < 0.0f) {
+        return -1;
+    }
+
+    glm::vec3 center(cx, cy, cz);
+    std::vector<flecs::entity_t> found;
+    forEachSpatialEntry(center - glm::vec3(radius), center + glm::vec3(radius), [&](const SpatialEntry& entry) {
+        glm::vec3 d = entry.position - center;
+        if ((entry.layers & layerMask) && glm::dot(d, d) <= radius * radius) {
+            found.push_back(entry.entity);
+        }
+    });
+
+    return writeSpatialResults(found, entities, capacity);
+    NATIVE_CATCH(-1)
+}
+
+int boulder_overlap_box(float cx, float cy, float cz, float hx, float hy, float hz,
+                        float rx, float ry, float rz, uint32_t layerMask,
+                        EntityID* entities, uint32_t capacity) {
+    NATIVE_TRY
+    if (!g_engine.ecs || hx < 0.0f || hy < 0.0f || hz < 0.0f) {
+        return -1;
+    }
+
+    glm::mat3 axes = rotationAxes(eulerToQuat(glm::vec3(rx, ry, rz)));
+    glm::mat3 inverse = glm::transpose(axes);
+
+    glm::vec3 center(cx, cy, cz);
+    glm::vec3 halfExtents(hx, hy, hz);
+    glm::vec3 reach = glm::abs(axes[0]) * hx + glm::abs(axes[1]) * hy + glm::abs(axes[2]) * hz;
+
+    std::vector<flecs::entity_t> found;
+    forEachSpatialEntry(center - reach, center + reach, [&](const SpatialEntry& entry) {
+        glm::vec3 local = glm::abs(inverse * (entry.position - center));
+        if ((entry.layers & layerMask) && glm::all(glm::lessThanEqual(local, halfExtents))) {
+            found.push_back(entry.entity);
+        }
+    });
+
+    return writeSpatialResults(found, entities, capacity);
+    NATIVE_CATCH(-1)
+}
+
+int boulder_find_nearest(float x, float y, float z, const char* tag, float maxDistance, EntityID* entity) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !entity) {
+        return -1;
+    }
+
+    glm::vec3 position(x, y, z);
+    float reach = maxDistance > 0.0f ? maxDistance : std::numeric_limits<float>::max();
+    float best = reach * reach;
+    flecs::entity_t nearest = 0;
+
+    auto visit = [&](const SpatialEntry& entry) {
+        glm::vec3 d = entry.position - position;
+        float distance = glm::dot(d, d);
+        if (distance > best || (nearest && distance == best)) {
+            return;
+        }
+        if (tag && tag[0] && !boulder_has_tag(entry.entity, tag)) {
+            return;
+        }
+        best = distance;
+        nearest = entry.entity;
+    };
+
+    if (maxDistance > 0.0f) {
+        forEachSpatialEntry(position - glm::vec3(maxDistance), position + glm::vec3(maxDistance), visit);
+    } else {
+        rebuildSpatialIndex();
+        for (const auto& [key, entries] : g_engine.spatialGrid) {
+            for (const SpatialEntry& entry : entries) {
+                visit(entry);
+            }
+        }
+    }
+
+    if (!nearest) {
+        return -1;
+    }
+    *entity = nearest;
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_apply_force(EntityID entity, float fx, float fy, float fz) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    PhysicsBody* pb = e.get_mut<PhysicsBody>();
+    if (!pb) {
+        missingComponent(e.id(), "physics body");
+        return -1;
+    }
+
+    glm::vec3 force(fx, fy, fz);
+    pb->acceleration += force / pb->mass;
+    markChanged(e.id(), COMPONENT_PHYSICS_BODY);
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+// Sets an entity's collider, replacing any it had. Colliders are placed by the transform.
+static int setCollider(EntityID entity, Collider collider, float friction, float restitution) {
+    if (!g_engine.ecs || friction < 0.0f || restitution < 0.0f) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    if (!e.has<Transform>()) {
+        return -1;
+    }
+    collider.friction = friction;
+    collider.restitution = std::min(restitution, 1.0f);
+    e.set<Collider>(std::move(collider));
+    return 0;
+}
+
+int boulder_add_box_collider(EntityID entity, float hx, float hy, float hz, float friction, float restitution) {
+    NATIVE_TRY
+    if (hx <= 0.0f || hy <= 0.0f || hz <= 0.0f) {
+        return -1;
+    }
+
+    Collider collider;
+    collider.shape = COLLIDER_BOX;
+    collider.halfExtents = glm::vec3(hx, hy, hz);
+    return setCollider(entity, std::move(collider), friction, restitution);
+    NATIVE_CATCH(-1)
+}
+
+int boulder_add_sphere_collider(EntityID entity, float radius, float friction, float restitution) {
+    NATIVE_TRY
+    if (radius <= 0.0f) {
+        return -1;
+    }
+
+    Collider collider;
+    collider.shape = COLLIDER_SPHERE;
+    collider.radius = radius;
+    return setCollider(entity, std::move(collider), friction, restitution);
+    NATIVE_CATCH(-1)
+}
+
+int boulder_add_capsule_collider(EntityID entity, float radius, float halfHeight, float friction, float restitution) {
+    NATIVE_TRY
+    if (radius <= 0.0f || halfHeight < 0.0f) {
+        return -1;
+    }
+
+    Collider collider;
+    collider.shape = COLLIDER_CAPSULE;
+    collider.radius = radius;
+    collider.halfHeight = halfHeight;
+    return setCollider(entity, std::move(collider), friction, restitution);
+    NATIVE_CATCH(-1)
+}
+
+int boulder_add_mesh_collider(EntityID entity, float friction, float restitution) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const Model* model = e.get<Model>();
+    if (!model) {
+        fail(ERROR_INVALID_ARGUMENT, "Mesh collider needs a loaded model");
+        return -1;
+    }
+
+    Collider collider;
+    collider.shape = COLLIDER_MESH;
+    for (const auto& mesh : model->meshes) {
+        for (size_t i = 0; i + 2 < mesh.indices.size(); i += 3) {
+            glm::vec3 a = mesh.vertices[mesh.indices[i]].position;
+            glm::vec3 b = mesh.vertices[mesh.indices[i + 1]].position;
+            glm::vec3 c = mesh.vertices[mesh.indices[i + 2]].position;
+            // Degenerate triangles have no normal to push along
+            if (glm::dot(glm::cross(b - a, c - a), glm::cross(b - a, c - a)) > 1e-12f) {
+                collider.triangles.insert(collider.triangles.end(), {a, b, c});
+            }
+        }
+    }
+    if (collider.triangles.empty()) {
+        return -1;
+    }
+    return setCollider(entity, std::move(collider), friction, restitution);
+    NATIVE_CATCH(-1)
+}
+
+int boulder_remove_collider(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    e.remove<Collider>();
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_set_collider_trigger(EntityID entity, int trigger) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    Collider* collider = e.get_mut<Collider>();
+    if (!collider) {
+        missingComponent(entity, "collider");
+        return -1;
+    }
+    if (collider->trigger == (trigger != 0)) {
+        return 0;
+    }
+    collider->trigger = trigger != 0;
+
+    // Contacts of the old kind end now; the next step starts them again as the new kind
+    for (auto it = g_engine.contacts.begin(); it != g_engine.contacts.end();) {
+        if (it->first.first != e.id() && it->first.second != e.id()) {
+            ++it;
+            continue;
+        }
+        if (g_engine.collisionEventsWatched) {
+            int kind = it->second.trigger ? COLLISION_EVENT_TRIGGER_EXIT : COLLISION_EVENT_EXIT;
+            g_engine.collisionEvents.push_back(collisionEvent(kind, it->first, it->second));
+        }
+        it = g_engine.contacts.erase(it);
+    }
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_is_collider_trigger(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    const Collider* collider = g_engine.ecs->entity(entity).get<Collider>();
+    if (!collider) {
+        return -1;
+    }
+    return collider->trigger ? 1 : 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_collider(EntityID entity, float* size, float* friction, float* restitution) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !size || !friction || !restitution) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const Collider* collider = e.get<Collider>();
+    if (!collider) {
+        return -1;
+    }
+
+    switch (collider->shape) {
+        case COLLIDER_BOX:
+            size[0] = collider->halfExtents.x;
+            size[1] = collider->halfExtents.y;
+            size[2] = collider->halfExtents.z;
+            break;
+        case COLLIDER_CAPSULE:
+            size[0] = collider->radius;
+            size[1] = collider->halfHeight;
+            size[2] = 0.0f;
+            break;
+        default:
+            size[0] = collider->radius;
+            size[1] = size[2] = 0.0f;
+            break;
+    }
+    *friction = collider->friction;
+    *restitution = collider->restitution;
+    return collider->shape;
+    NATIVE_CATCH(-1)
+}
+
+// World snapshot layout: header followed by one fixed-size record per entity, sorted by
+// entity ID so identical worlds produce identical bytes
+constexpr uint32_t SNAPSHOT_MAGIC = 0x504E5342; // "BSNP"
+constexpr uint32_t SNAPSHOT_VERSION = 1;
+constexpr uint32_t SNAPSHOT_HAS_TRANSFORM = 1u << 0;
+constexpr uint32_t SNAPSHOT_HAS_PHYSICS = 1u << 1;
+
+struct SnapshotHeader {
+    uint32_t magic;
+    uint32_t version;
+    uint32_t count;
+};
+
+struct SnapshotRecord {
+    uint64_t entity;
+    uint32_t flags;
+    float transform[9];  // position, Euler rotation, scale
+    float physics[7];    // mass, velocity, acceleration
+};
+
+static std::vector<flecs::entity_t> snapshotEntities() {
+    std::vector<flecs::entity_t> entities;
+    g_engine.ecs->query<Transform>().each([&entities](flecs::entity e, Transform&) {
+        entities.push_back(e.id());
+    });
+    g_engine.ecs->query<PhysicsBody>().each([&entities](flecs::entity e, PhysicsBody&) {
+        entities.push_back(e.id());
+    });
+    std::sort(entities.begin(), entities.end());
+    entities.erase(std::unique(entities.begin(), entities.end()), entities.end());
+    return entities;
+}
+
+uint32_t boulder_world_snapshot_size() {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return 0;
+    }
+
+    return sizeof(SnapshotHeader) + snapshotEntities().size() * sizeof(SnapshotRecord);
+    NATIVE_CATCH(0)
+}
+
+int boulder_world_save_snapshot(void* buffer, uint32_t size, uint32_t* written) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !buffer) {
+        return -1;
+    }
+
+    std::vector<flecs::entity_t> entities = snapshotEntities();
+    size_t required = sizeof(SnapshotHeader) + entities.size() * sizeof(SnapshotRecord);
+    if (size < required) {
+        return -1;
+    }
+
+    auto* out = static_cast<uint8_t*>(buffer);
+    SnapshotHeader header = {SNAPSHOT_MAGIC, SNAPSHOT_VERSION, static_cast<uint32_t>(entities.size())};
+    memcpy(out, &header, sizeof(header));
+    out += sizeof(header);
+
+    for (flecs::entity_t id : entities) {
+        flecs::entity e = g_engine.ecs->entity(id);
+        SnapshotRecord record = {};
+        record.entity = id;
+
+        if (const Transform* t = e.get<Transform>()) {
+            record.flags |= SNAPSHOT_HAS_TRANSFORM;
+            memcpy(&record.transform[0], &t->position, sizeof(float) * 3);
+            glm::vec3 euler = quatToEuler(t->rotation);
+            memcpy(&record.transform[3], &euler, sizeof(float) * 3);
+            memcpy(&record.transform[6], &t->scale, sizeof(float) * 3);
+        }
+        if (const PhysicsBody* pb = e.get<PhysicsBody>()) {
+            record.flags |= SNAPSHOT_HAS_PHYSICS;
+            record.physics[0] = pb->mass;
+            memcpy(&record.physics[1], &pb->velocity, sizeof(float) * 3);
+            memcpy(&record.physics[4], &pb->acceleration, sizeof(float) * 3);
+        }
+
+        memcpy(out, &record, sizeof(record));
+        out += sizeof(record);
+    }
+
+    if (written) {
+        *written = static_cast<uint32_t>(required);
+    }
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_world_load_snapshot(const void* buffer, uint32_t size) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !buffer || size < sizeof(SnapshotHeader)) {
+        return -1;
+    }
+
+    const auto* in = static_cast<const uint8_t*>(buffer);
+    SnapshotHeader header;
+    memcpy(&header, in, sizeof(header));
+    if (header.magic != SNAPSHOT_MAGIC || header.version != SNAPSHOT_VERSION ||
+        size < sizeof(SnapshotHeader) + static_cast<size_t>(header.count) * sizeof(SnapshotRecord)) {
+        fail(ERROR_INVALID_DATA, "Invalid world snapshot");
+        return -1;
+    }
+    in += sizeof(header);
+
+    for (uint32_t i = 0; i < header.count; i++) {
+        SnapshotRecord record;
+        memcpy(&record, in, sizeof(record));
+        in += sizeof(record);
+
+        flecs::entity e = g_engine.ecs->entity(record.entity);
+        if (!e.is_alive()) {
+            continue;
+        }
+
+        if (record.flags & SNAPSHOT_HAS_TRANSFORM) {
+            Transform t;
+            memcpy(&t.position, &record.transform[0], sizeof(float) * 3);
+            glm::vec3 euler;
+            memcpy(&euler, &record.transform[3], sizeof(float) * 3);
+            t.rotation = eulerToQuat(euler);
+            memcpy(&t.scale, &record.transform[6], sizeof(float) * 3);
+            e.set<Transform>(t);
+        } else {
+            e.remove<Transform>();
+        }
+
+        if (record.flags & SNAPSHOT_HAS_PHYSICS) {
+            PhysicsBody pb;
+            pb.mass = record.physics[0];
+            memcpy(&pb.velocity, &record.physics[1], sizeof(float) * 3);
+            memcpy(&pb.acceleration, &record.physics[4], sizeof(float) * 3);
+            e.set<PhysicsBody>(pb);
+        } else {
+            e.remove<PhysicsBody>();
+        }
+    }
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+// Extracts the meshes of an imported scene, uploads them and attaches them to an entity
+static int attachModel(EntityID entity, const aiScene* scene, const char* path) {
+    if (!scene || scene->mFlags & AI_SCENE_FLAGS_INCOMPLETE || !scene->mRootNode) {
+        fail(ERROR_FILE, "Failed to load model: {}", g_engine.importer->GetErrorString());
+        return -1;
+    }
+
+    // Process all meshes in the scene
+    Model model;
+    model.path = std::string(path);
+    model.scene = scene;
+    if (scene->mNumAnimations > 0) {
+        SkeletonImport import;
+        collectSkeletonNodes(scene->mRootNode, -1, import);
+        collectAnimationClips(scene, import);
+        processNode(scene->mRootNode, scene, model.meshes, &import);
+        model.skeleton = std::move(import.skeleton);
+    } else {
+        processNode(scene->mRootNode, scene, model.meshes);
+    }
+    collectBoneBoxes(scene, model.bones);
+    model.fileMaterials = collectMaterials(scene);
+    for (const ModelFileMaterial& fileMaterial : model.fileMaterials->materials) {
+        Material material;
+        writeStandardParams(material, fileMaterial.values);
+        model.materials.push_back(material);
+    }
+
+    Logger::get().info("✓ Model loaded: {} meshes extracted, {} bones, {} animations, {} materials",
+                       model.meshes.size(), model.bones.size(), model.skeleton ? model.skeleton->clips.size() : 0,
+                       model.materials.size());
+
+    // Debug: Print mesh statistics
+    for (size_t i = 0; i < model.meshes.size(); i++) {
+        const auto& mesh = model.meshes[i];
+        Logger::get().info("  Mesh {}: {} vertices, {} indices",
+                          i, mesh.vertices.size(), mesh.indexCount);
+
+        // Debug: Print first few indices to verify they're in range
+        if (mesh.indices.size() >= 10) {
+            Logger::get().info("    First 10 indices: {} {} {} {} {} {} {} {} {} {}",
+                              mesh.indices[0], mesh.indices[1], mesh.indices[2],
+                              mesh.indices[3], mesh.indices[4], mesh.indices[5],
+                              mesh.indices[6], mesh.indices[7], mesh.indices[8],
+                              mesh.indices[9]);
+        } else if (!mesh.indices.empty()) {
+            Logger::get().info("    All {} indices loaded", mesh.indices.size());
+        }
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    e.set<Model>(std::move(model));
+
+    // Ensure buffer writes are visible to GPU before rendering
+    // Even with HOST_COHERENT memory, we need an execution dependency
+    vkDeviceWaitIdle(g_engine.device);
+
+    Logger::get().info("Model buffers synchronized with GPU");
+
+    return 0;
+}
+
+int boulder_load_model(EntityID entity, const char* path) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !g_engine.importer || !path) {
+        fail(ERROR_INVALID_ARGUMENT, "Invalid parameters for loading model");
+        return -1;
+    }
+
+    if (!g_engine.device) {
+        fail(ERROR_NOT_INITIALIZED, "Cannot load model: Vulkan device not initialized");
+        return -1;
+    }
+
+    Logger::get().info("Loading model: {}", path);
+
+    const aiScene* scene = g_engine.importer->ReadFile(path,
+        aiProcess_Triangulate |
+        aiProcess_FlipUVs |
+        aiProcess_JoinIdenticalVertices);
+
+    return attachModel(entity, scene, path);
+    NATIVE_CATCH(-1)
+}
+
+int boulder_load_model_from_memory(EntityID entity, const void* data, uint32_t size, const char* name) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !g_engine.importer || !data || size == 0 || !name) {
+        fail(ERROR_INVALID_ARGUMENT, "Invalid parameters for loading model");
+        return -1;
+    }
+
+    if (!g_engine.device) {
+        fail(ERROR_NOT_INITIALIZED, "Cannot load model: Vulkan device not initialized");
+        return -1;
+    }
+
+    // Assimp picks the importer from the file extension hint
+    const char* extension = strrchr(name, '.');
+    const aiScene* scene = g_engine.importer->ReadFileFromMemory(data, size,
+        aiProcess_Triangulate |
+        aiProcess_FlipUVs |
+        aiProcess_JoinIdenticalVertices,
+        extension ? extension + 1 : "");
+
+    return attachModel(entity, scene, name);
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_model_bone_count(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const Model* model = e.get<Model>();
+    return model ? static_cast<int>(model->bones.size()) : -1;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_model_bone_box(EntityID entity, int index, char* name, uint32_t nameSize, float* min, float* max) {
+    NATIVE_TRY
+    if (!g_engine.ecs || index < 0 || !name || nameSize == 0 || !min || !max) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const Model* model = e.get<Model>();
+    if (!model || index >= static_cast<int>(model->bones.size())) {
+        return -1;
+    }
+
+    const BoneBox& box = model->bones[index];
+    snprintf(name, nameSize, "%s", box.name.c_str());
+    memcpy(min, &box.min, sizeof(float) * 3);
+    memcpy(max, &box.max, sizeof(float) * 3);
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+// Returns the entity's model if it has animations
+static Model* animatedModel(EntityID entity) {
+    flecs::entity e = g_engine.ecs->entity(entity);
+    Model* model = e.get_mut<Model>();
+    return model && model->skeleton ? model : nullptr;
+}
+
+// Switches a model to a clip (-1 for the bind pose), crossfading from the current pose over
+// fadeSeconds. A crossfade started during another fades from the clip that was fading in.
+static void startAnimation(Model& model, int clip, float fadeSeconds, bool loop) {
+    AnimationState& state = model.animation;
+    if (fadeSeconds > 0.0f && state.clip != clip) {
+        state.previousClip = state.clip;
+        state.previousTime = state.time;
+        state.previousLoop = state.loop;
+        state.fade = 0.0f;
+        state.fadeDuration = fadeSeconds;
+    } else {
+        state.previousClip = -1;
+        state.fadeDuration = 0.0f;
+    }
+
+    // Clips played backwards start from their end
+    state.clip = clip;
+    state.time = clip >= 0 && state.speed < 0.0f ? model.skeleton->clips[clip].duration : 0.0f;
+    state.loop = loop;
+    state.paused = false;
+    state.dirty = true;
+}
+
+int boulder_get_animation_count(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
+
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const Model* model = e.get<Model>();
+    if (!model) {
+        missingComponent(e.id(), "model");
+        return -1;
+    }
+    return model->skeleton ? static_cast<int>(model->skeleton->clips.size()) : 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_animation_info(EntityID entity, int index, char* name, uint32_t nameSize, float* duration) {
+    NATIVE_TRY
+    if (!g_engine.ecs || index < 0 || !name || nameSize == 0 || !duration) {
+        return -1;
+    }
+
+    const Model* model = animatedModel(entity);
+    if (!model || index >= static_cast<int>(model->skeleton->clips.size())) {
+        return -1;
+    }
+
+    const AnimationClip& clip = model->skeleton->clips[index];
+    snprintf(name, nameSize, "%s", clip.name.c_str());
+    *duration = clip.duration;
+    return 0;
+    NATIVE_CATCH(-1)
 }
 
-// Helper function to copy data to a buffer
-static void copyDataToBuffer(VkDeviceMemory bufferMemory, const void* data, size_t size) {
-    void* mapped;
-    vkMapMemory(g_engine.device, bufferMemory, 0, size, 0, &mapped);
-    memcpy(mapped, data, size);
-    vkUnmapMemory(g_engine.device, bufferMemory);
-}
+int boulder_play_animation(EntityID entity, const char* name, float fadeSeconds, int loop) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !name) {
+        return -1;
+    }
 
-// Helper function to process a single Assimp mesh
-static Mesh processMesh(aiMesh* mesh) {
-    Mesh result;
+    Model* model = animatedModel(entity);
+    if (!model) {
+        return -1;
+    }
 
-    // Extract vertices
-    for (uint32_t i = 0; i < mesh->mNumVertices; i++) {
-        Vertex vertex;
+    const auto& clips = model->skeleton->clips;
+    auto it = std::find_if(clips.begin(), clips.end(), [name](const AnimationClip& clip) { return clip.name == name; });
+    if (it == clips.end()) {
+        fail(ERROR_NOT_FOUND, "Model {} has no animation named {}", model->path, name);
+        return -1;
+    }
 
-        // Position
-        vertex.position = glm::vec3(
-            mesh->mVertices[i].x,
-            mesh->mVertices[i].y,
-            mesh->mVertices[i].z
-        );
+    startAnimation(*model, static_cast<int>(it - clips.begin()), fadeSeconds, loop != 0);
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-        // Normal
-        if (mesh->HasNormals()) {
-            vertex.normal = glm::vec3(
-                mesh->mNormals[i].x,
-                mesh->mNormals[i].y,
-                mesh->mNormals[i].z
-            );
-        } else {
-            vertex.normal = glm::vec3(0.0f, 1.0f, 0.0f);
-        }
+int boulder_stop_animation(EntityID entity, float fadeSeconds) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
 
-        // Texture coordinates
-        if (mesh->mTextureCoords[0]) {
-            vertex.texCoord = glm::vec2(
-                mesh->mTextureCoords[0][i].x,
-                mesh->mTextureCoords[0][i].y
-            );
-        } else {
-            vertex.texCoord = glm::vec2(0.0f, 0.0f);
-        }
+    Model* model = animatedModel(entity);
+    if (!model) {
+        return -1;
+    }
 
-        result.vertices.push_back(vertex);
+    startAnimation(*model, -1, fadeSeconds, true);
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_set_animation_paused(EntityID entity, int paused) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
     }
 
-    // Extract indices
-    for (uint32_t i = 0; i < mesh->mNumFaces; i++) {
-        aiFace face = mesh->mFaces[i];
-        for (uint32_t j = 0; j < face.mNumIndices; j++) {
-            result.indices.push_back(face.mIndices[j]);
-        }
+    Model* model = animatedModel(entity);
+    if (!model) {
+        return -1;
     }
 
-    result.indexCount = static_cast<uint32_t>(result.indices.size());
+    model->animation.paused = paused != 0;
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    // Create GPU storage buffers for mesh shaders
-    // NOTE: Mesh shaders read from STORAGE_BUFFER, NOT VERTEX_BUFFER
-    if (!result.vertices.empty()) {
-        VkDeviceSize vertexBufferSize = sizeof(Vertex) * result.vertices.size();
-        createBuffer(vertexBufferSize,
-                    VK_BUFFER_USAGE_STORAGE_BUFFER_BIT,
-                    VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT | VK_MEMORY_PROPERTY_HOST_COHERENT_BIT,
-                    result.vertexBuffer, result.vertexBufferMemory);
+int boulder_set_animation_speed(EntityID entity, float speed) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !std::isfinite(speed)) {
+        return -1;
+    }
 
-        copyDataToBuffer(result.vertexBufferMemory, result.vertices.data(), vertexBufferSize);
+    Model* model = animatedModel(entity);
+    if (!model) {
+        return -1;
     }
 
-    if (!result.indices.empty()) {
-        VkDeviceSize indexBufferSize = sizeof(uint32_t) * result.indices.size();
-        createBuffer(indexBufferSize,
-                    VK_BUFFER_USAGE_STORAGE_BUFFER_BIT,
-                    VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT | VK_MEMORY_PROPERTY_HOST_COHERENT_BIT,
-                    result.indexBuffer, result.indexBufferMemory);
+    model->animation.speed = speed;
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-        copyDataToBuffer(result.indexBufferMemory, result.indices.data(), indexBufferSize);
+int boulder_set_animation_time(EntityID entity, float time) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !std::isfinite(time)) {
+        return -1;
     }
 
-    // Create draw params buffer (indexCount, instanceCount)
-    struct DrawParams {
-        uint32_t indexCount;
-        uint32_t instanceCount;
-    };
-    DrawParams drawParams{result.indexCount, 1};
+    Model* model = animatedModel(entity);
+    if (!model || model->animation.clip < 0) {
+        return -1;
+    }
 
-    VkDeviceSize drawParamsSize = sizeof(DrawParams);
-    createBuffer(drawParamsSize,
-                VK_BUFFER_USAGE_STORAGE_BUFFER_BIT,
-                VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT | VK_MEMORY_PROPERTY_HOST_COHERENT_BIT,
-                result.drawParamsBuffer, result.drawParamsBufferMemory);
+    AnimationState& state = model->animation;
+    state.time = advanceClipTime(*model->skeleton, state.clip, 0.0f, time, state.loop);
+    state.dirty = true;
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    copyDataToBuffer(result.drawParamsBufferMemory, &drawParams, drawParamsSize);
+int boulder_get_animation_state(EntityID entity, int* clip, float* time, float* speed, int* paused) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !clip || !time || !speed || !paused) {
+        return -1;
+    }
 
-    Logger::get().info("Processed mesh: {} vertices, {} indices", result.vertices.size(), result.indices.size());
+    const Model* model = animatedModel(entity);
+    if (!model) {
+        return -1;
+    }
 
-    return result;
+    const AnimationState& state = model->animation;
+    *clip = state.clip;
+    *time = state.time;
+    *speed = state.speed;
+    *paused = state.paused ? 1 : 0;
+    return 0;
+    NATIVE_CATCH(-1)
 }
 
-// Helper function to recursively process Assimp nodes
-static void processNode(aiNode* node, const aiScene* scene, std::vector<Mesh>& meshes) {
-    // Process all the node's meshes
-    for (uint32_t i = 0; i < node->mNumMeshes; i++) {
-        aiMesh* mesh = scene->mMeshes[node->mMeshes[i]];
-        meshes.push_back(processMesh(mesh));
+int boulder_get_model_mesh_count(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
     }
 
-    // Process children
-    for (uint32_t i = 0; i < node->mNumChildren; i++) {
-        processNode(node->mChildren[i], scene, meshes);
-    }
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const Model* model = e.get<Model>();
+    return model ? static_cast<int>(model->meshes.size()) : -1;
+    NATIVE_CATCH(-1)
 }
 
-// Helper function to create depth buffer resources
-static int createDepthResources() {
-    // Create depth image
-    VkImageCreateInfo imageInfo{};
-    imageInfo.sType = VK_STRUCTURE_TYPE_IMAGE_CREATE_INFO;
-    imageInfo.imageType = VK_IMAGE_TYPE_2D;
-    imageInfo.extent.width = g_engine.swapchainExtent.width;
-    imageInfo.extent.height = g_engine.swapchainExtent.height;
-    imageInfo.extent.depth = 1;
-    imageInfo.mipLevels = 1;
-    imageInfo.arrayLayers = 1;
-    imageInfo.format = g_engine.depthFormat;
-    imageInfo.tiling = VK_IMAGE_TILING_OPTIMAL;
-    imageInfo.initialLayout = VK_IMAGE_LAYOUT_UNDEFINED;
-    imageInfo.usage = VK_IMAGE_USAGE_DEPTH_STENCIL_ATTACHMENT_BIT;
-    imageInfo.samples = VK_SAMPLE_COUNT_1_BIT;
-    imageInfo.sharingMode = VK_SHARING_MODE_EXCLUSIVE;
+int boulder_copy_mesh(EntityID source, int meshIndex, EntityID target, float* cx, float* cy, float* cz) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !g_engine.device || meshIndex < 0 || !cx || !cy || !cz) {
+        return -1;
+    }
 
-    if (vkCreateImage(g_engine.device, &imageInfo, nullptr, &g_engine.depthImage) != VK_SUCCESS) {
-        Logger::get().error("Failed to create depth image");
+    flecs::entity src = g_engine.ecs->entity(source);
+    const Model* sourceModel = src.get<Model>();
+    if (!sourceModel || meshIndex >= static_cast<int>(sourceModel->meshes.size())) {
         return -1;
     }
 
-    // Allocate memory for depth image
-    VkMemoryRequirements memRequirements;
-    vkGetImageMemoryRequirements(g_engine.device, g_engine.depthImage, &memRequirements);
+    const Mesh& original = sourceModel->meshes[meshIndex];
+    if (original.vertices.empty()) {
+        return -1;
+    }
 
-    VkMemoryAllocateInfo allocInfo{};
-    allocInfo.sType = VK_STRUCTURE_TYPE_MEMORY_ALLOCATE_INFO;
-    allocInfo.allocationSize = memRequirements.size;
-    allocInfo.memoryTypeIndex = findMemoryType(memRequirements.memoryTypeBits, VK_MEMORY_PROPERTY_DEVICE_LOCAL_BIT);
+    // Recenter the piece on its own centroid so it rotates around itself once detached
+    glm::vec3 center(0.0f);
+    for (const auto& v : original.vertices) {
+        center += v.position;
+    }
+    center /= static_cast<float>(original.vertices.size());
 
-    if (vkAllocateMemory(g_engine.device, &allocInfo, nullptr, &g_engine.depthImageMemory) != VK_SUCCESS) {
-        Logger::get().error("Failed to allocate depth image memory");
-        vkDestroyImage(g_engine.device, g_engine.depthImage, nullptr);
-        g_engine.depthImage = nullptr;
-        return -1;
+    Mesh mesh;
+    mesh.vertices = original.vertices;
+    for (auto& v : mesh.vertices) {
+        v.position -= center;
     }
+    mesh.indices = original.indices;
+    mesh.indexCount = original.indexCount;
+    mesh.material = original.material;
+    createMeshBuffers(mesh);
 
-    vkBindImageMemory(g_engine.device, g_engine.depthImage, g_engine.depthImageMemory, 0);
+    Model model;
+    model.path = sourceModel->path;
+    model.scene = nullptr;
+    model.meshes.push_back(std::move(mesh));
+    model.fileMaterials = sourceModel->fileMaterials;
+    model.materials = sourceModel->materials;
+
+    flecs::entity dst = g_engine.ecs->entity(target);
+    dst.set<Model>(std::move(model));
+
+    *cx = center.x;
+    *cy = center.y;
+    *cz = center.z;
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    // Create depth image view
-    VkImageViewCreateInfo viewInfo{};
-    viewInfo.sType = VK_STRUCTURE_TYPE_IMAGE_VIEW_CREATE_INFO;
-    viewInfo.image = g_engine.depthImage;
-    viewInfo.viewType = VK_IMAGE_VIEW_TYPE_2D;
-    viewInfo.format = g_engine.depthFormat;
-    viewInfo.subresourceRange.aspectMask = VK_IMAGE_ASPECT_DEPTH_BIT;
-    viewInfo.subresourceRange.baseMipLevel = 0;
-    viewInfo.subresourceRange.levelCount = 1;
-    viewInfo.subresourceRange.baseArrayLayer = 0;
-    viewInfo.subresourceRange.layerCount = 1;
+int boulder_set_model_visible(EntityID entity, int visible) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
 
-    if (vkCreateImageView(g_engine.device, &viewInfo, nullptr, &g_engine.depthImageView) != VK_SUCCESS) {
-        Logger::get().error("Failed to create depth image view");
-        vkFreeMemory(g_engine.device, g_engine.depthImageMemory, nullptr);
-        vkDestroyImage(g_engine.device, g_engine.depthImage, nullptr);
-        g_engine.depthImage = nullptr;
-        g_engine.depthImageMemory = nullptr;
+    flecs::entity e = g_engine.ecs->entity(entity);
+    Model* model = e.get_mut<Model>();
+    if (!model) {
+        missingComponent(e.id(), "model");
         return -1;
     }
 
+    model->visible = visible != 0;
+    markChanged(e.id(), COMPONENT_MODEL);
     return 0;
+    NATIVE_CATCH(-1)
 }
 
-// Helper function to destroy depth buffer resources
-static void destroyDepthResources() {
-    if (g_engine.depthImageView) {
-        vkDestroyImageView(g_engine.device, g_engine.depthImageView, nullptr);
-        g_engine.depthImageView = nullptr;
+int boulder_create_mesh(EntityID entity, const void* vertices, uint32_t vertexCount,
+                        const uint32_t* indices, uint32_t indexCount, int dynamic) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !vertices || vertexCount == 0 || !indices || indexCount == 0 || indexCount % 3 != 0) {
+        fail(ERROR_INVALID_ARGUMENT, "Invalid parameters for creating mesh");
+        return -1;
     }
-    if (g_engine.depthImage) {
-        vkDestroyImage(g_engine.device, g_engine.depthImage, nullptr);
-        g_engine.depthImage = nullptr;
+
+    if (!g_engine.device) {
+        fail(ERROR_NOT_INITIALIZED, "Cannot create mesh: Vulkan device not initialized");
+        return -1;
     }
-    if (g_engine.depthImageMemory) {
-        vkFreeMemory(g_engine.device, g_engine.depthImageMemory, nullptr);
-        g_engine.depthImageMemory = nullptr;
+
+    for (uint32_t i = 0; i < indexCount; i++) {
+        if (indices[i] >= vertexCount) {
+            fail(ERROR_INVALID_ARGUMENT, "Mesh index {} out of range ({} vertices)", indices[i], vertexCount);
+            return -1;
+        }
     }
+
+    Mesh mesh;
+    mesh.dynamic = dynamic != 0;
+    mesh.vertices.resize(vertexCount);
+    memcpy(mesh.vertices.data(), vertices, sizeof(Vertex) * vertexCount);
+    mesh.indices.assign(indices, indices + indexCount);
+    mesh.indexCount = indexCount;
+    createMeshBuffers(mesh);
+
+    // Meshes are added to the entity's model, creating one if needed
+    flecs::entity e = g_engine.ecs->entity(entity);
+    Model* model = e.get_mut<Model>();
+    if (!model) {
+        Model created;
+        created.scene = nullptr;
+        created.meshes.push_back(std::move(mesh));
+        e.set<Model>(std::move(created));
+        return 0;
+    }
+
+    model->meshes.push_back(std::move(mesh));
+    markChanged(e.id(), COMPONENT_MODEL);
+    return static_cast<int>(model->meshes.size()) - 1;
+    NATIVE_CATCH(-1)
 }
 
-// Helper function to recreate swapchain
-static int recreate_swapchain() {
+int boulder_update_mesh_vertices(EntityID entity, int meshIndex, uint32_t offset, const void* vertices, uint32_t count) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !vertices || meshIndex < 0) {
+        return -1;
+    }
 
-    if (!g_engine.device || !g_engine.window || !g_engine.physicalDevice || !g_engine.surface) {
+    flecs::entity e = g_engine.ecs->entity(entity);
+    Model* model = e.get_mut<Model>();
+    if (!model || meshIndex >= static_cast<int>(model->meshes.size())) {
         return -1;
     }
 
-    // Prevent re-entry
-    if (g_engine.isRecreatingSwapchain) {
-        Logger::get().error("recreate_swapchain is already recreating swapchain! Aborting...");
+    Mesh& mesh = model->meshes[meshIndex];
+    if (!mesh.dynamic) {
+        fail(ERROR_INVALID_ARGUMENT, "Cannot update vertices of a static mesh");
+        return -1;
+    }
+    if (offset > mesh.vertices.size() || count > mesh.vertices.size() - offset) {
+        return -1;
+    }
+    if (count == 0) {
         return 0;
     }
-    g_engine.isRecreatingSwapchain = true;
-    g_engine.resizeEventDuringRecreate = false;
 
-    // Wait for ALL device operations to complete (including presentation engine)
-    // This ensures semaphores are no longer in use before we destroy them
-    vkDeviceWaitIdle(g_engine.device);
+    memcpy(&mesh.vertices[offset], vertices, sizeof(Vertex) * count);
+    markChanged(e.id(), COMPONENT_MODEL);
+    markVerticesDirty(mesh, offset, count);
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    // Clean up old swapchain resources
-    for (auto imageView : g_engine.swapchainImageViews) {
-        vkDestroyImageView(g_engine.device, imageView, nullptr);
+int boulder_get_mesh_vertex_count(EntityID entity, int meshIndex) {
+    NATIVE_TRY
+    if (!g_engine.ecs || meshIndex < 0) {
+        return -1;
     }
-    g_engine.swapchainImageViews.clear();
-
-    // Clean up old depth resources
-    destroyDepthResources();
 
-    // Clean up old per-frame-in-flight semaphores
-    for (size_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
-        vkDestroySemaphore(g_engine.device, g_engine.imageAvailableSemaphores[i], nullptr);
-        vkDestroySemaphore(g_engine.device, g_engine.renderFinishedSemaphores[i], nullptr);
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const Model* model = e.get<Model>();
+    if (!model || meshIndex >= static_cast<int>(model->meshes.size())) {
+        return -1;
     }
+    return static_cast<int>(model->meshes[meshIndex].vertices.size());
+    NATIVE_CATCH(-1)
+}
 
-    VkSwapchainKHR oldSwapchain = g_engine.swapchain;
+static int floorDiv(int value, int divisor) {
+    return value >= 0 ? value / divisor : -((-value + divisor - 1) / divisor);
+}
 
-    // Get current window size
-    int width, height;
-    SDL_GetWindowSize(g_engine.window, &width, &height);
+static uint64_t voxelChunkKey(int cx, int cy, int cz) {
+    return (static_cast<uint64_t>(cx & 0x1FFFFF) << 42) |
+           (static_cast<uint64_t>(cy & 0x1FFFFF) << 21) |
+           static_cast<uint64_t>(cz & 0x1FFFFF);
+}
 
-    // Handle minimization (width/height = 0) - just skip recreation
-    if (width == 0 || height == 0) {
-        Logger::get().info("Window minimized, skipping swapchain recreation");
-        g_engine.isRecreatingSwapchain = false;
+static glm::ivec3 voxelChunkCoords(uint64_t key) {
+    // Sign extend the 21 bit fields
+    auto field = [key](int shift) {
+        int value = static_cast<int>((key >> shift) & 0x1FFFFF);
+        return value >= 0x100000 ? value - 0x200000 : value;
+    };
+    return glm::ivec3(field(42), field(21), field(0));
+}
+
+static int voxelIndex(int x, int y, int z) {
+    return x + VOXEL_CHUNK_SIZE * (y + VOXEL_CHUNK_SIZE * z);
+}
+
+static uint16_t getVoxel(const VoxelWorld& world, int x, int y, int z) {
+    auto it = world.chunks.find(voxelChunkKey(floorDiv(x, VOXEL_CHUNK_SIZE), floorDiv(y, VOXEL_CHUNK_SIZE),
+                                              floorDiv(z, VOXEL_CHUNK_SIZE)));
+    if (it == world.chunks.end()) {
         return 0;
     }
+    int lx = x - floorDiv(x, VOXEL_CHUNK_SIZE) * VOXEL_CHUNK_SIZE;
+    int ly = y - floorDiv(y, VOXEL_CHUNK_SIZE) * VOXEL_CHUNK_SIZE;
+    int lz = z - floorDiv(z, VOXEL_CHUNK_SIZE) * VOXEL_CHUNK_SIZE;
+    return it->second.blocks[voxelIndex(lx, ly, lz)];
+}
 
-    Logger::get().info("Recreating swapchain with size: {}x{}", width, height);
+static const VoxelBlockType& voxelType(const VoxelWorld& world, uint16_t block) {
+    return block < world.types.size() ? world.types[block] : world.types[0];
+}
 
-    // Get surface capabilities
-    VkSurfaceCapabilitiesKHR capabilities;
-    vkGetPhysicalDeviceSurfaceCapabilitiesKHR(g_engine.physicalDevice, g_engine.surface, &capabilities);
+// Marks a chunk, and the neighbours sharing the changed block's faces, for remeshing
+static void markVoxelDirty(VoxelWorld& world, int x, int y, int z) {
+    glm::ivec3 chunk(floorDiv(x, VOXEL_CHUNK_SIZE), floorDiv(y, VOXEL_CHUNK_SIZE), floorDiv(z, VOXEL_CHUNK_SIZE));
+    glm::ivec3 local = glm::ivec3(x, y, z) - chunk * VOXEL_CHUNK_SIZE;
 
-    // Update swapchain extent
-    g_engine.swapchainExtent = capabilities.currentExtent;
-    if (g_engine.swapchainExtent.width == UINT32_MAX) {
-        g_engine.swapchainExtent.width = std::clamp(static_cast<uint32_t>(width),
-                                                     capabilities.minImageExtent.width,
-                                                     capabilities.maxImageExtent.width);
-        g_engine.swapchainExtent.height = std::clamp(static_cast<uint32_t>(height),
-                                                      capabilities.minImageExtent.height,
-                                                      capabilities.maxImageExtent.height);
+    auto mark = [&world](glm::ivec3 c) {
+        auto it = world.chunks.find(voxelChunkKey(c.x, c.y, c.z));
+        if (it != world.chunks.end()) {
+            it->second.dirty = true;
+        }
+    };
+    mark(chunk);
+    for (int axis = 0; axis < 3; axis++) {
+        glm::ivec3 offset(0);
+        if (local[axis] == 0) {
+            offset[axis] = -1;
+            mark(chunk + offset);
+        } else if (local[axis] == VOXEL_CHUNK_SIZE - 1) {
+            offset[axis] = 1;
+            mark(chunk + offset);
+        }
     }
+}
 
-    uint32_t imageCount = capabilities.minImageCount + 1;
-    if (capabilities.maxImageCount > 0 && imageCount > capabilities.maxImageCount) {
-        imageCount = capabilities.maxImageCount;
+static bool setVoxel(VoxelWorld& world, int x, int y, int z, uint16_t block) {
+    int cx = floorDiv(x, VOXEL_CHUNK_SIZE), cy = floorDiv(y, VOXEL_CHUNK_SIZE), cz = floorDiv(z, VOXEL_CHUNK_SIZE);
+    uint64_t key = voxelChunkKey(cx, cy, cz);
+    auto it = world.chunks.find(key);
+    if (it == world.chunks.end()) {
+        if (block == 0) {
+            return false;
+        }
+        it = world.chunks.emplace(key, VoxelChunk{}).first;
     }
 
-    // Query available present modes (same as initial swapchain creation)
-    uint32_t presentModeCount;
-    vkGetPhysicalDeviceSurfacePresentModesKHR(g_engine.physicalDevice, g_engine.surface, &presentModeCount, nullptr);
-    std::vector<VkPresentModeKHR> presentModes(presentModeCount);
-    vkGetPhysicalDeviceSurfacePresentModesKHR(g_engine.physicalDevice, g_engine.surface, &presentModeCount, presentModes.data());
+    uint16_t& current = it->second.blocks[voxelIndex(x - cx * VOXEL_CHUNK_SIZE, y - cy * VOXEL_CHUNK_SIZE,
+                                                     z - cz * VOXEL_CHUNK_SIZE)];
+    if (current == block) {
+        return false;
+    }
+    it->second.filled += (block != 0) - (current != 0);
+    current = block;
+    markVoxelDirty(world, x, y, z);
+    return true;
+}
 
-    // Prefer Immediate (uncapped framerate) for maximum performance, fallback to FIFO (guaranteed support)
-    VkPresentModeKHR presentMode = VK_PRESENT_MODE_FIFO_KHR;
-    for (const auto& mode : presentModes) {
-        if (mode == VK_PRESENT_MODE_IMMEDIATE_KHR) {
-            presentMode = VK_PRESENT_MODE_IMMEDIATE_KHR;
-            Logger::get().info("Using Immediate present mode (uncapped framerate)");
-            break;
+// Greedy meshes one chunk: faces of the same material in a slice are merged into quads.
+// Positions are relative to the chunk origin; texCoord is the position on the quad in
+// blocks, with the material added to y in steps of VOXEL_MATERIAL_STRIDE.
+static void meshVoxelChunk(const VoxelWorld& world, const VoxelChunk& chunk, glm::ivec3 chunkCoords,
+                           std::vector<Vertex>& vertices, std::vector<uint32_t>& indices) {
+    const int n = VOXEL_CHUNK_SIZE;
+    glm::ivec3 origin = chunkCoords * n;
+    std::vector<int> mask(n * n);
+
+    auto block = [&](glm::ivec3 p) -> uint16_t {
+        if (p.x >= 0 && p.y >= 0 && p.z >= 0 && p.x < n && p.y < n && p.z < n) {
+            return chunk.blocks[voxelIndex(p.x, p.y, p.z)];
         }
-    }
-    if (presentMode == VK_PRESENT_MODE_FIFO_KHR) {
-        Logger::get().info("Using FIFO present mode (vsync fallback)");
-    }
+        return getVoxel(world, origin.x + p.x, origin.y + p.y, origin.z + p.z);
+    };
 
-    VkSwapchainCreateInfoKHR swapchainInfo{};
-    swapchainInfo.sType = VK_STRUCTURE_TYPE_SWAPCHAIN_CREATE_INFO_KHR;
-    swapchainInfo.surface = g_engine.surface;
-    swapchainInfo.minImageCount = imageCount;
-    swapchainInfo.imageFormat = g_engine.swapchainFormat;
-    swapchainInfo.imageColorSpace = VK_COLOR_SPACE_SRGB_NONLINEAR_KHR;
-    swapchainInfo.imageExtent = g_engine.swapchainExtent;
-    swapchainInfo.imageArrayLayers = 1;
-    swapchainInfo.imageUsage = VK_IMAGE_USAGE_COLOR_ATTACHMENT_BIT;
-    swapchainInfo.imageSharingMode = VK_SHARING_MODE_EXCLUSIVE;
-    swapchainInfo.preTransform = capabilities.currentTransform;
-    swapchainInfo.compositeAlpha = VK_COMPOSITE_ALPHA_OPAQUE_BIT_KHR;
-    swapchainInfo.presentMode = presentMode;
-    swapchainInfo.clipped = VK_TRUE;
-    swapchainInfo.oldSwapchain = oldSwapchain;
+    for (int d = 0; d < 3; d++) {
+        int u = (d + 1) % 3, v = (d + 2) % 3;
+        for (int dir = -1; dir <= 1; dir += 2) {
+            glm::ivec3 step(0);
+            step[d] = dir;
+
+            for (int slice = 0; slice < n; slice++) {
+                // Faces of this chunk's blocks in the slice that face dir
+                for (int j = 0; j < n; j++) {
+                    for (int i = 0; i < n; i++) {
+                        glm::ivec3 p;
+                        p[d] = slice;
+                        p[u] = i;
+                        p[v] = j;
+                        uint16_t a = chunk.blocks[voxelIndex(p.x, p.y, p.z)];
+                        uint16_t b = block(p + step);
+                        const VoxelBlockType& bt = voxelType(world, b);
+
+                        int entry = 0;
+                        if (a != 0 && b != a && !bt.opaque) {
+                            const VoxelBlockType& at = voxelType(world, a);
+                            uint16_t material = d != 1 ? at.side : dir > 0 ? at.top : at.bottom;
+                            entry = material + 1;
+                        }
+                        mask[i + j * n] = entry;
+                    }
+                }
 
-    if (vkCreateSwapchainKHR(g_engine.device, &swapchainInfo, nullptr, &g_engine.swapchain) != VK_SUCCESS) {
-        Logger::get().error("Failed to recreate swapchain");
-        g_engine.isRecreatingSwapchain = false;
-        return -1;
+                // Merge runs of equal faces into rectangles
+                for (int j = 0; j < n; j++) {
+                    for (int i = 0; i < n;) {
+                        int entry = mask[i + j * n];
+                        if (entry == 0) {
+                            i++;
+                            continue;
+                        }
+
+                        int w = 1;
+                        while (i + w < n && mask[i + w + j * n] == entry) {
+                            w++;
+                        }
+                        int h = 1;
+                        for (; j + h < n; h++) {
+                            bool row = true;
+                            for (int k = 0; k < w && row; k++) {
+                                row = mask[i + k + (j + h) * n] == entry;
+                            }
+                            if (!row) {
+                                break;
+                            }
+                        }
+
+                        glm::vec3 base(0.0f), du(0.0f), dv(0.0f), normal(0.0f);
+                        base[d] = static_cast<float>(slice + (dir > 0 ? 1 : 0));
+                        base[u] = static_cast<float>(i);
+                        base[v] = static_cast<float>(j);
+                        du[u] = static_cast<float>(w);
+                        dv[v] = static_cast<float>(h);
+                        normal[d] = static_cast<float>(dir);
+
+                        float layer = (entry - 1) * VOXEL_MATERIAL_STRIDE;
+                        uint32_t first = static_cast<uint32_t>(vertices.size());
+                        vertices.push_back({base * world.blockSize, normal, glm::vec2(0.0f, layer)});
+                        vertices.push_back({(base + du) * world.blockSize, normal, glm::vec2(w, layer)});
+                        vertices.push_back({(base + du + dv) * world.blockSize, normal, glm::vec2(w, layer + h)});
+                        vertices.push_back({(base + dv) * world.blockSize, normal, glm::vec2(0.0f, layer + h)});
+
+                        // Counter-clockwise seen from the side the face points to
+                        if (dir > 0) {
+                            indices.insert(indices.end(), {first, first + 1, first + 2, first, first + 2, first + 3});
+                        } else {
+                            indices.insert(indices.end(), {first, first + 2, first + 1, first, first + 3, first + 2});
+                        }
+
+                        for (int y = 0; y < h; y++) {
+                            std::fill_n(mask.begin() + i + (j + y) * n, w, 0);
+                        }
+                        i += w;
+                    }
+                }
+            }
+        }
     }
+}
 
-    // Destroy old swapchain
-    if (oldSwapchain) {
-        vkDestroySwapchainKHR(g_engine.device, oldSwapchain, nullptr);
-    }
+// Merges a chunk's solid blocks into as few boxes as possible
+static void buildVoxelCollision(const VoxelWorld& world, VoxelChunk& chunk, glm::ivec3 chunkCoords) {
+    const int n = VOXEL_CHUNK_SIZE;
+    chunk.collision.clear();
+    std::vector<bool> done(VOXEL_CHUNK_VOLUME, false);
 
-    // Get new swapchain images
-    vkGetSwapchainImagesKHR(g_engine.device, g_engine.swapchain, &imageCount, nullptr);
-    g_engine.swapchainImages.resize(imageCount);
-    vkGetSwapchainImagesKHR(g_engine.device, g_engine.swapchain, &imageCount, g_engine.swapchainImages.data());
+    auto solid = [&](int x, int y, int z) {
+        int index = voxelIndex(x, y, z);
+        return !done[index] && voxelType(world, chunk.blocks[index]).solid && chunk.blocks[index] != 0;
+    };
 
-    // Reset per-image fence tracking (no frame is using any image after recreation)
-    // Use assign() to clear ALL elements, not just resize which keeps old values if size unchanged
-    g_engine.imagesInFlight.assign(imageCount, VK_NULL_HANDLE);
+    for (int z = 0; z < n; z++) {
+        for (int y = 0; y < n; y++) {
+            for (int x = 0; x < n; x++) {
+                if (!solid(x, y, z)) {
+                    continue;
+                }
 
-    // Recreate image views
-    g_engine.swapchainImageViews.resize(imageCount);
-    for (size_t i = 0; i < imageCount; i++) {
-        VkImageViewCreateInfo viewInfo{};
-        viewInfo.sType = VK_STRUCTURE_TYPE_IMAGE_VIEW_CREATE_INFO;
-        viewInfo.image = g_engine.swapchainImages[i];
-        viewInfo.viewType = VK_IMAGE_VIEW_TYPE_2D;
-        viewInfo.format = g_engine.swapchainFormat;
-        viewInfo.components.r = VK_COMPONENT_SWIZZLE_IDENTITY;
-        viewInfo.components.g = VK_COMPONENT_SWIZZLE_IDENTITY;
-        viewInfo.components.b = VK_COMPONENT_SWIZZLE_IDENTITY;
-        viewInfo.components.a = VK_COMPONENT_SWIZZLE_IDENTITY;
-        viewInfo.subresourceRange.aspectMask = VK_IMAGE_ASPECT_COLOR_BIT;
-        viewInfo.subresourceRange.baseMipLevel = 0;
-        viewInfo.subresourceRange.levelCount = 1;
-        viewInfo.subresourceRange.baseArrayLayer = 0;
-        viewInfo.subresourceRange.layerCount = 1;
+                int x1 = x + 1;
+                while (x1 < n && solid(x1, y, z)) {
+                    x1++;
+                }
+                int y1 = y + 1;
+                for (; y1 < n; y1++) {
+                    bool row = true;
+                    for (int i = x; i < x1 && row; i++) {
+                        row = solid(i, y1, z);
+                    }
+                    if (!row) {
+                        break;
+                    }
+                }
+                int z1 = z + 1;
+                for (; z1 < n; z1++) {
+                    bool layer = true;
+                    for (int j = y; j < y1 && layer; j++) {
+                        for (int i = x; i < x1 && layer; i++) {
+                            layer = solid(i, j, z1);
+                        }
+                    }
+                    if (!layer) {
+                        break;
+                    }
+                }
 
-        if (vkCreateImageView(g_engine.device, &viewInfo, nullptr, &g_engine.swapchainImageViews[i]) != VK_SUCCESS) {
-            Logger::get().error("Failed to recreate image view");
-            g_engine.isRecreatingSwapchain = false;
-            return -1;
+                for (int k = z; k < z1; k++) {
+                    for (int j = y; j < y1; j++) {
+                        for (int i = x; i < x1; i++) {
+                            done[voxelIndex(i, j, k)] = true;
+                        }
+                    }
+                }
+                glm::ivec3 origin = chunkCoords * n;
+                chunk.collision.push_back(origin + glm::ivec3(x, y, z));
+                chunk.collision.push_back(origin + glm::ivec3(x1, y1, z1));
+            }
         }
     }
+}
 
-    // Recreate depth resources
-    if (createDepthResources() != 0) {
-        Logger::get().error("Failed to recreate depth resources");
-        g_engine.isRecreatingSwapchain = false;
-        return -1;
+static VoxelWorld* getVoxelWorld(EntityID entity) {
+    if (!g_engine.ecs) {
+        return nullptr;
     }
+    return g_engine.ecs->entity(entity).get_mut<VoxelWorld>();
+}
 
-    // Recreate per-frame-in-flight semaphores (both imageAvailable and renderFinished)
-    VkSemaphoreCreateInfo semaphoreInfo{};
-    semaphoreInfo.sType = VK_STRUCTURE_TYPE_SEMAPHORE_CREATE_INFO;
+static glm::vec3 voxelWorldOrigin(EntityID entity) {
+    const Transform* t = g_engine.ecs->entity(entity).get<Transform>();
+    return t ? t->position : glm::vec3(0.0f);
+}
 
-    for (size_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
-        if (vkCreateSemaphore(g_engine.device, &semaphoreInfo, nullptr, &g_engine.imageAvailableSemaphores[i]) != VK_SUCCESS ||
-            vkCreateSemaphore(g_engine.device, &semaphoreInfo, nullptr, &g_engine.renderFinishedSemaphores[i]) != VK_SUCCESS) {
-            Logger::get().error("Failed to recreate semaphores for frame {}", i);
-            g_engine.isRecreatingSwapchain = false;
-            return -1;
-        }
+int boulder_add_voxel_world(EntityID entity, float blockSize) {
+    NATIVE_TRY
+    if (!g_engine.ecs || blockSize <= 0.0f) {
+        return -1;
     }
 
-    // Reset frame index to start fresh
-    g_engine.currentFrameIndex = 0;
-
-    // After vkDeviceWaitIdle, all fences are signaled but we need them in a known state
-    // Since we're resetting currentFrameIndex to 0, we should ensure fence[0] will work correctly
-    // Actually, let's leave fences as-is (signaled) and let normal flow handle them
+    VoxelWorld world;
+    world.blockSize = blockSize;
+    g_engine.ecs->entity(entity).set<VoxelWorld>(std::move(world));
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    // Command buffers are per-frame-in-flight (MAX_FRAMES_IN_FLIGHT), not per-image, so no recreation needed
+int boulder_set_voxel_block_type(EntityID entity, int block, int solid, int opaque,
+                                 int topMaterial, int sideMaterial, int bottomMaterial) {
+    NATIVE_TRY
+    VoxelWorld* world = getVoxelWorld(entity);
+    if (!world || block <= 0 || block > 0xFFFF) {
+        return -1;
+    }
 
-    Logger::get().info("Swapchain recreated successfully! Frame index reset to 0");
+    if (static_cast<size_t>(block) >= world->types.size()) {
+        world->types.resize(block + 1);
+    }
+    world->types[block] = {solid != 0, opaque != 0, static_cast<uint16_t>(topMaterial),
+                           static_cast<uint16_t>(sideMaterial), static_cast<uint16_t>(bottomMaterial)};
 
-    vkGetPhysicalDeviceSurfaceCapabilitiesKHR(g_engine.physicalDevice, g_engine.surface, &capabilities);
+    // Appearance may have changed everywhere
+    for (auto& [key, chunk] : world->chunks) {
+        chunk.dirty = true;
+    }
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    if (g_engine.swapchainExtent.height != capabilities.currentExtent.height || g_engine.swapchainExtent.width != capabilities.currentExtent.width){
-        g_engine.resizeEventDuringRecreate = true;
+int boulder_set_voxel(EntityID entity, int x, int y, int z, int block) {
+    NATIVE_TRY
+    VoxelWorld* world = getVoxelWorld(entity);
+    if (!world || block < 0 || block > 0xFFFF) {
+        return -1;
     }
 
-    // Only clear the recreate flag if no resize event happened during recreation
-    if (!g_engine.resizeEventDuringRecreate) {
-        g_engine.swapchainNeedsRecreate = false;
-    } else {
-        Logger::get().info("Resize event occurred during recreation, will recreate again");
-        g_engine.resizeEventDuringRecreate = false;
+    setVoxel(*world, x, y, z, static_cast<uint16_t>(block));
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_voxel(EntityID entity, int x, int y, int z) {
+    NATIVE_TRY
+    VoxelWorld* world = getVoxelWorld(entity);
+    if (!world) {
+        return -1;
     }
+    return getVoxel(*world, x, y, z);
+    NATIVE_CATCH(-1)
+}
 
-    g_engine.isRecreatingSwapchain = false;
+int boulder_fill_voxels(EntityID entity, int x0, int y0, int z0, int x1, int y1, int z1, int block) {
+    NATIVE_TRY
+    VoxelWorld* world = getVoxelWorld(entity);
+    if (!world || block < 0 || block > 0xFFFF) {
+        return -1;
+    }
 
+    for (int z = std::min(z0, z1); z <= std::max(z0, z1); z++) {
+        for (int y = std::min(y0, y1); y <= std::max(y0, y1); y++) {
+            for (int x = std::min(x0, x1); x <= std::max(x0, x1); x++) {
+                setVoxel(*world, x, y, z, static_cast<uint16_t>(block));
+            }
+        }
+    }
     return 0;
+    NATIVE_CATCH(-1)
 }
 
-// Render all models with the Model component
-void boulder_render_models() {
-    if (!g_engine.initialized || !g_engine.activeCommandBuffer || !g_engine.modelPipeline || !g_engine.ecs) {
-        return;
+int boulder_update_voxel_world(EntityID entity, int maxChunks) {
+    NATIVE_TRY
+    VoxelWorld* world = getVoxelWorld(entity);
+    if (!world || !g_engine.device) {
+        return -1;
     }
 
-    vkCmdBindPipeline(g_engine.activeCommandBuffer, VK_PIPELINE_BIND_POINT_GRAPHICS, g_engine.modelPipeline);
+    flecs::entity owner = g_engine.ecs->entity(entity);
+    glm::vec3 origin = voxelWorldOrigin(entity);
+    float chunkExtent = VOXEL_CHUNK_SIZE * world->blockSize;
 
-    // Ensure all storage buffer writes are visible to mesh shader reads
-    VkMemoryBarrier memoryBarrier{};
-    memoryBarrier.sType = VK_STRUCTURE_TYPE_MEMORY_BARRIER;
-    memoryBarrier.srcAccessMask = VK_ACCESS_HOST_WRITE_BIT | VK_ACCESS_TRANSFER_WRITE_BIT;
-    memoryBarrier.dstAccessMask = VK_ACCESS_SHADER_READ_BIT;
+    std::vector<uint64_t> dirty;
+    for (auto& [key, chunk] : world->chunks) {
+        if (chunk.dirty && (maxChunks <= 0 || static_cast<int>(dirty.size()) < maxChunks)) {
+            dirty.push_back(key);
+        }
+    }
 
-    vkCmdPipelineBarrier(
-        g_engine.activeCommandBuffer,
-        VK_PIPELINE_STAGE_HOST_BIT | VK_PIPELINE_STAGE_TRANSFER_BIT,
-        VK_PIPELINE_STAGE_MESH_SHADER_BIT_EXT,
-        0,
-        1, &memoryBarrier,
-        0, nullptr,
-        0, nullptr
-    );
+    // Old chunk buffers may still be drawn by frames in flight
+    bool waited = false;
+    for (uint64_t key : dirty) {
+        VoxelChunk& chunk = world->chunks[key];
+        glm::ivec3 coords = voxelChunkCoords(key);
+        chunk.dirty = false;
 
-    // Set dynamic viewport and scissor
-    boulder_set_viewport(0.0f, 0.0f, (float)g_engine.swapchainExtent.width, (float)g_engine.swapchainExtent.height, 0.0f, 1.0f);
-    boulder_set_scissor(0, 0, g_engine.swapchainExtent.width, g_engine.swapchainExtent.height);
+        Mesh mesh;
+        if (chunk.filled > 0) {
+            meshVoxelChunk(*world, chunk, coords, mesh.vertices, mesh.indices);
+        }
+        buildVoxelCollision(*world, chunk, coords);
 
-    // Set up view-projection matrix
-    float aspect = (float)g_engine.swapchainExtent.width / (float)g_engine.swapchainExtent.height;
-    glm::mat4 proj = glm::perspective(glm::radians(45.0f), aspect, 0.1f, 100.0f);
-    proj[1][1] *= -1; // Flip Y for Vulkan
-
-    glm::mat4 view = glm::lookAt(
-        glm::vec3(2.0f, 2.0f, 2.0f),
-        glm::vec3(0.0f, 0.0f, 0.0f),
-        glm::vec3(0.0f, 1.0f, 0.0f)
-    );
+        flecs::entity chunkEntity;
+        if (chunk.meshEntity && g_engine.ecs->is_alive(chunk.meshEntity)) {
+            chunkEntity = g_engine.ecs->entity(chunk.meshEntity);
+        }
+        if (chunkEntity.id() != 0) {
+            if (Model* old = chunkEntity.get_mut<Model>()) {
+                if (!waited) {
+                    vkDeviceWaitIdle(g_engine.device);
+                    waited = true;
+                }
+                for (auto& m : old->meshes) {
+                    destroyMeshBuffers(m);
+                }
+                chunkEntity.remove<Model>();
+            }
+        }
 
-    glm::mat4 viewProj = proj * view;
+        if (mesh.indices.empty()) {
+            continue;
+        }
+        if (chunkEntity.id() == 0) {
+            chunkEntity = g_engine.ecs->entity().child_of(owner);
+            chunk.meshEntity = chunkEntity.id();
+        }
 
-    // Query all entities with Model and Transform components
-    auto query = g_engine.ecs->query_builder<const Model, const Transform>().build();
+        mesh.indexCount = static_cast<uint32_t>(mesh.indices.size());
+        createMeshBuffers(mesh);
+        Model model;
+        model.scene = nullptr;
+        model.meshes.push_back(std::move(mesh));
+        chunkEntity.set<Model>(std::move(model));
+    }
 
-    static bool logged = false;
-    int entityCount = 0;
+    // Chunks follow the world entity's position
+    for (auto& [key, chunk] : world->chunks) {
+        if (!chunk.meshEntity || !g_engine.ecs->is_alive(chunk.meshEntity)) {
+            continue;
+        }
+        glm::vec3 position = origin + glm::vec3(voxelChunkCoords(key)) * chunkExtent;
+        flecs::entity chunkEntity = g_engine.ecs->entity(chunk.meshEntity);
+        const Transform* t = chunkEntity.get<Transform>();
+        if (!t || t->position != position) {
+            chunkEntity.set<Transform>({position, glm::quat(1.0f, 0.0f, 0.0f, 0.0f), glm::vec3(1.0f)});
+        }
+    }
 
-    query.each([&](flecs::entity e, const Model& model, const Transform& transform) {
-        entityCount++;
-        // Build model matrix from transform
-        glm::mat4 modelMatrix = glm::mat4(1.0f);
-        modelMatrix = glm::translate(modelMatrix, transform.position);
-        modelMatrix = glm::rotate(modelMatrix, transform.rotation.x, glm::vec3(1, 0, 0));
-        modelMatrix = glm::rotate(modelMatrix, transform.rotation.y, glm::vec3(0, 1, 0));
-        modelMatrix = glm::rotate(modelMatrix, transform.rotation.z, glm::vec3(0, 0, 1));
-        modelMatrix = glm::scale(modelMatrix, transform.scale);
+    return static_cast<int>(dirty.size());
+    NATIVE_CATCH(-1)
+}
 
-        // Render each mesh in the model
-        int meshIndex = 0;
-        for (const auto& mesh : model.meshes) {
-            if (!logged) {
-                Logger::get().info("Processing mesh {}: vbuf={:x} ibuf={:x} indices={}",
-                                  meshIndex, (uint64_t)mesh.vertexBuffer, (uint64_t)mesh.indexBuffer, mesh.indexCount);
-            }
+int boulder_get_voxel_chunk_count(EntityID entity) {
+    NATIVE_TRY
+    VoxelWorld* world = getVoxelWorld(entity);
+    return world ? static_cast<int>(world->chunks.size()) : -1;
+    NATIVE_CATCH(-1)
+}
 
-            if (mesh.vertexBuffer == VK_NULL_HANDLE || mesh.indexBuffer == VK_NULL_HANDLE) {
-                if (!logged) {
-                    Logger::get().error("Skipping mesh {} - null buffers!", meshIndex);
-                }
-                meshIndex++;
-                continue;
-            }
+int boulder_get_voxel_chunks(EntityID entity, int* coords, uint32_t capacity) {
+    NATIVE_TRY
+    VoxelWorld* world = getVoxelWorld(entity);
+    if (!world) {
+        return -1;
+    }
 
-            // Allocate descriptor set for this mesh from current frame's pool
-            VkDescriptorSetAllocateInfo allocInfo{};
-            allocInfo.sType = VK_STRUCTURE_TYPE_DESCRIPTOR_SET_ALLOCATE_INFO;
-            allocInfo.descriptorPool = g_engine.modelDescriptorPools[g_engine.currentFrameIndex];
-            allocInfo.descriptorSetCount = 1;
-            allocInfo.pSetLayouts = &g_engine.modelDescriptorSetLayout;
+    uint32_t i = 0;
+    for (auto& [key, chunk] : world->chunks) {
+        if (coords && i < capacity) {
+            glm::ivec3 c = voxelChunkCoords(key);
+            coords[i * 3 + 0] = c.x;
+            coords[i * 3 + 1] = c.y;
+            coords[i * 3 + 2] = c.z;
+        }
+        i++;
+    }
+    return static_cast<int>(i);
+    NATIVE_CATCH(-1)
+}
 
-            VkDescriptorSet descriptorSet;
-            if (vkAllocateDescriptorSets(g_engine.device, &allocInfo, &descriptorSet) != VK_SUCCESS) {
-                Logger::get().error("Failed to allocate descriptor set for model mesh");
-                continue;
-            }
+int boulder_get_voxel_collision_boxes(EntityID entity, int cx, int cy, int cz, float* boxes, uint32_t capacity) {
+    NATIVE_TRY
+    VoxelWorld* world = getVoxelWorld(entity);
+    if (!world) {
+        return -1;
+    }
 
-            // Update descriptor set with storage buffer bindings
-            VkDescriptorBufferInfo vertexBufferInfo{};
-            vertexBufferInfo.buffer = mesh.vertexBuffer;
-            vertexBufferInfo.offset = 0;
-            vertexBufferInfo.range = VK_WHOLE_SIZE;
+    auto it = world->chunks.find(voxelChunkKey(cx, cy, cz));
+    if (it == world->chunks.end()) {
+        return 0;
+    }
 
-            VkDescriptorBufferInfo indexBufferInfo{};
-            indexBufferInfo.buffer = mesh.indexBuffer;
-            indexBufferInfo.offset = 0;
-            indexBufferInfo.range = VK_WHOLE_SIZE;
+    glm::vec3 origin = voxelWorldOrigin(entity);
+    const auto& collision = it->second.collision;
+    uint32_t count = static_cast<uint32_t>(collision.size() / 2);
+    for (uint32_t i = 0; boxes && i < count && i < capacity; i++) {
+        glm::vec3 lo = origin + glm::vec3(collision[i * 2]) * world->blockSize;
+        glm::vec3 hi = origin + glm::vec3(collision[i * 2 + 1]) * world->blockSize;
+        memcpy(&boxes[i * 6], &lo, sizeof(float) * 3);
+        memcpy(&boxes[i * 6 + 3], &hi, sizeof(float) * 3);
+    }
+    return static_cast<int>(count);
+    NATIVE_CATCH(-1)
+}
 
-            VkDescriptorBufferInfo drawParamsInfo{};
-            drawParamsInfo.buffer = mesh.drawParamsBuffer;
-            drawParamsInfo.offset = 0;
-            drawParamsInfo.range = VK_WHOLE_SIZE;
+int boulder_voxel_raycast(EntityID entity, float ox, float oy, float oz, float dx, float dy, float dz,
+                          float maxDistance, int* block, float* normal, float* distance) {
+    NATIVE_TRY
+    VoxelWorld* world = getVoxelWorld(entity);
+    if (!world || !block || !normal || !distance || !(maxDistance > 0.0f) || std::isinf(maxDistance)) {
+        return -1;
+    }
 
-            VkWriteDescriptorSet descriptorWrites[3] = {};
+    glm::vec3 direction(dx, dy, dz);
+    float length = glm::length(direction);
+    if (length <= 0.0f) {
+        return -1;
+    }
+    direction /= length;
+
+    // Walk the grid in block units (Amanatides and Woo)
+    glm::vec3 start = (glm::vec3(ox, oy, oz) - voxelWorldOrigin(entity)) / world->blockSize;
+    float reach = maxDistance / world->blockSize;
+    glm::ivec3 cell(glm::floor(start));
+    glm::ivec3 step;
+    glm::vec3 next, delta;
+    for (int i = 0; i < 3; i++) {
+        step[i] = direction[i] > 0 ? 1 : -1;
+        delta[i] = direction[i] != 0 ? std::abs(1.0f / direction[i]) : std::numeric_limits<float>::max();
+        float boundary = direction[i] > 0 ? cell[i] + 1.0f : static_cast<float>(cell[i]);
+        next[i] = direction[i] != 0 ? (boundary - start[i]) / direction[i] : std::numeric_limits<float>::max();
+    }
+
+    float travelled = 0.0f;
+    glm::vec3 hitNormal(0.0f);
+    while (travelled <= reach) {
+        uint16_t b = getVoxel(*world, cell.x, cell.y, cell.z);
+        if (b != 0 && voxelType(*world, b).solid) {
+            memcpy(block, &cell, sizeof(int) * 3);
+            memcpy(normal, &hitNormal, sizeof(float) * 3);
+            *distance = travelled * world->blockSize;
+            return 0;
+        }
 
-            descriptorWrites[0].sType = VK_STRUCTURE_TYPE_WRITE_DESCRIPTOR_SET;
-            descriptorWrites[0].dstSet = descriptorSet;
-            descriptorWrites[0].dstBinding = 0;
-            descriptorWrites[0].dstArrayElement = 0;
-            descriptorWrites[0].descriptorType = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
-            descriptorWrites[0].descriptorCount = 1;
-            descriptorWrites[0].pBufferInfo = &vertexBufferInfo;
+        int axis = next.x < next.y ? (next.x < next.z ? 0 : 2) : (next.y < next.z ? 1 : 2);
+        travelled = next[axis];
+        next[axis] += delta[axis];
+        cell[axis] += step[axis];
+        hitNormal = glm::vec3(0.0f);
+        hitNormal[axis] = static_cast<float>(-step[axis]);
+    }
+    return -1;
+    NATIVE_CATCH(-1)
+}
 
-            descriptorWrites[1].sType = VK_STRUCTURE_TYPE_WRITE_DESCRIPTOR_SET;
-            descriptorWrites[1].dstSet = descriptorSet;
-            descriptorWrites[1].dstBinding = 1;
-            descriptorWrites[1].dstArrayElement = 0;
-            descriptorWrites[1].descriptorType = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
-            descriptorWrites[1].descriptorCount = 1;
-            descriptorWrites[1].pBufferInfo = &indexBufferInfo;
+int boulder_save_voxel_chunk(EntityID entity, int cx, int cy, int cz, void* buffer, uint32_t size, uint32_t* written) {
+    NATIVE_TRY
+    VoxelWorld* world = getVoxelWorld(entity);
+    if (!world || !written) {
+        return -1;
+    }
 
-            descriptorWrites[2].sType = VK_STRUCTURE_TYPE_WRITE_DESCRIPTOR_SET;
-            descriptorWrites[2].dstSet = descriptorSet;
-            descriptorWrites[2].dstBinding = 2;
-            descriptorWrites[2].dstArrayElement = 0;
-            descriptorWrites[2].descriptorType = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
-            descriptorWrites[2].descriptorCount = 1;
-            descriptorWrites[2].pBufferInfo = &drawParamsInfo;
+    auto it = world->chunks.find(voxelChunkKey(cx, cy, cz));
+    if (it == world->chunks.end()) {
+        return -1;
+    }
 
-            vkUpdateDescriptorSets(g_engine.device, 3, descriptorWrites, 0, nullptr);
+    // Run-length encoded blocks: (block, count) pairs of uint16
+    std::vector<uint16_t> runs;
+    const auto& blocks = it->second.blocks;
+    for (int i = 0; i < VOXEL_CHUNK_VOLUME;) {
+        int run = 1;
+        while (i + run < VOXEL_CHUNK_VOLUME && blocks[i + run] == blocks[i] && run < 0xFFFF) {
+            run++;
+        }
+        runs.push_back(blocks[i]);
+        runs.push_back(static_cast<uint16_t>(run));
+        i += run;
+    }
 
-            // Bind descriptor set
-            vkCmdBindDescriptorSets(g_engine.activeCommandBuffer, VK_PIPELINE_BIND_POINT_GRAPHICS,
-                                   g_engine.modelPipelineLayout, 0, 1, &descriptorSet, 0, nullptr);
+    uint32_t header[3] = {VOXEL_CHUNK_MAGIC, VOXEL_CHUNK_VERSION, static_cast<uint32_t>(runs.size() / 2)};
+    uint32_t required = sizeof(header) + static_cast<uint32_t>(runs.size() * sizeof(uint16_t));
+    *written = required;
+    if (!buffer || size < required) {
+        return 1; // Caller needs a bigger buffer
+    }
 
-            // Set push constants
-            struct ModelPushConstants {
-                glm::mat4 viewProj;
-                glm::mat4 model;
-                uint32_t vertexOffset;
-                uint32_t indexOffset;
-            } pushConstants;
+    memcpy(buffer, header, sizeof(header));
+    memcpy(static_cast<uint8_t*>(buffer) + sizeof(header), runs.data(), runs.size() * sizeof(uint16_t));
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-            pushConstants.viewProj = viewProj;
-            pushConstants.model = modelMatrix;
-            pushConstants.vertexOffset = 0;
-            pushConstants.indexOffset = 0;
+int boulder_load_voxel_chunk(EntityID entity, int cx, int cy, int cz, const void* data, uint32_t size) {
+    NATIVE_TRY
+    VoxelWorld* world = getVoxelWorld(entity);
+    if (!world || !data || size < sizeof(uint32_t) * 3) {
+        return -1;
+    }
 
-            vkCmdPushConstants(g_engine.activeCommandBuffer, g_engine.modelPipelineLayout,
-                             VK_SHADER_STAGE_MESH_BIT_EXT, 0, sizeof(ModelPushConstants), &pushConstants);
+    uint32_t header[3];
+    memcpy(header, data, sizeof(header));
+    if (header[0] != VOXEL_CHUNK_MAGIC || header[1] != VOXEL_CHUNK_VERSION ||
+        size < sizeof(header) + static_cast<size_t>(header[2]) * 2 * sizeof(uint16_t)) {
+        fail(ERROR_INVALID_DATA, "Invalid voxel chunk data");
+        return -1;
+    }
 
-            // Draw mesh with mesh shader
-            // Calculate workgroups needed (30 indices = 10 triangles per workgroup)
-            uint32_t numWorkgroups = (mesh.indexCount + 29) / 30;
+    std::vector<uint16_t> runs(header[2] * 2);
+    memcpy(runs.data(), static_cast<const uint8_t*>(data) + sizeof(header), runs.size() * sizeof(uint16_t));
 
-            if (!logged) {
-                Logger::get().info("Drawing mesh: {} indices, {} workgroups", mesh.indexCount, numWorkgroups);
-            }
+    VoxelChunk chunk;
+    int i = 0;
+    for (size_t r = 0; r < runs.size(); r += 2) {
+        if (i + runs[r + 1] > VOXEL_CHUNK_VOLUME) {
+            fail(ERROR_INVALID_DATA, "Voxel chunk data overflows the chunk");
+            return -1;
+        }
+        std::fill_n(chunk.blocks.begin() + i, runs[r + 1], runs[r]);
+        if (runs[r] != 0) {
+            chunk.filled += runs[r + 1];
+        }
+        i += runs[r + 1];
+    }
+    if (i != VOXEL_CHUNK_VOLUME) {
+        fail(ERROR_INVALID_DATA, "Voxel chunk data is truncated");
+        return -1;
+    }
 
-            vkCmdDrawMeshTasksEXT(g_engine.activeCommandBuffer, numWorkgroups, 1, 1);
+    // Keep the chunk's mesh entity so the next update replaces its model
+    VoxelChunk& target = world->chunks[voxelChunkKey(cx, cy, cz)];
+    chunk.meshEntity = target.meshEntity;
+    target = std::move(chunk);
 
-            meshIndex++;
+    // Neighbours' faces against this chunk may have changed
+    for (int axis = 0; axis < 3; axis++) {
+        for (int dir = -1; dir <= 1; dir += 2) {
+            glm::ivec3 c(cx, cy, cz);
+            c[axis] += dir;
+            auto it = world->chunks.find(voxelChunkKey(c.x, c.y, c.z));
+            if (it != world->chunks.end()) {
+                it->second.dirty = true;
+            }
         }
-    });
+    }
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    // Debug log on first frame
-    if (!logged && entityCount > 0) {
-        Logger::get().info("Rendering {} entities with models", entityCount);
-        logged = true;
+void boulder_set_model_import_settings(int optimize, const float* lodRatios, const float* lodErrors, int lodCount) {
+    NATIVE_TRY
+    ModelImportSettings settings;
+    settings.optimize = optimize != 0;
+    for (int i = 0; i < lodCount && lodRatios; i++) {
+        settings.lodRatios.push_back(std::clamp(lodRatios[i], 0.0f, 1.0f));
+        settings.lodErrors.push_back(lodErrors ? lodErrors[i] : 0.01f);
     }
+    g_engine.importSettings = std::move(settings);
+    NATIVE_CATCH()
 }
 
-// Legacy function - use begin_frame/end_frame instead
-int boulder_render() {
-    uint32_t imageIndex;
-    int result = boulder_begin_frame(&imageIndex);
+int boulder_get_model_lod_count(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return 0;
+    }
 
-    if (result == -2) {
-        // Swapchain needs recreation
-        if (recreate_swapchain() != 0) {
-            return -1;
-        }
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const Model* model = e.get<Model>();
+    if (!model) {
         return 0;
-    } else if (result != 0) {
-        return result;
     }
 
-    // Draw cube with mesh shader (DISABLED for debugging model rendering)
-    if (false && g_engine.cubePipeline) {
-        vkCmdBindPipeline(g_engine.activeCommandBuffer, VK_PIPELINE_BIND_POINT_GRAPHICS, g_engine.cubePipeline);
+    size_t lods = 0;
+    for (const auto& mesh : model->meshes) {
+        lods = std::max(lods, mesh.lods.size());
+    }
+    return static_cast<int>(lods) + 1;
+    NATIVE_CATCH(0)
+}
 
-        // Set dynamic viewport and scissor
-        boulder_set_viewport(0.0f, 0.0f, (float)g_engine.swapchainExtent.width, (float)g_engine.swapchainExtent.height, 0.0f, 1.0f);
-        boulder_set_scissor(0, 0, g_engine.swapchainExtent.width, g_engine.swapchainExtent.height);
+int boulder_set_model_lod(EntityID entity, int lod) {
+    NATIVE_TRY
+    if (!g_engine.ecs || lod < 0) {
+        return -1;
+    }
 
-        // Set up view-projection matrix (simple perspective)
-        float aspect = (float)g_engine.swapchainExtent.width / (float)g_engine.swapchainExtent.height;
-        glm::mat4 proj = glm::perspective(glm::radians(90.0f), aspect, 0.1f, 100.0f);
-        proj[1][1] *= -1; // Flip Y for Vulkan
+    flecs::entity e = g_engine.ecs->entity(entity);
+    Model* model = e.get_mut<Model>();
+    if (!model) {
+        missingComponent(e.id(), "model");
+        return -1;
+    }
 
-        glm::mat4 view = glm::lookAt(
-            glm::vec3(2.0f, 2.0f, 2.0f),
-            glm::vec3(0.0f, 0.0f, 0.0f),
-            glm::vec3(0.0f, 1.0f, 0.0f)
-        );
+    // Meshes with fewer LODs draw their smallest one
+    model->lod = lod;
+    markChanged(e.id(), COMPONENT_MODEL);
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-        glm::mat4 viewProj = proj * view;
+int boulder_get_model_lod(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.ecs) {
+        return -1;
+    }
 
-        // Get current time for animation
-        static auto startTime = std::chrono::high_resolution_clock::now();
-        auto currentTime = std::chrono::high_resolution_clock::now();
-        float time = std::chrono::duration<float, std::chrono::seconds::period>(currentTime - startTime).count();
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const Model* model = e.get<Model>();
+    return model ? model->lod : -1;
+    NATIVE_CATCH(-1)
+}
 
-        // Push constants
-        struct PushConstants {
-            glm::mat4 viewProj;
-            float time;
-        } pushConstants;
-        pushConstants.viewProj = viewProj;
-        pushConstants.time = time;
+int boulder_get_model_triangle_count(EntityID entity, int lod) {
+    NATIVE_TRY
+    if (!g_engine.ecs || lod < 0) {
+        return -1;
+    }
 
-        vkCmdPushConstants(g_engine.activeCommandBuffer, g_engine.pipelineLayout, VK_SHADER_STAGE_MESH_BIT_EXT,
-                           0, sizeof(PushConstants), &pushConstants);
+    flecs::entity e = g_engine.ecs->entity(entity);
+    const Model* model = e.get<Model>();
+    if (!model) {
+        missingComponent(e.id(), "model");
+        return -1;
+    }
 
-        // Draw mesh shader (1 workgroup = 1 cube)
-        vkCmdDrawMeshTasksEXT(g_engine.activeCommandBuffer, 1, 1, 1);
+    size_t triangles = 0;
+    for (const auto& mesh : model->meshes) {
+        if (lod == 0 || mesh.lods.empty()) {
+            triangles += mesh.indexCount / 3;
+        } else {
+            triangles += mesh.lods[std::min<size_t>(lod, mesh.lods.size()) - 1].indexCount / 3;
+        }
     }
+    return static_cast<int>(triangles);
+    NATIVE_CATCH(-1)
+}
 
-    // Render models
-    boulder_render_models();
+int boulder_is_key_pressed(int keyCode) {
+    NATIVE_TRY
+    const bool* state = SDL_GetKeyboardState(nullptr);
+    return state[keyCode] ? 1 : 0;
+    NATIVE_CATCH(0)
+}
 
-    // Render UI overlay on top of the scene
-    boulder_ui_render(imageIndex);
+int boulder_poll_window_event(WindowEvent* event, char* path, uint32_t pathSize) {
+    NATIVE_TRY
+    if (!event || g_engine.windowEvents.empty()) {
+        return 0;
+    }
 
-    return boulder_end_frame(imageIndex);
+    *event = g_engine.windowEvents.front().first;
+    if (path && pathSize > 0) {
+        snprintf(path, pathSize, "%s", g_engine.windowEvents.front().second.c_str());
+    }
+    g_engine.windowEvents.pop_front();
+    return 1;
+    NATIVE_CATCH(0)
 }
 
-int boulder_create_window(int width, int height, const char* title) {
+int boulder_get_window_state() {
+    NATIVE_TRY
+    if (!g_engine.window) {
+        return 0;
+    }
 
-    VkResult err;
+    SDL_WindowFlags flags = SDL_GetWindowFlags(g_engine.window);
+    int state = 0;
+    if (flags & SDL_WINDOW_INPUT_FOCUS) {
+        state |= 1;
+    }
+    if (flags & SDL_WINDOW_MINIMIZED) {
+        state |= 2;
+    }
+    if (flags & SDL_WINDOW_MAXIMIZED) {
+        state |= 4;
+    }
+    return state;
+    NATIVE_CATCH(0)
+}
 
-    if (!g_engine.initialized || !g_engine.instance) {
-        Logger::get().error("Engine not initialized or no Vulkan instance");
-        return -1;
+int boulder_poll_key_event(KeyEvent* event) {
+    NATIVE_TRY
+    if (!event || g_engine.keyEvents.empty()) {
+        return 0;
     }
 
-    Logger::get().info("Window creation: {} x {} '{}'" , width, height, title);
+    *event = g_engine.keyEvents.front();
+    g_engine.keyEvents.pop_front();
+    return 1;
+    NATIVE_CATCH(0)
+}
 
+uint32_t boulder_get_keycode(int scancode) {
+    NATIVE_TRY
+    if (scancode <= SDL_SCANCODE_UNKNOWN || scancode >= SDL_SCANCODE_COUNT) {
+        return SDLK_UNKNOWN;
+    }
+    return SDL_GetKeyFromScancode(static_cast<SDL_Scancode>(scancode), SDL_KMOD_NONE, false);
+    NATIVE_CATCH(0)
+}
 
-    if (g_engine.window) {
-        SDL_DestroyWindow(g_engine.window);
+int boulder_get_scancode(uint32_t keycode) {
+    NATIVE_TRY
+    return SDL_GetScancodeFromKey(keycode, nullptr);
+    NATIVE_CATCH(0)
+}
+
+uint32_t boulder_get_key_name(int scancode, char* buffer, uint32_t capacity) {
+    NATIVE_TRY
+    if (scancode <= SDL_SCANCODE_UNKNOWN || scancode >= SDL_SCANCODE_COUNT) {
+        return copyString("", buffer, capacity);
     }
 
-    g_engine.window = SDL_CreateWindow(
-        title,
-        width, height,
-        SDL_WINDOW_VULKAN | SDL_WINDOW_RESIZABLE
-    );
+    SDL_Keycode key = SDL_GetKeyFromScancode(static_cast<SDL_Scancode>(scancode), SDL_KMOD_NONE, false);
+    const char* name = SDL_GetKeyName(key);
+    if (!name || !*name) {
+        // Keys the layout leaves unmapped still have their position's name
+        name = SDL_GetScancodeName(static_cast<SDL_Scancode>(scancode));
+    }
+    return copyString(name, buffer, capacity);
+    NATIVE_CATCH(0)
+}
 
-    if (!g_engine.window) {
-        Logger::get().error("Failed to create window: {}", SDL_GetError());
-        return -1;
+uint32_t boulder_get_scancode_name(int scancode, char* buffer, uint32_t capacity) {
+    NATIVE_TRY
+    if (scancode <= SDL_SCANCODE_UNKNOWN || scancode >= SDL_SCANCODE_COUNT) {
+        return copyString("", buffer, capacity);
     }
+    return copyString(SDL_GetScancodeName(static_cast<SDL_Scancode>(scancode)), buffer, capacity);
+    NATIVE_CATCH(0)
+}
 
-    if(!SDL_Vulkan_CreateSurface(g_engine.window, g_engine.instance, nullptr, &g_engine.surface)){
-        Logger::get().error("Failed to create Vulkan surface: {}", SDL_GetError());
-        return -1;
-    } else {
-        Logger::get().info("Vulkan surface created!");
+int boulder_take_keymap_changed() {
+    NATIVE_TRY
+    bool changed = g_engine.keymapChanged;
+    g_engine.keymapChanged = false;
+    return changed ? 1 : 0;
+    NATIVE_CATCH(0)
+}
+
+int boulder_is_mouse_button_pressed(int button) {
+    NATIVE_TRY
+    Uint32 buttons = SDL_GetMouseState(nullptr, nullptr);
+    // SDL3 uses SDL_BUTTON_MASK instead of SDL_BUTTON
+    return (buttons & SDL_BUTTON_MASK(button)) ? 1 : 0;
+    NATIVE_CATCH(0)
+}
+
+void boulder_get_mouse_position(float* x, float* y) {
+    NATIVE_TRY
+    if (x && y) {
+        SDL_GetMouseState(x, y);
     }
+    NATIVE_CATCH()
+}
 
-    // Select physical device
-    uint32_t deviceCount = 0;
-    vkEnumeratePhysicalDevices(g_engine.instance, &deviceCount, nullptr);
-    if (deviceCount == 0) {
-        Logger::get().error("No Vulkan physical devices found");
-        return -1;
+void boulder_get_mouse_wheel(float* x, float* y) {
+    NATIVE_TRY
+    if (x && y) {
+        *x = g_engine.mouseWheel.x;
+        *y = g_engine.mouseWheel.y;
     }
+    NATIVE_CATCH()
+}
 
-    std::vector<VkPhysicalDevice> devices(deviceCount);
-    vkEnumeratePhysicalDevices(g_engine.instance, &deviceCount, devices.data());
-    g_engine.physicalDevice = devices[0]; // Just use first device for now
+int boulder_poll_touch_event(TouchEvent* event) {
+    NATIVE_TRY
+    if (!event || g_engine.touchEvents.empty()) {
+        return 0;
+    }
 
-    // Find graphics queue family
-    uint32_t queueFamilyCount = 0;
-    vkGetPhysicalDeviceQueueFamilyProperties(g_engine.physicalDevice, &queueFamilyCount, nullptr);
-    std::vector<VkQueueFamilyProperties> queueFamilies(queueFamilyCount);
-    vkGetPhysicalDeviceQueueFamilyProperties(g_engine.physicalDevice, &queueFamilyCount, queueFamilies.data());
+    *event = g_engine.touchEvents.front();
+    g_engine.touchEvents.pop_front();
+    return 1;
+    NATIVE_CATCH(0)
+}
 
-    for (uint32_t i = 0; i < queueFamilyCount; i++) {
-        if (queueFamilies[i].queueFlags & VK_QUEUE_GRAPHICS_BIT) {
-            VkBool32 presentSupport = false;
-            vkGetPhysicalDeviceSurfaceSupportKHR(g_engine.physicalDevice, i, g_engine.surface, &presentSupport);
-            if (presentSupport) {
-                g_engine.graphicsQueueFamily = i;
-                break;
-            }
-        }
+int boulder_get_touch_count() {
+    NATIVE_TRY
+    return static_cast<int>(g_engine.touches.size());
+    NATIVE_CATCH(0)
+}
+
+int boulder_get_touch(int index, TouchPoint* touch) {
+    NATIVE_TRY
+    if (!touch || index < 0 || index >= static_cast<int>(g_engine.touches.size())) {
+        return -1;
     }
 
-    if (g_engine.graphicsQueueFamily == UINT32_MAX) {
-        Logger::get().error("No suitable queue family found");
+    *touch = g_engine.touches[index];
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_poll_app_event(int* event) {
+    NATIVE_TRY
+    if (!event || g_engine.appEvents.empty()) {
+        return 0;
+    }
+
+    *event = g_engine.appEvents.front();
+    g_engine.appEvents.pop_front();
+    return 1;
+    NATIVE_CATCH(0)
+}
+
+int boulder_is_paused() {
+    NATIVE_TRY
+    return g_engine.paused ? 1 : 0;
+    NATIVE_CATCH(0)
+}
+
+int boulder_enable_motion(int enabled) {
+    NATIVE_TRY
+    if (!g_engine.initialized) {
         return -1;
     }
+    if (!enabled) {
+        closeMotionSensors();
+        return 0;
+    }
+    if (g_engine.motionEnabled) {
+        return 0;
+    }
+    return openMotionSensors() ? 0 : -1;
+    NATIVE_CATCH(-1)
+}
 
-    // Create logical device
-    float queuePriority = 1.0f;
-    VkDeviceQueueCreateInfo queueCreateInfo{};
-    queueCreateInfo.sType = VK_STRUCTURE_TYPE_DEVICE_QUEUE_CREATE_INFO;
-    queueCreateInfo.queueFamilyIndex = g_engine.graphicsQueueFamily;
-    queueCreateInfo.queueCount = 1;
-    queueCreateInfo.pQueuePriorities = &queuePriority;
+int boulder_get_motion_source() {
+    NATIVE_TRY
+    return g_engine.motionSource;
+    NATIVE_CATCH(MOTION_NONE)
+}
 
-    VkPhysicalDeviceFeatures deviceFeatures{};
+void boulder_get_gyro(float* x, float* y, float* z) {
+    NATIVE_TRY
+    if (x && y && z) {
+        *x = g_engine.gyro.x;
+        *y = g_engine.gyro.y;
+        *z = g_engine.gyro.z;
+    }
+    NATIVE_CATCH()
+}
 
-    // Check if mesh shader extension is available
-    uint32_t extensionCount = 0;
-    vkEnumerateDeviceExtensionProperties(g_engine.physicalDevice, nullptr, &extensionCount, nullptr);
-    std::vector<VkExtensionProperties> availableExtensions(extensionCount);
-    vkEnumerateDeviceExtensionProperties(g_engine.physicalDevice, nullptr, &extensionCount, availableExtensions.data());
+void boulder_get_accel(float* x, float* y, float* z) {
+    NATIVE_TRY
+    if (x && y && z) {
+        *x = g_engine.accel.x;
+        *y = g_engine.accel.y;
+        *z = g_engine.accel.z;
+    }
+    NATIVE_CATCH()
+}
 
-    bool meshShaderSupported = false;
-    for (const auto& ext : availableExtensions) {
-        if (strcmp(ext.extensionName, VK_EXT_MESH_SHADER_EXTENSION_NAME) == 0) {
-            meshShaderSupported = true;
-            Logger::get().info("Mesh shader extension is supported!");
-            break;
-        }
+void boulder_take_gyro_delta(float* x, float* y, float* z, float* elapsed) {
+    NATIVE_TRY
+    if (x && y && z) {
+        *x = g_engine.gyroDelta.x;
+        *y = g_engine.gyroDelta.y;
+        *z = g_engine.gyroDelta.z;
     }
+    if (elapsed) {
+        *elapsed = g_engine.gyroDeltaTime;
+    }
+    g_engine.gyroDelta = glm::vec3(0.0f);
+    g_engine.gyroDeltaTime = 0.0f;
+    NATIVE_CATCH()
+}
 
-    if (!meshShaderSupported) {
-        Logger::get().error("Mesh shader extension NOT supported on this device!");
+void boulder_start_gyro_calibration() {
+    NATIVE_TRY
+    g_engine.calibratingGyro = true;
+    g_engine.calibrationSum = glm::dvec3(0.0);
+    g_engine.calibrationSamples = 0;
+    NATIVE_CATCH()
+}
+
+int boulder_finish_gyro_calibration() {
+    NATIVE_TRY
+    if (!g_engine.calibratingGyro) {
+        return -1;
+    }
+    g_engine.calibratingGyro = false;
+    if (g_engine.calibrationSamples == 0) {
         return -1;
     }
 
-    // Query mesh shader features to ensure they're actually supported
-    VkPhysicalDeviceMeshShaderFeaturesEXT queriedMeshShaderFeatures{};
-    queriedMeshShaderFeatures.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_MESH_SHADER_FEATURES_EXT;
+    g_engine.gyroBias = glm::vec3(g_engine.calibrationSum / static_cast<double>(g_engine.calibrationSamples));
+    Logger::get().info("Gyro calibrated from {} samples", g_engine.calibrationSamples);
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+void boulder_set_gyro_bias(float x, float y, float z) {
+    NATIVE_TRY
+    g_engine.gyroBias = glm::vec3(x, y, z);
+    NATIVE_CATCH()
+}
 
-    VkPhysicalDeviceFeatures2 features2{};
-    features2.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_FEATURES_2;
-    features2.pNext = &queriedMeshShaderFeatures;
+void boulder_get_gyro_bias(float* x, float* y, float* z) {
+    NATIVE_TRY
+    if (x && y && z) {
+        *x = g_engine.gyroBias.x;
+        *y = g_engine.gyroBias.y;
+        *z = g_engine.gyroBias.z;
+    }
+    NATIVE_CATCH()
+}
 
-    vkGetPhysicalDeviceFeatures2(g_engine.physicalDevice, &features2);
+int boulder_get_controller_count() {
+    NATIVE_TRY
+    return static_cast<int>(g_engine.controllers.size());
+    NATIVE_CATCH(0)
+}
 
-    if (!queriedMeshShaderFeatures.meshShader) {
-        Logger::get().error("Mesh shader feature NOT supported on this device!");
-        return -1;
+uint32_t boulder_get_controller_id(int index) {
+    NATIVE_TRY
+    if (index < 0 || index >= static_cast<int>(g_engine.controllers.size())) {
+        return 0;
     }
+    return g_engine.controllers[index].id;
+    NATIVE_CATCH(0)
+}
 
-    Logger::get().info("Mesh shader feature is supported!");
+uint32_t boulder_get_controller_name(uint32_t controller, char* buffer, uint32_t capacity) {
+    NATIVE_TRY
+    Controller* c = findController(controller);
+    if (!c) {
+        return 0;
+    }
 
-    // Enable mesh shader features for device creation
-    VkPhysicalDeviceMeshShaderFeaturesEXT meshShaderFeatures{};
-    meshShaderFeatures.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_MESH_SHADER_FEATURES_EXT;
-    meshShaderFeatures.meshShader = VK_TRUE;
-    meshShaderFeatures.taskShader = VK_FALSE;
+    return copyString(SDL_GetGamepadName(c->pad), buffer, capacity);
+    NATIVE_CATCH(0)
+}
 
-    VkPhysicalDeviceDynamicRenderingFeatures dynamicRenderingFeature{};
-    dynamicRenderingFeature.sType = VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_DYNAMIC_RENDERING_FEATURES;
-    dynamicRenderingFeature.pNext = &meshShaderFeatures;
-    dynamicRenderingFeature.dynamicRendering = VK_TRUE;
+uint32_t boulder_get_controller_capabilities(uint32_t controller) {
+    NATIVE_TRY
+    Controller* c = findController(controller);
+    return c ? c->capabilities : 0;
+    NATIVE_CATCH(0)
+}
 
-    const char* deviceExtensions[] = {
-        VK_KHR_SWAPCHAIN_EXTENSION_NAME,
-        VK_EXT_MESH_SHADER_EXTENSION_NAME
-    };
+int boulder_get_controller_button(uint32_t controller, int button) {
+    NATIVE_TRY
+    Controller* c = findController(controller);
+    if (!c || button < 0 || button >= SDL_GAMEPAD_BUTTON_COUNT) {
+        return 0;
+    }
+    return SDL_GetGamepadButton(c->pad, static_cast<SDL_GamepadButton>(button)) ? 1 : 0;
+    NATIVE_CATCH(0)
+}
 
-    VkDeviceCreateInfo deviceCreateInfo{};
-    deviceCreateInfo.sType = VK_STRUCTURE_TYPE_DEVICE_CREATE_INFO;
-    deviceCreateInfo.pNext = &dynamicRenderingFeature;
-    deviceCreateInfo.queueCreateInfoCount = 1;
-    deviceCreateInfo.pQueueCreateInfos = &queueCreateInfo;
-    deviceCreateInfo.pEnabledFeatures = &deviceFeatures;
-    deviceCreateInfo.enabledExtensionCount = 2;
-    deviceCreateInfo.ppEnabledExtensionNames = deviceExtensions;
+float boulder_get_controller_axis(uint32_t controller, int axis) {
+    NATIVE_TRY
+    Controller* c = findController(controller);
+    if (!c || axis < 0 || axis >= SDL_GAMEPAD_AXIS_COUNT) {
+        return 0.0f;
+    }
+    Sint16 value = SDL_GetGamepadAxis(c->pad, static_cast<SDL_GamepadAxis>(axis));
+    return std::max(static_cast<float>(value) / 32767.0f, -1.0f);
+    NATIVE_CATCH(0.0f)
+}
 
-    if (vkCreateDevice(g_engine.physicalDevice, &deviceCreateInfo, nullptr, &g_engine.device) != VK_SUCCESS) {
-        Logger::get().error("Failed to create logical device");
+int boulder_rumble(uint32_t controller, float low, float high, uint32_t durationMs) {
+    NATIVE_TRY
+    Controller* c = findController(controller);
+    if (!c || !(c->capabilities & CONTROLLER_RUMBLE)) {
         return -1;
     }
+    return SDL_RumbleGamepad(c->pad, unitToByte(low) * 257, unitToByte(high) * 257, durationMs) ? 0 : -1;
+    NATIVE_CATCH(-1)
+}
 
-    volkLoadDevice(g_engine.device);
-    vkGetDeviceQueue(g_engine.device, g_engine.graphicsQueueFamily, 0, &g_engine.graphicsQueue);
-    Logger::get().info("Vulkan device created!");
+int boulder_rumble_triggers(uint32_t controller, float left, float right, uint32_t durationMs) {
+    NATIVE_TRY
+    Controller* c = findController(controller);
+    if (!c || !(c->capabilities & CONTROLLER_TRIGGER_RUMBLE)) {
+        return -1;
+    }
+    return SDL_RumbleGamepadTriggers(c->pad, unitToByte(left) * 257, unitToByte(right) * 257, durationMs) ? 0 : -1;
+    NATIVE_CATCH(-1)
+}
 
-    // Create swapchain
-    VkSurfaceCapabilitiesKHR capabilities;
-    vkGetPhysicalDeviceSurfaceCapabilitiesKHR(g_engine.physicalDevice, g_engine.surface, &capabilities);
+int boulder_set_controller_led(uint32_t controller, float r, float g, float b) {
+    NATIVE_TRY
+    Controller* c = findController(controller);
+    if (!c || !(c->capabilities & CONTROLLER_LED)) {
+        return -1;
+    }
+    return SDL_SetGamepadLED(c->pad, unitToByte(r), unitToByte(g), unitToByte(b)) ? 0 : -1;
+    NATIVE_CATCH(-1)
+}
 
-    uint32_t formatCount;
-    vkGetPhysicalDeviceSurfaceFormatsKHR(g_engine.physicalDevice, g_engine.surface, &formatCount, nullptr);
-    std::vector<VkSurfaceFormatKHR> formats(formatCount);
-    vkGetPhysicalDeviceSurfaceFormatsKHR(g_engine.physicalDevice, g_engine.surface, &formatCount, formats.data());
+int boulder_set_trigger_effect(uint32_t controller, int trigger, const TriggerEffect* effect) {
+    NATIVE_TRY
+    Controller* c = findController(controller);
+    if (!c || !effect || !(c->capabilities & CONTROLLER_ADAPTIVE_TRIGGERS) || trigger < 0 || trigger > 1) {
+        return -1;
+    }
 
-    VkSurfaceFormatKHR surfaceFormat = formats[0];
-    for (const auto& format : formats) {
-        if (format.format == VK_FORMAT_B8G8R8A8_SRGB && format.colorSpace == VK_COLOR_SPACE_SRGB_NONLINEAR_KHR) {
-            surfaceFormat = format;
+    uint8_t block[11] = {};
+    switch (effect->mode) {
+        case TRIGGER_EFFECT_OFF:
+            block[0] = 0x05;
             break;
-        }
+        case TRIGGER_EFFECT_RESISTANCE:
+            block[0] = 0x01;
+            block[1] = unitToByte(effect->start);
+            block[2] = unitToByte(effect->strength);
+            break;
+        case TRIGGER_EFFECT_SECTION:
+            block[0] = 0x02;
+            block[1] = unitToByte(effect->start);
+            block[2] = unitToByte(effect->end);
+            block[3] = unitToByte(effect->strength);
+            break;
+        case TRIGGER_EFFECT_VIBRATION:
+            block[0] = 0x06;
+            block[1] = static_cast<uint8_t>(std::clamp(effect->frequency, 0.0f, 255.0f));
+            block[2] = unitToByte(effect->strength);
+            block[3] = unitToByte(effect->start);
+            break;
+        default:
+            return -1;
     }
 
-    g_engine.swapchainFormat = surfaceFormat.format;
-    g_engine.swapchainExtent = capabilities.currentExtent;
-
-    if (g_engine.swapchainExtent.width == UINT32_MAX) {
-        g_engine.swapchainExtent.width = width;
-        g_engine.swapchainExtent.height = height;
+    uint8_t report[DS5_EFFECT_SIZE] = {};
+    if (trigger == 0) {
+        report[0] = DS5_ENABLE_LEFT_TRIGGER;
+        std::memcpy(report + DS5_LEFT_TRIGGER_OFFSET, block, sizeof(block));
+    } else {
+        report[0] = DS5_ENABLE_RIGHT_TRIGGER;
+        std::memcpy(report + DS5_RIGHT_TRIGGER_OFFSET, block, sizeof(block));
     }
+    return SDL_SendGamepadEffect(c->pad, report, sizeof(report)) ? 0 : -1;
+    NATIVE_CATCH(-1)
+}
 
-    uint32_t imageCount = capabilities.minImageCount + 1;
-    if (capabilities.maxImageCount > 0 && imageCount > capabilities.maxImageCount) {
-        imageCount = capabilities.maxImageCount;
+uint32_t boulder_play_haptic_effect(uint32_t controller, const HapticEffect* effect) {
+    NATIVE_TRY
+    Controller* c = findController(controller);
+    if (!c || !effect) {
+        return 0;
     }
 
-    // Query available present modes
-    uint32_t presentModeCount;
-    vkGetPhysicalDeviceSurfacePresentModesKHR(g_engine.physicalDevice, g_engine.surface, &presentModeCount, nullptr);
-    std::vector<VkPresentModeKHR> presentModes(presentModeCount);
-    vkGetPhysicalDeviceSurfacePresentModesKHR(g_engine.physicalDevice, g_engine.surface, &presentModeCount, presentModes.data());
-
-    // Prefer Immediate (uncapped framerate) for maximum performance, fallback to FIFO (guaranteed support)
-    VkPresentModeKHR presentMode = VK_PRESENT_MODE_FIFO_KHR;
-    for (const auto& mode : presentModes) {
-        if (mode == VK_PRESENT_MODE_IMMEDIATE_KHR) {
-            presentMode = VK_PRESENT_MODE_IMMEDIATE_KHR;
-            Logger::get().info("Using Immediate present mode (uncapped framerate)");
-            break;
-        }
+    uint32_t required = CONTROLLER_RUMBLE;
+    if (effect->target == HAPTIC_LEFT_TRIGGER || effect->target == HAPTIC_RIGHT_TRIGGER) {
+        required = CONTROLLER_TRIGGER_RUMBLE;
     }
-    if (presentMode == VK_PRESENT_MODE_FIFO_KHR) {
-        Logger::get().info("Using FIFO present mode (vsync fallback)");
+    if (!(c->capabilities & required)) {
+        return 0;
     }
 
-    VkSwapchainCreateInfoKHR swapchainInfo{};
-    swapchainInfo.sType = VK_STRUCTURE_TYPE_SWAPCHAIN_CREATE_INFO_KHR;
-    swapchainInfo.surface = g_engine.surface;
-    swapchainInfo.minImageCount = imageCount;
-    swapchainInfo.imageFormat = surfaceFormat.format;
-    swapchainInfo.imageColorSpace = surfaceFormat.colorSpace;
-    swapchainInfo.imageExtent = g_engine.swapchainExtent;
-    swapchainInfo.imageArrayLayers = 1;
-    swapchainInfo.imageUsage = VK_IMAGE_USAGE_COLOR_ATTACHMENT_BIT;
-    swapchainInfo.imageSharingMode = VK_SHARING_MODE_EXCLUSIVE;
-    swapchainInfo.preTransform = capabilities.currentTransform;
-    swapchainInfo.compositeAlpha = VK_COMPOSITE_ALPHA_OPAQUE_BIT_KHR;
-    swapchainInfo.presentMode = presentMode;
-    swapchainInfo.clipped = VK_TRUE;
+    uint32_t id = g_engine.nextHapticID++;
+    c->haptics.push_back({id, *effect, SDL_GetTicksNS()});
+    return id;
+    NATIVE_CATCH(0)
+}
 
-    if (vkCreateSwapchainKHR(g_engine.device, &swapchainInfo, nullptr, &g_engine.swapchain) != VK_SUCCESS) {
-        Logger::get().error("Failed to create swapchain");
-        return -1;
+void boulder_stop_haptic_effect(uint32_t controller, uint32_t effect) {
+    NATIVE_TRY
+    Controller* c = findController(controller);
+    if (!c) {
+        return;
     }
 
-    vkGetSwapchainImagesKHR(g_engine.device, g_engine.swapchain, &imageCount, nullptr);
-    g_engine.swapchainImages.resize(imageCount);
-    vkGetSwapchainImagesKHR(g_engine.device, g_engine.swapchain, &imageCount, g_engine.swapchainImages.data());
+    auto& haptics = c->haptics;
+    haptics.erase(std::remove_if(haptics.begin(), haptics.end(),
+                                 [&](const PlayingHaptic& h) { return effect == 0 || h.id == effect; }),
+                  haptics.end());
+    NATIVE_CATCH()
+}
 
-    // Initialize per-image fence tracking (initially no frame is using any image)
-    g_engine.imagesInFlight.resize(imageCount, VK_NULL_HANDLE);
+void boulder_log_info(const char* message) {
+    NATIVE_TRY
+    if (message) {
+        Logger::get().info("{}",message);
+    }
+    NATIVE_CATCH()
+}
 
-    // Create image views
-    g_engine.swapchainImageViews.resize(imageCount);
-    for (size_t i = 0; i < imageCount; i++) {
-        VkImageViewCreateInfo viewInfo{};
-        viewInfo.sType = VK_STRUCTURE_TYPE_IMAGE_VIEW_CREATE_INFO;
-        viewInfo.image = g_engine.swapchainImages[i];
-        viewInfo.viewType = VK_IMAGE_VIEW_TYPE_2D;
-        viewInfo.format = g_engine.swapchainFormat;
-        viewInfo.components.r = VK_COMPONENT_SWIZZLE_IDENTITY;
-        viewInfo.components.g = VK_COMPONENT_SWIZZLE_IDENTITY;
-        viewInfo.components.b = VK_COMPONENT_SWIZZLE_IDENTITY;
-        viewInfo.components.a = VK_COMPONENT_SWIZZLE_IDENTITY;
-        viewInfo.subresourceRange.aspectMask = VK_IMAGE_ASPECT_COLOR_BIT;
-        viewInfo.subresourceRange.baseMipLevel = 0;
-        viewInfo.subresourceRange.levelCount = 1;
-        viewInfo.subresourceRange.baseArrayLayer = 0;
-        viewInfo.subresourceRange.layerCount = 1;
+void boulder_log_error(const char* message) {
+    NATIVE_TRY
+    if (message) {
+        Logger::get().error("{}",message);
+    }
+    NATIVE_CATCH()
+}
 
-        if (vkCreateImageView(g_engine.device, &viewInfo, nullptr, &g_engine.swapchainImageViews[i]) != VK_SUCCESS) {
-            Logger::get().error("Failed to create image view");
-            return -1;
+int boulder_watch_logs(int enabled) {
+    NATIVE_TRY
+    if (!enabled) {
+        Logger::get().setListener(nullptr);
+        std::lock_guard<std::mutex> lock(g_engine.logMutex);
+        g_engine.logLines.clear();
+        return 0;
+    }
+
+    Logger::get().setListener([](Logger::Level level, std::string_view message) {
+        std::lock_guard<std::mutex> lock(g_engine.logMutex);
+        if (g_engine.logLines.size() >= LOG_QUEUE_LIMIT) {
+            g_engine.logLines.pop_front();
         }
+        g_engine.logLines.emplace_back(static_cast<int>(level), std::string(message));
+    });
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_poll_log(int* level, char* message, uint32_t messageSize) {
+    NATIVE_TRY
+    if (!level) {
+        return 0;
     }
 
-    // Create depth resources
-    if (createDepthResources() != 0) {
-        Logger::get().error("Failed to create depth resources");
-        return -1;
+    std::lock_guard<std::mutex> lock(g_engine.logMutex);
+    if (g_engine.logLines.empty()) {
+        return 0;
+    }
+    *level = g_engine.logLines.front().first;
+    if (message && messageSize > 0) {
+        snprintf(message, messageSize, "%s", g_engine.logLines.front().second.c_str());
     }
+    g_engine.logLines.pop_front();
+    return 1;
+    NATIVE_CATCH(0)
+}
 
-    // Create command pool
-    VkCommandPoolCreateInfo poolInfo{};
-    poolInfo.sType = VK_STRUCTURE_TYPE_COMMAND_POOL_CREATE_INFO;
-    poolInfo.flags = VK_COMMAND_POOL_CREATE_RESET_COMMAND_BUFFER_BIT;
-    poolInfo.queueFamilyIndex = g_engine.graphicsQueueFamily;
+// Shader management
+ShaderModuleID boulder_compile_shader(const char* source, int shaderKind, const char* name) {
+    NATIVE_TRY
+    return boulder_compile_shader_variant(source, shaderKind, name, nullptr, 0);
+    NATIVE_CATCH(0)
+}
 
-    if (vkCreateCommandPool(g_engine.device, &poolInfo, nullptr, &g_engine.commandPool) != VK_SUCCESS) {
-        Logger::get().error("Failed to create command pool");
-        return -1;
+// Parses "NAME" or "NAME=VALUE" defines into macro name and value pairs
+static bool parseShaderDefines(const char* name, const char** defines, uint32_t defineCount,
+                               std::vector<std::pair<std::string, std::string>>& macros) {
+    for (uint32_t i = 0; i < defineCount; i++) {
+        std::string define = defines[i] ? defines[i] : "";
+        size_t eq = define.find('=');
+        if (define.empty() || eq == 0) {
+            fail(ERROR_INVALID_ARGUMENT, "Cannot compile shader {}: invalid define '{}'", name, define);
+            return false;
+        }
+        if (eq == std::string::npos) {
+            macros.emplace_back(define, "");
+        } else {
+            macros.emplace_back(define.substr(0, eq), define.substr(eq + 1));
+        }
     }
+    return true;
+}
 
-    // Create command buffers (one per frame in flight)
-    g_engine.commandBuffers.resize(MAX_FRAMES_IN_FLIGHT);
-    VkCommandBufferAllocateInfo allocInfo{};
-    allocInfo.sType = VK_STRUCTURE_TYPE_COMMAND_BUFFER_ALLOCATE_INFO;
-    allocInfo.commandPool = g_engine.commandPool;
-    allocInfo.level = VK_COMMAND_BUFFER_LEVEL_PRIMARY;
-    allocInfo.commandBufferCount = MAX_FRAMES_IN_FLIGHT;
+// Compiles GLSL into a shader module, or returns null. Safe to call from worker threads.
+static VkShaderModule compileShaderModule(const std::string& source, shaderc_shader_kind kind, const char* name,
+                                          const std::vector<std::pair<std::string, std::string>>& macros) {
+    auto spirv = compileShader(source, kind, name, macros);
+    if (spirv.empty()) {
+        return VK_NULL_HANDLE; // compileShader recorded the compiler's output
+    }
 
-    if (vkAllocateCommandBuffers(g_engine.device, &allocInfo, g_engine.commandBuffers.data()) != VK_SUCCESS) {
-        Logger::get().error("Failed to allocate command buffers");
-        return -1;
+    VkShaderModuleCreateInfo createInfo{};
+    createInfo.sType = VK_STRUCTURE_TYPE_SHADER_MODULE_CREATE_INFO;
+    createInfo.codeSize = spirv.size() * sizeof(uint32_t);
+    createInfo.pCode = spirv.data();
+
+    VkShaderModule shaderModule;
+    if (vkCreateShaderModule(g_engine.device, &createInfo, nullptr, &shaderModule) != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to create shader module: {}", name);
+        return VK_NULL_HANDLE;
     }
+    return shaderModule;
+}
 
-    // Create sync objects
-    VkSemaphoreCreateInfo semaphoreInfo{};
-    semaphoreInfo.sType = VK_STRUCTURE_TYPE_SEMAPHORE_CREATE_INFO;
+ShaderModuleID boulder_compile_shader_variant(const char* source, int shaderKind, const char* name,
+                                              const char** defines, uint32_t defineCount) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.device || !source || !name || (defineCount > 0 && !defines)) {
+        fail(ERROR_INVALID_ARGUMENT, "Cannot compile shader: engine not initialized or invalid parameters");
+        return 0;
+    }
 
-    VkFenceCreateInfo fenceInfo{};
-    fenceInfo.sType = VK_STRUCTURE_TYPE_FENCE_CREATE_INFO;
-    fenceInfo.flags = VK_FENCE_CREATE_SIGNALED_BIT;
+    std::vector<std::pair<std::string, std::string>> macros;
+    if (!parseShaderDefines(name, defines, defineCount, macros)) {
+        return 0;
+    }
 
-    // Per-frame-in-flight sync (imageAvailable, renderFinished, and fences)
-    for (size_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
-        if (vkCreateSemaphore(g_engine.device, &semaphoreInfo, nullptr, &g_engine.imageAvailableSemaphores[i]) != VK_SUCCESS ||
-            vkCreateSemaphore(g_engine.device, &semaphoreInfo, nullptr, &g_engine.renderFinishedSemaphores[i]) != VK_SUCCESS ||
-            vkCreateFence(g_engine.device, &fenceInfo, nullptr, &g_engine.inFlightFences[i]) != VK_SUCCESS) {
-            Logger::get().error("Failed to create sync objects for frame {}", i);
-            return -1;
-        }
+    VkShaderModule shaderModule = compileShaderModule(source, static_cast<shaderc_shader_kind>(shaderKind), name, macros);
+    if (!shaderModule) {
+        return 0;
     }
 
-    // Load and compile shaders at runtime
-    std::ifstream meshFile("shaders/cube.mesh");
-    std::string meshSource((std::istreambuf_iterator<char>(meshFile)), std::istreambuf_iterator<char>());
+    uint64_t id = g_engine.nextShaderModuleId++;
+    g_engine.shaderModules[id] = shaderModule;
 
-    std::ifstream fragFile("shaders/cube.frag");
-    std::string fragSource((std::istreambuf_iterator<char>(fragFile)), std::istreambuf_iterator<char>());
+    Logger::get().info("Shader module {} created with ID {}", name, id);
+    return id;
+    NATIVE_CATCH(0)
+}
 
-    if (meshSource.empty() || fragSource.empty()) {
-        Logger::get().error("Failed to read shader source files");
+int boulder_compile_spirv(const char* source, int shaderKind, const char* name,
+                          uint32_t* words, uint32_t capacity, uint32_t* wordCount) {
+    NATIVE_TRY
+    if (!source || !name || !wordCount) {
         return -1;
     }
 
-    auto meshSpirv = compileShader(meshSource, shaderc_glsl_default_mesh_shader, "cube.mesh");
-    auto fragSpirv = compileShader(fragSource, shaderc_glsl_default_fragment_shader, "cube.frag");
-
-    if (meshSpirv.empty() || fragSpirv.empty()) {
-        Logger::get().error("Failed to compile shaders");
+    // shaderc does not need a device, so this also works for offline cooking
+    auto spirv = compileShader(source, static_cast<shaderc_shader_kind>(shaderKind), name);
+    if (spirv.empty()) {
         return -1;
     }
 
-    // Create shader modules
-    VkShaderModuleCreateInfo meshModuleInfo{};
-    meshModuleInfo.sType = VK_STRUCTURE_TYPE_SHADER_MODULE_CREATE_INFO;
-    meshModuleInfo.codeSize = meshSpirv.size() * sizeof(uint32_t);
-    meshModuleInfo.pCode = meshSpirv.data();
+    *wordCount = static_cast<uint32_t>(spirv.size());
+    if (!words || capacity < spirv.size()) {
+        return 1;
+    }
 
-    VkShaderModuleCreateInfo fragModuleInfo{};
-    fragModuleInfo.sType = VK_STRUCTURE_TYPE_SHADER_MODULE_CREATE_INFO;
-    fragModuleInfo.codeSize = fragSpirv.size() * sizeof(uint32_t);
-    fragModuleInfo.pCode = fragSpirv.data();
+    memcpy(words, spirv.data(), spirv.size() * sizeof(uint32_t));
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    if (vkCreateShaderModule(g_engine.device, &meshModuleInfo, nullptr, &g_engine.meshShaderModule) != VK_SUCCESS ||
-        vkCreateShaderModule(g_engine.device, &fragModuleInfo, nullptr, &g_engine.fragShaderModule) != VK_SUCCESS) {
-        Logger::get().error("Failed to create shader modules");
-        return -1;
-    }
+void boulder_set_shader_include_root(const char* dir) {
+    NATIVE_TRY
+    std::lock_guard<std::mutex> lock(g_engine.shaderCacheMutex);
+    g_engine.shaderIncludeRoot = dir ? dir : "";
+    NATIVE_CATCH()
+}
 
-    // Create pipeline layout with push constants
-    VkPushConstantRange pushConstantRange{};
-    pushConstantRange.stageFlags = VK_SHADER_STAGE_MESH_BIT_EXT;
-    pushConstantRange.offset = 0;
-    pushConstantRange.size = sizeof(glm::mat4) + sizeof(float); // viewProj + time
+void boulder_clear_shader_cache() {
+    NATIVE_TRY
+    std::lock_guard<std::mutex> lock(g_engine.shaderCacheMutex);
+    g_engine.shaderVariantCache.clear();
+    NATIVE_CATCH()
+}
 
-    VkPipelineLayoutCreateInfo pipelineLayoutInfo{};
-    pipelineLayoutInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_LAYOUT_CREATE_INFO;
-    pipelineLayoutInfo.pushConstantRangeCount = 1;
-    pipelineLayoutInfo.pPushConstantRanges = &pushConstantRange;
+void boulder_destroy_shader_module(ShaderModuleID shaderId) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.device) {
+        return;
+    }
 
-    if (vkCreatePipelineLayout(g_engine.device, &pipelineLayoutInfo, nullptr, &g_engine.pipelineLayout) != VK_SUCCESS) {
-        Logger::get().error("Failed to create pipeline layout");
-        return -1;
+    // Pipelines still compiling may be reading the module
+    if (g_engine.pendingShaderModules.count(shaderId) || !g_engine.pendingPipelines.empty()) {
+        pollAsyncCompiles(true);
     }
 
-    // Create graphics pipeline
-    VkPipelineShaderStageCreateInfo meshStage{};
-    meshStage.sType = VK_STRUCTURE_TYPE_PIPELINE_SHADER_STAGE_CREATE_INFO;
-    meshStage.stage = VK_SHADER_STAGE_MESH_BIT_EXT;
-    meshStage.module = g_engine.meshShaderModule;
-    meshStage.pName = "main";
+    auto it = g_engine.shaderModules.find(shaderId);
+    if (it != g_engine.shaderModules.end()) {
+        vkDestroyShaderModule(g_engine.device, it->second, nullptr);
+        g_engine.shaderModules.erase(it);
+        Logger::get().info("Destroyed shader module with ID {}", shaderId);
+    }
+    std::lock_guard<std::mutex> lock(g_engine.shaderCacheMutex);
+    g_engine.shaderErrors.erase(shaderId);
+    NATIVE_CATCH()
+}
 
-    VkPipelineShaderStageCreateInfo fragStage{};
-    fragStage.sType = VK_STRUCTURE_TYPE_PIPELINE_SHADER_STAGE_CREATE_INFO;
-    fragStage.stage = VK_SHADER_STAGE_FRAGMENT_BIT;
-    fragStage.module = g_engine.fragShaderModule;
-    fragStage.pName = "main";
+ShaderModuleID boulder_reload_shader(ShaderModuleID shaderId, const char* source, int shaderKind, const char* name) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.device || !source || !name) {
+        fail(ERROR_INVALID_ARGUMENT, "Cannot reload shader: engine not initialized or invalid parameters");
+        return 0;
+    }
 
-    VkPipelineShaderStageCreateInfo shaderStages[] = {meshStage, fragStage};
+    // Destroy old shader module if it exists
+    if (shaderId != 0) {
+        boulder_destroy_shader_module(shaderId);
+    }
 
-    // Dynamic state for viewport and scissor
-    VkDynamicState dynamicStates[] = {
-        VK_DYNAMIC_STATE_VIEWPORT,
-        VK_DYNAMIC_STATE_SCISSOR
-    };
+    // Create new shader module
+    return boulder_compile_shader(source, shaderKind, name);
+    NATIVE_CATCH(0)
+}
 
-    VkPipelineDynamicStateCreateInfo dynamicState{};
-    dynamicState.sType = VK_STRUCTURE_TYPE_PIPELINE_DYNAMIC_STATE_CREATE_INFO;
-    dynamicState.dynamicStateCount = 2;
-    dynamicState.pDynamicStates = dynamicStates;
+// Pipeline management
+// Creates a mesh shader pipeline drawing into the swapchain with depth testing, unless
+// other depth and stencil state is given. Blended modes test depth without writing it.
+static VkPipeline createPipeline(VkShaderModule meshModule, VkShaderModule fragModule, VkPipelineLayout layout,
+                                 VkCullModeFlags cullMode, VkFrontFace frontFace, int blendMode,
+                                 const VkPipelineDepthStencilStateCreateInfo* depthStencilState,
+                                 VkColorComponentFlags colorWriteMask) {
+    // Create shader stages
+    VkPipelineShaderStageCreateInfo meshShaderStageInfo{};
+    meshShaderStageInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_SHADER_STAGE_CREATE_INFO;
+    meshShaderStageInfo.stage = VK_SHADER_STAGE_MESH_BIT_EXT;
+    meshShaderStageInfo.module = meshModule;
+    meshShaderStageInfo.pName = "main";
 
-    // Viewport state (counts only, actual values set dynamically)
-    VkPipelineViewportStateCreateInfo viewportState{};
-    viewportState.sType = VK_STRUCTURE_TYPE_PIPELINE_VIEWPORT_STATE_CREATE_INFO;
-    viewportState.viewportCount = 1;
-    viewportState.scissorCount = 1;
+    VkPipelineShaderStageCreateInfo fragShaderStageInfo{};
+    fragShaderStageInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_SHADER_STAGE_CREATE_INFO;
+    fragShaderStageInfo.stage = VK_SHADER_STAGE_FRAGMENT_BIT;
+    fragShaderStageInfo.module = fragModule;
+    fragShaderStageInfo.pName = "main";
 
+    // Fragment shaders can read the blend mode as specialization constant 0, e.g. to
+    // discard in alpha test mode
+    VkSpecializationMapEntry blendModeEntry{0, 0, sizeof(int32_t)};
+    int32_t blendModeValue = blendMode;
+    VkSpecializationInfo specialization{1, &blendModeEntry, sizeof(int32_t), &blendModeValue};
+    fragShaderStageInfo.pSpecializationInfo = &specialization;
+
+    VkPipelineShaderStageCreateInfo shaderStages[] = {meshShaderStageInfo, fragShaderStageInfo};
+
+    // Rasterization state
     VkPipelineRasterizationStateCreateInfo rasterizer{};
     rasterizer.sType = VK_STRUCTURE_TYPE_PIPELINE_RASTERIZATION_STATE_CREATE_INFO;
+    rasterizer.depthClampEnable = VK_FALSE;
+    rasterizer.rasterizerDiscardEnable = VK_FALSE;
     rasterizer.polygonMode = VK_POLYGON_MODE_FILL;
-    rasterizer.cullMode = VK_CULL_MODE_NONE;  // Disable culling for debugging
-    rasterizer.frontFace = VK_FRONT_FACE_COUNTER_CLOCKWISE;
     rasterizer.lineWidth = 1.0f;
+    rasterizer.cullMode = cullMode;
+    rasterizer.frontFace = frontFace;
+    rasterizer.depthBiasEnable = VK_FALSE;
 
+    // Multisampling
     VkPipelineMultisampleStateCreateInfo multisampling{};
     multisampling.sType = VK_STRUCTURE_TYPE_PIPELINE_MULTISAMPLE_STATE_CREATE_INFO;
+    multisampling.sampleShadingEnable = VK_FALSE;
     multisampling.rasterizationSamples = VK_SAMPLE_COUNT_1_BIT;
 
+    // Color blending
     VkPipelineColorBlendAttachmentState colorBlendAttachment{};
-    colorBlendAttachment.colorWriteMask = VK_COLOR_COMPONENT_R_BIT | VK_COLOR_COMPONENT_G_BIT |
-                                           VK_COLOR_COMPONENT_B_BIT | VK_COLOR_COMPONENT_A_BIT;
+    colorBlendAttachment.colorWriteMask = colorWriteMask;
     colorBlendAttachment.blendEnable = VK_FALSE;
+    if (blendMode == BLEND_MODE_ALPHA_BLEND || blendMode == BLEND_MODE_ADDITIVE) {
+        colorBlendAttachment.blendEnable = VK_TRUE;
+        colorBlendAttachment.srcColorBlendFactor = VK_BLEND_FACTOR_SRC_ALPHA;
+        colorBlendAttachment.dstColorBlendFactor = blendMode == BLEND_MODE_ADDITIVE ? VK_BLEND_FACTOR_ONE
+                                                                                    : VK_BLEND_FACTOR_ONE_MINUS_SRC_ALPHA;
+        colorBlendAttachment.colorBlendOp = VK_BLEND_OP_ADD;
+        colorBlendAttachment.srcAlphaBlendFactor = VK_BLEND_FACTOR_ONE;
+        colorBlendAttachment.dstAlphaBlendFactor = VK_BLEND_FACTOR_ONE_MINUS_SRC_ALPHA;
+        colorBlendAttachment.alphaBlendOp = VK_BLEND_OP_ADD;
+    }
 
     VkPipelineColorBlendStateCreateInfo colorBlending{};
     colorBlending.sType = VK_STRUCTURE_TYPE_PIPELINE_COLOR_BLEND_STATE_CREATE_INFO;
+    colorBlending.logicOpEnable = VK_FALSE;
     colorBlending.attachmentCount = 1;
     colorBlending.pAttachments = &colorBlendAttachment;
 
@@ -1533,737 +9380,1390 @@ int boulder_create_window(int width, int height, const char* title) {
     VkPipelineDepthStencilStateCreateInfo depthStencil{};
     depthStencil.sType = VK_STRUCTURE_TYPE_PIPELINE_DEPTH_STENCIL_STATE_CREATE_INFO;
     depthStencil.depthTestEnable = VK_TRUE;
-    depthStencil.depthWriteEnable = VK_TRUE;
+    depthStencil.depthWriteEnable = colorBlendAttachment.blendEnable ? VK_FALSE : VK_TRUE;
     depthStencil.depthCompareOp = VK_COMPARE_OP_LESS;
     depthStencil.depthBoundsTestEnable = VK_FALSE;
     depthStencil.stencilTestEnable = VK_FALSE;
 
-    VkPipelineRenderingCreateInfo pipelineRenderingInfo{};
-    pipelineRenderingInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_RENDERING_CREATE_INFO;
-    pipelineRenderingInfo.colorAttachmentCount = 1;
-    pipelineRenderingInfo.pColorAttachmentFormats = &g_engine.swapchainFormat;
-    pipelineRenderingInfo.depthAttachmentFormat = g_engine.depthFormat;
+    // Dynamic state
+    VkDynamicState dynamicStates[] = {
+        VK_DYNAMIC_STATE_VIEWPORT,
+        VK_DYNAMIC_STATE_SCISSOR
+    };
+
+    VkPipelineDynamicStateCreateInfo dynamicState{};
+    dynamicState.sType = VK_STRUCTURE_TYPE_PIPELINE_DYNAMIC_STATE_CREATE_INFO;
+    dynamicState.dynamicStateCount = 2;
+    dynamicState.pDynamicStates = dynamicStates;
+
+    // Viewport state (counts only, actual values set dynamically)
+    VkPipelineViewportStateCreateInfo viewportState{};
+    viewportState.sType = VK_STRUCTURE_TYPE_PIPELINE_VIEWPORT_STATE_CREATE_INFO;
+    viewportState.viewportCount = 1;
+    viewportState.scissorCount = 1;
+
+    // Dynamic rendering info
+    VkPipelineRenderingCreateInfo renderingInfo{};
+    renderingInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_RENDERING_CREATE_INFO;
+    renderingInfo.colorAttachmentCount = 1;
+    renderingInfo.pColorAttachmentFormats = &g_engine.swapchainFormat;
+    renderingInfo.depthAttachmentFormat = g_engine.depthFormat;
+    renderingInfo.stencilAttachmentFormat = g_engine.stencilFormat;
 
+    // Create graphics pipeline
     VkGraphicsPipelineCreateInfo pipelineInfo{};
     pipelineInfo.sType = VK_STRUCTURE_TYPE_GRAPHICS_PIPELINE_CREATE_INFO;
-    pipelineInfo.pNext = &pipelineRenderingInfo;
+    pipelineInfo.pNext = &renderingInfo;
     pipelineInfo.stageCount = 2;
     pipelineInfo.pStages = shaderStages;
-    pipelineInfo.pViewportState = &viewportState;
     pipelineInfo.pRasterizationState = &rasterizer;
     pipelineInfo.pMultisampleState = &multisampling;
     pipelineInfo.pColorBlendState = &colorBlending;
-    pipelineInfo.pDepthStencilState = &depthStencil;
+    pipelineInfo.pDepthStencilState = depthStencilState ? depthStencilState : &depthStencil;
     pipelineInfo.pDynamicState = &dynamicState;
-    pipelineInfo.layout = g_engine.pipelineLayout;
+    pipelineInfo.pViewportState = &viewportState;
+    pipelineInfo.layout = layout;
+    pipelineInfo.renderPass = VK_NULL_HANDLE;
+    pipelineInfo.subpass = 0;
 
-    if (vkCreateGraphicsPipelines(g_engine.device, nullptr, 1, &pipelineInfo, nullptr, &g_engine.cubePipeline) != VK_SUCCESS) {
-        Logger::get().error("Failed to create graphics pipeline");
+    VkPipeline pipeline;
+    if (vkCreateGraphicsPipelines(g_engine.device, VK_NULL_HANDLE, 1, &pipelineInfo, nullptr, &pipeline) != VK_SUCCESS) {
+        return VK_NULL_HANDLE;
+    }
+    return pipeline;
+}
+
+PipelineID boulder_create_graphics_pipeline(ShaderModuleID meshShader, ShaderModuleID fragShader) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.device) {
+        fail(ERROR_NOT_INITIALIZED, "Cannot create pipeline: engine not initialized");
+        return 0;
+    }
+
+    auto meshIt = g_engine.shaderModules.find(meshShader);
+    auto fragIt = g_engine.shaderModules.find(fragShader);
+
+    if (meshIt == g_engine.shaderModules.end() || fragIt == g_engine.shaderModules.end()) {
+        fail(ERROR_INVALID_ARGUMENT, "Cannot create pipeline: invalid shader module IDs");
+        return 0;
+    }
+
+    // Create pipeline layout with push constants
+    VkPushConstantRange pushConstantRange{};
+    pushConstantRange.stageFlags = VK_SHADER_STAGE_MESH_BIT_EXT;
+    pushConstantRange.offset = 0;
+    pushConstantRange.size = GRAPHICS_PUSH_CONSTANT_SIZE; // Transform matrix
+
+    VkPipelineLayoutCreateInfo layoutInfo{};
+    layoutInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_LAYOUT_CREATE_INFO;
+    layoutInfo.pushConstantRangeCount = 1;
+    layoutInfo.pPushConstantRanges = &pushConstantRange;
+
+    VkPipelineLayout pipelineLayout;
+    if (vkCreatePipelineLayout(g_engine.device, &layoutInfo, nullptr, &pipelineLayout) != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to create pipeline layout");
+        return 0;
+    }
+
+    VkPipeline pipeline = createPipeline(meshIt->second, fragIt->second, pipelineLayout,
+                                         VK_CULL_MODE_BACK_BIT, VK_FRONT_FACE_CLOCKWISE);
+    if (!pipeline) {
+        fail(ERROR_VULKAN, "Failed to create graphics pipeline");
+        vkDestroyPipelineLayout(g_engine.device, pipelineLayout, nullptr);
+        return 0;
+    }
+
+    uint64_t id = g_engine.nextPipelineId++;
+    g_engine.pipelines[id] = pipeline;
+    g_engine.pipelineLayouts[id] = pipelineLayout;
+
+    Logger::get().info("Graphics pipeline created with ID {}", id);
+    return id;
+    NATIVE_CATCH(0)
+}
+
+int boulder_bind_pipeline(PipelineID pipelineId) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.activeCommandBuffer) {
+        apiMisuse("Bind called outside a frame (call BeginFrame first)");
         return -1;
     }
 
-    Logger::get().info("Vulkan rendering setup complete!");
+    auto it = g_engine.pipelines.find(pipelineId);
+    if (it == g_engine.pipelines.end()) {
+        if (g_engine.destroyedPipelines.count(pipelineId)) {
+            apiMisuse(std::format("Bind called on pipeline {}, which was destroyed", pipelineId));
+        } else if (g_engine.pendingPipelines.count(pipelineId)) {
+            apiMisuse(std::format("Bind called on pipeline {}, which is still compiling", pipelineId));
+        } else {
+            apiMisuse(std::format("Bind called on unknown pipeline {}", pipelineId));
+        }
+        return -1;
+    }
 
-    // Create model rendering pipeline for loaded geometry
-    Logger::get().info("Creating model rendering pipeline...");
+    vkCmdBindPipeline(g_engine.activeCommandBuffer, VK_PIPELINE_BIND_POINT_GRAPHICS, it->second);
+    g_engine.boundPipeline = it->second;
+    g_engine.boundPipelineId = pipelineId;
+    g_engine.framePipelines.insert(pipelineId);
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    // Load model shaders
-    std::ifstream modelMeshFile("shaders/model.mesh");
-    std::string modelMeshSource((std::istreambuf_iterator<char>(modelMeshFile)), std::istreambuf_iterator<char>());
+void boulder_destroy_pipeline(PipelineID pipelineId) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.device) {
+        return;
+    }
 
-    std::ifstream modelFragFile("shaders/model.frag");
-    std::string modelFragSource((std::istreambuf_iterator<char>(modelFragFile)), std::istreambuf_iterator<char>());
+    if (g_engine.activeCommandBuffer && g_engine.framePipelines.count(pipelineId)) {
+        apiMisuse(std::format("pipeline {} destroyed after being bound in the frame being recorded "
+                              "(destroy it after EndFrame)", pipelineId));
+        return;
+    }
 
-    if (!modelMeshSource.empty() && !modelFragSource.empty()) {
-        auto modelMeshSpirv = compileShader(modelMeshSource, shaderc_glsl_default_mesh_shader, "model.mesh");
-        auto modelFragSpirv = compileShader(modelFragSource, shaderc_glsl_default_fragment_shader, "model.frag");
+    if (g_engine.pendingPipelines.count(pipelineId)) {
+        pollAsyncCompiles(true);
+    }
+    {
+        std::lock_guard<std::mutex> lock(g_engine.shaderCacheMutex);
+        g_engine.pipelineErrors.erase(pipelineId);
+    }
 
-        if (!modelMeshSpirv.empty() && !modelFragSpirv.empty()) {
-            // Create shader modules
-            VkShaderModuleCreateInfo meshModuleInfo{};
-            meshModuleInfo.sType = VK_STRUCTURE_TYPE_SHADER_MODULE_CREATE_INFO;
-            meshModuleInfo.codeSize = modelMeshSpirv.size() * sizeof(uint32_t);
-            meshModuleInfo.pCode = modelMeshSpirv.data();
-            vkCreateShaderModule(g_engine.device, &meshModuleInfo, nullptr, &g_engine.modelMeshShader);
+    auto pipelineIt = g_engine.pipelines.find(pipelineId);
+    auto layoutIt = g_engine.pipelineLayouts.find(pipelineId);
+    if (pipelineIt == g_engine.pipelines.end()) {
+        return;
+    }
 
-            VkShaderModuleCreateInfo fragModuleInfo{};
-            fragModuleInfo.sType = VK_STRUCTURE_TYPE_SHADER_MODULE_CREATE_INFO;
-            fragModuleInfo.codeSize = modelFragSpirv.size() * sizeof(uint32_t);
-            fragModuleInfo.pCode = modelFragSpirv.data();
-            vkCreateShaderModule(g_engine.device, &fragModuleInfo, nullptr, &g_engine.modelFragShader);
+    // Frames in flight may still draw with it
+    vkDeviceWaitIdle(g_engine.device);
+    if (g_engine.debugMode) {
+        g_engine.destroyedPipelines.insert(pipelineId);
+    }
 
-            // Create descriptor set layout for storage buffers
-            VkDescriptorSetLayoutBinding bindings[3] = {};
+    vkDestroyPipeline(g_engine.device, pipelineIt->second, nullptr);
+    g_engine.pipelines.erase(pipelineIt);
 
-            // Binding 0: Vertex buffer (SSBO)
-            bindings[0].binding = 0;
-            bindings[0].descriptorType = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
-            bindings[0].descriptorCount = 1;
-            bindings[0].stageFlags = VK_SHADER_STAGE_MESH_BIT_EXT;
+    if (layoutIt != g_engine.pipelineLayouts.end()) {
+        vkDestroyPipelineLayout(g_engine.device, layoutIt->second, nullptr);
+        g_engine.pipelineLayouts.erase(layoutIt);
+    }
+    g_engine.materialPipelines.erase(pipelineId);
+    g_engine.materialParamNames.erase(pipelineId);
+    auto variantsIt = g_engine.materialBlendPipelines.find(pipelineId);
+    if (variantsIt != g_engine.materialBlendPipelines.end()) {
+        for (VkPipeline variant : variantsIt->second) {
+            if (variant) {
+                vkDestroyPipeline(g_engine.device, variant, nullptr);
+            }
+        }
+        g_engine.materialBlendPipelines.erase(variantsIt);
+    }
 
-            // Binding 1: Index buffer (SSBO)
-            bindings[1].binding = 1;
-            bindings[1].descriptorType = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
-            bindings[1].descriptorCount = 1;
-            bindings[1].stageFlags = VK_SHADER_STAGE_MESH_BIT_EXT;
+    Logger::get().info("Destroyed pipeline with ID {}", pipelineId);
+    NATIVE_CATCH()
+}
 
-            // Binding 2: Draw params (SSBO)
-            bindings[2].binding = 2;
-            bindings[2].descriptorType = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
-            bindings[2].descriptorCount = 1;
-            bindings[2].stageFlags = VK_SHADER_STAGE_MESH_BIT_EXT;
+// Custom materials
+
+// Creates a material pipeline for every blend mode, or none on failure. Safe to call from
+// worker threads.
+static std::array<VkPipeline, BLEND_MODE_COUNT> createMaterialPipelines(VkShaderModule meshModule, VkShaderModule fragModule) {
+    // Same rasterization as the model pipeline, so materials can replace it one for one.
+    // Every blend mode is created up front, as the shader modules may be destroyed later.
+    std::array<VkPipeline, BLEND_MODE_COUNT> variants{};
+    for (int mode = 0; mode < BLEND_MODE_COUNT; mode++) {
+        variants[mode] = createPipeline(meshModule, fragModule, g_engine.materialPipelineLayout,
+                                        VK_CULL_MODE_NONE, VK_FRONT_FACE_COUNTER_CLOCKWISE, mode);
+        if (!variants[mode]) {
+            fail(ERROR_VULKAN, "Failed to create material pipeline");
+            for (VkPipeline variant : variants) {
+                if (variant) {
+                    vkDestroyPipeline(g_engine.device, variant, nullptr);
+                }
+            }
+            return {};
+        }
+    }
+    return variants;
+}
 
-            VkDescriptorSetLayoutCreateInfo descriptorLayoutInfo{};
-            descriptorLayoutInfo.sType = VK_STRUCTURE_TYPE_DESCRIPTOR_SET_LAYOUT_CREATE_INFO;
-            descriptorLayoutInfo.bindingCount = 3;
-            descriptorLayoutInfo.pBindings = bindings;
-            vkCreateDescriptorSetLayout(g_engine.device, &descriptorLayoutInfo, nullptr, &g_engine.modelDescriptorSetLayout);
+// Registers the pipelines from createMaterialPipelines under a pipeline ID
+static void addMaterialPipelines(uint64_t id, std::array<VkPipeline, BLEND_MODE_COUNT> variants) {
+    g_engine.pipelines[id] = variants[BLEND_MODE_OPAQUE];
+    variants[BLEND_MODE_OPAQUE] = VK_NULL_HANDLE;
+    g_engine.materialBlendPipelines[id] = variants;
+    g_engine.materialPipelines.insert(id);
+}
 
-            // Create pipeline layout with push constants
-            VkPushConstantRange modelPushConstant{};
-            modelPushConstant.stageFlags = VK_SHADER_STAGE_MESH_BIT_EXT;
-            modelPushConstant.offset = 0;
-            modelPushConstant.size = sizeof(glm::mat4) * 2 + sizeof(uint32_t) * 2; // viewProj + model + 2 offsets
+// Whether an ID is a material pipeline, ready or still compiling
+static bool isMaterialPipeline(uint64_t id) {
+    return g_engine.materialPipelines.count(id) || g_engine.pendingPipelines.count(id);
+}
 
-            VkPipelineLayoutCreateInfo modelLayoutInfo{};
-            modelLayoutInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_LAYOUT_CREATE_INFO;
-            modelLayoutInfo.setLayoutCount = 1;
-            modelLayoutInfo.pSetLayouts = &g_engine.modelDescriptorSetLayout;
-            modelLayoutInfo.pushConstantRangeCount = 1;
-            modelLayoutInfo.pPushConstantRanges = &modelPushConstant;
-            vkCreatePipelineLayout(g_engine.device, &modelLayoutInfo, nullptr, &g_engine.modelPipelineLayout);
+PipelineID boulder_create_material_pipeline(ShaderModuleID meshShader, ShaderModuleID fragShader) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.device || !g_engine.materialPipelineLayout) {
+        fail(ERROR_UNSUPPORTED, "Cannot create material pipeline: model rendering not available");
+        return 0;
+    }
+
+    // Shaders compiled asynchronously have to finish first
+    if (g_engine.pendingShaderModules.count(meshShader) || g_engine.pendingShaderModules.count(fragShader)) {
+        pollAsyncCompiles(true);
+    }
+
+    auto meshIt = g_engine.shaderModules.find(meshShader);
+    auto fragIt = g_engine.shaderModules.find(fragShader);
+    if (meshIt == g_engine.shaderModules.end() || fragIt == g_engine.shaderModules.end()) {
+        fail(ERROR_INVALID_ARGUMENT, "Cannot create material pipeline: invalid shader module IDs");
+        return 0;
+    }
 
-            // Create model pipeline (similar to cube pipeline but with descriptor sets)
-            VkPipelineShaderStageCreateInfo modelShaderStages[2] = {};
-            modelShaderStages[0].sType = VK_STRUCTURE_TYPE_PIPELINE_SHADER_STAGE_CREATE_INFO;
-            modelShaderStages[0].stage = VK_SHADER_STAGE_MESH_BIT_EXT;
-            modelShaderStages[0].module = g_engine.modelMeshShader;
-            modelShaderStages[0].pName = "main";
+    auto variants = createMaterialPipelines(meshIt->second, fragIt->second);
+    if (!variants[BLEND_MODE_OPAQUE]) {
+        return 0;
+    }
 
-            modelShaderStages[1].sType = VK_STRUCTURE_TYPE_PIPELINE_SHADER_STAGE_CREATE_INFO;
-            modelShaderStages[1].stage = VK_SHADER_STAGE_FRAGMENT_BIT;
-            modelShaderStages[1].module = g_engine.modelFragShader;
-            modelShaderStages[1].pName = "main";
+    uint64_t id = g_engine.nextPipelineId++;
+    addMaterialPipelines(id, variants);
 
-            VkGraphicsPipelineCreateInfo modelPipelineInfo{};
-            modelPipelineInfo.sType = VK_STRUCTURE_TYPE_GRAPHICS_PIPELINE_CREATE_INFO;
-            modelPipelineInfo.pNext = &pipelineRenderingInfo;
-            modelPipelineInfo.stageCount = 2;
-            modelPipelineInfo.pStages = modelShaderStages;
-            modelPipelineInfo.pViewportState = &viewportState;
-            modelPipelineInfo.pRasterizationState = &rasterizer;
-            modelPipelineInfo.pMultisampleState = &multisampling;
-            modelPipelineInfo.pColorBlendState = &colorBlending;
-            modelPipelineInfo.pDepthStencilState = &depthStencil;
-            modelPipelineInfo.pDynamicState = &dynamicState;
-            modelPipelineInfo.layout = g_engine.modelPipelineLayout;
+    Logger::get().info("Material pipeline created with ID {}", id);
+    return id;
+    NATIVE_CATCH(0)
+}
 
-            if (vkCreateGraphicsPipelines(g_engine.device, nullptr, 1, &modelPipelineInfo, nullptr, &g_engine.modelPipeline) == VK_SUCCESS) {
-                Logger::get().info("✓ Model rendering pipeline created");
+// Async compilation
 
-                // Create descriptor pools for model rendering (one per frame-in-flight)
-                // Support up to 1000 descriptor sets with 3 storage buffers each per pool
-                VkDescriptorPoolSize poolSize{};
-                poolSize.type = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
-                poolSize.descriptorCount = 3000; // 1000 sets * 3 bindings
+// Moves finished async compiles into shaderModules and pipelines, waiting for all of them
+// if wait is set. Returns how many are still compiling.
+static size_t pollAsyncCompiles(bool wait) {
+    auto finished = [wait](const auto& job) {
+        return wait || job.wait_for(std::chrono::seconds(0)) == std::future_status::ready;
+    };
 
-                VkDescriptorPoolCreateInfo poolInfo{};
-                poolInfo.sType = VK_STRUCTURE_TYPE_DESCRIPTOR_POOL_CREATE_INFO;
-                poolInfo.flags = VK_DESCRIPTOR_POOL_CREATE_FREE_DESCRIPTOR_SET_BIT;
-                poolInfo.poolSizeCount = 1;
-                poolInfo.pPoolSizes = &poolSize;
-                poolInfo.maxSets = 1000;
+    for (auto it = g_engine.pendingShaderModules.begin(); it != g_engine.pendingShaderModules.end();) {
+        if (!finished(it->second)) {
+            ++it;
+            continue;
+        }
+        if (VkShaderModule shaderModule = it->second.get()) {
+            g_engine.shaderModules[it->first] = shaderModule;
+            Logger::get().info("Shader module {} finished compiling", it->first);
+        } else {
+            Logger::get().error("Async compile of shader module {} failed", it->first);
+        }
+        it = g_engine.pendingShaderModules.erase(it);
+    }
 
-                for (size_t i = 0; i < MAX_FRAMES_IN_FLIGHT; i++) {
-                    if (vkCreateDescriptorPool(g_engine.device, &poolInfo, nullptr, &g_engine.modelDescriptorPools[i]) != VK_SUCCESS) {
-                        Logger::get().error("Failed to create model descriptor pool {}", i);
-                    }
-                }
-                Logger::get().info("✓ Model descriptor pools created ({} pools)", MAX_FRAMES_IN_FLIGHT);
-            } else {
-                Logger::get().error("Failed to create model pipeline");
-            }
+    for (auto it = g_engine.pendingPipelines.begin(); it != g_engine.pendingPipelines.end();) {
+        if (!finished(it->second)) {
+            ++it;
+            continue;
+        }
+        auto variants = it->second.get();
+        if (variants[BLEND_MODE_OPAQUE]) {
+            addMaterialPipelines(it->first, variants);
+            Logger::get().info("Material pipeline {} finished compiling", it->first);
         } else {
-            Logger::get().warning("Model shaders not compiled - model rendering disabled");
+            g_engine.materialParamNames.erase(it->first);
+            Logger::get().error("Async compile of material pipeline {} failed", it->first);
         }
-    } else {
-        Logger::get().warning("Model shader files not found - model rendering disabled");
+        it = g_engine.pendingPipelines.erase(it);
     }
 
-    // Initialize UI system now that all Vulkan resources are ready
-    if (boulder_ui_init() != 0) {
-        Logger::get().error("Failed to initialize UI system (non-fatal)");
-        // Don't fail window creation if UI init fails
+    return g_engine.pendingShaderModules.size() + g_engine.pendingPipelines.size();
+}
+
+ShaderModuleID boulder_compile_shader_async(const char* source, int shaderKind, const char* name,
+                                            const char** defines, uint32_t defineCount) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.device || !source || !name || (defineCount > 0 && !defines)) {
+        fail(ERROR_INVALID_ARGUMENT, "Cannot compile shader: engine not initialized or invalid parameters");
+        return 0;
     }
 
-    return g_engine.window ? 0 : -1;
+    std::vector<std::pair<std::string, std::string>> macros;
+    if (!parseShaderDefines(name, defines, defineCount, macros)) {
+        return 0;
+    }
+
+    uint64_t id = g_engine.nextShaderModuleId++;
+    g_engine.pendingShaderModules[id] = std::async(std::launch::async,
+        [id, source = std::string(source), kind = static_cast<shaderc_shader_kind>(shaderKind),
+         name = std::string(name), macros]() {
+            VkShaderModule shaderModule = compileShaderModule(source, kind, name.c_str(), macros);
+            if (!shaderModule) {
+                std::lock_guard<std::mutex> lock(g_engine.shaderCacheMutex);
+                g_engine.shaderErrors[id] = t_lastError.message;
+            }
+            return shaderModule;
+        }).share();
 
+    Logger::get().info("Shader module {} compiling with ID {}", name, id);
+    return id;
+    NATIVE_CATCH(0)
 }
 
-void boulder_set_window_size(int width, int height) {
-    if (g_engine.window) {
-        SDL_SetWindowSize(g_engine.window, width, height);
-        g_engine.swapchainNeedsRecreate = true;
+PipelineID boulder_create_material_pipeline_async(ShaderModuleID meshShader, ShaderModuleID fragShader) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.device || !g_engine.materialPipelineLayout) {
+        fail(ERROR_UNSUPPORTED, "Cannot create material pipeline: model rendering not available");
+        return 0;
+    }
+
+    // Ready modules are handed over as already finished jobs, so the worker can wait on
+    // shaders still compiling without blocking this thread
+    auto moduleJob = [](uint64_t id) -> std::shared_future<VkShaderModule> {
+        auto pending = g_engine.pendingShaderModules.find(id);
+        if (pending != g_engine.pendingShaderModules.end()) {
+            return pending->second;
+        }
+        auto ready = g_engine.shaderModules.find(id);
+        if (ready == g_engine.shaderModules.end()) {
+            return {};
+        }
+        std::promise<VkShaderModule> module;
+        module.set_value(ready->second);
+        return module.get_future().share();
+    };
+
+    auto meshJob = moduleJob(meshShader);
+    auto fragJob = moduleJob(fragShader);
+    if (!meshJob.valid() || !fragJob.valid()) {
+        fail(ERROR_INVALID_ARGUMENT, "Cannot create material pipeline: invalid shader module IDs");
+        return 0;
     }
+
+    uint64_t id = g_engine.nextPipelineId++;
+    g_engine.pendingPipelines[id] = std::async(std::launch::async, [id, meshShader, fragShader, meshJob, fragJob]() {
+        VkShaderModule meshModule = meshJob.get();
+        VkShaderModule fragModule = fragJob.get();
+        std::array<VkPipeline, BLEND_MODE_COUNT> variants{};
+        LastError error;
+        if (!meshModule || !fragModule) {
+            uint64_t failed = meshModule ? fragShader : meshShader;
+            std::lock_guard<std::mutex> lock(g_engine.shaderCacheMutex);
+            error = {ERROR_SHADER, std::format("Shader module {} failed to compile", failed)};
+            auto output = g_engine.shaderErrors.find(failed);
+            if (output != g_engine.shaderErrors.end()) {
+                error.message += ": " + output->second;
+            }
+        } else {
+            variants = createMaterialPipelines(meshModule, fragModule);
+            error = t_lastError;
+        }
+        if (!variants[BLEND_MODE_OPAQUE]) {
+            std::lock_guard<std::mutex> lock(g_engine.shaderCacheMutex);
+            g_engine.pipelineErrors[id] = std::move(error);
+        }
+        return variants;
+    });
+
+    Logger::get().info("Material pipeline compiling with ID {}", id);
+    return id;
+    NATIVE_CATCH(0)
 }
 
-void boulder_get_window_size(int* width, int* height) {
-    if (g_engine.window && width && height) {
-        SDL_GetWindowSize(g_engine.window, width, height);
+int boulder_get_shader_status(ShaderModuleID shaderId) {
+    NATIVE_TRY
+    pollAsyncCompiles(false);
+    if (g_engine.pendingShaderModules.count(shaderId)) {
+        return 0;
     }
+    return g_engine.shaderModules.count(shaderId) ? 1 : -1;
+    NATIVE_CATCH(-1)
 }
 
-int boulder_should_close() {
-    return g_engine.shouldClose ? 1 : 0;
+uint32_t boulder_get_shader_error(ShaderModuleID shaderId, char* buffer, uint32_t capacity) {
+    NATIVE_TRY
+    pollAsyncCompiles(false);
+    std::lock_guard<std::mutex> lock(g_engine.shaderCacheMutex);
+    auto it = g_engine.shaderErrors.find(shaderId);
+    return copyString(it != g_engine.shaderErrors.end() ? it->second.c_str() : "", buffer, capacity);
+    NATIVE_CATCH(0)
 }
 
-void boulder_poll_events() {
-    SDL_Event event;
-    while (SDL_PollEvent(&event)) {
-        switch (event.type) {
-            case SDL_EVENT_QUIT:
-                g_engine.shouldClose = true;
-                break;
-            case SDL_EVENT_WINDOW_RESIZED:
-            case SDL_EVENT_WINDOW_PIXEL_SIZE_CHANGED:
-                // Set flag to indicate resize needed
-                g_engine.swapchainNeedsRecreate = true;
-                // Track if this happened during swapchain recreation
-                if (g_engine.isRecreatingSwapchain) {
-                    g_engine.resizeEventDuringRecreate = true;
-                }
-                break;
-            default:
-                break;
-        }
+int boulder_get_pipeline_status(PipelineID pipelineId) {
+    NATIVE_TRY
+    pollAsyncCompiles(false);
+    if (g_engine.pendingPipelines.count(pipelineId)) {
+        return 0;
     }
+    return g_engine.pipelines.count(pipelineId) ? 1 : -1;
+    NATIVE_CATCH(-1)
 }
 
-EntityID boulder_create_entity() {
-    if (!g_engine.ecs) {
+uint32_t boulder_get_pipeline_error(PipelineID pipelineId, int* code, char* buffer, uint32_t capacity) {
+    NATIVE_TRY
+    pollAsyncCompiles(false);
+    std::lock_guard<std::mutex> lock(g_engine.shaderCacheMutex);
+    auto it = g_engine.pipelineErrors.find(pipelineId);
+    if (it == g_engine.pipelineErrors.end()) {
         return 0;
     }
+    if (code) {
+        *code = it->second.code;
+    }
+    return copyString(it->second.message.c_str(), buffer, capacity);
+    NATIVE_CATCH(0)
+}
 
-    flecs::entity e = g_engine.ecs->entity();
-    return e.id();
+uint32_t boulder_get_pending_compiles() {
+    NATIVE_TRY
+    return static_cast<uint32_t>(pollAsyncCompiles(false));
+    NATIVE_CATCH(0)
 }
 
-void boulder_destroy_entity(EntityID entity) {
-    if (!g_engine.ecs) {
-        return;
+void boulder_wait_async_compiles() {
+    NATIVE_TRY
+    pollAsyncCompiles(true);
+    NATIVE_CATCH()
+}
+
+int boulder_set_model_pipeline(EntityID entity, PipelineID pipelineId) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs) {
+        return -1;
     }
 
+    if (!g_engine.ecs->is_alive(entity)) {
+        return -1;
+    }
     flecs::entity e = g_engine.ecs->entity(entity);
-    e.destruct();
+
+    if (pipelineId == 0) {
+        if (Material* material = e.get_mut<Material>()) {
+            material->pipeline = 0;
+        }
+        return 0;
+    }
+    if (!isMaterialPipeline(pipelineId)) {
+        fail(ERROR_INVALID_ARGUMENT, "Cannot set model pipeline: {} is not a material pipeline", pipelineId);
+        return -1;
+    }
+
+    Material material;
+    if (const Material* existing = e.get<Material>()) {
+        material = *existing;
+    }
+    material.pipeline = pipelineId;
+    e.set<Material>(material);
+    return 0;
+    NATIVE_CATCH(-1)
 }
 
-int boulder_entity_exists(EntityID entity) {
-    if (!g_engine.ecs) {
+PipelineID boulder_get_model_pipeline(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs) {
         return 0;
     }
 
+    if (!g_engine.ecs->is_alive(entity)) {
+        return 0;
+    }
     flecs::entity e = g_engine.ecs->entity(entity);
-    return e.is_alive() ? 1 : 0;
+
+    const Material* material = e.get<Material>();
+    return material ? material->pipeline : 0;
+    NATIVE_CATCH(0)
 }
 
-int boulder_add_transform(EntityID entity, float x, float y, float z) {
-    if (!g_engine.ecs) {
+int boulder_set_material_params(EntityID entity, const void* data, uint32_t size) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs || size > MATERIAL_MAX_PARAMS || (size > 0 && !data)) {
         return -1;
     }
 
+    if (!g_engine.ecs->is_alive(entity)) {
+        return -1;
+    }
     flecs::entity e = g_engine.ecs->entity(entity);
-    e.set<Transform>({
-        .position = glm::vec3(x, y, z),
-        .rotation = glm::vec3(0.0f),
-        .scale = glm::vec3(1.0f)
-    });
 
+    Material material;
+    if (const Material* existing = e.get<Material>()) {
+        material = *existing;
+    }
+    memset(material.params, 0, sizeof(material.params));
+    if (size > 0) {
+        memcpy(material.params, data, size);
+    }
+    material.paramSize = size;
+    e.set<Material>(material);
     return 0;
+    NATIVE_CATCH(-1)
 }
 
-int boulder_get_transform(EntityID entity, float* x, float* y, float* z) {
-    if (!g_engine.ecs || !x || !y || !z) {
+int boulder_set_material_texture(EntityID entity, uint32_t slot, TextureID texture) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs || slot >= MATERIAL_MAX_TEXTURES) {
+        return -1;
+    }
+    if (texture != 0 && !g_engine.textures.count(texture)) {
         return -1;
     }
 
-    flecs::entity e = g_engine.ecs->entity(entity);
-    const Transform* t = e.get<Transform>();
-    if (!t) {
+    if (!g_engine.ecs->is_alive(entity)) {
         return -1;
     }
+    flecs::entity e = g_engine.ecs->entity(entity);
 
-    *x = t->position.x;
-    *y = t->position.y;
-    *z = t->position.z;
+    Material material;
+    if (const Material* existing = e.get<Material>()) {
+        material = *existing;
+    }
+    material.textures[slot] = texture;
+    e.set<Material>(material);
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
+int boulder_define_material_param(PipelineID pipelineId, const char* name, uint32_t offset) {
+    NATIVE_TRY
+    if (!name || !*name || !isMaterialPipeline(pipelineId) ||
+        offset % 4 != 0 || offset + sizeof(float) > MATERIAL_MAX_PARAMS) {
+        return -1;
+    }
+
+    g_engine.materialParamNames[pipelineId][name] = offset;
     return 0;
+    NATIVE_CATCH(-1)
 }
 
-int boulder_get_full_transform(EntityID entity,
-                               float* px, float* py, float* pz,
-                               float* rx, float* ry, float* rz,
-                               float* sx, float* sy, float* sz) {
-    if (!g_engine.ecs) {
+// Byte offset of a named float in the parameter block of an entity's material, or -1
+static int materialParamOffset(const Material* material, const char* name) {
+    if (!material || !name) {
         return -1;
     }
+    auto names = g_engine.materialParamNames.find(material->pipeline);
+    if (names == g_engine.materialParamNames.end()) {
+        return -1;
+    }
+    auto it = names->second.find(name);
+    return it == names->second.end() ? -1 : static_cast<int>(it->second);
+}
 
+int boulder_set_material_float(EntityID entity, const char* name, float value) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs || !g_engine.ecs->is_alive(entity)) {
+        return -1;
+    }
     flecs::entity e = g_engine.ecs->entity(entity);
-    const Transform* t = e.get<Transform>();
-    if (!t) {
+
+    const Material* existing = e.get<Material>();
+    int offset = materialParamOffset(existing, name);
+    if (offset < 0) {
         return -1;
     }
 
-    if (px) *px = t->position.x;
-    if (py) *py = t->position.y;
-    if (pz) *pz = t->position.z;
+    Material material = *existing;
+    memcpy(material.params + offset, &value, sizeof(float));
+    material.paramSize = std::max<uint32_t>(material.paramSize, offset + sizeof(float));
+    e.set<Material>(material);
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    if (rx) *rx = t->rotation.x;
-    if (ry) *ry = t->rotation.y;
-    if (rz) *rz = t->rotation.z;
+int boulder_get_material_float(EntityID entity, const char* name, float* value) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs || !value || !g_engine.ecs->is_alive(entity)) {
+        return -1;
+    }
 
-    if (sx) *sx = t->scale.x;
-    if (sy) *sy = t->scale.y;
-    if (sz) *sz = t->scale.z;
+    const Material* material = g_engine.ecs->entity(entity).get<Material>();
+    int offset = materialParamOffset(material, name);
+    if (offset < 0) {
+        return -1;
+    }
 
+    memcpy(value, material->params + offset, sizeof(float));
     return 0;
+    NATIVE_CATCH(-1)
 }
 
-int boulder_set_full_transform(EntityID entity,
-                              float px, float py, float pz,
-                              float rx, float ry, float rz,
-                              float sx, float sy, float sz) {
-    if (!g_engine.ecs) {
+// Model of a live entity with materials from its file, or nullptr
+static Model* materialModel(EntityID entity) {
+    if (!g_engine.initialized || !g_engine.ecs || !g_engine.ecs->is_alive(entity)) {
+        return nullptr;
+    }
+    Model* model = g_engine.ecs->entity(entity).get_mut<Model>();
+    return model && model->fileMaterials ? model : nullptr;
+}
+
+int boulder_get_model_path(EntityID entity, char* path, uint32_t pathSize) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs || !path || pathSize == 0 || !g_engine.ecs->is_alive(entity)) {
+        return -1;
+    }
+    const Model* model = g_engine.ecs->entity(entity).get<Model>();
+    if (!model) {
         return -1;
     }
 
-    flecs::entity e = g_engine.ecs->entity(entity);
-    Transform* t = e.get_mut<Transform>();
-    if (!t) {
+    snprintf(path, pathSize, "%s", model->path.c_str());
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_model_material_count(EntityID entity) {
+    NATIVE_TRY
+    const Model* model = materialModel(entity);
+    return model ? static_cast<int>(model->fileMaterials->materials.size()) : 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_model_material(EntityID entity, int index, StandardMaterial* material, char* name, uint32_t nameSize) {
+    NATIVE_TRY
+    const Model* model = materialModel(entity);
+    if (!model || !material || index < 0 || index >= static_cast<int>(model->fileMaterials->materials.size())) {
         return -1;
     }
 
-    t->position = glm::vec3(px, py, pz);
-    t->rotation = glm::vec3(rx, ry, rz);
-    t->scale = glm::vec3(sx, sy, sz);
+    const ModelFileMaterial& fileMaterial = model->fileMaterials->materials[index];
+    *material = fileMaterial.values;
+    if (name && nameSize > 0) {
+        snprintf(name, nameSize, "%s", fileMaterial.name.c_str());
+    }
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_model_material_texture(EntityID entity, int index, int slot, char* path, uint32_t pathSize) {
+    NATIVE_TRY
+    const Model* model = materialModel(entity);
+    if (!model || !path || pathSize == 0 || index < 0 ||
+        index >= static_cast<int>(model->fileMaterials->materials.size()) || slot < 0 || slot >= MATERIAL_MAX_TEXTURES) {
+        return -1;
+    }
+
+    snprintf(path, pathSize, "%s", model->fileMaterials->materials[index].textures[slot].c_str());
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_model_embedded_texture(EntityID entity, int index, void* data, uint32_t capacity,
+                                       uint32_t* width, uint32_t* height) {
+    NATIVE_TRY
+    const Model* model = materialModel(entity);
+    if (!model || !width || !height || index < 0 || index >= static_cast<int>(model->fileMaterials->embedded.size())) {
+        return -1;
+    }
+
+    const EmbeddedTexture& texture = model->fileMaterials->embedded[index];
+    *width = texture.width;
+    *height = texture.height;
+    if (data && capacity >= texture.data.size()) {
+        memcpy(data, texture.data.data(), texture.data.size());
+    }
+    return static_cast<int>(texture.data.size());
+    NATIVE_CATCH(-1)
+}
+
+int boulder_set_model_material(EntityID entity, int index, const StandardMaterial* material, const TextureID* textures) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs || !material || !textures || !g_engine.ecs->is_alive(entity)) {
+        return -1;
+    }
+    for (int slot = 0; slot < MATERIAL_MAX_TEXTURES; slot++) {
+        if (textures[slot] != 0 && !g_engine.textures.count(textures[slot])) {
+            return -1;
+        }
+    }
+    flecs::entity e = g_engine.ecs->entity(entity);
+
+    Material values;
+    writeStandardParams(values, *material);
+    memcpy(values.textures, textures, sizeof(values.textures));
+
+    Model* model = e.get_mut<Model>();
+    if (index >= 0) {
+        if (!model || index >= static_cast<int>(model->materials.size())) {
+            return -1;
+        }
+        model->materials[index] = values;
+        return 0;
+    }
+
+    // Every file material, and the entity's own for meshes without one
+    if (model) {
+        std::fill(model->materials.begin(), model->materials.end(), values);
+    }
+    Material own;
+    if (const Material* existing = e.get<Material>()) {
+        own = *existing;
+    }
+    memcpy(own.params, values.params, sizeof(own.params));
+    own.paramSize = values.paramSize;
+    memcpy(own.textures, values.textures, sizeof(own.textures));
+    e.set<Material>(own);
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_set_default_material_pipeline(PipelineID pipelineId) {
+    NATIVE_TRY
+    if (!g_engine.initialized) {
+        return -1;
+    }
+    if (pipelineId != 0 && !isMaterialPipeline(pipelineId)) {
+        fail(ERROR_INVALID_ARGUMENT, "Cannot set default material pipeline: {} is not a material pipeline", pipelineId);
+        return -1;
+    }
 
+    g_engine.defaultMaterialPipeline = pipelineId;
     return 0;
+    NATIVE_CATCH(-1)
 }
 
-int boulder_set_transform(EntityID entity, float x, float y, float z) {
-    if (!g_engine.ecs) {
-        return -1;
-    }
+PipelineID boulder_get_default_material_pipeline() {
+    NATIVE_TRY
+    return g_engine.defaultMaterialPipeline;
+    NATIVE_CATCH(0)
+}
 
-    flecs::entity e = g_engine.ecs->entity(entity);
-    Transform* t = e.get_mut<Transform>();
-    if (!t) {
+int boulder_set_tint(EntityID entity, float r, float g, float b, float a) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs || !g_engine.ecs->is_alive(entity)) {
         return -1;
     }
+    flecs::entity e = g_engine.ecs->entity(entity);
 
-    t->position = glm::vec3(x, y, z);
-
+    InstanceColor color;
+    if (const InstanceColor* existing = e.get<InstanceColor>()) {
+        color = *existing;
+    }
+    color.tint = glm::vec4(r, g, b, a);
+    e.set<InstanceColor>(color);
     return 0;
+    NATIVE_CATCH(-1)
 }
 
-int boulder_add_physics_body(EntityID entity, float mass) {
-    if (!g_engine.ecs) {
+int boulder_set_emissive(EntityID entity, float r, float g, float b, float intensity) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs || intensity < 0.0f || !g_engine.ecs->is_alive(entity)) {
         return -1;
     }
-
     flecs::entity e = g_engine.ecs->entity(entity);
-    e.set<PhysicsBody>({
-        .mass = mass,
-        .velocity = glm::vec3(0.0f),
-        .acceleration = glm::vec3(0.0f, -9.81f, 0.0f) // gravity
-    });
 
+    InstanceColor color;
+    if (const InstanceColor* existing = e.get<InstanceColor>()) {
+        color = *existing;
+    }
+    color.emissive = glm::vec4(glm::vec3(r, g, b) * intensity, 0.0f);
+    e.set<InstanceColor>(color);
     return 0;
+    NATIVE_CATCH(-1)
 }
 
-int boulder_set_velocity(EntityID entity, float vx, float vy, float vz) {
-    if (!g_engine.ecs) {
+int boulder_get_instance_color(EntityID entity, float* tint, float* emissive) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs || !tint || !emissive || !g_engine.ecs->is_alive(entity)) {
         return -1;
     }
 
-    flecs::entity e = g_engine.ecs->entity(entity);
-    PhysicsBody* pb = e.get_mut<PhysicsBody>();
-    if (!pb) {
-        return -1;
+    InstanceColor color;
+    if (const InstanceColor* existing = g_engine.ecs->entity(entity).get<InstanceColor>()) {
+        color = *existing;
     }
-
-    pb->velocity = glm::vec3(vx, vy, vz);
-
+    memcpy(tint, &color.tint, sizeof(float) * 4);
+    memcpy(emissive, &color.emissive, sizeof(float) * 3);
     return 0;
+    NATIVE_CATCH(-1)
 }
 
-int boulder_get_velocity(EntityID entity, float* vx, float* vy, float* vz) {
-    if (!g_engine.ecs || !vx || !vy || !vz) {
+static int setLight(EntityID entity, const Light& light) {
+    if (!g_engine.initialized || !g_engine.ecs || !g_engine.ecs->is_alive(entity)) {
         return -1;
     }
-
-    flecs::entity e = g_engine.ecs->entity(entity);
-    const PhysicsBody* pb = e.get<PhysicsBody>();
-    if (!pb) {
+    if (light.intensity < 0.0f || light.range < 0.0f) {
         return -1;
     }
+    g_engine.ecs->entity(entity).set<Light>(light);
+    return 0;
+}
 
-    *vx = pb->velocity.x;
-    *vy = pb->velocity.y;
-    *vz = pb->velocity.z;
+int boulder_add_directional_light(EntityID entity, float r, float g, float b, float intensity) {
+    NATIVE_TRY
+    Light light;
+    light.type = LIGHT_DIRECTIONAL;
+    light.color = glm::vec3(r, g, b);
+    light.intensity = intensity;
+    return setLight(entity, light);
+    NATIVE_CATCH(-1)
+}
 
-    return 0;
+int boulder_add_point_light(EntityID entity, float r, float g, float b, float intensity, float range) {
+    NATIVE_TRY
+    Light light;
+    light.type = LIGHT_POINT;
+    light.color = glm::vec3(r, g, b);
+    light.intensity = intensity;
+    light.range = range;
+    return setLight(entity, light);
+    NATIVE_CATCH(-1)
 }
 
-int boulder_apply_force(EntityID entity, float fx, float fy, float fz) {
-    if (!g_engine.ecs) {
+int boulder_add_spot_light(EntityID entity, float r, float g, float b, float intensity, float range,
+                           float innerAngle, float outerAngle) {
+    NATIVE_TRY
+    if (innerAngle < 0.0f || outerAngle < innerAngle || outerAngle >= 90.0f) {
         return -1;
     }
 
-    flecs::entity e = g_engine.ecs->entity(entity);
-    PhysicsBody* pb = e.get_mut<PhysicsBody>();
-    if (!pb) {
+    Light light;
+    light.type = LIGHT_SPOT;
+    light.color = glm::vec3(r, g, b);
+    light.intensity = intensity;
+    light.range = range;
+    light.innerCone = innerAngle;
+    light.outerCone = outerAngle;
+    return setLight(entity, light);
+    NATIVE_CATCH(-1)
+}
+
+int boulder_remove_light(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !g_engine.ecs->is_alive(entity)) {
         return -1;
     }
-
-    glm::vec3 force(fx, fy, fz);
-    pb->acceleration += force / pb->mass;
-
+    g_engine.ecs->entity(entity).remove<Light>();
     return 0;
+    NATIVE_CATCH(-1)
 }
 
-int boulder_load_model(EntityID entity, const char* path) {
-    if (!g_engine.ecs || !g_engine.importer || !path) {
-        Logger::get().error("Invalid parameters for loading model");
+int boulder_get_light(EntityID entity, float* color, float* intensity, float* range, float* innerAngle, float* outerAngle) {
+    NATIVE_TRY
+    if (!g_engine.ecs || !color || !intensity || !range || !innerAngle || !outerAngle || !g_engine.ecs->is_alive(entity)) {
         return -1;
     }
 
-    if (!g_engine.device) {
-        Logger::get().error("Cannot load model: Vulkan device not initialized");
+    const Light* light = g_engine.ecs->entity(entity).get<Light>();
+    if (!light) {
         return -1;
     }
+    memcpy(color, &light->color, sizeof(float) * 3);
+    *intensity = light->intensity;
+    *range = light->range;
+    *innerAngle = light->innerCone;
+    *outerAngle = light->outerCone;
+    return light->type;
+    NATIVE_CATCH(-1)
+}
 
-    Logger::get().info("Loading model: {}", path);
-
-    const aiScene* scene = g_engine.importer->ReadFile(path,
-        aiProcess_Triangulate |
-        aiProcess_FlipUVs |
-        aiProcess_JoinIdenticalVertices);
-
-    if (!scene || scene->mFlags & AI_SCENE_FLAGS_INCOMPLETE || !scene->mRootNode) {
-        Logger::get().error("Failed to load model: {}", g_engine.importer->GetErrorString());
+int boulder_set_ambient_light(float r, float g, float b, float intensity) {
+    NATIVE_TRY
+    if (intensity < 0.0f) {
         return -1;
     }
+    g_engine.ambientLight = glm::vec3(r, g, b) * intensity;
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    // Process all meshes in the scene
-    Model model;
-    model.path = std::string(path);
-    model.scene = scene;
-    processNode(scene->mRootNode, scene, model.meshes);
-
-    Logger::get().info("✓ Model loaded: {} meshes extracted", model.meshes.size());
-
-    // Debug: Print mesh statistics
-    for (size_t i = 0; i < model.meshes.size(); i++) {
-        const auto& mesh = model.meshes[i];
-        Logger::get().info("  Mesh {}: {} vertices, {} indices",
-                          i, mesh.vertices.size(), mesh.indexCount);
-
-        // Debug: Print first few indices to verify they're in range
-        if (mesh.indices.size() >= 10) {
-            Logger::get().info("    First 10 indices: {} {} {} {} {} {} {} {} {} {}",
-                              mesh.indices[0], mesh.indices[1], mesh.indices[2],
-                              mesh.indices[3], mesh.indices[4], mesh.indices[5],
-                              mesh.indices[6], mesh.indices[7], mesh.indices[8],
-                              mesh.indices[9]);
-        } else if (!mesh.indices.empty()) {
-            Logger::get().info("    All {} indices loaded", mesh.indices.size());
-        }
+int boulder_get_ambient_light(float* color) {
+    NATIVE_TRY
+    if (!color) {
+        return -1;
     }
+    memcpy(color, &g_engine.ambientLight, sizeof(float) * 3);
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
+int boulder_set_blend_mode(EntityID entity, int blendMode) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs || blendMode < 0 || blendMode >= BLEND_MODE_COUNT) {
+        return -1;
+    }
+    if (!g_engine.ecs->is_alive(entity)) {
+        return -1;
+    }
     flecs::entity e = g_engine.ecs->entity(entity);
-    e.set<Model>(std::move(model));
-
-    // Ensure buffer writes are visible to GPU before rendering
-    // Even with HOST_COHERENT memory, we need an execution dependency
-    vkDeviceWaitIdle(g_engine.device);
-
-    Logger::get().info("Model buffers synchronized with GPU");
 
+    Material material;
+    if (const Material* existing = e.get<Material>()) {
+        material = *existing;
+    }
+    material.blendMode = blendMode;
+    e.set<Material>(material);
     return 0;
+    NATIVE_CATCH(-1)
 }
 
-int boulder_is_key_pressed(int keyCode) {
-    const bool* state = SDL_GetKeyboardState(nullptr);
-    return state[keyCode] ? 1 : 0;
-}
+int boulder_get_blend_mode(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs || !g_engine.ecs->is_alive(entity)) {
+        return -1;
+    }
 
-int boulder_is_mouse_button_pressed(int button) {
-    Uint32 buttons = SDL_GetMouseState(nullptr, nullptr);
-    // SDL3 uses SDL_BUTTON_MASK instead of SDL_BUTTON
-    return (buttons & SDL_BUTTON_MASK(button)) ? 1 : 0;
+    const Material* material = g_engine.ecs->entity(entity).get<Material>();
+    return material ? material->blendMode : BLEND_MODE_OPAQUE;
+    NATIVE_CATCH(-1)
 }
 
-void boulder_get_mouse_position(float* x, float* y) {
-    if (x && y) {
-        SDL_GetMouseState(x, y);
+int boulder_set_render_queue(EntityID entity, int queue) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs || queue < 0) {
+        return -1;
     }
-}
+    if (!g_engine.ecs->is_alive(entity)) {
+        return -1;
+    }
+    flecs::entity e = g_engine.ecs->entity(entity);
 
-void boulder_log_info(const char* message) {
-    if (message) {
-        Logger::get().info("{}",message);
+    Material material;
+    if (const Material* existing = e.get<Material>()) {
+        material = *existing;
     }
+    material.queue = queue;
+    e.set<Material>(material);
+    return 0;
+    NATIVE_CATCH(-1)
 }
 
-void boulder_log_error(const char* message) {
-    if (message) {
-        Logger::get().error("{}",message);
+int boulder_get_render_queue(EntityID entity) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs || !g_engine.ecs->is_alive(entity)) {
+        return -1;
     }
+
+    const Material* material = g_engine.ecs->entity(entity).get<Material>();
+    return material ? material->queue : 0;
+    NATIVE_CATCH(-1)
 }
 
-// Shader management
-ShaderModuleID boulder_compile_shader(const char* source, int shaderKind, const char* name) {
-    if (!g_engine.initialized || !g_engine.device || !source || !name) {
-        Logger::get().error("Cannot compile shader: engine not initialized or invalid parameters");
-        return 0;
+int boulder_set_outline(EntityID entity, float r, float g, float b, float a, float thickness) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.ecs || thickness < 0.0f) {
+        return -1;
     }
+    if (!g_engine.ecs->is_alive(entity)) {
+        return -1;
+    }
+    flecs::entity e = g_engine.ecs->entity(entity);
 
-    std::string sourceStr(source);
-    shaderc_shader_kind kind = static_cast<shaderc_shader_kind>(shaderKind);
-
-    auto spirv = compileShader(sourceStr, kind, name);
-    if (spirv.empty()) {
-        Logger::get().error("Failed to compile shader: {}", name);
+    if (thickness == 0.0f) {
+        e.remove<Outline>();
         return 0;
     }
+    e.set<Outline>({glm::vec4(r, g, b, a), thickness});
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    VkShaderModuleCreateInfo createInfo{};
-    createInfo.sType = VK_STRUCTURE_TYPE_SHADER_MODULE_CREATE_INFO;
-    createInfo.codeSize = spirv.size() * sizeof(uint32_t);
-    createInfo.pCode = spirv.data();
+int boulder_outlines_supported() {
+    NATIVE_TRY
+    return g_engine.outlinePipeline ? 1 : 0;
+    NATIVE_CATCH(0)
+}
 
-    VkShaderModule shaderModule;
-    if (vkCreateShaderModule(g_engine.device, &createInfo, nullptr, &shaderModule) != VK_SUCCESS) {
-        Logger::get().error("Failed to create shader module: {}", name);
+TextureID boulder_create_texture(const void* rgba, uint32_t width, uint32_t height) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.device || !rgba || width == 0 || height == 0) {
         return 0;
     }
 
-    uint64_t id = g_engine.nextShaderModuleId++;
-    g_engine.shaderModules[id] = shaderModule;
+    Texture texture;
+    texture.width = width;
+    texture.height = height;
+    texture.pixels.assign(static_cast<const uint8_t*>(rgba), static_cast<const uint8_t*>(rgba) + (size_t)width * height * 4);
+    if (!uploadTexture(texture)) {
+        destroyTextureImage(texture);
+        return 0;
+    }
 
-    Logger::get().info("Shader module {} created with ID {}", name, id);
+    uint64_t id = g_engine.nextTextureId++;
+    g_engine.textures[id] = std::move(texture);
     return id;
+    NATIVE_CATCH(0)
 }
 
-void boulder_destroy_shader_module(ShaderModuleID shaderId) {
+TextureID boulder_create_texture_levels(uint32_t format, uint32_t width, uint32_t height, uint32_t levels,
+                                       const void* data, uint64_t size) {
+    NATIVE_TRY
     if (!g_engine.initialized || !g_engine.device) {
-        return;
-    }
-
-    auto it = g_engine.shaderModules.find(shaderId);
-    if (it != g_engine.shaderModules.end()) {
-        vkDestroyShaderModule(g_engine.device, it->second, nullptr);
-        g_engine.shaderModules.erase(it);
-        Logger::get().info("Destroyed shader module with ID {}", shaderId);
+        fail(ERROR_NOT_INITIALIZED, "Cannot create a texture before the renderer is up");
+        return 0;
     }
-}
-
-ShaderModuleID boulder_reload_shader(ShaderModuleID shaderId, const char* source, int shaderKind, const char* name) {
-    if (!g_engine.initialized || !g_engine.device || !source || !name) {
-        Logger::get().error("Cannot reload shader: engine not initialized or invalid parameters");
+    if (!data || width == 0 || height == 0 || levels == 0 || levels > 32) {
+        fail(ERROR_INVALID_ARGUMENT, "Invalid texture: {}x{} with {} levels", width, height, levels);
         return 0;
     }
 
-    // Destroy old shader module if it exists
-    if (shaderId != 0) {
-        boulder_destroy_shader_module(shaderId);
+    // Materials sample textures as stored, the way RGBA ones are uploaded, and decode sRGB
+    // themselves, so sRGB formats are uploaded as their UNORM equivalents
+    VkFormat vkFormat = static_cast<VkFormat>(format);
+    switch (vkFormat) {
+        case VK_FORMAT_R8G8B8A8_SRGB:
+            vkFormat = VK_FORMAT_R8G8B8A8_UNORM;
+            break;
+        case VK_FORMAT_BC1_RGB_SRGB_BLOCK:
+            vkFormat = VK_FORMAT_BC1_RGB_UNORM_BLOCK;
+            break;
+        case VK_FORMAT_BC1_RGBA_SRGB_BLOCK:
+            vkFormat = VK_FORMAT_BC1_RGBA_UNORM_BLOCK;
+            break;
+        case VK_FORMAT_BC3_SRGB_BLOCK:
+            vkFormat = VK_FORMAT_BC3_UNORM_BLOCK;
+            break;
+        case VK_FORMAT_BC7_SRGB_BLOCK:
+            vkFormat = VK_FORMAT_BC7_UNORM_BLOCK;
+            break;
+        default:
+            break;
     }
-
-    // Create new shader module
-    return boulder_compile_shader(source, shaderKind, name);
-}
-
-// Pipeline management
-PipelineID boulder_create_graphics_pipeline(ShaderModuleID meshShader, ShaderModuleID fragShader) {
-    if (!g_engine.initialized || !g_engine.device) {
-        Logger::get().error("Cannot create pipeline: engine not initialized");
+    uint32_t blockBytes = textureBlockBytes(vkFormat);
+    if (blockBytes == 0) {
+        fail(ERROR_UNSUPPORTED, "Unsupported texture format {}", format);
         return 0;
     }
-
-    auto meshIt = g_engine.shaderModules.find(meshShader);
-    auto fragIt = g_engine.shaderModules.find(fragShader);
-
-    if (meshIt == g_engine.shaderModules.end() || fragIt == g_engine.shaderModules.end()) {
-        Logger::get().error("Cannot create pipeline: invalid shader module IDs");
+    if (blockBytes != 4 && !g_engine.textureCompressionBC) {
+        fail(ERROR_UNSUPPORTED, "The GPU cannot sample BCn compressed textures");
         return 0;
     }
 
-    // Create pipeline layout with push constants
-    VkPushConstantRange pushConstantRange{};
-    pushConstantRange.stageFlags = VK_SHADER_STAGE_MESH_BIT_EXT;
-    pushConstantRange.offset = 0;
-    pushConstantRange.size = 64; // 64 bytes for transform matrix
-
-    VkPipelineLayoutCreateInfo layoutInfo{};
-    layoutInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_LAYOUT_CREATE_INFO;
-    layoutInfo.pushConstantRangeCount = 1;
-    layoutInfo.pPushConstantRanges = &pushConstantRange;
-
-    VkPipelineLayout pipelineLayout;
-    if (vkCreatePipelineLayout(g_engine.device, &layoutInfo, nullptr, &pipelineLayout) != VK_SUCCESS) {
-        Logger::get().error("Failed to create pipeline layout");
+    VkDeviceSize expected = 0;
+    for (uint32_t level = 0; level < levels; level++) {
+        expected += textureLevelSize(vkFormat, std::max(width >> level, 1u), std::max(height >> level, 1u));
+    }
+    if (size != expected) {
+        fail(ERROR_INVALID_DATA, "Texture data is {} bytes, {}x{} with {} levels needs {}", size, width, height,
+             levels, expected);
         return 0;
     }
 
-    // Create shader stages
-    VkPipelineShaderStageCreateInfo meshShaderStageInfo{};
-    meshShaderStageInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_SHADER_STAGE_CREATE_INFO;
-    meshShaderStageInfo.stage = VK_SHADER_STAGE_MESH_BIT_EXT;
-    meshShaderStageInfo.module = meshIt->second;
-    meshShaderStageInfo.pName = "main";
-
-    VkPipelineShaderStageCreateInfo fragShaderStageInfo{};
-    fragShaderStageInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_SHADER_STAGE_CREATE_INFO;
-    fragShaderStageInfo.stage = VK_SHADER_STAGE_FRAGMENT_BIT;
-    fragShaderStageInfo.module = fragIt->second;
-    fragShaderStageInfo.pName = "main";
-
-    VkPipelineShaderStageCreateInfo shaderStages[] = {meshShaderStageInfo, fragShaderStageInfo};
-
-    // Rasterization state
-    VkPipelineRasterizationStateCreateInfo rasterizer{};
-    rasterizer.sType = VK_STRUCTURE_TYPE_PIPELINE_RASTERIZATION_STATE_CREATE_INFO;
-    rasterizer.depthClampEnable = VK_FALSE;
-    rasterizer.rasterizerDiscardEnable = VK_FALSE;
-    rasterizer.polygonMode = VK_POLYGON_MODE_FILL;
-    rasterizer.lineWidth = 1.0f;
-    rasterizer.cullMode = VK_CULL_MODE_BACK_BIT;
-    rasterizer.frontFace = VK_FRONT_FACE_CLOCKWISE;
-    rasterizer.depthBiasEnable = VK_FALSE;
-
-    // Multisampling
-    VkPipelineMultisampleStateCreateInfo multisampling{};
-    multisampling.sType = VK_STRUCTURE_TYPE_PIPELINE_MULTISAMPLE_STATE_CREATE_INFO;
-    multisampling.sampleShadingEnable = VK_FALSE;
-    multisampling.rasterizationSamples = VK_SAMPLE_COUNT_1_BIT;
+    Texture texture;
+    texture.width = width;
+    texture.height = height;
+    texture.levels = levels;
+    texture.format = vkFormat;
+    texture.pixels.assign(static_cast<const uint8_t*>(data), static_cast<const uint8_t*>(data) + size);
+    if (!uploadTexture(texture)) {
+        destroyTextureImage(texture);
+        return 0;
+    }
 
-    // Color blending
-    VkPipelineColorBlendAttachmentState colorBlendAttachment{};
-    colorBlendAttachment.colorWriteMask = VK_COLOR_COMPONENT_R_BIT | VK_COLOR_COMPONENT_G_BIT |
-                                          VK_COLOR_COMPONENT_B_BIT | VK_COLOR_COMPONENT_A_BIT;
-    colorBlendAttachment.blendEnable = VK_FALSE;
+    uint64_t id = g_engine.nextTextureId++;
+    g_engine.textures[id] = std::move(texture);
+    return id;
+    NATIVE_CATCH(0)
+}
 
-    VkPipelineColorBlendStateCreateInfo colorBlending{};
-    colorBlending.sType = VK_STRUCTURE_TYPE_PIPELINE_COLOR_BLEND_STATE_CREATE_INFO;
-    colorBlending.logicOpEnable = VK_FALSE;
-    colorBlending.attachmentCount = 1;
-    colorBlending.pAttachments = &colorBlendAttachment;
+void boulder_destroy_texture(TextureID texture) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.device) {
+        return;
+    }
 
-    // Depth stencil state
-    VkPipelineDepthStencilStateCreateInfo depthStencil{};
-    depthStencil.sType = VK_STRUCTURE_TYPE_PIPELINE_DEPTH_STENCIL_STATE_CREATE_INFO;
-    depthStencil.depthTestEnable = VK_TRUE;
-    depthStencil.depthWriteEnable = VK_TRUE;
-    depthStencil.depthCompareOp = VK_COMPARE_OP_LESS;
-    depthStencil.depthBoundsTestEnable = VK_FALSE;
-    depthStencil.stencilTestEnable = VK_FALSE;
+    auto it = g_engine.textures.find(texture);
+    if (it == g_engine.textures.end()) {
+        return;
+    }
 
-    // Dynamic state
-    VkDynamicState dynamicStates[] = {
-        VK_DYNAMIC_STATE_VIEWPORT,
-        VK_DYNAMIC_STATE_SCISSOR
-    };
+    // Frames in flight may still sample it
+    vkDeviceWaitIdle(g_engine.device);
+    destroyTextureImage(it->second);
+    g_engine.textures.erase(it);
+    NATIVE_CATCH()
+}
 
-    VkPipelineDynamicStateCreateInfo dynamicState{};
-    dynamicState.sType = VK_STRUCTURE_TYPE_PIPELINE_DYNAMIC_STATE_CREATE_INFO;
-    dynamicState.dynamicStateCount = 2;
-    dynamicState.pDynamicStates = dynamicStates;
+// Frame pacing and present stats
 
-    // Viewport state (counts only, actual values set dynamically)
-    VkPipelineViewportStateCreateInfo viewportState{};
-    viewportState.sType = VK_STRUCTURE_TYPE_PIPELINE_VIEWPORT_STATE_CREATE_INFO;
-    viewportState.viewportCount = 1;
-    viewportState.scissorCount = 1;
+// Whether the frame in a slot is on screen (or rendered, when it has no present ID),
+// waiting up to timeout nanoseconds
+static bool frameCompleted(uint32_t slot, uint64_t timeout) {
+    const FrameTiming& timing = g_engine.frameTimings[slot];
+    if (timing.presentId) {
+        return vkWaitForPresentKHR(g_engine.device, g_engine.swapchain, timing.presentId, timeout) != VK_TIMEOUT;
+    }
+    return vkWaitForFences(g_engine.device, 1, &g_engine.inFlightFences[slot], VK_TRUE, timeout) != VK_TIMEOUT;
+}
 
-    // Dynamic rendering info
-    VkPipelineRenderingCreateInfo renderingInfo{};
-    renderingInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_RENDERING_CREATE_INFO;
-    renderingInfo.colorAttachmentCount = 1;
-    renderingInfo.pColorAttachmentFormats = &g_engine.swapchainFormat;
-    renderingInfo.depthAttachmentFormat = g_engine.depthFormat;
+// Adds frames that completed since the last call to the present stats, oldest first.
+// Frames are seen completing when a frame begins or ends, so without low latency mode the
+// measured latency can be up to a frame late.
+static void collectFrameTimings() {
+    auto now = std::chrono::steady_clock::now();
+    FrameStats& stats = g_engine.frameStats;
+
+    for (uint32_t i = 0; i < g_engine.framesInFlight; i++) {
+        uint32_t slot = (g_engine.currentFrameIndex + i) % g_engine.framesInFlight;
+        FrameTiming& timing = g_engine.frameTimings[slot];
+        if (!timing.pending) {
+            continue;
+        }
+        if (!frameCompleted(slot, 0)) {
+            break;
+        }
+        timing.pending = false;
+
+        stats.latencyMs = std::chrono::duration<double, std::milli>(now - timing.start).count();
+        stats.averageLatencyMs = stats.framesPresented == 0 ? stats.latencyMs
+                                                            : stats.averageLatencyMs * 0.9 + stats.latencyMs * 0.1;
+
+        // A frame arriving more than a refresh after the last one means the display showed
+        // the last one again. Gaps over a second are pauses rather than drops.
+        if (stats.framesPresented > 0) {
+            double refreshes = std::chrono::duration<double>(now - stats.lastPresent).count() * g_engine.refreshRate;
+            if (refreshes > 1.5 && refreshes < g_engine.refreshRate) {
+                stats.framesDropped += static_cast<uint64_t>(refreshes + 0.5) - 1;
+            }
+        }
+        stats.lastPresent = now;
+        stats.framesPresented++;
+    }
+}
 
-    // Create graphics pipeline
-    VkGraphicsPipelineCreateInfo pipelineInfo{};
-    pipelineInfo.sType = VK_STRUCTURE_TYPE_GRAPHICS_PIPELINE_CREATE_INFO;
-    pipelineInfo.pNext = &renderingInfo;
-    pipelineInfo.stageCount = 2;
-    pipelineInfo.pStages = shaderStages;
-    pipelineInfo.pRasterizationState = &rasterizer;
-    pipelineInfo.pMultisampleState = &multisampling;
-    pipelineInfo.pColorBlendState = &colorBlending;
-    pipelineInfo.pDepthStencilState = &depthStencil;
-    pipelineInfo.pDynamicState = &dynamicState;
-    pipelineInfo.pViewportState = &viewportState;
-    pipelineInfo.layout = pipelineLayout;
-    pipelineInfo.renderPass = VK_NULL_HANDLE;
-    pipelineInfo.subpass = 0;
+// Reads the GPU time of the frame last rendered in the slot, once its fence has signaled
+static void readGpuFrameTime(uint32_t slot) {
+    if (!g_engine.timestampPool || !g_engine.timestampsWritten[slot]) {
+        return;
+    }
+    g_engine.timestampsWritten[slot] = false;
 
-    VkPipeline pipeline;
-    if (vkCreateGraphicsPipelines(g_engine.device, VK_NULL_HANDLE, 1, &pipelineInfo, nullptr, &pipeline) != VK_SUCCESS) {
-        Logger::get().error("Failed to create graphics pipeline");
-        vkDestroyPipelineLayout(g_engine.device, pipelineLayout, nullptr);
+    uint64_t timestamps[2];
+    VkResult result = vkGetQueryPoolResults(g_engine.device, g_engine.timestampPool, 2 * slot, 2, sizeof(timestamps),
+                                            timestamps, sizeof(uint64_t), VK_QUERY_RESULT_64_BIT);
+    if (result != VK_SUCCESS) {
+        return;
+    }
+    uint64_t ticks = (timestamps[1] - timestamps[0]) & g_engine.timestampMask;
+    g_engine.gpuFrameMs = ticks * static_cast<double>(g_engine.timestampPeriod) / 1e6;
+}
+
+int boulder_set_frames_in_flight(uint32_t count) {
+    NATIVE_TRY
+    if (count < 1 || count > MAX_FRAMES_IN_FLIGHT) {
+        return -1;
+    }
+    if (count == g_engine.framesInFlight) {
         return 0;
     }
+    if (g_engine.activeCommandBuffer) {
+        fail(ERROR_API_MISUSE, "Cannot change frames in flight during a frame");
+        return -1;
+    }
 
-    uint64_t id = g_engine.nextPipelineId++;
-    g_engine.pipelines[id] = pipeline;
-    g_engine.pipelineLayouts[id] = pipelineLayout;
+    // Frame slots are reused from 0, so everything queued has to finish first
+    if (g_engine.device) {
+        vkDeviceWaitIdle(g_engine.device);
+        collectFrameTimings();
+    }
+    resetFrameTimings();
+    g_engine.framesInFlight = count;
+    g_engine.currentFrameIndex = 0;
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    Logger::get().info("Graphics pipeline created with ID {}", id);
-    return id;
+uint32_t boulder_get_frames_in_flight() {
+    NATIVE_TRY
+    return g_engine.framesInFlight;
+    NATIVE_CATCH(0)
 }
 
-void boulder_bind_pipeline(PipelineID pipelineId) {
-    if (!g_engine.initialized || !g_engine.activeCommandBuffer) {
-        Logger::get().error("Cannot bind pipeline: no active command buffer");
-        return;
+int boulder_set_present_mode(int mode) {
+    NATIVE_TRY
+    if (mode < PRESENT_MODE_IMMEDIATE || mode > PRESENT_MODE_FIFO_RELAXED) {
+        return -1;
     }
 
-    auto it = g_engine.pipelines.find(pipelineId);
-    if (it == g_engine.pipelines.end()) {
-        Logger::get().error("Cannot bind pipeline: invalid pipeline ID {}", pipelineId);
-        return;
+    g_engine.requestedPresentMode = static_cast<VkPresentModeKHR>(mode);
+    if (g_engine.swapchain && g_engine.requestedPresentMode != g_engine.presentMode) {
+        g_engine.swapchainNeedsRecreate = true;
     }
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    vkCmdBindPipeline(g_engine.activeCommandBuffer, VK_PIPELINE_BIND_POINT_GRAPHICS, it->second);
-    g_engine.boundPipeline = it->second;
+int boulder_get_present_mode() {
+    NATIVE_TRY
+    return g_engine.swapchain ? static_cast<int>(g_engine.presentMode) : static_cast<int>(g_engine.requestedPresentMode);
+    NATIVE_CATCH(0)
 }
 
-void boulder_destroy_pipeline(PipelineID pipelineId) {
-    if (!g_engine.initialized || !g_engine.device) {
-        return;
+void boulder_set_low_latency(int enabled) {
+    NATIVE_TRY
+    g_engine.lowLatency = enabled != 0;
+    NATIVE_CATCH()
+}
+
+int boulder_get_low_latency() {
+    NATIVE_TRY
+    return g_engine.lowLatency ? 1 : 0;
+    NATIVE_CATCH(0)
+}
+
+int boulder_get_present_stats(PresentStats* stats) {
+    NATIVE_TRY
+    if (!stats) {
+        return -1;
     }
 
-    auto pipelineIt = g_engine.pipelines.find(pipelineId);
-    auto layoutIt = g_engine.pipelineLayouts.find(pipelineId);
+    stats->latencyMs = static_cast<float>(g_engine.frameStats.latencyMs);
+    stats->averageLatencyMs = static_cast<float>(g_engine.frameStats.averageLatencyMs);
+    stats->refreshRate = g_engine.refreshRate;
+    stats->framesPresented = g_engine.frameStats.framesPresented;
+    stats->framesDropped = g_engine.frameStats.framesDropped;
+    stats->presentMode = boulder_get_present_mode();
+    stats->framesInFlight = g_engine.framesInFlight;
+    stats->lowLatency = boulder_get_low_latency();
+    stats->presentWait = g_engine.presentWaitSupported ? 1 : 0;
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+void boulder_reset_present_stats() {
+    NATIVE_TRY
+    g_engine.frameStats = FrameStats{};
+    NATIVE_CATCH()
+}
 
-    if (pipelineIt != g_engine.pipelines.end()) {
-        vkDestroyPipeline(g_engine.device, pipelineIt->second, nullptr);
-        g_engine.pipelines.erase(pipelineIt);
+int boulder_get_frame_times(FrameTimes* times) {
+    NATIVE_TRY
+    if (!times) {
+        return -1;
     }
+    times->cpuMs = static_cast<float>(g_engine.cpuFrameMs);
+    times->gpuMs = static_cast<float>(g_engine.gpuFrameMs);
+    times->gpuTimingSupported = g_engine.timestampPool ? 1 : 0;
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    if (layoutIt != g_engine.pipelineLayouts.end()) {
-        vkDestroyPipelineLayout(g_engine.device, layoutIt->second, nullptr);
-        g_engine.pipelineLayouts.erase(layoutIt);
+void boulder_set_lod_bias(int bias) {
+    NATIVE_TRY
+    g_engine.lodBias = bias;
+    NATIVE_CATCH()
+}
+
+int boulder_get_lod_bias() {
+    NATIVE_TRY
+    return g_engine.lodBias;
+    NATIVE_CATCH(0)
+}
+
+int boulder_get_render_stats(RenderStats* stats) {
+    NATIVE_TRY
+    if (!stats) {
+        return -1;
     }
+    *stats = g_engine.renderStats;
+    stats->deviceMemoryBytes = g_engine.deviceMemoryBytes;
+    stats->deviceAllocations = static_cast<uint32_t>(g_engine.deviceMemorySizes.size());
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    Logger::get().info("Destroyed pipeline with ID {}", pipelineId);
+int boulder_get_subsystem_times(SubsystemTimes* times) {
+    NATIVE_TRY
+    if (!times) {
+        return -1;
+    }
+    *times = g_engine.subsystemTimes;
+    return 0;
+    NATIVE_CATCH(-1)
 }
 
 // Rendering control
+// Clears the swapchain image to the clear color and blits the backdrop over it, scaled by
+// its fit, leaving the image in COLOR_ATTACHMENT_OPTIMAL for rendering to load
+static void recordBackdrop(VkCommandBuffer cmd, uint32_t imageIndex) {
+    Texture& backdrop = g_engine.backdrop;
+    VkImage target = g_engine.swapchainImages[imageIndex];
+    VkExtent2D extent = g_engine.swapchainExtent;
+
+    VkImageMemoryBarrier barriers[2]{};
+    barriers[0].sType = VK_STRUCTURE_TYPE_IMAGE_MEMORY_BARRIER;
+    barriers[0].oldLayout = VK_IMAGE_LAYOUT_UNDEFINED; // Overwritten, so the old contents don't matter
+    barriers[0].newLayout = VK_IMAGE_LAYOUT_TRANSFER_DST_OPTIMAL;
+    barriers[0].srcQueueFamilyIndex = VK_QUEUE_FAMILY_IGNORED;
+    barriers[0].dstQueueFamilyIndex = VK_QUEUE_FAMILY_IGNORED;
+    barriers[0].image = target;
+    barriers[0].subresourceRange = {VK_IMAGE_ASPECT_COLOR_BIT, 0, 1, 0, 1};
+    barriers[0].srcAccessMask = 0;
+    barriers[0].dstAccessMask = VK_ACCESS_TRANSFER_WRITE_BIT;
+    barriers[1] = barriers[0];
+    barriers[1].oldLayout = VK_IMAGE_LAYOUT_SHADER_READ_ONLY_OPTIMAL;
+    barriers[1].newLayout = VK_IMAGE_LAYOUT_TRANSFER_SRC_OPTIMAL;
+    barriers[1].image = backdrop.image;
+    barriers[1].srcAccessMask = VK_ACCESS_SHADER_READ_BIT;
+    barriers[1].dstAccessMask = VK_ACCESS_TRANSFER_READ_BIT;
+    vkCmdPipelineBarrier(cmd, VK_PIPELINE_STAGE_COLOR_ATTACHMENT_OUTPUT_BIT | VK_PIPELINE_STAGE_FRAGMENT_SHADER_BIT,
+                         VK_PIPELINE_STAGE_TRANSFER_BIT, 0, 0, nullptr, 0, nullptr, 2, barriers);
+
+    VkImageSubresourceRange range = {VK_IMAGE_ASPECT_COLOR_BIT, 0, 1, 0, 1};
+    vkCmdClearColorImage(cmd, target, VK_IMAGE_LAYOUT_TRANSFER_DST_OPTIMAL, &g_engine.clearColor, 1, &range);
+
+    // Scale the image to fit inside the screen or to cover it, centred
+    float scaleX = static_cast<float>(extent.width) / backdrop.width;
+    float scaleY = static_cast<float>(extent.height) / backdrop.height;
+    float scale = g_engine.backdropFit == BACKDROP_FIT_COVER ? std::max(scaleX, scaleY) : std::min(scaleX, scaleY);
+    float width = backdrop.width * scale;
+    float height = backdrop.height * scale;
+    float x = (extent.width - width) / 2.0f;
+    float y = (extent.height - height) / 2.0f;
+
+    // Blits can't clip, so a covering image is cropped in source pixels instead
+    float srcX0 = 0.0f, srcY0 = 0.0f, srcX1 = static_cast<float>(backdrop.width), srcY1 = static_cast<float>(backdrop.height);
+    if (x < 0.0f) {
+        srcX0 = -x / scale;
+        srcX1 = backdrop.width - srcX0;
+        x = 0.0f;
+        width = static_cast<float>(extent.width);
+    }
+    if (y < 0.0f) {
+        srcY0 = -y / scale;
+        srcY1 = backdrop.height - srcY0;
+        y = 0.0f;
+        height = static_cast<float>(extent.height);
+    }
+
+    VkImageBlit blit{};
+    blit.srcSubresource = {VK_IMAGE_ASPECT_COLOR_BIT, 0, 0, 1};
+    blit.srcOffsets[0] = {static_cast<int32_t>(srcX0), static_cast<int32_t>(srcY0), 0};
+    blit.srcOffsets[1] = {static_cast<int32_t>(srcX1), static_cast<int32_t>(srcY1), 1};
+    blit.dstSubresource = {VK_IMAGE_ASPECT_COLOR_BIT, 0, 0, 1};
+    blit.dstOffsets[0] = {static_cast<int32_t>(x), static_cast<int32_t>(y), 0};
+    blit.dstOffsets[1] = {static_cast<int32_t>(x + width), static_cast<int32_t>(y + height), 1};
+    if (blit.dstOffsets[1].x > blit.dstOffsets[0].x && blit.dstOffsets[1].y > blit.dstOffsets[0].y &&
+        blit.srcOffsets[1].x > blit.srcOffsets[0].x && blit.srcOffsets[1].y > blit.srcOffsets[0].y) {
+        VkFilter filter = g_engine.textureFilter == TEXTURE_FILTER_NEAREST ? VK_FILTER_NEAREST : VK_FILTER_LINEAR;
+        vkCmdBlitImage(cmd, backdrop.image, VK_IMAGE_LAYOUT_TRANSFER_SRC_OPTIMAL,
+                       target, VK_IMAGE_LAYOUT_TRANSFER_DST_OPTIMAL, 1, &blit, filter);
+    }
+
+    barriers[0].oldLayout = VK_IMAGE_LAYOUT_TRANSFER_DST_OPTIMAL;
+    barriers[0].newLayout = VK_IMAGE_LAYOUT_COLOR_ATTACHMENT_OPTIMAL;
+    barriers[0].srcAccessMask = VK_ACCESS_TRANSFER_WRITE_BIT;
+    barriers[0].dstAccessMask = VK_ACCESS_COLOR_ATTACHMENT_READ_BIT | VK_ACCESS_COLOR_ATTACHMENT_WRITE_BIT;
+    barriers[1].oldLayout = VK_IMAGE_LAYOUT_TRANSFER_SRC_OPTIMAL;
+    barriers[1].newLayout = VK_IMAGE_LAYOUT_SHADER_READ_ONLY_OPTIMAL;
+    barriers[1].srcAccessMask = VK_ACCESS_TRANSFER_READ_BIT;
+    barriers[1].dstAccessMask = VK_ACCESS_SHADER_READ_BIT;
+    vkCmdPipelineBarrier(cmd, VK_PIPELINE_STAGE_TRANSFER_BIT,
+                         VK_PIPELINE_STAGE_COLOR_ATTACHMENT_OUTPUT_BIT | VK_PIPELINE_STAGE_FRAGMENT_SHADER_BIT,
+                         0, 0, nullptr, 0, nullptr, 2, barriers);
+}
+
 int boulder_begin_frame(uint32_t* imageIndex) {
+    NATIVE_TRY
+    if (g_engine.paused && g_engine.initialized) {
+        return -3;
+    }
+
+    // The swapchain was released while paused (Android) and is rebuilt like after a resize
+    if (g_engine.initialized && g_engine.device && !g_engine.swapchain && g_engine.swapchainNeedsRecreate) {
+        return -2;
+    }
+
     if (!g_engine.initialized || !g_engine.device || !g_engine.swapchain) {
-        Logger::get().error("Cannot begin frame: engine not initialized");
+        fail(ERROR_NOT_INITIALIZED, "Cannot begin frame: engine not initialized");
+        return -1;
+    }
+
+    if (g_engine.activeCommandBuffer) {
+        apiMisuse("BeginFrame called again before EndFrame");
         return -1;
     }
 
@@ -2272,9 +10772,33 @@ int boulder_begin_frame(uint32_t* imageIndex) {
         return -2;
     }
 
+    // The last frame's draws are complete; start counting this one's
+    g_engine.renderStats.drawCalls = g_engine.frameDrawCalls;
+    g_engine.renderStats.triangles = g_engine.frameTriangles;
+    g_engine.frameDrawCalls = 0;
+    g_engine.frameTriangles = 0;
+
+    // Pipelines that finished compiling replace their fallback from this frame on
+    pollAsyncCompiles(false);
 
-    // Wait for the fence for this frame
-    vkWaitForFences(g_engine.device, 1, &g_engine.inFlightFences[g_engine.currentFrameIndex], VK_TRUE, UINT64_MAX);
+    // Wait for the fence for this frame. Debug mode reports a GPU that stops making progress.
+    auto waitStart = std::chrono::steady_clock::now();
+    VkFence frameFence = g_engine.inFlightFences[g_engine.currentFrameIndex];
+    VkResult waitResult = vkWaitForFences(g_engine.device, 1, &frameFence, VK_TRUE,
+                                          g_engine.debugMode ? GPU_HANG_TIMEOUT : UINT64_MAX);
+    if (waitResult == VK_TIMEOUT) {
+        apiMisuse("GPU has not finished a frame in 2 seconds (a shader may be looping or reading out of bounds)");
+        waitResult = vkWaitForFences(g_engine.device, 1, &frameFence, VK_TRUE, UINT64_MAX);
+    }
+    if (waitResult == VK_ERROR_DEVICE_LOST) {
+        apiMisuse("GPU device lost (enable debug mode before Init for validation errors)");
+        return -1;
+    }
+    collectFrameTimings();
+    readGpuFrameTime(g_engine.currentFrameIndex);
+    if (g_engine.frameStart == std::chrono::steady_clock::time_point{}) {
+        g_engine.frameStart = std::chrono::steady_clock::now();
+    }
 
     // Acquire next image (before resetting fence, in case acquisition fails)
     VkResult result = vkAcquireNextImageKHR(
@@ -2290,7 +10814,7 @@ int boulder_begin_frame(uint32_t* imageIndex) {
         g_engine.swapchainNeedsRecreate = true;
         return -2;
     } else if (result != VK_SUCCESS) {
-        Logger::get().error("Failed to acquire swapchain image: {}", (int)result);
+        fail(ERROR_VULKAN, "Failed to acquire swapchain image: {}", (int)result);
         return -1;
     }
 
@@ -2299,6 +10823,7 @@ int boulder_begin_frame(uint32_t* imageIndex) {
     if (g_engine.imagesInFlight[*imageIndex] != VK_NULL_HANDLE) {
         vkWaitForFences(g_engine.device, 1, &g_engine.imagesInFlight[*imageIndex], VK_TRUE, UINT64_MAX);
     }
+    g_engine.frameWaitMs += std::chrono::duration<double, std::milli>(std::chrono::steady_clock::now() - waitStart).count();
 
     // Now safe to reset our fence (after waiting for any previous use)
     vkResetFences(g_engine.device, 1, &g_engine.inFlightFences[g_engine.currentFrameIndex]);
@@ -2310,10 +10835,15 @@ int boulder_begin_frame(uint32_t* imageIndex) {
     if (g_engine.modelDescriptorPools[g_engine.currentFrameIndex]) {
         vkResetDescriptorPool(g_engine.device, g_engine.modelDescriptorPools[g_engine.currentFrameIndex], 0);
     }
+    g_engine.materialParamOffset = 0;
 
     // Begin command buffer
     VkCommandBuffer cmd = g_engine.commandBuffers[g_engine.currentFrameIndex];
     g_engine.activeCommandBuffer = cmd;
+    g_engine.activeImageIndex = *imageIndex;
+    g_engine.boundPipeline = nullptr;
+    g_engine.boundPipelineId = 0;
+    g_engine.framePipelines.clear();
 
     vkResetCommandBuffer(cmd, 0);
 
@@ -2322,11 +10852,23 @@ int boulder_begin_frame(uint32_t* imageIndex) {
     beginInfo.flags = VK_COMMAND_BUFFER_USAGE_ONE_TIME_SUBMIT_BIT;
 
     if (vkBeginCommandBuffer(cmd, &beginInfo) != VK_SUCCESS) {
-        Logger::get().error("Failed to begin command buffer");
+        fail(ERROR_VULKAN, "Failed to begin command buffer");
         g_engine.activeCommandBuffer = nullptr;
         return -1;
     }
 
+    if (g_engine.timestampPool) {
+        uint32_t firstQuery = 2 * g_engine.currentFrameIndex;
+        vkCmdResetQueryPool(cmd, g_engine.timestampPool, firstQuery, 2);
+        vkCmdWriteTimestamp(cmd, VK_PIPELINE_STAGE_TOP_OF_PIPE_BIT, g_engine.timestampPool, firstQuery);
+    }
+
+    // With a backdrop the image is cleared and drawn on by a blit, and rendering loads it
+    bool backdrop = g_engine.backdrop.image != VK_NULL_HANDLE;
+    if (backdrop) {
+        recordBackdrop(cmd, *imageIndex);
+    }
+
     // Transition image layout from PRESENT_SRC (or UNDEFINED on first frame, which is compatible)
     VkImageMemoryBarrier barrier{};
     barrier.sType = VK_STRUCTURE_TYPE_IMAGE_MEMORY_BARRIER;
@@ -2343,18 +10885,23 @@ int boulder_begin_frame(uint32_t* imageIndex) {
     barrier.srcAccessMask = 0;
     barrier.dstAccessMask = VK_ACCESS_COLOR_ATTACHMENT_WRITE_BIT;
 
-    vkCmdPipelineBarrier(cmd, VK_PIPELINE_STAGE_COLOR_ATTACHMENT_OUTPUT_BIT, VK_PIPELINE_STAGE_COLOR_ATTACHMENT_OUTPUT_BIT,
-                         0, 0, nullptr, 0, nullptr, 1, &barrier);
+    if (!backdrop) {
+        vkCmdPipelineBarrier(cmd, VK_PIPELINE_STAGE_COLOR_ATTACHMENT_OUTPUT_BIT, VK_PIPELINE_STAGE_COLOR_ATTACHMENT_OUTPUT_BIT,
+                             0, 0, nullptr, 0, nullptr, 1, &barrier);
+    }
 
     // Transition depth image to depth attachment optimal
+    bool hasStencil = g_engine.stencilFormat != VK_FORMAT_UNDEFINED;
+    VkImageLayout depthLayout = hasStencil ? VK_IMAGE_LAYOUT_DEPTH_STENCIL_ATTACHMENT_OPTIMAL
+                                           : VK_IMAGE_LAYOUT_DEPTH_ATTACHMENT_OPTIMAL;
     VkImageMemoryBarrier depthBarrier{};
     depthBarrier.sType = VK_STRUCTURE_TYPE_IMAGE_MEMORY_BARRIER;
     depthBarrier.oldLayout = VK_IMAGE_LAYOUT_UNDEFINED;
-    depthBarrier.newLayout = VK_IMAGE_LAYOUT_DEPTH_ATTACHMENT_OPTIMAL;
+    depthBarrier.newLayout = depthLayout;
     depthBarrier.srcQueueFamilyIndex = VK_QUEUE_FAMILY_IGNORED;
     depthBarrier.dstQueueFamilyIndex = VK_QUEUE_FAMILY_IGNORED;
     depthBarrier.image = g_engine.depthImage;
-    depthBarrier.subresourceRange.aspectMask = VK_IMAGE_ASPECT_DEPTH_BIT;
+    depthBarrier.subresourceRange.aspectMask = VK_IMAGE_ASPECT_DEPTH_BIT | (hasStencil ? VK_IMAGE_ASPECT_STENCIL_BIT : 0);
     depthBarrier.subresourceRange.baseMipLevel = 0;
     depthBarrier.subresourceRange.levelCount = 1;
     depthBarrier.subresourceRange.baseArrayLayer = 0;
@@ -2370,14 +10917,14 @@ int boulder_begin_frame(uint32_t* imageIndex) {
     colorAttachment.sType = VK_STRUCTURE_TYPE_RENDERING_ATTACHMENT_INFO;
     colorAttachment.imageView = g_engine.swapchainImageViews[*imageIndex];
     colorAttachment.imageLayout = VK_IMAGE_LAYOUT_COLOR_ATTACHMENT_OPTIMAL;
-    colorAttachment.loadOp = VK_ATTACHMENT_LOAD_OP_CLEAR;
+    colorAttachment.loadOp = backdrop ? VK_ATTACHMENT_LOAD_OP_LOAD : VK_ATTACHMENT_LOAD_OP_CLEAR;
     colorAttachment.storeOp = VK_ATTACHMENT_STORE_OP_STORE;
     colorAttachment.clearValue.color = g_engine.clearColor;
 
     VkRenderingAttachmentInfo depthAttachment{};
     depthAttachment.sType = VK_STRUCTURE_TYPE_RENDERING_ATTACHMENT_INFO;
     depthAttachment.imageView = g_engine.depthImageView;
-    depthAttachment.imageLayout = VK_IMAGE_LAYOUT_DEPTH_ATTACHMENT_OPTIMAL;
+    depthAttachment.imageLayout = depthLayout;
     depthAttachment.loadOp = VK_ATTACHMENT_LOAD_OP_CLEAR;
     depthAttachment.storeOp = VK_ATTACHMENT_STORE_OP_DONT_CARE;
     depthAttachment.clearValue.depthStencil = {1.0f, 0};
@@ -2390,15 +10937,85 @@ int boulder_begin_frame(uint32_t* imageIndex) {
     renderingInfo.colorAttachmentCount = 1;
     renderingInfo.pColorAttachments = &colorAttachment;
     renderingInfo.pDepthAttachment = &depthAttachment;
+    renderingInfo.pStencilAttachment = hasStencil ? &depthAttachment : nullptr;
 
     vkCmdBeginRendering(cmd, &renderingInfo);
 
     return 0;
+    NATIVE_CATCH(-1)
+}
+
+// Records a copy of the rendered swapchain image into the screenshot buffer, leaving the
+// image in TRANSFER_SRC_OPTIMAL
+static bool recordScreenshotCopy(VkCommandBuffer cmd, uint32_t imageIndex) {
+    g_engine.screenshotRequested = false;
+
+    VkFormat format = g_engine.swapchainFormat;
+    if (format != VK_FORMAT_B8G8R8A8_UNORM && format != VK_FORMAT_B8G8R8A8_SRGB &&
+        format != VK_FORMAT_R8G8B8A8_UNORM && format != VK_FORMAT_R8G8B8A8_SRGB) {
+        fail(ERROR_UNSUPPORTED, "Screenshots not supported for swapchain format {}", (int)format);
+        return false;
+    }
+
+    VkExtent2D extent = g_engine.swapchainExtent;
+    VkDeviceSize size = static_cast<VkDeviceSize>(extent.width) * extent.height * 4;
+    if (size != g_engine.screenshotSize) {
+        if (g_engine.screenshotBuffer) {
+            // An older capture may still be in flight
+            vkDeviceWaitIdle(g_engine.device);
+            vkDestroyBuffer(g_engine.device, g_engine.screenshotBuffer, nullptr);
+            freeDeviceMemory(g_engine.device, g_engine.screenshotMemory, nullptr);
+        }
+        createBuffer(size, VK_BUFFER_USAGE_TRANSFER_DST_BIT,
+                     VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT | VK_MEMORY_PROPERTY_HOST_COHERENT_BIT,
+                     g_engine.screenshotBuffer, g_engine.screenshotMemory);
+        g_engine.screenshotSize = size;
+    }
+    g_engine.screenshotExtent = extent;
+
+    VkImageMemoryBarrier barrier{};
+    barrier.sType = VK_STRUCTURE_TYPE_IMAGE_MEMORY_BARRIER;
+    barrier.oldLayout = VK_IMAGE_LAYOUT_COLOR_ATTACHMENT_OPTIMAL;
+    barrier.newLayout = VK_IMAGE_LAYOUT_TRANSFER_SRC_OPTIMAL;
+    barrier.srcQueueFamilyIndex = VK_QUEUE_FAMILY_IGNORED;
+    barrier.dstQueueFamilyIndex = VK_QUEUE_FAMILY_IGNORED;
+    barrier.image = g_engine.swapchainImages[imageIndex];
+    barrier.subresourceRange = {VK_IMAGE_ASPECT_COLOR_BIT, 0, 1, 0, 1};
+    barrier.srcAccessMask = VK_ACCESS_COLOR_ATTACHMENT_WRITE_BIT;
+    barrier.dstAccessMask = VK_ACCESS_TRANSFER_READ_BIT;
+    vkCmdPipelineBarrier(cmd, VK_PIPELINE_STAGE_COLOR_ATTACHMENT_OUTPUT_BIT, VK_PIPELINE_STAGE_TRANSFER_BIT,
+                         0, 0, nullptr, 0, nullptr, 1, &barrier);
+
+    VkBufferImageCopy region{};
+    region.imageSubresource = {VK_IMAGE_ASPECT_COLOR_BIT, 0, 0, 1};
+    region.imageExtent = {extent.width, extent.height, 1};
+    vkCmdCopyImageToBuffer(cmd, g_engine.swapchainImages[imageIndex], VK_IMAGE_LAYOUT_TRANSFER_SRC_OPTIMAL,
+                           g_engine.screenshotBuffer, 1, &region);
+
+    // Make the copy visible to the host once the frame's fence signals
+    VkMemoryBarrier hostBarrier{};
+    hostBarrier.sType = VK_STRUCTURE_TYPE_MEMORY_BARRIER;
+    hostBarrier.srcAccessMask = VK_ACCESS_TRANSFER_WRITE_BIT;
+    hostBarrier.dstAccessMask = VK_ACCESS_HOST_READ_BIT;
+    vkCmdPipelineBarrier(cmd, VK_PIPELINE_STAGE_TRANSFER_BIT, VK_PIPELINE_STAGE_HOST_BIT,
+                         0, 1, &hostBarrier, 0, nullptr, 0, nullptr);
+    return true;
 }
 
 int boulder_end_frame(uint32_t imageIndex) {
-    if (!g_engine.initialized || !g_engine.device || !g_engine.activeCommandBuffer) {
-        Logger::get().error("Cannot end frame: no active command buffer");
+    NATIVE_TRY
+    SubsystemTimer timer{g_engine.subsystemTimes.submitMs};
+    if (!g_engine.initialized || !g_engine.device) {
+        fail(ERROR_NOT_INITIALIZED, "Cannot end frame: engine not initialized");
+        return -1;
+    }
+    if (!g_engine.activeCommandBuffer) {
+        apiMisuse("EndFrame called without BeginFrame");
+        return -1;
+    }
+    if (imageIndex != g_engine.activeImageIndex) {
+        apiMisuse(std::format("EndFrame called with image {}, but BeginFrame acquired image {}",
+                              imageIndex, g_engine.activeImageIndex));
         return -1;
     }
 
@@ -2407,10 +11024,12 @@ int boulder_end_frame(uint32_t imageIndex) {
     // End rendering
     vkCmdEndRendering(cmd);
 
+    bool captured = g_engine.screenshotRequested && recordScreenshotCopy(cmd, imageIndex);
+
     // Transition image layout for presentation
     VkImageMemoryBarrier barrier{};
     barrier.sType = VK_STRUCTURE_TYPE_IMAGE_MEMORY_BARRIER;
-    barrier.oldLayout = VK_IMAGE_LAYOUT_COLOR_ATTACHMENT_OPTIMAL;
+    barrier.oldLayout = captured ? VK_IMAGE_LAYOUT_TRANSFER_SRC_OPTIMAL : VK_IMAGE_LAYOUT_COLOR_ATTACHMENT_OPTIMAL;
     barrier.newLayout = VK_IMAGE_LAYOUT_PRESENT_SRC_KHR;
     barrier.srcQueueFamilyIndex = VK_QUEUE_FAMILY_IGNORED;
     barrier.dstQueueFamilyIndex = VK_QUEUE_FAMILY_IGNORED;
@@ -2420,15 +11039,20 @@ int boulder_end_frame(uint32_t imageIndex) {
     barrier.subresourceRange.levelCount = 1;
     barrier.subresourceRange.baseArrayLayer = 0;
     barrier.subresourceRange.layerCount = 1;
-    barrier.srcAccessMask = VK_ACCESS_COLOR_ATTACHMENT_WRITE_BIT;
+    barrier.srcAccessMask = captured ? VK_ACCESS_TRANSFER_READ_BIT : VK_ACCESS_COLOR_ATTACHMENT_WRITE_BIT;
     barrier.dstAccessMask = 0;
 
-    vkCmdPipelineBarrier(cmd, VK_PIPELINE_STAGE_COLOR_ATTACHMENT_OUTPUT_BIT, VK_PIPELINE_STAGE_BOTTOM_OF_PIPE_BIT,
-                         0, 0, nullptr, 0, nullptr, 1, &barrier);
+    vkCmdPipelineBarrier(cmd, captured ? VK_PIPELINE_STAGE_TRANSFER_BIT : VK_PIPELINE_STAGE_COLOR_ATTACHMENT_OUTPUT_BIT,
+                         VK_PIPELINE_STAGE_BOTTOM_OF_PIPE_BIT, 0, 0, nullptr, 0, nullptr, 1, &barrier);
+
+    if (g_engine.timestampPool) {
+        vkCmdWriteTimestamp(cmd, VK_PIPELINE_STAGE_BOTTOM_OF_PIPE_BIT, g_engine.timestampPool,
+                            2 * g_engine.currentFrameIndex + 1);
+    }
 
     // End command buffer
     if (vkEndCommandBuffer(cmd) != VK_SUCCESS) {
-        Logger::get().error("Failed to record command buffer");
+        fail(ERROR_VULKAN, "Failed to record command buffer");
         g_engine.activeCommandBuffer = nullptr;
         return -1;
     }
@@ -2450,44 +11074,283 @@ int boulder_end_frame(uint32_t imageIndex) {
 
     auto res = vkQueueSubmit(g_engine.graphicsQueue, 1, &submitInfo, g_engine.inFlightFences[g_engine.currentFrameIndex]);
 
-    if (res != VK_SUCCESS) {
-        Logger::get().error("Failed to submit draw command buffer: {}", (int)res);
-        g_engine.activeCommandBuffer = nullptr;
+    if (res != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to submit draw command buffer: {}", (int)res);
+        g_engine.activeCommandBuffer = nullptr;
+        return -1;
+    }
+    g_engine.timestampsWritten[g_engine.currentFrameIndex] = g_engine.timestampPool != nullptr;
+
+    // CPU time is the whole frame so far less the time BeginFrame spent waiting for the GPU
+    double frameMs = std::chrono::duration<double, std::milli>(std::chrono::steady_clock::now() - g_engine.frameStart).count();
+    g_engine.cpuFrameMs = std::max(frameMs - g_engine.frameWaitMs, 0.0);
+    g_engine.subsystemTimes.waitMs = static_cast<float>(g_engine.frameWaitMs);
+    g_engine.frameWaitMs = 0;
+
+    // Present
+    VkPresentInfoKHR presentInfo{};
+    presentInfo.sType = VK_STRUCTURE_TYPE_PRESENT_INFO_KHR;
+    presentInfo.waitSemaphoreCount = 1;
+    presentInfo.pWaitSemaphores = signalSemaphores;
+    VkSwapchainKHR swapchains[] = {g_engine.swapchain};
+    presentInfo.swapchainCount = 1;
+    presentInfo.pSwapchains = swapchains;
+    presentInfo.pImageIndices = &imageIndex;
+
+    // With present wait, present stats and low latency mode follow the frame to the screen
+    uint64_t presentId = 0;
+    VkPresentIdKHR presentIdInfo{};
+    if (g_engine.presentWaitSupported) {
+        presentId = g_engine.nextPresentId++;
+        presentIdInfo.sType = VK_STRUCTURE_TYPE_PRESENT_ID_KHR;
+        presentIdInfo.swapchainCount = 1;
+        presentIdInfo.pPresentIds = &presentId;
+        presentInfo.pNext = &presentIdInfo;
+    }
+
+    VkResult result = vkQueuePresentKHR(g_engine.graphicsQueue, &presentInfo);
+
+    if (result == VK_ERROR_OUT_OF_DATE_KHR || result == VK_SUBOPTIMAL_KHR) {
+        g_engine.swapchainNeedsRecreate = true;
+    } else if (result != VK_SUCCESS) {
+        fail(ERROR_VULKAN, "Failed to present swapchain image");
+    }
+
+    if (captured) {
+        g_engine.screenshotPending = true;
+        g_engine.screenshotFrame = g_engine.currentFrameIndex;
+    }
+
+    FrameTiming& timing = g_engine.frameTimings[g_engine.currentFrameIndex];
+    timing.start = g_engine.frameStart;
+    timing.presentId = result == VK_SUCCESS ? presentId : 0;
+    timing.pending = true;
+
+    if (g_engine.lowLatency) {
+        // Wait until the frame is on screen, so the next one starts from fresh input
+        frameCompleted(g_engine.currentFrameIndex, LOW_LATENCY_WAIT_TIMEOUT);
+    }
+
+    g_engine.activeCommandBuffer = nullptr;
+    g_engine.currentFrameIndex = (g_engine.currentFrameIndex + 1) % g_engine.framesInFlight;
+
+    collectFrameTimings();
+    g_engine.frameStart = std::chrono::steady_clock::now();
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+void boulder_request_screenshot() {
+    NATIVE_TRY
+    g_engine.screenshotRequested = true;
+    NATIVE_CATCH()
+}
+
+int boulder_get_screenshot(uint8_t* rgba, uint32_t capacity, uint32_t* width, uint32_t* height) {
+    NATIVE_TRY
+    if (!g_engine.device || !width || !height) {
+        return -1;
+    }
+    if (!g_engine.screenshotPending) {
+        return g_engine.screenshotRequested ? 1 : -1;
+    }
+
+    *width = g_engine.screenshotExtent.width;
+    *height = g_engine.screenshotExtent.height;
+    uint32_t size = *width * *height * 4;
+    if (!rgba || capacity < size) {
+        return 2; // Caller needs a bigger buffer
+    }
+
+    vkWaitForFences(g_engine.device, 1, &g_engine.inFlightFences[g_engine.screenshotFrame], VK_TRUE, UINT64_MAX);
+
+    void* mapped;
+    vkMapMemory(g_engine.device, g_engine.screenshotMemory, 0, size, 0, &mapped);
+    memcpy(rgba, mapped, size);
+    vkUnmapMemory(g_engine.device, g_engine.screenshotMemory);
+
+    // Swapchains are usually BGRA
+    if (g_engine.swapchainFormat == VK_FORMAT_B8G8R8A8_UNORM || g_engine.swapchainFormat == VK_FORMAT_B8G8R8A8_SRGB) {
+        for (uint32_t i = 0; i < size; i += 4) {
+            std::swap(rgba[i], rgba[i + 2]);
+        }
+    }
+
+    g_engine.screenshotPending = false;
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+void boulder_set_clear_color(float r, float g, float b, float a) {
+    NATIVE_TRY
+    g_engine.clearColor = {{r, g, b, a}};
+    NATIVE_CATCH()
+}
+
+int boulder_set_backdrop(const void* rgba, uint32_t width, uint32_t height, int fit) {
+    NATIVE_TRY
+    if (!g_engine.initialized || !g_engine.device) {
+        return -1;
+    }
+    if (rgba && (width == 0 || height == 0)) {
+        return -1;
+    }
+    if (fit != BACKDROP_FIT_CONTAIN && fit != BACKDROP_FIT_COVER) {
+        return -1;
+    }
+
+    // Frames in flight may still blit the previous image
+    if (g_engine.backdrop.image) {
+        vkDeviceWaitIdle(g_engine.device);
+        destroyTextureImage(g_engine.backdrop);
+    }
+    g_engine.backdrop.pixels.clear();
+    g_engine.backdropFit = fit;
+    if (!rgba) {
+        return 0;
+    }
+
+    g_engine.backdrop.width = width;
+    g_engine.backdrop.height = height;
+    g_engine.backdrop.pixels.assign(static_cast<const uint8_t*>(rgba), static_cast<const uint8_t*>(rgba) + (size_t)width * height * 4);
+    if (!uploadBackdrop()) {
+        g_engine.backdrop.pixels.clear();
+        return -1;
+    }
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_has_backdrop() {
+    NATIVE_TRY
+    return g_engine.backdrop.pixels.empty() ? 0 : 1;
+    NATIVE_CATCH(0)
+}
+
+int boulder_set_camera_perspective(float fovY, float nearZ, float farZ) {
+    NATIVE_TRY
+    if (fovY <= 0.0f || fovY >= 180.0f || nearZ <= 0.0f || farZ <= nearZ) {
+        return -1;
+    }
+
+    g_engine.camera.projection = CAMERA_PERSPECTIVE;
+    g_engine.camera.fovY = fovY;
+    g_engine.camera.nearZ = nearZ;
+    g_engine.camera.farZ = farZ;
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_set_camera_orthographic(float height, float nearZ, float farZ) {
+    NATIVE_TRY
+    if (height <= 0.0f || farZ <= nearZ) {
+        return -1;
+    }
+
+    g_engine.camera.projection = CAMERA_ORTHOGRAPHIC;
+    g_engine.camera.orthoHeight = height;
+    g_engine.camera.nearZ = nearZ;
+    g_engine.camera.farZ = farZ;
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_set_camera_look_at(float px, float py, float pz, float tx, float ty, float tz,
+                               float ux, float uy, float uz) {
+    NATIVE_TRY
+    glm::vec3 up(ux, uy, uz);
+    if (glm::length(up) < 1e-6f) {
+        return -1;
+    }
+
+    g_engine.camera.position = glm::vec3(px, py, pz);
+    g_engine.camera.target = glm::vec3(tx, ty, tz);
+    g_engine.camera.up = glm::normalize(up);
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_set_camera_pixel_perfect(float pixelsPerUnit, int zoom, int snap) {
+    NATIVE_TRY
+    if (pixelsPerUnit < 0.0f || zoom < 0 || snap < CAMERA_SNAP_NONE || snap > CAMERA_SNAP_TEXEL) {
         return -1;
     }
 
-    // Present
-    VkPresentInfoKHR presentInfo{};
-    presentInfo.sType = VK_STRUCTURE_TYPE_PRESENT_INFO_KHR;
-    presentInfo.waitSemaphoreCount = 1;
-    presentInfo.pWaitSemaphores = signalSemaphores;
-    VkSwapchainKHR swapchains[] = {g_engine.swapchain};
-    presentInfo.swapchainCount = 1;
-    presentInfo.pSwapchains = swapchains;
-    presentInfo.pImageIndices = &imageIndex;
+    g_engine.camera.pixelsPerUnit = pixelsPerUnit;
+    g_engine.camera.zoom = zoom;
+    g_engine.camera.snap = snap;
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    VkResult result = vkQueuePresentKHR(g_engine.graphicsQueue, &presentInfo);
+float boulder_get_camera_pixel_scale() {
+    NATIVE_TRY
+    return cameraPixelScale();
+    NATIVE_CATCH(0.0f)
+}
 
-    if (result == VK_ERROR_OUT_OF_DATE_KHR || result == VK_SUBOPTIMAL_KHR) {
-        g_engine.swapchainNeedsRecreate = true;
-    } else if (result != VK_SUCCESS) {
-        Logger::get().error("Failed to present swapchain image");
+int boulder_camera_screen_ray(float x, float y, float* origin, float* direction) {
+    NATIVE_TRY
+    if (!origin || !direction || g_engine.swapchainExtent.width == 0 || g_engine.swapchainExtent.height == 0) {
+        return -1;
     }
 
-    g_engine.activeCommandBuffer = nullptr;
-    g_engine.currentFrameIndex = (g_engine.currentFrameIndex + 1) % MAX_FRAMES_IN_FLIGHT;
+    glm::mat4 view, proj;
+    cameraMatrices(view, proj);
+    glm::mat4 inverse = glm::inverse(proj * view);
 
+    // Orthographic projections map depth to [0, 1], perspective ones to [-1, 1]
+    float nearDepth = g_engine.camera.projection == CAMERA_ORTHOGRAPHIC ? 0.0f : -1.0f;
+    float ndcX = x / g_engine.swapchainExtent.width * 2.0f - 1.0f;
+    float ndcY = y / g_engine.swapchainExtent.height * 2.0f - 1.0f;
+    glm::vec4 nearPoint = inverse * glm::vec4(ndcX, ndcY, nearDepth, 1.0f);
+    glm::vec4 farPoint = inverse * glm::vec4(ndcX, ndcY, 1.0f, 1.0f);
+
+    glm::vec3 from = glm::vec3(nearPoint) / nearPoint.w;
+    glm::vec3 dir = glm::normalize(glm::vec3(farPoint) / farPoint.w - from);
+    memcpy(origin, &from, sizeof(float) * 3);
+    memcpy(direction, &dir, sizeof(float) * 3);
     return 0;
+    NATIVE_CATCH(-1)
 }
 
-void boulder_set_clear_color(float r, float g, float b, float a) {
-    g_engine.clearColor = {{r, g, b, a}};
+int boulder_set_texture_filter(int filter) {
+    NATIVE_TRY
+    if (filter != TEXTURE_FILTER_LINEAR && filter != TEXTURE_FILTER_NEAREST) {
+        return -1;
+    }
+    if (filter == g_engine.textureFilter) {
+        return 0;
+    }
+
+    g_engine.textureFilter = filter;
+    if (!g_engine.device) {
+        return 0; // Used when the device is created
+    }
+
+    // Frames in flight may still be sampling with the old sampler
+    vkDeviceWaitIdle(g_engine.device);
+    return createTextureSampler();
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_texture_filter() {
+    NATIVE_TRY
+    return g_engine.textureFilter;
+    NATIVE_CATCH(0)
 }
 
-void boulder_set_viewport(float x, float y, float width, float height, float minDepth, float maxDepth) {
+int boulder_set_viewport(float x, float y, float width, float height, float minDepth, float maxDepth) {
+    NATIVE_TRY
     if (!g_engine.initialized || !g_engine.activeCommandBuffer) {
-        Logger::get().error("Cannot set viewport: no active command buffer");
-        return;
+        apiMisuse("SetViewport called outside a frame (call BeginFrame first)");
+        return -1;
+    }
+    if (width <= 0 || height == 0 || minDepth < 0 || minDepth > 1 || maxDepth < 0 || maxDepth > 1) {
+        apiMisuse(std::format("SetViewport called with invalid size {}x{} or depth range {} to {}",
+                              width, height, minDepth, maxDepth));
+        return -1;
     }
 
     VkViewport viewport{};
@@ -2499,12 +11362,19 @@ void boulder_set_viewport(float x, float y, float width, float height, float min
     viewport.maxDepth = maxDepth;
 
     vkCmdSetViewport(g_engine.activeCommandBuffer, 0, 1, &viewport);
+    return 0;
+    NATIVE_CATCH(-1)
 }
 
-void boulder_set_scissor(int x, int y, int width, int height) {
+int boulder_set_scissor(int x, int y, int width, int height) {
+    NATIVE_TRY
     if (!g_engine.initialized || !g_engine.activeCommandBuffer) {
-        Logger::get().error("Cannot set scissor: no active command buffer");
-        return;
+        apiMisuse("SetScissor called outside a frame (call BeginFrame first)");
+        return -1;
+    }
+    if (x < 0 || y < 0 || width < 0 || height < 0) {
+        apiMisuse(std::format("SetScissor called with negative rectangle ({}, {}, {}, {})", x, y, width, height));
+        return -1;
     }
 
     VkRect2D scissor{};
@@ -2512,65 +11382,140 @@ void boulder_set_scissor(int x, int y, int width, int height) {
     scissor.extent = {static_cast<uint32_t>(width), static_cast<uint32_t>(height)};
 
     vkCmdSetScissor(g_engine.activeCommandBuffer, 0, 1, &scissor);
+    return 0;
+    NATIVE_CATCH(-1)
 }
 
 // Draw commands
-void boulder_draw_mesh(uint32_t groupCountX, uint32_t groupCountY, uint32_t groupCountZ) {
+int boulder_draw_mesh(uint32_t groupCountX, uint32_t groupCountY, uint32_t groupCountZ) {
+    NATIVE_TRY
     if (!g_engine.initialized || !g_engine.activeCommandBuffer) {
-        Logger::get().error("Cannot draw mesh: no active command buffer");
-        return;
+        apiMisuse("DrawMesh called outside a frame (call BeginFrame first)");
+        return -1;
+    }
+    if (!g_engine.boundPipeline) {
+        apiMisuse("DrawMesh called without a pipeline bound this frame (call Pipeline.Bind)");
+        return -1;
+    }
+
+    if (g_engine.debugMode) {
+        const auto& limits = g_engine.meshShaderProperties;
+        uint64_t total = uint64_t(groupCountX) * groupCountY * groupCountZ;
+        if (groupCountX > limits.maxMeshWorkGroupCount[0] || groupCountY > limits.maxMeshWorkGroupCount[1] ||
+            groupCountZ > limits.maxMeshWorkGroupCount[2] || total > limits.maxMeshWorkGroupTotalCount) {
+            apiMisuse(std::format("DrawMesh group count {}x{}x{} exceeds the device limit of {}x{}x{} ({} total)",
+                                  groupCountX, groupCountY, groupCountZ, limits.maxMeshWorkGroupCount[0],
+                                  limits.maxMeshWorkGroupCount[1], limits.maxMeshWorkGroupCount[2],
+                                  limits.maxMeshWorkGroupTotalCount));
+            return -1;
+        }
     }
 
     vkCmdDrawMeshTasksEXT(g_engine.activeCommandBuffer, groupCountX, groupCountY, groupCountZ);
+    g_engine.frameDrawCalls++;
+    return 0;
+    NATIVE_CATCH(-1)
 }
 
-void boulder_set_push_constants(const void* data, uint32_t size, uint32_t offset) {
+int boulder_set_push_constants(const void* data, uint32_t size, uint32_t offset) {
+    NATIVE_TRY
     if (!g_engine.initialized || !g_engine.activeCommandBuffer) {
-        Logger::get().error("Cannot set push constants: no active command buffer");
-        return;
+        apiMisuse("SetPushConstants called outside a frame (call BeginFrame first)");
+        return -1;
     }
 
     if (!data || size == 0) {
-        Logger::get().error("Cannot set push constants: invalid data or size");
-        return;
+        apiMisuse("SetPushConstants called with no data");
+        return -1;
     }
 
-    // Find the pipeline layout for the currently bound pipeline
-    VkPipelineLayout layout = VK_NULL_HANDLE;
-    for (const auto& [id, pipeline] : g_engine.pipelines) {
-        if (pipeline == g_engine.boundPipeline) {
-            auto layoutIt = g_engine.pipelineLayouts.find(id);
-            if (layoutIt != g_engine.pipelineLayouts.end()) {
-                layout = layoutIt->second;
-                break;
-            }
-        }
+    if (!g_engine.boundPipelineId) {
+        apiMisuse("SetPushConstants called without a pipeline bound this frame (call Pipeline.Bind)");
+        return -1;
     }
 
-    if (layout == VK_NULL_HANDLE) {
-        Logger::get().error("Cannot set push constants: no pipeline layout found for bound pipeline");
-        return;
+    auto layoutIt = g_engine.pipelineLayouts.find(g_engine.boundPipelineId);
+    if (layoutIt == g_engine.pipelineLayouts.end()) {
+        apiMisuse(std::format("SetPushConstants called with pipeline {} bound, which has no push constants "
+                              "(material pipelines get theirs from RenderModels)", g_engine.boundPipelineId));
+        return -1;
+    }
+
+    if (offset % 4 != 0 || size % 4 != 0 || uint64_t(offset) + size > GRAPHICS_PUSH_CONSTANT_SIZE) {
+        apiMisuse(std::format("SetPushConstants range {} to {} is outside the pipeline's {} bytes or not 4 byte aligned",
+                              offset, uint64_t(offset) + size, GRAPHICS_PUSH_CONSTANT_SIZE));
+        return -1;
+    }
+
+    vkCmdPushConstants(g_engine.activeCommandBuffer, layoutIt->second, VK_SHADER_STAGE_MESH_BIT_EXT, offset, size, data);
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+// Debugging
+
+void boulder_set_debug_mode(int enabled) {
+    NATIVE_TRY
+    g_engine.debugMode = enabled != 0;
+    if (!g_engine.debugMode) {
+        g_engine.destroyedPipelines.clear();
     }
+    NATIVE_CATCH()
+}
+
+int boulder_get_debug_mode() {
+    NATIVE_TRY
+    return g_engine.debugMode ? 1 : 0;
+    NATIVE_CATCH(0)
+}
+
+int boulder_validation_enabled() {
+    NATIVE_TRY
+    return g_engine.debugMessenger ? 1 : 0;
+    NATIVE_CATCH(0)
+}
+
+uint32_t boulder_take_api_error(char* buffer, uint32_t capacity) {
+    return takeErrorMessage(g_engine.apiErrorMutex, g_engine.apiError, buffer, capacity);
+}
+
+uint32_t boulder_take_native_error(char* buffer, uint32_t capacity) {
+    return takeErrorMessage(g_engine.nativeErrorMutex, g_engine.nativeError, buffer, capacity);
+}
+
+uint32_t boulder_get_last_error_length() {
+    return t_lastError.code == ERROR_UNKNOWN ? 0 : static_cast<uint32_t>(t_lastError.message.size());
+}
 
-    vkCmdPushConstants(g_engine.activeCommandBuffer, layout, VK_SHADER_STAGE_MESH_BIT_EXT, offset, size, data);
+int boulder_get_last_error(char* buffer, uint32_t capacity) {
+    if (t_lastError.code == ERROR_UNKNOWN) {
+        copyString("", buffer, capacity);
+        return ERROR_UNKNOWN;
+    }
+    copyString(t_lastError.message.c_str(), buffer, capacity);
+    return t_lastError.code;
 }
 
 // Swapchain management
 void boulder_get_swapchain_extent(int* width, int* height) {
+    NATIVE_TRY
     if (width && height) {
         *width = g_engine.swapchainExtent.width;
         *height = g_engine.swapchainExtent.height;
     }
+    NATIVE_CATCH()
 }
 
 int boulder_recreate_swapchain() {
+    NATIVE_TRY
     if (!g_engine.initialized || !g_engine.device) {
-        Logger::get().error("Cannot recreate swapchain: engine not initialized");
+        fail(ERROR_NOT_INITIALIZED, "Cannot recreate swapchain: engine not initialized");
         return -1;
     }
 
     g_engine.swapchainNeedsRecreate = true;
     return 0;
+    NATIVE_CATCH(-1)
 }
 
 // Network implementation
@@ -2600,6 +11545,9 @@ struct BoulderNetworkSession {
     std::queue<NetworkEvent> eventQueue;
     std::mutex eventMutex;
     bool isServer = false;
+    bool accepting = true; // Cleared while a server drains
+    int timeoutInitialMs = 0;   // 0 keeps the GameNetworkingSockets default
+    int timeoutConnectedMs = 0;
 
     static void DebugOutput(ESteamNetworkingSocketsDebugOutputType eType, const char* pszMsg) {
         if (eType == k_ESteamNetworkingSocketsDebugOutputType_Msg ||
@@ -2620,6 +11568,16 @@ struct BoulderNetworkSession {
         return handle;
     }
 
+    // Applies the session's timeouts to a connection it made or accepted
+    void applyTimeouts(HSteamNetConnection conn) {
+        if (timeoutInitialMs > 0) {
+            SteamNetworkingUtils()->SetConnectionConfigValueInt32(conn, k_ESteamNetworkingConfig_TimeoutInitial, timeoutInitialMs);
+        }
+        if (timeoutConnectedMs > 0) {
+            SteamNetworkingUtils()->SetConnectionConfigValueInt32(conn, k_ESteamNetworkingConfig_TimeoutConnected, timeoutConnectedMs);
+        }
+    }
+
     void removeConnection(HSteamNetConnection conn) {
         auto it = connectionMap.find(conn);
         if (it != connectionMap.end()) {
@@ -2642,7 +11600,9 @@ struct BoulderNetworkSession {
             NetworkEvent event;
             event.type = 3; // Message
             event.connection = handle;
+            event.channel = msg->m_idxLane;
             event.dataSize = msg->m_cbSize;
+            event.timestamp = msg->m_usecTimeReceived;
             event.data = new uint8_t[msg->m_cbSize];
             memcpy(event.data, msg->m_pData, msg->m_cbSize);
 
@@ -2666,8 +11626,10 @@ struct BoulderNetworkSession {
                 NetworkEvent event;
                 event.type = 1; // Connected
                 event.connection = handle;
+                event.channel = 0;
                 event.data = nullptr;
                 event.dataSize = 0;
+                event.timestamp = SteamNetworkingUtils()->GetLocalTimestamp();
 
                 std::lock_guard<std::mutex> lock(session->eventMutex);
                 session->eventQueue.push(event);
@@ -2685,8 +11647,10 @@ struct BoulderNetworkSession {
                     NetworkEvent event;
                     event.type = 2; // Disconnected
                     event.connection = handle;
+                    event.channel = 0;
                     event.data = nullptr;
                     event.dataSize = 0;
+                    event.timestamp = SteamNetworkingUtils()->GetLocalTimestamp();
 
                     std::lock_guard<std::mutex> lock(session->eventMutex);
                     session->eventQueue.push(event);
@@ -2695,6 +11659,10 @@ struct BoulderNetworkSession {
                     session->removeConnection(pInfo->m_hConn);
                 }
 
+                {
+                    std::lock_guard<std::mutex> lock(g_sessionMapMutex);
+                    g_connectionSessions.erase(pInfo->m_hConn);
+                }
                 session->interface->CloseConnection(pInfo->m_hConn, 0, nullptr, false);
                 break;
             }
@@ -2707,9 +11675,19 @@ struct BoulderNetworkSession {
                         g_connectionSessions[pInfo->m_hConn] = session;
                     }
 
-                    if (session->interface->AcceptConnection(pInfo->m_hConn) != k_EResultOK) {
+                    if (!session->accepting) {
+                        {
+                            std::lock_guard<std::mutex> lock(g_sessionMapMutex);
+                            g_connectionSessions.erase(pInfo->m_hConn);
+                        }
+                        session->interface->CloseConnection(pInfo->m_hConn, k_ESteamNetConnectionEnd_App_Generic,
+                                                            "Server is shutting down", false);
+                        Logger::get().info("Refused incoming connection: server is draining");
+                    } else if (session->interface->AcceptConnection(pInfo->m_hConn) != k_EResultOK) {
                         session->interface->CloseConnection(pInfo->m_hConn, 0, nullptr, false);
                         Logger::get().error("Failed to accept incoming connection");
+                    } else {
+                        session->applyTimeouts(pInfo->m_hConn);
                     }
                 }
                 break;
@@ -2750,6 +11728,7 @@ static void GlobalConnectionStatusChanged(SteamNetConnectionStatusChangedCallbac
 }
 
 NetworkSession boulder_create_network_session() {
+    NATIVE_TRY
     // Initialize GNS globally with reference counting
     {
         std::lock_guard<std::mutex> lock(g_gnsInitMutex);
@@ -2779,7 +11758,7 @@ NetworkSession boulder_create_network_session() {
             }
 
             if (!GameNetworkingSockets_Init(nullptr, errMsg)) {
-                Logger::get().error("Failed to initialize GameNetworkingSockets: {}", errMsg);
+                fail(ERROR_NETWORK, "Failed to initialize GameNetworkingSockets: {}", errMsg);
                 return nullptr;
             }
             g_gnsInitialized = true;
@@ -2805,7 +11784,7 @@ NetworkSession boulder_create_network_session() {
     session->interface = SteamNetworkingSockets();
 
     if (!session->interface) {
-        Logger::get().error("Failed to get SteamNetworkingSockets interface");
+        fail(ERROR_NETWORK, "Failed to get SteamNetworkingSockets interface");
         std::lock_guard<std::mutex> lock(g_gnsInitMutex);
         g_gnsRefCount--;
         delete session;
@@ -2814,7 +11793,7 @@ NetworkSession boulder_create_network_session() {
 
     session->pollGroup = session->interface->CreatePollGroup();
     if (session->pollGroup == k_HSteamNetPollGroup_Invalid) {
-        Logger::get().error("Failed to create poll group");
+        fail(ERROR_NETWORK, "Failed to create poll group");
         std::lock_guard<std::mutex> lock(g_gnsInitMutex);
         g_gnsRefCount--;
         delete session;
@@ -2823,9 +11802,11 @@ NetworkSession boulder_create_network_session() {
 
     Logger::get().info("Network session created");
     return session;
+    NATIVE_CATCH(nullptr)
 }
 
 void boulder_destroy_network_session(NetworkSession session) {
+    NATIVE_TRY
     if (!session) return;
 
     BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
@@ -2843,6 +11824,13 @@ void boulder_destroy_network_session(NetworkSession session) {
         s->interface->CloseConnection(conn, 0, "Session destroyed", false);
     }
 
+    // Forget the session in the global maps so callbacks can't reach it once deleted
+    {
+        std::lock_guard<std::mutex> lock(g_sessionMapMutex);
+        std::erase_if(g_connectionSessions, [s](const auto& entry) { return entry.second == s; });
+        std::erase_if(g_serverSessions, [s](const auto& entry) { return entry.second == s; });
+    }
+
     delete s;
 
     // Decrement reference count and kill GNS if no more sessions
@@ -2863,9 +11851,11 @@ void boulder_destroy_network_session(NetworkSession session) {
     }
 
     Logger::get().info("Network session destroyed");
+    NATIVE_CATCH()
 }
 
 void boulder_network_update(NetworkSession session) {
+    NATIVE_TRY
     if (!session) return;
 
     // Run Steam API callbacks if initialized
@@ -2876,9 +11866,11 @@ void boulder_network_update(NetworkSession session) {
     BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
     s->interface->RunCallbacks();
     s->processCallbacks();
+    NATIVE_CATCH()
 }
 
 int boulder_start_server(NetworkSession session, uint16_t port) {
+    NATIVE_TRY
     if (!session) return -1;
 
     BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
@@ -2889,7 +11881,7 @@ int boulder_start_server(NetworkSession session, uint16_t port) {
 
     s->listenSocket = s->interface->CreateListenSocketIP(addr, 0, nullptr);
     if (s->listenSocket == k_HSteamListenSocket_Invalid) {
-        Logger::get().error("Failed to create listen socket on port {}", port);
+        fail(ERROR_NETWORK, "Failed to create listen socket on port {}", port);
         return -1;
     }
 
@@ -2902,9 +11894,11 @@ int boulder_start_server(NetworkSession session, uint16_t port) {
     s->isServer = true;
     Logger::get().info("Server started on port {}", port);
     return 0;
+    NATIVE_CATCH(-1)
 }
 
 void boulder_stop_server(NetworkSession session) {
+    NATIVE_TRY
     if (!session) return;
 
     BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
@@ -2921,25 +11915,28 @@ void boulder_stop_server(NetworkSession session) {
         s->isServer = false;
         Logger::get().info("Server stopped");
     }
+    NATIVE_CATCH()
 }
 
 ConnectionHandle boulder_connect(NetworkSession session, const char* address, uint16_t port) {
+    NATIVE_TRY
     if (!session || !address) return 0;
 
     BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
 
     SteamNetworkingIPAddr addr;
     if (!addr.ParseString(address)) {
-        Logger::get().error("Failed to parse address: {}", address);
+        fail(ERROR_INVALID_ARGUMENT, "Failed to parse address: {}", address);
         return 0;
     }
     addr.m_port = port;
 
     HSteamNetConnection conn = s->interface->ConnectByIPAddress(addr, 0, nullptr);
     if (conn == k_HSteamNetConnection_Invalid) {
-        Logger::get().error("Failed to connect to {}:{}", address, port);
+        fail(ERROR_NETWORK, "Failed to connect to {}:{}", address, port);
         return 0;
     }
+    s->applyTimeouts(conn);
 
     // Register connection in global map
     {
@@ -2950,9 +11947,11 @@ ConnectionHandle boulder_connect(NetworkSession session, const char* address, ui
     ConnectionHandle handle = s->getOrCreateConnectionHandle(conn);
     Logger::get().info("Connecting to {}:{} (handle: {})", address, port, handle);
     return handle;
+    NATIVE_CATCH(0)
 }
 
 void boulder_disconnect(NetworkSession session, ConnectionHandle conn) {
+    NATIVE_TRY
     if (!session) return;
 
     BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
@@ -2968,9 +11967,70 @@ void boulder_disconnect(NetworkSession session, ConnectionHandle conn) {
         s->removeConnection(it->second);
         Logger::get().info("Disconnected connection {}", conn);
     }
+    NATIVE_CATCH()
+}
+
+void boulder_close_connection(NetworkSession session, ConnectionHandle conn, const char* reason, int linger) {
+    NATIVE_TRY
+    if (!session) return;
+
+    BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
+    auto it = s->reverseMap.find(conn);
+    if (it != s->reverseMap.end()) {
+        {
+            std::lock_guard<std::mutex> lock(g_sessionMapMutex);
+            g_connectionSessions.erase(it->second);
+        }
+
+        s->interface->CloseConnection(it->second, k_ESteamNetConnectionEnd_App_Generic,
+                                      reason ? reason : "Disconnected by user", linger != 0);
+        s->removeConnection(it->second);
+        Logger::get().info("Closed connection {}{}", conn, linger ? " after flushing it" : "");
+    }
+    NATIVE_CATCH()
+}
+
+int boulder_set_accepting_connections(NetworkSession session, int accept) {
+    NATIVE_TRY
+    if (!session) return -1;
+
+    static_cast<BoulderNetworkSession*>(session)->accepting = accept != 0;
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_connections(NetworkSession session, ConnectionHandle* connections, uint32_t capacity) {
+    NATIVE_TRY
+    if (!session || (capacity > 0 && !connections)) return -1;
+
+    BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
+    uint32_t count = 0;
+    for (const auto& [handle, conn] : s->reverseMap) {
+        if (count < capacity) {
+            connections[count] = handle;
+        }
+        count++;
+    }
+    return static_cast<int>(count);
+    NATIVE_CATCH(-1)
+}
+
+int boulder_set_network_timeouts(NetworkSession session, int initialMs, int connectedMs) {
+    NATIVE_TRY
+    if (!session || initialMs < 0 || connectedMs < 0) return -1;
+
+    BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
+    s->timeoutInitialMs = initialMs;
+    s->timeoutConnectedMs = connectedMs;
+    for (const auto& [conn, handle] : s->connectionMap) {
+        s->applyTimeouts(conn);
+    }
+    return 0;
+    NATIVE_CATCH(-1)
 }
 
 int boulder_connection_state(NetworkSession session, ConnectionHandle conn) {
+    NATIVE_TRY
     if (!session) return -1;
 
     BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
@@ -2985,10 +12045,30 @@ int boulder_connection_state(NetworkSession session, ConnectionHandle conn) {
     }
 
     return -1;
+    NATIVE_CATCH(-1)
+}
+
+SteamID boulder_get_remote_steam_id(NetworkSession session, ConnectionHandle conn) {
+    NATIVE_TRY
+    if (!session) return 0;
+
+    BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
+    auto it = s->reverseMap.find(conn);
+    if (it == s->reverseMap.end()) {
+        return 0;
+    }
+
+    SteamNetConnectionInfo_t info;
+    if (!s->interface->GetConnectionInfo(it->second, &info) || info.m_identityRemote.IsInvalid()) {
+        return 0;
+    }
+    return info.m_identityRemote.GetSteamID64();
+    NATIVE_CATCH(0)
 }
 
 // Relay and P2P functions
 void boulder_network_init_with_steam_app(uint32_t appId) {
+    NATIVE_TRY
     std::lock_guard<std::mutex> lock(g_gnsInitMutex);
     if (!g_gnsInitialized) {
         g_steamAppId = appId;
@@ -3003,9 +12083,11 @@ void boulder_network_init_with_steam_app(uint32_t appId) {
 
         Logger::get().info("Steam AppID set to {} (will be used on next session creation)", appId);
     }
+    NATIVE_CATCH()
 }
 
 void boulder_network_set_relay_server(const char* address, uint16_t port) {
+    NATIVE_TRY
     if (!address) return;
 
     // This sets the SDR (Steam Datagram Relay) configuration
@@ -3016,16 +12098,20 @@ void boulder_network_set_relay_server(const char* address, uint16_t port) {
         // Configure relay through GNS utils
         Logger::get().info("Relay server set to {}:{}", address, port);
     }
+    NATIVE_CATCH()
 }
 
 void boulder_network_enable_fake_ip() {
+    NATIVE_TRY
     // Enable FakeIP allocation for easier P2P testing without Steam
     SteamNetworkingUtils()->SetGlobalConfigValueInt32(
         k_ESteamNetworkingConfig_IP_AllowWithoutAuth, 1);
     Logger::get().info("FakeIP enabled for testing");
+    NATIVE_CATCH()
 }
 
 int boulder_start_server_p2p(NetworkSession session, int virtualPort) {
+    NATIVE_TRY
     if (!session) return -1;
 
     BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
@@ -3033,7 +12119,7 @@ int boulder_start_server_p2p(NetworkSession session, int virtualPort) {
     // Create P2P listen socket on virtual port
     s->listenSocket = s->interface->CreateListenSocketP2P(virtualPort, 0, nullptr);
     if (s->listenSocket == k_HSteamListenSocket_Invalid) {
-        Logger::get().error("Failed to create P2P listen socket on virtual port {}", virtualPort);
+        fail(ERROR_NETWORK, "Failed to create P2P listen socket on virtual port {}", virtualPort);
         return -1;
     }
 
@@ -3046,9 +12132,11 @@ int boulder_start_server_p2p(NetworkSession session, int virtualPort) {
     s->isServer = true;
     Logger::get().info("P2P server started on virtual port {}", virtualPort);
     return 0;
+    NATIVE_CATCH(-1)
 }
 
 ConnectionHandle boulder_connect_p2p(NetworkSession session, SteamID steamID, int virtualPort) {
+    NATIVE_TRY
     if (!session) return 0;
 
     BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
@@ -3060,9 +12148,10 @@ ConnectionHandle boulder_connect_p2p(NetworkSession session, SteamID steamID, in
     // Connect via P2P
     HSteamNetConnection conn = s->interface->ConnectP2P(identity, virtualPort, 0, nullptr);
     if (conn == k_HSteamNetConnection_Invalid) {
-        Logger::get().error("Failed to connect P2P to Steam ID {}", steamID);
+        fail(ERROR_NETWORK, "Failed to connect P2P to Steam ID {}", steamID);
         return 0;
     }
+    s->applyTimeouts(conn);
 
     // Register connection in global map
     {
@@ -3073,9 +12162,11 @@ ConnectionHandle boulder_connect_p2p(NetworkSession session, SteamID steamID, in
     ConnectionHandle handle = s->getOrCreateConnectionHandle(conn);
     Logger::get().info("Connecting P2P to Steam ID {} (handle: {})", steamID, handle);
     return handle;
+    NATIVE_CATCH(0)
 }
 
 void boulder_set_local_identity(NetworkSession session, const char* name) {
+    NATIVE_TRY
     if (!session || !name) return;
 
     BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
@@ -3083,9 +12174,11 @@ void boulder_set_local_identity(NetworkSession session, const char* name) {
     // Set a friendly name for this connection
     // This is useful for debugging and doesn't require Steam authentication
     Logger::get().info("Local identity set to: {}", name);
+    NATIVE_CATCH()
 }
 
 SteamID boulder_get_local_steam_id(NetworkSession session) {
+    NATIVE_TRY
     if (!session) return 0;
 
     BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
@@ -3109,9 +12202,27 @@ SteamID boulder_get_local_steam_id(NetworkSession session) {
     }
 
     return steamID;
+    NATIVE_CATCH(0)
+}
+
+int boulder_network_steam_available(NetworkSession session) {
+    NATIVE_TRY
+    if (!session || !g_steamAPIInitialized) return 0;
+
+    BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
+
+    // Unlike boulder_get_local_steam_id this is polled, so it must not log
+    SteamNetworkingIdentity identity;
+    if (!s->interface->GetIdentity(&identity) || identity.IsInvalid()) {
+        return 0;
+    }
+
+    return identity.GetSteamID64() != 0 ? 1 : 0;
+    NATIVE_CATCH(0)
 }
 
 int boulder_send_message(NetworkSession session, ConnectionHandle conn, const void* data, uint32_t size, int reliable) {
+    NATIVE_TRY
     if (!session || !data || size == 0) return -1;
 
     BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
@@ -3123,34 +12234,289 @@ int boulder_send_message(NetworkSession session, ConnectionHandle conn, const vo
     int flags = reliable ? k_nSteamNetworkingSend_Reliable : k_nSteamNetworkingSend_Unreliable;
     EResult result = s->interface->SendMessageToConnection(it->second, data, size, flags, nullptr);
 
-    if (result != k_EResultOK) {
-        Logger::get().error("Failed to send message: {}", (int)result);
-        return -1;
+    if (result != k_EResultOK) {
+        fail(ERROR_NETWORK, "Failed to send message: {}", (int)result);
+        return -1;
+    }
+
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_configure_channels(NetworkSession session, ConnectionHandle conn, int count,
+                                const int* priorities, const uint16_t* weights) {
+    NATIVE_TRY
+    if (!session || count < 1 || count > NETWORK_MAX_CHANNELS || !priorities || !weights) return -1;
+
+    BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
+    auto it = s->reverseMap.find(conn);
+    if (it == s->reverseMap.end()) {
+        return -1;
+    }
+
+    EResult result = s->interface->ConfigureConnectionLanes(it->second, count, priorities, weights);
+    if (result != k_EResultOK) {
+        fail(ERROR_NETWORK, "Failed to configure {} channels: {}", count, (int)result);
+        return -1;
+    }
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_send_message_on_channel(NetworkSession session, ConnectionHandle conn, int channel,
+                                    const void* data, uint32_t size, int flags) {
+    NATIVE_TRY
+    if (!session || !data || size == 0 || channel < 0 || channel >= NETWORK_MAX_CHANNELS) return -1;
+
+    BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
+    auto it = s->reverseMap.find(conn);
+    if (it == s->reverseMap.end()) {
+        return -1;
+    }
+
+    SteamNetworkingMessage_t* msg = SteamNetworkingUtils()->AllocateMessage(size);
+    if (!msg) {
+        return -1;
+    }
+    memcpy(msg->m_pData, data, size);
+    msg->m_conn = it->second;
+    msg->m_idxLane = static_cast<uint16>(channel);
+    msg->m_nFlags = (flags & NETWORK_SEND_RELIABLE) ? k_nSteamNetworkingSend_Reliable : k_nSteamNetworkingSend_Unreliable;
+    if (flags & NETWORK_SEND_NO_NAGLE) {
+        msg->m_nFlags |= k_nSteamNetworkingSend_NoNagle;
+    }
+    if (flags & NETWORK_SEND_NO_DELAY) {
+        msg->m_nFlags |= k_nSteamNetworkingSend_NoDelay;
+    }
+
+    // Takes ownership of the message; a negative result is the EResult of the failure
+    int64 result = 0;
+    s->interface->SendMessages(1, &msg, &result);
+    if (result < 0) {
+        fail(ERROR_NETWORK, "Failed to send message on channel {}: {}", channel, (int)-result);
+        return -1;
+    }
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_get_connection_stats(NetworkSession session, ConnectionHandle conn, ConnectionStats* stats) {
+    NATIVE_TRY
+    if (!session || !stats) return -1;
+
+    BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
+    auto it = s->reverseMap.find(conn);
+    if (it == s->reverseMap.end()) {
+        return -1;
+    }
+
+    SteamNetConnectionRealTimeStatus_t status;
+    if (s->interface->GetConnectionRealTimeStatus(it->second, &status, 0, nullptr) != k_EResultOK) {
+        return -1;
+    }
+
+    stats->pingMs = status.m_nPing;
+    stats->qualityLocal = status.m_flConnectionQualityLocal;
+    stats->qualityRemote = status.m_flConnectionQualityRemote;
+    stats->outPacketsPerSec = status.m_flOutPacketsPerSec;
+    stats->outBytesPerSec = status.m_flOutBytesPerSec;
+    stats->inPacketsPerSec = status.m_flInPacketsPerSec;
+    stats->inBytesPerSec = status.m_flInBytesPerSec;
+    stats->sendRateBytesPerSec = status.m_nSendRateBytesPerSecond;
+    stats->pendingUnreliableBytes = status.m_cbPendingUnreliable;
+    stats->pendingReliableBytes = status.m_cbPendingReliable;
+    stats->sentUnackedReliableBytes = status.m_cbSentUnackedReliable;
+    stats->queueTimeUsec = status.m_usecQueueTime;
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_poll_network_event(NetworkSession session, NetworkEvent* event) {
+    NATIVE_TRY
+    if (!session || !event) return 0;
+
+    BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
+
+    std::lock_guard<std::mutex> lock(s->eventMutex);
+    if (s->eventQueue.empty()) {
+        event->type = 0; // No event
+        return 0;
+    }
+
+    *event = s->eventQueue.front();
+    s->eventQueue.pop();
+    return 1;
+    NATIVE_CATCH(0)
+}
+
+void boulder_free_network_event_data(void* data) {
+    NATIVE_TRY
+    if (data) {
+        delete[] static_cast<uint8_t*>(data);
+    }
+    NATIVE_CATCH()
+}
+
+int64_t boulder_network_local_time() {
+    NATIVE_TRY
+    std::lock_guard<std::mutex> lock(g_gnsInitMutex);
+    if (!g_gnsInitialized) {
+        return 0;
+    }
+
+    return SteamNetworkingUtils()->GetLocalTimestamp();
+    NATIVE_CATCH(0)
+}
+
+// Steam lobbies
+//
+// Lobbies advertise hosted games through Steam matchmaking. The host stores its name,
+// connect address and ping location as lobby data; results arrive through call results
+// dispatched by SteamAPI_RunCallbacks in boulder_network_update.
+struct SteamLobbyState {
+    CCallResult<SteamLobbyState, LobbyMatchList_t> listResult;
+    CCallResult<SteamLobbyState, LobbyCreated_t> createResult;
+
+    std::vector<CSteamID> lobbies;
+    bool listPending = false;
+    bool listReady = false;
+
+    CSteamID hostedLobby;
+    bool createPending = false;
+    std::string pendingName;
+    std::string pendingAddress;
+
+    void onLobbyList(LobbyMatchList_t* result, bool ioFailure) {
+        listPending = false;
+        listReady = true;
+        lobbies.clear();
+        if (ioFailure) {
+            Logger::get().error("Steam lobby list request failed");
+            return;
+        }
+
+        for (uint32_t i = 0; i < result->m_nLobbiesMatching; i++) {
+            lobbies.push_back(SteamMatchmaking()->GetLobbyByIndex(i));
+        }
+    }
+
+    void onLobbyCreated(LobbyCreated_t* result, bool ioFailure) {
+        createPending = false;
+        if (ioFailure || result->m_eResult != k_EResultOK) {
+            fail(ERROR_NETWORK, "Failed to create Steam lobby");
+            return;
+        }
+
+        hostedLobby = CSteamID(result->m_ulSteamIDLobby);
+        SteamMatchmaking()->SetLobbyData(hostedLobby, "boulder_name", pendingName.c_str());
+        SteamMatchmaking()->SetLobbyData(hostedLobby, "boulder_address", pendingAddress.c_str());
+
+        SteamNetworkPingLocation_t location;
+        if (SteamNetworkingUtils()->GetLocalPingLocation(location) >= 0) {
+            char locationString[k_cchMaxSteamNetworkingPingLocationString];
+            SteamNetworkingUtils()->ConvertPingLocationToString(location, locationString, sizeof(locationString));
+            SteamMatchmaking()->SetLobbyData(hostedLobby, "boulder_ping", locationString);
+        }
+
+        Logger::get().info("Created Steam lobby {}", hostedLobby.ConvertToUint64());
+    }
+};
+
+static SteamLobbyState g_steamLobbies;
+
+int boulder_steam_request_lobby_list() {
+    NATIVE_TRY
+    if (!g_steamAPIInitialized) return -1;
+    if (g_steamLobbies.listPending) return 0;
+
+    // Relay ping estimates need network access to be initialized
+    SteamNetworkingUtils()->InitRelayNetworkAccess();
+
+    SteamMatchmaking()->AddRequestLobbyListStringFilter("boulder_address", "", k_ELobbyComparisonNotEqual);
+    SteamAPICall_t call = SteamMatchmaking()->RequestLobbyList();
+    g_steamLobbies.listResult.Set(call, &g_steamLobbies, &SteamLobbyState::onLobbyList);
+    g_steamLobbies.listPending = true;
+    g_steamLobbies.listReady = false;
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+int boulder_steam_lobby_list_ready() {
+    NATIVE_TRY
+    return g_steamLobbies.listReady ? 1 : 0;
+    NATIVE_CATCH(0)
+}
+
+int boulder_steam_lobby_count() {
+    NATIVE_TRY
+    if (!g_steamAPIInitialized || !g_steamLobbies.listReady) return 0;
+    return static_cast<int>(g_steamLobbies.lobbies.size());
+    NATIVE_CATCH(0)
+}
+
+int boulder_steam_get_lobby(int index, uint64_t* lobbyId,
+                            char* name, uint32_t nameSize,
+                            char* address, uint32_t addressSize,
+                            int* players, int* maxPlayers, int* pingMs) {
+    NATIVE_TRY
+    if (!g_steamAPIInitialized || index < 0 ||
+        index >= static_cast<int>(g_steamLobbies.lobbies.size())) {
+        return -1;
+    }
+
+    CSteamID lobby = g_steamLobbies.lobbies[index];
+    if (lobbyId) *lobbyId = lobby.ConvertToUint64();
+    if (name && nameSize > 0) {
+        snprintf(name, nameSize, "%s", SteamMatchmaking()->GetLobbyData(lobby, "boulder_name"));
+    }
+    if (address && addressSize > 0) {
+        snprintf(address, addressSize, "%s", SteamMatchmaking()->GetLobbyData(lobby, "boulder_address"));
+    }
+    if (players) *players = SteamMatchmaking()->GetNumLobbyMembers(lobby);
+    if (maxPlayers) *maxPlayers = SteamMatchmaking()->GetLobbyMemberLimit(lobby);
+
+    if (pingMs) {
+        *pingMs = -1;
+        SteamNetworkPingLocation_t location;
+        const char* locationString = SteamMatchmaking()->GetLobbyData(lobby, "boulder_ping");
+        if (locationString[0] && SteamNetworkingUtils()->ParsePingLocationString(locationString, location)) {
+            *pingMs = SteamNetworkingUtils()->EstimatePingTimeFromLocalHost(location);
+        }
     }
 
     return 0;
+    NATIVE_CATCH(-1)
 }
 
-int boulder_poll_network_event(NetworkSession session, NetworkEvent* event) {
-    if (!session || !event) return 0;
+int boulder_steam_create_lobby(int maxPlayers, const char* name, const char* address) {
+    NATIVE_TRY
+    if (!g_steamAPIInitialized || !name || !address) return -1;
+    if (g_steamLobbies.createPending) return -1;
 
-    BoulderNetworkSession* s = static_cast<BoulderNetworkSession*>(session);
+    SteamNetworkingUtils()->InitRelayNetworkAccess();
 
-    std::lock_guard<std::mutex> lock(s->eventMutex);
-    if (s->eventQueue.empty()) {
-        event->type = 0; // No event
-        return 0;
-    }
+    g_steamLobbies.pendingName = name;
+    g_steamLobbies.pendingAddress = address;
+    SteamAPICall_t call = SteamMatchmaking()->CreateLobby(k_ELobbyTypePublic, maxPlayers);
+    g_steamLobbies.createResult.Set(call, &g_steamLobbies, &SteamLobbyState::onLobbyCreated);
+    g_steamLobbies.createPending = true;
+    return 0;
+    NATIVE_CATCH(-1)
+}
 
-    *event = s->eventQueue.front();
-    s->eventQueue.pop();
-    return 1;
+uint64_t boulder_steam_get_hosted_lobby() {
+    NATIVE_TRY
+    return g_steamLobbies.hostedLobby.ConvertToUint64();
+    NATIVE_CATCH(0)
 }
 
-void boulder_free_network_event_data(void* data) {
-    if (data) {
-        delete[] static_cast<uint8_t*>(data);
-    }
+void boulder_steam_leave_lobby() {
+    NATIVE_TRY
+    if (!g_steamAPIInitialized || !g_steamLobbies.hostedLobby.IsValid()) return;
+
+    SteamMatchmaking()->LeaveLobby(g_steamLobbies.hostedLobby);
+    g_steamLobbies.hostedLobby = CSteamID();
+    NATIVE_CATCH()
 }
 
 // ============================================================================
@@ -3158,8 +12524,9 @@ void boulder_free_network_event_data(void* data) {
 // ============================================================================
 
 int boulder_ui_init() {
+    NATIVE_TRY
     if (!g_engine.device || !g_engine.physicalDevice) {
-        Logger::get().error("Cannot initialize UI: Vulkan not initialized");
+        fail(ERROR_NOT_INITIALIZED, "Cannot initialize UI: Vulkan not initialized");
         return -1;
     }
 
@@ -3168,7 +12535,7 @@ int boulder_ui_init() {
     if (!g_engine.uiRenderer->initialize(g_engine.device, g_engine.physicalDevice,
                                          g_engine.swapchainFormat, g_engine.commandPool,
                                          g_engine.graphicsQueue, g_engine.graphicsQueueFamily)) {
-        Logger::get().error("Failed to initialize UI renderer");
+        fail(ERROR_VULKAN, "Failed to initialize UI renderer");
         g_engine.uiRenderer.reset();
         return -1;
     }
@@ -3179,22 +12546,26 @@ int boulder_ui_init() {
 
     Logger::get().info("UI system initialized successfully");
     return 0;
+    NATIVE_CATCH(-1)
 }
 
 void boulder_ui_cleanup() {
+    NATIVE_TRY
     if (g_engine.uiRenderer) {
         g_engine.uiRenderer->cleanup();
         g_engine.uiRenderer.reset();
     }
     g_engine.buttonClickStates.clear();
+    NATIVE_CATCH()
 }
 
 UIButtonID boulder_ui_create_button(float x, float y, float width, float height,
                                     float normalR, float normalG, float normalB, float normalA,
                                     float hoverR, float hoverG, float hoverB, float hoverA,
                                     float pressedR, float pressedG, float pressedB, float pressedA) {
+    NATIVE_TRY
     if (!g_engine.uiRenderer) {
-        Logger::get().error("UI renderer not initialized");
+        fail(ERROR_NOT_INITIALIZED, "UI renderer not initialized");
         return 0;
     }
 
@@ -3216,93 +12587,675 @@ UIButtonID boulder_ui_create_button(float x, float y, float width, float height,
     });
 
     return buttonId;
+    NATIVE_CATCH(0)
 }
 
 void boulder_ui_destroy_button(UIButtonID buttonId) {
+    NATIVE_TRY
     if (!g_engine.uiRenderer) {
         return;
     }
 
     g_engine.uiRenderer->destroyButton(buttonId);
     g_engine.buttonClickStates.erase(buttonId);
+    NATIVE_CATCH()
 }
 
 void boulder_ui_set_button_position(UIButtonID buttonId, float x, float y) {
+    NATIVE_TRY
     if (!g_engine.uiRenderer) {
         return;
     }
 
     g_engine.uiRenderer->setButtonPosition(buttonId, glm::vec2(x, y));
+    NATIVE_CATCH()
 }
 
 void boulder_ui_set_button_size(UIButtonID buttonId, float width, float height) {
+    NATIVE_TRY
     if (!g_engine.uiRenderer) {
         return;
     }
 
     g_engine.uiRenderer->setButtonSize(buttonId, glm::vec2(width, height));
+    NATIVE_CATCH()
 }
 
 void boulder_ui_set_button_enabled(UIButtonID buttonId, int enabled) {
+    NATIVE_TRY
     if (!g_engine.uiRenderer) {
         return;
     }
 
     g_engine.uiRenderer->setButtonEnabled(buttonId, enabled != 0);
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_button_colors(UIButtonID buttonId,
+                                  float normalR, float normalG, float normalB, float normalA,
+                                  float hoverR, float hoverG, float hoverB, float hoverA,
+                                  float pressedR, float pressedG, float pressedB, float pressedA) {
+    NATIVE_TRY
+    if (!g_engine.uiRenderer) {
+        return;
+    }
+
+    g_engine.uiRenderer->setButtonColors(buttonId,
+                                         glm::vec4(normalR, normalG, normalB, normalA),
+                                         glm::vec4(hoverR, hoverG, hoverB, hoverA),
+                                         glm::vec4(pressedR, pressedG, pressedB, pressedA));
+    NATIVE_CATCH()
 }
 
 void boulder_ui_handle_mouse_move(float x, float y) {
+    NATIVE_TRY
     if (!g_engine.uiRenderer) {
         return;
     }
 
     g_engine.uiRenderer->handleMouseMove(x, y);
+    NATIVE_CATCH()
 }
 
 void boulder_ui_handle_mouse_down(float x, float y) {
+    NATIVE_TRY
     if (!g_engine.uiRenderer) {
         return;
     }
 
     g_engine.uiRenderer->handleMouseDown(x, y);
+    NATIVE_CATCH()
 }
 
 void boulder_ui_handle_mouse_up(float x, float y) {
+    NATIVE_TRY
     if (!g_engine.uiRenderer) {
         return;
     }
 
     g_engine.uiRenderer->handleMouseUp(x, y);
+    NATIVE_CATCH()
 }
 
 int boulder_ui_button_was_clicked(UIButtonID buttonId) {
+    NATIVE_TRY
     auto it = g_engine.buttonClickStates.find(buttonId);
     if (it != g_engine.buttonClickStates.end()) {
         return it->second ? 1 : 0;
     }
     return 0;
+    NATIVE_CATCH(0)
 }
 
 void boulder_ui_reset_button_click(UIButtonID buttonId) {
+    NATIVE_TRY
     auto it = g_engine.buttonClickStates.find(buttonId);
     if (it != g_engine.buttonClickStates.end()) {
         it->second = false;
     }
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_button_opacity(UIButtonID buttonId, float opacity) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer) {
+        g_engine.uiRenderer->setButtonOpacity(buttonId, opacity);
+    }
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_button_visible(UIButtonID buttonId, int visible) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer) {
+        g_engine.uiRenderer->setButtonVisible(buttonId, visible != 0);
+    }
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_button_clip(UIButtonID buttonId, float x, float y, float width, float height) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer) {
+        g_engine.uiRenderer->setButtonClip(buttonId, {x, y, x + std::max(width, 0.0f), y + std::max(height, 0.0f)});
+    }
+    NATIVE_CATCH()
+}
+
+void boulder_ui_clear_button_clip(UIButtonID buttonId) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer) {
+        g_engine.uiRenderer->clearButtonClip(buttonId);
+    }
+    NATIVE_CATCH()
+}
+
+int boulder_ui_get_button_info(UIButtonID buttonId, UIButtonInfo* info) {
+    NATIVE_TRY
+    const boulder::UIButton* button = g_engine.uiRenderer ? g_engine.uiRenderer->getButton(buttonId) : nullptr;
+    if (!button || !info) {
+        return -1;
+    }
+
+    info->x = button->position.x;
+    info->y = button->position.y;
+    info->width = button->size.x;
+    info->height = button->size.y;
+    for (int i = 0; i < 4; i++) {
+        info->normalColor[i] = button->normalColor[i];
+        info->hoverColor[i] = button->hoverColor[i];
+        info->pressedColor[i] = button->pressedColor[i];
+    }
+    info->opacity = button->opacity;
+    info->visible = button->visible ? 1 : 0;
+    info->enabled = button->enabled ? 1 : 0;
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+static boulder::UIStyle toUIStyle(const UIButtonStyle& style) {
+    boulder::UIStyle result;
+    result.cornerRadius = std::max(style.cornerRadius, 0.0f);
+    result.borderWidth = std::max(style.borderWidth, 0.0f);
+    result.borderColor = {style.borderColor[0], style.borderColor[1], style.borderColor[2], style.borderColor[3]};
+    result.shadowColor = {style.shadowColor[0], style.shadowColor[1], style.shadowColor[2], style.shadowColor[3]};
+    result.shadowOffset = {style.shadowOffsetX, style.shadowOffsetY};
+    result.shadowBlur = std::max(style.shadowBlur, 0.0f);
+    return result;
+}
+
+void boulder_ui_set_button_style(UIButtonID buttonId, const UIButtonStyle* style) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer && style) {
+        g_engine.uiRenderer->setButtonStyle(buttonId, toUIStyle(*style));
+    }
+    NATIVE_CATCH()
+}
+
+int boulder_ui_get_button_style(UIButtonID buttonId, UIButtonStyle* style) {
+    NATIVE_TRY
+    const boulder::UIButton* button = g_engine.uiRenderer ? g_engine.uiRenderer->getButton(buttonId) : nullptr;
+    if (!button || !style) {
+        return -1;
+    }
+
+    const boulder::UIStyle& source = button->style;
+    style->cornerRadius = source.cornerRadius;
+    style->borderWidth = source.borderWidth;
+    for (int i = 0; i < 4; i++) {
+        style->borderColor[i] = source.borderColor[i];
+        style->shadowColor[i] = source.shadowColor[i];
+    }
+    style->shadowOffsetX = source.shadowOffset.x;
+    style->shadowOffsetY = source.shadowOffset.y;
+    style->shadowBlur = source.shadowBlur;
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+void boulder_ui_set_default_style(const UIButtonStyle* style) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer && style) {
+        g_engine.uiRenderer->setDefaultStyle(toUIStyle(*style));
+    }
+    NATIVE_CATCH()
+}
+
+// Applies a change to a copy of a progress bar and sets it back
+template <typename Edit>
+static void editProgressBar(UIProgressBarID barId, Edit edit) {
+    if (!g_engine.uiRenderer) {
+        return;
+    }
+    const boulder::UIProgressBar* bar = g_engine.uiRenderer->getProgressBar(barId);
+    if (!bar) {
+        return;
+    }
+    boulder::UIProgressBar changed = *bar;
+    edit(changed);
+    g_engine.uiRenderer->setProgressBar(changed);
+}
+
+static glm::vec4 colorFrom(const float* rgba) {
+    return {rgba[0], rgba[1], rgba[2], rgba[3]};
+}
+
+UIProgressBarID boulder_ui_create_progress_bar(float x, float y, float width, float height) {
+    NATIVE_TRY
+    if (!g_engine.uiRenderer) {
+        fail(ERROR_NOT_INITIALIZED, "UI renderer not initialized");
+        return 0;
+    }
+    return g_engine.uiRenderer->createProgressBar(glm::vec2(x, y), glm::vec2(width, height));
+    NATIVE_CATCH(0)
+}
+
+void boulder_ui_destroy_progress_bar(UIProgressBarID barId) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer) {
+        g_engine.uiRenderer->destroyProgressBar(barId);
+    }
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_progress_bar_bounds(UIProgressBarID barId, float x, float y, float width, float height) {
+    NATIVE_TRY
+    editProgressBar(barId, [&](boulder::UIProgressBar& bar) {
+        bar.position = glm::vec2(x, y);
+        bar.size = glm::vec2(width, height);
+    });
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_progress_bar_value(UIProgressBarID barId, float value, float trail) {
+    NATIVE_TRY
+    editProgressBar(barId, [&](boulder::UIProgressBar& bar) {
+        bar.value = std::clamp(value, 0.0f, 1.0f);
+        bar.trail = std::clamp(trail, 0.0f, 1.0f);
+    });
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_progress_bar_fill(UIProgressBarID barId, int fill) {
+    NATIVE_TRY
+    if (fill < 0 || fill > static_cast<int>(boulder::FillMode::CounterClockwise)) {
+        return;
+    }
+    editProgressBar(barId, [&](boulder::UIProgressBar& bar) {
+        bar.fill = static_cast<boulder::FillMode>(fill);
+    });
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_progress_bar_colors(UIProgressBarID barId, const float* background, const float* fillStart,
+                                        const float* fillEnd, const float* trail) {
+    NATIVE_TRY
+    editProgressBar(barId, [&](boulder::UIProgressBar& bar) {
+        if (background) {
+            bar.backgroundColor = colorFrom(background);
+        }
+        if (fillStart) {
+            bar.fillStartColor = colorFrom(fillStart);
+        }
+        if (fillEnd) {
+            bar.fillEndColor = colorFrom(fillEnd);
+        }
+        if (trail) {
+            bar.trailColor = colorFrom(trail);
+        }
+    });
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_progress_bar_style(UIProgressBarID barId, const UIButtonStyle* style) {
+    NATIVE_TRY
+    if (!style) {
+        return;
+    }
+    editProgressBar(barId, [&](boulder::UIProgressBar& bar) {
+        bar.style = toUIStyle(*style);
+    });
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_progress_bar_opacity(UIProgressBarID barId, float opacity) {
+    NATIVE_TRY
+    editProgressBar(barId, [&](boulder::UIProgressBar& bar) {
+        bar.opacity = std::clamp(opacity, 0.0f, 1.0f);
+    });
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_progress_bar_visible(UIProgressBarID barId, int visible) {
+    NATIVE_TRY
+    editProgressBar(barId, [&](boulder::UIProgressBar& bar) {
+        bar.visible = visible != 0;
+    });
+    NATIVE_CATCH()
+}
+
+// Copies a text style over a UIText, keeping its text
+static bool applyTextStyle(boulder::UIText& text, const UITextStyle& style) {
+    if (style.size <= 0.0f || style.align < 0 || style.align > static_cast<int>(boulder::TextAlign::End) ||
+        style.verticalAlign < 0 || style.verticalAlign > static_cast<int>(boulder::TextAlign::End)) {
+        return false;
+    }
+
+    text.font = style.font;
+    text.size = style.size;
+    text.color = colorFrom(style.color);
+    text.align = static_cast<boulder::TextAlign>(style.align);
+    text.verticalAlign = static_cast<boulder::TextAlign>(style.verticalAlign);
+    return true;
+}
+
+UIFontID boulder_ui_load_font(const void* data, uint32_t size) {
+    NATIVE_TRY
+    if (!g_engine.uiRenderer) {
+        fail(ERROR_NOT_INITIALIZED, "UI renderer not initialized");
+        return 0;
+    }
+    return g_engine.uiRenderer->loadFont(static_cast<const uint8_t*>(data), size);
+    NATIVE_CATCH(0)
+}
+
+void boulder_ui_destroy_font(UIFontID font) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer) {
+        g_engine.uiRenderer->destroyFont(font);
+    }
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_default_font(UIFontID font) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer) {
+        g_engine.uiRenderer->setDefaultFont(font);
+    }
+    NATIVE_CATCH()
+}
+
+int boulder_ui_measure_text(const char* text, const UITextStyle* style, float* width, float* height) {
+    NATIVE_TRY
+    boulder::UIText measured;
+    if (!g_engine.uiRenderer || !style || !applyTextStyle(measured, *style)) {
+        return -1;
+    }
+
+    measured.text = text ? text : "";
+    glm::vec2 size = g_engine.uiRenderer->measureText(measured);
+    if (width) {
+        *width = size.x;
+    }
+    if (height) {
+        *height = size.y;
+    }
+    return 0;
+    NATIVE_CATCH(-1)
+}
+
+void boulder_ui_set_button_text(UIButtonID buttonId, const char* text) {
+    NATIVE_TRY
+    const boulder::UIButton* button = g_engine.uiRenderer ? g_engine.uiRenderer->getButton(buttonId) : nullptr;
+    if (button) {
+        boulder::UIText changed = button->text;
+        changed.text = text ? text : "";
+        g_engine.uiRenderer->setButtonText(buttonId, changed);
+    }
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_button_text_style(UIButtonID buttonId, const UITextStyle* style) {
+    NATIVE_TRY
+    const boulder::UIButton* button = g_engine.uiRenderer ? g_engine.uiRenderer->getButton(buttonId) : nullptr;
+    if (!button || !style) {
+        return;
+    }
+
+    boulder::UIText changed = button->text;
+    if (applyTextStyle(changed, *style)) {
+        g_engine.uiRenderer->setButtonText(buttonId, changed);
+    }
+    NATIVE_CATCH()
+}
+
+// Applies a change to a copy of a label and sets it back
+template <typename Edit>
+static void editLabel(UILabelID labelId, Edit edit) {
+    if (!g_engine.uiRenderer) {
+        return;
+    }
+    const boulder::UILabel* label = g_engine.uiRenderer->getLabel(labelId);
+    if (!label) {
+        return;
+    }
+    boulder::UILabel changed = *label;
+    edit(changed);
+    g_engine.uiRenderer->setLabel(changed);
+}
+
+UILabelID boulder_ui_create_label(float x, float y, float width, float height) {
+    NATIVE_TRY
+    if (!g_engine.uiRenderer) {
+        fail(ERROR_NOT_INITIALIZED, "UI renderer not initialized");
+        return 0;
+    }
+    return g_engine.uiRenderer->createLabel(glm::vec2(x, y), glm::vec2(width, height));
+    NATIVE_CATCH(0)
+}
+
+void boulder_ui_destroy_label(UILabelID labelId) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer) {
+        g_engine.uiRenderer->destroyLabel(labelId);
+    }
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_label_bounds(UILabelID labelId, float x, float y, float width, float height) {
+    NATIVE_TRY
+    editLabel(labelId, [&](boulder::UILabel& label) {
+        label.position = glm::vec2(x, y);
+        label.size = glm::vec2(width, height);
+    });
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_label_text(UILabelID labelId, const char* text) {
+    NATIVE_TRY
+    editLabel(labelId, [&](boulder::UILabel& label) {
+        label.text.text = text ? text : "";
+    });
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_label_text_style(UILabelID labelId, const UITextStyle* style) {
+    NATIVE_TRY
+    if (!style) {
+        return;
+    }
+    editLabel(labelId, [&](boulder::UILabel& label) {
+        boulder::UIText changed = label.text;
+        if (applyTextStyle(changed, *style)) {
+            label.text = changed;
+        }
+    });
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_label_opacity(UILabelID labelId, float opacity) {
+    NATIVE_TRY
+    editLabel(labelId, [&](boulder::UILabel& label) {
+        label.opacity = std::clamp(opacity, 0.0f, 1.0f);
+    });
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_label_visible(UILabelID labelId, int visible) {
+    NATIVE_TRY
+    editLabel(labelId, [&](boulder::UILabel& label) {
+        label.visible = visible != 0;
+    });
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_button_label(UIButtonID buttonId, const char* label) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer) {
+        g_engine.uiRenderer->setButtonLabel(buttonId, label ? label : "");
+    }
+    NATIVE_CATCH()
+}
+
+uint32_t boulder_ui_get_button_label(UIButtonID buttonId, char* buffer, uint32_t capacity) {
+    NATIVE_TRY
+    if (!g_engine.uiRenderer) {
+        return copyString("", buffer, capacity);
+    }
+
+    const std::string* label = g_engine.uiRenderer->getButtonLabel(buttonId);
+    return copyString(label ? label->c_str() : "", buffer, capacity);
+    NATIVE_CATCH(0)
+}
+
+UIButtonID boulder_ui_get_focused_button() {
+    NATIVE_TRY
+    return g_engine.uiRenderer ? g_engine.uiRenderer->getFocusedButton() : 0;
+    NATIVE_CATCH(0)
+}
+
+UIButtonID boulder_ui_get_hovered_button() {
+    NATIVE_TRY
+    return g_engine.uiRenderer ? g_engine.uiRenderer->getHoveredButton() : 0;
+    NATIVE_CATCH(0)
+}
+
+UIButtonID boulder_ui_get_pressed_button() {
+    NATIVE_TRY
+    return g_engine.uiRenderer ? g_engine.uiRenderer->getPressedButton() : 0;
+    NATIVE_CATCH(0)
+}
+
+int boulder_ui_take_focus_changed() {
+    NATIVE_TRY
+    return g_engine.uiRenderer && g_engine.uiRenderer->takeFocusChanged() ? 1 : 0;
+    NATIVE_CATCH(0)
+}
+
+int boulder_ui_move_focus(int direction) {
+    NATIVE_TRY
+    if (!g_engine.uiRenderer || direction < 0 || direction > static_cast<int>(boulder::FocusDirection::Previous)) {
+        return 0;
+    }
+    return g_engine.uiRenderer->moveFocus(static_cast<boulder::FocusDirection>(direction)) ? 1 : 0;
+    NATIVE_CATCH(0)
+}
+
+void boulder_ui_set_focus(UIButtonID buttonId) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer) {
+        g_engine.uiRenderer->setFocus(buttonId);
+    }
+    NATIVE_CATCH()
+}
+
+int boulder_ui_activate_focused() {
+    NATIVE_TRY
+    return g_engine.uiRenderer && g_engine.uiRenderer->activateFocused() ? 1 : 0;
+    NATIVE_CATCH(0)
+}
+
+void boulder_ui_set_button_focusable(UIButtonID buttonId, int focusable) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer) {
+        g_engine.uiRenderer->setButtonFocusable(buttonId, focusable != 0);
+    }
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_focus_color(float r, float g, float b, float a) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer) {
+        g_engine.uiRenderer->setFocusColor(glm::vec4(r, g, b, a));
+    }
+    NATIVE_CATCH()
+}
+
+UIContainerID boulder_ui_create_container() {
+    NATIVE_TRY
+    return g_engine.uiRenderer ? g_engine.uiRenderer->createContainer() : 0;
+    NATIVE_CATCH(0)
+}
+
+void boulder_ui_destroy_container(UIContainerID containerId) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer) {
+        g_engine.uiRenderer->destroyContainer(containerId);
+    }
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_button_container(UIButtonID buttonId, UIContainerID containerId) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer) {
+        g_engine.uiRenderer->setButtonContainer(buttonId, containerId);
+    }
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_label_container(UILabelID labelId, UIContainerID containerId) {
+    NATIVE_TRY
+    editLabel(labelId, [&](boulder::UILabel& label) {
+        label.container = containerId;
+    });
+    NATIVE_CATCH()
+}
+
+void boulder_ui_set_modal(UIContainerID containerId, const float* dimColor) {
+    NATIVE_TRY
+    if (g_engine.uiRenderer) {
+        glm::vec4 dim = dimColor ? colorFrom(dimColor) : glm::vec4(0.0f, 0.0f, 0.0f, 0.5f);
+        g_engine.uiRenderer->setModal(containerId, dim);
+    }
+    NATIVE_CATCH()
+}
+
+UIContainerID boulder_ui_get_modal() {
+    NATIVE_TRY
+    return g_engine.uiRenderer ? g_engine.uiRenderer->getModal() : 0;
+    NATIVE_CATCH(0)
+}
+
+int boulder_get_native_object_counts(NativeObjectCounts* counts) {
+    NATIVE_TRY
+    if (!counts) {
+        return -1;
+    }
+
+    *counts = {};
+    counts->worlds = static_cast<int>(g_engine.worlds.size());
+    for (auto& [id, world] : g_engine.worlds) {
+        counts->entities += userEntityCount(*world);
+        world->query<Model>().each([counts](flecs::entity, Model& model) {
+            counts->models++;
+            counts->meshes += static_cast<int>(model.meshes.size());
+        });
+    }
+
+    counts->textures = static_cast<int>(g_engine.textures.size());
+    counts->shaderModules = static_cast<int>(g_engine.shaderModules.size() + g_engine.pendingShaderModules.size());
+    counts->pipelines = static_cast<int>(g_engine.pipelines.size() + g_engine.pendingPipelines.size());
+    if (g_engine.uiRenderer) {
+        counts->uiElements = static_cast<int>(g_engine.uiRenderer->getElementCount());
+        counts->fonts = static_cast<int>(g_engine.uiRenderer->getFontCount());
+    }
+
+    {
+        std::lock_guard<std::mutex> lock(g_gnsInitMutex);
+        counts->networkSessions = g_gnsRefCount;
+    }
+    {
+        std::lock_guard<std::mutex> lock(g_sessionMapMutex);
+        counts->connections = static_cast<int>(g_connectionSessions.size());
+    }
+    return 0;
+    NATIVE_CATCH(-1)
 }
 
 void boulder_ui_render(uint32_t imageIndex) {
+    NATIVE_TRY
+    SubsystemTimer timer{g_engine.subsystemTimes.uiMs};
     if (!g_engine.uiRenderer || !g_engine.activeCommandBuffer) {
         return;
     }
 
     if (imageIndex >= g_engine.swapchainImages.size()) {
-        Logger::get().error("Invalid image index for UI rendering");
+        fail(ERROR_INVALID_ARGUMENT, "Invalid image index for UI rendering");
         return;
     }
 
     g_engine.uiRenderer->render(g_engine.activeCommandBuffer, g_engine.swapchainExtent,
                                 g_engine.swapchainImages[imageIndex],
                                 g_engine.swapchainImageViews[imageIndex]);
+    NATIVE_CATCH()
 }
 
 } // extern "C"
\ No newline at end of file
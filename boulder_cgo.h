@@ -10,6 +10,7 @@ extern "C" {
 // Engine initialization and lifecycle
 int boulder_init(const char* appName, uint version);
 void boulder_shutdown();
+int boulder_restart(); // Recreates instance, device and window; keeps entities
 int boulder_update(float deltaTime);
 int boulder_render();
 
@@ -20,11 +21,88 @@ void boulder_get_window_size(int* width, int* height);
 int boulder_should_close();
 void boulder_poll_events();
 
+// Window events collected by boulder_poll_events: 0 resized (width and height in window
+// coordinates; the swapchain is recreated on the next frame), 1 focus gained, 2 focus
+// lost, 3 minimized, 4 restored, 5 maximized, 6 file dropped (path, at x, y).
+typedef struct {
+    int type;
+    int width;
+    int height;
+    float x;
+    float y;
+} WindowEvent;
+
+// 1 if an event was returned; a dropped file's path is copied into path
+int boulder_poll_window_event(WindowEvent* event, char* path, uint32_t pathSize);
+int boulder_get_window_state(); // Mask: 1 focused, 2 minimized, 4 maximized
+
+// Displays and fullscreen. Displays are indexes in the system's order, -1 meaning the one
+// the window is on. Fullscreen: 0 windowed, 1 borderless (the desktop's resolution), 2
+// exclusive (the display mode set with boulder_set_display_mode, else the desktop's).
+typedef struct {
+    int width;
+    int height;
+    float refreshRate;  // 0 if unknown
+    float pixelDensity; // Pixels per window coordinate
+} DisplayMode;
+
+int boulder_get_display_count();
+int boulder_get_display_name(int display, char* name, uint32_t nameSize);
+int boulder_get_desktop_display_mode(int display, DisplayMode* mode);
+// Copies up to capacity of the display's fullscreen modes, largest first, and returns how
+// many it has (-1 if there is no such display)
+int boulder_get_display_modes(int display, DisplayMode* modes, uint32_t capacity);
+int boulder_get_window_display();
+int boulder_set_fullscreen(int mode, int display);
+int boulder_get_fullscreen();
+// Picks the display's mode closest to width, height and refreshRate (0 for the desktop's)
+// for exclusive fullscreen, applying it at once if the window is, and writes it to chosen
+int boulder_set_display_mode(int display, int width, int height, float refreshRate, DisplayMode* chosen);
+
+// Runtime check, usable before boulder_init. Returns 0 or a mask of problems:
+// 1 = no Vulkan loader, 2 = no Vulkan GPU, 4 = no GPU with mesh shaders, 8 = no video driver
+// (-1 if the check itself failed)
+int boulder_check_runtime();
+
+// Native message box, usable before boulder_init, e.g. for fatal errors before the renderer
+// is up. Blocks until it is closed. Kind: 0 information, 1 warning, 2 error. The first
+// button is the default for Enter and the last for Escape. Returns the index of the button
+// pressed, -1 on failure.
+int boulder_show_message_box(int kind, const char* title, const char* message,
+                             const char* const* buttons, int buttonCount);
+
+// GPU selection (takes effect the next time the device is created)
+// preference: 0 = first supported GPU, 1 = discrete, 2 = integrated
+int boulder_get_gpu_count();
+int boulder_get_gpu_info(int index, char* name, uint32_t nameSize, int* type,
+                         uint64_t* memory, uint32_t* vendorID, uint32_t* deviceID, int* supported);
+void boulder_set_gpu(int index, int preference);
+int boulder_get_selected_gpu();
+
 // Entity management (ECS)
 typedef unsigned long long EntityID;
 EntityID boulder_create_entity();
 void boulder_destroy_entity(EntityID entity);
 int boulder_entity_exists(EntityID entity);
+int boulder_revive_entity(EntityID entity); // Recreate a destroyed entity with the same ID
+
+// Worlds. Each world has its own entities, and entity IDs only mean something in their
+// world. World 1 is created by boulder_init and lasts until shutdown. Entity, component,
+// query and snapshot calls act on the world bound with boulder_bind_world; boulder_update
+// simulates and boulder_render_models draws the active world. Component events and change
+// tracking only cover the active world and are cleared when it changes.
+typedef uint32_t WorldID;
+WorldID boulder_create_world(); // 0 on failure
+int boulder_destroy_world(WorldID world); // Fails for world 1 and the active world
+int boulder_bind_world(WorldID world);
+int boulder_set_active_world(WorldID world);
+WorldID boulder_get_active_world();
+// Moves an entity and its components from the bound world to another, writing its new ID.
+// Voxel worlds cannot be moved.
+int boulder_move_entity(EntityID entity, WorldID world, EntityID* moved);
+// Entities in a world, leaving out the ones flecs and the engine make for themselves
+// (components, observers and other named builtins). -1 for a world that doesn't exist.
+int boulder_world_entity_count(WorldID world);
 
 // Component operations
 int boulder_add_transform(EntityID entity, float x, float y, float z);
@@ -38,48 +116,579 @@ int boulder_set_full_transform(EntityID entity,
                                float px, float py, float pz,
                                float rx, float ry, float rz,
                                float sx, float sy, float sz);
+// Rotations are stored as unit quaternions; the Euler angles above (radians, X then Y then
+// Z) are converted to and from them
+int boulder_set_rotation_quat(EntityID entity, float x, float y, float z, float w);
+int boulder_get_rotation_quat(EntityID entity, float* x, float* y, float* z, float* w);
 
 // Physics
 int boulder_add_physics_body(EntityID entity, float mass);
 int boulder_set_velocity(EntityID entity, float vx, float vy, float vz);
 int boulder_get_velocity(EntityID entity, float* vx, float* vy, float* vz);
+int boulder_remove_physics_body(EntityID entity);
+int boulder_get_mass(EntityID entity, float* mass); // -1 without a physics body
 int boulder_apply_force(EntityID entity, float fx, float fy, float fz);
 
+// Colliders. Entities need a transform; those with a physics body are pushed apart on
+// contact, the others are static level geometry. Sizes are in world units and turn with
+// the entity's rotation; a capsule runs along the entity's Y axis with caps halfHeight
+// from its center. Mesh colliders copy the triangles of the entity's loaded model, follow
+// its full transform and are never moved by contacts. Friction of a contact is the
+// geometric mean of the two colliders', restitution (0 to 1) the larger of the two.
+int boulder_add_box_collider(EntityID entity, float hx, float hy, float hz, float friction, float restitution);
+int boulder_add_sphere_collider(EntityID entity, float radius, float friction, float restitution);
+int boulder_add_capsule_collider(EntityID entity, float radius, float halfHeight, float friction, float restitution);
+int boulder_add_mesh_collider(EntityID entity, float friction, float restitution);
+int boulder_remove_collider(EntityID entity);
+// Returns the shape (0 box, 1 sphere, 2 capsule, 3 mesh) or -1 without a collider. size has
+// the box's half extents, the sphere's radius, or the capsule's radius and halfHeight.
+int boulder_get_collider(EntityID entity, float* size, float* friction, float* restitution);
+// Trigger volumes are colliders that report bodies overlapping them as trigger enter and exit
+// events instead of pushing them. Only bodies with mass set them off, and they don't move.
+int boulder_set_collider_trigger(EntityID entity, int trigger);
+int boulder_is_collider_trigger(EntityID entity); // 1 or 0, -1 without a collider
+
+// Buoyancy and soft bodies
+// A buoyancy volume is a box of half extents hx/hy/hz centered on the entity's transform
+int boulder_add_buoyancy_volume(EntityID entity, float hx, float hy, float hz, float density, float linearDrag);
+int boulder_set_buoyancy(EntityID entity, float volume, float height);
+int boulder_add_soft_body(EntityID entity, float stiffness, float damping, float amount);
+int boulder_remove_soft_body(EntityID entity);
+
+// Spatial queries over entity positions. Entities are in layer bit 0 unless given layers;
+// queries match entities in any layer of layerMask. Overlap queries write up to capacity
+// entities and return how many matched. boulder_find_nearest returns -1 when nothing
+// matches; an empty tag matches any entity and maxDistance <= 0 searches everything.
+int boulder_set_spatial_cell_size(float size);
+int boulder_set_layers(EntityID entity, uint32_t layers);
+uint32_t boulder_get_layers(EntityID entity);
+int boulder_add_tag(EntityID entity, const char* tag);
+int boulder_remove_tag(EntityID entity, const char* tag);
+int boulder_has_tag(EntityID entity, const char* tag);
+uint32_t boulder_get_tags(EntityID entity, char* buffer, uint32_t capacity); // Newline separated, returns the full length
+int boulder_overlap_sphere(float cx, float cy, float cz, float radius, uint32_t layerMask,
+                           EntityID* entities, uint32_t capacity);
+// The box has half extents hx/hy/hz and euler rotation rx/ry/rz (radians, like transforms)
+int boulder_overlap_box(float cx, float cy, float cz, float hx, float hy, float hz,
+                        float rx, float ry, float rz, uint32_t layerMask,
+                        EntityID* entities, uint32_t capacity);
+int boulder_find_nearest(float x, float y, float z, const char* tag, float maxDistance, EntityID* entity);
+
+// Voxel worlds: chunks of 32^3 blocks on an entity, axis aligned at the entity's position.
+// Block 0 is air. Chunks are greedy meshed into child entities by boulder_update_voxel_world
+// (at most maxChunks per call, 0 for all), which returns how many chunks it remeshed. Chunk
+// vertices have texCoord.x/y running across each quad in blocks, with the face's material
+// index added to y in steps of 1024. Collision boxes are min/max float triples in world
+// space. boulder_save_voxel_chunk returns 1 and sets written when buffer is too small.
+int boulder_add_voxel_world(EntityID entity, float blockSize);
+int boulder_set_voxel_block_type(EntityID entity, int block, int solid, int opaque,
+                                 int topMaterial, int sideMaterial, int bottomMaterial);
+int boulder_set_voxel(EntityID entity, int x, int y, int z, int block);
+int boulder_get_voxel(EntityID entity, int x, int y, int z);
+int boulder_fill_voxels(EntityID entity, int x0, int y0, int z0, int x1, int y1, int z1, int block);
+int boulder_update_voxel_world(EntityID entity, int maxChunks);
+int boulder_get_voxel_chunk_count(EntityID entity);
+int boulder_get_voxel_chunks(EntityID entity, int* coords, uint32_t capacity); // 3 ints per chunk
+int boulder_get_voxel_collision_boxes(EntityID entity, int cx, int cy, int cz, float* boxes, uint32_t capacity);
+int boulder_voxel_raycast(EntityID entity, float ox, float oy, float oz, float dx, float dy, float dz,
+                          float maxDistance, int* block, float* normal, float* distance);
+int boulder_save_voxel_chunk(EntityID entity, int cx, int cy, int cz, void* buffer, uint32_t size, uint32_t* written);
+int boulder_load_voxel_chunk(EntityID entity, int cx, int cy, int cz, const void* data, uint32_t size);
+
+// Component events. Components: 0 Transform, 1 PhysicsBody, 2 Model, 3 BuoyancyVolume,
+// 4 Buoyant, 5 SoftBody, 6 Collider. Kinds: 0 added, 1 removed, 2 changed. Events are only queued for
+// the kinds a component is watched for (a bit per kind). Watching changes, or bit 3 alone,
+// records the tick each entity's component last changed at. The change tick advances at
+// the start of boulder_update.
+typedef struct {
+    EntityID entity;
+    int component;
+    int kind;
+    uint64_t tick;
+} ComponentEvent;
+
+int boulder_watch_component(int component, int kinds);
+int boulder_poll_component_event(ComponentEvent* event); // 1 if an event was returned
+uint64_t boulder_get_change_tick();
+int boulder_get_component_change_tick(EntityID entity, int component, uint64_t* tick);
+// Writes up to capacity entities changed at or after tick, returning how many changed
+int boulder_get_changed_entities(int component, uint64_t tick, EntityID* entities, uint32_t capacity);
+
+// Collision events. Kinds: 0 enter (the colliders started touching), 1 exit (they stopped,
+// or one was destroyed or lost its collider), 2 and 3 the same for a body and a trigger
+// volume overlapping. a has the lower ID, normal points from b to a
+// and point is where they touch (for exits, where they last touched). Events are only
+// queued while watched and are cleared when the active world changes.
+typedef struct {
+    int kind;
+    EntityID a;
+    EntityID b;
+    float point[3];
+    float normal[3];
+} CollisionEvent;
+
+int boulder_watch_collisions(int enabled);
+int boulder_poll_collision_event(CollisionEvent* event); // 1 if an event was returned
+
+// Entity queries. Writes up to capacity entities that have every component in with and
+// none in without (component numbers as for component events), returning how many match
+// or -1 if with is empty or a component is unknown.
+int boulder_query_entities(const int* with, int withCount, const int* without, int withoutCount,
+                           EntityID* entities, uint32_t capacity);
+
+// World snapshots (rollback)
+uint32_t boulder_world_snapshot_size(); // Bytes needed to save the current world
+int boulder_world_save_snapshot(void* buffer, uint32_t size, uint32_t* written);
+int boulder_world_load_snapshot(const void* buffer, uint32_t size);
+
 // Model loading
 int boulder_load_model(EntityID entity, const char* path);
+int boulder_load_model_from_memory(EntityID entity, const void* data, uint32_t size, const char* name);
+int boulder_get_model_mesh_count(EntityID entity);
+// Bone boxes bound the bind pose vertices each bone drives; min and max are 3 floats each
+int boulder_get_model_bone_count(EntityID entity);
+int boulder_get_model_bone_box(EntityID entity, int index, char* name, uint32_t nameSize, float* min, float* max);
+int boulder_set_model_visible(EntityID entity, int visible);
+// Animations of the loaded model (glTF clips and the like). Animated models are skinned on
+// the CPU in boulder_update, for the active world. fadeSeconds crossfades from the current
+// pose; clip -1 in the state is the bind pose, after boulder_stop_animation.
+int boulder_get_animation_count(EntityID entity);
+int boulder_get_animation_info(EntityID entity, int index, char* name, uint32_t nameSize, float* duration);
+int boulder_play_animation(EntityID entity, const char* name, float fadeSeconds, int loop);
+int boulder_stop_animation(EntityID entity, float fadeSeconds);
+int boulder_set_animation_paused(EntityID entity, int paused);
+int boulder_set_animation_speed(EntityID entity, float speed); // Negative plays backwards
+int boulder_set_animation_time(EntityID entity, float time);    // Seconds into the current clip
+int boulder_get_animation_state(EntityID entity, int* clip, float* time, float* speed, int* paused);
+// Copies one mesh of a model onto target, recentered on its centroid (written to cx/cy/cz)
+int boulder_copy_mesh(EntityID source, int meshIndex, EntityID target, float* cx, float* cy, float* cz);
+
+// Meshes built at runtime. Vertices are 8 floats each: position, normal, texCoord.
+// Returns the mesh index within the entity's model, or -1 on failure.
+int boulder_create_mesh(EntityID entity, const void* vertices, uint32_t vertexCount,
+                        const uint32_t* indices, uint32_t indexCount, int dynamic);
+int boulder_update_mesh_vertices(EntityID entity, int meshIndex, uint32_t offset, const void* vertices, uint32_t count);
+int boulder_get_mesh_vertex_count(EntityID entity, int meshIndex);
+
+// Model import settings and LODs
+void boulder_set_model_import_settings(int optimize, const float* lodRatios, const float* lodErrors, int lodCount);
+int boulder_get_model_lod_count(EntityID entity);
+int boulder_set_model_lod(EntityID entity, int lod);
+int boulder_get_model_lod(EntityID entity);
+int boulder_get_model_triangle_count(EntityID entity, int lod);
 
 // Input handling
 int boulder_is_key_pressed(int keyCode);
 int boulder_is_mouse_button_pressed(int button);
 void boulder_get_mouse_position(float* x, float* y);
+// Wheel movement during the last boulder_poll_events in notches (fractional on touchpads);
+// positive y scrolls away from the user, positive x to the right
+void boulder_get_mouse_wheel(float* x, float* y);
+
+// Keys. Scancodes are physical key positions named after the US layout (SDL_Scancode) and
+// are what boulder_is_key_pressed takes; keycodes are what a key types on the user's
+// layout (SDL_Keycode), so on AZERTY scancode 26 (W) has keycode 'z'.
+typedef struct {
+    int scancode;
+    uint32_t keycode;
+    int down;   // 1 pressed, 0 released
+    int repeat; // 1 if the key is held and this is a repeat
+} KeyEvent;
+
+int boulder_poll_key_event(KeyEvent* event); // 1 if an event was returned
+uint32_t boulder_get_keycode(int scancode);  // On the current layout
+int boulder_get_scancode(uint32_t keycode);  // 0 if no key types it
+// Name of the key at a position on the current layout ("Z" for W on AZERTY), and the
+// layout independent name of the position; both return the full length
+uint32_t boulder_get_key_name(int scancode, char* buffer, uint32_t capacity);
+uint32_t boulder_get_scancode_name(int scancode, char* buffer, uint32_t capacity);
+int boulder_take_keymap_changed(); // 1 if the keyboard layout changed since the last call
+
+// Touch input, in window coordinates like the mouse. A finger keeps its id from down to up.
+// Phase: 0 down, 1 move, 2 up, 3 cancel (the system took the touch).
+typedef struct {
+    uint64_t id;
+    int phase;
+    float x;
+    float y;
+    float dx;
+    float dy;
+    float pressure;
+} TouchEvent;
+
+typedef struct {
+    uint64_t id;
+    float x;
+    float y;
+    float startX; // Where the finger went down
+    float startY;
+    float pressure;
+} TouchPoint;
+
+int boulder_poll_touch_event(TouchEvent* event); // 1 if an event was returned
+int boulder_get_touch_count();
+int boulder_get_touch(int index, TouchPoint* touch);
+
+// App lifecycle (Android and iOS): 0 will pause, 1 paused, 2 will resume, 3 resumed,
+// 4 low memory, 5 terminating. While paused boulder_begin_frame returns -3 and
+// boulder_render skips frames; on Android the window surface is released when paused and
+// created again on resume.
+int boulder_poll_app_event(int* event); // 1 if an event was returned
+int boulder_is_paused();
+
+// Motion sensors: the gyro in radians per second and the accelerometer in m/s² including
+// gravity, from a controller that has them (DualSense, Switch Pro, ...) or else the device
+// itself (phones, Steam Deck). Readings are collected by boulder_poll_events once enabled.
+// Source: 0 none, 1 device, 2 controller.
+int boulder_enable_motion(int enabled);
+int boulder_get_motion_source();
+void boulder_get_gyro(float* x, float* y, float* z); // Calibrated bias removed
+void boulder_get_accel(float* x, float* y, float* z);
+// Rotation in radians integrated from every gyro sample since the last call, and the
+// seconds those samples covered
+void boulder_take_gyro_delta(float* x, float* y, float* z, float* elapsed);
+// Calibration averages the gyro while the device is held still; -1 if no samples arrived
+void boulder_start_gyro_calibration();
+int boulder_finish_gyro_calibration();
+void boulder_set_gyro_bias(float x, float y, float z);
+void boulder_get_gyro_bias(float* x, float* y, float* z);
+
+// Controllers, identified by an id that stays the same while they are connected.
+// Capabilities: 1 rumble, 2 trigger rumble, 4 LED, 8 adaptive triggers, 16 HD rumble,
+// 32 gyro, 64 accelerometer.
+int boulder_get_controller_count();
+uint32_t boulder_get_controller_id(int index); // 0 if out of range
+uint32_t boulder_get_controller_name(uint32_t controller, char* buffer, uint32_t capacity); // Full length
+uint32_t boulder_get_controller_capabilities(uint32_t controller);
+
+// Buttons and axes in SDL's order. Buttons: 0 south (A/cross), 1 east, 2 west, 3 north,
+// 4 back, 5 guide, 6 start, 7 left stick, 8 right stick, 9 left shoulder, 10 right
+// shoulder, 11-14 d-pad up, down, left, right. Axes: 0-1 left stick x and y, 2-3 right
+// stick, 4-5 left and right trigger. Sticks read -1 to 1 with y pointing down, triggers 0 to 1.
+int boulder_get_controller_button(uint32_t controller, int button);
+float boulder_get_controller_axis(uint32_t controller, int axis);
+
+// Rumble strengths and colors are 0 to 1. These return -1 if the controller lacks the feature.
+int boulder_rumble(uint32_t controller, float low, float high, uint32_t durationMs);
+int boulder_rumble_triggers(uint32_t controller, float left, float right, uint32_t durationMs);
+int boulder_set_controller_led(uint32_t controller, float r, float g, float b);
+
+// Adaptive trigger effect (DualSense) on trigger 0 (left) or 1 (right). Mode: 0 off,
+// 1 resistance from start, 2 resistance between start and end, 3 vibration past start.
+// Positions are 0 to 1 of the pull.
+typedef struct {
+    int mode;
+    float start;
+    float end;
+    float strength;  // 0 to 1
+    float frequency; // Hz, for vibration
+} TriggerEffect;
+
+int boulder_set_trigger_effect(uint32_t controller, int trigger, const TriggerEffect* effect);
+
+// Haptic effect mixed with the others playing on the controller each boulder_poll_events.
+// Target: 0 the body's motors, 1 left trigger, 2 right trigger. Frequency splits body
+// effects between the low (40 Hz and below) and high (320 Hz and above) motors, which are
+// the HD rumble bands on Switch controllers; 0 drives both equally.
+typedef struct {
+    int target;
+    float strength;    // 0 to 1 once attacked and until the fade
+    float frequency;   // Hz
+    float duration;    // Seconds including attack and fade, 0 to play until stopped
+    float attackTime;  // Seconds to ramp from attackLevel to strength
+    float attackLevel;
+    float fadeTime;    // Seconds to ramp from strength to fadeLevel at the end
+    float fadeLevel;
+} HapticEffect;
+
+uint32_t boulder_play_haptic_effect(uint32_t controller, const HapticEffect* effect); // 0 if unsupported
+void boulder_stop_haptic_effect(uint32_t controller, uint32_t effect); // 0 stops all
 
 // Logging
 void boulder_log_info(const char* message);
 void boulder_log_error(const char* message);
+// Queues every line logged from then on, engine and game alike, for boulder_poll_log; the
+// oldest are dropped past 1024. Levels: 0 debug, 1 info, 2 warning, 3 error, 4 critical.
+int boulder_watch_logs(int enabled);
+int boulder_poll_log(int* level, char* message, uint32_t messageSize); // 1 if a line was returned
 
 // Shader management
 typedef unsigned long long ShaderModuleID;
 ShaderModuleID boulder_compile_shader(const char* source, int shaderKind, const char* name);
 void boulder_destroy_shader_module(ShaderModuleID shaderId);
+int boulder_compile_spirv(const char* source, int shaderKind, const char* name,
+                          uint32_t* words, uint32_t capacity, uint32_t* wordCount); // 1 if words too small
 ShaderModuleID boulder_reload_shader(ShaderModuleID shaderId, const char* source, int shaderKind, const char* name);
+// Variants take "NAME" or "NAME=VALUE" defines and are cached by preprocessed source.
+// #include "file" is resolved next to the including file, then under the include root.
+ShaderModuleID boulder_compile_shader_variant(const char* source, int shaderKind, const char* name,
+                                              const char** defines, uint32_t defineCount);
+void boulder_set_shader_include_root(const char* dir); // NULL or "" for the working directory
+void boulder_clear_shader_cache();
 
 // Pipeline management
 typedef unsigned long long PipelineID;
 PipelineID boulder_create_graphics_pipeline(ShaderModuleID meshShader, ShaderModuleID fragShader);
-void boulder_bind_pipeline(PipelineID pipelineId);
+int boulder_bind_pipeline(PipelineID pipelineId);
 void boulder_destroy_pipeline(PipelineID pipelineId);
 
+// Custom materials. Material pipelines use the model pipeline's set 0 and push constants,
+// plus set 1: binding 0 is the entity's parameter block (uniform buffer, up to 256 bytes)
+// and binding 1 an array of 4 sampled textures (unset slots are white).
+typedef unsigned long long TextureID;
+TextureID boulder_create_texture(const void* rgba, uint32_t width, uint32_t height); // 0 on failure
+// A texture in a GPU format with its mip levels, e.g. from a KTX2 file. format is a VkFormat:
+// R8G8B8A8, or BC1, BC3, BC4, BC5 or BC7 when the GPU supports BCn. data holds the levels
+// back to back, largest first. 0 on failure.
+TextureID boulder_create_texture_levels(uint32_t format, uint32_t width, uint32_t height, uint32_t levels,
+                                       const void* data, uint64_t size);
+void boulder_destroy_texture(TextureID texture);
+PipelineID boulder_create_material_pipeline(ShaderModuleID meshShader, ShaderModuleID fragShader);
+int boulder_set_model_pipeline(EntityID entity, PipelineID pipelineId); // 0 restores the default
+PipelineID boulder_get_model_pipeline(EntityID entity);
+int boulder_set_material_params(EntityID entity, const void* data, uint32_t size);
+int boulder_set_material_texture(EntityID entity, uint32_t slot, TextureID texture); // 0 clears the slot
+// Named floats in a material pipeline's parameter block (byte offset, 4 aligned), set per
+// entity with boulder_set_material_float
+int boulder_define_material_param(PipelineID pipelineId, const char* name, uint32_t offset);
+int boulder_set_material_float(EntityID entity, const char* name, float value);
+int boulder_get_material_float(EntityID entity, const char* name, float* value);
+
+// Standard material, which the materials of model files are imported as. Its parameter
+// block (std140): vec4 baseColor at 0, vec4 emissive at 16 (rgb), then floats metallic at
+// 32, roughness 36, normalScale 40 and alphaCutoff 44. Texture slots: 0 albedo, 1 normal,
+// 2 metallic-roughness (roughness in G, metallic in B), 3 emissive.
+typedef struct {
+    float baseColor[4];
+    float emissive[3];
+    float metallic;
+    float roughness;
+    float normalScale;
+    float alphaCutoff;
+    int alphaMode; // Blend mode the file asks for: opaque, alpha test or alpha blend
+} StandardMaterial;
+// Materials of an entity's model file, drawn per mesh with the entity's material pipeline
+// (or the default one) over the entity's own parameter block and textures. Texture paths
+// are relative to the model file, "*N" for embedded texture N, or empty.
+int boulder_get_model_path(EntityID entity, char* path, uint32_t pathSize); // File (or name) it was loaded from
+int boulder_get_model_material_count(EntityID entity);
+int boulder_get_model_material(EntityID entity, int index, StandardMaterial* material, char* name, uint32_t nameSize);
+int boulder_get_model_material_texture(EntityID entity, int index, int slot, char* path, uint32_t pathSize);
+// Copies embedded texture N of the entity's model file into data, if it fits, and returns
+// its size in bytes (-1 if there is none). Width and height are 0 for compressed images
+// (PNG, JPEG); otherwise the data is RGBA pixels.
+int boulder_get_model_embedded_texture(EntityID entity, int index, void* data, uint32_t capacity,
+                                       uint32_t* width, uint32_t* height);
+// Sets material index of the entity's model to values and 4 textures (0 samples white).
+// Index -1 sets every one of them and the entity's own material.
+int boulder_set_model_material(EntityID entity, int index, const StandardMaterial* material, const TextureID* textures);
+// Material pipeline for entities with a material but no pipeline of their own, and for
+// models with materials from their file. 0 draws them with the built-in model pipeline.
+int boulder_set_default_material_pipeline(PipelineID pipelineId);
+PipelineID boulder_get_default_material_pipeline();
+
+// Per-entity tint (multiplies the color, alpha included) and emissive color (added),
+// passed to model and material fragment shaders as push constants at offset 144:
+// vec4 tint, vec4 emissive. boulder_get_instance_color writes 4 tint and 3 emissive floats.
+int boulder_set_tint(EntityID entity, float r, float g, float b, float a);
+int boulder_set_emissive(EntityID entity, float r, float g, float b, float intensity);
+int boulder_get_instance_color(EntityID entity, float* tint, float* emissive);
+
+// Lights, read by model and material fragment shaders from set 0, binding 3 (std430):
+// vec4 ambient, uint count, then per light vec4 position (w range, 0 for no cutoff),
+// vec4 direction (w type: 0 directional, 1 point, 2 spot), vec4 color (w intensity) and
+// vec4 cone (cosines of the inner and outer half angles). Lights shine along the entity's
+// -Z axis. Up to 64 are used, the nearest to the camera; scenes without any get a default
+// directional light. Cone angles are half angles in degrees.
+int boulder_add_directional_light(EntityID entity, float r, float g, float b, float intensity);
+int boulder_add_point_light(EntityID entity, float r, float g, float b, float intensity, float range);
+int boulder_add_spot_light(EntityID entity, float r, float g, float b, float intensity, float range,
+                           float innerAngle, float outerAngle);
+int boulder_remove_light(EntityID entity);
+// Writes 3 color floats and intensity, range and cone angles; returns the type, -1 if the entity has no light
+int boulder_get_light(EntityID entity, float* color, float* intensity, float* range, float* innerAngle, float* outerAngle);
+int boulder_set_ambient_light(float r, float g, float b, float intensity);
+int boulder_get_ambient_light(float* color); // Color times intensity
+
+// Blend modes: 0 opaque, 1 alpha test, 2 alpha blend, 3 additive. Blended modes test depth
+// without writing it. Fragment shaders get the mode as specialization constant 0, so alpha
+// tested shaders can discard. Models draw by render queue (0 picks the blend mode's: 2000
+// opaque, 2450 alpha test, 3000 blended), blended models within a queue back to front.
+int boulder_set_blend_mode(EntityID entity, int blendMode);
+int boulder_get_blend_mode(EntityID entity);
+int boulder_set_render_queue(EntityID entity, int queue);
+int boulder_get_render_queue(EntityID entity); // 0 when the blend mode's queue is used
+
+// Async compilation. IDs are returned at once and work on worker threads; shaders still
+// compiling can be passed to boulder_create_material_pipeline_async. Entities using a
+// material pipeline that is still compiling (or failed) draw with the built-in model
+// pipeline. Finished compiles are picked up by boulder_begin_frame and the queries below.
+// Status: 1 ready, 0 compiling, -1 failed or unknown ID.
+ShaderModuleID boulder_compile_shader_async(const char* source, int shaderKind, const char* name,
+                                            const char** defines, uint32_t defineCount);
+PipelineID boulder_create_material_pipeline_async(ShaderModuleID meshShader, ShaderModuleID fragShader);
+int boulder_get_shader_status(ShaderModuleID shaderId);
+// Copies the compiler output of a failed async shader compile, returning its length (0 if
+// the shader didn't fail)
+uint32_t boulder_get_shader_error(ShaderModuleID shaderId, char* buffer, uint32_t capacity);
+int boulder_get_pipeline_status(PipelineID pipelineId);
+// Copies why an async material pipeline failed and sets code to its error code, returning
+// the message length (0 if the pipeline didn't fail)
+uint32_t boulder_get_pipeline_error(PipelineID pipelineId, int* code, char* buffer, uint32_t capacity);
+uint32_t boulder_get_pending_compiles();
+void boulder_wait_async_compiles();
+
+// Selection outlines, thickness in pixels (0 removes the outline). Outlines are drawn over
+// everything, skipping other outlined models. They need a stencil buffer and the
+// shaders/outline.mesh and shaders/outline.frag files; boulder_outlines_supported says
+// whether both were found.
+int boulder_set_outline(EntityID entity, float r, float g, float b, float a, float thickness);
+int boulder_outlines_supported();
+
 // Rendering control
 int boulder_begin_frame(uint32_t* imageIndex);
 int boulder_end_frame(uint32_t imageIndex);
-void boulder_render_models();  // Render all entities with Model components
+int boulder_render_models();  // Render all entities with Model components
 void boulder_set_clear_color(float r, float g, float b, float a);
-void boulder_set_viewport(float x, float y, float width, float height, float minDepth, float maxDepth);
-void boulder_set_scissor(int x, int y, int width, int height);
+// An RGBA image frames start from, drawn over the clear color before anything else (splash
+// screens, boot videos). Fit: 0 the whole image with bars in the clear color, 1 covering
+// the screen. NULL removes it. Replacing it waits for the GPU.
+int boulder_set_backdrop(const void* rgba, uint32_t width, uint32_t height, int fit);
+int boulder_has_backdrop();
+int boulder_set_viewport(float x, float y, float width, float height, float minDepth, float maxDepth);
+int boulder_set_scissor(int x, int y, int width, int height);
+
+// Frame pacing. Frames in flight: 1 to 3 (default 3) frames queued at once. Present modes:
+// 0 immediate (default), 1 mailbox, 2 FIFO (vsync), 3 FIFO relaxed; unsupported modes fall
+// back to FIFO and changing it recreates the swapchain. Low latency mode makes
+// boulder_end_frame wait until the frame is on screen (VK_KHR_present_wait, presentWait 1)
+// or, without present wait, rendered.
+typedef struct {
+    float latencyMs;        // End of the previous frame to this one on screen (or rendered)
+    float averageLatencyMs; // Smoothed over recent frames
+    float refreshRate;      // Of the window's display
+    uint64_t framesPresented;
+    uint64_t framesDropped; // Display refreshes that showed an old frame again
+    int presentMode;
+    uint32_t framesInFlight;
+    int lowLatency;
+    int presentWait;
+} PresentStats;
+
+int boulder_set_frames_in_flight(uint32_t count);
+uint32_t boulder_get_frames_in_flight();
+int boulder_set_present_mode(int mode);
+int boulder_get_present_mode(); // The mode in use, which may be the FIFO fallback
+void boulder_set_low_latency(int enabled);
+int boulder_get_low_latency();
+int boulder_get_present_stats(PresentStats* stats);
+void boulder_reset_present_stats();
+
+// Time the last frame took on the CPU (excluding waits for the GPU) and on the GPU (from
+// timestamps, a few frames late; 0 if the GPU has no timestamps). The LOD bias is added to
+// every model's LOD when drawing, e.g. 1 draws LOD 0 models at LOD 1.
+typedef struct {
+    float cpuMs;
+    float gpuMs;
+    int gpuTimingSupported;
+} FrameTimes;
+
+int boulder_get_frame_times(FrameTimes* times);
+void boulder_set_lod_bias(int bias);
+int boulder_get_lod_bias();
+
+// CPU time of each engine subsystem in the last boulder_update and frame. waitMs is how
+// long the last frame waited for the GPU and the swapchain.
+typedef struct {
+    float physicsMs;    // Integrating velocities
+    float collisionsMs;
+    float buoyancyMs;
+    float softBodiesMs;
+    float modelsMs;     // Recording model draws
+    float uiMs;         // Recording the UI
+    float submitMs;     // Submitting and presenting
+    float waitMs;
+} SubsystemTimes;
+
+int boulder_get_subsystem_times(SubsystemTimes* times);
+
+// Draws recorded for the last frame (models, outlines and DrawMesh calls; not the UI), and
+// the device memory the engine has allocated for buffers, textures and attachments
+typedef struct {
+    uint32_t drawCalls;
+    uint64_t triangles;
+    uint64_t deviceMemoryBytes;
+    uint32_t deviceAllocations;
+} RenderStats;
+
+int boulder_get_render_stats(RenderStats* stats);
+
+// Live native objects by subsystem, for soak tests that look for leaks
+typedef struct {
+    int worlds;
+    int entities;       // In every world, counted as boulder_world_entity_count does
+    int models;         // Entities with a model
+    int meshes;         // Meshes of those models
+    int textures;
+    int shaderModules;
+    int pipelines;
+    int uiElements;     // Buttons, labels, progress bars and containers
+    int fonts;
+    int networkSessions;
+    int connections;    // Open on every network session
+} NativeObjectCounts;
+
+int boulder_get_native_object_counts(NativeObjectCounts* counts);
+
+// Camera used by boulder_render_models. Projections: 0 perspective (the default, fovY in
+// degrees), 1 orthographic (height in world units). Pixel perfect orthographic cameras
+// scale pixelsPerUnit art pixels to a whole number of screen pixels (zoom, 0 for the
+// largest that shows the orthographic height). Snap: 0 none, 1 screen pixels, 2 art pixels,
+// applied to the camera and model positions.
+int boulder_set_camera_perspective(float fovY, float nearZ, float farZ);
+int boulder_set_camera_orthographic(float height, float nearZ, float farZ);
+int boulder_set_camera_look_at(float px, float py, float pz, float tx, float ty, float tz,
+                               float ux, float uy, float uz);
+int boulder_set_camera_pixel_perfect(float pixelsPerUnit, int zoom, int snap);
+float boulder_get_camera_pixel_scale(); // Screen pixels per world unit, 0 for perspective
+int boulder_camera_screen_ray(float x, float y, float* origin, float* direction);
+
+// Filtering of textures the engine binds: 0 linear (default), 1 nearest for pixel art
+int boulder_set_texture_filter(int filter);
+int boulder_get_texture_filter();
+
+// Screenshots: request one, render a frame, then read it back as RGBA8.
+// boulder_get_screenshot returns 0 when copied, 1 if the requested frame hasn't been
+// rendered yet, 2 if rgba is too small (width/height are still set), -1 on error.
+void boulder_request_screenshot();
+int boulder_get_screenshot(uint8_t* rgba, uint32_t capacity, uint32_t* width, uint32_t* height);
 
 // Draw commands
-void boulder_draw_mesh(uint32_t groupCountX, uint32_t groupCountY, uint32_t groupCountZ);
-void boulder_set_push_constants(const void* data, uint32_t size, uint32_t offset);
+int boulder_draw_mesh(uint32_t groupCountX, uint32_t groupCountY, uint32_t groupCountZ);
+int boulder_set_push_constants(const void* data, uint32_t size, uint32_t offset); // Up to 64 bytes
+
+// API misuse. Calls made outside a frame, with destroyed or unbound pipelines or push
+// constants out of range fail and record a message, taken (and cleared) with
+// boulder_take_api_error, which returns its length (0 if none). Debug mode adds device
+// limit and GPU hang checks; set before boulder_init it enables the Vulkan validation
+// layer (if installed), whose errors are recorded the same way.
+void boulder_set_debug_mode(int enabled);
+int boulder_get_debug_mode();
+int boulder_validation_enabled();
+uint32_t boulder_take_api_error(char* buffer, uint32_t capacity);
+
+// Native exceptions. Every function catches C++ exceptions instead of letting them reach
+// the caller: it logs them and returns its failure value (-1, 0 or NULL). The last message
+// is taken (and cleared) with boulder_take_native_error, which returns its length.
+uint32_t boulder_take_native_error(char* buffer, uint32_t capacity);
+
+// Why the last call on this thread failed: returns a code and copies the message into
+// buffer. 0 (with an empty message) if the call recorded no reason; each call clears it.
+// Codes: 1 not initialized, 2 invalid argument, 3 not found, 4 file, 5 invalid data,
+// 6 unsupported, 7 Vulkan, 8 shader compilation, 9 platform (SDL), 10 network,
+// 11 API misuse, 12 native exception.
+int boulder_get_last_error(char* buffer, uint32_t capacity);
+uint32_t boulder_get_last_error_length(); // Of the message, e.g. to size buffer for a shader's compiler output
 
 // Swapchain management
 void boulder_get_swapchain_extent(int* width, int* height);
@@ -104,33 +713,93 @@ void boulder_network_enable_fake_ip(); // For easier testing without real Steam
 int boulder_start_server(NetworkSession session, uint16_t port);
 int boulder_start_server_p2p(NetworkSession session, int virtualPort); // P2P mode with virtual port
 void boulder_stop_server(NetworkSession session);
+// Refuses new incoming connections while accept is 0, keeping the ones that are open
+int boulder_set_accepting_connections(NetworkSession session, int accept);
+// Writes up to capacity open connections and returns how many there are
+int boulder_get_connections(NetworkSession session, ConnectionHandle* connections, uint32_t capacity);
 
 // Client operations
 ConnectionHandle boulder_connect(NetworkSession session, const char* address, uint16_t port);
 ConnectionHandle boulder_connect_p2p(NetworkSession session, SteamID steamID, int virtualPort); // Connect by Steam ID
 void boulder_disconnect(NetworkSession session, ConnectionHandle conn);
+// Closes a connection with a reason the peer is told. With linger, reliable messages still
+// queued are delivered first.
+void boulder_close_connection(NetworkSession session, ConnectionHandle conn, const char* reason, int linger);
 int boulder_connection_state(NetworkSession session, ConnectionHandle conn);
+// How long a connection may take to connect and may go without hearing from the peer
+// before it is closed, for the session's open and future connections. 0 keeps the default
+// (10 seconds each).
+int boulder_set_network_timeouts(NetworkSession session, int initialMs, int connectedMs);
 
 // Identity management
 void boulder_set_local_identity(NetworkSession session, const char* name);
 SteamID boulder_get_local_steam_id(NetworkSession session);
+SteamID boulder_get_remote_steam_id(NetworkSession session, ConnectionHandle conn); // 0 unless Steam authenticated the peer
+int boulder_network_steam_available(NetworkSession session); // 1 if Steam P2P can be used
 
 // Messaging
 int boulder_send_message(NetworkSession session, ConnectionHandle conn, const void* data, uint32_t size, int reliable);
 
+// Channels (GameNetworkingSockets lanes) split a connection so a stalled reliable message on
+// one doesn't hold up the others. Up to 16; lower priorities are sent first and channels of
+// equal priority share bandwidth by weight. Channels can be added but not removed; 0 is the
+// one boulder_send_message uses. Send flags: 1 reliable, 2 send now instead of batching
+// with later messages, 4 drop an unreliable message that can't be sent right away.
+int boulder_configure_channels(NetworkSession session, ConnectionHandle conn, int count,
+                               const int* priorities, const uint16_t* weights);
+int boulder_send_message_on_channel(NetworkSession session, ConnectionHandle conn, int channel,
+                                    const void* data, uint32_t size, int flags);
+
 // Event polling
 typedef struct {
     int type; // 0=none, 1=connected, 2=disconnected, 3=message
     ConnectionHandle connection;
     uint8_t* data;
     uint32_t dataSize;
+    int64_t timestamp; // Local time the event was received, in microseconds (see boulder_network_local_time)
+    int channel;       // Of a message
 } NetworkEvent;
 
 int boulder_poll_network_event(NetworkSession session, NetworkEvent* event);
+
+// Link quality of a connection, as GameNetworkingSockets measures it. Qualities are the
+// fraction of packets delivered in each direction (-1 until known).
+typedef struct {
+    int pingMs;
+    float qualityLocal;          // Packets from the peer that arrived
+    float qualityRemote;         // Packets to the peer that arrived, as it reports
+    float outPacketsPerSec;
+    float outBytesPerSec;
+    float inPacketsPerSec;
+    float inBytesPerSec;
+    int sendRateBytesPerSec;     // Estimated bandwidth
+    int pendingUnreliableBytes;  // Queued, not yet sent
+    int pendingReliableBytes;
+    int sentUnackedReliableBytes;
+    int64_t queueTimeUsec;       // How long a message sent now would wait to go out
+} ConnectionStats;
+
+int boulder_get_connection_stats(NetworkSession session, ConnectionHandle conn, ConnectionStats* stats);
 void boulder_free_network_event_data(void* data);
 
+// Clock
+int64_t boulder_network_local_time(); // Monotonic local networking time in microseconds
+
+// Steam lobbies (require boulder_network_init_with_steam_app and an active session)
+int boulder_steam_request_lobby_list(); // Results arrive during boulder_network_update
+int boulder_steam_lobby_list_ready();
+int boulder_steam_lobby_count();
+int boulder_steam_get_lobby(int index, uint64_t* lobbyId,
+                            char* name, uint32_t nameSize,
+                            char* address, uint32_t addressSize,
+                            int* players, int* maxPlayers, int* pingMs); // pingMs is -1 if unknown
+int boulder_steam_create_lobby(int maxPlayers, const char* name, const char* address);
+uint64_t boulder_steam_get_hosted_lobby(); // 0 until the lobby has been created
+void boulder_steam_leave_lobby();
+
 // UI Overlay System
 typedef uint64_t UIButtonID;
+typedef uint64_t UIContainerID;
 
 // UI initialization (called automatically during boulder_init)
 int boulder_ui_init();
@@ -145,6 +814,10 @@ void boulder_ui_destroy_button(UIButtonID buttonId);
 void boulder_ui_set_button_position(UIButtonID buttonId, float x, float y);
 void boulder_ui_set_button_size(UIButtonID buttonId, float width, float height);
 void boulder_ui_set_button_enabled(UIButtonID buttonId, int enabled);
+void boulder_ui_set_button_colors(UIButtonID buttonId,
+                                  float normalR, float normalG, float normalB, float normalA,
+                                  float hoverR, float hoverG, float hoverB, float hoverA,
+                                  float pressedR, float pressedG, float pressedB, float pressedA);
 
 // Input handling (should be called from event loop)
 void boulder_ui_handle_mouse_move(float x, float y);
@@ -155,6 +828,125 @@ void boulder_ui_handle_mouse_up(float x, float y);
 int boulder_ui_button_was_clicked(UIButtonID buttonId);
 void boulder_ui_reset_button_click(UIButtonID buttonId);
 
+// Opacity (0 to 1) multiplies the alpha of every color. Hidden buttons are not drawn,
+// hovered, clicked or focused.
+void boulder_ui_set_button_opacity(UIButtonID buttonId, float opacity);
+void boulder_ui_set_button_visible(UIButtonID buttonId, int visible);
+// Draw and hit the button only inside a rect, e.g. a scroll view's viewport
+void boulder_ui_set_button_clip(UIButtonID buttonId, float x, float y, float width, float height);
+void boulder_ui_clear_button_clip(UIButtonID buttonId);
+
+typedef struct {
+    float x;
+    float y;
+    float width;
+    float height;
+    float normalColor[4];
+    float hoverColor[4];
+    float pressedColor[4];
+    float opacity;
+    int visible;
+    int enabled;
+} UIButtonInfo;
+
+int boulder_ui_get_button_info(UIButtonID buttonId, UIButtonInfo* info); // -1 if there is no such button
+
+// Rounded corners, borders and drop shadows. Borders are drawn inside the button; a
+// shadow with shadowColor alpha 0 is not drawn. The default style is given to buttons
+// created after it is set.
+typedef struct {
+    float cornerRadius;
+    float borderWidth;
+    float borderColor[4];
+    float shadowColor[4];
+    float shadowOffsetX;
+    float shadowOffsetY;
+    float shadowBlur; // Pixels the shadow's edge fades over
+} UIButtonStyle;
+
+void boulder_ui_set_button_style(UIButtonID buttonId, const UIButtonStyle* style);
+int boulder_ui_get_button_style(UIButtonID buttonId, UIButtonStyle* style); // -1 if there is no such button
+void boulder_ui_set_default_style(const UIButtonStyle* style);
+
+// Progress bars, drawn over buttons. Fill: 0 left to right, 1 right to left, 2 bottom to
+// top, 3 top to bottom, 4 clockwise and 5 counterclockwise from the top (radial, drawn as a
+// circle in the bar's bounds). The fill blends from fillStart at the empty end to fillEnd
+// at the full end; the trail is drawn behind it up to its own fraction. Colors are RGBA.
+typedef uint64_t UIProgressBarID;
+
+UIProgressBarID boulder_ui_create_progress_bar(float x, float y, float width, float height); // 0 on failure
+void boulder_ui_destroy_progress_bar(UIProgressBarID barId);
+void boulder_ui_set_progress_bar_bounds(UIProgressBarID barId, float x, float y, float width, float height);
+void boulder_ui_set_progress_bar_value(UIProgressBarID barId, float value, float trail); // Fractions, 0 to 1
+void boulder_ui_set_progress_bar_fill(UIProgressBarID barId, int fill);
+void boulder_ui_set_progress_bar_colors(UIProgressBarID barId, const float* background, const float* fillStart,
+                                        const float* fillEnd, const float* trail);
+void boulder_ui_set_progress_bar_style(UIProgressBarID barId, const UIButtonStyle* style);
+void boulder_ui_set_progress_bar_opacity(UIProgressBarID barId, float opacity);
+void boulder_ui_set_progress_bar_visible(UIProgressBarID barId, int visible);
+
+// Text. Fonts are TrueType or OpenType data, copied by boulder_ui_load_font; the first
+// font loaded is the default, used by text whose style has font 0. Size is the font's
+// pixel height. Align: 0 left, 1 center, 2 right; vertical align: 0 top, 1 middle,
+// 2 bottom. Text is UTF-8 and '\n' starts a new line. Button text is drawn on the button
+// (centered unless aligned otherwise); labels are drawn over buttons and progress bars,
+// top-left in their bounds unless aligned otherwise.
+typedef uint64_t UIFontID;
+typedef uint64_t UILabelID;
+
+typedef struct {
+    UIFontID font;
+    float size;
+    float color[4];
+    int align;
+    int verticalAlign;
+} UITextStyle;
+
+UIFontID boulder_ui_load_font(const void* data, uint32_t size); // 0 on failure
+void boulder_ui_destroy_font(UIFontID font);
+void boulder_ui_set_default_font(UIFontID font);
+int boulder_ui_measure_text(const char* text, const UITextStyle* style, float* width, float* height);
+void boulder_ui_set_button_text(UIButtonID buttonId, const char* text);
+void boulder_ui_set_button_text_style(UIButtonID buttonId, const UITextStyle* style);
+UILabelID boulder_ui_create_label(float x, float y, float width, float height); // 0 on failure
+void boulder_ui_destroy_label(UILabelID labelId);
+void boulder_ui_set_label_bounds(UILabelID labelId, float x, float y, float width, float height);
+void boulder_ui_set_label_text(UILabelID labelId, const char* text);
+void boulder_ui_set_label_text_style(UILabelID labelId, const UITextStyle* style);
+void boulder_ui_set_label_opacity(UILabelID labelId, float opacity);
+void boulder_ui_set_label_visible(UILabelID labelId, int visible);
+
+// Accessible names and focus. The focused button is the one last hovered, touched or
+// navigated to; boulder_ui_take_focus_changed returns 1 once after it changes.
+void boulder_ui_set_button_label(UIButtonID buttonId, const char* label);
+uint32_t boulder_ui_get_button_label(UIButtonID buttonId, char* buffer, uint32_t capacity); // Full length
+UIButtonID boulder_ui_get_focused_button(); // 0 if none
+UIButtonID boulder_ui_get_hovered_button(); // Enabled button under the pointer, 0 if none or while pressing it
+UIButtonID boulder_ui_get_pressed_button(); // Button the mouse went down on, until it is released
+int boulder_ui_take_focus_changed();
+
+// Keyboard and controller navigation. Direction: 0 up, 1 down, 2 left, 3 right, 4 next,
+// 5 previous (reading order by container). Moving focus shows a ring around the focused
+// button until the mouse moves; activating clicks it.
+int boulder_ui_move_focus(int direction); // 1 if focus moved
+void boulder_ui_set_focus(UIButtonID buttonId); // 0 clears focus
+int boulder_ui_activate_focused(); // 1 if a button was clicked
+void boulder_ui_set_button_focusable(UIButtonID buttonId, int focusable);
+void boulder_ui_set_focus_color(float r, float g, float b, float a);
+
+// Containers order focus: next and previous go through a container's buttons before the
+// next container's, and directional moves stay in the container while they can
+UIContainerID boulder_ui_create_container();
+void boulder_ui_destroy_container(UIContainerID containerId);
+void boulder_ui_set_button_container(UIButtonID buttonId, UIContainerID containerId); // 0 for none
+void boulder_ui_set_label_container(UILabelID labelId, UIContainerID containerId); // 0 for none
+
+// Modal layer: only buttons in the modal container take input and focus, and everything
+// else is drawn under dimColor (RGBA) with the container's buttons and labels on top.
+// 0 clears it.
+void boulder_ui_set_modal(UIContainerID containerId, const float* dimColor);
+UIContainerID boulder_ui_get_modal(); // 0 if none
+
 // Rendering (called during frame rendering)
 void boulder_ui_render(uint32_t imageIndex);
 
@@ -0,0 +1,197 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// SpeechPriority decides what happens to speech while something else is being said
+type SpeechPriority int
+
+const (
+	SpeechLow    SpeechPriority = 0 // Dropped if anything is being said or waiting
+	SpeechNormal SpeechPriority = 1 // Waits for what is being said
+	SpeechHigh   SpeechPriority = 2 // Cuts off what is being said and drops what is waiting
+)
+
+// SpeechBackend says text aloud. The default uses the platform's voice; set one with
+// Accessibility.SetBackend to send speech to a screen reader (NVDA, JAWS, VoiceOver,
+// TalkBack) through its own API instead.
+type SpeechBackend interface {
+	// Speak starts saying text without waiting for it to finish. With interrupt, whatever
+	// is being said is cut off first.
+	Speak(text string, interrupt bool) error
+	Stop() error
+	IsSpeaking() bool
+}
+
+// Accessibility speaks text for players who cannot read the screen and announces UI
+// buttons as they take focus. Call Update once a frame after Window.PollEvents.
+type Accessibility struct {
+	engine        *Engine
+	backend       SpeechBackend
+	queue         []string
+	announceFocus bool
+}
+
+// NewAccessibility creates an Accessibility speaking with the platform's voice: say on
+// macOS, Speech Dispatcher (or eSpeak) on Linux and System.Speech on Windows. Android and
+// iOS have no default; set a backend there. Focus announcements are on.
+func NewAccessibility(engine *Engine) *Accessibility {
+	a := &Accessibility{engine: engine, announceFocus: true}
+	if voice := newPlatformVoice(); voice != nil {
+		a.backend = voice
+	}
+	return a
+}
+
+// SetBackend replaces how text is spoken, e.g. with a screen reader's API. nil turns
+// speech off.
+func (a *Accessibility) SetBackend(backend SpeechBackend) {
+	if a.backend != nil {
+		a.backend.Stop()
+	}
+	a.backend = backend
+	a.queue = nil
+}
+
+// HasVoice returns whether there is a backend to speak with
+func (a *Accessibility) HasVoice() bool {
+	return a.backend != nil
+}
+
+// Speak says text with the given priority. Normal priority speech waits its turn and is
+// started by Update.
+func (a *Accessibility) Speak(text string, priority SpeechPriority) error {
+	if a.backend == nil {
+		return errors.New("no speech backend")
+	}
+	if text == "" {
+		return nil
+	}
+
+	busy := a.backend.IsSpeaking() || len(a.queue) > 0
+	switch priority {
+	case SpeechHigh:
+		a.queue = nil
+		return a.backend.Speak(text, true)
+	case SpeechLow:
+		if busy {
+			return nil
+		}
+	default:
+		if busy {
+			a.queue = append(a.queue, text)
+			return nil
+		}
+	}
+	return a.backend.Speak(text, false)
+}
+
+// Stop cuts off what is being said and drops what is waiting
+func (a *Accessibility) Stop() {
+	a.queue = nil
+	if a.backend != nil {
+		a.backend.Stop()
+	}
+}
+
+// SetAnnounceFocus turns announcing the labels of focused UI buttons on or off
+func (a *Accessibility) SetAnnounceFocus(enabled bool) {
+	a.announceFocus = enabled
+}
+
+// Update announces a UI button that took focus, with the label set by UIButton.SetLabel,
+// and starts waiting speech once the voice is free
+func (a *Accessibility) Update() {
+	if !a.engine.initialized {
+		return
+	}
+
+	if C.boulder_ui_take_focus_changed() != 0 && a.announceFocus {
+		if id := C.boulder_ui_get_focused_button(); id != 0 {
+			if label := uiButtonLabel(id); label != "" {
+				if err := a.Speak(label, SpeechHigh); err != nil {
+					LogError("accessibility: " + err.Error())
+				}
+			}
+		}
+	}
+
+	if a.backend != nil && len(a.queue) > 0 && !a.backend.IsSpeaking() {
+		text := a.queue[0]
+		a.queue = a.queue[1:]
+		if err := a.backend.Speak(text, false); err != nil {
+			LogError("accessibility: " + err.Error())
+		}
+	}
+}
+
+// commandVoice speaks by running a text-to-speech program, one process per utterance,
+// with the text on standard input so it is never parsed as options
+type commandVoice struct {
+	path     string
+	args     []string
+	stopArgs []string // Run to silence speech a killed process left queued, if any
+
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	speaking bool
+}
+
+func (v *commandVoice) Speak(text string, interrupt bool) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// One process talks at a time, so a new utterance always replaces the last
+	v.stopLocked()
+
+	cmd := exec.Command(v.path, v.args...)
+	cmd.Stdin = strings.NewReader(text)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	v.cmd = cmd
+	v.speaking = true
+
+	go func() {
+		cmd.Wait()
+		v.mu.Lock()
+		if v.cmd == cmd {
+			v.cmd = nil
+			v.speaking = false
+		}
+		v.mu.Unlock()
+	}()
+	return nil
+}
+
+func (v *commandVoice) Stop() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.stopLocked()
+	return nil
+}
+
+func (v *commandVoice) stopLocked() {
+	if v.cmd != nil {
+		v.cmd.Process.Kill()
+		v.cmd = nil
+		if v.stopArgs != nil {
+			exec.Command(v.path, v.stopArgs...).Run()
+		}
+	}
+	v.speaking = false
+}
+
+func (v *commandVoice) IsSpeaking() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.speaking
+}
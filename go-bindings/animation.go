@@ -0,0 +1,191 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"unsafe"
+)
+
+// AnimationClip is an animation stored in a model file
+type AnimationClip struct {
+	Name     string
+	Duration float32 // Seconds
+}
+
+// AnimationOptions controls how PlayAnimationWith starts a clip
+type AnimationOptions struct {
+	Fade float32 // Seconds to crossfade from the current pose; 0 cuts straight to the clip
+	Once bool    // Hold the last frame instead of looping
+}
+
+// AnimationState is what an entity's model is playing
+type AnimationState struct {
+	Clip   string  // Empty in the bind pose
+	Time   float32 // Seconds into the clip
+	Speed  float32
+	Paused bool
+}
+
+// GetAnimations returns the clips of the entity's model, in file order
+func (e *Entity) GetAnimations() []AnimationClip {
+	if !e.world.ready() {
+		return nil
+	}
+
+	count := int(C.boulder_get_animation_count(C.EntityID(e.ID)))
+	clips := make([]AnimationClip, 0, max(0, count))
+	for i := 0; i < count; i++ {
+		var name [256]C.char
+		var duration C.float
+		if C.boulder_get_animation_info(C.EntityID(e.ID), C.int(i), &name[0], C.uint32_t(len(name)), &duration) != 0 {
+			continue
+		}
+		clips = append(clips, AnimationClip{Name: C.GoString(&name[0]), Duration: float32(duration)})
+	}
+	return clips
+}
+
+// GetAnimationNames returns the names of the clips PlayAnimation accepts
+func (e *Entity) GetAnimationNames() []string {
+	clips := e.GetAnimations()
+	names := make([]string, len(clips))
+	for i, clip := range clips {
+		names[i] = clip.Name
+	}
+	return names
+}
+
+// PlayAnimation loops a clip of the entity's model from its start. Skinned meshes follow
+// their bones and other meshes their nodes; poses are updated by Update for the active world.
+func (e *Entity) PlayAnimation(name string) error {
+	return e.PlayAnimationWith(name, AnimationOptions{})
+}
+
+// CrossfadeAnimation blends from the current pose into a looping clip over duration seconds,
+// e.g. from walking into running
+func (e *Entity) CrossfadeAnimation(name string, duration float32) error {
+	return e.PlayAnimationWith(name, AnimationOptions{Fade: duration})
+}
+
+// PlayAnimationWith starts a clip of the entity's model. Playing the clip that is already
+// playing restarts it.
+func (e *Entity) PlayAnimationWith(name string, options AnimationOptions) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+	if options.Fade < 0 {
+		return errors.New("fade can't be negative")
+	}
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	loop := C.int(1)
+	if options.Once {
+		loop = 0
+	}
+	if ret := C.boulder_play_animation(C.EntityID(e.ID), cName, C.float(options.Fade), loop); ret != 0 {
+		return lastError("failed to play animation " + name)
+	}
+
+	return nil
+}
+
+// StopAnimation returns the entity's model to its bind pose, fading over fade seconds
+func (e *Entity) StopAnimation(fade float32) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_stop_animation(C.EntityID(e.ID), C.float(max(0, fade))); ret != 0 {
+		return lastError("failed to stop animation")
+	}
+
+	return nil
+}
+
+// PauseAnimation holds the entity's model in its current pose, crossfades included
+func (e *Entity) PauseAnimation() error {
+	return e.setAnimationPaused(true)
+}
+
+// ResumeAnimation continues a paused animation
+func (e *Entity) ResumeAnimation() error {
+	return e.setAnimationPaused(false)
+}
+
+func (e *Entity) setAnimationPaused(paused bool) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	cPaused := C.int(0)
+	if paused {
+		cPaused = 1
+	}
+	if ret := C.boulder_set_animation_paused(C.EntityID(e.ID), cPaused); ret != 0 {
+		return lastError("failed to pause animation")
+	}
+
+	return nil
+}
+
+// SetAnimationSpeed scales how fast the entity's animations play: 1 is normal, 0.5 half
+// speed and negative values play backwards
+func (e *Entity) SetAnimationSpeed(speed float32) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_set_animation_speed(C.EntityID(e.ID), C.float(speed)); ret != 0 {
+		return lastError("failed to set animation speed")
+	}
+
+	return nil
+}
+
+// SetAnimationTime jumps to a time in seconds in the current clip, wrapped into a looping
+// clip and clamped to a clip played once
+func (e *Entity) SetAnimationTime(time float32) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_set_animation_time(C.EntityID(e.ID), C.float(time)); ret != 0 {
+		return lastError("failed to set animation time")
+	}
+
+	return nil
+}
+
+// GetAnimationState returns the clip the entity's model is playing and how far into it it is
+func (e *Entity) GetAnimationState() (AnimationState, error) {
+	defer lockThread()()
+	if !e.world.ready() {
+		return AnimationState{}, errNotInitialized
+	}
+
+	var clip, paused C.int
+	var time, speed C.float
+	if ret := C.boulder_get_animation_state(C.EntityID(e.ID), &clip, &time, &speed, &paused); ret != 0 {
+		return AnimationState{}, lastError("failed to get animation state")
+	}
+
+	state := AnimationState{Time: float32(time), Speed: float32(speed), Paused: paused != 0}
+	if clip >= 0 {
+		var name [256]C.char
+		var duration C.float
+		if C.boulder_get_animation_info(C.EntityID(e.ID), clip, &name[0], C.uint32_t(len(name)), &duration) == 0 {
+			state.Clip = C.GoString(&name[0])
+		}
+	}
+	return state, nil
+}
@@ -0,0 +1,355 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"os"
+	"sort"
+	"time"
+	"unsafe"
+)
+
+// Default streaming limits
+const (
+	DefaultStreamingBudget = 2 * time.Millisecond
+	DefaultMaxAssetReads   = 2
+)
+
+// AssetPriority orders streaming requests; higher priorities are read and uploaded first
+type AssetPriority int
+
+const (
+	AssetPriorityLow      AssetPriority = 0
+	AssetPriorityNormal   AssetPriority = 1
+	AssetPriorityHigh     AssetPriority = 2
+	AssetPriorityCritical AssetPriority = 3 // Uploaded as soon as it is read, ignoring the budget
+)
+
+// AssetState is the progress of a streaming request
+type AssetState int
+
+const (
+	AssetStateQueued    AssetState = 0 // Waiting for a read slot
+	AssetStateReading   AssetState = 1 // File being read in the background
+	AssetStateReady     AssetState = 2 // Read, waiting for upload budget
+	AssetStateLoaded    AssetState = 3
+	AssetStateFailed    AssetState = 4
+	AssetStateCancelled AssetState = 5
+)
+
+// AssetCallback is called on the goroutine running Assets.Update when a request finishes
+type AssetCallback func(request *AssetRequest)
+
+// AssetRequest is a model queued for background loading
+type AssetRequest struct {
+	Path     string
+	Entity   EntityID
+	Priority AssetPriority
+
+	state    AssetState
+	err      error
+	data     []byte
+	seq      uint64
+	callback AssetCallback
+}
+
+// GetState returns the request's progress
+func (r *AssetRequest) GetState() AssetState {
+	return r.state
+}
+
+// GetError returns why the request failed
+func (r *AssetRequest) GetError() error {
+	return r.err
+}
+
+// IsDone returns true once the request has loaded, failed or been cancelled
+func (r *AssetRequest) IsDone() bool {
+	return r.state >= AssetStateLoaded
+}
+
+// StreamingStats reports the state of the streaming queue
+type StreamingStats struct {
+	Queued         int
+	Reading        int
+	Ready          int
+	LoadedLastTick int
+	UploadTime     time.Duration // Main thread time spent uploading in the last Update
+	OverBudget     int           // Updates whose uploads exceeded the budget
+}
+
+type assetReadResult struct {
+	request *AssetRequest
+	data    []byte
+	err     error
+}
+
+// Assets streams models in the background. Files are read on worker goroutines; parsing
+// and GPU upload happen in Update, which stops once the per-frame budget is spent so
+// loading never causes frame spikes during gameplay.
+type Assets struct {
+	world    *World
+	budget   time.Duration
+	maxReads int
+
+	nextSeq uint64
+	queued  []*AssetRequest
+	ready   []*AssetRequest
+	reading int
+	results chan assetReadResult
+
+	uploadRate float64 // Estimated upload nanoseconds per byte
+	stats      StreamingStats
+}
+
+// NewAssets creates an asset streamer for a world
+func NewAssets(world *World) *Assets {
+	return &Assets{
+		world:    world,
+		budget:   DefaultStreamingBudget,
+		maxReads: DefaultMaxAssetReads,
+		results:  make(chan assetReadResult, 64),
+	}
+}
+
+// SetStreamingBudget sets how much main thread time Update may spend uploading assets each
+// frame. At least one asset is uploaded per Update so large assets cannot stall the queue.
+func (a *Assets) SetStreamingBudget(budget time.Duration) {
+	if budget < 0 {
+		budget = 0
+	}
+	a.budget = budget
+}
+
+// GetStreamingBudget returns the per-frame upload budget
+func (a *Assets) GetStreamingBudget() time.Duration {
+	return a.budget
+}
+
+// SetMaxConcurrentReads limits how many files are read in the background at once
+func (a *Assets) SetMaxConcurrentReads(reads int) {
+	if reads < 1 {
+		reads = 1
+	}
+	a.maxReads = reads
+}
+
+// LoadModel queues a model to be loaded onto an entity
+func (a *Assets) LoadModel(entity EntityID, path string, priority AssetPriority, callback AssetCallback) *AssetRequest {
+	a.nextSeq++
+	request := &AssetRequest{
+		Path:     path,
+		Entity:   entity,
+		Priority: priority,
+		seq:      a.nextSeq,
+		callback: callback,
+	}
+	a.queued = append(a.queued, request)
+	sortAssetRequests(a.queued)
+	return request
+}
+
+// SetPriority changes the priority of a request that has not been uploaded yet
+func (a *Assets) SetPriority(request *AssetRequest, priority AssetPriority) {
+	if request.IsDone() {
+		return
+	}
+	request.Priority = priority
+	sortAssetRequests(a.queued)
+	sortAssetRequests(a.ready)
+}
+
+// Cancel drops a request that has not been uploaded yet
+func (a *Assets) Cancel(request *AssetRequest) {
+	if request.IsDone() {
+		return
+	}
+
+	a.queued = removeAssetRequest(a.queued, request)
+	a.ready = removeAssetRequest(a.ready, request)
+	// A request still being read is dropped when its read completes
+	a.finish(request, AssetStateCancelled, nil)
+}
+
+// Update starts background reads and uploads finished reads within the streaming budget
+// (call this every frame)
+func (a *Assets) Update() {
+	a.collectReads()
+	a.startReads()
+	a.upload(a.budget)
+}
+
+// Flush blocks until every queued model is loaded, ignoring the budget (e.g. behind a
+// loading screen)
+func (a *Assets) Flush() {
+	for len(a.queued) > 0 || a.reading > 0 || len(a.ready) > 0 {
+		a.startReads()
+		if len(a.ready) == 0 && a.reading > 0 {
+			a.handleRead(<-a.results)
+		}
+		a.collectReads()
+		a.upload(-1)
+	}
+}
+
+// GetStats returns the current queue sizes and last frame's upload cost
+func (a *Assets) GetStats() StreamingStats {
+	stats := a.stats
+	stats.Queued = len(a.queued)
+	stats.Reading = a.reading
+	stats.Ready = len(a.ready)
+	return stats
+}
+
+// Pending returns how many requests have not finished
+func (a *Assets) Pending() int {
+	return len(a.queued) + a.reading + len(a.ready)
+}
+
+func (a *Assets) startReads() {
+	for a.reading < a.maxReads && len(a.queued) > 0 {
+		request := a.queued[0]
+		a.queued = a.queued[1:]
+
+		request.state = AssetStateReading
+		a.reading++
+		go func(request *AssetRequest) {
+			data, err := os.ReadFile(request.Path)
+			a.results <- assetReadResult{request: request, data: data, err: err}
+		}(request)
+	}
+}
+
+func (a *Assets) collectReads() {
+	for {
+		select {
+		case result := <-a.results:
+			a.handleRead(result)
+		default:
+			return
+		}
+	}
+}
+
+func (a *Assets) handleRead(result assetReadResult) {
+	a.reading--
+
+	request := result.request
+	if request.state == AssetStateCancelled {
+		return
+	}
+	if result.err != nil {
+		a.finish(request, AssetStateFailed, result.err)
+		return
+	}
+	if len(result.data) == 0 {
+		a.finish(request, AssetStateFailed, errors.New("empty asset file"))
+		return
+	}
+
+	request.data = result.data
+	request.state = AssetStateReady
+	a.ready = append(a.ready, request)
+	sortAssetRequests(a.ready)
+}
+
+// upload loads ready assets until budget is spent (a negative budget is unlimited)
+func (a *Assets) upload(budget time.Duration) {
+	start := time.Now()
+	a.stats.LoadedLastTick = 0
+
+	for len(a.ready) > 0 {
+		request := a.ready[0]
+		elapsed := time.Since(start)
+
+		if budget >= 0 && a.stats.LoadedLastTick > 0 && request.Priority < AssetPriorityCritical {
+			estimate := time.Duration(a.uploadRate * float64(len(request.data)))
+			if elapsed+estimate > budget {
+				break
+			}
+		}
+
+		a.ready = a.ready[1:]
+		uploadStart := time.Now()
+		err := a.uploadModel(request)
+		a.recordUpload(len(request.data), time.Since(uploadStart))
+
+		if err != nil {
+			a.finish(request, AssetStateFailed, err)
+		} else {
+			a.finish(request, AssetStateLoaded, nil)
+		}
+		a.stats.LoadedLastTick++
+	}
+
+	a.stats.UploadTime = time.Since(start)
+	if budget >= 0 && a.stats.UploadTime > budget {
+		a.stats.OverBudget++
+	}
+}
+
+func (a *Assets) uploadModel(request *AssetRequest) error {
+	defer lockThread()()
+	if !a.world.ready() {
+		return errNotInitialized
+	}
+	if !a.world.EntityExists(request.Entity) {
+		return errors.New("entity no longer exists")
+	}
+
+	cName := C.CString(request.Path)
+	defer C.free(unsafe.Pointer(cName))
+
+	if ret := C.boulder_load_model_from_memory(C.EntityID(request.Entity),
+		unsafe.Pointer(&request.data[0]), C.uint32_t(len(request.data)), cName); ret != 0 {
+		return lastError("failed to load model")
+	}
+
+	(&Entity{ID: request.Entity, world: a.world}).loadModelTextures()
+	return nil
+}
+
+// recordUpload updates the upload cost estimate used to decide what fits in the budget
+func (a *Assets) recordUpload(size int, took time.Duration) {
+	if size == 0 {
+		return
+	}
+
+	rate := float64(took) / float64(size)
+	if a.uploadRate == 0 {
+		a.uploadRate = rate
+	} else {
+		a.uploadRate += (rate - a.uploadRate) * 0.2
+	}
+}
+
+func (a *Assets) finish(request *AssetRequest, state AssetState, err error) {
+	request.state = state
+	request.err = err
+	request.data = nil
+	if request.callback != nil {
+		runCallback("LoadModel", func() { request.callback(request) })
+	}
+}
+
+// sortAssetRequests orders requests by priority, then by the order they were made
+func sortAssetRequests(requests []*AssetRequest) {
+	sort.SliceStable(requests, func(i, j int) bool {
+		if requests[i].Priority != requests[j].Priority {
+			return requests[i].Priority > requests[j].Priority
+		}
+		return requests[i].seq < requests[j].seq
+	})
+}
+
+func removeAssetRequest(requests []*AssetRequest, request *AssetRequest) []*AssetRequest {
+	for i, r := range requests {
+		if r == request {
+			return append(requests[:i], requests[i+1:]...)
+		}
+	}
+	return requests
+}
@@ -0,0 +1,246 @@
+package boulder
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+)
+
+// baselineChunkSize is the maximum payload carried by one baseline chunk
+const baselineChunkSize = 16 * 1024
+
+// maxBaselineSize is the largest baseline, before compression, that is sent or accepted.
+// Clients refuse bigger ones, so a small packet can't inflate into gigabytes.
+const maxBaselineSize = 64 * 1024 * 1024
+
+// baselineMinEntitySize is the fewest bytes an entity takes in a baseline: its record size
+// and a spawn message with an empty archetype and no transform
+const baselineMinEntitySize = 1 + 11
+
+// Baseline chunk header layout:
+//
+//	baseline id uint32
+//	chunk index uint16
+//	chunk count uint16
+const baselineHeaderSize = 8
+
+// SendWorldBaseline sends the full replicated world state to a connection through the
+// session's ReplicationServer
+func (ns *NetworkSession) SendWorldBaseline(conn ConnectionHandle) error {
+	if ns.handle == nil {
+		return errSessionNotInitialized
+	}
+	if ns.replication == nil {
+		return errors.New("no replication server attached to session")
+	}
+
+	return ns.replication.SendWorldBaseline(conn)
+}
+
+// SendWorldBaseline serializes every replicated entity, compresses the result, and sends
+// it to a connection in reliable chunks. The connection only receives delta updates once
+// the client acknowledges the baseline (see IsBaselineAcked). Newly connected clients are
+// sent a baseline automatically.
+func (rs *ReplicationServer) SendWorldBaseline(conn ConnectionHandle) error {
+	rc, ok := rs.connections[conn]
+	if !ok {
+		rc = &replicationConnection{}
+		rs.connections[conn] = rc
+	}
+
+	var compressed bytes.Buffer
+	writer, err := flate.NewWriter(&compressed, flate.BestSpeed)
+	if err != nil {
+		return err
+	}
+
+	var header [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(header[:], uint64(len(rs.order)))
+	writer.Write(header[:n])
+	size := n
+	for _, entity := range rs.order {
+		record := encodeSpawn(entity, rs.archetypes[entity], rs.world)
+		n := binary.PutUvarint(header[:], uint64(len(record)))
+		writer.Write(header[:n])
+		writer.Write(record)
+		size += n + len(record)
+	}
+	if size > maxBaselineSize {
+		return errors.New("world baseline too large")
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	data := compressed.Bytes()
+	chunkCount := (len(data) + baselineChunkSize - 1) / baselineChunkSize
+	if chunkCount == 0 {
+		chunkCount = 1
+	}
+	if chunkCount > math.MaxUint16 {
+		return errors.New("world baseline too large")
+	}
+
+	rs.nextBaseline++
+	rc.baselineID = rs.nextBaseline
+	rc.baselineAcked = false
+
+	for i := 0; i < chunkCount; i++ {
+		start := i * baselineChunkSize
+		end := start + baselineChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		payload := make([]byte, 0, baselineHeaderSize+end-start)
+		payload = binary.LittleEndian.AppendUint32(payload, rc.baselineID)
+		payload = binary.LittleEndian.AppendUint16(payload, uint16(i))
+		payload = binary.LittleEndian.AppendUint16(payload, uint16(chunkCount))
+		payload = append(payload, data[start:end]...)
+
+		if err := rs.session.sendControl(conn, controlBaselineChunk, payload, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rs *ReplicationServer) handleBaselineAck(conn ConnectionHandle, payload []byte, timestamp float64) {
+	if len(payload) < 4 {
+		return
+	}
+
+	rc, ok := rs.connections[conn]
+	if !ok {
+		return
+	}
+	if binary.LittleEndian.Uint32(payload) == rc.baselineID {
+		rc.baselineAcked = true
+	}
+}
+
+// baselineAssembly collects the chunks of a baseline on the client
+type baselineAssembly struct {
+	id       uint32
+	chunks   [][]byte
+	received int
+}
+
+// BaselineCallback is called when a world baseline from the server has been applied
+type BaselineCallback func(conn ConnectionHandle, entityCount int)
+
+// OnBaselineComplete sets the function called after a world baseline has been applied
+func (rc *ReplicationClient) OnBaselineComplete(callback BaselineCallback) {
+	rc.onBaseline = callback
+}
+
+// IsBaselineComplete reports whether the world baseline from a connection has been applied
+func (rc *ReplicationClient) IsBaselineComplete(conn ConnectionHandle) bool {
+	return rc.baselineDone[conn]
+}
+
+func (rc *ReplicationClient) handleBaselineChunk(conn ConnectionHandle, payload []byte, timestamp float64) {
+	if len(payload) < baselineHeaderSize {
+		return
+	}
+
+	id := binary.LittleEndian.Uint32(payload)
+	index := int(binary.LittleEndian.Uint16(payload[4:]))
+	count := int(binary.LittleEndian.Uint16(payload[6:]))
+	if count == 0 || index >= count || len(payload)-baselineHeaderSize > baselineChunkSize {
+		return
+	}
+
+	assembly, ok := rc.baselines[conn]
+	if !ok || assembly.id != id {
+		// A newer baseline supersedes any partially received one
+		assembly = &baselineAssembly{id: id, chunks: make([][]byte, count)}
+		rc.baselines[conn] = assembly
+		rc.baselineDone[conn] = false
+	}
+	if len(assembly.chunks) != count || assembly.chunks[index] != nil {
+		return
+	}
+
+	assembly.chunks[index] = append([]byte(nil), payload[baselineHeaderSize:]...)
+	assembly.received++
+	if assembly.received < count {
+		return
+	}
+
+	delete(rc.baselines, conn)
+	entityCount, err := rc.applyBaseline(conn, bytes.Join(assembly.chunks, nil))
+	if err != nil {
+		LogError("Replication: invalid world baseline: " + err.Error())
+		return
+	}
+
+	rc.baselineDone[conn] = true
+	ack := binary.LittleEndian.AppendUint32(nil, id)
+	rc.session.sendControl(conn, controlBaselineAck, ack, true)
+
+	if rc.onBaseline != nil {
+		runCallback("OnBaselineComplete", func() { rc.onBaseline(conn, entityCount) })
+	}
+}
+
+// applyBaseline spawns every entity in a baseline and despawns stale proxies that the
+// server no longer has
+func (rc *ReplicationClient) applyBaseline(conn ConnectionHandle, data []byte) (int, error) {
+	reader := flate.NewReader(bytes.NewReader(data))
+	defer reader.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(reader, maxBaselineSize+1))
+	if err != nil {
+		return 0, err
+	}
+	if len(raw) > maxBaselineSize {
+		return 0, errors.New("baseline larger than " + strconv.Itoa(maxBaselineSize) + " bytes")
+	}
+
+	entityCount, n := binary.Uvarint(raw)
+	if n <= 0 {
+		return 0, errors.New("truncated baseline")
+	}
+	offset := n
+	if entityCount > uint64((len(raw)-offset)/baselineMinEntitySize) {
+		return 0, errors.New("truncated baseline")
+	}
+
+	messages := make([]spawnMessage, 0, entityCount)
+	for i := uint64(0); i < entityCount; i++ {
+		size, n := binary.Uvarint(raw[offset:])
+		if n <= 0 || uint64(len(raw)-offset-n) < size {
+			return 0, errors.New("truncated baseline")
+		}
+		offset += n
+
+		msg, err := decodeSpawn(raw[offset : offset+int(size)])
+		if err != nil {
+			return 0, err
+		}
+		offset += int(size)
+		messages = append(messages, msg)
+	}
+
+	present := make(map[EntityID]struct{}, len(messages))
+	for _, msg := range messages {
+		present[msg.entity] = struct{}{}
+	}
+	for serverEntity, proxy := range rc.proxies {
+		if _, ok := present[serverEntity]; !ok && proxy.conn == conn {
+			rc.despawn(serverEntity)
+		}
+	}
+
+	for _, msg := range messages {
+		rc.applySpawn(conn, msg)
+	}
+
+	return len(messages), nil
+}
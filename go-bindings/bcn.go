@@ -0,0 +1,229 @@
+package boulder
+
+import (
+	"encoding/binary"
+)
+
+// Block compression encoders. Each takes the 16 RGBA pixels of a 4x4 block in row order
+// and appends the encoded block. They use fast bounding-box endpoint selection, which is
+// good enough for a load-time or cook-time encoder; quality can be raised later without
+// changing the file format.
+
+// blockPixels is a 4x4 block of RGBA pixels in row order
+type blockPixels [16][4]uint8
+
+// encodeBC1Block appends an 8 byte BC1 block (RGB, alpha ignored)
+func encodeBC1Block(dst []byte, block *blockPixels) []byte {
+	var lo, hi [3]uint8
+	lo, hi = [3]uint8{255, 255, 255}, [3]uint8{0, 0, 0}
+	for _, p := range block {
+		for c := 0; c < 3; c++ {
+			lo[c] = min(lo[c], p[c])
+			hi[c] = max(hi[c], p[c])
+		}
+	}
+
+	c0, c1 := packRGB565(hi), packRGB565(lo)
+	var indices uint32
+	if c0 < c1 {
+		c0, c1 = c1, c0
+	}
+	if c0 != c1 {
+		e0, e1 := unpackRGB565(c0), unpackRGB565(c1)
+		var palette [4][3]int
+		for c := 0; c < 3; c++ {
+			palette[0][c] = e0[c]
+			palette[1][c] = e1[c]
+			palette[2][c] = (2*e0[c] + e1[c]) / 3
+			palette[3][c] = (e0[c] + 2*e1[c]) / 3
+		}
+
+		for i, p := range block {
+			best, bestErr := 0, 1<<30
+			for j := range palette {
+				err := 0
+				for c := 0; c < 3; c++ {
+					d := int(p[c]) - palette[j][c]
+					err += d * d
+				}
+				if err < bestErr {
+					best, bestErr = j, err
+				}
+			}
+			indices |= uint32(best) << (2 * i)
+		}
+	}
+
+	dst = binary.LittleEndian.AppendUint16(dst, c0)
+	dst = binary.LittleEndian.AppendUint16(dst, c1)
+	return binary.LittleEndian.AppendUint32(dst, indices)
+}
+
+// encodeBC4Block appends an 8 byte BC4 block for one channel of the pixels
+func encodeBC4Block(dst []byte, block *blockPixels, channel int) []byte {
+	lo, hi := uint8(255), uint8(0)
+	for _, p := range block {
+		lo = min(lo, p[channel])
+		hi = max(hi, p[channel])
+	}
+
+	var indices uint64
+	if hi != lo {
+		// hi > lo selects the eight value mode
+		var palette [8]int
+		palette[0], palette[1] = int(hi), int(lo)
+		for i := 1; i < 7; i++ {
+			palette[i+1] = ((7-i)*int(hi) + i*int(lo)) / 7
+		}
+
+		for i, p := range block {
+			best, bestErr := 0, 1<<30
+			for j, v := range palette {
+				d := int(p[channel]) - v
+				if d*d < bestErr {
+					best, bestErr = j, d*d
+				}
+			}
+			indices |= uint64(best) << (3 * i)
+		}
+	}
+
+	dst = append(dst, hi, lo)
+	for i := 0; i < 6; i++ {
+		dst = append(dst, byte(indices>>(8*i)))
+	}
+	return dst
+}
+
+// encodeBC3Block appends a 16 byte BC3 block (BC4 alpha followed by BC1 color)
+func encodeBC3Block(dst []byte, block *blockPixels) []byte {
+	dst = encodeBC4Block(dst, block, 3)
+	return encodeBC1Block(dst, block)
+}
+
+// encodeBC5Block appends a 16 byte BC5 block (red and green as two BC4 blocks)
+func encodeBC5Block(dst []byte, block *blockPixels) []byte {
+	dst = encodeBC4Block(dst, block, 0)
+	return encodeBC4Block(dst, block, 1)
+}
+
+// bc7Weights4 are the BC7 interpolation weights for 4 bit indices
+var bc7Weights4 = [16]int{0, 4, 9, 13, 17, 21, 26, 30, 34, 38, 43, 47, 51, 55, 60, 64}
+
+// encodeBC7Block appends a 16 byte BC7 block using mode 6 (one subset, RGBA endpoints
+// with per-endpoint p-bits and 4 bit indices)
+func encodeBC7Block(dst []byte, block *blockPixels) []byte {
+	var lo, hi [4]uint8
+	lo, hi = [4]uint8{255, 255, 255, 255}, [4]uint8{}
+	for _, p := range block {
+		for c := 0; c < 4; c++ {
+			lo[c] = min(lo[c], p[c])
+			hi[c] = max(hi[c], p[c])
+		}
+	}
+
+	q0, p0 := quantizeBC7Endpoint(lo)
+	q1, p1 := quantizeBC7Endpoint(hi)
+
+	var e0, e1 [4]int
+	for c := 0; c < 4; c++ {
+		e0[c] = int(q0[c])<<1 | int(p0)
+		e1[c] = int(q1[c])<<1 | int(p1)
+	}
+
+	var palette [16][4]int
+	for i, w := range bc7Weights4 {
+		for c := 0; c < 4; c++ {
+			palette[i][c] = ((64-w)*e0[c] + w*e1[c] + 32) >> 6
+		}
+	}
+
+	var indices [16]int
+	for i, p := range block {
+		best, bestErr := 0, 1<<30
+		for j := range palette {
+			err := 0
+			for c := 0; c < 4; c++ {
+				d := int(p[c]) - palette[j][c]
+				err += d * d
+			}
+			if err < bestErr {
+				best, bestErr = j, err
+			}
+		}
+		indices[i] = best
+	}
+
+	// The first index is stored with its top bit implied zero; swap endpoints if needed
+	if indices[0] >= 8 {
+		q0, q1 = q1, q0
+		p0, p1 = p1, p0
+		for i := range indices {
+			indices[i] = 15 - indices[i]
+		}
+	}
+
+	var w bitWriter
+	w.write(1<<6, 7) // Mode 6
+	for c := 0; c < 4; c++ {
+		w.write(uint64(q0[c]), 7)
+		w.write(uint64(q1[c]), 7)
+	}
+	w.write(uint64(p0), 1)
+	w.write(uint64(p1), 1)
+	w.write(uint64(indices[0]), 3)
+	for i := 1; i < 16; i++ {
+		w.write(uint64(indices[i]), 4)
+	}
+
+	dst = binary.LittleEndian.AppendUint64(dst, w.lo)
+	return binary.LittleEndian.AppendUint64(dst, w.hi)
+}
+
+// quantizeBC7Endpoint picks the 7 bit color and shared p-bit closest to an RGBA endpoint
+func quantizeBC7Endpoint(e [4]uint8) ([4]uint8, uint8) {
+	var best [4]uint8
+	bestP, bestErr := uint8(0), 1<<30
+	for p := 0; p < 2; p++ {
+		var q [4]uint8
+		err := 0
+		for c := 0; c < 4; c++ {
+			v := (int(e[c]) - p + 1) >> 1
+			v = max(0, min(127, v))
+			q[c] = uint8(v)
+			d := int(e[c]) - (v<<1 | p)
+			err += d * d
+		}
+		if err < bestErr {
+			best, bestP, bestErr = q, uint8(p), err
+		}
+	}
+	return best, bestP
+}
+
+func packRGB565(c [3]uint8) uint16 {
+	return uint16(c[0]>>3)<<11 | uint16(c[1]>>2)<<5 | uint16(c[2]>>3)
+}
+
+func unpackRGB565(v uint16) [3]int {
+	r, g, b := int(v>>11)&31, int(v>>5)&63, int(v)&31
+	return [3]int{r<<3 | r>>2, g<<2 | g>>4, b<<3 | b>>2}
+}
+
+// bitWriter packs fields least significant bit first into 128 bits
+type bitWriter struct {
+	lo, hi uint64
+	pos    uint
+}
+
+func (w *bitWriter) write(value uint64, bits uint) {
+	for i := uint(0); i < bits; i++ {
+		bit := (value >> i) & 1
+		if w.pos < 64 {
+			w.lo |= bit << w.pos
+		} else {
+			w.hi |= bit << (w.pos - 64)
+		}
+		w.pos++
+	}
+}
@@ -0,0 +1,398 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Frames from the start of a benchmark that are not measured, while caches and the
+// swapchain settle
+const benchmarkWarmUp = time.Second
+
+// Upper edges of the frame time histogram buckets, at common refresh rates from 240 Hz
+// down to 10 Hz. The last bucket holds everything slower.
+var benchmarkBuckets = []time.Duration{
+	4167 * time.Microsecond,
+	8333 * time.Microsecond,
+	11111 * time.Microsecond,
+	16667 * time.Microsecond,
+	20000 * time.Microsecond,
+	33333 * time.Microsecond,
+	50000 * time.Microsecond,
+	100000 * time.Microsecond,
+}
+
+// Native subsystems in SubsystemTimes, in report order
+var benchmarkSubsystems = []string{"physics", "collisions", "buoyancy", "soft_bodies", "models", "ui", "submit", "gpu_wait"}
+
+// BenchmarkReport is the result of RunBenchmark
+type BenchmarkReport struct {
+	Scene    string        `json:"scene"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration_ns"` // Measured, after the warm-up
+	Frames   int           `json:"frames"`
+
+	AverageFPS       float64       `json:"average_fps"`
+	Low1PercentFPS   float64       `json:"low_1_percent_fps"`   // Average of the slowest 1% of frames
+	Low01PercentFPS  float64       `json:"low_0_1_percent_fps"` // Average of the slowest 0.1% of frames
+	AverageFrameTime time.Duration `json:"average_frame_time_ns"`
+	MinFrameTime     time.Duration `json:"min_frame_time_ns"`
+	MaxFrameTime     time.Duration `json:"max_frame_time_ns"`
+
+	Histogram  []BenchmarkBucket    `json:"histogram"`
+	Subsystems []BenchmarkSubsystem `json:"subsystems"`
+	Hardware   BenchmarkHardware    `json:"hardware"`
+
+	FrameTimes []time.Duration `json:"frame_times_ns"` // Every measured frame, in order
+}
+
+// BenchmarkBucket counts the frames that took up to Max (and more than the previous
+// bucket's Max). The last bucket has no Max.
+type BenchmarkBucket struct {
+	Max    time.Duration `json:"max_ns"`
+	Frames int           `json:"frames"`
+}
+
+// BenchmarkSubsystem is where frame time went: "update" is all of Engine.Update, "gpu"
+// the GPU's own time from timestamps, and the rest the engine's native subsystems
+type BenchmarkSubsystem struct {
+	Name    string        `json:"name"`
+	Average time.Duration `json:"average_ns"`
+	Max     time.Duration `json:"max_ns"`
+}
+
+// BenchmarkHardware describes the machine a benchmark ran on
+type BenchmarkHardware struct {
+	GPU         GPUInfo     `json:"gpu"`
+	OS          string      `json:"os"`
+	Arch        string      `json:"arch"`
+	CPUs        int         `json:"cpus"`
+	GoVersion   string      `json:"go_version"`
+	Width       int         `json:"width"` // Swapchain size
+	Height      int         `json:"height"`
+	PresentMode PresentMode `json:"present_mode"`
+	RefreshRate float32     `json:"refresh_rate"`
+}
+
+// RunBenchmark loads a scene file (or, with an empty path, keeps the world as it is),
+// renders it as fast as the present mode allows and measures duration of frames after a
+// one second warm-up. Each frame polls events, runs Update and draws the models and UI, so
+// set up the camera and anything that moves first; PresentImmediate measures more than
+// the refresh rate. The window must have been created. Closing it ends the benchmark with
+// an error.
+func (e *Engine) RunBenchmark(scene string, duration time.Duration) (*BenchmarkReport, error) {
+	if !e.initialized {
+		return nil, errNotInitialized
+	}
+	if duration <= 0 {
+		return nil, errors.New("benchmark duration must be positive")
+	}
+
+	if scene != "" {
+		if err := e.loadBenchmarkScene(scene); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &BenchmarkReport{Scene: scene}
+	names := append([]string{"update", "gpu"}, benchmarkSubsystems...)
+	totals := make([]time.Duration, len(names))
+	maxes := make([]time.Duration, len(names))
+
+	start := time.Now()
+	var deltaTime time.Duration
+	for {
+		frameStart := time.Now()
+		updateTime, err := e.benchmarkFrame(float32(deltaTime.Seconds()))
+		if err != nil {
+			return nil, err
+		}
+		deltaTime = time.Since(frameStart)
+
+		if frameStart.Sub(start) < benchmarkWarmUp {
+			continue
+		}
+		if report.Frames == 0 {
+			report.Started = frameStart
+		}
+
+		report.Frames++
+		report.FrameTimes = append(report.FrameTimes, deltaTime)
+		for i, t := range benchmarkSubsystemTimes(updateTime) {
+			totals[i] += t
+			maxes[i] = max(maxes[i], t)
+		}
+		if time.Since(report.Started) >= duration {
+			break
+		}
+	}
+	report.Duration = time.Since(report.Started)
+
+	report.summarize()
+	for i, name := range names {
+		report.Subsystems = append(report.Subsystems, BenchmarkSubsystem{
+			Name:    name,
+			Average: totals[i] / time.Duration(report.Frames),
+			Max:     maxes[i],
+		})
+	}
+	report.Hardware = e.benchmarkHardware()
+	return report, nil
+}
+
+// loadBenchmarkScene loads a scene behind no loading screen, presenting frames as it goes
+func (e *Engine) loadBenchmarkScene(path string) error {
+	config := LoadScreenConfig{StreamingBudget: 50 * time.Millisecond, Priority: AssetPriorityHigh}
+	load, err := e.LoadSceneAsync(path, config)
+	if err != nil {
+		return err
+	}
+
+	last := time.Now()
+	for !load.IsDone() {
+		deltaTime := time.Since(last)
+		last = time.Now()
+		if _, err := e.benchmarkFrame(float32(deltaTime.Seconds())); err != nil {
+			load.Cancel()
+			return err
+		}
+	}
+	return load.GetError()
+}
+
+// benchmarkFrame runs one frame and returns how long Update took
+func (e *Engine) benchmarkFrame(deltaTime float32) (time.Duration, error) {
+	defer lockThread()()
+	C.boulder_poll_events()
+	e.dispatchAppEvents()
+	e.dispatchLayoutChanged()
+	if C.boulder_should_close() != 0 {
+		return 0, errors.New("window closed during benchmark")
+	}
+
+	start := time.Now()
+	if err := e.Update(deltaTime); err != nil {
+		return 0, err
+	}
+	updateTime := time.Since(start)
+
+	var imageIndex C.uint32_t
+	switch C.boulder_begin_frame(&imageIndex) {
+	case 0:
+	case -2:
+		if C.boulder_recreate_swapchain() != 0 {
+			return 0, lastError("failed to recreate swapchain")
+		}
+		return updateTime, nil
+	case -3:
+		return 0, errors.New("app paused during benchmark")
+	default:
+		return 0, lastError("failed to begin frame (was the window created?)")
+	}
+
+	C.boulder_render_models()
+	C.boulder_ui_render(imageIndex)
+	if C.boulder_end_frame(imageIndex) != 0 {
+		return 0, lastError("failed to end frame")
+	}
+	return updateTime, nil
+}
+
+// benchmarkSubsystemTimes returns the last frame's times in report order
+func benchmarkSubsystemTimes(updateTime time.Duration) []time.Duration {
+	var t C.SubsystemTimes
+	C.boulder_get_subsystem_times(&t)
+	var frame C.FrameTimes
+	C.boulder_get_frame_times(&frame)
+
+	ms := func(v C.float) time.Duration { return time.Duration(float64(v) * float64(time.Millisecond)) }
+	return []time.Duration{
+		updateTime,
+		time.Duration(float64(frame.gpuMs) * float64(time.Millisecond)),
+		ms(t.physicsMs), ms(t.collisionsMs), ms(t.buoyancyMs), ms(t.softBodiesMs),
+		ms(t.modelsMs), ms(t.uiMs), ms(t.submitMs), ms(t.waitMs),
+	}
+}
+
+// summarize works out the frame rate figures and histogram from the frame times
+func (r *BenchmarkReport) summarize() {
+	var total time.Duration
+	for _, t := range r.FrameTimes {
+		total += t
+	}
+	r.AverageFrameTime = total / time.Duration(len(r.FrameTimes))
+	r.AverageFPS = fps(r.AverageFrameTime)
+
+	sorted := slices.Clone(r.FrameTimes)
+	slices.Sort(sorted)
+	r.MinFrameTime = sorted[0]
+	r.MaxFrameTime = sorted[len(sorted)-1]
+	r.Low1PercentFPS = fps(slowestAverage(sorted, 0.01))
+	r.Low01PercentFPS = fps(slowestAverage(sorted, 0.001))
+
+	r.Histogram = make([]BenchmarkBucket, len(benchmarkBuckets)+1)
+	for i, edge := range benchmarkBuckets {
+		r.Histogram[i].Max = edge
+	}
+	for _, t := range sorted {
+		bucket, _ := slices.BinarySearch(benchmarkBuckets, t)
+		r.Histogram[bucket].Frames++
+	}
+}
+
+// slowestAverage returns the average of the slowest fraction of sorted frame times, at
+// least one frame
+func slowestAverage(sorted []time.Duration, fraction float64) time.Duration {
+	count := max(int(float64(len(sorted))*fraction), 1)
+	var total time.Duration
+	for _, t := range sorted[len(sorted)-count:] {
+		total += t
+	}
+	return total / time.Duration(count)
+}
+
+func fps(frameTime time.Duration) float64 {
+	if frameTime <= 0 {
+		return 0
+	}
+	return float64(time.Second) / float64(frameTime)
+}
+
+func (e *Engine) benchmarkHardware() BenchmarkHardware {
+	hardware := BenchmarkHardware{
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+		GoVersion: runtime.Version(),
+	}
+
+	var width, height C.int
+	C.boulder_get_swapchain_extent(&width, &height)
+	hardware.Width, hardware.Height = int(width), int(height)
+
+	var stats C.PresentStats
+	C.boulder_get_present_stats(&stats)
+	hardware.PresentMode = PresentMode(stats.presentMode)
+	hardware.RefreshRate = float32(stats.refreshRate)
+
+	if gpus, err := EnumerateGPUs(); err == nil {
+		selected := e.GetSelectedGPU()
+		for _, gpu := range gpus {
+			if gpu.Index == selected {
+				hardware.GPU = gpu
+			}
+		}
+	}
+	return hardware
+}
+
+// WriteJSON writes the whole report, frame times included, as indented JSON
+func (r *BenchmarkReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// SaveJSON writes the report to a JSON file
+func (r *BenchmarkReport) SaveJSON(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.WriteJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteCSV writes the report as one CSV row of summary columns (times in milliseconds),
+// after a header row when header is true. Rows from runs on different machines line up,
+// so a hardware matrix can be collected into one file.
+func (r *BenchmarkReport) WriteCSV(w io.Writer, header bool) error {
+	writer := csv.NewWriter(w)
+	if header {
+		writer.Write(r.csvHeader())
+	}
+	writer.Write(r.csvRow())
+	writer.Flush()
+	return writer.Error()
+}
+
+// AppendCSV adds the report's row to a CSV file, creating it with a header row if needed
+func (r *BenchmarkReport) AppendCSV(path string) error {
+	info, err := os.Stat(path)
+	header := err != nil || info.Size() == 0
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := r.WriteCSV(f, header); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteFrameCSV writes every measured frame time in milliseconds, one row per frame
+func (r *BenchmarkReport) WriteFrameCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"frame", "frame_ms"})
+	for i, t := range r.FrameTimes {
+		writer.Write([]string{strconv.Itoa(i), formatMs(t)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (r *BenchmarkReport) csvHeader() []string {
+	columns := []string{"scene", "started", "gpu", "os", "arch", "cpus", "width", "height", "present_mode",
+		"frames", "average_fps", "low_1_percent_fps", "low_0_1_percent_fps",
+		"average_ms", "min_ms", "max_ms"}
+	for _, s := range r.Subsystems {
+		columns = append(columns, s.Name+"_ms")
+	}
+	for i, b := range r.Histogram {
+		if i == len(r.Histogram)-1 {
+			columns = append(columns, "frames_over_"+formatMs(r.Histogram[i-1].Max)+"ms")
+		} else {
+			columns = append(columns, "frames_up_to_"+formatMs(b.Max)+"ms")
+		}
+	}
+	return columns
+}
+
+func (r *BenchmarkReport) csvRow() []string {
+	h := r.Hardware
+	row := []string{r.Scene, r.Started.Format(time.RFC3339), h.GPU.Name, h.OS, h.Arch, strconv.Itoa(h.CPUs),
+		strconv.Itoa(h.Width), strconv.Itoa(h.Height), strconv.Itoa(int(h.PresentMode)),
+		strconv.Itoa(r.Frames), formatFloat(r.AverageFPS), formatFloat(r.Low1PercentFPS), formatFloat(r.Low01PercentFPS),
+		formatMs(r.AverageFrameTime), formatMs(r.MinFrameTime), formatMs(r.MaxFrameTime)}
+	for _, s := range r.Subsystems {
+		row = append(row, formatMs(s.Average))
+	}
+	for _, b := range r.Histogram {
+		row = append(row, strconv.Itoa(b.Frames))
+	}
+	return row
+}
+
+func formatMs(d time.Duration) string {
+	return formatFloat(float64(d) / float64(time.Millisecond))
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
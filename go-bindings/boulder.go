@@ -1,7 +1,6 @@
 package boulder
 
 // #cgo CFLAGS: -I..
-// #cgo LDFLAGS: -L../build -lboulder_shared -Wl,-rpath,${SRCDIR}/../build
 // #include <stdlib.h>
 // #include "../boulder_cgo.h"
 import "C"
@@ -15,23 +14,64 @@ type Vector3 struct {
 	X, Y, Z float32
 }
 
+// EngineConfig holds settings applied when the engine creates its GPU device
+type EngineConfig struct {
+	GPU           int           // Index from EnumerateGPUs to pin, or -1 to pick by GPUPreference
+	GPUPreference GPUPreference // Used when GPU is -1 or not present
+}
+
+// DefaultEngineConfig returns a config that uses the first supported GPU
+func DefaultEngineConfig() EngineConfig {
+	return EngineConfig{
+		GPU:           -1,
+		GPUPreference: GPUPreferenceDefault,
+	}
+}
+
 // Engine represents the Boulder game engine core
 type Engine struct {
 	appName     string
 	version     uint32
+	config      EngineConfig
 	initialized bool
+	boundWorld  C.WorldID // World native entity calls act on
+	activeWorld *World
+
+	readyCallbacks  map[PipelineID][]func(ready bool) // Run by Update once a pipeline compiled
+	appCallbacks    []func(event AppEvent)            // Run by Window.PollEvents
+	layoutCallbacks []func()                          // Run by Window.PollEvents
+	windowCallbacks []func(event WindowEvent)         // Run by Window.PollEvents
+	tweens          []*Tween                          // Advanced by Update
+	sceneLoad       *SceneLoad                        // Advanced by Update
+	scene           *Scene
+	sceneCallbacks  []func(scene *Scene, err error)
+	persistent      []*Entity           // Survive scene loads and world switches
+	modelTextures   map[string]*Texture // Textures of model files, by path
+	cvars           map[string]*cvarEntry
+	commands        map[string]*consoleCommand
+	perfHUD         *perfHUD // Built-in performance overlay
+
+	live    map[dependent]liveObject // Destroyed by Shutdown if still alive
+	liveSeq uint64
 }
 
 // NewEngine creates a new Engine instance
 func NewEngine(appName string, ver uint32) *Engine {
+	return NewEngineWithConfig(appName, ver, DefaultEngineConfig())
+}
+
+// NewEngineWithConfig creates a new Engine instance with the given config
+func NewEngineWithConfig(appName string, ver uint32, config EngineConfig) *Engine {
 	return &Engine{
 		appName: appName,
 		version: ver,
+		config:  config,
 	}
 }
 
 // Init initializes the Boulder engine
 func (e *Engine) Init() error {
+	defer lockThread()()
 	if e.initialized {
 		return errors.New("engine already initialized")
 	}
@@ -40,23 +80,61 @@ func (e *Engine) Init() error {
 	defer C.free(unsafe.Pointer(cAppName))
 
 	if ret := C.boulder_init(cAppName, C.uint(e.version)); ret != 0 {
-		return errors.New("failed to initialize engine")
+		return lastError("failed to initialize engine")
 	}
+	C.boulder_set_gpu(C.int(e.config.GPU), C.int(e.config.GPUPreference))
 
 	e.initialized = true
+	e.boundWorld = defaultWorldID
 	return nil
 }
 
-// Shutdown shuts down the engine and releases resources
+// Shutdown shuts down the engine and releases resources. Network sessions, pipelines,
+// shaders and textures that are still alive are destroyed first, in that order; their
+// wrappers, like every other wrapper, become no-ops afterwards.
 func (e *Engine) Shutdown() {
 	if !e.initialized {
 		return
 	}
 
+	e.destroyLiveObjects()
+	if e.perfHUD != nil {
+		e.ShowPerfHUD(false)
+	}
+	e.readyCallbacks = nil
+	e.tweens = nil
+	e.sceneLoad = nil
+	e.scene = nil
+	e.persistent = nil
+	e.boundWorld = 0
+	e.activeWorld = nil
+
 	C.boulder_shutdown()
 	e.initialized = false
 }
 
+// Restart tears down and recreates the Vulkan instance, device and window (if one was
+// created) without relaunching, e.g. to apply GPU or driver-level settings. Entities and
+// their components survive and loaded models are uploaded to the new device, but shaders,
+// pipelines and UI buttons belong to the old device and must be created again.
+func (e *Engine) Restart() error {
+	defer lockThread()()
+	if !e.initialized {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_restart(); ret != 0 {
+		return lastError("failed to restart engine")
+	}
+
+	e.untrackStage(stagePipelines)
+	e.untrackStage(stageShaders)
+	if e.perfHUD != nil {
+		e.perfHUD.forget(e)
+	}
+	return nil
+}
+
 // IsInitialized returns whether the engine is initialized
 func (e *Engine) IsInitialized() bool {
 	return e.initialized
@@ -72,27 +150,38 @@ func (e *Engine) GetVersion() uint32 {
 	return e.version
 }
 
+// GetConfig returns the engine config
+func (e *Engine) GetConfig() EngineConfig {
+	return e.config
+}
+
 // Update updates the engine with the given delta time
 func (e *Engine) Update(deltaTime float32) error {
+	defer lockThread()()
 	if !e.initialized {
-		return errors.New("engine not initialized")
+		return errNotInitialized
 	}
 
 	if ret := C.boulder_update(C.float(deltaTime)); ret != 0 {
-		return errors.New("failed to update engine")
+		return lastError("failed to update engine")
 	}
 
+	e.runReadyCallbacks()
+	e.updateTweens(deltaTime)
+	e.updateSceneLoad(deltaTime)
+	e.updatePerfHUD(deltaTime)
 	return nil
 }
 
 // Render renders the current frame (legacy function, prefer using Renderer)
 func (e *Engine) Render() error {
+	defer lockThread()()
 	if !e.initialized {
-		return errors.New("engine not initialized")
+		return errNotInitialized
 	}
 
 	if ret := C.boulder_render(); ret != 0 {
-		return errors.New("failed to render frame")
+		return lastError("failed to render frame")
 	}
 
 	return nil
@@ -139,12 +228,14 @@ var (
 type UIButton struct {
 	id            C.UIButtonID
 	clickedThisFrame bool
+	text          string
 }
 
 // UIInitialize initializes the UI system
 func UIInitialize() error {
+	defer lockThread()()
 	if ret := C.boulder_ui_init(); ret != 0 {
-		return errors.New("failed to initialize UI system")
+		return lastError("failed to initialize UI system")
 	}
 	return nil
 }
@@ -174,6 +265,7 @@ func CreateUIButton(x, y, width, height float32, normalColor, hoverColor, presse
 func (b *UIButton) Destroy() {
 	if b.id != 0 {
 		C.boulder_ui_destroy_button(b.id)
+		delete(uiTooltips, b.id)
 		b.id = 0
 	}
 }
@@ -205,6 +297,17 @@ func (b *UIButton) SetEnabled(enabled bool) {
 	}
 }
 
+// SetColors changes the button's normal, hover and pressed colors
+func (b *UIButton) SetColors(normalColor, hoverColor, pressedColor UIColor) {
+	if b.id != 0 {
+		C.boulder_ui_set_button_colors(b.id,
+			C.float(normalColor.R), C.float(normalColor.G), C.float(normalColor.B), C.float(normalColor.A),
+			C.float(hoverColor.R), C.float(hoverColor.G), C.float(hoverColor.B), C.float(hoverColor.A),
+			C.float(pressedColor.R), C.float(pressedColor.G), C.float(pressedColor.B), C.float(pressedColor.A),
+		)
+	}
+}
+
 // WasClicked returns true if the button was clicked since the last reset
 func (b *UIButton) WasClicked() bool {
 	if b.id == 0 {
@@ -220,6 +323,93 @@ func (b *UIButton) ResetClick() {
 	}
 }
 
+// SetOpacity fades the whole button, from 0 (invisible) to 1, keeping its colors' alpha
+func (b *UIButton) SetOpacity(opacity float32) {
+	if b.id != 0 {
+		C.boulder_ui_set_button_opacity(b.id, C.float(opacity))
+	}
+}
+
+// SetVisible shows or hides the button; hidden buttons cannot be clicked or focused
+func (b *UIButton) SetVisible(visible bool) {
+	if b.id != 0 {
+		cVisible := C.int(0)
+		if visible {
+			cVisible = 1
+		}
+		C.boulder_ui_set_button_visible(b.id, cVisible)
+	}
+}
+
+// IsVisible returns whether the button is shown
+func (b *UIButton) IsVisible() bool {
+	info, ok := b.info()
+	return ok && info.visible != 0
+}
+
+// GetPosition returns the button's position
+func (b *UIButton) GetPosition() (x, y float32) {
+	info, _ := b.info()
+	return float32(info.x), float32(info.y)
+}
+
+// GetSize returns the button's size
+func (b *UIButton) GetSize() (width, height float32) {
+	info, _ := b.info()
+	return float32(info.width), float32(info.height)
+}
+
+// GetColors returns the button's normal, hover and pressed colors
+func (b *UIButton) GetColors() (normalColor, hoverColor, pressedColor UIColor) {
+	info, _ := b.info()
+	return uiColorFrom(info.normalColor), uiColorFrom(info.hoverColor), uiColorFrom(info.pressedColor)
+}
+
+// GetOpacity returns the button's opacity
+func (b *UIButton) GetOpacity() float32 {
+	info, ok := b.info()
+	if !ok {
+		return 0
+	}
+	return float32(info.opacity)
+}
+
+func (b *UIButton) info() (C.UIButtonInfo, bool) {
+	var info C.UIButtonInfo
+	if b.id == 0 {
+		return info, false
+	}
+	return info, C.boulder_ui_get_button_info(b.id, &info) == 0
+}
+
+func uiColorFrom(c [4]C.float) UIColor {
+	return UIColor{float32(c[0]), float32(c[1]), float32(c[2]), float32(c[3])}
+}
+
+// SetLabel sets the button's accessible name, which Accessibility announces when the
+// button takes focus
+func (b *UIButton) SetLabel(label string) {
+	if b.id != 0 {
+		cLabel := C.CString(label)
+		defer C.free(unsafe.Pointer(cLabel))
+		C.boulder_ui_set_button_label(b.id, cLabel)
+	}
+}
+
+// GetLabel returns the button's accessible name
+func (b *UIButton) GetLabel() string {
+	if b.id == 0 {
+		return ""
+	}
+	return uiButtonLabel(b.id)
+}
+
+func uiButtonLabel(id C.UIButtonID) string {
+	var buf [256]C.char
+	length := C.boulder_ui_get_button_label(id, &buf[0], C.uint32_t(len(buf)))
+	return C.GoStringN(&buf[0], C.int(min(int(length), len(buf)-1)))
+}
+
 // UI input handling functions
 
 // UIHandleMouseMove updates the UI with the current mouse position
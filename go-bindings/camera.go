@@ -0,0 +1,266 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import "errors"
+
+// PixelSnap rounds positions to a pixel grid so orthographic scenes don't shimmer
+type PixelSnap int
+
+const (
+	PixelSnapNone   PixelSnap = 0
+	PixelSnapScreen PixelSnap = 1 // Screen pixels; smooth motion at high zoom
+	PixelSnapTexel  PixelSnap = 2 // Art pixels; sprites never straddle pixels
+)
+
+// TextureFilter is how textures bound by the engine are sampled
+type TextureFilter int
+
+const (
+	TextureFilterLinear  TextureFilter = 0
+	TextureFilterNearest TextureFilter = 1 // Crisp pixel art
+)
+
+// SetPerspective draws the scene with a perspective camera (the default: 45 degrees, 0.1
+// to 100)
+func (r *Renderer) SetPerspective(fovY, near, far float32) error {
+	if ret := C.boulder_set_camera_perspective(C.float(fovY), C.float(near), C.float(far)); ret != 0 {
+		return errors.New("invalid perspective projection")
+	}
+	return nil
+}
+
+// SetOrthographic draws the scene with an orthographic camera showing height world units
+// vertically. With SetPixelPerfect the height is the minimum shown instead.
+func (r *Renderer) SetOrthographic(height, near, far float32) error {
+	if ret := C.boulder_set_camera_orthographic(C.float(height), C.float(near), C.float(far)); ret != 0 {
+		return errors.New("invalid orthographic projection")
+	}
+	return nil
+}
+
+// SetCameraLookAt places the camera at position looking at target. 2D games usually look
+// down -Z: position (x, y, 10), target (x, y, 0), up (0, 1, 0).
+func (r *Renderer) SetCameraLookAt(position, target, up Vector3) error {
+	if ret := C.boulder_set_camera_look_at(C.float(position.X), C.float(position.Y), C.float(position.Z),
+		C.float(target.X), C.float(target.Y), C.float(target.Z),
+		C.float(up.X), C.float(up.Y), C.float(up.Z)); ret != 0 {
+		return errors.New("camera up vector is zero")
+	}
+	return nil
+}
+
+// SetPixelPerfect sizes the orthographic camera so each art pixel (pixelsPerUnit per world
+// unit) covers zoom x zoom screen pixels. A zoom of 0 picks the largest that still shows
+// the orthographic height. pixelsPerUnit 0 turns pixel perfect sizing off.
+func (r *Renderer) SetPixelPerfect(pixelsPerUnit float32, zoom int, snap PixelSnap) error {
+	if ret := C.boulder_set_camera_pixel_perfect(C.float(pixelsPerUnit), C.int(zoom), C.int(snap)); ret != 0 {
+		return errors.New("invalid pixel perfect settings")
+	}
+	return nil
+}
+
+// GetPixelScale returns how many screen pixels one world unit covers with the orthographic
+// camera, or 0 with a perspective camera
+func (r *Renderer) GetPixelScale() float32 {
+	return float32(C.boulder_get_camera_pixel_scale())
+}
+
+// ScreenRay returns the camera ray through a window position in pixels
+func (r *Renderer) ScreenRay(x, y float32) (origin, direction Vector3, err error) {
+	var o, d [3]C.float
+	if ret := C.boulder_camera_screen_ray(C.float(x), C.float(y), &o[0], &d[0]); ret != 0 {
+		return Vector3{}, Vector3{}, errors.New("no swapchain")
+	}
+	origin = Vector3{float32(o[0]), float32(o[1]), float32(o[2])}
+	direction = Vector3{float32(d[0]), float32(d[1]), float32(d[2])}
+	return origin, direction, nil
+}
+
+// ScreenToPlane returns where the camera ray through a window position crosses the plane
+// Z = z, e.g. to find the tile under the mouse
+func (r *Renderer) ScreenToPlane(x, y, z float32) (Vector3, bool) {
+	origin, direction, err := r.ScreenRay(x, y)
+	if err != nil || direction.Z == 0 {
+		return Vector3{}, false
+	}
+
+	t := (z - origin.Z) / direction.Z
+	if t < 0 {
+		return Vector3{}, false
+	}
+	return Vector3{origin.X + direction.X*t, origin.Y + direction.Y*t, z}, true
+}
+
+// SetTextureFilter sets how textures bound by the engine are sampled. Changing it waits
+// for the GPU to go idle.
+func (r *Renderer) SetTextureFilter(filter TextureFilter) error {
+	defer lockThread()()
+	if ret := C.boulder_set_texture_filter(C.int(filter)); ret != 0 {
+		return lastError("failed to set texture filter")
+	}
+	return nil
+}
+
+// GetTextureFilter returns how textures bound by the engine are sampled
+func (r *Renderer) GetTextureFilter() TextureFilter {
+	return TextureFilter(C.boulder_get_texture_filter())
+}
+
+// Camera is a viewpoint Go code moves around, e.g. to follow a player or fly freely. The
+// scene is drawn from the camera passed to Renderer.SetActiveCamera; the others just keep
+// their settings until activated.
+type Camera struct {
+	renderer *Renderer
+	position Vector3
+	target   Vector3
+	up       Vector3
+	fovY     float32
+	near     float32
+	far      float32
+}
+
+// CreateCamera returns a perspective camera with the engine's defaults: at (2, 2, 2)
+// looking at the origin, 45 degrees, 0.1 to 100
+func (r *Renderer) CreateCamera() *Camera {
+	return &Camera{
+		renderer: r,
+		position: Vector3{X: 2, Y: 2, Z: 2},
+		up:       Vector3{Y: 1},
+		fovY:     45,
+		near:     0.1,
+		far:      100,
+	}
+}
+
+// SetActiveCamera draws the scene from camera. Its settings replace those made with
+// SetPerspective and SetCameraLookAt, and later changes to it apply immediately.
+func (r *Renderer) SetActiveCamera(camera *Camera) error {
+	if camera == nil {
+		return errors.New("camera is nil")
+	}
+	if camera.renderer != r {
+		return errors.New("camera belongs to another renderer")
+	}
+
+	previous := r.activeCamera
+	r.activeCamera = camera
+	if err := camera.apply(); err != nil {
+		r.activeCamera = previous
+		return err
+	}
+	return nil
+}
+
+// GetActiveCamera returns the camera the scene is drawn from, or nil if none was set
+func (r *Renderer) GetActiveCamera() *Camera {
+	return r.activeCamera
+}
+
+// SetPosition moves the camera, keeping the direction it looks in
+func (c *Camera) SetPosition(position Vector3) error {
+	c.target = Vector3{
+		X: c.target.X + position.X - c.position.X,
+		Y: c.target.Y + position.Y - c.position.Y,
+		Z: c.target.Z + position.Z - c.position.Z,
+	}
+	c.position = position
+	return c.apply()
+}
+
+// LookAt turns the camera to face target
+func (c *Camera) LookAt(target Vector3) error {
+	if target == c.position {
+		return errors.New("camera target is at its position")
+	}
+
+	c.target = target
+	return c.apply()
+}
+
+// SetUp sets which way is up on screen (the default is +Y)
+func (c *Camera) SetUp(up Vector3) error {
+	if vectorLength(up) < 1e-6 {
+		return errors.New("camera up vector is zero")
+	}
+
+	c.up = up
+	return c.apply()
+}
+
+// SetFOV sets the vertical field of view in degrees
+func (c *Camera) SetFOV(fovY float32) error {
+	if fovY <= 0 || fovY >= 180 {
+		return errors.New("field of view must be between 0 and 180 degrees")
+	}
+
+	c.fovY = fovY
+	return c.apply()
+}
+
+// SetNearFar sets the distances of the near and far clipping planes
+func (c *Camera) SetNearFar(near, far float32) error {
+	if near <= 0 || far <= near {
+		return errors.New("invalid near and far planes")
+	}
+
+	c.near, c.far = near, far
+	return c.apply()
+}
+
+// GetPosition returns where the camera is
+func (c *Camera) GetPosition() Vector3 {
+	return c.position
+}
+
+// GetTarget returns the point the camera looks at
+func (c *Camera) GetTarget() Vector3 {
+	return c.target
+}
+
+// GetForward returns the unit direction the camera looks in
+func (c *Camera) GetForward() Vector3 {
+	return normalizeVector(Vector3{
+		X: c.target.X - c.position.X,
+		Y: c.target.Y - c.position.Y,
+		Z: c.target.Z - c.position.Z,
+	})
+}
+
+// GetRight returns the unit direction to the right of the screen, for strafing
+func (c *Camera) GetRight() Vector3 {
+	f := c.GetForward()
+	return normalizeVector(Vector3{
+		X: f.Y*c.up.Z - f.Z*c.up.Y,
+		Y: f.Z*c.up.X - f.X*c.up.Z,
+		Z: f.X*c.up.Y - f.Y*c.up.X,
+	})
+}
+
+// GetFOV returns the vertical field of view in degrees
+func (c *Camera) GetFOV() float32 {
+	return c.fovY
+}
+
+// GetNearFar returns the distances of the near and far clipping planes
+func (c *Camera) GetNearFar() (near, far float32) {
+	return c.near, c.far
+}
+
+// IsActive returns whether the scene is drawn from the camera
+func (c *Camera) IsActive() bool {
+	return c.renderer.activeCamera == c
+}
+
+// apply updates the native camera if this one is active
+func (c *Camera) apply() error {
+	if !c.IsActive() {
+		return nil
+	}
+	if err := c.renderer.SetPerspective(c.fovY, c.near, c.far); err != nil {
+		return err
+	}
+	return c.renderer.SetCameraLookAt(c.position, c.target, c.up)
+}
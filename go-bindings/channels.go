@@ -0,0 +1,207 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"encoding/binary"
+	"errors"
+	"unsafe"
+)
+
+// MaxChannels is the most channels a session can have
+const MaxChannels = 16
+
+// ChannelConfig sets how messages on a channel are delivered. A channel's reliable
+// messages arrive in the order they were sent, but never wait for another channel's, so
+// game state, chat and voice don't hold each other up.
+type ChannelConfig struct {
+	Reliable  bool // Every message is reliable, whatever the send flags
+	Sequenced bool // Unreliable messages older than the newest one received are dropped
+	Priority  int  // Lower priorities are sent first
+	Weight    int  // Share of bandwidth among channels of the same priority (0 counts as 1)
+}
+
+// Key of the sequence counters of a sequenced channel
+type channelKey struct {
+	conn    ConnectionHandle
+	channel int
+}
+
+// channelState is a session's channels and what it has sent and received on them
+type channelState struct {
+	configs    []ChannelConfig
+	configured map[ConnectionHandle]int // Channels the native connection has been given
+	sent       map[channelKey]uint32    // Last sequence number sent
+	received   map[channelKey]uint32    // Newest sequence number received
+}
+
+func newChannelState() *channelState {
+	return &channelState{
+		configured: make(map[ConnectionHandle]int),
+		sent:       make(map[channelKey]uint32),
+		received:   make(map[channelKey]uint32),
+	}
+}
+
+// SetChannels sets up the session's channels; channel 0 is the one SendMessage uses.
+// Channels can be added later but not removed, and both ends should set up the same ones.
+// Connections from transport plugins have a single stream, so their channels only differ
+// in reliability and sequencing.
+func (ns *NetworkSession) SetChannels(channels []ChannelConfig) error {
+	if ns.handle == nil {
+		return errSessionNotInitialized
+	}
+	if len(channels) == 0 || len(channels) > MaxChannels {
+		return errors.New("a session has between 1 and 16 channels")
+	}
+	if ns.channels != nil && len(channels) < len(ns.channels.configs) {
+		return errors.New("channels cannot be removed")
+	}
+
+	if ns.channels == nil {
+		ns.channels = newChannelState()
+	}
+	ns.channels.configs = append([]ChannelConfig(nil), channels...)
+
+	// Connections pick up the new channels on their next send
+	clear(ns.channels.configured)
+	return nil
+}
+
+// GetChannels returns the channels set by SetChannels
+func (ns *NetworkSession) GetChannels() []ChannelConfig {
+	if ns.channels == nil {
+		return nil
+	}
+	return append([]ChannelConfig(nil), ns.channels.configs...)
+}
+
+// SendOnChannel sends data on one of the channels set by SetChannels. flags combine
+// SendReliable, SendNoNagle and SendNoDelay; the channel's Reliable setting overrides them.
+func (ns *NetworkSession) SendOnChannel(conn ConnectionHandle, channel int, data []byte, flags int) error {
+	defer lockThread()()
+	if ns.handle == nil {
+		return errSessionNotInitialized
+	}
+	if len(data) == 0 {
+		return errors.New("empty data")
+	}
+	if isControlMessage(data) {
+		return errors.New("message starts with the reserved control marker")
+	}
+	configs := ns.GetChannels()
+	if channel == 0 && len(configs) == 0 {
+		return ns.SendMessage(conn, data, flags&SendReliable != 0)
+	}
+	if channel < 0 || channel >= len(configs) {
+		return errors.New("channel not set up (see SetChannels)")
+	}
+
+	config := configs[channel]
+	if config.Reliable {
+		flags |= SendReliable
+	}
+	if send, err := ns.admit(conn, flags&SendReliable != 0); !send {
+		return err
+	}
+	if config.Sequenced && flags&SendReliable == 0 {
+		data = ns.channels.sequence(conn, channel, data)
+	}
+
+	if pc, ok := ns.lookupPlugin(conn); ok {
+		return pc.plugin.Send(pc.conn, data, flags&SendReliable != 0)
+	}
+	if err := ns.configureChannels(conn); err != nil {
+		return err
+	}
+
+	result := C.boulder_send_message_on_channel(ns.handle, C.ConnectionHandle(conn), C.int(channel),
+		unsafe.Pointer(&data[0]), C.uint32_t(len(data)), C.int(flags))
+	if result != 0 {
+		return lastError("failed to send message")
+	}
+	return nil
+}
+
+// configureChannels gives a native connection the session's channels if it doesn't have
+// them yet
+func (ns *NetworkSession) configureChannels(conn ConnectionHandle) error {
+	defer lockThread()()
+	state := ns.channels
+	if state.configured[conn] == len(state.configs) {
+		return nil
+	}
+
+	priorities := make([]C.int, len(state.configs))
+	weights := make([]C.uint16_t, len(state.configs))
+	for i, config := range state.configs {
+		priorities[i] = C.int(config.Priority)
+		weights[i] = C.uint16_t(max(config.Weight, 1))
+	}
+	if C.boulder_configure_channels(ns.handle, C.ConnectionHandle(conn), C.int(len(state.configs)),
+		&priorities[0], &weights[0]) != 0 {
+		return lastError("failed to set up channels")
+	}
+	state.configured[conn] = len(state.configs)
+	return nil
+}
+
+// sequence frames an unreliable message on a sequenced channel with its channel and
+// sequence number, as a control message the receiving session unwraps
+func (s *channelState) sequence(conn ConnectionHandle, channel int, data []byte) []byte {
+	key := channelKey{conn, channel}
+	s.sent[key]++
+
+	payload := make([]byte, 5, 5+len(data))
+	payload[0] = byte(channel)
+	binary.LittleEndian.PutUint32(payload[1:], s.sent[key])
+	return encodeControl(controlSequenced, append(payload, data...))
+}
+
+// receiveSequenced unwraps a sequenced message, returning false for one older than the
+// newest already received on its channel
+func (ns *NetworkSession) receiveSequenced(conn ConnectionHandle, payload []byte, timestamp float64) (MessageEvent, bool) {
+	if len(payload) <= 5 {
+		return MessageEvent{}, false
+	}
+	channel := int(payload[0])
+	number := binary.LittleEndian.Uint32(payload[1:])
+
+	if ns.channels == nil {
+		// The receiving end has no channels of its own; sequence on the sender's numbering
+		ns.channels = newChannelState()
+	}
+	key := channelKey{conn, channel}
+	if last, ok := ns.channels.received[key]; ok && int32(number-last) <= 0 {
+		return MessageEvent{}, false
+	}
+	ns.channels.received[key] = number
+
+	return MessageEvent{
+		Connection: conn,
+		Channel:    channel,
+		Data:       payload[5:],
+		Timestamp:  timestamp,
+		ServerTime: ns.ToServerTime(timestamp),
+	}, true
+}
+
+// forgetChannels drops a closed connection's channel state
+func (ns *NetworkSession) forgetChannels(conn ConnectionHandle) {
+	if ns.channels == nil {
+		return
+	}
+	delete(ns.channels.configured, conn)
+	for key := range ns.channels.sent {
+		if key.conn == conn {
+			delete(ns.channels.sent, key)
+		}
+	}
+	for key := range ns.channels.received {
+		if key.conn == conn {
+			delete(ns.channels.received, key)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package boulder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// World snapshot layout, matching boulder_world_save_snapshot: a 12 byte header (magic,
+// version, count) followed by fixed size records starting with the entity ID
+const snapshotHeaderSize = 12
+
+// CheckpointState saves and restores game state that isn't part of the world snapshot,
+// such as inventories or quest progress
+type CheckpointState struct {
+	Save func() ([]byte, error)
+	Load func(data []byte) error
+}
+
+// CheckpointCallback is called after a checkpoint is taken. name is the trigger's name,
+// "timer" for timed auto-saves, or empty for manual checkpoints.
+type CheckpointCallback func(name string)
+
+type checkpointTrigger struct {
+	halfExtents Vector3
+	name        string
+}
+
+type checkpointData struct {
+	Diff   []byte            `json:"diff"`   // Snapshot of the records that changed since the baseline
+	States map[string][]byte `json:"states"` // Registered states by name
+	Fired  []EntityID        `json:"fired"`  // Triggers that already fired
+}
+
+// Checkpoints restores the world to a checkpoint without reloading the level. Call
+// SetBaseline once the level is loaded; each checkpoint then only stores the entities that
+// changed since. Entity IDs must be the same each time the level loads for checkpoints
+// saved to disk to apply.
+type Checkpoints struct {
+	world  *World
+	saves  *SaveGames
+	slot   string
+	states map[string]CheckpointState
+
+	baseline   []byte
+	recordSize int
+	current    *checkpointData
+
+	players  []EntityID
+	triggers map[EntityID]*checkpointTrigger
+	fired    map[EntityID]bool
+	interval time.Duration
+	elapsed  time.Duration
+
+	onCheckpoint CheckpointCallback
+}
+
+// NewCheckpoints creates a checkpoint system. saves may be nil to keep checkpoints in
+// memory only.
+func NewCheckpoints(world *World, saves *SaveGames) *Checkpoints {
+	return &Checkpoints{
+		world:    world,
+		saves:    saves,
+		slot:     "checkpoint",
+		states:   make(map[string]CheckpointState),
+		triggers: make(map[EntityID]*checkpointTrigger),
+		fired:    make(map[EntityID]bool),
+	}
+}
+
+// SetSlot sets the save slot checkpoints are written to (default "checkpoint")
+func (c *Checkpoints) SetSlot(slot string) {
+	c.slot = slot
+}
+
+// AddState includes game state in checkpoints
+func (c *Checkpoints) AddState(name string, state CheckpointState) {
+	c.states[name] = state
+}
+
+// OnCheckpoint sets the callback run after each checkpoint
+func (c *Checkpoints) OnCheckpoint(callback CheckpointCallback) {
+	c.onCheckpoint = callback
+}
+
+// SetBaseline captures the world checkpoints are diffed against (call after loading a
+// level). Any previous checkpoint and fired triggers are forgotten.
+func (c *Checkpoints) SetBaseline() error {
+	snapshot, err := c.world.SaveSnapshot(nil)
+	if err != nil {
+		return err
+	}
+	size, err := snapshotRecordSize(snapshot)
+	if err != nil {
+		return err
+	}
+
+	c.baseline, c.recordSize = snapshot, size
+	c.current = nil
+	c.fired = make(map[EntityID]bool)
+	c.elapsed = 0
+	return nil
+}
+
+// Checkpoint captures the world and registered states, writing them to the save slot when
+// the checkpoint system has a SaveGames
+func (c *Checkpoints) Checkpoint() error {
+	return c.checkpoint("")
+}
+
+// HasCheckpoint returns true if there is a checkpoint to restore
+func (c *Checkpoints) HasCheckpoint() bool {
+	return c.current != nil
+}
+
+// Restore returns the world and registered states to the last checkpoint. Entities
+// destroyed since the checkpoint are not revived.
+func (c *Checkpoints) Restore() error {
+	if c.current == nil {
+		return errors.New("no checkpoint")
+	}
+	if c.baseline == nil {
+		return errors.New("checkpoint baseline not set")
+	}
+
+	snapshot, err := mergeSnapshot(c.baseline, c.current.Diff, c.recordSize)
+	if err != nil {
+		return err
+	}
+	if err := c.world.LoadSnapshot(snapshot); err != nil {
+		return err
+	}
+
+	for name, data := range c.current.States {
+		if state, ok := c.states[name]; ok && state.Load != nil {
+			if err := state.Load(data); err != nil {
+				return err
+			}
+		}
+	}
+
+	c.fired = make(map[EntityID]bool, len(c.current.Fired))
+	for _, trigger := range c.current.Fired {
+		c.fired[trigger] = true
+	}
+	c.elapsed = 0
+	return nil
+}
+
+// Load reads the checkpoint in the save slot and restores it. The level must be loaded
+// and SetBaseline called first.
+func (c *Checkpoints) Load() error {
+	if c.saves == nil {
+		return errors.New("checkpoints have no save games")
+	}
+
+	data, _, err := c.saves.Load(c.slot)
+	if err != nil {
+		return err
+	}
+	var checkpoint checkpointData
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return err
+	}
+
+	c.current = &checkpoint
+	return c.Restore()
+}
+
+// SetPlayers sets the entities that set off checkpoint triggers
+func (c *Checkpoints) SetPlayers(players ...EntityID) {
+	c.players = players
+}
+
+// AddTrigger takes a checkpoint the first time a player enters the box of halfExtents
+// around entity's position
+func (c *Checkpoints) AddTrigger(entity EntityID, halfExtents Vector3, name string) {
+	c.triggers[entity] = &checkpointTrigger{halfExtents: halfExtents, name: name}
+}
+
+// RemoveTrigger removes a checkpoint trigger
+func (c *Checkpoints) RemoveTrigger(entity EntityID) {
+	delete(c.triggers, entity)
+}
+
+// SetAutoSaveInterval takes a checkpoint every interval of play; zero disables it
+func (c *Checkpoints) SetAutoSaveInterval(interval time.Duration) {
+	c.interval = interval
+	c.elapsed = 0
+}
+
+// Update checks triggers and the auto-save timer (call every frame with the engine delta
+// time)
+func (c *Checkpoints) Update(deltaTime float32) error {
+	if c.baseline == nil {
+		return nil
+	}
+
+	for entity, trigger := range c.triggers {
+		if c.fired[entity] || !c.playerInside(entity, trigger) {
+			continue
+		}
+		c.fired[entity] = true
+		if err := c.checkpoint(trigger.name); err != nil {
+			return err
+		}
+	}
+
+	if c.interval > 0 {
+		c.elapsed += time.Duration(float64(deltaTime) * float64(time.Second))
+		if c.elapsed >= c.interval {
+			return c.checkpoint("timer")
+		}
+	}
+	return nil
+}
+
+func (c *Checkpoints) playerInside(entity EntityID, trigger *checkpointTrigger) bool {
+	center, err := (&Entity{ID: entity, world: c.world}).GetTransform()
+	if err != nil {
+		return false
+	}
+
+	for _, player := range c.players {
+		p, err := (&Entity{ID: player, world: c.world}).GetTransform()
+		if err != nil {
+			continue
+		}
+		if abs32(p.X-center.X) <= trigger.halfExtents.X &&
+			abs32(p.Y-center.Y) <= trigger.halfExtents.Y &&
+			abs32(p.Z-center.Z) <= trigger.halfExtents.Z {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Checkpoints) checkpoint(name string) error {
+	if c.baseline == nil {
+		return errors.New("checkpoint baseline not set")
+	}
+
+	snapshot, err := c.world.SaveSnapshot(nil)
+	if err != nil {
+		return err
+	}
+	diff, err := diffSnapshot(c.baseline, snapshot, c.recordSize)
+	if err != nil {
+		return err
+	}
+
+	checkpoint := &checkpointData{Diff: diff, States: make(map[string][]byte, len(c.states))}
+	for stateName, state := range c.states {
+		if state.Save == nil {
+			continue
+		}
+		data, err := state.Save()
+		if err != nil {
+			return err
+		}
+		checkpoint.States[stateName] = data
+	}
+	for trigger := range c.fired {
+		checkpoint.Fired = append(checkpoint.Fired, trigger)
+	}
+
+	if c.saves != nil {
+		data, err := json.Marshal(checkpoint)
+		if err != nil {
+			return err
+		}
+		if err := c.saves.Save(c.slot, name, data, nil); err != nil {
+			return err
+		}
+	}
+
+	c.current = checkpoint
+	c.elapsed = 0
+	if c.onCheckpoint != nil {
+		runCallback("OnCheckpoint", func() { c.onCheckpoint(name) })
+	}
+	return nil
+}
+
+// snapshotRecordSize returns the size of one record, which includes the native struct's
+// padding
+func snapshotRecordSize(snapshot []byte) (int, error) {
+	if len(snapshot) < snapshotHeaderSize {
+		return 0, errors.New("invalid world snapshot")
+	}
+	count := int(binary.LittleEndian.Uint32(snapshot[8:]))
+	if count == 0 {
+		return 0, nil
+	}
+	size := (len(snapshot) - snapshotHeaderSize) / count
+	if size < 8 || size*count != len(snapshot)-snapshotHeaderSize {
+		return 0, errors.New("invalid world snapshot")
+	}
+	return size, nil
+}
+
+// snapshotRecords splits a snapshot into records keyed by entity
+func snapshotRecords(snapshot []byte, size int) (map[uint64][]byte, []uint64, error) {
+	if len(snapshot) < snapshotHeaderSize {
+		return nil, nil, errors.New("invalid world snapshot")
+	}
+	count := int(binary.LittleEndian.Uint32(snapshot[8:]))
+	if count > 0 && (size == 0 || len(snapshot) != snapshotHeaderSize+count*size) {
+		return nil, nil, errors.New("world snapshot record size changed")
+	}
+
+	records := make(map[uint64][]byte, count)
+	order := make([]uint64, 0, count)
+	for i := 0; i < count; i++ {
+		record := snapshot[snapshotHeaderSize+i*size : snapshotHeaderSize+(i+1)*size]
+		entity := binary.LittleEndian.Uint64(record)
+		records[entity] = record
+		order = append(order, entity)
+	}
+	return records, order, nil
+}
+
+// diffSnapshot returns a snapshot of the records in current that differ from baseline
+func diffSnapshot(baseline, current []byte, size int) ([]byte, error) {
+	if size == 0 {
+		var err error
+		if size, err = snapshotRecordSize(current); err != nil {
+			return nil, err
+		}
+	}
+	before, _, err := snapshotRecords(baseline, size)
+	if err != nil {
+		return nil, err
+	}
+	after, order, err := snapshotRecords(current, size)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := append([]byte(nil), current[:snapshotHeaderSize]...)
+	count := 0
+	for _, entity := range order {
+		if !bytes.Equal(before[entity], after[entity]) {
+			diff = append(diff, after[entity]...)
+			count++
+		}
+	}
+	binary.LittleEndian.PutUint32(diff[8:], uint32(count))
+	return diff, nil
+}
+
+// mergeSnapshot applies a diff from diffSnapshot to baseline
+func mergeSnapshot(baseline, diff []byte, size int) ([]byte, error) {
+	if size == 0 {
+		var err error
+		if size, err = snapshotRecordSize(diff); err != nil {
+			return nil, err
+		}
+	}
+	records, order, err := snapshotRecords(baseline, size)
+	if err != nil {
+		return nil, err
+	}
+	changed, changedOrder, err := snapshotRecords(diff, size)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entity := range changedOrder {
+		if _, ok := records[entity]; !ok {
+			order = append(order, entity)
+		}
+		records[entity] = changed[entity]
+	}
+
+	merged := append([]byte(nil), baseline[:snapshotHeaderSize]...)
+	for _, entity := range order {
+		merged = append(merged, records[entity]...)
+	}
+	binary.LittleEndian.PutUint32(merged[8:], uint32(len(order)))
+	return merged, nil
+}
+
+func abs32(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,198 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+)
+
+// clockSampleCount is how many ping samples are kept for offset estimation
+const clockSampleCount = 16
+
+// clockSmoothing is the weight of a new sample in the smoothed RTT and offset
+const clockSmoothing = 0.1
+
+// ClockSyncStats describes the state of clock synchronization with the server
+type ClockSyncStats struct {
+	Synchronized bool
+	RTT          float64 // Smoothed round trip time in seconds
+	Offset       float64 // Smoothed server time minus local time in seconds
+	Jitter       float64 // Standard deviation of recent RTT samples in seconds
+	Samples      int
+}
+
+type clockSample struct {
+	rtt    float64
+	offset float64
+}
+
+// clockSync implements an NTP-like exchange: the client sends its local time, the
+// server echoes it with its own time, and the client derives RTT and offset
+type clockSync struct {
+	server   ConnectionHandle
+	enabled  bool
+	interval float64
+	lastPing float64
+	samples  []clockSample
+	stats    ClockSyncStats
+}
+
+func newClockSync() *clockSync {
+	return &clockSync{}
+}
+
+// localNetworkTime returns the local networking clock in seconds
+func localNetworkTime() float64 {
+	return float64(C.boulder_network_local_time()) / 1e6
+}
+
+func (cs *clockSync) update(ns *NetworkSession) {
+	if !cs.enabled {
+		return
+	}
+
+	now := localNetworkTime()
+	// Ping quickly until the first few samples arrive, then settle on the interval
+	interval := cs.interval
+	if len(cs.samples) < 4 {
+		interval = math.Min(interval, 0.25)
+	}
+	if now-cs.lastPing < interval {
+		return
+	}
+	cs.lastPing = now
+
+	payload := binary.LittleEndian.AppendUint64(nil, math.Float64bits(now))
+	ns.sendControl(cs.server, controlClockPing, payload, false)
+}
+
+func (cs *clockSync) handle(ns *NetworkSession, conn ConnectionHandle, kind controlType, payload []byte, timestamp float64) {
+	switch kind {
+	case controlClockPing:
+		if len(payload) < 8 {
+			return
+		}
+		reply := make([]byte, 0, 16)
+		reply = append(reply, payload[:8]...)
+		reply = binary.LittleEndian.AppendUint64(reply, math.Float64bits(localNetworkTime()))
+		ns.sendControl(conn, controlClockPong, reply, false)
+
+	case controlClockPong:
+		if !cs.enabled || conn != cs.server || len(payload) < 16 {
+			return
+		}
+		sent := math.Float64frombits(binary.LittleEndian.Uint64(payload))
+		serverTime := math.Float64frombits(binary.LittleEndian.Uint64(payload[8:]))
+		cs.addSample(sent, serverTime, timestamp)
+	}
+}
+
+func (cs *clockSync) addSample(sent, serverTime, received float64) {
+	rtt := received - sent
+	if rtt < 0 {
+		return
+	}
+	offset := serverTime + rtt/2 - received
+
+	cs.samples = append(cs.samples, clockSample{rtt: rtt, offset: offset})
+	if len(cs.samples) > clockSampleCount {
+		cs.samples = cs.samples[1:]
+	}
+
+	// Samples with the lowest RTT have the least asymmetric delay, so estimate the
+	// offset from the best half only
+	sorted := make([]clockSample, len(cs.samples))
+	copy(sorted, cs.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].rtt < sorted[j].rtt })
+	best := sorted[:(len(sorted)+1)/2]
+
+	var offsetSum, rttSum float64
+	for _, s := range best {
+		offsetSum += s.offset
+	}
+	for _, s := range cs.samples {
+		rttSum += s.rtt
+	}
+	estimate := offsetSum / float64(len(best))
+	meanRTT := rttSum / float64(len(cs.samples))
+
+	var variance float64
+	for _, s := range cs.samples {
+		variance += (s.rtt - meanRTT) * (s.rtt - meanRTT)
+	}
+
+	if !cs.stats.Synchronized {
+		cs.stats.Offset = estimate
+		cs.stats.RTT = rtt
+		cs.stats.Synchronized = true
+	} else {
+		cs.stats.Offset += (estimate - cs.stats.Offset) * clockSmoothing
+		cs.stats.RTT += (rtt - cs.stats.RTT) * clockSmoothing
+	}
+	cs.stats.Jitter = math.Sqrt(variance / float64(len(cs.samples)))
+	cs.stats.Samples = len(cs.samples)
+}
+
+// EnableClockSync starts synchronizing this session's clock with the session at the
+// other end of conn (usually the server), pinging it every interval
+func (ns *NetworkSession) EnableClockSync(conn ConnectionHandle, interval time.Duration) {
+	if ns.clock == nil {
+		return
+	}
+
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ns.clock.server = conn
+	ns.clock.enabled = true
+	ns.clock.interval = interval.Seconds()
+	ns.clock.lastPing = 0
+	ns.clock.samples = nil
+	ns.clock.stats = ClockSyncStats{}
+}
+
+// DisableClockSync stops clock synchronization; GetServerTime keeps the last offset
+func (ns *NetworkSession) DisableClockSync() {
+	if ns.clock != nil {
+		ns.clock.enabled = false
+	}
+}
+
+// GetLocalTime returns the local networking clock in seconds
+func (ns *NetworkSession) GetLocalTime() float64 {
+	if ns.handle == nil {
+		return 0
+	}
+	return localNetworkTime()
+}
+
+// GetServerTime returns the estimated current server time in seconds. On the server
+// itself (or before synchronization) this is the local time.
+func (ns *NetworkSession) GetServerTime() float64 {
+	if ns.handle == nil {
+		return 0
+	}
+	return localNetworkTime() + ns.clock.stats.Offset
+}
+
+// ToServerTime converts a local timestamp (such as MessageEvent.Timestamp) to server time
+func (ns *NetworkSession) ToServerTime(localTime float64) float64 {
+	if ns.clock == nil {
+		return localTime
+	}
+	return localTime + ns.clock.stats.Offset
+}
+
+// GetClockStats returns the current clock synchronization estimate
+func (ns *NetworkSession) GetClockStats() ClockSyncStats {
+	if ns.clock == nil {
+		return ClockSyncStats{}
+	}
+	return ns.clock.stats
+}
@@ -0,0 +1,189 @@
+// Command boulder-fetch downloads a prebuilt engine library for the bindings to link
+// against, so Go programs build without compiling the C++ engine. Run it from the
+// go-bindings directory:
+//
+//	go run ./cmd/boulder-fetch -version v0.0.1
+//	GOOS=windows GOARCH=amd64 go run ./cmd/boulder-fetch -version v0.0.1
+//
+// The archive boulder_shared_<os>_<arch>.tar.gz is unpacked into lib/<os>_<arch>, which
+// the bindings search after ../build. With -bundle, the library is also copied next to a
+// built executable so the two can be shipped together. The archive must match the
+// checksum published next to it; -insecure allows mirrors that publish none.
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const defaultURL = "https://github.com/NOT-REAL-GAMES/BOULDER/releases/download"
+
+func main() {
+	version := flag.String("version", "", "release to download, e.g. v0.0.1")
+	baseURL := flag.String("url", defaultURL, "where releases are published (a mirror or local server)")
+	goos := flag.String("os", envOr("GOOS", runtime.GOOS), "target operating system")
+	goarch := flag.String("arch", envOr("GOARCH", runtime.GOARCH), "target architecture")
+	dir := flag.String("dir", "lib", "directory the <os>_<arch> folder is created in")
+	bundle := flag.String("bundle", "", "also copy the library into this directory (next to your executable)")
+	insecure := flag.Bool("insecure", false, "unpack the archive even if no checksum is published for it")
+	flag.Parse()
+
+	if *version == "" {
+		log.Fatal("boulder-fetch: -version is required")
+	}
+
+	target := *goos + "_" + *goarch
+	archive := "boulder_shared_" + target + ".tar.gz"
+	url := strings.TrimSuffix(*baseURL, "/") + "/" + *version + "/" + archive
+
+	data, err := download(url)
+	if err != nil {
+		log.Fatalf("boulder-fetch: %v", err)
+	}
+
+	// Releases publish a checksum next to each archive; mirrors may leave it out, which
+	// is only accepted with -insecure
+	if sum, err := download(url + ".sha256"); err == nil {
+		if err := verify(data, sum); err != nil {
+			log.Fatalf("boulder-fetch: %s: %v", archive, err)
+		}
+	} else if *insecure {
+		log.Printf("boulder-fetch: no checksum for %s, skipping verification (-insecure)", archive)
+	} else {
+		log.Fatalf("boulder-fetch: no checksum for %s (%v); pass -insecure to unpack it unverified", archive, err)
+	}
+
+	outDir := filepath.Join(*dir, target)
+	files, err := extract(data, outDir)
+	if err != nil {
+		log.Fatalf("boulder-fetch: %v", err)
+	}
+	fmt.Printf("Unpacked %d files into %s\n", len(files), outDir)
+
+	if *bundle != "" {
+		for _, name := range files {
+			if !isLibrary(name) {
+				continue
+			}
+			if err := copyFile(filepath.Join(outDir, name), filepath.Join(*bundle, name)); err != nil {
+				log.Fatalf("boulder-fetch: %v", err)
+			}
+		}
+		fmt.Printf("Copied the libraries into %s\n", *bundle)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func download(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// verify checks data against a sha256sum-style line ("<hex digest>  <file name>")
+func verify(data, sumFile []byte) error {
+	fields := strings.Fields(string(sumFile))
+	if len(fields) == 0 {
+		return fmt.Errorf("empty checksum file")
+	}
+
+	sum := sha256.Sum256(data)
+	if !strings.EqualFold(fields[0], hex.EncodeToString(sum[:])) {
+		return fmt.Errorf("checksum mismatch")
+	}
+	return nil
+}
+
+// extract unpacks the regular files of a .tar.gz into dir, flattening any folders, and
+// returns their names
+func extract(data []byte, dir string) ([]string, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := filepath.Base(header.Name)
+		out, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, name)
+	}
+	return files, nil
+}
+
+func isLibrary(name string) bool {
+	return strings.HasSuffix(name, ".so") || strings.Contains(name, ".so.") ||
+		strings.HasSuffix(name, ".dylib") || strings.HasSuffix(name, ".dll")
+}
+
+func copyFile(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(to, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
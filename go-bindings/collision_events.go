@@ -0,0 +1,134 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import "errors"
+
+// CollisionEventKind is whether two colliders started or stopped touching
+type CollisionEventKind int
+
+const (
+	EnterContact CollisionEventKind = 0
+	ExitContact  CollisionEventKind = 1 // Also sent when either entity is destroyed or loses its collider
+	EnterTrigger CollisionEventKind = 2 // A body started overlapping a trigger volume
+	ExitTrigger  CollisionEventKind = 3 // Also sent when either entity is destroyed or loses its collider
+)
+
+// IsTrigger returns whether the event is about a trigger volume rather than a contact
+func (k CollisionEventKind) IsTrigger() bool {
+	return k == EnterTrigger || k == ExitTrigger
+}
+
+// CollisionEvent reports two colliders starting or stopping touching. Normal points from B
+// to A, and Point is where they touch (for ExitContact, where they last touched).
+type CollisionEvent struct {
+	Kind   CollisionEventKind
+	A      EntityID
+	B      EntityID
+	Point  Vector3
+	Normal Vector3
+}
+
+// CollisionCallback is called for collision events
+type CollisionCallback func(event CollisionEvent)
+
+type collisionEventState struct {
+	callbacks map[EntityID][]CollisionCallback
+	watching  bool
+}
+
+func (w *World) collisionEvents() *collisionEventState {
+	if w.collisions == nil {
+		w.collisions = &collisionEventState{callbacks: make(map[EntityID][]CollisionCallback)}
+	}
+	return w.collisions
+}
+
+// OnCollision calls fn whenever a collider starts or stops touching the entity. Events are
+// flipped so A is always the entity. Callbacks run from PollCollisionEvents.
+func (w *World) OnCollision(entity EntityID, fn CollisionCallback) error {
+	if fn == nil {
+		return errors.New("collision callback is nil")
+	}
+	if err := w.watchCollisions(); err != nil {
+		return err
+	}
+
+	state := w.collisionEvents()
+	state.callbacks[entity] = append(state.callbacks[entity], fn)
+	return nil
+}
+
+// RemoveCollisionCallbacks removes the entity's OnCollision callbacks
+func (w *World) RemoveCollisionCallbacks(entity EntityID) {
+	if w.collisions != nil {
+		delete(w.collisions.callbacks, entity)
+	}
+}
+
+// PollCollisionEvents returns the collision events since the last call and runs their
+// OnCollision callbacks (call every frame after Engine.Update). Only the active world
+// simulates physics, so other worlds have no events. Events start being queued by the
+// first call.
+func (w *World) PollCollisionEvents() []CollisionEvent {
+	if !w.IsActive() || w.watchCollisions() != nil {
+		return nil
+	}
+
+	state := w.collisionEvents()
+	var events []CollisionEvent
+	var event C.CollisionEvent
+	for C.boulder_poll_collision_event(&event) == 1 {
+		e := CollisionEvent{
+			Kind:   CollisionEventKind(event.kind),
+			A:      EntityID(event.a),
+			B:      EntityID(event.b),
+			Point:  Vector3{X: float32(event.point[0]), Y: float32(event.point[1]), Z: float32(event.point[2])},
+			Normal: Vector3{X: float32(event.normal[0]), Y: float32(event.normal[1]), Z: float32(event.normal[2])},
+		}
+		events = append(events, e)
+
+		for _, fn := range state.callbacks[e.A] {
+			runCallback("OnCollision", func() { fn(e) })
+		}
+		flipped := e
+		flipped.A, flipped.B = e.B, e.A
+		flipped.Normal = Vector3{X: -e.Normal.X, Y: -e.Normal.Y, Z: -e.Normal.Z}
+		for _, fn := range state.callbacks[e.B] {
+			runCallback("OnCollision", func() { fn(flipped) })
+		}
+
+		if e.Kind == ExitContact || e.Kind == ExitTrigger {
+			// Destroyed entities have no more contacts to report
+			w.forgetDestroyed(state, e.A)
+			w.forgetDestroyed(state, e.B)
+		}
+	}
+	return events
+}
+
+// watchCollisions tells the engine to start queuing collision events
+func (w *World) watchCollisions() error {
+	defer lockThread()()
+	if !w.ready() {
+		return errNotInitialized
+	}
+
+	state := w.collisionEvents()
+	if state.watching {
+		return nil
+	}
+	if ret := C.boulder_watch_collisions(1); ret != 0 {
+		return lastError("failed to watch collisions")
+	}
+	state.watching = true
+	return nil
+}
+
+func (w *World) forgetDestroyed(state *collisionEventState, entity EntityID) {
+	if _, ok := state.callbacks[entity]; ok && !w.EntityExists(entity) {
+		delete(state.callbacks, entity)
+	}
+}
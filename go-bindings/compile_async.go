@@ -0,0 +1,266 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"unsafe"
+)
+
+// CompileStatus is how far an async shader or pipeline compile got
+type CompileStatus int
+
+const (
+	CompileFailed  CompileStatus = -1 // Also returned for destroyed shaders and pipelines
+	CompilePending CompileStatus = 0
+	CompileReady   CompileStatus = 1
+)
+
+// MaterialSource is a material pipeline to compile from GLSL, for WarmUpMaterials
+type MaterialSource struct {
+	Name       string
+	MeshSource string
+	FragSource string
+	Defines    ShaderDefines // Applied to both shaders
+}
+
+// WarmUp tracks pipelines compiling in the background, e.g. behind a loading screen
+type WarmUp struct {
+	Pipelines []*Pipeline // In the order of the sources
+	Shaders   []*Shader   // Mesh and fragment shader of each pipeline
+	engine    *Engine
+}
+
+// CompileShaderAsync starts compiling a shader on a worker thread and returns at once. The
+// shader can be passed to CreateMaterialPipelineAsync before it is ready. Compile errors
+// are logged and reported by Status, and GetCompileError has the compiler's output.
+func (e *Engine) CompileShaderAsync(source string, kind ShaderKind, name string, defines ShaderDefines) (*Shader, error) {
+	defer lockThread()()
+	if !e.initialized {
+		return nil, errNotInitialized
+	}
+
+	cDefines, err := defines.cStrings()
+	if err != nil {
+		return nil, err
+	}
+	defer freeCStrings(cDefines)
+
+	cSource := C.CString(source)
+	defer C.free(unsafe.Pointer(cSource))
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	id := C.boulder_compile_shader_async(cSource, C.int(kind), cName, cStringArray(cDefines), C.uint32_t(len(cDefines)))
+	if id == 0 {
+		return nil, lastError("failed to compile shader: " + name)
+	}
+
+	s := &Shader{
+		ID:      ShaderModuleID(id),
+		Kind:    kind,
+		Name:    name,
+		Defines: defines,
+		engine:  e,
+	}
+	e.track(s, stageShaders)
+	return s, nil
+}
+
+// Status returns whether the shader finished compiling
+func (s *Shader) Status() CompileStatus {
+	if s.engine == nil || !s.engine.initialized {
+		return CompileFailed
+	}
+	return CompileStatus(C.boulder_get_shader_status(C.ShaderModuleID(s.ID)))
+}
+
+// Ready returns whether the shader compiled and can be used
+func (s *Shader) Ready() bool {
+	return s.Status() == CompileReady
+}
+
+// CreateMaterialPipelineAsync starts creating a material pipeline on a worker thread and
+// returns at once. Until it is ready, entities using it draw with the built-in model
+// pipeline. Keep the shaders until the pipeline is ready; destroying one waits for it.
+func (e *Engine) CreateMaterialPipelineAsync(config PipelineConfig) (*Pipeline, error) {
+	defer lockThread()()
+	if !e.initialized {
+		return nil, errNotInitialized
+	}
+
+	if config.MeshShader == nil || config.FragShader == nil {
+		return nil, errors.New("both mesh and fragment shaders are required")
+	}
+
+	id := C.boulder_create_material_pipeline_async(
+		C.ShaderModuleID(config.MeshShader.ID),
+		C.ShaderModuleID(config.FragShader.ID),
+	)
+
+	if id == 0 {
+		return nil, lastError("failed to create material pipeline")
+	}
+
+	p := &Pipeline{
+		ID:         PipelineID(id),
+		MeshShader: config.MeshShader,
+		FragShader: config.FragShader,
+		engine:     e,
+	}
+	e.track(p, stagePipelines)
+	return p, nil
+}
+
+// Status returns whether the pipeline finished compiling
+func (p *Pipeline) Status() CompileStatus {
+	if p.engine == nil || !p.engine.initialized {
+		return CompileFailed
+	}
+	return CompileStatus(C.boulder_get_pipeline_status(C.PipelineID(p.ID)))
+}
+
+// Ready returns whether the pipeline compiled and is drawing
+func (p *Pipeline) Ready() bool {
+	return p.Status() == CompileReady
+}
+
+// GetCompileError returns why an async pipeline failed, with the compiler's output if one of
+// its shaders didn't compile, or nil if it hasn't failed
+func (p *Pipeline) GetCompileError() error {
+	if p.engine == nil || !p.engine.initialized {
+		return nil
+	}
+
+	var code C.int
+	length := C.boulder_get_pipeline_error(C.PipelineID(p.ID), &code, nil, 0)
+	if length == 0 {
+		return nil
+	}
+	buf := make([]C.char, length+1)
+	C.boulder_get_pipeline_error(C.PipelineID(p.ID), &code, &buf[0], C.uint32_t(len(buf)))
+	return &Error{Code: ErrorCode(code), Op: "failed to compile material pipeline", Message: C.GoString(&buf[0])}
+}
+
+// OnReady calls fn from Engine.Update once the pipeline finished compiling, with whether
+// it succeeded. fn is called right away if it already has.
+func (p *Pipeline) OnReady(fn func(ready bool)) {
+	if status := p.Status(); status != CompilePending {
+		fn(status == CompileReady)
+		return
+	}
+
+	if p.engine.readyCallbacks == nil {
+		p.engine.readyCallbacks = make(map[PipelineID][]func(bool))
+	}
+	p.engine.readyCallbacks[p.ID] = append(p.engine.readyCallbacks[p.ID], fn)
+}
+
+// PendingCompiles returns how many async shader and pipeline compiles are still running
+func (e *Engine) PendingCompiles() int {
+	if !e.initialized {
+		return 0
+	}
+	return int(C.boulder_get_pending_compiles())
+}
+
+// WaitCompiles blocks until every async compile finished
+func (e *Engine) WaitCompiles() {
+	if !e.initialized {
+		return
+	}
+	C.boulder_wait_async_compiles()
+	e.runReadyCallbacks()
+}
+
+func (e *Engine) runReadyCallbacks() {
+	for id, callbacks := range e.readyCallbacks {
+		status := CompileStatus(C.boulder_get_pipeline_status(C.PipelineID(id)))
+		if status == CompilePending {
+			continue
+		}
+		delete(e.readyCallbacks, id)
+		for _, fn := range callbacks {
+			runCallback("OnReady", func() { fn(status == CompileReady) })
+		}
+	}
+}
+
+// WarmUpMaterials starts compiling material pipelines in the background, so they are
+// ready before gameplay needs them. Keep rendering a loading screen and check Progress.
+func (e *Engine) WarmUpMaterials(sources []MaterialSource) (*WarmUp, error) {
+	if !e.initialized {
+		return nil, errNotInitialized
+	}
+
+	w := &WarmUp{engine: e}
+	for _, src := range sources {
+		mesh, err := e.CompileShaderAsync(src.MeshSource, ShaderKindMesh, src.Name+".mesh", src.Defines)
+		if err != nil {
+			return w, err
+		}
+		w.Shaders = append(w.Shaders, mesh)
+
+		frag, err := e.CompileShaderAsync(src.FragSource, ShaderKindFragment, src.Name+".frag", src.Defines)
+		if err != nil {
+			return w, err
+		}
+		w.Shaders = append(w.Shaders, frag)
+
+		pipeline, err := e.CreateMaterialPipelineAsync(PipelineConfig{MeshShader: mesh, FragShader: frag})
+		if err != nil {
+			return w, err
+		}
+		w.Pipelines = append(w.Pipelines, pipeline)
+	}
+
+	return w, nil
+}
+
+// Progress returns the fraction of pipelines that finished compiling, from 0 to 1
+func (w *WarmUp) Progress() float32 {
+	if len(w.Pipelines) == 0 {
+		return 1
+	}
+
+	done := 0
+	for _, pipeline := range w.Pipelines {
+		if pipeline.Status() != CompilePending {
+			done++
+		}
+	}
+	return float32(done) / float32(len(w.Pipelines))
+}
+
+// Done returns whether every pipeline finished compiling
+func (w *WarmUp) Done() bool {
+	return w.Progress() == 1
+}
+
+// Wait blocks until every pipeline finished compiling and returns an error if any failed
+func (w *WarmUp) Wait() error {
+	w.engine.WaitCompiles()
+
+	for _, pipeline := range w.Pipelines {
+		if pipeline.Ready() {
+			continue
+		}
+		if err := pipeline.GetCompileError(); err != nil {
+			return err
+		}
+		return errors.New("material pipeline was destroyed before it compiled")
+	}
+	return nil
+}
+
+// ReleaseShaders destroys the warm-up's shader modules, which the pipelines no longer need
+// once they are ready
+func (w *WarmUp) ReleaseShaders() {
+	for _, shader := range w.Shaders {
+		shader.Destroy()
+	}
+	w.Shaders = nil
+}
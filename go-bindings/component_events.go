@@ -0,0 +1,199 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"unsafe"
+)
+
+// Component identifies a native component type
+type Component int
+
+const (
+	ComponentTransform      Component = 0
+	ComponentPhysicsBody    Component = 1
+	ComponentModel          Component = 2
+	ComponentBuoyancyVolume Component = 3
+	ComponentBuoyant        Component = 4
+	ComponentSoftBody       Component = 5
+	ComponentCollider       Component = 6
+
+	componentCount = 7
+
+	componentTrackChanges = 1 << 3 // Watch bit recording change ticks without events
+)
+
+// ComponentEventKind is what happened to a component
+type ComponentEventKind int
+
+const (
+	ComponentAdded   ComponentEventKind = 0
+	ComponentRemoved ComponentEventKind = 1
+	ComponentChanged ComponentEventKind = 2 // Includes being set when added
+)
+
+// ComponentEvent reports a component being added, removed or changed
+type ComponentEvent struct {
+	Entity    EntityID
+	Component Component
+	Kind      ComponentEventKind
+	Tick      uint64 // Change tick the event happened at
+}
+
+// ComponentCallback is called for component events
+type ComponentCallback func(event ComponentEvent)
+
+type componentEventState struct {
+	callbacks [componentCount][3][]ComponentCallback
+	tracked   [componentCount]bool
+}
+
+func (w *World) componentEvents() *componentEventState {
+	if w.components == nil {
+		w.components = &componentEventState{}
+	}
+	return w.components
+}
+
+// OnComponentAdded calls fn whenever the component is added to an entity. Callbacks run
+// from DispatchComponentEvents.
+func (w *World) OnComponentAdded(component Component, fn ComponentCallback) error {
+	return w.onComponent(component, ComponentAdded, fn)
+}
+
+// OnComponentRemoved calls fn whenever the component is removed, including when its
+// entity is destroyed
+func (w *World) OnComponentRemoved(component Component, fn ComponentCallback) error {
+	return w.onComponent(component, ComponentRemoved, fn)
+}
+
+// OnComponentChanged calls fn at most once per change tick for each entity whose component
+// changed, and enables change tracking for the component
+func (w *World) OnComponentChanged(component Component, fn ComponentCallback) error {
+	return w.onComponent(component, ComponentChanged, fn)
+}
+
+// EnableChangeTracking records change ticks for a component without a callback, for use
+// with GetChangedEntities
+func (w *World) EnableChangeTracking(component Component) error {
+	if component < 0 || component >= componentCount {
+		return errors.New("invalid component")
+	}
+
+	w.componentEvents().tracked[component] = true
+	return w.watchComponent(component)
+}
+
+// DispatchComponentEvents runs the callbacks for component events queued since the last
+// call (call every frame after Engine.Update)
+func (w *World) DispatchComponentEvents() {
+	if !w.ready() {
+		return
+	}
+
+	state := w.componentEvents()
+	var event C.ComponentEvent
+	for C.boulder_poll_component_event(&event) == 1 {
+		e := ComponentEvent{
+			Entity:    EntityID(event.entity),
+			Component: Component(event.component),
+			Kind:      ComponentEventKind(event.kind),
+			Tick:      uint64(event.tick),
+		}
+		if e.Component < 0 || e.Component >= componentCount || e.Kind < 0 || e.Kind > ComponentChanged {
+			continue
+		}
+		for _, fn := range state.callbacks[e.Component][e.Kind] {
+			runCallback("component event", func() { fn(e) })
+		}
+	}
+}
+
+// GetChangeTick returns the current change tick. It advances at the start of each
+// Engine.Update.
+func (w *World) GetChangeTick() uint64 {
+	if !w.ready() {
+		return 0
+	}
+	return uint64(C.boulder_get_change_tick())
+}
+
+// GetChangedEntities returns the entities whose component changed at or after tick. The
+// component must have change tracking enabled.
+func (w *World) GetChangedEntities(component Component, tick uint64) ([]EntityID, error) {
+	if !w.ready() {
+		return nil, errNotInitialized
+	}
+
+	count := C.boulder_get_changed_entities(C.int(component), C.uint64_t(tick), nil, 0)
+	if count < 0 {
+		return nil, errors.New("invalid component")
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	ids := make([]C.EntityID, count)
+	count = C.boulder_get_changed_entities(C.int(component), C.uint64_t(tick),
+		(*C.EntityID)(unsafe.Pointer(&ids[0])), C.uint32_t(len(ids)))
+
+	entities := make([]EntityID, 0, min(int(count), len(ids)))
+	for _, id := range ids[:min(int(count), len(ids))] {
+		entities = append(entities, EntityID(id))
+	}
+	return entities, nil
+}
+
+// GetChangeTick returns the tick the component last changed at. ok is false if it hasn't
+// changed since change tracking was enabled.
+func (e *Entity) GetChangeTick(component Component) (tick uint64, ok bool) {
+	if !e.world.ready() {
+		return 0, false
+	}
+
+	var t C.uint64_t
+	if C.boulder_get_component_change_tick(C.EntityID(e.ID), C.int(component), &t) != 0 {
+		return 0, false
+	}
+	return uint64(t), true
+}
+
+func (w *World) onComponent(component Component, kind ComponentEventKind, fn ComponentCallback) error {
+	if component < 0 || component >= componentCount {
+		return errors.New("invalid component")
+	}
+	if fn == nil {
+		return errors.New("component callback is nil")
+	}
+
+	state := w.componentEvents()
+	state.callbacks[component][kind] = append(state.callbacks[component][kind], fn)
+	return w.watchComponent(component)
+}
+
+// watchComponent tells the engine which events to queue for a component
+func (w *World) watchComponent(component Component) error {
+	defer lockThread()()
+	if !w.ready() {
+		return errNotInitialized
+	}
+
+	state := w.componentEvents()
+	kinds := 0
+	for kind, callbacks := range state.callbacks[component] {
+		if len(callbacks) > 0 {
+			kinds |= 1 << kind
+		}
+	}
+	if state.tracked[component] {
+		kinds |= componentTrackChanges
+	}
+
+	if ret := C.boulder_watch_component(C.int(component), C.int(kinds)); ret != 0 {
+		return lastError("failed to watch component")
+	}
+	return nil
+}
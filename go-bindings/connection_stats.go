@@ -0,0 +1,69 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"time"
+)
+
+// ConnectionStats describes the quality of a connection's link, e.g. for a ping indicator
+type ConnectionStats struct {
+	RTT               time.Duration
+	PacketLoss        float32 // Percent of packets lost in the worse direction, -1 until known
+	SendRate          float32 // Bytes per second
+	ReceiveRate       float32
+	SendPacketRate    float32 // Packets per second
+	ReceivePacketRate float32
+	Bandwidth         float32       // Estimated bytes per second the link can send
+	QueuedBytes       int           // Waiting to be sent, reliable and unreliable
+	UnackedBytes      int           // Reliable bytes sent but not yet acknowledged
+	QueueTime         time.Duration // How long a message sent now would wait to go out
+}
+
+// ConnectionStatsPlugin is implemented by transport plugins that can measure their
+// connections; GetConnectionStats fails for connections of plugins that don't
+type ConnectionStatsPlugin interface {
+	ConnectionStats(conn TransportConn) (ConnectionStats, error)
+}
+
+// GetConnectionStats returns the round trip time, packet loss, data rates and queued bytes
+// of a connection. The figures are GameNetworkingSockets' own running estimates, so
+// calling it every frame is cheap.
+func (ns *NetworkSession) GetConnectionStats(conn ConnectionHandle) (ConnectionStats, error) {
+	defer lockThread()()
+	if ns.handle == nil {
+		return ConnectionStats{}, errSessionNotInitialized
+	}
+
+	if pc, ok := ns.lookupPlugin(conn); ok {
+		if plugin, ok := pc.plugin.(ConnectionStatsPlugin); ok {
+			return plugin.ConnectionStats(pc.conn)
+		}
+		return ConnectionStats{}, errors.New("transport " + pc.plugin.Name() + " has no connection stats")
+	}
+
+	var s C.ConnectionStats
+	if C.boulder_get_connection_stats(ns.handle, C.ConnectionHandle(conn), &s) != 0 {
+		return ConnectionStats{}, lastError("failed to get connection stats")
+	}
+
+	loss := float32(-1)
+	if quality := min(float32(s.qualityLocal), float32(s.qualityRemote)); quality >= 0 {
+		loss = (1 - quality) * 100
+	}
+	return ConnectionStats{
+		RTT:               time.Duration(s.pingMs) * time.Millisecond,
+		PacketLoss:        loss,
+		SendRate:          float32(s.outBytesPerSec),
+		ReceiveRate:       float32(s.inBytesPerSec),
+		SendPacketRate:    float32(s.outPacketsPerSec),
+		ReceivePacketRate: float32(s.inPacketsPerSec),
+		Bandwidth:         float32(s.sendRateBytesPerSec),
+		QueuedBytes:       int(s.pendingUnreliableBytes) + int(s.pendingReliableBytes),
+		UnackedBytes:      int(s.sentUnackedReliableBytes),
+		QueueTime:         time.Duration(s.queueTimeUsec) * time.Microsecond,
+	}, nil
+}
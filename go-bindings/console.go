@@ -0,0 +1,175 @@
+package boulder
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// ConsoleCommand runs a console command with its arguments and returns what to print
+type ConsoleCommand func(args []string) (string, error)
+
+type consoleCommand struct {
+	help string
+	run  ConsoleCommand
+}
+
+// commandTable returns the engine's console commands, registering the built-in ones the
+// first time
+func (e *Engine) commandTable() map[string]*consoleCommand {
+	if e.commands == nil {
+		e.commands = map[string]*consoleCommand{
+			"help":  {help: "List commands", run: e.helpCommand},
+			"cvars": {help: "List cvars with their values", run: e.cvarsCommand},
+			"get":   {help: "get <cvar> - Print a cvar's value", run: e.getCommand},
+			"set":   {help: "set <cvar> <value> - Change a cvar", run: e.setCommand},
+			"stats": {help: "Print world, frame and memory stats", run: e.statsCommand},
+		}
+	}
+	return e.commands
+}
+
+// RegisterCommand adds a console command, run by ExecuteCommand and the remote console.
+// help is shown by the help command.
+func (e *Engine) RegisterCommand(name, help string, run ConsoleCommand) error {
+	if name == "" || strings.ContainsFunc(name, unicode.IsSpace) {
+		return errors.New("invalid command name: " + name)
+	}
+	if run == nil {
+		return errors.New("command function is nil")
+	}
+	commands := e.commandTable()
+	if _, ok := commands[name]; ok {
+		return errors.New("command already registered: " + name)
+	}
+
+	commands[name] = &consoleCommand{help: help, run: run}
+	return nil
+}
+
+// ExecuteCommand runs a console command line, e.g. "set perf_hud 1". Arguments are split
+// on spaces, and double quotes group words into one. A cvar's name on its own prints its
+// value and followed by a value sets it. Commands run on the calling goroutine, so call it
+// from the game loop.
+func (e *Engine) ExecuteCommand(line string) (string, error) {
+	args, err := splitCommandLine(line)
+	if err != nil || len(args) == 0 {
+		return "", err
+	}
+
+	name, args := args[0], args[1:]
+	if command, ok := e.commandTable()[name]; ok {
+		var output string
+		err := errors.New("command " + name + " panicked")
+		runCallback("Command "+name, func() { output, err = command.run(args) })
+		return output, err
+	}
+	if _, ok := e.cvarTable()[name]; ok {
+		if len(args) == 0 {
+			return e.getCommand([]string{name})
+		}
+		return e.setCommand(append([]string{name}, args...))
+	}
+	return "", errors.New("unknown command: " + name)
+}
+
+func (e *Engine) helpCommand(args []string) (string, error) {
+	names := make([]string, 0, len(e.commandTable()))
+	for name := range e.commands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%-12s %s\n", name, e.commands[name].help)
+	}
+	b.WriteString("Type a cvar's name to print it, or its name and a value to set it")
+	return b.String(), nil
+}
+
+func (e *Engine) cvarsCommand(args []string) (string, error) {
+	lines := make([]string, 0, len(e.cvarTable()))
+	for _, cvar := range e.GetCVars() {
+		lines = append(lines, fmt.Sprintf("%s = %q (default %q) - %s", cvar.Name, cvar.Value, cvar.Default, cvar.Description))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (e *Engine) getCommand(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("usage: get <cvar>")
+	}
+	value, ok := e.GetCVar(args[0])
+	if !ok {
+		return "", errors.New("unknown cvar: " + args[0])
+	}
+	return fmt.Sprintf("%s = %q", args[0], value), nil
+}
+
+func (e *Engine) setCommand(args []string) (string, error) {
+	if len(args) < 2 {
+		return "", errors.New("usage: set <cvar> <value>")
+	}
+	value := strings.Join(args[1:], " ")
+	if err := e.SetCVar(args[0], value); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s = %q", args[0], value), nil
+}
+
+func (e *Engine) statsCommand(args []string) (string, error) {
+	var b strings.Builder
+	if world := e.GetActiveWorld(); world != nil && e.initialized {
+		fmt.Fprintf(&b, "World: %d entities, %d bodies, %d colliders, %d models\n",
+			world.QueryCount(WithTransform()), world.QueryCount(WithPhysicsBody()),
+			world.QueryCount(WithCollider()), world.QueryCount(WithModel()))
+
+		renderer := NewRenderer(e)
+		times := renderer.GetFrameTimes()
+		stats := renderer.GetRenderStats()
+		fmt.Fprintf(&b, "Frame: CPU %.2f ms, GPU %.2f ms, %d draws, %s triangles\n",
+			msOf(times.CPU), msOf(times.GPU), stats.DrawCalls, formatCount(stats.Triangles))
+		fmt.Fprintf(&b, "GPU memory: %s in %d allocations\n", formatBytes(stats.DeviceMemory), stats.DeviceAllocations)
+	} else {
+		b.WriteString("World: none active\n")
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	fmt.Fprintf(&b, "Go: %s heap, %d goroutines, %d GCs", formatBytes(mem.HeapAlloc), runtime.NumGoroutine(), mem.NumGC)
+	return b.String(), nil
+}
+
+// splitCommandLine splits a command line on spaces, keeping double quoted words together
+func splitCommandLine(line string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord, quoted := false, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case unicode.IsSpace(r) && !quoted:
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
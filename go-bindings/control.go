@@ -0,0 +1,120 @@
+package boulder
+
+import "bytes"
+
+// Control messages are engine-internal messages (clock sync, replication, ...) that share
+// a connection with game data. They start with a reserved marker and are consumed by
+// PollEvent instead of being returned as MessageEvents.
+var controlMarker = []byte{0xB0, 0x1D, 0xE5, 0xC7}
+
+// controlType identifies the kind of a control message
+type controlType byte
+
+const (
+	controlClockPing controlType = 1
+	controlClockPong controlType = 2
+	controlSpawn     controlType = 3
+	controlDespawn   controlType = 4
+
+	controlBaselineChunk controlType = 5
+	controlBaselineAck   controlType = 6
+
+	controlRollbackInput    controlType = 7
+	controlRollbackChecksum controlType = 8
+
+	controlHealth controlType = 9
+
+	controlSequenced controlType = 10 // Unreliable message on a sequenced channel
+
+	controlStateUpdate controlType = 11
+	controlStateAck    controlType = 12
+
+	controlKeepAlive    controlType = 13
+	controlResumeToken  controlType = 14
+	controlResume       controlType = 15
+	controlResumeResult controlType = 16
+
+	controlDrain controlType = 17
+
+	controlPlayerIdentity controlType = 18
+
+	controlSpectate       controlType = 19
+	controlSpectateResult controlType = 20
+)
+
+// controlHandler processes a control message received on a connection
+type controlHandler func(conn ConnectionHandle, payload []byte, timestamp float64)
+
+// connectionObserver is notified of connection events before they are returned to the game
+type connectionObserver func(event NetworkEvent)
+
+// isControlMessage reports whether data is an engine-internal control message
+func isControlMessage(data []byte) bool {
+	return len(data) > len(controlMarker) && bytes.HasPrefix(data, controlMarker)
+}
+
+// encodeControl frames a control message
+func encodeControl(kind controlType, payload []byte) []byte {
+	buf := make([]byte, 0, len(controlMarker)+1+len(payload))
+	buf = append(buf, controlMarker...)
+	buf = append(buf, byte(kind))
+	return append(buf, payload...)
+}
+
+// decodeControl splits a control message into its kind and payload
+func decodeControl(data []byte) (controlType, []byte) {
+	return controlType(data[len(controlMarker)]), data[len(controlMarker)+1:]
+}
+
+// sendControl sends an engine-internal control message to a connection
+func (ns *NetworkSession) sendControl(conn ConnectionHandle, kind controlType, payload []byte, reliable bool) error {
+	if ns.handle == nil {
+		return errSessionNotInitialized
+	}
+
+	return ns.sendRaw(conn, encodeControl(kind, payload), reliable)
+}
+
+// handleControl dispatches a received control message
+func (ns *NetworkSession) handleControl(conn ConnectionHandle, data []byte, timestamp float64) {
+	kind, payload := decodeControl(data)
+
+	switch kind {
+	case controlClockPing, controlClockPong:
+		ns.clock.handle(ns, conn, kind, payload, timestamp)
+	case controlKeepAlive:
+		// Arriving was enough to reset the connection's timeout
+	case controlResumeToken, controlResume, controlResumeResult:
+		ns.handleResume(conn, kind, payload)
+	case controlDrain:
+		ns.handleDrain(conn, payload)
+	default:
+		if handler, ok := ns.controlHandlers[kind]; ok {
+			handler(conn, payload, timestamp)
+		}
+	}
+}
+
+// setControlHandler registers the handler for a kind of control message (nil removes it)
+func (ns *NetworkSession) setControlHandler(kind controlType, handler controlHandler) {
+	if ns.controlHandlers == nil {
+		ns.controlHandlers = make(map[controlType]controlHandler)
+	}
+	if handler == nil {
+		delete(ns.controlHandlers, kind)
+		return
+	}
+	ns.controlHandlers[kind] = handler
+}
+
+// addConnectionObserver registers a function called for every connect and disconnect event
+func (ns *NetworkSession) addConnectionObserver(observer connectionObserver) {
+	ns.connectionObservers = append(ns.connectionObservers, observer)
+}
+
+// notifyConnectionObservers forwards a connection event to the registered observers
+func (ns *NetworkSession) notifyConnectionObservers(event NetworkEvent) {
+	for _, observer := range ns.connectionObservers {
+		observer(event)
+	}
+}
@@ -0,0 +1,269 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"time"
+)
+
+// ControllerCapability is a feature a controller has
+type ControllerCapability uint32
+
+const (
+	ControllerRumble           ControllerCapability = 1
+	ControllerTriggerRumble    ControllerCapability = 2  // Motors in the triggers (Xbox One and later)
+	ControllerLED              ControllerCapability = 4  // RGB light (DualShock 4, DualSense)
+	ControllerAdaptiveTriggers ControllerCapability = 8  // Trigger resistance (DualSense)
+	ControllerHDRumble         ControllerCapability = 16 // Linear actuators with a low and a high band (Switch)
+	ControllerGyro             ControllerCapability = 32
+	ControllerAccel            ControllerCapability = 64
+)
+
+// Controller is a connected gamepad. It stays valid until it disconnects, after which its
+// methods fail or do nothing.
+type Controller struct {
+	ID     uint32
+	engine *Engine
+}
+
+// GetControllers returns the connected controllers in the order they connected.
+// Window.PollEvents picks up controllers as they are plugged in and out.
+func (i *Input) GetControllers() []*Controller {
+	if !i.engine.initialized {
+		return nil
+	}
+
+	count := int(C.boulder_get_controller_count())
+	controllers := make([]*Controller, 0, count)
+	for index := 0; index < count; index++ {
+		if id := uint32(C.boulder_get_controller_id(C.int(index))); id != 0 {
+			controllers = append(controllers, &Controller{ID: id, engine: i.engine})
+		}
+	}
+	return controllers
+}
+
+// GetName returns the controller's product name
+func (c *Controller) GetName() string {
+	if !c.engine.initialized {
+		return ""
+	}
+
+	var buf [256]C.char
+	length := C.boulder_get_controller_name(C.uint32_t(c.ID), &buf[0], C.uint32_t(len(buf)))
+	return C.GoStringN(&buf[0], C.int(min(int(length), len(buf)-1)))
+}
+
+// GetCapabilities returns the features the controller has, 0 once it disconnected
+func (c *Controller) GetCapabilities() ControllerCapability {
+	if !c.engine.initialized {
+		return 0
+	}
+	return ControllerCapability(C.boulder_get_controller_capabilities(C.uint32_t(c.ID)))
+}
+
+// Has returns whether the controller has a feature
+func (c *Controller) Has(capability ControllerCapability) bool {
+	return c.GetCapabilities()&capability == capability
+}
+
+// ControllerButton is a controller button, named by position so the layout matches
+// every brand: ButtonSouth is A on Xbox, cross on PlayStation and B on Switch
+type ControllerButton int
+
+const (
+	ButtonSouth         ControllerButton = 0
+	ButtonEast          ControllerButton = 1
+	ButtonWest          ControllerButton = 2
+	ButtonNorth         ControllerButton = 3
+	ButtonBack          ControllerButton = 4
+	ButtonGuide         ControllerButton = 5
+	ButtonStart         ControllerButton = 6
+	ButtonLeftStick     ControllerButton = 7
+	ButtonRightStick    ControllerButton = 8
+	ButtonLeftShoulder  ControllerButton = 9
+	ButtonRightShoulder ControllerButton = 10
+	ButtonDPadUp        ControllerButton = 11
+	ButtonDPadDown      ControllerButton = 12
+	ButtonDPadLeft      ControllerButton = 13
+	ButtonDPadRight     ControllerButton = 14
+)
+
+// ControllerAxis is a stick direction or trigger
+type ControllerAxis int
+
+const (
+	AxisLeftX        ControllerAxis = 0
+	AxisLeftY        ControllerAxis = 1 // Positive is down
+	AxisRightX       ControllerAxis = 2
+	AxisRightY       ControllerAxis = 3
+	AxisLeftTrigger  ControllerAxis = 4
+	AxisRightTrigger ControllerAxis = 5
+)
+
+// IsButtonPressed checks if a button is held
+func (c *Controller) IsButtonPressed(button ControllerButton) bool {
+	if !c.engine.initialized {
+		return false
+	}
+	return C.boulder_get_controller_button(C.uint32_t(c.ID), C.int(button)) != 0
+}
+
+// GetAxis returns a stick axis from -1 to 1 or a trigger from 0 to 1
+func (c *Controller) GetAxis(axis ControllerAxis) float32 {
+	if !c.engine.initialized {
+		return 0
+	}
+	return float32(C.boulder_get_controller_axis(C.uint32_t(c.ID), C.int(axis)))
+}
+
+// Rumble runs the low frequency (left) and high frequency (right) motors at 0 to 1 for a
+// duration. Playing haptic effects take the motors back when they change.
+func (c *Controller) Rumble(low, high float32, duration time.Duration) error {
+	defer lockThread()()
+	if !c.engine.initialized {
+		return errNotInitialized
+	}
+	ret := C.boulder_rumble(C.uint32_t(c.ID), C.float(low), C.float(high), C.uint32_t(duration.Milliseconds()))
+	return apiError(ret, "controller has no rumble")
+}
+
+// RumbleTriggers runs the motors in the triggers at 0 to 1 for a duration
+func (c *Controller) RumbleTriggers(left, right float32, duration time.Duration) error {
+	defer lockThread()()
+	if !c.engine.initialized {
+		return errNotInitialized
+	}
+	ret := C.boulder_rumble_triggers(C.uint32_t(c.ID), C.float(left), C.float(right), C.uint32_t(duration.Milliseconds()))
+	return apiError(ret, "controller has no trigger rumble")
+}
+
+// SetLEDColor changes the color of the controller's light, e.g. to tell players apart.
+// Alpha is ignored.
+func (c *Controller) SetLEDColor(color UIColor) error {
+	defer lockThread()()
+	if !c.engine.initialized {
+		return errNotInitialized
+	}
+	ret := C.boulder_set_controller_led(C.uint32_t(c.ID), C.float(color.R), C.float(color.G), C.float(color.B))
+	return apiError(ret, "controller has no LED")
+}
+
+// Trigger is the left or right trigger
+type Trigger int
+
+const (
+	TriggerLeft  Trigger = 0
+	TriggerRight Trigger = 1
+)
+
+// TriggerEffectMode is how an adaptive trigger pushes back
+type TriggerEffectMode int
+
+const (
+	TriggerEffectOff        TriggerEffectMode = 0
+	TriggerEffectResistance TriggerEffectMode = 1 // Resists from Start to the end of the pull
+	TriggerEffectSection    TriggerEffectMode = 2 // Resists between Start and End, then gives like a trigger break
+	TriggerEffectVibration  TriggerEffectMode = 3 // Vibrates at Frequency past Start
+)
+
+// TriggerEffect is an adaptive trigger setting. Start and End are 0 to 1 of the pull.
+type TriggerEffect struct {
+	Mode       TriggerEffectMode
+	Start, End float32
+	Strength   float32 // 0 to 1
+	Frequency  float32 // Hz, for TriggerEffectVibration
+}
+
+// SetTriggerEffect sets how a trigger resists (DualSense). It stays until replaced;
+// TriggerEffect{} turns it off.
+func (c *Controller) SetTriggerEffect(trigger Trigger, effect TriggerEffect) error {
+	defer lockThread()()
+	if !c.engine.initialized {
+		return errNotInitialized
+	}
+
+	cEffect := C.TriggerEffect{
+		mode:      C.int(effect.Mode),
+		start:     C.float(effect.Start),
+		end:       C.float(effect.End),
+		strength:  C.float(effect.Strength),
+		frequency: C.float(effect.Frequency),
+	}
+	ret := C.boulder_set_trigger_effect(C.uint32_t(c.ID), C.int(trigger), &cEffect)
+	return apiError(ret, "controller has no adaptive triggers")
+}
+
+// HapticTarget is what a haptic effect shakes
+type HapticTarget int
+
+const (
+	HapticBody         HapticTarget = 0 // The main motors
+	HapticLeftTrigger  HapticTarget = 1
+	HapticRightTrigger HapticTarget = 2
+)
+
+// HapticEffect describes a vibration with an envelope: it ramps from AttackLevel to
+// Strength over Attack, holds, and ramps to FadeLevel over the last Fade of Duration.
+// Frequency decides how a body effect is split between the low and high frequency motors:
+// 40 Hz and below only drives the low one, 320 Hz and above only the high one, and 0 both
+// equally. On Switch controllers these are the HD rumble bands.
+type HapticEffect struct {
+	Target      HapticTarget
+	Strength    float32       // 0 to 1
+	Frequency   float32       // Hz
+	Duration    time.Duration // Including Attack and Fade; 0 plays until stopped
+	Attack      time.Duration
+	AttackLevel float32
+	Fade        time.Duration
+	FadeLevel   float32
+}
+
+// HapticID identifies a playing haptic effect
+type HapticID uint32
+
+// PlayHaptic starts an effect. Effects playing on a controller add up, so short hits can
+// go on top of a long engine rumble.
+func (c *Controller) PlayHaptic(effect HapticEffect) (HapticID, error) {
+	if !c.engine.initialized {
+		return 0, errNotInitialized
+	}
+
+	cEffect := C.HapticEffect{
+		target:      C.int(effect.Target),
+		strength:    C.float(effect.Strength),
+		frequency:   C.float(effect.Frequency),
+		duration:    C.float(effect.Duration.Seconds()),
+		attackTime:  C.float(effect.Attack.Seconds()),
+		attackLevel: C.float(effect.AttackLevel),
+		fadeTime:    C.float(effect.Fade.Seconds()),
+		fadeLevel:   C.float(effect.FadeLevel),
+	}
+	id := HapticID(C.boulder_play_haptic_effect(C.uint32_t(c.ID), &cEffect))
+	if id == 0 {
+		if err := LastNativeError(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("controller cannot play the effect")
+	}
+	return id, nil
+}
+
+// StopHaptic stops an effect before it ends
+func (c *Controller) StopHaptic(id HapticID) {
+	if !c.engine.initialized || id == 0 {
+		return
+	}
+	C.boulder_stop_haptic_effect(C.uint32_t(c.ID), C.uint32_t(id))
+}
+
+// StopHaptics stops every effect playing on the controller
+func (c *Controller) StopHaptics() {
+	if !c.engine.initialized {
+		return
+	}
+	C.boulder_stop_haptic_effect(C.uint32_t(c.ID), 0)
+}
@@ -0,0 +1,666 @@
+package boulder
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Cutscene timelines are JSON files of camera keyframes and cues. Times are in seconds from
+// the start. Each cue is a command: a name followed by space separated arguments, as in
+// dialogue scripts. Entities are named as in the world's scene file, or by ID.
+//
+//	{"id": "intro", "camera": [
+//	  {"time": 0, "position": [0, 2, 8], "target": [0, 1, 0], "fov": 50},
+//	  {"time": 6, "position": [4, 3, 4], "look": "guard", "easing": "inOutCubic"}],
+//	 "cues": [
+//	  {"time": 0, "command": "letterbox 0.12 0.5"},
+//	  {"time": 0, "command": "fade in 1"},
+//	  {"time": 1, "command": "animate guard wave 0.2"},
+//	  {"time": 1, "command": "audio guard_greeting"},
+//	  {"time": 11, "command": "fade out 1"},
+//	  {"time": 12, "command": "open_gate", "onSkip": true}]}
+//
+// Built in commands: animate <entity> <clip> [crossfade], stop_animation <entity> [fade],
+// audio <cue> [args...], fade in|out <seconds> [r g b], letterbox <height> [seconds] with
+// the bars' height a fraction of the screen's (0 removes them).
+
+// CutsceneCameraKey is where the camera is at a point in a timeline. Between keys the
+// camera moves from one to the next.
+type CutsceneCameraKey struct {
+	Time     float32    `json:"time"`
+	Position [3]float32 `json:"position"`
+	Target   [3]float32 `json:"target"`
+	Look     string     `json:"look,omitempty"`   // Entity to look at instead of Target, followed as it moves
+	FOV      float32    `json:"fov,omitempty"`    // Degrees; 0 keeps the previous key's
+	Easing   string     `json:"easing,omitempty"` // Of the move into this key; linear by default
+	Cut      bool       `json:"cut,omitempty"`    // Jump to this key instead of moving to it
+}
+
+// CutsceneCue is a command run at a point in a timeline
+type CutsceneCue struct {
+	Time    float32 `json:"time"`
+	Command string  `json:"command"`
+	OnSkip  bool    `json:"onSkip,omitempty"` // Also run when the cutscene is skipped past it
+}
+
+// CutsceneTimeline is a cutscene asset
+type CutsceneTimeline struct {
+	ID          string              `json:"id"`
+	Duration    float32             `json:"duration,omitempty"` // 0 ends with the last key or cue
+	Unskippable bool                `json:"unskippable,omitempty"`
+	Camera      []CutsceneCameraKey `json:"camera,omitempty"`
+	Cues        []CutsceneCue       `json:"cues,omitempty"`
+}
+
+var cutsceneEasings = map[string]Easing{
+	"":           EaseLinear,
+	"linear":     EaseLinear,
+	"inQuad":     EaseInQuad,
+	"outQuad":    EaseOutQuad,
+	"inOutQuad":  EaseInOutQuad,
+	"inCubic":    EaseInCubic,
+	"outCubic":   EaseOutCubic,
+	"inOutCubic": EaseInOutCubic,
+	"outBack":    EaseOutBack,
+	"outBounce":  EaseOutBounce,
+}
+
+// ParseCutscene parses a cutscene timeline, sorting its keys and cues by time
+func ParseCutscene(data []byte) (*CutsceneTimeline, error) {
+	var t CutsceneTimeline
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	if t.ID == "" {
+		return nil, errors.New("cutscene needs an id")
+	}
+
+	end := float32(0)
+	for _, key := range t.Camera {
+		if key.Time < 0 {
+			return nil, errors.New("cutscene " + t.ID + " has a camera key before 0")
+		}
+		if _, ok := cutsceneEasings[key.Easing]; !ok {
+			return nil, errors.New("cutscene " + t.ID + " has unknown easing: " + key.Easing)
+		}
+		end = max(end, key.Time)
+	}
+	for _, cue := range t.Cues {
+		if cue.Time < 0 {
+			return nil, errors.New("cutscene " + t.ID + " has a cue before 0")
+		}
+		if strings.TrimSpace(cue.Command) == "" {
+			return nil, errors.New("cutscene " + t.ID + " has a cue without a command")
+		}
+		end = max(end, cue.Time)
+	}
+	if t.Duration <= 0 {
+		t.Duration = end
+	}
+
+	slices.SortStableFunc(t.Camera, func(a, b CutsceneCameraKey) int { return compareTimes(a.Time, b.Time) })
+	slices.SortStableFunc(t.Cues, func(a, b CutsceneCue) int { return compareTimes(a.Time, b.Time) })
+
+	// Keys without a field of view keep the one before
+	for i := 1; i < len(t.Camera); i++ {
+		if t.Camera[i].FOV == 0 {
+			t.Camera[i].FOV = t.Camera[i-1].FOV
+		}
+	}
+	return &t, nil
+}
+
+// LoadCutscene loads a cutscene timeline from a JSON file
+func LoadCutscene(path string) (*CutsceneTimeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCutscene(data)
+}
+
+func compareTimes(a, b float32) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// CutsceneCommandFunc runs a cue's command
+type CutsceneCommandFunc func(args []string)
+
+// CutsceneEventKind identifies a cutscene event
+type CutsceneEventKind int
+
+const (
+	CutsceneStarted   CutsceneEventKind = iota
+	CutsceneCompleted                   // Played to the end, skipped or stopped
+	CutsceneAudioCue                    // An audio command for the game's audio to play
+)
+
+// CutsceneEvent reports a cutscene starting, completing or cueing audio
+type CutsceneEvent struct {
+	Kind     CutsceneEventKind
+	Cutscene string
+	Skipped  bool     // For CutsceneCompleted: ended by Skip or Stop
+	Cue      string   // For CutsceneAudioCue: the sound to play
+	Args     []string // For CutsceneAudioCue: the rest of the command
+}
+
+// CutsceneCallback is called for each cutscene event
+type CutsceneCallback func(event CutsceneEvent)
+
+// CutsceneConfig sets up a cutscene player
+type CutsceneConfig struct {
+	Renderer       *Renderer // Required: the camera is moved on it and fades cover its screen
+	World          *World    // Where cues look up entities
+	Input          *Input    // Read for SkipKeys; nil leaves skipping to Skip
+	SkipKeys       []int     // Scancodes that skip a cutscene
+	FadeColor      UIColor   // Default color of fades
+	LetterboxColor UIColor
+}
+
+// DefaultCutsceneConfig returns a config with black fades and bars that Escape skips
+func DefaultCutsceneConfig(renderer *Renderer, world *World, input *Input) CutsceneConfig {
+	black := UIColor{0.0, 0.0, 0.0, 1.0}
+	return CutsceneConfig{
+		Renderer:       renderer,
+		World:          world,
+		Input:          input,
+		SkipKeys:       []int{KeyEscape},
+		FadeColor:      black,
+		LetterboxColor: black,
+	}
+}
+
+// Cutscene plays timelines: it moves a camera of its own between the keyframes, runs the
+// cues as their times pass and draws fades and letterbox bars over the game. The camera
+// that was active before is restored when a cutscene ends. It advances with the delta time
+// passed to Update, so it pauses with the game.
+type Cutscene struct {
+	config    CutsceneConfig
+	timelines map[string]*CutsceneTimeline
+	commands  map[string]CutsceneCommandFunc
+	camera    *Camera
+
+	playing  *CutsceneTimeline
+	elapsed  float32
+	nextCue  int
+	previous *Camera // Active before the cutscene took over
+	keyDown  bool    // A skip key was down last frame
+
+	fade      *UIProgressBar
+	fadeRamp  cutsceneRamp
+	bars      [2]*UIProgressBar
+	letterbox cutsceneRamp
+
+	events  []CutsceneEvent
+	onEvent CutsceneCallback
+}
+
+// cutsceneRamp is a value moving from one number to another over a time
+type cutsceneRamp struct {
+	from, to, duration, elapsed float32
+}
+
+func (r *cutsceneRamp) start(to, duration float32) {
+	r.from, r.to = r.value(), to
+	r.duration, r.elapsed = duration, 0
+}
+
+func (r *cutsceneRamp) value() float32 {
+	if r.duration <= 0 || r.elapsed >= r.duration {
+		return r.to
+	}
+	return lerp(r.from, r.to, r.elapsed/r.duration)
+}
+
+// NewCutscene creates a cutscene player
+func NewCutscene(config CutsceneConfig) (*Cutscene, error) {
+	if config.Renderer == nil {
+		return nil, errors.New("cutscene needs a renderer")
+	}
+
+	cs := &Cutscene{
+		config:    config,
+		timelines: make(map[string]*CutsceneTimeline),
+		camera:    config.Renderer.CreateCamera(),
+	}
+	cs.commands = map[string]CutsceneCommandFunc{
+		"animate":        cs.builtin("animate", cs.animateCommand),
+		"stop_animation": cs.builtin("stop_animation", cs.stopAnimationCommand),
+		"audio":          cs.builtin("audio", cs.audioCommand),
+		"fade":           cs.builtin("fade", cs.fadeCommand),
+		"letterbox":      cs.builtin("letterbox", cs.letterboxCommand),
+	}
+	return cs, nil
+}
+
+// AddTimeline makes a timeline available to Play under its ID. Timelines built in Go
+// rather than parsed must list their keys and cues in time order.
+func (cs *Cutscene) AddTimeline(t *CutsceneTimeline) {
+	cs.timelines[t.ID] = t
+}
+
+// RegisterCommand adds a cue command, or replaces a built in one
+func (cs *Cutscene) RegisterCommand(name string, command CutsceneCommandFunc) {
+	cs.commands[name] = command
+}
+
+// GetCamera returns the camera cutscenes are shown from, e.g. to set its clipping planes
+func (cs *Cutscene) GetCamera() *Camera {
+	return cs.camera
+}
+
+// OnEvent sets the callback run for cutscene events. Events are also queued for
+// PollEvents.
+func (cs *Cutscene) OnEvent(callback CutsceneCallback) {
+	cs.onEvent = callback
+}
+
+// PollEvents returns the cutscene events since the last call
+func (cs *Cutscene) PollEvents() []CutsceneEvent {
+	events := cs.events
+	cs.events = nil
+	return events
+}
+
+// Play starts a timeline added with AddTimeline, stopping the one playing. Cues at time 0
+// run straight away.
+func (cs *Cutscene) Play(name string) error {
+	t, ok := cs.timelines[name]
+	if !ok {
+		return errors.New("unknown cutscene: " + name)
+	}
+	for _, cue := range t.Cues {
+		fields := strings.Fields(cue.Command)
+		if len(fields) == 0 {
+			return errors.New("cutscene " + name + " has a cue without a command")
+		}
+		if _, ok := cs.commands[fields[0]]; !ok {
+			return errors.New("cutscene " + name + " uses unknown command: " + fields[0])
+		}
+	}
+
+	if cs.playing != nil {
+		cs.finish(true)
+	}
+	cs.playing = t
+	cs.elapsed = 0
+	cs.nextCue = 0
+	cs.keyDown = cs.skipDown() // The key that started it mustn't skip it
+
+	if len(t.Camera) > 0 {
+		cs.previous = cs.config.Renderer.GetActiveCamera()
+		cs.moveCamera()
+		if err := cs.config.Renderer.SetActiveCamera(cs.camera); err != nil {
+			cs.playing = nil
+			return err
+		}
+	}
+
+	cs.emit(CutsceneEvent{Kind: CutsceneStarted, Cutscene: name})
+	cs.advance(0)
+	return nil
+}
+
+// Update advances the playing cutscene by deltaTime seconds, checking the skip keys (call
+// every frame)
+func (cs *Cutscene) Update(deltaTime float32) {
+	if cs.playing == nil {
+		return
+	}
+	if cs.skipPressed() && cs.Skip() {
+		return
+	}
+	cs.advance(deltaTime)
+}
+
+// Skip ends the playing cutscene, running the cues left that are marked onSkip. It returns
+// false if nothing is playing or the cutscene is unskippable.
+func (cs *Cutscene) Skip() bool {
+	if cs.playing == nil || cs.playing.Unskippable {
+		return false
+	}
+	for _, cue := range cs.playing.Cues[cs.nextCue:] {
+		if cue.OnSkip {
+			cs.run(cue)
+		}
+	}
+	cs.finish(true)
+	return true
+}
+
+// Stop ends the playing cutscene without running any more cues, even an unskippable one
+func (cs *Cutscene) Stop() {
+	if cs.playing != nil {
+		cs.finish(true)
+	}
+}
+
+// IsPlaying returns true while a cutscene is playing
+func (cs *Cutscene) IsPlaying() bool {
+	return cs.playing != nil
+}
+
+// GetPlaying returns the ID of the playing cutscene and how far into it it is in seconds
+func (cs *Cutscene) GetPlaying() (string, float32) {
+	if cs.playing == nil {
+		return "", 0
+	}
+	return cs.playing.ID, cs.elapsed
+}
+
+// advance runs the cues that are due and moves the camera, fade and bars
+func (cs *Cutscene) advance(deltaTime float32) {
+	t := cs.playing
+	cs.elapsed = min(cs.elapsed+deltaTime, t.Duration)
+	cs.fadeRamp.elapsed += deltaTime
+	cs.letterbox.elapsed += deltaTime
+
+	for cs.nextCue < len(t.Cues) && t.Cues[cs.nextCue].Time <= cs.elapsed {
+		cue := t.Cues[cs.nextCue]
+		cs.nextCue++
+		cs.run(cue)
+		if cs.playing != t {
+			return // A command stopped it or played another
+		}
+	}
+
+	if len(t.Camera) > 0 {
+		cs.moveCamera()
+	}
+	cs.updateOverlays()
+
+	if cs.elapsed >= t.Duration {
+		cs.finish(false)
+	}
+}
+
+// moveCamera places the camera between the keys around the current time
+func (cs *Cutscene) moveCamera() {
+	keys := cs.playing.Camera
+	next := slices.IndexFunc(keys, func(key CutsceneCameraKey) bool { return key.Time > cs.elapsed })
+	var from, to CutsceneCameraKey
+	k := float32(0)
+	switch next {
+	case -1:
+		from, to = keys[len(keys)-1], keys[len(keys)-1]
+	case 0:
+		from, to = keys[0], keys[0]
+	default:
+		from, to = keys[next-1], keys[next]
+		if !to.Cut {
+			k = cutsceneEasings[to.Easing]((cs.elapsed - from.Time) / (to.Time - from.Time))
+		}
+	}
+
+	c := cs.camera
+	c.position = lerpVector(vectorOf(from.Position), vectorOf(to.Position), k)
+	target := lerpVector(cs.keyTarget(from), cs.keyTarget(to), k)
+	if target != c.position {
+		c.target = target
+	}
+	if from.FOV > 0 && to.FOV > 0 {
+		c.fovY = lerp(from.FOV, to.FOV, k)
+	}
+	if err := c.apply(); err != nil {
+		LogError("Failed to move cutscene camera: " + err.Error())
+	}
+}
+
+// keyTarget returns what a key looks at: its entity's position, or its target
+func (cs *Cutscene) keyTarget(key CutsceneCameraKey) Vector3 {
+	if key.Look != "" {
+		if entity, err := cs.findEntity(key.Look); err == nil {
+			if position, err := entity.GetTransform(); err == nil {
+				return position
+			}
+		}
+	}
+	return vectorOf(key.Target)
+}
+
+func vectorOf(v [3]float32) Vector3 {
+	return Vector3{X: v[0], Y: v[1], Z: v[2]}
+}
+
+// updateOverlays sizes and fades the fade and letterbox bars
+func (cs *Cutscene) updateOverlays() {
+	width, height := cs.config.Renderer.GetSwapchainExtent()
+	w, h := float32(width), float32(height)
+
+	if cs.fade != nil {
+		cs.fade.SetBounds(0, 0, w, h)
+		cs.fade.SetOpacity(cs.fadeRamp.value())
+	}
+	if cs.bars[0] != nil {
+		bar := h * cs.letterbox.value()
+		cs.bars[0].SetBounds(0, 0, w, bar)
+		cs.bars[1].SetBounds(0, h-bar, w, bar)
+	}
+}
+
+// finish ends the playing cutscene, removing its overlays and giving the camera back
+func (cs *Cutscene) finish(skipped bool) {
+	name := cs.playing.ID
+	hadCamera := len(cs.playing.Camera) > 0
+	cs.playing = nil
+
+	if cs.fade != nil {
+		cs.fade.Destroy()
+		cs.fade = nil
+	}
+	for i, bar := range cs.bars {
+		if bar != nil {
+			bar.Destroy()
+			cs.bars[i] = nil
+		}
+	}
+	cs.fadeRamp = cutsceneRamp{}
+	cs.letterbox = cutsceneRamp{}
+
+	if hadCamera && cs.previous != nil && cs.camera.IsActive() {
+		if err := cs.config.Renderer.SetActiveCamera(cs.previous); err != nil {
+			LogError("Failed to restore camera after cutscene: " + err.Error())
+		}
+	}
+	cs.previous = nil
+
+	cs.emit(CutsceneEvent{Kind: CutsceneCompleted, Cutscene: name, Skipped: skipped})
+}
+
+// run runs a cue's command
+func (cs *Cutscene) run(cue CutsceneCue) {
+	args := strings.Fields(cue.Command)
+	command, ok := cs.commands[args[0]]
+	if !ok {
+		LogError("Unknown cutscene command: " + args[0])
+		return
+	}
+	runCallback("Cutscene command "+args[0], func() { command(args[1:]) })
+}
+
+func (cs *Cutscene) emit(event CutsceneEvent) {
+	cs.events = append(cs.events, event)
+	if cs.onEvent != nil {
+		runCallback("Cutscene.OnEvent", func() { cs.onEvent(event) })
+	}
+}
+
+// skipDown returns whether a skip key is down
+func (cs *Cutscene) skipDown() bool {
+	return cs.config.Input != nil && slices.ContainsFunc(cs.config.SkipKeys, cs.config.Input.IsKeyPressed)
+}
+
+// skipPressed returns whether a skip key went down this frame
+func (cs *Cutscene) skipPressed() bool {
+	down := cs.skipDown()
+	pressed := down && !cs.keyDown
+	cs.keyDown = down
+	return pressed
+}
+
+// findEntity looks an entity up by its scene name or ID
+func (cs *Cutscene) findEntity(name string) (*Entity, error) {
+	w := cs.config.World
+	if w == nil || !w.ready() {
+		return nil, errNotInitialized
+	}
+	if w.scene != nil {
+		if id, ok := w.scene.FindEntity(name); ok {
+			return &Entity{ID: id, world: w}, nil
+		}
+	}
+	if id, err := strconv.ParseUint(name, 10, 64); err == nil {
+		return &Entity{ID: EntityID(id), world: w}, nil
+	}
+	return nil, errors.New("no entity named " + name)
+}
+
+// builtin wraps a built in command, logging its errors
+func (cs *Cutscene) builtin(name string, command func(args []string) error) CutsceneCommandFunc {
+	return func(args []string) {
+		if err := command(args); err != nil {
+			LogError("Cutscene command " + name + ": " + err.Error())
+		}
+	}
+}
+
+func (cs *Cutscene) animateCommand(args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: animate <entity> <clip> [crossfade]")
+	}
+	entity, err := cs.findEntity(args[0])
+	if err != nil {
+		return err
+	}
+	crossfade, err := floatArg(args, 2, 0)
+	if err != nil {
+		return err
+	}
+	if crossfade > 0 {
+		return entity.CrossfadeAnimation(args[1], crossfade)
+	}
+	return entity.PlayAnimation(args[1])
+}
+
+func (cs *Cutscene) stopAnimationCommand(args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: stop_animation <entity> [fade]")
+	}
+	entity, err := cs.findEntity(args[0])
+	if err != nil {
+		return err
+	}
+	fade, err := floatArg(args, 1, 0)
+	if err != nil {
+		return err
+	}
+	return entity.StopAnimation(fade)
+}
+
+func (cs *Cutscene) audioCommand(args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: audio <cue> [args...]")
+	}
+	cs.emit(CutsceneEvent{Kind: CutsceneAudioCue, Cutscene: cs.playing.ID, Cue: args[0], Args: args[1:]})
+	return nil
+}
+
+func (cs *Cutscene) fadeCommand(args []string) error {
+	defer lockThread()()
+	if len(args) < 2 || (args[0] != "in" && args[0] != "out") || (len(args) != 2 && len(args) != 5) {
+		return errors.New("usage: fade in|out <seconds> [r g b]")
+	}
+	duration, err := floatArg(args, 1, 0)
+	if err != nil {
+		return err
+	}
+	color := cs.config.FadeColor
+	if len(args) == 5 {
+		for i, c := range []*float32{&color.R, &color.G, &color.B} {
+			if *c, err = floatArg(args, 2+i, 0); err != nil {
+				return err
+			}
+		}
+		color.A = 1
+	}
+
+	if cs.fade == nil {
+		cs.fade = CreateUIProgressBar(0, 0, 0, 0)
+		if cs.fade == nil {
+			return lastError("failed to create fade")
+		}
+		cs.fade.SetOpacity(cs.fadeRamp.value())
+	}
+	cs.fade.SetColors(color, color, color)
+
+	if args[0] == "out" {
+		cs.fadeRamp.start(1, duration)
+		return nil
+	}
+	// Fading in from a clear screen starts from the color
+	if cs.fadeRamp.value() == 0 {
+		cs.fadeRamp = cutsceneRamp{to: 1}
+	}
+	cs.fadeRamp.start(0, duration)
+	return nil
+}
+
+func (cs *Cutscene) letterboxCommand(args []string) error {
+	defer lockThread()()
+	if len(args) < 1 {
+		return errors.New("usage: letterbox <height> [seconds]")
+	}
+	height, err := floatArg(args, 0, 0)
+	if err != nil {
+		return err
+	}
+	if height < 0 || height >= 0.5 {
+		return errors.New("letterbox height must be from 0 to under 0.5 of the screen")
+	}
+	duration, err := floatArg(args, 1, 0)
+	if err != nil {
+		return err
+	}
+
+	if cs.bars[0] == nil {
+		color := cs.config.LetterboxColor
+		for i := range cs.bars {
+			bar := CreateUIProgressBar(0, 0, 0, 0)
+			if bar == nil {
+				// Taken first, as destroying the other bar clears the engine's reason
+				err := lastError("failed to create letterbox")
+				if cs.bars[0] != nil {
+					cs.bars[0].Destroy()
+					cs.bars[0] = nil
+				}
+				return err
+			}
+			bar.SetColors(color, color, color)
+			cs.bars[i] = bar
+		}
+	}
+	cs.letterbox.start(height, duration)
+	return nil
+}
+
+// floatArg returns args[i] as a number, or fallback if there are fewer arguments
+func floatArg(args []string, i int, fallback float32) (float32, error) {
+	if i >= len(args) {
+		return fallback, nil
+	}
+	value, err := strconv.ParseFloat(args[i], 32)
+	if err != nil {
+		return 0, errors.New("not a number: " + args[i])
+	}
+	return float32(value), nil
+}
@@ -0,0 +1,93 @@
+package boulder
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// CVar is a named setting that can be changed while the game runs, e.g. from a debug
+// console. The engine registers its own (perf_hud); games add theirs with RegisterCVar.
+type CVar struct {
+	Name        string
+	Description string
+	Value       string
+	Default     string
+}
+
+type cvarEntry struct {
+	CVar
+	onChange func(value string) error
+}
+
+// cvarTable returns the engine's cvars, registering the built-in ones the first time
+func (e *Engine) cvarTable() map[string]*cvarEntry {
+	if e.cvars == nil {
+		e.cvars = make(map[string]*cvarEntry)
+		e.registerPerfHUDCVar()
+	}
+	return e.cvars
+}
+
+// RegisterCVar adds a cvar with a starting value. onChange, if set, is called by SetCVar
+// with the new value and can reject it by returning an error.
+func (e *Engine) RegisterCVar(name, description, value string, onChange func(value string) error) error {
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return errors.New("invalid cvar name: " + name)
+	}
+	cvars := e.cvarTable()
+	if _, ok := cvars[name]; ok {
+		return errors.New("cvar already registered: " + name)
+	}
+
+	cvars[name] = &cvarEntry{
+		CVar:     CVar{Name: name, Description: description, Value: value, Default: value},
+		onChange: onChange,
+	}
+	return nil
+}
+
+// SetCVar changes a cvar's value, keeping the old one if its onChange rejects it
+func (e *Engine) SetCVar(name, value string) error {
+	cvar, ok := e.cvarTable()[name]
+	if !ok {
+		return errors.New("unknown cvar: " + name)
+	}
+	if cvar.onChange != nil {
+		if err := cvar.onChange(value); err != nil {
+			return err
+		}
+	}
+	cvar.Value = value
+	return nil
+}
+
+// GetCVar returns a cvar's value
+func (e *Engine) GetCVar(name string) (string, bool) {
+	cvar, ok := e.cvarTable()[name]
+	if !ok {
+		return "", false
+	}
+	return cvar.Value, true
+}
+
+// GetCVars returns every cvar, sorted by name
+func (e *Engine) GetCVars() []CVar {
+	cvars := make([]CVar, 0, len(e.cvarTable()))
+	for _, cvar := range e.cvars {
+		cvars = append(cvars, cvar.CVar)
+	}
+	slices.SortFunc(cvars, func(a, b CVar) int { return strings.Compare(a.Name, b.Name) })
+	return cvars
+}
+
+// ParseCVarBool reads a boolean cvar value: 1, true, on or yes, and 0, false, off or no
+func ParseCVarBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "on", "yes":
+		return true, nil
+	case "0", "false", "off", "no":
+		return false, nil
+	}
+	return false, errors.New("not a boolean: " + value)
+}
@@ -0,0 +1,67 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+
+// SetDebugMode turns on extra checks of the rendering API: mesh draws within device
+// limits, and a report when the GPU stops finishing frames. Set before Init, it also
+// enables the Vulkan validation layer (when installed) and EndFrame returns its errors.
+// Misuse such as drawing outside a frame is reported as an error with or without it.
+func (e *Engine) SetDebugMode(enabled bool) {
+	cEnabled := C.int(0)
+	if enabled {
+		cEnabled = 1
+	}
+	C.boulder_set_debug_mode(cEnabled)
+}
+
+// GetDebugMode returns whether debug mode is on
+func (e *Engine) GetDebugMode() bool {
+	return C.boulder_get_debug_mode() != 0
+}
+
+// ValidationEnabled returns whether the Vulkan validation layer is reporting errors
+func (e *Engine) ValidationEnabled() bool {
+	return C.boulder_validation_enabled() != 0
+}
+
+// LastAPIError returns and clears the last misuse or validation error that no call has
+// returned yet, or nil
+func (e *Engine) LastAPIError() error {
+	if message := takeAPIError(); message != "" {
+		return &Error{Code: ErrorAPIMisuse, Message: message}
+	}
+	return nil
+}
+
+// apiError returns nil if a native call succeeded, otherwise an error for fallback with the
+// reason, exception or misuse it recorded. Like lastError, callers start with
+// defer lockThread()() so the call and this run on the same thread.
+func apiError(ret C.int, fallback string) error {
+	if ret == 0 {
+		return nil
+	}
+	err := lastError(fallback)
+	// Taken either way, so they aren't returned again by a later call
+	native, misuse := takeNativeError(), takeAPIError()
+	if err.Code == ErrorUnknown {
+		switch {
+		case native != "":
+			err.Code, err.Message = ErrorNativeException, "native exception in "+native
+		case misuse != "":
+			err.Code, err.Message = ErrorAPIMisuse, misuse
+		}
+	}
+	return err
+}
+
+func takeAPIError() string {
+	var buf [1024]C.char
+	length := C.boulder_take_api_error(&buf[0], C.uint32_t(len(buf)))
+	if length == 0 {
+		return ""
+	}
+	return C.GoStringN(&buf[0], C.int(min(int(length), len(buf)-1)))
+}
@@ -0,0 +1,404 @@
+package boulder
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Default destruction settings
+const (
+	DefaultDebrisLifetime = 10 * time.Second
+	DefaultMaxDebris      = 256
+)
+
+// FracturedModel is a pre-fractured model: each mesh of the model file is one piece. It is
+// loaded once onto a hidden entity and copied for every break.
+type FracturedModel struct {
+	Path string
+
+	template *Entity
+	pieces   int
+	pool     [][]*debrisPiece // Spare piece sets, ready to be placed
+}
+
+// GetPieceCount returns the number of pieces the model breaks into
+func (f *FracturedModel) GetPieceCount() int {
+	return f.pieces
+}
+
+// DestructibleSettings controls how a destructible entity breaks
+type DestructibleSettings struct {
+	Health         float32
+	PieceMass      float32
+	ImpulseScale   float32       // Multiplies the impulse of the breaking damage event
+	Spread         float32       // Extra outward speed pushing pieces away from the hit point
+	DebrisLifetime time.Duration // Zero keeps pieces until the destructible is reset
+	DestroyOnBreak bool          // Destroy the intact entity instead of hiding it
+}
+
+// DefaultDestructibleSettings returns settings for a crate-sized object
+func DefaultDestructibleSettings() DestructibleSettings {
+	return DestructibleSettings{
+		Health:         100,
+		PieceMass:      1,
+		ImpulseScale:   1,
+		Spread:         2,
+		DebrisLifetime: DefaultDebrisLifetime,
+	}
+}
+
+// BreakCallback is called when a destructible breaks, with the entities of its pieces
+type BreakCallback func(entity EntityID, pieces []EntityID)
+
+type debrisPiece struct {
+	entity *Entity
+	offset Vector3 // Piece centroid in the intact model's space
+}
+
+type destructible struct {
+	entity    *Entity
+	fractured *FracturedModel
+	settings  DestructibleSettings
+	health    float32
+	broken    bool
+	pieces    []*debrisPiece
+	expires   time.Time
+}
+
+// Destruction swaps destructible entities for their fractured pieces when their health
+// runs out, and recycles the pieces once their lifetime ends
+type Destruction struct {
+	world        *World
+	fractured    map[string]*FracturedModel
+	destructible map[EntityID]*destructible
+	debris       []*destructible // Broken destructibles in the order they broke
+	maxDebris    int
+	onBreak      BreakCallback
+}
+
+// NewDestruction creates a destruction manager for a world
+func NewDestruction(world *World) *Destruction {
+	return &Destruction{
+		world:        world,
+		fractured:    make(map[string]*FracturedModel),
+		destructible: make(map[EntityID]*destructible),
+		maxDebris:    DefaultMaxDebris,
+	}
+}
+
+// SetMaxDebris limits the number of live pieces; the oldest debris is recycled first
+func (d *Destruction) SetMaxDebris(pieces int) {
+	d.maxDebris = max(1, pieces)
+}
+
+// OnBreak sets the callback run when a destructible breaks
+func (d *Destruction) OnBreak(callback BreakCallback) {
+	d.onBreak = callback
+}
+
+// LoadFracturedModel loads a pre-fractured model, reusing it if it was already loaded
+func (d *Destruction) LoadFracturedModel(path string) (*FracturedModel, error) {
+	if f, ok := d.fractured[path]; ok {
+		return f, nil
+	}
+
+	template, err := d.world.NewEntity()
+	if err != nil {
+		return nil, err
+	}
+	if err := template.LoadModel(path); err != nil {
+		template.Destroy()
+		return nil, err
+	}
+	template.SetModelVisible(false)
+
+	pieces := template.GetModelMeshCount()
+	if pieces == 0 {
+		template.Destroy()
+		return nil, errors.New("fractured model has no pieces")
+	}
+
+	f := &FracturedModel{Path: path, template: template, pieces: pieces}
+	d.fractured[path] = f
+	return f, nil
+}
+
+// Prewarm creates spare piece sets so breaking doesn't upload meshes mid-game
+func (d *Destruction) Prewarm(fractured *FracturedModel, sets int) error {
+	for len(fractured.pool) < sets {
+		pieces, err := d.createPieces(fractured)
+		if err != nil {
+			return err
+		}
+		fractured.pool = append(fractured.pool, pieces)
+	}
+	return nil
+}
+
+// MakeDestructible lets an entity break into a fractured model's pieces
+func (d *Destruction) MakeDestructible(entity EntityID, fractured *FracturedModel, settings DestructibleSettings) error {
+	if fractured == nil {
+		return errors.New("nil fractured model")
+	}
+	if settings.Health <= 0 {
+		return errors.New("destructible health must be positive")
+	}
+	if settings.PieceMass <= 0 {
+		return errors.New("piece mass must be positive")
+	}
+
+	d.destructible[entity] = &destructible{
+		entity:    &Entity{ID: entity, world: d.world},
+		fractured: fractured,
+		settings:  settings,
+		health:    settings.Health,
+	}
+	return nil
+}
+
+// RemoveDestructible stops tracking an entity, recycling its debris if it broke
+func (d *Destruction) RemoveDestructible(entity EntityID) {
+	ds, ok := d.destructible[entity]
+	if !ok {
+		return
+	}
+	d.recycle(ds)
+	delete(d.destructible, entity)
+}
+
+// GetHealth returns a destructible's remaining health
+func (d *Destruction) GetHealth(entity EntityID) float32 {
+	if ds, ok := d.destructible[entity]; ok {
+		return ds.health
+	}
+	return 0
+}
+
+// IsBroken returns true if a destructible has broken
+func (d *Destruction) IsBroken(entity EntityID) bool {
+	ds, ok := d.destructible[entity]
+	return ok && ds.broken
+}
+
+// Damage applies damage to a destructible and breaks it once its health runs out. Returns
+// true if this damage broke it.
+func (d *Destruction) Damage(entity EntityID, event DamageEvent) (bool, error) {
+	ds, ok := d.destructible[entity]
+	if !ok {
+		return false, errors.New("entity is not destructible")
+	}
+	if ds.broken {
+		return false, nil
+	}
+
+	ds.health -= event.Amount
+	if ds.health > 0 {
+		return false, nil
+	}
+
+	if err := d.breakApart(ds, event); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Break breaks a destructible immediately, regardless of its health
+func (d *Destruction) Break(entity EntityID, event DamageEvent) error {
+	ds, ok := d.destructible[entity]
+	if !ok {
+		return errors.New("entity is not destructible")
+	}
+	if ds.broken {
+		return nil
+	}
+	return d.breakApart(ds, event)
+}
+
+// Reset restores a broken destructible to its intact model and full health
+func (d *Destruction) Reset(entity EntityID) error {
+	ds, ok := d.destructible[entity]
+	if !ok {
+		return errors.New("entity is not destructible")
+	}
+	if ds.settings.DestroyOnBreak && ds.broken {
+		return errors.New("destructible was destroyed when it broke")
+	}
+
+	d.recycle(ds)
+	ds.health = ds.settings.Health
+	if ds.broken {
+		ds.broken = false
+		return ds.entity.SetModelVisible(true)
+	}
+	return nil
+}
+
+// Update recycles debris whose lifetime has ended (call this every frame)
+func (d *Destruction) Update() {
+	now := time.Now()
+	for _, ds := range append([]*destructible(nil), d.debris...) {
+		if ds.pieces != nil && !ds.expires.IsZero() && now.After(ds.expires) {
+			d.recycle(ds)
+		}
+	}
+}
+
+// GetDebrisCount returns the number of live pieces
+func (d *Destruction) GetDebrisCount() int {
+	count := 0
+	for _, ds := range d.debris {
+		count += len(ds.pieces)
+	}
+	return count
+}
+
+func (d *Destruction) breakApart(ds *destructible, event DamageEvent) error {
+	position, rotation, scale, err := ds.entity.GetFullTransform()
+	if err != nil {
+		return err
+	}
+
+	pieces, err := d.acquirePieces(ds.fractured)
+	if err != nil {
+		return err
+	}
+	d.makeRoom(len(pieces))
+
+	settings := ds.settings
+	ids := make([]EntityID, len(pieces))
+	for i, piece := range pieces {
+		offset := rotateEuler(Vector3{piece.offset.X * scale.X, piece.offset.Y * scale.Y, piece.offset.Z * scale.Z}, rotation)
+		center := Vector3{position.X + offset.X, position.Y + offset.Y, position.Z + offset.Z}
+
+		piece.entity.SetFullTransform(center, rotation, scale)
+		piece.entity.SetModelVisible(true)
+		piece.entity.AddPhysicsBody(settings.PieceMass)
+
+		// Pieces near the hit take most of the impulse and are pushed away from it
+		away := Vector3{center.X - event.Point.X, center.Y - event.Point.Y, center.Z - event.Point.Z}
+		distance := vectorLength(away)
+		falloff := float32(1)
+		if event.Radius > 0 {
+			falloff = max(0, 1-distance/event.Radius)
+		}
+		if distance > 0 {
+			away = Vector3{away.X / distance, away.Y / distance, away.Z / distance}
+		}
+
+		share := settings.ImpulseScale * falloff / settings.PieceMass / float32(len(pieces))
+		outward := settings.Spread * falloff
+		piece.entity.SetVelocity(Vector3{
+			X: event.Impulse.X*share + away.X*outward,
+			Y: event.Impulse.Y*share + away.Y*outward,
+			Z: event.Impulse.Z*share + away.Z*outward,
+		})
+		ids[i] = piece.entity.ID
+	}
+
+	ds.broken = true
+	ds.pieces = pieces
+	ds.expires = time.Time{}
+	if settings.DebrisLifetime > 0 {
+		ds.expires = time.Now().Add(settings.DebrisLifetime)
+	}
+	d.debris = append(d.debris, ds)
+
+	if settings.DestroyOnBreak {
+		ds.entity.Destroy()
+	} else {
+		ds.entity.SetModelVisible(false)
+	}
+
+	if d.onBreak != nil {
+		runCallback("OnBreak", func() { d.onBreak(ds.entity.ID, ids) })
+	}
+	return nil
+}
+
+// makeRoom recycles the oldest debris until incoming pieces fit under the debris limit
+func (d *Destruction) makeRoom(incoming int) {
+	for len(d.debris) > 0 && d.GetDebrisCount()+incoming > d.maxDebris {
+		d.recycle(d.debris[0])
+	}
+}
+
+// recycle hides a destructible's pieces and returns them to its model's pool
+func (d *Destruction) recycle(ds *destructible) {
+	if ds.pieces == nil {
+		return
+	}
+
+	for _, piece := range ds.pieces {
+		piece.entity.SetModelVisible(false)
+		piece.entity.RemovePhysicsBody()
+	}
+	ds.fractured.pool = append(ds.fractured.pool, ds.pieces)
+	ds.pieces = nil
+
+	for i, other := range d.debris {
+		if other == ds {
+			d.debris = append(d.debris[:i], d.debris[i+1:]...)
+			break
+		}
+	}
+}
+
+func (d *Destruction) acquirePieces(fractured *FracturedModel) ([]*debrisPiece, error) {
+	if n := len(fractured.pool); n > 0 {
+		pieces := fractured.pool[n-1]
+		fractured.pool = fractured.pool[:n-1]
+		return pieces, nil
+	}
+	return d.createPieces(fractured)
+}
+
+func (d *Destruction) createPieces(fractured *FracturedModel) ([]*debrisPiece, error) {
+	pieces := make([]*debrisPiece, 0, fractured.pieces)
+	for i := 0; i < fractured.pieces; i++ {
+		entity, err := d.world.NewEntity()
+		if err != nil {
+			destroyPieces(pieces)
+			return nil, err
+		}
+
+		offset, err := entity.copyMesh(fractured.template, i)
+		if err == nil {
+			err = entity.AddTransform(Vector3{})
+		}
+		if err != nil {
+			entity.Destroy()
+			destroyPieces(pieces)
+			return nil, err
+		}
+
+		entity.SetModelVisible(false)
+		pieces = append(pieces, &debrisPiece{entity: entity, offset: offset})
+	}
+	return pieces, nil
+}
+
+func destroyPieces(pieces []*debrisPiece) {
+	for _, piece := range pieces {
+		piece.entity.Destroy()
+	}
+}
+
+// rotateEuler rotates v by Euler angles in radians, in the same order as the renderer
+// (X, then Y, then Z applied to the model matrix)
+func rotateEuler(v, rotation Vector3) Vector3 {
+	sx, cx := math.Sincos(float64(rotation.X))
+	sy, cy := math.Sincos(float64(rotation.Y))
+	sz, cz := math.Sincos(float64(rotation.Z))
+	x, y, z := float64(v.X), float64(v.Y), float64(v.Z)
+
+	x, y = x*cz-y*sz, x*sz+y*cz
+	x, z = x*cy+z*sy, -x*sy+z*cy
+	y, z = y*cx-z*sx, y*sx+z*cx
+
+	return Vector3{X: float32(x), Y: float32(y), Z: float32(z)}
+}
+
+func vectorLength(v Vector3) float32 {
+	return float32(math.Sqrt(float64(v.X*v.X + v.Y*v.Y + v.Z*v.Z)))
+}
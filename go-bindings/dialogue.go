@@ -0,0 +1,367 @@
+package boulder
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Dialogue graphs are JSON files of nodes. Each node has a speaker and lines, then either
+// choices or a next node; an empty next ends the conversation. Conditions and scripts are
+// commands: a name followed by space separated arguments, with "!" before a condition
+// negating it.
+//
+//	{"id": "smith", "start": "hello", "nodes": [
+//	  {"id": "hello", "speaker": "smith.name", "lines": ["smith.hello"], "choices": [
+//	    {"text": "smith.quest", "next": "quest", "condition": "!quest_started find_hammer"},
+//	    {"text": "smith.bye"}]},
+//	  {"id": "quest", "speaker": "smith.name", "lines": ["smith.lost_hammer"],
+//	   "script": "quest_start find_hammer"}]}
+//
+// Built in conditions: var <name> <value>, quest_started <quest>, quest_active <quest>,
+// quest_completed <quest>. Built in scripts: set <name> <value>, quest_start <quest>,
+// quest_progress <quest> <objective> [amount], quest_complete <quest>, quest_fail <quest>.
+
+// DialogueChoice is an option the player can pick
+type DialogueChoice struct {
+	Text      string `json:"text"`
+	Next      string `json:"next,omitempty"`
+	Condition string `json:"condition,omitempty"` // Hidden unless the condition holds
+	Script    string `json:"script,omitempty"`    // Run when picked
+}
+
+// DialogueNode is a speaker saying one or more lines
+type DialogueNode struct {
+	ID      string           `json:"id"`
+	Speaker string           `json:"speaker"`
+	Lines   []string         `json:"lines"`
+	Choices []DialogueChoice `json:"choices,omitempty"`
+	Next    string           `json:"next,omitempty"`   // Used when there are no choices
+	Script  string           `json:"script,omitempty"` // Run when the node is entered
+}
+
+// Dialogue is a conversation graph
+type Dialogue struct {
+	ID    string         `json:"id"`
+	Start string         `json:"start"`
+	Nodes []DialogueNode `json:"nodes"`
+
+	byID map[string]*DialogueNode
+}
+
+// ParseDialogue parses a dialogue graph and checks its links
+func ParseDialogue(data []byte) (*Dialogue, error) {
+	var d Dialogue
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	if d.ID == "" {
+		return nil, errors.New("dialogue needs an id")
+	}
+
+	d.byID = make(map[string]*DialogueNode, len(d.Nodes))
+	for i := range d.Nodes {
+		d.byID[d.Nodes[i].ID] = &d.Nodes[i]
+	}
+	if d.Start == "" && len(d.Nodes) > 0 {
+		d.Start = d.Nodes[0].ID
+	}
+	if _, ok := d.byID[d.Start]; !ok {
+		return nil, errors.New("dialogue start node not found: " + d.Start)
+	}
+
+	for _, node := range d.Nodes {
+		links := []string{node.Next}
+		for _, c := range node.Choices {
+			links = append(links, c.Next)
+		}
+		for _, next := range links {
+			if _, ok := d.byID[next]; next != "" && !ok {
+				return nil, errors.New("dialogue node " + node.ID + " links to missing node " + next)
+			}
+		}
+	}
+	return &d, nil
+}
+
+// LoadDialogue loads a dialogue graph from a JSON file
+func LoadDialogue(path string) (*Dialogue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDialogue(data)
+}
+
+// DialogueConditionFunc decides whether a condition holds
+type DialogueConditionFunc func(args []string) bool
+
+// DialogueScriptFunc runs a script command
+type DialogueScriptFunc func(args []string)
+
+// TranslateFunc returns the localized text for a key, or the key itself
+type TranslateFunc func(key string) string
+
+// DialogueRunner plays dialogue graphs one line at a time. Speakers, lines and choice text
+// are passed through the translator so graphs can hold localization keys.
+type DialogueRunner struct {
+	dialogues  map[string]*Dialogue
+	conditions map[string]DialogueConditionFunc
+	scripts    map[string]DialogueScriptFunc
+	translate  TranslateFunc
+	variables  map[string]string
+	quests     *QuestLog
+
+	current *Dialogue
+	node    *DialogueNode
+	line    int
+}
+
+// NewDialogueRunner creates a dialogue runner. quests may be nil if the game has no quests.
+func NewDialogueRunner(quests *QuestLog) *DialogueRunner {
+	return &DialogueRunner{
+		dialogues:  make(map[string]*Dialogue),
+		conditions: make(map[string]DialogueConditionFunc),
+		scripts:    make(map[string]DialogueScriptFunc),
+		translate:  func(key string) string { return key },
+		variables:  make(map[string]string),
+		quests:     quests,
+	}
+}
+
+// AddDialogue makes a dialogue available to Start
+func (dr *DialogueRunner) AddDialogue(d *Dialogue) {
+	dr.dialogues[d.ID] = d
+}
+
+// RegisterCondition adds a condition command
+func (dr *DialogueRunner) RegisterCondition(name string, condition DialogueConditionFunc) {
+	dr.conditions[name] = condition
+}
+
+// RegisterScript adds a script command
+func (dr *DialogueRunner) RegisterScript(name string, script DialogueScriptFunc) {
+	dr.scripts[name] = script
+}
+
+// SetTranslator sets the function used to localize dialogue text
+func (dr *DialogueRunner) SetTranslator(translate TranslateFunc) {
+	if translate == nil {
+		translate = func(key string) string { return key }
+	}
+	dr.translate = translate
+}
+
+// SetVariable sets a dialogue variable
+func (dr *DialogueRunner) SetVariable(name, value string) {
+	dr.variables[name] = value
+}
+
+// GetVariable returns a dialogue variable
+func (dr *DialogueRunner) GetVariable(name string) string {
+	return dr.variables[name]
+}
+
+// Start begins a dialogue
+func (dr *DialogueRunner) Start(id string) error {
+	d, ok := dr.dialogues[id]
+	if !ok {
+		return errors.New("unknown dialogue: " + id)
+	}
+
+	dr.current = d
+	dr.enter(d.Start)
+	return nil
+}
+
+// End stops the current dialogue
+func (dr *DialogueRunner) End() {
+	dr.current = nil
+	dr.node = nil
+	dr.line = 0
+}
+
+// IsActive returns true while a dialogue is running
+func (dr *DialogueRunner) IsActive() bool {
+	return dr.node != nil
+}
+
+// GetSpeaker returns the translated speaker of the current line
+func (dr *DialogueRunner) GetSpeaker() string {
+	if dr.node == nil {
+		return ""
+	}
+	return dr.translate(dr.node.Speaker)
+}
+
+// GetLine returns the translated current line
+func (dr *DialogueRunner) GetLine() string {
+	if dr.node == nil || dr.line >= len(dr.node.Lines) {
+		return ""
+	}
+	return dr.translate(dr.node.Lines[dr.line])
+}
+
+// GetChoices returns the translated text of the choices whose conditions hold. Choices are
+// only offered on a node's last line.
+func (dr *DialogueRunner) GetChoices() []string {
+	var choices []string
+	for _, c := range dr.visibleChoices() {
+		choices = append(choices, dr.translate(c.Text))
+	}
+	return choices
+}
+
+// Advance moves to the next line, or to the next node when a node without choices has
+// no more lines. Returns false once the dialogue has ended.
+func (dr *DialogueRunner) Advance() bool {
+	if dr.node == nil {
+		return false
+	}
+
+	if dr.line < len(dr.node.Lines)-1 {
+		dr.line++
+		return true
+	}
+	if len(dr.node.Choices) > 0 {
+		return true // Waiting for Choose
+	}
+
+	dr.enter(dr.node.Next)
+	return dr.node != nil
+}
+
+// Choose picks one of the choices returned by GetChoices
+func (dr *DialogueRunner) Choose(index int) error {
+	if dr.node == nil {
+		return errors.New("no dialogue running")
+	}
+	if dr.line < len(dr.node.Lines)-1 {
+		return errors.New("dialogue node has more lines")
+	}
+
+	choices := dr.visibleChoices()
+	if index < 0 || index >= len(choices) {
+		return errors.New("dialogue choice out of range")
+	}
+
+	choice := choices[index]
+	dr.run(choice.Script)
+	dr.enter(choice.Next)
+	return nil
+}
+
+// SaveVariables serializes dialogue variables for save games
+func (dr *DialogueRunner) SaveVariables() ([]byte, error) {
+	return json.Marshal(dr.variables)
+}
+
+// LoadVariables restores variables saved by SaveVariables
+func (dr *DialogueRunner) LoadVariables(data []byte) error {
+	variables := make(map[string]string)
+	if err := json.Unmarshal(data, &variables); err != nil {
+		return err
+	}
+	dr.variables = variables
+	return nil
+}
+
+func (dr *DialogueRunner) enter(id string) {
+	dr.line = 0
+	dr.node = nil
+	if id == "" || dr.current == nil {
+		dr.current = nil
+		return
+	}
+
+	dr.node = dr.current.byID[id]
+	if dr.node != nil {
+		dr.run(dr.node.Script)
+	}
+}
+
+func (dr *DialogueRunner) visibleChoices() []DialogueChoice {
+	if dr.node == nil || dr.line < len(dr.node.Lines)-1 {
+		return nil
+	}
+
+	var choices []DialogueChoice
+	for _, c := range dr.node.Choices {
+		if dr.check(c.Condition) {
+			choices = append(choices, c)
+		}
+	}
+	return choices
+}
+
+// check evaluates a condition command; unknown conditions are false
+func (dr *DialogueRunner) check(condition string) bool {
+	condition = strings.TrimSpace(condition)
+	if condition == "" {
+		return true
+	}
+
+	negate := strings.HasPrefix(condition, "!")
+	fields := strings.Fields(strings.TrimPrefix(condition, "!"))
+	if len(fields) == 0 {
+		return !negate
+	}
+
+	return dr.evaluate(fields[0], fields[1:]) != negate
+}
+
+func (dr *DialogueRunner) evaluate(name string, args []string) bool {
+	if fn, ok := dr.conditions[name]; ok {
+		return fn(args)
+	}
+
+	switch {
+	case name == "var" && len(args) == 2:
+		return dr.variables[args[0]] == args[1]
+	case name == "quest_started" && len(args) == 1 && dr.quests != nil:
+		return dr.quests.GetState(args[0]) != QuestNotStarted
+	case name == "quest_active" && len(args) == 1 && dr.quests != nil:
+		return dr.quests.GetState(args[0]) == QuestActive
+	case name == "quest_completed" && len(args) == 1 && dr.quests != nil:
+		return dr.quests.GetState(args[0]) == QuestCompleted
+	}
+	return false
+}
+
+// run executes script commands separated by ";"
+func (dr *DialogueRunner) run(script string) {
+	for _, command := range strings.Split(script, ";") {
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			continue
+		}
+		name, args := fields[0], fields[1:]
+
+		if fn, ok := dr.scripts[name]; ok {
+			fn(args)
+			continue
+		}
+
+		switch {
+		case name == "set" && len(args) == 2:
+			dr.variables[args[0]] = args[1]
+		case dr.quests == nil:
+		case name == "quest_start" && len(args) == 1:
+			dr.quests.Start(args[0])
+		case name == "quest_progress" && len(args) >= 2:
+			amount := 1
+			if len(args) > 2 {
+				if n, err := strconv.Atoi(args[2]); err == nil {
+					amount = n
+				}
+			}
+			dr.quests.Progress(args[0], args[1], amount)
+		case name == "quest_complete" && len(args) == 1:
+			dr.quests.Complete(args[0])
+		case name == "quest_fail" && len(args) == 1:
+			dr.quests.Fail(args[0])
+		}
+	}
+}
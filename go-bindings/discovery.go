@@ -0,0 +1,398 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// DefaultDiscoveryPort is the UDP port LAN discovery uses unless configured otherwise
+const DefaultDiscoveryPort = 27099
+
+// discoveryGroup is the multicast group LAN queries are sent to. Multicast works without
+// the per-platform socket options broadcast needs.
+var discoveryGroup = net.IPv4(239, 255, 66, 66)
+
+var (
+	discoveryQueryMagic    = []byte("BLDQ")
+	discoveryResponseMagic = []byte("BLDR")
+)
+
+// discoveryTimeout is how long a LAN server stays listed without answering a query
+const discoveryTimeout = 10 * time.Second
+
+// ServerSource identifies where a server listing came from
+type ServerSource int
+
+const (
+	ServerSourceLAN   ServerSource = 1
+	ServerSourceSteam ServerSource = 2
+)
+
+// ServerInfo describes a joinable game found by discovery
+type ServerInfo struct {
+	Name       string
+	Address    PeerAddress // Pass to NetworkSession.ConnectPeer
+	Players    int
+	MaxPlayers int
+	Ping       time.Duration // Negative if unknown
+	Source     ServerSource
+	LobbyID    uint64 // Steam lobbies only
+}
+
+// ServerAnnouncement is what a LANAdvertiser tells clients about a server
+type ServerAnnouncement struct {
+	Name       string
+	Port       uint16 // Game port; clients combine it with the address the answer came from
+	Players    int
+	MaxPlayers int
+	Address    string // Optional PeerAddress string (e.g. a relay token) used instead of Port
+}
+
+// LANAdvertiser answers LAN discovery queries for a hosted game
+type LANAdvertiser struct {
+	socket *net.UDPConn
+	mu     sync.Mutex
+	info   ServerAnnouncement
+}
+
+// NewLANAdvertiser starts answering discovery queries on discoveryPort (usually
+// DefaultDiscoveryPort)
+func NewLANAdvertiser(discoveryPort uint16, info ServerAnnouncement) (*LANAdvertiser, error) {
+	socket, err := net.ListenMulticastUDP("udp4", nil, &net.UDPAddr{IP: discoveryGroup, Port: int(discoveryPort)})
+	if err != nil {
+		return nil, err
+	}
+
+	a := &LANAdvertiser{socket: socket, info: info}
+	go a.serve()
+	return a, nil
+}
+
+// SetInfo replaces the announced server information
+func (a *LANAdvertiser) SetInfo(info ServerAnnouncement) {
+	a.mu.Lock()
+	a.info = info
+	a.mu.Unlock()
+}
+
+// SetPlayers updates the announced player count
+func (a *LANAdvertiser) SetPlayers(players int) {
+	a.mu.Lock()
+	a.info.Players = players
+	a.mu.Unlock()
+}
+
+// Close stops answering queries
+func (a *LANAdvertiser) Close() {
+	a.socket.Close()
+}
+
+func (a *LANAdvertiser) serve() {
+	buf := make([]byte, 64)
+	for {
+		n, from, err := a.socket.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if n < 8 || !bytes.Equal(buf[:4], discoveryQueryMagic) {
+			continue
+		}
+
+		a.mu.Lock()
+		response := encodeAnnouncement(buf[4:8], a.info)
+		a.mu.Unlock()
+
+		a.socket.WriteToUDP(response, from)
+	}
+}
+
+// encodeAnnouncement builds a discovery response echoing the query nonce
+func encodeAnnouncement(nonce []byte, info ServerAnnouncement) []byte {
+	name := info.Name
+	if len(name) > 255 {
+		name = name[:255]
+	}
+
+	buf := make([]byte, 0, 16+len(name)+len(info.Address))
+	buf = append(buf, discoveryResponseMagic...)
+	buf = append(buf, nonce...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(info.Players))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(info.MaxPlayers))
+	buf = binary.LittleEndian.AppendUint16(buf, info.Port)
+	buf = append(buf, byte(len(name)))
+	buf = append(buf, name...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(info.Address)))
+	return append(buf, info.Address...)
+}
+
+type discoveryResponse struct {
+	from     *net.UDPAddr
+	data     []byte
+	received time.Time
+}
+
+// LANDiscovery finds servers advertised with LANAdvertiser on the local network
+type LANDiscovery struct {
+	socket   *net.UDPConn
+	port     uint16
+	incoming chan discoveryResponse
+	done     chan struct{}
+
+	nonce   uint32
+	queries map[uint32]time.Time
+	servers map[string]ServerInfo
+	seen    map[string]time.Time
+}
+
+// NewLANDiscovery creates a LAN discovery client for discoveryPort (usually
+// DefaultDiscoveryPort)
+func NewLANDiscovery(discoveryPort uint16) (*LANDiscovery, error) {
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+
+	d := &LANDiscovery{
+		socket:   socket,
+		port:     discoveryPort,
+		incoming: make(chan discoveryResponse, 64),
+		done:     make(chan struct{}),
+		queries:  make(map[uint32]time.Time),
+		servers:  make(map[string]ServerInfo),
+		seen:     make(map[string]time.Time),
+	}
+	go d.read()
+	return d, nil
+}
+
+// Refresh sends a discovery query; answers are collected by Update
+func (d *LANDiscovery) Refresh() error {
+	d.nonce++
+	d.queries[d.nonce] = time.Now()
+
+	query := append([]byte(nil), discoveryQueryMagic...)
+	query = binary.LittleEndian.AppendUint32(query, d.nonce)
+
+	_, err := d.socket.WriteToUDP(query, &net.UDPAddr{IP: discoveryGroup, Port: int(d.port)})
+	return err
+}
+
+// Update processes answers received since the last call (call this every frame)
+func (d *LANDiscovery) Update() {
+	d.receive()
+
+	now := time.Now()
+	for key, last := range d.seen {
+		if now.Sub(last) > discoveryTimeout {
+			delete(d.seen, key)
+			delete(d.servers, key)
+		}
+	}
+	for nonce, sent := range d.queries {
+		if now.Sub(sent) > discoveryTimeout {
+			delete(d.queries, nonce)
+		}
+	}
+}
+
+// GetServers returns the servers found so far, sorted by ping
+func (d *LANDiscovery) GetServers() []ServerInfo {
+	servers := make([]ServerInfo, 0, len(d.servers))
+	for _, server := range d.servers {
+		servers = append(servers, server)
+	}
+	sortServers(servers)
+	return servers
+}
+
+// Close stops discovery
+func (d *LANDiscovery) Close() {
+	close(d.done)
+	d.socket.Close()
+}
+
+func (d *LANDiscovery) read() {
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := d.socket.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		response := discoveryResponse{from: from, data: append([]byte(nil), buf[:n]...), received: time.Now()}
+		select {
+		case d.incoming <- response:
+		case <-d.done:
+			return
+		}
+	}
+}
+
+func (d *LANDiscovery) receive() {
+	for {
+		select {
+		case response := <-d.incoming:
+			d.handleResponse(response)
+		default:
+			return
+		}
+	}
+}
+
+func (d *LANDiscovery) handleResponse(response discoveryResponse) {
+	data := response.data
+	if len(data) < 15 || !bytes.Equal(data[:4], discoveryResponseMagic) {
+		return
+	}
+
+	sent, ok := d.queries[binary.LittleEndian.Uint32(data[4:])]
+	if !ok {
+		return
+	}
+
+	info := ServerInfo{
+		Players:    int(binary.LittleEndian.Uint16(data[8:])),
+		MaxPlayers: int(binary.LittleEndian.Uint16(data[10:])),
+		Ping:       response.received.Sub(sent),
+		Source:     ServerSourceLAN,
+	}
+	port := binary.LittleEndian.Uint16(data[12:])
+
+	nameLen := int(data[14])
+	if len(data) < 15+nameLen+2 {
+		return
+	}
+	info.Name = string(data[15 : 15+nameLen])
+	offset := 15 + nameLen
+	addressLen := int(binary.LittleEndian.Uint16(data[offset:]))
+	offset += 2
+	if len(data) < offset+addressLen {
+		return
+	}
+
+	if addressLen > 0 {
+		address, err := ParsePeerAddress(string(data[offset : offset+addressLen]))
+		if err != nil {
+			return
+		}
+		info.Address = address
+	} else {
+		info.Address = IPAddress(response.from.IP.String(), port)
+	}
+
+	key := response.from.IP.String() + ":" + strconv.Itoa(int(port))
+	d.servers[key] = info
+	d.seen[key] = response.received
+}
+
+// sortServers orders servers by ping, unknown pings last, then by name
+func sortServers(servers []ServerInfo) {
+	sort.SliceStable(servers, func(i, j int) bool {
+		pi, pj := servers[i].Ping, servers[j].Ping
+		if (pi < 0) != (pj < 0) {
+			return pj < 0
+		}
+		if pi != pj {
+			return pi < pj
+		}
+		return servers[i].Name < servers[j].Name
+	})
+}
+
+// Steam lobbies
+
+// RequestSteamLobbies starts fetching the list of public Steam lobbies hosted with
+// CreateSteamLobby. Results arrive while a NetworkSession is being updated.
+func RequestSteamLobbies() error {
+	if C.boulder_steam_request_lobby_list() != 0 {
+		return errors.New("steam not available")
+	}
+	return nil
+}
+
+// GetSteamLobbies returns the lobbies from the last request and whether it has completed
+func GetSteamLobbies() ([]ServerInfo, bool) {
+	if C.boulder_steam_lobby_list_ready() == 0 {
+		return nil, false
+	}
+
+	var name [256]C.char
+	var address [1024]C.char
+
+	count := int(C.boulder_steam_lobby_count())
+	lobbies := make([]ServerInfo, 0, count)
+	for i := 0; i < count; i++ {
+		var lobbyID C.uint64_t
+		var players, maxPlayers, ping C.int
+		if C.boulder_steam_get_lobby(C.int(i), &lobbyID,
+			&name[0], C.uint32_t(len(name)),
+			&address[0], C.uint32_t(len(address)),
+			&players, &maxPlayers, &ping) != 0 {
+			continue
+		}
+
+		peer, err := ParsePeerAddress(C.GoString(&address[0]))
+		if err != nil {
+			continue
+		}
+
+		info := ServerInfo{
+			Name:       C.GoString(&name[0]),
+			Address:    peer,
+			Players:    int(players),
+			MaxPlayers: int(maxPlayers),
+			Ping:       -1,
+			Source:     ServerSourceSteam,
+			LobbyID:    uint64(lobbyID),
+		}
+		if ping >= 0 {
+			info.Ping = time.Duration(ping) * time.Millisecond
+		}
+		lobbies = append(lobbies, info)
+	}
+
+	sortServers(lobbies)
+	return lobbies, true
+}
+
+// CreateSteamLobby advertises a hosted game as a public Steam lobby. address is how
+// clients connect, usually a relay token from NetworkSession.CreateRelayToken.
+func CreateSteamLobby(maxPlayers int, name string, address PeerAddress) error {
+	defer lockThread()()
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	cAddress := C.CString(address.String())
+	defer C.free(unsafe.Pointer(cAddress))
+
+	if C.boulder_steam_create_lobby(C.int(maxPlayers), cName, cAddress) != 0 {
+		return lastError("failed to create steam lobby")
+	}
+	return nil
+}
+
+// GetHostedSteamLobby returns the ID of the lobby created by CreateSteamLobby, or 0
+func GetHostedSteamLobby() uint64 {
+	return uint64(C.boulder_steam_get_hosted_lobby())
+}
+
+// LeaveSteamLobby stops advertising the hosted lobby
+func LeaveSteamLobby() {
+	C.boulder_steam_leave_lobby()
+}
@@ -0,0 +1,164 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import "errors"
+
+// FullscreenMode is how the window covers its display
+type FullscreenMode int
+
+const (
+	FullscreenOff        FullscreenMode = 0 // Windowed
+	FullscreenBorderless FullscreenMode = 1 // A window covering the display at the desktop's resolution; quick to switch away from
+	FullscreenExclusive  FullscreenMode = 2 // Takes over the display in the mode set with SetDisplayMode
+)
+
+// CurrentDisplay is the display the window is on, for the calls that take a display index
+const CurrentDisplay = -1
+
+// DisplayMode is a resolution and refresh rate a display can run at
+type DisplayMode struct {
+	Width        int
+	Height       int
+	RefreshRate  float32 // Hz; 0 if unknown
+	PixelDensity float32 // Pixels per window coordinate, above 1 on high DPI displays
+}
+
+// Display is a monitor attached to the system
+type Display struct {
+	Index   int
+	Name    string
+	Desktop DisplayMode // The mode the desktop runs at
+}
+
+// GetDisplays returns the connected displays, in the system's order
+func (w *Window) GetDisplays() []Display {
+	if !w.engine.initialized {
+		return nil
+	}
+
+	count := int(C.boulder_get_display_count())
+	displays := make([]Display, 0, count)
+	for i := 0; i < count; i++ {
+		var name [256]C.char
+		var desktop C.DisplayMode
+		if C.boulder_get_display_name(C.int(i), &name[0], C.uint32_t(len(name))) != 0 {
+			continue
+		}
+		C.boulder_get_desktop_display_mode(C.int(i), &desktop)
+		displays = append(displays, Display{Index: i, Name: C.GoString(&name[0]), Desktop: displayModeFromNative(desktop)})
+	}
+	return displays
+}
+
+// GetDisplay returns the index of the display the window is on, -1 if it is unknown
+func (w *Window) GetDisplay() int {
+	if !w.engine.initialized {
+		return -1
+	}
+	return int(C.boulder_get_window_display())
+}
+
+// ListDisplayModes returns the modes a display can run exclusive fullscreen at, largest and
+// fastest first, e.g. for a resolution dropdown
+func (w *Window) ListDisplayModes(display int) ([]DisplayMode, error) {
+	if !w.engine.initialized {
+		return nil, errNotInitialized
+	}
+
+	count := int(C.boulder_get_display_modes(C.int(display), nil, 0))
+	if count < 0 {
+		return nil, errors.New("no such display")
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	native := make([]C.DisplayMode, count)
+	count = min(count, int(C.boulder_get_display_modes(C.int(display), &native[0], C.uint32_t(len(native)))))
+	modes := make([]DisplayMode, 0, count)
+	for i := 0; i < count; i++ {
+		modes = append(modes, displayModeFromNative(native[i]))
+	}
+	return modes, nil
+}
+
+// SetFullscreen switches the window between windowed, borderless and exclusive fullscreen
+// on a display (CurrentDisplay keeps the window's). The swapchain is recreated on the next
+// frame and a WindowResized event follows.
+func (w *Window) SetFullscreen(mode FullscreenMode, display int) error {
+	defer lockThread()()
+	if !w.engine.initialized {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_set_fullscreen(C.int(mode), C.int(display)); ret != 0 {
+		return lastError("failed to set fullscreen mode")
+	}
+
+	return nil
+}
+
+// GetFullscreen returns how the window covers its display
+func (w *Window) GetFullscreen() FullscreenMode {
+	if !w.engine.initialized {
+		return FullscreenOff
+	}
+	return FullscreenMode(C.boulder_get_fullscreen())
+}
+
+// SetDisplayMode picks the resolution and refresh rate for exclusive fullscreen on a
+// display, the closest the display supports (a refreshRate of 0 picks the desktop's), and
+// returns the mode picked. A window already in exclusive fullscreen switches at once.
+func (w *Window) SetDisplayMode(display int, mode DisplayMode) (DisplayMode, error) {
+	defer lockThread()()
+	if !w.engine.initialized {
+		return DisplayMode{}, errNotInitialized
+	}
+
+	var chosen C.DisplayMode
+	if ret := C.boulder_set_display_mode(C.int(display), C.int(mode.Width), C.int(mode.Height), C.float(mode.RefreshRate), &chosen); ret != 0 {
+		return DisplayMode{}, lastError("failed to set display mode")
+	}
+
+	return displayModeFromNative(chosen), nil
+}
+
+// SetVSync turns vsync on (PresentFIFO) or off (PresentImmediate, the default). Use
+// Renderer.SetPresentMode for the other present modes.
+func (w *Window) SetVSync(enabled bool) error {
+	defer lockThread()()
+	if !w.engine.initialized {
+		return errNotInitialized
+	}
+
+	mode := PresentImmediate
+	if enabled {
+		mode = PresentFIFO
+	}
+	if ret := C.boulder_set_present_mode(C.int(mode)); ret != 0 {
+		return lastError("failed to set vsync")
+	}
+
+	return nil
+}
+
+// IsVSync returns whether frames wait for the display's refresh
+func (w *Window) IsVSync() bool {
+	if !w.engine.initialized {
+		return false
+	}
+	mode := PresentMode(C.boulder_get_present_mode())
+	return mode == PresentFIFO || mode == PresentFIFORelaxed
+}
+
+func displayModeFromNative(mode C.DisplayMode) DisplayMode {
+	return DisplayMode{
+		Width:        int(mode.width),
+		Height:       int(mode.height),
+		RefreshRate:  float32(mode.refreshRate),
+		PixelDensity: float32(mode.pixelDensity),
+	}
+}
@@ -0,0 +1,241 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+const (
+	NetworkEventServerDraining NetworkEventType = 7
+	NetworkEventDrainProgress  NetworkEventType = 8
+	NetworkEventDrained        NetworkEventType = 9
+)
+
+// drainProgressInterval is how often a draining server reports its progress
+const drainProgressInterval = 250 * time.Millisecond
+
+// ServerDrainingEvent is returned on a client when the server it is connected to begins
+// draining, e.g. to show "Server restarting" before the connection closes. The connection
+// isn't reconnected when it does.
+type ServerDrainingEvent struct {
+	Connection ConnectionHandle
+	Reason     string
+	TimeLeft   time.Duration // Until the server closes the connection at the latest
+}
+
+func (e ServerDrainingEvent) Type() NetworkEventType { return NetworkEventServerDraining }
+
+// DrainProgressEvent is returned on a draining server as its clients receive what is still
+// queued for them
+type DrainProgressEvent struct {
+	Connections  int // Still open
+	PendingBytes int // Queued or unacknowledged on them
+	Elapsed      time.Duration
+	TimeLeft     time.Duration
+}
+
+func (e DrainProgressEvent) Type() NetworkEventType { return NetworkEventDrainProgress }
+
+// DrainedEvent is returned once a draining server has closed every connection. The session
+// then accepts nothing more and can be destroyed.
+type DrainedEvent struct {
+	Reason  string
+	Elapsed time.Duration
+	Forced  int // Connections closed at the deadline with data still undelivered
+}
+
+func (e DrainedEvent) Type() NetworkEventType { return NetworkEventDrained }
+
+// drainState is a server drain in progress, and the drain notices a client received
+type drainState struct {
+	active       bool
+	reason       string
+	started      time.Time
+	deadline     time.Time
+	conns        map[ConnectionHandle]bool
+	lastProgress time.Time
+	events       []NetworkEvent
+}
+
+// BeginDrain shuts a server down gracefully: clients are told why and how long they have,
+// new connections are refused, and each connection closes once everything sent to it has
+// been delivered, or when seconds run out. Progress comes from PollEvent as
+// DrainProgressEvents, ending with a DrainedEvent. Messages can still be sent meanwhile,
+// e.g. final scores.
+func (ns *NetworkSession) BeginDrain(reason string, seconds float64) error {
+	if ns.handle == nil {
+		return errSessionNotInitialized
+	}
+	if seconds < 0 {
+		return errors.New("drain time can't be negative")
+	}
+	if ns.IsDraining() {
+		return errors.New("session is already draining")
+	}
+
+	C.boulder_set_accepting_connections(ns.handle, 0)
+
+	now := time.Now()
+	grace := time.Duration(seconds * float64(time.Second))
+	if ns.drain == nil {
+		ns.drain = &drainState{}
+	}
+	d := ns.drain
+	d.active = true
+	d.reason = reason
+	d.started = now
+	d.deadline = now.Add(grace)
+	d.conns = make(map[ConnectionHandle]bool)
+
+	payload := make([]byte, 4, 4+len(reason))
+	binary.LittleEndian.PutUint32(payload, uint32(grace.Milliseconds()))
+	payload = append(payload, reason...)
+	for _, conn := range ns.openConnections() {
+		d.conns[conn] = true
+		if err := ns.sendControl(conn, controlDrain, payload, true); err != nil {
+			LogError(fmt.Sprintf("Failed to tell connection %d about the drain: %v", conn, err))
+		}
+	}
+
+	LogInfo(fmt.Sprintf("Draining %d connections within %v: %s", len(d.conns), grace, reason))
+	ns.updateDrain()
+	return nil
+}
+
+// IsDraining reports whether BeginDrain was called and the drain hasn't finished
+func (ns *NetworkSession) IsDraining() bool {
+	return ns.drain != nil && ns.drain.active
+}
+
+// openConnections returns the session's connections, native and through transport plugins
+func (ns *NetworkSession) openConnections() []ConnectionHandle {
+	count := int(C.boulder_get_connections(ns.handle, nil, 0))
+	conns := make([]ConnectionHandle, max(0, count))
+	if count > 0 {
+		count = int(C.boulder_get_connections(ns.handle, (*C.ConnectionHandle)(unsafe.Pointer(&conns[0])), C.uint32_t(count)))
+		conns = conns[:min(count, len(conns))]
+	}
+
+	if ns.plugins != nil {
+		for conn := range ns.plugins.conns {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
+// updateDrain reports the drain's progress and closes the connections that are flushed, or
+// all of them once the deadline passes
+func (ns *NetworkSession) updateDrain() {
+	d := ns.drain
+	if d == nil || !d.active {
+		return
+	}
+
+	now := time.Now()
+	expired := !now.Before(d.deadline)
+	pending := 0
+	forced := 0
+	for conn := range d.conns {
+		queued := 0
+		if stats, err := ns.GetConnectionStats(conn); err == nil {
+			queued = stats.QueuedBytes + stats.UnackedBytes
+		}
+		if queued > 0 && !expired {
+			pending += queued
+			continue
+		}
+		if queued > 0 {
+			forced++
+		}
+		ns.closeWithReason(conn, d.reason)
+		delete(d.conns, conn)
+	}
+
+	if len(d.conns) > 0 {
+		if now.Sub(d.lastProgress) >= drainProgressInterval {
+			d.lastProgress = now
+			d.events = append(d.events, DrainProgressEvent{
+				Connections:  len(d.conns),
+				PendingBytes: pending,
+				Elapsed:      now.Sub(d.started),
+				TimeLeft:     d.deadline.Sub(now),
+			})
+		}
+		return
+	}
+
+	d.active = false
+	C.boulder_stop_server(ns.handle)
+	LogInfo(fmt.Sprintf("Drained in %v (%d connections closed with data undelivered)", now.Sub(d.started), forced))
+	d.events = append(d.events, DrainedEvent{Reason: d.reason, Elapsed: now.Sub(d.started), Forced: forced})
+}
+
+// closeWithReason closes a connection, telling the peer why and letting
+// GameNetworkingSockets deliver what it still holds, without a DisconnectedEvent
+func (ns *NetworkSession) closeWithReason(conn ConnectionHandle, reason string) {
+	if pc, ok := ns.lookupPlugin(conn); ok {
+		pc.plugin.Disconnect(pc.conn)
+		ns.plugins.remove(conn)
+	} else {
+		cReason := C.CString(reason)
+		defer C.free(unsafe.Pointer(cReason))
+		C.boulder_close_connection(ns.handle, C.ConnectionHandle(conn), cReason, 1)
+	}
+	ns.forgetConnection(conn)
+}
+
+// refuseWhileDraining closes a connection that completed while the session drains
+func (ns *NetworkSession) refuseWhileDraining(conn ConnectionHandle) bool {
+	if !ns.IsDraining() {
+		return false
+	}
+	ns.closeWithReason(conn, ns.drain.reason)
+	return true
+}
+
+// drainDropped stops waiting on a connection that closed by itself during the drain
+func (ns *NetworkSession) drainDropped(conn ConnectionHandle) {
+	if ns.drain != nil && ns.drain.conns != nil {
+		delete(ns.drain.conns, conn)
+	}
+}
+
+// handleDrain turns a server's drain notice into a ServerDrainingEvent. Only the servers
+// this session connected to may send one; from a connection it accepted, a client could
+// otherwise make it report that it is draining itself.
+func (ns *NetworkSession) handleDrain(conn ConnectionHandle, payload []byte) {
+	if len(payload) < 4 || !ns.outgoing[conn] {
+		return
+	}
+
+	// A server closing on purpose isn't a dropped link to reconnect
+	ns.forgetReconnect(conn)
+
+	if ns.drain == nil {
+		ns.drain = &drainState{}
+	}
+	ns.drain.events = append(ns.drain.events, ServerDrainingEvent{
+		Connection: conn,
+		Reason:     string(payload[4:]),
+		TimeLeft:   time.Duration(binary.LittleEndian.Uint32(payload)) * time.Millisecond,
+	})
+}
+
+// takeDrainEvent returns the oldest drain event not yet polled
+func (ns *NetworkSession) takeDrainEvent() NetworkEvent {
+	d := ns.drain
+	if d == nil || len(d.events) == 0 {
+		return nil
+	}
+	event := d.events[0]
+	d.events = d.events[1:]
+	return event
+}
@@ -0,0 +1,41 @@
+#version 450
+
+// Custom material example: burns the model away where a noise texture is below the
+// dissolve amount, with a glowing edge. Use with model.mesh through CreateMaterialPipeline, with
+// pipeline.DefineParam("dissolve", 32) so Entity.SetMaterialFloat("dissolve", v) drives it.
+
+layout(location = 0) in vec3 fragNormal;
+layout(location = 1) in vec2 fragTexCoord;
+layout(location = 2) in vec3 fragWorldPos;
+
+layout(set = 1, binding = 0) uniform MaterialParams {
+    vec4 baseColor;
+    vec4 edgeColor;
+    float dissolve; // 0 = intact, 1 = gone
+    float edgeWidth;
+} params;
+
+layout(set = 1, binding = 1) uniform sampler2D textures[4]; // 0 = albedo, 1 = noise
+
+layout(push_constant) uniform PushConstants {
+    layout(offset = 144) vec4 tint;
+    vec4 emissive;
+} pc;
+
+layout(location = 0) out vec4 outColor;
+
+#include "lights.glsl"
+
+void main() {
+    float noise = texture(textures[1], fragTexCoord).r;
+    if (noise < params.dissolve) {
+        discard;
+    }
+
+    vec3 normal = normalize(fragNormal);
+    vec3 diffuse = diffuseLighting(normal, fragWorldPos);
+    vec3 color = texture(textures[0], fragTexCoord).rgb * params.baseColor.rgb * pc.tint.rgb * diffuse + pc.emissive.rgb;
+
+    float edge = 1.0 - smoothstep(0.0, params.edgeWidth, noise - params.dissolve);
+    outColor = vec4(mix(color, params.edgeColor.rgb, edge * step(0.001, params.dissolve)), 1.0);
+}
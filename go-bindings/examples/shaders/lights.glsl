@@ -0,0 +1,50 @@
+// Scene lights (Entity.AddDirectionalLight, AddPointLight, AddSpotLight), shared by the
+// model shaders through #include "lights.glsl"
+
+struct Light {
+    vec4 positionRange;  // w: range, 0 for no cutoff
+    vec4 directionType;  // xyz: direction the light travels, w: 0 directional, 1 point, 2 spot
+    vec4 colorIntensity;
+    vec4 cone;           // Cosines of the inner and outer half angles
+};
+
+layout(std430, set = 0, binding = 3) readonly buffer Lights {
+    vec4 ambient;
+    uint count;
+    Light lights[];
+} scene;
+
+// Direction toward light i from position, and how much of it arrives there
+vec3 lightDirection(uint i, vec3 position, out float strength) {
+    Light light = scene.lights[i];
+    strength = light.colorIntensity.w;
+    int type = int(light.directionType.w);
+    if (type == 0) {
+        return -light.directionType.xyz;
+    }
+
+    vec3 toLight = light.positionRange.xyz - position;
+    float dist = length(toLight);
+    vec3 l = toLight / max(dist, 1e-4);
+    float range = light.positionRange.w;
+    if (range > 0.0) {
+        float fade = clamp(1.0 - pow(dist / range, 4.0), 0.0, 1.0);
+        strength *= fade * fade;
+    }
+    strength /= dist * dist + 1.0;
+    if (type == 2) {
+        strength *= smoothstep(light.cone.y, light.cone.x, dot(-l, light.directionType.xyz));
+    }
+    return l;
+}
+
+// Ambient plus Lambert diffuse from every light
+vec3 diffuseLighting(vec3 normal, vec3 position) {
+    vec3 light = scene.ambient.rgb;
+    for (uint i = 0u; i < scene.count; i++) {
+        float strength;
+        vec3 l = lightDirection(i, position, strength);
+        light += scene.lights[i].colorIntensity.rgb * strength * max(dot(normal, l), 0.0);
+    }
+    return light;
+}
@@ -6,15 +6,28 @@ layout(location = 2) in vec3 fragWorldPos;
 
 layout(location = 0) out vec4 outColor;
 
+// Blend mode the pipeline was created for (1 = alpha test)
+layout(constant_id = 0) const int BLEND_MODE = 0;
+
+// Per-entity tint and emissive color (Entity.SetTint / SetEmissive)
+layout(push_constant) uniform PushConstants {
+    layout(offset = 144) vec4 tint;
+    vec4 emissive;
+} pc;
+
+#include "lights.glsl"
+
 void main() {
     // Debug: Show normals as colors to verify geometry is correct
     vec3 normalColor = normalize(fragNormal) * 0.5 + 0.5;
 
     // Also show some simple lighting
-    vec3 lightDir = normalize(vec3(0.5, 1.0, 0.3));
     vec3 normal = normalize(fragNormal);
-    float diffuse = max(dot(normal, lightDir), 0.0) * 0.8 + 0.2;
+    vec3 light = diffuseLighting(normal, fragWorldPos);
 
-    vec3 color = normalColor * diffuse;
-    outColor = vec4(color, 1.0);
+    vec4 color = vec4(normalColor * light, 1.0) * pc.tint;
+    if (BLEND_MODE == 1 && color.a < 0.5) {
+        discard;
+    }
+    outColor = vec4(color.rgb + pc.emissive.rgb, color.a);
 }
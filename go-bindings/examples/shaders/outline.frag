@@ -0,0 +1,11 @@
+#version 450
+
+layout(push_constant) uniform PushConstants {
+    layout(offset = 144) vec4 color;
+} pc;
+
+layout(location = 0) out vec4 outColor;
+
+void main() {
+    outColor = pc.color;
+}
@@ -0,0 +1,116 @@
+#version 450
+
+// Standard material: metallic-roughness shading of the values and textures Entity.SetMaterial
+// and glTF models' materials fill in. Use with model.mesh through CreateMaterialPipeline and
+// engine.SetDefaultMaterialPipeline so loaded models show their textures.
+
+layout(location = 0) in vec3 fragNormal;
+layout(location = 1) in vec2 fragTexCoord;
+layout(location = 2) in vec3 fragWorldPos;
+
+layout(set = 1, binding = 0) uniform MaterialParams {
+    vec4 baseColor;
+    vec4 emissive;
+    float metallic;
+    float roughness;
+    float normalScale;
+    float alphaCutoff;
+} params;
+
+// 0 = albedo, 1 = normal, 2 = metallic-roughness (G roughness, B metallic), 3 = emissive
+layout(set = 1, binding = 1) uniform sampler2D textures[4];
+
+layout(constant_id = 0) const int BLEND_MODE = 0;
+
+layout(push_constant) uniform PushConstants {
+    mat4 viewProj;
+    mat4 model;
+    uint vertexOffset;
+    uint indexOffset;
+    uvec2 padding;
+    vec4 tint;
+    vec4 emissive;
+} pc;
+
+layout(location = 0) out vec4 outColor;
+
+const float PI = 3.14159265;
+
+#include "lights.glsl"
+
+// Textures are uploaded as UNORM, so color textures are decoded here
+vec3 srgbToLinear(vec3 c) {
+    return pow(c, vec3(2.2));
+}
+
+// Meshes have no tangents: the tangent frame comes from screen space derivatives
+vec3 perturbNormal(vec3 normal, vec3 position, vec2 uv) {
+    vec3 sampled = texture(textures[1], uv).xyz * 2.0 - 1.0;
+    sampled.xy *= params.normalScale;
+
+    vec3 dp1 = dFdx(position);
+    vec3 dp2 = dFdy(position);
+    vec2 duv1 = dFdx(uv);
+    vec2 duv2 = dFdy(uv);
+    vec3 dp2perp = cross(dp2, normal);
+    vec3 dp1perp = cross(normal, dp1);
+    vec3 tangent = dp2perp * duv1.x + dp1perp * duv2.x;
+    vec3 bitangent = dp2perp * duv1.y + dp1perp * duv2.y;
+    float scale = inversesqrt(max(dot(tangent, tangent), dot(bitangent, bitangent)));
+    if (isinf(scale) || isnan(scale)) {
+        return normal;
+    }
+    return normalize(mat3(tangent * scale, bitangent * scale, normal) * sampled);
+}
+
+// The camera is where clip space w is 0 at every depth
+vec3 viewDirection(vec3 position) {
+    vec4 eye = inverse(pc.viewProj) * vec4(0.0, 0.0, 1.0, 0.0);
+    if (abs(eye.w) < 1e-6) {
+        return normalize(-eye.xyz); // Orthographic
+    }
+    return normalize(eye.xyz / eye.w - position);
+}
+
+void main() {
+    vec4 albedo = texture(textures[0], fragTexCoord);
+    vec4 base = vec4(srgbToLinear(albedo.rgb), albedo.a) * params.baseColor * pc.tint;
+    if (BLEND_MODE == 1 && base.a < params.alphaCutoff) {
+        discard;
+    }
+
+    vec4 metallicRoughness = texture(textures[2], fragTexCoord);
+    float metallic = clamp(params.metallic * metallicRoughness.b, 0.0, 1.0);
+    float roughness = clamp(params.roughness * metallicRoughness.g, 0.04, 1.0);
+
+    vec3 n = perturbNormal(normalize(fragNormal), fragWorldPos, fragTexCoord);
+    vec3 v = viewDirection(fragWorldPos);
+    float nv = max(dot(n, v), 1e-4);
+    float a = roughness * roughness;
+    float a2 = a * a;
+    float k = (roughness + 1.0) * (roughness + 1.0) / 8.0;
+    vec3 f0 = mix(vec3(0.04), base.rgb, metallic);
+
+    vec3 color = base.rgb * scene.ambient.rgb;
+    for (uint i = 0u; i < scene.count; i++) {
+        float strength;
+        vec3 l = lightDirection(i, fragWorldPos, strength);
+        vec3 h = normalize(v + l);
+        float nl = max(dot(n, l), 0.0);
+        float nh = max(dot(n, h), 0.0);
+        float vh = max(dot(v, h), 0.0);
+
+        // GGX distribution, Smith visibility and Schlick Fresnel
+        float d = nh * nh * (a2 - 1.0) + 1.0;
+        float distribution = a2 / (PI * d * d);
+        float visibility = 0.25 / ((nl * (1.0 - k) + k) * (nv * (1.0 - k) + k));
+        vec3 fresnel = f0 + (1.0 - f0) * pow(1.0 - vh, 5.0);
+
+        vec3 diffuse = (1.0 - fresnel) * (1.0 - metallic) * base.rgb / PI;
+        vec3 specular = fresnel * distribution * visibility;
+        color += (diffuse + specular) * scene.lights[i].colorIntensity.rgb * strength * nl * PI;
+    }
+
+    vec3 emissive = srgbToLinear(texture(textures[3], fragTexCoord).rgb) * params.emissive.rgb;
+    outColor = vec4(color + emissive + pc.emissive.rgb, base.a);
+}
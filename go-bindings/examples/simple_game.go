@@ -184,10 +184,8 @@ func main() {
 	connected := false
 	shouldQuit := false
 
-	// Initialize with dummy network sessions (Null Object pattern)
-	server := boulder.NewDummyNetworkSession()
-	client := boulder.NewDummyNetworkSession()
-	var activeConnection boulder.ConnectionHandle = 0
+	// Initialize with a dummy host session (Null Object pattern)
+	host := boulder.NewDummyHostSession()
 
 	for !window.ShouldClose() && !shouldQuit {
 
@@ -203,28 +201,31 @@ func main() {
 		}
 
 		// Always safe to call Update/PollEvent on dummy sessions (they do nothing)
-		server.Update()
-		client.Update()
+		host.Update()
 
 		// Poll server events
 		for {
-			event := server.PollEvent()
+			event := host.Server.PollEvent()
 			if event == nil {
 				break
 			}
-			if _, ok := event.(boulder.ConnectedEvent); ok {
-				boulder.LogInfo("[SERVER] P2P client connected!")
+			if e, ok := event.(boulder.ConnectedEvent); ok {
+				if host.IsLocalConnection(e.Connection) {
+					boulder.LogInfo("[SERVER] Local client connected!")
+				} else {
+					boulder.LogInfo("[SERVER] Remote client connected!")
+				}
 			}
 		}
 
 		// Poll client events
 		for {
-			event := client.PollEvent()
+			event := host.Client.PollEvent()
 			if event == nil {
 				break
 			}
 			if _, ok := event.(boulder.ConnectedEvent); ok {
-				boulder.LogInfo("[CLIENT] P2P connection established!")
+				boulder.LogInfo("[CLIENT] Connected to local server!")
 				connected = true
 				// Update status indicator color when connected
 				if statusIndicator != nil {
@@ -258,55 +259,16 @@ func main() {
 			boulder.LogInfo("Start Server button clicked!")
 			startServerButton.ResetClick()
 
-			// Clean up any existing sessions
-			if server.IsValid() {
-				server.Destroy()
-			}
-			if client.IsValid() {
-				if activeConnection != 0 {
-					client.Disconnect(activeConnection)
-				}
-				client.Destroy()
-			}
+			// Clean up any existing session
+			host.Destroy()
 
-			// Create real network sessions
 			var err error
-			server, err = boulder.NewNetworkSession(engine)
+			host, err = boulder.NewHostSession(engine, 27015)
 			if err != nil {
-				boulder.LogError(fmt.Sprintf("Failed to create server: %v", err))
-				server = boulder.NewDummyNetworkSession()
+				boulder.LogError(fmt.Sprintf("Failed to host session: %v", err))
+				host = boulder.NewDummyHostSession()
 			} else {
-				server.SetLocalIdentity("P2P Server")
-				if err := server.StartServerP2P(1000); err != nil {
-					boulder.LogError(fmt.Sprintf("Failed to start P2P server: %v (Steam running?)", err))
-					server.Destroy()
-					server = boulder.NewDummyNetworkSession()
-				} else {
-					boulder.LogInfo("✓ P2P Server started!")
-					serverSteamID := server.GetLocalSteamID()
-
-					// Create client session
-					client, err = boulder.NewNetworkSession(engine)
-					if err != nil {
-						boulder.LogError(fmt.Sprintf("Failed to create client: %v", err))
-						client = boulder.NewDummyNetworkSession()
-					} else {
-						client.SetLocalIdentity("P2P Client")
-						clientSteamID := client.GetLocalSteamID()
-						boulder.LogInfo(fmt.Sprintf("✓ P2P Client created (Steam ID: %d)", clientSteamID))
-
-						// Connect P2P
-						activeConnection, err = client.ConnectP2P(serverSteamID, 1000)
-						if err != nil {
-							boulder.LogError(fmt.Sprintf("Failed to connect P2P: %v", err))
-							client.Destroy()
-							client = boulder.NewDummyNetworkSession()
-							activeConnection = 0
-						} else {
-							boulder.LogInfo("✓ Connecting to P2P server...")
-						}
-					}
-				}
+				boulder.LogInfo("✓ Hosting on port 27015")
 			}
 		}
 
@@ -314,25 +276,11 @@ func main() {
 			boulder.LogInfo("Disconnect button clicked!")
 			disconnectButton.ResetClick()
 
-			// Disconnect and clean up sessions
-			if client.IsValid() {
-				if activeConnection != 0 {
-					client.Disconnect(activeConnection)
-					activeConnection = 0
-				}
-				client.Destroy()
-			}
-			if server.IsValid() {
-				server.StopServer()
-				server.Destroy()
-			}
-
-			// Replace with dummy sessions
-			server = boulder.NewDummyNetworkSession()
-			client = boulder.NewDummyNetworkSession()
+			// Disconnect and clean up sessions (Destroy leaves dummy sessions behind)
+			host.Destroy()
 			connected = false
 
-			boulder.LogInfo("✓ Disconnected from P2P")
+			boulder.LogInfo("✓ Stopped hosting")
 		}
 
 		if jumpButton != nil && jumpButton.WasClicked() {
@@ -373,13 +321,9 @@ func main() {
 			boulder.LogError(fmt.Sprintf("Update error: %v", err))
 		}
 
-		/*if err := engine.Render(); err != nil {
+		if err := engine.Render(); err != nil {
 			boulder.LogError(fmt.Sprintf("Render error: %v", err))
-		}*/
-
-		img := boulder.BeginFrame()
-		boulder.RenderModels()
-		boulder.EndFrame(img)
+		}
 
 		// Calculate FPS
 		frameCount++
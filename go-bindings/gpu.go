@@ -0,0 +1,113 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+
+// GPUType is the kind of graphics adapter (values match VkPhysicalDeviceType)
+type GPUType int
+
+const (
+	GPUTypeOther      GPUType = 0
+	GPUTypeIntegrated GPUType = 1
+	GPUTypeDiscrete   GPUType = 2
+	GPUTypeVirtual    GPUType = 3
+	GPUTypeCPU        GPUType = 4
+)
+
+// String returns a readable name for the GPU type
+func (t GPUType) String() string {
+	switch t {
+	case GPUTypeIntegrated:
+		return "integrated"
+	case GPUTypeDiscrete:
+		return "discrete"
+	case GPUTypeVirtual:
+		return "virtual"
+	case GPUTypeCPU:
+		return "cpu"
+	default:
+		return "other"
+	}
+}
+
+// GPUPreference picks a GPU when none is pinned by index
+type GPUPreference int
+
+const (
+	GPUPreferenceDefault         GPUPreference = 0 // First supported GPU
+	GPUPreferenceHighPerformance GPUPreference = 1 // Discrete GPU if there is one
+	GPUPreferenceLowPower        GPUPreference = 2 // Integrated GPU if there is one
+)
+
+// GPUInfo describes a graphics adapter found by EnumerateGPUs
+type GPUInfo struct {
+	Index     int // Pass as EngineConfig.GPU or to Engine.SetGPU
+	Name      string
+	Type      GPUType
+	Memory    uint64 // Device-local memory in bytes
+	VendorID  uint32
+	DeviceID  uint32
+	Supported bool // Has the mesh shader support the renderer requires
+}
+
+// EnumerateGPUs returns the graphics adapters available to the engine (the engine must be
+// initialized)
+func EnumerateGPUs() ([]GPUInfo, error) {
+	count := int(C.boulder_get_gpu_count())
+	if count < 0 {
+		return nil, errNotInitialized
+	}
+
+	var name [256]C.char
+	gpus := make([]GPUInfo, 0, count)
+	for i := 0; i < count; i++ {
+		var gpuType, supported C.int
+		var memory C.uint64_t
+		var vendorID, deviceID C.uint32_t
+		if C.boulder_get_gpu_info(C.int(i), &name[0], C.uint32_t(len(name)), &gpuType,
+			&memory, &vendorID, &deviceID, &supported) != 0 {
+			continue
+		}
+
+		gpus = append(gpus, GPUInfo{
+			Index:     i,
+			Name:      C.GoString(&name[0]),
+			Type:      GPUType(gpuType),
+			Memory:    uint64(memory),
+			VendorID:  uint32(vendorID),
+			DeviceID:  uint32(deviceID),
+			Supported: supported != 0,
+		})
+	}
+
+	return gpus, nil
+}
+
+// SetGPU pins the GPU at index (-1 picks by the config's preference). It applies the next
+// time a window is created, so call Restart to switch a running game.
+func (e *Engine) SetGPU(index int) {
+	e.config.GPU = index
+	if e.initialized {
+		C.boulder_set_gpu(C.int(e.config.GPU), C.int(e.config.GPUPreference))
+	}
+}
+
+// SetGPUPreference sets how a GPU is picked when none is pinned. Like SetGPU it applies
+// the next time a window is created.
+func (e *Engine) SetGPUPreference(preference GPUPreference) {
+	e.config.GPUPreference = preference
+	if e.initialized {
+		C.boulder_set_gpu(C.int(e.config.GPU), C.int(e.config.GPUPreference))
+	}
+}
+
+// GetSelectedGPU returns the index of the GPU the device was created on, or -1 if no
+// window has been created
+func (e *Engine) GetSelectedGPU() int {
+	if !e.initialized {
+		return -1
+	}
+	return int(C.boulder_get_selected_gpu())
+}
@@ -0,0 +1,515 @@
+package boulder
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// DamageType classifies damage for resistances
+type DamageType uint8
+
+const (
+	DamageGeneric   DamageType = 0
+	DamagePhysical  DamageType = 1
+	DamageFire      DamageType = 2
+	DamageCold      DamageType = 3
+	DamagePoison    DamageType = 4
+	DamageExplosive DamageType = 5
+)
+
+// String returns the damage type name
+func (t DamageType) String() string {
+	switch t {
+	case DamagePhysical:
+		return "physical"
+	case DamageFire:
+		return "fire"
+	case DamageCold:
+		return "cold"
+	case DamagePoison:
+		return "poison"
+	case DamageExplosive:
+		return "explosive"
+	default:
+		return "generic"
+	}
+}
+
+// DamageEvent is damage dealt to an entity with health or to a destructible
+type DamageEvent struct {
+	Amount  float32
+	Type    DamageType
+	Source  EntityID // Entity responsible for the damage, if any
+	Point   Vector3  // World position of the hit
+	Impulse Vector3  // Momentum delivered by the hit, spread over the pieces of destructibles
+	Radius  float32  // Destructible pieces further than this from Point get no impulse (0 = no falloff)
+}
+
+// Health is the health of an entity
+type Health struct {
+	Current      float32
+	Max          float32
+	Resistances  map[DamageType]float32 // Fraction of damage ignored; 1 is immune, negative is a weakness
+	Invulnerable bool
+}
+
+// IsDead returns true once health has run out
+func (h Health) IsDead() bool {
+	return h.Current <= 0
+}
+
+// StatusEffect is an effect that deals damage (or heals, with negative damage) over time
+type StatusEffect struct {
+	Name          string
+	Duration      time.Duration
+	TickInterval  time.Duration // Zero applies no damage, e.g. for effects read by game code
+	DamagePerTick float32
+	DamageType    DamageType
+	MaxStacks     int // Reapplying adds a stack up to this; 0 or 1 only refreshes the duration
+	Source        EntityID
+}
+
+// ActiveEffect is a status effect currently on an entity
+type ActiveEffect struct {
+	Name      string
+	Remaining time.Duration
+	Stacks    int
+}
+
+// HealthEventType identifies a health event
+type HealthEventType uint8
+
+const (
+	HealthEventDamaged       HealthEventType = 0
+	HealthEventHealed        HealthEventType = 1
+	HealthEventDied          HealthEventType = 2
+	HealthEventRevived       HealthEventType = 3
+	HealthEventEffectApplied HealthEventType = 4
+	HealthEventEffectExpired HealthEventType = 5
+)
+
+// HealthEvent reports a change to an entity's health
+type HealthEvent struct {
+	Type       HealthEventType
+	Entity     EntityID
+	Amount     float32 // Damage taken or health restored
+	DamageType DamageType
+	Source     EntityID
+	Effect     string // Status effect name for effect events
+}
+
+// HealthCallback is called for each health event
+type HealthCallback func(event HealthEvent)
+
+type activeEffect struct {
+	effect    StatusEffect
+	remaining time.Duration
+	nextTick  time.Duration
+	stacks    int
+}
+
+type healthEntity struct {
+	health  Health
+	effects []*activeEffect
+}
+
+// HealthSystem tracks health, damage and status effects. With a ReplicationServer attached
+// the health of replicated entities is sent to clients; with a ReplicationClient attached
+// the health of proxies is received from the server and can't be changed locally.
+type HealthSystem struct {
+	world    *World
+	entities map[EntityID]*healthEntity
+	events   []HealthEvent
+	onEvent  HealthCallback
+
+	server *ReplicationServer
+	client *ReplicationClient
+	remote map[EntityID]Health // Client side, keyed by server entity
+}
+
+// NewHealthSystem creates a health system for a world
+func NewHealthSystem(world *World) *HealthSystem {
+	return &HealthSystem{
+		world:    world,
+		entities: make(map[EntityID]*healthEntity),
+		remote:   make(map[EntityID]Health),
+	}
+}
+
+// OnEvent sets the callback run for each health event. Events are also queued for PollEvents.
+func (hs *HealthSystem) OnEvent(callback HealthCallback) {
+	hs.onEvent = callback
+}
+
+// PollEvents returns the health events since the last call
+func (hs *HealthSystem) PollEvents() []HealthEvent {
+	events := hs.events
+	hs.events = nil
+	return events
+}
+
+// AddHealth gives an entity full health
+func (hs *HealthSystem) AddHealth(entity EntityID, max float32) error {
+	if max <= 0 {
+		return errors.New("max health must be positive")
+	}
+
+	hs.entities[entity] = &healthEntity{health: Health{Current: max, Max: max}}
+	hs.replicate(entity, nil)
+	return nil
+}
+
+// RemoveHealth removes an entity's health and status effects
+func (hs *HealthSystem) RemoveHealth(entity EntityID) {
+	delete(hs.entities, entity)
+}
+
+// GetHealth returns an entity's health. On clients this includes replicated proxies.
+func (hs *HealthSystem) GetHealth(entity EntityID) (Health, bool) {
+	if h, ok := hs.entities[entity]; ok {
+		return h.health, true
+	}
+	if hs.client != nil {
+		if server, ok := hs.client.GetServerEntity(entity); ok {
+			health, ok := hs.remote[server]
+			return health, ok
+		}
+	}
+	return Health{}, false
+}
+
+// SetResistance sets the fraction of a damage type an entity ignores
+func (hs *HealthSystem) SetResistance(entity EntityID, damageType DamageType, resistance float32) error {
+	h, err := hs.local(entity)
+	if err != nil {
+		return err
+	}
+
+	if h.health.Resistances == nil {
+		h.health.Resistances = make(map[DamageType]float32)
+	}
+	h.health.Resistances[damageType] = min(resistance, 1)
+	return nil
+}
+
+// SetInvulnerable stops an entity taking damage
+func (hs *HealthSystem) SetInvulnerable(entity EntityID, invulnerable bool) error {
+	h, err := hs.local(entity)
+	if err != nil {
+		return err
+	}
+	h.health.Invulnerable = invulnerable
+	return nil
+}
+
+// ApplyDamage deals damage after resistances and returns how much was taken
+func (hs *HealthSystem) ApplyDamage(entity EntityID, event DamageEvent) (float32, error) {
+	h, err := hs.local(entity)
+	if err != nil {
+		return 0, err
+	}
+	if h.health.IsDead() || h.health.Invulnerable || event.Amount <= 0 {
+		return 0, nil
+	}
+
+	amount := event.Amount * (1 - h.health.Resistances[event.Type])
+	if amount <= 0 {
+		return 0, nil
+	}
+	amount = min(amount, h.health.Current)
+	h.health.Current -= amount
+
+	hs.emit(HealthEvent{Type: HealthEventDamaged, Entity: entity, Amount: amount, DamageType: event.Type, Source: event.Source})
+	if h.health.IsDead() {
+		h.health.Current = 0
+		h.effects = nil
+		hs.emit(HealthEvent{Type: HealthEventDied, Entity: entity, DamageType: event.Type, Source: event.Source})
+	}
+	return amount, nil
+}
+
+// Heal restores health up to the maximum and returns how much was restored. The dead
+// can't be healed; use Revive.
+func (hs *HealthSystem) Heal(entity EntityID, amount float32, source EntityID) (float32, error) {
+	h, err := hs.local(entity)
+	if err != nil {
+		return 0, err
+	}
+	if h.health.IsDead() || amount <= 0 {
+		return 0, nil
+	}
+
+	amount = min(amount, h.health.Max-h.health.Current)
+	if amount <= 0 {
+		return 0, nil
+	}
+	h.health.Current += amount
+
+	hs.emit(HealthEvent{Type: HealthEventHealed, Entity: entity, Amount: amount, Source: source})
+	return amount, nil
+}
+
+// Revive brings a dead entity back with the given health (clamped to its maximum)
+func (hs *HealthSystem) Revive(entity EntityID, health float32) error {
+	h, err := hs.local(entity)
+	if err != nil {
+		return err
+	}
+	if !h.health.IsDead() {
+		return errors.New("entity is not dead")
+	}
+	if health <= 0 {
+		return errors.New("revive health must be positive")
+	}
+
+	h.health.Current = min(health, h.health.Max)
+	hs.emit(HealthEvent{Type: HealthEventRevived, Entity: entity, Amount: h.health.Current})
+	return nil
+}
+
+// ApplyEffect puts a status effect on an entity. Reapplying an effect refreshes its
+// duration and adds a stack if it stacks.
+func (hs *HealthSystem) ApplyEffect(entity EntityID, effect StatusEffect) error {
+	h, err := hs.local(entity)
+	if err != nil {
+		return err
+	}
+	if effect.Name == "" {
+		return errors.New("status effect needs a name")
+	}
+	if effect.Duration <= 0 {
+		return errors.New("status effect duration must be positive")
+	}
+	if h.health.IsDead() {
+		return errors.New("entity is dead")
+	}
+
+	for _, active := range h.effects {
+		if active.effect.Name == effect.Name {
+			active.effect = effect
+			active.remaining = effect.Duration
+			active.stacks = min(active.stacks+1, max(1, effect.MaxStacks))
+			hs.emit(HealthEvent{Type: HealthEventEffectApplied, Entity: entity, Source: effect.Source, Effect: effect.Name})
+			return nil
+		}
+	}
+
+	h.effects = append(h.effects, &activeEffect{
+		effect:    effect,
+		remaining: effect.Duration,
+		nextTick:  effect.TickInterval,
+		stacks:    1,
+	})
+	hs.emit(HealthEvent{Type: HealthEventEffectApplied, Entity: entity, Source: effect.Source, Effect: effect.Name})
+	return nil
+}
+
+// RemoveEffect removes a status effect from an entity
+func (hs *HealthSystem) RemoveEffect(entity EntityID, name string) {
+	h, ok := hs.entities[entity]
+	if !ok {
+		return
+	}
+
+	for i, active := range h.effects {
+		if active.effect.Name == name {
+			h.effects = append(h.effects[:i], h.effects[i+1:]...)
+			hs.emit(HealthEvent{Type: HealthEventEffectExpired, Entity: entity, Effect: name})
+			return
+		}
+	}
+}
+
+// GetEffects returns the status effects on an entity
+func (hs *HealthSystem) GetEffects(entity EntityID) []ActiveEffect {
+	h, ok := hs.entities[entity]
+	if !ok {
+		return nil
+	}
+
+	effects := make([]ActiveEffect, len(h.effects))
+	for i, active := range h.effects {
+		effects[i] = ActiveEffect{Name: active.effect.Name, Remaining: active.remaining, Stacks: active.stacks}
+	}
+	return effects
+}
+
+// HasEffect returns true if a status effect is on an entity
+func (hs *HealthSystem) HasEffect(entity EntityID, name string) bool {
+	h, ok := hs.entities[entity]
+	if !ok {
+		return false
+	}
+	for _, active := range h.effects {
+		if active.effect.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Update ticks status effects by dt seconds (pass the same delta time as Engine.Update)
+func (hs *HealthSystem) Update(dt float32) {
+	step := time.Duration(float64(dt) * float64(time.Second))
+
+	for entity, h := range hs.entities {
+		for i := 0; i < len(h.effects); i++ {
+			active := h.effects[i]
+			elapsed := min(step, active.remaining)
+			active.remaining -= elapsed
+
+			if active.effect.TickInterval > 0 {
+				active.nextTick -= elapsed
+				for active.nextTick <= 0 && !h.health.IsDead() {
+					active.nextTick += active.effect.TickInterval
+					hs.tickEffect(entity, active)
+				}
+			}
+
+			if h.health.IsDead() {
+				break // Death clears effects
+			}
+			if active.remaining <= 0 {
+				h.effects = append(h.effects[:i], h.effects[i+1:]...)
+				i--
+				hs.emit(HealthEvent{Type: HealthEventEffectExpired, Entity: entity, Effect: active.effect.Name})
+			}
+		}
+	}
+}
+
+func (hs *HealthSystem) tickEffect(entity EntityID, active *activeEffect) {
+	amount := active.effect.DamagePerTick * float32(active.stacks)
+	if amount > 0 {
+		hs.ApplyDamage(entity, DamageEvent{Amount: amount, Type: active.effect.DamageType, Source: active.effect.Source})
+	} else if amount < 0 {
+		hs.Heal(entity, -amount, active.effect.Source)
+	}
+}
+
+// local returns an entity's locally simulated health
+func (hs *HealthSystem) local(entity EntityID) (*healthEntity, error) {
+	h, ok := hs.entities[entity]
+	if !ok {
+		if hs.client != nil {
+			if _, replicated := hs.client.GetServerEntity(entity); replicated {
+				return nil, errors.New("health of replicated entities is server authoritative")
+			}
+		}
+		return nil, errors.New("entity has no health")
+	}
+	return h, nil
+}
+
+func (hs *HealthSystem) emit(event HealthEvent) {
+	hs.events = append(hs.events, event)
+	if hs.onEvent != nil {
+		runCallback("OnEvent", func() { hs.onEvent(event) })
+	}
+	hs.replicate(event.Entity, &event)
+}
+
+// Replication
+
+// healthMessageSize is the size of a health control message: entity, current, max, then
+// an optional event (type, amount, damage type, source)
+const healthMessageSize = 8 + 4 + 4 + 1 + 4 + 1 + 8
+
+// healthNoEvent marks a health message that only carries state
+const healthNoEvent = 0xFF
+
+// EnableServerReplication sends the health of replicated entities to clients
+func (hs *HealthSystem) EnableServerReplication(server *ReplicationServer) {
+	hs.server = server
+	server.session.addConnectionObserver(func(event NetworkEvent) {
+		if e, ok := event.(ConnectedEvent); ok && hs.server == server {
+			for entity, h := range hs.entities {
+				if server.IsReplicated(entity) {
+					server.session.sendControl(e.Connection, controlHealth, encodeHealth(entity, h.health, nil), true)
+				}
+			}
+		}
+	})
+}
+
+// EnableClientReplication receives the health of proxies from the server
+func (hs *HealthSystem) EnableClientReplication(client *ReplicationClient) {
+	hs.client = client
+	client.session.setControlHandler(controlHealth, hs.handleHealth)
+}
+
+func (hs *HealthSystem) replicate(entity EntityID, event *HealthEvent) {
+	if hs.server == nil || !hs.server.IsReplicated(entity) {
+		return
+	}
+	h, ok := hs.entities[entity]
+	if !ok {
+		return
+	}
+
+	payload := encodeHealth(entity, h.health, event)
+	for _, conn := range hs.server.GetConnections() {
+		hs.server.session.sendControl(conn, controlHealth, payload, true)
+	}
+}
+
+func (hs *HealthSystem) handleHealth(conn ConnectionHandle, payload []byte, timestamp float64) {
+	if len(payload) < healthMessageSize {
+		return
+	}
+
+	server := EntityID(binary.LittleEndian.Uint64(payload))
+	health := hs.remote[server]
+	health.Current = math.Float32frombits(binary.LittleEndian.Uint32(payload[8:]))
+	health.Max = math.Float32frombits(binary.LittleEndian.Uint32(payload[12:]))
+	hs.remote[server] = health
+
+	kind := payload[16]
+	if kind == healthNoEvent {
+		return
+	}
+
+	proxy, ok := hs.client.GetProxy(server)
+	if !ok {
+		return
+	}
+
+	event := HealthEvent{
+		Type:       HealthEventType(kind),
+		Entity:     proxy.ID,
+		Amount:     math.Float32frombits(binary.LittleEndian.Uint32(payload[17:])),
+		DamageType: DamageType(payload[21]),
+		Source:     EntityID(binary.LittleEndian.Uint64(payload[22:])),
+	}
+	if local, ok := hs.client.GetProxy(event.Source); ok {
+		event.Source = local.ID
+	}
+
+	hs.events = append(hs.events, event)
+	if hs.onEvent != nil {
+		runCallback("OnEvent", func() { hs.onEvent(event) })
+	}
+}
+
+// encodeHealth builds a health control message. Effect names are not sent; clients see
+// the damage effects deal.
+func encodeHealth(entity EntityID, health Health, event *HealthEvent) []byte {
+	buf := make([]byte, 0, healthMessageSize)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(entity))
+	buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(health.Current))
+	buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(health.Max))
+
+	if event == nil || event.Type == HealthEventEffectApplied || event.Type == HealthEventEffectExpired {
+		buf = append(buf, healthNoEvent)
+		buf = binary.LittleEndian.AppendUint32(buf, 0)
+		buf = append(buf, 0)
+		return binary.LittleEndian.AppendUint64(buf, 0)
+	}
+
+	buf = append(buf, byte(event.Type))
+	buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(event.Amount))
+	buf = append(buf, byte(event.DamageType))
+	return binary.LittleEndian.AppendUint64(buf, uint64(event.Source))
+}
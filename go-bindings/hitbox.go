@@ -0,0 +1,362 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultLagCompensationWindow is how much hitbox history is kept for rewinding queries
+const DefaultLagCompensationWindow = time.Second
+
+// HitboxRegion groups hitboxes for damage multipliers
+type HitboxRegion int
+
+const (
+	HitboxRegionBody HitboxRegion = 0
+	HitboxRegionHead HitboxRegion = 1
+	HitboxRegionLimb HitboxRegion = 2
+)
+
+// String returns the region name
+func (r HitboxRegion) String() string {
+	switch r {
+	case HitboxRegionHead:
+		return "head"
+	case HitboxRegionLimb:
+		return "limb"
+	default:
+		return "body"
+	}
+}
+
+// DefaultHitboxMultiplier returns the damage multiplier usually given to a region
+func DefaultHitboxMultiplier(region HitboxRegion) float32 {
+	switch region {
+	case HitboxRegionHead:
+		return 2
+	case HitboxRegionLimb:
+		return 0.75
+	default:
+		return 1
+	}
+}
+
+// Hitbox is a box in an entity's model space that can be struck
+type Hitbox struct {
+	Name       string
+	Region     HitboxRegion
+	Multiplier float32 // Damage multiplier for hits on this box
+	Min, Max   Vector3
+}
+
+// HitboxQuery is a ray or sphere tested against hitboxes. With MaxDistance > 0 it is a
+// ray from Origin along Direction, thickened by Radius; otherwise it is a sphere of
+// Radius around Origin.
+type HitboxQuery struct {
+	Origin      Vector3
+	Direction   Vector3
+	MaxDistance float32
+	Radius      float32
+	Time        float64  // Time to rewind hitboxes to (see RecordHitboxes); zero is now
+	Ignore      EntityID // Usually the shooter
+}
+
+// HitboxHit is a hitbox struck by a query
+type HitboxHit struct {
+	Entity   EntityID
+	Hitbox   Hitbox
+	Point    Vector3
+	Distance float32 // Along the ray; zero for sphere queries
+}
+
+type hitboxSample struct {
+	time                      float64
+	position, rotation, scale Vector3
+}
+
+type hitboxState struct {
+	boxes   map[EntityID][]Hitbox
+	history map[EntityID][]hitboxSample
+	window  time.Duration
+}
+
+func (w *World) hitboxState() *hitboxState {
+	if w.hitboxes == nil {
+		w.hitboxes = &hitboxState{
+			boxes:   make(map[EntityID][]Hitbox),
+			history: make(map[EntityID][]hitboxSample),
+			window:  DefaultLagCompensationWindow,
+		}
+	}
+	return w.hitboxes
+}
+
+// GenerateHitboxes builds one hitbox per bone of the entity's model skeleton, classifying
+// bones into regions by name. The boxes are returned so they can be adjusted before
+// SetHitboxes; they are also applied to the entity.
+func (w *World) GenerateHitboxes(entity EntityID) ([]Hitbox, error) {
+	defer lockThread()()
+	if !w.ready() {
+		return nil, errNotInitialized
+	}
+
+	count := int(C.boulder_get_model_bone_count(C.EntityID(entity)))
+	if count < 0 {
+		return nil, errors.New("entity has no model")
+	}
+	if count == 0 {
+		return nil, errors.New("model has no skeleton")
+	}
+
+	boxes := make([]Hitbox, 0, count)
+	var name [256]C.char
+	var lo, hi [3]C.float
+	for i := 0; i < count; i++ {
+		if ret := C.boulder_get_model_bone_box(C.EntityID(entity), C.int(i), &name[0], C.uint32_t(len(name)), &lo[0], &hi[0]); ret != 0 {
+			return nil, lastError("failed to get bone box")
+		}
+
+		region := hitboxRegionForBone(C.GoString(&name[0]))
+		boxes = append(boxes, Hitbox{
+			Name:       C.GoString(&name[0]),
+			Region:     region,
+			Multiplier: DefaultHitboxMultiplier(region),
+			Min:        Vector3{float32(lo[0]), float32(lo[1]), float32(lo[2])},
+			Max:        Vector3{float32(hi[0]), float32(hi[1]), float32(hi[2])},
+		})
+	}
+
+	w.SetHitboxes(entity, boxes)
+	return boxes, nil
+}
+
+// SetHitboxes sets an entity's hitboxes, replacing any it had
+func (w *World) SetHitboxes(entity EntityID, boxes []Hitbox) {
+	w.hitboxState().boxes[entity] = boxes
+}
+
+// GetHitboxes returns an entity's hitboxes
+func (w *World) GetHitboxes(entity EntityID) []Hitbox {
+	return w.hitboxState().boxes[entity]
+}
+
+// RemoveHitboxes removes an entity's hitboxes and history
+func (w *World) RemoveHitboxes(entity EntityID) {
+	state := w.hitboxState()
+	delete(state.boxes, entity)
+	delete(state.history, entity)
+}
+
+// SetLagCompensationWindow sets how far back hitbox queries can be rewound
+func (w *World) SetLagCompensationWindow(window time.Duration) {
+	w.hitboxState().window = max(0, window)
+}
+
+// RecordHitboxes stores where every entity with hitboxes is at time (in seconds, on the
+// clock shooters report their shots with). Servers call this once per tick so that queries
+// can be rewound to what a client saw when it fired.
+func (w *World) RecordHitboxes(time float64) {
+	state := w.hitboxState()
+	oldest := time - state.window.Seconds()
+
+	for entity := range state.boxes {
+		e := &Entity{ID: entity, world: w}
+		position, rotation, scale, err := e.GetFullTransform()
+		if err != nil {
+			continue
+		}
+
+		history := append(state.history[entity], hitboxSample{time, position, rotation, scale})
+		drop := 0
+		for drop < len(history)-1 && history[drop+1].time <= oldest {
+			drop++
+		}
+		state.history[entity] = append(history[:0], history[drop:]...)
+	}
+}
+
+// QueryHitboxes returns the hitboxes struck by a ray or sphere, nearest first. Rays report
+// at most one hit per entity (the first box along the ray).
+func (w *World) QueryHitboxes(query HitboxQuery) []HitboxHit {
+	state := w.hitboxState()
+
+	var hits []HitboxHit
+	for entity, boxes := range state.boxes {
+		if entity == query.Ignore || len(boxes) == 0 {
+			continue
+		}
+
+		position, rotation, scale, ok := w.hitboxTransformAt(entity, query.Time)
+		if !ok {
+			continue
+		}
+
+		if query.MaxDistance > 0 {
+			if hit, ok := rayHitboxes(entity, boxes, query, position, rotation, scale); ok {
+				hits = append(hits, hit)
+			}
+		} else {
+			hits = append(hits, sphereHitboxes(entity, boxes, query, position, rotation, scale)...)
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Distance != hits[j].Distance {
+			return hits[i].Distance < hits[j].Distance
+		}
+		return hits[i].Entity < hits[j].Entity
+	})
+	return hits
+}
+
+// hitboxTransformAt returns an entity's transform at a recorded time, interpolating
+// between samples, or its current transform when time is zero or nothing was recorded
+func (w *World) hitboxTransformAt(entity EntityID, time float64) (position, rotation, scale Vector3, ok bool) {
+	history := w.hitboxState().history[entity]
+	if time == 0 || len(history) == 0 {
+		e := &Entity{ID: entity, world: w}
+		position, rotation, scale, err := e.GetFullTransform()
+		return position, rotation, scale, err == nil
+	}
+
+	if time <= history[0].time {
+		s := history[0]
+		return s.position, s.rotation, s.scale, true
+	}
+	for i := 1; i < len(history); i++ {
+		if time <= history[i].time {
+			a, b := history[i-1], history[i]
+			t := float32((time - a.time) / (b.time - a.time))
+			return lerpVector(a.position, b.position, t), lerpVector(a.rotation, b.rotation, t), lerpVector(a.scale, b.scale, t), true
+		}
+	}
+
+	s := history[len(history)-1]
+	return s.position, s.rotation, s.scale, true
+}
+
+func rayHitboxes(entity EntityID, boxes []Hitbox, query HitboxQuery, position, rotation, scale Vector3) (HitboxHit, bool) {
+	dir := normalizeVector(query.Direction)
+	if dir == (Vector3{}) {
+		return HitboxHit{}, false
+	}
+
+	origin := toHitboxSpace(query.Origin, position, rotation, scale)
+	localDir := toHitboxSpace(Vector3{position.X + dir.X, position.Y + dir.Y, position.Z + dir.Z}, position, rotation, scale)
+	pad := Vector3{query.Radius / safeScale(scale.X), query.Radius / safeScale(scale.Y), query.Radius / safeScale(scale.Z)}
+
+	var best HitboxHit
+	found := false
+	for _, box := range boxes {
+		lo := Vector3{box.Min.X - pad.X, box.Min.Y - pad.Y, box.Min.Z - pad.Z}
+		hi := Vector3{box.Max.X + pad.X, box.Max.Y + pad.Y, box.Max.Z + pad.Z}
+
+		t, ok := rayBox(origin, localDir, lo, hi)
+		if !ok || t > query.MaxDistance || (found && t >= best.Distance) {
+			continue
+		}
+
+		best = HitboxHit{
+			Entity:   entity,
+			Hitbox:   box,
+			Point:    Vector3{query.Origin.X + dir.X*t, query.Origin.Y + dir.Y*t, query.Origin.Z + dir.Z*t},
+			Distance: t,
+		}
+		found = true
+	}
+	return best, found
+}
+
+func sphereHitboxes(entity EntityID, boxes []Hitbox, query HitboxQuery, position, rotation, scale Vector3) []HitboxHit {
+	center := toHitboxSpace(query.Origin, position, rotation, scale)
+
+	var hits []HitboxHit
+	for _, box := range boxes {
+		closest := Vector3{
+			X: min(max(center.X, box.Min.X), box.Max.X),
+			Y: min(max(center.Y, box.Min.Y), box.Max.Y),
+			Z: min(max(center.Z, box.Min.Z), box.Max.Z),
+		}
+
+		point := fromHitboxSpace(closest, position, rotation, scale)
+		d := Vector3{point.X - query.Origin.X, point.Y - query.Origin.Y, point.Z - query.Origin.Z}
+		if vectorLength(d) <= query.Radius {
+			hits = append(hits, HitboxHit{Entity: entity, Hitbox: box, Point: point})
+		}
+	}
+	return hits
+}
+
+// rayBox returns the distance along a ray to where it enters a box (slab test)
+func rayBox(origin, dir, lo, hi Vector3) (float32, bool) {
+	tmin, tmax := float32(0), float32(math.MaxFloat32)
+	o := [3]float32{origin.X, origin.Y, origin.Z}
+	d := [3]float32{dir.X, dir.Y, dir.Z}
+	l := [3]float32{lo.X, lo.Y, lo.Z}
+	h := [3]float32{hi.X, hi.Y, hi.Z}
+
+	for i := 0; i < 3; i++ {
+		if d[i] == 0 {
+			if o[i] < l[i] || o[i] > h[i] {
+				return 0, false
+			}
+			continue
+		}
+		t1, t2 := (l[i]-o[i])/d[i], (h[i]-o[i])/d[i]
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+		tmin, tmax = max(tmin, t1), min(tmax, t2)
+		if tmin > tmax {
+			return 0, false
+		}
+	}
+	return tmin, true
+}
+
+// toHitboxSpace moves a world point into an entity's model space
+func toHitboxSpace(p, position, rotation, scale Vector3) Vector3 {
+	local := inverseRotateEuler(Vector3{p.X - position.X, p.Y - position.Y, p.Z - position.Z}, rotation)
+	return Vector3{local.X / safeScale(scale.X), local.Y / safeScale(scale.Y), local.Z / safeScale(scale.Z)}
+}
+
+// fromHitboxSpace moves a point in an entity's model space into the world
+func fromHitboxSpace(p, position, rotation, scale Vector3) Vector3 {
+	world := rotateEuler(Vector3{p.X * scale.X, p.Y * scale.Y, p.Z * scale.Z}, rotation)
+	return Vector3{world.X + position.X, world.Y + position.Y, world.Z + position.Z}
+}
+
+// inverseRotateEuler undoes rotateEuler
+func inverseRotateEuler(v, rotation Vector3) Vector3 {
+	v = rotateEuler(v, Vector3{X: -rotation.X})
+	v = rotateEuler(v, Vector3{Y: -rotation.Y})
+	return rotateEuler(v, Vector3{Z: -rotation.Z})
+}
+
+func safeScale(s float32) float32 {
+	if s == 0 {
+		return 1
+	}
+	return s
+}
+
+// hitboxRegionForBone guesses a bone's region from common skeleton naming
+func hitboxRegionForBone(name string) HitboxRegion {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.Contains(lower, "head"), strings.Contains(lower, "neck"):
+		return HitboxRegionHead
+	case strings.Contains(lower, "spine"), strings.Contains(lower, "chest"), strings.Contains(lower, "pelvis"),
+		strings.Contains(lower, "hip"), strings.Contains(lower, "torso"), strings.Contains(lower, "root"):
+		return HitboxRegionBody
+	default:
+		return HitboxRegionLimb
+	}
+}
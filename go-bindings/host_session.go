@@ -0,0 +1,206 @@
+package boulder
+
+import (
+	"errors"
+)
+
+// loopbackTransportName is the plugin name used between a host's server and local client
+const loopbackTransportName = "loopback"
+
+// loopbackTransport is one end of an in-process transport pair. Messages are handed
+// straight to the other end, so the local client sees no latency or loss.
+type loopbackTransport struct {
+	peer      *loopbackTransport
+	listening bool
+	connected bool
+	events    []TransportEvent
+}
+
+// newLoopbackPair returns two connected ends of a loopback transport
+func newLoopbackPair() (*loopbackTransport, *loopbackTransport) {
+	a, b := &loopbackTransport{}, &loopbackTransport{}
+	a.peer, b.peer = b, a
+	return a, b
+}
+
+// loopbackConn is the only connection a loopback transport has
+const loopbackConn TransportConn = 1
+
+func (t *loopbackTransport) Name() string {
+	return loopbackTransportName
+}
+
+func (t *loopbackTransport) Listen(address string) error {
+	t.listening = true
+	return nil
+}
+
+func (t *loopbackTransport) Connect(address string) (TransportConn, error) {
+	if t.peer == nil || !t.peer.listening {
+		return 0, errors.New("loopback peer not listening")
+	}
+	if t.connected {
+		return 0, errors.New("loopback already connected")
+	}
+
+	t.connected, t.peer.connected = true, true
+	t.events = append(t.events, TransportEvent{Type: NetworkEventConnected, Conn: loopbackConn})
+	t.peer.events = append(t.peer.events, TransportEvent{Type: NetworkEventConnected, Conn: loopbackConn})
+	return loopbackConn, nil
+}
+
+func (t *loopbackTransport) Disconnect(conn TransportConn) {
+	if !t.connected {
+		return
+	}
+
+	t.connected = false
+	if t.peer != nil && t.peer.connected {
+		t.peer.connected = false
+		t.peer.events = append(t.peer.events, TransportEvent{Type: NetworkEventDisconnected, Conn: loopbackConn})
+	}
+}
+
+func (t *loopbackTransport) Send(conn TransportConn, data []byte, reliable bool) error {
+	if !t.connected || t.peer == nil {
+		return errors.New("loopback not connected")
+	}
+
+	message := append([]byte(nil), data...)
+	t.peer.events = append(t.peer.events, TransportEvent{Type: NetworkEventMessage, Conn: loopbackConn, Data: message})
+	return nil
+}
+
+func (t *loopbackTransport) State(conn TransportConn) ConnectionState {
+	if t.connected {
+		return ConnectionStateConnected
+	}
+	return ConnectionStateNone
+}
+
+func (t *loopbackTransport) Update() {}
+
+func (t *loopbackTransport) Poll() (TransportEvent, bool) {
+	if len(t.events) == 0 {
+		return TransportEvent{}, false
+	}
+
+	event := t.events[0]
+	t.events = t.events[1:]
+	return event, true
+}
+
+func (t *loopbackTransport) Close() {
+	t.Disconnect(loopbackConn)
+	if t.peer != nil {
+		t.peer.peer = nil
+	}
+	t.peer = nil
+	t.events = nil
+}
+
+// HostSession runs a listen server and the host player's own client in one object. Remote
+// players connect to the server over the network as usual; the local client is connected
+// to the server through an in-process loopback with zero latency, so the host's game code
+// can treat itself exactly like any other client.
+type HostSession struct {
+	Server *NetworkSession // Server side; the local client appears as GetLocalConnection
+	Client *NetworkSession // Local client; the server appears as GetServerConnection
+
+	local  ConnectionHandle
+	remote ConnectionHandle
+}
+
+// NewHostSession starts a server on port and connects a local client to it
+func NewHostSession(engine *Engine, port uint16) (*HostSession, error) {
+	server, err := NewNetworkSession(engine)
+	if err != nil {
+		return nil, err
+	}
+	if err := server.StartServer(port); err != nil {
+		server.Destroy()
+		return nil, err
+	}
+
+	client, err := NewNetworkSession(engine)
+	if err != nil {
+		server.StopServer()
+		server.Destroy()
+		return nil, err
+	}
+
+	host := &HostSession{Server: server, Client: client}
+	if err := host.connectLocal(); err != nil {
+		host.Destroy()
+		return nil, err
+	}
+
+	return host, nil
+}
+
+// NewDummyHostSession creates a host session whose server and client are dummy sessions
+func NewDummyHostSession() *HostSession {
+	return &HostSession{
+		Server: NewDummyNetworkSession(),
+		Client: NewDummyNetworkSession(),
+	}
+}
+
+// connectLocal joins the local client to the server through a loopback transport pair
+func (h *HostSession) connectLocal() error {
+	serverEnd, clientEnd := newLoopbackPair()
+	if err := h.Server.RegisterTransport(serverEnd); err != nil {
+		return err
+	}
+	if err := h.Client.RegisterTransport(clientEnd); err != nil {
+		return err
+	}
+	if err := h.Server.ListenTransport(loopbackTransportName, ""); err != nil {
+		return err
+	}
+
+	remote, err := h.Client.ConnectTransport(loopbackTransportName, "")
+	if err != nil {
+		return err
+	}
+	h.remote = remote
+	h.local = h.Server.plugins.handleFor(serverEnd, loopbackConn)
+	return nil
+}
+
+// Update processes network callbacks for both sides (call this every frame)
+func (h *HostSession) Update() {
+	h.Server.Update()
+	h.Client.Update()
+}
+
+// GetLocalConnection returns the server's handle for the host's own client
+func (h *HostSession) GetLocalConnection() ConnectionHandle {
+	return h.local
+}
+
+// GetServerConnection returns the local client's handle for the server
+func (h *HostSession) GetServerConnection() ConnectionHandle {
+	return h.remote
+}
+
+// IsLocalConnection reports whether a server-side connection is the host's own client
+func (h *HostSession) IsLocalConnection(conn ConnectionHandle) bool {
+	return h.local != 0 && conn == h.local
+}
+
+// IsValid returns true if the host session is running (not a dummy)
+func (h *HostSession) IsValid() bool {
+	return h.Server.IsValid() && h.Client.IsValid()
+}
+
+// Destroy disconnects everyone, stops the server and destroys both sessions
+func (h *HostSession) Destroy() {
+	h.Client.Destroy()
+	h.Server.StopServer()
+	h.Server.Destroy()
+
+	h.local, h.remote = 0, 0
+	h.Server = NewDummyNetworkSession()
+	h.Client = NewDummyNetworkSession()
+}
@@ -1,12 +1,11 @@
 package boulder
 
 // #cgo CFLAGS: -I..
-// #cgo LDFLAGS: -L../build -lboulder_shared -Wl,-rpath,${SRCDIR}/../build
 // #include <stdlib.h>
 // #include "../boulder_cgo.h"
 import "C"
 
-// Input manages input handling (keyboard, mouse)
+// Input manages input handling (keyboard, mouse, touch, controllers)
 type Input struct {
 	engine *Engine
 }
@@ -18,7 +17,8 @@ func NewInput(engine *Engine) *Input {
 	}
 }
 
-// IsKeyPressed checks if a key is pressed
+// IsKeyPressed checks if the key at a position (a scancode such as KeyW) is pressed,
+// whatever it types on the user's layout
 func (i *Input) IsKeyPressed(keyCode int) bool {
 	if !i.engine.initialized {
 		return false
@@ -47,7 +47,96 @@ func (i *Input) GetMousePosition() (x, y float32) {
 	return float32(cX), float32(cY)
 }
 
-// Common key codes (SDL key codes)
+// GetMouseWheel returns how far the wheel turned during the last Window.PollEvents, in
+// notches (fractions on touchpads): positive y is away from the user, positive x right
+func (i *Input) GetMouseWheel() (x, y float32) {
+	if !i.engine.initialized {
+		return 0, 0
+	}
+
+	var cX, cY C.float
+	C.boulder_get_mouse_wheel(&cX, &cY)
+	return float32(cX), float32(cY)
+}
+
+// TouchPhase is what a finger did in a TouchEvent
+type TouchPhase int
+
+const (
+	TouchDown   TouchPhase = 0
+	TouchMove   TouchPhase = 1
+	TouchUp     TouchPhase = 2
+	TouchCancel TouchPhase = 3 // The system took the touch, e.g. for a gesture
+)
+
+// TouchEvent is a finger going down, moving or lifting, in window coordinates like the
+// mouse. ID stays the same from TouchDown to TouchUp, so several fingers can be followed.
+type TouchEvent struct {
+	ID       uint64
+	Phase    TouchPhase
+	X, Y     float32
+	DX, DY   float32 // Movement since the last event of this finger
+	Pressure float32 // 0 to 1, 1 on screens that do not report it
+}
+
+// Touch is a finger that is down
+type Touch struct {
+	ID             uint64
+	X, Y           float32
+	StartX, StartY float32 // Where the finger went down
+	Pressure       float32
+}
+
+// PollTouchEvents returns the touch events since the last call, oldest first. Events are
+// collected by Window.PollEvents; the engine keeps the last 256.
+func (i *Input) PollTouchEvents() []TouchEvent {
+	if !i.engine.initialized {
+		return nil
+	}
+
+	var events []TouchEvent
+	var event C.TouchEvent
+	for C.boulder_poll_touch_event(&event) != 0 {
+		events = append(events, TouchEvent{
+			ID:       uint64(event.id),
+			Phase:    TouchPhase(event.phase),
+			X:        float32(event.x),
+			Y:        float32(event.y),
+			DX:       float32(event.dx),
+			DY:       float32(event.dy),
+			Pressure: float32(event.pressure),
+		})
+	}
+	return events
+}
+
+// GetTouches returns the fingers that are down, in the order they touched
+func (i *Input) GetTouches() []Touch {
+	if !i.engine.initialized {
+		return nil
+	}
+
+	count := int(C.boulder_get_touch_count())
+	touches := make([]Touch, 0, count)
+	var touch C.TouchPoint
+	for index := 0; index < count; index++ {
+		if C.boulder_get_touch(C.int(index), &touch) != 0 {
+			continue
+		}
+		touches = append(touches, Touch{
+			ID:       uint64(touch.id),
+			X:        float32(touch.x),
+			Y:        float32(touch.y),
+			StartX:   float32(touch.startX),
+			StartY:   float32(touch.startY),
+			Pressure: float32(touch.pressure),
+		})
+	}
+	return touches
+}
+
+// Common keys as scancodes (SDL scancodes): physical positions named after the US layout.
+// KeyW is the key left of E on every keyboard, labeled Z on AZERTY; see GetKeyName.
 const (
 	KeyUnknown = 0
 
@@ -94,6 +183,20 @@ const (
 	KeyBackspace = 42
 	KeyTab       = 43
 	KeySpace     = 44
+	KeyGrave     = 53 // The key left of 1, under Escape
+
+	KeyF1  = 58
+	KeyF2  = 59
+	KeyF3  = 60
+	KeyF4  = 61
+	KeyF5  = 62
+	KeyF6  = 63
+	KeyF7  = 64
+	KeyF8  = 65
+	KeyF9  = 66
+	KeyF10 = 67
+	KeyF11 = 68
+	KeyF12 = 69
 
 	KeyRight = 79
 	KeyLeft  = 80
@@ -0,0 +1,233 @@
+package boulder
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultInspectorAddress = "127.0.0.1:27100"
+
+	inspectorTimeout = 2 * time.Second // How long a request waits for Update before giving up
+)
+
+// InspectorConfig sets up an entity inspector
+type InspectorConfig struct {
+	// Address to listen on; "" is DefaultInspectorAddress, which only this machine can reach
+	Address string
+	Token   string          // Required; clients send "Authorization: Bearer <token>"
+	World   *World          // The world to inspect; nil is the engine's active world
+	Session *NetworkSession // For /connections; nil leaves them empty
+}
+
+// Inspector serves read-only JSON about a running game for live debugging dashboards:
+//
+//	GET /entities         every entity with its name, prefab, components and position;
+//	                      ?component=model, ?tag=enemy and ?limit=100 narrow it down
+//	GET /entities/{id}    one entity's transform, model, body, collider, light and tags
+//	GET /stats            frame times, render stats, presentation and memory
+//	GET /connections      the session's connections with their stats and players
+//
+// It is only built with -tags boulder_inspector, so release builds can't turn it on, and
+// every request must carry the configured token. Requests are answered in Update, so they
+// see the world between frames like the rest of the game loop.
+type Inspector struct {
+	engine   *Engine
+	config   InspectorConfig
+	listener net.Listener
+	server   *http.Server
+	views    map[string]inspectorView
+
+	mu      sync.Mutex
+	pending []*inspectorRequest
+	closed  bool
+}
+
+type inspectorRequest struct {
+	view    inspectorView
+	request *http.Request
+	done    chan inspectorResult
+}
+
+type inspectorResult struct {
+	value any
+	err   error
+}
+
+// inspectorView builds one endpoint's JSON on the game thread
+type inspectorView func(i *Inspector, request *http.Request) (any, error)
+
+// inspectorError is a failed request with the HTTP status to answer it with
+type inspectorError struct {
+	status  int
+	message string
+}
+
+func (e *inspectorError) Error() string {
+	return e.message
+}
+
+// NewInspector starts serving the entity inspector. It fails in builds without
+// -tags boulder_inspector and without a token.
+func NewInspector(engine *Engine, config InspectorConfig) (*Inspector, error) {
+	if !inspectorBuilt {
+		return nil, errors.New("entity inspector not built in; build with -tags boulder_inspector")
+	}
+	if engine == nil {
+		return nil, errors.New("engine is nil")
+	}
+	if config.Token == "" {
+		return nil, errors.New("entity inspector needs a token")
+	}
+	if config.Address == "" {
+		config.Address = DefaultInspectorAddress
+	}
+
+	listener, err := net.Listen("tcp", config.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Inspector{engine: engine, config: config, listener: listener, views: inspectorViews()}
+	i.server = &http.Server{Handler: i.authorize(http.HandlerFunc(i.route)), ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		if err := i.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			LogError("Entity inspector stopped serving: " + err.Error())
+		}
+	}()
+	LogInfo("Entity inspector listening on " + listener.Addr().String())
+	return i, nil
+}
+
+// GetAddress returns the address the inspector listens on, e.g. after asking for port 0
+func (i *Inspector) GetAddress() string {
+	return i.listener.Addr().String()
+}
+
+// Update answers the requests made since the last call (call every frame or server tick)
+func (i *Inspector) Update() {
+	i.mu.Lock()
+	pending := i.pending
+	i.pending = nil
+	i.mu.Unlock()
+
+	for _, request := range pending {
+		var result inspectorResult
+		result.err = errors.New("inspector view panicked")
+		runCallback("Inspector "+request.request.URL.Path, func() {
+			result.value, result.err = request.view(i, request.request)
+		})
+		request.done <- result
+	}
+}
+
+// Close stops serving; requests waiting for Update are answered 503
+func (i *Inspector) Close() {
+	i.mu.Lock()
+	if i.closed {
+		i.mu.Unlock()
+		return
+	}
+	i.closed = true
+	pending := i.pending
+	i.pending = nil
+	i.mu.Unlock()
+
+	for _, request := range pending {
+		request.done <- inspectorResult{err: &inspectorError{http.StatusServiceUnavailable, "inspector closed"}}
+	}
+	i.server.Close()
+}
+
+// world returns the world to inspect, or nil if there isn't one
+func (i *Inspector) world() *World {
+	if i.config.World != nil {
+		return i.config.World
+	}
+	return i.engine.GetActiveWorld()
+}
+
+// authorize rejects requests without the token, which is only taken from the
+// Authorization header so it doesn't end up in URLs, logs and browser history
+func (i *Inspector) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(i.config.Token)) != 1 {
+			LogError("Entity inspector " + r.RemoteAddr + ": bad token")
+			writeInspectorJSON(w, http.StatusUnauthorized, map[string]string{"error": "bad or missing token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// route finds the view for a request: the one for its exact path, or for the path up to
+// its last / (e.g. /entities/ for /entities/42)
+func (i *Inspector) route(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	default:
+		w.Header().Set("Allow", "GET, HEAD")
+		writeInspectorJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "only GET is supported"})
+		return
+	}
+
+	view := i.views[r.URL.Path]
+	if slash := strings.LastIndexByte(r.URL.Path, '/'); view == nil && slash > 0 && slash < len(r.URL.Path)-1 {
+		view = i.views[r.URL.Path[:slash+1]]
+	}
+	if view == nil {
+		writeInspectorJSON(w, http.StatusNotFound, map[string]string{"error": "no such endpoint: " + r.URL.Path})
+		return
+	}
+	i.serve(w, r, view)
+}
+
+// serve queues a request for Update and writes what the view returns
+func (i *Inspector) serve(w http.ResponseWriter, r *http.Request, view inspectorView) {
+	request := &inspectorRequest{view: view, request: r, done: make(chan inspectorResult, 1)}
+	i.mu.Lock()
+	if i.closed {
+		i.mu.Unlock()
+		writeInspectorJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "inspector closed"})
+		return
+	}
+	i.pending = append(i.pending, request)
+	i.mu.Unlock()
+
+	var result inspectorResult
+	select {
+	case result = <-request.done:
+	case <-time.After(inspectorTimeout):
+		result.err = &inspectorError{http.StatusServiceUnavailable, "game loop didn't answer; is Update being called?"}
+	case <-r.Context().Done():
+		return
+	}
+
+	if result.err != nil {
+		status := http.StatusInternalServerError
+		var ie *inspectorError
+		if errors.As(result.err, &ie) {
+			status = ie.status
+		}
+		writeInspectorJSON(w, status, map[string]string{"error": result.err.Error()})
+		return
+	}
+	writeInspectorJSON(w, http.StatusOK, result.value)
+}
+
+func writeInspectorJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
@@ -0,0 +1,321 @@
+//go:build boulder_inspector
+
+package boulder
+
+// The entity inspector's views, built with -tags boulder_inspector so release builds can't
+// serve them. Each runs in Inspector.Update and returns the JSON for one endpoint.
+
+import (
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	inspectorBuilt = true
+
+	inspectorDefaultLimit = 1000 // Entities listed by /entities without ?limit
+)
+
+var inspectorComponentNames = [componentCount]string{
+	"transform", "physicsBody", "model", "buoyancyVolume", "buoyant", "softBody", "collider",
+}
+
+type inspectorEntity struct {
+	ID         EntityID    `json:"id"`
+	Name       string      `json:"name,omitempty"`
+	Prefab     string      `json:"prefab,omitempty"`
+	Components []string    `json:"components"`
+	Position   *[3]float32 `json:"position,omitempty"`
+	Tags       []string    `json:"tags,omitempty"`
+}
+
+type inspectorEntityDetail struct {
+	inspectorEntity
+	Rotation   *[3]float32    `json:"rotation,omitempty"` // Radians
+	Scale      *[3]float32    `json:"scale,omitempty"`
+	Model      string         `json:"model,omitempty"`
+	Meshes     int            `json:"meshes,omitempty"`
+	Triangles  int            `json:"triangles,omitempty"`
+	Mass       *float32       `json:"mass,omitempty"`
+	Velocity   *[3]float32    `json:"velocity,omitempty"`
+	Collider   *sceneCollider `json:"collider,omitempty"`
+	Light      *sceneLight    `json:"light,omitempty"`
+	Layers     uint32         `json:"layers"`
+	Persistent bool           `json:"persistent"`
+}
+
+type inspectorConnection struct {
+	Connection   ConnectionHandle `json:"connection"`
+	Player       PlayerIdentity   `json:"player,omitempty"`
+	PlayerEntity EntityID         `json:"playerEntity,omitempty"`
+	Spectator    bool             `json:"spectator"`
+	RTTMs        int64            `json:"rttMs"`
+	PacketLoss   float32          `json:"packetLoss"` // Percent, -1 until known
+	SendRate     float32          `json:"sendRate"`   // Bytes per second
+	ReceiveRate  float32          `json:"receiveRate"`
+	Bandwidth    float32          `json:"bandwidth"`
+	QueuedBytes  int              `json:"queuedBytes"`
+	UnackedBytes int              `json:"unackedBytes"`
+	QueueTimeMs  float64          `json:"queueTimeMs"`
+	Error        string           `json:"error,omitempty"` // Why the stats are missing
+}
+
+// inspectorViews returns the views by path; a path ending in / serves the paths below it
+func inspectorViews() map[string]inspectorView {
+	return map[string]inspectorView{
+		"/":            (*Inspector).indexView,
+		"/entities":    (*Inspector).entitiesView,
+		"/entities/":   (*Inspector).entityView,
+		"/stats":       (*Inspector).statsView,
+		"/connections": (*Inspector).connectionsView,
+	}
+}
+
+func (i *Inspector) indexView(request *http.Request) (any, error) {
+	return map[string]string{
+		"/entities":      "Every entity; ?component=, ?tag= and ?limit= narrow it down",
+		"/entities/{id}": "One entity's components",
+		"/stats":         "Frame times, render stats, presentation and memory",
+		"/connections":   "Network connections with their stats and players",
+	}, nil
+}
+
+func (i *Inspector) entitiesView(request *http.Request) (any, error) {
+	w, err := i.inspectedWorld()
+	if err != nil {
+		return nil, err
+	}
+
+	query := request.URL.Query()
+	limit := inspectorDefaultLimit
+	if text := query.Get("limit"); text != "" {
+		if limit, err = strconv.Atoi(text); err != nil || limit < 0 {
+			return nil, &inspectorError{http.StatusBadRequest, "bad limit: " + text}
+		}
+	}
+	only := -1
+	if name := query.Get("component"); name != "" {
+		if only = slices.Index(inspectorComponentNames[:], name); only < 0 {
+			return nil, &inspectorError{http.StatusBadRequest, "unknown component: " + name}
+		}
+	}
+	tag := query.Get("tag")
+
+	components, err := inspectorComponents(w)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]EntityID, 0, len(components))
+	for id, has := range components {
+		if only < 0 || has[only] {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	names := inspectorEntityNames(w)
+	entities := make([]inspectorEntity, 0, min(len(ids), limit))
+	total := 0
+	for _, id := range ids {
+		entity := &Entity{ID: id, world: w}
+		tags := entity.GetTags()
+		if tag != "" && !slices.Contains(tags, tag) {
+			continue
+		}
+		total++
+		if len(entities) == limit {
+			continue
+		}
+
+		desc := inspectorEntity{ID: id, Name: names[id], Prefab: w.GetEntityPrefab(id), Components: componentNames(components[id]), Tags: tags}
+		if position, err := entity.GetTransform(); err == nil && components[id][ComponentTransform] {
+			desc.Position = &[3]float32{position.X, position.Y, position.Z}
+		}
+		entities = append(entities, desc)
+	}
+
+	return map[string]any{"total": total, "entities": entities}, nil
+}
+
+func (i *Inspector) entityView(request *http.Request) (any, error) {
+	w, err := i.inspectedWorld()
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimPrefix(request.URL.Path, "/entities/")
+	value, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return nil, &inspectorError{http.StatusBadRequest, "bad entity ID: " + text}
+	}
+	id := EntityID(value)
+
+	components, err := inspectorComponents(w)
+	if err != nil {
+		return nil, err
+	}
+	has, ok := components[id]
+	if !ok {
+		return nil, &inspectorError{http.StatusNotFound, "no entity " + text}
+	}
+
+	entity := &Entity{ID: id, world: w}
+	desc := inspectorEntityDetail{
+		inspectorEntity: inspectorEntity{ID: id, Name: inspectorEntityNames(w)[id], Prefab: w.GetEntityPrefab(id), Components: componentNames(has), Tags: entity.GetTags()},
+		Layers:          entity.GetLayers(),
+		Persistent:      entity.IsPersistent(),
+	}
+	if has[ComponentTransform] {
+		if position, rotation, scale, err := entity.GetFullTransform(); err == nil {
+			desc.Position = &[3]float32{position.X, position.Y, position.Z}
+			desc.Rotation = &[3]float32{rotation.X, rotation.Y, rotation.Z}
+			desc.Scale = &[3]float32{scale.X, scale.Y, scale.Z}
+		}
+	}
+	if has[ComponentModel] {
+		desc.Model = entity.modelPath()
+		desc.Meshes = entity.GetModelMeshCount()
+		desc.Triangles = entity.GetModelTriangleCount(0)
+	}
+	if mass, ok := entity.GetMass(); ok {
+		desc.Mass = &mass
+		if velocity, err := entity.GetVelocity(); err == nil {
+			desc.Velocity = &[3]float32{velocity.X, velocity.Y, velocity.Z}
+		}
+	}
+	if collider, ok := entity.GetCollider(); ok {
+		desc.Collider = sceneColliderOf(collider)
+	}
+	if light, ok := entity.GetLight(); ok {
+		desc.Light = sceneLightOf(light)
+	}
+	return desc, nil
+}
+
+func (i *Inspector) statsView(request *http.Request) (any, error) {
+	stats := map[string]any{}
+	if i.engine.initialized {
+		renderer := NewRenderer(i.engine)
+		times := renderer.GetFrameTimes()
+		render := renderer.GetRenderStats()
+		present := renderer.GetPresentStats()
+		stats["frame"] = map[string]any{
+			"cpuMs":              msOf(times.CPU),
+			"gpuMs":              msOf(times.GPU),
+			"gpuTimingSupported": times.GPUTimingSupported,
+		}
+		stats["render"] = map[string]any{
+			"drawCalls":         render.DrawCalls,
+			"triangles":         render.Triangles,
+			"deviceMemory":      render.DeviceMemory,
+			"deviceAllocations": render.DeviceAllocations,
+		}
+		stats["present"] = map[string]any{
+			"latencyMs":        msOf(present.Latency),
+			"averageLatencyMs": msOf(present.AverageLatency),
+			"refreshRate":      present.RefreshRate,
+			"framesPresented":  present.FramesPresented,
+			"framesDropped":    present.FramesDropped,
+			"framesInFlight":   present.FramesInFlight,
+		}
+	}
+	if w, err := i.inspectedWorld(); err == nil {
+		stats["world"] = map[string]int{
+			"entities":  w.QueryCount(WithTransform()),
+			"bodies":    w.QueryCount(WithPhysicsBody()),
+			"colliders": w.QueryCount(WithCollider()),
+			"models":    w.QueryCount(WithModel()),
+		}
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats["go"] = map[string]any{
+		"heapBytes":  mem.HeapAlloc,
+		"goroutines": runtime.NumGoroutine(),
+		"gcs":        mem.NumGC,
+	}
+	return stats, nil
+}
+
+func (i *Inspector) connectionsView(request *http.Request) (any, error) {
+	connections := []inspectorConnection{}
+	ns := i.config.Session
+	if !ns.IsValid() {
+		return connections, nil
+	}
+
+	for _, conn := range ns.openConnections() {
+		desc := inspectorConnection{Connection: conn, Spectator: ns.IsSpectator(conn)}
+		if player, ok := ns.GetPlayer(conn); ok {
+			desc.Player = player.Identity
+			desc.PlayerEntity = player.Entity
+		}
+		if s, err := ns.GetConnectionStats(conn); err == nil {
+			desc.RTTMs = s.RTT.Milliseconds()
+			desc.PacketLoss = s.PacketLoss
+			desc.SendRate = s.SendRate
+			desc.ReceiveRate = s.ReceiveRate
+			desc.Bandwidth = s.Bandwidth
+			desc.QueuedBytes = s.QueuedBytes
+			desc.UnackedBytes = s.UnackedBytes
+			desc.QueueTimeMs = msOf(s.QueueTime)
+		} else {
+			desc.Error = err.Error()
+		}
+		connections = append(connections, desc)
+	}
+	return connections, nil
+}
+
+// inspectedWorld returns the world to inspect, failing with 503 when there is none
+func (i *Inspector) inspectedWorld() (*World, error) {
+	w := i.world()
+	if w == nil || !w.ready() {
+		return nil, &inspectorError{http.StatusServiceUnavailable, "no world to inspect"}
+	}
+	return w, nil
+}
+
+// inspectorComponents returns which components each entity in the world has
+func inspectorComponents(w *World) (map[EntityID]*[componentCount]bool, error) {
+	components := make(map[EntityID]*[componentCount]bool)
+	for c := range inspectorComponentNames {
+		ids, err := w.QueryIDs(With(Component(c)))
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			has := components[id]
+			if has == nil {
+				has = new([componentCount]bool)
+				components[id] = has
+			}
+			has[c] = true
+		}
+	}
+	return components, nil
+}
+
+func componentNames(has *[componentCount]bool) []string {
+	var names []string
+	for c, ok := range has {
+		if ok {
+			names = append(names, inspectorComponentNames[c])
+		}
+	}
+	return names
+}
+
+// inspectorEntityNames returns the names entities were given in the world's scene file
+func inspectorEntityNames(w *World) map[EntityID]string {
+	names := make(map[EntityID]string)
+	if w.scene != nil {
+		for name, id := range w.scene.names {
+			names[id] = name
+		}
+	}
+	return names
+}
@@ -0,0 +1,195 @@
+package boulder
+
+import (
+	"errors"
+	"math"
+)
+
+// Interactable makes an entity usable by players looking at it from nearby
+type Interactable struct {
+	Prompt   string  // Text shown by the UI, e.g. "Open door"
+	Action   string  // Action name passed to InteractEvent, e.g. "open"
+	Radius   float32 // Furthest a player can be to use it
+	Angle    float32 // Largest angle in radians between the player's view and the entity; zero allows any
+	Priority int     // Higher priorities win over closer candidates
+	Enabled  bool
+}
+
+// DefaultInteractable returns an interactable usable from 2 meters within a 45 degree cone
+func DefaultInteractable(prompt, action string) Interactable {
+	return Interactable{
+		Prompt:  prompt,
+		Action:  action,
+		Radius:  2,
+		Angle:   math.Pi / 4,
+		Enabled: true,
+	}
+}
+
+// InteractionPrompt is what the UI shows for a player's focused interactable
+type InteractionPrompt struct {
+	Entity   EntityID
+	Prompt   string
+	Action   string
+	Distance float32
+}
+
+// InteractEvent reports a player using an interactable
+type InteractEvent struct {
+	Player EntityID
+	Target EntityID
+	Action string
+}
+
+// InteractCallback is called when a player interacts with an entity
+type InteractCallback func(event InteractEvent)
+
+// Interaction finds which interactable each player is focused on. Players look along
+// the direction set with SetViewDirection, or along -Z rotated by their transform.
+type Interaction struct {
+	world         *World
+	interactables map[EntityID]*Interactable
+	views         map[EntityID]Vector3
+	events        []InteractEvent
+	onInteract    InteractCallback
+}
+
+// NewInteraction creates an interaction system for a world
+func NewInteraction(world *World) *Interaction {
+	return &Interaction{
+		world:         world,
+		interactables: make(map[EntityID]*Interactable),
+		views:         make(map[EntityID]Vector3),
+	}
+}
+
+// AddInteractable makes an entity interactable
+func (in *Interaction) AddInteractable(entity EntityID, interactable Interactable) error {
+	if interactable.Radius <= 0 {
+		return errors.New("interaction radius must be positive")
+	}
+	in.interactables[entity] = &interactable
+	return nil
+}
+
+// RemoveInteractable stops an entity being interactable
+func (in *Interaction) RemoveInteractable(entity EntityID) {
+	delete(in.interactables, entity)
+}
+
+// GetInteractable returns an entity's interaction settings
+func (in *Interaction) GetInteractable(entity EntityID) (Interactable, bool) {
+	if i, ok := in.interactables[entity]; ok {
+		return *i, true
+	}
+	return Interactable{}, false
+}
+
+// SetEnabled enables or disables an interactable, e.g. a door that is locked
+func (in *Interaction) SetEnabled(entity EntityID, enabled bool) {
+	if i, ok := in.interactables[entity]; ok {
+		i.Enabled = enabled
+	}
+}
+
+// SetPrompt changes an interactable's prompt, e.g. "Open" to "Close"
+func (in *Interaction) SetPrompt(entity EntityID, prompt string) {
+	if i, ok := in.interactables[entity]; ok {
+		i.Prompt = prompt
+	}
+}
+
+// SetViewDirection sets where a player is looking (usually the camera's forward vector)
+func (in *Interaction) SetViewDirection(player EntityID, direction Vector3) {
+	in.views[player] = normalizeVector(direction)
+}
+
+// OnInteract sets the callback run when a player interacts. Events are also queued for
+// PollEvents.
+func (in *Interaction) OnInteract(callback InteractCallback) {
+	in.onInteract = callback
+}
+
+// PollEvents returns the interactions since the last call
+func (in *Interaction) PollEvents() []InteractEvent {
+	events := in.events
+	in.events = nil
+	return events
+}
+
+// GetFocused returns the interactable a player would use: the highest priority one in
+// range and view, preferring the closest and most centered
+func (in *Interaction) GetFocused(player EntityID) (EntityID, bool) {
+	prompt, ok := in.GetPrompt(player)
+	return prompt.Entity, ok
+}
+
+// GetPrompt returns the prompt of the interactable a player is focused on
+func (in *Interaction) GetPrompt(player EntityID) (InteractionPrompt, bool) {
+	p := &Entity{ID: player, world: in.world}
+	position, rotation, _, err := p.GetFullTransform()
+	if err != nil {
+		return InteractionPrompt{}, false
+	}
+
+	view, ok := in.views[player]
+	if !ok {
+		view = rotateEuler(Vector3{Z: -1}, rotation)
+	}
+
+	var best InteractionPrompt
+	bestPriority, bestScore := 0, float32(math.MaxFloat32)
+	found := false
+
+	for entity, i := range in.interactables {
+		if entity == player || !i.Enabled {
+			continue
+		}
+
+		target, err := (&Entity{ID: entity, world: in.world}).GetTransform()
+		if err != nil {
+			continue
+		}
+
+		to := Vector3{target.X - position.X, target.Y - position.Y, target.Z - position.Z}
+		distance := vectorLength(to)
+		if distance > i.Radius {
+			continue
+		}
+
+		angle := float32(0)
+		if distance > 0 {
+			cos := (to.X*view.X + to.Y*view.Y + to.Z*view.Z) / distance
+			angle = float32(math.Acos(float64(max(-1, min(1, cos)))))
+		}
+		if i.Angle > 0 && angle > i.Angle {
+			continue
+		}
+
+		score := distance/i.Radius + angle/math.Pi
+		if found && (i.Priority < bestPriority || (i.Priority == bestPriority && score >= bestScore)) {
+			continue
+		}
+
+		best = InteractionPrompt{Entity: entity, Prompt: i.Prompt, Action: i.Action, Distance: distance}
+		bestPriority, bestScore, found = i.Priority, score, true
+	}
+
+	return best, found
+}
+
+// Interact uses the player's focused interactable, if any (call this when the interact
+// input fires)
+func (in *Interaction) Interact(player EntityID) (EntityID, bool) {
+	prompt, ok := in.GetPrompt(player)
+	if !ok {
+		return 0, false
+	}
+
+	event := InteractEvent{Player: player, Target: prompt.Entity, Action: prompt.Action}
+	in.events = append(in.events, event)
+	if in.onInteract != nil {
+		runCallback("OnInteract", func() { in.onInteract(event) })
+	}
+	return prompt.Entity, true
+}
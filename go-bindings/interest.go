@@ -0,0 +1,317 @@
+package boulder
+
+import "math"
+
+// maxInterestSpan is the most cells RelevantEntities searches each way from the viewer's
+// cell, so a query looks at no more than 17³ cells
+const maxInterestSpan = 8
+
+// InterestMode selects how entity relevance is decided for a connection
+type InterestMode int
+
+const (
+	// InterestRadius treats entities within Radius of the viewer as relevant
+	InterestRadius InterestMode = 0
+	// InterestGrid treats entities in the viewer's grid cell (or its neighbours) as relevant
+	InterestGrid InterestMode = 1
+)
+
+// Relevance overrides spatial interest for a single entity
+type Relevance int
+
+const (
+	RelevanceDefault Relevance = 0 // Use the spatial test
+	RelevanceAlways  Relevance = 1 // Always sent to every connection (game state, scoreboards)
+	RelevanceNever   Relevance = 2 // Never replicated (server-only entities)
+)
+
+// InterestConfig contains configuration for an InterestManager
+type InterestConfig struct {
+	Mode     InterestMode
+	Radius   float32 // Relevance radius for InterestRadius
+	CellSize float32 // Grid cell size (defaults to Radius, and at least Radius/8)
+	// NeighbourCells is how many cells around the viewer's cell count as relevant in
+	// InterestGrid mode, at most 8
+	NeighbourCells int
+}
+
+// DefaultInterestConfig returns a radius-based configuration suitable for most games
+func DefaultInterestConfig() InterestConfig {
+	return InterestConfig{
+		Mode:           InterestRadius,
+		Radius:         50.0,
+		CellSize:       50.0,
+		NeighbourCells: 1,
+	}
+}
+
+type interestCell struct {
+	X, Y, Z int32
+}
+
+// InterestManager filters replicated entities per connection so that bandwidth
+// scales with the number of nearby entities instead of the size of the world
+type InterestManager struct {
+	config    InterestConfig
+	viewers   map[ConnectionHandle]Vector3
+	positions map[EntityID]Vector3
+	cellOf    map[EntityID]interestCell
+	cells     map[interestCell]map[EntityID]struct{}
+	overrides map[EntityID]Relevance
+	always    map[EntityID]struct{}
+	perConn   map[EntityID]map[ConnectionHandle]bool
+}
+
+// NewInterestManager creates a new interest manager
+func NewInterestManager(config InterestConfig) *InterestManager {
+	if config.Radius <= 0 {
+		config.Radius = DefaultInterestConfig().Radius
+	}
+	if config.CellSize <= 0 {
+		config.CellSize = config.Radius
+	}
+	// Small cells with a large radius would make every query walk a huge block of cells
+	config.CellSize = max(config.CellSize, config.Radius/maxInterestSpan)
+	config.NeighbourCells = min(max(config.NeighbourCells, 0), maxInterestSpan)
+
+	return &InterestManager{
+		config:    config,
+		viewers:   make(map[ConnectionHandle]Vector3),
+		positions: make(map[EntityID]Vector3),
+		cellOf:    make(map[EntityID]interestCell),
+		cells:     make(map[interestCell]map[EntityID]struct{}),
+		overrides: make(map[EntityID]Relevance),
+		always:    make(map[EntityID]struct{}),
+		perConn:   make(map[EntityID]map[ConnectionHandle]bool),
+	}
+}
+
+// GetConfig returns the active configuration
+func (im *InterestManager) GetConfig() InterestConfig {
+	return im.config
+}
+
+func (im *InterestManager) cellFor(position Vector3) interestCell {
+	size := im.config.CellSize
+	return interestCell{
+		X: int32(math.Floor(float64(position.X / size))),
+		Y: int32(math.Floor(float64(position.Y / size))),
+		Z: int32(math.Floor(float64(position.Z / size))),
+	}
+}
+
+// SetViewer sets the position a connection observes the world from (usually its player)
+func (im *InterestManager) SetViewer(conn ConnectionHandle, position Vector3) {
+	im.viewers[conn] = position
+}
+
+// RemoveViewer forgets a connection (call on disconnect)
+func (im *InterestManager) RemoveViewer(conn ConnectionHandle) {
+	delete(im.viewers, conn)
+	for _, conns := range im.perConn {
+		delete(conns, conn)
+	}
+}
+
+// UpdateEntity records the current position of a replicated entity
+func (im *InterestManager) UpdateEntity(entity EntityID, position Vector3) {
+	im.positions[entity] = position
+
+	cell := im.cellFor(position)
+	if old, ok := im.cellOf[entity]; ok {
+		if old == cell {
+			return
+		}
+		im.removeFromCell(entity, old)
+	}
+
+	members, ok := im.cells[cell]
+	if !ok {
+		members = make(map[EntityID]struct{})
+		im.cells[cell] = members
+	}
+	members[entity] = struct{}{}
+	im.cellOf[entity] = cell
+}
+
+// UpdateEntityFromTransform records an entity's position from its Transform component
+func (im *InterestManager) UpdateEntityFromTransform(entity *Entity) error {
+	position, err := entity.GetTransform()
+	if err != nil {
+		return err
+	}
+
+	im.UpdateEntity(entity.ID, position)
+	return nil
+}
+
+// RemoveEntity stops tracking an entity
+func (im *InterestManager) RemoveEntity(entity EntityID) {
+	if cell, ok := im.cellOf[entity]; ok {
+		im.removeFromCell(entity, cell)
+	}
+	delete(im.cellOf, entity)
+	delete(im.positions, entity)
+	delete(im.overrides, entity)
+	delete(im.always, entity)
+	delete(im.perConn, entity)
+}
+
+func (im *InterestManager) removeFromCell(entity EntityID, cell interestCell) {
+	if members, ok := im.cells[cell]; ok {
+		delete(members, entity)
+		if len(members) == 0 {
+			delete(im.cells, cell)
+		}
+	}
+}
+
+// SetRelevance overrides spatial relevance for an entity
+func (im *InterestManager) SetRelevance(entity EntityID, relevance Relevance) {
+	if relevance == RelevanceDefault {
+		delete(im.overrides, entity)
+	} else {
+		im.overrides[entity] = relevance
+	}
+
+	if relevance == RelevanceAlways {
+		im.always[entity] = struct{}{}
+	} else {
+		delete(im.always, entity)
+	}
+}
+
+// GetRelevance returns the relevance override for an entity
+func (im *InterestManager) GetRelevance(entity EntityID) Relevance {
+	return im.overrides[entity]
+}
+
+// SetRelevantTo forces an entity to be relevant (or irrelevant) to one connection,
+// e.g. to always send a player's own entity or to hide an invisible enemy
+func (im *InterestManager) SetRelevantTo(entity EntityID, conn ConnectionHandle, relevant bool) {
+	conns, ok := im.perConn[entity]
+	if !ok {
+		conns = make(map[ConnectionHandle]bool)
+		im.perConn[entity] = conns
+	}
+	conns[conn] = relevant
+}
+
+// ClearRelevantTo removes a per-connection override
+func (im *InterestManager) ClearRelevantTo(entity EntityID, conn ConnectionHandle) {
+	if conns, ok := im.perConn[entity]; ok {
+		delete(conns, conn)
+		if len(conns) == 0 {
+			delete(im.perConn, entity)
+		}
+	}
+}
+
+// IsRelevant reports whether updates for an entity should be sent to a connection
+func (im *InterestManager) IsRelevant(conn ConnectionHandle, entity EntityID) bool {
+	if conns, ok := im.perConn[entity]; ok {
+		if relevant, ok := conns[conn]; ok {
+			return relevant
+		}
+	}
+
+	switch im.overrides[entity] {
+	case RelevanceAlways:
+		return true
+	case RelevanceNever:
+		return false
+	}
+
+	viewer, ok := im.viewers[conn]
+	if !ok {
+		return false
+	}
+	position, ok := im.positions[entity]
+	if !ok {
+		return false
+	}
+
+	return im.spatiallyRelevant(viewer, position)
+}
+
+func (im *InterestManager) spatiallyRelevant(viewer, position Vector3) bool {
+	if im.config.Mode == InterestGrid {
+		a := im.cellFor(viewer)
+		b := im.cellFor(position)
+		n := int32(im.config.NeighbourCells)
+		return absInt32(a.X-b.X) <= n && absInt32(a.Y-b.Y) <= n && absInt32(a.Z-b.Z) <= n
+	}
+
+	dx := position.X - viewer.X
+	dy := position.Y - viewer.Y
+	dz := position.Z - viewer.Z
+	return dx*dx+dy*dy+dz*dz <= im.config.Radius*im.config.Radius
+}
+
+// RelevantEntities returns every entity that should be replicated to a connection.
+// Only grid cells near the viewer are visited, so the cost depends on local density.
+func (im *InterestManager) RelevantEntities(conn ConnectionHandle) []EntityID {
+	result := make([]EntityID, 0, 32)
+	seen := make(map[EntityID]struct{})
+
+	add := func(entity EntityID) {
+		if _, ok := seen[entity]; ok {
+			return
+		}
+		seen[entity] = struct{}{}
+		if im.IsRelevant(conn, entity) {
+			result = append(result, entity)
+		}
+	}
+
+	for entity := range im.always {
+		add(entity)
+	}
+	for entity, conns := range im.perConn {
+		if conns[conn] {
+			add(entity)
+		}
+	}
+
+	viewer, ok := im.viewers[conn]
+	if !ok {
+		return result
+	}
+
+	span := int32(im.config.NeighbourCells)
+	if im.config.Mode == InterestRadius {
+		span = int32(math.Ceil(float64(im.config.Radius / im.config.CellSize)))
+	}
+	span = min(span, maxInterestSpan)
+
+	center := im.cellFor(viewer)
+	for x := center.X - span; x <= center.X+span; x++ {
+		for y := center.Y - span; y <= center.Y+span; y++ {
+			for z := center.Z - span; z <= center.Z+span; z++ {
+				for entity := range im.cells[interestCell{x, y, z}] {
+					add(entity)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// InterestedConnections returns every viewer that considers an entity relevant
+func (im *InterestManager) InterestedConnections(entity EntityID) []ConnectionHandle {
+	result := make([]ConnectionHandle, 0, len(im.viewers))
+	for conn := range im.viewers {
+		if im.IsRelevant(conn, entity) {
+			result = append(result, conn)
+		}
+	}
+	return result
+}
+
+func absInt32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,633 @@
+package boulder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ItemDefinition describes a kind of item. Definitions are data, loaded from JSON or TOML.
+type ItemDefinition struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	MaxStack    int               `json:"max_stack,omitempty"` // Zero or one means the item doesn't stack
+	Weight      float32           `json:"weight,omitempty"`
+	Icon        string            `json:"icon,omitempty"`
+	Model       string            `json:"model,omitempty"` // Drawn for pickups of the item
+	Tags        []string          `json:"tags,omitempty"`
+	Properties  map[string]string `json:"properties,omitempty"` // Game specific values
+}
+
+// GetMaxStack returns how many of the item fit in one slot
+func (d *ItemDefinition) GetMaxStack() int {
+	return max(1, d.MaxStack)
+}
+
+// HasTag returns true if the item has a tag
+func (d *ItemDefinition) HasTag(tag string) bool {
+	for _, t := range d.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ItemDatabase holds item definitions by ID
+type ItemDatabase struct {
+	items map[string]*ItemDefinition
+	order []string
+}
+
+// NewItemDatabase creates an empty item database
+func NewItemDatabase() *ItemDatabase {
+	return &ItemDatabase{items: make(map[string]*ItemDefinition)}
+}
+
+// Register adds an item definition, replacing any with the same ID
+func (db *ItemDatabase) Register(def ItemDefinition) error {
+	if def.ID == "" {
+		return errors.New("item definition needs an id")
+	}
+	if def.MaxStack < 0 {
+		return errors.New("item max stack can't be negative: " + def.ID)
+	}
+
+	if _, ok := db.items[def.ID]; !ok {
+		db.order = append(db.order, def.ID)
+	}
+	db.items[def.ID] = &def
+	return nil
+}
+
+// Get returns an item definition
+func (db *ItemDatabase) Get(id string) (*ItemDefinition, bool) {
+	def, ok := db.items[id]
+	return def, ok
+}
+
+// GetAll returns every definition in the order they were registered
+func (db *ItemDatabase) GetAll() []*ItemDefinition {
+	defs := make([]*ItemDefinition, len(db.order))
+	for i, id := range db.order {
+		defs[i] = db.items[id]
+	}
+	return defs
+}
+
+// LoadFile loads item definitions from a .json or .toml file
+func (db *ItemDatabase) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = db.LoadJSON(data)
+	case ".toml":
+		err = db.LoadTOML(data)
+	default:
+		return errors.New("unsupported item file: " + path)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadJSON loads item definitions from either a JSON array of items or an object with an
+// "items" array
+func (db *ItemDatabase) LoadJSON(data []byte) error {
+	var defs []ItemDefinition
+	if err := json.Unmarshal(data, &defs); err != nil {
+		var file struct {
+			Items []ItemDefinition `json:"items"`
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return err
+		}
+		defs = file.Items
+	}
+
+	for _, def := range defs {
+		if err := db.Register(def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadTOML loads item definitions from [[item]] tables. Only what item files need is
+// supported: strings, numbers, booleans, string arrays and an [item.properties] table.
+//
+//	[[item]]
+//	id = "potion"
+//	name = "Health Potion"
+//	max_stack = 10
+//	tags = ["consumable"]
+//
+//	[item.properties]
+//	heal = "25"
+func (db *ItemDatabase) LoadTOML(data []byte) error {
+	var defs []ItemDefinition
+	var current *ItemDefinition
+	inProperties := false
+
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(stripTOMLComment(line))
+		if line == "" {
+			continue
+		}
+
+		switch line {
+		case "[[item]]", "[[items]]":
+			defs = append(defs, ItemDefinition{})
+			current = &defs[len(defs)-1]
+			inProperties = false
+			continue
+		case "[item.properties]", "[items.properties]":
+			if current == nil {
+				return fmt.Errorf("line %d: properties outside an item", n+1)
+			}
+			inProperties = true
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return fmt.Errorf("line %d: unsupported table %s", n+1, line)
+		}
+		if current == nil {
+			return fmt.Errorf("line %d: key outside an item", n+1)
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("line %d: expected key = value", n+1)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+		raw = strings.TrimSpace(raw)
+
+		if inProperties {
+			value, err := parseTOMLScalar(raw)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", n+1, err)
+			}
+			if current.Properties == nil {
+				current.Properties = make(map[string]string)
+			}
+			current.Properties[key] = value
+			continue
+		}
+
+		if err := setItemField(current, key, raw); err != nil {
+			return fmt.Errorf("line %d: %w", n+1, err)
+		}
+	}
+
+	for _, def := range defs {
+		if err := db.Register(def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setItemField(def *ItemDefinition, key, raw string) error {
+	if key == "tags" {
+		tags, err := parseTOMLStringArray(raw)
+		def.Tags = tags
+		return err
+	}
+
+	value, err := parseTOMLScalar(raw)
+	if err != nil {
+		return err
+	}
+
+	switch key {
+	case "id":
+		def.ID = value
+	case "name":
+		def.Name = value
+	case "description":
+		def.Description = value
+	case "icon":
+		def.Icon = value
+	case "model":
+		def.Model = value
+	case "max_stack":
+		def.MaxStack, err = strconv.Atoi(value)
+	case "weight":
+		var weight float64
+		weight, err = strconv.ParseFloat(value, 32)
+		def.Weight = float32(weight)
+	default:
+		return errors.New("unknown item field " + key)
+	}
+	return err
+}
+
+// parseTOMLScalar returns a TOML string, number or boolean as text
+func parseTOMLScalar(raw string) (string, error) {
+	if strings.HasPrefix(raw, `"`) {
+		return strconv.Unquote(raw)
+	}
+	if strings.HasPrefix(raw, "'") && strings.HasSuffix(raw, "'") && len(raw) >= 2 {
+		return raw[1 : len(raw)-1], nil
+	}
+	if raw == "true" || raw == "false" {
+		return raw, nil
+	}
+	if _, err := strconv.ParseFloat(strings.ReplaceAll(raw, "_", ""), 64); err == nil {
+		return strings.ReplaceAll(raw, "_", ""), nil
+	}
+	return "", errors.New("unsupported value " + raw)
+}
+
+func parseTOMLStringArray(raw string) ([]string, error) {
+	if !strings.HasPrefix(raw, "[") || !strings.HasSuffix(raw, "]") {
+		return nil, errors.New("expected an array")
+	}
+
+	var values []string
+	for _, part := range strings.Split(raw[1:len(raw)-1], ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		value, err := parseTOMLScalar(part)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// stripTOMLComment removes a # comment that isn't inside a string
+func stripTOMLComment(line string) string {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// ItemStack is a number of one item in an inventory slot
+type ItemStack struct {
+	Item  string `json:"item"`
+	Count int    `json:"count"`
+}
+
+// IsEmpty returns true for an empty slot
+func (s ItemStack) IsEmpty() bool {
+	return s.Count <= 0 || s.Item == ""
+}
+
+// Inventory is a fixed number of slots holding stacks of items
+type Inventory struct {
+	db    *ItemDatabase
+	slots []ItemStack
+}
+
+// NewInventory creates an empty inventory
+func NewInventory(db *ItemDatabase, slots int) *Inventory {
+	return &Inventory{db: db, slots: make([]ItemStack, max(0, slots))}
+}
+
+// GetSlotCount returns the number of slots
+func (inv *Inventory) GetSlotCount() int {
+	return len(inv.slots)
+}
+
+// GetSlot returns the stack in a slot
+func (inv *Inventory) GetSlot(slot int) ItemStack {
+	if slot < 0 || slot >= len(inv.slots) {
+		return ItemStack{}
+	}
+	return inv.slots[slot]
+}
+
+// GetSlots returns a copy of every slot
+func (inv *Inventory) GetSlots() []ItemStack {
+	return append([]ItemStack(nil), inv.slots...)
+}
+
+// Add puts items into the inventory, topping up existing stacks before using empty slots.
+// Returns how many were added; the rest didn't fit.
+func (inv *Inventory) Add(item string, count int) (int, error) {
+	def, ok := inv.db.Get(item)
+	if !ok {
+		return 0, errors.New("unknown item: " + item)
+	}
+	if count <= 0 {
+		return 0, nil
+	}
+
+	remaining := count
+	for i := range inv.slots {
+		if remaining == 0 {
+			break
+		}
+		if inv.slots[i].Item == item && inv.slots[i].Count < def.GetMaxStack() {
+			n := min(remaining, def.GetMaxStack()-inv.slots[i].Count)
+			inv.slots[i].Count += n
+			remaining -= n
+		}
+	}
+	for i := range inv.slots {
+		if remaining == 0 {
+			break
+		}
+		if inv.slots[i].IsEmpty() {
+			n := min(remaining, def.GetMaxStack())
+			inv.slots[i] = ItemStack{Item: item, Count: n}
+			remaining -= n
+		}
+	}
+	return count - remaining, nil
+}
+
+// Remove takes items out of the inventory, emptying the last stacks first. Returns how
+// many were removed.
+func (inv *Inventory) Remove(item string, count int) int {
+	remaining := count
+	for i := len(inv.slots) - 1; i >= 0 && remaining > 0; i-- {
+		if inv.slots[i].Item != item {
+			continue
+		}
+		n := min(remaining, inv.slots[i].Count)
+		inv.slots[i].Count -= n
+		remaining -= n
+		if inv.slots[i].Count == 0 {
+			inv.slots[i] = ItemStack{}
+		}
+	}
+	return count - remaining
+}
+
+// Count returns how many of an item the inventory holds
+func (inv *Inventory) Count(item string) int {
+	total := 0
+	for _, s := range inv.slots {
+		if s.Item == item {
+			total += s.Count
+		}
+	}
+	return total
+}
+
+// GetWeight returns the total weight of everything in the inventory
+func (inv *Inventory) GetWeight() float32 {
+	var weight float32
+	for _, s := range inv.slots {
+		if def, ok := inv.db.Get(s.Item); ok && !s.IsEmpty() {
+			weight += def.Weight * float32(s.Count)
+		}
+	}
+	return weight
+}
+
+// Move moves a slot's stack onto another slot, merging matching stacks and swapping
+// different ones
+func (inv *Inventory) Move(from, to int) error {
+	if from < 0 || from >= len(inv.slots) || to < 0 || to >= len(inv.slots) {
+		return errors.New("inventory slot out of range")
+	}
+	if from == to || inv.slots[from].IsEmpty() {
+		return nil
+	}
+
+	src, dst := &inv.slots[from], &inv.slots[to]
+	if src.Item == dst.Item {
+		def, _ := inv.db.Get(src.Item)
+		n := src.Count
+		if def != nil {
+			n = min(n, def.GetMaxStack()-dst.Count)
+		}
+		dst.Count += n
+		src.Count -= n
+		if src.Count == 0 {
+			*src = ItemStack{}
+		}
+		return nil
+	}
+
+	*src, *dst = *dst, *src
+	return nil
+}
+
+// Clear empties every slot
+func (inv *Inventory) Clear() {
+	clear(inv.slots)
+}
+
+// MarshalJSON saves the inventory's slots
+func (inv *Inventory) MarshalJSON() ([]byte, error) {
+	return json.Marshal(inv.slots)
+}
+
+// UnmarshalJSON restores slots saved by MarshalJSON. Unknown items are dropped so that
+// removing an item definition doesn't break old saves.
+func (inv *Inventory) UnmarshalJSON(data []byte) error {
+	var slots []ItemStack
+	if err := json.Unmarshal(data, &slots); err != nil {
+		return err
+	}
+
+	for i := range slots {
+		if _, ok := inv.db.Get(slots[i].Item); !ok || slots[i].Count <= 0 {
+			slots[i] = ItemStack{}
+		}
+	}
+	if len(slots) < len(inv.slots) {
+		slots = append(slots, make([]ItemStack, len(inv.slots)-len(slots))...)
+	}
+	inv.slots = slots
+	return nil
+}
+
+// PickupEvent reports an entity collecting items from a pickup
+type PickupEvent struct {
+	Pickup    EntityID
+	Collector EntityID
+	Item      string
+	Count     int
+}
+
+// PickupCallback is called when items are picked up
+type PickupCallback func(event PickupEvent)
+
+type pickup struct {
+	entity *Entity
+	stack  ItemStack
+	radius float32
+}
+
+// Items gives entities inventories and lets them collect pickups by walking into their
+// trigger radius
+type Items struct {
+	world       *World
+	db          *ItemDatabase
+	inventories map[EntityID]*Inventory
+	pickups     map[EntityID]*pickup
+	events      []PickupEvent
+	onPickup    PickupCallback
+}
+
+// NewItems creates an item system for a world
+func NewItems(world *World, db *ItemDatabase) *Items {
+	return &Items{
+		world:       world,
+		db:          db,
+		inventories: make(map[EntityID]*Inventory),
+		pickups:     make(map[EntityID]*pickup),
+	}
+}
+
+// GetDatabase returns the item definitions
+func (it *Items) GetDatabase() *ItemDatabase {
+	return it.db
+}
+
+// AddInventory gives an entity an inventory; entities with inventories collect pickups
+func (it *Items) AddInventory(entity EntityID, slots int) *Inventory {
+	inv := NewInventory(it.db, slots)
+	it.inventories[entity] = inv
+	return inv
+}
+
+// GetInventory returns an entity's inventory
+func (it *Items) GetInventory(entity EntityID) (*Inventory, bool) {
+	inv, ok := it.inventories[entity]
+	return inv, ok
+}
+
+// RemoveInventory removes an entity's inventory
+func (it *Items) RemoveInventory(entity EntityID) {
+	delete(it.inventories, entity)
+}
+
+// OnPickup sets the callback run when items are picked up. Events are also queued for
+// PollPickups.
+func (it *Items) OnPickup(callback PickupCallback) {
+	it.onPickup = callback
+}
+
+// PollPickups returns the pickups since the last call
+func (it *Items) PollPickups() []PickupEvent {
+	events := it.events
+	it.events = nil
+	return events
+}
+
+// SpawnPickup creates an entity holding items that is collected when an entity with an
+// inventory comes within radius. The item's model is drawn if it has one.
+func (it *Items) SpawnPickup(item string, count int, position Vector3, radius float32) (EntityID, error) {
+	def, ok := it.db.Get(item)
+	if !ok {
+		return 0, errors.New("unknown item: " + item)
+	}
+	if count <= 0 || radius <= 0 {
+		return 0, errors.New("pickup needs a positive count and radius")
+	}
+
+	entity, err := it.world.NewEntity()
+	if err != nil {
+		return 0, err
+	}
+	if err := entity.AddTransform(position); err != nil {
+		entity.Destroy()
+		return 0, err
+	}
+	if def.Model != "" {
+		if err := entity.LoadModel(def.Model); err != nil {
+			entity.Destroy()
+			return 0, err
+		}
+	}
+
+	it.pickups[entity.ID] = &pickup{entity: entity, stack: ItemStack{Item: item, Count: count}, radius: radius}
+	return entity.ID, nil
+}
+
+// Update gives pickups to inventories that are in range (call this every frame). A pickup
+// that doesn't fully fit stays behind with what's left.
+func (it *Items) Update() {
+	for id, p := range it.pickups {
+		center, err := p.entity.GetTransform()
+		if err != nil {
+			delete(it.pickups, id)
+			continue
+		}
+
+		for collector, inv := range it.inventories {
+			position, err := (&Entity{ID: collector, world: it.world}).GetTransform()
+			if err != nil {
+				continue
+			}
+			d := Vector3{position.X - center.X, position.Y - center.Y, position.Z - center.Z}
+			if vectorLength(d) > p.radius {
+				continue
+			}
+
+			added, _ := inv.Add(p.stack.Item, p.stack.Count)
+			if added == 0 {
+				continue
+			}
+			p.stack.Count -= added
+
+			event := PickupEvent{Pickup: id, Collector: collector, Item: p.stack.Item, Count: added}
+			it.events = append(it.events, event)
+			if it.onPickup != nil {
+				runCallback("OnPickup", func() { it.onPickup(event) })
+			}
+
+			if p.stack.Count == 0 {
+				p.entity.Destroy()
+				delete(it.pickups, id)
+				break
+			}
+		}
+	}
+}
+
+// SaveInventories serializes every inventory, keyed by entity, for save games
+func (it *Items) SaveInventories() ([]byte, error) {
+	return json.Marshal(it.inventories)
+}
+
+// LoadInventories restores inventories saved by SaveInventories
+func (it *Items) LoadInventories(data []byte) error {
+	var raw map[EntityID]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	inventories := make(map[EntityID]*Inventory, len(raw))
+	for entity, slots := range raw {
+		inv := NewInventory(it.db, 0)
+		if err := inv.UnmarshalJSON(slots); err != nil {
+			return err
+		}
+		inventories[entity] = inv
+	}
+	it.inventories = inventories
+	return nil
+}
@@ -0,0 +1,150 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// KeepAlivePolicy sends keep-alives on quiet connections and drops connections that have
+// gone quiet. GameNetworkingSockets already times out dead links (see SetConnectionTimeouts);
+// this also catches a peer whose game loop has stopped while its network thread runs on.
+type KeepAlivePolicy struct {
+	Interval time.Duration // Send a keep-alive after this long without sending anything; 0 sends none
+	Timeout  time.Duration // Drop a connection after this long without receiving anything; 0 never does
+}
+
+// DefaultKeepAlivePolicy sends a keep-alive each second and drops a connection after 10
+// seconds of silence
+func DefaultKeepAlivePolicy() KeepAlivePolicy {
+	return KeepAlivePolicy{
+		Interval: time.Second,
+		Timeout:  10 * time.Second,
+	}
+}
+
+// keepAliveState is the session's policy and when each connection last sent and received
+type keepAliveState struct {
+	policy   KeepAlivePolicy
+	sent     map[ConnectionHandle]time.Time
+	received map[ConnectionHandle]time.Time
+	timedOut []ConnectionHandle // Dropped, to be reported by PollEvent
+}
+
+// SetConnectionTimeouts sets how long the session's connections, open and future, may take
+// to connect and may go without hearing from the peer before they close with a
+// DisconnectedEvent. 0 keeps the default of 10 seconds.
+func (ns *NetworkSession) SetConnectionTimeouts(connect, connected time.Duration) error {
+	defer lockThread()()
+	if ns.handle == nil {
+		return errSessionNotInitialized
+	}
+	if connect < 0 || connected < 0 {
+		return errors.New("timeouts can't be negative")
+	}
+
+	if C.boulder_set_network_timeouts(ns.handle, C.int(connect.Milliseconds()), C.int(connected.Milliseconds())) != 0 {
+		return lastError("failed to set connection timeouts")
+	}
+	return nil
+}
+
+// SetKeepAlivePolicy turns on keep-alives for the session's connections; a zero policy
+// turns them off. Both ends should use the same Interval, well under the other's Timeout.
+// Connections dropped for silence are reported by PollEvent like any other disconnect
+// (or reconnected, see EnableAutoReconnect).
+func (ns *NetworkSession) SetKeepAlivePolicy(policy KeepAlivePolicy) {
+	if policy.Interval <= 0 && policy.Timeout <= 0 {
+		ns.keepAlive = nil
+		return
+	}
+	if ns.keepAlive == nil {
+		ns.keepAlive = &keepAliveState{
+			sent:     make(map[ConnectionHandle]time.Time),
+			received: make(map[ConnectionHandle]time.Time),
+		}
+	}
+	ns.keepAlive.policy = policy
+}
+
+// GetKeepAlivePolicy returns the session's keep-alive policy, zero when it has none
+func (ns *NetworkSession) GetKeepAlivePolicy() KeepAlivePolicy {
+	if ns.keepAlive == nil {
+		return KeepAlivePolicy{}
+	}
+	return ns.keepAlive.policy
+}
+
+// startKeepAlive starts the timers of a new connection
+func (ns *NetworkSession) startKeepAlive(conn ConnectionHandle) {
+	if ka := ns.keepAlive; ka != nil {
+		now := time.Now()
+		ka.sent[conn] = now
+		ka.received[conn] = now
+	}
+}
+
+// noteSent resets a connection's keep-alive timer
+func (ns *NetworkSession) noteSent(conn ConnectionHandle) {
+	if ka := ns.keepAlive; ka != nil {
+		if _, ok := ka.sent[conn]; ok {
+			ka.sent[conn] = time.Now()
+		}
+	}
+}
+
+// noteReceived resets a connection's timeout
+func (ns *NetworkSession) noteReceived(conn ConnectionHandle) {
+	if ka := ns.keepAlive; ka != nil {
+		if _, ok := ka.received[conn]; ok {
+			ka.received[conn] = time.Now()
+		}
+	}
+}
+
+// updateKeepAlive sends the keep-alives that are due and drops silent connections
+func (ns *NetworkSession) updateKeepAlive() {
+	ka := ns.keepAlive
+	if ka == nil {
+		return
+	}
+
+	now := time.Now()
+	for conn, received := range ka.received {
+		if ka.policy.Timeout > 0 && now.Sub(received) > ka.policy.Timeout {
+			LogInfo(fmt.Sprintf("Dropping connection %d after %v without a message", conn, ka.policy.Timeout))
+			ns.closeTransport(conn)
+			ns.forgetKeepAlive(conn)
+			ka.timedOut = append(ka.timedOut, conn)
+			continue
+		}
+		if ka.policy.Interval > 0 && now.Sub(ka.sent[conn]) >= ka.policy.Interval {
+			if err := ns.sendControl(conn, controlKeepAlive, nil, false); err == nil {
+				ka.sent[conn] = now
+			}
+		}
+	}
+}
+
+// takeTimedOut returns a connection dropped for silence that PollEvent hasn't reported yet
+func (ns *NetworkSession) takeTimedOut() (ConnectionHandle, bool) {
+	ka := ns.keepAlive
+	if ka == nil || len(ka.timedOut) == 0 {
+		return 0, false
+	}
+	conn := ka.timedOut[0]
+	ka.timedOut = ka.timedOut[1:]
+	return conn, true
+}
+
+// forgetKeepAlive drops a closed connection's timers
+func (ns *NetworkSession) forgetKeepAlive(conn ConnectionHandle) {
+	if ka := ns.keepAlive; ka != nil {
+		delete(ka.sent, conn)
+		delete(ka.received, conn)
+	}
+}
@@ -0,0 +1,101 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+
+// KeyEvent is a key going down or up. Scancode is the key's position, named after the US
+// layout like the Key constants; Keycode is what it types on the user's layout, so on
+// AZERTY pressing KeyW gives the keycode 'z'.
+type KeyEvent struct {
+	Scancode int
+	Keycode  int
+	Down     bool
+	Repeat   bool // The key is held and this is a repeat
+}
+
+// PollKeyEvents returns the key events since the last call, oldest first. Events are
+// collected by Window.PollEvents; the engine keeps the last 256.
+func (i *Input) PollKeyEvents() []KeyEvent {
+	if !i.engine.initialized {
+		return nil
+	}
+
+	var events []KeyEvent
+	var event C.KeyEvent
+	for C.boulder_poll_key_event(&event) != 0 {
+		events = append(events, KeyEvent{
+			Scancode: int(event.scancode),
+			Keycode:  int(event.keycode),
+			Down:     event.down != 0,
+			Repeat:   event.repeat != 0,
+		})
+	}
+	return events
+}
+
+// GetKeycode returns what the key at a position types on the current layout, lowercase
+// for letters ('z' for KeyW on AZERTY)
+func (i *Input) GetKeycode(scancode int) int {
+	if !i.engine.initialized {
+		return 0
+	}
+	return int(C.boulder_get_keycode(C.int(scancode)))
+}
+
+// GetScancode returns the position of the key that types a keycode on the current
+// layout, or KeyUnknown if none does
+func (i *Input) GetScancode(keycode int) int {
+	if !i.engine.initialized {
+		return KeyUnknown
+	}
+	return int(C.boulder_get_scancode(C.uint32_t(keycode)))
+}
+
+// IsKeycodePressed checks if the key that types a keycode on the current layout is
+// pressed, e.g. 'z' for a shortcut named after its letter
+func (i *Input) IsKeycodePressed(keycode int) bool {
+	scancode := i.GetScancode(keycode)
+	return scancode != KeyUnknown && i.IsKeyPressed(scancode)
+}
+
+// GetKeyName returns the name of the key at a position as the current layout labels it,
+// for showing bindings: "Z" for KeyW on AZERTY and "W" on QWERTY. Store bindings as
+// scancodes and name them when shown, so they follow layout changes.
+func (i *Input) GetKeyName(scancode int) string {
+	if !i.engine.initialized {
+		return ""
+	}
+
+	var buf [64]C.char
+	length := C.boulder_get_key_name(C.int(scancode), &buf[0], C.uint32_t(len(buf)))
+	return C.GoStringN(&buf[0], C.int(min(int(length), len(buf)-1)))
+}
+
+// GetScancodeName returns the layout independent name of a key position, the same on
+// every keyboard
+func (i *Input) GetScancodeName(scancode int) string {
+	if !i.engine.initialized {
+		return ""
+	}
+
+	var buf [64]C.char
+	length := C.boulder_get_scancode_name(C.int(scancode), &buf[0], C.uint32_t(len(buf)))
+	return C.GoStringN(&buf[0], C.int(min(int(length), len(buf)-1)))
+}
+
+// OnKeyboardLayoutChanged registers a callback run by Window.PollEvents when the user
+// switches keyboard layout, so shown key names can be refreshed with GetKeyName
+func (e *Engine) OnKeyboardLayoutChanged(callback func()) {
+	e.layoutCallbacks = append(e.layoutCallbacks, callback)
+}
+
+func (e *Engine) dispatchLayoutChanged() {
+	if C.boulder_take_keymap_changed() == 0 {
+		return
+	}
+	for _, callback := range e.layoutCallbacks {
+		runCallback("OnKeyboardLayoutChanged", callback)
+	}
+}
@@ -0,0 +1,126 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import "errors"
+
+// LightType is how a light shines
+type LightType int
+
+const (
+	LightDirectional LightType = 0 // Parallel rays along the entity's -Z axis, like the sun
+	LightPoint       LightType = 1 // From the entity's position in every direction
+	LightSpot        LightType = 2 // From the entity's position in a cone around its -Z axis
+)
+
+// Light is a light component's settings
+type Light struct {
+	Type       LightType
+	Color      UIColor // Alpha is unused
+	Intensity  float32
+	Range      float32 // Distance at which point and spot lights fade out; 0 has no cutoff
+	InnerAngle float32 // Half angle in degrees inside which a spot light is at full strength
+	OuterAngle float32 // Half angle in degrees outside which a spot light is dark
+}
+
+// AddDirectionalLight makes the entity light the scene along its -Z axis; rotate it to aim
+func (e *Entity) AddDirectionalLight(color UIColor, intensity float32) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_add_directional_light(C.EntityID(e.ID), C.float(color.R), C.float(color.G), C.float(color.B), C.float(intensity)); ret != 0 {
+		return lastError("failed to add directional light")
+	}
+
+	return nil
+}
+
+// AddPointLight makes the entity a light shining in every direction, fading out at range
+// (0 never cuts it off)
+func (e *Entity) AddPointLight(color UIColor, intensity, lightRange float32) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_add_point_light(C.EntityID(e.ID), C.float(color.R), C.float(color.G), C.float(color.B), C.float(intensity), C.float(lightRange)); ret != 0 {
+		return lastError("failed to add point light")
+	}
+
+	return nil
+}
+
+// AddSpotLight makes the entity a light shining in a cone along its -Z axis. innerAngle and
+// outerAngle are half angles in degrees (below 90): full strength inside the inner one,
+// fading to dark at the outer one.
+func (e *Entity) AddSpotLight(color UIColor, intensity, lightRange, innerAngle, outerAngle float32) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_add_spot_light(C.EntityID(e.ID), C.float(color.R), C.float(color.G), C.float(color.B), C.float(intensity),
+		C.float(lightRange), C.float(innerAngle), C.float(outerAngle)); ret != 0 {
+		return lastError("failed to add spot light")
+	}
+
+	return nil
+}
+
+// RemoveLight removes the entity's light. Once a scene has no lights left, it is lit by the
+// default light from above again.
+func (e *Entity) RemoveLight() error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_remove_light(C.EntityID(e.ID)); ret != 0 {
+		return lastError("failed to remove light")
+	}
+
+	return nil
+}
+
+// GetLight returns the entity's light, false if it has none
+func (e *Entity) GetLight() (Light, bool) {
+	if !e.world.ready() {
+		return Light{}, false
+	}
+
+	var color [3]C.float
+	var intensity, lightRange, inner, outer C.float
+	ret := C.boulder_get_light(C.EntityID(e.ID), &color[0], &intensity, &lightRange, &inner, &outer)
+	if ret < 0 {
+		return Light{}, false
+	}
+
+	return Light{
+		Type:       LightType(ret),
+		Color:      UIColor{float32(color[0]), float32(color[1]), float32(color[2]), 1},
+		Intensity:  float32(intensity),
+		Range:      float32(lightRange),
+		InnerAngle: float32(inner),
+		OuterAngle: float32(outer),
+	}, true
+}
+
+// SetAmbientLight sets the light that reaches every surface from all around (the default:
+// white at 0.2)
+func (r *Renderer) SetAmbientLight(color UIColor, intensity float32) error {
+	if ret := C.boulder_set_ambient_light(C.float(color.R), C.float(color.G), C.float(color.B), C.float(intensity)); ret != 0 {
+		return errors.New("invalid ambient light")
+	}
+	return nil
+}
+
+// GetAmbientLight returns the ambient light's color times its intensity
+func (r *Renderer) GetAmbientLight() UIColor {
+	var color [3]C.float
+	C.boulder_get_ambient_light(&color[0])
+	return UIColor{float32(color[0]), float32(color[1]), float32(color[2]), 1}
+}
@@ -0,0 +1,12 @@
+//go:build android
+
+package boulder
+
+// Links libboulder_shared.so built with the Android NDK from lib/android_<arch>. Package it
+// in the APK's jniLibs next to SDL's libSDL3.so and the Go library, where the app's
+// loader finds it.
+
+// #cgo android,arm64 LDFLAGS: -L${SRCDIR}/lib/android_arm64
+// #cgo android,amd64 LDFLAGS: -L${SRCDIR}/lib/android_amd64
+// #cgo LDFLAGS: -lboulder_shared -landroid -llog
+import "C"
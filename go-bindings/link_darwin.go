@@ -0,0 +1,14 @@
+//go:build darwin && !ios
+
+package boulder
+
+// Links libboulder_shared.dylib from the CMake build directory, or from lib/darwin_<arch>
+// where cmd/boulder-fetch unpacks release builds. Vulkan runs on MoltenVK, loaded at runtime
+// from the Vulkan loader (see CheckRuntime). To ship the library inside an app bundle,
+// build with -ldflags=-extldflags=-Wl,-rpath,@executable_path/../Frameworks.
+
+// #cgo LDFLAGS: -L${SRCDIR}/../build -Wl,-rpath,${SRCDIR}/../build
+// #cgo darwin,amd64 LDFLAGS: -L${SRCDIR}/lib/darwin_amd64 -Wl,-rpath,${SRCDIR}/lib/darwin_amd64
+// #cgo darwin,arm64 LDFLAGS: -L${SRCDIR}/lib/darwin_arm64 -Wl,-rpath,${SRCDIR}/lib/darwin_arm64
+// #cgo LDFLAGS: -lboulder_shared
+import "C"
@@ -0,0 +1,12 @@
+//go:build ios
+
+package boulder
+
+// Links libboulder_shared.dylib built for iOS from lib/ios_arm64 (lib/ios_amd64 for the
+// simulator). Embed it in the app's Frameworks folder and give the executable an rpath to
+// it in Xcode (@executable_path/Frameworks). Vulkan runs on MoltenVK.
+
+// #cgo ios,arm64 LDFLAGS: -L${SRCDIR}/lib/ios_arm64
+// #cgo ios,amd64 LDFLAGS: -L${SRCDIR}/lib/ios_amd64
+// #cgo LDFLAGS: -lboulder_shared -framework Metal -framework QuartzCore -framework UIKit
+import "C"
@@ -0,0 +1,13 @@
+//go:build linux && !android
+
+package boulder
+
+// Links libboulder_shared.so from the CMake build directory, or from lib/linux_<arch>
+// where cmd/boulder-fetch unpacks release builds. Executables also look in their own
+// directory, so the library can be shipped next to them.
+
+// #cgo LDFLAGS: -L${SRCDIR}/../build -Wl,-rpath,${SRCDIR}/../build -Wl,-rpath,$ORIGIN
+// #cgo linux,amd64 LDFLAGS: -L${SRCDIR}/lib/linux_amd64 -Wl,-rpath,${SRCDIR}/lib/linux_amd64
+// #cgo linux,arm64 LDFLAGS: -L${SRCDIR}/lib/linux_arm64 -Wl,-rpath,${SRCDIR}/lib/linux_arm64
+// #cgo LDFLAGS: -lboulder_shared
+import "C"
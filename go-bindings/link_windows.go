@@ -0,0 +1,13 @@
+//go:build windows
+
+package boulder
+
+// Links boulder_shared.dll (built with MinGW) from the CMake build directory, or from
+// lib/windows_<arch> where cmd/boulder-fetch unpacks release builds. Windows has no rpath:
+// copy the DLL next to the executable or add its directory to PATH.
+
+// #cgo LDFLAGS: -L${SRCDIR}/../build
+// #cgo windows,amd64 LDFLAGS: -L${SRCDIR}/lib/windows_amd64
+// #cgo windows,arm64 LDFLAGS: -L${SRCDIR}/lib/windows_arm64
+// #cgo LDFLAGS: -lboulder_shared
+import "C"
@@ -0,0 +1,423 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"os"
+	"unsafe"
+)
+
+const (
+	// MaterialMaxTextures is the number of texture slots in a material
+	MaterialMaxTextures = 4
+
+	// MaterialMaxParams is the size in bytes of a material's parameter block
+	MaterialMaxParams = 256
+)
+
+// BlendMode is how a model's fragments combine with what is already drawn
+type BlendMode int
+
+const (
+	BlendOpaque     BlendMode = 0
+	BlendAlphaTest  BlendMode = 1 // Opaque; the fragment shader discards (constant_id 0 is the mode)
+	BlendAlphaBlend BlendMode = 2 // Glass, smoke; sorted back to front
+	BlendAdditive   BlendMode = 3 // Fire, sparks; sorted back to front
+)
+
+// Render queues models draw in, lowest first. Queue 0 picks the blend mode's queue.
+const (
+	RenderQueueOpaque      = 2000
+	RenderQueueAlphaTest   = 2450
+	RenderQueueTransparent = 3000
+)
+
+// TextureID represents a texture on the GPU
+type TextureID uint64
+
+// Texture is an image that materials can sample, RGBA or in a KTX2 file's compressed
+// format. It is uploaded again when the engine restarts.
+type Texture struct {
+	ID     TextureID
+	Width  int
+	Height int
+	engine *Engine
+}
+
+// CreateTexture uploads an image as a texture
+func (e *Engine) CreateTexture(img image.Image) (*Texture, error) {
+	defer lockThread()()
+	if !e.initialized {
+		return nil, errNotInitialized
+	}
+
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, errors.New("empty image")
+	}
+
+	rgba := tightNRGBA(img)
+	id := C.boulder_create_texture(unsafe.Pointer(&rgba.Pix[0]), C.uint32_t(bounds.Dx()), C.uint32_t(bounds.Dy()))
+	if id == 0 {
+		return nil, lastError("failed to create texture")
+	}
+
+	t := &Texture{ID: TextureID(id), Width: bounds.Dx(), Height: bounds.Dy(), engine: e}
+	e.track(t, stageTextures)
+	return t, nil
+}
+
+// tightNRGBA returns the image's pixels as tightly packed RGBA rows, converting if needed
+func tightNRGBA(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	rgba, ok := img.(*image.NRGBA)
+	if !ok || rgba.Stride != bounds.Dx()*4 {
+		rgba = image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	}
+	return rgba
+}
+
+// LoadTexture decodes a PNG or JPEG file and uploads it as a texture. KTX2 files, e.g.
+// from CookTexture, are uploaded with their mips in their own format; BCn formats need a
+// GPU that supports them.
+func (e *Engine) LoadTexture(path string) (*Texture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, ktx2Identifier) {
+		return e.createKTX2Texture(data)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return e.CreateTexture(img)
+}
+
+func (e *Engine) createKTX2Texture(data []byte) (*Texture, error) {
+	defer lockThread()()
+	if !e.initialized {
+		return nil, errNotInitialized
+	}
+
+	format, width, height, levels, pixels, err := readKTX2(data)
+	if err != nil {
+		return nil, err
+	}
+	id := C.boulder_create_texture_levels(C.uint32_t(format), C.uint32_t(width), C.uint32_t(height),
+		C.uint32_t(levels), unsafe.Pointer(&pixels[0]), C.uint64_t(len(pixels)))
+	if id == 0 {
+		return nil, lastError("failed to create texture")
+	}
+
+	t := &Texture{ID: TextureID(id), Width: width, Height: height, engine: e}
+	e.track(t, stageTextures)
+	return t, nil
+}
+
+// Destroy frees the texture. Materials still using it sample white instead.
+func (t *Texture) Destroy() {
+	if t.engine == nil || !t.engine.initialized {
+		return
+	}
+
+	C.boulder_destroy_texture(C.TextureID(t.ID))
+	t.ID = 0
+	t.engine.untrack(t)
+}
+
+// CreateMaterialPipeline creates a pipeline for drawing models with a custom material. The
+// mesh shader gets the same inputs as the built-in model shader (set 0 and push
+// constants); set 1 holds the entity's parameter block at binding 0 and its textures at
+// binding 1.
+func (e *Engine) CreateMaterialPipeline(config PipelineConfig) (*Pipeline, error) {
+	defer lockThread()()
+	if !e.initialized {
+		return nil, errNotInitialized
+	}
+
+	if config.MeshShader == nil || config.FragShader == nil {
+		return nil, errors.New("both mesh and fragment shaders are required")
+	}
+
+	id := C.boulder_create_material_pipeline(
+		C.ShaderModuleID(config.MeshShader.ID),
+		C.ShaderModuleID(config.FragShader.ID),
+	)
+
+	if id == 0 {
+		return nil, lastError("failed to create material pipeline")
+	}
+
+	p := &Pipeline{
+		ID:         PipelineID(id),
+		MeshShader: config.MeshShader,
+		FragShader: config.FragShader,
+		engine:     e,
+	}
+	e.track(p, stagePipelines)
+	return p, nil
+}
+
+// SetCustomPipeline draws the entity's model with a pipeline from CreateMaterialPipeline.
+// nil restores the built-in model pipeline.
+func (e *Entity) SetCustomPipeline(pipeline *Pipeline) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	var id C.PipelineID
+	if pipeline != nil {
+		id = C.PipelineID(pipeline.ID)
+	}
+
+	if ret := C.boulder_set_model_pipeline(C.EntityID(e.ID), id); ret != 0 {
+		return lastError("failed to set custom pipeline")
+	}
+
+	return nil
+}
+
+// GetCustomPipeline returns the ID of the entity's material pipeline, or 0 if it draws with
+// the built-in model pipeline
+func (e *Entity) GetCustomPipeline() PipelineID {
+	if !e.world.ready() {
+		return 0
+	}
+	return PipelineID(C.boulder_get_model_pipeline(C.EntityID(e.ID)))
+}
+
+// SetMaterialParams sets the entity's parameter block ([]byte, []float32 or []int32, up to
+// MaterialMaxParams bytes). Lay it out to match the shader's std140 uniform block.
+func (e *Entity) SetMaterialParams(data interface{}) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	var ptr unsafe.Pointer
+	var size int
+
+	switch v := data.(type) {
+	case []byte:
+		if len(v) > 0 {
+			ptr = unsafe.Pointer(&v[0])
+		}
+		size = len(v)
+	case []float32:
+		if len(v) > 0 {
+			ptr = unsafe.Pointer(&v[0])
+		}
+		size = len(v) * 4
+	case []int32:
+		if len(v) > 0 {
+			ptr = unsafe.Pointer(&v[0])
+		}
+		size = len(v) * 4
+	default:
+		return errors.New("unsupported data type")
+	}
+
+	if size > MaterialMaxParams {
+		return errors.New("material parameters too large")
+	}
+
+	if ret := C.boulder_set_material_params(C.EntityID(e.ID), ptr, C.uint32_t(size)); ret != 0 {
+		return lastError("failed to set material parameters")
+	}
+
+	return nil
+}
+
+// SetMaterialTexture binds a texture to one of the entity's material slots. nil clears the
+// slot, which then samples white.
+func (e *Entity) SetMaterialTexture(slot int, texture *Texture) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+	if slot < 0 || slot >= MaterialMaxTextures {
+		return errors.New("invalid material texture slot")
+	}
+
+	var id C.TextureID
+	if texture != nil {
+		id = C.TextureID(texture.ID)
+	}
+
+	if ret := C.boulder_set_material_texture(C.EntityID(e.ID), C.uint32_t(slot), id); ret != 0 {
+		return lastError("failed to set material texture")
+	}
+
+	return nil
+}
+
+// SetBlendMode sets how the entity's model blends. Blended models test depth without
+// writing it and are drawn after opaque ones, back to front.
+func (e *Entity) SetBlendMode(mode BlendMode) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_set_blend_mode(C.EntityID(e.ID), C.int(mode)); ret != 0 {
+		return lastError("failed to set blend mode")
+	}
+
+	return nil
+}
+
+// GetBlendMode returns how the entity's model blends
+func (e *Entity) GetBlendMode() BlendMode {
+	if !e.world.ready() {
+		return BlendOpaque
+	}
+
+	mode := C.boulder_get_blend_mode(C.EntityID(e.ID))
+	if mode < 0 {
+		return BlendOpaque
+	}
+	return BlendMode(mode)
+}
+
+// SetRenderQueue sets the queue the entity's model draws in, e.g. RenderQueueTransparent+1
+// to draw after other translucent models. 0 picks the blend mode's queue.
+func (e *Entity) SetRenderQueue(queue int) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_set_render_queue(C.EntityID(e.ID), C.int(queue)); ret != 0 {
+		return lastError("failed to set render queue")
+	}
+
+	return nil
+}
+
+// GetRenderQueue returns the queue set with SetRenderQueue, 0 if the blend mode's is used
+func (e *Entity) GetRenderQueue() int {
+	if !e.world.ready() {
+		return 0
+	}
+	return max(0, int(C.boulder_get_render_queue(C.EntityID(e.ID))))
+}
+
+// DefineParam names a float in the parameter block of a material pipeline, at a byte offset
+// matching the shader's uniform block, so entities can set it with SetMaterialFloat
+func (p *Pipeline) DefineParam(name string, offset uint32) error {
+	if p.engine == nil || !p.engine.initialized {
+		return errNotInitialized
+	}
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	if ret := C.boulder_define_material_param(C.PipelineID(p.ID), cName, C.uint32_t(offset)); ret != 0 {
+		return errors.New("invalid material parameter " + name)
+	}
+
+	return nil
+}
+
+// SetMaterialFloat sets one named float of the entity's material, leaving the rest of its
+// parameter block as it is. The name must be defined on the entity's custom pipeline.
+func (e *Entity) SetMaterialFloat(name string, value float32) error {
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	if ret := C.boulder_set_material_float(C.EntityID(e.ID), cName, C.float(value)); ret != 0 {
+		return errors.New("no material parameter " + name)
+	}
+
+	return nil
+}
+
+// GetMaterialFloat returns one named float of the entity's material
+func (e *Entity) GetMaterialFloat(name string) (float32, bool) {
+	if !e.world.ready() {
+		return 0, false
+	}
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	var value C.float
+	if ret := C.boulder_get_material_float(C.EntityID(e.ID), cName, &value); ret != 0 {
+		return 0, false
+	}
+	return float32(value), true
+}
+
+// SetTint multiplies the color of the entity's model, e.g. red for a damage flash. Alpha
+// fades the model when it is blended. White restores it.
+func (e *Entity) SetTint(color UIColor) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_set_tint(C.EntityID(e.ID), C.float(color.R), C.float(color.G), C.float(color.B),
+		C.float(color.A)); ret != 0 {
+		return lastError("failed to set tint")
+	}
+
+	return nil
+}
+
+// GetTint returns the entity's tint (white when unset)
+func (e *Entity) GetTint() UIColor {
+	tint, _ := e.instanceColor()
+	return tint
+}
+
+// SetEmissive adds a glow of color times intensity to the entity's model. Zero intensity
+// turns it off.
+func (e *Entity) SetEmissive(color UIColor, intensity float32) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_set_emissive(C.EntityID(e.ID), C.float(color.R), C.float(color.G), C.float(color.B),
+		C.float(intensity)); ret != 0 {
+		return lastError("failed to set emissive")
+	}
+
+	return nil
+}
+
+// GetEmissive returns the emissive color added to the entity's model, intensity included
+func (e *Entity) GetEmissive() UIColor {
+	_, emissive := e.instanceColor()
+	return emissive
+}
+
+func (e *Entity) instanceColor() (tint, emissive UIColor) {
+	if !e.world.ready() {
+		return UIColorWhite, UIColor{}
+	}
+
+	var t [4]C.float
+	var em [3]C.float
+	if ret := C.boulder_get_instance_color(C.EntityID(e.ID), &t[0], &em[0]); ret != 0 {
+		return UIColorWhite, UIColor{}
+	}
+	return UIColor{float32(t[0]), float32(t[1]), float32(t[2]), float32(t[3])},
+		UIColor{float32(em[0]), float32(em[1]), float32(em[2]), 1}
+}
@@ -0,0 +1,153 @@
+package boulder
+
+import "math"
+
+// Quaternion represents a rotation as a unit quaternion
+type Quaternion struct {
+	X, Y, Z, W float32
+}
+
+// QuaternionIdentity is the rotation that does nothing
+var QuaternionIdentity = Quaternion{0, 0, 0, 1}
+
+// QuaternionFromEuler converts Euler angles in radians (applied X, then Y, then Z,
+// matching the renderer's model matrix) to a quaternion
+func QuaternionFromEuler(rotation Vector3) Quaternion {
+	cx, sx := math.Cos(float64(rotation.X)/2), math.Sin(float64(rotation.X)/2)
+	cy, sy := math.Cos(float64(rotation.Y)/2), math.Sin(float64(rotation.Y)/2)
+	cz, sz := math.Cos(float64(rotation.Z)/2), math.Sin(float64(rotation.Z)/2)
+
+	// q = qx * qy * qz
+	return Quaternion{
+		X: float32(sx*cy*cz + cx*sy*sz),
+		Y: float32(cx*sy*cz - sx*cy*sz),
+		Z: float32(cx*cy*sz + sx*sy*cz),
+		W: float32(cx*cy*cz - sx*sy*sz),
+	}
+}
+
+// QuaternionFromAxisAngle returns a rotation of angle radians around axis, counterclockwise
+// looking down the axis towards the origin. The axis doesn't need to be unit length.
+func QuaternionFromAxisAngle(axis Vector3, angle float32) Quaternion {
+	length := vectorLength(axis)
+	if length == 0 {
+		return QuaternionIdentity
+	}
+
+	s, c := math.Sincos(float64(angle) / 2)
+	k := float32(s) / length
+	return Quaternion{X: axis.X * k, Y: axis.Y * k, Z: axis.Z * k, W: float32(c)}
+}
+
+// ToEuler converts the quaternion back to Euler angles in radians (X, then Y, then Z)
+func (q Quaternion) ToEuler() Vector3 {
+	x, y, z, w := float64(q.X), float64(q.Y), float64(q.Z), float64(q.W)
+
+	// Rotation matrix element m02 = sin(y) for the X*Y*Z order
+	sy := 2 * (x*z + w*y)
+	if sy > 1 {
+		sy = 1
+	} else if sy < -1 {
+		sy = -1
+	}
+
+	ry := math.Asin(sy)
+	var rx, rz float64
+	if math.Abs(sy) < 0.9999 {
+		rx = math.Atan2(2*(w*x-y*z), 1-2*(x*x+y*y))
+		rz = math.Atan2(2*(w*z-x*y), 1-2*(y*y+z*z))
+	} else {
+		// Gimbal lock: fold all remaining rotation into X
+		rx = math.Atan2(2*(w*x+y*z), 1-2*(x*x+z*z))
+	}
+
+	return Vector3{X: float32(rx), Y: float32(ry), Z: float32(rz)}
+}
+
+// ToAxisAngle returns the axis (unit length) and angle in radians of the rotation. The
+// identity returns the X axis and 0.
+func (q Quaternion) ToAxisAngle() (axis Vector3, angle float32) {
+	q = q.Normalize()
+	if q.W < 0 {
+		q = Quaternion{-q.X, -q.Y, -q.Z, -q.W}
+	}
+
+	s := math.Sqrt(1 - float64(q.W)*float64(q.W))
+	if s < 1e-6 {
+		return Vector3{X: 1}, 0
+	}
+	return Vector3{X: q.X / float32(s), Y: q.Y / float32(s), Z: q.Z / float32(s)},
+		float32(2 * math.Acos(float64(q.W)))
+}
+
+// Normalize returns the quaternion scaled to unit length
+func (q Quaternion) Normalize() Quaternion {
+	length := float32(math.Sqrt(float64(q.X*q.X + q.Y*q.Y + q.Z*q.Z + q.W*q.W)))
+	if length == 0 {
+		return QuaternionIdentity
+	}
+	return Quaternion{q.X / length, q.Y / length, q.Z / length, q.W / length}
+}
+
+// Mul returns the rotation r followed by q, so q.Mul(r).Rotate(v) == q.Rotate(r.Rotate(v)).
+// Rotating an entity by a turn in its own frame is rotation.Mul(turn).
+func (q Quaternion) Mul(r Quaternion) Quaternion {
+	return Quaternion{
+		X: q.W*r.X + q.X*r.W + q.Y*r.Z - q.Z*r.Y,
+		Y: q.W*r.Y - q.X*r.Z + q.Y*r.W + q.Z*r.X,
+		Z: q.W*r.Z + q.X*r.Y - q.Y*r.X + q.Z*r.W,
+		W: q.W*r.W - q.X*r.X - q.Y*r.Y - q.Z*r.Z,
+	}
+}
+
+// Conjugate returns the opposite rotation of a unit quaternion
+func (q Quaternion) Conjugate() Quaternion {
+	return Quaternion{-q.X, -q.Y, -q.Z, q.W}
+}
+
+// Dot returns the dot product of two quaternions; its absolute value is 1 for the same
+// rotation and falls towards 0 as they turn apart
+func (q Quaternion) Dot(r Quaternion) float32 {
+	return q.X*r.X + q.Y*r.Y + q.Z*r.Z + q.W*r.W
+}
+
+// Rotate returns v rotated by the quaternion
+func (q Quaternion) Rotate(v Vector3) Vector3 {
+	// v + 2w(u x v) + 2u x (u x v), with u the vector part
+	tx := 2 * (q.Y*v.Z - q.Z*v.Y)
+	ty := 2 * (q.Z*v.X - q.X*v.Z)
+	tz := 2 * (q.X*v.Y - q.Y*v.X)
+	return Vector3{
+		X: v.X + q.W*tx + q.Y*tz - q.Z*ty,
+		Y: v.Y + q.W*ty + q.Z*tx - q.X*tz,
+		Z: v.Z + q.W*tz + q.X*ty - q.Y*tx,
+	}
+}
+
+// Slerp interpolates from a to b at a constant angular speed, t from 0 (a) to 1 (b),
+// taking the shorter way around
+func Slerp(a, b Quaternion, t float32) Quaternion {
+	cos := float64(a.Dot(b))
+	if cos < 0 {
+		b = Quaternion{-b.X, -b.Y, -b.Z, -b.W}
+		cos = -cos
+	}
+
+	// Nearly the same rotation: the arc is almost straight and sin(theta) is close to 0
+	var wa, wb float64
+	if cos > 0.9995 {
+		wa, wb = 1-float64(t), float64(t)
+	} else {
+		theta := math.Acos(cos)
+		sin := math.Sin(theta)
+		wa = math.Sin((1-float64(t))*theta) / sin
+		wb = math.Sin(float64(t)*theta) / sin
+	}
+
+	return Quaternion{
+		X: float32(wa*float64(a.X) + wb*float64(b.X)),
+		Y: float32(wa*float64(a.Y) + wb*float64(b.Y)),
+		Z: float32(wa*float64(a.Z) + wb*float64(b.Z)),
+		W: float32(wa*float64(a.W) + wb*float64(b.W)),
+	}.Normalize()
+}
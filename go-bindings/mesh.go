@@ -0,0 +1,96 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"unsafe"
+)
+
+// Vertex is a mesh vertex, laid out to match the engine's vertex storage buffer
+type Vertex struct {
+	Position Vector3
+	Normal   Vector3
+	U, V     float32
+}
+
+// Mesh is a mesh built at runtime and attached to an entity's model
+type Mesh struct {
+	entity      *Entity
+	index       int
+	vertexCount int
+	dynamic     bool
+}
+
+// CreateMesh builds a mesh from vertices and triangle indices and adds it to the entity's
+// model. Dynamic meshes can have their vertices changed every frame with UpdateVertices
+// (cloth proxies, debris, trail ribbons); static meshes are cheaper to draw.
+func (e *Entity) CreateMesh(vertices []Vertex, indices []uint32, dynamic bool) (*Mesh, error) {
+	defer lockThread()()
+	if !e.world.ready() {
+		return nil, errNotInitialized
+	}
+	if len(vertices) == 0 || len(indices) == 0 {
+		return nil, errors.New("mesh needs vertices and indices")
+	}
+	if len(indices)%3 != 0 {
+		return nil, errors.New("mesh indices must form triangles")
+	}
+
+	cDynamic := C.int(0)
+	if dynamic {
+		cDynamic = 1
+	}
+
+	index := int(C.boulder_create_mesh(C.EntityID(e.ID),
+		unsafe.Pointer(&vertices[0]), C.uint32_t(len(vertices)),
+		(*C.uint32_t)(unsafe.Pointer(&indices[0])), C.uint32_t(len(indices)), cDynamic))
+	if index < 0 {
+		return nil, lastError("failed to create mesh")
+	}
+
+	return &Mesh{entity: e, index: index, vertexCount: len(vertices), dynamic: dynamic}, nil
+}
+
+// UpdateVertices replaces vertices starting at offset. The change is picked up by each
+// frame in flight when it is next recorded, so it is safe to call while frames are still
+// being drawn. Only dynamic meshes can be updated.
+func (m *Mesh) UpdateVertices(offset int, vertices []Vertex) error {
+	defer lockThread()()
+	if !m.entity.world.ready() {
+		return errNotInitialized
+	}
+	if !m.dynamic {
+		return errors.New("mesh is not dynamic")
+	}
+	if offset < 0 || offset+len(vertices) > m.vertexCount {
+		return errors.New("vertex range out of bounds")
+	}
+	if len(vertices) == 0 {
+		return nil
+	}
+
+	if ret := C.boulder_update_mesh_vertices(C.EntityID(m.entity.ID), C.int(m.index),
+		C.uint32_t(offset), unsafe.Pointer(&vertices[0]), C.uint32_t(len(vertices))); ret != 0 {
+		return lastError("failed to update mesh vertices")
+	}
+
+	return nil
+}
+
+// GetVertexCount returns the number of vertices in the mesh
+func (m *Mesh) GetVertexCount() int {
+	return m.vertexCount
+}
+
+// GetIndex returns the mesh's position within its entity's model
+func (m *Mesh) GetIndex() int {
+	return m.index
+}
+
+// IsDynamic returns true if the mesh's vertices can be updated
+func (m *Mesh) IsDynamic() bool {
+	return m.dynamic
+}
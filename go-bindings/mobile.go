@@ -0,0 +1,62 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+
+// AppEvent is a change in the app's lifecycle, sent on Android and iOS
+type AppEvent int
+
+const (
+	AppWillPause   AppEvent = 0 // About to go to the background; save progress now
+	AppPaused      AppEvent = 1 // In the background; frames are skipped until AppResumed
+	AppWillResume  AppEvent = 2
+	AppResumed     AppEvent = 3
+	AppLowMemory   AppEvent = 4 // Free caches, or the system may kill the app
+	AppTerminating AppEvent = 5 // The system is closing the app; ShouldClose returns true
+)
+
+// String returns a readable name for the event
+func (e AppEvent) String() string {
+	switch e {
+	case AppWillPause:
+		return "will pause"
+	case AppPaused:
+		return "paused"
+	case AppWillResume:
+		return "will resume"
+	case AppResumed:
+		return "resumed"
+	case AppLowMemory:
+		return "low memory"
+	case AppTerminating:
+		return "terminating"
+	default:
+		return "unknown"
+	}
+}
+
+// OnAppEvent registers a callback for lifecycle events, run by Window.PollEvents. While the
+// app is paused Render skips frames and BeginFrame returns an error; on Android the window
+// surface is released and created again on resume, with nothing to do on your side.
+func (e *Engine) OnAppEvent(callback func(event AppEvent)) {
+	e.appCallbacks = append(e.appCallbacks, callback)
+}
+
+// IsPaused returns whether the app is in the background
+func (e *Engine) IsPaused() bool {
+	if !e.initialized {
+		return false
+	}
+	return C.boulder_is_paused() != 0
+}
+
+func (e *Engine) dispatchAppEvents() {
+	var event C.int
+	for C.boulder_poll_app_event(&event) != 0 {
+		for _, callback := range e.appCallbacks {
+			runCallback("OnAppEvent", func() { callback(AppEvent(event)) })
+		}
+	}
+}
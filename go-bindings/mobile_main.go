@@ -0,0 +1,27 @@
+//go:build android || ios
+
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+
+var mobileMain func()
+
+// SetMobileMain sets the function run as the app's main on Android and iOS, where SDL
+// starts the app and calls SDL_main instead of the Go program's main. Call it from an init
+// function of a program built with -buildmode=c-shared (Android) or c-archive (iOS).
+func SetMobileMain(main func()) {
+	mobileMain = main
+}
+
+//export SDL_main
+func SDL_main(argc C.int, argv **C.char) C.int {
+	if mobileMain == nil {
+		LogError("No mobile main set; call boulder.SetMobileMain from an init function")
+		return 1
+	}
+	mobileMain()
+	return 0
+}
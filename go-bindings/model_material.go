@@ -0,0 +1,313 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// Texture slots of a Material
+const (
+	MaterialSlotAlbedo            = 0
+	MaterialSlotNormal            = 1
+	MaterialSlotMetallicRoughness = 2 // Roughness in green, metallic in blue
+	MaterialSlotEmissive          = 3
+)
+
+// Material is a metallic-roughness surface, the kind glTF files describe. It fills the
+// parameter block and texture slots in the layout examples/shaders/pbr.frag reads, so it
+// shows with a pipeline made from that shader (see SetDefaultMaterialPipeline).
+type Material struct {
+	BaseColor   UIColor   // Multiplies the albedo texture
+	Emissive    UIColor   // Multiplies the emissive texture; alpha is unused
+	Metallic    float32   // Multiplies the texture's metallic channel
+	Roughness   float32   // Multiplies the texture's roughness channel
+	NormalScale float32   // Strength of the normal map
+	AlphaCutoff float32   // Alpha below which BlendAlphaTest discards
+	AlphaMode   BlendMode // Blend mode a model file asks for; it takes effect through SetBlendMode
+
+	// nil slots sample white
+	Albedo            *Texture
+	Normal            *Texture
+	MetallicRoughness *Texture
+	EmissiveMap       *Texture
+}
+
+// DefaultMaterial returns a white, fully rough, non-metallic material without textures
+func DefaultMaterial() Material {
+	return Material{
+		BaseColor:   UIColorWhite,
+		Roughness:   1,
+		NormalScale: 1,
+		AlphaCutoff: 0.5,
+	}
+}
+
+// ModelMaterial is a material of the file an entity's model was loaded from
+type ModelMaterial struct {
+	Name     string
+	Material Material // As the file has it, with the textures LoadModel loaded for it
+
+	// Texture files by slot: relative to the model file, "*N" for embedded texture N, or
+	// empty when the slot has none
+	TexturePaths [MaterialMaxTextures]string
+}
+
+// SetDefaultMaterialPipeline sets the material pipeline for entities that have a material
+// but no pipeline of their own, models with materials from their file included. nil draws
+// them with the built-in model pipeline again.
+func (e *Engine) SetDefaultMaterialPipeline(pipeline *Pipeline) error {
+	defer lockThread()()
+	if !e.initialized {
+		return errNotInitialized
+	}
+
+	var id C.PipelineID
+	if pipeline != nil {
+		id = C.PipelineID(pipeline.ID)
+	}
+
+	if ret := C.boulder_set_default_material_pipeline(id); ret != 0 {
+		return lastError("failed to set default material pipeline")
+	}
+
+	return nil
+}
+
+// GetDefaultMaterialPipeline returns the ID of the default material pipeline, 0 if there is none
+func (e *Engine) GetDefaultMaterialPipeline() PipelineID {
+	if !e.initialized {
+		return 0
+	}
+	return PipelineID(C.boulder_get_default_material_pipeline())
+}
+
+// SetMaterial gives the entity's whole model one material, replacing the materials from
+// its file. It overrides the parameter block and textures set with SetMaterialParams and
+// SetMaterialTexture.
+func (e *Entity) SetMaterial(material Material) error {
+	return e.setModelMaterial(-1, material)
+}
+
+// SetModelMaterial overrides one material of the entity's model file (by its index in
+// GetModelMaterials) on this entity only, e.g. to recolor one part of a character
+func (e *Entity) SetModelMaterial(index int, material Material) error {
+	if index < 0 {
+		return errors.New("invalid model material index")
+	}
+	return e.setModelMaterial(index, material)
+}
+
+func (e *Entity) setModelMaterial(index int, material Material) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	values := material.native()
+	var textures [MaterialMaxTextures]C.TextureID
+	for slot, texture := range material.textures() {
+		if texture != nil {
+			textures[slot] = C.TextureID(texture.ID)
+		}
+	}
+
+	if ret := C.boulder_set_model_material(C.EntityID(e.ID), C.int(index), &values, &textures[0]); ret != 0 {
+		return lastError("failed to set material")
+	}
+
+	return nil
+}
+
+// GetModelMaterials returns the materials of the entity's model file, in file order
+func (e *Entity) GetModelMaterials() []ModelMaterial {
+	if !e.world.ready() {
+		return nil
+	}
+
+	count := int(C.boulder_get_model_material_count(C.EntityID(e.ID)))
+	materials := make([]ModelMaterial, 0, max(0, count))
+	for i := 0; i < count; i++ {
+		var values C.StandardMaterial
+		var name [256]C.char
+		if C.boulder_get_model_material(C.EntityID(e.ID), C.int(i), &values, &name[0], C.uint32_t(len(name))) != 0 {
+			continue
+		}
+
+		m := ModelMaterial{Name: C.GoString(&name[0]), Material: materialFromNative(values)}
+		for slot := range m.TexturePaths {
+			var path [1024]C.char
+			if C.boulder_get_model_material_texture(C.EntityID(e.ID), C.int(i), C.int(slot), &path[0], C.uint32_t(len(path))) == 0 {
+				m.TexturePaths[slot] = C.GoString(&path[0])
+			}
+		}
+		m.Material.setTextures(e.world.engine.modelTexturesFor(m.TexturePaths, e.modelPath()))
+		materials = append(materials, m)
+	}
+	return materials
+}
+
+// native converts the material's values for boulder_set_model_material
+func (m Material) native() C.StandardMaterial {
+	var values C.StandardMaterial
+	values.baseColor = [4]C.float{C.float(m.BaseColor.R), C.float(m.BaseColor.G), C.float(m.BaseColor.B), C.float(m.BaseColor.A)}
+	values.emissive = [3]C.float{C.float(m.Emissive.R), C.float(m.Emissive.G), C.float(m.Emissive.B)}
+	values.metallic = C.float(m.Metallic)
+	values.roughness = C.float(m.Roughness)
+	values.normalScale = C.float(m.NormalScale)
+	values.alphaCutoff = C.float(m.AlphaCutoff)
+	values.alphaMode = C.int(m.AlphaMode)
+	return values
+}
+
+func materialFromNative(values C.StandardMaterial) Material {
+	return Material{
+		BaseColor:   UIColor{float32(values.baseColor[0]), float32(values.baseColor[1]), float32(values.baseColor[2]), float32(values.baseColor[3])},
+		Emissive:    UIColor{float32(values.emissive[0]), float32(values.emissive[1]), float32(values.emissive[2]), 1},
+		Metallic:    float32(values.metallic),
+		Roughness:   float32(values.roughness),
+		NormalScale: float32(values.normalScale),
+		AlphaCutoff: float32(values.alphaCutoff),
+		AlphaMode:   BlendMode(values.alphaMode),
+	}
+}
+
+// textures returns the material's textures by slot
+func (m Material) textures() [MaterialMaxTextures]*Texture {
+	return [MaterialMaxTextures]*Texture{m.Albedo, m.Normal, m.MetallicRoughness, m.EmissiveMap}
+}
+
+func (m *Material) setTextures(textures [MaterialMaxTextures]*Texture) {
+	m.Albedo = textures[MaterialSlotAlbedo]
+	m.Normal = textures[MaterialSlotNormal]
+	m.MetallicRoughness = textures[MaterialSlotMetallicRoughness]
+	m.EmissiveMap = textures[MaterialSlotEmissive]
+}
+
+// modelPath returns the path the entity's model was loaded from
+func (e *Entity) modelPath() string {
+	var path [1024]C.char
+	if C.boulder_get_model_path(C.EntityID(e.ID), &path[0], C.uint32_t(len(path))) != 0 {
+		return ""
+	}
+	return C.GoString(&path[0])
+}
+
+// loadModelTextures loads the textures the materials of the entity's model file reference
+// and binds them to its materials. Textures are shared by every model loaded from the same
+// file; ones that fail to load are logged and left white.
+func (e *Entity) loadModelTextures() {
+	modelPath := e.modelPath()
+	for i, m := range e.GetModelMaterials() {
+		textures := m.Material.textures()
+		for slot, path := range m.TexturePaths {
+			if path == "" || textures[slot] != nil {
+				continue
+			}
+			texture, err := e.world.engine.loadModelTexture(e, path, modelPath)
+			if err != nil {
+				LogError(fmt.Sprintf("Failed to load texture %s of %s: %v", path, modelPath, err))
+				continue
+			}
+			textures[slot] = texture
+		}
+
+		// The entity's materials start out untextured, even when the textures were cached
+		if textures == [MaterialMaxTextures]*Texture{} {
+			continue
+		}
+		m.Material.setTextures(textures)
+		if err := e.SetModelMaterial(i, m.Material); err != nil {
+			LogError(fmt.Sprintf("Failed to set material %s of %s: %v", m.Name, modelPath, err))
+		}
+	}
+}
+
+// modelTextureKey is what a texture of a model file is cached by
+func modelTextureKey(path, modelPath string) string {
+	if strings.HasPrefix(path, "*") {
+		return modelPath + path
+	}
+	return filepath.Join(filepath.Dir(modelPath), path)
+}
+
+// modelTexturesFor returns the cached textures for a material's texture paths
+func (e *Engine) modelTexturesFor(paths [MaterialMaxTextures]string, modelPath string) [MaterialMaxTextures]*Texture {
+	var textures [MaterialMaxTextures]*Texture
+	for slot, path := range paths {
+		if path == "" {
+			continue
+		}
+		if texture := e.modelTextures[modelTextureKey(path, modelPath)]; texture != nil && texture.ID != 0 {
+			textures[slot] = texture
+		}
+	}
+	return textures
+}
+
+// loadModelTexture returns a texture of a model file, loading it the first time
+func (e *Engine) loadModelTexture(entity *Entity, path, modelPath string) (*Texture, error) {
+	key := modelTextureKey(path, modelPath)
+	if texture := e.modelTextures[key]; texture != nil && texture.ID != 0 {
+		return texture, nil
+	}
+
+	var texture *Texture
+	var err error
+	if strings.HasPrefix(path, "*") {
+		texture, err = e.loadEmbeddedTexture(entity, path[1:])
+	} else {
+		texture, err = e.LoadTexture(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if e.modelTextures == nil {
+		e.modelTextures = make(map[string]*Texture)
+	}
+	e.modelTextures[key] = texture
+	return texture, nil
+}
+
+// loadEmbeddedTexture decodes and uploads a texture embedded in the entity's model file
+func (e *Engine) loadEmbeddedTexture(entity *Entity, index string) (*Texture, error) {
+	n, err := strconv.Atoi(index)
+	if err != nil {
+		return nil, errors.New("invalid embedded texture " + index)
+	}
+
+	var width, height C.uint32_t
+	size := int(C.boulder_get_model_embedded_texture(C.EntityID(entity.ID), C.int(n), nil, 0, &width, &height))
+	if size <= 0 {
+		return nil, errors.New("no embedded texture " + index)
+	}
+	data := make([]byte, size)
+	C.boulder_get_model_embedded_texture(C.EntityID(entity.ID), C.int(n), unsafe.Pointer(&data[0]), C.uint32_t(size), &width, &height)
+
+	if width == 0 {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return e.CreateTexture(img)
+	}
+
+	if size != int(width)*int(height)*4 {
+		return nil, errors.New("embedded texture " + index + " has the wrong size")
+	}
+	return e.CreateTexture(&image.NRGBA{
+		Pix:    data,
+		Stride: int(width) * 4,
+		Rect:   image.Rect(0, 0, int(width), int(height)),
+	})
+}
@@ -0,0 +1,166 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"math"
+)
+
+// MotionSource is where gyro and accelerometer readings come from
+type MotionSource int
+
+const (
+	MotionNone       MotionSource = 0
+	MotionDevice     MotionSource = 1 // The phone, tablet or handheld itself (Steam Deck)
+	MotionController MotionSource = 2 // A controller with a gyro (DualSense, Switch Pro, ...)
+)
+
+// EnableMotion turns the motion sensors on or off. While on, Window.PollEvents collects
+// readings from a connected controller that has a gyro, or else from the device's own
+// sensors; a controller takes over while it is connected.
+func (i *Input) EnableMotion(enabled bool) error {
+	defer lockThread()()
+	if !i.engine.initialized {
+		return errNotInitialized
+	}
+
+	cEnabled := C.int(0)
+	if enabled {
+		cEnabled = 1
+	}
+	return apiError(C.boulder_enable_motion(cEnabled), "failed to enable motion sensors")
+}
+
+// GetMotionSource returns where the readings come from, MotionNone if there is no sensor
+func (i *Input) GetMotionSource() MotionSource {
+	if !i.engine.initialized {
+		return MotionNone
+	}
+	return MotionSource(C.boulder_get_motion_source())
+}
+
+// GetGyro returns the latest angular velocity in radians per second around each axis,
+// with the calibrated bias removed. Axes follow SDL: X points right (pitch), Y up (yaw)
+// and Z towards the player (roll).
+func (i *Input) GetGyro() Vector3 {
+	if !i.engine.initialized {
+		return Vector3{}
+	}
+
+	var x, y, z C.float
+	C.boulder_get_gyro(&x, &y, &z)
+	return Vector3{float32(x), float32(y), float32(z)}
+}
+
+// GetAccel returns the latest acceleration in m/s², including gravity, on the same axes
+// as GetGyro
+func (i *Input) GetAccel() Vector3 {
+	if !i.engine.initialized {
+		return Vector3{}
+	}
+
+	var x, y, z C.float
+	C.boulder_get_accel(&x, &y, &z)
+	return Vector3{float32(x), float32(y), float32(z)}
+}
+
+// TakeGyroDelta returns the rotation in radians since the last call, integrated from
+// every gyro sample rather than the one GetGyro shows, and the seconds it covers
+func (i *Input) TakeGyroDelta() (rotation Vector3, elapsed float32) {
+	if !i.engine.initialized {
+		return Vector3{}, 0
+	}
+
+	var x, y, z, cElapsed C.float
+	C.boulder_take_gyro_delta(&x, &y, &z, &cElapsed)
+	return Vector3{float32(x), float32(y), float32(z)}, float32(cElapsed)
+}
+
+// StartGyroCalibration starts averaging the gyro to find its bias, the rotation it reports
+// while still. Ask the player to put the controller or device down, keep polling events
+// for a second or so and call FinishGyroCalibration.
+func (i *Input) StartGyroCalibration() {
+	if !i.engine.initialized {
+		return
+	}
+	C.boulder_start_gyro_calibration()
+}
+
+// FinishGyroCalibration stores the averaged bias, which is removed from every reading
+// from then on
+func (i *Input) FinishGyroCalibration() error {
+	if !i.engine.initialized {
+		return errNotInitialized
+	}
+	if C.boulder_finish_gyro_calibration() != 0 {
+		return errors.New("no gyro samples during calibration")
+	}
+	return nil
+}
+
+// GetGyroBias returns the calibrated bias, e.g. to save it with the settings
+func (i *Input) GetGyroBias() Vector3 {
+	if !i.engine.initialized {
+		return Vector3{}
+	}
+
+	var x, y, z C.float
+	C.boulder_get_gyro_bias(&x, &y, &z)
+	return Vector3{float32(x), float32(y), float32(z)}
+}
+
+// SetGyroBias restores a bias from an earlier calibration
+func (i *Input) SetGyroBias(bias Vector3) {
+	if !i.engine.initialized {
+		return
+	}
+	C.boulder_set_gyro_bias(C.float(bias.X), C.float(bias.Y), C.float(bias.Z))
+}
+
+// GyroAim turns rotating the controller or device into camera yaw and pitch, for aiming
+// on top of the sticks or touch controls
+type GyroAim struct {
+	Sensitivity float32 // Camera radians per radian the controller turns
+	Tightening  float32 // Turns slower than this (radians per second) are scaled down to hide hand tremor
+	InvertPitch bool
+	UseRoll     bool // Also yaw when the controller rolls, for players who tilt rather than turn it
+}
+
+// NewGyroAim returns a GyroAim with a sensitivity of 2 and a little tightening
+func NewGyroAim() *GyroAim {
+	return &GyroAim{Sensitivity: 2, Tightening: 0.05}
+}
+
+// Update returns how far to turn the camera since the last call, in radians: positive yaw
+// turns right and positive pitch looks up. Call it once a frame after Window.PollEvents;
+// it consumes Input.TakeGyroDelta.
+func (a *GyroAim) Update(input *Input) (yaw, pitch float32) {
+	rotation, elapsed := input.TakeGyroDelta()
+	if elapsed <= 0 {
+		return 0, 0
+	}
+
+	// Turning left is a positive rotation around Y (and rolling left around Z)
+	yaw = -rotation.Y
+	if a.UseRoll {
+		yaw -= rotation.Z
+	}
+	pitch = rotation.X
+
+	if a.Tightening > 0 {
+		speed := float32(math.Hypot(float64(yaw), float64(pitch))) / elapsed
+		if speed < a.Tightening {
+			scale := speed / a.Tightening
+			yaw *= scale
+			pitch *= scale
+		}
+	}
+
+	if a.InvertPitch {
+		pitch = -pitch
+	}
+	return yaw * a.Sensitivity, pitch * a.Sensitivity
+}
@@ -0,0 +1,355 @@
+package boulder
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ViolationKind is what a movement check caught
+type ViolationKind int
+
+const (
+	ViolationSpeed        ViolationKind = 0 // Moved faster than MaxSpeed or MaxVerticalSpeed
+	ViolationTeleport     ViolationKind = 1 // Moved farther than TeleportDistance in one update
+	ViolationResimulation ViolationKind = 2 // Reported a state the server's resimulation of its inputs doesn't reach
+	ViolationClock        ViolationKind = 3 // Sent inputs covering more time than has passed (a speed hack)
+)
+
+// String returns a readable name for the kind
+func (k ViolationKind) String() string {
+	switch k {
+	case ViolationSpeed:
+		return "speed"
+	case ViolationTeleport:
+		return "teleport"
+	case ViolationResimulation:
+		return "resimulation"
+	case ViolationClock:
+		return "clock"
+	default:
+		return "unknown"
+	}
+}
+
+// ViolationSeverity is how far past a limit a violation went
+type ViolationSeverity int
+
+const (
+	SeverityLow    ViolationSeverity = 0 // Barely over; lag and jitter do this too
+	SeverityMedium ViolationSeverity = 1
+	SeverityHigh   ViolationSeverity = 2 // Not possible without cheating or a bug
+)
+
+// String returns a readable name for the severity
+func (s ViolationSeverity) String() string {
+	switch s {
+	case SeverityLow:
+		return "low"
+	case SeverityMedium:
+		return "medium"
+	case SeverityHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+// Suspicion a violation adds, by severity; it drains at MovementConfig.SuspicionDecay
+var violationWeights = [...]float32{SeverityLow: 1, SeverityMedium: 3, SeverityHigh: 10}
+
+// MovementState is where a moving entity is and how fast it goes
+type MovementState struct {
+	Position Vector3
+	Velocity Vector3
+}
+
+// MovementFunc is the game's character movement: the state after applying one input for
+// deltaTime. The server reruns it on the inputs clients send, so it must be the same code
+// clients predict with and must not depend on anything but its arguments and the world.
+type MovementFunc func(entity EntityID, state MovementState, input []byte, deltaTime float32) MovementState
+
+// Violation is a movement check an entity failed
+type Violation struct {
+	Entity     EntityID
+	Connection ConnectionHandle // Of the player moving it
+	Kind       ViolationKind
+	Severity   ViolationSeverity
+	Reported   MovementState // What the client claimed
+	Expected   MovementState // What the server allows; the entity was corrected to it when Corrected
+	Amount     float32       // How far over the limit, as a multiple of it (1 is at the limit)
+	Corrected  bool
+	Suspicion  float32 // The entity's suspicion after this violation
+}
+
+// ViolationCallback is called for every violation
+type ViolationCallback func(v Violation)
+
+// MovementConfig sets the limits a MovementValidator enforces
+type MovementConfig struct {
+	MaxSpeed          float32       // Horizontal units per second
+	MaxVerticalSpeed  float32       // Up or down; 0 doesn't check it
+	SpeedTolerance    float32       // Fraction over the limits allowed for jitter; 0 is 0.15
+	TeleportDistance  float32       // Farthest a single update may move; 0 is a second at MaxSpeed
+	PositionTolerance float32       // Distance a reported state may be from the resimulated one; 0 is 0.25
+	MaxClockAhead     time.Duration // Input time a client may get ahead of real time; 0 is 250ms
+	CorrectFrom       ViolationSeverity
+	SuspicionDecay    float32 // Suspicion drained per second; 0 is 1
+}
+
+// DefaultMovementConfig returns limits for characters running at up to maxSpeed, corrected
+// from medium violations on
+func DefaultMovementConfig(maxSpeed float32) MovementConfig {
+	return MovementConfig{
+		MaxSpeed:          maxSpeed,
+		SpeedTolerance:    0.15,
+		TeleportDistance:  maxSpeed,
+		PositionTolerance: 0.25,
+		MaxClockAhead:     250 * time.Millisecond,
+		CorrectFrom:       SeverityMedium,
+		SuspicionDecay:    1,
+	}
+}
+
+func (c MovementConfig) withDefaults() MovementConfig {
+	defaults := DefaultMovementConfig(c.MaxSpeed)
+	if c.SpeedTolerance <= 0 {
+		c.SpeedTolerance = defaults.SpeedTolerance
+	}
+	if c.TeleportDistance <= 0 {
+		c.TeleportDistance = defaults.TeleportDistance
+	}
+	if c.PositionTolerance <= 0 {
+		c.PositionTolerance = defaults.PositionTolerance
+	}
+	if c.MaxClockAhead <= 0 {
+		c.MaxClockAhead = defaults.MaxClockAhead
+	}
+	if c.SuspicionDecay <= 0 {
+		c.SuspicionDecay = defaults.SuspicionDecay
+	}
+	return c
+}
+
+// movementTrack is the server's view of one moving entity
+type movementTrack struct {
+	conn          ConnectionHandle
+	state         MovementState // Last accepted
+	allowTeleport bool
+	started       time.Time
+	inputTime     time.Duration // Covered by the inputs applied since started
+	suspicion     float32
+	suspicionAt   time.Time
+}
+
+// MovementValidator checks the movement clients report for the entities they control.
+// Servers either take reported positions and check them against speed and teleport limits
+// (CheckMove), or rerun the inputs clients send with the game's own movement code and
+// compare (ApplyInput), which also catches clients sending more input than time allows.
+// Each violation raises the entity's suspicion, which drains over time, so games can
+// tell a player with a bad connection from one who keeps cheating.
+type MovementValidator struct {
+	config    MovementConfig
+	move      MovementFunc
+	tracks    map[EntityID]*movementTrack
+	callbacks []ViolationCallback
+}
+
+// NewMovementValidator creates a validator. move may be nil when only CheckMove is used.
+func NewMovementValidator(config MovementConfig, move MovementFunc) *MovementValidator {
+	return &MovementValidator{
+		config: config.withDefaults(),
+		move:   move,
+		tracks: make(map[EntityID]*movementTrack),
+	}
+}
+
+// OnViolation registers a callback for violations
+func (mv *MovementValidator) OnViolation(callback ViolationCallback) {
+	mv.callbacks = append(mv.callbacks, callback)
+}
+
+// Track starts validating an entity a connection moves, from an authoritative state
+func (mv *MovementValidator) Track(entity EntityID, conn ConnectionHandle, state MovementState) {
+	now := time.Now()
+	mv.tracks[entity] = &movementTrack{conn: conn, state: state, started: now, suspicionAt: now}
+}
+
+// Untrack stops validating an entity
+func (mv *MovementValidator) Untrack(entity EntityID) {
+	delete(mv.tracks, entity)
+}
+
+// SetState moves an entity on the server's authority, e.g. a respawn or a teleporter, so
+// the jump isn't taken for a violation
+func (mv *MovementValidator) SetState(entity EntityID, state MovementState) {
+	if t, ok := mv.tracks[entity]; ok {
+		t.state = state
+	}
+}
+
+// AllowTeleport accepts the entity's next reported move whatever its distance
+func (mv *MovementValidator) AllowTeleport(entity EntityID) {
+	if t, ok := mv.tracks[entity]; ok {
+		t.allowTeleport = true
+	}
+}
+
+// GetState returns the last state the validator accepted for an entity
+func (mv *MovementValidator) GetState(entity EntityID) (MovementState, bool) {
+	t, ok := mv.tracks[entity]
+	if !ok {
+		return MovementState{}, false
+	}
+	return t.state, true
+}
+
+// GetSuspicion returns an entity's suspicion: the weights of its violations (1 low, 3
+// medium, 10 high), drained over time
+func (mv *MovementValidator) GetSuspicion(entity EntityID) float32 {
+	t, ok := mv.tracks[entity]
+	if !ok {
+		return 0
+	}
+	mv.decay(t)
+	return t.suspicion
+}
+
+// CheckMove validates a move the client reports after deltaTime seconds and returns the
+// state the server accepts: the reported one, or a correction when the move broke a limit
+// by CorrectFrom or more. Untracked entities are tracked from the reported state.
+func (mv *MovementValidator) CheckMove(entity EntityID, conn ConnectionHandle, reported MovementState, deltaTime float32) MovementState {
+	t, ok := mv.tracks[entity]
+	if !ok {
+		mv.Track(entity, conn, reported)
+		return reported
+	}
+	if t.allowTeleport {
+		t.allowTeleport = false
+		t.state = reported
+		return reported
+	}
+
+	from := t.state.Position
+	delta := Vector3{reported.Position.X - from.X, reported.Position.Y - from.Y, reported.Position.Z - from.Z}
+	distance := vectorLength(delta)
+	tolerance := 1 + mv.config.SpeedTolerance
+
+	if distance > mv.config.TeleportDistance {
+		return mv.violate(t, entity, ViolationTeleport, SeverityHigh, distance/mv.config.TeleportDistance, reported, t.state)
+	}
+
+	if deltaTime > 0 && mv.config.MaxSpeed > 0 {
+		horizontal := float32(math.Hypot(float64(delta.X), float64(delta.Z))) / deltaTime
+		if amount := horizontal / (mv.config.MaxSpeed * tolerance); amount > 1 {
+			// Allowed as far as the limit along the way it went
+			expected := reported
+			expected.Position = lerpVector(from, reported.Position, 1/amount)
+			expected.Velocity = Vector3{}
+			return mv.violate(t, entity, ViolationSpeed, severityFor(amount), amount, reported, expected)
+		}
+	}
+	if deltaTime > 0 && mv.config.MaxVerticalSpeed > 0 {
+		vertical := float32(math.Abs(float64(delta.Y))) / deltaTime
+		if amount := vertical / (mv.config.MaxVerticalSpeed * tolerance); amount > 1 {
+			expected := reported
+			expected.Position.Y = from.Y + delta.Y/amount
+			expected.Velocity.Y = 0
+			return mv.violate(t, entity, ViolationSpeed, severityFor(amount), amount, reported, expected)
+		}
+	}
+
+	t.state = reported
+	return reported
+}
+
+// ApplyInput reruns one of the client's inputs covering deltaTime with the movement
+// function and returns the authoritative state. If the client reported where the input took
+// it, the two are compared. Inputs that would put the client's clock ahead of real time by
+// more than MaxClockAhead are dropped.
+func (mv *MovementValidator) ApplyInput(entity EntityID, input []byte, deltaTime float32, reported *MovementState) MovementState {
+	t, ok := mv.tracks[entity]
+	if !ok || mv.move == nil {
+		if reported != nil {
+			return *reported
+		}
+		return MovementState{}
+	}
+
+	// Inputs may arrive late in bursts, but never cover more time than has passed. Time
+	// not used while lagging can't be banked for later either.
+	elapsed := time.Since(t.started)
+	inputTime := t.inputTime + time.Duration(float64(deltaTime)*float64(time.Second))
+	if ahead := inputTime - elapsed; ahead > mv.config.MaxClockAhead {
+		amount := float32(ahead) / float32(mv.config.MaxClockAhead)
+		got := t.state
+		if reported != nil {
+			got = *reported
+		}
+		return mv.violate(t, entity, ViolationClock, severityFor(amount), amount, got, t.state)
+	}
+	t.inputTime = max(inputTime, elapsed-time.Second)
+
+	expected := mv.move(entity, t.state, input, deltaTime)
+	t.state = expected
+	if reported == nil {
+		return expected
+	}
+
+	diff := Vector3{reported.Position.X - expected.Position.X, reported.Position.Y - expected.Position.Y, reported.Position.Z - expected.Position.Z}
+	if amount := vectorLength(diff) / mv.config.PositionTolerance; amount > 1 {
+		return mv.violate(t, entity, ViolationResimulation, severityFor(amount), amount, *reported, expected)
+	}
+	return expected
+}
+
+// violate records a violation and returns the state to accept: expected if it is to be
+// corrected, reported otherwise
+func (mv *MovementValidator) violate(t *movementTrack, entity EntityID, kind ViolationKind, severity ViolationSeverity, amount float32, reported, expected MovementState) MovementState {
+	mv.decay(t)
+	t.suspicion += violationWeights[severity]
+
+	v := Violation{
+		Entity:     entity,
+		Connection: t.conn,
+		Kind:       kind,
+		Severity:   severity,
+		Reported:   reported,
+		Expected:   expected,
+		Amount:     amount,
+		Corrected:  severity >= mv.config.CorrectFrom,
+		Suspicion:  t.suspicion,
+	}
+	if severity == SeverityHigh {
+		LogInfo(fmt.Sprintf("Movement violation by entity %d on connection %d: %v x%.1f", entity, t.conn, kind, amount))
+	}
+	for _, callback := range mv.callbacks {
+		callback(v)
+	}
+
+	if v.Corrected {
+		t.state = expected
+	} else {
+		t.state = reported
+	}
+	return t.state
+}
+
+// decay drains an entity's suspicion for the time since it last did
+func (mv *MovementValidator) decay(t *movementTrack) {
+	now := time.Now()
+	t.suspicion = max(0, t.suspicion-float32(now.Sub(t.suspicionAt).Seconds())*mv.config.SuspicionDecay)
+	t.suspicionAt = now
+}
+
+// severityFor grades how many times over a limit something went
+func severityFor(amount float32) ViolationSeverity {
+	switch {
+	case amount >= 3:
+		return SeverityHigh
+	case amount >= 1.5:
+		return SeverityMedium
+	default:
+		return SeverityLow
+	}
+}
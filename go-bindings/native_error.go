@@ -0,0 +1,186 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// ErrorCode is the kind of reason a call failed
+type ErrorCode int
+
+const (
+	ErrorUnknown         ErrorCode = 0 // The engine recorded no reason
+	ErrorNotInitialized  ErrorCode = 1 // The engine, window, renderer or session isn't set up
+	ErrorInvalidArgument ErrorCode = 2
+	ErrorNotFound        ErrorCode = 3  // No such entity, component, animation or resource
+	ErrorFile            ErrorCode = 4  // A missing or unreadable file
+	ErrorInvalidData     ErrorCode = 5  // Truncated or corrupt data, e.g. a snapshot or voxel chunk
+	ErrorUnsupported     ErrorCode = 6  // The GPU, display or driver can't do it
+	ErrorVulkan          ErrorCode = 7  // A Vulkan call failed
+	ErrorShader          ErrorCode = 8  // Shader compilation; the message has the compiler's output
+	ErrorPlatform        ErrorCode = 9  // SDL: windows, displays, input devices
+	ErrorNetwork         ErrorCode = 10 // GameNetworkingSockets or Steam
+	ErrorAPIMisuse       ErrorCode = 11 // A call made at the wrong time; see Engine.SetDebugMode
+	ErrorNativeException ErrorCode = 12 // A C++ exception; see LastNativeError
+)
+
+// String returns a readable name for the code
+func (c ErrorCode) String() string {
+	switch c {
+	case ErrorUnknown:
+		return "unknown"
+	case ErrorNotInitialized:
+		return "not initialized"
+	case ErrorInvalidArgument:
+		return "invalid argument"
+	case ErrorNotFound:
+		return "not found"
+	case ErrorFile:
+		return "file"
+	case ErrorInvalidData:
+		return "invalid data"
+	case ErrorUnsupported:
+		return "unsupported"
+	case ErrorVulkan:
+		return "vulkan"
+	case ErrorShader:
+		return "shader"
+	case ErrorPlatform:
+		return "platform"
+	case ErrorNetwork:
+		return "network"
+	case ErrorAPIMisuse:
+		return "api misuse"
+	case ErrorNativeException:
+		return "native exception"
+	default:
+		return "unknown"
+	}
+}
+
+// Error is a failed engine call: what was being done and the engine's reason, e.g.
+// "failed to create window: No available video device"
+type Error struct {
+	Code    ErrorCode
+	Op      string // What failed, e.g. "failed to load model"
+	Message string // The engine's reason; empty if it recorded none
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Message == "":
+		return e.Op
+	case e.Op == "":
+		return e.Message
+	case len(e.Message) >= len(e.Op) && strings.EqualFold(e.Message[:len(e.Op)], e.Op):
+		return e.Op + e.Message[len(e.Op):] // The engine's message already says what failed
+	default:
+		return e.Op + ": " + e.Message
+	}
+}
+
+// Is matches another *Error with the same code, so errors.Is(err, &Error{Code: ErrorFile})
+// tells a missing file from other failures
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && t.Op == "" && t.Message == ""
+}
+
+// ErrorCodeOf returns the code of an *Error in err's chain, ErrorUnknown if there is none
+func ErrorCodeOf(err error) ErrorCode {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ErrorUnknown
+}
+
+var (
+	errNotInitialized        = &Error{Code: ErrorNotInitialized, Op: "engine not initialized"}
+	errSessionNotInitialized = &Error{Code: ErrorNotInitialized, Op: "session not initialized"}
+)
+
+// lastError returns the error for an engine call that just failed doing op, with the reason
+// the engine recorded. The engine records it on the OS thread the call ran on, so call it
+// straight after the failed call, in a function that started with defer lockThread()().
+func lastError(op string) *Error {
+	buf := make([]C.char, C.boulder_get_last_error_length()+1)
+	code := C.boulder_get_last_error(&buf[0], C.uint32_t(len(buf)))
+	return &Error{Code: ErrorCode(code), Op: op, Message: C.GoString(&buf[0])}
+}
+
+// lockThread keeps the goroutine on its OS thread until the returned function is called,
+// so a failed engine call and lastError run on the same thread
+func lockThread() func() {
+	runtime.LockOSThread()
+	return runtime.UnlockOSThread
+}
+
+// LastNativeError returns and clears the last C++ exception the engine caught, or nil.
+// The call that hit it failed the same way as with bad arguments, so check this when an
+// error (or a zero ID) is not explained by what was passed in.
+func LastNativeError() error {
+	if message := takeNativeError(); message != "" {
+		return &Error{Code: ErrorNativeException, Message: "native exception in " + message}
+	}
+	return nil
+}
+
+func takeNativeError() string {
+	var buf [1024]C.char
+	length := C.boulder_take_native_error(&buf[0], C.uint32_t(len(buf)))
+	if length == 0 {
+		return ""
+	}
+	return C.GoStringN(&buf[0], C.int(min(int(length), len(buf)-1)))
+}
+
+// CallbackPanicHandler is told about a panic recovered from a callback the engine ran,
+// with the callback's name and the goroutine's stack at the panic
+type CallbackPanicHandler func(callback string, recovered any, stack []byte)
+
+var (
+	panicHandlerMu sync.Mutex
+	panicHandler   CallbackPanicHandler
+)
+
+// SetCallbackPanicHandler replaces how panics in callbacks (OnImpact, OnComponentAdded,
+// OnReady and the like) are reported. By default they are logged with their stack; either
+// way the panic is recovered and the engine carries on with the next callback. Pass nil to
+// go back to logging.
+func SetCallbackPanicHandler(handler CallbackPanicHandler) {
+	panicHandlerMu.Lock()
+	panicHandler = handler
+	panicHandlerMu.Unlock()
+}
+
+// runCallback calls fn, recovering and reporting a panic instead of letting it unwind
+// through the engine's update
+func runCallback(name string, fn func()) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			reportCallbackPanic(name, recovered, debug.Stack())
+		}
+	}()
+	fn()
+}
+
+func reportCallbackPanic(name string, recovered any, stack []byte) {
+	panicHandlerMu.Lock()
+	handler := panicHandler
+	panicHandlerMu.Unlock()
+
+	if handler != nil {
+		handler(name, recovered, stack)
+		return
+	}
+	LogError(fmt.Sprintf("panic in %s callback: %v\n%s", name, recovered, stack))
+}
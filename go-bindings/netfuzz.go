@@ -0,0 +1,170 @@
+//go:build boulder_netfuzz
+
+package boulder
+
+// Network fuzzing, built with -tags boulder_netfuzz so release builds can't turn it on.
+// A fuzzer sits between the transport and PollEvent and rewrites each received message,
+// so parsers and the replication layer can be hammered with corrupted, truncated and
+// duplicated packets from a Go test or fuzz target.
+
+// PacketFuzzer rewrites a message on its way into a session. It returns the messages to
+// deliver in its place: the message itself, changed copies, several of them or none.
+type PacketFuzzer func(conn ConnectionHandle, data []byte) [][]byte
+
+// packetFuzzState is the fuzzer and the messages it produced that PollEvent hasn't
+// returned yet, kept out of NetworkSession so normal builds don't carry it
+type packetFuzzState struct {
+	fuzzer PacketFuzzer
+	queue  []fuzzedMessage
+}
+
+type fuzzedMessage struct {
+	conn      ConnectionHandle
+	channel   int
+	data      []byte
+	timestamp float64
+}
+
+var packetFuzz = make(map[*NetworkSession]*packetFuzzState)
+
+func (ns *NetworkSession) packetFuzzState() *packetFuzzState {
+	state, ok := packetFuzz[ns]
+	if !ok {
+		state = &packetFuzzState{}
+		packetFuzz[ns] = state
+	}
+	return state
+}
+
+// SetPacketFuzzer passes every message the session receives through fuzzer before
+// PollEvent handles it; nil stops fuzzing
+func (ns *NetworkSession) SetPacketFuzzer(fuzzer PacketFuzzer) {
+	if fuzzer == nil {
+		if state, ok := packetFuzz[ns]; ok && len(state.queue) == 0 {
+			delete(packetFuzz, ns)
+		} else if ok {
+			state.fuzzer = nil
+		}
+		return
+	}
+	ns.packetFuzzState().fuzzer = fuzzer
+}
+
+// InjectPacket queues data as if it had just arrived from conn, e.g. an input from a Go
+// fuzz target. It isn't passed through the fuzzer.
+func (ns *NetworkSession) InjectPacket(conn ConnectionHandle, data []byte) {
+	state := ns.packetFuzzState()
+	state.queue = append(state.queue, fuzzedMessage{
+		conn:      conn,
+		data:      append([]byte(nil), data...),
+		timestamp: localNetworkTime(),
+	})
+}
+
+// receiveEvent returns injected and fuzzed messages first, then the transport's events
+func (ns *NetworkSession) receiveEvent() (NetworkEventType, ConnectionHandle, int, []byte, float64, bool) {
+	state, ok := packetFuzz[ns]
+	if !ok {
+		return ns.nextEvent()
+	}
+
+	for len(state.queue) == 0 {
+		kind, conn, channel, data, timestamp, ok := ns.nextEvent()
+		if !ok || kind != NetworkEventMessage || state.fuzzer == nil {
+			return kind, conn, channel, data, timestamp, ok
+		}
+
+		var messages [][]byte
+		runCallback("PacketFuzzer", func() { messages = state.fuzzer(conn, data) })
+		for _, message := range messages {
+			state.queue = append(state.queue, fuzzedMessage{conn: conn, channel: channel, data: message, timestamp: timestamp})
+		}
+	}
+
+	m := state.queue[0]
+	state.queue = state.queue[1:]
+	return NetworkEventMessage, m.conn, m.channel, m.data, m.timestamp, true
+}
+
+// forgetPacketFuzz drops a destroyed session's fuzzer
+func (ns *NetworkSession) forgetPacketFuzz() {
+	delete(packetFuzz, ns)
+}
+
+// PacketFuzzConfig sets how often RandomPacketFuzzer damages messages. Each rate is the
+// chance, from 0 to 1, that it happens to a message; several can happen to one.
+type PacketFuzzConfig struct {
+	Seed          uint64 // The same seed damages the same messages the same way
+	DropRate      float64
+	TruncateRate  float64 // Cut to a random shorter length, possibly empty
+	CorruptRate   float64 // Random bytes changed
+	DuplicateRate float64 // Delivered twice
+	MaxCorrupt    int     // Most bytes changed in one message; 0 is 4
+	// Filter picks the messages to fuzz, e.g. isolating one message type; nil fuzzes all
+	Filter func(conn ConnectionHandle, data []byte) bool
+}
+
+// PacketFuzzStats counts what RandomPacketFuzzer did
+type PacketFuzzStats struct {
+	Received   int
+	Dropped    int
+	Truncated  int
+	Corrupted  int
+	Duplicated int
+}
+
+// RandomPacketFuzzer damages messages at random, reproducibly from its seed:
+//
+//	fuzzer := boulder.NewRandomPacketFuzzer(boulder.PacketFuzzConfig{Seed: 1, CorruptRate: 0.1, TruncateRate: 0.05})
+//	session.SetPacketFuzzer(fuzzer.Fuzz)
+type RandomPacketFuzzer struct {
+	config PacketFuzzConfig
+	rng    *RNGStream
+	stats  PacketFuzzStats
+}
+
+// NewRandomPacketFuzzer creates a fuzzer from config
+func NewRandomPacketFuzzer(config PacketFuzzConfig) *RandomPacketFuzzer {
+	if config.MaxCorrupt <= 0 {
+		config.MaxCorrupt = 4
+	}
+	return &RandomPacketFuzzer{
+		config: config,
+		rng:    NewRNG(config.Seed).Stream("netfuzz"),
+	}
+}
+
+// Fuzz implements PacketFuzzer
+func (f *RandomPacketFuzzer) Fuzz(conn ConnectionHandle, data []byte) [][]byte {
+	f.stats.Received++
+	if f.config.Filter != nil && !f.config.Filter(conn, data) {
+		return [][]byte{data}
+	}
+
+	if f.rng.Chance(f.config.DropRate) {
+		f.stats.Dropped++
+		return nil
+	}
+	if len(data) > 0 && f.rng.Chance(f.config.TruncateRate) {
+		data = data[:f.rng.Intn(len(data))]
+		f.stats.Truncated++
+	}
+	if len(data) > 0 && f.rng.Chance(f.config.CorruptRate) {
+		data = append([]byte(nil), data...)
+		for n := f.rng.Range(1, f.config.MaxCorrupt); n > 0; n-- {
+			// XOR with a non-zero byte always changes it
+			data[f.rng.Intn(len(data))] ^= byte(f.rng.Range(1, 255))
+		}
+		f.stats.Corrupted++
+	}
+	if f.rng.Chance(f.config.DuplicateRate) {
+		f.stats.Duplicated++
+		return [][]byte{data, append([]byte(nil), data...)}
+	}
+	return [][]byte{data}
+}
+
+// GetStats returns what the fuzzer has done so far
+func (f *RandomPacketFuzzer) GetStats() PacketFuzzStats {
+	return f.stats
+}
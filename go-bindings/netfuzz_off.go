@@ -0,0 +1,11 @@
+//go:build !boulder_netfuzz
+
+package boulder
+
+// receiveEvent returns the transport's next event. Builds with -tags boulder_netfuzz can
+// fuzz messages here (see netfuzz.go).
+func (ns *NetworkSession) receiveEvent() (NetworkEventType, ConnectionHandle, int, []byte, float64, bool) {
+	return ns.nextEvent()
+}
+
+func (ns *NetworkSession) forgetPacketFuzz() {}
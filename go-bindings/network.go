@@ -1,7 +1,6 @@
 package boulder
 
 // #cgo CFLAGS: -I..
-// #cgo LDFLAGS: -L../build -lboulder_shared -Wl,-rpath,${SRCDIR}/../build
 // #include <stdlib.h>
 // #include "../boulder_cgo.h"
 import "C"
@@ -48,7 +47,10 @@ func (e DisconnectedEvent) Type() NetworkEventType { return NetworkEventDisconne
 // MessageEvent is fired when a message is received
 type MessageEvent struct {
 	Connection ConnectionHandle
+	Channel    int // See SetChannels; 0 for SendMessage
 	Data       []byte
+	Timestamp  float64 // Local receive time in seconds (see GetLocalTime)
+	ServerTime float64 // Receive time converted to server time (see GetServerTime)
 }
 
 func (e MessageEvent) Type() NetworkEventType { return NetworkEventMessage }
@@ -69,12 +71,29 @@ const (
 const (
 	SendUnreliable = 0
 	SendReliable   = 1
+	SendNoNagle    = 2 // Send now instead of batching with later messages
+	SendNoDelay    = 4 // Drop an unreliable message that can't be sent right away
 )
 
 // NetworkSession manages network connections (client or server)
 type NetworkSession struct {
 	handle C.NetworkSession
 	engine *Engine
+	clock  *clockSync
+
+	replication         *ReplicationServer
+	controlHandlers     map[controlType]controlHandler
+	connectionObservers []connectionObserver
+	transports          map[ConnectionHandle]Transport
+	outgoing            map[ConnectionHandle]bool // Connections this session opened to a server
+	plugins             *transportPlugins
+	channels            *channelState
+	backpressure        *backpressureState // Set by SetBackpressurePolicy
+	keepAlive           *keepAliveState    // Set by SetKeepAlivePolicy
+	reconnect           *reconnectState    // Set by EnableAutoReconnect and EnableSessionResume
+	drain               *drainState        // Set by BeginDrain, or a server's drain notice
+	players             *playerState       // Set by EnablePlayerRegistry and SetPlayerIdentity
+	spectators          *spectatorState    // Set by SetSpectatePolicy and Spectate
 }
 
 // Global relay configuration functions (call before creating sessions)
@@ -100,26 +119,33 @@ func EnableFakeIP() {
 
 // NewNetworkSession creates a new network session
 func NewNetworkSession(engine *Engine) (*NetworkSession, error) {
+	defer lockThread()()
 	if !engine.initialized {
-		return nil, errors.New("engine not initialized")
+		return nil, errNotInitialized
 	}
 
 	handle := C.boulder_create_network_session()
 	if handle == nil {
-		return nil, errors.New("failed to create network session")
+		return nil, lastError("failed to create network session")
 	}
 
-	return &NetworkSession{
+	ns := &NetworkSession{
 		handle: handle,
 		engine: engine,
-	}, nil
+		clock:  newClockSync(),
+	}
+	engine.track(ns, stageSessions)
+	return ns, nil
 }
 
 // Destroy cleans up the network session
 func (ns *NetworkSession) Destroy() {
 	if ns.handle != nil {
+		ns.closePlugins()
+		ns.forgetPacketFuzz()
 		C.boulder_destroy_network_session(ns.handle)
 		ns.handle = nil
+		ns.engine.untrack(ns)
 	}
 }
 
@@ -127,18 +153,25 @@ func (ns *NetworkSession) Destroy() {
 func (ns *NetworkSession) Update() {
 	if ns.handle != nil {
 		C.boulder_network_update(ns.handle)
+		ns.updatePlugins()
+		ns.clock.update(ns)
+		ns.updateKeepAlive()
+		ns.updateReconnect()
+		ns.updateDrain()
+		ns.updatePlayers()
 	}
 }
 
 // StartServer starts listening for connections on the specified port
 func (ns *NetworkSession) StartServer(port uint16) error {
+	defer lockThread()()
 	if ns.handle == nil {
-		return errors.New("session not initialized")
+		return errSessionNotInitialized
 	}
 
 	result := C.boulder_start_server(ns.handle, C.uint16_t(port))
 	if result != 0 {
-		return errors.New("failed to start server")
+		return lastError("failed to start server")
 	}
 
 	return nil
@@ -146,13 +179,14 @@ func (ns *NetworkSession) StartServer(port uint16) error {
 
 // StartServerP2P starts a P2P server on a virtual port
 func (ns *NetworkSession) StartServerP2P(virtualPort int) error {
+	defer lockThread()()
 	if ns.handle == nil {
-		return errors.New("session not initialized")
+		return errSessionNotInitialized
 	}
 
 	result := C.boulder_start_server_p2p(ns.handle, C.int(virtualPort))
 	if result != 0 {
-		return errors.New("failed to start P2P server")
+		return lastError("failed to start P2P server")
 	}
 
 	return nil
@@ -167,8 +201,9 @@ func (ns *NetworkSession) StopServer() {
 
 // Connect initiates a connection to a remote address
 func (ns *NetworkSession) Connect(address string, port uint16) (ConnectionHandle, error) {
+	defer lockThread()()
 	if ns.handle == nil {
-		return 0, errors.New("session not initialized")
+		return 0, errSessionNotInitialized
 	}
 
 	cAddr := C.CString(address)
@@ -176,29 +211,68 @@ func (ns *NetworkSession) Connect(address string, port uint16) (ConnectionHandle
 
 	handle := C.boulder_connect(ns.handle, cAddr, C.uint16_t(port))
 	if handle == 0 {
-		return 0, errors.New("failed to connect")
+		return 0, lastError("failed to connect")
 	}
 
+	ns.markOutgoing(ConnectionHandle(handle))
+	ns.rememberTarget(ConnectionHandle(handle), reconnectTarget{address: address, port: port})
 	return ConnectionHandle(handle), nil
 }
 
 // ConnectP2P initiates a P2P connection to a Steam user
 func (ns *NetworkSession) ConnectP2P(steamID SteamID, virtualPort int) (ConnectionHandle, error) {
+	defer lockThread()()
 	if ns.handle == nil {
-		return 0, errors.New("session not initialized")
+		return 0, errSessionNotInitialized
 	}
 
 	handle := C.boulder_connect_p2p(ns.handle, C.SteamID(steamID), C.int(virtualPort))
 	if handle == 0 {
-		return 0, errors.New("failed to connect P2P")
+		return 0, lastError("failed to connect P2P")
 	}
 
+	ns.markOutgoing(ConnectionHandle(handle))
+	ns.rememberTarget(ConnectionHandle(handle), reconnectTarget{steamID: steamID, virtualPort: virtualPort})
 	return ConnectionHandle(handle), nil
 }
 
 // Disconnect closes a connection
 func (ns *NetworkSession) Disconnect(conn ConnectionHandle) {
-	if ns.handle != nil {
+	if ns.handle == nil {
+		return
+	}
+
+	ns.closeTransport(conn)
+	ns.forgetConnection(conn)
+}
+
+// markOutgoing records a connection the session opened as a client, as opposed to one a
+// listening session accepted
+func (ns *NetworkSession) markOutgoing(conn ConnectionHandle) {
+	if ns.outgoing == nil {
+		ns.outgoing = make(map[ConnectionHandle]bool)
+	}
+	ns.outgoing[conn] = true
+}
+
+// forgetConnection drops the session's state for a connection it closed
+func (ns *NetworkSession) forgetConnection(conn ConnectionHandle) {
+	delete(ns.transports, conn)
+	delete(ns.outgoing, conn)
+	ns.forgetChannels(conn)
+	ns.forgetBackpressure(conn)
+	ns.forgetKeepAlive(conn)
+	ns.forgetReconnect(conn)
+	ns.drainDropped(conn)
+}
+
+// closeTransport closes a connection in the native session or its transport plugin,
+// without a DisconnectedEvent
+func (ns *NetworkSession) closeTransport(conn ConnectionHandle) {
+	if pc, ok := ns.lookupPlugin(conn); ok {
+		pc.plugin.Disconnect(pc.conn)
+		ns.plugins.remove(conn)
+	} else {
 		C.boulder_disconnect(ns.handle, C.ConnectionHandle(conn))
 	}
 }
@@ -226,6 +300,10 @@ func (ns *NetworkSession) ConnectionState(conn ConnectionHandle) ConnectionState
 		return ConnectionStateNone
 	}
 
+	if pc, ok := ns.lookupPlugin(conn); ok {
+		return pc.plugin.State(pc.conn)
+	}
+
 	state := C.boulder_connection_state(ns.handle, C.ConnectionHandle(conn))
 	return ConnectionState(state)
 }
@@ -233,13 +311,34 @@ func (ns *NetworkSession) ConnectionState(conn ConnectionHandle) ConnectionState
 // SendMessage sends data to a connection
 func (ns *NetworkSession) SendMessage(conn ConnectionHandle, data []byte, reliable bool) error {
 	if ns.handle == nil {
-		return errors.New("session not initialized")
+		return errSessionNotInitialized
 	}
 
 	if len(data) == 0 {
 		return errors.New("empty data")
 	}
 
+	if isControlMessage(data) {
+		return errors.New("message starts with the reserved control marker")
+	}
+	if held, err := ns.holdForReconnect(conn, data, reliable); held {
+		return err
+	}
+	if send, err := ns.admit(conn, reliable); !send {
+		return err
+	}
+
+	return ns.sendRaw(conn, data, reliable)
+}
+
+// sendRaw sends data to a connection without validating its contents
+func (ns *NetworkSession) sendRaw(conn ConnectionHandle, data []byte, reliable bool) error {
+	defer lockThread()()
+	ns.noteSent(conn)
+	if pc, ok := ns.lookupPlugin(conn); ok {
+		return pc.plugin.Send(pc.conn, data, reliable)
+	}
+
 	flags := SendUnreliable
 	if reliable {
 		flags = SendReliable
@@ -254,7 +353,7 @@ func (ns *NetworkSession) SendMessage(conn ConnectionHandle, data []byte, reliab
 	)
 
 	if result != 0 {
-		return errors.New("failed to send message")
+		return lastError("failed to send message")
 	}
 
 	return nil
@@ -276,38 +375,124 @@ func (ns *NetworkSession) PollEvent() NetworkEvent {
 		return nil
 	}
 
-	var event C.NetworkEvent
-	result := C.boulder_poll_network_event(ns.handle, &event)
-
-	if result == 0 || event._type == 0 {
-		return nil
+	if event := ns.takeBackpressureEvent(); event != nil {
+		return event
+	}
+	if event := ns.takeDrainEvent(); event != nil {
+		return event
 	}
 
-	switch NetworkEventType(event._type) {
-	case NetworkEventConnected:
-		return ConnectedEvent{
-			Connection: ConnectionHandle(event.connection),
+	for {
+		if event := ns.takeReconnectEvent(); event != nil {
+			return event
+		}
+		if event := ns.takePlayerEvent(); event != nil {
+			return event
+		}
+		if event := ns.takeSpectatorEvent(); event != nil {
+			return event
 		}
 
-	case NetworkEventDisconnected:
-		return DisconnectedEvent{
-			Connection: ConnectionHandle(event.connection),
+		kind, connection, channel, data, timestamp, ok := ns.sessionEvent()
+		if !ok {
+			return nil
 		}
 
-	case NetworkEventMessage:
+		switch kind {
+		case NetworkEventMessage:
+			ns.noteReceived(connection)
+			if ns.dropSpectatorInput(connection, data) {
+				continue
+			}
+			// Control messages are handled internally and never reach the game, except
+			// for the sequenced channel messages they wrap
+			if isControlMessage(data) {
+				if control, payload := decodeControl(data); control == controlSequenced {
+					if message, ok := ns.receiveSequenced(connection, payload, timestamp); ok {
+						return message
+					}
+					continue
+				}
+				ns.handleControl(connection, data, timestamp)
+				continue
+			}
+
+			return MessageEvent{
+				Connection: connection,
+				Channel:    channel,
+				Data:       data,
+				Timestamp:  timestamp,
+				ServerTime: ns.ToServerTime(timestamp),
+			}
+
+		case NetworkEventConnected:
+			if ns.refuseWhileDraining(connection) {
+				continue
+			}
+			connected := ConnectedEvent{
+				Connection: connection,
+			}
+			ns.notifyConnectionObservers(connected)
+			ns.startKeepAlive(connection)
+			if event, replaced := ns.reconnectConnected(connection); replaced {
+				if event == nil {
+					continue
+				}
+				return event
+			}
+			return connected
+
+		case NetworkEventDisconnected:
+			disconnected := DisconnectedEvent{
+				Connection: connection,
+			}
+			ns.notifyConnectionObservers(disconnected)
+			delete(ns.transports, connection)
+			delete(ns.outgoing, connection)
+			ns.forgetChannels(connection)
+			ns.forgetBackpressure(connection)
+			ns.forgetKeepAlive(connection)
+			ns.drainDropped(connection)
+			if ns.plugins != nil {
+				ns.plugins.remove(connection)
+			}
+			if event, replaced := ns.reconnectDropped(connection); replaced {
+				return event
+			}
+			return disconnected
+		}
+	}
+}
+
+// sessionEvent returns the next raw event, connections dropped for silence first
+func (ns *NetworkSession) sessionEvent() (NetworkEventType, ConnectionHandle, int, []byte, float64, bool) {
+	if conn, ok := ns.takeTimedOut(); ok {
+		return NetworkEventDisconnected, conn, 0, nil, localNetworkTime(), true
+	}
+	return ns.receiveEvent()
+}
+
+// nextEvent returns the next raw event from the native session or a transport plugin,
+// with the channel of a message
+func (ns *NetworkSession) nextEvent() (NetworkEventType, ConnectionHandle, int, []byte, float64, bool) {
+	var event C.NetworkEvent
+	result := C.boulder_poll_network_event(ns.handle, &event)
+
+	if result == 0 || event._type == 0 {
+		kind, connection, data, ok := ns.pollPlugins()
+		return kind, connection, 0, data, localNetworkTime(), ok
+	}
+
+	var data []byte
+	if NetworkEventType(event._type) == NetworkEventMessage {
 		// Copy the data
-		data := C.GoBytes(unsafe.Pointer(event.data), C.int(event.dataSize))
+		data = C.GoBytes(unsafe.Pointer(event.data), C.int(event.dataSize))
 		// Free the C-allocated data
 		C.boulder_free_network_event_data(unsafe.Pointer(event.data))
-
-		return MessageEvent{
-			Connection: ConnectionHandle(event.connection),
-			Data:       data,
-		}
-
-	default:
-		return nil
 	}
+
+	timestamp := float64(event.timestamp) / 1e6
+	return NetworkEventType(event._type), ConnectionHandle(event.connection), int(event.channel), data, timestamp, true
 }
 
 // PollEvents retrieves all pending network events
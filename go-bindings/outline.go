@@ -0,0 +1,37 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import "errors"
+
+// SetOutline draws an outline thickness pixels wide around the entity's model, over
+// everything in front of it, e.g. to highlight a selection. Zero thickness removes it.
+func (e *Entity) SetOutline(color UIColor, thickness float32) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+	if thickness < 0 {
+		return errors.New("outline thickness must not be negative")
+	}
+
+	if ret := C.boulder_set_outline(C.EntityID(e.ID), C.float(color.R), C.float(color.G), C.float(color.B),
+		C.float(color.A), C.float(thickness)); ret != 0 {
+		return lastError("failed to set outline")
+	}
+
+	return nil
+}
+
+// RemoveOutline removes the entity's outline
+func (e *Entity) RemoveOutline() error {
+	return e.SetOutline(UIColor{}, 0)
+}
+
+// OutlinesSupported returns true if outlines can be drawn. They need a stencil buffer and
+// the shaders/outline.mesh and shaders/outline.frag files.
+func (r *Renderer) OutlinesSupported() bool {
+	return C.boulder_outlines_supported() != 0
+}
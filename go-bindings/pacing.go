@@ -0,0 +1,159 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"time"
+)
+
+// MaxFramesInFlight is the most frames the renderer can queue at once
+const MaxFramesInFlight = 3
+
+// PresentMode is how finished frames are shown
+type PresentMode int
+
+const (
+	PresentImmediate   PresentMode = 0 // Uncapped, may tear (the default)
+	PresentMailbox     PresentMode = 1 // Uncapped, the newest frame is shown at each refresh
+	PresentFIFO        PresentMode = 2 // Vsync
+	PresentFIFORelaxed PresentMode = 3 // Vsync, but late frames tear instead of waiting
+)
+
+// PresentStats describes how frames reached the screen
+type PresentStats struct {
+	Latency         time.Duration // End of the previous frame to this one on screen
+	AverageLatency  time.Duration // Smoothed over recent frames
+	RefreshRate     float32       // Of the window's display
+	FramesPresented uint64
+	FramesDropped   uint64 // Display refreshes that showed an old frame again
+	PresentMode     PresentMode
+	FramesInFlight  int
+	LowLatency      bool
+	PresentWait     bool // Latency is measured to the screen; otherwise to when the GPU finished
+}
+
+// SetFramesInFlight sets how many frames the CPU may queue ahead of the GPU, from 1 to
+// MaxFramesInFlight (the default). Fewer frames cut latency but leave the GPU idle more
+// often. Changing it waits for the GPU to go idle.
+func (r *Renderer) SetFramesInFlight(count int) error {
+	defer lockThread()()
+	if count < 1 || count > MaxFramesInFlight {
+		return errors.New("invalid frames in flight")
+	}
+	if ret := C.boulder_set_frames_in_flight(C.uint32_t(count)); ret != 0 {
+		return lastError("failed to set frames in flight")
+	}
+	return nil
+}
+
+// GetFramesInFlight returns how many frames the CPU may queue ahead of the GPU
+func (r *Renderer) GetFramesInFlight() int {
+	return int(C.boulder_get_frames_in_flight())
+}
+
+// SetPresentMode picks how frames are shown. Modes the display doesn't support fall back
+// to PresentFIFO. The swapchain is recreated at the next BeginFrame.
+func (r *Renderer) SetPresentMode(mode PresentMode) error {
+	if ret := C.boulder_set_present_mode(C.int(mode)); ret != 0 {
+		return errors.New("invalid present mode")
+	}
+	return nil
+}
+
+// GetPresentMode returns the present mode in use
+func (r *Renderer) GetPresentMode() PresentMode {
+	return PresentMode(C.boulder_get_present_mode())
+}
+
+// SetLowLatency makes EndFrame wait until the frame is on screen, so the next frame starts
+// from the newest input instead of queueing behind older frames. Costs some frame rate.
+func (r *Renderer) SetLowLatency(enabled bool) {
+	cEnabled := C.int(0)
+	if enabled {
+		cEnabled = 1
+	}
+	C.boulder_set_low_latency(cEnabled)
+}
+
+// GetLowLatency returns whether low latency mode is on
+func (r *Renderer) GetLowLatency() bool {
+	return C.boulder_get_low_latency() != 0
+}
+
+// GetPresentStats returns frame latency and dropped frame counts
+func (r *Renderer) GetPresentStats() PresentStats {
+	var s C.PresentStats
+	C.boulder_get_present_stats(&s)
+
+	return PresentStats{
+		Latency:         time.Duration(float64(s.latencyMs) * float64(time.Millisecond)),
+		AverageLatency:  time.Duration(float64(s.averageLatencyMs) * float64(time.Millisecond)),
+		RefreshRate:     float32(s.refreshRate),
+		FramesPresented: uint64(s.framesPresented),
+		FramesDropped:   uint64(s.framesDropped),
+		PresentMode:     PresentMode(s.presentMode),
+		FramesInFlight:  int(s.framesInFlight),
+		LowLatency:      s.lowLatency != 0,
+		PresentWait:     s.presentWait != 0,
+	}
+}
+
+// ResetPresentStats zeroes the frame counts, e.g. after a loading screen
+func (r *Renderer) ResetPresentStats() {
+	C.boulder_reset_present_stats()
+}
+
+// FrameTimes is how long the last frame took
+type FrameTimes struct {
+	CPU                time.Duration // Excluding waits for the GPU
+	GPU                time.Duration // From GPU timestamps, a few frames late
+	GPUTimingSupported bool          // Without GPU timestamps GPU is 0
+}
+
+// GetFrameTimes returns the CPU and GPU time of the last frame
+func (r *Renderer) GetFrameTimes() FrameTimes {
+	var t C.FrameTimes
+	C.boulder_get_frame_times(&t)
+
+	return FrameTimes{
+		CPU:                time.Duration(float64(t.cpuMs) * float64(time.Millisecond)),
+		GPU:                time.Duration(float64(t.gpuMs) * float64(time.Millisecond)),
+		GPUTimingSupported: t.gpuTimingSupported != 0,
+	}
+}
+
+// RenderStats is what the last frame drew and the GPU memory the engine holds
+type RenderStats struct {
+	DrawCalls         int
+	Triangles         uint64
+	DeviceMemory      uint64 // Bytes allocated by the engine, not counting the driver's own
+	DeviceAllocations int
+}
+
+// GetRenderStats returns the draw calls and triangles of the last frame and the engine's
+// GPU memory
+func (r *Renderer) GetRenderStats() RenderStats {
+	var s C.RenderStats
+	C.boulder_get_render_stats(&s)
+
+	return RenderStats{
+		DrawCalls:         int(s.drawCalls),
+		Triangles:         uint64(s.triangles),
+		DeviceMemory:      uint64(s.deviceMemoryBytes),
+		DeviceAllocations: int(s.deviceAllocations),
+	}
+}
+
+// SetLODBias adds bias to every model's LOD when drawing, e.g. 1 draws models one LOD
+// coarser. Models are clamped to their full mesh and their smallest LOD.
+func (r *Renderer) SetLODBias(bias int) {
+	C.boulder_set_lod_bias(C.int(bias))
+}
+
+// GetLODBias returns the LOD bias set by SetLODBias
+func (r *Renderer) GetLODBias() int {
+	return int(C.boulder_get_lod_bias())
+}
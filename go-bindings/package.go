@@ -0,0 +1,435 @@
+package boulder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// PackageManifestVersion is the manifest format written by Package
+const PackageManifestVersion = 1
+
+// PackageConfig describes what Package cooks and where it writes the result
+type PackageConfig struct {
+	Root         string   // Directory asset paths are relative to; empty uses the working directory
+	Scenes       []string // Scene files scanned for asset references
+	Assets       []string // Extra files or directories always packaged
+	Output       string   // Pak archive path; the manifest is written next to it
+	Platform     string   // Recorded in the manifest; empty uses runtime.GOOS
+	CookTextures bool     // Transcode PNG/JPG textures to KTX2, keeping their names
+	CookShaders  bool     // Compile GLSL shaders to SPIR-V, packaged next to their source
+	Texture      TextureCookSettings
+}
+
+// DefaultPackageConfig returns a config that cooks textures and shaders into build/game.pak
+func DefaultPackageConfig() PackageConfig {
+	return PackageConfig{
+		Output:       "build/game.pak",
+		CookTextures: true,
+		CookShaders:  true,
+		Texture:      DefaultTextureCookSettings(),
+	}
+}
+
+// PackageEntry is one file in a packaged build
+type PackageEntry struct {
+	Path         string   `json:"path"`   // Path inside the pak
+	Source       string   `json:"source"` // Asset the entry was cooked from
+	Kind         string   `json:"kind"`
+	Size         int      `json:"size"`
+	Hash         string   `json:"sha256"`
+	Dependencies []string `json:"dependencies,omitempty"` // Sources this asset references
+}
+
+// PackageManifest lists everything Package put in the pak archive
+type PackageManifest struct {
+	Version  int            `json:"version"`
+	Platform string         `json:"platform"`
+	Entries  []PackageEntry `json:"entries"`
+	Missing  []string       `json:"missing,omitempty"` // "asset: reference" pairs that did not resolve
+}
+
+// Asset kinds recorded in the manifest
+const (
+	assetKindScene    = "scene"
+	assetKindModel    = "model"
+	assetKindMaterial = "material"
+	assetKindTexture  = "texture"
+	assetKindShader   = "shader"
+	assetKindData     = "data"
+)
+
+var assetKindsByExt = map[string]string{
+	".gltf": assetKindModel, ".glb": assetKindModel, ".obj": assetKindModel, ".fbx": assetKindModel,
+	".dae": assetKindModel, ".3ds": assetKindModel, ".ply": assetKindModel, ".stl": assetKindModel,
+	".mtl": assetKindMaterial,
+	".png": assetKindTexture, ".jpg": assetKindTexture, ".jpeg": assetKindTexture, ".tga": assetKindTexture,
+	".bmp": assetKindTexture, ".ktx2": assetKindTexture, ".dds": assetKindTexture,
+	".vert": assetKindShader, ".frag": assetKindShader, ".comp": assetKindShader, ".geom": assetKindShader,
+	".tesc": assetKindShader, ".tese": assetKindShader, ".mesh": assetKindShader, ".task": assetKindShader,
+	".glsl": assetKindShader,
+	".bin":  assetKindData, ".json": assetKindData, ".wav": assetKindData, ".ogg": assetKindData,
+}
+
+// assetReferencePattern finds file names with a known asset extension in text formats
+var assetReferencePattern = regexp.MustCompile(
+	`[A-Za-z0-9_./\\-]+\.(gltf|glb|obj|fbx|dae|3ds|ply|stl|mtl|png|jpg|jpeg|tga|bmp|ktx2|dds|vert|frag|comp|geom|tesc|tese|mesh|task|glsl|bin|json|wav|ogg)\b`)
+
+// packageAsset is a node of the asset dependency graph
+type packageAsset struct {
+	source string // Root-relative, slash separated
+	kind   string
+	deps   []string
+}
+
+// Package scans scenes for the assets they reference (following references between
+// assets), cooks textures and shaders into platform formats, and writes the pak archive
+// plus a JSON manifest. Output depends only on the inputs, so release builds are
+// reproducible. Cooked textures keep their source names, so scene, model and material
+// references still find them; LoadTexture tells KTX2 data by its header. Shaders are
+// packaged as source, which CompileShaderFromFile reads, with their SPIR-V next to them
+// as .spv. The manifest maps each entry back to its source.
+func Package(config PackageConfig) (*PackageManifest, error) {
+	if config.Output == "" {
+		return nil, errors.New("package output path not set")
+	}
+	if config.Platform == "" {
+		config.Platform = runtime.GOOS
+	}
+	root := config.Root
+	if root == "" {
+		root = "."
+	}
+
+	p := &packager{root: root, assets: make(map[string]*packageAsset), missing: make(map[string]bool)}
+	for _, scene := range config.Scenes {
+		source, err := p.rootRelative(scene)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.add(source, assetKindScene); err != nil {
+			return nil, err
+		}
+	}
+	for _, asset := range config.Assets {
+		if err := p.addPath(asset); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.resolve(); err != nil {
+		return nil, err
+	}
+
+	manifest := &PackageManifest{Version: PackageManifestVersion, Platform: config.Platform}
+	var files []pakFile
+	seen := make(map[string]string)
+	for _, source := range p.sortedSources() {
+		asset := p.assets[source]
+		data, err := os.ReadFile(p.fullPath(source))
+		if err != nil {
+			return nil, err
+		}
+
+		cooked, err := cookAsset(asset, data, config)
+		if err != nil {
+			return nil, errors.New(source + ": " + err.Error())
+		}
+		for _, file := range cooked {
+			if other, exists := seen[file.path]; exists {
+				return nil, errors.New(source + " and " + other + " both package to " + file.path)
+			}
+			seen[file.path] = source
+
+			hash := sha256.Sum256(file.data)
+			files = append(files, file)
+			manifest.Entries = append(manifest.Entries, PackageEntry{
+				Path:         file.path,
+				Source:       source,
+				Kind:         asset.kind,
+				Size:         len(file.data),
+				Hash:         hex.EncodeToString(hash[:]),
+				Dependencies: asset.deps,
+			})
+		}
+	}
+	sort.Slice(manifest.Entries, func(i, j int) bool { return manifest.Entries[i].Path < manifest.Entries[j].Path })
+	for missing := range p.missing {
+		manifest.Missing = append(manifest.Missing, missing)
+	}
+	sort.Strings(manifest.Missing)
+
+	if err := writePak(config.Output, files); err != nil {
+		return nil, err
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	manifestPath := strings.TrimSuffix(config.Output, filepath.Ext(config.Output)) + ".manifest.json"
+	if err := writeFileAtomic(manifestPath, append(manifestData, '\n')); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// cookAsset converts an asset to the files packaged for it, the asset itself first
+func cookAsset(asset *packageAsset, data []byte, config PackageConfig) ([]pakFile, error) {
+	ext := strings.ToLower(path.Ext(asset.source))
+	switch {
+	case config.CookTextures && (ext == ".png" || ext == ".jpg" || ext == ".jpeg"):
+		cooked, err := cookTextureData(data, config.Texture)
+		if err != nil {
+			return nil, err
+		}
+		return []pakFile{{path: asset.source, data: cooked}}, nil
+
+	case config.CookShaders && asset.kind == assetKindShader:
+		kind, ok := ShaderKindFromPath(asset.source)
+		if !ok {
+			// Include files are only compiled as part of the shaders using them
+			break
+		}
+		words, err := CompileSPIRV(string(data), kind, asset.source)
+		if err != nil {
+			return nil, err
+		}
+		spirv := make([]byte, 0, len(words)*4)
+		for _, word := range words {
+			spirv = binary.LittleEndian.AppendUint32(spirv, word)
+		}
+		return []pakFile{{path: asset.source, data: data}, {path: asset.source + ".spv", data: spirv}}, nil
+	}
+
+	return []pakFile{{path: asset.source, data: data}}, nil
+}
+
+type packager struct {
+	root    string
+	assets  map[string]*packageAsset
+	pending []string
+	missing map[string]bool
+}
+
+// add queues an asset for scanning
+func (p *packager) add(source, kind string) error {
+	if _, exists := p.assets[source]; exists {
+		return nil
+	}
+	info, err := os.Stat(p.fullPath(source))
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return errors.New(source + " is a directory")
+	}
+
+	if kind == "" {
+		kind = assetKindsByExt[strings.ToLower(path.Ext(source))]
+		if kind == "" {
+			kind = assetKindData
+		}
+	}
+	p.assets[source] = &packageAsset{source: source, kind: kind}
+	p.pending = append(p.pending, source)
+	return nil
+}
+
+// addPath adds a file, or every file under a directory
+func (p *packager) addPath(name string) error {
+	source, err := p.rootRelative(name)
+	if err != nil {
+		return err
+	}
+
+	full := p.fullPath(source)
+	info, err := os.Stat(full)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return p.add(source, "")
+	}
+
+	return filepath.WalkDir(full, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		source, err := p.rootRelative(file)
+		if err != nil {
+			return err
+		}
+		return p.add(source, "")
+	})
+}
+
+// resolve scans queued assets until every reference has been followed
+func (p *packager) resolve() error {
+	for len(p.pending) > 0 {
+		source := p.pending[0]
+		p.pending = p.pending[1:]
+		asset := p.assets[source]
+
+		data, err := os.ReadFile(p.fullPath(source))
+		if err != nil {
+			return err
+		}
+
+		deps := make(map[string]bool)
+		for _, ref := range scanAssetReferences(source, data) {
+			dep, ok := p.resolveReference(source, ref)
+			if !ok {
+				p.missing[source+": "+ref] = true
+				continue
+			}
+			if dep == source || deps[dep] {
+				continue
+			}
+			deps[dep] = true
+			if err := p.add(dep, ""); err != nil {
+				return err
+			}
+		}
+
+		for dep := range deps {
+			asset.deps = append(asset.deps, dep)
+		}
+		sort.Strings(asset.deps)
+	}
+	return nil
+}
+
+// resolveReference finds the file a reference names, relative to the referencing asset
+// first and then to the root
+func (p *packager) resolveReference(from, ref string) (string, bool) {
+	ref = strings.ReplaceAll(ref, "\\", "/")
+	for _, candidate := range []string{path.Join(path.Dir(from), ref), path.Clean(ref)} {
+		if strings.HasPrefix(candidate, "../") || path.IsAbs(candidate) {
+			continue
+		}
+		if info, err := os.Stat(p.fullPath(candidate)); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// rootRelative converts a path to the slash separated form used inside the pak
+func (p *packager) rootRelative(name string) (string, error) {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(p.root, name)
+	}
+	root, err := filepath.Abs(p.root)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return "", err
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", errors.New(name + " is outside the package root")
+	}
+	return rel, nil
+}
+
+func (p *packager) fullPath(source string) string {
+	return filepath.Join(p.root, filepath.FromSlash(source))
+}
+
+func (p *packager) sortedSources() []string {
+	sources := make([]string, 0, len(p.assets))
+	for source := range p.assets {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// scanAssetReferences returns the file names an asset refers to
+func scanAssetReferences(source string, data []byte) []string {
+	switch strings.ToLower(path.Ext(source)) {
+	case ".json", ".gltf":
+		return scanJSONReferences(data)
+	case ".obj":
+		return scanLineReferences(data, "mtllib")
+	case ".mtl":
+		return scanLineReferences(data, "map_Ka", "map_Kd", "map_Ks", "map_Ns", "map_d",
+			"map_Bump", "map_bump", "bump", "disp", "norm")
+	}
+
+	// Binary assets have no references; other text (scenes, shaders) is searched for names
+	// with asset extensions
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return nil
+	}
+	return assetReferencePattern.FindAllString(string(data), -1)
+}
+
+// scanJSONReferences returns every string value that looks like a file name
+func scanJSONReferences(data []byte) []string {
+	var document any
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil
+	}
+
+	var refs []string
+	var walk func(value any)
+	walk = func(value any) {
+		switch v := value.(type) {
+		case map[string]any:
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		case string:
+			if !strings.HasPrefix(v, "data:") && assetReferencePattern.FindString(v) == v {
+				refs = append(refs, v)
+			}
+		}
+	}
+	walk(document)
+
+	sort.Strings(refs)
+	return refs
+}
+
+// scanLineReferences returns the last field of lines starting with one of the keywords
+func scanLineReferences(data []byte, keywords ...string) []string {
+	var refs []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, keyword := range keywords {
+			if fields[0] == keyword {
+				refs = append(refs, fields[len(fields)-1])
+				break
+			}
+		}
+	}
+	return refs
+}
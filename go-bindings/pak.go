@@ -0,0 +1,167 @@
+package boulder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+// Pak archive layout: a header, the file data, then a table of entries sorted by path.
+// Nothing time or machine dependent is stored, so the same inputs give the same archive.
+const (
+	pakVersion    = 1
+	pakHeaderSize = 20 // Magic, version, entry count, table offset
+	pakAlignment  = 16
+)
+
+var pakMagic = []byte("BPAK")
+
+// pakFile is a file to be written into a pak archive
+type pakFile struct {
+	path string
+	data []byte
+}
+
+type pakEntry struct {
+	offset uint64
+	size   uint64
+	hash   [sha256.Size]byte
+}
+
+// writePak writes files into a pak archive at path
+func writePak(path string, files []pakFile) error {
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+
+	var buf bytes.Buffer
+	buf.Write(make([]byte, pakHeaderSize))
+
+	entries := make([]pakEntry, len(files))
+	for i, file := range files {
+		for buf.Len()%pakAlignment != 0 {
+			buf.WriteByte(0)
+		}
+		entries[i] = pakEntry{offset: uint64(buf.Len()), size: uint64(len(file.data)), hash: sha256.Sum256(file.data)}
+		buf.Write(file.data)
+	}
+
+	tableOffset := uint64(buf.Len())
+	for i, file := range files {
+		if len(file.path) > 0xFFFF {
+			return errors.New("pak path too long: " + file.path)
+		}
+		binary.Write(&buf, binary.LittleEndian, uint16(len(file.path)))
+		buf.WriteString(file.path)
+		binary.Write(&buf, binary.LittleEndian, entries[i].offset)
+		binary.Write(&buf, binary.LittleEndian, entries[i].size)
+		buf.Write(entries[i].hash[:])
+	}
+
+	data := buf.Bytes()
+	copy(data, pakMagic)
+	binary.LittleEndian.PutUint32(data[4:], pakVersion)
+	binary.LittleEndian.PutUint32(data[8:], uint32(len(files)))
+	binary.LittleEndian.PutUint64(data[12:], tableOffset)
+	return writeFileAtomic(path, data)
+}
+
+// Pak is an open pak archive written by Package
+type Pak struct {
+	file    *os.File
+	entries map[string]pakEntry
+	paths   []string
+}
+
+// OpenPak opens a pak archive for reading
+func OpenPak(path string) (*Pak, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pak, err := readPakTable(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return pak, nil
+}
+
+func readPakTable(file *os.File) (*Pak, error) {
+	header := make([]byte, pakHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:4], pakMagic) {
+		return nil, errors.New("not a pak archive")
+	}
+	if binary.LittleEndian.Uint32(header[4:]) != pakVersion {
+		return nil, errors.New("unsupported pak version")
+	}
+
+	count := int(binary.LittleEndian.Uint32(header[8:]))
+	tableOffset := int64(binary.LittleEndian.Uint64(header[12:]))
+	table, err := io.ReadAll(io.NewSectionReader(file, tableOffset, 1<<62))
+	if err != nil {
+		return nil, err
+	}
+
+	pak := &Pak{file: file, entries: make(map[string]pakEntry, count)}
+	for i := 0; i < count; i++ {
+		if len(table) < 2 {
+			return nil, errors.New("truncated pak table")
+		}
+		pathLen := int(binary.LittleEndian.Uint16(table))
+		if len(table) < 2+pathLen+16+sha256.Size {
+			return nil, errors.New("truncated pak table")
+		}
+		path := string(table[2 : 2+pathLen])
+		table = table[2+pathLen:]
+
+		var entry pakEntry
+		entry.offset = binary.LittleEndian.Uint64(table)
+		entry.size = binary.LittleEndian.Uint64(table[8:])
+		copy(entry.hash[:], table[16:])
+		table = table[16+sha256.Size:]
+
+		pak.entries[path] = entry
+		pak.paths = append(pak.paths, path)
+	}
+	return pak, nil
+}
+
+// List returns the paths stored in the archive, sorted
+func (p *Pak) List() []string {
+	return p.paths
+}
+
+// Contains reports whether the archive has a file
+func (p *Pak) Contains(path string) bool {
+	_, ok := p.entries[path]
+	return ok
+}
+
+// ReadFile returns the contents of a file in the archive, verifying its hash
+func (p *Pak) ReadFile(path string) ([]byte, error) {
+	entry, ok := p.entries[path]
+	if !ok {
+		return nil, errors.New("file not in pak: " + path)
+	}
+
+	data := make([]byte, entry.size)
+	if _, err := p.file.ReadAt(data, int64(entry.offset)); err != nil {
+		return nil, err
+	}
+	if sha256.Sum256(data) != entry.hash {
+		return nil, errors.New("pak entry corrupted: " + path)
+	}
+	return data, nil
+}
+
+// Close closes the archive
+func (p *Pak) Close() error {
+	return p.file.Close()
+}
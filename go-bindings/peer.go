@@ -0,0 +1,288 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Transport identifies a way of reaching a peer
+type Transport int
+
+const (
+	TransportNone   Transport = 0
+	TransportIP     Transport = 1 // Direct UDP to an IP address
+	TransportSteam  Transport = 2 // Steam P2P with NAT traversal and Steam Datagram Relay
+	TransportCustom Transport = 3 // A registered TransportPlugin
+)
+
+// String returns the transport name
+func (t Transport) String() string {
+	switch t {
+	case TransportIP:
+		return "ip"
+	case TransportSteam:
+		return "steam"
+	case TransportCustom:
+		return "custom"
+	default:
+		return "none"
+	}
+}
+
+// PeerAddressKind identifies what a PeerAddress refers to
+type PeerAddressKind int
+
+const (
+	PeerAddressIP     PeerAddressKind = 1 // Host and port
+	PeerAddressSteam  PeerAddressKind = 2 // Steam ID and virtual port
+	PeerAddressRelay  PeerAddressKind = 3 // Relay token listing every way to reach a host
+	PeerAddressPlugin PeerAddressKind = 4 // Plugin name and plugin-specific address
+)
+
+// relayTokenPrefix marks relay tokens created by CreateRelayToken
+const relayTokenPrefix = "boulder1."
+
+// PeerAddress identifies a peer independently of the transport used to reach it
+type PeerAddress struct {
+	Kind        PeerAddressKind
+	Host        string  // IP and plugin addresses
+	Port        uint16  // IP addresses
+	SteamID     SteamID // Steam addresses
+	VirtualPort int     // Steam addresses
+	Token       string  // Relay addresses
+	Plugin      string  // Plugin addresses
+}
+
+// IPAddress returns the address of a peer reachable at host:port
+func IPAddress(host string, port uint16) PeerAddress {
+	return PeerAddress{Kind: PeerAddressIP, Host: host, Port: port}
+}
+
+// SteamAddress returns the address of a Steam user listening on a virtual port
+func SteamAddress(steamID SteamID, virtualPort int) PeerAddress {
+	return PeerAddress{Kind: PeerAddressSteam, SteamID: steamID, VirtualPort: virtualPort}
+}
+
+// RelayAddress returns the address described by a relay token from CreateRelayToken
+func RelayAddress(token string) PeerAddress {
+	return PeerAddress{Kind: PeerAddressRelay, Token: token}
+}
+
+// PluginAddress returns the address of a peer reached through a TransportPlugin
+func PluginAddress(plugin, address string) PeerAddress {
+	return PeerAddress{Kind: PeerAddressPlugin, Plugin: plugin, Host: address}
+}
+
+// ParsePeerAddress parses the String form of an address ("ip:host:port",
+// "steam:id:virtualPort", "plugin:name:address" or a relay token). A bare "host:port" is
+// treated as an IP address.
+func ParsePeerAddress(s string) (PeerAddress, error) {
+	switch {
+	case strings.HasPrefix(s, relayTokenPrefix):
+		return RelayAddress(s), nil
+
+	case strings.HasPrefix(s, "plugin:"):
+		name, address, ok := strings.Cut(strings.TrimPrefix(s, "plugin:"), ":")
+		if !ok || name == "" {
+			return PeerAddress{}, errors.New("plugin address must be plugin:name:address")
+		}
+		return PluginAddress(name, address), nil
+
+	case strings.HasPrefix(s, "steam:"):
+		parts := strings.Split(strings.TrimPrefix(s, "steam:"), ":")
+		if len(parts) != 2 {
+			return PeerAddress{}, errors.New("steam address must be steam:id:virtualPort")
+		}
+		id, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil {
+			return PeerAddress{}, fmt.Errorf("invalid steam id: %w", err)
+		}
+		vport, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return PeerAddress{}, fmt.Errorf("invalid virtual port: %w", err)
+		}
+		return SteamAddress(SteamID(id), vport), nil
+
+	default:
+		host, portString, err := net.SplitHostPort(strings.TrimPrefix(s, "ip:"))
+		if err != nil {
+			return PeerAddress{}, err
+		}
+		port, err := strconv.ParseUint(portString, 10, 16)
+		if err != nil {
+			return PeerAddress{}, fmt.Errorf("invalid port: %w", err)
+		}
+		return IPAddress(host, uint16(port)), nil
+	}
+}
+
+// String returns a form of the address accepted by ParsePeerAddress
+func (a PeerAddress) String() string {
+	switch a.Kind {
+	case PeerAddressIP:
+		return "ip:" + net.JoinHostPort(a.Host, strconv.Itoa(int(a.Port)))
+	case PeerAddressSteam:
+		return fmt.Sprintf("steam:%d:%d", a.SteamID, a.VirtualPort)
+	case PeerAddressRelay:
+		return a.Token
+	case PeerAddressPlugin:
+		return "plugin:" + a.Plugin + ":" + a.Host
+	default:
+		return ""
+	}
+}
+
+// Candidates returns the direct addresses a relay token contains, in order of preference.
+// For IP and Steam addresses it returns the address itself.
+func (a PeerAddress) Candidates() ([]PeerAddress, error) {
+	if a.Kind != PeerAddressRelay {
+		return []PeerAddress{a}, nil
+	}
+
+	if !strings.HasPrefix(a.Token, relayTokenPrefix) {
+		return nil, errors.New("unrecognized relay token")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(a.Token, relayTokenPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid relay token: %w", err)
+	}
+
+	var candidates []PeerAddress
+	for _, field := range strings.Split(string(raw), ";") {
+		if field == "" {
+			continue
+		}
+		candidate, err := ParsePeerAddress(field)
+		if err != nil || candidate.Kind == PeerAddressRelay {
+			return nil, errors.New("invalid relay token candidate")
+		}
+		candidates = append(candidates, candidate)
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New("relay token has no candidates")
+	}
+
+	return candidates, nil
+}
+
+// Transport returns the transport used to reach a direct address
+func (a PeerAddress) Transport() Transport {
+	switch a.Kind {
+	case PeerAddressIP:
+		return TransportIP
+	case PeerAddressSteam:
+		return TransportSteam
+	case PeerAddressPlugin:
+		return TransportCustom
+	default:
+		return TransportNone
+	}
+}
+
+// IsTransportAvailable reports whether this session can use a transport. IP is always
+// available; Steam requires InitWithSteamApp and an authenticated Steam identity; custom
+// transports require at least one registered TransportPlugin.
+func (ns *NetworkSession) IsTransportAvailable(transport Transport) bool {
+	if ns.handle == nil {
+		return false
+	}
+
+	switch transport {
+	case TransportIP:
+		return true
+	case TransportSteam:
+		return C.boulder_network_steam_available(ns.handle) != 0
+	case TransportCustom:
+		return ns.plugins != nil && len(ns.plugins.order) > 0
+	default:
+		return false
+	}
+}
+
+// CreateRelayToken returns a relay token describing how to reach this session: through
+// Steam on virtualPort when Steam is available, and directly on host:port when host is
+// not empty. Clients connect to the token with ConnectPeer(RelayAddress(token)).
+func (ns *NetworkSession) CreateRelayToken(host string, port uint16, virtualPort int) (string, error) {
+	if ns.handle == nil {
+		return "", errSessionNotInitialized
+	}
+
+	var candidates []string
+	if ns.IsTransportAvailable(TransportSteam) {
+		candidates = append(candidates, SteamAddress(ns.GetLocalSteamID(), virtualPort).String())
+	}
+	if host != "" {
+		candidates = append(candidates, IPAddress(host, port).String())
+	}
+	if len(candidates) == 0 {
+		return "", errors.New("no transport available to advertise")
+	}
+
+	raw := strings.Join(candidates, ";")
+	return relayTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(raw)), nil
+}
+
+// ConnectPeer connects to a peer over the best transport both sides support. Relay tokens
+// are tried candidate by candidate, preferring Steam (which traverses NATs), then plugin
+// transports, then direct IP, and skipping transports this session cannot use.
+func (ns *NetworkSession) ConnectPeer(address PeerAddress) (ConnectionHandle, error) {
+	if ns.handle == nil {
+		return 0, errSessionNotInitialized
+	}
+
+	candidates, err := address.Candidates()
+	if err != nil {
+		return 0, err
+	}
+
+	var lastErr error
+	for _, preferred := range []Transport{TransportSteam, TransportCustom, TransportIP} {
+		for _, candidate := range candidates {
+			if candidate.Transport() != preferred {
+				continue
+			}
+			if !ns.IsTransportAvailable(preferred) {
+				lastErr = fmt.Errorf("%s transport unavailable", preferred)
+				continue
+			}
+
+			var conn ConnectionHandle
+			switch preferred {
+			case TransportSteam:
+				conn, err = ns.ConnectP2P(candidate.SteamID, candidate.VirtualPort)
+			case TransportCustom:
+				conn, err = ns.ConnectTransport(candidate.Plugin, candidate.Host)
+			default:
+				conn, err = ns.Connect(candidate.Host, candidate.Port)
+			}
+			if err != nil {
+				lastErr = err
+				continue
+			}
+
+			if ns.transports == nil {
+				ns.transports = make(map[ConnectionHandle]Transport)
+			}
+			ns.transports[conn] = preferred
+			return conn, nil
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no compatible transport")
+	}
+	return 0, lastErr
+}
+
+// GetConnectionTransport returns the transport chosen by ConnectPeer for a connection
+func (ns *NetworkSession) GetConnectionTransport(conn ConnectionHandle) Transport {
+	return ns.transports[conn]
+}
@@ -0,0 +1,328 @@
+package boulder
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// perfHUDRefresh is how often the HUD's figures are rewritten; the graph moves every frame
+const perfHUDRefresh = 250 * time.Millisecond
+
+// PerfHUDConfig sets up the performance overlay
+type PerfHUDConfig struct {
+	X, Y        float32          // Top left corner in pixels
+	Hotkey      int              // Scancode that shows and hides the overlay, e.g. KeyF3; 0 for none
+	Session     *NetworkSession  // For ping and packet loss; nil leaves them out
+	Connection  ConnectionHandle // Whose ping to show; 0 is the session's first connection
+	GraphFrames int              // Frames in the frame time graph; 0 is 90
+	GraphMax    time.Duration    // Frame time at the top of the graph; 0 is 33ms
+}
+
+// DefaultPerfHUDConfig returns the overlay in the top left corner, without a hotkey
+func DefaultPerfHUDConfig() PerfHUDConfig {
+	return PerfHUDConfig{
+		X:           8,
+		Y:           8,
+		GraphFrames: 90,
+		GraphMax:    33 * time.Millisecond,
+	}
+}
+
+func (c PerfHUDConfig) withDefaults() PerfHUDConfig {
+	defaults := DefaultPerfHUDConfig()
+	if c.GraphFrames <= 0 {
+		c.GraphFrames = defaults.GraphFrames
+	}
+	if c.GraphMax <= 0 {
+		c.GraphMax = defaults.GraphMax
+	}
+	return c
+}
+
+// perfHUD is the engine's performance overlay. It is made of UI labels and progress bars
+// the engine owns, created when the overlay is first shown.
+type perfHUD struct {
+	config    PerfHUDConfig
+	renderer  *Renderer // For the frame figures; never drawn with
+	input     *Input
+	shown     bool
+	hotkeyWas bool
+
+	frames  []time.Duration // Ring of recent frame times
+	next    int
+	elapsed time.Duration // Since the figures were last rewritten
+
+	panel *UIProgressBar
+	text  *UILabel
+	bars  []*UIProgressBar
+}
+
+const (
+	perfHUDWidth       = 300
+	perfHUDTextHeight  = 96
+	perfHUDGraphHeight = 48
+	perfHUDPadding     = 6
+)
+
+var (
+	perfHUDBackground = UIColor{0.0, 0.0, 0.0, 0.6}
+	perfHUDGood       = UIColor{0.3, 0.9, 0.4, 1.0} // Under 60 fps worth
+	perfHUDSlow       = UIColor{1.0, 0.8, 0.2, 1.0} // Under 30 fps worth
+	perfHUDBad        = UIColor{1.0, 0.3, 0.3, 1.0}
+)
+
+// SetPerfHUDConfig sets where the performance overlay sits, what toggles it and which
+// network session it reports on
+func (e *Engine) SetPerfHUDConfig(config PerfHUDConfig) {
+	hud := e.perfHUDState()
+	shown := hud.shown
+	hud.destroy()
+	hud.config = config.withDefaults()
+	hud.frames = make([]time.Duration, hud.config.GraphFrames)
+	hud.next = 0
+	if shown {
+		hud.show(e)
+	}
+}
+
+// ShowPerfHUD shows or hides the performance overlay: frame rate, a frame time graph, CPU
+// and GPU time, draw calls, ping and packet loss, and memory. It is drawn by the engine
+// over the game's UI, and can also be toggled with the perf_hud cvar or the configured
+// hotkey. Engine.Update keeps it current.
+func (e *Engine) ShowPerfHUD(show bool) {
+	hud := e.perfHUDState()
+	if show == hud.shown {
+		return
+	}
+	if show {
+		hud.show(e)
+	} else {
+		hud.destroy()
+	}
+	if cvar, ok := e.cvarTable()["perf_hud"]; ok {
+		cvar.Value = "0"
+		if show {
+			cvar.Value = "1"
+		}
+	}
+}
+
+// IsPerfHUDShown returns whether the performance overlay is on screen
+func (e *Engine) IsPerfHUDShown() bool {
+	return e.perfHUD != nil && e.perfHUD.shown
+}
+
+func (e *Engine) perfHUDState() *perfHUD {
+	if e.perfHUD == nil {
+		config := DefaultPerfHUDConfig()
+		e.perfHUD = &perfHUD{
+			config:   config,
+			renderer: NewRenderer(e),
+			input:    NewInput(e),
+			frames:   make([]time.Duration, config.GraphFrames),
+		}
+	}
+	return e.perfHUD
+}
+
+func (e *Engine) registerPerfHUDCVar() {
+	e.cvars["perf_hud"] = &cvarEntry{
+		CVar: CVar{Name: "perf_hud", Description: "Show the performance overlay (0 or 1)", Value: "0", Default: "0"},
+		onChange: func(value string) error {
+			show, err := ParseCVarBool(value)
+			if err != nil {
+				return err
+			}
+			e.ShowPerfHUD(show)
+			return nil
+		},
+	}
+}
+
+// updatePerfHUD checks the hotkey and records the frame (called by Update)
+func (e *Engine) updatePerfHUD(deltaTime float32) {
+	hud := e.perfHUD
+	if hud == nil {
+		return
+	}
+
+	if hud.config.Hotkey != 0 {
+		pressed := hud.input.IsKeyPressed(hud.config.Hotkey)
+		if pressed && !hud.hotkeyWas {
+			e.ShowPerfHUD(!hud.shown)
+		}
+		hud.hotkeyWas = pressed
+	}
+	if !hud.shown {
+		return
+	}
+
+	frame := time.Duration(float64(deltaTime) * float64(time.Second))
+	hud.frames[hud.next] = frame
+	hud.next = (hud.next + 1) % len(hud.frames)
+	hud.updateGraph()
+
+	hud.elapsed += frame
+	if hud.elapsed >= perfHUDRefresh && hud.text != nil {
+		hud.elapsed = 0
+		hud.text.SetText(hud.describe())
+	}
+}
+
+// show creates the overlay's UI
+func (h *perfHUD) show(e *Engine) {
+	h.shown = true
+	x, y := h.config.X, h.config.Y
+	height := float32(perfHUDTextHeight + perfHUDGraphHeight + 3*perfHUDPadding)
+
+	h.panel = CreateUIProgressBar(x, y, perfHUDWidth, height)
+	if h.panel != nil {
+		h.panel.SetColors(perfHUDBackground, perfHUDBackground, perfHUDBackground)
+	}
+
+	h.text = CreateUILabel(x+perfHUDPadding, y+perfHUDPadding, perfHUDWidth-2*perfHUDPadding, perfHUDTextHeight, "")
+	if h.text != nil {
+		h.text.SetTextStyle(UITextStyle{Size: 14, Color: UIColorWhite, Align: AlignStart, VerticalAlign: AlignStart})
+		h.text.SetText(h.describe())
+	}
+
+	graphY := y + perfHUDTextHeight + 2*perfHUDPadding
+	barWidth := float32(perfHUDWidth-2*perfHUDPadding) / float32(len(h.frames))
+	clear := UIColor{}
+	h.bars = make([]*UIProgressBar, 0, len(h.frames))
+	for i := range h.frames {
+		bar := CreateUIProgressBar(x+perfHUDPadding+float32(i)*barWidth, graphY, barWidth, perfHUDGraphHeight)
+		if bar == nil {
+			continue
+		}
+		bar.SetFill(FillBottomToTop)
+		bar.SetRange(0, float32(h.config.GraphMax.Seconds()))
+		bar.SetColors(clear, perfHUDGood, perfHUDGood)
+		h.bars = append(h.bars, bar)
+	}
+	h.updateGraph()
+}
+
+// destroy removes the overlay's UI
+func (h *perfHUD) destroy() {
+	h.shown = false
+	if h.panel != nil {
+		h.panel.Destroy()
+		h.panel = nil
+	}
+	if h.text != nil {
+		h.text.Destroy()
+		h.text = nil
+	}
+	for _, bar := range h.bars {
+		bar.Destroy()
+	}
+	h.bars = nil
+}
+
+// forget drops the overlay's UI without destroying it, after a restart took the UI with it
+func (h *perfHUD) forget(e *Engine) {
+	shown := h.shown
+	h.panel, h.text, h.bars = nil, nil, nil
+	h.shown = false
+	if shown {
+		h.show(e)
+	}
+}
+
+// updateGraph draws the frame times oldest on the left
+func (h *perfHUD) updateGraph() {
+	for i, bar := range h.bars {
+		frame := h.frames[(h.next+i)%len(h.frames)]
+		color := perfHUDGood
+		switch {
+		case frame > 33333*time.Microsecond:
+			color = perfHUDBad
+		case frame > 16667*time.Microsecond:
+			color = perfHUDSlow
+		}
+		if color != bar.fillStart {
+			bar.SetColors(UIColor{}, color, color)
+		}
+		bar.SetValue(float32(frame.Seconds()))
+	}
+}
+
+// describe returns the overlay's figures
+func (h *perfHUD) describe() string {
+	var total time.Duration
+	var worst time.Duration
+	count := 0
+	for _, frame := range h.frames {
+		if frame > 0 {
+			total += frame
+			worst = max(worst, frame)
+			count++
+		}
+	}
+
+	var b strings.Builder
+	if count > 0 {
+		average := total / time.Duration(count)
+		fmt.Fprintf(&b, "FPS %.0f  %.2f ms  worst %.2f ms\n", fps(average), msOf(average), msOf(worst))
+	} else {
+		b.WriteString("FPS -\n")
+	}
+
+	times := h.renderer.GetFrameTimes()
+	if times.GPUTimingSupported {
+		fmt.Fprintf(&b, "CPU %.2f ms  GPU %.2f ms\n", msOf(times.CPU), msOf(times.GPU))
+	} else {
+		fmt.Fprintf(&b, "CPU %.2f ms  GPU n/a\n", msOf(times.CPU))
+	}
+
+	stats := h.renderer.GetRenderStats()
+	fmt.Fprintf(&b, "Draws %d  Triangles %s\n", stats.DrawCalls, formatCount(stats.Triangles))
+
+	if ns := h.config.Session; ns.IsValid() {
+		conn := h.config.Connection
+		if conn == 0 {
+			if open := ns.openConnections(); len(open) > 0 {
+				conn = open[0]
+			}
+		}
+		if s, err := ns.GetConnectionStats(conn); conn != 0 && err == nil {
+			if s.PacketLoss >= 0 {
+				fmt.Fprintf(&b, "Ping %d ms  Loss %.1f%%\n", s.RTT.Milliseconds(), s.PacketLoss)
+			} else {
+				fmt.Fprintf(&b, "Ping %d ms  Loss ?\n", s.RTT.Milliseconds())
+			}
+		} else {
+			b.WriteString("Ping -  not connected\n")
+		}
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	fmt.Fprintf(&b, "GPU mem %s (%d allocs)  Go heap %s", formatBytes(stats.DeviceMemory), stats.DeviceAllocations, formatBytes(mem.HeapAlloc))
+	return b.String()
+}
+
+func msOf(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func formatCount(n uint64) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1e3)
+	}
+	return fmt.Sprint(n)
+}
+
+func formatBytes(n uint64) string {
+	const mb = 1 << 20
+	if n >= 10*mb {
+		return fmt.Sprintf("%d MB", n/mb)
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/mb)
+}
@@ -0,0 +1,82 @@
+package boulder
+
+import (
+	"errors"
+	"slices"
+)
+
+// SetPersistent marks an entity to survive scene loads and world switches, e.g. the player,
+// managers or the music. LoadSceneAsync leaves it alive when it replaces the scene it came
+// from, and SetActiveWorld moves it into the new active world. Moving gives it a new ID
+// there: this Entity is updated to follow it, but other wrappers and state kept on the Go
+// side by ID, such as hitboxes and health, stay with the old one.
+func (e *Entity) SetPersistent(persistent bool) error {
+	if !e.Exists() {
+		return errors.New("entity does not exist")
+	}
+
+	engine := e.world.engine
+	index := slices.IndexFunc(engine.persistent, e.sameEntity)
+	if !persistent {
+		if index >= 0 {
+			engine.persistent = slices.Delete(engine.persistent, index, index+1)
+		}
+		return nil
+	}
+
+	if index < 0 {
+		engine.persistent = append(engine.persistent, e)
+	} else {
+		// Keep the latest wrapper, which is the one the caller holds on to
+		engine.persistent[index] = e
+	}
+	return nil
+}
+
+// IsPersistent returns whether the entity survives scene loads and world switches
+func (e *Entity) IsPersistent() bool {
+	return e.world.engine.isPersistent(e.world, e.ID)
+}
+
+// GetPersistentEntities returns the entities marked with SetPersistent that still exist
+func (e *Engine) GetPersistentEntities() []*Entity {
+	e.prunePersistent()
+	return slices.Clone(e.persistent)
+}
+
+func (e *Entity) sameEntity(other *Entity) bool {
+	return other.ID == e.ID && other.world.id == e.world.id
+}
+
+func (e *Engine) isPersistent(world *World, entity EntityID) bool {
+	return slices.ContainsFunc(e.persistent, func(p *Entity) bool {
+		return p.ID == entity && p.world.id == world.id
+	})
+}
+
+// prunePersistent forgets persistent entities that have been destroyed
+func (e *Engine) prunePersistent() {
+	e.persistent = slices.DeleteFunc(e.persistent, func(p *Entity) bool { return !p.Exists() })
+}
+
+// movePersistent moves the persistent entities of a world into the new active world
+// (called by SetActiveWorld)
+func (e *Engine) movePersistent(from, to *World) {
+	if from.id == to.id {
+		return
+	}
+
+	e.prunePersistent()
+	for _, p := range e.persistent {
+		if p.world.id != from.id {
+			continue
+		}
+		id, err := from.MoveEntity(p.ID, to)
+		if err != nil {
+			LogError("Failed to move persistent entity to the active world: " + err.Error())
+			continue
+		}
+		p.ID = id
+		p.world = to
+	}
+}
@@ -0,0 +1,192 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"path/filepath"
+)
+
+// PhysicsHarnessConfig sets up a RunPhysicsHarness run
+type PhysicsHarnessConfig struct {
+	Ticks    int     // Fixed ticks to step
+	TickRate float32 // Ticks per second; 0 is 60
+	// Quantum rounds positions, rotations and velocities to multiples of it before hashing,
+	// so a physics upgrade that only moves the last bits still matches. 0 hashes exact bits.
+	Quantum float32
+	// Setup runs after the scene is spawned and before the first tick, e.g. to add the
+	// colliders and starting velocities a scene file can't describe
+	Setup func(world *World, scene *Scene) error
+}
+
+// PhysicsEntityState is where a scene entity ended up after a harness run
+type PhysicsEntityState struct {
+	Name     string
+	Position Vector3
+	Rotation Quaternion
+	Velocity Vector3 // Zero without a physics body
+}
+
+// PhysicsTrace is the result of a harness run. Record it from a known good build and
+// compare later runs against it.
+type PhysicsTrace struct {
+	Hash       uint64               // State after the last tick
+	TickHashes []uint64             // State after each tick, to find where runs diverge
+	Entities   []PhysicsEntityState // Final state, in the order the scene file lists them
+}
+
+// RunPhysicsHarness loads a scene file into a world of its own, steps the simulation a fixed
+// number of ticks and hashes the state of the scene's entities after each one. The same
+// scene and config give the same hashes on the same build, so a Go test can check a
+// physics change for behavioral regressions:
+//
+//	trace, err := engine.RunPhysicsHarness("testdata/stack.json", boulder.PhysicsHarnessConfig{Ticks: 600})
+//	if trace.Hash != want { ... }
+//
+// Models aren't loaded and nothing is drawn, so it runs headless after Init. Entities with
+// a mass get a physics body as in LoadSceneAsync. The active world is swapped out for the
+// run and restored afterwards; run it outside the game loop, which would otherwise lose
+// that world's pending component events.
+func (e *Engine) RunPhysicsHarness(scenePath string, config PhysicsHarnessConfig) (*PhysicsTrace, error) {
+	defer lockThread()()
+	if !e.initialized {
+		return nil, errNotInitialized
+	}
+	if config.Ticks < 0 {
+		return nil, errors.New("tick count can't be negative")
+	}
+	if config.TickRate <= 0 {
+		config.TickRate = 60
+	}
+
+	file, err := parseSceneFile(scenePath)
+	if err != nil {
+		return nil, err
+	}
+
+	world, err := e.CreateWorld()
+	if err != nil {
+		return nil, err
+	}
+	previous := C.boulder_get_active_world()
+	defer func() {
+		C.boulder_set_active_world(previous)
+		if err := world.Destroy(); err != nil {
+			LogError("Failed to destroy physics harness world: " + err.Error())
+		}
+	}()
+	if C.boulder_set_active_world(world.id) != 0 {
+		return nil, lastError("failed to set active world")
+	}
+
+	scene := &Scene{Path: filepath.Clean(scenePath), names: make(map[string]EntityID)}
+	names := make([]string, 0, len(file.Entities))
+	descs, err := world.expandScene(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, desc := range descs {
+		entity, err := scene.spawnEntity(world, desc)
+		if err != nil {
+			return nil, err
+		}
+		if err := addSceneComponents(entity, desc); err != nil {
+			return nil, err
+		}
+		names = append(names, desc.Name)
+	}
+	if config.Setup != nil {
+		if err := config.Setup(world, scene); err != nil {
+			return nil, err
+		}
+	}
+
+	trace := &PhysicsTrace{TickHashes: make([]uint64, 0, config.Ticks)}
+	dt := 1 / config.TickRate
+	for tick := 0; tick < config.Ticks; tick++ {
+		if C.boulder_update(C.float(dt)) != 0 {
+			return nil, lastError("failed to step physics")
+		}
+		hash, err := hashPhysicsState(world, scene, config.Quantum)
+		if err != nil {
+			return nil, err
+		}
+		trace.TickHashes = append(trace.TickHashes, hash)
+	}
+
+	if trace.Hash, err = hashPhysicsState(world, scene, config.Quantum); err != nil {
+		return nil, err
+	}
+	for i, id := range scene.entities {
+		state := PhysicsEntityState{Name: names[i]}
+		if state.Position, state.Rotation, state.Velocity, err = physicsState(world, id); err != nil {
+			return nil, err
+		}
+		trace.Entities = append(trace.Entities, state)
+	}
+	return trace, nil
+}
+
+// FirstDivergence returns the first tick (from 0) after which the traces' states differ,
+// or -1 if they match for as many ticks as both ran
+func (t *PhysicsTrace) FirstDivergence(other *PhysicsTrace) int {
+	for i := 0; i < min(len(t.TickHashes), len(other.TickHashes)); i++ {
+		if t.TickHashes[i] != other.TickHashes[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+// hashPhysicsState hashes the scene entities' transforms and velocities, in file order so
+// entity IDs don't matter
+func hashPhysicsState(world *World, scene *Scene, quantum float32) (uint64, error) {
+	h := fnv.New64a()
+	var buf [4]byte
+	write := func(values ...float32) {
+		for _, v := range values {
+			if quantum > 0 {
+				v = float32(math.Round(float64(v/quantum))) * quantum
+			}
+			if v == 0 {
+				v = 0 // -0 hashes as 0
+			}
+			bits := math.Float32bits(v)
+			buf[0], buf[1], buf[2], buf[3] = byte(bits), byte(bits>>8), byte(bits>>16), byte(bits>>24)
+			h.Write(buf[:])
+		}
+	}
+
+	for _, id := range scene.entities {
+		position, rotation, velocity, err := physicsState(world, id)
+		if err != nil {
+			return 0, err
+		}
+		// q and -q are the same rotation
+		if rotation.W < 0 {
+			rotation = Quaternion{-rotation.X, -rotation.Y, -rotation.Z, -rotation.W}
+		}
+		write(position.X, position.Y, position.Z)
+		write(rotation.X, rotation.Y, rotation.Z, rotation.W)
+		write(velocity.X, velocity.Y, velocity.Z)
+	}
+	return h.Sum64(), nil
+}
+
+// physicsState reads what the harness hashes for an entity
+func physicsState(world *World, id EntityID) (position Vector3, rotation Quaternion, velocity Vector3, err error) {
+	entity := &Entity{ID: id, world: world}
+	if position, err = entity.GetTransform(); err != nil {
+		return
+	}
+	if rotation, err = entity.GetRotationQuat(); err != nil {
+		return
+	}
+	// Entities without a body have no velocity
+	velocity, _ = entity.GetVelocity()
+	return position, rotation, velocity, nil
+}
@@ -1,7 +1,6 @@
 package boulder
 
 // #cgo CFLAGS: -I..
-// #cgo LDFLAGS: -L../build -lboulder_shared -Wl,-rpath,${SRCDIR}/../build
 // #include <stdlib.h>
 // #include "../boulder_cgo.h"
 import "C"
@@ -10,6 +9,9 @@ import "errors"
 // PipelineID uniquely identifies a graphics pipeline
 type PipelineID uint64
 
+// PushConstantSize is the push constant bytes of pipelines from CreateGraphicsPipeline
+const PushConstantSize = 64
+
 // Pipeline represents a graphics pipeline
 type Pipeline struct {
 	ID         PipelineID
@@ -26,8 +28,9 @@ type PipelineConfig struct {
 
 // CreateGraphicsPipeline creates a new graphics pipeline from shaders
 func (e *Engine) CreateGraphicsPipeline(config PipelineConfig) (*Pipeline, error) {
+	defer lockThread()()
 	if !e.initialized {
-		return nil, errors.New("engine not initialized")
+		return nil, errNotInitialized
 	}
 
 	if config.MeshShader == nil || config.FragShader == nil {
@@ -40,28 +43,31 @@ func (e *Engine) CreateGraphicsPipeline(config PipelineConfig) (*Pipeline, error
 	)
 
 	if id == 0 {
-		return nil, errors.New("failed to create graphics pipeline")
+		return nil, lastError("failed to create graphics pipeline")
 	}
 
-	return &Pipeline{
+	p := &Pipeline{
 		ID:         PipelineID(id),
 		MeshShader: config.MeshShader,
 		FragShader: config.FragShader,
 		engine:     e,
-	}, nil
+	}
+	e.track(p, stagePipelines)
+	return p, nil
 }
 
-// Bind binds this pipeline for rendering
+// Bind binds this pipeline for rendering until the frame ends or RenderModels is called
 func (p *Pipeline) Bind() error {
+	defer lockThread()()
 	if p.engine == nil || !p.engine.initialized {
-		return errors.New("engine not initialized")
+		return errNotInitialized
 	}
 
-	C.boulder_bind_pipeline(C.PipelineID(p.ID))
-	return nil
+	return apiError(C.boulder_bind_pipeline(C.PipelineID(p.ID)), "failed to bind pipeline")
 }
 
-// Destroy destroys the pipeline and frees resources
+// Destroy destroys the pipeline and frees resources, waiting for frames in flight that may
+// use it. Pipelines bound in the frame being recorded can only be destroyed after EndFrame.
 func (p *Pipeline) Destroy() {
 	if p.engine == nil || !p.engine.initialized {
 		return
@@ -69,6 +75,7 @@ func (p *Pipeline) Destroy() {
 
 	C.boulder_destroy_pipeline(C.PipelineID(p.ID))
 	p.ID = 0
+	p.engine.untrack(p)
 }
 
 // PipelineBuilder provides a fluent interface for building pipelines
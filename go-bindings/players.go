@@ -0,0 +1,337 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	NetworkEventPlayerJoined   NetworkEventType = 10
+	NetworkEventPlayerRejoined NetworkEventType = 11
+	NetworkEventPlayerLeft     NetworkEventType = 12
+)
+
+// defaultPlayerGrace is how long a disconnected player is kept when no grace is given
+const defaultPlayerGrace = 60 * time.Second
+
+// PlayerIdentity identifies a player across connections, e.g. "steam:76561197960287930"
+type PlayerIdentity string
+
+// SteamIdentity returns the identity of a Steam user
+func SteamIdentity(steamID SteamID) PlayerIdentity {
+	return PlayerIdentity("steam:" + strconv.FormatUint(uint64(steamID), 10))
+}
+
+// Player is a player known to the server's registry
+type Player struct {
+	Identity     PlayerIdentity
+	Connection   ConnectionHandle // The player's current connection, or the last one while away
+	Connected    bool
+	Entity       EntityID // Set with SetPlayerEntity; kept while the player is away
+	Joined       time.Time
+	Disconnected time.Time // When the player went away, while not Connected
+	Rejoins      int
+}
+
+// PlayerVerifier checks the token a client sent with SetPlayerIdentity and returns the
+// player it identifies, e.g. the account a login service issued the token for
+type PlayerVerifier func(conn ConnectionHandle, token string) (PlayerIdentity, error)
+
+// PlayerRegistryConfig sets up a server's player registry
+type PlayerRegistryConfig struct {
+	Grace time.Duration // How long a disconnected player's entity is kept for them; 0 is 60s
+	// Verify turns tokens into identities. nil trusts the token as the identity, which is
+	// only safe for tokens nobody could guess, e.g. ones the server issued itself.
+	Verify PlayerVerifier
+}
+
+// PlayerJoinedEvent is returned on a server when a player it doesn't know identifies itself
+type PlayerJoinedEvent struct {
+	Connection ConnectionHandle
+	Identity   PlayerIdentity
+}
+
+func (e PlayerJoinedEvent) Type() NetworkEventType { return NetworkEventPlayerJoined }
+
+// PlayerRejoinedEvent is returned on a server when a player comes back within the grace
+// window, or signs in again from a new connection, which replaces the old one. Entity is
+// still theirs: hand control of it to Connection.
+type PlayerRejoinedEvent struct {
+	Connection ConnectionHandle
+	Previous   ConnectionHandle
+	Identity   PlayerIdentity
+	Entity     EntityID
+	Away       time.Duration // 0 when the old connection was still open
+}
+
+func (e PlayerRejoinedEvent) Type() NetworkEventType { return NetworkEventPlayerRejoined }
+
+// PlayerLeftEvent is returned on a server once a disconnected player's grace window passes
+// without them coming back, e.g. to despawn their entity
+type PlayerLeftEvent struct {
+	Connection ConnectionHandle // The player's last connection
+	Identity   PlayerIdentity
+	Entity     EntityID
+}
+
+func (e PlayerLeftEvent) Type() NetworkEventType { return NetworkEventPlayerLeft }
+
+// playerState is the session's player registry on a server, and the identity a client
+// presents
+type playerState struct {
+	// Server side
+	enabled bool
+	config  PlayerRegistryConfig
+	players map[PlayerIdentity]*Player
+	byConn  map[ConnectionHandle]PlayerIdentity
+	events  []NetworkEvent
+
+	// Client side
+	token string
+}
+
+func (ns *NetworkSession) ensurePlayers() *playerState {
+	if ns.players == nil {
+		ns.players = &playerState{
+			players: make(map[PlayerIdentity]*Player),
+			byConn:  make(map[ConnectionHandle]PlayerIdentity),
+		}
+		ns.addConnectionObserver(ns.observePlayerConnection)
+	}
+	return ns.players
+}
+
+// EnablePlayerRegistry makes the server track players by identity rather than by
+// connection: Steam users by their authenticated Steam ID, others by the token their client
+// sends with SetPlayerIdentity. A player who disconnects keeps their entity for the grace
+// window; coming back on any new connection within it gives a PlayerRejoinedEvent instead
+// of a PlayerJoinedEvent.
+func (ns *NetworkSession) EnablePlayerRegistry(config PlayerRegistryConfig) error {
+	if ns.handle == nil {
+		return errSessionNotInitialized
+	}
+	if config.Grace <= 0 {
+		config.Grace = defaultPlayerGrace
+	}
+
+	ps := ns.ensurePlayers()
+	ps.enabled = true
+	ps.config = config
+	ns.setControlHandler(controlPlayerIdentity, ns.handlePlayerIdentity)
+	return nil
+}
+
+// SetPlayerIdentity makes the client identify itself to servers with token, e.g. an auth
+// token from a login service, on every connection it makes, reconnects included. Clients
+// signed in to Steam don't need one.
+func (ns *NetworkSession) SetPlayerIdentity(token string) error {
+	if ns.handle == nil {
+		return errSessionNotInitialized
+	}
+
+	ps := ns.ensurePlayers()
+	ps.token = token
+	if token == "" {
+		return nil
+	}
+	for _, conn := range ns.openConnections() {
+		ns.sendPlayerIdentity(conn)
+	}
+	return nil
+}
+
+// GetPlayerByIdentity returns the registered player with an identity, connected or within
+// their grace window
+func (ns *NetworkSession) GetPlayerByIdentity(identity PlayerIdentity) (Player, bool) {
+	if ns.players == nil {
+		return Player{}, false
+	}
+	player, ok := ns.players.players[identity]
+	if !ok {
+		return Player{}, false
+	}
+	return *player, true
+}
+
+// GetPlayer returns the player on a connection
+func (ns *NetworkSession) GetPlayer(conn ConnectionHandle) (Player, bool) {
+	if ns.players == nil {
+		return Player{}, false
+	}
+	identity, ok := ns.players.byConn[conn]
+	if !ok {
+		return Player{}, false
+	}
+	return ns.GetPlayerByIdentity(identity)
+}
+
+// GetPlayers returns every registered player
+func (ns *NetworkSession) GetPlayers() []Player {
+	if ns.players == nil {
+		return nil
+	}
+	players := make([]Player, 0, len(ns.players.players))
+	for _, player := range ns.players.players {
+		players = append(players, *player)
+	}
+	return players
+}
+
+// SetPlayerEntity records the entity a player controls, to be handed back when they rejoin
+func (ns *NetworkSession) SetPlayerEntity(identity PlayerIdentity, entity EntityID) error {
+	if ns.players == nil {
+		return errors.New("player registry not enabled")
+	}
+	player, ok := ns.players.players[identity]
+	if !ok {
+		return errors.New("unknown player")
+	}
+	player.Entity = entity
+	return nil
+}
+
+// RemovePlayer forgets a player straight away, without a PlayerLeftEvent
+func (ns *NetworkSession) RemovePlayer(identity PlayerIdentity) {
+	ps := ns.players
+	if ps == nil {
+		return
+	}
+	if player, ok := ps.players[identity]; ok {
+		delete(ps.byConn, player.Connection)
+		delete(ps.players, identity)
+	}
+}
+
+// sendPlayerIdentity presents the client's identity token on a connection
+func (ns *NetworkSession) sendPlayerIdentity(conn ConnectionHandle) {
+	if err := ns.sendControl(conn, controlPlayerIdentity, []byte(ns.players.token), true); err != nil {
+		LogError(fmt.Sprintf("Failed to send player identity on connection %d: %v", conn, err))
+	}
+}
+
+// observePlayerConnection identifies Steam players as they connect, sends the client's
+// token, and starts the grace window of players who disconnect
+func (ns *NetworkSession) observePlayerConnection(event NetworkEvent) {
+	ps := ns.players
+	switch e := event.(type) {
+	case ConnectedEvent:
+		if ps.token != "" {
+			ns.sendPlayerIdentity(e.Connection)
+		}
+		if !ps.enabled {
+			return
+		}
+		if steamID := SteamID(C.boulder_get_remote_steam_id(ns.handle, C.ConnectionHandle(e.Connection))); steamID != 0 {
+			ns.registerPlayer(e.Connection, SteamIdentity(steamID))
+		}
+
+	case DisconnectedEvent:
+		identity, ok := ps.byConn[e.Connection]
+		if !ok {
+			return
+		}
+		delete(ps.byConn, e.Connection)
+		if player := ps.players[identity]; player != nil && player.Connection == e.Connection {
+			player.Connected = false
+			player.Disconnected = time.Now()
+		}
+	}
+}
+
+// handlePlayerIdentity registers the player a client's token identifies
+func (ns *NetworkSession) handlePlayerIdentity(conn ConnectionHandle, payload []byte, timestamp float64) {
+	ps := ns.players
+	if ps == nil || !ps.enabled || len(payload) == 0 {
+		return
+	}
+	if _, known := ps.byConn[conn]; known {
+		return // Steam already identified it
+	}
+
+	identity := PlayerIdentity(payload)
+	if ps.config.Verify != nil {
+		verified, err := ps.config.Verify(conn, string(payload))
+		if err != nil || verified == "" {
+			LogError(fmt.Sprintf("Rejected player identity on connection %d: %v", conn, err))
+			ns.closeWithReason(conn, "Player identity rejected")
+			ns.notifyConnectionObservers(DisconnectedEvent{Connection: conn})
+			ps.events = append(ps.events, DisconnectedEvent{Connection: conn})
+			return
+		}
+		identity = verified
+	}
+	ns.registerPlayer(conn, identity)
+}
+
+// registerPlayer ties a connection to a player, taking over their previous connection
+func (ns *NetworkSession) registerPlayer(conn ConnectionHandle, identity PlayerIdentity) {
+	ps := ns.players
+	now := time.Now()
+	ps.byConn[conn] = identity
+
+	player, ok := ps.players[identity]
+	if !ok {
+		ps.players[identity] = &Player{Identity: identity, Connection: conn, Connected: true, Joined: now}
+		ps.events = append(ps.events, PlayerJoinedEvent{Connection: conn, Identity: identity})
+		return
+	}
+
+	previous := player.Connection
+	var away time.Duration
+	if player.Connected {
+		// Signed in again elsewhere: the new connection wins
+		delete(ps.byConn, previous)
+		ns.closeWithReason(previous, "Signed in from another connection")
+		ns.notifyConnectionObservers(DisconnectedEvent{Connection: previous})
+		ps.events = append(ps.events, DisconnectedEvent{Connection: previous})
+	} else {
+		away = now.Sub(player.Disconnected)
+	}
+
+	player.Connection = conn
+	player.Connected = true
+	player.Disconnected = time.Time{}
+	player.Rejoins++
+	LogInfo(fmt.Sprintf("Player %s rejoined on connection %d (was %d)", identity, conn, previous))
+	ps.events = append(ps.events, PlayerRejoinedEvent{
+		Connection: conn,
+		Previous:   previous,
+		Identity:   identity,
+		Entity:     player.Entity,
+		Away:       away,
+	})
+}
+
+// updatePlayers lets go of players whose grace window has passed
+func (ns *NetworkSession) updatePlayers() {
+	ps := ns.players
+	if ps == nil || !ps.enabled {
+		return
+	}
+
+	now := time.Now()
+	for identity, player := range ps.players {
+		if player.Connected || now.Sub(player.Disconnected) < ps.config.Grace {
+			continue
+		}
+		delete(ps.players, identity)
+		ps.events = append(ps.events, PlayerLeftEvent{Connection: player.Connection, Identity: identity, Entity: player.Entity})
+	}
+}
+
+// takePlayerEvent returns the oldest player event not yet polled
+func (ns *NetworkSession) takePlayerEvent() NetworkEvent {
+	ps := ns.players
+	if ps == nil || len(ps.events) == 0 {
+		return nil
+	}
+	event := ps.events[0]
+	ps.events = ps.events[1:]
+	return event
+}
@@ -0,0 +1,204 @@
+package boulder
+
+import "errors"
+
+// Prefab is an entity template registered once with World.RegisterPrefab and spawned as
+// many times as needed with World.Spawn. In scene files prefabs are written like entities,
+// under "prefabs", and an entity with "prefab" starts from one.
+type Prefab struct {
+	Model    string  // Model file; relative paths are from the working directory
+	Rotation Vector3 // Radians
+	Scale    Vector3 // Zero is 1, 1, 1
+	Mass     float32 // Above 0 adds a physics body
+	Velocity Vector3 // Starting velocity of the physics body
+	Collider *Collider
+	Light    *Light
+	Layers   uint32 // 0 leaves LayerDefault
+	Tags     []string
+}
+
+// prefabState is the world's prefabs and the prefab each instance was spawned from
+type prefabState struct {
+	templates map[string]sceneFileEntity // Model paths usable as they are
+	instances map[EntityID]string
+}
+
+func (w *World) prefabState() *prefabState {
+	if w.prefabs == nil {
+		w.prefabs = &prefabState{
+			templates: make(map[string]sceneFileEntity),
+			instances: make(map[EntityID]string),
+		}
+	}
+	return w.prefabs
+}
+
+// RegisterPrefab adds a prefab to the world under a name, replacing any prefab of that name.
+// Entities already spawned from the old one keep their components.
+func (w *World) RegisterPrefab(name string, prefab Prefab) error {
+	if name == "" {
+		return errors.New("prefab name is empty")
+	}
+
+	desc := sceneFileEntity{
+		Rotation: [3]float32{prefab.Rotation.X, prefab.Rotation.Y, prefab.Rotation.Z},
+		Model:    prefab.Model,
+		Mass:     prefab.Mass,
+		Layers:   prefab.Layers,
+		Tags:     prefab.Tags,
+	}
+	if prefab.Scale != (Vector3{}) {
+		desc.Scale = &[3]float32{prefab.Scale.X, prefab.Scale.Y, prefab.Scale.Z}
+	}
+	if prefab.Velocity != (Vector3{}) {
+		desc.Velocity = &[3]float32{prefab.Velocity.X, prefab.Velocity.Y, prefab.Velocity.Z}
+	}
+	if prefab.Collider != nil {
+		if desc.Collider = sceneColliderOf(*prefab.Collider); desc.Collider == nil {
+			return errors.New("unknown collider shape")
+		}
+	}
+	if prefab.Light != nil {
+		if desc.Light = sceneLightOf(*prefab.Light); desc.Light == nil {
+			return errors.New("unknown light type")
+		}
+	}
+
+	w.prefabState().templates[name] = desc
+	return nil
+}
+
+// LoadPrefabs registers every prefab in a scene file, e.g. a library of them kept apart
+// from the levels that use them. Its entities are ignored.
+func (w *World) LoadPrefabs(path string) error {
+	file, err := parseSceneFile(path)
+	if err != nil {
+		return err
+	}
+	return w.registerScenePrefabs(file)
+}
+
+// HasPrefab returns whether a prefab is registered under a name
+func (w *World) HasPrefab(name string) bool {
+	if w.prefabs == nil {
+		return false
+	}
+	_, ok := w.prefabs.templates[name]
+	return ok
+}
+
+// GetEntityPrefab returns the name of the prefab an entity was spawned from, "" if none
+func (w *World) GetEntityPrefab(entity EntityID) string {
+	if w.prefabs == nil {
+		return ""
+	}
+	return w.prefabs.instances[entity]
+}
+
+// Spawn creates an entity from a prefab at a position, loading its model before it returns
+func (w *World) Spawn(name string, position Vector3) (*Entity, error) {
+	if !w.ready() {
+		return nil, errNotInitialized
+	}
+
+	desc, ok := w.prefabState().templates[name]
+	if !ok {
+		return nil, errors.New("unknown prefab: " + name)
+	}
+	desc.Prefab = name
+	desc.Position = [3]float32{position.X, position.Y, position.Z}
+
+	entity, err := w.NewEntity()
+	if err != nil {
+		return nil, err
+	}
+	err = setSceneTransform(entity, desc)
+	if err == nil && desc.Model != "" {
+		err = entity.LoadModel(desc.Model)
+	}
+	if err == nil {
+		err = addSceneComponents(entity, desc)
+	}
+	if err != nil {
+		w.DestroyEntity(entity.ID)
+		return nil, err
+	}
+	return entity, nil
+}
+
+// registerScenePrefabs registers the prefabs of a parsed scene file
+func (w *World) registerScenePrefabs(file *sceneFile) error {
+	for name, desc := range file.Prefabs {
+		if name == "" {
+			return errors.New("prefab name is empty")
+		}
+		if desc.Prefab != "" {
+			return errors.New("prefab " + name + " can't be based on another prefab")
+		}
+	}
+
+	ps := w.prefabState()
+	for name, desc := range file.Prefabs {
+		ps.templates[name] = desc
+	}
+	return nil
+}
+
+// expandScene registers a scene file's prefabs and returns its entities with the prefabs
+// they name filled in
+func (w *World) expandScene(file *sceneFile) ([]sceneFileEntity, error) {
+	if err := w.registerScenePrefabs(file); err != nil {
+		return nil, err
+	}
+
+	descs := make([]sceneFileEntity, 0, len(file.Entities))
+	for _, desc := range file.Entities {
+		if desc.Prefab == "" {
+			descs = append(descs, desc)
+			continue
+		}
+		prefab, ok := w.prefabState().templates[desc.Prefab]
+		if !ok {
+			return nil, errors.New("unknown prefab: " + desc.Prefab)
+		}
+		descs = append(descs, applyPrefab(prefab, desc))
+	}
+	return descs, nil
+}
+
+// applyPrefab returns a scene entity based on a prefab, overriding the fields it sets. A
+// zero rotation keeps the prefab's.
+func applyPrefab(prefab, desc sceneFileEntity) sceneFileEntity {
+	merged := prefab
+	merged.Name = desc.Name
+	merged.Prefab = desc.Prefab
+	merged.Position = desc.Position
+	if desc.Rotation != ([3]float32{}) {
+		merged.Rotation = desc.Rotation
+	}
+	if desc.Scale != nil {
+		merged.Scale = desc.Scale
+	}
+	if desc.Model != "" {
+		merged.Model = desc.Model
+	}
+	if desc.Mass != 0 {
+		merged.Mass = desc.Mass
+	}
+	if desc.Velocity != nil {
+		merged.Velocity = desc.Velocity
+	}
+	if desc.Collider != nil {
+		merged.Collider = desc.Collider
+	}
+	if desc.Light != nil {
+		merged.Light = desc.Light
+	}
+	if desc.Layers != 0 {
+		merged.Layers = desc.Layers
+	}
+	if len(desc.Tags) > 0 {
+		merged.Tags = desc.Tags
+	}
+	return merged
+}
@@ -0,0 +1,386 @@
+package boulder
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// ProjectileMode selects who decides what a projectile hits
+type ProjectileMode int
+
+const (
+	// ProjectileModeLocal simulates projectiles and reports impacts (single player)
+	ProjectileModeLocal ProjectileMode = 0
+	// ProjectileModeServer simulates projectiles authoritatively, reports impacts and
+	// replicates projectile entities when a ReplicationServer is attached
+	ProjectileModeServer ProjectileMode = 1
+	// ProjectileModeClient simulates projectiles for rendering only; they stop on contact
+	// but never report impacts, which come from the server
+	ProjectileModeClient ProjectileMode = 2
+)
+
+// DefaultProjectileLifetime is how long a projectile flies before it is removed
+const DefaultProjectileLifetime = 5 * time.Second
+
+// ProjectileSettings describes how a projectile flies
+type ProjectileSettings struct {
+	Gravity   float32       // Downward acceleration in m/s^2
+	Drag      float32       // Fraction of velocity lost per second
+	Radius    float32       // Collision radius; zero is a ray
+	Lifetime  time.Duration // Removed after this long without hitting anything
+	Damage    float32       // Carried to impact events
+	Model     string        // Optional model drawn at the projectile
+	Archetype string        // Replication archetype in ProjectileModeServer; empty is not replicated
+}
+
+// DefaultProjectileSettings returns settings for a fast bullet
+func DefaultProjectileSettings() ProjectileSettings {
+	return ProjectileSettings{
+		Gravity:  9.81,
+		Drag:     0.05,
+		Lifetime: DefaultProjectileLifetime,
+		Damage:   10,
+	}
+}
+
+// RaycastHit is the result of a swept test
+type RaycastHit struct {
+	Entity   EntityID
+	Point    Vector3
+	Normal   Vector3
+	Fraction float32 // Position of the hit along the segment (0-1)
+}
+
+// RaycastFunc tests the segment from..to, inflated by radius, against the game's
+// collision geometry, ignoring the entity that fired the projectile
+type RaycastFunc func(from, to Vector3, radius float32, ignore EntityID) (RaycastHit, bool)
+
+// Projectile is a projectile in flight
+type Projectile struct {
+	ID       uint32
+	Owner    EntityID
+	Position Vector3
+	Velocity Vector3
+	Settings ProjectileSettings
+
+	entity *Entity
+	age    time.Duration
+	alive  bool
+}
+
+// GetEntity returns the entity drawing the projectile, or nil if it has none
+func (p *Projectile) GetEntity() *Entity {
+	return p.entity
+}
+
+// IsAlive returns true while the projectile is in flight
+func (p *Projectile) IsAlive() bool {
+	return p.alive
+}
+
+// ProjectileImpact is a projectile hitting something
+type ProjectileImpact struct {
+	Projectile *Projectile
+	Entity     EntityID
+	Point      Vector3
+	Normal     Vector3
+	Velocity   Vector3 // Velocity at the moment of impact
+}
+
+// ImpactCallback is called when a projectile hits something
+type ImpactCallback func(impact ProjectileImpact)
+
+type projectileTarget struct {
+	entity *Entity
+	radius float32
+}
+
+// Projectiles simulates projectiles with swept collision, so fast projectiles can't pass
+// through thin targets between ticks. Collision is tested against targets registered with
+// AddTarget and against an optional RaycastFunc for level geometry.
+type Projectiles struct {
+	world       *World
+	mode        ProjectileMode
+	replication *ReplicationServer
+	raycast     RaycastFunc
+	onImpact    ImpactCallback
+
+	nextID      uint32
+	projectiles []*Projectile
+	targets     map[EntityID]projectileTarget
+	impacts     []ProjectileImpact
+}
+
+// NewProjectiles creates a projectile system for a world
+func NewProjectiles(world *World, mode ProjectileMode) *Projectiles {
+	return &Projectiles{
+		world:   world,
+		mode:    mode,
+		targets: make(map[EntityID]projectileTarget),
+	}
+}
+
+// GetMode returns the projectile mode
+func (ps *Projectiles) GetMode() ProjectileMode {
+	return ps.mode
+}
+
+// SetReplicationServer replicates projectile entities in ProjectileModeServer
+func (ps *Projectiles) SetReplicationServer(server *ReplicationServer) {
+	ps.replication = server
+}
+
+// SetRaycaster sets the function used to test projectiles against level geometry
+func (ps *Projectiles) SetRaycaster(raycast RaycastFunc) {
+	ps.raycast = raycast
+}
+
+// OnImpact sets the callback run for each impact. Impacts are also queued for PollImpacts.
+func (ps *Projectiles) OnImpact(callback ImpactCallback) {
+	ps.onImpact = callback
+}
+
+// AddTarget makes an entity hittable as a sphere around its transform
+func (ps *Projectiles) AddTarget(entity EntityID, radius float32) error {
+	if radius <= 0 {
+		return errors.New("target radius must be positive")
+	}
+	ps.targets[entity] = projectileTarget{entity: &Entity{ID: entity, world: ps.world}, radius: radius}
+	return nil
+}
+
+// RemoveTarget stops an entity being hit by projectiles
+func (ps *Projectiles) RemoveTarget(entity EntityID) {
+	delete(ps.targets, entity)
+}
+
+// Spawn fires a projectile from position. owner is never hit by its own projectiles.
+func (ps *Projectiles) Spawn(owner EntityID, position, velocity Vector3, settings ProjectileSettings) (*Projectile, error) {
+	if settings.Lifetime <= 0 {
+		return nil, errors.New("projectile lifetime must be positive")
+	}
+
+	ps.nextID++
+	p := &Projectile{
+		ID:       ps.nextID,
+		Owner:    owner,
+		Position: position,
+		Velocity: velocity,
+		Settings: settings,
+		alive:    true,
+	}
+
+	if settings.Model != "" || (ps.mode == ProjectileModeServer && settings.Archetype != "") {
+		entity, err := ps.createEntity(p)
+		if err != nil {
+			return nil, err
+		}
+		p.entity = entity
+	}
+
+	ps.projectiles = append(ps.projectiles, p)
+	return p, nil
+}
+
+// Remove takes a projectile out of flight without an impact
+func (ps *Projectiles) Remove(p *Projectile) {
+	ps.kill(p)
+	ps.compact()
+}
+
+// Update advances every projectile by dt seconds, testing the path it travels this tick
+func (ps *Projectiles) Update(dt float32) {
+	step := time.Duration(float64(dt) * float64(time.Second))
+
+	for _, p := range ps.projectiles {
+		if !p.alive {
+			continue
+		}
+
+		p.Velocity.Y -= p.Settings.Gravity * dt
+		drag := max(0, 1-p.Settings.Drag*dt)
+		p.Velocity = Vector3{p.Velocity.X * drag, p.Velocity.Y * drag, p.Velocity.Z * drag}
+		next := Vector3{
+			X: p.Position.X + p.Velocity.X*dt,
+			Y: p.Position.Y + p.Velocity.Y*dt,
+			Z: p.Position.Z + p.Velocity.Z*dt,
+		}
+
+		if hit, ok := ps.sweep(p, p.Position, next); ok {
+			p.Position = hit.Point
+			ps.impact(p, hit)
+			continue
+		}
+
+		p.Position = next
+		p.age += step
+		if p.age >= p.Settings.Lifetime {
+			ps.kill(p)
+			continue
+		}
+
+		if p.entity != nil {
+			p.entity.SetTransform(p.Position)
+		}
+	}
+
+	ps.compact()
+}
+
+// PollImpacts returns the impacts since the last call
+func (ps *Projectiles) PollImpacts() []ProjectileImpact {
+	impacts := ps.impacts
+	ps.impacts = nil
+	return impacts
+}
+
+// GetProjectiles returns the projectiles in flight
+func (ps *Projectiles) GetProjectiles() []*Projectile {
+	return ps.projectiles
+}
+
+// sweep finds the first thing hit on the segment from..to
+func (ps *Projectiles) sweep(p *Projectile, from, to Vector3) (RaycastHit, bool) {
+	var best RaycastHit
+	found := false
+
+	for id, target := range ps.targets {
+		if id == p.Owner {
+			continue
+		}
+		center, err := target.entity.GetTransform()
+		if err != nil {
+			continue
+		}
+
+		fraction, ok := sweepSphere(from, to, center, target.radius+p.Settings.Radius)
+		if ok && (!found || fraction < best.Fraction) {
+			point := lerpVector(from, to, fraction)
+			best = RaycastHit{
+				Entity:   id,
+				Point:    point,
+				Normal:   normalizeVector(Vector3{point.X - center.X, point.Y - center.Y, point.Z - center.Z}),
+				Fraction: fraction,
+			}
+			found = true
+		}
+	}
+
+	if ps.raycast != nil {
+		if hit, ok := ps.raycast(from, to, p.Settings.Radius, p.Owner); ok && (!found || hit.Fraction < best.Fraction) {
+			best, found = hit, true
+		}
+	}
+
+	return best, found
+}
+
+func (ps *Projectiles) impact(p *Projectile, hit RaycastHit) {
+	if ps.mode != ProjectileModeClient {
+		impact := ProjectileImpact{
+			Projectile: p,
+			Entity:     hit.Entity,
+			Point:      hit.Point,
+			Normal:     hit.Normal,
+			Velocity:   p.Velocity,
+		}
+		ps.impacts = append(ps.impacts, impact)
+		if ps.onImpact != nil {
+			runCallback("OnImpact", func() { ps.onImpact(impact) })
+		}
+	}
+	ps.kill(p)
+}
+
+func (ps *Projectiles) kill(p *Projectile) {
+	if !p.alive {
+		return
+	}
+	p.alive = false
+
+	if p.entity != nil {
+		if ps.replication != nil && ps.replication.IsReplicated(p.entity.ID) {
+			ps.replication.DestroyEntity(p.entity.ID)
+		} else {
+			p.entity.Destroy()
+		}
+		p.entity = nil
+	}
+}
+
+// compact drops dead projectiles
+func (ps *Projectiles) compact() {
+	alive := ps.projectiles[:0]
+	for _, p := range ps.projectiles {
+		if p.alive {
+			alive = append(alive, p)
+		}
+	}
+	clear(ps.projectiles[len(alive):])
+	ps.projectiles = alive
+}
+
+func (ps *Projectiles) createEntity(p *Projectile) (*Entity, error) {
+	entity, err := ps.world.NewEntity()
+	if err != nil {
+		return nil, err
+	}
+	if err := entity.AddTransform(p.Position); err != nil {
+		entity.Destroy()
+		return nil, err
+	}
+	if p.Settings.Model != "" {
+		if err := entity.LoadModel(p.Settings.Model); err != nil {
+			entity.Destroy()
+			return nil, err
+		}
+	}
+	if ps.mode == ProjectileModeServer && ps.replication != nil && p.Settings.Archetype != "" {
+		if err := ps.replication.Replicate(entity, p.Settings.Archetype); err != nil {
+			entity.Destroy()
+			return nil, err
+		}
+	}
+	return entity, nil
+}
+
+// sweepSphere returns where along from..to the segment first enters a sphere
+func sweepSphere(from, to, center Vector3, radius float32) (float32, bool) {
+	d := Vector3{to.X - from.X, to.Y - from.Y, to.Z - from.Z}
+	m := Vector3{from.X - center.X, from.Y - center.Y, from.Z - center.Z}
+
+	c := m.X*m.X + m.Y*m.Y + m.Z*m.Z - radius*radius
+	if c <= 0 {
+		return 0, true // Starts inside
+	}
+
+	a := d.X*d.X + d.Y*d.Y + d.Z*d.Z
+	b := m.X*d.X + m.Y*d.Y + m.Z*d.Z
+	if a == 0 || b > 0 {
+		return 0, false
+	}
+
+	disc := b*b - a*c
+	if disc < 0 {
+		return 0, false
+	}
+
+	t := (-b - float32(math.Sqrt(float64(disc)))) / a
+	if t > 1 {
+		return 0, false
+	}
+	return max(0, t), true
+}
+
+func lerpVector(a, b Vector3, t float32) Vector3 {
+	return Vector3{a.X + (b.X-a.X)*t, a.Y + (b.Y-a.Y)*t, a.Z + (b.Z-a.Z)*t}
+}
+
+func normalizeVector(v Vector3) Vector3 {
+	length := vectorLength(v)
+	if length == 0 {
+		return Vector3{}
+	}
+	return Vector3{v.X / length, v.Y / length, v.Z / length}
+}
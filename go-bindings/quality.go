@@ -0,0 +1,282 @@
+package boulder
+
+import (
+	"errors"
+	"time"
+)
+
+// QualityTier is one preset of quality settings. The manager applies LODBias itself; the
+// other settings are for the game's own systems (shadows, particles, render targets) to
+// read when the tier changes.
+type QualityTier struct {
+	Name             string
+	ShadowResolution int     // Shadow map size in pixels
+	ParticleBudget   int     // Most live particles
+	LODBias          int     // Added to every model's LOD (Renderer.SetLODBias)
+	RenderScale      float32 // Fraction of the window resolution to render at
+}
+
+// DefaultQualityTiers returns Low, Medium, High and Ultra tiers, lowest first
+func DefaultQualityTiers() []QualityTier {
+	return []QualityTier{
+		{Name: "Low", ShadowResolution: 512, ParticleBudget: 1000, LODBias: 2, RenderScale: 0.5},
+		{Name: "Medium", ShadowResolution: 1024, ParticleBudget: 4000, LODBias: 1, RenderScale: 0.75},
+		{Name: "High", ShadowResolution: 2048, ParticleBudget: 10000, LODBias: 0, RenderScale: 1},
+		{Name: "Ultra", ShadowResolution: 4096, ParticleBudget: 20000, LODBias: 0, RenderScale: 1},
+	}
+}
+
+// QualityChangeReason is why the quality tier changed
+type QualityChangeReason int
+
+const (
+	QualityDowngraded QualityChangeReason = 0 // Frames took longer than the target
+	QualityUpgraded   QualityChangeReason = 1 // Frames had headroom to spare
+	QualityManual     QualityChangeReason = 2 // SetTier or SetBounds
+)
+
+// QualityChangeEvent reports a quality tier change. Tiers are indexes into the manager's
+// tiers; the frame times are the smoothed times that caused the change.
+type QualityChangeEvent struct {
+	From    int
+	To      int
+	Tier    QualityTier
+	Reason  QualityChangeReason
+	CPUTime time.Duration
+	GPUTime time.Duration
+}
+
+// QualityCallback is called when the quality tier changes
+type QualityCallback func(event QualityChangeEvent)
+
+// Hitches longer than this (loading, a dragged window) don't count towards a change
+const qualityMaxFrameTime = 250 * time.Millisecond
+
+// Most times the upgrade wait doubles when upgrades keep failing
+const qualityMaxBackoff = 8
+
+// QualityManager steps between quality tiers to hold a target frame time. The slower of
+// the CPU and GPU frame times is smoothed; a tier is dropped when it stays over the target
+// and raised when it stays well under it. Upgrades that get undone straight away make the
+// next upgrade wait longer, so the quality doesn't flicker between two tiers.
+type QualityManager struct {
+	renderer *Renderer
+	tiers    []QualityTier
+	tier     int
+	minTier  int
+	maxTier  int
+	enabled  bool
+
+	target         time.Duration
+	headroom       float64
+	downgradeAfter time.Duration
+	upgradeAfter   time.Duration
+
+	cpu         time.Duration // Smoothed frame times
+	gpu         time.Duration
+	slow        time.Duration // How long frames have been over the target
+	fast        time.Duration // How long frames have had headroom
+	settle      time.Duration // Frame times are ignored until the last change shows up
+	backoff     int
+	lastUpgrade bool
+
+	callbacks []QualityCallback
+}
+
+// NewQualityManager creates a manager for tiers ordered lowest first, starting at the
+// highest tier. Pass DefaultQualityTiers() for the built-in presets.
+func NewQualityManager(renderer *Renderer, tiers []QualityTier) (*QualityManager, error) {
+	if renderer == nil {
+		return nil, errors.New("renderer is nil")
+	}
+	if len(tiers) == 0 {
+		return nil, errors.New("no quality tiers")
+	}
+
+	q := &QualityManager{
+		renderer:       renderer,
+		tiers:          append([]QualityTier(nil), tiers...),
+		tier:           len(tiers) - 1,
+		maxTier:        len(tiers) - 1,
+		enabled:        true,
+		target:         time.Second / 60,
+		headroom:       0.75,
+		downgradeAfter: time.Second,
+		upgradeAfter:   5 * time.Second,
+		backoff:        1,
+	}
+	q.apply()
+	return q, nil
+}
+
+// SetTargetFrameTime sets the frame time to hold (default 1/60 s)
+func (q *QualityManager) SetTargetFrameTime(target time.Duration) {
+	if target > 0 {
+		q.target = target
+	}
+}
+
+// SetHeadroom sets the fraction of the target frames must stay under to raise the tier
+// (default 0.75)
+func (q *QualityManager) SetHeadroom(fraction float64) {
+	if fraction > 0 && fraction < 1 {
+		q.headroom = fraction
+	}
+}
+
+// SetDelays sets how long frames must stay over the target before the tier drops (default
+// 1 s) and under the headroom before it rises (default 5 s)
+func (q *QualityManager) SetDelays(downgradeAfter, upgradeAfter time.Duration) {
+	q.downgradeAfter = downgradeAfter
+	q.upgradeAfter = upgradeAfter
+}
+
+// SetEnabled turns automatic changes on or off. SetTier still works while disabled.
+func (q *QualityManager) SetEnabled(enabled bool) {
+	q.enabled = enabled
+	q.resetTimers()
+}
+
+// IsEnabled returns whether the tier changes automatically
+func (q *QualityManager) IsEnabled() bool {
+	return q.enabled
+}
+
+// SetBounds limits the tiers the manager may pick, e.g. from the game's settings menu.
+// The current tier is moved into the bounds.
+func (q *QualityManager) SetBounds(minTier, maxTier int) error {
+	if minTier < 0 || maxTier >= len(q.tiers) || minTier > maxTier {
+		return errors.New("invalid quality tier bounds")
+	}
+
+	q.minTier = minTier
+	q.maxTier = maxTier
+	q.backoff = 1
+	if q.tier < minTier {
+		q.change(minTier, QualityManual)
+	} else if q.tier > maxTier {
+		q.change(maxTier, QualityManual)
+	}
+	return nil
+}
+
+// GetBounds returns the lowest and highest tiers the manager may pick
+func (q *QualityManager) GetBounds() (int, int) {
+	return q.minTier, q.maxTier
+}
+
+// SetTier switches to a tier within the bounds
+func (q *QualityManager) SetTier(tier int) error {
+	if tier < q.minTier || tier > q.maxTier {
+		return errors.New("quality tier out of bounds")
+	}
+
+	q.backoff = 1
+	if tier != q.tier {
+		q.change(tier, QualityManual)
+	}
+	return nil
+}
+
+// GetTier returns the index of the current tier
+func (q *QualityManager) GetTier() int {
+	return q.tier
+}
+
+// GetCurrentTier returns the current tier's settings
+func (q *QualityManager) GetCurrentTier() QualityTier {
+	return q.tiers[q.tier]
+}
+
+// GetTiers returns all tiers, lowest first
+func (q *QualityManager) GetTiers() []QualityTier {
+	return append([]QualityTier(nil), q.tiers...)
+}
+
+// GetFrameTimes returns the smoothed CPU and GPU frame times the manager is acting on
+func (q *QualityManager) GetFrameTimes() (cpu, gpu time.Duration) {
+	return q.cpu, q.gpu
+}
+
+// OnQualityChanged calls fn whenever the tier changes, e.g. to update a settings screen
+// or resize shadow maps
+func (q *QualityManager) OnQualityChanged(fn QualityCallback) {
+	if fn != nil {
+		q.callbacks = append(q.callbacks, fn)
+	}
+}
+
+// Update samples the last frame's times and changes tier if needed (call every frame with
+// the engine delta time)
+func (q *QualityManager) Update(deltaTime float32) {
+	dt := time.Duration(float64(deltaTime) * float64(time.Second))
+	if dt <= 0 || dt > qualityMaxFrameTime {
+		return
+	}
+
+	times := q.renderer.GetFrameTimes()
+	if q.cpu == 0 && q.gpu == 0 {
+		q.cpu, q.gpu = times.CPU, times.GPU
+	} else {
+		q.cpu += (times.CPU - q.cpu) / 10
+		q.gpu += (times.GPU - q.gpu) / 10
+	}
+
+	if !q.enabled {
+		return
+	}
+	// GPU times arrive a few frames late, so the new tier needs time to show up
+	if q.settle > 0 {
+		q.settle -= dt
+		return
+	}
+
+	frame := max(q.cpu, q.gpu)
+	switch {
+	case frame > q.target:
+		q.slow += dt
+		q.fast = 0
+	case float64(frame) < float64(q.target)*q.headroom:
+		q.fast += dt
+		q.slow = 0
+	default:
+		q.slow, q.fast = 0, 0
+	}
+
+	if q.slow >= q.downgradeAfter && q.tier > q.minTier {
+		if q.lastUpgrade && q.backoff < qualityMaxBackoff {
+			q.backoff *= 2
+		}
+		q.change(q.tier-1, QualityDowngraded)
+	} else if q.fast >= q.upgradeAfter*time.Duration(q.backoff) && q.tier < q.maxTier {
+		q.change(q.tier+1, QualityUpgraded)
+	}
+}
+
+func (q *QualityManager) change(tier int, reason QualityChangeReason) {
+	event := QualityChangeEvent{
+		From:    q.tier,
+		To:      tier,
+		Tier:    q.tiers[tier],
+		Reason:  reason,
+		CPUTime: q.cpu,
+		GPUTime: q.gpu,
+	}
+	q.tier = tier
+	q.lastUpgrade = reason == QualityUpgraded
+	q.apply()
+	q.resetTimers()
+
+	for _, fn := range q.callbacks {
+		runCallback("OnQualityChanged", func() { fn(event) })
+	}
+}
+
+func (q *QualityManager) apply() {
+	q.renderer.SetLODBias(q.tiers[q.tier].LODBias)
+}
+
+func (q *QualityManager) resetTimers() {
+	q.slow, q.fast = 0, 0
+	q.settle = time.Second / 2
+}
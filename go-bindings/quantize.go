@@ -0,0 +1,442 @@
+package boulder
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// TransformState is the replicated portion of an entity transform
+type TransformState struct {
+	Position Vector3
+	Rotation Quaternion
+	Scale    Vector3
+}
+
+// QuantizedTransform is a TransformState reduced to integers
+type QuantizedTransform struct {
+	Position [3]uint32
+	Rotation uint32 // Smallest-three: 2 bit largest index + 3 x 10 bit components
+	Scale    [3]uint16
+}
+
+// QuantizationConfig describes the world bounds and precision used for quantization
+type QuantizationConfig struct {
+	WorldMin          Vector3
+	WorldMax          Vector3
+	PositionPrecision float32 // World units per step (0.001 = millimeters for meter units)
+	ScalePrecision    float32 // Scale units per step
+}
+
+// DefaultQuantizationConfig returns millimeter precision inside a 4 km cube centered on the origin
+func DefaultQuantizationConfig() QuantizationConfig {
+	return QuantizationConfig{
+		WorldMin:          Vector3{X: -2048, Y: -2048, Z: -2048},
+		WorldMax:          Vector3{X: 2048, Y: 2048, Z: 2048},
+		PositionPrecision: 0.001,
+		ScalePrecision:    0.001,
+	}
+}
+
+const (
+	rotationComponentBits = 10
+	rotationComponentMax  = (1 << rotationComponentBits) - 1
+	rotationRange         = 0.70710678 // 1/sqrt(2), the largest possible value of the non-largest components
+)
+
+// TransformCodec quantizes transforms and encodes them as deltas against a baseline
+type TransformCodec struct {
+	config QuantizationConfig
+}
+
+// NewTransformCodec creates a new transform codec
+func NewTransformCodec(config QuantizationConfig) *TransformCodec {
+	defaults := DefaultQuantizationConfig()
+	if config.PositionPrecision <= 0 {
+		config.PositionPrecision = defaults.PositionPrecision
+	}
+	if config.ScalePrecision <= 0 {
+		config.ScalePrecision = defaults.ScalePrecision
+	}
+	if config.WorldMax == (Vector3{}) && config.WorldMin == (Vector3{}) {
+		config.WorldMin = defaults.WorldMin
+		config.WorldMax = defaults.WorldMax
+	}
+
+	return &TransformCodec{config: config}
+}
+
+func quantizeFloat(v, min, max, precision float32) uint32 {
+	if v < min {
+		v = min
+	} else if v > max {
+		v = max
+	}
+	return uint32(math.Round((float64(v) - float64(min)) / float64(precision)))
+}
+
+func dequantizeFloat(q uint32, min, precision float32) float32 {
+	return float32(float64(min) + float64(q)*float64(precision))
+}
+
+// Quantize reduces a transform to integers
+func (tc *TransformCodec) Quantize(state TransformState) QuantizedTransform {
+	c := tc.config
+	var q QuantizedTransform
+
+	q.Position[0] = quantizeFloat(state.Position.X, c.WorldMin.X, c.WorldMax.X, c.PositionPrecision)
+	q.Position[1] = quantizeFloat(state.Position.Y, c.WorldMin.Y, c.WorldMax.Y, c.PositionPrecision)
+	q.Position[2] = quantizeFloat(state.Position.Z, c.WorldMin.Z, c.WorldMax.Z, c.PositionPrecision)
+
+	q.Rotation = quantizeRotation(state.Rotation)
+
+	scaleMax := float32(math.MaxUint16) * c.ScalePrecision
+	q.Scale[0] = uint16(quantizeFloat(state.Scale.X, 0, scaleMax, c.ScalePrecision))
+	q.Scale[1] = uint16(quantizeFloat(state.Scale.Y, 0, scaleMax, c.ScalePrecision))
+	q.Scale[2] = uint16(quantizeFloat(state.Scale.Z, 0, scaleMax, c.ScalePrecision))
+
+	return q
+}
+
+// Dequantize restores a transform from its quantized form
+func (tc *TransformCodec) Dequantize(q QuantizedTransform) TransformState {
+	c := tc.config
+	return TransformState{
+		Position: Vector3{
+			X: dequantizeFloat(q.Position[0], c.WorldMin.X, c.PositionPrecision),
+			Y: dequantizeFloat(q.Position[1], c.WorldMin.Y, c.PositionPrecision),
+			Z: dequantizeFloat(q.Position[2], c.WorldMin.Z, c.PositionPrecision),
+		},
+		Rotation: dequantizeRotation(q.Rotation),
+		Scale: Vector3{
+			X: dequantizeFloat(uint32(q.Scale[0]), 0, c.ScalePrecision),
+			Y: dequantizeFloat(uint32(q.Scale[1]), 0, c.ScalePrecision),
+			Z: dequantizeFloat(uint32(q.Scale[2]), 0, c.ScalePrecision),
+		},
+	}
+}
+
+// quantizeRotation packs a quaternion with the smallest-three method: the largest
+// component is dropped (and recovered from the unit length) and the other three are
+// stored in 10 bits each
+func quantizeRotation(q Quaternion) uint32 {
+	q = q.Normalize()
+	components := [4]float32{q.X, q.Y, q.Z, q.W}
+
+	largest := 0
+	for i := 1; i < 4; i++ {
+		if math.Abs(float64(components[i])) > math.Abs(float64(components[largest])) {
+			largest = i
+		}
+	}
+
+	// q and -q are the same rotation, so make the dropped component positive
+	sign := float32(1)
+	if components[largest] < 0 {
+		sign = -1
+	}
+
+	packed := uint32(largest)
+	for i := 0; i < 4; i++ {
+		if i == largest {
+			continue
+		}
+		v := components[i] * sign
+		normalized := (v + rotationRange) / (2 * rotationRange)
+		quantized := uint32(math.Round(float64(normalized * rotationComponentMax)))
+		if quantized > rotationComponentMax {
+			quantized = rotationComponentMax
+		}
+		packed = packed<<rotationComponentBits | quantized
+	}
+
+	return packed
+}
+
+func dequantizeRotation(packed uint32) Quaternion {
+	largest := int(packed >> (3 * rotationComponentBits))
+
+	var components [4]float32
+	sum := float32(0)
+	for i := 3; i >= 0; i-- {
+		if i == largest {
+			continue
+		}
+		quantized := packed & rotationComponentMax
+		packed >>= rotationComponentBits
+		v := float32(quantized)/rotationComponentMax*(2*rotationRange) - rotationRange
+		components[i] = v
+		sum += v * v
+	}
+
+	remaining := 1 - sum
+	if remaining < 0 {
+		remaining = 0
+	}
+	components[largest] = float32(math.Sqrt(float64(remaining)))
+
+	return Quaternion{components[0], components[1], components[2], components[3]}.Normalize()
+}
+
+// Delta field mask bits
+const (
+	deltaPositionX = 1 << iota
+	deltaPositionY
+	deltaPositionZ
+	deltaRotation
+	deltaScale
+)
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+func unzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// EncodeDelta appends the difference between baseline and current to buf. Unchanged
+// fields cost nothing and small movements cost one or two bytes per axis.
+func EncodeDelta(buf []byte, baseline, current QuantizedTransform) []byte {
+	var mask byte
+	for i := 0; i < 3; i++ {
+		if current.Position[i] != baseline.Position[i] {
+			mask |= deltaPositionX << i
+		}
+	}
+	if current.Rotation != baseline.Rotation {
+		mask |= deltaRotation
+	}
+	if current.Scale != baseline.Scale {
+		mask |= deltaScale
+	}
+
+	buf = append(buf, mask)
+	for i := 0; i < 3; i++ {
+		if mask&(deltaPositionX<<i) != 0 {
+			buf = binary.AppendUvarint(buf, zigzag(int64(current.Position[i])-int64(baseline.Position[i])))
+		}
+	}
+	if mask&deltaRotation != 0 {
+		buf = binary.LittleEndian.AppendUint32(buf, current.Rotation)
+	}
+	if mask&deltaScale != 0 {
+		for i := 0; i < 3; i++ {
+			buf = binary.AppendUvarint(buf, zigzag(int64(current.Scale[i])-int64(baseline.Scale[i])))
+		}
+	}
+
+	return buf
+}
+
+// DecodeDelta applies a delta produced by EncodeDelta to baseline and returns the
+// result together with the number of bytes consumed
+func DecodeDelta(data []byte, baseline QuantizedTransform) (QuantizedTransform, int, error) {
+	if len(data) == 0 {
+		return baseline, 0, errors.New("empty delta")
+	}
+
+	result := baseline
+	mask := data[0]
+	offset := 1
+
+	readVarint := func() (int64, error) {
+		v, n := binary.Uvarint(data[offset:])
+		if n <= 0 {
+			return 0, errors.New("truncated delta")
+		}
+		offset += n
+		return unzigzag(v), nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if mask&(deltaPositionX<<i) != 0 {
+			d, err := readVarint()
+			if err != nil {
+				return baseline, 0, err
+			}
+			result.Position[i] = uint32(int64(baseline.Position[i]) + d)
+		}
+	}
+	if mask&deltaRotation != 0 {
+		if len(data) < offset+4 {
+			return baseline, 0, errors.New("truncated delta")
+		}
+		result.Rotation = binary.LittleEndian.Uint32(data[offset:])
+		offset += 4
+	}
+	if mask&deltaScale != 0 {
+		for i := 0; i < 3; i++ {
+			d, err := readVarint()
+			if err != nil {
+				return baseline, 0, err
+			}
+			result.Scale[i] = uint16(int64(baseline.Scale[i]) + d)
+		}
+	}
+
+	return result, offset, nil
+}
+
+// TransformDeltaEncoder tracks, per connection, the last state each client acknowledged
+// so that updates are encoded against something the client is known to have
+type TransformDeltaEncoder struct {
+	codec   *TransformCodec
+	acked   map[ConnectionHandle]map[EntityID]deltaBaseline
+	pending map[ConnectionHandle]map[uint16]map[EntityID]QuantizedTransform
+}
+
+type deltaBaseline struct {
+	sequence uint16
+	state    QuantizedTransform
+}
+
+// NewTransformDeltaEncoder creates a new delta encoder
+func NewTransformDeltaEncoder(codec *TransformCodec) *TransformDeltaEncoder {
+	return &TransformDeltaEncoder{
+		codec:   codec,
+		acked:   make(map[ConnectionHandle]map[EntityID]deltaBaseline),
+		pending: make(map[ConnectionHandle]map[uint16]map[EntityID]QuantizedTransform),
+	}
+}
+
+// Encode appends an entity update for a connection to buf. The update references the
+// sequence of its baseline (0 = none, full state follows) and is remembered under
+// sequence until Ack is called. Sequences must be non-zero.
+func (de *TransformDeltaEncoder) Encode(buf []byte, conn ConnectionHandle, entity EntityID, state TransformState, sequence uint16) []byte {
+	current := de.codec.Quantize(state)
+
+	var baseline QuantizedTransform
+	var baseSequence uint16
+	// Baselines the decoder may have dropped from its history are ignored
+	if acked, ok := de.acked[conn][entity]; ok && int16(sequence-acked.sequence) < deltaHistorySize {
+		baseline = acked.state
+		baseSequence = acked.sequence
+	}
+
+	buf = binary.LittleEndian.AppendUint16(buf, baseSequence)
+	buf = EncodeDelta(buf, baseline, current)
+
+	bySequence, ok := de.pending[conn]
+	if !ok {
+		bySequence = make(map[uint16]map[EntityID]QuantizedTransform)
+		de.pending[conn] = bySequence
+	}
+	entities, ok := bySequence[sequence]
+	if !ok {
+		entities = make(map[EntityID]QuantizedTransform)
+		bySequence[sequence] = entities
+	}
+	entities[entity] = current
+
+	return buf
+}
+
+// Ack marks every update sent under sequence as received by the connection, making
+// them the new baselines. Older unacknowledged sequences are discarded.
+func (de *TransformDeltaEncoder) Ack(conn ConnectionHandle, sequence uint16) {
+	bySequence, ok := de.pending[conn]
+	if !ok {
+		return
+	}
+	entities, ok := bySequence[sequence]
+	if !ok {
+		return
+	}
+
+	acked, ok := de.acked[conn]
+	if !ok {
+		acked = make(map[EntityID]deltaBaseline)
+		de.acked[conn] = acked
+	}
+	for entity, state := range entities {
+		acked[entity] = deltaBaseline{sequence: sequence, state: state}
+	}
+
+	for s := range bySequence {
+		// Sequence comparison with wrap-around
+		if int16(s-sequence) <= 0 {
+			delete(bySequence, s)
+		}
+	}
+}
+
+// RemoveEntity drops baselines for an entity on every connection
+func (de *TransformDeltaEncoder) RemoveEntity(entity EntityID) {
+	for _, acked := range de.acked {
+		delete(acked, entity)
+	}
+	for _, bySequence := range de.pending {
+		for _, entities := range bySequence {
+			delete(entities, entity)
+		}
+	}
+}
+
+// RemoveConnection drops all baselines for a connection
+func (de *TransformDeltaEncoder) RemoveConnection(conn ConnectionHandle) {
+	delete(de.acked, conn)
+	delete(de.pending, conn)
+}
+
+// deltaHistorySize is how many received states per entity the decoder keeps as baselines
+const deltaHistorySize = 64
+
+// TransformDeltaDecoder reconstructs transforms from updates made by TransformDeltaEncoder
+type TransformDeltaDecoder struct {
+	codec   *TransformCodec
+	history map[EntityID]map[uint16]QuantizedTransform
+}
+
+// NewTransformDeltaDecoder creates a new delta decoder
+func NewTransformDeltaDecoder(codec *TransformCodec) *TransformDeltaDecoder {
+	return &TransformDeltaDecoder{
+		codec:   codec,
+		history: make(map[EntityID]map[uint16]QuantizedTransform),
+	}
+}
+
+// Decode reads one entity update received under sequence and returns the transform
+// and the number of bytes consumed
+func (dd *TransformDeltaDecoder) Decode(data []byte, entity EntityID, sequence uint16) (TransformState, int, error) {
+	if len(data) < 2 {
+		return TransformState{}, 0, errors.New("truncated delta")
+	}
+
+	baseSequence := binary.LittleEndian.Uint16(data)
+	var baseline QuantizedTransform
+	if baseSequence != 0 {
+		states, ok := dd.history[entity]
+		if !ok {
+			return TransformState{}, 0, errors.New("missing delta baseline")
+		}
+		baseline, ok = states[baseSequence]
+		if !ok {
+			return TransformState{}, 0, errors.New("missing delta baseline")
+		}
+	}
+
+	current, n, err := DecodeDelta(data[2:], baseline)
+	if err != nil {
+		return TransformState{}, 0, err
+	}
+
+	states, ok := dd.history[entity]
+	if !ok {
+		states = make(map[uint16]QuantizedTransform)
+		dd.history[entity] = states
+	}
+	states[sequence] = current
+	for s := range states {
+		if int16(sequence-s) >= deltaHistorySize {
+			delete(states, s)
+		}
+	}
+
+	return dd.codec.Dequantize(current), n + 2, nil
+}
+
+// RemoveEntity drops the decoding history for an entity
+func (dd *TransformDeltaDecoder) RemoveEntity(entity EntityID) {
+	delete(dd.history, entity)
+}
@@ -0,0 +1,127 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"iter"
+	"unsafe"
+)
+
+// QueryTerm is a condition on an entity's components for World.Query
+type QueryTerm struct {
+	component Component
+	without   bool
+}
+
+// With matches entities that have a component
+func With(component Component) QueryTerm {
+	return QueryTerm{component: component}
+}
+
+// Without matches entities that do not have a component
+func Without(component Component) QueryTerm {
+	return QueryTerm{component: component, without: true}
+}
+
+// WithTransform matches entities that have a transform
+func WithTransform() QueryTerm { return With(ComponentTransform) }
+
+// WithPhysicsBody matches entities that have a physics body
+func WithPhysicsBody() QueryTerm { return With(ComponentPhysicsBody) }
+
+// WithModel matches entities that have a model
+func WithModel() QueryTerm { return With(ComponentModel) }
+
+// WithBuoyancyVolume matches water regions
+func WithBuoyancyVolume() QueryTerm { return With(ComponentBuoyancyVolume) }
+
+// WithBuoyancy matches bodies that float
+func WithBuoyancy() QueryTerm { return With(ComponentBuoyant) }
+
+// WithSoftBody matches entities whose model wobbles
+func WithSoftBody() QueryTerm { return With(ComponentSoftBody) }
+
+// WithCollider matches entities that collide
+func WithCollider() QueryTerm { return With(ComponentCollider) }
+
+// Query iterates over the entities matching every term, for systems run each frame:
+//
+//	for e := range world.Query(boulder.WithTransform(), boulder.WithPhysicsBody()) {
+//		e.ApplyForce(wind)
+//	}
+//
+// The matches are collected before the loop starts, so entities can be created, destroyed
+// or changed inside it. At least one With term is needed; an invalid query yields nothing
+// (QueryIDs returns its error).
+func (w *World) Query(terms ...QueryTerm) iter.Seq[*Entity] {
+	return func(yield func(*Entity) bool) {
+		ids, err := w.QueryIDs(terms...)
+		if err != nil {
+			return
+		}
+		for _, id := range ids {
+			if !yield(&Entity{ID: id, world: w}) {
+				return
+			}
+		}
+	}
+}
+
+// QueryIDs returns the IDs of the entities matching every term
+func (w *World) QueryIDs(terms ...QueryTerm) ([]EntityID, error) {
+	defer lockThread()()
+	if !w.ready() {
+		return nil, errNotInitialized
+	}
+
+	var with, without []C.int
+	for _, term := range terms {
+		if term.component < 0 || term.component >= componentCount {
+			return nil, errors.New("invalid component")
+		}
+		if term.without {
+			without = append(without, C.int(term.component))
+		} else {
+			with = append(with, C.int(term.component))
+		}
+	}
+	if len(with) == 0 {
+		return nil, errors.New("query needs at least one With term")
+	}
+
+	var withoutPtr *C.int
+	if len(without) > 0 {
+		withoutPtr = &without[0]
+	}
+
+	// Guess the size from the last query so most queries take a single pass
+	ids := make([]C.EntityID, max(w.queryHint, 64))
+	for {
+		count := int(C.boulder_query_entities(&with[0], C.int(len(with)), withoutPtr, C.int(len(without)),
+			(*C.EntityID)(unsafe.Pointer(&ids[0])), C.uint32_t(len(ids))))
+		if count < 0 {
+			return nil, lastError("failed to query entities")
+		}
+		if count <= len(ids) {
+			w.queryHint = count
+			entities := make([]EntityID, count)
+			for i, id := range ids[:count] {
+				entities[i] = EntityID(id)
+			}
+			return entities, nil
+		}
+		ids = make([]C.EntityID, count)
+	}
+}
+
+// QueryCount returns how many entities match every term
+func (w *World) QueryCount(terms ...QueryTerm) int {
+	ids, err := w.QueryIDs(terms...)
+	if err != nil {
+		return 0
+	}
+	return len(ids)
+}
@@ -0,0 +1,312 @@
+package boulder
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// QuestState is the progress of a quest
+type QuestState int
+
+const (
+	QuestNotStarted QuestState = 0
+	QuestActive     QuestState = 1
+	QuestCompleted  QuestState = 2
+	QuestFailed     QuestState = 3
+)
+
+// String returns the state name
+func (s QuestState) String() string {
+	switch s {
+	case QuestActive:
+		return "active"
+	case QuestCompleted:
+		return "completed"
+	case QuestFailed:
+		return "failed"
+	default:
+		return "not_started"
+	}
+}
+
+// QuestObjective is one step of a quest
+type QuestObjective struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Required    int    `json:"required,omitempty"` // Progress needed; zero or one is a single step
+	Optional    bool   `json:"optional,omitempty"` // Not needed to complete the quest
+}
+
+// QuestDefinition describes a quest
+type QuestDefinition struct {
+	ID          string           `json:"id"`
+	Title       string           `json:"title"`
+	Description string           `json:"description,omitempty"`
+	Objectives  []QuestObjective `json:"objectives"`
+}
+
+// QuestEvent reports a change in the quest log. Objective is empty for quest state changes.
+type QuestEvent struct {
+	Quest     string
+	Objective string
+	State     QuestState
+	Progress  int
+}
+
+// QuestCallback is called when the quest log changes
+type QuestCallback func(event QuestEvent)
+
+type questProgress struct {
+	State      QuestState     `json:"state"`
+	Objectives map[string]int `json:"objectives,omitempty"`
+}
+
+// QuestLog tracks quests and their objectives. Quests complete on their own once every
+// required objective is done.
+type QuestLog struct {
+	definitions map[string]*QuestDefinition
+	progress    map[string]*questProgress
+	order       []string // Quests in the order they were started
+	onUpdate    QuestCallback
+}
+
+// NewQuestLog creates an empty quest log
+func NewQuestLog() *QuestLog {
+	return &QuestLog{
+		definitions: make(map[string]*QuestDefinition),
+		progress:    make(map[string]*questProgress),
+	}
+}
+
+// Define adds a quest definition
+func (ql *QuestLog) Define(def QuestDefinition) error {
+	if def.ID == "" {
+		return errors.New("quest definition needs an id")
+	}
+	for _, o := range def.Objectives {
+		if o.ID == "" {
+			return errors.New("quest objective needs an id: " + def.ID)
+		}
+	}
+	ql.definitions[def.ID] = &def
+	return nil
+}
+
+// LoadQuests loads quest definitions from a JSON file holding an array of quests
+func (ql *QuestLog) LoadQuests(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var defs []QuestDefinition
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return err
+	}
+	for _, def := range defs {
+		if err := ql.Define(def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDefinition returns a quest's definition
+func (ql *QuestLog) GetDefinition(quest string) (*QuestDefinition, bool) {
+	def, ok := ql.definitions[quest]
+	return def, ok
+}
+
+// OnUpdate sets the callback run when a quest or objective changes
+func (ql *QuestLog) OnUpdate(callback QuestCallback) {
+	ql.onUpdate = callback
+}
+
+// Start makes a quest active
+func (ql *QuestLog) Start(quest string) error {
+	if _, ok := ql.definitions[quest]; !ok {
+		return errors.New("unknown quest: " + quest)
+	}
+	if ql.GetState(quest) != QuestNotStarted {
+		return errors.New("quest already started: " + quest)
+	}
+
+	ql.progress[quest] = &questProgress{State: QuestActive, Objectives: make(map[string]int)}
+	ql.order = append(ql.order, quest)
+	ql.notify(QuestEvent{Quest: quest, State: QuestActive})
+	return nil
+}
+
+// Progress adds progress to an objective of an active quest
+func (ql *QuestLog) Progress(quest, objective string, amount int) error {
+	def, p, err := ql.active(quest)
+	if err != nil {
+		return err
+	}
+
+	var obj *QuestObjective
+	for i := range def.Objectives {
+		if def.Objectives[i].ID == objective {
+			obj = &def.Objectives[i]
+		}
+	}
+	if obj == nil {
+		return errors.New("unknown objective: " + objective)
+	}
+
+	required := max(1, obj.Required)
+	if p.Objectives[objective] >= required {
+		return nil
+	}
+	p.Objectives[objective] = min(required, max(0, p.Objectives[objective]+amount))
+	ql.notify(QuestEvent{Quest: quest, Objective: objective, State: p.State, Progress: p.Objectives[objective]})
+
+	if ql.requiredDone(def, p) {
+		p.State = QuestCompleted
+		ql.notify(QuestEvent{Quest: quest, State: QuestCompleted})
+	}
+	return nil
+}
+
+// CompleteObjective finishes an objective of an active quest
+func (ql *QuestLog) CompleteObjective(quest, objective string) error {
+	def, ok := ql.definitions[quest]
+	if !ok {
+		return errors.New("unknown quest: " + quest)
+	}
+	for _, o := range def.Objectives {
+		if o.ID == objective {
+			return ql.Progress(quest, objective, max(1, o.Required))
+		}
+	}
+	return errors.New("unknown objective: " + objective)
+}
+
+// Complete finishes an active quest regardless of its objectives
+func (ql *QuestLog) Complete(quest string) error {
+	return ql.finish(quest, QuestCompleted)
+}
+
+// Fail fails an active quest
+func (ql *QuestLog) Fail(quest string) error {
+	return ql.finish(quest, QuestFailed)
+}
+
+// GetState returns a quest's state
+func (ql *QuestLog) GetState(quest string) QuestState {
+	if p, ok := ql.progress[quest]; ok {
+		return p.State
+	}
+	return QuestNotStarted
+}
+
+// GetProgress returns the progress of an objective
+func (ql *QuestLog) GetProgress(quest, objective string) int {
+	if p, ok := ql.progress[quest]; ok {
+		return p.Objectives[objective]
+	}
+	return 0
+}
+
+// IsObjectiveComplete returns true once an objective has reached its required progress
+func (ql *QuestLog) IsObjectiveComplete(quest, objective string) bool {
+	def, ok := ql.definitions[quest]
+	if !ok {
+		return false
+	}
+	for _, o := range def.Objectives {
+		if o.ID == objective {
+			return ql.GetProgress(quest, objective) >= max(1, o.Required)
+		}
+	}
+	return false
+}
+
+// GetQuests returns the quests in a state, in the order they were started
+func (ql *QuestLog) GetQuests(state QuestState) []string {
+	var quests []string
+	for _, quest := range ql.order {
+		if ql.progress[quest].State == state {
+			quests = append(quests, quest)
+		}
+	}
+	return quests
+}
+
+// Save serializes quest progress for save games
+func (ql *QuestLog) Save() ([]byte, error) {
+	type saved struct {
+		Quest string `json:"quest"`
+		questProgress
+	}
+
+	quests := make([]saved, 0, len(ql.order))
+	for _, quest := range ql.order {
+		quests = append(quests, saved{Quest: quest, questProgress: *ql.progress[quest]})
+	}
+	return json.Marshal(quests)
+}
+
+// Load restores progress saved by Save. Quests that are no longer defined are dropped.
+func (ql *QuestLog) Load(data []byte) error {
+	var quests []struct {
+		Quest string `json:"quest"`
+		questProgress
+	}
+	if err := json.Unmarshal(data, &quests); err != nil {
+		return err
+	}
+
+	ql.progress = make(map[string]*questProgress, len(quests))
+	ql.order = ql.order[:0]
+	for _, q := range quests {
+		if _, ok := ql.definitions[q.Quest]; !ok {
+			continue
+		}
+		p := q.questProgress
+		if p.Objectives == nil {
+			p.Objectives = make(map[string]int)
+		}
+		ql.progress[q.Quest] = &p
+		ql.order = append(ql.order, q.Quest)
+	}
+	return nil
+}
+
+func (ql *QuestLog) active(quest string) (*QuestDefinition, *questProgress, error) {
+	def, ok := ql.definitions[quest]
+	if !ok {
+		return nil, nil, errors.New("unknown quest: " + quest)
+	}
+	p, ok := ql.progress[quest]
+	if !ok || p.State != QuestActive {
+		return nil, nil, errors.New("quest not active: " + quest)
+	}
+	return def, p, nil
+}
+
+func (ql *QuestLog) finish(quest string, state QuestState) error {
+	_, p, err := ql.active(quest)
+	if err != nil {
+		return err
+	}
+	p.State = state
+	ql.notify(QuestEvent{Quest: quest, State: state})
+	return nil
+}
+
+func (ql *QuestLog) requiredDone(def *QuestDefinition, p *questProgress) bool {
+	for _, o := range def.Objectives {
+		if !o.Optional && p.Objectives[o.ID] < max(1, o.Required) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ql *QuestLog) notify(event QuestEvent) {
+	if ql.onUpdate != nil {
+		runCallback("OnUpdate", func() { ql.onUpdate(event) })
+	}
+}
@@ -0,0 +1,450 @@
+package boulder
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"time"
+)
+
+// ErrReconnecting is returned for a reliable message sent to a reconnecting connection
+// once it has more held than the reconnect policy allows
+var ErrReconnecting = errors.New("connection is reconnecting and its held messages are full")
+
+const (
+	NetworkEventReconnecting NetworkEventType = 5
+	NetworkEventReconnected  NetworkEventType = 6
+)
+
+const (
+	resumeTokenSize     = 16
+	defaultMaxHeldBytes = 64 * 1024 // Held for a connection the server is waiting on
+)
+
+// ReconnectingEvent is returned instead of the DisconnectedEvent of a connection that may
+// come back. A client with EnableAutoReconnect gets one before each attempt; a server with
+// EnableSessionResume gets one when the connection drops, then a ReconnectedEvent if the
+// client resumes within the window or a DisconnectedEvent if it doesn't.
+type ReconnectingEvent struct {
+	Connection ConnectionHandle // The connection that dropped
+	Attempt    int              // Counting from 1 on the client; 0 on the server
+	Delay      time.Duration    // Until the attempt, or how long the server waits
+}
+
+func (e ReconnectingEvent) Type() NetworkEventType { return NetworkEventReconnecting }
+
+// ReconnectedEvent is returned once a dropped connection is back. Connection replaces
+// Previous from then on: send to it and move anything keyed by Previous over. On the
+// server it follows the new connection's ConnectedEvent.
+type ReconnectedEvent struct {
+	Connection ConnectionHandle
+	Previous   ConnectionHandle
+	Resumed    bool // The server recognised the session from its resume token
+}
+
+func (e ReconnectedEvent) Type() NetworkEventType { return NetworkEventReconnected }
+
+// ReconnectPolicy controls how a client reconnects connections that drop
+type ReconnectPolicy struct {
+	MaxAttempts  int           // Attempts before giving up with a DisconnectedEvent; 0 retries forever
+	InitialDelay time.Duration // Before the first attempt
+	MaxDelay     time.Duration // The delay doubles after each failed attempt, up to this
+	// Reliable messages sent to the dropped connection are held, up to this many bytes, and
+	// sent once it is back; unreliable ones are dropped
+	MaxHeldBytes int
+}
+
+// DefaultReconnectPolicy tries 5 times over about 15 seconds, holding up to 64KB
+func DefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{
+		MaxAttempts:  5,
+		InitialDelay: 500 * time.Millisecond,
+		MaxDelay:     8 * time.Second,
+		MaxHeldBytes: defaultMaxHeldBytes,
+	}
+}
+
+// reconnectTarget is where a client connection was made to
+type reconnectTarget struct {
+	address     string
+	port        uint16
+	steamID     SteamID // P2P when set
+	virtualPort int
+}
+
+// reconnectAttempt is a dropped client connection being reconnected
+type reconnectAttempt struct {
+	target   reconnectTarget
+	attempt  int
+	due      time.Time
+	conn     ConnectionHandle // Connection of the attempt in flight, 0 while waiting
+	resuming bool             // Connected, waiting for the server's answer to the token
+}
+
+// heldMessages are the reliable messages sent to a connection while it reconnects
+type heldMessages struct {
+	data  [][]byte
+	bytes int
+}
+
+// reconnectState is the session's reconnect and resume bookkeeping
+type reconnectState struct {
+	// Client side
+	policy    *ReconnectPolicy // nil when auto-reconnect is off
+	targets   map[ConnectionHandle]reconnectTarget
+	tokens    map[ConnectionHandle][]byte            // Resume tokens from the server
+	attempts  map[ConnectionHandle]*reconnectAttempt // By the dropped connection
+	byAttempt map[ConnectionHandle]ConnectionHandle  // Attempt connection to dropped connection
+
+	// Server side
+	resumeWindow time.Duration // 0 when resume is off
+	issued       map[string]ConnectionHandle
+	tokenOf      map[ConnectionHandle]string
+	dropped      map[ConnectionHandle]time.Time // Waiting to be resumed until then
+
+	held   map[ConnectionHandle]*heldMessages
+	events []NetworkEvent
+}
+
+func (ns *NetworkSession) ensureReconnect() *reconnectState {
+	if ns.reconnect == nil {
+		ns.reconnect = &reconnectState{
+			targets:   make(map[ConnectionHandle]reconnectTarget),
+			tokens:    make(map[ConnectionHandle][]byte),
+			attempts:  make(map[ConnectionHandle]*reconnectAttempt),
+			byAttempt: make(map[ConnectionHandle]ConnectionHandle),
+			issued:    make(map[string]ConnectionHandle),
+			tokenOf:   make(map[ConnectionHandle]string),
+			dropped:   make(map[ConnectionHandle]time.Time),
+			held:      make(map[ConnectionHandle]*heldMessages),
+		}
+	}
+	return ns.reconnect
+}
+
+// EnableAutoReconnect makes the client reconnect connections it makes with Connect or
+// ConnectP2P from now on when they drop or time out. PollEvent returns a ReconnectingEvent
+// before each attempt and a ReconnectedEvent with the new connection once one succeeds, or
+// a DisconnectedEvent once the attempts run out. If the server has EnableSessionResume
+// on, the client presents the token it was given and the server picks the session back up.
+func (ns *NetworkSession) EnableAutoReconnect(policy ReconnectPolicy) {
+	if policy.InitialDelay < 0 || policy.MaxHeldBytes < 0 {
+		policy = DefaultReconnectPolicy()
+	}
+	ns.ensureReconnect().policy = &policy
+}
+
+// DisableAutoReconnect stops reconnecting. Connections still being reconnected are given up
+// with a DisconnectedEvent.
+func (ns *NetworkSession) DisableAutoReconnect() {
+	rs := ns.reconnect
+	if rs == nil || rs.policy == nil {
+		return
+	}
+	rs.policy = nil
+	for old := range rs.attempts {
+		ns.forgetReconnect(old)
+		rs.events = append(rs.events, DisconnectedEvent{Connection: old})
+	}
+	clear(rs.targets)
+}
+
+// EnableSessionResume makes the server give each connection it accepts from now on a resume
+// token, and wait up to window for a dropped connection's client to reconnect with it
+// before reporting the disconnect; 0 turns it off. Messages sent to the dropped connection
+// meanwhile are held as with ReconnectPolicy.MaxHeldBytes, 64KB.
+func (ns *NetworkSession) EnableSessionResume(window time.Duration) {
+	ns.ensureReconnect().resumeWindow = max(0, window)
+}
+
+// rememberTarget records where a client connection was made to, so it can be reconnected
+func (ns *NetworkSession) rememberTarget(conn ConnectionHandle, target reconnectTarget) {
+	if rs := ns.reconnect; rs != nil && rs.policy != nil {
+		rs.targets[conn] = target
+	}
+}
+
+// connectTarget makes a new connection to where a dropped one went
+func (ns *NetworkSession) connectTarget(target reconnectTarget) (ConnectionHandle, error) {
+	if target.steamID != 0 {
+		return ns.ConnectP2P(target.steamID, target.virtualPort)
+	}
+	return ns.Connect(target.address, target.port)
+}
+
+// reconnectConnected handles a new connection. It returns the event to report instead of
+// its ConnectedEvent (nil for none) and whether to replace it.
+func (ns *NetworkSession) reconnectConnected(conn ConnectionHandle) (NetworkEvent, bool) {
+	rs := ns.reconnect
+	if rs == nil {
+		return nil, false
+	}
+
+	if old, ok := rs.byAttempt[conn]; ok {
+		if token, ok := rs.tokens[old]; ok {
+			if err := ns.sendControl(conn, controlResume, token, true); err == nil {
+				// The ReconnectedEvent waits for the server's answer
+				rs.attempts[old].resuming = true
+				return nil, true
+			}
+		}
+		return ns.finishReconnect(old, conn, false), true
+	}
+
+	if _, client := rs.targets[conn]; !client && rs.resumeWindow > 0 {
+		ns.issueResumeToken(conn)
+	}
+	return nil, false
+}
+
+// issueResumeToken gives an accepted connection the token it can resume its session with
+func (ns *NetworkSession) issueResumeToken(conn ConnectionHandle) {
+	rs := ns.reconnect
+	token := make([]byte, resumeTokenSize)
+	if _, err := rand.Read(token); err != nil {
+		LogError("Failed to make resume token: " + err.Error())
+		return
+	}
+	rs.issued[string(token)] = conn
+	rs.tokenOf[conn] = string(token)
+	if err := ns.sendControl(conn, controlResumeToken, token, true); err != nil {
+		LogError("Failed to send resume token: " + err.Error())
+	}
+}
+
+// reconnectDropped handles a connection that closed. It returns the event to report
+// instead of its DisconnectedEvent and whether to replace it.
+func (ns *NetworkSession) reconnectDropped(conn ConnectionHandle) (NetworkEvent, bool) {
+	rs := ns.reconnect
+	if rs == nil {
+		return nil, false
+	}
+
+	// An attempt that failed
+	if old, ok := rs.byAttempt[conn]; ok {
+		delete(rs.byAttempt, conn)
+		delete(rs.targets, conn)
+		delete(rs.tokens, conn)
+		a := rs.attempts[old]
+		a.conn = 0
+		a.resuming = false
+		return ns.scheduleAttempt(old, a), true
+	}
+
+	if target, ok := rs.targets[conn]; ok && rs.policy != nil {
+		delete(rs.targets, conn)
+		a := &reconnectAttempt{target: target}
+		rs.attempts[conn] = a
+		return ns.scheduleAttempt(conn, a), true
+	}
+
+	if _, ok := rs.tokenOf[conn]; ok && rs.resumeWindow > 0 {
+		rs.dropped[conn] = time.Now().Add(rs.resumeWindow)
+		return ReconnectingEvent{Connection: conn, Delay: rs.resumeWindow}, true
+	}
+
+	ns.forgetReconnect(conn)
+	return nil, false
+}
+
+// scheduleAttempt sets up the next attempt at reconnecting a dropped connection, or gives
+// up once the policy's attempts are spent
+func (ns *NetworkSession) scheduleAttempt(old ConnectionHandle, a *reconnectAttempt) NetworkEvent {
+	rs := ns.reconnect
+	a.attempt++
+	if rs.policy == nil || (rs.policy.MaxAttempts > 0 && a.attempt > rs.policy.MaxAttempts) {
+		ns.forgetReconnect(old)
+		return DisconnectedEvent{Connection: old}
+	}
+
+	delay := rs.policy.InitialDelay
+	for i := 1; i < a.attempt && (rs.policy.MaxDelay <= 0 || delay < rs.policy.MaxDelay); i++ {
+		delay *= 2
+	}
+	if rs.policy.MaxDelay > 0 {
+		delay = min(delay, rs.policy.MaxDelay)
+	}
+	a.due = time.Now().Add(delay)
+	return ReconnectingEvent{Connection: old, Attempt: a.attempt, Delay: delay}
+}
+
+// finishReconnect hands a dropped client connection over to the attempt that replaced it
+func (ns *NetworkSession) finishReconnect(old, conn ConnectionHandle, resumed bool) NetworkEvent {
+	rs := ns.reconnect
+	delete(rs.attempts, old)
+	delete(rs.byAttempt, conn)
+	if token, ok := rs.tokens[old]; ok && resumed {
+		// The server moved the token over to the new connection
+		rs.tokens[conn] = token
+	}
+	delete(rs.tokens, old)
+	ns.flushHeld(old, conn)
+	return ReconnectedEvent{Connection: conn, Previous: old, Resumed: resumed}
+}
+
+// handleResume processes the resume control messages of both ends
+func (ns *NetworkSession) handleResume(conn ConnectionHandle, kind controlType, payload []byte) {
+	rs := ns.reconnect
+
+	switch kind {
+	case controlResumeToken:
+		if rs != nil && rs.policy != nil && len(payload) == resumeTokenSize {
+			rs.tokens[conn] = bytes.Clone(payload)
+		}
+
+	case controlResume:
+		old, resumed := ConnectionHandle(0), false
+		if rs != nil {
+			old, resumed = rs.issued[string(payload)]
+			if _, waiting := rs.dropped[old]; !resumed || !waiting {
+				resumed = false
+			}
+		}
+		result := []byte{0}
+		if resumed {
+			result[0] = 1
+		}
+		if err := ns.sendControl(conn, controlResumeResult, result, true); err != nil {
+			LogError("Failed to answer resume: " + err.Error())
+		}
+		if !resumed {
+			return
+		}
+
+		// The token now belongs to the new connection in place of the one it was just given
+		delete(rs.dropped, old)
+		delete(rs.tokenOf, old)
+		if fresh, ok := rs.tokenOf[conn]; ok {
+			delete(rs.issued, fresh)
+		}
+		rs.issued[string(payload)] = conn
+		rs.tokenOf[conn] = string(payload)
+		ns.flushHeld(old, conn)
+		rs.events = append(rs.events, ReconnectedEvent{Connection: conn, Previous: old, Resumed: true})
+
+	case controlResumeResult:
+		if rs == nil {
+			return
+		}
+		old, ok := rs.byAttempt[conn]
+		if !ok || !rs.attempts[old].resuming {
+			return
+		}
+		rs.events = append(rs.events, ns.finishReconnect(old, conn, len(payload) > 0 && payload[0] == 1))
+	}
+}
+
+// holdForReconnect keeps a message sent to a connection that is reconnecting. It returns
+// whether the connection is, and the error to return for the message.
+func (ns *NetworkSession) holdForReconnect(conn ConnectionHandle, data []byte, reliable bool) (bool, error) {
+	rs := ns.reconnect
+	if rs == nil {
+		return false, nil
+	}
+
+	limit := defaultMaxHeldBytes
+	if _, ok := rs.attempts[conn]; ok {
+		limit = rs.policy.MaxHeldBytes
+	} else if _, ok := rs.dropped[conn]; !ok {
+		return false, nil
+	}
+	if !reliable {
+		return true, nil
+	}
+
+	held := rs.held[conn]
+	if held == nil {
+		held = &heldMessages{}
+		rs.held[conn] = held
+	}
+	if held.bytes+len(data) > limit {
+		return true, ErrReconnecting
+	}
+	held.data = append(held.data, bytes.Clone(data))
+	held.bytes += len(data)
+	return true, nil
+}
+
+// flushHeld sends the messages held for a dropped connection on the one replacing it
+func (ns *NetworkSession) flushHeld(old, conn ConnectionHandle) {
+	rs := ns.reconnect
+	held := rs.held[old]
+	delete(rs.held, old)
+	if held == nil {
+		return
+	}
+	for _, data := range held.data {
+		if err := ns.sendRaw(conn, data, true); err != nil {
+			LogError("Failed to send held message: " + err.Error())
+		}
+	}
+}
+
+// updateReconnect starts the reconnect attempts that are due and gives up on dropped
+// connections whose resume window has passed
+func (ns *NetworkSession) updateReconnect() {
+	rs := ns.reconnect
+	if rs == nil {
+		return
+	}
+
+	now := time.Now()
+	for old, a := range rs.attempts {
+		if a.conn != 0 || now.Before(a.due) {
+			continue
+		}
+		conn, err := ns.connectTarget(a.target)
+		if err != nil {
+			rs.events = append(rs.events, ns.scheduleAttempt(old, a))
+			continue
+		}
+		a.conn = conn
+		rs.byAttempt[conn] = old
+	}
+
+	for conn, deadline := range rs.dropped {
+		if now.After(deadline) {
+			ns.forgetReconnect(conn)
+			rs.events = append(rs.events, DisconnectedEvent{Connection: conn})
+		}
+	}
+}
+
+// takeReconnectEvent returns the oldest reconnect event not yet polled
+func (ns *NetworkSession) takeReconnectEvent() NetworkEvent {
+	rs := ns.reconnect
+	if rs == nil || len(rs.events) == 0 {
+		return nil
+	}
+	event := rs.events[0]
+	rs.events = rs.events[1:]
+	return event
+}
+
+// forgetReconnect drops a connection's reconnect state, cancelling the attempt in flight
+// when it is one being reconnected
+func (ns *NetworkSession) forgetReconnect(conn ConnectionHandle) {
+	rs := ns.reconnect
+	if rs == nil {
+		return
+	}
+
+	if old, ok := rs.byAttempt[conn]; ok {
+		conn = old
+	}
+	if a, ok := rs.attempts[conn]; ok {
+		delete(rs.attempts, conn)
+		if a.conn != 0 {
+			delete(rs.byAttempt, a.conn)
+			ns.Disconnect(a.conn)
+		}
+	}
+	if token, ok := rs.tokenOf[conn]; ok {
+		delete(rs.issued, token)
+		delete(rs.tokenOf, conn)
+	}
+	delete(rs.targets, conn)
+	delete(rs.tokens, conn)
+	delete(rs.dropped, conn)
+	delete(rs.held, conn)
+}
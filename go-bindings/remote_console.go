@@ -0,0 +1,590 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+const (
+	DefaultRemoteConsoleAddress = "127.0.0.1:27099"
+
+	remoteConsoleQueue      = 256                    // Lines waiting to be sent to a client before more are dropped
+	remoteConsoleMaxLine    = 4096                   // Longest log line or command
+	remoteConsoleAuthWindow = 10 * time.Second       // How long a client has to log in
+	remoteConsoleSniffTime  = 250 * time.Millisecond // How long to wait for an HTTP request
+	websocketGUID           = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var remoteConsoleLevels = []string{"DEBUG", "INFO", "WARNING", "ERROR", "CRITICAL"}
+
+// httpRequestLine matches the first line of an HTTP request, e.g. "POST /run HTTP/1.1"
+var httpRequestLine = regexp.MustCompile(`^[A-Za-z]+ \S+ HTTP/\d(\.\d)?$`)
+
+// RemoteConsoleConfig sets up a remote console
+type RemoteConsoleConfig struct {
+	// Address to listen on; "" is DefaultRemoteConsoleAddress, which only this machine can
+	// reach. Anyone who can connect can run commands, so set a Password before listening on
+	// other interfaces.
+	Address    string
+	Password   string // Clients must send "auth <password>" first; "" for none, which turns browsers away
+	MaxClients int    // 0 is 4
+
+	// Origins (e.g. "https://tools.example.com") whose pages may open a WebSocket besides
+	// the console's own page. Upgrades from any other origin, or with none, are refused.
+	AllowedOrigins []string
+}
+
+// RemoteConsole lets a browser or a terminal connect to a running game or dedicated server
+// to run console commands, tail the log, and inspect cvars and world stats. Terminals
+// connect with plain TCP (nc localhost 27099), one command per line; browsers open
+// http://localhost:27099 for a console page that talks to it over a WebSocket. Browsers
+// need a Password, since any page they have open can reach the console's address.
+//
+// Connections are handled in the background, but commands run in Update, so they can touch
+// the engine and worlds like the rest of the game loop.
+type RemoteConsole struct {
+	engine   *Engine
+	config   RemoteConsoleConfig
+	listener net.Listener
+
+	mu       sync.Mutex
+	clients  map[*remoteConsoleClient]bool
+	commands []remoteConsoleCommand
+	closed   bool
+}
+
+type remoteConsoleCommand struct {
+	client *remoteConsoleClient
+	line   string
+}
+
+type remoteConsoleClient struct {
+	conn      net.Conn
+	websocket bool
+	tail      atomic.Bool
+	out       chan string
+	done      chan struct{}
+	closeOnce sync.Once
+	writeMu   sync.Mutex // Replies to pings are written by the reader
+}
+
+// NewRemoteConsole starts listening for remote console clients. It is off unless the game
+// creates one, e.g. behind a command line flag on dedicated servers.
+func NewRemoteConsole(engine *Engine, config RemoteConsoleConfig) (*RemoteConsole, error) {
+	defer lockThread()()
+	if engine == nil {
+		return nil, errors.New("engine is nil")
+	}
+	if config.Address == "" {
+		config.Address = DefaultRemoteConsoleAddress
+	}
+	if config.MaxClients <= 0 {
+		config.MaxClients = 4
+	}
+
+	listener, err := net.Listen("tcp", config.Address)
+	if err != nil {
+		return nil, err
+	}
+	if C.boulder_watch_logs(1) != 0 {
+		listener.Close()
+		return nil, lastError("failed to watch logs")
+	}
+
+	rc := &RemoteConsole{
+		engine:   engine,
+		config:   config,
+		listener: listener,
+		clients:  make(map[*remoteConsoleClient]bool),
+	}
+	go rc.serve()
+	LogInfo("Remote console listening on " + listener.Addr().String())
+	return rc, nil
+}
+
+// GetAddress returns the address the console listens on, e.g. after asking for port 0
+func (rc *RemoteConsole) GetAddress() string {
+	return rc.listener.Addr().String()
+}
+
+// GetClientCount returns how many clients are connected
+func (rc *RemoteConsole) GetClientCount() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.clients)
+}
+
+// Update runs the commands clients sent since the last call and sends them the new log
+// lines (call every frame or server tick)
+func (rc *RemoteConsole) Update() {
+	rc.mu.Lock()
+	commands := rc.commands
+	rc.commands = nil
+	rc.mu.Unlock()
+
+	for _, command := range commands {
+		LogInfo(fmt.Sprintf("Remote console %s: %s", command.client.conn.RemoteAddr(), command.line))
+		output, err := rc.engine.ExecuteCommand(command.line)
+		if err != nil {
+			command.client.send("error: " + err.Error())
+		} else if output != "" {
+			command.client.send(output)
+		}
+	}
+
+	buffer := make([]byte, remoteConsoleMaxLine)
+	var level C.int
+	for C.boulder_poll_log(&level, (*C.char)(unsafe.Pointer(&buffer[0])), C.uint32_t(len(buffer))) == 1 {
+		name := "LOG"
+		if int(level) >= 0 && int(level) < len(remoteConsoleLevels) {
+			name = remoteConsoleLevels[level]
+		}
+		line := name + " " + C.GoString((*C.char)(unsafe.Pointer(&buffer[0])))
+
+		rc.mu.Lock()
+		for client := range rc.clients {
+			if client.tail.Load() {
+				client.send(line)
+			}
+		}
+		rc.mu.Unlock()
+	}
+}
+
+// Close stops listening and disconnects every client
+func (rc *RemoteConsole) Close() {
+	rc.mu.Lock()
+	if rc.closed {
+		rc.mu.Unlock()
+		return
+	}
+	rc.closed = true
+	clients := rc.clients
+	rc.clients = make(map[*remoteConsoleClient]bool)
+	rc.mu.Unlock()
+
+	rc.listener.Close()
+	for client := range clients {
+		client.close()
+	}
+	C.boulder_watch_logs(0)
+}
+
+func (rc *RemoteConsole) serve() {
+	for {
+		conn, err := rc.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				LogError("Remote console stopped accepting: " + err.Error())
+			}
+			return
+		}
+		go rc.handle(conn)
+	}
+}
+
+// handle reads a client's commands until it disconnects. A first line like "GET / HTTP/1.1"
+// is an HTTP request: a WebSocket upgrade, or a browser asking for the console page. Other
+// HTTP requests are refused, and so is a plain TCP client sending one later, so a web page
+// can never run commands by posting to the console's address.
+func (rc *RemoteConsole) handle(conn net.Conn) {
+	reader := bufio.NewReaderSize(conn, remoteConsoleMaxLine)
+	client := &remoteConsoleClient{conn: conn, out: make(chan string, remoteConsoleQueue), done: make(chan struct{})}
+	go client.write()
+	defer client.close()
+
+	// Browsers send their request straight away; terminals wait for the banner. What comes
+	// first is read to the end of its line, however many packets it arrives in.
+	var first string
+	conn.SetReadDeadline(time.Now().Add(remoteConsoleSniffTime))
+	if _, err := reader.Peek(1); err == nil {
+		conn.SetReadDeadline(time.Now().Add(remoteConsoleAuthWindow))
+		if first, err = client.read(reader); err != nil {
+			return
+		}
+	}
+	conn.SetReadDeadline(time.Time{})
+	if httpRequestLine.MatchString(strings.TrimSpace(first)) {
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if !strings.HasPrefix(first, "GET ") {
+			LogError(fmt.Sprintf("Remote console %s: refused HTTP request %q", conn.RemoteAddr(), strings.TrimSpace(first)))
+			writeHTTPResponse(conn, "405 Method Not Allowed", "text/plain", "Only GET is allowed\n")
+			return
+		}
+		// The request line was consumed; later reads, WebSocket frames included, go through
+		// a reader that replays it
+		reader = bufio.NewReaderSize(io.MultiReader(strings.NewReader(first), reader), remoteConsoleMaxLine)
+		first = ""
+		request, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		if rc.config.Password == "" {
+			writeHTTPResponse(conn, "403 Forbidden", "text/plain", "The remote console needs a password for browsers.\n")
+			return
+		}
+		if !strings.EqualFold(request.Header.Get("Upgrade"), "websocket") {
+			writeHTTPResponse(conn, "200 OK", "text/html", remoteConsolePage)
+			return
+		}
+		if !rc.allowOrigin(request) {
+			LogError(fmt.Sprintf("Remote console %s: refused WebSocket from origin %q", conn.RemoteAddr(), request.Header.Get("Origin")))
+			writeHTTPResponse(conn, "403 Forbidden", "text/plain", "Origin not allowed\n")
+			return
+		}
+		if err := acceptWebSocket(conn, request); err != nil {
+			return
+		}
+		conn.SetWriteDeadline(time.Time{})
+		client.websocket = true
+	}
+
+	rc.mu.Lock()
+	full := len(rc.clients) >= rc.config.MaxClients
+	if !full && !rc.closed {
+		rc.clients[client] = true
+	}
+	closed := rc.closed
+	rc.mu.Unlock()
+	if closed {
+		return
+	}
+	if full {
+		client.send("error: too many remote console clients")
+		return
+	}
+	defer func() {
+		rc.mu.Lock()
+		delete(rc.clients, client)
+		rc.mu.Unlock()
+	}()
+
+	authed := rc.config.Password == ""
+	client.tail.Store(authed)
+	if authed {
+		client.send("Boulder remote console. Type help for commands, tail off to stop the log, quit to leave.")
+	} else {
+		client.send("Boulder remote console. Log in with: auth <password>")
+		conn.SetReadDeadline(time.Now().Add(remoteConsoleAuthWindow))
+	}
+
+	for {
+		line := first
+		first = ""
+		if line == "" {
+			var err error
+			if line, err = client.read(reader); err != nil {
+				return
+			}
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !client.websocket && httpRequestLine.MatchString(line) {
+			LogError(fmt.Sprintf("Remote console %s: refused HTTP request %q", conn.RemoteAddr(), line))
+			return
+		}
+
+		if !authed {
+			password, ok := strings.CutPrefix(line, "auth ")
+			if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(rc.config.Password)) != 1 {
+				LogError(fmt.Sprintf("Remote console %s: failed login", conn.RemoteAddr()))
+				client.send("error: wrong password")
+				return
+			}
+			authed = true
+			client.tail.Store(true)
+			conn.SetReadDeadline(time.Time{})
+			client.send("Logged in. Type help for commands, tail off to stop the log, quit to leave.")
+			continue
+		}
+
+		switch line {
+		case "quit", "exit":
+			return
+		case "tail on", "tail off":
+			client.tail.Store(line == "tail on")
+			continue
+		}
+
+		rc.mu.Lock()
+		rc.commands = append(rc.commands, remoteConsoleCommand{client: client, line: line})
+		rc.mu.Unlock()
+	}
+}
+
+// allowOrigin returns whether a WebSocket upgrade comes from the console's own page or an
+// allowed origin
+func (rc *RemoteConsole) allowOrigin(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host != "" && strings.EqualFold(u.Host, request.Host) {
+		return true
+	}
+	origin = strings.TrimSuffix(origin, "/")
+	for _, allowed := range rc.config.AllowedOrigins {
+		if strings.EqualFold(origin, strings.TrimSuffix(allowed, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// send queues text for the client, dropping it if the client isn't keeping up
+func (c *remoteConsoleClient) send(text string) {
+	select {
+	case c.out <- text:
+	case <-c.done:
+	default:
+	}
+}
+
+// write sends queued text until the client is closed, then closes the connection
+func (c *remoteConsoleClient) write() {
+	defer c.conn.Close()
+	for {
+		select {
+		case text := <-c.out:
+			if c.writeText(text) != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			// Flush what was queued first, e.g. why the client was turned away
+			for {
+				select {
+				case text := <-c.out:
+					if c.writeText(text) != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *remoteConsoleClient) writeText(text string) error {
+	if c.websocket {
+		return c.writeFrame(websocketText, []byte(text))
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := io.WriteString(c.conn, text+"\n")
+	return err
+}
+
+func (c *remoteConsoleClient) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	return writeWebSocketFrame(c.conn, opcode, payload)
+}
+
+// read returns the client's next line or WebSocket message
+func (c *remoteConsoleClient) read(reader *bufio.Reader) (string, error) {
+	if !c.websocket {
+		// The reader holds remoteConsoleMaxLine bytes, so a longer line fills it
+		line, err := reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return "", errors.New("line too long")
+		}
+		return string(line), err
+	}
+
+	var message []byte
+	for {
+		opcode, payload, fin, err := readWebSocketFrame(reader)
+		if err != nil {
+			return "", err
+		}
+		switch opcode {
+		case websocketClose:
+			c.writeFrame(websocketClose, nil)
+			return "", io.EOF
+		case websocketPing:
+			c.writeFrame(websocketPong, payload)
+			continue
+		case websocketPong:
+			continue
+		}
+		message = append(message, payload...)
+		if len(message) > remoteConsoleMaxLine {
+			return "", errors.New("message too long")
+		}
+		if fin {
+			return string(message), nil
+		}
+	}
+}
+
+// close ends the client; write closes the connection once it has flushed
+func (c *remoteConsoleClient) close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// WebSocket opcodes (RFC 6455)
+const (
+	websocketText  = 1
+	websocketClose = 8
+	websocketPing  = 9
+	websocketPong  = 10
+)
+
+// writeHTTPResponse answers a request and ends the connection
+func writeHTTPResponse(conn net.Conn, status, contentType, body string) {
+	fmt.Fprintf(conn, "HTTP/1.1 %s\r\nContent-Type: %s; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s",
+		status, contentType, len(body), body)
+}
+
+// acceptWebSocket answers a WebSocket upgrade request
+func acceptWebSocket(conn net.Conn, request *http.Request) error {
+	key := request.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		fmt.Fprint(conn, "HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n")
+		return errors.New("missing Sec-WebSocket-Key")
+	}
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	_, err := fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(hash[:]))
+	return err
+}
+
+// readWebSocketFrame reads one frame from a client, unmasking its payload
+func readWebSocketFrame(reader *bufio.Reader) (opcode byte, payload []byte, fin bool, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(reader, header[:]); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err = io.ReadFull(reader, extended[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err = io.ReadFull(reader, extended[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > remoteConsoleMaxLine {
+		err = errors.New("websocket frame too long")
+		return
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(reader, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(reader, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// writeWebSocketFrame writes one unmasked frame, as servers send them
+func writeWebSocketFrame(w io.Writer, opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	frame = append(frame, payload...)
+	_, err := w.Write(frame)
+	return err
+}
+
+// remoteConsolePage is the console a browser gets from the remote console's address
+const remoteConsolePage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Boulder remote console</title>
+<style>
+body { margin: 0; display: flex; flex-direction: column; height: 100vh; background: #111; color: #ddd; font: 13px monospace; }
+#log { flex: 1; overflow-y: auto; margin: 0; padding: 8px; white-space: pre-wrap; }
+#line { border: 0; border-top: 1px solid #333; padding: 8px; background: #1a1a1a; color: #fff; font: inherit; outline: none; }
+.ERROR, .CRITICAL, .error { color: #f66; } .WARNING { color: #fc6; } .command { color: #6cf; }
+</style>
+</head>
+<body>
+<pre id="log"></pre>
+<input id="line" autofocus placeholder="Command">
+<script>
+const log = document.getElementById("log"), line = document.getElementById("line");
+const history = [];
+let back = 0;
+function print(text, kind) {
+	const atEnd = log.scrollTop + log.clientHeight >= log.scrollHeight - 4;
+	const div = document.createElement("div");
+	div.textContent = text;
+	div.className = kind || text.split(" ", 1)[0].replace(":", "");
+	log.appendChild(div);
+	if (atEnd) log.scrollTop = log.scrollHeight;
+}
+const socket = new WebSocket("ws://" + location.host + "/");
+socket.onmessage = event => print(event.data);
+socket.onclose = () => print("Disconnected", "error");
+line.onkeydown = event => {
+	if (event.key === "Enter" && line.value) {
+		print("> " + line.value, "command");
+		socket.send(line.value);
+		history.push(line.value);
+		back = history.length;
+		line.value = "";
+	} else if (event.key === "ArrowUp" && back > 0) {
+		line.value = history[--back];
+	} else if (event.key === "ArrowDown" && back < history.length) {
+		line.value = history[++back] || "";
+	}
+};
+</script>
+</body>
+</html>
+`
@@ -1,12 +1,12 @@
 package boulder
 
 // #cgo CFLAGS: -I..
-// #cgo LDFLAGS: -L../build -lboulder_shared -Wl,-rpath,${SRCDIR}/../build
 // #include <stdlib.h>
 // #include "../boulder_cgo.h"
 import "C"
 import (
 	"errors"
+	"image"
 	"unsafe"
 )
 
@@ -15,6 +15,7 @@ type Renderer struct {
 	engine       *Engine
 	clearColor   [4]float32
 	currentImage uint32
+	activeCamera *Camera
 }
 
 // NewRenderer creates a new Renderer instance
@@ -36,56 +37,121 @@ func (r *Renderer) GetClearColor() (red, green, blue, alpha float32) {
 	return r.clearColor[0], r.clearColor[1], r.clearColor[2], r.clearColor[3]
 }
 
+// BackdropFit is how SetBackdrop scales its image to the screen
+type BackdropFit int
+
+const (
+	BackdropContain BackdropFit = 0 // The whole image, with bars in the clear color
+	BackdropCover   BackdropFit = 1 // Fills the screen, cropping what overflows
+)
+
+// SetBackdrop draws an image at the start of every frame, over the clear color and under
+// models and UI, centred and scaled by fit. It is meant for splash screens and boot
+// videos; replacing it waits for the GPU to finish the frames in flight.
+func (r *Renderer) SetBackdrop(img image.Image, fit BackdropFit) error {
+	defer lockThread()()
+	if !r.engine.initialized {
+		return errNotInitialized
+	}
+	if img.Bounds().Empty() {
+		return errors.New("empty image")
+	}
+
+	rgba := tightNRGBA(img)
+	bounds := rgba.Bounds()
+	if C.boulder_set_backdrop(unsafe.Pointer(&rgba.Pix[0]), C.uint32_t(bounds.Dx()), C.uint32_t(bounds.Dy()), C.int(fit)) != 0 {
+		return lastError("failed to set backdrop")
+	}
+	return nil
+}
+
+// ClearBackdrop goes back to starting frames from the clear color alone
+func (r *Renderer) ClearBackdrop() {
+	if r.engine.initialized {
+		C.boulder_set_backdrop(nil, 0, 0, C.int(BackdropContain))
+	}
+}
+
+// HasBackdrop returns whether SetBackdrop's image is being drawn
+func (r *Renderer) HasBackdrop() bool {
+	return r.engine.initialized && C.boulder_has_backdrop() != 0
+}
+
 // BeginFrame starts a new frame and returns the image index
-// Returns -2 if swapchain recreation is needed
+// Returns -2 if swapchain recreation is needed, and an error while the app is paused in the
+// background (see Engine.IsPaused)
 func (r *Renderer) BeginFrame() (imageIndex uint32, err error) {
+	defer lockThread()()
 	if !r.engine.initialized {
-		return 0, errors.New("engine not initialized")
+		return 0, errNotInitialized
 	}
 
 	var idx C.uint32_t
 	result := C.boulder_begin_frame(&idx)
 
-	if result == -2 {
+	if result == -3 {
+		return 0, errors.New("app paused")
+	} else if result == -2 {
 		return 0, errors.New("swapchain recreation needed")
 	} else if result != 0 {
-		return 0, errors.New("failed to begin frame")
+		return 0, apiError(result, "failed to begin frame")
 	}
 
 	r.currentImage = uint32(idx)
 	return r.currentImage, nil
 }
 
-// EndFrame ends the current frame and presents it
+// EndFrame ends the current frame and presents it. In debug mode it also returns Vulkan
+// validation errors recorded during the frame.
 func (r *Renderer) EndFrame() error {
+	defer lockThread()()
 	if !r.engine.initialized {
-		return errors.New("engine not initialized")
+		return errNotInitialized
 	}
 
 	result := C.boulder_end_frame(C.uint32_t(r.currentImage))
 	if result != 0 {
-		return errors.New("failed to end frame")
+		return apiError(result, "failed to end frame")
 	}
 
+	if C.boulder_get_debug_mode() != 0 {
+		if message := takeAPIError(); message != "" {
+			return &Error{Code: ErrorAPIMisuse, Message: message}
+		}
+	}
 	return nil
 }
 
+// RenderModels draws every visible entity with a model. Pipelines bound before it have to
+// be bound again for DrawMesh.
+func (r *Renderer) RenderModels() error {
+	defer lockThread()()
+	if !r.engine.initialized {
+		return errNotInitialized
+	}
+
+	return apiError(C.boulder_render_models(), "failed to render models")
+}
+
 // SetViewport sets the viewport for rendering
-func (r *Renderer) SetViewport(x, y, width, height, minDepth, maxDepth float32) {
+func (r *Renderer) SetViewport(x, y, width, height, minDepth, maxDepth float32) error {
+	defer lockThread()()
 	if !r.engine.initialized {
-		return
+		return errNotInitialized
 	}
 
-	C.boulder_set_viewport(C.float(x), C.float(y), C.float(width), C.float(height), C.float(minDepth), C.float(maxDepth))
+	return apiError(C.boulder_set_viewport(C.float(x), C.float(y), C.float(width), C.float(height),
+		C.float(minDepth), C.float(maxDepth)), "failed to set viewport")
 }
 
 // SetScissor sets the scissor rectangle
-func (r *Renderer) SetScissor(x, y, width, height int) {
+func (r *Renderer) SetScissor(x, y, width, height int) error {
+	defer lockThread()()
 	if !r.engine.initialized {
-		return
+		return errNotInitialized
 	}
 
-	C.boulder_set_scissor(C.int(x), C.int(y), C.int(width), C.int(height))
+	return apiError(C.boulder_set_scissor(C.int(x), C.int(y), C.int(width), C.int(height)), "failed to set scissor")
 }
 
 // GetSwapchainExtent returns the current swapchain dimensions
@@ -97,30 +163,71 @@ func (r *Renderer) GetSwapchainExtent() (width, height int) {
 
 // RecreateSwapchain requests swapchain recreation
 func (r *Renderer) RecreateSwapchain() error {
+	defer lockThread()()
 	if !r.engine.initialized {
-		return errors.New("engine not initialized")
+		return errNotInitialized
 	}
 
 	if result := C.boulder_recreate_swapchain(); result != 0 {
-		return errors.New("failed to recreate swapchain")
+		return lastError("failed to recreate swapchain")
 	}
 
 	return nil
 }
 
-// DrawMesh draws a mesh using mesh shaders
-func (r *Renderer) DrawMesh(groupCountX, groupCountY, groupCountZ uint32) {
+// RequestScreenshot captures the next frame ended with EndFrame
+func (r *Renderer) RequestScreenshot() {
 	if !r.engine.initialized {
 		return
 	}
 
-	C.boulder_draw_mesh(C.uint32_t(groupCountX), C.uint32_t(groupCountY), C.uint32_t(groupCountZ))
+	C.boulder_request_screenshot()
+}
+
+// GetScreenshot returns the frame captured after RequestScreenshot. ok is false until
+// that frame has been ended.
+func (r *Renderer) GetScreenshot() (img *image.RGBA, ok bool, err error) {
+	defer lockThread()()
+	if !r.engine.initialized {
+		return nil, false, errNotInitialized
+	}
+
+	var w, h C.uint32_t
+	switch result := C.boulder_get_screenshot(nil, 0, &w, &h); result {
+	case 1:
+		return nil, false, nil
+	case 2:
+		if w == 0 || h == 0 {
+			return nil, false, errors.New("screenshot is empty")
+		}
+	default:
+		return nil, false, errors.New("no screenshot requested")
+	}
+
+	img = image.NewRGBA(image.Rect(0, 0, int(w), int(h)))
+	if result := C.boulder_get_screenshot((*C.uint8_t)(unsafe.Pointer(&img.Pix[0])), C.uint32_t(len(img.Pix)), &w, &h); result != 0 {
+		return nil, false, lastError("failed to read screenshot")
+	}
+	return img, true, nil
+}
+
+// DrawMesh draws a mesh using mesh shaders with the pipeline bound this frame
+func (r *Renderer) DrawMesh(groupCountX, groupCountY, groupCountZ uint32) error {
+	defer lockThread()()
+	if !r.engine.initialized {
+		return errNotInitialized
+	}
+
+	return apiError(C.boulder_draw_mesh(C.uint32_t(groupCountX), C.uint32_t(groupCountY), C.uint32_t(groupCountZ)),
+		"failed to draw mesh")
 }
 
-// SetPushConstants sets push constants for the bound pipeline
+// SetPushConstants sets push constants for the pipeline bound this frame, within its
+// PushConstantSize bytes
 func (r *Renderer) SetPushConstants(data interface{}, offset uint32) error {
+	defer lockThread()()
 	if !r.engine.initialized {
-		return errors.New("engine not initialized")
+		return errNotInitialized
 	}
 
 	// Convert data to byte slice
@@ -150,6 +257,5 @@ func (r *Renderer) SetPushConstants(data interface{}, offset uint32) error {
 		return errors.New("unsupported data type")
 	}
 
-	C.boulder_set_push_constants(ptr, size, C.uint32_t(offset))
-	return nil
+	return apiError(C.boulder_set_push_constants(ptr, size, C.uint32_t(offset)), "failed to set push constants")
 }
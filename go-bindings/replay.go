@@ -0,0 +1,228 @@
+package boulder
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+const (
+	defaultReplayLength  = 10 * time.Second
+	replayRecordInterval = 1.0 / 30 // Seconds between recorded frames
+)
+
+// replayFrame is the proxies' transforms at one moment, by server entity
+type replayFrame struct {
+	time       float64 // Local network time
+	transforms map[EntityID]TransformState
+}
+
+// Replay is a rolling buffer of the last few seconds of a ReplicationClient's proxies, for
+// kill cams and instant replays without recording a replay file. It records the
+// interpolated state sync transforms, so only entities moved by state sync are replayed,
+// and only those whose proxies still exist when it plays.
+type Replay struct {
+	client *ReplicationClient
+	length time.Duration
+	frames []replayFrame // Oldest first
+
+	playing  bool
+	cursor   float64 // Local time being shown
+	end      float64 // Local time playback stops at
+	speed    float32
+	camera   *Camera
+	previous *Camera // Active before playback, restored after
+	follow   EntityID
+	view     *SpectatorCamera
+	onFinish func()
+}
+
+// EnableReplayBuffer keeps the last length of the proxies' state (0 is 10 seconds) for
+// Replay.PlayRecent. State sync must be enabled.
+func (rc *ReplicationClient) EnableReplayBuffer(length time.Duration) *Replay {
+	if length <= 0 {
+		length = defaultReplayLength
+	}
+	if rc.replay == nil {
+		rc.replay = &Replay{client: rc, speed: 1}
+	}
+	rc.replay.length = length
+	return rc.replay
+}
+
+// GetReplay returns the replay buffer, or nil if EnableReplayBuffer wasn't called
+func (rc *ReplicationClient) GetReplay() *Replay {
+	return rc.replay
+}
+
+// GetBufferedDuration returns how far back the buffer currently reaches
+func (r *Replay) GetBufferedDuration() time.Duration {
+	if len(r.frames) < 2 {
+		return 0
+	}
+	return time.Duration((r.frames[len(r.frames)-1].time - r.frames[0].time) * float64(time.Second))
+}
+
+// PlayRecent replays the last fromSeconds (clamped to what is buffered) up to now, drawn from
+// camera, which is made active until playback ends and the previous camera is restored.
+// Proxies stop following the server while it plays; state keeps being received and recorded,
+// and they jump back to it afterwards. Call Update every frame after ReplicationClient.Update.
+func (r *Replay) PlayRecent(fromSeconds float32, camera *Camera) error {
+	if camera == nil {
+		return errors.New("camera is nil")
+	}
+	if fromSeconds <= 0 {
+		return errors.New("replay length must be positive")
+	}
+	if len(r.frames) < 2 {
+		return errors.New("nothing buffered to replay")
+	}
+
+	previous := camera.renderer.GetActiveCamera()
+	if err := camera.renderer.SetActiveCamera(camera); err != nil {
+		return err
+	}
+
+	r.end = r.frames[len(r.frames)-1].time
+	r.cursor = max(r.frames[0].time, r.end-float64(fromSeconds))
+	r.camera = camera
+	if previous != camera {
+		r.previous = previous
+	}
+	r.view = nil
+	r.playing = true
+	return r.show()
+}
+
+// Follow makes the replay camera follow an entity's proxy (by server entity), e.g. the
+// player who scored the kill; 0 leaves the camera where the game puts it
+func (r *Replay) Follow(serverEntity EntityID) {
+	r.follow = serverEntity
+	r.view = nil
+}
+
+// SetSpeed sets the playback rate, below 1 for slow motion
+func (r *Replay) SetSpeed(speed float32) {
+	if speed > 0 {
+		r.speed = speed
+	}
+}
+
+// OnFinished sets a function called when playback reaches the end or is stopped
+func (r *Replay) OnFinished(callback func()) {
+	r.onFinish = callback
+}
+
+// IsPlaying returns whether a replay is being shown
+func (r *Replay) IsPlaying() bool {
+	return r.playing
+}
+
+// GetRemaining returns how much of the replay is left to show, at normal speed
+func (r *Replay) GetRemaining() time.Duration {
+	if !r.playing {
+		return 0
+	}
+	return time.Duration((r.end - r.cursor) * float64(time.Second))
+}
+
+// Update advances playback by deltaTime and moves the proxies to the recorded state
+func (r *Replay) Update(deltaTime float32) error {
+	if !r.playing {
+		return nil
+	}
+
+	r.cursor += float64(deltaTime * r.speed)
+	if r.cursor >= r.end {
+		r.Stop()
+		return nil
+	}
+	if err := r.show(); err != nil {
+		return err
+	}
+
+	if r.follow == 0 {
+		return nil
+	}
+	proxy, ok := r.client.proxies[r.follow]
+	if !ok {
+		return nil
+	}
+	if r.view == nil {
+		r.view = NewSpectatorCamera(r.camera, r.client.world, SpectatorCameraConfig{})
+		r.view.SetMode(SpectateFollow)
+		r.view.SetTargets([]EntityID{proxy.entity.ID})
+		r.view.jump()
+	}
+	return r.view.Update(nil, deltaTime)
+}
+
+// Stop ends playback early, restoring the previous camera
+func (r *Replay) Stop() {
+	if !r.playing {
+		return
+	}
+	r.playing = false
+	r.view = nil
+	if r.previous != nil {
+		if err := r.previous.renderer.SetActiveCamera(r.previous); err != nil {
+			LogError("Replay: failed to restore camera: " + err.Error())
+		}
+		r.previous = nil
+	}
+	if r.onFinish != nil {
+		runCallback("ReplayFinished", r.onFinish)
+	}
+}
+
+// show moves every proxy to its recorded transform at the cursor
+func (r *Replay) show() error {
+	i := sort.Search(len(r.frames), func(i int) bool { return r.frames[i].time > r.cursor })
+	if i == 0 || i == len(r.frames) {
+		return nil
+	}
+	a, b := r.frames[i-1], r.frames[i]
+	t := float32((r.cursor - a.time) / (b.time - a.time))
+
+	for serverEntity, from := range a.transforms {
+		proxy, ok := r.client.proxies[serverEntity]
+		if !ok {
+			continue
+		}
+		transform := from
+		if to, ok := b.transforms[serverEntity]; ok {
+			transform = TransformState{
+				Position: lerpVector(from.Position, to.Position, t),
+				Rotation: Slerp(from.Rotation, to.Rotation, t),
+				Scale:    lerpVector(from.Scale, to.Scale, t),
+			}
+		}
+		if err := proxy.entity.SetFullTransform(transform.Position, transform.Rotation.ToEuler(), transform.Scale); err != nil {
+			return err
+		}
+		proxy.entity.SetRotationQuat(transform.Rotation)
+	}
+	return nil
+}
+
+// recording returns the frame to fill in at local time now, or nil if it is too soon after
+// the last one
+func (r *Replay) recording(now float64) *replayFrame {
+	if n := len(r.frames); n > 0 && now-r.frames[n-1].time < replayRecordInterval {
+		return nil
+	}
+
+	// Drop what has fallen out of the buffer, but never what playback is showing
+	cutoff := now - r.length.Seconds()
+	if r.playing {
+		cutoff = min(cutoff, r.cursor-1)
+	}
+	drop := 0
+	for drop < len(r.frames)-1 && r.frames[drop+1].time <= cutoff {
+		drop++
+	}
+	r.frames = r.frames[drop:]
+
+	r.frames = append(r.frames, replayFrame{time: now, transforms: make(map[EntityID]TransformState)})
+	return &r.frames[len(r.frames)-1]
+}
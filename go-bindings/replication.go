@@ -0,0 +1,434 @@
+package boulder
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// ============================================================================
+// Replication Server
+// ============================================================================
+
+// ReplicationServer informs clients about replicated entities. Connected clients are
+// told when entities are spawned or destroyed, and new clients automatically receive
+// a baseline of every entity that already exists.
+type ReplicationServer struct {
+	session      *NetworkSession
+	world        *World
+	archetypes   map[EntityID]string
+	order        []EntityID
+	connections  map[ConnectionHandle]*replicationConnection
+	nextBaseline uint32
+	state        *stateSender // Set by EnableStateSync
+	rateScale    float32      // Set by SetStateRateScale; 0 is 1
+}
+
+// replicationConnection is the server's view of one client
+type replicationConnection struct {
+	baselineID    uint32
+	baselineAcked bool
+}
+
+// NewReplicationServer creates a replication server on top of a network session
+func NewReplicationServer(session *NetworkSession, world *World) (*ReplicationServer, error) {
+	if !session.IsValid() {
+		return nil, errSessionNotInitialized
+	}
+
+	rs := &ReplicationServer{
+		session:     session,
+		world:       world,
+		archetypes:  make(map[EntityID]string),
+		connections: make(map[ConnectionHandle]*replicationConnection),
+	}
+
+	session.replication = rs
+	session.setControlHandler(controlBaselineAck, rs.handleBaselineAck)
+	session.addConnectionObserver(func(event NetworkEvent) {
+		switch e := event.(type) {
+		case ConnectedEvent:
+			rs.AddConnection(e.Connection)
+		case DisconnectedEvent:
+			rs.RemoveConnection(e.Connection)
+		}
+	})
+
+	return rs, nil
+}
+
+// Replicate marks an entity as replicated. Clients spawn a local proxy built by the
+// factory registered for archetype (see ReplicationClient.RegisterArchetype).
+func (rs *ReplicationServer) Replicate(entity *Entity, archetype string) error {
+	if _, ok := rs.archetypes[entity.ID]; ok {
+		return errors.New("entity already replicated")
+	}
+	if len(archetype) > math.MaxUint16 {
+		return errors.New("archetype name too long")
+	}
+
+	rs.archetypes[entity.ID] = archetype
+	rs.order = append(rs.order, entity.ID)
+
+	for conn := range rs.connections {
+		rs.sendSpawn(conn, entity.ID)
+	}
+
+	return nil
+}
+
+// Unreplicate stops replicating an entity and despawns its proxies on all clients
+func (rs *ReplicationServer) Unreplicate(entity EntityID) {
+	if _, ok := rs.archetypes[entity]; !ok {
+		return
+	}
+
+	delete(rs.archetypes, entity)
+	rs.forgetStateEntity(entity)
+	for i, id := range rs.order {
+		if id == entity {
+			rs.order = append(rs.order[:i], rs.order[i+1:]...)
+			break
+		}
+	}
+
+	payload := binary.LittleEndian.AppendUint64(nil, uint64(entity))
+	for conn := range rs.connections {
+		rs.session.sendControl(conn, controlDespawn, payload, true)
+	}
+}
+
+// DestroyEntity unreplicates an entity and destroys it in the server world
+func (rs *ReplicationServer) DestroyEntity(entity EntityID) {
+	rs.Unreplicate(entity)
+	rs.world.DestroyEntity(entity)
+}
+
+// IsReplicated reports whether an entity is replicated
+func (rs *ReplicationServer) IsReplicated(entity EntityID) bool {
+	_, ok := rs.archetypes[entity]
+	return ok
+}
+
+// GetArchetype returns the archetype an entity was replicated with
+func (rs *ReplicationServer) GetArchetype(entity EntityID) (string, bool) {
+	archetype, ok := rs.archetypes[entity]
+	return archetype, ok
+}
+
+// GetReplicatedEntities returns all replicated entities in spawn order
+func (rs *ReplicationServer) GetReplicatedEntities() []EntityID {
+	result := make([]EntityID, len(rs.order))
+	copy(result, rs.order)
+	return result
+}
+
+// AddConnection starts replicating to a connection and sends it the world baseline.
+// Connections are added automatically when the session reports them as connected.
+func (rs *ReplicationServer) AddConnection(conn ConnectionHandle) {
+	if _, ok := rs.connections[conn]; ok {
+		return
+	}
+
+	rs.connections[conn] = &replicationConnection{}
+	if err := rs.SendWorldBaseline(conn); err != nil {
+		LogError("Replication: failed to send world baseline: " + err.Error())
+	}
+}
+
+// RemoveConnection stops replicating to a connection
+func (rs *ReplicationServer) RemoveConnection(conn ConnectionHandle) {
+	delete(rs.connections, conn)
+	rs.forgetStateConnection(conn)
+}
+
+// GetConnections returns the connections being replicated to
+func (rs *ReplicationServer) GetConnections() []ConnectionHandle {
+	result := make([]ConnectionHandle, 0, len(rs.connections))
+	for conn := range rs.connections {
+		result = append(result, conn)
+	}
+	return result
+}
+
+// IsBaselineAcked reports whether a connection has applied its world baseline and can
+// receive delta updates
+func (rs *ReplicationServer) IsBaselineAcked(conn ConnectionHandle) bool {
+	if rc, ok := rs.connections[conn]; ok {
+		return rc.baselineAcked
+	}
+	return false
+}
+
+func (rs *ReplicationServer) sendSpawn(conn ConnectionHandle, entity EntityID) error {
+	payload := encodeSpawn(entity, rs.archetypes[entity], rs.world)
+	return rs.session.sendControl(conn, controlSpawn, payload, true)
+}
+
+// Spawn message layout:
+//
+//	entity    uint64
+//	archetype uint16 length + bytes
+//	flags     uint8 (1 = transform follows)
+//	transform 9 x float32 (position, rotation, scale)
+const spawnHasTransform = 1
+
+func encodeSpawn(entity EntityID, archetype string, world *World) []byte {
+	buf := make([]byte, 0, 8+2+len(archetype)+1+36)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(entity))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(archetype)))
+	buf = append(buf, archetype...)
+
+	e := &Entity{ID: entity, world: world}
+	position, rotation, scale, err := e.GetFullTransform()
+	if err != nil {
+		return append(buf, 0)
+	}
+
+	buf = append(buf, spawnHasTransform)
+	for _, v := range []Vector3{position, rotation, scale} {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v.X))
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v.Y))
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v.Z))
+	}
+	return buf
+}
+
+type spawnMessage struct {
+	entity       EntityID
+	archetype    string
+	hasTransform bool
+	position     Vector3
+	rotation     Vector3
+	scale        Vector3
+}
+
+func decodeSpawn(payload []byte) (spawnMessage, error) {
+	var msg spawnMessage
+	if len(payload) < 11 {
+		return msg, errors.New("truncated spawn message")
+	}
+
+	msg.entity = EntityID(binary.LittleEndian.Uint64(payload))
+	nameLen := int(binary.LittleEndian.Uint16(payload[8:]))
+	offset := 10
+	if len(payload) < offset+nameLen+1 {
+		return msg, errors.New("truncated spawn message")
+	}
+	msg.archetype = string(payload[offset : offset+nameLen])
+	offset += nameLen
+
+	flags := payload[offset]
+	offset++
+	if flags&spawnHasTransform == 0 {
+		return msg, nil
+	}
+	if len(payload) < offset+36 {
+		return msg, errors.New("truncated spawn message")
+	}
+
+	readVector := func() Vector3 {
+		v := Vector3{
+			X: math.Float32frombits(binary.LittleEndian.Uint32(payload[offset:])),
+			Y: math.Float32frombits(binary.LittleEndian.Uint32(payload[offset+4:])),
+			Z: math.Float32frombits(binary.LittleEndian.Uint32(payload[offset+8:])),
+		}
+		offset += 12
+		return v
+	}
+
+	msg.hasTransform = true
+	msg.position = readVector()
+	msg.rotation = readVector()
+	msg.scale = readVector()
+	return msg, nil
+}
+
+// ============================================================================
+// Replication Client
+// ============================================================================
+
+// ArchetypeFactory adds components (model, physics, ...) to a freshly spawned proxy.
+// The proxy already has the server's transform when the factory runs.
+type ArchetypeFactory func(proxy *Entity) error
+
+// SpawnCallback is called after a proxy has been spawned for a server entity
+type SpawnCallback func(serverEntity EntityID, proxy *Entity, archetype string)
+
+// DespawnCallback is called before the proxy of a server entity is destroyed
+type DespawnCallback func(serverEntity EntityID, proxy *Entity)
+
+type replicatedProxy struct {
+	entity    *Entity
+	archetype string
+	conn      ConnectionHandle
+}
+
+// ReplicationClient spawns and despawns local proxy entities as the server reports them
+type ReplicationClient struct {
+	session   *NetworkSession
+	world     *World
+	factories map[string]ArchetypeFactory
+	proxies   map[EntityID]*replicatedProxy
+	byLocal   map[EntityID]EntityID
+	onSpawn   SpawnCallback
+	onDespawn DespawnCallback
+
+	baselines    map[ConnectionHandle]*baselineAssembly
+	baselineDone map[ConnectionHandle]bool
+	onBaseline   BaselineCallback
+
+	state  *stateReceiver // Set by EnableStateSync
+	replay *Replay        // Set by EnableReplayBuffer
+}
+
+// NewReplicationClient creates a replication client on top of a network session
+func NewReplicationClient(session *NetworkSession, world *World) (*ReplicationClient, error) {
+	if !session.IsValid() {
+		return nil, errSessionNotInitialized
+	}
+
+	rc := &ReplicationClient{
+		session:   session,
+		world:     world,
+		factories: make(map[string]ArchetypeFactory),
+		proxies:   make(map[EntityID]*replicatedProxy),
+		byLocal:   make(map[EntityID]EntityID),
+
+		baselines:    make(map[ConnectionHandle]*baselineAssembly),
+		baselineDone: make(map[ConnectionHandle]bool),
+	}
+
+	session.setControlHandler(controlSpawn, rc.handleSpawn)
+	session.setControlHandler(controlDespawn, rc.handleDespawn)
+	session.setControlHandler(controlBaselineChunk, rc.handleBaselineChunk)
+	session.addConnectionObserver(func(event NetworkEvent) {
+		if e, ok := event.(DisconnectedEvent); ok {
+			rc.despawnConnection(e.Connection)
+			delete(rc.baselines, e.Connection)
+			delete(rc.baselineDone, e.Connection)
+		}
+	})
+
+	return rc, nil
+}
+
+// RegisterArchetype registers the factory used to build proxies of an archetype
+func (rc *ReplicationClient) RegisterArchetype(archetype string, factory ArchetypeFactory) {
+	rc.factories[archetype] = factory
+}
+
+// OnSpawn sets the function called whenever a proxy is spawned
+func (rc *ReplicationClient) OnSpawn(callback SpawnCallback) {
+	rc.onSpawn = callback
+}
+
+// OnDespawn sets the function called whenever a proxy is about to be destroyed
+func (rc *ReplicationClient) OnDespawn(callback DespawnCallback) {
+	rc.onDespawn = callback
+}
+
+// GetProxy returns the local proxy of a server entity
+func (rc *ReplicationClient) GetProxy(serverEntity EntityID) (*Entity, bool) {
+	if proxy, ok := rc.proxies[serverEntity]; ok {
+		return proxy.entity, true
+	}
+	return nil, false
+}
+
+// GetServerEntity returns the server entity a local proxy represents
+func (rc *ReplicationClient) GetServerEntity(local EntityID) (EntityID, bool) {
+	serverEntity, ok := rc.byLocal[local]
+	return serverEntity, ok
+}
+
+// GetProxyCount returns the number of live proxies
+func (rc *ReplicationClient) GetProxyCount() int {
+	return len(rc.proxies)
+}
+
+// Destroy unregisters the client from its session and destroys every proxy
+func (rc *ReplicationClient) Destroy() {
+	rc.session.setControlHandler(controlSpawn, nil)
+	rc.session.setControlHandler(controlDespawn, nil)
+	rc.session.setControlHandler(controlBaselineChunk, nil)
+	rc.session.setControlHandler(controlStateUpdate, nil)
+
+	for serverEntity := range rc.proxies {
+		rc.despawn(serverEntity)
+	}
+}
+
+func (rc *ReplicationClient) handleSpawn(conn ConnectionHandle, payload []byte, timestamp float64) {
+	msg, err := decodeSpawn(payload)
+	if err != nil {
+		LogError("Replication: " + err.Error())
+		return
+	}
+
+	rc.applySpawn(conn, msg)
+}
+
+func (rc *ReplicationClient) applySpawn(conn ConnectionHandle, msg spawnMessage) {
+	// A repeated spawn (e.g. after a baseline resync) replaces the old proxy
+	if _, ok := rc.proxies[msg.entity]; ok {
+		rc.despawn(msg.entity)
+	}
+
+	proxy, err := rc.world.NewEntity()
+	if err != nil {
+		LogError("Replication: failed to spawn proxy: " + err.Error())
+		return
+	}
+
+	if msg.hasTransform {
+		proxy.AddTransform(msg.position)
+		proxy.SetFullTransform(msg.position, msg.rotation, msg.scale)
+	}
+
+	if factory, ok := rc.factories[msg.archetype]; ok {
+		if err := factory(proxy); err != nil {
+			LogError("Replication: archetype " + msg.archetype + " failed: " + err.Error())
+		}
+	} else if msg.archetype != "" {
+		LogError("Replication: no factory registered for archetype " + msg.archetype)
+	}
+
+	rc.proxies[msg.entity] = &replicatedProxy{entity: proxy, archetype: msg.archetype, conn: conn}
+	rc.byLocal[proxy.ID] = msg.entity
+
+	if rc.onSpawn != nil {
+		runCallback("OnSpawn", func() { rc.onSpawn(msg.entity, proxy, msg.archetype) })
+	}
+}
+
+func (rc *ReplicationClient) handleDespawn(conn ConnectionHandle, payload []byte, timestamp float64) {
+	if len(payload) < 8 {
+		return
+	}
+	rc.despawn(EntityID(binary.LittleEndian.Uint64(payload)))
+}
+
+func (rc *ReplicationClient) despawn(serverEntity EntityID) {
+	proxy, ok := rc.proxies[serverEntity]
+	if !ok {
+		return
+	}
+
+	if rc.onDespawn != nil {
+		runCallback("OnDespawn", func() { rc.onDespawn(serverEntity, proxy.entity) })
+	}
+
+	delete(rc.proxies, serverEntity)
+	rc.forgetState(serverEntity)
+	delete(rc.byLocal, proxy.entity.ID)
+	proxy.entity.Destroy()
+}
+
+func (rc *ReplicationClient) despawnConnection(conn ConnectionHandle) {
+	for serverEntity, proxy := range rc.proxies {
+		if proxy.conn == conn {
+			rc.despawn(serverEntity)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package boulder
+
+import "sort"
+
+// Default replication priorities
+const (
+	ReplicationPriorityLow    float32 = 0.25
+	ReplicationPriorityNormal float32 = 1.0
+	ReplicationPriorityHigh   float32 = 4.0
+)
+
+// SchedulerConfig contains configuration for a ReplicationScheduler
+type SchedulerConfig struct {
+	// BytesPerSecond is the default per-connection bandwidth budget
+	BytesPerSecond int
+	// MaxBurst caps how many unused bytes a connection may bank (defaults to a quarter second of budget)
+	MaxBurst int
+	// StarvationTicks is how many consecutive ticks an entity may be deferred before it counts as starved
+	StarvationTicks int
+}
+
+// DefaultSchedulerConfig returns a configuration suitable for typical broadband clients
+func DefaultSchedulerConfig() SchedulerConfig {
+	return SchedulerConfig{
+		BytesPerSecond:  64 * 1024,
+		StarvationTicks: 30,
+	}
+}
+
+// ReplicationCandidate is an entity that has pending state for a connection
+type ReplicationCandidate struct {
+	Entity EntityID
+	Size   int // Encoded size in bytes
+}
+
+// SchedulerStats contains per-connection scheduling metrics
+type SchedulerStats struct {
+	Ticks           uint64
+	EntitiesSent    uint64
+	EntitiesDropped uint64 // Deferred to a later tick because the budget ran out
+	BytesSent       uint64
+	StarvedEntities int // Entities currently deferred for longer than StarvationTicks
+	MaxStarvation   int // Longest current deferral in ticks
+	BudgetBytes     int // Bytes available at the start of the last tick
+}
+
+type connectionSchedule struct {
+	bytesPerSecond int
+	credit         float64
+	accumulated    map[EntityID]float32
+	deferredTicks  map[EntityID]int
+	stats          SchedulerStats
+}
+
+// ReplicationScheduler picks which entities to send each tick so that the most
+// important and most stale entities go first and no connection exceeds its budget
+type ReplicationScheduler struct {
+	config      SchedulerConfig
+	priorities  map[EntityID]float32
+	connections map[ConnectionHandle]*connectionSchedule
+}
+
+// NewReplicationScheduler creates a new replication scheduler
+func NewReplicationScheduler(config SchedulerConfig) *ReplicationScheduler {
+	defaults := DefaultSchedulerConfig()
+	if config.BytesPerSecond <= 0 {
+		config.BytesPerSecond = defaults.BytesPerSecond
+	}
+	if config.StarvationTicks <= 0 {
+		config.StarvationTicks = defaults.StarvationTicks
+	}
+
+	return &ReplicationScheduler{
+		config:      config,
+		priorities:  make(map[EntityID]float32),
+		connections: make(map[ConnectionHandle]*connectionSchedule),
+	}
+}
+
+func (rs *ReplicationScheduler) connection(conn ConnectionHandle) *connectionSchedule {
+	cs, ok := rs.connections[conn]
+	if !ok {
+		cs = &connectionSchedule{
+			bytesPerSecond: rs.config.BytesPerSecond,
+			accumulated:    make(map[EntityID]float32),
+			deferredTicks:  make(map[EntityID]int),
+		}
+		rs.connections[conn] = cs
+	}
+	return cs
+}
+
+// SetPriority sets the replication priority of an entity (higher is sent more often)
+func (rs *ReplicationScheduler) SetPriority(entity EntityID, priority float32) {
+	if priority <= 0 {
+		priority = ReplicationPriorityLow
+	}
+	rs.priorities[entity] = priority
+}
+
+// GetPriority returns the replication priority of an entity
+func (rs *ReplicationScheduler) GetPriority(entity EntityID) float32 {
+	if priority, ok := rs.priorities[entity]; ok {
+		return priority
+	}
+	return ReplicationPriorityNormal
+}
+
+// SetBandwidthBudget sets the bandwidth budget for a single connection
+func (rs *ReplicationScheduler) SetBandwidthBudget(conn ConnectionHandle, bytesPerSecond int) {
+	if bytesPerSecond <= 0 {
+		bytesPerSecond = rs.config.BytesPerSecond
+	}
+	rs.connection(conn).bytesPerSecond = bytesPerSecond
+}
+
+// GetBandwidthBudget returns the bandwidth budget of a connection
+func (rs *ReplicationScheduler) GetBandwidthBudget(conn ConnectionHandle) int {
+	if cs, ok := rs.connections[conn]; ok {
+		return cs.bytesPerSecond
+	}
+	return rs.config.BytesPerSecond
+}
+
+// RemoveEntity forgets an entity's priority and staleness on every connection
+func (rs *ReplicationScheduler) RemoveEntity(entity EntityID) {
+	delete(rs.priorities, entity)
+	for _, cs := range rs.connections {
+		delete(cs.accumulated, entity)
+		delete(cs.deferredTicks, entity)
+	}
+}
+
+// RemoveConnection forgets all scheduling state for a connection
+func (rs *ReplicationScheduler) RemoveConnection(conn ConnectionHandle) {
+	delete(rs.connections, conn)
+}
+
+// Schedule returns the candidates to send to a connection this tick, in send order.
+// Each tick an entity's accumulated priority grows by its priority, so entities that
+// keep losing out eventually outrank everything else and are never starved forever.
+func (rs *ReplicationScheduler) Schedule(conn ConnectionHandle, deltaTime float32, candidates []ReplicationCandidate) []ReplicationCandidate {
+	cs := rs.connection(conn)
+
+	maxBurst := rs.config.MaxBurst
+	if maxBurst <= 0 {
+		maxBurst = cs.bytesPerSecond / 4
+	}
+
+	cs.credit += float64(cs.bytesPerSecond) * float64(deltaTime)
+	if cs.credit > float64(maxBurst) {
+		cs.credit = float64(maxBurst)
+	}
+	cs.stats.Ticks++
+	cs.stats.BudgetBytes = int(cs.credit)
+
+	for _, c := range candidates {
+		cs.accumulated[c.Entity] += rs.GetPriority(c.Entity)
+	}
+
+	ordered := make([]ReplicationCandidate, len(candidates))
+	copy(ordered, candidates)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return cs.accumulated[ordered[i].Entity] > cs.accumulated[ordered[j].Entity]
+	})
+
+	selected := make([]ReplicationCandidate, 0, len(ordered))
+	pending := make(map[EntityID]struct{}, len(ordered))
+	for _, c := range ordered {
+		pending[c.Entity] = struct{}{}
+		// A full bucket always lets one entity through, even if it is larger than the burst size
+		fullBucket := len(selected) == 0 && cs.credit >= float64(maxBurst)
+		if float64(c.Size) > cs.credit && !fullBucket {
+			cs.deferredTicks[c.Entity]++
+			cs.stats.EntitiesDropped++
+			continue
+		}
+
+		cs.credit -= float64(c.Size)
+		if cs.credit < 0 {
+			cs.credit = 0
+		}
+		cs.accumulated[c.Entity] = 0
+		delete(cs.deferredTicks, c.Entity)
+		cs.stats.EntitiesSent++
+		cs.stats.BytesSent += uint64(c.Size)
+		selected = append(selected, c)
+	}
+
+	// Entities that no longer have pending state are up to date
+	for entity := range cs.accumulated {
+		if _, ok := pending[entity]; !ok {
+			delete(cs.accumulated, entity)
+			delete(cs.deferredTicks, entity)
+		}
+	}
+
+	cs.stats.StarvedEntities = 0
+	cs.stats.MaxStarvation = 0
+	for _, ticks := range cs.deferredTicks {
+		if ticks > cs.stats.MaxStarvation {
+			cs.stats.MaxStarvation = ticks
+		}
+		if ticks >= rs.config.StarvationTicks {
+			cs.stats.StarvedEntities++
+		}
+	}
+
+	return selected
+}
+
+// GetStats returns scheduling metrics for a connection
+func (rs *ReplicationScheduler) GetStats(conn ConnectionHandle) SchedulerStats {
+	if cs, ok := rs.connections[conn]; ok {
+		return cs.stats
+	}
+	return SchedulerStats{}
+}
+
+// GetStarvation returns how many consecutive ticks an entity has been deferred on a connection
+func (rs *ReplicationScheduler) GetStarvation(conn ConnectionHandle, entity EntityID) int {
+	if cs, ok := rs.connections[conn]; ok {
+		return cs.deferredTicks[entity]
+	}
+	return 0
+}
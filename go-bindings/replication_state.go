@@ -0,0 +1,503 @@
+package boulder
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// StateSyncConfig sets up transform and velocity replication. The server and its clients
+// must use the same Quantization.
+type StateSyncConfig struct {
+	TickRate     float32               // Server snapshots per second; 0 is 20
+	Quantization QuantizationConfig    // Zero value is DefaultQuantizationConfig
+	Scheduler    *ReplicationScheduler // Server: limits each connection to its bandwidth budget; nil sends everything each tick
+	Interest     *InterestManager      // Server: only entities relevant to a connection are updated; nil updates all
+
+	InterpolationDelay time.Duration // Client: how far behind the newest snapshot proxies are shown; 0 is 100ms
+	MaxExtrapolation   time.Duration // Client: how long proxies keep moving on their velocity when snapshots stop; 0 is 250ms
+}
+
+// DefaultStateSyncConfig returns 20 snapshots per second shown 100ms behind
+func DefaultStateSyncConfig() StateSyncConfig {
+	return StateSyncConfig{
+		TickRate:           20,
+		Quantization:       DefaultQuantizationConfig(),
+		InterpolationDelay: 100 * time.Millisecond,
+		MaxExtrapolation:   250 * time.Millisecond,
+	}
+}
+
+func (c StateSyncConfig) withDefaults() StateSyncConfig {
+	defaults := DefaultStateSyncConfig()
+	if c.TickRate <= 0 {
+		c.TickRate = defaults.TickRate
+	}
+	if c.Quantization == (QuantizationConfig{}) {
+		c.Quantization = defaults.Quantization
+	}
+	if c.InterpolationDelay <= 0 {
+		c.InterpolationDelay = defaults.InterpolationDelay
+	}
+	if c.MaxExtrapolation <= 0 {
+		c.MaxExtrapolation = defaults.MaxExtrapolation
+	}
+	return c
+}
+
+// State update message layout, one per packet so each can be acked on its own:
+//
+//	sequence   uint16 (never 0)
+//	serverTime float64 seconds
+//	entities until the end:
+//		entity   uint64
+//		delta    baseline sequence + EncodeDelta (see TransformDeltaEncoder)
+//		flags    uint8 (1 = velocity follows)
+//		velocity 3 x zigzag varint, in stateVelocityPrecision steps
+//
+// The ack is the sequence alone.
+const (
+	stateHasVelocity       = 1
+	stateVelocityPrecision = 0.01
+	stateHeaderSize        = 10
+	stateMaxPacketSize     = 1200 // Stays under the usual MTU
+	stateEntryEstimate     = 24   // Typical entry size, for the scheduler
+)
+
+// ============================================================================
+// Server
+// ============================================================================
+
+// stateSender snapshots replicated entities for a ReplicationServer
+type stateSender struct {
+	config    StateSyncConfig
+	encoder   *TransformDeltaEncoder
+	sequences map[ConnectionHandle]uint16 // Last sent to each connection
+	elapsed   float32
+}
+
+// EnableStateSync sends the transform and velocity of replicated entities to clients at
+// config.TickRate, delta compressed against the last snapshot each client acknowledged.
+// Clients calling ReplicationClient.EnableStateSync move their proxies to match. Call
+// Update every frame to send the snapshots.
+func (rs *ReplicationServer) EnableStateSync(config StateSyncConfig) {
+	config = config.withDefaults()
+	rs.state = &stateSender{
+		config:    config,
+		encoder:   NewTransformDeltaEncoder(NewTransformCodec(config.Quantization)),
+		sequences: make(map[ConnectionHandle]uint16),
+	}
+	rs.session.setControlHandler(controlStateAck, rs.handleStateAck)
+}
+
+// DisableStateSync stops sending snapshots
+func (rs *ReplicationServer) DisableStateSync() {
+	rs.state = nil
+	rs.session.setControlHandler(controlStateAck, nil)
+}
+
+// SetStateRateScale sends snapshots at a fraction of the state sync TickRate, e.g. to
+// shed load on an overloaded server (see TickProfiler). 1 restores the full rate.
+func (rs *ReplicationServer) SetStateRateScale(scale float32) {
+	if scale <= 0 || scale > 1 {
+		scale = 1
+	}
+	rs.rateScale = scale
+}
+
+// GetStateRateScale returns the fraction of the state sync TickRate snapshots are sent at
+func (rs *ReplicationServer) GetStateRateScale() float32 {
+	if rs.rateScale <= 0 {
+		return 1
+	}
+	return rs.rateScale
+}
+
+// Update sends a snapshot to every client whose baseline is acked once a tick has passed
+func (rs *ReplicationServer) Update(deltaTime float32) {
+	s := rs.state
+	if s == nil {
+		return
+	}
+
+	interval := 1 / (s.config.TickRate * rs.GetStateRateScale())
+	s.elapsed += deltaTime
+	if s.elapsed < interval {
+		return
+	}
+	tickTime := s.elapsed
+	// Don't try to catch up on ticks missed in a long frame
+	s.elapsed = float32(math.Mod(float64(s.elapsed), float64(interval)))
+
+	states := make(map[EntityID]entityState, len(rs.order))
+	for _, id := range rs.order {
+		state, ok := readEntityState(&Entity{ID: id, world: rs.world})
+		if !ok {
+			continue
+		}
+		states[id] = state
+		if s.config.Interest != nil {
+			s.config.Interest.UpdateEntity(id, state.transform.Position)
+		}
+	}
+
+	serverTime := rs.session.GetServerTime()
+	for conn, rc := range rs.connections {
+		if !rc.baselineAcked {
+			continue
+		}
+
+		candidates := make([]ReplicationCandidate, 0, len(rs.order))
+		for _, id := range rs.order {
+			if _, ok := states[id]; !ok {
+				continue
+			}
+			if s.config.Interest != nil && !s.config.Interest.IsRelevant(conn, id) {
+				continue
+			}
+			candidates = append(candidates, ReplicationCandidate{Entity: id, Size: stateEntryEstimate})
+		}
+		if s.config.Scheduler != nil {
+			candidates = s.config.Scheduler.Schedule(conn, tickTime, candidates)
+		}
+		rs.sendState(conn, candidates, states, serverTime)
+	}
+}
+
+// sendState packs the candidates' states into as many packets as they need
+func (rs *ReplicationServer) sendState(conn ConnectionHandle, candidates []ReplicationCandidate, states map[EntityID]entityState, serverTime float64) {
+	s := rs.state
+	var packet []byte
+	var sequence uint16
+
+	flush := func() {
+		if len(packet) > stateHeaderSize {
+			rs.session.sendControl(conn, controlStateUpdate, packet, false)
+		}
+		packet = nil
+	}
+
+	for _, c := range candidates {
+		if packet == nil {
+			sequence = s.sequences[conn] + 1
+			if sequence == 0 {
+				sequence = 1
+			}
+			s.sequences[conn] = sequence
+			packet = make([]byte, 0, stateMaxPacketSize)
+			packet = binary.LittleEndian.AppendUint16(packet, sequence)
+			packet = binary.LittleEndian.AppendUint64(packet, math.Float64bits(serverTime))
+		}
+
+		state := states[c.Entity]
+		packet = binary.LittleEndian.AppendUint64(packet, uint64(c.Entity))
+		packet = s.encoder.Encode(packet, conn, c.Entity, state.transform, sequence)
+		if state.hasVelocity {
+			packet = append(packet, stateHasVelocity)
+			for _, v := range []float32{state.velocity.X, state.velocity.Y, state.velocity.Z} {
+				packet = binary.AppendUvarint(packet, zigzag(int64(math.Round(float64(v)/stateVelocityPrecision))))
+			}
+		} else {
+			packet = append(packet, 0)
+		}
+
+		if len(packet) >= stateMaxPacketSize-64 {
+			flush()
+		}
+	}
+	flush()
+}
+
+func (rs *ReplicationServer) handleStateAck(conn ConnectionHandle, payload []byte, timestamp float64) {
+	if rs.state == nil || len(payload) < 2 {
+		return
+	}
+	rs.state.encoder.Ack(conn, binary.LittleEndian.Uint16(payload))
+}
+
+// forgetStateEntity drops an entity from state sync
+func (rs *ReplicationServer) forgetStateEntity(entity EntityID) {
+	if rs.state == nil {
+		return
+	}
+	rs.state.encoder.RemoveEntity(entity)
+	if rs.state.config.Scheduler != nil {
+		rs.state.config.Scheduler.RemoveEntity(entity)
+	}
+	if rs.state.config.Interest != nil {
+		rs.state.config.Interest.RemoveEntity(entity)
+	}
+}
+
+// forgetStateConnection drops a connection's baselines and budget
+func (rs *ReplicationServer) forgetStateConnection(conn ConnectionHandle) {
+	if rs.state == nil {
+		return
+	}
+	rs.state.encoder.RemoveConnection(conn)
+	delete(rs.state.sequences, conn)
+	if rs.state.config.Scheduler != nil {
+		rs.state.config.Scheduler.RemoveConnection(conn)
+	}
+}
+
+// entityState is what state sync replicates of an entity
+type entityState struct {
+	transform   TransformState
+	velocity    Vector3
+	hasVelocity bool
+}
+
+func readEntityState(entity *Entity) (entityState, bool) {
+	var state entityState
+	position, _, scale, err := entity.GetFullTransform()
+	if err != nil {
+		return state, false
+	}
+	rotation, err := entity.GetRotationQuat()
+	if err != nil {
+		return state, false
+	}
+	state.transform = TransformState{Position: position, Rotation: rotation, Scale: scale}
+	if velocity, err := entity.GetVelocity(); err == nil {
+		state.velocity = velocity
+		state.hasVelocity = true
+	}
+	return state, true
+}
+
+// ============================================================================
+// Client
+// ============================================================================
+
+// stateSnapshot is one received state of a proxy
+type stateSnapshot struct {
+	time  float64 // Server time
+	state entityState
+}
+
+// stateReceiver interpolates proxies for a ReplicationClient
+type stateReceiver struct {
+	config    StateSyncConfig
+	decoder   *TransformDeltaDecoder
+	snapshots map[EntityID][]stateSnapshot // By server entity, oldest first
+	offset    float64                      // Server time minus local time, from the snapshots
+	hasOffset bool
+}
+
+// stateBufferSize is how many snapshots each proxy keeps
+const stateBufferSize = 32
+
+// EnableStateSync receives the snapshots of a server with state sync enabled and moves
+// proxies between them, config.InterpolationDelay behind the server, so they move smoothly
+// however the packets arrive. Call Update every frame before rendering.
+func (rc *ReplicationClient) EnableStateSync(config StateSyncConfig) {
+	config = config.withDefaults()
+	rc.state = &stateReceiver{
+		config:    config,
+		decoder:   NewTransformDeltaDecoder(NewTransformCodec(config.Quantization)),
+		snapshots: make(map[EntityID][]stateSnapshot),
+	}
+	rc.session.setControlHandler(controlStateUpdate, rc.handleStateUpdate)
+}
+
+// DisableStateSync stops moving proxies; they keep their last transform
+func (rc *ReplicationClient) DisableStateSync() {
+	rc.state = nil
+	rc.session.setControlHandler(controlStateUpdate, nil)
+}
+
+// GetProxyVelocity returns the last velocity the server sent for an entity
+func (rc *ReplicationClient) GetProxyVelocity(serverEntity EntityID) (Vector3, bool) {
+	if rc.state == nil {
+		return Vector3{}, false
+	}
+	snapshots := rc.state.snapshots[serverEntity]
+	if len(snapshots) == 0 || !snapshots[len(snapshots)-1].state.hasVelocity {
+		return Vector3{}, false
+	}
+	return snapshots[len(snapshots)-1].state.velocity, true
+}
+
+func (rc *ReplicationClient) handleStateUpdate(conn ConnectionHandle, payload []byte, timestamp float64) {
+	r := rc.state
+	if r == nil || len(payload) < stateHeaderSize {
+		return
+	}
+
+	sequence := binary.LittleEndian.Uint16(payload)
+	serverTime := math.Float64frombits(binary.LittleEndian.Uint64(payload[2:]))
+	if err := rc.applyState(payload[stateHeaderSize:], sequence, serverTime); err != nil {
+		LogError("Replication: " + err.Error())
+		return
+	}
+
+	// Use the synchronized clock when there is one, otherwise the snapshots' own times; the
+	// smallest offset has the least delay in it
+	offset := serverTime - timestamp
+	if !r.hasOffset || offset < r.offset {
+		r.offset = offset
+		r.hasOffset = true
+	}
+
+	rc.session.sendControl(conn, controlStateAck, binary.LittleEndian.AppendUint16(nil, sequence), false)
+}
+
+func (rc *ReplicationClient) applyState(data []byte, sequence uint16, serverTime float64) error {
+	r := rc.state
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return errors.New("truncated state update")
+		}
+		entity := EntityID(binary.LittleEndian.Uint64(data))
+		data = data[8:]
+
+		transform, n, err := r.decoder.Decode(data, entity, sequence)
+		if err != nil {
+			// The rest of the packet can't be read without this entry's length
+			return err
+		}
+		data = data[n:]
+
+		if len(data) < 1 {
+			return errors.New("truncated state update")
+		}
+		state := entityState{transform: transform}
+		flags := data[0]
+		data = data[1:]
+		if flags&stateHasVelocity != 0 {
+			var v [3]float32
+			for i := range v {
+				q, n := binary.Uvarint(data)
+				if n <= 0 {
+					return errors.New("truncated state update")
+				}
+				data = data[n:]
+				v[i] = float32(float64(unzigzag(q)) * stateVelocityPrecision)
+			}
+			state.velocity = Vector3{X: v[0], Y: v[1], Z: v[2]}
+			state.hasVelocity = true
+		}
+
+		if _, ok := rc.proxies[entity]; ok {
+			r.add(entity, stateSnapshot{time: serverTime, state: state})
+		}
+	}
+	return nil
+}
+
+// add inserts a snapshot in time order; late packets still fill in the history
+func (r *stateReceiver) add(entity EntityID, snapshot stateSnapshot) {
+	snapshots := r.snapshots[entity]
+	i := sort.Search(len(snapshots), func(i int) bool { return snapshots[i].time > snapshot.time })
+	if i > 0 && snapshots[i-1].time == snapshot.time {
+		return
+	}
+	snapshots = append(snapshots, stateSnapshot{})
+	copy(snapshots[i+1:], snapshots[i:])
+	snapshots[i] = snapshot
+	if len(snapshots) > stateBufferSize {
+		snapshots = snapshots[len(snapshots)-stateBufferSize:]
+	}
+	r.snapshots[entity] = snapshots
+}
+
+// Update moves every proxy to where its entity was InterpolationDelay ago, and records it in
+// the replay buffer. While a replay plays the proxies are left to it.
+func (rc *ReplicationClient) Update() {
+	r := rc.state
+	if r == nil || !r.hasOffset {
+		return
+	}
+
+	now := rc.session.GetLocalTime() + r.offset
+	if rc.session.GetClockStats().Synchronized {
+		now = rc.session.GetServerTime()
+	}
+	renderTime := now - r.config.InterpolationDelay.Seconds()
+
+	var frame *replayFrame
+	if rc.replay != nil {
+		frame = rc.replay.recording(rc.session.GetLocalTime())
+	}
+
+	for serverEntity, snapshots := range r.snapshots {
+		proxy, ok := rc.proxies[serverEntity]
+		if !ok || len(snapshots) == 0 {
+			continue
+		}
+
+		// Drop snapshots nothing will interpolate from again
+		for len(snapshots) > 2 && snapshots[1].time <= renderTime {
+			snapshots = snapshots[1:]
+		}
+		r.snapshots[serverEntity] = snapshots
+
+		state := r.sample(snapshots, renderTime)
+		t := state.transform
+		if frame != nil {
+			frame.transforms[serverEntity] = t
+		}
+		if rc.replay != nil && rc.replay.playing {
+			continue
+		}
+		if err := proxy.entity.SetFullTransform(t.Position, t.Rotation.ToEuler(), t.Scale); err != nil {
+			continue
+		}
+		proxy.entity.SetRotationQuat(t.Rotation)
+	}
+}
+
+// sample returns the state at renderTime, interpolated between the snapshots around it or
+// extrapolated a little past the newest
+func (r *stateReceiver) sample(snapshots []stateSnapshot, renderTime float64) entityState {
+	first := snapshots[0]
+	if renderTime <= first.time {
+		return first.state
+	}
+
+	for i := 1; i < len(snapshots); i++ {
+		b := snapshots[i]
+		if renderTime > b.time {
+			continue
+		}
+		a := snapshots[i-1]
+		t := float32((renderTime - a.time) / (b.time - a.time))
+		at, bt := a.state.transform, b.state.transform
+		return entityState{
+			transform: TransformState{
+				Position: lerpVector(at.Position, bt.Position, t),
+				Rotation: Slerp(at.Rotation, bt.Rotation, t),
+				Scale:    lerpVector(at.Scale, bt.Scale, t),
+			},
+			velocity:    lerpVector(a.state.velocity, b.state.velocity, t),
+			hasVelocity: b.state.hasVelocity,
+		}
+	}
+
+	// Past the newest snapshot: keep going on its velocity for a while, then hold
+	last := snapshots[len(snapshots)-1]
+	if !last.state.hasVelocity {
+		return last.state
+	}
+	ahead := float32(math.Min(renderTime-last.time, r.config.MaxExtrapolation.Seconds()))
+	state := last.state
+	v := state.velocity
+	state.transform.Position = Vector3{
+		X: state.transform.Position.X + v.X*ahead,
+		Y: state.transform.Position.Y + v.Y*ahead,
+		Z: state.transform.Position.Z + v.Z*ahead,
+	}
+	return state
+}
+
+// forgetState drops the snapshots of a despawned proxy
+func (rc *ReplicationClient) forgetState(serverEntity EntityID) {
+	if rc.state == nil {
+		return
+	}
+	delete(rc.state.snapshots, serverEntity)
+	rc.state.decoder.RemoveEntity(serverEntity)
+}
@@ -0,0 +1,242 @@
+package boulder
+
+import (
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// RNG hands out deterministic random number streams derived from one seed. Each system
+// draws from its own named stream (e.g. "loot", "ai", "vfx"), so extra VFX rolls on one
+// machine don't change loot rolls, and a replay started from the same seed, or from saved
+// state, rolls the same numbers. RNGs are not safe for concurrent use.
+type RNG struct {
+	seed    uint64
+	streams map[string]*RNGStream
+}
+
+// RNGStream is one sequence of random numbers (xoshiro256**)
+type RNGStream struct {
+	state [4]uint64
+}
+
+// NewRNG creates an RNG whose streams are all derived from seed
+func NewRNG(seed uint64) *RNG {
+	return &RNG{
+		seed:    seed,
+		streams: make(map[string]*RNGStream),
+	}
+}
+
+// GetSeed returns the seed the RNG was created or reset with
+func (r *RNG) GetSeed() uint64 {
+	return r.seed
+}
+
+// Stream returns the named stream, creating it on first use. A stream's sequence depends
+// only on the seed and its name, not on which other streams exist or were used.
+func (r *RNG) Stream(name string) *RNGStream {
+	if s, ok := r.streams[name]; ok {
+		return s
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	s := newRNGStream(r.seed ^ h.Sum64())
+	r.streams[name] = s
+	return s
+}
+
+// Reset reseeds the RNG, restarting every stream
+func (r *RNG) Reset(seed uint64) {
+	r.seed = seed
+	r.streams = make(map[string]*RNGStream)
+}
+
+type rngSave struct {
+	Seed    uint64               `json:"seed"`
+	Streams map[string][4]uint64 `json:"streams"`
+}
+
+// MarshalJSON saves the seed and the position of every stream, for save games and replays
+func (r *RNG) MarshalJSON() ([]byte, error) {
+	save := rngSave{Seed: r.seed, Streams: make(map[string][4]uint64, len(r.streams))}
+	for name, s := range r.streams {
+		save.Streams[name] = s.state
+	}
+	return json.Marshal(save)
+}
+
+// UnmarshalJSON restores state saved by MarshalJSON. Streams handed out before keep
+// working and continue from the restored positions.
+func (r *RNG) UnmarshalJSON(data []byte) error {
+	var save rngSave
+	if err := json.Unmarshal(data, &save); err != nil {
+		return err
+	}
+	for _, state := range save.Streams {
+		if state == [4]uint64{} {
+			return errors.New("invalid random number stream state")
+		}
+	}
+
+	old := r.streams
+	r.seed = save.Seed
+	r.streams = make(map[string]*RNGStream, len(save.Streams))
+	for name, state := range save.Streams {
+		s := old[name]
+		if s == nil {
+			s = &RNGStream{}
+		}
+		s.state = state
+		r.streams[name] = s
+	}
+	// Streams not in the save restart, as if they hadn't been used yet
+	for name, s := range old {
+		if _, ok := r.streams[name]; !ok {
+			*s = *r.Stream(name)
+			r.streams[name] = s
+		}
+	}
+	return nil
+}
+
+// CheckpointState returns the RNG's state for Checkpoints.AddState
+func (r *RNG) CheckpointState() CheckpointState {
+	return CheckpointState{
+		Save: r.MarshalJSON,
+		Load: r.UnmarshalJSON,
+	}
+}
+
+func newRNGStream(seed uint64) *RNGStream {
+	// SplitMix64 spreads the seed over the state, which is never all zero
+	s := &RNGStream{}
+	for i := range s.state {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		s.state[i] = z ^ (z >> 31)
+	}
+	return s
+}
+
+// Uint64 returns a random 64-bit number
+func (s *RNGStream) Uint64() uint64 {
+	result := bits.RotateLeft64(s.state[1]*5, 7) * 9
+	t := s.state[1] << 17
+	s.state[2] ^= s.state[0]
+	s.state[3] ^= s.state[1]
+	s.state[1] ^= s.state[2]
+	s.state[0] ^= s.state[3]
+	s.state[2] ^= t
+	s.state[3] = bits.RotateLeft64(s.state[3], 45)
+	return result
+}
+
+// Intn returns a number in [0, n), without bias. It returns 0 if n <= 0.
+func (s *RNGStream) Intn(n int) int {
+	if n <= 0 {
+		return 0
+	}
+
+	// Lemire's multiply and reject
+	bound := uint64(n)
+	hi, lo := bits.Mul64(s.Uint64(), bound)
+	if lo < bound {
+		threshold := -bound % bound
+		for lo < threshold {
+			hi, lo = bits.Mul64(s.Uint64(), bound)
+		}
+	}
+	return int(hi)
+}
+
+// Range returns a number in [min, max]
+func (s *RNGStream) Range(min, max int) int {
+	if max <= min {
+		return min
+	}
+	return min + s.Intn(max-min+1)
+}
+
+// Float64 returns a number in [0, 1)
+func (s *RNGStream) Float64() float64 {
+	return float64(s.Uint64()>>11) / (1 << 53)
+}
+
+// Float32 returns a number in [0, 1)
+func (s *RNGStream) Float32() float32 {
+	return float32(s.Uint64()>>40) / (1 << 24)
+}
+
+// RangeFloat returns a number in [min, max)
+func (s *RNGStream) RangeFloat(min, max float32) float32 {
+	return min + (max-min)*s.Float32()
+}
+
+// Chance returns true with probability p
+func (s *RNGStream) Chance(p float64) bool {
+	return s.Float64() < p
+}
+
+// Normal returns a normally distributed number with the given mean and standard deviation
+func (s *RNGStream) Normal(mean, stddev float64) float64 {
+	// Box-Muller; 1 - Float64 is never 0
+	u := 1 - s.Float64()
+	v := s.Float64()
+	return mean + stddev*math.Sqrt(-2*math.Log(u))*math.Cos(2*math.Pi*v)
+}
+
+// Weighted returns the index of a weight chosen with probability proportional to it, e.g.
+// for loot tables. It returns -1 if no weight is positive.
+func (s *RNGStream) Weighted(weights []float64) int {
+	total := 0.0
+	for _, w := range weights {
+		if w > 0 {
+			total += w
+		}
+	}
+	if total <= 0 {
+		return -1
+	}
+
+	roll := s.Float64() * total
+	last := -1
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		if roll < w {
+			return i
+		}
+		roll -= w
+		last = i
+	}
+	// Rounding left roll just past the last weight
+	return last
+}
+
+// Shuffle randomly orders n elements using swap
+func (s *RNGStream) Shuffle(n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, s.Intn(i+1))
+	}
+}
+
+// InsideUnitSphere returns a random point in the unit sphere, e.g. for particle spread
+func (s *RNGStream) InsideUnitSphere() Vector3 {
+	for {
+		v := Vector3{
+			X: s.RangeFloat(-1, 1),
+			Y: s.RangeFloat(-1, 1),
+			Z: s.RangeFloat(-1, 1),
+		}
+		if v.X*v.X+v.Y*v.Y+v.Z*v.Z <= 1 {
+			return v
+		}
+	}
+}
@@ -0,0 +1,509 @@
+package boulder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// rollbackRingSize is how many frames of input are kept per player
+const rollbackRingSize = 128
+
+// RollbackConfig configures a RollbackSession. Every peer in a match must use the same
+// Players, InputDelay and ChecksumInterval.
+type RollbackConfig struct {
+	Players          int     // Number of players, including the local one
+	LocalPlayer      int     // Index of the local player
+	InputDelay       int     // Frames between sampling local input and applying it
+	MaxPrediction    int     // Frames the simulation may run ahead of confirmed input
+	ChecksumInterval int     // Frames between desync checks (0 disables them)
+	FrameRate        float64 // Simulation frames per second, used for frame advantage
+}
+
+// DefaultRollbackConfig returns settings suited to a two player fighting game at 60 Hz
+func DefaultRollbackConfig() RollbackConfig {
+	return RollbackConfig{
+		Players:          2,
+		LocalPlayer:      0,
+		InputDelay:       2,
+		MaxPrediction:    8,
+		ChecksumInterval: 30,
+		FrameRate:        60,
+	}
+}
+
+// RollbackAdvanceFunc simulates one frame using one input per player. It is called again
+// for frames that are re-simulated after a misprediction, so it must be deterministic and
+// should skip effects outside the world (sounds, particles) while IsResimulating is true.
+type RollbackAdvanceFunc func(frame int, inputs [][]byte)
+
+// DesyncCallback is called when a peer's checksum for a confirmed frame differs from ours
+type DesyncCallback func(frame int, player int, local, remote uint32)
+
+// RollbackStats describes the state of a RollbackSession
+type RollbackStats struct {
+	Frame            int     // Next frame to be simulated
+	ConfirmedFrame   int     // Latest frame for which every player's input is known
+	Rollbacks        int     // Number of rollbacks performed
+	RolledBackFrames int     // Total frames re-simulated
+	MaxRollback      int     // Longest rollback in frames
+	FrameAdvantage   float64 // See GetFrameAdvantage
+	Desyncs          int     // Number of checksum mismatches
+}
+
+type rollbackInput struct {
+	frame     int
+	input     []byte
+	confirmed bool
+}
+
+type rollbackSnapshot struct {
+	frame int
+	data  []byte
+}
+
+type rollbackPlayer struct {
+	remote      bool
+	conn        ConnectionHandle
+	lastFrame   int // Latest frame with confirmed input
+	lastInput   []byte
+	remoteFrame int // Frame the peer was simulating when it last sent input
+	inputs      []rollbackInput
+}
+
+type remoteChecksum struct {
+	player   int
+	checksum uint32
+}
+
+// RollbackSession implements GGPO-style rollback netcode on top of a World. Each frame the
+// game adds its local input and calls AdvanceFrame; missing remote input is predicted by
+// repeating the player's last input, and when the real input arrives and differs the world
+// is restored from a snapshot and the affected frames are re-simulated.
+type RollbackSession struct {
+	world   *World
+	session *NetworkSession
+	config  RollbackConfig
+	advance RollbackAdvanceFunc
+
+	frame        int
+	rollbackFrom int
+	resimulating bool
+	players      []rollbackPlayer
+	peers        map[ConnectionHandle]int
+	snapshots    []rollbackSnapshot
+
+	nextChecksum    int
+	localChecksums  map[int]uint32
+	remoteChecksums map[int][]remoteChecksum
+	onDesync        DesyncCallback
+
+	stats RollbackStats
+}
+
+// NewRollbackSession creates a rollback session. session may be nil for local-only play
+// (for example to test determinism); otherwise remote players are added with
+// AddRemotePlayer. The game must keep updating and polling the NetworkSession so that
+// remote input is received.
+func NewRollbackSession(world *World, session *NetworkSession, config RollbackConfig, advance RollbackAdvanceFunc) (*RollbackSession, error) {
+	if world == nil || advance == nil {
+		return nil, errors.New("rollback session requires a world and an advance function")
+	}
+	if config.Players < 1 || config.LocalPlayer < 0 || config.LocalPlayer >= config.Players {
+		return nil, errors.New("invalid rollback player configuration")
+	}
+	if config.InputDelay < 0 || config.MaxPrediction < 0 ||
+		config.InputDelay+config.MaxPrediction >= rollbackRingSize/2 {
+		return nil, fmt.Errorf("input delay plus prediction must be below %d frames", rollbackRingSize/2)
+	}
+	if config.FrameRate <= 0 {
+		config.FrameRate = 60
+	}
+
+	rs := &RollbackSession{
+		world:           world,
+		session:         session,
+		config:          config,
+		advance:         advance,
+		rollbackFrom:    -1,
+		players:         make([]rollbackPlayer, config.Players),
+		peers:           make(map[ConnectionHandle]int),
+		snapshots:       make([]rollbackSnapshot, config.MaxPrediction+2),
+		nextChecksum:    config.ChecksumInterval,
+		localChecksums:  make(map[int]uint32),
+		remoteChecksums: make(map[int][]remoteChecksum),
+	}
+
+	// Frames before the input delay has elapsed have no input from anyone
+	for i := range rs.players {
+		rs.players[i].lastFrame = config.InputDelay - 1
+		rs.players[i].inputs = make([]rollbackInput, rollbackRingSize)
+	}
+	for i := range rs.snapshots {
+		rs.snapshots[i].frame = -1
+	}
+
+	if session != nil {
+		session.setControlHandler(controlRollbackInput, rs.handleInput)
+		session.setControlHandler(controlRollbackChecksum, rs.handleChecksum)
+	}
+
+	return rs, nil
+}
+
+// Destroy detaches the rollback session from its NetworkSession
+func (rs *RollbackSession) Destroy() {
+	if rs.session != nil {
+		rs.session.setControlHandler(controlRollbackInput, nil)
+		rs.session.setControlHandler(controlRollbackChecksum, nil)
+	}
+}
+
+// AddRemotePlayer assigns a player index to the peer at the other end of conn
+func (rs *RollbackSession) AddRemotePlayer(player int, conn ConnectionHandle) error {
+	if rs.session == nil {
+		return errors.New("rollback session has no network session")
+	}
+	if player < 0 || player >= len(rs.players) || player == rs.config.LocalPlayer {
+		return errors.New("invalid remote player index")
+	}
+	if rs.players[player].remote {
+		return errors.New("player already assigned")
+	}
+
+	rs.players[player].remote = true
+	rs.players[player].conn = conn
+	rs.peers[conn] = player
+	return nil
+}
+
+// OnDesync sets the function called when a peer's state diverges from ours
+func (rs *RollbackSession) OnDesync(callback DesyncCallback) {
+	rs.onDesync = callback
+}
+
+// AddLocalInput records the local player's input for the current frame. The input takes
+// effect InputDelay frames later and is sent to every remote player.
+func (rs *RollbackSession) AddLocalInput(input []byte) error {
+	local := &rs.players[rs.config.LocalPlayer]
+	target := rs.frame + rs.config.InputDelay
+	if local.lastFrame >= target {
+		return errors.New("local input already added for this frame")
+	}
+
+	rs.storeInput(rs.config.LocalPlayer, target, input)
+
+	if rs.session != nil {
+		payload := make([]byte, 0, 9+len(input))
+		payload = binary.LittleEndian.AppendUint32(payload, uint32(target))
+		payload = binary.LittleEndian.AppendUint32(payload, uint32(rs.frame))
+		payload = append(payload, byte(rs.config.LocalPlayer))
+		payload = append(payload, input...)
+
+		for _, p := range rs.players {
+			if p.remote {
+				rs.session.sendControl(p.conn, controlRollbackInput, payload, true)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CanAdvance reports whether AdvanceFrame can run without exceeding MaxPrediction. When it
+// returns false the game should keep rendering and polling the network but not simulate.
+func (rs *RollbackSession) CanAdvance() bool {
+	return rs.frame-rs.confirmedFrame() <= rs.config.MaxPrediction
+}
+
+// AdvanceFrame rolls back and re-simulates if a misprediction was detected, then simulates
+// the current frame. If no local input was added this frame the previous one is repeated.
+func (rs *RollbackSession) AdvanceFrame() error {
+	local := &rs.players[rs.config.LocalPlayer]
+	if local.lastFrame < rs.frame+rs.config.InputDelay {
+		if err := rs.AddLocalInput(local.lastInput); err != nil {
+			return err
+		}
+	}
+
+	if !rs.CanAdvance() {
+		return errors.New("waiting for remote input")
+	}
+
+	if rs.rollbackFrom >= 0 {
+		if err := rs.rollback(); err != nil {
+			return err
+		}
+	}
+
+	if err := rs.saveSnapshot(rs.frame); err != nil {
+		return err
+	}
+	rs.advance(rs.frame, rs.gatherInputs(rs.frame))
+	rs.frame++
+
+	rs.updateChecksums()
+	return nil
+}
+
+// IsResimulating reports whether the advance function is re-simulating a rolled back frame
+func (rs *RollbackSession) IsResimulating() bool {
+	return rs.resimulating
+}
+
+// GetFrame returns the next frame to be simulated
+func (rs *RollbackSession) GetFrame() int {
+	return rs.frame
+}
+
+// GetConfirmedFrame returns the latest frame for which every player's input is known
+func (rs *RollbackSession) GetConfirmedFrame() int {
+	return rs.confirmedFrame()
+}
+
+// GetInputDelay returns the configured input delay in frames
+func (rs *RollbackSession) GetInputDelay() int {
+	return rs.config.InputDelay
+}
+
+// GetFrameAdvantage returns how many frames the local simulation is ahead of the furthest
+// behind remote player, accounting for network latency. Games usually wait a frame now
+// and then while it stays above 1 so that neither side rolls back disproportionately.
+func (rs *RollbackSession) GetFrameAdvantage() float64 {
+	latency := 0.0
+	if rs.session != nil {
+		if clock := rs.session.GetClockStats(); clock.Synchronized {
+			latency = clock.RTT / 2 * rs.config.FrameRate
+		}
+	}
+
+	advantage := 0.0
+	found := false
+	for _, p := range rs.players {
+		if !p.remote {
+			continue
+		}
+		a := float64(rs.frame) - (float64(p.remoteFrame) + latency)
+		if !found || a > advantage {
+			advantage = a
+			found = true
+		}
+	}
+
+	return advantage
+}
+
+// GetStats returns rollback statistics
+func (rs *RollbackSession) GetStats() RollbackStats {
+	stats := rs.stats
+	stats.Frame = rs.frame
+	stats.ConfirmedFrame = rs.confirmedFrame()
+	stats.FrameAdvantage = rs.GetFrameAdvantage()
+	return stats
+}
+
+func (rs *RollbackSession) confirmedFrame() int {
+	confirmed := rs.players[0].lastFrame
+	for _, p := range rs.players[1:] {
+		if p.lastFrame < confirmed {
+			confirmed = p.lastFrame
+		}
+	}
+	return confirmed
+}
+
+// storeInput records a player's confirmed input for a frame and schedules a rollback if it
+// differs from the input predicted for an already simulated frame
+func (rs *RollbackSession) storeInput(player, frame int, input []byte) {
+	p := &rs.players[player]
+	slot := &p.inputs[frame%rollbackRingSize]
+
+	if slot.frame == frame && !slot.confirmed && frame < rs.frame && !bytes.Equal(slot.input, input) {
+		if rs.rollbackFrom < 0 || frame < rs.rollbackFrom {
+			rs.rollbackFrom = frame
+		}
+	}
+
+	input = append([]byte(nil), input...)
+	*slot = rollbackInput{frame: frame, input: input, confirmed: true}
+	p.lastFrame = frame
+	p.lastInput = input
+}
+
+// inputFor returns a player's input for a frame, predicting it if it is not yet known
+func (rs *RollbackSession) inputFor(player, frame int) []byte {
+	if frame < rs.config.InputDelay {
+		return nil
+	}
+
+	p := &rs.players[player]
+	slot := &p.inputs[frame%rollbackRingSize]
+	if slot.frame == frame && slot.confirmed {
+		return slot.input
+	}
+
+	*slot = rollbackInput{frame: frame, input: p.lastInput}
+	return p.lastInput
+}
+
+func (rs *RollbackSession) gatherInputs(frame int) [][]byte {
+	inputs := make([][]byte, len(rs.players))
+	for i := range rs.players {
+		inputs[i] = rs.inputFor(i, frame)
+	}
+	return inputs
+}
+
+func (rs *RollbackSession) saveSnapshot(frame int) error {
+	slot := &rs.snapshots[frame%len(rs.snapshots)]
+	data, err := rs.world.SaveSnapshot(slot.data)
+	if err != nil {
+		return err
+	}
+
+	slot.frame = frame
+	slot.data = data
+	return nil
+}
+
+// rollback restores the world to the first mispredicted frame and re-simulates up to the
+// current frame with the corrected inputs
+func (rs *RollbackSession) rollback() error {
+	from := rs.rollbackFrom
+	rs.rollbackFrom = -1
+
+	snapshot := &rs.snapshots[from%len(rs.snapshots)]
+	if snapshot.frame != from {
+		return fmt.Errorf("no snapshot for frame %d", from)
+	}
+	if err := rs.world.LoadSnapshot(snapshot.data); err != nil {
+		return err
+	}
+
+	rs.resimulating = true
+	for frame := from; frame < rs.frame; frame++ {
+		if frame > from {
+			if err := rs.saveSnapshot(frame); err != nil {
+				rs.resimulating = false
+				return err
+			}
+		}
+		rs.advance(frame, rs.gatherInputs(frame))
+	}
+	rs.resimulating = false
+
+	count := rs.frame - from
+	rs.stats.Rollbacks++
+	rs.stats.RolledBackFrames += count
+	if count > rs.stats.MaxRollback {
+		rs.stats.MaxRollback = count
+	}
+
+	return nil
+}
+
+// updateChecksums checksums the snapshots of frames that can no longer be rolled back,
+// sends them to remote players and compares them with checksums already received
+func (rs *RollbackSession) updateChecksums() {
+	if rs.config.ChecksumInterval <= 0 {
+		return
+	}
+
+	confirmed := rs.confirmedFrame()
+	for rs.nextChecksum <= confirmed+1 && rs.nextChecksum < rs.frame {
+		frame := rs.nextChecksum
+		rs.nextChecksum += rs.config.ChecksumInterval
+
+		snapshot := rs.snapshots[frame%len(rs.snapshots)]
+		if snapshot.frame != frame {
+			continue
+		}
+
+		checksum := crc32.ChecksumIEEE(snapshot.data)
+		rs.localChecksums[frame] = checksum
+
+		if rs.session != nil {
+			payload := binary.LittleEndian.AppendUint32(nil, uint32(frame))
+			payload = binary.LittleEndian.AppendUint32(payload, checksum)
+			for _, p := range rs.players {
+				if p.remote {
+					rs.session.sendControl(p.conn, controlRollbackChecksum, payload, true)
+				}
+			}
+		}
+
+		for _, remote := range rs.remoteChecksums[frame] {
+			rs.compareChecksum(frame, remote.player, checksum, remote.checksum)
+		}
+		delete(rs.remoteChecksums, frame)
+	}
+
+	// Peers never lag far behind the confirmed frame, so old checksums can be dropped
+	horizon := rs.frame - 4*rollbackRingSize
+	for frame := range rs.localChecksums {
+		if frame < horizon {
+			delete(rs.localChecksums, frame)
+		}
+	}
+	for frame := range rs.remoteChecksums {
+		if frame < horizon {
+			delete(rs.remoteChecksums, frame)
+		}
+	}
+}
+
+func (rs *RollbackSession) compareChecksum(frame, player int, local, remote uint32) {
+	if local == remote {
+		return
+	}
+
+	rs.stats.Desyncs++
+	LogError(fmt.Sprintf("Rollback: desync with player %d at frame %d (local %08x, remote %08x)",
+		player, frame, local, remote))
+	if rs.onDesync != nil {
+		runCallback("OnDesync", func() { rs.onDesync(frame, player, local, remote) })
+	}
+}
+
+func (rs *RollbackSession) handleInput(conn ConnectionHandle, payload []byte, timestamp float64) {
+	player, ok := rs.peers[conn]
+	if !ok || len(payload) < 9 {
+		return
+	}
+
+	frame := int(binary.LittleEndian.Uint32(payload))
+	senderFrame := int(binary.LittleEndian.Uint32(payload[4:]))
+	if int(payload[8]) != player {
+		return
+	}
+
+	p := &rs.players[player]
+	if senderFrame > p.remoteFrame {
+		p.remoteFrame = senderFrame
+	}
+
+	// Input arrives reliably and in order; anything else is a duplicate or too far ahead
+	if frame != p.lastFrame+1 || frame >= rs.frame+rollbackRingSize/2 {
+		return
+	}
+
+	rs.storeInput(player, frame, payload[9:])
+}
+
+func (rs *RollbackSession) handleChecksum(conn ConnectionHandle, payload []byte, timestamp float64) {
+	player, ok := rs.peers[conn]
+	if !ok || len(payload) < 8 {
+		return
+	}
+
+	frame := int(binary.LittleEndian.Uint32(payload))
+	remote := binary.LittleEndian.Uint32(payload[4:])
+
+	if local, ok := rs.localChecksums[frame]; ok {
+		rs.compareChecksum(frame, player, local, remote)
+		return
+	}
+	rs.remoteChecksums[frame] = append(rs.remoteChecksums[frame], remoteChecksum{player: player, checksum: remote})
+}
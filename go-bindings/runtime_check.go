@@ -0,0 +1,106 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"runtime"
+	"strings"
+)
+
+// RuntimeProblem is a native dependency CheckRuntime found missing
+type RuntimeProblem int
+
+const (
+	RuntimeNoVulkanLoader RuntimeProblem = 1
+	RuntimeNoVulkanGPU    RuntimeProblem = 2
+	RuntimeNoMeshShaders  RuntimeProblem = 4
+	RuntimeNoVideo        RuntimeProblem = 8
+)
+
+// String returns a short description of the problem
+func (p RuntimeProblem) String() string {
+	switch p {
+	case RuntimeNoVulkanLoader:
+		return "Vulkan loader not found"
+	case RuntimeNoVulkanGPU:
+		return "no GPU with a Vulkan driver"
+	case RuntimeNoMeshShaders:
+		return "no GPU supports mesh shaders"
+	case RuntimeNoVideo:
+		return "no video driver"
+	default:
+		return "unknown problem"
+	}
+}
+
+// Fix returns what to install or change on this OS to solve the problem
+func (p RuntimeProblem) Fix() string {
+	switch p {
+	case RuntimeNoVulkanLoader:
+		switch runtime.GOOS {
+		case "darwin":
+			return "install MoltenVK and the Vulkan loader (brew install molten-vk vulkan-loader, or the LunarG Vulkan SDK); " +
+				"with Homebrew on Apple silicon also set DYLD_FALLBACK_LIBRARY_PATH=/opt/homebrew/lib"
+		case "windows":
+			return "install or update the GPU driver, which provides vulkan-1.dll"
+		default:
+			return "install the Vulkan loader and your GPU's Vulkan driver (e.g. libvulkan1 and mesa-vulkan-drivers on Debian and Ubuntu)"
+		}
+	case RuntimeNoVulkanGPU:
+		if runtime.GOOS == "darwin" {
+			return "the Vulkan loader did not find MoltenVK; point VK_DRIVER_FILES at MoltenVK_icd.json"
+		}
+		return "install or update the GPU driver; check that vulkaninfo lists the GPU"
+	case RuntimeNoMeshShaders:
+		if runtime.GOOS == "darwin" {
+			return "the renderer needs VK_EXT_mesh_shader, which this MoltenVK does not provide; update MoltenVK"
+		}
+		return "the renderer needs VK_EXT_mesh_shader (NVIDIA Turing, AMD RDNA2, Intel Arc or newer); update the GPU driver"
+	case RuntimeNoVideo:
+		if runtime.GOOS == "linux" {
+			return "no X11 or Wayland display; set DISPLAY or WAYLAND_DISPLAY, or run without creating a window"
+		}
+		return "run from a desktop session, or without creating a window"
+	default:
+		return ""
+	}
+}
+
+// CheckRuntime looks for the native dependencies the engine loads at runtime: the Vulkan
+// loader (MoltenVK on macOS), a GPU with mesh shader support and a video driver. It can be
+// called before Init and returns nil or an error listing each missing one with how to fix
+// it. The engine library itself is linked at startup, so a program that runs has it.
+func CheckRuntime() error {
+	problems, err := RuntimeProblems()
+	if err != nil || len(problems) == 0 {
+		return err
+	}
+
+	lines := make([]string, len(problems))
+	for i, p := range problems {
+		lines[i] = p.String() + ": " + p.Fix()
+	}
+	return errors.New("missing native dependencies:\n" + strings.Join(lines, "\n"))
+}
+
+// RuntimeProblems returns the problems CheckRuntime describes
+func RuntimeProblems() ([]RuntimeProblem, error) {
+	mask := int(C.boulder_check_runtime())
+	if mask < 0 {
+		if err := LastNativeError(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("runtime check failed")
+	}
+
+	var problems []RuntimeProblem
+	for _, p := range []RuntimeProblem{RuntimeNoVulkanLoader, RuntimeNoVulkanGPU, RuntimeNoMeshShaders, RuntimeNoVideo} {
+		if mask&int(p) != 0 {
+			problems = append(problems, p)
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,163 @@
+package boulder
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+// Protected file layout: a header, the payload (an IV and the AES-256-CTR encrypted data
+// when encrypted), then an HMAC-SHA256 of everything before it
+const (
+	protectedFormatVersion = 1
+	protectedHeaderSize    = 12 // Magic, format version, flags
+
+	protectFlagSigned    = 1
+	protectFlagEncrypted = 2
+)
+
+var protectedMagic = []byte("BSEC")
+
+// ErrSaveTampered is returned for a save or protected file whose signature doesn't match:
+// it was edited, signed with another user's key, or had its signature stripped
+var ErrSaveTampered = errors.New("save file tampered with")
+
+// SaveKey encrypts and signs save and settings files. It is derived from a secret built
+// into the game and a salt per user, so a file edited by hand, or copied from another
+// user's profile, fails to verify. The secret ships with the game, so this stops casual
+// editing, not someone who pulls it out of the binary.
+type SaveKey struct {
+	encryption [32]byte
+	signing    [32]byte
+}
+
+// NewSaveKey derives a key from the game's secret and a user's salt, e.g. their Steam ID
+// (see SteamSaveSalt) or their account ID
+func NewSaveKey(titleSecret, userSalt []byte) (*SaveKey, error) {
+	if len(titleSecret) < 16 {
+		return nil, errors.New("title secret must be at least 16 bytes")
+	}
+
+	prk := hmacSHA256(userSalt, titleSecret)
+	var key SaveKey
+	copy(key.encryption[:], hmacSHA256(prk, []byte("boulder save encryption\x01")))
+	copy(key.signing[:], hmacSHA256(prk, []byte("boulder save signing\x01")))
+	return &key, nil
+}
+
+// SteamSaveSalt returns the salt for a Steam user, for NewSaveKey
+func SteamSaveSalt(steamID SteamID) []byte {
+	return binary.LittleEndian.AppendUint64([]byte("steam:"), uint64(steamID))
+}
+
+// Seal signs data, encrypting it first if encrypt is set, for Open to verify. Use it for
+// files outside SaveGames, such as settings.
+func (k *SaveKey) Seal(data []byte, encrypt bool) ([]byte, error) {
+	flags := uint32(protectFlagSigned)
+	payload := data
+	if encrypt {
+		flags |= protectFlagEncrypted
+		var err error
+		if payload, err = k.encrypt(data); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(protectedMagic)
+	binary.Write(&buf, binary.LittleEndian, uint32(protectedFormatVersion))
+	binary.Write(&buf, binary.LittleEndian, flags)
+	buf.Write(payload)
+	buf.Write(k.sign(buf.Bytes()))
+	return buf.Bytes(), nil
+}
+
+// Open verifies data sealed with Seal and returns it decrypted, or ErrSaveTampered
+func (k *SaveKey) Open(sealed []byte) ([]byte, error) {
+	if len(sealed) < protectedHeaderSize+sha256.Size || !bytes.Equal(sealed[:4], protectedMagic) {
+		return nil, errSaveCorrupted
+	}
+	if binary.LittleEndian.Uint32(sealed[4:]) != protectedFormatVersion {
+		return nil, errors.New("unsupported protected file version")
+	}
+
+	body := sealed[:len(sealed)-sha256.Size]
+	if !k.verify(body, sealed[len(body):]) {
+		return nil, ErrSaveTampered
+	}
+
+	payload := body[protectedHeaderSize:]
+	if binary.LittleEndian.Uint32(sealed[8:])&protectFlagEncrypted == 0 {
+		return bytes.Clone(payload), nil
+	}
+	return k.decrypt(payload)
+}
+
+// WriteFile seals data and writes it to path, replacing the file in one step
+func (k *SaveKey) WriteFile(path string, data []byte, encrypt bool) error {
+	sealed, err := k.Seal(data, encrypt)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, sealed)
+}
+
+// ReadFile reads and opens a file written with WriteFile
+func (k *SaveKey) ReadFile(path string) ([]byte, error) {
+	sealed, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return k.Open(sealed)
+}
+
+// sign returns the signature of data
+func (k *SaveKey) sign(data []byte) []byte {
+	return hmacSHA256(k.signing[:], data)
+}
+
+// verify checks a signature in constant time
+func (k *SaveKey) verify(data, signature []byte) bool {
+	return hmac.Equal(k.sign(data), signature)
+}
+
+// encrypt returns a random IV followed by data encrypted with AES-256-CTR. It is only
+// safe under a signature, which is what detects changes to the ciphertext.
+func (k *SaveKey) encrypt(data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(k.encryption[:])
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, aes.BlockSize+len(data))
+	if _, err := rand.Read(out[:aes.BlockSize]); err != nil {
+		return nil, err
+	}
+	cipher.NewCTR(block, out[:aes.BlockSize]).XORKeyStream(out[aes.BlockSize:], data)
+	return out, nil
+}
+
+// decrypt reverses encrypt
+func (k *SaveKey) decrypt(data []byte) ([]byte, error) {
+	if len(data) < aes.BlockSize {
+		return nil, errSaveCorrupted
+	}
+	block, err := aes.NewCipher(k.encryption[:])
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCTR(block, data[:aes.BlockSize]).XORKeyStream(out, data[aes.BlockSize:])
+	return out, nil
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,445 @@
+package boulder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Save file layout: a header, the metadata as JSON, the gzip compressed game data, then a
+// SHA-256 of everything before it, or an HMAC-SHA256 when signed with a SaveKey. Encrypted
+// saves hold an IV and the encrypted game data instead. Saving moves the previous save of a
+// slot to a backup, which Load falls back to when the slot is corrupted.
+const (
+	saveFormatVersion = 2
+	saveHeaderSize    = 16 // Magic, format version, flags, metadata length
+	saveV1HeaderSize  = 12 // Version 1 had no flags
+	saveExtension     = ".sav"
+	saveBackupSuffix  = ".bak"
+
+	// DefaultThumbnailWidth is the width save thumbnails are scaled down to
+	DefaultThumbnailWidth = 256
+)
+
+var saveMagic = []byte("BSAV")
+
+var errSaveCorrupted = errors.New("save file corrupted")
+
+// SaveMetadata describes a save without loading its game data
+type SaveMetadata struct {
+	Slot       string        `json:"-"`
+	Name       string        `json:"name"`
+	Version    int           `json:"version"` // Schema version of the game data
+	Playtime   time.Duration `json:"playtime"`
+	Timestamp  time.Time     `json:"timestamp"`
+	Thumbnail  []byte        `json:"thumbnail,omitempty"` // PNG
+	FromBackup bool          `json:"-"`                   // Loaded from the backup because the slot was corrupted
+}
+
+// GetThumbnail decodes the save's thumbnail
+func (m *SaveMetadata) GetThumbnail() (image.Image, error) {
+	if len(m.Thumbnail) == 0 {
+		return nil, errors.New("save has no thumbnail")
+	}
+	return png.Decode(bytes.NewReader(m.Thumbnail))
+}
+
+// SaveProtection signs saves so edited ones are rejected with ErrSaveTampered
+type SaveProtection struct {
+	Key     *SaveKey
+	Encrypt bool // Encrypt the game data too; the metadata is only signed, so List still shows it
+	// AcceptUnsigned loads saves written before protection was turned on; they are signed
+	// the next time their slot is saved. Without it an unsigned save counts as tampered.
+	AcceptUnsigned bool
+}
+
+// MigrationFunc upgrades game data by one schema version
+type MigrationFunc func(data []byte) ([]byte, error)
+
+// SaveGames stores game data in named slots inside a directory. The game data format is up
+// to the game; its schema version is recorded so older saves can be migrated on load.
+type SaveGames struct {
+	dir            string
+	version        int
+	migrations     map[int]MigrationFunc
+	compression    int
+	thumbnailWidth int
+	playtime       time.Duration
+	protection     SaveProtection
+}
+
+// NewSaveGames creates a save system writing to dir, with version as the current schema
+// version of the game data
+func NewSaveGames(dir string, version int) *SaveGames {
+	return &SaveGames{
+		dir:            dir,
+		version:        version,
+		migrations:     make(map[int]MigrationFunc),
+		compression:    gzip.DefaultCompression,
+		thumbnailWidth: DefaultThumbnailWidth,
+	}
+}
+
+// RegisterMigration sets the function upgrading game data from schema version from to
+// from+1. Loading runs migrations in order until the data reaches the current version.
+func (sg *SaveGames) RegisterMigration(from int, migrate MigrationFunc) {
+	sg.migrations[from] = migrate
+}
+
+// SetCompressionLevel sets the gzip level used for game data (gzip.BestSpeed to
+// gzip.BestCompression)
+func (sg *SaveGames) SetCompressionLevel(level int) error {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return errors.New("invalid compression level")
+	}
+	sg.compression = level
+	return nil
+}
+
+// SetProtection signs (and optionally encrypts) saves written from now on and makes
+// loading reject saves that don't verify. A zero SaveProtection turns it off.
+func (sg *SaveGames) SetProtection(protection SaveProtection) {
+	sg.protection = protection
+}
+
+// SetThumbnailWidth sets the width thumbnails are scaled down to
+func (sg *SaveGames) SetThumbnailWidth(width int) {
+	sg.thumbnailWidth = max(1, width)
+}
+
+// Update adds to the playtime recorded in saves (call every frame with the engine delta
+// time while the game is being played)
+func (sg *SaveGames) Update(deltaTime float32) {
+	sg.playtime += time.Duration(float64(deltaTime) * float64(time.Second))
+}
+
+// GetPlaytime returns the playtime so far, including the playtime of the loaded save
+func (sg *SaveGames) GetPlaytime() time.Duration {
+	return sg.playtime
+}
+
+// SetPlaytime sets the playtime, e.g. to zero when starting a new game
+func (sg *SaveGames) SetPlaytime(playtime time.Duration) {
+	sg.playtime = playtime
+}
+
+// Save writes game data to a slot. thumbnail may be nil; use Renderer.RequestScreenshot
+// and GetScreenshot to capture one. The slot's previous save becomes its backup.
+func (sg *SaveGames) Save(slot, name string, data []byte, thumbnail image.Image) error {
+	path, err := sg.slotPath(slot)
+	if err != nil {
+		return err
+	}
+
+	meta := SaveMetadata{
+		Name:      name,
+		Version:   sg.version,
+		Playtime:  sg.playtime,
+		Timestamp: time.Now().UTC(),
+	}
+	if thumbnail != nil {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, scaleImage(thumbnail, sg.thumbnailWidth)); err != nil {
+			return err
+		}
+		meta.Thumbnail = buf.Bytes()
+	}
+
+	file, err := encodeSave(meta, data, sg.compression, sg.protection)
+	if err != nil {
+		return err
+	}
+
+	// Only a save that verifies may replace the backup, so one bad write can't lose both
+	if current, err := os.ReadFile(path); err == nil {
+		if _, _, err := decodeSave(current, false, sg.protection); err == nil {
+			if err := os.Rename(path, path+saveBackupSuffix); err != nil {
+				return err
+			}
+		}
+	}
+
+	return writeFileAtomic(path, file)
+}
+
+// Load reads and migrates the game data in a slot, falling back to the slot's backup when
+// the save is corrupted. The playtime continues from the save's.
+func (sg *SaveGames) Load(slot string) ([]byte, SaveMetadata, error) {
+	data, meta, err := sg.read(slot, true)
+	if err != nil {
+		return nil, SaveMetadata{}, err
+	}
+
+	if meta.Version > sg.version {
+		return nil, SaveMetadata{}, errors.New("save is from a newer version: " + strconv.Itoa(meta.Version))
+	}
+	for meta.Version < sg.version {
+		migrate, ok := sg.migrations[meta.Version]
+		if !ok {
+			return nil, SaveMetadata{}, errors.New("no save migration from version " + strconv.Itoa(meta.Version))
+		}
+		if data, err = migrate(data); err != nil {
+			return nil, SaveMetadata{}, err
+		}
+		meta.Version++
+	}
+
+	sg.playtime = meta.Playtime
+	return data, meta, nil
+}
+
+// GetMetadata returns a slot's metadata without migrating its game data
+func (sg *SaveGames) GetMetadata(slot string) (SaveMetadata, error) {
+	_, meta, err := sg.read(slot, false)
+	return meta, err
+}
+
+// Exists returns true if a slot or its backup is on disk
+func (sg *SaveGames) Exists(slot string) bool {
+	path, err := sg.slotPath(slot)
+	if err != nil {
+		return false
+	}
+	for _, p := range []string{path, path + saveBackupSuffix} {
+		if _, err := os.Stat(p); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the metadata of every readable slot, newest first
+func (sg *SaveGames) List() ([]SaveMetadata, error) {
+	entries, err := os.ReadDir(sg.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	slots := make(map[string]bool)
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), saveBackupSuffix)
+		if !entry.IsDir() && strings.HasSuffix(name, saveExtension) {
+			slots[strings.TrimSuffix(name, saveExtension)] = true
+		}
+	}
+
+	var saves []SaveMetadata
+	for slot := range slots {
+		if meta, err := sg.GetMetadata(slot); err == nil {
+			saves = append(saves, meta)
+		}
+	}
+	sort.Slice(saves, func(i, j int) bool { return saves[i].Timestamp.After(saves[j].Timestamp) })
+	return saves, nil
+}
+
+// Delete removes a slot and its backup
+func (sg *SaveGames) Delete(slot string) error {
+	path, err := sg.slotPath(slot)
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{path, path + saveBackupSuffix} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sg *SaveGames) slotPath(slot string) (string, error) {
+	if slot == "" || strings.ContainsAny(slot, `/\:`) || slot == "." || slot == ".." {
+		return "", errors.New("invalid save slot: " + slot)
+	}
+	return filepath.Join(sg.dir, slot+saveExtension), nil
+}
+
+// read decodes a slot, trying its backup if the slot is missing or corrupted
+func (sg *SaveGames) read(slot string, withData bool) ([]byte, SaveMetadata, error) {
+	path, err := sg.slotPath(slot)
+	if err != nil {
+		return nil, SaveMetadata{}, err
+	}
+
+	var firstErr error
+	for i, p := range []string{path, path + saveBackupSuffix} {
+		file, err := os.ReadFile(p)
+		if err == nil {
+			var data []byte
+			var meta SaveMetadata
+			if data, meta, err = decodeSave(file, withData, sg.protection); err == nil {
+				meta.Slot = slot
+				meta.FromBackup = i > 0
+				return data, meta, nil
+			}
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, SaveMetadata{}, firstErr
+}
+
+func encodeSave(meta SaveMetadata, data []byte, level int, protection SaveProtection) ([]byte, error) {
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	var compressed bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&compressed, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	var flags uint32
+	payload := compressed.Bytes()
+	if key := protection.Key; key != nil {
+		flags |= protectFlagSigned
+		if protection.Encrypt {
+			flags |= protectFlagEncrypted
+			if payload, err = key.encrypt(payload); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(saveMagic)
+	binary.Write(&buf, binary.LittleEndian, uint32(saveFormatVersion))
+	binary.Write(&buf, binary.LittleEndian, flags)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(metaJSON)))
+	buf.Write(metaJSON)
+	buf.Write(payload)
+
+	if flags&protectFlagSigned != 0 {
+		buf.Write(protection.Key.sign(buf.Bytes()))
+	} else {
+		sum := sha256.Sum256(buf.Bytes())
+		buf.Write(sum[:])
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeSave verifies a save file and returns its metadata, and its game data if withData
+func decodeSave(file []byte, withData bool, protection SaveProtection) ([]byte, SaveMetadata, error) {
+	var meta SaveMetadata
+	if len(file) < saveV1HeaderSize+sha256.Size || !bytes.Equal(file[:4], saveMagic) {
+		return nil, meta, errSaveCorrupted
+	}
+
+	var flags uint32
+	headerSize := saveHeaderSize
+	switch binary.LittleEndian.Uint32(file[4:]) {
+	case 1:
+		headerSize = saveV1HeaderSize
+	case saveFormatVersion:
+		if len(file) < saveHeaderSize+sha256.Size {
+			return nil, meta, errSaveCorrupted
+		}
+		flags = binary.LittleEndian.Uint32(file[8:])
+	default:
+		return nil, meta, errors.New("unsupported save format version")
+	}
+
+	body := file[:len(file)-sha256.Size]
+	if flags&protectFlagSigned != 0 {
+		if protection.Key == nil {
+			return nil, meta, errors.New("save is signed but no save key is set")
+		}
+		if !protection.Key.verify(body, file[len(body):]) {
+			return nil, meta, ErrSaveTampered
+		}
+	} else {
+		if sum := sha256.Sum256(body); !bytes.Equal(sum[:], file[len(body):]) {
+			return nil, meta, errSaveCorrupted
+		}
+		if flags&protectFlagEncrypted != 0 {
+			return nil, meta, errSaveCorrupted
+		}
+		if protection.Key != nil && !protection.AcceptUnsigned {
+			return nil, meta, ErrSaveTampered
+		}
+	}
+
+	metaEnd := headerSize + int(binary.LittleEndian.Uint32(file[headerSize-4:]))
+	if metaEnd > len(body) {
+		return nil, meta, errSaveCorrupted
+	}
+	if err := json.Unmarshal(body[headerSize:metaEnd], &meta); err != nil {
+		return nil, meta, errSaveCorrupted
+	}
+	if !withData {
+		return nil, meta, nil
+	}
+
+	payload := body[metaEnd:]
+	if flags&protectFlagEncrypted != 0 {
+		var err error
+		if payload, err = protection.Key.decrypt(payload); err != nil {
+			return nil, meta, err
+		}
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, meta, errSaveCorrupted
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, meta, errSaveCorrupted
+	}
+	return data, meta, nil
+}
+
+// scaleImage shrinks an image to width (keeping its aspect ratio) by averaging pixels
+func scaleImage(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	if bounds.Dx() <= width {
+		return src
+	}
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := bounds.Min.Y+y*bounds.Dy()/height, bounds.Min.Y+(y+1)*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			x0, x1 := bounds.Min.X+x*bounds.Dx()/width, bounds.Min.X+(x+1)*bounds.Dx()/width
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+cr, g+cg, b+cb, a+ca, n+1
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(b / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,725 @@
+package boulder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Scene files are JSON listing the entities to create:
+//
+//	{"entities": [
+//		{"name": "ground", "position": [0, -1, 0], "scale": [20, 1, 20], "model": "ground.glb",
+//			"collider": {"shape": "mesh", "friction": 0.8}},
+//		{"name": "crate", "position": [0, 4, 0], "rotation": [0, 0.5, 0], "model": "crate.glb", "mass": 1,
+//			"collider": {"shape": "box", "size": [1, 1, 1], "friction": 0.5}, "tags": ["pickup"]},
+//		{"name": "lamp", "position": [2, 3, 0], "light": {"type": "point", "color": [1, 0.9, 0.7], "intensity": 4, "range": 10}}
+//	]}
+//
+// Rotations are in radians and model paths are relative to the scene file. Entities with a
+// mass get a physics body. Collider shapes are box (size), sphere (radius), capsule (radius
+// and height) and mesh; light types are directional, point and spot (innerAngle and
+// outerAngle in degrees).
+//
+// A "prefabs" object maps names to entity templates written the same way, and an entity
+// with "prefab" starts from one, overriding whichever fields it sets itself (see Prefab).
+type sceneFile struct {
+	Prefabs  map[string]sceneFileEntity `json:"prefabs,omitempty"`
+	Entities []sceneFileEntity          `json:"entities"`
+}
+
+type sceneFileEntity struct {
+	Name     string         `json:"name,omitempty"`
+	Prefab   string         `json:"prefab,omitempty"`
+	Position [3]float32     `json:"position"`
+	Rotation [3]float32     `json:"rotation"`
+	Scale    *[3]float32    `json:"scale,omitempty"`
+	Model    string         `json:"model,omitempty"`
+	Mass     float32        `json:"mass,omitempty"`
+	Velocity *[3]float32    `json:"velocity,omitempty"`
+	Collider *sceneCollider `json:"collider,omitempty"`
+	Light    *sceneLight    `json:"light,omitempty"`
+	Layers   uint32         `json:"layers,omitempty"` // 0 leaves LayerDefault
+	Tags     []string       `json:"tags,omitempty"`
+}
+
+type sceneCollider struct {
+	Shape       string      `json:"shape"`
+	Size        *[3]float32 `json:"size,omitempty"`
+	Radius      float32     `json:"radius,omitempty"`
+	Height      float32     `json:"height,omitempty"`
+	Friction    float32     `json:"friction"`
+	Restitution float32     `json:"restitution"`
+	Trigger     bool        `json:"trigger,omitempty"`
+}
+
+type sceneLight struct {
+	Type       string     `json:"type"`
+	Color      [3]float32 `json:"color"`
+	Intensity  float32    `json:"intensity"`
+	Range      float32    `json:"range,omitempty"`
+	InnerAngle float32    `json:"innerAngle,omitempty"`
+	OuterAngle float32    `json:"outerAngle,omitempty"`
+}
+
+var (
+	sceneColliderShapes = []string{ColliderBox: "box", ColliderSphere: "sphere", ColliderCapsule: "capsule", ColliderMesh: "mesh"}
+	sceneLightTypes     = []string{LightDirectional: "directional", LightPoint: "point", LightSpot: "spot"}
+)
+
+// Scene is a set of entities loaded from a scene file
+type Scene struct {
+	Path string
+
+	entities []EntityID
+	names    map[string]EntityID
+}
+
+// GetEntities returns the scene's entities in the order the file lists them
+func (s *Scene) GetEntities() []EntityID {
+	return s.entities
+}
+
+// FindEntity returns the entity with a name in the scene file
+func (s *Scene) FindEntity(name string) (EntityID, bool) {
+	id, ok := s.names[name]
+	return id, ok
+}
+
+// LoadScreenConfig sets up the loading screen shown by LoadSceneAsync
+type LoadScreenConfig struct {
+	Window          *Window       // Screen the loading UI covers; nil shows no loading UI
+	Background      UIColor       // Covers the screen while loading
+	BarColor        UIColor       // Progress bar fill
+	BarWidth        float32       // Fraction of the screen width
+	BarHeight       float32       // Pixels
+	MinDuration     time.Duration // Keeps the screen up so quick loads don't flash
+	StreamingBudget time.Duration // Upload time per frame; the loading screen keeps animating
+	Priority        AssetPriority
+	OnProgress      func(progress float32) // Called each frame with progress from 0 to 1
+}
+
+// DefaultLoadScreenConfig returns a black loading screen with a green bar along the bottom
+func DefaultLoadScreenConfig(window *Window) LoadScreenConfig {
+	return LoadScreenConfig{
+		Window:          window,
+		Background:      UIColor{0.0, 0.0, 0.0, 1.0},
+		BarColor:        UIColor{0.2, 0.8, 0.3, 1.0},
+		BarWidth:        0.6,
+		BarHeight:       12,
+		MinDuration:     500 * time.Millisecond,
+		StreamingBudget: 8 * time.Millisecond,
+		Priority:        AssetPriorityHigh,
+	}
+}
+
+type sceneParseResult struct {
+	file *sceneFile
+	err  error
+}
+
+// SceneLoad is a scene being loaded by LoadSceneAsync
+type SceneLoad struct {
+	engine *Engine
+	world  *World
+	scene  *Scene
+	config LoadScreenConfig
+
+	parsed   chan sceneParseResult
+	assets   *Assets
+	requests []*AssetRequest
+	descs    map[EntityID]sceneFileEntity // Components added once everything has loaded
+	loaded   map[EntityID]bool            // Entities whose model finished loading
+	elapsed  time.Duration
+	progress float32
+	done     bool
+	err      error
+
+	background *UIProgressBar
+	bar        *UIProgressBar
+}
+
+// OnSceneLoaded registers a callback run by Engine.Update when LoadSceneAsync finishes. On
+// success scene is the new current scene; on failure err says why and the previous scene
+// is still in place.
+func (e *Engine) OnSceneLoaded(callback func(scene *Scene, err error)) {
+	e.sceneCallbacks = append(e.sceneCallbacks, callback)
+}
+
+// GetScene returns the scene loaded last by LoadSceneAsync, or nil
+func (e *Engine) GetScene() *Scene {
+	return e.scene
+}
+
+// GetSceneLoad returns the scene load in progress, or nil
+func (e *Engine) GetSceneLoad() *SceneLoad {
+	return e.sceneLoad
+}
+
+// LoadSceneAsync loads a scene behind a loading screen without stalling the frame. The file
+// is parsed and its models read on worker goroutines and uploaded within the streaming
+// budget while Engine.Update advances the load. The new entities stay hidden and without
+// physics, colliders or lights until everything has loaded; then, within a single Update,
+// the previous scene's entities are destroyed (except persistent ones, see
+// Entity.SetPersistent), the new ones are shown, and OnSceneLoaded callbacks run.
+func (e *Engine) LoadSceneAsync(path string, config LoadScreenConfig) (*SceneLoad, error) {
+	if !e.initialized {
+		return nil, errNotInitialized
+	}
+	if e.sceneLoad != nil {
+		return nil, errors.New("a scene is already loading")
+	}
+
+	l := &SceneLoad{
+		engine: e,
+		world:  e.GetActiveWorld(),
+		scene:  &Scene{Path: path, names: make(map[string]EntityID)},
+		config: config,
+		parsed: make(chan sceneParseResult, 1),
+		descs:  make(map[EntityID]sceneFileEntity),
+		loaded: make(map[EntityID]bool),
+	}
+	l.showLoadScreen()
+
+	go func() {
+		file, err := parseSceneFile(path)
+		l.parsed <- sceneParseResult{file: file, err: err}
+	}()
+
+	e.sceneLoad = l
+	return l, nil
+}
+
+// GetPath returns the scene file being loaded
+func (l *SceneLoad) GetPath() string {
+	return l.scene.Path
+}
+
+// GetProgress returns how far the load is, from 0 to 1
+func (l *SceneLoad) GetProgress() float32 {
+	return l.progress
+}
+
+// IsDone returns whether the load has finished, failed or been cancelled
+func (l *SceneLoad) IsDone() bool {
+	return l.done
+}
+
+// GetError returns why the load failed
+func (l *SceneLoad) GetError() error {
+	return l.err
+}
+
+// Cancel stops the load and destroys what it created, keeping the previous scene
+func (l *SceneLoad) Cancel() {
+	if !l.done {
+		l.fail(errors.New("scene load cancelled"))
+	}
+}
+
+// updateSceneLoad advances the scene load in progress (called by Update)
+func (e *Engine) updateSceneLoad(deltaTime float32) {
+	if l := e.sceneLoad; l != nil {
+		l.update(deltaTime)
+	}
+}
+
+func (l *SceneLoad) update(deltaTime float32) {
+	l.elapsed += time.Duration(float64(deltaTime) * float64(time.Second))
+
+	if l.assets == nil {
+		select {
+		case result := <-l.parsed:
+			if result.err != nil {
+				l.fail(result.err)
+				return
+			}
+			if err := l.spawn(result.file); err != nil {
+				l.fail(err)
+				return
+			}
+		default:
+			l.setProgress(0)
+			return
+		}
+	}
+
+	l.assets.Update()
+	if l.done {
+		// A model failed to load
+		return
+	}
+
+	// Parsing counts as the first step
+	total := len(l.requests) + 1
+	finished := 1 + len(l.requests) - l.assets.Pending()
+	l.setProgress(float32(finished) / float32(total))
+
+	if l.assets.Pending() == 0 && l.elapsed >= l.config.MinDuration {
+		l.swap()
+	}
+}
+
+// spawn creates the scene's entities, hidden, and queues their models
+func (l *SceneLoad) spawn(file *sceneFile) error {
+	l.assets = NewAssets(l.world)
+	l.assets.SetStreamingBudget(l.config.StreamingBudget)
+
+	descs, err := l.world.expandScene(file)
+	if err != nil {
+		return err
+	}
+	for _, desc := range descs {
+		entity, err := l.scene.spawnEntity(l.world, desc)
+		if err != nil {
+			return err
+		}
+		l.descs[entity.ID] = desc
+
+		if desc.Model != "" {
+			request := l.assets.LoadModel(entity.ID, desc.Model, l.config.Priority, l.modelLoaded)
+			l.requests = append(l.requests, request)
+		}
+	}
+	return nil
+}
+
+// spawnEntity creates a scene entity with its transform and adds it to the scene
+func (s *Scene) spawnEntity(world *World, desc sceneFileEntity) (*Entity, error) {
+	entity, err := world.NewEntity()
+	if err != nil {
+		return nil, err
+	}
+	s.entities = append(s.entities, entity.ID)
+	if desc.Name != "" {
+		s.names[desc.Name] = entity.ID
+	}
+	if err := setSceneTransform(entity, desc); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// setSceneTransform gives a new entity the transform of a scene file entity, and records
+// the prefab it came from
+func setSceneTransform(entity *Entity, desc sceneFileEntity) error {
+	if desc.Prefab != "" {
+		entity.world.prefabState().instances[entity.ID] = desc.Prefab
+	}
+
+	scale := Vector3{X: 1, Y: 1, Z: 1}
+	if desc.Scale != nil {
+		scale = vector3From(*desc.Scale)
+	}
+	if err := entity.AddTransform(vector3From(desc.Position)); err != nil {
+		return err
+	}
+	return entity.SetFullTransform(vector3From(desc.Position), vector3From(desc.Rotation), scale)
+}
+
+// addSceneComponents gives a scene entity the components besides its transform and model
+func addSceneComponents(entity *Entity, desc sceneFileEntity) error {
+	if desc.Mass > 0 {
+		if err := entity.AddPhysicsBody(desc.Mass); err != nil {
+			return err
+		}
+		if desc.Velocity != nil {
+			if err := entity.SetVelocity(vector3From(*desc.Velocity)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if c := desc.Collider; c != nil {
+		shape := slices.Index(sceneColliderShapes, c.Shape)
+		if shape < 0 {
+			return errors.New("unknown collider shape: " + c.Shape)
+		}
+		collider := Collider{Shape: ColliderShape(shape), Radius: c.Radius, Height: c.Height, Friction: c.Friction, Restitution: c.Restitution, Trigger: c.Trigger}
+		if c.Size != nil {
+			collider.Size = vector3From(*c.Size)
+		}
+		if err := entity.AddCollider(collider); err != nil {
+			return err
+		}
+	}
+
+	if l := desc.Light; l != nil {
+		color := UIColor{l.Color[0], l.Color[1], l.Color[2], 1}
+		var err error
+		switch l.Type {
+		case "directional":
+			err = entity.AddDirectionalLight(color, l.Intensity)
+		case "point":
+			err = entity.AddPointLight(color, l.Intensity, l.Range)
+		case "spot":
+			err = entity.AddSpotLight(color, l.Intensity, l.Range, l.InnerAngle, l.OuterAngle)
+		default:
+			err = errors.New("unknown light type: " + l.Type)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if desc.Layers != 0 {
+		if err := entity.SetLayers(desc.Layers); err != nil {
+			return err
+		}
+	}
+	for _, tag := range desc.Tags {
+		if err := entity.AddTag(tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// modelLoaded hides each model as it arrives so the new scene appears all at once
+func (l *SceneLoad) modelLoaded(request *AssetRequest) {
+	if l.done {
+		return
+	}
+	switch request.GetState() {
+	case AssetStateLoaded:
+		entity := &Entity{ID: request.Entity, world: l.world}
+		if err := entity.SetModelVisible(false); err != nil {
+			l.fail(err)
+			return
+		}
+		l.loaded[request.Entity] = true
+	case AssetStateFailed:
+		// The request holds the engine's *Error from the upload; wrapping keeps its code
+		l.fail(fmt.Errorf("failed to load %s: %w", request.Path, request.GetError()))
+	}
+}
+
+// swap replaces the previous scene with the loaded one, keeping its persistent entities
+func (l *SceneLoad) swap() {
+	e := l.engine
+	if e.scene != nil {
+		for _, id := range e.scene.entities {
+			if !e.isPersistent(l.world, id) {
+				l.world.DestroyEntity(id)
+			}
+		}
+	}
+
+	for _, id := range l.scene.entities {
+		entity := &Entity{ID: id, world: l.world}
+		if l.loaded[id] {
+			if err := entity.SetModelVisible(true); err != nil {
+				LogError("Failed to show scene entity: " + err.Error())
+			}
+		}
+		if err := addSceneComponents(entity, l.descs[id]); err != nil {
+			LogError("Failed to add scene components: " + err.Error())
+		}
+	}
+
+	e.scene = l.scene
+	l.world.scene = l.scene
+	l.setProgress(1)
+	l.finish(nil)
+}
+
+// fail destroys what the load created and reports err
+func (l *SceneLoad) fail(err error) {
+	l.done = true
+	for _, request := range l.requests {
+		if !request.IsDone() {
+			l.assets.Cancel(request)
+		}
+	}
+	for _, id := range l.scene.entities {
+		l.world.DestroyEntity(id)
+	}
+	l.finish(err)
+}
+
+func (l *SceneLoad) finish(err error) {
+	l.done = true
+	l.err = err
+	l.hideLoadScreen()
+
+	e := l.engine
+	if e.sceneLoad == l {
+		e.sceneLoad = nil
+	}
+
+	var scene *Scene
+	if err == nil {
+		scene = l.scene
+	}
+	for _, callback := range e.sceneCallbacks {
+		runCallback("OnSceneLoaded", func() { callback(scene, err) })
+	}
+}
+
+func (l *SceneLoad) setProgress(progress float32) {
+	l.progress = progress
+	if l.bar != nil {
+		l.bar.SetValue(progress)
+	}
+	if l.config.OnProgress != nil {
+		runCallback("OnProgress", func() { l.config.OnProgress(progress) })
+	}
+}
+
+// showLoadScreen covers the window with the background and a progress bar near the bottom
+func (l *SceneLoad) showLoadScreen() {
+	if l.config.Window == nil {
+		return
+	}
+	width, height := l.config.Window.GetSize()
+	screenWidth, screenHeight := float32(width), float32(height)
+
+	// Progress bars draw over buttons, so the screen hides the previous scene's UI
+	l.background = CreateUIProgressBar(0, 0, screenWidth, screenHeight)
+	if l.background != nil {
+		l.background.SetColors(l.config.Background, l.config.Background, l.config.Background)
+	}
+
+	barWidth := screenWidth * l.config.BarWidth
+	l.bar = CreateUIProgressBar((screenWidth-barWidth)/2, screenHeight*0.85, barWidth, l.config.BarHeight)
+	if l.bar != nil {
+		l.bar.SetFillColor(l.config.BarColor)
+		l.bar.SetStyle(UIStyle{CornerRadius: l.config.BarHeight / 2})
+	}
+}
+
+func (l *SceneLoad) hideLoadScreen() {
+	if l.bar != nil {
+		l.bar.Destroy()
+		l.bar = nil
+	}
+	if l.background != nil {
+		l.background.Destroy()
+		l.background = nil
+	}
+}
+
+func parseSceneFile(path string) (*sceneFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file sceneFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, errors.New("invalid scene file: " + err.Error())
+	}
+
+	// Model paths are relative to the scene file; from here on they are usable as they are
+	dir := filepath.Dir(path)
+	for name, desc := range file.Prefabs {
+		desc.Model = sceneModelPath(dir, desc.Model)
+		file.Prefabs[name] = desc
+	}
+	for i := range file.Entities {
+		file.Entities[i].Model = sceneModelPath(dir, file.Entities[i].Model)
+	}
+	return &file, nil
+}
+
+// LoadScene adds the entities of a scene file to the world, loading their models before it
+// returns, and registers its prefabs. Unlike LoadSceneAsync it leaves the world's other
+// entities alone. On failure the entities it created are destroyed.
+func (w *World) LoadScene(path string) (*Scene, error) {
+	if !w.ready() {
+		return nil, errNotInitialized
+	}
+
+	file, err := parseSceneFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	descs, err := w.expandScene(file)
+	if err != nil {
+		return nil, err
+	}
+
+	scene := &Scene{Path: path, names: make(map[string]EntityID)}
+	for _, desc := range descs {
+		entity, err := scene.spawnEntity(w, desc)
+		if err == nil && desc.Model != "" {
+			err = entity.LoadModel(desc.Model)
+		}
+		if err == nil {
+			err = addSceneComponents(entity, desc)
+		}
+		if err != nil {
+			for _, id := range scene.entities {
+				w.DestroyEntity(id)
+			}
+			return nil, err
+		}
+	}
+
+	w.scene = scene
+	return scene, nil
+}
+
+// SaveScene writes the world's entities with a transform to a scene file: their transforms,
+// model files, physics bodies, colliders, lights, layers and tags, along with the world's
+// prefabs and the prefab each instance came from. Names come from the scene last loaded
+// into the world. Models built in code (CreateMesh, voxel worlds) have no file to refer to
+// and are left out, along with anything else the scene format doesn't cover.
+func (w *World) SaveScene(path string) error {
+	if !w.ready() {
+		return errNotInitialized
+	}
+
+	ids, err := w.QueryIDs(WithTransform())
+	if err != nil {
+		return err
+	}
+	slices.Sort(ids)
+
+	names := make(map[EntityID]string)
+	if w.scene != nil {
+		for name, id := range w.scene.names {
+			names[id] = name
+		}
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	file := sceneFile{Entities: make([]sceneFileEntity, 0, len(ids))}
+	if w.prefabs != nil && len(w.prefabs.templates) > 0 {
+		file.Prefabs = make(map[string]sceneFileEntity, len(w.prefabs.templates))
+		for name, desc := range w.prefabs.templates {
+			desc.Model = relativeModelPath(dir, desc.Model)
+			file.Prefabs[name] = desc
+		}
+	}
+	for _, id := range ids {
+		entity := &Entity{ID: id, world: w}
+		desc, ok := saveSceneEntity(entity, dir)
+		if !ok {
+			continue
+		}
+		desc.Name = names[id]
+		if w.prefabs != nil {
+			desc.Prefab = w.prefabs.instances[id]
+		}
+		file.Entities = append(file.Entities, desc)
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// saveSceneEntity describes an entity for a scene file in dir, false if it can't be saved
+func saveSceneEntity(entity *Entity, dir string) (sceneFileEntity, bool) {
+	var desc sceneFileEntity
+	position, rotation, scale, err := entity.GetFullTransform()
+	if err != nil {
+		return desc, false
+	}
+	desc.Position = [3]float32{position.X, position.Y, position.Z}
+	desc.Rotation = [3]float32{rotation.X, rotation.Y, rotation.Z}
+	if scale != (Vector3{X: 1, Y: 1, Z: 1}) {
+		desc.Scale = &[3]float32{scale.X, scale.Y, scale.Z}
+	}
+
+	if entity.GetModelMeshCount() > 0 {
+		model := entity.modelPath()
+		if model == "" {
+			return desc, false
+		}
+		desc.Model = relativeModelPath(dir, model)
+	}
+
+	if mass, ok := entity.GetMass(); ok {
+		desc.Mass = mass
+		if velocity, err := entity.GetVelocity(); err == nil && velocity != (Vector3{}) {
+			desc.Velocity = &[3]float32{velocity.X, velocity.Y, velocity.Z}
+		}
+	}
+
+	if collider, ok := entity.GetCollider(); ok {
+		desc.Collider = sceneColliderOf(collider)
+	}
+	if light, ok := entity.GetLight(); ok {
+		desc.Light = sceneLightOf(light)
+	}
+
+	if layers := entity.GetLayers(); layers != LayerDefault {
+		desc.Layers = layers
+	}
+	desc.Tags = entity.GetTags()
+	return desc, true
+}
+
+// sceneColliderOf describes a collider for a scene file, nil for an unknown shape
+func sceneColliderOf(collider Collider) *sceneCollider {
+	if int(collider.Shape) >= len(sceneColliderShapes) {
+		return nil
+	}
+	c := &sceneCollider{Shape: sceneColliderShapes[collider.Shape], Friction: collider.Friction, Restitution: collider.Restitution, Trigger: collider.Trigger}
+	switch collider.Shape {
+	case ColliderBox:
+		c.Size = &[3]float32{collider.Size.X, collider.Size.Y, collider.Size.Z}
+	case ColliderSphere:
+		c.Radius = collider.Radius
+	case ColliderCapsule:
+		c.Radius, c.Height = collider.Radius, collider.Height
+	}
+	return c
+}
+
+// sceneLightOf describes a light for a scene file, nil for an unknown type
+func sceneLightOf(light Light) *sceneLight {
+	if int(light.Type) >= len(sceneLightTypes) {
+		return nil
+	}
+	return &sceneLight{
+		Type:       sceneLightTypes[light.Type],
+		Color:      [3]float32{light.Color.R, light.Color.G, light.Color.B},
+		Intensity:  light.Intensity,
+		Range:      light.Range,
+		InnerAngle: light.InnerAngle,
+		OuterAngle: light.OuterAngle,
+	}
+}
+
+// sceneModelPath resolves a model path in a scene file in dir
+func sceneModelPath(dir, model string) string {
+	if model == "" {
+		return ""
+	}
+	model = filepath.FromSlash(model)
+	if filepath.IsAbs(model) {
+		return model
+	}
+	return filepath.Join(dir, model)
+}
+
+// relativeModelPath turns a model path into one relative to a scene file in dir
+func relativeModelPath(dir, model string) string {
+	if model == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(model); err == nil {
+		if rel, err := filepath.Rel(dir, abs); err == nil {
+			model = rel
+		}
+	}
+	return filepath.ToSlash(model)
+}
+
+func vector3From(v [3]float32) Vector3 {
+	return Vector3{X: v[0], Y: v[1], Z: v[2]}
+}
@@ -0,0 +1,160 @@
+package boulder
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSendBudgetExceeded is returned for a message refused because its connection already
+// has more queued than its BackpressurePolicy allows
+var ErrSendBudgetExceeded = errors.New("send queue over budget")
+
+// NetworkEventSendBudgetExceeded is the type of SendBudgetExceededEvent
+const NetworkEventSendBudgetExceeded NetworkEventType = 4
+
+// SendBudgetExceededEvent is returned by PollEvent when a connection's send queue goes
+// over the budget of the session's BackpressurePolicy. It comes once each time the queue
+// goes over, so a server can slow down what it sends that client, or drop it, before
+// messages start to fail.
+type SendBudgetExceededEvent struct {
+	Connection  ConnectionHandle
+	QueuedBytes int
+	Budget      int
+}
+
+func (e SendBudgetExceededEvent) Type() NetworkEventType { return NetworkEventSendBudgetExceeded }
+
+// BackpressureAction is what happens to a message sent while its connection's queue is
+// over budget
+type BackpressureAction int
+
+const (
+	BackpressureSend  BackpressureAction = 0 // Queue it anyway
+	BackpressureDrop  BackpressureAction = 1 // Drop it and return nil
+	BackpressureError BackpressureAction = 2 // Refuse it with ErrSendBudgetExceeded
+	BackpressureBlock BackpressureAction = 3 // Wait up to BlockTimeout for the queue to drain, then refuse it
+)
+
+// BackpressurePolicy limits how much can queue up on a connection. It applies to
+// SendMessage, SendReliable, SendUnreliable and SendOnChannel; engine messages (clock sync,
+// replication) are never held back.
+type BackpressurePolicy struct {
+	MaxQueuedBytes int // Budget per connection; 0 turns backpressure off
+	Unreliable     BackpressureAction
+	Reliable       BackpressureAction
+	BlockTimeout   time.Duration
+}
+
+// DefaultBackpressurePolicy drops unreliable messages and refuses reliable ones once 256KB
+// are queued, half the GameNetworkingSockets send buffer
+func DefaultBackpressurePolicy() BackpressurePolicy {
+	return BackpressurePolicy{
+		MaxQueuedBytes: 256 * 1024,
+		Unreliable:     BackpressureDrop,
+		Reliable:       BackpressureError,
+		BlockTimeout:   50 * time.Millisecond,
+	}
+}
+
+// backpressureState is the session's policy and the connections over budget
+type backpressureState struct {
+	policy BackpressurePolicy
+	over   map[ConnectionHandle]bool
+	events []NetworkEvent
+}
+
+// GetSendQueueBytes returns how many bytes are waiting to be sent on a connection,
+// reliable and unreliable
+func (ns *NetworkSession) GetSendQueueBytes(conn ConnectionHandle) (int, error) {
+	stats, err := ns.GetConnectionStats(conn)
+	if err != nil {
+		return 0, err
+	}
+	return stats.QueuedBytes, nil
+}
+
+// SetBackpressurePolicy sets how sends behave when a connection's queue is over budget
+func (ns *NetworkSession) SetBackpressurePolicy(policy BackpressurePolicy) {
+	if policy.MaxQueuedBytes <= 0 {
+		ns.backpressure = nil
+		return
+	}
+	if ns.backpressure == nil {
+		ns.backpressure = &backpressureState{over: make(map[ConnectionHandle]bool)}
+	}
+	ns.backpressure.policy = policy
+}
+
+// GetBackpressurePolicy returns the session's policy; MaxQueuedBytes is 0 when it has none
+func (ns *NetworkSession) GetBackpressurePolicy() BackpressurePolicy {
+	if ns.backpressure == nil {
+		return BackpressurePolicy{}
+	}
+	return ns.backpressure.policy
+}
+
+// admit applies the backpressure policy to a message about to be sent. It returns whether
+// to send it, and the error to return instead when not.
+func (ns *NetworkSession) admit(conn ConnectionHandle, reliable bool) (bool, error) {
+	bp := ns.backpressure
+	if bp == nil {
+		return true, nil
+	}
+
+	queued, err := ns.GetSendQueueBytes(conn)
+	if err != nil {
+		// Connections without stats can't be measured; let the send report the problem
+		return true, nil
+	}
+	if queued <= bp.policy.MaxQueuedBytes {
+		delete(bp.over, conn)
+		return true, nil
+	}
+	if !bp.over[conn] {
+		bp.over[conn] = true
+		bp.events = append(bp.events, SendBudgetExceededEvent{
+			Connection:  conn,
+			QueuedBytes: queued,
+			Budget:      bp.policy.MaxQueuedBytes,
+		})
+	}
+
+	action := bp.policy.Unreliable
+	if reliable {
+		action = bp.policy.Reliable
+	}
+	switch action {
+	case BackpressureDrop:
+		return false, nil
+	case BackpressureError:
+		return false, ErrSendBudgetExceeded
+	case BackpressureBlock:
+		deadline := time.Now().Add(bp.policy.BlockTimeout)
+		for time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+			if queued, err := ns.GetSendQueueBytes(conn); err != nil || queued <= bp.policy.MaxQueuedBytes {
+				return true, nil
+			}
+		}
+		return false, ErrSendBudgetExceeded
+	}
+	return true, nil
+}
+
+// takeBackpressureEvent returns the oldest SendBudgetExceededEvent not yet polled
+func (ns *NetworkSession) takeBackpressureEvent() NetworkEvent {
+	bp := ns.backpressure
+	if bp == nil || len(bp.events) == 0 {
+		return nil
+	}
+	event := bp.events[0]
+	bp.events = bp.events[1:]
+	return event
+}
+
+// forgetBackpressure drops a closed connection's state
+func (ns *NetworkSession) forgetBackpressure(conn ConnectionHandle) {
+	if ns.backpressure != nil {
+		delete(ns.backpressure.over, conn)
+	}
+}
@@ -0,0 +1,342 @@
+package boulder
+
+import (
+	"errors"
+	"time"
+)
+
+// SessionBrowserConfig configures the layout and server sources of a SessionBrowser
+type SessionBrowserConfig struct {
+	X, Y            float32
+	Width           float32
+	RowHeight       float32
+	RowSpacing      float32
+	VisibleRows     int
+	ButtonHeight    float32
+	SearchLAN       bool
+	SearchSteam     bool
+	DiscoveryPort   uint16        // 0 uses DefaultDiscoveryPort
+	RefreshInterval time.Duration // 0 only refreshes on demand
+
+	RowColor      UIColor
+	RowHoverColor UIColor
+	SelectedColor UIColor
+	ButtonColor   UIColor
+	ButtonHover   UIColor
+	ButtonPressed UIColor
+}
+
+// DefaultSessionBrowserConfig returns a ten row browser searching LAN and Steam
+func DefaultSessionBrowserConfig() SessionBrowserConfig {
+	return SessionBrowserConfig{
+		X:               40,
+		Y:               40,
+		Width:           560,
+		RowHeight:       32,
+		RowSpacing:      4,
+		VisibleRows:     10,
+		ButtonHeight:    40,
+		SearchLAN:       true,
+		SearchSteam:     true,
+		RefreshInterval: 5 * time.Second,
+
+		RowColor:      UIColor{0.15, 0.15, 0.18, 0.9},
+		RowHoverColor: UIColor{0.25, 0.25, 0.3, 0.9},
+		SelectedColor: UIColor{0.2, 0.4, 0.7, 0.95},
+		ButtonColor:   UIColorDarkGray,
+		ButtonHover:   UIColorGray,
+		ButtonPressed: UIColor{0.2, 0.2, 0.2, 1.0},
+	}
+}
+
+// sessionRowState is how a row is currently drawn, so colors only change when needed
+type sessionRowState int
+
+const (
+	sessionRowUnset sessionRowState = iota
+	sessionRowEmpty
+	sessionRowServer
+	sessionRowSelected
+)
+
+// SessionJoinCallback is called after the browser starts connecting to a server
+type SessionJoinCallback func(server ServerInfo, conn ConnectionHandle, err error)
+
+// SessionBrowser is a prebuilt "join game" list of LAN servers and Steam lobbies with
+// refresh and join buttons. Each row is a selectable button; the row's server (name,
+// players and ping columns) is available through GetRowServer and GetRowBounds for
+// drawing text on top.
+type SessionBrowser struct {
+	session *NetworkSession
+	config  SessionBrowserConfig
+	lan     *LANDiscovery
+
+	servers     []ServerInfo
+	lanServers  []ServerInfo
+	steamLobby  []ServerInfo
+	selected    int
+	scroll      int
+	lastRefresh time.Time
+	onJoin      SessionJoinCallback
+
+	rows      []*UIButton
+	rowStates []sessionRowState
+	refresh   *UIButton
+	join      *UIButton
+}
+
+// NewSessionBrowser creates the browser's UI and starts searching for servers. Joining
+// connects with session.ConnectPeer.
+func NewSessionBrowser(session *NetworkSession, config SessionBrowserConfig) (*SessionBrowser, error) {
+	defer lockThread()()
+	if config.VisibleRows <= 0 {
+		return nil, errors.New("session browser needs at least one visible row")
+	}
+	if config.DiscoveryPort == 0 {
+		config.DiscoveryPort = DefaultDiscoveryPort
+	}
+
+	sb := &SessionBrowser{
+		session:  session,
+		config:   config,
+		selected: -1,
+	}
+
+	if config.SearchLAN {
+		lan, err := NewLANDiscovery(config.DiscoveryPort)
+		if err != nil {
+			return nil, err
+		}
+		sb.lan = lan
+	}
+
+	for i := 0; i < config.VisibleRows; i++ {
+		x, y, w, h, _ := sb.GetRowBounds(i)
+		row := CreateUIButton(x, y, w, h, config.RowColor, config.RowHoverColor, config.SelectedColor)
+		if row == nil {
+			err := lastError("failed to create session browser row")
+			sb.Destroy()
+			return nil, err
+		}
+		sb.rows = append(sb.rows, row)
+		sb.rowStates = append(sb.rowStates, sessionRowUnset)
+	}
+
+	buttonY := config.Y + float32(config.VisibleRows)*(config.RowHeight+config.RowSpacing) + config.RowSpacing
+	buttonWidth := (config.Width - config.RowSpacing) / 2
+	sb.refresh = CreateUIButton(config.X, buttonY, buttonWidth, config.ButtonHeight,
+		config.ButtonColor, config.ButtonHover, config.ButtonPressed)
+	if sb.refresh != nil {
+		sb.join = CreateUIButton(config.X+buttonWidth+config.RowSpacing, buttonY, buttonWidth, config.ButtonHeight,
+			config.ButtonColor, config.ButtonHover, config.ButtonPressed)
+	}
+	if sb.refresh == nil || sb.join == nil {
+		err := lastError("failed to create session browser buttons")
+		sb.Destroy()
+		return nil, err
+	}
+
+	sb.Refresh()
+	sb.updateRows()
+	return sb, nil
+}
+
+// Destroy removes the browser's UI and stops discovery
+func (sb *SessionBrowser) Destroy() {
+	for _, row := range sb.rows {
+		row.Destroy()
+	}
+	sb.rows = nil
+	if sb.refresh != nil {
+		sb.refresh.Destroy()
+	}
+	if sb.join != nil {
+		sb.join.Destroy()
+	}
+	if sb.lan != nil {
+		sb.lan.Close()
+		sb.lan = nil
+	}
+}
+
+// OnJoin sets the function called when the player joins a server
+func (sb *SessionBrowser) OnJoin(callback SessionJoinCallback) {
+	sb.onJoin = callback
+}
+
+// Refresh queries LAN servers and Steam lobbies again
+func (sb *SessionBrowser) Refresh() {
+	sb.lastRefresh = time.Now()
+
+	if sb.lan != nil {
+		if err := sb.lan.Refresh(); err != nil {
+			LogError("Session browser: LAN query failed: " + err.Error())
+		}
+	}
+	if sb.config.SearchSteam {
+		// Without Steam the browser simply lists LAN servers
+		RequestSteamLobbies()
+	}
+}
+
+// Update collects discovery results and handles clicks (call this every frame after
+// forwarding mouse input to the UI)
+func (sb *SessionBrowser) Update() {
+	if sb.config.RefreshInterval > 0 && time.Since(sb.lastRefresh) >= sb.config.RefreshInterval {
+		sb.Refresh()
+	}
+
+	if sb.lan != nil {
+		sb.lan.Update()
+		sb.lanServers = sb.lan.GetServers()
+	}
+	if sb.config.SearchSteam {
+		if lobbies, ready := GetSteamLobbies(); ready {
+			sb.steamLobby = lobbies
+		}
+	}
+	sb.mergeServers()
+
+	for i, row := range sb.rows {
+		if row.WasClicked() {
+			row.ResetClick()
+			sb.Select(sb.scroll + i)
+		}
+	}
+	if sb.refresh.WasClicked() {
+		sb.refresh.ResetClick()
+		sb.Refresh()
+	}
+	if sb.join.WasClicked() {
+		sb.join.ResetClick()
+		sb.Join()
+	}
+
+	sb.updateRows()
+}
+
+// GetServers returns every listed server, LAN servers first, each group sorted by ping
+func (sb *SessionBrowser) GetServers() []ServerInfo {
+	return sb.servers
+}
+
+// Select selects the server at index in GetServers (-1 clears the selection)
+func (sb *SessionBrowser) Select(index int) {
+	if index < -1 || index >= len(sb.servers) {
+		return
+	}
+	sb.selected = index
+	sb.updateRows()
+}
+
+// GetSelected returns the selected server
+func (sb *SessionBrowser) GetSelected() (ServerInfo, bool) {
+	if sb.selected < 0 || sb.selected >= len(sb.servers) {
+		return ServerInfo{}, false
+	}
+	return sb.servers[sb.selected], true
+}
+
+// Scroll moves the visible rows by delta entries
+func (sb *SessionBrowser) Scroll(delta int) {
+	sb.scroll += delta
+	sb.clampScroll()
+	sb.updateRows()
+}
+
+// Join connects to the selected server
+func (sb *SessionBrowser) Join() (ConnectionHandle, error) {
+	server, ok := sb.GetSelected()
+	if !ok {
+		return 0, errors.New("no server selected")
+	}
+
+	conn, err := sb.session.ConnectPeer(server.Address)
+	if sb.onJoin != nil {
+		runCallback("OnJoin", func() { sb.onJoin(server, conn, err) })
+	}
+	return conn, err
+}
+
+// GetRowBounds returns the screen rectangle of a visible row
+func (sb *SessionBrowser) GetRowBounds(row int) (x, y, width, height float32, ok bool) {
+	if row < 0 || row >= sb.config.VisibleRows {
+		return 0, 0, 0, 0, false
+	}
+
+	y = sb.config.Y + float32(row)*(sb.config.RowHeight+sb.config.RowSpacing)
+	return sb.config.X, y, sb.config.Width, sb.config.RowHeight, true
+}
+
+// GetRowServer returns the server shown in a visible row
+func (sb *SessionBrowser) GetRowServer(row int) (ServerInfo, bool) {
+	index := sb.scroll + row
+	if row < 0 || row >= sb.config.VisibleRows || index >= len(sb.servers) {
+		return ServerInfo{}, false
+	}
+	return sb.servers[index], true
+}
+
+// mergeServers rebuilds the list while keeping the selected server selected
+func (sb *SessionBrowser) mergeServers() {
+	var previous ServerInfo
+	hadSelection := false
+	if selected, ok := sb.GetSelected(); ok {
+		previous, hadSelection = selected, true
+	}
+
+	sb.servers = append(append(sb.servers[:0:0], sb.lanServers...), sb.steamLobby...)
+
+	sb.selected = -1
+	if hadSelection {
+		for i, server := range sb.servers {
+			if server.Address == previous.Address {
+				sb.selected = i
+				break
+			}
+		}
+	}
+	sb.clampScroll()
+}
+
+func (sb *SessionBrowser) clampScroll() {
+	maxScroll := len(sb.servers) - sb.config.VisibleRows
+	if sb.scroll > maxScroll {
+		sb.scroll = maxScroll
+	}
+	if sb.scroll < 0 {
+		sb.scroll = 0
+	}
+}
+
+// updateRows shows a row per visible server and highlights the selection
+func (sb *SessionBrowser) updateRows() {
+	hidden := UIColor{}
+	for i, row := range sb.rows {
+		index := sb.scroll + i
+		state := sessionRowServer
+		if index >= len(sb.servers) {
+			state = sessionRowEmpty
+		} else if index == sb.selected {
+			state = sessionRowSelected
+		}
+		if state == sb.rowStates[i] {
+			continue
+		}
+		sb.rowStates[i] = state
+
+		switch state {
+		case sessionRowEmpty:
+			row.SetColors(hidden, hidden, hidden)
+		case sessionRowSelected:
+			row.SetColors(sb.config.SelectedColor, sb.config.SelectedColor, sb.config.SelectedColor)
+		default:
+			row.SetColors(sb.config.RowColor, sb.config.RowHoverColor, sb.config.SelectedColor)
+		}
+		row.SetEnabled(state != sessionRowEmpty)
+	}
+
+	if sb.join != nil {
+		sb.join.SetEnabled(sb.selected >= 0)
+	}
+}
@@ -1,13 +1,15 @@
 package boulder
 
 // #cgo CFLAGS: -I..
-// #cgo LDFLAGS: -L../build -lboulder_shared -Wl,-rpath,${SRCDIR}/../build
 // #include <stdlib.h>
 // #include "../boulder_cgo.h"
 import "C"
 import (
 	"errors"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"unsafe"
 )
 
@@ -35,18 +37,24 @@ const (
 // ShaderModuleID uniquely identifies a compiled shader module
 type ShaderModuleID uint64
 
+// ShaderDefines are the preprocessor macros of a shader variant. An empty value defines
+// the macro without a value, for #ifdef.
+type ShaderDefines map[string]string
+
 // Shader represents a compiled shader module
 type Shader struct {
-	ID     ShaderModuleID
-	Kind   ShaderKind
-	Name   string
-	engine *Engine
+	ID      ShaderModuleID
+	Kind    ShaderKind
+	Name    string
+	Defines ShaderDefines // Kept when the shader is reloaded
+	engine  *Engine
 }
 
 // CompileShader compiles shader source code and creates a shader module
 func (e *Engine) CompileShader(source string, kind ShaderKind, name string) (*Shader, error) {
+	defer lockThread()()
 	if !e.initialized {
-		return nil, errors.New("engine not initialized")
+		return nil, errNotInitialized
 	}
 
 	cSource := C.CString(source)
@@ -57,21 +65,23 @@ func (e *Engine) CompileShader(source string, kind ShaderKind, name string) (*Sh
 
 	id := C.boulder_compile_shader(cSource, C.int(kind), cName)
 	if id == 0 {
-		return nil, errors.New("failed to compile shader: " + name)
+		return nil, shaderCompileError("failed to compile shader: "+name, name, lastError(""))
 	}
 
-	return &Shader{
+	s := &Shader{
 		ID:     ShaderModuleID(id),
 		Kind:   kind,
 		Name:   name,
 		engine: e,
-	}, nil
+	}
+	e.track(s, stageShaders)
+	return s, nil
 }
 
 // CompileShaderFromFile loads and compiles a shader from a file
 func (e *Engine) CompileShaderFromFile(path string, kind ShaderKind) (*Shader, error) {
 	if !e.initialized {
-		return nil, errors.New("engine not initialized")
+		return nil, errNotInitialized
 	}
 
 	// Read file
@@ -84,6 +94,157 @@ func (e *Engine) CompileShaderFromFile(path string, kind ShaderKind) (*Shader, e
 	return e.CompileShader(source, kind, path)
 }
 
+// SetShaderIncludeRoot sets the directory shader #include paths are resolved against,
+// usually the asset directory. #include "file" is tried next to the including file first.
+// An empty dir uses the working directory.
+func (e *Engine) SetShaderIncludeRoot(dir string) error {
+	if !e.initialized {
+		return errNotInitialized
+	}
+
+	cDir := C.CString(dir)
+	defer C.free(unsafe.Pointer(cDir))
+
+	C.boulder_set_shader_include_root(cDir)
+	return nil
+}
+
+// CompileShaderVariant compiles shader source with preprocessor defines. Variants are
+// cached by their preprocessed source, so compiling the same variant again skips the
+// compiler unless an included file changed.
+func (e *Engine) CompileShaderVariant(source string, kind ShaderKind, defines ShaderDefines) (*Shader, error) {
+	return e.compileShaderVariant(source, kind, "variant"+defines.String(), defines)
+}
+
+// CompileShaderVariantFromFile loads a shader from a file and compiles it with
+// preprocessor defines
+func (e *Engine) CompileShaderVariantFromFile(path string, kind ShaderKind, defines ShaderDefines) (*Shader, error) {
+	if !e.initialized {
+		return nil, errNotInitialized
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.compileShaderVariant(string(data), kind, path, defines)
+}
+
+// ClearShaderCache drops the cached variant binaries
+func (e *Engine) ClearShaderCache() {
+	if !e.initialized {
+		return
+	}
+	C.boulder_clear_shader_cache()
+}
+
+func (e *Engine) compileShaderVariant(source string, kind ShaderKind, name string, defines ShaderDefines) (*Shader, error) {
+	if !e.initialized {
+		return nil, errNotInitialized
+	}
+
+	id, err := compileVariantModule(0, source, kind, name, defines)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Shader{
+		ID:      id,
+		Kind:    kind,
+		Name:    name,
+		Defines: defines,
+		engine:  e,
+	}
+	e.track(s, stageShaders)
+	return s, nil
+}
+
+// compileVariantModule compiles a shader variant, destroying the module it replaces
+// (if any) once the new one compiled
+func compileVariantModule(replace ShaderModuleID, source string, kind ShaderKind, name string,
+	defines ShaderDefines) (ShaderModuleID, error) {
+	defer lockThread()()
+	cDefines, err := defines.cStrings()
+	if err != nil {
+		return 0, err
+	}
+	defer freeCStrings(cDefines)
+
+	cSource := C.CString(source)
+	defer C.free(unsafe.Pointer(cSource))
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	id := C.boulder_compile_shader_variant(cSource, C.int(kind), cName, cStringArray(cDefines), C.uint32_t(len(cDefines)))
+	if id == 0 {
+		return 0, shaderCompileError("failed to compile shader: "+name, name, lastError(""))
+	}
+
+	if replace != 0 {
+		C.boulder_destroy_shader_module(C.ShaderModuleID(replace))
+	}
+	return ShaderModuleID(id), nil
+}
+
+// String formats the defines like "[FOG SHADOWS=4]", sorted by name
+func (d ShaderDefines) String() string {
+	parts := make([]string, 0, len(d))
+	for _, macro := range d.names() {
+		if value := d[macro]; value != "" {
+			parts = append(parts, macro+"="+value)
+		} else {
+			parts = append(parts, macro)
+		}
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// cStrings returns the defines as "NAME" or "NAME=VALUE" C strings, to be freed with
+// freeCStrings
+func (d ShaderDefines) cStrings() ([]*C.char, error) {
+	for macro := range d {
+		if macro == "" || strings.ContainsAny(macro, "= \t") {
+			return nil, errors.New("invalid shader define: " + macro)
+		}
+	}
+
+	cDefines := make([]*C.char, 0, len(d))
+	for _, macro := range d.names() {
+		define := macro
+		if value := d[macro]; value != "" {
+			define += "=" + value
+		}
+		cDefines = append(cDefines, C.CString(define))
+	}
+	return cDefines, nil
+}
+
+func freeCStrings(strs []*C.char) {
+	for _, str := range strs {
+		C.free(unsafe.Pointer(str))
+	}
+}
+
+// cStringArray returns a pointer to the first string, or nil. The pointers are C memory,
+// so the array may be passed from Go memory.
+func cStringArray(strs []*C.char) **C.char {
+	if len(strs) == 0 {
+		return nil
+	}
+	return &strs[0]
+}
+
+func (d ShaderDefines) names() []string {
+	names := make([]string, 0, len(d))
+	for macro := range d {
+		names = append(names, macro)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Destroy destroys the shader module and frees resources
 func (s *Shader) Destroy() {
 	if s.engine == nil || !s.engine.initialized {
@@ -92,12 +253,23 @@ func (s *Shader) Destroy() {
 
 	C.boulder_destroy_shader_module(C.ShaderModuleID(s.ID))
 	s.ID = 0
+	s.engine.untrack(s)
 }
 
 // Reload recompiles the shader with new source code
 func (s *Shader) Reload(source string) error {
+	defer lockThread()()
 	if s.engine == nil || !s.engine.initialized {
-		return errors.New("engine not initialized")
+		return errNotInitialized
+	}
+
+	if len(s.Defines) > 0 {
+		newID, err := compileVariantModule(s.ID, source, s.Kind, s.Name, s.Defines)
+		if err != nil {
+			return err
+		}
+		s.ID = newID
+		return nil
 	}
 
 	cSource := C.CString(source)
@@ -108,7 +280,7 @@ func (s *Shader) Reload(source string) error {
 
 	newID := C.boulder_reload_shader(C.ShaderModuleID(s.ID), cSource, C.int(s.Kind), cName)
 	if newID == 0 {
-		return errors.New("failed to reload shader: " + s.Name)
+		return shaderCompileError("failed to reload shader: "+s.Name, s.Name, lastError(""))
 	}
 
 	s.ID = ShaderModuleID(newID)
@@ -118,7 +290,7 @@ func (s *Shader) Reload(source string) error {
 // ReloadFromFile reloads the shader from a file
 func (s *Shader) ReloadFromFile(path string) error {
 	if s.engine == nil || !s.engine.initialized {
-		return errors.New("engine not initialized")
+		return errNotInitialized
 	}
 
 	// Read file
@@ -131,3 +303,52 @@ func (s *Shader) ReloadFromFile(path string) error {
 	s.Name = path
 	return s.Reload(source)
 }
+
+// CompileSPIRV compiles shader source to SPIR-V words without creating a shader module.
+// It does not need an initialized engine, so it can be used by offline cook steps.
+func CompileSPIRV(source string, kind ShaderKind, name string) ([]uint32, error) {
+	defer lockThread()()
+	cSource := C.CString(source)
+	defer C.free(unsafe.Pointer(cSource))
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	words := make([]uint32, 16*1024)
+	var count C.uint32_t
+	ret := C.boulder_compile_spirv(cSource, C.int(kind), cName,
+		(*C.uint32_t)(unsafe.Pointer(&words[0])), C.uint32_t(len(words)), &count)
+	if ret == 1 {
+		words = make([]uint32, count)
+		ret = C.boulder_compile_spirv(cSource, C.int(kind), cName,
+			(*C.uint32_t)(unsafe.Pointer(&words[0])), C.uint32_t(len(words)), &count)
+	}
+	if ret != 0 {
+		return nil, shaderCompileError("failed to compile shader: "+name, name, lastError(""))
+	}
+
+	return words[:count], nil
+}
+
+// ShaderKindFromPath returns the shader kind for a file extension such as ".frag" or ".mesh"
+func ShaderKindFromPath(path string) (ShaderKind, bool) {
+	switch filepath.Ext(path) {
+	case ".vert":
+		return ShaderKindVertex, true
+	case ".frag":
+		return ShaderKindFragment, true
+	case ".comp":
+		return ShaderKindCompute, true
+	case ".geom":
+		return ShaderKindGeometry, true
+	case ".tesc":
+		return ShaderKindTessControl, true
+	case ".tese":
+		return ShaderKindTessEvaluation, true
+	case ".mesh":
+		return ShaderKindMesh, true
+	case ".task":
+		return ShaderKindTask, true
+	}
+	return 0, false
+}
@@ -0,0 +1,91 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ShaderDiagnostic is one message from the shader compiler
+type ShaderDiagnostic struct {
+	File     string // The shader's name, or the included file the message is about
+	Line     int    // 0 if the message isn't about a line
+	Severity string // "error" or "warning"
+	Message  string
+}
+
+// ShaderCompileError is returned when GLSL fails to compile. Its message has the compiler's
+// whole output, as glslc would print it; Diagnostics has the same split into messages, e.g.
+// to jump to a line in an editor. It unwraps to the engine's *Error with ErrorShader.
+type ShaderCompileError struct {
+	Op          string // What failed, e.g. "failed to compile shader: water.frag"
+	Name        string // The shader's name
+	Log         string // The compiler's output
+	Diagnostics []ShaderDiagnostic
+	Err         *Error
+}
+
+func (e *ShaderCompileError) Error() string {
+	if e.Log == "" {
+		return e.Op
+	}
+	return e.Op + ":\n" + e.Log
+}
+
+func (e *ShaderCompileError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	shaderLinePattern = regexp.MustCompile(`^(.*?):(\d+): (error|warning): (.*)$`)
+	shaderFilePattern = regexp.MustCompile(`^(.*?): (error|warning): (.*)$`)
+)
+
+// shaderCompileError names a failed shader compile with op, returning a *ShaderCompileError
+// when the compiler rejected the source
+func shaderCompileError(op, name string, err *Error) error {
+	err.Op = op
+	if err.Code != ErrorShader {
+		return err
+	}
+
+	log := strings.TrimPrefix(err.Message, "Shader compilation failed for "+name+": ")
+	log = strings.TrimRight(log, "\n")
+	return &ShaderCompileError{Op: op, Name: name, Log: log, Diagnostics: parseShaderLog(log), Err: err}
+}
+
+// parseShaderLog splits shaderc's output into messages, skipping its summary lines such as
+// "2 errors generated."
+func parseShaderLog(log string) []ShaderDiagnostic {
+	var diagnostics []ShaderDiagnostic
+	for _, line := range strings.Split(log, "\n") {
+		line = strings.TrimSpace(line)
+		if m := shaderLinePattern.FindStringSubmatch(line); m != nil {
+			number, _ := strconv.Atoi(m[2])
+			diagnostics = append(diagnostics, ShaderDiagnostic{File: m[1], Line: number, Severity: m[3], Message: m[4]})
+		} else if m := shaderFilePattern.FindStringSubmatch(line); m != nil {
+			diagnostics = append(diagnostics, ShaderDiagnostic{File: m[1], Severity: m[2], Message: m[3]})
+		}
+	}
+	return diagnostics
+}
+
+// GetCompileError returns why an async compile failed, with the compiler's output, or nil
+// if it hasn't failed
+func (s *Shader) GetCompileError() error {
+	if s.engine == nil || !s.engine.initialized {
+		return nil
+	}
+
+	length := C.boulder_get_shader_error(C.ShaderModuleID(s.ID), nil, 0)
+	if length == 0 {
+		return nil
+	}
+	buf := make([]C.char, length+1)
+	C.boulder_get_shader_error(C.ShaderModuleID(s.ID), &buf[0], C.uint32_t(len(buf)))
+	return shaderCompileError("failed to compile shader: "+s.Name, s.Name, &Error{Code: ErrorShader, Message: C.GoString(&buf[0])})
+}
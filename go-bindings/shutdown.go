@@ -0,0 +1,135 @@
+package boulder
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// shutdownStage orders how Engine.Shutdown tears down objects that are still alive. Lower
+// stages go first: sessions stop before anything they might render or replicate goes away,
+// and pipelines are destroyed before the shaders they were built from. The window is not
+// a stage: the engine has one, it has no Destroy of its own, and boulder_shutdown closes it
+// after the device, which nothing tracked here outlives.
+type shutdownStage int
+
+const (
+	stageSessions shutdownStage = iota
+	stagePipelines
+	stageShaders
+	stageTextures
+)
+
+// dependent is an object created from an engine that must be destroyed before it shuts down
+type dependent interface {
+	Destroy()
+	describe() string
+}
+
+// liveObject records when and in which stage a dependent is torn down
+type liveObject struct {
+	stage shutdownStage
+	seq   uint64
+}
+
+// track registers an object so Shutdown destroys it if it is still alive
+func (e *Engine) track(d dependent, stage shutdownStage) {
+	if e.live == nil {
+		e.live = make(map[dependent]liveObject)
+	}
+	e.liveSeq++
+	e.live[d] = liveObject{stage: stage, seq: e.liveSeq}
+}
+
+// untrack forgets an object once it was destroyed
+func (e *Engine) untrack(d dependent) {
+	if e == nil {
+		return
+	}
+	delete(e.live, d)
+}
+
+// untrackStage forgets every object in a stage, e.g. after the device they lived on is gone
+func (e *Engine) untrackStage(stage shutdownStage) {
+	for d, obj := range e.live {
+		if obj.stage == stage {
+			delete(e.live, d)
+		}
+	}
+}
+
+// liveObjects returns the tracked objects in teardown order: by stage, newest first
+func (e *Engine) liveObjects() []dependent {
+	objects := make([]dependent, 0, len(e.live))
+	for d := range e.live {
+		objects = append(objects, d)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		a, b := e.live[objects[i]], e.live[objects[j]]
+		if a.stage != b.stage {
+			return a.stage < b.stage
+		}
+		return a.seq > b.seq
+	})
+	return objects
+}
+
+// LiveObjects describes the sessions, pipelines, shaders and textures created from the
+// engine that were not destroyed yet, in the order Shutdown would tear them down. The
+// window is not listed; Shutdown always closes it.
+func (e *Engine) LiveObjects() []string {
+	objects := e.liveObjects()
+	names := make([]string, len(objects))
+	for i, d := range objects {
+		names[i] = d.describe()
+	}
+	return names
+}
+
+// ShutdownStrict shuts the engine down only if every session, pipeline, shader and texture
+// created from it was destroyed. Otherwise it returns an error listing them and leaves the
+// engine running. An open window does not count, as it can only be closed by shutting down.
+func (e *Engine) ShutdownStrict() error {
+	if !e.initialized {
+		return nil
+	}
+
+	if names := e.LiveObjects(); len(names) > 0 {
+		return errors.New("engine has " + strconv.Itoa(len(names)) + " live objects: " + strings.Join(names, ", "))
+	}
+
+	e.Shutdown()
+	return nil
+}
+
+// destroyLiveObjects destroys everything still tracked, dependents first
+func (e *Engine) destroyLiveObjects() {
+	objects := e.liveObjects()
+	if len(objects) > 0 {
+		LogInfo("Destroying " + strconv.Itoa(len(objects)) + " live objects before shutdown")
+	}
+	for _, d := range objects {
+		d.Destroy()
+	}
+	e.live = nil
+}
+
+func (ns *NetworkSession) describe() string {
+	return "network session"
+}
+
+func (p *Pipeline) describe() string {
+	return "pipeline " + strconv.FormatUint(uint64(p.ID), 10)
+}
+
+func (s *Shader) describe() string {
+	if s.Name != "" {
+		return "shader " + strconv.Quote(s.Name)
+	}
+	return "shader " + strconv.FormatUint(uint64(s.ID), 10)
+}
+
+func (t *Texture) describe() string {
+	return "texture " + strconv.FormatUint(uint64(t.ID), 10) + " (" + strconv.Itoa(t.Width) + "x" + strconv.Itoa(t.Height) + ")"
+}
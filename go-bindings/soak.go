@@ -0,0 +1,174 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EntityCount returns how many entities the world has. Entities flecs and the engine make
+// for themselves (components, observers) aren't counted, so an empty world has 0.
+func (w *World) EntityCount() int {
+	if !w.engine.initialized || w.id == 0 {
+		return 0
+	}
+	return max(0, int(C.boulder_world_entity_count(w.id)))
+}
+
+// NativeObjectCounts is how many objects each engine subsystem holds on the native side
+type NativeObjectCounts struct {
+	Worlds          int
+	Entities        int // In every world
+	Models          int // Entities with a model
+	Meshes          int // Meshes of those models
+	Textures        int
+	ShaderModules   int
+	Pipelines       int
+	UIElements      int // Buttons, labels, progress bars and containers
+	Fonts           int
+	NetworkSessions int
+	Connections     int // Open on every network session
+}
+
+// GetNativeObjectCounts returns the live native objects by subsystem, e.g. to log from a
+// long-running soak test
+func (e *Engine) GetNativeObjectCounts() (NativeObjectCounts, error) {
+	defer lockThread()()
+	if !e.initialized {
+		return NativeObjectCounts{}, errNotInitialized
+	}
+
+	var c C.NativeObjectCounts
+	if C.boulder_get_native_object_counts(&c) != 0 {
+		return NativeObjectCounts{}, lastError("failed to get native object counts")
+	}
+	return NativeObjectCounts{
+		Worlds:          int(c.worlds),
+		Entities:        int(c.entities),
+		Models:          int(c.models),
+		Meshes:          int(c.meshes),
+		Textures:        int(c.textures),
+		ShaderModules:   int(c.shaderModules),
+		Pipelines:       int(c.pipelines),
+		UIElements:      int(c.uiElements),
+		Fonts:           int(c.fonts),
+		NetworkSessions: int(c.networkSessions),
+		Connections:     int(c.connections),
+	}, nil
+}
+
+// fields returns the counts by name, in declaration order
+func (c NativeObjectCounts) fields() []objectCount {
+	return []objectCount{
+		{"worlds", c.Worlds},
+		{"entities", c.Entities},
+		{"models", c.Models},
+		{"meshes", c.Meshes},
+		{"textures", c.Textures},
+		{"shader modules", c.ShaderModules},
+		{"pipelines", c.Pipelines},
+		{"UI elements", c.UIElements},
+		{"fonts", c.Fonts},
+		{"network sessions", c.NetworkSessions},
+		{"connections", c.Connections},
+	}
+}
+
+type objectCount struct {
+	name  string
+	count int
+}
+
+// LeakTracker samples native object counts across the cycles of a soak test, such as
+// spawning and destroying a level over and over, and reports counts that never stop
+// growing. Sample after each cycle, once things have settled, then Check.
+type LeakTracker struct {
+	engine  *Engine
+	samples []NativeObjectCounts
+}
+
+// NewLeakTracker returns a tracker with no samples
+func (e *Engine) NewLeakTracker() *LeakTracker {
+	return &LeakTracker{engine: e}
+}
+
+// Sample records the counts at the end of a cycle
+func (t *LeakTracker) Sample() error {
+	counts, err := t.engine.GetNativeObjectCounts()
+	if err != nil {
+		return err
+	}
+	t.samples = append(t.samples, counts)
+	return nil
+}
+
+// GetSamples returns the counts recorded so far, oldest first
+func (t *LeakTracker) GetSamples() []NativeObjectCounts {
+	return t.samples
+}
+
+// Check returns an error naming every count that rose from each sample to the next. Counts
+// that grow and then level off, like caches filling, pass. It needs at least 3 samples.
+func (t *LeakTracker) Check() error {
+	if len(t.samples) < 3 {
+		return errors.New("leak check needs at least 3 samples")
+	}
+
+	var leaks []string
+	first := t.samples[0].fields()
+	last := t.samples[len(t.samples)-1].fields()
+	for i := range first {
+		growing := true
+		for s := 1; s < len(t.samples) && growing; s++ {
+			growing = t.samples[s].fields()[i].count > t.samples[s-1].fields()[i].count
+		}
+		if growing {
+			leaks = append(leaks, fmt.Sprintf("%s %d -> %d", first[i].name, first[i].count, last[i].count))
+		}
+	}
+
+	if len(leaks) > 0 {
+		return fmt.Errorf("counts grew every cycle over %d cycles: %s", len(t.samples)-1, strings.Join(leaks, ", "))
+	}
+	return nil
+}
+
+// RunLeakCheck runs cycle the given number of times plus one warm-up run, sampling the
+// native object counts after each, and errors if any count grew every time. A Go test can
+// spawn and destroy something in cycle to catch leaks in it:
+//
+//	err := engine.RunLeakCheck(10, func(i int) error {
+//		entity, err := world.NewEntity()
+//		if err != nil {
+//			return err
+//		}
+//		entity.Destroy()
+//		return nil
+//	})
+func (e *Engine) RunLeakCheck(cycles int, cycle func(i int) error) error {
+	if cycles < 2 {
+		return errors.New("leak check needs at least 2 cycles")
+	}
+
+	// The warm-up fills caches and registers components before the first sample
+	if err := cycle(0); err != nil {
+		return err
+	}
+	tracker := e.NewLeakTracker()
+	if err := tracker.Sample(); err != nil {
+		return err
+	}
+	for i := 1; i <= cycles; i++ {
+		if err := cycle(i); err != nil {
+			return err
+		}
+		if err := tracker.Sample(); err != nil {
+			return err
+		}
+	}
+	return tracker.Check()
+}
@@ -0,0 +1,183 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"strings"
+	"unsafe"
+)
+
+// Query layers. Entities are in LayerDefault until SetLayers is called.
+const (
+	LayerDefault uint32 = 1
+	LayerAll     uint32 = 0xFFFFFFFF
+)
+
+// SetSpatialCellSize sets the cell size of the grid behind spatial queries. Cells around
+// the size of typical query radii work best (default 8).
+func (w *World) SetSpatialCellSize(size float32) error {
+	if !w.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_set_spatial_cell_size(C.float(size)); ret != 0 {
+		return errors.New("spatial cell size must be positive")
+	}
+
+	return nil
+}
+
+// OverlapSphere returns the entities whose position is within radius of center and that
+// are in any of the layers in layerMask
+func (w *World) OverlapSphere(center Vector3, radius float32, layerMask uint32) []EntityID {
+	if !w.ready() {
+		return nil
+	}
+
+	return collectEntities(func(out *C.EntityID, capacity C.uint32_t) C.int {
+		return C.boulder_overlap_sphere(C.float(center.X), C.float(center.Y), C.float(center.Z),
+			C.float(radius), C.uint32_t(layerMask), out, capacity)
+	})
+}
+
+// OverlapBox returns the entities whose position is inside a box with the given half
+// extents and euler rotation, and that are in any of the layers in layerMask
+func (w *World) OverlapBox(center, halfExtents, rotation Vector3, layerMask uint32) []EntityID {
+	if !w.ready() {
+		return nil
+	}
+
+	return collectEntities(func(out *C.EntityID, capacity C.uint32_t) C.int {
+		return C.boulder_overlap_box(C.float(center.X), C.float(center.Y), C.float(center.Z),
+			C.float(halfExtents.X), C.float(halfExtents.Y), C.float(halfExtents.Z),
+			C.float(rotation.X), C.float(rotation.Y), C.float(rotation.Z),
+			C.uint32_t(layerMask), out, capacity)
+	})
+}
+
+// FindNearest returns the closest entity with tag within maxDistance of position. An empty
+// tag matches any entity and maxDistance <= 0 has no limit.
+func (w *World) FindNearest(position Vector3, tag string, maxDistance float32) (EntityID, bool) {
+	if !w.ready() {
+		return 0, false
+	}
+
+	cTag := C.CString(tag)
+	defer C.free(unsafe.Pointer(cTag))
+
+	var entity C.EntityID
+	if ret := C.boulder_find_nearest(C.float(position.X), C.float(position.Y), C.float(position.Z),
+		cTag, C.float(maxDistance), &entity); ret != 0 {
+		return 0, false
+	}
+
+	return EntityID(entity), true
+}
+
+// SetLayers sets the query layers the entity is in, as a bit mask
+func (e *Entity) SetLayers(layers uint32) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_set_layers(C.EntityID(e.ID), C.uint32_t(layers)); ret != 0 {
+		return lastError("failed to set layers")
+	}
+
+	return nil
+}
+
+// GetLayers returns the query layers the entity is in
+func (e *Entity) GetLayers() uint32 {
+	if !e.world.ready() {
+		return 0
+	}
+	return uint32(C.boulder_get_layers(C.EntityID(e.ID)))
+}
+
+// AddTag tags the entity for FindNearest
+func (e *Entity) AddTag(tag string) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	cTag := C.CString(tag)
+	defer C.free(unsafe.Pointer(cTag))
+
+	if ret := C.boulder_add_tag(C.EntityID(e.ID), cTag); ret != 0 {
+		return lastError("failed to add tag")
+	}
+
+	return nil
+}
+
+// RemoveTag removes a tag from the entity
+func (e *Entity) RemoveTag(tag string) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	cTag := C.CString(tag)
+	defer C.free(unsafe.Pointer(cTag))
+
+	if ret := C.boulder_remove_tag(C.EntityID(e.ID), cTag); ret != 0 {
+		return lastError("failed to remove tag")
+	}
+
+	return nil
+}
+
+// GetTags returns the entity's tags
+func (e *Entity) GetTags() []string {
+	if !e.world.ready() {
+		return nil
+	}
+
+	length := C.boulder_get_tags(C.EntityID(e.ID), nil, 0)
+	if length == 0 {
+		return nil
+	}
+	buf := make([]C.char, length+1)
+	C.boulder_get_tags(C.EntityID(e.ID), &buf[0], C.uint32_t(len(buf)))
+	return strings.Split(C.GoString(&buf[0]), "\n")
+}
+
+// HasTag returns true if the entity has the tag
+func (e *Entity) HasTag(tag string) bool {
+	if !e.world.ready() {
+		return false
+	}
+
+	cTag := C.CString(tag)
+	defer C.free(unsafe.Pointer(cTag))
+
+	return C.boulder_has_tag(C.EntityID(e.ID), cTag) != 0
+}
+
+// collectEntities runs a native query that fills a buffer and returns the match count,
+// retrying with a bigger buffer when there are more matches than fit
+func collectEntities(query func(out *C.EntityID, capacity C.uint32_t) C.int) []EntityID {
+	buf := make([]C.EntityID, 64)
+	for {
+		count := int(query(&buf[0], C.uint32_t(len(buf))))
+		if count <= 0 {
+			return nil
+		}
+		if count > len(buf) {
+			buf = make([]C.EntityID, count)
+			continue
+		}
+
+		entities := make([]EntityID, count)
+		for i := range entities {
+			entities[i] = EntityID(buf[i])
+		}
+		return entities
+	}
+}
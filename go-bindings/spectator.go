@@ -0,0 +1,225 @@
+package boulder
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	NetworkEventSpectatorJoined NetworkEventType = 13
+	NetworkEventSpectateResult  NetworkEventType = 14
+)
+
+// SpectatePolicy is a server's rules for observer connections
+type SpectatePolicy struct {
+	Allow         bool // Whether the server takes spectators at all; requests are refused without it
+	MaxSpectators int  // 0 is no limit
+	// Verify decides each request from the token the client sent with Spectate, e.g. to let
+	// only tournament staff watch. nil lets anyone spectate while Allow is set.
+	Verify func(conn ConnectionHandle, token string) bool
+}
+
+// SpectatorJoinedEvent is returned on a server when it accepts a connection as a spectator.
+// Replication carries on to it as to any client; its messages are dropped from then on.
+type SpectatorJoinedEvent struct {
+	Connection ConnectionHandle
+	Token      string
+}
+
+func (e SpectatorJoinedEvent) Type() NetworkEventType { return NetworkEventSpectatorJoined }
+
+// SpectateResultEvent is returned on a client when a server answers its Spectate request.
+// A refused request is followed by the server closing the connection.
+type SpectateResultEvent struct {
+	Connection ConnectionHandle
+	Accepted   bool
+	Reason     string // Why the request was refused
+}
+
+func (e SpectateResultEvent) Type() NetworkEventType { return NetworkEventSpectateResult }
+
+// spectatorState is a server's spectators and spectate policy, and a client's requests to
+// spectate
+type spectatorState struct {
+	// Server side
+	policy     SpectatePolicy
+	spectators map[ConnectionHandle]bool
+	dropped    uint64
+	events     []NetworkEvent
+
+	// Client side
+	requested  bool
+	token      string
+	spectating map[ConnectionHandle]bool // Servers that accepted the request
+}
+
+func (ns *NetworkSession) ensureSpectators() *spectatorState {
+	if ns.spectators == nil {
+		ns.spectators = &spectatorState{
+			spectators: make(map[ConnectionHandle]bool),
+			spectating: make(map[ConnectionHandle]bool),
+		}
+		ns.addConnectionObserver(ns.observeSpectatorConnection)
+	}
+	return ns.spectators
+}
+
+// SetSpectatePolicy sets whether and by whom a server can be watched. Spectators already
+// accepted stay; Disconnect them to remove them.
+func (ns *NetworkSession) SetSpectatePolicy(policy SpectatePolicy) error {
+	if ns.handle == nil {
+		return errSessionNotInitialized
+	}
+	if policy.MaxSpectators < 0 {
+		return errors.New("spectator limit can't be negative")
+	}
+
+	ss := ns.ensureSpectators()
+	ss.policy = policy
+	ns.setControlHandler(controlSpectate, ns.handleSpectate)
+	return nil
+}
+
+// Spectate asks the servers the client is connected to, and any it connects to later, to
+// take it as an observer: it receives replication but sends no inputs. token goes to the
+// server's SpectatePolicy.Verify. Answers arrive as SpectateResultEvents.
+func (ns *NetworkSession) Spectate(token string) error {
+	if ns.handle == nil {
+		return errSessionNotInitialized
+	}
+
+	ss := ns.ensureSpectators()
+	ss.requested = true
+	ss.token = token
+	ns.setControlHandler(controlSpectateResult, ns.handleSpectateResult)
+	for _, conn := range ns.openConnections() {
+		ns.sendSpectate(conn)
+	}
+	return nil
+}
+
+// IsSpectating returns whether the server on a connection accepted the client as a spectator
+func (ns *NetworkSession) IsSpectating(conn ConnectionHandle) bool {
+	return ns.spectators != nil && ns.spectators.spectating[conn]
+}
+
+// IsSpectator returns whether a server took a connection as a spectator
+func (ns *NetworkSession) IsSpectator(conn ConnectionHandle) bool {
+	return ns.spectators != nil && ns.spectators.spectators[conn]
+}
+
+// GetSpectators returns the connections a server took as spectators
+func (ns *NetworkSession) GetSpectators() []ConnectionHandle {
+	if ns.spectators == nil {
+		return nil
+	}
+	conns := make([]ConnectionHandle, 0, len(ns.spectators.spectators))
+	for conn := range ns.spectators.spectators {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// GetDroppedSpectatorMessages returns how many messages spectators sent that were dropped
+func (ns *NetworkSession) GetDroppedSpectatorMessages() uint64 {
+	if ns.spectators == nil {
+		return 0
+	}
+	return ns.spectators.dropped
+}
+
+// sendSpectate asks the server on a connection to take the client as a spectator
+func (ns *NetworkSession) sendSpectate(conn ConnectionHandle) {
+	if err := ns.sendControl(conn, controlSpectate, []byte(ns.spectators.token), true); err != nil {
+		LogError(fmt.Sprintf("Failed to send spectate request on connection %d: %v", conn, err))
+	}
+}
+
+// observeSpectatorConnection repeats the client's request on new connections and forgets
+// connections that close
+func (ns *NetworkSession) observeSpectatorConnection(event NetworkEvent) {
+	ss := ns.spectators
+	switch e := event.(type) {
+	case ConnectedEvent:
+		if ss.requested {
+			ns.sendSpectate(e.Connection)
+		}
+	case DisconnectedEvent:
+		delete(ss.spectators, e.Connection)
+		delete(ss.spectating, e.Connection)
+	}
+}
+
+// handleSpectate decides a client's request to spectate
+func (ns *NetworkSession) handleSpectate(conn ConnectionHandle, payload []byte, timestamp float64) {
+	ss := ns.spectators
+	if ss == nil || ss.spectators[conn] {
+		return
+	}
+
+	token := string(payload)
+	reason := ""
+	switch {
+	case !ss.policy.Allow:
+		reason = "Spectating is not allowed"
+	case ss.policy.MaxSpectators > 0 && len(ss.spectators) >= ss.policy.MaxSpectators:
+		reason = "No spectator slots left"
+	case ss.policy.Verify != nil && !ss.policy.Verify(conn, token):
+		reason = "Spectate request rejected"
+	}
+
+	if reason != "" {
+		LogInfo(fmt.Sprintf("Refused spectator on connection %d: %s", conn, reason))
+		ns.sendControl(conn, controlSpectateResult, append([]byte{0}, reason...), true)
+		ns.closeWithReason(conn, reason)
+		ns.notifyConnectionObservers(DisconnectedEvent{Connection: conn})
+		ss.events = append(ss.events, DisconnectedEvent{Connection: conn})
+		return
+	}
+
+	ss.spectators[conn] = true
+	ns.sendControl(conn, controlSpectateResult, []byte{1}, true)
+	ss.events = append(ss.events, SpectatorJoinedEvent{Connection: conn, Token: token})
+}
+
+// handleSpectateResult records a server's answer to the client's request
+func (ns *NetworkSession) handleSpectateResult(conn ConnectionHandle, payload []byte, timestamp float64) {
+	ss := ns.spectators
+	if ss == nil || len(payload) == 0 {
+		return
+	}
+
+	accepted := payload[0] == 1
+	if accepted {
+		ss.spectating[conn] = true
+	}
+	ss.events = append(ss.events, SpectateResultEvent{Connection: conn, Accepted: accepted, Reason: string(payload[1:])})
+}
+
+// dropSpectatorInput reports whether a message from a connection is input from a spectator,
+// which the server drops: game messages and rollback inputs. The engine's own traffic, such
+// as clock sync and replication acks, still gets through.
+func (ns *NetworkSession) dropSpectatorInput(conn ConnectionHandle, data []byte) bool {
+	ss := ns.spectators
+	if ss == nil || !ss.spectators[conn] {
+		return false
+	}
+	if isControlMessage(data) {
+		if kind, _ := decodeControl(data); kind != controlSequenced && kind != controlRollbackInput {
+			return false
+		}
+	}
+	ss.dropped++
+	return true
+}
+
+// takeSpectatorEvent returns the oldest spectator event not yet polled
+func (ns *NetworkSession) takeSpectatorEvent() NetworkEvent {
+	ss := ns.spectators
+	if ss == nil || len(ss.events) == 0 {
+		return nil
+	}
+	event := ss.events[0]
+	ss.events = ss.events[1:]
+	return event
+}
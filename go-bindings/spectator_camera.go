@@ -0,0 +1,271 @@
+package boulder
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// SpectateMode is how a SpectatorCamera moves
+type SpectateMode int
+
+const (
+	SpectateFreeFly SpectateMode = 0 // Flown with WASD, Q and E for down and up, shift for speed, right mouse button to look
+	SpectateFollow  SpectateMode = 1 // Behind the current target, looking at it
+	SpectateCycle   SpectateMode = 2 // Follows each target in turn, moving on every CycleInterval
+)
+
+// SpectatorCameraConfig tunes a SpectatorCamera
+type SpectatorCameraConfig struct {
+	FlySpeed       float32       // Units per second in free-fly; 0 is 10
+	LookSpeed      float32       // Radians per pixel of mouse movement; 0 is 0.005
+	FollowDistance float32       // How far behind the target; 0 is 6
+	FollowHeight   float32       // How far above the target; 0 is 2
+	Smoothing      float32       // How quickly the camera catches up with its target, per second; 0 is 8
+	CycleInterval  time.Duration // How long each target is watched in SpectateCycle; 0 is 10s
+}
+
+// DefaultSpectatorCameraConfig returns the settings zero values stand for
+func DefaultSpectatorCameraConfig() SpectatorCameraConfig {
+	return SpectatorCameraConfig{
+		FlySpeed:       10,
+		LookSpeed:      0.005,
+		FollowDistance: 6,
+		FollowHeight:   2,
+		Smoothing:      8,
+		CycleInterval:  10 * time.Second,
+	}
+}
+
+func (c SpectatorCameraConfig) withDefaults() SpectatorCameraConfig {
+	defaults := DefaultSpectatorCameraConfig()
+	if c.FlySpeed <= 0 {
+		c.FlySpeed = defaults.FlySpeed
+	}
+	if c.LookSpeed <= 0 {
+		c.LookSpeed = defaults.LookSpeed
+	}
+	if c.FollowDistance <= 0 {
+		c.FollowDistance = defaults.FollowDistance
+	}
+	if c.FollowHeight == 0 {
+		c.FollowHeight = defaults.FollowHeight
+	}
+	if c.Smoothing <= 0 {
+		c.Smoothing = defaults.Smoothing
+	}
+	if c.CycleInterval <= 0 {
+		c.CycleInterval = defaults.CycleInterval
+	}
+	return c
+}
+
+// SpectatorCamera moves a Camera for someone watching a game: flying freely, following a
+// player, or cycling through the players on its own. Targets are local entities, e.g. the
+// proxies a ReplicationClient spawned for the players.
+type SpectatorCamera struct {
+	camera  *Camera
+	world   *World
+	config  SpectatorCameraConfig
+	mode    SpectateMode
+	targets []EntityID
+	target  int
+	watched time.Duration // Time on the current target in SpectateCycle
+	jumping bool          // Place the camera behind the target at once on the next Update
+
+	yaw, pitch float32
+	mouseX     float32
+	mouseY     float32
+	looking    bool
+}
+
+// NewSpectatorCamera returns a spectator camera driving camera, in free-fly from where the
+// camera is
+func NewSpectatorCamera(camera *Camera, world *World, config SpectatorCameraConfig) *SpectatorCamera {
+	sc := &SpectatorCamera{camera: camera, world: world, config: config.withDefaults()}
+	sc.lookFromCamera()
+	return sc
+}
+
+// GetCamera returns the camera being moved
+func (sc *SpectatorCamera) GetCamera() *Camera {
+	return sc.camera
+}
+
+// SetMode switches how the camera moves. Free-fly starts from wherever the camera is.
+func (sc *SpectatorCamera) SetMode(mode SpectateMode) {
+	if mode == SpectateFreeFly && sc.mode != SpectateFreeFly {
+		sc.lookFromCamera()
+	}
+	sc.mode = mode
+	sc.watched = 0
+}
+
+// GetMode returns how the camera moves
+func (sc *SpectatorCamera) GetMode() SpectateMode {
+	return sc.mode
+}
+
+// SetTargets sets the entities that can be followed, keeping the current target if it is
+// still among them
+func (sc *SpectatorCamera) SetTargets(targets []EntityID) {
+	current, ok := sc.GetTarget()
+	sc.targets = slices.Clone(targets)
+	sc.target = 0
+	if ok {
+		if i := slices.Index(sc.targets, current); i >= 0 {
+			sc.target = i
+		}
+	}
+}
+
+// GetTarget returns the entity being followed
+func (sc *SpectatorCamera) GetTarget() (EntityID, bool) {
+	if len(sc.targets) == 0 {
+		return 0, false
+	}
+	return sc.targets[sc.target], true
+}
+
+// SetTarget follows an entity among the targets
+func (sc *SpectatorCamera) SetTarget(entity EntityID) bool {
+	i := slices.Index(sc.targets, entity)
+	if i < 0 {
+		return false
+	}
+	sc.target = i
+	sc.watched = 0
+	return true
+}
+
+// NextTarget follows the next target, wrapping around
+func (sc *SpectatorCamera) NextTarget() {
+	sc.step(1)
+}
+
+// PreviousTarget follows the previous target, wrapping around
+func (sc *SpectatorCamera) PreviousTarget() {
+	sc.step(-1)
+}
+
+func (sc *SpectatorCamera) step(delta int) {
+	if len(sc.targets) == 0 {
+		return
+	}
+	sc.target = (sc.target + delta + len(sc.targets)) % len(sc.targets)
+	sc.watched = 0
+}
+
+// Update moves the camera for a frame. Input is only read in free-fly and may be nil
+// otherwise.
+func (sc *SpectatorCamera) Update(input *Input, deltaTime float32) error {
+	if sc.mode == SpectateFreeFly {
+		return sc.fly(input, deltaTime)
+	}
+
+	if sc.mode == SpectateCycle {
+		sc.watched += time.Duration(float64(deltaTime) * float64(time.Second))
+		if sc.watched >= sc.config.CycleInterval {
+			sc.NextTarget()
+		}
+	}
+
+	// Skip targets that are gone, e.g. a player who left
+	for range sc.targets {
+		target, _ := sc.GetTarget()
+		entity := &Entity{ID: target, world: sc.world}
+		position, rotation, _, err := entity.GetFullTransform()
+		if err == nil {
+			return sc.follow(position, rotation.Y, deltaTime)
+		}
+		sc.step(1)
+	}
+	return nil
+}
+
+// follow eases the camera towards its place behind a target facing yaw
+func (sc *SpectatorCamera) follow(position Vector3, yaw, deltaTime float32) error {
+	sin, cos := math.Sincos(float64(yaw))
+	// Entities face -Z, so behind is +Z rotated by their yaw
+	desired := Vector3{
+		X: position.X + float32(sin)*sc.config.FollowDistance,
+		Y: position.Y + sc.config.FollowHeight,
+		Z: position.Z + float32(cos)*sc.config.FollowDistance,
+	}
+
+	t := 1 - float32(math.Exp(float64(-sc.config.Smoothing*deltaTime)))
+	if sc.jumping {
+		t = 1
+		sc.jumping = false
+	}
+	eye := lerpVector(sc.camera.position, desired, t)
+	if eye == position {
+		return nil
+	}
+	sc.camera.position = eye
+	sc.camera.target = position
+	return sc.camera.apply()
+}
+
+// fly moves the camera from keyboard and mouse input
+func (sc *SpectatorCamera) fly(input *Input, deltaTime float32) error {
+	if input == nil {
+		return nil
+	}
+
+	x, y := input.GetMousePosition()
+	if input.IsMouseButtonPressed(MouseButtonRight) {
+		if sc.looking {
+			sc.yaw -= (x - sc.mouseX) * sc.config.LookSpeed
+			sc.pitch -= (y - sc.mouseY) * sc.config.LookSpeed
+			sc.pitch = max(-1.55, min(1.55, sc.pitch))
+		}
+		sc.looking = true
+	} else {
+		sc.looking = false
+	}
+	sc.mouseX, sc.mouseY = x, y
+
+	sinYaw, cosYaw := math.Sincos(float64(sc.yaw))
+	sinPitch, cosPitch := math.Sincos(float64(sc.pitch))
+	forward := Vector3{X: float32(-sinYaw * cosPitch), Y: float32(sinPitch), Z: float32(-cosYaw * cosPitch)}
+	right := Vector3{X: float32(cosYaw), Z: float32(-sinYaw)}
+
+	var move Vector3
+	axis := func(key int, direction Vector3, sign float32) {
+		if input.IsKeyPressed(key) {
+			move = Vector3{X: move.X + direction.X*sign, Y: move.Y + direction.Y*sign, Z: move.Z + direction.Z*sign}
+		}
+	}
+	axis(KeyW, forward, 1)
+	axis(KeyS, forward, -1)
+	axis(KeyD, right, 1)
+	axis(KeyA, right, -1)
+	axis(KeyE, Vector3{Y: 1}, 1)
+	axis(KeyQ, Vector3{Y: 1}, -1)
+
+	speed := sc.config.FlySpeed * deltaTime
+	if input.IsKeyPressed(KeyLShift) {
+		speed *= 4
+	}
+	move = normalizeVector(move)
+	position := sc.camera.position
+	position = Vector3{X: position.X + move.X*speed, Y: position.Y + move.Y*speed, Z: position.Z + move.Z*speed}
+
+	sc.camera.position = position
+	sc.camera.target = Vector3{X: position.X + forward.X, Y: position.Y + forward.Y, Z: position.Z + forward.Z}
+	return sc.camera.apply()
+}
+
+// jump makes the next follow place the camera without easing, e.g. at the start of a replay
+func (sc *SpectatorCamera) jump() {
+	sc.jumping = true
+}
+
+// lookFromCamera points free-fly the way the camera faces
+func (sc *SpectatorCamera) lookFromCamera() {
+	forward := sc.camera.GetForward()
+	sc.yaw = float32(math.Atan2(float64(-forward.X), float64(-forward.Z)))
+	sc.pitch = float32(math.Asin(float64(max(-1, min(1, forward.Y)))))
+	sc.looking = false
+}
@@ -0,0 +1,14 @@
+//go:build darwin && !ios
+
+package boulder
+
+import "os/exec"
+
+// newPlatformVoice speaks with say, in the system voice chosen in Spoken Content settings
+func newPlatformVoice() SpeechBackend {
+	path, err := exec.LookPath("say")
+	if err != nil {
+		return nil
+	}
+	return &commandVoice{path: path, args: []string{"-f", "-"}}
+}
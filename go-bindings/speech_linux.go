@@ -0,0 +1,19 @@
+//go:build linux && !android
+
+package boulder
+
+import "os/exec"
+
+// newPlatformVoice speaks through Speech Dispatcher, which uses the voice and rate the
+// player set up for their screen reader (Orca), or eSpeak NG where it is not installed
+func newPlatformVoice() SpeechBackend {
+	if path, err := exec.LookPath("spd-say"); err == nil {
+		return &commandVoice{path: path, args: []string{"--wait", "--pipe-mode"}, stopArgs: []string{"--cancel"}}
+	}
+	for _, name := range []string{"espeak-ng", "espeak"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return &commandVoice{path: path, args: []string{"--stdin"}}
+		}
+	}
+	return nil
+}
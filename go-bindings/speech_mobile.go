@@ -0,0 +1,10 @@
+//go:build android || ios
+
+package boulder
+
+// newPlatformVoice returns nil: Android's TextToSpeech and iOS's AVSpeechSynthesizer are
+// reached through Java and Objective-C, so apps pass a SpeechBackend that calls them (or
+// TalkBack and VoiceOver announcements) to Accessibility.SetBackend
+func newPlatformVoice() SpeechBackend {
+	return nil
+}
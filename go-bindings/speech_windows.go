@@ -0,0 +1,18 @@
+//go:build windows
+
+package boulder
+
+import "os/exec"
+
+// speakScript reads the text from standard input and says it with the default SAPI voice
+const speakScript = "Add-Type -AssemblyName System.Speech; " +
+	"(New-Object System.Speech.Synthesis.SpeechSynthesizer).Speak([Console]::In.ReadToEnd())"
+
+// newPlatformVoice speaks through System.Speech, the voice set in Windows speech settings
+func newPlatformVoice() SpeechBackend {
+	path, err := exec.LookPath("powershell")
+	if err != nil {
+		return nil
+	}
+	return &commandVoice{path: path, args: []string{"-NoProfile", "-NonInteractive", "-Command", speakScript}}
+}
@@ -0,0 +1,373 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"image"
+	"os"
+	"slices"
+	"time"
+)
+
+// SplashVideo supplies the frames of a boot video. The engine has no video decoder, so
+// wrap one (or frames decoded ahead of time, see NewSplashFrames) in this interface.
+type SplashVideo interface {
+	// Frame returns the frame to show once elapsed has passed since the video started, or
+	// nil to keep the previous one, and false once the video has ended
+	Frame(elapsed time.Duration) (frame image.Image, playing bool)
+}
+
+// SplashItem is an image or a video shown by RunSplash
+type SplashItem struct {
+	Image    image.Image   // Shown for Duration
+	Path     string        // PNG or JPEG loaded instead when Image is nil
+	Video    SplashVideo   // Played to its end instead of an image
+	Duration time.Duration // How long an image shows, fades included
+	Fit      BackdropFit
+}
+
+// SplashConfig sets up the screens RunSplash shows before the main loop
+type SplashConfig struct {
+	Window     *Window
+	Renderer   *Renderer
+	Input      *Input // Read for SkipKeys; nil makes the splash unskippable
+	Items      []SplashItem
+	Background UIColor                 // Around images that don't fill the screen, and faded through
+	FadeTime   time.Duration           // Fade in and out of each item
+	SkipKeys   []int                   // Scancodes that skip the remaining items
+	Assets     *Assets                 // Updated each frame so queued models stream in behind the splash
+	OnFrame    func(deltaTime float32) // Called each frame on the main thread
+}
+
+// DefaultSplashConfig returns a config with black fades that Escape, Space or Enter skip
+func DefaultSplashConfig(window *Window, renderer *Renderer, input *Input) SplashConfig {
+	return SplashConfig{
+		Window:     window,
+		Renderer:   renderer,
+		Input:      input,
+		Background: UIColor{0.0, 0.0, 0.0, 1.0},
+		FadeTime:   400 * time.Millisecond,
+		SkipKeys:   []int{KeyEscape, KeySpace, KeyReturn},
+	}
+}
+
+// RunSplash shows the splash items one after the other until they have all played (or
+// been skipped) and warmUp has returned, then returns warmUp's error. Call it after the
+// window is created and before the main loop. warmUp runs on its own goroutine and must not
+// call into the engine, which isn't thread safe: have it read, decode and build what it
+// can, and upload the results afterwards, through config.Assets or in OnFrame. If warm-up
+// outlasts the items the last one stays on screen. Closing the window stops the splash with
+// an error.
+func RunSplash(config SplashConfig, warmUp func() error) error {
+	if config.Window == nil || config.Renderer == nil {
+		return errors.New("splash needs a window and a renderer")
+	}
+	if !config.Renderer.engine.initialized {
+		return errNotInitialized
+	}
+
+	warmed := make(chan error, 1)
+	if warmUp != nil {
+		go func() {
+			err := errors.New("splash warm-up panicked")
+			runCallback("RunSplash", func() { err = warmUp() })
+			warmed <- err
+		}()
+	} else {
+		warmed <- nil
+	}
+
+	s := &splash{config: config, index: -1}
+	s.showFade()
+	defer s.finish()
+
+	var warmUpErr error
+	warming := true
+	last := time.Now()
+	for {
+		config.Window.PollEvents()
+		if config.Window.ShouldClose() {
+			return errors.New("window closed during splash")
+		}
+
+		now := time.Now()
+		deltaTime := now.Sub(last)
+		last = now
+
+		if warming {
+			select {
+			case warmUpErr = <-warmed:
+				warming = false
+			default:
+			}
+		}
+		if config.Assets != nil {
+			config.Assets.Update()
+		}
+		if config.OnFrame != nil {
+			runCallback("OnFrame", func() { config.OnFrame(float32(deltaTime.Seconds())) })
+		}
+		loading := warming || (config.Assets != nil && config.Assets.Pending() > 0)
+
+		if s.skipPressed() {
+			s.skip()
+		}
+		if !s.advance(deltaTime, loading) {
+			return warmUpErr
+		}
+		s.present()
+	}
+}
+
+// splash is the state of RunSplash
+type splash struct {
+	config  SplashConfig
+	index   int           // Item showing, -1 before the first
+	elapsed time.Duration // Since the item started
+	ended   bool          // The item has played and is fading out
+	fadeOut time.Duration // Into the fade out
+	skipped bool          // Items after the current one are dropped
+	keyDown bool          // A skip key was down last frame
+	fade    *UIProgressBar
+
+	restoreClear [4]float32 // Clear color before the splash
+}
+
+// advance moves the splash on by deltaTime and updates the backdrop and fade. It returns
+// false once the last item has faded out.
+func (s *splash) advance(deltaTime time.Duration, loading bool) bool {
+	if s.index < 0 && !s.next() {
+		// Nothing to show: wait for the warm-up on the background color
+		s.setFade(1)
+		return loading
+	}
+
+	s.elapsed += deltaTime
+	item := s.config.Items[s.index]
+	if !s.ended {
+		s.ended = s.playItem(item)
+	}
+
+	// The last item stays up while loading goes on
+	lastItem := s.skipped || s.index == len(s.config.Items)-1
+	if s.ended && lastItem && loading {
+		s.fadeOut = 0
+		s.setFade(s.fadeIn())
+		return true
+	}
+
+	if s.ended {
+		s.fadeOut += deltaTime
+		if s.fadeOut >= s.config.FadeTime {
+			if lastItem || !s.next() {
+				return false
+			}
+			return true
+		}
+		s.setFade(min(s.fadeIn(), 1-fraction(s.fadeOut, s.config.FadeTime)))
+		return true
+	}
+
+	s.setFade(s.fadeIn())
+	return true
+}
+
+// playItem updates the backdrop for the item and returns whether it has finished playing
+func (s *splash) playItem(item SplashItem) bool {
+	if item.Video != nil {
+		frame, playing := item.Video.Frame(s.elapsed)
+		if frame != nil {
+			if err := s.config.Renderer.SetBackdrop(frame, item.Fit); err != nil {
+				LogError("Failed to show splash video frame: " + err.Error())
+			}
+		}
+		return !playing
+	}
+	// Images fade out within their duration
+	return s.elapsed >= item.Duration-s.config.FadeTime
+}
+
+// next starts the following item, skipping ones that fail to load. It returns false when
+// there are none left.
+func (s *splash) next() bool {
+	for s.index+1 < len(s.config.Items) {
+		s.index++
+		s.elapsed = 0
+		s.ended = false
+		s.fadeOut = 0
+
+		item := s.config.Items[s.index]
+		if item.Video != nil {
+			return true
+		}
+		img := item.Image
+		if img == nil {
+			var err error
+			if img, err = loadSplashImage(item.Path, ""); err != nil {
+				LogError("Failed to load splash image " + item.Path + ": " + err.Error())
+				continue
+			}
+		}
+		if err := s.config.Renderer.SetBackdrop(img, item.Fit); err != nil {
+			LogError("Failed to show splash image: " + err.Error())
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// skip drops the items after the current one and fades it out
+func (s *splash) skip() {
+	if s.index < 0 || s.skipped {
+		return
+	}
+	s.skipped = true
+	if !s.ended {
+		s.ended = true
+		// Fade out from however far the fade in got
+		s.fadeOut = time.Duration(float64(s.config.FadeTime) * float64(1-s.fadeIn()))
+	}
+}
+
+// skipPressed returns whether a skip key went down this frame
+func (s *splash) skipPressed() bool {
+	if s.config.Input == nil {
+		return false
+	}
+	down := slices.ContainsFunc(s.config.SkipKeys, s.config.Input.IsKeyPressed)
+	pressed := down && !s.keyDown
+	s.keyDown = down
+	return pressed
+}
+
+// fadeIn returns how visible the current item is from its fade in, 0 to 1
+func (s *splash) fadeIn() float32 {
+	return fraction(s.elapsed, s.config.FadeTime)
+}
+
+// showFade covers the screen with the background, which fades away to reveal each item.
+// Without the UI items cut in and out instead.
+func (s *splash) showFade() {
+	s.fade = CreateUIProgressBar(0, 0, 0, 0)
+	if s.fade != nil {
+		bg := s.config.Background
+		s.fade.SetColors(bg, bg, bg)
+	}
+	r, g, b, a := s.config.Renderer.GetClearColor()
+	s.config.Renderer.SetClearColor(s.config.Background.R, s.config.Background.G, s.config.Background.B, 1)
+	s.restoreClear = [4]float32{r, g, b, a}
+}
+
+// setFade sets how visible the current item is, from 0 (the background) to 1
+func (s *splash) setFade(visible float32) {
+	if s.fade == nil {
+		return
+	}
+	width, height := s.config.Renderer.GetSwapchainExtent()
+	s.fade.SetBounds(0, 0, float32(width), float32(height))
+	s.fade.SetOpacity(1 - visible)
+}
+
+// present draws a frame of the backdrop and the fade
+func (s *splash) present() {
+	var imageIndex C.uint32_t
+	switch C.boulder_begin_frame(&imageIndex) {
+	case 0:
+	case -2:
+		if err := s.config.Renderer.RecreateSwapchain(); err != nil {
+			LogError("Failed to recreate swapchain: " + err.Error())
+		}
+		return
+	default:
+		// Paused in the background, or the device failed; don't spin
+		time.Sleep(10 * time.Millisecond)
+		return
+	}
+
+	C.boulder_ui_render(imageIndex)
+	C.boulder_end_frame(imageIndex)
+}
+
+// finish removes the splash so the main loop starts from a clean frame
+func (s *splash) finish() {
+	if s.fade != nil {
+		s.fade.Destroy()
+		s.fade = nil
+	}
+	s.config.Renderer.ClearBackdrop()
+	c := s.restoreClear
+	s.config.Renderer.SetClearColor(c[0], c[1], c[2], c[3])
+}
+
+// fraction returns elapsed / total clamped to 0..1, 1 when total is 0
+func fraction(elapsed, total time.Duration) float32 {
+	if total <= 0 || elapsed >= total {
+		return 1
+	}
+	if elapsed <= 0 {
+		return 0
+	}
+	return float32(elapsed) / float32(total)
+}
+
+// loadSplashImage decodes an image file, failing with ErrorFile or ErrorInvalidData like
+// the engine's own loaders
+func loadSplashImage(path, op string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, &Error{Code: ErrorFile, Op: op, Message: err.Error()}
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, &Error{Code: ErrorInvalidData, Op: op, Message: err.Error()}
+	}
+	return img, nil
+}
+
+// SplashFrames is a boot video of frames decoded ahead of time, played at a fixed rate
+type SplashFrames struct {
+	frames []image.Image
+	fps    float64
+	shown  int // Frame last returned, -1 before the first
+}
+
+// NewSplashFrames returns a video playing frames at fps frames per second
+func NewSplashFrames(frames []image.Image, fps float64) *SplashFrames {
+	if fps <= 0 {
+		fps = 30
+	}
+	return &SplashFrames{frames: frames, fps: fps, shown: -1}
+}
+
+// LoadSplashFrames decodes PNG or JPEG files, in order, into a video playing at fps frames
+// per second
+func LoadSplashFrames(paths []string, fps float64) (*SplashFrames, error) {
+	frames := make([]image.Image, 0, len(paths))
+	for _, path := range paths {
+		img, err := loadSplashImage(path, "failed to load splash frame "+path)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, img)
+	}
+	return NewSplashFrames(frames, fps), nil
+}
+
+// Frame implements SplashVideo, dropping frames when presenting falls behind
+func (v *SplashFrames) Frame(elapsed time.Duration) (image.Image, bool) {
+	index := int(elapsed.Seconds() * v.fps)
+	if index >= len(v.frames) {
+		return nil, false
+	}
+	if index == v.shown {
+		return nil, true
+	}
+	v.shown = index
+	return v.frames[index], true
+}
@@ -0,0 +1,470 @@
+package boulder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/jpeg" // Register decoders for CookTexture
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultTextureCacheDir is where Assets.CookTexture stores cooked textures by default
+const DefaultTextureCacheDir = ".boulder/cache/textures"
+
+// TextureFormat is the GPU format a texture is cooked to
+type TextureFormat int
+
+const (
+	TextureFormatRGBA8 TextureFormat = 0 // Uncompressed
+	TextureFormatBC1   TextureFormat = 1 // RGB, 4 bits per pixel
+	TextureFormatBC3   TextureFormat = 2 // RGBA, 8 bits per pixel
+	TextureFormatBC4   TextureFormat = 3 // Single channel (red), 4 bits per pixel
+	TextureFormatBC5   TextureFormat = 4 // Two channels (red, green), for normal maps
+	TextureFormatBC7   TextureFormat = 5 // High quality RGBA, 8 bits per pixel
+)
+
+// TextureCookSettings controls how CookTexture converts an image
+type TextureCookSettings struct {
+	Format       TextureFormat
+	GenerateMips bool
+	SRGB         bool   // Color data; mips are filtered in linear space (ignored by BC4/BC5)
+	CacheDir     string // Used by Assets.CookTexture; empty uses DefaultTextureCacheDir
+}
+
+// DefaultTextureCookSettings returns settings for color textures: BC7, sRGB, with mips
+func DefaultTextureCookSettings() TextureCookSettings {
+	return TextureCookSettings{
+		Format:       TextureFormatBC7,
+		GenerateMips: true,
+		SRGB:         true,
+	}
+}
+
+// NormalMapCookSettings returns settings for tangent space normal maps: BC5 with mips
+func NormalMapCookSettings() TextureCookSettings {
+	return TextureCookSettings{
+		Format:       TextureFormatBC5,
+		GenerateMips: true,
+	}
+}
+
+// ktx2Identifier starts every KTX2 file
+var ktx2Identifier = []byte{0xAB, 'K', 'T', 'X', ' ', '2', '0', 0xBB, '\r', '\n', 0x1A, '\n'}
+
+// CookTexture returns the path of a cooked KTX2 version of a PNG or JPG texture, cooking
+// it into the cache directory first if the source or settings changed. KTX2 files are
+// returned unchanged. This can run at load time or from an offline cook step.
+func (a *Assets) CookTexture(path string, settings TextureCookSettings) (string, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if bytes.HasPrefix(source, ktx2Identifier) {
+		return path, nil
+	}
+
+	cacheDir := settings.CacheDir
+	if cacheDir == "" {
+		cacheDir = DefaultTextureCacheDir
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	cooked := filepath.Join(cacheDir, name+"-"+textureCacheKey(source, settings)+".ktx2")
+	if _, err := os.Stat(cooked); err == nil {
+		return cooked, nil
+	}
+
+	data, err := cookTextureData(source, settings)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(cooked, data); err != nil {
+		return "", err
+	}
+
+	return cooked, nil
+}
+
+// CookTexture converts a PNG or JPG texture at src into a KTX2 file at dst
+func CookTexture(src, dst string, settings TextureCookSettings) error {
+	source, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(source, ktx2Identifier) {
+		return writeFileAtomic(dst, source)
+	}
+
+	data, err := cookTextureData(source, settings)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(dst, data)
+}
+
+// textureCacheKey identifies a source image cooked with particular settings
+func textureCacheKey(source []byte, settings TextureCookSettings) string {
+	h := sha256.New()
+	h.Write(source)
+	binary.Write(h, binary.LittleEndian, [3]int32{
+		int32(settings.Format), boolToInt32(settings.GenerateMips), boolToInt32(settings.SRGB),
+	})
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// cookTextureData decodes an image and encodes it as a KTX2 file
+func cookTextureData(source []byte, settings TextureCookSettings) ([]byte, error) {
+	decoded, _, err := image.Decode(bytes.NewReader(source))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := decoded.Bounds()
+	level := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(level, level.Bounds(), decoded, bounds.Min, draw.Src)
+
+	srgb := settings.SRGB && settings.Format != TextureFormatBC4 && settings.Format != TextureFormatBC5
+	levels := [][]byte{encodeTextureLevel(level, settings.Format)}
+	if settings.GenerateMips {
+		for level.Rect.Dx() > 1 || level.Rect.Dy() > 1 {
+			level = downsampleImage(level, srgb)
+			levels = append(levels, encodeTextureLevel(level, settings.Format))
+		}
+	}
+
+	return writeKTX2(settings.Format, srgb, bounds.Dx(), bounds.Dy(), levels)
+}
+
+// encodeTextureLevel block compresses one mip level
+func encodeTextureLevel(img *image.NRGBA, format TextureFormat) []byte {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	if format == TextureFormatRGBA8 {
+		data := make([]byte, 0, width*height*4)
+		for y := 0; y < height; y++ {
+			data = append(data, img.Pix[y*img.Stride:y*img.Stride+width*4]...)
+		}
+		return data
+	}
+
+	blocksX, blocksY := (width+3)/4, (height+3)/4
+	data := make([]byte, 0, blocksX*blocksY*textureBlockSize(format))
+	var block blockPixels
+	for by := 0; by < blocksY; by++ {
+		for bx := 0; bx < blocksX; bx++ {
+			// Edge blocks repeat the last row and column
+			for i := range block {
+				x := min(bx*4+i%4, width-1)
+				y := min(by*4+i/4, height-1)
+				copy(block[i][:], img.Pix[y*img.Stride+x*4:])
+			}
+
+			switch format {
+			case TextureFormatBC1:
+				data = encodeBC1Block(data, &block)
+			case TextureFormatBC3:
+				data = encodeBC3Block(data, &block)
+			case TextureFormatBC4:
+				data = encodeBC4Block(data, &block, 0)
+			case TextureFormatBC5:
+				data = encodeBC5Block(data, &block)
+			default:
+				data = encodeBC7Block(data, &block)
+			}
+		}
+	}
+	return data
+}
+
+// downsampleImage halves an image with a box filter, averaging color in linear space when
+// the image is sRGB
+func downsampleImage(img *image.NRGBA, srgb bool) *image.NRGBA {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	outWidth, outHeight := max(1, width/2), max(1, height/2)
+	out := image.NewNRGBA(image.Rect(0, 0, outWidth, outHeight))
+
+	for y := 0; y < outHeight; y++ {
+		for x := 0; x < outWidth; x++ {
+			var sum [4]float64
+			for dy := 0; dy < 2; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					sx, sy := min(x*2+dx, width-1), min(y*2+dy, height-1)
+					p := img.Pix[sy*img.Stride+sx*4:]
+					for c := 0; c < 4; c++ {
+						v := float64(p[c]) / 255
+						if srgb && c < 3 {
+							v = srgbToLinear(v)
+						}
+						sum[c] += v
+					}
+				}
+			}
+
+			o := out.Pix[y*out.Stride+x*4:]
+			for c := 0; c < 4; c++ {
+				v := sum[c] / 4
+				if srgb && c < 3 {
+					v = linearToSRGB(v)
+				}
+				o[c] = uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+			}
+		}
+	}
+	return out
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// textureBlockSize returns the bytes per 4x4 block, or per pixel for RGBA8
+func textureBlockSize(format TextureFormat) int {
+	switch format {
+	case TextureFormatRGBA8:
+		return 4
+	case TextureFormatBC1, TextureFormatBC4:
+		return 8
+	default:
+		return 16
+	}
+}
+
+// textureVkFormat returns the VkFormat value of a texture format
+func textureVkFormat(format TextureFormat, srgb bool) uint32 {
+	switch format {
+	case TextureFormatRGBA8:
+		if srgb {
+			return 43 // VK_FORMAT_R8G8B8A8_SRGB
+		}
+		return 37 // VK_FORMAT_R8G8B8A8_UNORM
+	case TextureFormatBC1:
+		if srgb {
+			return 132 // VK_FORMAT_BC1_RGB_SRGB_BLOCK
+		}
+		return 131 // VK_FORMAT_BC1_RGB_UNORM_BLOCK
+	case TextureFormatBC3:
+		if srgb {
+			return 138 // VK_FORMAT_BC3_SRGB_BLOCK
+		}
+		return 137 // VK_FORMAT_BC3_UNORM_BLOCK
+	case TextureFormatBC4:
+		return 139 // VK_FORMAT_BC4_UNORM_BLOCK
+	case TextureFormatBC5:
+		return 141 // VK_FORMAT_BC5_UNORM_BLOCK
+	default:
+		if srgb {
+			return 146 // VK_FORMAT_BC7_SRGB_BLOCK
+		}
+		return 145 // VK_FORMAT_BC7_UNORM_BLOCK
+	}
+}
+
+// ktx2Sample is one sample of a KTX2 basic data format descriptor
+type ktx2Sample struct {
+	bitOffset uint16
+	bitLength uint8 // Length minus one
+	channel   uint8
+	upper     uint32
+}
+
+// ktx2Descriptor returns the data format descriptor block for a texture format
+func ktx2Descriptor(format TextureFormat, srgb bool) []byte {
+	const alphaChannel, linearFlag = 15, 0x10
+
+	colorModel := uint8(1) // RGBSDA
+	blockDim := uint8(3)   // 4x4 blocks
+	var samples []ktx2Sample
+	switch format {
+	case TextureFormatRGBA8:
+		blockDim = 0
+		for i, channel := range []uint8{0, 1, 2, alphaChannel} {
+			samples = append(samples, ktx2Sample{bitOffset: uint16(8 * i), bitLength: 7, channel: channel, upper: 255})
+		}
+	case TextureFormatBC1:
+		colorModel = 128
+		samples = []ktx2Sample{{bitLength: 63, upper: math.MaxUint32}}
+	case TextureFormatBC3:
+		colorModel = 130
+		samples = []ktx2Sample{
+			{bitLength: 63, channel: alphaChannel, upper: math.MaxUint32},
+			{bitOffset: 64, bitLength: 63, upper: math.MaxUint32},
+		}
+	case TextureFormatBC4:
+		colorModel = 131
+		samples = []ktx2Sample{{bitLength: 63, upper: math.MaxUint32}}
+	case TextureFormatBC5:
+		colorModel = 132
+		samples = []ktx2Sample{
+			{bitLength: 63, upper: math.MaxUint32},
+			{bitOffset: 64, bitLength: 63, channel: 1, upper: math.MaxUint32},
+		}
+	default:
+		colorModel = 134
+		samples = []ktx2Sample{{bitLength: 127, upper: math.MaxUint32}}
+	}
+
+	transfer := uint8(1) // Linear
+	if srgb {
+		transfer = 2
+	}
+
+	blockSize := 24 + 16*len(samples)
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(4+blockSize))
+	buf = binary.LittleEndian.AppendUint32(buf, 0) // Khronos vendor, basic descriptor
+	buf = binary.LittleEndian.AppendUint16(buf, 2) // Version 1.3
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(blockSize))
+	buf = append(buf, colorModel, 1, transfer, 0) // BT.709 primaries, straight alpha
+	buf = append(buf, blockDim, blockDim, 0, 0)
+	buf = append(buf, uint8(textureBlockSize(format)), 0, 0, 0, 0, 0, 0, 0)
+	for _, s := range samples {
+		channel := s.channel
+		if srgb && channel == alphaChannel {
+			channel |= linearFlag
+		}
+		buf = binary.LittleEndian.AppendUint16(buf, s.bitOffset)
+		buf = append(buf, s.bitLength, channel, 0, 0, 0, 0)
+		buf = binary.LittleEndian.AppendUint32(buf, 0)
+		buf = binary.LittleEndian.AppendUint32(buf, s.upper)
+	}
+	return buf
+}
+
+// writeKTX2 builds a KTX2 file from mip levels, largest first
+func writeKTX2(format TextureFormat, srgb bool, width, height int, levels [][]byte) ([]byte, error) {
+	if len(levels) == 0 {
+		return nil, errors.New("texture has no levels")
+	}
+
+	const headerSize = 12 + 9*4 + 4*4 + 2*8
+	levelIndexSize := 24 * len(levels)
+	dfd := ktx2Descriptor(format, srgb)
+	dfdOffset := headerSize + levelIndexSize
+
+	// Level data is stored smallest first, each level aligned to the block size
+	align := textureBlockSize(format)
+	offsets := make([]int, len(levels))
+	offset := dfdOffset + len(dfd)
+	for i := len(levels) - 1; i >= 0; i-- {
+		offset = (offset + align - 1) / align * align
+		offsets[i] = offset
+		offset += len(levels[i])
+	}
+
+	buf := make([]byte, 0, offset)
+	buf = append(buf, ktx2Identifier...)
+	for _, v := range []uint32{
+		textureVkFormat(format, srgb),
+		1, // typeSize
+		uint32(width), uint32(height), 0,
+		0, // layerCount
+		1, // faceCount
+		uint32(len(levels)),
+		0, // No supercompression
+		uint32(dfdOffset), uint32(len(dfd)),
+		0, 0, // No key/value data
+	} {
+		buf = binary.LittleEndian.AppendUint32(buf, v)
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, 0) // No supercompression global data
+	buf = binary.LittleEndian.AppendUint64(buf, 0)
+
+	for i, level := range levels {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(offsets[i]))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(len(level)))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(len(level)))
+	}
+	buf = append(buf, dfd...)
+
+	for i := len(levels) - 1; i >= 0; i-- {
+		for len(buf) < offsets[i] {
+			buf = append(buf, 0)
+		}
+		buf = append(buf, levels[i]...)
+	}
+	return buf, nil
+}
+
+// readKTX2 returns the VkFormat, size and mip levels of a KTX2 file, the levels back to back
+// and largest first. Only single 2D images without supercompression are read.
+func readKTX2(data []byte) (format uint32, width, height, levels int, pixels []byte, err error) {
+	const headerSize = 12 + 9*4 + 4*4 + 2*8
+	if len(data) < headerSize || !bytes.HasPrefix(data, ktx2Identifier) {
+		return 0, 0, 0, 0, nil, errors.New("not a KTX2 file")
+	}
+
+	field := func(i int) uint32 { return binary.LittleEndian.Uint32(data[12+4*i:]) }
+	format = field(0)
+	width, height = int(field(2)), int(field(3))
+	levels = max(int(field(7)), 1)
+	if format == 0 || field(8) != 0 {
+		return 0, 0, 0, 0, nil, errors.New("supercompressed KTX2 textures are not supported")
+	}
+	if width == 0 || height == 0 || field(4) != 0 || field(5) > 1 || field(6) != 1 {
+		return 0, 0, 0, 0, nil, errors.New("only 2D KTX2 textures are supported")
+	}
+	if levels > 32 || len(data) < headerSize+24*levels {
+		return 0, 0, 0, 0, nil, errors.New("truncated KTX2 file")
+	}
+
+	for i := 0; i < levels; i++ {
+		entry := data[headerSize+24*i:]
+		offset := binary.LittleEndian.Uint64(entry)
+		length := binary.LittleEndian.Uint64(entry[8:])
+		if offset > uint64(len(data)) || length > uint64(len(data))-offset {
+			return 0, 0, 0, 0, nil, errors.New("truncated KTX2 file")
+		}
+		pixels = append(pixels, data[offset:offset+length]...)
+	}
+	if len(pixels) == 0 {
+		return 0, 0, 0, 0, nil, errors.New("KTX2 texture has no data")
+	}
+	return format, width, height, levels, pixels, nil
+}
+
+// writeFileAtomic writes data next to path and renames it into place, so readers never
+// see a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
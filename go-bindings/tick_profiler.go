@@ -0,0 +1,377 @@
+package boulder
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// TickPhase is a part of a server tick the profiler times separately
+type TickPhase int
+
+const (
+	TickPhaseNetwork     TickPhase = 0 // Receiving and handling messages
+	TickPhaseSimulation  TickPhase = 1 // Gameplay and physics
+	TickPhaseReplication TickPhase = 2 // Sending state to clients
+	TickPhaseDeferrable  TickPhase = 3 // Low priority work run by RunDeferrable, e.g. AI
+	TickPhaseCount                 = 4
+)
+
+func (p TickPhase) String() string {
+	switch p {
+	case TickPhaseNetwork:
+		return "network"
+	case TickPhaseSimulation:
+		return "simulation"
+	case TickPhaseReplication:
+		return "replication"
+	case TickPhaseDeferrable:
+		return "deferrable"
+	default:
+		return "unknown"
+	}
+}
+
+// TickProfilerConfig sets a server's tick budget and what it sheds when it can't keep it
+type TickProfilerConfig struct {
+	TickRate      float32 // Ticks per second the server runs at; the budget is one tick. 0 is 30
+	OverloadAfter int     // Consecutive ticks over budget before work is shed; 0 is 5
+	RecoverAfter  int     // Consecutive ticks under Headroom before it is restored; 0 is 60
+	Headroom      float64 // Fraction of the budget ticks must stay under to recover; 0 is 0.7
+	History       int     // Ticks GetProfile covers; 0 is 256
+
+	// While overloaded
+	ReplicationScale float32            // Fraction of Replication's state sync rate kept; 0 is 0.5
+	DeferInterval    int                // Deferrable tasks run once every this many ticks; 0 is 4
+	Replication      *ReplicationServer // Slowed while overloaded; nil leaves replication alone
+}
+
+// DefaultTickProfilerConfig returns a 30 tick per second budget that halves replication
+// and runs deferrable work every 4th tick after 5 ticks over budget
+func DefaultTickProfilerConfig() TickProfilerConfig {
+	return TickProfilerConfig{
+		TickRate:         30,
+		OverloadAfter:    5,
+		RecoverAfter:     60,
+		Headroom:         0.7,
+		History:          256,
+		ReplicationScale: 0.5,
+		DeferInterval:    4,
+	}
+}
+
+func (c TickProfilerConfig) withDefaults() TickProfilerConfig {
+	defaults := DefaultTickProfilerConfig()
+	if c.TickRate <= 0 {
+		c.TickRate = defaults.TickRate
+	}
+	if c.OverloadAfter <= 0 {
+		c.OverloadAfter = defaults.OverloadAfter
+	}
+	if c.RecoverAfter <= 0 {
+		c.RecoverAfter = defaults.RecoverAfter
+	}
+	if c.Headroom <= 0 || c.Headroom >= 1 {
+		c.Headroom = defaults.Headroom
+	}
+	if c.History <= 0 {
+		c.History = defaults.History
+	}
+	if c.ReplicationScale <= 0 || c.ReplicationScale > 1 {
+		c.ReplicationScale = defaults.ReplicationScale
+	}
+	if c.DeferInterval <= 0 {
+		c.DeferInterval = defaults.DeferInterval
+	}
+	return c
+}
+
+// TickTiming is how long one tick and each of its phases took
+type TickTiming struct {
+	Tick       uint64
+	Total      time.Duration
+	Phases     [TickPhaseCount]time.Duration
+	Overloaded bool // Work was being shed during the tick
+	Deferred   int  // Deferrable tasks skipped this tick
+}
+
+// TickProfile summarizes the ticks in the profiler's history
+type TickProfile struct {
+	Ticks        int
+	Budget       time.Duration
+	Average      time.Duration
+	P95          time.Duration
+	Max          time.Duration
+	PhaseAverage [TickPhaseCount]time.Duration
+	OverBudget   int    // Ticks that took longer than the budget
+	Overloaded   bool   // Work is being shed now
+	Overloads    uint64 // Times the server became overloaded since the profiler was created
+}
+
+// OverloadEvent reports the server starting or stopping to shed work
+type OverloadEvent struct {
+	Overloaded bool
+	Tick       uint64
+	Average    time.Duration // Of the ticks that caused the change
+	Budget     time.Duration
+}
+
+// OverloadCallback is called when the server starts or stops shedding work
+type OverloadCallback func(event OverloadEvent)
+
+// deferrableTask is low priority work run by RunDeferrable
+type deferrableTask struct {
+	name    string
+	fn      func(deltaTime float32)
+	pending float32 // Time since it last ran
+}
+
+// TickProfiler times a dedicated server's ticks phase by phase and sheds low priority work
+// when ticks keep going over budget, so an overloaded server degrades instead of falling
+// further behind each tick. While overloaded, replication runs at a fraction of its rate
+// and deferrable tasks run every few ticks with the time they missed; both are restored
+// once ticks have headroom again.
+//
+// A server loop wraps each tick in BeginTick and EndTick and its phases in Measure:
+//
+//	profiler.BeginTick()
+//	profiler.Measure(TickPhaseNetwork, func() { session.Update(); handleEvents() })
+//	profiler.Measure(TickPhaseSimulation, func() { simulate(dt) })
+//	profiler.RunDeferrable(dt)
+//	profiler.Measure(TickPhaseReplication, func() { replication.Update(dt) })
+//	profiler.EndTick()
+type TickProfiler struct {
+	config TickProfilerConfig
+	budget time.Duration
+
+	tick       uint64
+	tickStart  time.Time
+	inTick     bool
+	current    TickTiming
+	history    []TickTiming // Ring of the last config.History ticks
+	next       int
+	overloaded bool
+	overloads  uint64
+	over       int // Consecutive ticks over budget
+	under      int // Consecutive ticks under the headroom
+	streak     time.Duration
+
+	tasks     []*deferrableTask
+	callbacks []OverloadCallback
+}
+
+// NewTickProfiler creates a tick profiler. Pass DefaultTickProfilerConfig() for the defaults.
+func NewTickProfiler(config TickProfilerConfig) *TickProfiler {
+	config = config.withDefaults()
+	return &TickProfiler{
+		config:  config,
+		budget:  time.Duration(float64(time.Second) / float64(config.TickRate)),
+		history: make([]TickTiming, 0, config.History),
+	}
+}
+
+// OnOverload registers a callback for when the server starts or stops shedding work
+func (tp *TickProfiler) OnOverload(callback OverloadCallback) {
+	tp.callbacks = append(tp.callbacks, callback)
+}
+
+// Budget returns how long a tick may take
+func (tp *TickProfiler) Budget() time.Duration {
+	return tp.budget
+}
+
+// IsOverloaded returns whether low priority work is being shed
+func (tp *TickProfiler) IsOverloaded() bool {
+	return tp.overloaded
+}
+
+// BeginTick starts timing a tick
+func (tp *TickProfiler) BeginTick() {
+	tp.tick++
+	tp.tickStart = time.Now()
+	tp.inTick = true
+	tp.current = TickTiming{Tick: tp.tick, Overloaded: tp.overloaded}
+}
+
+// Measure runs fn and adds the time it took to phase. Phases can be measured more than once
+// per tick; their times add up.
+func (tp *TickProfiler) Measure(phase TickPhase, fn func()) {
+	start := time.Now()
+	fn()
+	tp.AddPhaseTime(phase, time.Since(start))
+}
+
+// AddPhaseTime adds time measured elsewhere to a phase of the current tick
+func (tp *TickProfiler) AddPhaseTime(phase TickPhase, elapsed time.Duration) {
+	if phase < 0 || phase >= TickPhaseCount {
+		return
+	}
+	tp.current.Phases[phase] += elapsed
+}
+
+// AddDeferrable registers low priority work, e.g. an AI update, that RunDeferrable calls
+// every tick, or every few ticks while the server is overloaded. fn gets the time since it
+// last ran. Adding a task with a name already in use replaces it.
+func (tp *TickProfiler) AddDeferrable(name string, fn func(deltaTime float32)) {
+	for _, task := range tp.tasks {
+		if task.name == name {
+			task.fn = fn
+			return
+		}
+	}
+	tp.tasks = append(tp.tasks, &deferrableTask{name: name, fn: fn})
+}
+
+// RemoveDeferrable unregisters a deferrable task
+func (tp *TickProfiler) RemoveDeferrable(name string) {
+	for i, task := range tp.tasks {
+		if task.name == name {
+			tp.tasks = append(tp.tasks[:i], tp.tasks[i+1:]...)
+			return
+		}
+	}
+}
+
+// RunDeferrable runs the deferrable tasks due this tick, timed as TickPhaseDeferrable. While
+// overloaded, tasks take turns so each runs once every DeferInterval ticks.
+func (tp *TickProfiler) RunDeferrable(deltaTime float32) {
+	start := time.Now()
+	interval := uint64(tp.config.DeferInterval)
+	for i, task := range tp.tasks {
+		task.pending += deltaTime
+		if tp.overloaded && (tp.tick+uint64(i))%interval != 0 {
+			tp.current.Deferred++
+			continue
+		}
+		elapsed := task.pending
+		task.pending = 0
+		task.fn(elapsed)
+	}
+	tp.AddPhaseTime(TickPhaseDeferrable, time.Since(start))
+}
+
+// EndTick finishes timing the tick, enters or leaves overload mode and returns the tick's
+// timing
+func (tp *TickProfiler) EndTick() TickTiming {
+	if !tp.inTick {
+		return TickTiming{}
+	}
+	tp.inTick = false
+	tp.current.Total = time.Since(tp.tickStart)
+	timing := tp.current
+
+	if len(tp.history) < tp.config.History {
+		tp.history = append(tp.history, timing)
+	} else {
+		tp.history[tp.next] = timing
+	}
+	tp.next = (tp.next + 1) % tp.config.History
+
+	tp.updateOverload(timing.Total)
+	return timing
+}
+
+// updateOverload counts ticks over budget and under the headroom, switching overload mode
+// once either streak is long enough
+func (tp *TickProfiler) updateOverload(total time.Duration) {
+	headroom := time.Duration(float64(tp.budget) * tp.config.Headroom)
+	switch {
+	case total > tp.budget:
+		if tp.under > 0 || tp.over == 0 {
+			tp.streak = 0
+		}
+		tp.over++
+		tp.under = 0
+	case total < headroom:
+		if tp.over > 0 || tp.under == 0 {
+			tp.streak = 0
+		}
+		tp.under++
+		tp.over = 0
+	default:
+		tp.over = 0
+		tp.under = 0
+		tp.streak = 0
+		return
+	}
+	tp.streak += total
+
+	if !tp.overloaded && tp.over >= tp.config.OverloadAfter {
+		tp.setOverloaded(true, tp.streak/time.Duration(tp.over))
+	} else if tp.overloaded && tp.under >= tp.config.RecoverAfter {
+		tp.setOverloaded(false, tp.streak/time.Duration(tp.under))
+	}
+}
+
+func (tp *TickProfiler) setOverloaded(overloaded bool, average time.Duration) {
+	tp.overloaded = overloaded
+	tp.over = 0
+	tp.under = 0
+	tp.streak = 0
+
+	scale := float32(1)
+	if overloaded {
+		tp.overloads++
+		scale = tp.config.ReplicationScale
+		LogInfo(fmt.Sprintf("Server overloaded: ticks averaging %v against a %v budget, shedding low priority work", average, tp.budget))
+	} else {
+		LogInfo(fmt.Sprintf("Server recovered: ticks averaging %v against a %v budget", average, tp.budget))
+	}
+	if tp.config.Replication != nil {
+		tp.config.Replication.SetStateRateScale(scale)
+	}
+
+	event := OverloadEvent{Overloaded: overloaded, Tick: tp.tick, Average: average, Budget: tp.budget}
+	for _, callback := range tp.callbacks {
+		callback(event)
+	}
+}
+
+// GetLastTick returns the timing of the last finished tick
+func (tp *TickProfiler) GetLastTick() TickTiming {
+	if len(tp.history) == 0 {
+		return TickTiming{}
+	}
+	last := tp.next - 1
+	if last < 0 {
+		last = len(tp.history) - 1
+	}
+	return tp.history[last]
+}
+
+// GetProfile summarizes the ticks in the history
+func (tp *TickProfiler) GetProfile() TickProfile {
+	profile := TickProfile{
+		Ticks:      len(tp.history),
+		Budget:     tp.budget,
+		Overloaded: tp.overloaded,
+		Overloads:  tp.overloads,
+	}
+	if len(tp.history) == 0 {
+		return profile
+	}
+
+	totals := make([]time.Duration, len(tp.history))
+	var sum time.Duration
+	var phases [TickPhaseCount]time.Duration
+	for i, timing := range tp.history {
+		totals[i] = timing.Total
+		sum += timing.Total
+		for phase, elapsed := range timing.Phases {
+			phases[phase] += elapsed
+		}
+		if timing.Total > tp.budget {
+			profile.OverBudget++
+		}
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i] < totals[j] })
+
+	count := time.Duration(len(tp.history))
+	profile.Average = sum / count
+	profile.Max = totals[len(totals)-1]
+	profile.P95 = totals[(len(totals)*95)/100]
+	for phase := range phases {
+		profile.PhaseAverage[phase] = phases[phase] / count
+	}
+	return profile
+}
@@ -0,0 +1,892 @@
+package boulder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tiled GID flags. The top bits of a tile GID flip the tile; the rest is the tile ID.
+const (
+	TiledFlipHorizontal uint32 = 0x80000000
+	TiledFlipVertical   uint32 = 0x40000000
+	TiledFlipDiagonal   uint32 = 0x20000000
+	TiledGIDMask        uint32 = 0x0FFFFFFF
+)
+
+// TiledShape is the shape of a Tiled object
+type TiledShape int
+
+const (
+	TiledRectangle TiledShape = 0
+	TiledEllipse   TiledShape = 1
+	TiledPolygon   TiledShape = 2
+	TiledPolyline  TiledShape = 3
+	TiledPoint     TiledShape = 4
+)
+
+// TiledObject is an object from an object layer, or a collision shape drawn on a tile in
+// the tileset editor. Positions are in pixels with Y down, as in Tiled.
+type TiledObject struct {
+	ID                  int
+	Name                string
+	Type                string // Type, or class in newer Tiled versions
+	Shape               TiledShape
+	X, Y, Width, Height float32
+	Rotation            float32   // Degrees clockwise around X, Y
+	Points              []Vector3 // Polygon and polyline points relative to X, Y (Z unused)
+	GID                 uint32    // Tile drawn by tile objects
+	Visible             bool
+	Properties          map[string]string
+}
+
+// TiledTileset is an atlas image cut into tiles
+type TiledTileset struct {
+	FirstGID                uint32
+	Name                    string
+	TileWidth, TileHeight   int
+	Spacing, Margin         int
+	TileCount, Columns      int
+	Image                   string // Atlas path, resolved against the map or tileset file
+	ImageWidth, ImageHeight int
+	OffsetX, OffsetY        int // Drawing offset of every tile in pixels
+
+	Shapes     map[uint32][]TiledObject     // Collision shapes by tile ID within the tileset
+	Properties map[uint32]map[string]string // Tile properties by tile ID within the tileset
+}
+
+// TiledLayer is a tile layer. Tiles are stored sparsely so infinite maps can extend in any
+// direction.
+type TiledLayer struct {
+	Name             string
+	Order            int // Draw order among tile and object layers, from the back
+	Visible          bool
+	Opacity          float32
+	OffsetX, OffsetY float32 // In pixels, including the offsets of parent groups
+	Properties       map[string]string
+
+	chunks map[tileChunkKey][]uint32
+}
+
+// TiledObjectGroup is an object layer
+type TiledObjectGroup struct {
+	Name             string
+	Order            int
+	Visible          bool
+	Opacity          float32
+	OffsetX, OffsetY float32
+	Objects          []TiledObject
+	Properties       map[string]string
+}
+
+// TiledMap is a map made in the Tiled editor. Group layers are flattened into Layers and
+// ObjectGroups, keeping their draw order.
+type TiledMap struct {
+	Width, Height         int // In tiles; infinite maps may have tiles outside
+	TileWidth, TileHeight int // Grid cell size in pixels
+	Infinite              bool
+	Tilesets              []*TiledTileset // Sorted by FirstGID
+	Layers                []*TiledLayer
+	ObjectGroups          []*TiledObjectGroup
+	Properties            map[string]string
+}
+
+// tileChunkKey is the position of a chunk of TilemapChunkSize x TilemapChunkSize tiles
+type tileChunkKey struct {
+	X, Y int
+}
+
+// LoadTiledMap loads a .tmx or .tmj map along with its external tilesets. Only orthogonal
+// maps are supported.
+func LoadTiledMap(path string) (*TiledMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file tiledMapFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tmx":
+		var root xmlNode
+		if err := xml.Unmarshal(data, &root); err != nil {
+			return nil, err
+		}
+		if root.XMLName.Local != "map" {
+			return nil, errors.New("not a tiled map: " + path)
+		}
+		file = tmxMap(&root)
+	case ".tmj", ".json":
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unsupported tiled map format: " + path)
+	}
+
+	if file.Orientation != "" && file.Orientation != "orthogonal" {
+		return nil, errors.New("unsupported tiled map orientation: " + file.Orientation)
+	}
+
+	m := &TiledMap{
+		Width:      file.Width,
+		Height:     file.Height,
+		TileWidth:  file.TileWidth,
+		TileHeight: file.TileHeight,
+		Infinite:   file.Infinite,
+		Properties: tiledProperties(file.Properties),
+	}
+	if m.TileWidth <= 0 || m.TileHeight <= 0 {
+		return nil, errors.New("tiled map has no tile size")
+	}
+
+	dir := filepath.Dir(path)
+	for i := range file.Tilesets {
+		tileset, err := loadTiledTileset(&file.Tilesets[i], dir)
+		if err != nil {
+			return nil, err
+		}
+		m.Tilesets = append(m.Tilesets, tileset)
+	}
+	sort.Slice(m.Tilesets, func(i, j int) bool { return m.Tilesets[i].FirstGID < m.Tilesets[j].FirstGID })
+
+	order := 0
+	if err := m.addLayers(file.Layers, 0, 0, true, 1, &order); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FindLayer returns the index of the first tile layer with name, or -1
+func (m *TiledMap) FindLayer(name string) int {
+	for i, layer := range m.Layers {
+		if layer.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// FindObjectGroup returns the first object layer with name
+func (m *TiledMap) FindObjectGroup(name string) *TiledObjectGroup {
+	for _, group := range m.ObjectGroups {
+		if group.Name == name {
+			return group
+		}
+	}
+	return nil
+}
+
+// GetTileset returns the tileset a GID belongs to and the tile's ID within it. Flip flags
+// are ignored.
+func (m *TiledMap) GetTileset(gid uint32) (tileset *TiledTileset, id uint32, ok bool) {
+	i := m.findTileset(gid)
+	if i < 0 {
+		return nil, 0, false
+	}
+	return m.Tilesets[i], gid&TiledGIDMask - m.Tilesets[i].FirstGID, true
+}
+
+// findTileset returns the index of the tileset a GID belongs to, or -1
+func (m *TiledMap) findTileset(gid uint32) int {
+	gid &= TiledGIDMask
+	if gid == 0 {
+		return -1
+	}
+	return sort.Search(len(m.Tilesets), func(i int) bool { return m.Tilesets[i].FirstGID > gid }) - 1
+}
+
+// GetTileShapes returns the collision shapes of a tile, unflipped and relative to the
+// tile's top-left corner
+func (m *TiledMap) GetTileShapes(gid uint32) []TiledObject {
+	tileset, id, ok := m.GetTileset(gid)
+	if !ok {
+		return nil
+	}
+	return tileset.Shapes[id]
+}
+
+// GetTileProperty returns a custom property of a tile, or "" if it isn't set
+func (m *TiledMap) GetTileProperty(gid uint32, name string) string {
+	tileset, id, ok := m.GetTileset(gid)
+	if !ok {
+		return ""
+	}
+	return tileset.Properties[id][name]
+}
+
+// GetTile returns the GID at a tile position, including flip flags. Zero is empty.
+func (l *TiledLayer) GetTile(x, y int) uint32 {
+	key, index := tileChunkIndex(x, y)
+	chunk, ok := l.chunks[key]
+	if !ok {
+		return 0
+	}
+	return chunk[index]
+}
+
+// GetBounds returns the range of tile positions holding tiles, inclusive
+func (l *TiledLayer) GetBounds() (minX, minY, maxX, maxY int, ok bool) {
+	for key, chunk := range l.chunks {
+		for index, gid := range chunk {
+			if gid == 0 {
+				continue
+			}
+			x := key.X*TilemapChunkSize + index%TilemapChunkSize
+			y := key.Y*TilemapChunkSize + index/TilemapChunkSize
+			if !ok {
+				minX, minY, maxX, maxY, ok = x, y, x, y, true
+				continue
+			}
+			minX, minY = min(minX, x), min(minY, y)
+			maxX, maxY = max(maxX, x), max(maxY, y)
+		}
+	}
+	return minX, minY, maxX, maxY, ok
+}
+
+func (l *TiledLayer) setTile(x, y int, gid uint32) {
+	key, index := tileChunkIndex(x, y)
+	chunk, ok := l.chunks[key]
+	if !ok {
+		if gid == 0 {
+			return
+		}
+		chunk = make([]uint32, TilemapChunkSize*TilemapChunkSize)
+		l.chunks[key] = chunk
+	}
+	chunk[index] = gid
+}
+
+// tileChunkIndex returns the chunk holding a tile and the tile's index within it
+func tileChunkIndex(x, y int) (tileChunkKey, int) {
+	key := tileChunkKey{floorDiv(x, TilemapChunkSize), floorDiv(y, TilemapChunkSize)}
+	return key, (y-key.Y*TilemapChunkSize)*TilemapChunkSize + x - key.X*TilemapChunkSize
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+// addLayers flattens layers into the map, applying the offset, visibility and opacity of
+// the groups they are in
+func (m *TiledMap) addLayers(layers []tiledLayerFile, offsetX, offsetY float32, visible bool, opacity float32, order *int) error {
+	for i := range layers {
+		file := &layers[i]
+		x, y := offsetX+file.OffsetX, offsetY+file.OffsetY
+		v, o := visible && file.Visible, opacity*file.Opacity
+
+		switch file.Type {
+		case "tilelayer":
+			layer := &TiledLayer{
+				Name:       file.Name,
+				Order:      *order,
+				Visible:    v,
+				Opacity:    o,
+				OffsetX:    x,
+				OffsetY:    y,
+				Properties: tiledProperties(file.Properties),
+				chunks:     make(map[tileChunkKey][]uint32),
+			}
+			if err := layer.load(file); err != nil {
+				return errors.New("tiled layer " + file.Name + ": " + err.Error())
+			}
+			m.Layers = append(m.Layers, layer)
+			*order++
+		case "objectgroup":
+			group := &TiledObjectGroup{
+				Name:       file.Name,
+				Order:      *order,
+				Visible:    v,
+				Opacity:    o,
+				OffsetX:    x,
+				OffsetY:    y,
+				Properties: tiledProperties(file.Properties),
+			}
+			for j := range file.Objects {
+				group.Objects = append(group.Objects, file.Objects[j].object())
+			}
+			m.ObjectGroups = append(m.ObjectGroups, group)
+			*order++
+		case "group":
+			if err := m.addLayers(file.Layers, x, y, v, o, order); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// load decodes a tile layer's data, either one block covering the layer or the chunks of
+// an infinite map
+func (l *TiledLayer) load(file *tiledLayerFile) error {
+	if len(file.Chunks) == 0 {
+		return l.loadBlock(file.Data, file, file.X, file.Y, file.Width, file.Height)
+	}
+	for i := range file.Chunks {
+		c := &file.Chunks[i]
+		if err := l.loadBlock(c.Data, file, c.X, c.Y, c.Width, c.Height); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *TiledLayer) loadBlock(data tiledData, file *tiledLayerFile, x, y, width, height int) error {
+	gids, err := data.decode(file.Encoding, file.Compression)
+	if err != nil {
+		return err
+	}
+	if len(gids) != width*height {
+		return fmt.Errorf("tile data has %d tiles, expected %d", len(gids), width*height)
+	}
+	for i, gid := range gids {
+		if gid != 0 {
+			l.setTile(x+i%width, y+i/width, gid)
+		}
+	}
+	return nil
+}
+
+func loadTiledTileset(file *tiledTilesetFile, dir string) (*TiledTileset, error) {
+	firstGID := file.FirstGID
+	if file.Source != "" {
+		path := filepath.Join(dir, file.Source)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var external tiledTilesetFile
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".tsx":
+			var root xmlNode
+			if err := xml.Unmarshal(data, &root); err != nil {
+				return nil, err
+			}
+			if root.XMLName.Local != "tileset" {
+				return nil, errors.New("not a tiled tileset: " + path)
+			}
+			external = tmxTileset(&root)
+		case ".tsj", ".json":
+			if err := json.Unmarshal(data, &external); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errors.New("unsupported tiled tileset format: " + path)
+		}
+		file, dir = &external, filepath.Dir(path)
+	}
+
+	if file.Image == "" {
+		return nil, errors.New("tileset " + file.Name + " is an image collection; tilemaps need a single atlas image")
+	}
+	if file.TileWidth <= 0 || file.TileHeight <= 0 || file.ImageWidth <= 0 || file.ImageHeight <= 0 {
+		return nil, errors.New("tileset " + file.Name + " has no tile or image size")
+	}
+
+	tileset := &TiledTileset{
+		FirstGID:    firstGID,
+		Name:        file.Name,
+		TileWidth:   file.TileWidth,
+		TileHeight:  file.TileHeight,
+		Spacing:     file.Spacing,
+		Margin:      file.Margin,
+		TileCount:   file.TileCount,
+		Columns:     file.Columns,
+		Image:       filepath.Join(dir, file.Image),
+		ImageWidth:  file.ImageWidth,
+		ImageHeight: file.ImageHeight,
+		OffsetX:     file.TileOffset.X,
+		OffsetY:     file.TileOffset.Y,
+		Shapes:      make(map[uint32][]TiledObject),
+		Properties:  make(map[uint32]map[string]string),
+	}
+	if tileset.Columns <= 0 {
+		tileset.Columns = max(1, (tileset.ImageWidth-2*tileset.Margin+tileset.Spacing)/(tileset.TileWidth+tileset.Spacing))
+	}
+
+	for _, tile := range file.Tiles {
+		if len(tile.Properties) > 0 {
+			tileset.Properties[tile.ID] = tiledProperties(tile.Properties)
+		}
+		if tile.ObjectGroup != nil {
+			for i := range tile.ObjectGroup.Objects {
+				tileset.Shapes[tile.ID] = append(tileset.Shapes[tile.ID], tile.ObjectGroup.Objects[i].object())
+			}
+		}
+	}
+	return tileset, nil
+}
+
+// Tiled file structures. The JSON formats unmarshal into these directly; TMX and TSX files
+// are converted from their XML.
+
+type tiledMapFile struct {
+	Orientation string             `json:"orientation"`
+	Width       int                `json:"width"`
+	Height      int                `json:"height"`
+	TileWidth   int                `json:"tilewidth"`
+	TileHeight  int                `json:"tileheight"`
+	Infinite    bool               `json:"infinite"`
+	Properties  []tiledProperty    `json:"properties"`
+	Tilesets    []tiledTilesetFile `json:"tilesets"`
+	Layers      []tiledLayerFile   `json:"layers"`
+}
+
+type tiledProperty struct {
+	Name  string `json:"name"`
+	Value any    `json:"value"`
+}
+
+type tiledTilesetFile struct {
+	FirstGID    uint32             `json:"firstgid"`
+	Source      string             `json:"source"`
+	Name        string             `json:"name"`
+	TileWidth   int                `json:"tilewidth"`
+	TileHeight  int                `json:"tileheight"`
+	Spacing     int                `json:"spacing"`
+	Margin      int                `json:"margin"`
+	TileCount   int                `json:"tilecount"`
+	Columns     int                `json:"columns"`
+	Image       string             `json:"image"`
+	ImageWidth  int                `json:"imagewidth"`
+	ImageHeight int                `json:"imageheight"`
+	TileOffset  struct{ X, Y int } `json:"tileoffset"`
+	Tiles       []tiledTileFile    `json:"tiles"`
+}
+
+type tiledTileFile struct {
+	ID          uint32          `json:"id"`
+	Properties  []tiledProperty `json:"properties"`
+	ObjectGroup *tiledLayerFile `json:"objectgroup"`
+}
+
+type tiledLayerFile struct {
+	Type        string            `json:"type"`
+	Name        string            `json:"name"`
+	Visible     bool              `json:"visible"`
+	Opacity     float32           `json:"opacity"`
+	OffsetX     float32           `json:"offsetx"`
+	OffsetY     float32           `json:"offsety"`
+	X           int               `json:"x"`
+	Y           int               `json:"y"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	Encoding    string            `json:"encoding"`
+	Compression string            `json:"compression"`
+	Data        tiledData         `json:"data"`
+	Chunks      []tiledChunkFile  `json:"chunks"`
+	Objects     []tiledObjectFile `json:"objects"`
+	Layers      []tiledLayerFile  `json:"layers"`
+	Properties  []tiledProperty   `json:"properties"`
+}
+
+type tiledChunkFile struct {
+	X      int       `json:"x"`
+	Y      int       `json:"y"`
+	Width  int       `json:"width"`
+	Height int       `json:"height"`
+	Data   tiledData `json:"data"`
+}
+
+type tiledPoint struct {
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
+}
+
+type tiledObjectFile struct {
+	ID         int             `json:"id"`
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	Class      string          `json:"class"`
+	X          float32         `json:"x"`
+	Y          float32         `json:"y"`
+	Width      float32         `json:"width"`
+	Height     float32         `json:"height"`
+	Rotation   float32         `json:"rotation"`
+	GID        uint32          `json:"gid"`
+	Visible    bool            `json:"visible"`
+	Ellipse    bool            `json:"ellipse"`
+	Point      bool            `json:"point"`
+	Polygon    []tiledPoint    `json:"polygon"`
+	Polyline   []tiledPoint    `json:"polyline"`
+	Properties []tiledProperty `json:"properties"`
+}
+
+func (f *tiledObjectFile) object() TiledObject {
+	o := TiledObject{
+		ID:         f.ID,
+		Name:       f.Name,
+		Type:       f.Type,
+		X:          f.X,
+		Y:          f.Y,
+		Width:      f.Width,
+		Height:     f.Height,
+		Rotation:   f.Rotation,
+		GID:        f.GID,
+		Visible:    f.Visible,
+		Properties: tiledProperties(f.Properties),
+	}
+	if o.Type == "" {
+		o.Type = f.Class
+	}
+
+	points := f.Polygon
+	switch {
+	case f.Ellipse:
+		o.Shape = TiledEllipse
+	case f.Point:
+		o.Shape = TiledPoint
+	case len(f.Polygon) > 0:
+		o.Shape = TiledPolygon
+	case len(f.Polyline) > 0:
+		o.Shape, points = TiledPolyline, f.Polyline
+	}
+	for _, p := range points {
+		o.Points = append(o.Points, Vector3{X: p.X, Y: p.Y})
+	}
+	return o
+}
+
+// tiledData is layer or chunk tile data: GIDs, or text in the layer's encoding
+type tiledData struct {
+	gids []uint32
+	text string
+}
+
+func (d *tiledData) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &d.text)
+	}
+	return json.Unmarshal(data, &d.gids)
+}
+
+func (d *tiledData) decode(encoding, compression string) ([]uint32, error) {
+	if d.gids != nil || d.text == "" {
+		return d.gids, nil
+	}
+
+	switch encoding {
+	case "csv":
+		fields := strings.Split(d.text, ",")
+		gids := make([]uint32, 0, len(fields))
+		for _, field := range fields {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			gid, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			gids = append(gids, uint32(gid))
+		}
+		return gids, nil
+	case "base64":
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(d.text))
+		if err != nil {
+			return nil, err
+		}
+
+		var r io.ReadCloser
+		switch compression {
+		case "":
+		case "gzip":
+			r, err = gzip.NewReader(bytes.NewReader(data))
+		case "zlib":
+			r, err = zlib.NewReader(bytes.NewReader(data))
+		default:
+			return nil, errors.New("unsupported tile data compression: " + compression)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			data, err = io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if len(data)%4 != 0 {
+			return nil, errors.New("truncated tile data")
+		}
+		gids := make([]uint32, len(data)/4)
+		for i := range gids {
+			gids[i] = binary.LittleEndian.Uint32(data[i*4:])
+		}
+		return gids, nil
+	default:
+		return nil, errors.New("unsupported tile data encoding: " + encoding)
+	}
+}
+
+func tiledProperties(properties []tiledProperty) map[string]string {
+	if len(properties) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(properties))
+	for _, p := range properties {
+		switch v := p.Value.(type) {
+		case string:
+			values[p.Name] = v
+		case float64:
+			values[p.Name] = strconv.FormatFloat(v, 'g', -1, 64)
+		case nil:
+			values[p.Name] = ""
+		default:
+			values[p.Name] = fmt.Sprint(v)
+		}
+	}
+	return values
+}
+
+// xmlNode is a generic XML element, used so TMX layers keep their document order
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Content  string     `xml:",chardata"`
+	Children []xmlNode  `xml:",any"`
+}
+
+func (n *xmlNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (n *xmlNode) attrInt(name string) int {
+	v, _ := strconv.Atoi(n.attr(name))
+	return v
+}
+
+func (n *xmlNode) attrFloat(name string, fallback float32) float32 {
+	v, err := strconv.ParseFloat(n.attr(name), 32)
+	if err != nil {
+		return fallback
+	}
+	return float32(v)
+}
+
+func (n *xmlNode) child(name string) *xmlNode {
+	for i := range n.Children {
+		if n.Children[i].XMLName.Local == name {
+			return &n.Children[i]
+		}
+	}
+	return nil
+}
+
+func tmxMap(n *xmlNode) tiledMapFile {
+	m := tiledMapFile{
+		Orientation: n.attr("orientation"),
+		Width:       n.attrInt("width"),
+		Height:      n.attrInt("height"),
+		TileWidth:   n.attrInt("tilewidth"),
+		TileHeight:  n.attrInt("tileheight"),
+		Infinite:    n.attr("infinite") == "1",
+		Properties:  tmxProperties(n),
+		Layers:      tmxLayers(n),
+	}
+	for i := range n.Children {
+		if n.Children[i].XMLName.Local == "tileset" {
+			m.Tilesets = append(m.Tilesets, tmxTileset(&n.Children[i]))
+		}
+	}
+	return m
+}
+
+func tmxTileset(n *xmlNode) tiledTilesetFile {
+	t := tiledTilesetFile{
+		FirstGID:   uint32(n.attrInt("firstgid")),
+		Source:     n.attr("source"),
+		Name:       n.attr("name"),
+		TileWidth:  n.attrInt("tilewidth"),
+		TileHeight: n.attrInt("tileheight"),
+		Spacing:    n.attrInt("spacing"),
+		Margin:     n.attrInt("margin"),
+		TileCount:  n.attrInt("tilecount"),
+		Columns:    n.attrInt("columns"),
+	}
+	if image := n.child("image"); image != nil {
+		t.Image = image.attr("source")
+		t.ImageWidth = image.attrInt("width")
+		t.ImageHeight = image.attrInt("height")
+	}
+	if offset := n.child("tileoffset"); offset != nil {
+		t.TileOffset.X = offset.attrInt("x")
+		t.TileOffset.Y = offset.attrInt("y")
+	}
+
+	for i := range n.Children {
+		c := &n.Children[i]
+		if c.XMLName.Local != "tile" {
+			continue
+		}
+		tile := tiledTileFile{ID: uint32(c.attrInt("id")), Properties: tmxProperties(c)}
+		if group := c.child("objectgroup"); group != nil {
+			layer := tmxLayer(group)
+			tile.ObjectGroup = &layer
+		}
+		t.Tiles = append(t.Tiles, tile)
+	}
+	return t
+}
+
+func tmxLayers(n *xmlNode) []tiledLayerFile {
+	var layers []tiledLayerFile
+	for i := range n.Children {
+		switch n.Children[i].XMLName.Local {
+		case "layer", "objectgroup", "group", "imagelayer":
+			layers = append(layers, tmxLayer(&n.Children[i]))
+		}
+	}
+	return layers
+}
+
+func tmxLayer(n *xmlNode) tiledLayerFile {
+	l := tiledLayerFile{
+		Type:       n.XMLName.Local,
+		Name:       n.attr("name"),
+		Visible:    n.attr("visible") != "0",
+		Opacity:    n.attrFloat("opacity", 1),
+		OffsetX:    n.attrFloat("offsetx", 0),
+		OffsetY:    n.attrFloat("offsety", 0),
+		X:          n.attrInt("x"),
+		Y:          n.attrInt("y"),
+		Width:      n.attrInt("width"),
+		Height:     n.attrInt("height"),
+		Properties: tmxProperties(n),
+	}
+
+	switch l.Type {
+	case "layer":
+		l.Type = "tilelayer"
+		if data := n.child("data"); data != nil {
+			l.Encoding, l.Compression = data.attr("encoding"), data.attr("compression")
+			l.Data = tmxData(data, l.Encoding)
+			for i := range data.Children {
+				c := &data.Children[i]
+				if c.XMLName.Local == "chunk" {
+					l.Chunks = append(l.Chunks, tiledChunkFile{
+						X:      c.attrInt("x"),
+						Y:      c.attrInt("y"),
+						Width:  c.attrInt("width"),
+						Height: c.attrInt("height"),
+						Data:   tmxData(c, l.Encoding),
+					})
+				}
+			}
+		}
+	case "objectgroup":
+		for i := range n.Children {
+			if n.Children[i].XMLName.Local == "object" {
+				l.Objects = append(l.Objects, tmxObject(&n.Children[i]))
+			}
+		}
+	case "group":
+		l.Layers = tmxLayers(n)
+	}
+	return l
+}
+
+// tmxData reads tile data, which is either encoded text or, without an encoding, one
+// <tile gid=""> element per tile
+func tmxData(n *xmlNode, encoding string) tiledData {
+	if encoding != "" {
+		return tiledData{text: n.Content}
+	}
+
+	var d tiledData
+	for i := range n.Children {
+		if n.Children[i].XMLName.Local == "tile" {
+			gid, _ := strconv.ParseUint(n.Children[i].attr("gid"), 10, 32)
+			d.gids = append(d.gids, uint32(gid))
+		}
+	}
+	return d
+}
+
+func tmxObject(n *xmlNode) tiledObjectFile {
+	o := tiledObjectFile{
+		ID:         n.attrInt("id"),
+		Name:       n.attr("name"),
+		Type:       n.attr("type"),
+		Class:      n.attr("class"),
+		X:          n.attrFloat("x", 0),
+		Y:          n.attrFloat("y", 0),
+		Width:      n.attrFloat("width", 0),
+		Height:     n.attrFloat("height", 0),
+		Rotation:   n.attrFloat("rotation", 0),
+		Visible:    n.attr("visible") != "0",
+		Ellipse:    n.child("ellipse") != nil,
+		Point:      n.child("point") != nil,
+		Properties: tmxProperties(n),
+	}
+	gid, _ := strconv.ParseUint(n.attr("gid"), 10, 32)
+	o.GID = uint32(gid)
+
+	if polygon := n.child("polygon"); polygon != nil {
+		o.Polygon = tmxPoints(polygon.attr("points"))
+	}
+	if polyline := n.child("polyline"); polyline != nil {
+		o.Polyline = tmxPoints(polyline.attr("points"))
+	}
+	return o
+}
+
+// tmxPoints parses a "x,y x,y ..." point list
+func tmxPoints(s string) []tiledPoint {
+	var points []tiledPoint
+	for _, pair := range strings.Fields(s) {
+		x, y, ok := strings.Cut(pair, ",")
+		if !ok {
+			continue
+		}
+		px, _ := strconv.ParseFloat(x, 32)
+		py, _ := strconv.ParseFloat(y, 32)
+		points = append(points, tiledPoint{X: float32(px), Y: float32(py)})
+	}
+	return points
+}
+
+func tmxProperties(n *xmlNode) []tiledProperty {
+	props := n.child("properties")
+	if props == nil {
+		return nil
+	}
+
+	var properties []tiledProperty
+	for i := range props.Children {
+		p := &props.Children[i]
+		if p.XMLName.Local != "property" {
+			continue
+		}
+		value := p.attr("value")
+		if value == "" {
+			value = p.Content // Multi-line strings are stored as text
+		}
+		properties = append(properties, tiledProperty{Name: p.attr("name"), Value: value})
+	}
+	return properties
+}
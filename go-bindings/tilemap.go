@@ -0,0 +1,412 @@
+package boulder
+
+import (
+	"errors"
+	"math"
+)
+
+const (
+	// TilemapChunkSize is the number of tiles along each side of a tilemap chunk. Each
+	// chunk of each layer is one entity with one mesh.
+	TilemapChunkSize = 16
+
+	// DefaultTilemapLayerSpacing is the Z distance between consecutive layers. Later layers
+	// in the Tiled file are nearer the camera.
+	DefaultTilemapLayerSpacing float32 = 0.01
+
+	// TilesetUVStride is the step a tile's tileset adds to its vertices' V coordinate.
+	// Shaders pick the atlas with floor(v / stride) and sample it at (u, mod(v, stride)).
+	TilesetUVStride = 2
+)
+
+// TileCollider is a tile's collision shape in world space
+type TileCollider struct {
+	Layer  int
+	X, Y   int // Tile position
+	GID    uint32
+	Shape  TiledShape
+	Type   string    // Type of the shape in the tileset editor
+	Points []Vector3 // Rectangle and ellipse bounding corners, polygon or polyline points
+	Min    Vector3
+	Max    Vector3
+}
+
+type tilemapChunk struct {
+	entity *Entity
+	mesh   *Mesh
+}
+
+type tilemapLayer struct {
+	z       float32
+	visible bool
+	chunks  map[tileChunkKey]*tilemapChunk
+}
+
+// Tilemap draws the tile layers of a Tiled map. The map's top-left corner is at the
+// entity's position, with +X right and +Y up; pixelsPerUnit pixels make one world unit.
+type Tilemap struct {
+	world  *World
+	entity EntityID
+	tiled  *TiledMap
+	origin Vector3
+	scale  float32 // World units per pixel
+	layers []tilemapLayer
+}
+
+// AddTilemap builds meshes for a map's tile layers under an entity. Tile vertices carry
+// atlas UVs offset by TilesetUVStride per tileset.
+func (w *World) AddTilemap(entity EntityID, tiled *TiledMap, pixelsPerUnit float32) (*Tilemap, error) {
+	if !w.ready() {
+		return nil, errNotInitialized
+	}
+	if tiled == nil {
+		return nil, errors.New("tiled map is nil")
+	}
+	if pixelsPerUnit <= 0 {
+		return nil, errors.New("pixels per unit must be positive")
+	}
+
+	root := &Entity{ID: entity, world: w}
+	origin, err := root.GetTransform()
+	if err != nil {
+		if err := root.AddTransform(Vector3{}); err != nil {
+			return nil, err
+		}
+	}
+
+	tm := &Tilemap{
+		world:  w,
+		entity: entity,
+		tiled:  tiled,
+		origin: origin,
+		scale:  1 / pixelsPerUnit,
+		layers: make([]tilemapLayer, len(tiled.Layers)),
+	}
+	for i, layer := range tiled.Layers {
+		tm.layers[i] = tilemapLayer{
+			z:       float32(layer.Order) * DefaultTilemapLayerSpacing,
+			visible: layer.Visible,
+			chunks:  make(map[tileChunkKey]*tilemapChunk),
+		}
+		for key := range layer.chunks {
+			if err := tm.buildChunk(i, key); err != nil {
+				tm.Destroy()
+				return nil, err
+			}
+		}
+	}
+
+	return tm, nil
+}
+
+// GetEntity returns the tilemap's root entity
+func (tm *Tilemap) GetEntity() EntityID {
+	return tm.entity
+}
+
+// GetMap returns the Tiled map the tilemap draws
+func (tm *Tilemap) GetMap() *TiledMap {
+	return tm.tiled
+}
+
+// GetTile returns the GID at a tile position in a layer
+func (tm *Tilemap) GetTile(layer, x, y int) uint32 {
+	if layer < 0 || layer >= len(tm.layers) {
+		return 0
+	}
+	return tm.tiled.Layers[layer].GetTile(x, y)
+}
+
+// SetTile changes the tile at a position in a layer, including flip flags. Zero clears it.
+func (tm *Tilemap) SetTile(layer, x, y int, gid uint32) error {
+	if layer < 0 || layer >= len(tm.layers) {
+		return errors.New("invalid tilemap layer")
+	}
+
+	tm.tiled.Layers[layer].setTile(x, y, gid)
+
+	key, index := tileChunkIndex(x, y)
+	chunk, ok := tm.layers[layer].chunks[key]
+	if !ok {
+		if gid == 0 {
+			return nil
+		}
+		return tm.buildChunk(layer, key)
+	}
+
+	vertices := tm.tileVertices(gid, index%TilemapChunkSize, index/TilemapChunkSize)
+	return chunk.mesh.UpdateVertices(index*4, vertices[:])
+}
+
+// SetLayerZ moves a layer to a Z offset from the tilemap's entity
+func (tm *Tilemap) SetLayerZ(layer int, z float32) error {
+	if layer < 0 || layer >= len(tm.layers) {
+		return errors.New("invalid tilemap layer")
+	}
+
+	tm.layers[layer].z = z
+	for key, chunk := range tm.layers[layer].chunks {
+		if err := chunk.entity.SetTransform(tm.chunkPosition(layer, key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLayerZ returns a layer's Z offset from the tilemap's entity
+func (tm *Tilemap) GetLayerZ(layer int) float32 {
+	if layer < 0 || layer >= len(tm.layers) {
+		return 0
+	}
+	return tm.layers[layer].z
+}
+
+// SetLayerVisible shows or hides a layer
+func (tm *Tilemap) SetLayerVisible(layer int, visible bool) error {
+	if layer < 0 || layer >= len(tm.layers) {
+		return errors.New("invalid tilemap layer")
+	}
+
+	tm.layers[layer].visible = visible
+	for _, chunk := range tm.layers[layer].chunks {
+		if err := chunk.entity.SetModelVisible(visible); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WorldToTile returns the tile position under a world position, ignoring layer offsets
+func (tm *Tilemap) WorldToTile(position Vector3) (x, y int) {
+	px := (position.X - tm.origin.X) / tm.scale
+	py := (tm.origin.Y - position.Y) / tm.scale
+	return int(math.Floor(float64(px / float32(tm.tiled.TileWidth)))),
+		int(math.Floor(float64(py / float32(tm.tiled.TileHeight))))
+}
+
+// TileToWorld returns the world position of a tile's center, ignoring layer offsets
+func (tm *Tilemap) TileToWorld(x, y int) Vector3 {
+	return Vector3{
+		X: tm.origin.X + (float32(x)+0.5)*float32(tm.tiled.TileWidth)*tm.scale,
+		Y: tm.origin.Y - (float32(y)+0.5)*float32(tm.tiled.TileHeight)*tm.scale,
+		Z: tm.origin.Z,
+	}
+}
+
+// GetColliders returns the collision shapes of every tile in a layer, flipped and placed
+// in world space
+func (tm *Tilemap) GetColliders(layer int) []TileCollider {
+	if layer < 0 || layer >= len(tm.layers) {
+		return nil
+	}
+
+	var colliders []TileCollider
+	for key, chunk := range tm.tiled.Layers[layer].chunks {
+		for index, gid := range chunk {
+			if gid != 0 {
+				x := key.X*TilemapChunkSize + index%TilemapChunkSize
+				y := key.Y*TilemapChunkSize + index/TilemapChunkSize
+				colliders = tm.appendColliders(colliders, layer, x, y, gid)
+			}
+		}
+	}
+	return colliders
+}
+
+// GetCollidersAt returns the collision shapes of the tile at a position
+func (tm *Tilemap) GetCollidersAt(layer, x, y int) []TileCollider {
+	if layer < 0 || layer >= len(tm.layers) {
+		return nil
+	}
+	return tm.appendColliders(nil, layer, x, y, tm.tiled.Layers[layer].GetTile(x, y))
+}
+
+// Destroy removes the tilemap's chunk entities
+func (tm *Tilemap) Destroy() {
+	for i := range tm.layers {
+		for key, chunk := range tm.layers[i].chunks {
+			chunk.entity.Destroy()
+			delete(tm.layers[i].chunks, key)
+		}
+	}
+}
+
+// buildChunk creates the entity and mesh for a chunk of a layer. Every tile slot gets a
+// quad so tiles can be changed in place; empty tiles are degenerate.
+func (tm *Tilemap) buildChunk(layer int, key tileChunkKey) error {
+	tiles := tm.tiled.Layers[layer].chunks[key]
+	if tiles == nil {
+		return nil
+	}
+
+	entity, err := tm.world.NewEntity()
+	if err != nil {
+		return err
+	}
+	if err := entity.AddTransform(tm.chunkPosition(layer, key)); err != nil {
+		entity.Destroy()
+		return err
+	}
+
+	vertices := make([]Vertex, 0, len(tiles)*4)
+	indices := make([]uint32, 0, len(tiles)*6)
+	for index, gid := range tiles {
+		quad := tm.tileVertices(gid, index%TilemapChunkSize, index/TilemapChunkSize)
+		base := uint32(len(vertices))
+		vertices = append(vertices, quad[:]...)
+		indices = append(indices, base, base+3, base+2, base+2, base+1, base)
+	}
+
+	mesh, err := entity.CreateMesh(vertices, indices, true)
+	if err != nil {
+		entity.Destroy()
+		return err
+	}
+	if !tm.layers[layer].visible {
+		if err := entity.SetModelVisible(false); err != nil {
+			entity.Destroy()
+			return err
+		}
+	}
+
+	tm.layers[layer].chunks[key] = &tilemapChunk{entity: entity, mesh: mesh}
+	return nil
+}
+
+// chunkPosition returns the world position of a chunk's top-left corner
+func (tm *Tilemap) chunkPosition(layer int, key tileChunkKey) Vector3 {
+	l := tm.tiled.Layers[layer]
+	px := l.OffsetX + float32(key.X*TilemapChunkSize*tm.tiled.TileWidth)
+	py := l.OffsetY + float32(key.Y*TilemapChunkSize*tm.tiled.TileHeight)
+	return Vector3{
+		X: tm.origin.X + px*tm.scale,
+		Y: tm.origin.Y - py*tm.scale,
+		Z: tm.origin.Z + tm.layers[layer].z,
+	}
+}
+
+// tileVertices returns the quad for a tile at a position within its chunk: top-left,
+// top-right, bottom-right, bottom-left. Tiles bigger than the grid extend up and right
+// from the bottom-left of their cell, as in Tiled.
+func (tm *Tilemap) tileVertices(gid uint32, x, y int) [4]Vertex {
+	var quad [4]Vertex
+	i := tm.tiled.findTileset(gid)
+	if i < 0 {
+		return quad
+	}
+	ts := tm.tiled.Tilesets[i]
+	id := int(gid&TiledGIDMask - ts.FirstGID)
+	if ts.TileCount > 0 && id >= ts.TileCount {
+		return quad
+	}
+
+	px := ts.Margin + id%ts.Columns*(ts.TileWidth+ts.Spacing)
+	py := ts.Margin + id/ts.Columns*(ts.TileHeight+ts.Spacing)
+	u0 := float32(px) / float32(ts.ImageWidth)
+	v0 := float32(py) / float32(ts.ImageHeight)
+	u1 := float32(px+ts.TileWidth) / float32(ts.ImageWidth)
+	v1 := float32(py+ts.TileHeight) / float32(ts.ImageHeight)
+	atlas := float32(i * TilesetUVStride)
+
+	left := float32(x*tm.tiled.TileWidth + ts.OffsetX)
+	bottom := float32((y+1)*tm.tiled.TileHeight + ts.OffsetY)
+	right := left + float32(ts.TileWidth)
+	top := bottom - float32(ts.TileHeight)
+
+	corners := [4][2]float32{{0, 0}, {1, 0}, {1, 1}, {0, 1}}
+	for c, corner := range corners {
+		// Flips apply to the image diagonal first, then horizontal, then vertical, so the
+		// texture lookup undoes them in reverse
+		s, t := corner[0], corner[1]
+		if gid&TiledFlipVertical != 0 {
+			t = 1 - t
+		}
+		if gid&TiledFlipHorizontal != 0 {
+			s = 1 - s
+		}
+		if gid&TiledFlipDiagonal != 0 {
+			s, t = t, s
+		}
+
+		quad[c] = Vertex{
+			Position: Vector3{
+				X: (left + (right-left)*corner[0]) * tm.scale,
+				Y: -(top + (bottom-top)*corner[1]) * tm.scale,
+			},
+			Normal: Vector3{Z: 1},
+			U:      u0 + (u1-u0)*s,
+			V:      v0 + (v1-v0)*t + atlas,
+		}
+	}
+	return quad
+}
+
+// appendColliders adds a tile's collision shapes in world space
+func (tm *Tilemap) appendColliders(colliders []TileCollider, layer, x, y int, gid uint32) []TileCollider {
+	tileset, _, ok := tm.tiled.GetTileset(gid)
+	if !ok {
+		return colliders
+	}
+	shapes := tm.tiled.GetTileShapes(gid)
+	if len(shapes) == 0 {
+		return colliders
+	}
+
+	l := tm.tiled.Layers[layer]
+	width, height := float32(tileset.TileWidth), float32(tileset.TileHeight)
+	left := l.OffsetX + float32(x*tm.tiled.TileWidth+tileset.OffsetX)
+	top := l.OffsetY + float32((y+1)*tm.tiled.TileHeight+tileset.OffsetY) - height
+	z := tm.origin.Z + tm.layers[layer].z
+
+	for _, shape := range shapes {
+		var local []Vector3
+		switch shape.Shape {
+		case TiledRectangle, TiledEllipse:
+			local = []Vector3{
+				{X: 0, Y: 0},
+				{X: shape.Width, Y: 0},
+				{X: shape.Width, Y: shape.Height},
+				{X: 0, Y: shape.Height},
+			}
+		case TiledPolygon, TiledPolyline:
+			local = shape.Points
+		case TiledPoint:
+			local = []Vector3{{}}
+		}
+		if len(local) == 0 {
+			continue
+		}
+
+		sin, cos := math.Sincos(float64(shape.Rotation) * math.Pi / 180)
+		collider := TileCollider{Layer: layer, X: x, Y: y, GID: gid, Shape: shape.Shape, Type: shape.Type}
+		for i, p := range local {
+			// Rotate around the shape's origin, then flip within the tile
+			px := shape.X + p.X*float32(cos) - p.Y*float32(sin)
+			py := shape.Y + p.X*float32(sin) + p.Y*float32(cos)
+			if gid&TiledFlipDiagonal != 0 {
+				px, py = py, px
+			}
+			if gid&TiledFlipHorizontal != 0 {
+				px = width - px
+			}
+			if gid&TiledFlipVertical != 0 {
+				py = height - py
+			}
+
+			point := Vector3{
+				X: tm.origin.X + (left+px)*tm.scale,
+				Y: tm.origin.Y - (top+py)*tm.scale,
+				Z: z,
+			}
+			collider.Points = append(collider.Points, point)
+			if i == 0 {
+				collider.Min, collider.Max = point, point
+				continue
+			}
+			collider.Min = Vector3{min(collider.Min.X, point.X), min(collider.Min.Y, point.Y), z}
+			collider.Max = Vector3{max(collider.Max.X, point.X), max(collider.Max.Y, point.Y), z}
+		}
+		colliders = append(colliders, collider)
+	}
+	return colliders
+}
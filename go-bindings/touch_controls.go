@@ -0,0 +1,140 @@
+package boulder
+
+import "math"
+
+// VirtualJoystick is an on-screen stick for touch screens, drawn as two UI buttons: the
+// base and a knob that follows the finger. A finger that goes down inside the base drives
+// the stick until it lifts, so other fingers stay free for buttons. Call UIInitialize
+// first and Update every frame after Window.PollEvents.
+type VirtualJoystick struct {
+	DeadZone float32 // Fraction of the radius around the center that reads as zero
+
+	x, y    float32
+	radius  float32
+	base    *UIButton
+	knob    *UIButton
+	touchID uint64
+	active  bool
+	dx, dy  float32 // Knob offset from the center, at most radius long
+}
+
+// Default joystick colors, see SetColors
+var (
+	JoystickBaseColor = UIColor{1.0, 1.0, 1.0, 0.15}
+	JoystickKnobColor = UIColor{1.0, 1.0, 1.0, 0.4}
+)
+
+// NewVirtualJoystick creates a joystick centered at x, y (window coordinates) whose knob
+// moves up to radius away from the center
+func NewVirtualJoystick(x, y, radius float32) *VirtualJoystick {
+	j := &VirtualJoystick{DeadZone: 0.15, x: x, y: y, radius: radius}
+	j.base = CreateUIButton(x-radius, y-radius, radius*2, radius*2,
+		JoystickBaseColor, JoystickBaseColor, JoystickBaseColor)
+	j.knob = CreateUIButton(x-radius/2, y-radius/2, radius, radius,
+		JoystickKnobColor, JoystickKnobColor, JoystickKnobColor)
+	return j
+}
+
+// Update follows the finger driving the joystick, or picks up one that went down inside
+// the base
+func (j *VirtualJoystick) Update(input *Input) {
+	touches := input.GetTouches()
+
+	if j.active {
+		j.active = false
+		for _, touch := range touches {
+			if touch.ID == j.touchID {
+				j.active = true
+				j.moveKnob(touch.X-j.x, touch.Y-j.y)
+				break
+			}
+		}
+	}
+
+	if !j.active {
+		for _, touch := range touches {
+			if j.inside(touch.StartX, touch.StartY) {
+				j.active = true
+				j.touchID = touch.ID
+				j.moveKnob(touch.X-j.x, touch.Y-j.y)
+				break
+			}
+		}
+	}
+
+	if !j.active {
+		j.moveKnob(0, 0)
+	}
+}
+
+// Axis returns the stick position from -1 to 1 on each axis, with y pointing down like
+// window coordinates, and zero inside the dead zone
+func (j *VirtualJoystick) Axis() (x, y float32) {
+	if j.radius <= 0 {
+		return 0, 0
+	}
+
+	x, y = j.dx/j.radius, j.dy/j.radius
+	length := float32(math.Hypot(float64(x), float64(y)))
+	if length <= j.DeadZone || length == 0 {
+		return 0, 0
+	}
+
+	// Rescale so the edge of the dead zone reads as zero rather than jumping to it
+	scale := (length - j.DeadZone) / (1 - j.DeadZone) / length
+	return x * scale, y * scale
+}
+
+// Active returns whether a finger is driving the joystick
+func (j *VirtualJoystick) Active() bool {
+	return j.active
+}
+
+// SetPosition moves the joystick's center
+func (j *VirtualJoystick) SetPosition(x, y float32) {
+	j.x, j.y = x, y
+	if j.base != nil {
+		j.base.SetPosition(x-j.radius, y-j.radius)
+	}
+	j.moveKnob(j.dx, j.dy)
+}
+
+// SetColors changes the base and knob colors
+func (j *VirtualJoystick) SetColors(base, knob UIColor) {
+	if j.base != nil {
+		j.base.SetColors(base, base, base)
+	}
+	if j.knob != nil {
+		j.knob.SetColors(knob, knob, knob)
+	}
+}
+
+// Destroy removes the joystick's buttons
+func (j *VirtualJoystick) Destroy() {
+	if j.base != nil {
+		j.base.Destroy()
+		j.base = nil
+	}
+	if j.knob != nil {
+		j.knob.Destroy()
+		j.knob = nil
+	}
+	j.active = false
+}
+
+func (j *VirtualJoystick) inside(x, y float32) bool {
+	return math.Hypot(float64(x-j.x), float64(y-j.y)) <= float64(j.radius)
+}
+
+// moveKnob places the knob at an offset from the center, clamped to the radius
+func (j *VirtualJoystick) moveKnob(dx, dy float32) {
+	length := float32(math.Hypot(float64(dx), float64(dy)))
+	if length > j.radius && length > 0 {
+		dx, dy = dx*j.radius/length, dy*j.radius/length
+	}
+	j.dx, j.dy = dx, dy
+
+	if j.knob != nil {
+		j.knob.SetPosition(j.x+dx-j.radius/2, j.y+dy-j.radius/2)
+	}
+}
@@ -0,0 +1,262 @@
+package boulder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// DefaultUndoLimit is how many edits the undo stack keeps
+const DefaultUndoLimit = 100
+
+// worldEdit is a committed transaction: the records of the entities it touched before and
+// after, as world snapshots
+type worldEdit struct {
+	name      string
+	before    []byte // Changed and destroyed entities
+	after     []byte // Changed and created entities
+	created   []EntityID
+	destroyed []EntityID
+}
+
+type editHistory struct {
+	pending string
+	open    bool
+	start   []byte
+	undo    []*worldEdit
+	redo    []*worldEdit
+	limit   int
+}
+
+func (w *World) edits() *editHistory {
+	if w.history == nil {
+		w.history = &editHistory{limit: DefaultUndoLimit}
+	}
+	return w.history
+}
+
+// BeginTransaction starts recording world edits. Transform and physics changes are recorded,
+// as is creating and destroying entities that have them; other components are not.
+func (w *World) BeginTransaction(name string) error {
+	h := w.edits()
+	if h.open {
+		return errors.New("transaction already open: " + h.pending)
+	}
+
+	start, err := w.SaveSnapshot(nil)
+	if err != nil {
+		return err
+	}
+
+	h.pending, h.open, h.start = name, true, start
+	return nil
+}
+
+// InTransaction returns true between BeginTransaction and CommitTransaction or
+// RollbackTransaction
+func (w *World) InTransaction() bool {
+	return w.history != nil && w.history.open
+}
+
+// CommitTransaction ends the transaction and pushes its edits onto the undo stack. Redo is
+// cleared. A transaction that changed nothing is dropped.
+func (w *World) CommitTransaction() error {
+	edit, err := w.closeTransaction()
+	if err != nil || edit == nil {
+		return err
+	}
+
+	h := w.history
+	h.undo = append(h.undo, edit)
+	if len(h.undo) > h.limit {
+		h.undo = h.undo[len(h.undo)-h.limit:]
+	}
+	h.redo = nil
+	return nil
+}
+
+// RollbackTransaction ends the transaction and reverts its edits
+func (w *World) RollbackTransaction() error {
+	edit, err := w.closeTransaction()
+	if err != nil || edit == nil {
+		return err
+	}
+	return w.revertEdit(edit)
+}
+
+// Undo reverts the last committed transaction
+func (w *World) Undo() error {
+	h := w.edits()
+	if h.open {
+		return errors.New("cannot undo during a transaction")
+	}
+	if len(h.undo) == 0 {
+		return errors.New("nothing to undo")
+	}
+
+	edit := h.undo[len(h.undo)-1]
+	if err := w.revertEdit(edit); err != nil {
+		return err
+	}
+	h.undo = h.undo[:len(h.undo)-1]
+	h.redo = append(h.redo, edit)
+	return nil
+}
+
+// Redo reapplies the last undone transaction
+func (w *World) Redo() error {
+	h := w.edits()
+	if h.open {
+		return errors.New("cannot redo during a transaction")
+	}
+	if len(h.redo) == 0 {
+		return errors.New("nothing to redo")
+	}
+
+	edit := h.redo[len(h.redo)-1]
+	if err := w.applyEdit(edit); err != nil {
+		return err
+	}
+	h.redo = h.redo[:len(h.redo)-1]
+	h.undo = append(h.undo, edit)
+	return nil
+}
+
+// CanUndo returns true if there is a transaction to undo
+func (w *World) CanUndo() bool {
+	return w.history != nil && len(w.history.undo) > 0
+}
+
+// CanRedo returns true if there is a transaction to redo
+func (w *World) CanRedo() bool {
+	return w.history != nil && len(w.history.redo) > 0
+}
+
+// GetUndoName returns the name of the transaction Undo would revert
+func (w *World) GetUndoName() string {
+	if !w.CanUndo() {
+		return ""
+	}
+	return w.history.undo[len(w.history.undo)-1].name
+}
+
+// GetRedoName returns the name of the transaction Redo would reapply
+func (w *World) GetRedoName() string {
+	if !w.CanRedo() {
+		return ""
+	}
+	return w.history.redo[len(w.history.redo)-1].name
+}
+
+// SetUndoLimit sets how many transactions the undo stack keeps
+func (w *World) SetUndoLimit(limit int) {
+	h := w.edits()
+	h.limit = max(1, limit)
+	if len(h.undo) > h.limit {
+		h.undo = h.undo[len(h.undo)-h.limit:]
+	}
+}
+
+// ClearHistory empties the undo and redo stacks, e.g. after loading a level
+func (w *World) ClearHistory() {
+	if w.history != nil {
+		w.history.undo = nil
+		w.history.redo = nil
+	}
+}
+
+// closeTransaction diffs the world against the start of the open transaction. Returns nil
+// when nothing changed.
+func (w *World) closeTransaction() (*worldEdit, error) {
+	h := w.edits()
+	if !h.open {
+		return nil, errors.New("no transaction open")
+	}
+	start := h.start
+	h.open, h.start = false, nil
+
+	end, err := w.SaveSnapshot(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := snapshotRecordSize(start)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		if size, err = snapshotRecordSize(end); err != nil {
+			return nil, err
+		}
+	}
+
+	before, beforeOrder, err := snapshotRecords(start, size)
+	if err != nil {
+		return nil, err
+	}
+	after, afterOrder, err := snapshotRecords(end, size)
+	if err != nil {
+		return nil, err
+	}
+
+	edit := &worldEdit{name: h.pending}
+	var beforeRecords, afterRecords [][]byte
+	for _, entity := range beforeOrder {
+		record, ok := after[entity]
+		switch {
+		case !ok:
+			edit.destroyed = append(edit.destroyed, EntityID(entity))
+			beforeRecords = append(beforeRecords, before[entity])
+		case !bytes.Equal(record, before[entity]):
+			beforeRecords = append(beforeRecords, before[entity])
+			afterRecords = append(afterRecords, record)
+		}
+	}
+	for _, entity := range afterOrder {
+		if _, ok := before[entity]; !ok {
+			edit.created = append(edit.created, EntityID(entity))
+			afterRecords = append(afterRecords, after[entity])
+		}
+	}
+
+	if len(beforeRecords) == 0 && len(afterRecords) == 0 {
+		return nil, nil
+	}
+	edit.before = buildSnapshot(start, beforeRecords)
+	edit.after = buildSnapshot(end, afterRecords)
+	return edit, nil
+}
+
+func (w *World) revertEdit(edit *worldEdit) error {
+	for _, entity := range edit.created {
+		w.DestroyEntity(entity)
+	}
+	for _, entity := range edit.destroyed {
+		if err := w.reviveEntity(entity); err != nil {
+			return err
+		}
+	}
+	return w.LoadSnapshot(edit.before)
+}
+
+func (w *World) applyEdit(edit *worldEdit) error {
+	for _, entity := range edit.destroyed {
+		w.DestroyEntity(entity)
+	}
+	for _, entity := range edit.created {
+		if err := w.reviveEntity(entity); err != nil {
+			return err
+		}
+	}
+	return w.LoadSnapshot(edit.after)
+}
+
+// buildSnapshot makes a snapshot holding records, taking the header from template
+func buildSnapshot(template []byte, records [][]byte) []byte {
+	snapshot := append([]byte(nil), template[:snapshotHeaderSize]...)
+	for _, record := range records {
+		snapshot = append(snapshot, record...)
+	}
+	binary.LittleEndian.PutUint32(snapshot[8:], uint32(len(records)))
+	return snapshot
+}
@@ -0,0 +1,198 @@
+package boulder
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TransportConn identifies a connection inside a TransportPlugin
+type TransportConn uint64
+
+// TransportEvent is an event reported by a TransportPlugin. Type is one of
+// NetworkEventConnected, NetworkEventDisconnected or NetworkEventMessage.
+type TransportEvent struct {
+	Type NetworkEventType
+	Conn TransportConn
+	Data []byte
+}
+
+// TransportPlugin is an alternative networking backend (EOS P2P, a console platform relay,
+// plain UDP, ...) that a NetworkSession can use alongside GameNetworkingSockets. Plugin
+// connections get ordinary ConnectionHandles, so messaging, events, control messages and
+// everything built on them (clock sync, replication, rollback) work unchanged.
+//
+// All methods are called from the goroutine that drives the NetworkSession.
+type TransportPlugin interface {
+	// Name identifies the plugin in ConnectTransport and plugin PeerAddresses
+	Name() string
+	// Listen accepts incoming connections on a plugin-specific address
+	Listen(address string) error
+	// Connect starts connecting to a plugin-specific address
+	Connect(address string) (TransportConn, error)
+	// Disconnect closes a connection without reporting a disconnect event
+	Disconnect(conn TransportConn)
+	// Send sends a message; reliable messages must be delivered in order
+	Send(conn TransportConn, data []byte, reliable bool) error
+	// State returns the state of a connection
+	State(conn TransportConn) ConnectionState
+	// Update performs periodic work such as retransmission and timeouts
+	Update()
+	// Poll returns the next pending event, if any
+	Poll() (TransportEvent, bool)
+	// Close shuts the plugin down and releases its resources
+	Close()
+}
+
+// pluginHandleBase is the first ConnectionHandle given to plugin connections, far above
+// the handles assigned by the native session
+const pluginHandleBase ConnectionHandle = 1 << 62
+
+type pluginConnection struct {
+	plugin TransportPlugin
+	conn   TransportConn
+}
+
+// transportPlugins tracks the plugins registered on a session and their connections
+type transportPlugins struct {
+	byName     map[string]TransportPlugin
+	order      []TransportPlugin
+	conns      map[ConnectionHandle]pluginConnection
+	handles    map[pluginConnection]ConnectionHandle
+	nextHandle ConnectionHandle
+}
+
+func newTransportPlugins() *transportPlugins {
+	return &transportPlugins{
+		byName:     make(map[string]TransportPlugin),
+		conns:      make(map[ConnectionHandle]pluginConnection),
+		handles:    make(map[pluginConnection]ConnectionHandle),
+		nextHandle: pluginHandleBase,
+	}
+}
+
+// handleFor returns the session handle of a plugin connection, assigning one if needed
+func (tp *transportPlugins) handleFor(plugin TransportPlugin, conn TransportConn) ConnectionHandle {
+	key := pluginConnection{plugin: plugin, conn: conn}
+	if handle, ok := tp.handles[key]; ok {
+		return handle
+	}
+
+	handle := tp.nextHandle
+	tp.nextHandle++
+	tp.conns[handle] = key
+	tp.handles[key] = handle
+	return handle
+}
+
+func (tp *transportPlugins) remove(handle ConnectionHandle) {
+	if key, ok := tp.conns[handle]; ok {
+		delete(tp.handles, key)
+		delete(tp.conns, handle)
+	}
+}
+
+// lookupPlugin returns the plugin connection behind a handle
+func (ns *NetworkSession) lookupPlugin(conn ConnectionHandle) (pluginConnection, bool) {
+	if ns.plugins == nil {
+		return pluginConnection{}, false
+	}
+	pc, ok := ns.plugins.conns[conn]
+	return pc, ok
+}
+
+// RegisterTransport adds a transport plugin to the session. The session updates, polls
+// and closes the plugin from then on.
+func (ns *NetworkSession) RegisterTransport(plugin TransportPlugin) error {
+	if ns.handle == nil {
+		return errSessionNotInitialized
+	}
+	if plugin == nil || plugin.Name() == "" {
+		return errors.New("transport plugin must have a name")
+	}
+
+	if ns.plugins == nil {
+		ns.plugins = newTransportPlugins()
+	}
+	if _, exists := ns.plugins.byName[plugin.Name()]; exists {
+		return fmt.Errorf("transport %q already registered", plugin.Name())
+	}
+
+	ns.plugins.byName[plugin.Name()] = plugin
+	ns.plugins.order = append(ns.plugins.order, plugin)
+	return nil
+}
+
+// GetTransport returns a registered transport plugin by name, or nil
+func (ns *NetworkSession) GetTransport(name string) TransportPlugin {
+	if ns.plugins == nil {
+		return nil
+	}
+	return ns.plugins.byName[name]
+}
+
+// ListenTransport accepts connections through a registered transport plugin
+func (ns *NetworkSession) ListenTransport(name, address string) error {
+	plugin := ns.GetTransport(name)
+	if plugin == nil {
+		return fmt.Errorf("transport %q not registered", name)
+	}
+
+	return plugin.Listen(address)
+}
+
+// ConnectTransport connects to a peer through a registered transport plugin
+func (ns *NetworkSession) ConnectTransport(name, address string) (ConnectionHandle, error) {
+	plugin := ns.GetTransport(name)
+	if plugin == nil {
+		return 0, fmt.Errorf("transport %q not registered", name)
+	}
+
+	conn, err := plugin.Connect(address)
+	if err != nil {
+		return 0, err
+	}
+
+	handle := ns.plugins.handleFor(plugin, conn)
+	ns.markOutgoing(handle)
+	return handle, nil
+}
+
+// updatePlugins runs periodic plugin work
+func (ns *NetworkSession) updatePlugins() {
+	if ns.plugins == nil {
+		return
+	}
+	for _, plugin := range ns.plugins.order {
+		plugin.Update()
+	}
+}
+
+// pollPlugins returns the next event from any plugin, translated to a session handle
+func (ns *NetworkSession) pollPlugins() (NetworkEventType, ConnectionHandle, []byte, bool) {
+	if ns.plugins == nil {
+		return NetworkEventNone, 0, nil, false
+	}
+
+	for _, plugin := range ns.plugins.order {
+		event, ok := plugin.Poll()
+		if !ok {
+			continue
+		}
+
+		handle := ns.plugins.handleFor(plugin, event.Conn)
+		return event.Type, handle, event.Data, true
+	}
+
+	return NetworkEventNone, 0, nil, false
+}
+
+// closePlugins shuts down every registered plugin
+func (ns *NetworkSession) closePlugins() {
+	if ns.plugins == nil {
+		return
+	}
+	for _, plugin := range ns.plugins.order {
+		plugin.Close()
+	}
+	ns.plugins = nil
+}
@@ -0,0 +1,375 @@
+package boulder
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+// Reference UDP transport timing and limits
+const (
+	udpMaxPacket         = 1200
+	udpHeaderSize        = 5 // Packet type and sequence number
+	udpResendInterval    = 200 * time.Millisecond
+	udpKeepAliveInterval = time.Second
+	udpTimeout           = 10 * time.Second
+)
+
+type udpPacketType byte
+
+const (
+	udpConnect    udpPacketType = 1
+	udpAccept     udpPacketType = 2
+	udpUnreliable udpPacketType = 3
+	udpReliable   udpPacketType = 4
+	udpAck        udpPacketType = 5
+	udpDisconnect udpPacketType = 6
+	udpKeepAlive  udpPacketType = 7
+)
+
+type udpPacket struct {
+	from *net.UDPAddr
+	data []byte
+}
+
+type udpPending struct {
+	packet   []byte
+	lastSent time.Time
+}
+
+type udpConnection struct {
+	id           TransportConn
+	addr         *net.UDPAddr
+	state        ConnectionState
+	lastReceived time.Time
+	lastSent     time.Time
+
+	nextSendSeq uint32
+	unacked     map[uint32]*udpPending
+	nextRecvSeq uint32
+	outOfOrder  map[uint32][]byte
+}
+
+// UDPTransport is a reference TransportPlugin that sends messages over plain UDP. Reliable
+// messages are acknowledged, retransmitted and delivered in order; unreliable messages are
+// sent as single datagrams. Messages are limited to a single packet (about 1 KB) and traffic
+// is neither encrypted nor authenticated, so it is meant for LAN play, tests, and as a
+// starting point for platform transports rather than for public servers.
+type UDPTransport struct {
+	socket    *net.UDPConn
+	listening bool
+	incoming  chan udpPacket
+	done      chan struct{}
+
+	conns    map[TransportConn]*udpConnection
+	byAddr   map[string]*udpConnection
+	nextConn TransportConn
+	events   []TransportEvent
+}
+
+// NewUDPTransport creates a UDP transport. Register it with NetworkSession.RegisterTransport.
+func NewUDPTransport() *UDPTransport {
+	return &UDPTransport{
+		conns:    make(map[TransportConn]*udpConnection),
+		byAddr:   make(map[string]*udpConnection),
+		nextConn: 1,
+	}
+}
+
+// Name returns "udp"
+func (t *UDPTransport) Name() string {
+	return "udp"
+}
+
+// Listen accepts connections on a local address such as ":27020"
+func (t *UDPTransport) Listen(address string) error {
+	if t.socket != nil {
+		return errors.New("udp transport already bound")
+	}
+	if err := t.open(address); err != nil {
+		return err
+	}
+
+	t.listening = true
+	return nil
+}
+
+// Connect starts connecting to a remote "host:port"
+func (t *UDPTransport) Connect(address string) (TransportConn, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return 0, err
+	}
+	if t.socket == nil {
+		if err := t.open(":0"); err != nil {
+			return 0, err
+		}
+	}
+	if _, exists := t.byAddr[addr.String()]; exists {
+		return 0, errors.New("already connected to " + addr.String())
+	}
+
+	c := t.addConnection(addr, ConnectionStateConnecting)
+	t.write(c, udpConnect, 0, nil)
+	return c.id, nil
+}
+
+// Disconnect closes a connection and notifies the peer
+func (t *UDPTransport) Disconnect(conn TransportConn) {
+	c, ok := t.conns[conn]
+	if !ok {
+		return
+	}
+
+	t.write(c, udpDisconnect, 0, nil)
+	t.removeConnection(c)
+}
+
+// Send sends a message to a connected peer
+func (t *UDPTransport) Send(conn TransportConn, data []byte, reliable bool) error {
+	c, ok := t.conns[conn]
+	if !ok || c.state != ConnectionStateConnected {
+		return errors.New("connection not established")
+	}
+	if udpHeaderSize+len(data) > udpMaxPacket {
+		return errors.New("message too large for udp transport")
+	}
+
+	if !reliable {
+		t.write(c, udpUnreliable, 0, data)
+		return nil
+	}
+
+	seq := c.nextSendSeq
+	c.nextSendSeq++
+	packet := t.write(c, udpReliable, seq, data)
+	c.unacked[seq] = &udpPending{packet: packet, lastSent: c.lastSent}
+	return nil
+}
+
+// State returns the state of a connection
+func (t *UDPTransport) State(conn TransportConn) ConnectionState {
+	if c, ok := t.conns[conn]; ok {
+		return c.state
+	}
+	return ConnectionStateNone
+}
+
+// Update processes received packets, retransmits unacknowledged messages and detects
+// timed out connections
+func (t *UDPTransport) Update() {
+	t.receive()
+
+	now := time.Now()
+	for _, c := range t.conns {
+		if now.Sub(c.lastReceived) > udpTimeout {
+			c.state = ConnectionStateProblemDetectedLocally
+			t.events = append(t.events, TransportEvent{Type: NetworkEventDisconnected, Conn: c.id})
+			t.removeConnection(c)
+			continue
+		}
+
+		if c.state == ConnectionStateConnecting {
+			if now.Sub(c.lastSent) >= udpResendInterval {
+				t.write(c, udpConnect, 0, nil)
+			}
+			continue
+		}
+
+		for _, pending := range c.unacked {
+			if now.Sub(pending.lastSent) >= udpResendInterval {
+				t.socket.WriteToUDP(pending.packet, c.addr)
+				pending.lastSent = now
+				c.lastSent = now
+			}
+		}
+		if now.Sub(c.lastSent) >= udpKeepAliveInterval {
+			t.write(c, udpKeepAlive, 0, nil)
+		}
+	}
+}
+
+// Poll returns the next pending event
+func (t *UDPTransport) Poll() (TransportEvent, bool) {
+	if len(t.events) == 0 {
+		t.receive()
+	}
+	if len(t.events) == 0 {
+		return TransportEvent{}, false
+	}
+
+	event := t.events[0]
+	t.events = t.events[1:]
+	return event, true
+}
+
+// Close disconnects every peer and closes the socket
+func (t *UDPTransport) Close() {
+	if t.socket == nil {
+		return
+	}
+
+	for _, c := range t.conns {
+		t.write(c, udpDisconnect, 0, nil)
+		t.removeConnection(c)
+	}
+
+	close(t.done)
+	t.socket.Close()
+	t.socket = nil
+	t.listening = false
+	t.events = nil
+}
+
+// open binds the socket and starts the goroutine that reads from it
+func (t *UDPTransport) open(address string) error {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return err
+	}
+	socket, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	t.socket = socket
+	t.incoming = make(chan udpPacket, 256)
+	t.done = make(chan struct{})
+	go readUDP(socket, t.incoming, t.done)
+	return nil
+}
+
+// readUDP forwards datagrams to the transport until the socket is closed. Packets are
+// only processed on the goroutine driving the session, so no state is shared.
+func readUDP(socket *net.UDPConn, incoming chan<- udpPacket, done <-chan struct{}) {
+	buf := make([]byte, udpMaxPacket)
+	for {
+		n, from, err := socket.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if n < udpHeaderSize {
+			continue
+		}
+
+		packet := udpPacket{from: from, data: append([]byte(nil), buf[:n]...)}
+		select {
+		case incoming <- packet:
+		case <-done:
+			return
+		}
+	}
+}
+
+func (t *UDPTransport) receive() {
+	for {
+		select {
+		case packet := <-t.incoming:
+			t.handlePacket(packet)
+		default:
+			return
+		}
+	}
+}
+
+func (t *UDPTransport) handlePacket(packet udpPacket) {
+	kind := udpPacketType(packet.data[0])
+	seq := binary.LittleEndian.Uint32(packet.data[1:])
+	payload := packet.data[udpHeaderSize:]
+
+	c, ok := t.byAddr[packet.from.String()]
+	if !ok {
+		if kind != udpConnect || !t.listening {
+			return
+		}
+		c = t.addConnection(packet.from, ConnectionStateConnected)
+		t.events = append(t.events, TransportEvent{Type: NetworkEventConnected, Conn: c.id})
+	}
+	c.lastReceived = time.Now()
+
+	switch kind {
+	case udpConnect:
+		// Also answers retransmitted connects whose accept was lost
+		t.write(c, udpAccept, 0, nil)
+
+	case udpAccept:
+		t.establish(c)
+
+	case udpUnreliable:
+		if c.state == ConnectionStateConnected {
+			t.events = append(t.events, TransportEvent{Type: NetworkEventMessage, Conn: c.id, Data: payload})
+		}
+
+	case udpReliable:
+		// A reliable message proves the peer accepted even if the accept was lost
+		t.establish(c)
+		t.write(c, udpAck, seq, nil)
+		if seq < c.nextRecvSeq {
+			return
+		}
+
+		c.outOfOrder[seq] = payload
+		for {
+			data, ok := c.outOfOrder[c.nextRecvSeq]
+			if !ok {
+				break
+			}
+			delete(c.outOfOrder, c.nextRecvSeq)
+			c.nextRecvSeq++
+			t.events = append(t.events, TransportEvent{Type: NetworkEventMessage, Conn: c.id, Data: data})
+		}
+
+	case udpAck:
+		delete(c.unacked, seq)
+
+	case udpDisconnect:
+		c.state = ConnectionStateClosedByPeer
+		t.events = append(t.events, TransportEvent{Type: NetworkEventDisconnected, Conn: c.id})
+		t.removeConnection(c)
+	}
+}
+
+func (t *UDPTransport) establish(c *udpConnection) {
+	if c.state == ConnectionStateConnecting {
+		c.state = ConnectionStateConnected
+		t.events = append(t.events, TransportEvent{Type: NetworkEventConnected, Conn: c.id})
+	}
+}
+
+func (t *UDPTransport) addConnection(addr *net.UDPAddr, state ConnectionState) *udpConnection {
+	now := time.Now()
+	c := &udpConnection{
+		id:           t.nextConn,
+		addr:         addr,
+		state:        state,
+		lastReceived: now,
+		unacked:      make(map[uint32]*udpPending),
+		outOfOrder:   make(map[uint32][]byte),
+	}
+	t.nextConn++
+
+	t.conns[c.id] = c
+	t.byAddr[addr.String()] = c
+	return c
+}
+
+func (t *UDPTransport) removeConnection(c *udpConnection) {
+	delete(t.conns, c.id)
+	delete(t.byAddr, c.addr.String())
+}
+
+// write sends a packet to a connection and returns it
+func (t *UDPTransport) write(c *udpConnection, kind udpPacketType, seq uint32, payload []byte) []byte {
+	packet := make([]byte, udpHeaderSize, udpHeaderSize+len(payload))
+	packet[0] = byte(kind)
+	binary.LittleEndian.PutUint32(packet[1:], seq)
+	packet = append(packet, payload...)
+
+	t.socket.WriteToUDP(packet, c.addr)
+	c.lastSent = time.Now()
+	return packet
+}
@@ -0,0 +1,344 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import "math"
+
+// Width of the outline drawn around the drop target under a drag
+const dropOutlineWidth = 2
+
+// UIDropAcceptFunc decides whether a target takes a payload, e.g. whether an item fits a
+// slot
+type UIDropAcceptFunc func(payload any, source *UIButton) bool
+
+// UIDropFunc receives a payload dropped on a target that accepted it
+type UIDropFunc func(payload any, source *UIButton)
+
+type dropTarget struct {
+	accept UIDropAcceptFunc
+	drop   UIDropFunc
+}
+
+// UIDragDrop moves payloads between buttons, for inventories and loadouts. Dragging a
+// source with the mouse picks up its payload and shows a preview of the button under the
+// pointer; the target under it is outlined in AcceptColor or RejectColor, and releasing
+// over a target that accepts drops it there. Keyboard and controller players use
+// StartDrag and Drop with the focused button. Call Update once a frame after forwarding
+// mouse input to the UI and before checking sources for clicks: a drag does not click.
+type UIDragDrop struct {
+	Threshold      float32 // Pixels the pointer moves before a press becomes a drag
+	PreviewOpacity float32
+	AcceptColor    UIColor
+	RejectColor    UIColor
+
+	sources map[C.UIButtonID]func() any
+	targets map[C.UIButtonID]dropTarget
+	onEnd   func(payload any, dropped bool)
+
+	candidate      C.UIButtonID // Source pressed but not dragged far enough yet
+	pressX, pressY float32
+	source         *UIButton
+	payload        any
+	byPointer      bool
+	grabX, grabY   float32 // Where the source was grabbed, from its corner
+	target         C.UIButtonID
+	suppressClicks int // Frames left in which the source's click is dropped
+
+	outline *UIProgressBar // Progress bars draw over buttons and never take input
+	preview *UIProgressBar
+}
+
+// NewUIDragDrop creates a drag and drop controller with no sources or targets
+func NewUIDragDrop() *UIDragDrop {
+	return &UIDragDrop{
+		Threshold:      6,
+		PreviewOpacity: 0.75,
+		AcceptColor:    UIColor{0.3, 0.9, 0.4, 1.0},
+		RejectColor:    UIColor{0.9, 0.3, 0.3, 1.0},
+		sources:        make(map[C.UIButtonID]func() any),
+		targets:        make(map[C.UIButtonID]dropTarget),
+	}
+}
+
+// Destroy cancels a drag and removes the preview
+func (d *UIDragDrop) Destroy() {
+	d.Cancel()
+	if d.outline != nil {
+		d.outline.Destroy()
+		d.outline = nil
+	}
+	if d.preview != nil {
+		d.preview.Destroy()
+		d.preview = nil
+	}
+}
+
+// AddSource lets a button be dragged. payload is called as the drag starts; returning nil
+// leaves the button where it is, e.g. for an empty slot.
+func (d *UIDragDrop) AddSource(button *UIButton, payload func() any) {
+	if button != nil && button.id != 0 && payload != nil {
+		d.sources[button.id] = payload
+	}
+}
+
+// RemoveSource stops a button from being dragged
+func (d *UIDragDrop) RemoveSource(button *UIButton) {
+	if button != nil {
+		delete(d.sources, button.id)
+	}
+}
+
+// AddTarget lets payloads be dropped on a button. accept is asked while a payload is over
+// it (nil accepts everything) and drop receives the payloads it accepted.
+func (d *UIDragDrop) AddTarget(button *UIButton, accept UIDropAcceptFunc, drop UIDropFunc) {
+	if button != nil && button.id != 0 && drop != nil {
+		d.targets[button.id] = dropTarget{accept: accept, drop: drop}
+	}
+}
+
+// RemoveTarget stops a button from taking drops
+func (d *UIDragDrop) RemoveTarget(button *UIButton) {
+	if button != nil {
+		delete(d.targets, button.id)
+	}
+}
+
+// OnDragEnd sets a function called when a drag ends, dropped or not, e.g. to put an item
+// back in its slot
+func (d *UIDragDrop) OnDragEnd(callback func(payload any, dropped bool)) {
+	d.onEnd = callback
+}
+
+// IsDragging returns whether a payload is being dragged
+func (d *UIDragDrop) IsDragging() bool {
+	return d.source != nil
+}
+
+// GetPayload returns what is being dragged and the button it came from
+func (d *UIDragDrop) GetPayload() (payload any, source *UIButton) {
+	return d.payload, d.source
+}
+
+// GetPreviewBounds returns where the drag preview is, for drawing the payload's icon or
+// text on top
+func (d *UIDragDrop) GetPreviewBounds() (x, y, width, height float32, ok bool) {
+	if d.source == nil {
+		return 0, 0, 0, 0, false
+	}
+	x, y = d.previewPosition()
+	width, height = d.source.GetSize()
+	return x, y, width, height, true
+}
+
+// StartDrag picks up a source's payload without the mouse, for keyboard and controller
+// players, e.g. when it is activated with UINavigator. The preview follows the focused
+// button and Drop puts the payload on it. It returns whether a drag started.
+func (d *UIDragDrop) StartDrag(source *UIButton) bool {
+	if d.source != nil || source == nil {
+		return false
+	}
+	return d.begin(source, false, 0, 0)
+}
+
+// Drop puts the payload on the focused button if it is a target that accepts it, ending
+// a drag started with StartDrag. It returns whether the payload was dropped.
+func (d *UIDragDrop) Drop() bool {
+	if d.source == nil {
+		return false
+	}
+	return d.finish(C.boulder_ui_get_focused_button())
+}
+
+// Cancel ends a drag without dropping
+func (d *UIDragDrop) Cancel() {
+	if d.source != nil {
+		d.end(false)
+	}
+}
+
+// Update follows the pointer: it starts drags from sources, moves the preview, outlines
+// the target under it and drops on release
+func (d *UIDragDrop) Update(input *Input) {
+	if !input.engine.initialized {
+		return
+	}
+
+	mouseDown := input.IsMouseButtonPressed(MouseButtonLeft)
+	mouseX, mouseY := input.GetMousePosition()
+
+	if d.source == nil {
+		pressed := C.boulder_ui_get_pressed_button()
+		switch {
+		case !mouseDown || d.sources[pressed] == nil:
+			d.candidate = 0
+		case d.candidate != pressed:
+			d.candidate = pressed
+			d.pressX, d.pressY = mouseX, mouseY
+		case math.Hypot(float64(mouseX-d.pressX), float64(mouseY-d.pressY)) >= float64(d.Threshold):
+			d.candidate = 0
+			d.begin(&UIButton{id: pressed}, true, mouseX, mouseY)
+		}
+	}
+
+	if d.source != nil {
+		if !d.byPointer {
+			d.hover(C.boulder_ui_get_focused_button())
+		} else if mouseDown {
+			d.hover(C.boulder_ui_get_hovered_button())
+		} else {
+			// The release may come before or after the UI saw the pointer's last move
+			target := C.boulder_ui_get_hovered_button()
+			if target == 0 {
+				target = d.target
+			}
+			d.finish(target)
+		}
+		d.updatePreview()
+	}
+
+	dragging := d.source != nil && d.byPointer
+	if dragging || d.suppressClicks > 0 {
+		for id := range d.sources {
+			(&UIButton{id: id}).ResetClick()
+		}
+		if !dragging {
+			d.suppressClicks--
+		}
+	}
+}
+
+// begin picks up a source's payload, returning false if it has none
+func (d *UIDragDrop) begin(source *UIButton, byPointer bool, pointerX, pointerY float32) bool {
+	build := d.sources[source.id]
+	if build == nil {
+		return false
+	}
+	var payload any
+	runCallback("drag payload", func() { payload = build() })
+	if payload == nil {
+		return false
+	}
+
+	d.source, d.payload, d.byPointer = source, payload, byPointer
+	d.target = 0
+	if byPointer {
+		x, y := source.GetPosition()
+		d.grabX, d.grabY = pointerX-x, pointerY-y
+	}
+
+	if d.outline == nil {
+		d.outline = CreateUIProgressBar(0, 0, 0, 0)
+	}
+	if d.preview == nil {
+		d.preview = CreateUIProgressBar(0, 0, 0, 0)
+	}
+	if d.preview != nil {
+		normal, _, _ := source.GetColors()
+		d.preview.SetColors(normal, normal, normal)
+		d.preview.SetStyle(source.GetStyle())
+		d.preview.SetOpacity(d.PreviewOpacity)
+		d.preview.SetVisible(true)
+	}
+	d.updatePreview()
+	return true
+}
+
+// hover outlines the target under the payload
+func (d *UIDragDrop) hover(target C.UIButtonID) {
+	if target == d.target {
+		return
+	}
+	d.target = target
+
+	t, ok := d.targets[target]
+	if !ok || d.outline == nil {
+		if d.outline != nil {
+			d.outline.SetVisible(false)
+		}
+		return
+	}
+
+	color := d.RejectColor
+	if d.accepts(t) {
+		color = d.AcceptColor
+	}
+	button := &UIButton{id: target}
+	x, y := button.GetPosition()
+	width, height := button.GetSize()
+	style := button.GetStyle()
+	if style.CornerRadius > 0 {
+		style.CornerRadius += dropOutlineWidth
+	}
+
+	d.outline.SetBounds(x-dropOutlineWidth, y-dropOutlineWidth, width+2*dropOutlineWidth, height+2*dropOutlineWidth)
+	d.outline.SetColors(UIColor{}, UIColor{}, UIColor{})
+	d.outline.SetStyle(UIStyle{CornerRadius: style.CornerRadius, BorderWidth: dropOutlineWidth, BorderColor: color})
+	d.outline.SetVisible(true)
+}
+
+func (d *UIDragDrop) accepts(t dropTarget) bool {
+	if t.accept == nil {
+		return true
+	}
+	accepted := false
+	runCallback("drop accept", func() { accepted = t.accept(d.payload, d.source) })
+	return accepted
+}
+
+// finish drops on a target that accepts the payload and ends the drag
+func (d *UIDragDrop) finish(target C.UIButtonID) bool {
+	t, ok := d.targets[target]
+	dropped := ok && d.accepts(t)
+	if dropped {
+		payload, source := d.payload, d.source
+		runCallback("drop", func() { t.drop(payload, source) })
+	}
+	d.end(dropped)
+	return dropped
+}
+
+func (d *UIDragDrop) end(dropped bool) {
+	if d.byPointer {
+		// The release may reach the UI this frame or the next
+		d.suppressClicks = 2
+	}
+	payload := d.payload
+	d.source, d.payload, d.target = nil, nil, 0
+	if d.outline != nil {
+		d.outline.SetVisible(false)
+	}
+	if d.preview != nil {
+		d.preview.SetVisible(false)
+	}
+	if d.onEnd != nil {
+		runCallback("drag end", func() { d.onEnd(payload, dropped) })
+	}
+}
+
+// previewPosition returns where the preview goes: under the pointer where the source was
+// grabbed, or offset over the focused button without a pointer
+func (d *UIDragDrop) previewPosition() (x, y float32) {
+	if d.byPointer {
+		var cX, cY C.float
+		C.boulder_get_mouse_position(&cX, &cY)
+		return float32(cX) - d.grabX, float32(cY) - d.grabY
+	}
+
+	anchor := d.source
+	if focused := C.boulder_ui_get_focused_button(); focused != 0 {
+		anchor = &UIButton{id: focused}
+	}
+	x, y = anchor.GetPosition()
+	return x + 8, y + 8
+}
+
+func (d *UIDragDrop) updatePreview() {
+	if d.preview == nil || d.source == nil {
+		return
+	}
+	x, y := d.previewPosition()
+	width, height := d.source.GetSize()
+	d.preview.SetBounds(x, y, width, height)
+}
@@ -0,0 +1,249 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"slices"
+	"time"
+)
+
+// FocusDirection is where UIMoveFocus moves focus
+type FocusDirection int
+
+const (
+	FocusUp       FocusDirection = 0
+	FocusDown     FocusDirection = 1
+	FocusLeft     FocusDirection = 2
+	FocusRight    FocusDirection = 3
+	FocusNext     FocusDirection = 4 // Reading order: by container, then top to bottom and left to right
+	FocusPrevious FocusDirection = 5
+
+	focusNone FocusDirection = -1
+)
+
+// UIMoveFocus moves focus to the nearest focusable button in a direction, or along the
+// reading order, and shows a ring around it until the mouse moves. With nothing focused
+// yet it focuses the first button. It returns whether focus moved.
+func UIMoveFocus(direction FocusDirection) bool {
+	return C.boulder_ui_move_focus(C.int(direction)) != 0
+}
+
+// UISetFocus focuses a button, e.g. the first item when a menu opens; nil clears focus
+func UISetFocus(button *UIButton) {
+	var id C.UIButtonID
+	if button != nil {
+		id = button.id
+	}
+	C.boulder_ui_set_focus(id)
+}
+
+// UIActivateFocused clicks the focused button, so WasClicked reports it as if it had
+// been clicked with the mouse. It returns whether there was an enabled button to click.
+func UIActivateFocused() bool {
+	return C.boulder_ui_activate_focused() != 0
+}
+
+// UISetFocusColor sets the color of the ring around a button focused by navigation
+func UISetFocusColor(color UIColor) {
+	C.boulder_ui_set_focus_color(C.float(color.R), C.float(color.G), C.float(color.B), C.float(color.A))
+}
+
+// IsFocused returns whether the button has focus
+func (b *UIButton) IsFocused() bool {
+	return b.id != 0 && C.boulder_ui_get_focused_button() == b.id
+}
+
+// SetFocusable sets whether navigation stops on the button; buttons are focusable when
+// created, and disabled ones are always skipped
+func (b *UIButton) SetFocusable(focusable bool) {
+	if b.id != 0 {
+		cFocusable := C.int(0)
+		if focusable {
+			cFocusable = 1
+		}
+		C.boulder_ui_set_button_focusable(b.id, cFocusable)
+	}
+}
+
+// UIContainer groups buttons that belong together, such as a menu or a panel, for focus
+// order: FocusNext goes through a container's buttons before those of the next container
+// (in creation order), and directional moves stay in the container while it has a button
+// that way. Buttons outside any container come first.
+type UIContainer struct {
+	id         C.UIContainerID
+	buttons    []*UIButton
+	labels     []*UILabel
+	rest       map[*UIButton][2]float32 // Positions to return to while a transition runs
+	transition []*Tween
+}
+
+// CreateUIContainer creates an empty container
+func CreateUIContainer() *UIContainer {
+	id := C.boulder_ui_create_container()
+	if id == 0 {
+		return nil
+	}
+	return &UIContainer{id: id}
+}
+
+// Add moves buttons into the container
+func (c *UIContainer) Add(buttons ...*UIButton) {
+	if c.id == 0 {
+		return
+	}
+	for _, b := range buttons {
+		if b == nil || b.id == 0 || slices.Contains(c.buttons, b) {
+			continue
+		}
+		C.boulder_ui_set_button_container(b.id, c.id)
+		c.buttons = append(c.buttons, b)
+	}
+}
+
+// Remove takes buttons out of the container
+func (c *UIContainer) Remove(buttons ...*UIButton) {
+	for _, b := range buttons {
+		if b != nil && b.id != 0 {
+			C.boulder_ui_set_button_container(b.id, 0)
+		}
+		c.buttons = slices.DeleteFunc(c.buttons, func(other *UIButton) bool { return other == b })
+	}
+}
+
+// AddLabels moves labels into the container, so they are drawn with its buttons when it
+// is modal (see UIPushModal)
+func (c *UIContainer) AddLabels(labels ...*UILabel) {
+	if c.id == 0 {
+		return
+	}
+	for _, l := range labels {
+		if l == nil || l.id == 0 || slices.Contains(c.labels, l) {
+			continue
+		}
+		C.boulder_ui_set_label_container(l.id, c.id)
+		c.labels = append(c.labels, l)
+	}
+}
+
+// RemoveLabels takes labels out of the container
+func (c *UIContainer) RemoveLabels(labels ...*UILabel) {
+	for _, l := range labels {
+		if l != nil && l.id != 0 {
+			C.boulder_ui_set_label_container(l.id, 0)
+		}
+		c.labels = slices.DeleteFunc(c.labels, func(other *UILabel) bool { return other == l })
+	}
+}
+
+// GetButtons returns the buttons in the container, in the order they were added
+func (c *UIContainer) GetButtons() []*UIButton {
+	return slices.Clone(c.buttons)
+}
+
+// Destroy removes the container, closing it if it is modal; its buttons and labels are
+// kept, outside any container
+func (c *UIContainer) Destroy() {
+	if c.id != 0 {
+		UIPopModal(c)
+		C.boulder_ui_destroy_container(c.id)
+		c.id = 0
+		c.buttons = nil
+		c.labels = nil
+	}
+}
+
+// UINavigator drives UI focus from the keyboard and controllers, for controller-only
+// play: the arrow keys, the d-pad and left stick of any controller move focus, Tab and
+// Shift+Tab go through the reading order, and Enter, Space or the south button (A on
+// Xbox) activate. A held direction repeats.
+type UINavigator struct {
+	RepeatDelay    time.Duration // Before a held direction starts repeating
+	RepeatInterval time.Duration
+	StickThreshold float32 // How far the stick must be pushed to count as a direction
+
+	held            FocusDirection
+	repeatIn        time.Duration
+	activateWasDown bool
+}
+
+// NewUINavigator returns a UINavigator with the usual repeat timings
+func NewUINavigator() *UINavigator {
+	return &UINavigator{
+		RepeatDelay:    400 * time.Millisecond,
+		RepeatInterval: 120 * time.Millisecond,
+		StickThreshold: 0.5,
+		held:           focusNone,
+	}
+}
+
+// Update moves focus and activates buttons from the current input. Call it once a frame
+// after Window.PollEvents; it returns whether a button was activated.
+func (n *UINavigator) Update(input *Input, deltaTime float32) bool {
+	if !input.engine.initialized {
+		return false
+	}
+
+	controllers := input.GetControllers()
+	direction := n.direction(input, controllers)
+	if direction != n.held {
+		n.held = direction
+		if direction != focusNone {
+			UIMoveFocus(direction)
+			n.repeatIn = n.RepeatDelay
+		}
+	} else if direction != focusNone {
+		n.repeatIn -= time.Duration(float64(deltaTime) * float64(time.Second))
+		if n.repeatIn <= 0 {
+			UIMoveFocus(direction)
+			n.repeatIn += n.RepeatInterval
+		}
+	}
+
+	activateDown := input.IsKeyPressed(KeyReturn) || input.IsKeyPressed(KeySpace)
+	for _, c := range controllers {
+		activateDown = activateDown || c.IsButtonPressed(ButtonSouth)
+	}
+	activated := false
+	if activateDown && !n.activateWasDown {
+		activated = UIActivateFocused()
+	}
+	n.activateWasDown = activateDown
+	return activated
+}
+
+// direction returns the direction being held, focusNone if none
+func (n *UINavigator) direction(input *Input, controllers []*Controller) FocusDirection {
+	if input.IsKeyPressed(KeyTab) {
+		if input.IsKeyPressed(KeyLShift) || input.IsKeyPressed(KeyRShift) {
+			return FocusPrevious
+		}
+		return FocusNext
+	}
+
+	up := input.IsKeyPressed(KeyUp)
+	down := input.IsKeyPressed(KeyDown)
+	left := input.IsKeyPressed(KeyLeft)
+	right := input.IsKeyPressed(KeyRight)
+	for _, c := range controllers {
+		x, y := c.GetAxis(AxisLeftX), c.GetAxis(AxisLeftY)
+		up = up || c.IsButtonPressed(ButtonDPadUp) || y <= -n.StickThreshold
+		down = down || c.IsButtonPressed(ButtonDPadDown) || y >= n.StickThreshold
+		left = left || c.IsButtonPressed(ButtonDPadLeft) || x <= -n.StickThreshold
+		right = right || c.IsButtonPressed(ButtonDPadRight) || x >= n.StickThreshold
+	}
+
+	switch {
+	case up && !down:
+		return FocusUp
+	case down && !up:
+		return FocusDown
+	case left && !right:
+		return FocusLeft
+	case right && !left:
+		return FocusRight
+	default:
+		return focusNone
+	}
+}
@@ -0,0 +1,271 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"slices"
+	"unsafe"
+)
+
+// MessageBoxKind is the icon a native message box shows
+type MessageBoxKind int
+
+const (
+	MessageBoxInfo    MessageBoxKind = 0
+	MessageBoxWarning MessageBoxKind = 1
+	MessageBoxError   MessageBoxKind = 2
+)
+
+// ShowNativeMessageBox shows the platform's own message box and blocks until it is closed,
+// returning the index of the button pressed. It works before Init and without a renderer,
+// e.g. to report a fatal error at startup. The first button is the default for Enter and
+// the last for Escape; with no buttons there is a single "OK".
+func ShowNativeMessageBox(kind MessageBoxKind, title, text string, buttons ...string) (int, error) {
+	defer lockThread()()
+	if len(buttons) == 0 {
+		buttons = []string{"OK"}
+	}
+
+	cTitle := C.CString(title)
+	defer C.free(unsafe.Pointer(cTitle))
+	cText := C.CString(text)
+	defer C.free(unsafe.Pointer(cText))
+
+	cButtons := make([]*C.char, len(buttons))
+	for i, b := range buttons {
+		cButtons[i] = C.CString(b)
+	}
+	defer freeCStrings(cButtons)
+
+	pressed := int(C.boulder_show_message_box(C.int(kind), cTitle, cText, cStringArray(cButtons), C.int(len(buttons))))
+	if pressed < 0 {
+		return -1, lastError("failed to show message box")
+	}
+	return pressed, nil
+}
+
+// A modal container with what to restore when it closes
+type uiModal struct {
+	container *UIContainer
+	dim       UIColor
+	focus     C.UIButtonID // Focused when the modal opened
+}
+
+var uiModals []uiModal // Topmost last
+
+// UIPushModal makes a container modal: only its buttons can be hovered, clicked and
+// focused, and everything else is drawn under dim (e.g. translucent black) with the
+// container's buttons and labels on top. Modals stack, so a confirmation can open over a
+// settings dialog; the topmost one takes input.
+func UIPushModal(container *UIContainer, dim UIColor) {
+	if container == nil || container.id == 0 {
+		return
+	}
+
+	UIPopModal(container)
+	uiModals = append(uiModals, uiModal{
+		container: container,
+		dim:       dim,
+		focus:     C.boulder_ui_get_focused_button(),
+	})
+	setUIModal(container.id, dim)
+}
+
+// UIPopModal closes a modal container wherever it is in the stack. When it was the
+// topmost, the one below takes input again and focus goes back to the button focused when
+// it opened.
+func UIPopModal(container *UIContainer) {
+	index := slices.IndexFunc(uiModals, func(m uiModal) bool { return m.container == container })
+	if index < 0 {
+		return
+	}
+
+	closed := uiModals[index]
+	uiModals = slices.Delete(uiModals, index, index+1)
+	if index < len(uiModals) {
+		return
+	}
+
+	if len(uiModals) == 0 {
+		setUIModal(0, UIColor{})
+	} else {
+		top := uiModals[len(uiModals)-1]
+		setUIModal(top.container.id, top.dim)
+	}
+	C.boulder_ui_set_focus(closed.focus)
+}
+
+// UIGetModal returns the modal container taking input, nil if there is none
+func UIGetModal() *UIContainer {
+	if len(uiModals) == 0 {
+		return nil
+	}
+	return uiModals[len(uiModals)-1].container
+}
+
+func setUIModal(id C.UIContainerID, dim UIColor) {
+	cDim := uiColorToC(dim)
+	C.boulder_ui_set_modal(id, &cDim[0])
+}
+
+// UIMessageBox is a modal dialog with a title, text and a row of buttons, shown by
+// UIShowMessageBox. It closes when one of its buttons is clicked or activated.
+type UIMessageBox struct {
+	container *UIContainer
+	panel     *UIButton
+	title     *UILabel
+	text      *UILabel
+	buttons   []*UIButton
+	result    int
+	closed    bool
+}
+
+const (
+	messageBoxPadding      = 20
+	messageBoxMinWidth     = 320
+	messageBoxButtonHeight = 36
+	messageBoxButtonGap    = 10
+)
+
+// UIShowMessageBox opens a modal message box in the middle of the screen, in the current
+// theme and the default font, with the first button focused. Poll Result each frame to
+// find out which button closed it; with no buttons there is a single "OK". Before the UI
+// is up it shows a native message box instead, which blocks and returns the box already
+// closed.
+func UIShowMessageBox(title, text string, buttons ...string) *UIMessageBox {
+	if len(buttons) == 0 {
+		buttons = []string{"OK"}
+	}
+
+	container := CreateUIContainer()
+	if container == nil {
+		pressed, err := ShowNativeMessageBox(MessageBoxInfo, title, text, buttons...)
+		if err != nil {
+			pressed = len(buttons) - 1
+		}
+		return &UIMessageBox{result: pressed, closed: true}
+	}
+
+	titleStyle := DefaultUITextStyle()
+	titleStyle.Size = 22
+	titleStyle.Align = AlignStart
+	textStyle := DefaultUITextStyle()
+	textStyle.Align = AlignStart
+	textStyle.VerticalAlign = AlignStart
+	buttonStyle := DefaultUITextStyle()
+
+	// Size the box to its text and buttons; without a font the measurements are zero
+	titleWidth, titleHeight, _ := MeasureUIText(title, titleStyle)
+	textWidth, textHeight, _ := MeasureUIText(text, textStyle)
+	buttonWidths := make([]float32, len(buttons))
+	var rowWidth float32
+	for i, label := range buttons {
+		w, _, _ := MeasureUIText(label, buttonStyle)
+		buttonWidths[i] = max(w+32, 96)
+		rowWidth += buttonWidths[i]
+	}
+	rowWidth += float32(len(buttons)-1) * messageBoxButtonGap
+
+	width := max(messageBoxMinWidth, titleWidth, textWidth, rowWidth) + 2*messageBoxPadding
+	titleHeight = max(titleHeight, titleStyle.Size)
+	height := messageBoxPadding + titleHeight + messageBoxPadding/2 + textHeight + messageBoxPadding +
+		messageBoxButtonHeight + messageBoxPadding
+
+	var screenWidth, screenHeight C.int
+	C.boulder_get_swapchain_extent(&screenWidth, &screenHeight)
+	x := (float32(screenWidth) - width) / 2
+	y := (float32(screenHeight) - height) / 2
+
+	m := &UIMessageBox{container: container, result: -1}
+
+	// The panel is a button that does nothing, so clicks on it don't reach what is under it
+	theme := UIGetTheme()
+	m.panel = CreateUIButton(x, y, width, height, theme.NormalColor, theme.NormalColor, theme.NormalColor)
+	if m.panel != nil {
+		m.panel.SetStyle(theme.Style)
+		m.panel.SetFocusable(false)
+		container.Add(m.panel)
+	}
+
+	m.title = CreateUILabel(x+messageBoxPadding, y+messageBoxPadding, width-2*messageBoxPadding, titleHeight, title)
+	m.text = CreateUILabel(x+messageBoxPadding, y+messageBoxPadding*1.5+titleHeight,
+		width-2*messageBoxPadding, textHeight, text)
+	for _, label := range []*UILabel{m.title, m.text} {
+		if label != nil {
+			container.AddLabels(label)
+		}
+	}
+	if m.title != nil {
+		m.title.SetTextStyle(titleStyle)
+	}
+	if m.text != nil {
+		m.text.SetTextStyle(textStyle)
+	}
+
+	// Buttons sit in a row at the bottom right
+	buttonX := x + width - messageBoxPadding - rowWidth
+	buttonY := y + height - messageBoxPadding - messageBoxButtonHeight
+	for i, label := range buttons {
+		button := CreateThemedUIButton(buttonX, buttonY, buttonWidths[i], messageBoxButtonHeight)
+		buttonX += buttonWidths[i] + messageBoxButtonGap
+		if button == nil {
+			continue
+		}
+		button.SetText(label)
+		button.SetLabel(label)
+		container.Add(button)
+		m.buttons = append(m.buttons, button)
+	}
+
+	UIPushModal(container, UIColor{0, 0, 0, 0.5})
+	if len(m.buttons) > 0 {
+		UISetFocus(m.buttons[0])
+	}
+	return m
+}
+
+// Result returns the index of the button that closed the box and whether it has closed
+func (m *UIMessageBox) Result() (button int, closed bool) {
+	if !m.closed {
+		for i, b := range m.buttons {
+			if b.WasClicked() {
+				m.Close(i)
+				break
+			}
+		}
+	}
+	return m.result, m.closed
+}
+
+// IsOpen returns whether the box is still showing
+func (m *UIMessageBox) IsOpen() bool {
+	_, closed := m.Result()
+	return !closed
+}
+
+// Close closes the box as if button had been clicked, e.g. the last one when Escape is
+// pressed
+func (m *UIMessageBox) Close(button int) {
+	if m.closed {
+		return
+	}
+
+	m.result = button
+	m.closed = true
+	UIPopModal(m.container)
+	for _, b := range m.buttons {
+		b.Destroy()
+	}
+	m.buttons = nil
+	for _, l := range []*UILabel{m.title, m.text} {
+		if l != nil {
+			l.Destroy()
+		}
+	}
+	if m.panel != nil {
+		m.panel.Destroy()
+	}
+	m.container.Destroy()
+}
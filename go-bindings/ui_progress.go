@@ -0,0 +1,235 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import "time"
+
+// UIFillMode is the direction a progress bar fills in
+type UIFillMode int
+
+const (
+	FillLeftToRight      UIFillMode = 0
+	FillRightToLeft      UIFillMode = 1
+	FillBottomToTop      UIFillMode = 2
+	FillTopToBottom      UIFillMode = 3
+	FillClockwise        UIFillMode = 4 // Radial from the top, drawn as a circle; give the bar a square size
+	FillCounterClockwise UIFillMode = 5
+)
+
+// UIProgressBar shows a value between a minimum and a maximum as a filled bar or circle,
+// for loading screens, cooldowns and the like. Progress bars are drawn over buttons and do
+// not take input.
+type UIProgressBar struct {
+	id         C.UIProgressBarID
+	min, max   float32
+	value      float32
+	trail      float32 // Fraction, see UIHealthBar
+	background UIColor
+	fillStart  UIColor
+	fillEnd    UIColor
+	trailColor UIColor
+}
+
+// CreateUIProgressBar creates an empty bar from 0 to 1 that fills left to right in green
+// on a dark background
+func CreateUIProgressBar(x, y, width, height float32) *UIProgressBar {
+	id := C.boulder_ui_create_progress_bar(C.float(x), C.float(y), C.float(width), C.float(height))
+	if id == 0 {
+		return nil
+	}
+
+	fill := UIColor{0.2, 0.8, 0.3, 1.0}
+	return &UIProgressBar{
+		id:         id,
+		max:        1,
+		background: UIColor{0.1, 0.1, 0.1, 0.8},
+		fillStart:  fill,
+		fillEnd:    fill,
+		trailColor: UIColor{1.0, 1.0, 1.0, 0.6},
+	}
+}
+
+// Destroy removes the bar
+func (b *UIProgressBar) Destroy() {
+	if b.id != 0 {
+		C.boulder_ui_destroy_progress_bar(b.id)
+		b.id = 0
+	}
+}
+
+// SetBounds moves and resizes the bar
+func (b *UIProgressBar) SetBounds(x, y, width, height float32) {
+	if b.id != 0 {
+		C.boulder_ui_set_progress_bar_bounds(b.id, C.float(x), C.float(y), C.float(width), C.float(height))
+	}
+}
+
+// SetRange sets the values shown as empty and full; the value is kept within them
+func (b *UIProgressBar) SetRange(min, max float32) {
+	b.min, b.max = min, max
+	b.SetValue(b.value)
+}
+
+// GetRange returns the values shown as empty and full
+func (b *UIProgressBar) GetRange() (min, max float32) {
+	return b.min, b.max
+}
+
+// SetValue sets how full the bar is, between its minimum and maximum
+func (b *UIProgressBar) SetValue(value float32) {
+	b.value = clampFloat32(value, min(b.min, b.max), max(b.min, b.max))
+	b.update()
+}
+
+// GetValue returns the bar's value
+func (b *UIProgressBar) GetValue() float32 {
+	return b.value
+}
+
+// GetFraction returns how full the bar is, from 0 to 1
+func (b *UIProgressBar) GetFraction() float32 {
+	if b.max == b.min {
+		return 0
+	}
+	return clampFloat32((b.value-b.min)/(b.max-b.min), 0, 1)
+}
+
+// SetFill sets the direction the bar fills in
+func (b *UIProgressBar) SetFill(mode UIFillMode) {
+	if b.id != 0 {
+		C.boulder_ui_set_progress_bar_fill(b.id, C.int(mode))
+	}
+}
+
+// SetColors sets the background and a gradient for the fill, from fillStart at the empty
+// end to fillEnd at the full end (around the circle for radial bars). Pass the same color
+// twice for a solid fill.
+func (b *UIProgressBar) SetColors(background, fillStart, fillEnd UIColor) {
+	b.background, b.fillStart, b.fillEnd = background, fillStart, fillEnd
+	b.updateColors()
+}
+
+// SetFillColor fills the bar with a single color
+func (b *UIProgressBar) SetFillColor(color UIColor) {
+	b.SetColors(b.background, color, color)
+}
+
+// SetStyle sets the bar's corners, border and shadow; the fill sits inside the border
+func (b *UIProgressBar) SetStyle(style UIStyle) {
+	if b.id != 0 {
+		cStyle := style.toC()
+		C.boulder_ui_set_progress_bar_style(b.id, &cStyle)
+	}
+}
+
+// SetOpacity fades the whole bar, from 0 (invisible) to 1
+func (b *UIProgressBar) SetOpacity(opacity float32) {
+	if b.id != 0 {
+		C.boulder_ui_set_progress_bar_opacity(b.id, C.float(opacity))
+	}
+}
+
+// SetVisible shows or hides the bar
+func (b *UIProgressBar) SetVisible(visible bool) {
+	if b.id != 0 {
+		cVisible := C.int(0)
+		if visible {
+			cVisible = 1
+		}
+		C.boulder_ui_set_progress_bar_visible(b.id, cVisible)
+	}
+}
+
+func (b *UIProgressBar) update() {
+	if b.id != 0 {
+		C.boulder_ui_set_progress_bar_value(b.id, C.float(b.GetFraction()), C.float(b.trail))
+	}
+}
+
+func (b *UIProgressBar) updateColors() {
+	if b.id == 0 {
+		return
+	}
+	background := uiColorToC(b.background)
+	fillStart := uiColorToC(b.fillStart)
+	fillEnd := uiColorToC(b.fillEnd)
+	trail := uiColorToC(b.trailColor)
+	C.boulder_ui_set_progress_bar_colors(b.id, &background[0], &fillStart[0], &fillEnd[0], &trail[0])
+}
+
+// UIHealthBar is a progress bar for health. Its color shifts from LowColor to HighColor as
+// health rises, and health just lost stays visible as a trail that catches up after a
+// moment, so players can see how hard they were hit. Call Update once a frame.
+type UIHealthBar struct {
+	*UIProgressBar
+
+	LowColor   UIColor
+	HighColor  UIColor
+	TrailDelay time.Duration // How long lost health stays before the trail starts shrinking
+	TrailSpeed float32       // Fraction of the bar the trail shrinks by per second
+
+	trailWait time.Duration
+}
+
+// CreateUIHealthBar creates a full health bar from 0 to maxHealth, red when low and green
+// when high
+func CreateUIHealthBar(x, y, width, height, maxHealth float32) *UIHealthBar {
+	bar := CreateUIProgressBar(x, y, width, height)
+	if bar == nil {
+		return nil
+	}
+
+	h := &UIHealthBar{
+		UIProgressBar: bar,
+		LowColor:      UIColor{0.85, 0.15, 0.1, 1.0},
+		HighColor:     UIColor{0.2, 0.8, 0.3, 1.0},
+		TrailDelay:    500 * time.Millisecond,
+		TrailSpeed:    0.5,
+	}
+	bar.SetRange(0, maxHealth)
+	h.SetValue(maxHealth)
+	return h
+}
+
+// SetValue sets the health. Lost health is left behind as the trail; healing moves the
+// trail along with it.
+func (h *UIHealthBar) SetValue(health float32) {
+	previous := h.GetFraction()
+	h.UIProgressBar.SetValue(health)
+	fraction := h.GetFraction()
+
+	if fraction < previous {
+		h.trail = max(h.trail, previous)
+		h.trailWait = h.TrailDelay
+	} else {
+		h.trail = fraction
+	}
+
+	color := lerpColor(h.LowColor, h.HighColor, fraction)
+	h.fillStart, h.fillEnd = color, color
+	h.updateColors()
+	h.update()
+}
+
+// SetTrailColor sets the color of health just lost
+func (h *UIHealthBar) SetTrailColor(color UIColor) {
+	h.trailColor = color
+	h.updateColors()
+}
+
+// Update shrinks the trail towards the health once TrailDelay has passed
+func (h *UIHealthBar) Update(deltaTime float32) {
+	fraction := h.GetFraction()
+	if h.trail <= fraction {
+		return
+	}
+
+	if h.trailWait > 0 {
+		h.trailWait -= time.Duration(float64(deltaTime) * float64(time.Second))
+		return
+	}
+	h.trail = max(h.trail-h.TrailSpeed*deltaTime, fraction)
+	h.update()
+}
@@ -0,0 +1,509 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"math"
+	"slices"
+)
+
+const (
+	scrollbarWidth  = 4
+	scrollbarMargin = 2
+	scrollbarMinLen = 16
+	stickDeadzone   = 0.2
+)
+
+// UIScrollView shows buttons laid out on a content area larger than the view, clipped to
+// the view's rectangle. It scrolls with the mouse wheel, by dragging (mouse or touch),
+// with a controller's right stick, and to keep the focused button in view while
+// navigating with UINavigator. Its buttons share a UIContainer so focus goes through them
+// together. For thousands of entries use UIList, which only creates the visible rows.
+type UIScrollView struct {
+	WheelStep     float32 // Pixels per wheel notch
+	StickSpeed    float32 // Pixels per second with the right stick pushed all the way
+	DragThreshold float32 // Pixels the pointer moves before a press becomes a drag
+
+	x, y, width, height         float32
+	contentWidth, contentHeight float32
+	scrollX, scrollY            float32
+
+	container *UIContainer
+	items     []*UIButton
+	offsets   map[*UIButton][2]float32 // Positions on the content area
+	scrollbar *UIButton
+
+	mouseWasDown               bool
+	pressed, dragging          bool
+	pressX, pressY             float32
+	pressScrollX, pressScrollY float32
+	suppressClicks             int // Frames left in which clicks are dropped after a drag
+	lastFocus                  C.UIButtonID
+}
+
+// NewUIScrollView creates an empty scroll view covering a rectangle of the screen
+func NewUIScrollView(x, y, width, height float32) *UIScrollView {
+	container := CreateUIContainer()
+	if container == nil {
+		return nil
+	}
+
+	s := &UIScrollView{
+		WheelStep:     40,
+		StickSpeed:    800,
+		DragThreshold: 8,
+		x:             x,
+		y:             y,
+		width:         width,
+		height:        height,
+		container:     container,
+		offsets:       make(map[*UIButton][2]float32),
+	}
+
+	thumb := UIColor{1.0, 1.0, 1.0, 0.35}
+	s.scrollbar = CreateUIButton(0, 0, scrollbarWidth, scrollbarMinLen, thumb, thumb, thumb)
+	if s.scrollbar != nil {
+		s.scrollbar.SetFocusable(false)
+		s.scrollbar.SetStyle(UIStyle{CornerRadius: scrollbarWidth / 2})
+	}
+	s.updateScrollbar()
+	return s
+}
+
+// Destroy removes the view's container and scrollbar. Its buttons are kept where they
+// are, no longer clipped.
+func (s *UIScrollView) Destroy() {
+	for _, b := range s.items {
+		if b.id != 0 {
+			C.boulder_ui_clear_button_clip(b.id)
+		}
+	}
+	s.items = nil
+	clear(s.offsets)
+	if s.scrollbar != nil {
+		s.scrollbar.Destroy()
+		s.scrollbar = nil
+	}
+	if s.container != nil {
+		s.container.Destroy()
+	}
+}
+
+// Add puts buttons in the view where they are on screen, taking the current scroll into
+// account, and grows the content area to fit them
+func (s *UIScrollView) Add(buttons ...*UIButton) {
+	for _, b := range buttons {
+		if b == nil || b.id == 0 {
+			continue
+		}
+		bx, by := b.GetPosition()
+		bw, bh := b.GetSize()
+		offsetX, offsetY := bx-s.x+s.scrollX, by-s.y+s.scrollY
+		s.contentWidth = max(s.contentWidth, offsetX+bw)
+		s.contentHeight = max(s.contentHeight, offsetY+bh)
+		s.place(b, offsetX, offsetY)
+	}
+	s.updateScrollbar()
+}
+
+// Remove takes buttons out of the view; they stay where they are, no longer clipped
+func (s *UIScrollView) Remove(buttons ...*UIButton) {
+	for _, b := range buttons {
+		if _, ok := s.offsets[b]; !ok {
+			continue
+		}
+		delete(s.offsets, b)
+		s.items = slices.DeleteFunc(s.items, func(other *UIButton) bool { return other == b })
+		s.container.Remove(b)
+		if b.id != 0 {
+			C.boulder_ui_clear_button_clip(b.id)
+		}
+	}
+}
+
+// GetContainer returns the container holding the view's buttons, e.g. for a Transition
+func (s *UIScrollView) GetContainer() *UIContainer {
+	return s.container
+}
+
+// SetContentSize sets the size of the scrollable area, which Add otherwise grows to fit
+// the buttons
+func (s *UIScrollView) SetContentSize(width, height float32) {
+	s.contentWidth, s.contentHeight = width, height
+	s.ScrollTo(s.scrollX, s.scrollY)
+}
+
+// GetContentSize returns the size of the scrollable area
+func (s *UIScrollView) GetContentSize() (width, height float32) {
+	return s.contentWidth, s.contentHeight
+}
+
+// GetViewport returns the rectangle of the screen the view covers
+func (s *UIScrollView) GetViewport() (x, y, width, height float32) {
+	return s.x, s.y, s.width, s.height
+}
+
+// GetScroll returns how far the content is scrolled, in pixels from its top-left corner
+func (s *UIScrollView) GetScroll() (x, y float32) {
+	return s.scrollX, s.scrollY
+}
+
+// ScrollTo scrolls to a position, kept within the content area
+func (s *UIScrollView) ScrollTo(x, y float32) {
+	x = clampFloat32(x, 0, max(s.contentWidth-s.width, 0))
+	y = clampFloat32(y, 0, max(s.contentHeight-s.height, 0))
+	if x == s.scrollX && y == s.scrollY {
+		s.updateScrollbar()
+		return
+	}
+
+	s.scrollX, s.scrollY = x, y
+	for _, b := range s.items {
+		s.position(b)
+	}
+	s.updateScrollbar()
+}
+
+// ScrollBy scrolls by a number of pixels
+func (s *UIScrollView) ScrollBy(dx, dy float32) {
+	s.ScrollTo(s.scrollX+dx, s.scrollY+dy)
+}
+
+// ScrollIntoView scrolls as little as needed to show the whole of a button in the view
+func (s *UIScrollView) ScrollIntoView(button *UIButton) {
+	offset, ok := s.offsets[button]
+	if !ok {
+		return
+	}
+
+	bw, bh := button.GetSize()
+	x, y := s.scrollX, s.scrollY
+	if offset[0] < x {
+		x = offset[0]
+	} else if offset[0]+bw > x+s.width {
+		x = offset[0] + bw - s.width
+	}
+	if offset[1] < y {
+		y = offset[1]
+	} else if offset[1]+bh > y+s.height {
+		y = offset[1] + bh - s.height
+	}
+	s.ScrollTo(x, y)
+}
+
+// Update scrolls from the current input. Call it once a frame after Window.PollEvents and
+// before checking the view's buttons for clicks: releasing a drag over a button does not
+// click it.
+func (s *UIScrollView) Update(input *Input, deltaTime float32) {
+	if !input.engine.initialized {
+		return
+	}
+
+	mouseX, mouseY := input.GetMousePosition()
+	if s.contains(mouseX, mouseY) {
+		wheelX, wheelY := input.GetMouseWheel()
+		if wheelX != 0 || wheelY != 0 {
+			s.ScrollBy(wheelX*s.WheelStep, -wheelY*s.WheelStep)
+		}
+	}
+
+	s.updateDrag(input, mouseX, mouseY)
+
+	var stickX, stickY float32
+	for _, c := range input.GetControllers() {
+		if x := c.GetAxis(AxisRightX); abs32(x) > abs32(stickX) {
+			stickX = x
+		}
+		if y := c.GetAxis(AxisRightY); abs32(y) > abs32(stickY) {
+			stickY = y
+		}
+	}
+	if abs32(stickX) > stickDeadzone || abs32(stickY) > stickDeadzone {
+		step := s.StickSpeed * deltaTime
+		s.ScrollBy(stickX*step, stickY*step)
+	}
+
+	// Follow focus as it moves onto a button, without fighting the stick afterwards
+	if focused := C.boulder_ui_get_focused_button(); focused != s.lastFocus {
+		s.lastFocus = focused
+		if b := s.button(focused); b != nil {
+			s.ScrollIntoView(b)
+		}
+	}
+}
+
+// updateDrag scrolls with a press that moved past DragThreshold, and drops the click that
+// ends it
+func (s *UIScrollView) updateDrag(input *Input, mouseX, mouseY float32) {
+	mouseDown := input.IsMouseButtonPressed(MouseButtonLeft)
+	if mouseDown && !s.mouseWasDown && s.contains(mouseX, mouseY) {
+		s.pressed = true
+		s.pressX, s.pressY = mouseX, mouseY
+		s.pressScrollX, s.pressScrollY = s.scrollX, s.scrollY
+	}
+	s.mouseWasDown = mouseDown
+
+	if s.pressed && mouseDown {
+		dx, dy := mouseX-s.pressX, mouseY-s.pressY
+		if !s.dragging && float32(math.Hypot(float64(dx), float64(dy))) >= s.DragThreshold {
+			s.dragging = true
+		}
+		if s.dragging {
+			s.ScrollTo(s.pressScrollX-dx, s.pressScrollY-dy)
+		}
+	} else if s.pressed {
+		if s.dragging {
+			// The release may reach the UI this frame or the next
+			s.suppressClicks = 2
+		}
+		s.pressed, s.dragging = false, false
+	}
+
+	if s.dragging || s.suppressClicks > 0 {
+		for _, b := range s.items {
+			b.ResetClick()
+		}
+		if !s.dragging {
+			s.suppressClicks--
+		}
+	}
+}
+
+// place puts a button at a position on the content area
+func (s *UIScrollView) place(b *UIButton, offsetX, offsetY float32) {
+	if _, ok := s.offsets[b]; !ok {
+		s.items = append(s.items, b)
+		s.container.Add(b)
+		C.boulder_ui_set_button_clip(b.id, C.float(s.x), C.float(s.y), C.float(s.width), C.float(s.height))
+	}
+	s.offsets[b] = [2]float32{offsetX, offsetY}
+	s.position(b)
+}
+
+func (s *UIScrollView) position(b *UIButton) {
+	offset := s.offsets[b]
+	b.SetPosition(s.x+offset[0]-s.scrollX, s.y+offset[1]-s.scrollY)
+}
+
+func (s *UIScrollView) button(id C.UIButtonID) *UIButton {
+	if id == 0 {
+		return nil
+	}
+	for _, b := range s.items {
+		if b.id == id {
+			return b
+		}
+	}
+	return nil
+}
+
+func (s *UIScrollView) contains(x, y float32) bool {
+	return x >= s.x && x < s.x+s.width && y >= s.y && y < s.y+s.height
+}
+
+// updateScrollbar sizes the thumb to the visible part of the content, hiding it when
+// everything fits
+func (s *UIScrollView) updateScrollbar() {
+	if s.scrollbar == nil {
+		return
+	}
+
+	maxScroll := s.contentHeight - s.height
+	if maxScroll <= 0 {
+		s.scrollbar.SetVisible(false)
+		return
+	}
+
+	length := max(s.height*s.height/s.contentHeight, scrollbarMinLen)
+	thumbY := s.y + (s.height-length)*s.scrollY/maxScroll
+	s.scrollbar.SetPosition(s.x+s.width-scrollbarWidth-scrollbarMargin, thumbY)
+	s.scrollbar.SetSize(scrollbarWidth, length)
+	s.scrollbar.SetVisible(true)
+}
+
+// UIListBinder fills in the row button showing the item at index, e.g. its colors and
+// label. Rows are reused as the list scrolls, so it is called again whenever a row starts
+// showing another item.
+type UIListBinder func(row *UIButton, index int)
+
+// UIList is a scrolling list of rows that only creates buttons for the rows in view (and
+// one beyond each edge, so controller focus can move onto the next row), for server
+// browsers, inventories and chat history with thousands of entries
+type UIList struct {
+	view       *UIScrollView
+	rowWidth   float32
+	rowHeight  float32
+	rowSpacing float32
+	count      int
+	bind       UIListBinder
+
+	rows map[int]*UIButton // Items that have a row, by index
+	free []*UIButton       // Hidden rows waiting for reuse
+}
+
+// NewUIList creates an empty list covering a rectangle of the screen. Rows are created
+// with the current theme (see UISetTheme) and then passed to bind.
+func NewUIList(x, y, width, height, rowHeight, rowSpacing float32, bind UIListBinder) *UIList {
+	view := NewUIScrollView(x, y, width, height)
+	if view == nil {
+		return nil
+	}
+	return &UIList{
+		view: view,
+		// Leave room for the scrollbar so it is not drawn under the rows
+		rowWidth:   width - scrollbarWidth - 2*scrollbarMargin,
+		rowHeight:  rowHeight,
+		rowSpacing: rowSpacing,
+		bind:       bind,
+		rows:       make(map[int]*UIButton),
+	}
+}
+
+// Destroy removes the list and its rows
+func (l *UIList) Destroy() {
+	rows := l.free
+	for _, row := range l.rows {
+		rows = append(rows, row)
+	}
+	l.view.Destroy()
+	for _, row := range rows {
+		row.Destroy()
+	}
+	clear(l.rows)
+	l.free = nil
+}
+
+// GetView returns the scroll view the rows are in
+func (l *UIList) GetView() *UIScrollView {
+	return l.view
+}
+
+// SetCount sets how many items the list has, e.g. after more chat lines arrived
+func (l *UIList) SetCount(count int) {
+	l.count = max(count, 0)
+	l.view.SetContentSize(l.rowWidth, max(float32(l.count)*l.stride()-l.rowSpacing, 0))
+	for index, row := range l.rows {
+		if index >= l.count {
+			l.release(index, row)
+		}
+	}
+	l.updateRows()
+}
+
+// GetCount returns how many items the list has
+func (l *UIList) GetCount() int {
+	return l.count
+}
+
+// Refresh binds every row in view again, after the items they show changed
+func (l *UIList) Refresh() {
+	for index, row := range l.rows {
+		l.bind(row, index)
+	}
+}
+
+// ScrollToIndex scrolls as little as needed to show an item
+func (l *UIList) ScrollToIndex(index int) {
+	if index < 0 || index >= l.count {
+		return
+	}
+	top := float32(index) * l.stride()
+	_, scrollY := l.view.GetScroll()
+	if top < scrollY {
+		l.view.ScrollTo(0, top)
+	} else if top+l.rowHeight > scrollY+l.view.height {
+		l.view.ScrollTo(0, top+l.rowHeight-l.view.height)
+	}
+	l.updateRows()
+}
+
+// GetVisibleRange returns the first and last index with a row, or -1, -1 when empty
+func (l *UIList) GetVisibleRange() (first, last int) {
+	first, last = l.rowRange()
+	if first > last {
+		return -1, -1
+	}
+	return first, last
+}
+
+// GetRow returns the button showing an item, nil if the item has no row now
+func (l *UIList) GetRow(index int) *UIButton {
+	return l.rows[index]
+}
+
+// GetClicked returns the item whose row was clicked or activated since the last call
+func (l *UIList) GetClicked() (index int, ok bool) {
+	for index, row := range l.rows {
+		if row.WasClicked() {
+			row.ResetClick()
+			return index, true
+		}
+	}
+	return -1, false
+}
+
+// Update scrolls from the current input and brings the rows in view up to date. Call it
+// once a frame after Window.PollEvents, before GetClicked.
+func (l *UIList) Update(input *Input, deltaTime float32) {
+	l.view.Update(input, deltaTime)
+	l.updateRows()
+}
+
+func (l *UIList) stride() float32 {
+	return l.rowHeight + l.rowSpacing
+}
+
+// rowRange returns the items that should have a row: those in view and one on each side
+func (l *UIList) rowRange() (first, last int) {
+	_, scrollY := l.view.GetScroll()
+	first = max(int(scrollY/l.stride())-1, 0)
+	last = min(int((scrollY+l.view.height)/l.stride())+1, l.count-1)
+	return first, last
+}
+
+// updateRows hands rows that scrolled out to items that scrolled in
+func (l *UIList) updateRows() {
+	first, last := l.rowRange()
+	focused := C.boulder_ui_get_focused_button()
+	for index, row := range l.rows {
+		// A focused row keeps its item so focus does not jump to another one
+		if (index < first || index > last) && row.id != focused {
+			l.release(index, row)
+		}
+	}
+
+	for index := first; index <= last; index++ {
+		if _, ok := l.rows[index]; ok {
+			continue
+		}
+
+		var row *UIButton
+		if n := len(l.free); n > 0 {
+			row = l.free[n-1]
+			l.free = l.free[:n-1]
+			row.SetVisible(true)
+		} else {
+			row = CreateThemedUIButton(0, 0, l.rowWidth, l.rowHeight)
+			if row == nil {
+				LogError("UI list: failed to create row")
+				return
+			}
+		}
+		l.view.place(row, 0, float32(index)*l.stride())
+		l.rows[index] = row
+		l.bind(row, index)
+	}
+}
+
+func (l *UIList) release(index int, row *UIButton) {
+	delete(l.rows, index)
+	row.ResetClick()
+	row.SetVisible(false)
+	l.free = append(l.free, row)
+}
+
+func clampFloat32(v, lo, hi float32) float32 {
+	return min(max(v, lo), hi)
+}
@@ -0,0 +1,151 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+
+// UIStyle is how a button's shape is drawn: rounded corners, a border inside its edge and
+// a soft drop shadow. The zero value is a plain rectangle.
+type UIStyle struct {
+	CornerRadius  float32
+	BorderWidth   float32
+	BorderColor   UIColor
+	ShadowColor   UIColor // Alpha 0 for no shadow
+	ShadowOffsetX float32
+	ShadowOffsetY float32 // Positive is down
+	ShadowBlur    float32 // Pixels the shadow's edge fades over
+}
+
+func (s UIStyle) toC() C.UIButtonStyle {
+	return C.UIButtonStyle{
+		cornerRadius:  C.float(s.CornerRadius),
+		borderWidth:   C.float(s.BorderWidth),
+		borderColor:   uiColorToC(s.BorderColor),
+		shadowColor:   uiColorToC(s.ShadowColor),
+		shadowOffsetX: C.float(s.ShadowOffsetX),
+		shadowOffsetY: C.float(s.ShadowOffsetY),
+		shadowBlur:    C.float(s.ShadowBlur),
+	}
+}
+
+func uiColorToC(c UIColor) [4]C.float {
+	return [4]C.float{C.float(c.R), C.float(c.G), C.float(c.B), C.float(c.A)}
+}
+
+// SetStyle sets the button's corners, border and shadow
+func (b *UIButton) SetStyle(style UIStyle) {
+	if b.id != 0 {
+		cStyle := style.toC()
+		C.boulder_ui_set_button_style(b.id, &cStyle)
+	}
+}
+
+// GetStyle returns the button's corners, border and shadow
+func (b *UIButton) GetStyle() UIStyle {
+	var cStyle C.UIButtonStyle
+	if b.id == 0 || C.boulder_ui_get_button_style(b.id, &cStyle) != 0 {
+		return UIStyle{}
+	}
+	return UIStyle{
+		CornerRadius:  float32(cStyle.cornerRadius),
+		BorderWidth:   float32(cStyle.borderWidth),
+		BorderColor:   uiColorFrom(cStyle.borderColor),
+		ShadowColor:   uiColorFrom(cStyle.shadowColor),
+		ShadowOffsetX: float32(cStyle.shadowOffsetX),
+		ShadowOffsetY: float32(cStyle.shadowOffsetY),
+		ShadowBlur:    float32(cStyle.shadowBlur),
+	}
+}
+
+// SetCornerRadius rounds the button's corners; the radius is capped at half its shorter side
+func (b *UIButton) SetCornerRadius(radius float32) {
+	style := b.GetStyle()
+	style.CornerRadius = radius
+	b.SetStyle(style)
+}
+
+// SetBorder draws a border of the given width inside the button's edge; a width of 0
+// removes it
+func (b *UIButton) SetBorder(width float32, color UIColor) {
+	style := b.GetStyle()
+	style.BorderWidth = width
+	style.BorderColor = color
+	b.SetStyle(style)
+}
+
+// SetShadow draws a drop shadow under the button, offset in pixels and blurred over blur
+// pixels; a transparent color removes it
+func (b *UIButton) SetShadow(color UIColor, offsetX, offsetY, blur float32) {
+	style := b.GetStyle()
+	style.ShadowColor = color
+	style.ShadowOffsetX = offsetX
+	style.ShadowOffsetY = offsetY
+	style.ShadowBlur = blur
+	b.SetStyle(style)
+}
+
+// UITheme is a look shared by buttons: their colors, shape and the focus ring
+type UITheme struct {
+	NormalColor  UIColor
+	HoverColor   UIColor
+	PressedColor UIColor
+	FocusColor   UIColor
+	Style        UIStyle
+}
+
+// DefaultUITheme returns dark gray buttons with slightly rounded corners and a soft shadow
+func DefaultUITheme() UITheme {
+	return UITheme{
+		NormalColor:  UIColorDarkGray,
+		HoverColor:   UIColorGray,
+		PressedColor: UIColor{0.2, 0.2, 0.2, 1.0},
+		FocusColor:   UIColorWhite,
+		Style: UIStyle{
+			CornerRadius:  6,
+			BorderWidth:   1,
+			BorderColor:   UIColor{1.0, 1.0, 1.0, 0.15},
+			ShadowColor:   UIColor{0.0, 0.0, 0.0, 0.4},
+			ShadowOffsetY: 3,
+			ShadowBlur:    8,
+		},
+	}
+}
+
+var uiTheme = DefaultUITheme()
+
+// UISetTheme makes a theme the current one: buttons created from then on get its style
+// (including those from CreateUIButton), CreateThemedUIButton uses its colors and the focus
+// ring takes its color. Existing buttons keep their look; use UITheme.Apply for those.
+// Call it after UIInitialize.
+func UISetTheme(theme UITheme) {
+	uiTheme = theme
+	cStyle := theme.Style.toC()
+	C.boulder_ui_set_default_style(&cStyle)
+	UISetFocusColor(theme.FocusColor)
+}
+
+// UIGetTheme returns the current theme
+func UIGetTheme() UITheme {
+	return uiTheme
+}
+
+// CreateThemedUIButton creates a button with the current theme's colors and style
+func CreateThemedUIButton(x, y, width, height float32) *UIButton {
+	button := CreateUIButton(x, y, width, height, uiTheme.NormalColor, uiTheme.HoverColor, uiTheme.PressedColor)
+	if button != nil {
+		button.SetStyle(uiTheme.Style)
+	}
+	return button
+}
+
+// Apply gives buttons the theme's colors and style
+func (t UITheme) Apply(buttons ...*UIButton) {
+	for _, button := range buttons {
+		if button == nil {
+			continue
+		}
+		button.SetColors(t.NormalColor, t.HoverColor, t.PressedColor)
+		button.SetStyle(t.Style)
+	}
+}
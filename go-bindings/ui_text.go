@@ -0,0 +1,229 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"errors"
+	"os"
+	"unsafe"
+)
+
+// UITextAlign is where text sits in its box, horizontally or vertically
+type UITextAlign int
+
+const (
+	AlignStart  UITextAlign = 0 // Left or top
+	AlignCenter UITextAlign = 1
+	AlignEnd    UITextAlign = 2 // Right or bottom
+)
+
+// UIFont is a TrueType or OpenType font for UI text. The first font loaded is the default,
+// used by text styles without a font.
+type UIFont struct {
+	id C.UIFontID
+}
+
+// LoadUIFont loads a .ttf or .otf font file
+func LoadUIFont(path string) (*UIFont, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return LoadUIFontData(data)
+}
+
+// LoadUIFontData loads a font from the contents of a .ttf or .otf file, e.g. one embedded
+// with go:embed
+func LoadUIFontData(data []byte) (*UIFont, error) {
+	defer lockThread()()
+	if len(data) == 0 {
+		return nil, errors.New("font data is empty")
+	}
+
+	id := C.boulder_ui_load_font(unsafe.Pointer(&data[0]), C.uint32_t(len(data)))
+	if id == 0 {
+		return nil, lastError("failed to load font")
+	}
+	return &UIFont{id: id}, nil
+}
+
+// Destroy unloads the font; text using it is no longer drawn
+func (f *UIFont) Destroy() {
+	if f.id != 0 {
+		C.boulder_ui_destroy_font(f.id)
+		f.id = 0
+	}
+}
+
+// SetDefault makes text styles without a font use this one
+func (f *UIFont) SetDefault() {
+	if f.id != 0 {
+		C.boulder_ui_set_default_font(f.id)
+	}
+}
+
+// UITextStyle is how button and label text is drawn
+type UITextStyle struct {
+	Font          *UIFont // nil for the default font
+	Size          float32 // Pixel height of the font
+	Color         UIColor
+	Align         UITextAlign
+	VerticalAlign UITextAlign
+}
+
+// DefaultUITextStyle returns white 16 pixel text in the default font, centered
+func DefaultUITextStyle() UITextStyle {
+	return UITextStyle{
+		Size:          16,
+		Color:         UIColor{1.0, 1.0, 1.0, 1.0},
+		Align:         AlignCenter,
+		VerticalAlign: AlignCenter,
+	}
+}
+
+func (s UITextStyle) toC() C.UITextStyle {
+	style := C.UITextStyle{
+		size:          C.float(s.Size),
+		color:         uiColorToC(s.Color),
+		align:         C.int(s.Align),
+		verticalAlign: C.int(s.VerticalAlign),
+	}
+	if s.Font != nil {
+		style.font = s.Font.id
+	}
+	return style
+}
+
+// MeasureUIText returns the size text takes up when drawn in a style, for laying out
+// labels and sizing buttons to fit
+func MeasureUIText(text string, style UITextStyle) (width, height float32, err error) {
+	cText := C.CString(text)
+	defer C.free(unsafe.Pointer(cText))
+
+	cStyle := style.toC()
+	var w, h C.float
+	if C.boulder_ui_measure_text(cText, &cStyle, &w, &h) != 0 {
+		return 0, 0, errors.New("invalid text style")
+	}
+	return float32(w), float32(h), nil
+}
+
+// SetText sets the text drawn on the button, centered unless SetTextStyle aligns it
+// otherwise. The accessible name is separate; see SetLabel.
+func (b *UIButton) SetText(text string) {
+	if b.id == 0 {
+		return
+	}
+
+	cText := C.CString(text)
+	defer C.free(unsafe.Pointer(cText))
+	C.boulder_ui_set_button_text(b.id, cText)
+	b.text = text
+}
+
+// GetText returns the text drawn on the button
+func (b *UIButton) GetText() string {
+	return b.text
+}
+
+// SetTextStyle sets the font, size, color and alignment of the button's text. Disabled
+// buttons draw it darkened.
+func (b *UIButton) SetTextStyle(style UITextStyle) error {
+	if b.id == 0 {
+		return nil
+	}
+	if style.Size <= 0 {
+		return errors.New("text size must be positive")
+	}
+
+	cStyle := style.toC()
+	C.boulder_ui_set_button_text_style(b.id, &cStyle)
+	return nil
+}
+
+// UILabel is text on screen that takes no input, aligned within its bounds (top-left by
+// default). Labels are drawn over buttons and progress bars.
+type UILabel struct {
+	id   C.UILabelID
+	text string
+}
+
+// CreateUILabel creates a label showing text in white at 16 pixels in the default font
+func CreateUILabel(x, y, width, height float32, text string) *UILabel {
+	id := C.boulder_ui_create_label(C.float(x), C.float(y), C.float(width), C.float(height))
+	if id == 0 {
+		return nil
+	}
+
+	l := &UILabel{id: id}
+	l.SetText(text)
+	return l
+}
+
+// Destroy removes the label
+func (l *UILabel) Destroy() {
+	if l.id != 0 {
+		C.boulder_ui_destroy_label(l.id)
+		l.id = 0
+	}
+}
+
+// SetText sets the label's text; "\n" starts a new line
+func (l *UILabel) SetText(text string) {
+	if l.id == 0 {
+		return
+	}
+
+	cText := C.CString(text)
+	defer C.free(unsafe.Pointer(cText))
+	C.boulder_ui_set_label_text(l.id, cText)
+	l.text = text
+}
+
+// GetText returns the label's text
+func (l *UILabel) GetText() string {
+	return l.text
+}
+
+// SetTextStyle sets the label's font, size, color and alignment
+func (l *UILabel) SetTextStyle(style UITextStyle) error {
+	if l.id == 0 {
+		return nil
+	}
+	if style.Size <= 0 {
+		return errors.New("text size must be positive")
+	}
+
+	cStyle := style.toC()
+	C.boulder_ui_set_label_text_style(l.id, &cStyle)
+	return nil
+}
+
+// SetBounds moves and resizes the box the text is aligned in
+func (l *UILabel) SetBounds(x, y, width, height float32) {
+	if l.id != 0 {
+		C.boulder_ui_set_label_bounds(l.id, C.float(x), C.float(y), C.float(width), C.float(height))
+	}
+}
+
+// SetOpacity fades the label, from 0 (invisible) to 1
+func (l *UILabel) SetOpacity(opacity float32) {
+	if l.id != 0 {
+		C.boulder_ui_set_label_opacity(l.id, C.float(opacity))
+	}
+}
+
+// SetVisible shows or hides the label
+func (l *UILabel) SetVisible(visible bool) {
+	if l.id == 0 {
+		return
+	}
+
+	cVisible := C.int(0)
+	if visible {
+		cVisible = 1
+	}
+	C.boulder_ui_set_label_visible(l.id, cVisible)
+}
@@ -0,0 +1,228 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// UITextRenderer measures and draws text for UI widgets that show it, such as tooltips.
+// Implement it with UILabel and MeasureUIText, or with the font library the game uses.
+type UITextRenderer interface {
+	MeasureText(text string) (width, height float32)
+	DrawText(text string, x, y float32) // x, y is the top-left corner
+}
+
+// Rough text size used without a UITextRenderer
+const (
+	estimatedCharWidth  = 8
+	estimatedLineHeight = 18
+)
+
+// Tooltip text by button, so every UIButton value for a button shares it
+var uiTooltips = make(map[C.UIButtonID]func() string)
+
+// SetTooltip sets the text shown while the pointer rests on the button; "" removes it.
+// Lines are separated by "\n".
+func (b *UIButton) SetTooltip(text string) {
+	if text == "" {
+		b.SetTooltipFunc(nil)
+		return
+	}
+	b.SetTooltipFunc(func() string { return text })
+}
+
+// SetTooltipFunc builds the tooltip each frame it is shown, for text that changes, such as
+// a cooldown or a price; returning "" shows nothing. nil removes it.
+func (b *UIButton) SetTooltipFunc(build func() string) {
+	if b.id == 0 {
+		return
+	}
+	if build == nil {
+		delete(uiTooltips, b.id)
+		return
+	}
+	uiTooltips[b.id] = build
+}
+
+// UITooltips shows the tooltip of the button under the pointer once it has rested there
+// for Delay, kept on screen near the screen edges. Moving straight from one tooltip to the
+// next button shows its tooltip at once. Call Update once a frame after Window.PollEvents,
+// after drawing other UI text so the tooltip's text is on top.
+type UITooltips struct {
+	Delay        time.Duration
+	FollowCursor bool    // Follow the pointer instead of sitting under the button
+	OffsetX      float32 // From the pointer, when following it
+	OffsetY      float32
+	Gap          float32 // From the button, when not following the pointer
+	Padding      float32 // Around the text
+	Margin       float32 // Kept from the screen edges
+	Background   UIColor
+	Style        UIStyle
+
+	window *Window
+	text   UITextRenderer
+	panel  *UIProgressBar // Progress bars draw over buttons and never take input
+
+	hovered   C.UIButtonID
+	hoverTime time.Duration
+	shown     bool
+	content   string
+
+	x, y, width, height float32
+}
+
+// NewUITooltips creates the tooltip display for a window. With a nil text renderer the
+// tooltip's size is estimated and its text must be drawn from GetVisible.
+func NewUITooltips(window *Window, text UITextRenderer) *UITooltips {
+	panel := CreateUIProgressBar(0, 0, 0, 0)
+	if panel == nil {
+		return nil
+	}
+	panel.SetVisible(false)
+
+	style := uiTheme.Style
+	style.BorderWidth = 0
+	return &UITooltips{
+		Delay:      500 * time.Millisecond,
+		OffsetX:    12,
+		OffsetY:    20,
+		Gap:        6,
+		Padding:    6,
+		Margin:     4,
+		Background: UIColor{0.08, 0.08, 0.1, 0.95},
+		Style:      style,
+		window:     window,
+		text:       text,
+		panel:      panel,
+	}
+}
+
+// Destroy removes the tooltip display
+func (t *UITooltips) Destroy() {
+	if t.panel != nil {
+		t.panel.Destroy()
+		t.panel = nil
+	}
+}
+
+// Update shows, moves or hides the tooltip for the button under the pointer
+func (t *UITooltips) Update(input *Input, deltaTime float32) {
+	if !input.engine.initialized || t.panel == nil {
+		return
+	}
+
+	id := C.boulder_ui_get_hovered_button()
+	if id != t.hovered {
+		warm := t.shown
+		t.hide()
+		t.hovered = id
+		t.hoverTime = 0
+		if warm {
+			t.hoverTime = t.Delay
+		}
+	}
+
+	build := uiTooltips[id]
+	if id == 0 || build == nil {
+		t.hide()
+		return
+	}
+
+	if t.hoverTime < t.Delay {
+		t.hoverTime += time.Duration(float64(deltaTime) * float64(time.Second))
+		if t.hoverTime < t.Delay {
+			return
+		}
+	}
+
+	content := build()
+	if content == "" {
+		t.hide()
+		return
+	}
+
+	resized := !t.shown || content != t.content
+	if resized {
+		t.content = content
+		t.width, t.height = t.measure(content)
+		t.width += 2 * t.Padding
+		t.height += 2 * t.Padding
+	}
+	if resized || t.FollowCursor {
+		t.place(input, &UIButton{id: id})
+		t.panel.SetBounds(t.x, t.y, t.width, t.height)
+	}
+
+	if !t.shown {
+		t.panel.SetColors(t.Background, t.Background, t.Background)
+		t.panel.SetStyle(t.Style)
+		t.panel.SetVisible(true)
+		t.shown = true
+	}
+
+	if t.text != nil {
+		t.text.DrawText(t.content, t.x+t.Padding, t.y+t.Padding)
+	}
+}
+
+// GetVisible returns the tooltip being shown and where, including padding
+func (t *UITooltips) GetVisible() (text string, x, y, width, height float32, ok bool) {
+	if !t.shown {
+		return "", 0, 0, 0, 0, false
+	}
+	return t.content, t.x, t.y, t.width, t.height, true
+}
+
+func (t *UITooltips) hide() {
+	if t.shown {
+		t.panel.SetVisible(false)
+		t.shown = false
+	}
+}
+
+func (t *UITooltips) measure(text string) (width, height float32) {
+	if t.text != nil {
+		return t.text.MeasureText(text)
+	}
+
+	lines := strings.Split(text, "\n")
+	longest := 0
+	for _, line := range lines {
+		longest = max(longest, utf8.RuneCountInString(line))
+	}
+	return float32(longest * estimatedCharWidth), float32(len(lines) * estimatedLineHeight)
+}
+
+// place puts the tooltip below the pointer or button, or above it when there is no room
+// below, and keeps it within the screen
+func (t *UITooltips) place(input *Input, button *UIButton) {
+	var x, below, above float32
+	if t.FollowCursor {
+		mouseX, mouseY := input.GetMousePosition()
+		x = mouseX + t.OffsetX
+		below = mouseY + t.OffsetY
+		above = mouseY - t.OffsetY - t.height
+	} else {
+		bx, by := button.GetPosition()
+		bw, bh := button.GetSize()
+		x = bx + (bw-t.width)/2
+		below = by + bh + t.Gap
+		above = by - t.Gap - t.height
+	}
+
+	screenWidth, screenHeight := t.window.GetSize()
+	right := float32(screenWidth) - t.Margin
+	bottom := float32(screenHeight) - t.Margin
+
+	y := below
+	if y+t.height > bottom && above >= t.Margin {
+		y = above
+	}
+	t.x = max(min(x, right-t.width), t.Margin)
+	t.y = max(min(y, bottom-t.height), t.Margin)
+}
@@ -0,0 +1,381 @@
+package boulder
+
+import "time"
+
+// Easing maps a tween's progress, 0 to 1, onto how far along its values are
+type Easing func(t float32) float32
+
+// Easings for tweens and transitions
+var (
+	EaseLinear    Easing = func(t float32) float32 { return t }
+	EaseInQuad    Easing = func(t float32) float32 { return t * t }
+	EaseOutQuad   Easing = func(t float32) float32 { return t * (2 - t) }
+	EaseInOutQuad Easing = func(t float32) float32 {
+		if t < 0.5 {
+			return 2 * t * t
+		}
+		return -1 + (4-2*t)*t
+	}
+	EaseInCubic  Easing = func(t float32) float32 { return t * t * t }
+	EaseOutCubic Easing = func(t float32) float32 {
+		u := t - 1
+		return u*u*u + 1
+	}
+	EaseInOutCubic Easing = func(t float32) float32 {
+		if t < 0.5 {
+			return 4 * t * t * t
+		}
+		u := 2*t - 2
+		return 0.5*u*u*u + 1
+	}
+	// EaseOutBack overshoots the target a little and settles back
+	EaseOutBack Easing = func(t float32) float32 {
+		const c = 1.70158
+		u := t - 1
+		return 1 + (c+1)*u*u*u + c*u*u
+	}
+	EaseOutBounce Easing = func(t float32) float32 {
+		const n, d = 7.5625, 2.75
+		switch {
+		case t < 1/d:
+			return n * t * t
+		case t < 2/d:
+			t -= 1.5 / d
+			return n*t*t + 0.75
+		case t < 2.5/d:
+			t -= 2.25 / d
+			return n*t*t + 0.9375
+		default:
+			t -= 2.625 / d
+			return n*t*t + 0.984375
+		}
+	}
+)
+
+// Tween animates a button's position, size, colors and opacity from where they are when
+// it starts to the targets set with MoveTo, ResizeTo, ColorsTo and FadeTo. It advances
+// with the delta time passed to Engine.Update, so it pauses with the game.
+type Tween struct {
+	engine     *Engine
+	button     *UIButton
+	duration   time.Duration
+	delay      time.Duration
+	elapsed    time.Duration
+	easing     Easing
+	onComplete func()
+	started    bool
+	done       bool
+
+	animatePosition, animateSize, animateColors, animateOpacity bool
+
+	fromX, fromY, toX, toY float32
+	fromW, fromH, toW, toH float32
+	fromColors, toColors   [3]UIColor
+	fromOpacity, toOpacity float32
+}
+
+// Tween starts describing an animation of a button over a duration; set targets and
+// options on it and call Start
+func (e *Engine) Tween(button *UIButton, duration time.Duration) *Tween {
+	return &Tween{engine: e, button: button, duration: duration, easing: EaseOutQuad}
+}
+
+// MoveTo animates the position
+func (t *Tween) MoveTo(x, y float32) *Tween {
+	t.animatePosition, t.toX, t.toY = true, x, y
+	return t
+}
+
+// ResizeTo animates the size
+func (t *Tween) ResizeTo(width, height float32) *Tween {
+	t.animateSize, t.toW, t.toH = true, width, height
+	return t
+}
+
+// ColorsTo animates the normal, hover and pressed colors
+func (t *Tween) ColorsTo(normalColor, hoverColor, pressedColor UIColor) *Tween {
+	t.animateColors = true
+	t.toColors = [3]UIColor{normalColor, hoverColor, pressedColor}
+	return t
+}
+
+// FadeTo animates the opacity
+func (t *Tween) FadeTo(opacity float32) *Tween {
+	t.animateOpacity, t.toOpacity = true, opacity
+	return t
+}
+
+// WithEasing sets the easing, EaseOutQuad by default
+func (t *Tween) WithEasing(easing Easing) *Tween {
+	if easing != nil {
+		t.easing = easing
+	}
+	return t
+}
+
+// WithDelay waits before starting; the starting values are read once the delay is over
+func (t *Tween) WithDelay(delay time.Duration) *Tween {
+	t.delay = delay
+	return t
+}
+
+// OnComplete runs a callback once the tween reached its targets
+func (t *Tween) OnComplete(callback func()) *Tween {
+	t.onComplete = callback
+	return t
+}
+
+// Start plays the tween. A tween already playing on the same button stops if it animates
+// any of the same properties.
+func (t *Tween) Start() *Tween {
+	if t.button == nil || t.done {
+		return t
+	}
+
+	for _, other := range t.engine.tweens {
+		if other.button == t.button && other.overlaps(t) {
+			other.done = true
+		}
+	}
+	t.engine.tweens = append(t.engine.tweens, t)
+	return t
+}
+
+// Stop leaves the button where the tween got it, without running OnComplete
+func (t *Tween) Stop() {
+	t.done = true
+}
+
+// IsDone returns whether the tween finished or was stopped
+func (t *Tween) IsDone() bool {
+	return t.done
+}
+
+func (t *Tween) overlaps(other *Tween) bool {
+	return (t.animatePosition && other.animatePosition) || (t.animateSize && other.animateSize) ||
+		(t.animateColors && other.animateColors) || (t.animateOpacity && other.animateOpacity)
+}
+
+// advance moves the tween on and returns whether it just finished
+func (t *Tween) advance(deltaTime time.Duration) bool {
+	t.elapsed += deltaTime
+	if t.elapsed < t.delay {
+		return false
+	}
+
+	if !t.started {
+		t.started = true
+		t.fromX, t.fromY = t.button.GetPosition()
+		t.fromW, t.fromH = t.button.GetSize()
+		normal, hover, pressed := t.button.GetColors()
+		t.fromColors = [3]UIColor{normal, hover, pressed}
+		t.fromOpacity = t.button.GetOpacity()
+	}
+
+	progress := float32(1)
+	if t.duration > 0 {
+		progress = min(float32(t.elapsed-t.delay)/float32(t.duration), 1)
+	}
+	t.apply(t.easing(progress))
+	return progress >= 1
+}
+
+func (t *Tween) apply(k float32) {
+	b := t.button
+	if t.animatePosition {
+		b.SetPosition(lerp(t.fromX, t.toX, k), lerp(t.fromY, t.toY, k))
+	}
+	if t.animateSize {
+		b.SetSize(lerp(t.fromW, t.toW, k), lerp(t.fromH, t.toH, k))
+	}
+	if t.animateColors {
+		b.SetColors(lerpColor(t.fromColors[0], t.toColors[0], k),
+			lerpColor(t.fromColors[1], t.toColors[1], k),
+			lerpColor(t.fromColors[2], t.toColors[2], k))
+	}
+	if t.animateOpacity {
+		b.SetOpacity(lerp(t.fromOpacity, t.toOpacity, k))
+	}
+}
+
+// updateTweens advances the playing tweens and runs the callbacks of those that finished
+func (e *Engine) updateTweens(deltaTime float32) {
+	if len(e.tweens) == 0 {
+		return
+	}
+
+	step := time.Duration(float64(deltaTime) * float64(time.Second))
+	var finished []*Tween
+	for _, t := range e.tweens {
+		if t.done {
+			continue
+		}
+		if t.button.id == 0 {
+			t.done = true // The button was destroyed
+			continue
+		}
+		if t.advance(step) {
+			t.done = true
+			finished = append(finished, t)
+		}
+	}
+
+	// Callbacks may start new tweens, so the list is trimmed before they run
+	playing := e.tweens[:0]
+	for _, t := range e.tweens {
+		if !t.done {
+			playing = append(playing, t)
+		}
+	}
+	clear(e.tweens[len(playing):])
+	e.tweens = playing
+
+	for _, t := range finished {
+		if t.onComplete != nil {
+			runCallback("Tween.OnComplete", t.onComplete)
+		}
+	}
+}
+
+func lerp(a, b, k float32) float32 {
+	return a + (b-a)*k
+}
+
+func lerpColor(a, b UIColor, k float32) UIColor {
+	return UIColor{lerp(a.R, b.R, k), lerp(a.G, b.G, k), lerp(a.B, b.B, k), lerp(a.A, b.A, k)}
+}
+
+// Transition shows or hides the buttons of a container, as a panel, with a fade and a
+// slide. Set it up with Fade and Slide and call Show or Hide:
+//
+//	engine.Transition(menu).Fade().Slide(0, 40).Over(300 * time.Millisecond).Show()
+type Transition struct {
+	engine    *Engine
+	container *UIContainer
+	duration  time.Duration
+	easing    Easing
+	fade      bool
+	dx, dy    float32
+	then      func()
+}
+
+// Transition starts describing a transition of a container's buttons, 250 ms with
+// EaseOutCubic unless changed
+func (e *Engine) Transition(container *UIContainer) *Transition {
+	return &Transition{engine: e, container: container, duration: 250 * time.Millisecond, easing: EaseOutCubic}
+}
+
+// Fade fades the buttons in when shown and out when hidden
+func (tr *Transition) Fade() *Transition {
+	tr.fade = true
+	return tr
+}
+
+// Slide moves the buttons in from this offset when shown and out to it when hidden
+func (tr *Transition) Slide(dx, dy float32) *Transition {
+	tr.dx, tr.dy = dx, dy
+	return tr
+}
+
+// Over sets how long the transition takes
+func (tr *Transition) Over(duration time.Duration) *Transition {
+	tr.duration = duration
+	return tr
+}
+
+// WithEasing sets the easing
+func (tr *Transition) WithEasing(easing Easing) *Transition {
+	if easing != nil {
+		tr.easing = easing
+	}
+	return tr
+}
+
+// Then runs a callback once the transition finished
+func (tr *Transition) Then(callback func()) *Transition {
+	tr.then = callback
+	return tr
+}
+
+// Show makes the buttons visible and plays the transition into their places
+func (tr *Transition) Show() {
+	tr.play(true)
+}
+
+// Hide plays the transition out and hides the buttons, putting them back in their places
+// with full opacity for the next Show
+func (tr *Transition) Hide() {
+	tr.play(false)
+}
+
+func (tr *Transition) play(show bool) {
+	c := tr.container
+	if c == nil || len(c.buttons) == 0 {
+		if tr.then != nil {
+			runCallback("Transition.Then", tr.then)
+		}
+		return
+	}
+	if c.rest == nil {
+		c.rest = make(map[*UIButton][2]float32)
+	}
+
+	// A transition in the other direction takes over from where this one got to
+	for _, t := range c.transition {
+		t.Stop()
+	}
+	c.transition = c.transition[:0]
+
+	slide := tr.dx != 0 || tr.dy != 0
+	for i, b := range c.buttons {
+		// Where the button belongs; kept while a transition runs so an interrupted one
+		// does not leave it offset
+		rest, ok := c.rest[b]
+		if !ok {
+			x, y := b.GetPosition()
+			rest = [2]float32{x, y}
+			c.rest[b] = rest
+		}
+
+		t := tr.engine.Tween(b, tr.duration).WithEasing(tr.easing)
+		if show {
+			if !b.IsVisible() {
+				if tr.fade {
+					b.SetOpacity(0)
+				}
+				if slide {
+					b.SetPosition(rest[0]+tr.dx, rest[1]+tr.dy)
+				}
+				b.SetVisible(true)
+			}
+			if tr.fade {
+				t.FadeTo(1)
+			}
+			if slide {
+				t.MoveTo(rest[0], rest[1])
+			}
+		} else {
+			if tr.fade {
+				t.FadeTo(0)
+			}
+			if slide {
+				t.MoveTo(rest[0]+tr.dx, rest[1]+tr.dy)
+			}
+		}
+
+		button := b
+		last := i == len(c.buttons)-1
+		t.OnComplete(func() {
+			if !show {
+				button.SetVisible(false)
+				button.SetPosition(rest[0], rest[1])
+				button.SetOpacity(1)
+			}
+			delete(c.rest, button)
+			if last && tr.then != nil {
+				tr.then()
+			}
+		})
+		c.transition = append(c.transition, t.Start())
+	}
+}
@@ -0,0 +1,349 @@
+package boulder
+
+// #cgo CFLAGS: -I..
+// #include <stdlib.h>
+// #include "../boulder_cgo.h"
+import "C"
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"unsafe"
+)
+
+const (
+	// VoxelChunkSize is the number of blocks along each side of a chunk
+	VoxelChunkSize = 32
+
+	// VoxelMaterialStride is the step the face material adds to a chunk vertex's V
+	// coordinate. Shaders recover the material with floor(v / stride) and the position on
+	// the quad with (u, mod(v, stride)).
+	VoxelMaterialStride = 1024
+
+	// BlockAir is the empty block
+	BlockAir uint16 = 0
+)
+
+var voxelSaveMagic = []byte("BVXW")
+
+// BlockType describes how a block looks and collides. Materials index the game's texture
+// atlas or array.
+type BlockType struct {
+	Solid  bool // Blocks collision and raycasts
+	Opaque bool // Hides the faces of neighbouring blocks
+	Top    uint16
+	Side   uint16
+	Bottom uint16
+}
+
+// SolidBlock returns an opaque, solid block type with one material on every face
+func SolidBlock(material uint16) BlockType {
+	return BlockType{Solid: true, Opaque: true, Top: material, Side: material, Bottom: material}
+}
+
+// VoxelCoord is a block or chunk position
+type VoxelCoord struct {
+	X, Y, Z int
+}
+
+// VoxelBox is an axis-aligned collision box in world space
+type VoxelBox struct {
+	Min, Max Vector3
+}
+
+// VoxelHit is the first solid block along a ray
+type VoxelHit struct {
+	Block    VoxelCoord
+	Point    Vector3
+	Normal   Vector3 // Face the ray entered through
+	Distance float32
+}
+
+// VoxelWorld is a chunked block grid attached to an entity. It is axis aligned at the
+// entity's position; rotation and scale are ignored.
+type VoxelWorld struct {
+	world  *World
+	entity EntityID
+}
+
+// AddVoxelWorld makes an entity a voxel world with blocks of blockSize meters
+func (w *World) AddVoxelWorld(entity EntityID, blockSize float32) (*VoxelWorld, error) {
+	defer lockThread()()
+	if !w.ready() {
+		return nil, errNotInitialized
+	}
+
+	if ret := C.boulder_add_voxel_world(C.EntityID(entity), C.float(blockSize)); ret != 0 {
+		return nil, lastError("failed to add voxel world")
+	}
+
+	return &VoxelWorld{world: w, entity: entity}, nil
+}
+
+// GetEntity returns the voxel world's entity
+func (vw *VoxelWorld) GetEntity() EntityID {
+	return vw.entity
+}
+
+// SetBlockType defines a block type. Chunks are remeshed on the next Update.
+func (vw *VoxelWorld) SetBlockType(block uint16, blockType BlockType) error {
+	defer lockThread()()
+	if !vw.world.ready() {
+		return errNotInitialized
+	}
+	if block == BlockAir {
+		return errors.New("cannot redefine air")
+	}
+
+	if ret := C.boulder_set_voxel_block_type(C.EntityID(vw.entity), C.int(block),
+		C.int(boolToInt32(blockType.Solid)), C.int(boolToInt32(blockType.Opaque)),
+		C.int(blockType.Top), C.int(blockType.Side), C.int(blockType.Bottom)); ret != 0 {
+		return lastError("failed to set block type")
+	}
+
+	return nil
+}
+
+// SetBlock sets the block at a position
+func (vw *VoxelWorld) SetBlock(position VoxelCoord, block uint16) error {
+	defer lockThread()()
+	if !vw.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_set_voxel(C.EntityID(vw.entity), C.int(position.X), C.int(position.Y), C.int(position.Z),
+		C.int(block)); ret != 0 {
+		return lastError("failed to set block")
+	}
+
+	return nil
+}
+
+// GetBlock returns the block at a position
+func (vw *VoxelWorld) GetBlock(position VoxelCoord) uint16 {
+	if !vw.world.ready() {
+		return BlockAir
+	}
+
+	block := C.boulder_get_voxel(C.EntityID(vw.entity), C.int(position.X), C.int(position.Y), C.int(position.Z))
+	if block < 0 {
+		return BlockAir
+	}
+	return uint16(block)
+}
+
+// Fill sets every block in the box between two corners, inclusive
+func (vw *VoxelWorld) Fill(from, to VoxelCoord, block uint16) error {
+	defer lockThread()()
+	if !vw.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_fill_voxels(C.EntityID(vw.entity), C.int(from.X), C.int(from.Y), C.int(from.Z),
+		C.int(to.X), C.int(to.Y), C.int(to.Z), C.int(block)); ret != 0 {
+		return lastError("failed to fill blocks")
+	}
+
+	return nil
+}
+
+// Update remeshes up to maxChunks changed chunks (zero for all) and rebuilds their
+// collision. Returns how many chunks were remeshed. Call every frame.
+func (vw *VoxelWorld) Update(maxChunks int) (int, error) {
+	defer lockThread()()
+	if !vw.world.ready() {
+		return 0, errNotInitialized
+	}
+
+	count := C.boulder_update_voxel_world(C.EntityID(vw.entity), C.int(maxChunks))
+	if count < 0 {
+		return 0, lastError("failed to update voxel world")
+	}
+
+	return int(count), nil
+}
+
+// GetChunks returns the coordinates of every chunk holding blocks
+func (vw *VoxelWorld) GetChunks() []VoxelCoord {
+	if !vw.world.ready() {
+		return nil
+	}
+
+	count := int(C.boulder_get_voxel_chunk_count(C.EntityID(vw.entity)))
+	if count <= 0 {
+		return nil
+	}
+
+	coords := make([]C.int, count*3)
+	count = min(count, int(C.boulder_get_voxel_chunks(C.EntityID(vw.entity), &coords[0], C.uint32_t(count))))
+
+	chunks := make([]VoxelCoord, count)
+	for i := range chunks {
+		chunks[i] = VoxelCoord{int(coords[i*3]), int(coords[i*3+1]), int(coords[i*3+2])}
+	}
+	return chunks
+}
+
+// GetCollisionBoxes returns the merged solid boxes of a chunk, as of the last Update
+func (vw *VoxelWorld) GetCollisionBoxes(chunk VoxelCoord) []VoxelBox {
+	if !vw.world.ready() {
+		return nil
+	}
+
+	count := int(C.boulder_get_voxel_collision_boxes(C.EntityID(vw.entity),
+		C.int(chunk.X), C.int(chunk.Y), C.int(chunk.Z), nil, 0))
+	if count <= 0 {
+		return nil
+	}
+
+	floats := make([]C.float, count*6)
+	C.boulder_get_voxel_collision_boxes(C.EntityID(vw.entity), C.int(chunk.X), C.int(chunk.Y), C.int(chunk.Z),
+		&floats[0], C.uint32_t(count))
+
+	boxes := make([]VoxelBox, count)
+	for i := range boxes {
+		f := floats[i*6:]
+		boxes[i] = VoxelBox{
+			Min: Vector3{float32(f[0]), float32(f[1]), float32(f[2])},
+			Max: Vector3{float32(f[3]), float32(f[4]), float32(f[5])},
+		}
+	}
+	return boxes
+}
+
+// Raycast returns the first solid block along a ray, checking blocks directly rather than
+// the collision boxes built by Update
+func (vw *VoxelWorld) Raycast(origin, direction Vector3, maxDistance float32) (VoxelHit, bool) {
+	if !vw.world.ready() {
+		return VoxelHit{}, false
+	}
+
+	var block [3]C.int
+	var normal [3]C.float
+	var distance C.float
+	if ret := C.boulder_voxel_raycast(C.EntityID(vw.entity),
+		C.float(origin.X), C.float(origin.Y), C.float(origin.Z),
+		C.float(direction.X), C.float(direction.Y), C.float(direction.Z),
+		C.float(maxDistance), &block[0], &normal[0], &distance); ret != 0 {
+		return VoxelHit{}, false
+	}
+
+	dir := normalizeVector(direction)
+	d := float32(distance)
+	return VoxelHit{
+		Block:    VoxelCoord{int(block[0]), int(block[1]), int(block[2])},
+		Point:    Vector3{origin.X + dir.X*d, origin.Y + dir.Y*d, origin.Z + dir.Z*d},
+		Normal:   Vector3{float32(normal[0]), float32(normal[1]), float32(normal[2])},
+		Distance: d,
+	}, true
+}
+
+// Raycaster returns a RaycastFunc for Projectiles that hits solid blocks. The projectile
+// radius is ignored.
+func (vw *VoxelWorld) Raycaster() RaycastFunc {
+	return func(from, to Vector3, radius float32, ignore EntityID) (RaycastHit, bool) {
+		if ignore == vw.entity {
+			return RaycastHit{}, false
+		}
+
+		delta := Vector3{to.X - from.X, to.Y - from.Y, to.Z - from.Z}
+		length := vectorLength(delta)
+		if length == 0 {
+			return RaycastHit{}, false
+		}
+
+		hit, ok := vw.Raycast(from, delta, length)
+		if !ok {
+			return RaycastHit{}, false
+		}
+		return RaycastHit{Entity: vw.entity, Point: hit.Point, Normal: hit.Normal, Fraction: hit.Distance / length}, true
+	}
+}
+
+// SaveChunk serializes a chunk's blocks (run-length encoded)
+func (vw *VoxelWorld) SaveChunk(chunk VoxelCoord) ([]byte, error) {
+	defer lockThread()()
+	if !vw.world.ready() {
+		return nil, errNotInitialized
+	}
+
+	var written C.uint32_t
+	if ret := C.boulder_save_voxel_chunk(C.EntityID(vw.entity), C.int(chunk.X), C.int(chunk.Y), C.int(chunk.Z),
+		nil, 0, &written); ret < 0 {
+		return nil, errors.New("no such voxel chunk")
+	}
+
+	data := make([]byte, written)
+	if ret := C.boulder_save_voxel_chunk(C.EntityID(vw.entity), C.int(chunk.X), C.int(chunk.Y), C.int(chunk.Z),
+		unsafe.Pointer(&data[0]), C.uint32_t(len(data)), &written); ret != 0 {
+		return nil, lastError("failed to save voxel chunk")
+	}
+
+	return data[:written], nil
+}
+
+// LoadChunk replaces a chunk's blocks with data from SaveChunk
+func (vw *VoxelWorld) LoadChunk(chunk VoxelCoord, data []byte) error {
+	defer lockThread()()
+	if !vw.world.ready() {
+		return errNotInitialized
+	}
+	if len(data) == 0 {
+		return errors.New("empty voxel chunk data")
+	}
+
+	if ret := C.boulder_load_voxel_chunk(C.EntityID(vw.entity), C.int(chunk.X), C.int(chunk.Y), C.int(chunk.Z),
+		unsafe.Pointer(&data[0]), C.uint32_t(len(data))); ret != 0 {
+		return lastError("failed to load voxel chunk")
+	}
+
+	return nil
+}
+
+// Save serializes every chunk, e.g. for a save game
+func (vw *VoxelWorld) Save() ([]byte, error) {
+	chunks := vw.GetChunks()
+
+	var buf bytes.Buffer
+	buf.Write(voxelSaveMagic)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(chunks)))
+	for _, chunk := range chunks {
+		data, err := vw.SaveChunk(chunk)
+		if err != nil {
+			return nil, err
+		}
+		binary.Write(&buf, binary.LittleEndian, [3]int32{int32(chunk.X), int32(chunk.Y), int32(chunk.Z)})
+		binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// Load restores chunks saved by Save. Chunks that aren't in the data are left as they are.
+func (vw *VoxelWorld) Load(data []byte) error {
+	if len(data) < 8 || !bytes.Equal(data[:4], voxelSaveMagic) {
+		return errors.New("not voxel world data")
+	}
+
+	count := int(binary.LittleEndian.Uint32(data[4:]))
+	data = data[8:]
+	for i := 0; i < count; i++ {
+		if len(data) < 16 {
+			return errors.New("truncated voxel world data")
+		}
+		chunk := VoxelCoord{
+			X: int(int32(binary.LittleEndian.Uint32(data[0:]))),
+			Y: int(int32(binary.LittleEndian.Uint32(data[4:]))),
+			Z: int(int32(binary.LittleEndian.Uint32(data[8:]))),
+		}
+		size := int(binary.LittleEndian.Uint32(data[12:]))
+		if len(data) < 16+size {
+			return errors.New("truncated voxel world data")
+		}
+		if err := vw.LoadChunk(chunk, data[16:16+size]); err != nil {
+			return err
+		}
+		data = data[16+size:]
+	}
+	return nil
+}
@@ -1,15 +1,56 @@
 package boulder
 
 // #cgo CFLAGS: -I..
-// #cgo LDFLAGS: -L../build -lboulder_shared -Wl,-rpath,${SRCDIR}/../build
 // #include <stdlib.h>
 // #include "../boulder_cgo.h"
 import "C"
-import (
-	"errors"
-	"unsafe"
+import "unsafe"
+
+// WindowEventType is what happened to the window
+type WindowEventType int
+
+const (
+	WindowResized     WindowEventType = 0 // Width and Height are the new size
+	WindowFocusGained WindowEventType = 1
+	WindowFocusLost   WindowEventType = 2
+	WindowMinimized   WindowEventType = 3
+	WindowRestored    WindowEventType = 4 // No longer minimized or maximized
+	WindowMaximized   WindowEventType = 5
+	WindowFileDropped WindowEventType = 6 // Path was dropped on the window at X, Y
 )
 
+// String returns a readable name for the event type
+func (t WindowEventType) String() string {
+	switch t {
+	case WindowResized:
+		return "resized"
+	case WindowFocusGained:
+		return "focus gained"
+	case WindowFocusLost:
+		return "focus lost"
+	case WindowMinimized:
+		return "minimized"
+	case WindowRestored:
+		return "restored"
+	case WindowMaximized:
+		return "maximized"
+	case WindowFileDropped:
+		return "file dropped"
+	default:
+		return "unknown"
+	}
+}
+
+// WindowEvent is a change to the window, or a file dropped on it
+type WindowEvent struct {
+	Type   WindowEventType
+	Width  int // WindowResized
+	Height int
+	X      float32 // WindowFileDropped, in window coordinates
+	Y      float32
+	Path   string
+}
+
 // Window manages the application window
 type Window struct {
 	engine *Engine
@@ -27,15 +68,16 @@ func NewWindow(engine *Engine) *Window {
 
 // Create creates a new window with the specified dimensions and title
 func (w *Window) Create(width, height int, title string) error {
+	defer lockThread()()
 	if !w.engine.initialized {
-		return errors.New("engine not initialized")
+		return errNotInitialized
 	}
 
 	cTitle := C.CString(title)
 	defer C.free(unsafe.Pointer(cTitle))
 
 	if ret := C.boulder_create_window(C.int(width), C.int(height), cTitle); ret != 0 {
-		return errors.New("failed to create window")
+		return lastError("failed to create window")
 	}
 
 	w.width = width
@@ -85,6 +127,64 @@ func (w *Window) PollEvents() {
 	}
 
 	C.boulder_poll_events()
+	w.engine.dispatchAppEvents()
+	w.engine.dispatchLayoutChanged()
+	w.dispatchEvents()
+}
+
+// OnEvent registers a callback for window events, run by PollEvents: resizes, focus
+// changes, minimizing and restoring, and dropped files. The swapchain is recreated on the
+// frame after a resize without any help; minimized windows are a good time to pause.
+func (w *Window) OnEvent(callback func(event WindowEvent)) {
+	w.engine.windowCallbacks = append(w.engine.windowCallbacks, callback)
+}
+
+// IsFocused returns whether the window has keyboard focus
+func (w *Window) IsFocused() bool {
+	if !w.engine.initialized {
+		return false
+	}
+	return C.boulder_get_window_state()&1 != 0
+}
+
+// IsMinimized returns whether the window is minimized
+func (w *Window) IsMinimized() bool {
+	if !w.engine.initialized {
+		return false
+	}
+	return C.boulder_get_window_state()&2 != 0
+}
+
+// IsMaximized returns whether the window is maximized
+func (w *Window) IsMaximized() bool {
+	if !w.engine.initialized {
+		return false
+	}
+	return C.boulder_get_window_state()&4 != 0
+}
+
+func (w *Window) dispatchEvents() {
+	var event C.WindowEvent
+	var path [4096]C.char
+	for C.boulder_poll_window_event(&event, &path[0], C.uint32_t(len(path))) != 0 {
+		e := WindowEvent{
+			Type:   WindowEventType(event._type),
+			Width:  int(event.width),
+			Height: int(event.height),
+			X:      float32(event.x),
+			Y:      float32(event.y),
+		}
+		if e.Type == WindowFileDropped {
+			e.Path = C.GoString(&path[0])
+		}
+		if e.Type == WindowResized {
+			w.width = e.Width
+			w.height = e.Height
+		}
+		for _, callback := range w.engine.windowCallbacks {
+			runCallback("OnEvent", func() { callback(e) })
+		}
+	}
 }
 
 // GetTitle returns the window title
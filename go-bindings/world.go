@@ -1,7 +1,6 @@
 package boulder
 
 // #cgo CFLAGS: -I..
-// #cgo LDFLAGS: -L../build -lboulder_shared -Wl,-rpath,${SRCDIR}/../build
 // #include <stdlib.h>
 // #include "../boulder_cgo.h"
 import "C"
@@ -13,27 +12,150 @@ import (
 // EntityID represents a unique identifier for an entity in the ECS
 type EntityID uint64
 
-// World manages the ECS (Entity Component System)
+// The world boulder_init creates, which NewWorld wraps
+const defaultWorldID = 1
+
+// World manages the ECS (Entity Component System). Each world has its own entities, so a
+// menu's background scene, the gameplay world and a level being loaded can exist side by
+// side; the engine simulates and draws the active one.
 type World struct {
-	engine *Engine
+	engine     *Engine
+	id         C.WorldID
+	hitboxes   *hitboxState
+	history    *editHistory
+	components *componentEventState
+	collisions *collisionEventState
+	prefabs    *prefabState
+	queryHint  int    // Matches found by the last query, to size the next one
+	scene      *Scene // Loaded into it last, for the names SaveScene writes
 }
 
-// NewWorld creates a new World manager
+// NewWorld creates a manager for the engine's default world, which is active until
+// SetActiveWorld picks another
 func NewWorld(engine *Engine) *World {
 	return &World{
 		engine: engine,
+		id:     defaultWorldID,
+	}
+}
+
+// CreateWorld creates an empty world. It is simulated and drawn once made active; until
+// then it can be filled in the background, e.g. with the next level.
+func (e *Engine) CreateWorld() (*World, error) {
+	defer lockThread()()
+	if !e.initialized {
+		return nil, errNotInitialized
+	}
+
+	id := C.boulder_create_world()
+	if id == 0 {
+		return nil, lastError("failed to create world")
+	}
+
+	return &World{engine: e, id: id}, nil
+}
+
+// Destroy destroys the world and its entities. The default world and the active world
+// cannot be destroyed.
+func (w *World) Destroy() error {
+	defer lockThread()()
+	if !w.engine.initialized || w.id == 0 {
+		return nil
+	}
+
+	if ret := C.boulder_destroy_world(w.id); ret != 0 {
+		return lastError("failed to destroy world (the default and active worlds cannot be destroyed)")
+	}
+	if w.engine.boundWorld == w.id {
+		w.engine.boundWorld = 0
+	}
+	w.id = 0
+
+	return nil
+}
+
+// SetActiveWorld picks the world Update simulates and the renderer draws. Pending component
+// events of the previous world are dropped: component events only cover the active world.
+// Persistent entities (see Entity.SetPersistent) move with it.
+func (e *Engine) SetActiveWorld(world *World) error {
+	defer lockThread()()
+	if !e.initialized {
+		return errNotInitialized
+	}
+	if world == nil || world.id == 0 {
+		return errors.New("invalid world")
+	}
+
+	previous := e.GetActiveWorld()
+	if ret := C.boulder_set_active_world(world.id); ret != 0 {
+		return lastError("failed to set active world")
+	}
+	e.activeWorld = world
+	e.movePersistent(previous, world)
+
+	return nil
+}
+
+// GetActiveWorld returns the world being simulated and drawn
+func (e *Engine) GetActiveWorld() *World {
+	if e.activeWorld == nil || e.activeWorld.id == 0 {
+		return NewWorld(e)
+	}
+	return e.activeWorld
+}
+
+// IsActive returns whether the world is the one being simulated and drawn
+func (w *World) IsActive() bool {
+	if !w.engine.initialized || w.id == 0 {
+		return false
 	}
+	return C.boulder_get_active_world() == w.id
+}
+
+// ready binds the world for native calls, which act on one world at a time. It returns
+// false if the engine is not running or the world was destroyed.
+func (w *World) ready() bool {
+	if !w.engine.initialized || w.id == 0 {
+		return false
+	}
+	if w.engine.boundWorld != w.id {
+		if C.boulder_bind_world(w.id) != 0 {
+			return false
+		}
+		w.engine.boundWorld = w.id
+	}
+	return true
+}
+
+// MoveEntity moves an entity and its components to another world, returning its ID there.
+// State kept on the Go side, such as hitboxes and health, stays with the old ID.
+func (w *World) MoveEntity(entity EntityID, target *World) (EntityID, error) {
+	defer lockThread()()
+	if !w.ready() {
+		return 0, errNotInitialized
+	}
+	if target == nil || target.id == 0 {
+		return 0, errors.New("invalid world")
+	}
+
+	var moved C.EntityID
+	if ret := C.boulder_move_entity(C.EntityID(entity), target.id, &moved); ret != 0 {
+		return 0, lastError("failed to move entity")
+	}
+
+	return EntityID(moved), nil
 }
 
 // CreateEntity creates a new entity and returns its ID
 func (w *World) CreateEntity() (EntityID, error) {
-	if !w.engine.initialized {
-		return 0, errors.New("engine not initialized")
+	defer lockThread()()
+	if !w.ready() {
+		return 0, errNotInitialized
 	}
 
 	id := C.boulder_create_entity()
 	if id == 0 {
-		return 0, errors.New("failed to create entity")
+		return 0, lastError("failed to create entity")
 	}
 
 	return EntityID(id), nil
@@ -41,22 +163,40 @@ func (w *World) CreateEntity() (EntityID, error) {
 
 // DestroyEntity destroys an entity
 func (w *World) DestroyEntity(entity EntityID) {
-	if !w.engine.initialized {
+	if !w.ready() {
 		return
 	}
 
 	C.boulder_destroy_entity(C.EntityID(entity))
+	if w.prefabs != nil {
+		delete(w.prefabs.instances, entity)
+	}
 }
 
 // EntityExists checks if an entity exists
 func (w *World) EntityExists(entity EntityID) bool {
-	if !w.engine.initialized {
+	if !w.ready() {
 		return false
 	}
 
 	return C.boulder_entity_exists(C.EntityID(entity)) != 0
 }
 
+// reviveEntity recreates a destroyed entity with the same ID, failing if its ID has been
+// reused
+func (w *World) reviveEntity(entity EntityID) error {
+	defer lockThread()()
+	if !w.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_revive_entity(C.EntityID(entity)); ret != 0 {
+		return lastError("failed to revive entity")
+	}
+
+	return nil
+}
+
 // Entity represents a game entity with components
 type Entity struct {
 	ID    EntityID
@@ -76,6 +216,15 @@ func (w *World) NewEntity() (*Entity, error) {
 	}, nil
 }
 
+// MoveToWorld moves this entity to another world, returning it there
+func (e *Entity) MoveToWorld(target *World) (*Entity, error) {
+	id, err := e.world.MoveEntity(e.ID, target)
+	if err != nil {
+		return nil, err
+	}
+	return &Entity{ID: id, world: target}, nil
+}
+
 // Destroy destroys this entity
 func (e *Entity) Destroy() {
 	e.world.DestroyEntity(e.ID)
@@ -90,13 +239,14 @@ func (e *Entity) Exists() bool {
 
 // AddTransform adds a transform component to an entity
 func (e *Entity) AddTransform(position Vector3) error {
-	if !e.world.engine.initialized {
-		return errors.New("engine not initialized")
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
 	}
 
 	if ret := C.boulder_add_transform(C.EntityID(e.ID),
 		C.float(position.X), C.float(position.Y), C.float(position.Z)); ret != 0 {
-		return errors.New("failed to add transform")
+		return lastError("failed to add transform")
 	}
 
 	return nil
@@ -104,13 +254,14 @@ func (e *Entity) AddTransform(position Vector3) error {
 
 // GetTransform gets the transform position of an entity
 func (e *Entity) GetTransform() (Vector3, error) {
-	if !e.world.engine.initialized {
-		return Vector3{}, errors.New("engine not initialized")
+	defer lockThread()()
+	if !e.world.ready() {
+		return Vector3{}, errNotInitialized
 	}
 
 	var x, y, z C.float
 	if ret := C.boulder_get_transform(C.EntityID(e.ID), &x, &y, &z); ret != 0 {
-		return Vector3{}, errors.New("failed to get transform")
+		return Vector3{}, lastError("failed to get transform")
 	}
 
 	return Vector3{X: float32(x), Y: float32(y), Z: float32(z)}, nil
@@ -118,8 +269,9 @@ func (e *Entity) GetTransform() (Vector3, error) {
 
 // GetFullTransform gets the complete transform (position, rotation, scale) of an entity
 func (e *Entity) GetFullTransform() (position, rotation, scale Vector3, err error) {
-	if !e.world.engine.initialized {
-		return Vector3{}, Vector3{}, Vector3{}, errors.New("engine not initialized")
+	defer lockThread()()
+	if !e.world.ready() {
+		return Vector3{}, Vector3{}, Vector3{}, errNotInitialized
 	}
 
 	var px, py, pz C.float
@@ -130,7 +282,7 @@ func (e *Entity) GetFullTransform() (position, rotation, scale Vector3, err erro
 		&px, &py, &pz,
 		&rx, &ry, &rz,
 		&sx, &sy, &sz); ret != 0 {
-		return Vector3{}, Vector3{}, Vector3{}, errors.New("failed to get full transform")
+		return Vector3{}, Vector3{}, Vector3{}, lastError("failed to get full transform")
 	}
 
 	position = Vector3{X: float32(px), Y: float32(py), Z: float32(pz)}
@@ -142,45 +294,80 @@ func (e *Entity) GetFullTransform() (position, rotation, scale Vector3, err erro
 
 // SetTransform sets the transform position of an entity
 func (e *Entity) SetTransform(position Vector3) error {
-	if !e.world.engine.initialized {
-		return errors.New("engine not initialized")
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
 	}
 
 	if ret := C.boulder_set_transform(C.EntityID(e.ID),
 		C.float(position.X), C.float(position.Y), C.float(position.Z)); ret != 0 {
-		return errors.New("failed to set transform")
+		return lastError("failed to set transform")
 	}
 
 	return nil
 }
 
 // SetFullTransform sets the complete transform (position, rotation, scale) of an entity
-// Rotation is in radians
+// Rotation is in radians, applied X, then Y, then Z; use SetRotationQuat to avoid gimbal lock
 func (e *Entity) SetFullTransform(position, rotation, scale Vector3) error {
-	if !e.world.engine.initialized {
-		return errors.New("engine not initialized")
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
 	}
 
 	if ret := C.boulder_set_full_transform(C.EntityID(e.ID),
 		C.float(position.X), C.float(position.Y), C.float(position.Z),
 		C.float(rotation.X), C.float(rotation.Y), C.float(rotation.Z),
 		C.float(scale.X), C.float(scale.Y), C.float(scale.Z)); ret != 0 {
-		return errors.New("failed to set full transform")
+		return lastError("failed to set full transform")
+	}
+
+	return nil
+}
+
+// SetRotationQuat sets an entity's rotation from a quaternion, which is how rotations are
+// stored, so it never suffers from gimbal lock. It is normalized; the zero quaternion is
+// an error.
+func (e *Entity) SetRotationQuat(rotation Quaternion) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_set_rotation_quat(C.EntityID(e.ID),
+		C.float(rotation.X), C.float(rotation.Y), C.float(rotation.Z), C.float(rotation.W)); ret != 0 {
+		return lastError("failed to set rotation")
 	}
 
 	return nil
 }
 
+// GetRotationQuat gets an entity's rotation as a unit quaternion
+func (e *Entity) GetRotationQuat() (Quaternion, error) {
+	defer lockThread()()
+	if !e.world.ready() {
+		return Quaternion{}, errNotInitialized
+	}
+
+	var x, y, z, w C.float
+	if ret := C.boulder_get_rotation_quat(C.EntityID(e.ID), &x, &y, &z, &w); ret != 0 {
+		return Quaternion{}, lastError("failed to get rotation")
+	}
+
+	return Quaternion{X: float32(x), Y: float32(y), Z: float32(z), W: float32(w)}, nil
+}
+
 // Physics component methods
 
 // AddPhysicsBody adds a physics body component to an entity
 func (e *Entity) AddPhysicsBody(mass float32) error {
-	if !e.world.engine.initialized {
-		return errors.New("engine not initialized")
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
 	}
 
 	if ret := C.boulder_add_physics_body(C.EntityID(e.ID), C.float(mass)); ret != 0 {
-		return errors.New("failed to add physics body")
+		return lastError("failed to add physics body")
 	}
 
 	return nil
@@ -188,13 +375,14 @@ func (e *Entity) AddPhysicsBody(mass float32) error {
 
 // SetVelocity sets the velocity of an entity's physics body
 func (e *Entity) SetVelocity(velocity Vector3) error {
-	if !e.world.engine.initialized {
-		return errors.New("engine not initialized")
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
 	}
 
 	if ret := C.boulder_set_velocity(C.EntityID(e.ID),
 		C.float(velocity.X), C.float(velocity.Y), C.float(velocity.Z)); ret != 0 {
-		return errors.New("failed to set velocity")
+		return lastError("failed to set velocity")
 	}
 
 	return nil
@@ -202,27 +390,378 @@ func (e *Entity) SetVelocity(velocity Vector3) error {
 
 // GetVelocity gets the velocity of an entity's physics body
 func (e *Entity) GetVelocity() (Vector3, error) {
-	if !e.world.engine.initialized {
-		return Vector3{}, errors.New("engine not initialized")
+	defer lockThread()()
+	if !e.world.ready() {
+		return Vector3{}, errNotInitialized
 	}
 
 	var vx, vy, vz C.float
 	if ret := C.boulder_get_velocity(C.EntityID(e.ID), &vx, &vy, &vz); ret != 0 {
-		return Vector3{}, errors.New("failed to get velocity")
+		return Vector3{}, lastError("failed to get velocity")
 	}
 
 	return Vector3{X: float32(vx), Y: float32(vy), Z: float32(vz)}, nil
 }
 
+// RemovePhysicsBody removes an entity's physics body so it is no longer simulated
+func (e *Entity) RemovePhysicsBody() error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_remove_physics_body(C.EntityID(e.ID)); ret != 0 {
+		return lastError("failed to remove physics body")
+	}
+
+	return nil
+}
+
+// GetMass returns the mass of an entity's physics body, false if it has none
+func (e *Entity) GetMass() (float32, bool) {
+	if !e.world.ready() {
+		return 0, false
+	}
+
+	var mass C.float
+	if ret := C.boulder_get_mass(C.EntityID(e.ID), &mass); ret != 0 {
+		return 0, false
+	}
+
+	return float32(mass), true
+}
+
+// Collider methods
+
+// ColliderShape is the shape an entity collides as
+type ColliderShape int
+
+const (
+	ColliderBox     ColliderShape = 0
+	ColliderSphere  ColliderShape = 1
+	ColliderCapsule ColliderShape = 2
+	ColliderMesh    ColliderShape = 3
+)
+
+// Collider is a collider's settings, in the units the Add calls take
+type Collider struct {
+	Shape       ColliderShape
+	Size        Vector3 // Box
+	Radius      float32 // Sphere and capsule
+	Height      float32 // Capsule, including the rounded ends
+	Friction    float32
+	Restitution float32
+	Trigger     bool // A trigger volume, see AddTriggerVolume
+}
+
+// AddBoxCollider makes an entity collide as a box of the given size centered on its
+// transform, turning with its rotation. With a physics body it is pushed around on
+// contact; without one it is static level geometry. Friction is usually between 0 (ice)
+// and 1 (rubber); restitution is how bouncy it is, from 0 to 1.
+func (e *Entity) AddBoxCollider(size Vector3, friction, restitution float32) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_add_box_collider(C.EntityID(e.ID),
+		C.float(size.X/2), C.float(size.Y/2), C.float(size.Z/2), C.float(friction), C.float(restitution)); ret != 0 {
+		return lastError("failed to add box collider")
+	}
+
+	return nil
+}
+
+// AddSphereCollider makes an entity collide as a sphere centered on its transform
+func (e *Entity) AddSphereCollider(radius, friction, restitution float32) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_add_sphere_collider(C.EntityID(e.ID),
+		C.float(radius), C.float(friction), C.float(restitution)); ret != 0 {
+		return lastError("failed to add sphere collider")
+	}
+
+	return nil
+}
+
+// AddCapsuleCollider makes an entity collide as a capsule standing along its Y axis, e.g.
+// for characters. height is the full height including the rounded ends.
+func (e *Entity) AddCapsuleCollider(radius, height, friction, restitution float32) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	halfHeight := max(height/2-radius, 0)
+	if ret := C.boulder_add_capsule_collider(C.EntityID(e.ID),
+		C.float(radius), C.float(halfHeight), C.float(friction), C.float(restitution)); ret != 0 {
+		return lastError("failed to add capsule collider")
+	}
+
+	return nil
+}
+
+// AddMeshCollider makes an entity collide with the exact triangles of its loaded model,
+// for terrain and level geometry. Mesh colliders follow the entity's transform when it is
+// set but are never moved by contacts, and do not collide with each other.
+func (e *Entity) AddMeshCollider(friction, restitution float32) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_add_mesh_collider(C.EntityID(e.ID), C.float(friction), C.float(restitution)); ret != 0 {
+		return lastError("failed to add mesh collider")
+	}
+
+	return nil
+}
+
+// RemoveCollider stops an entity from colliding
+func (e *Entity) RemoveCollider() error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_remove_collider(C.EntityID(e.ID)); ret != 0 {
+		return lastError("failed to remove collider")
+	}
+
+	return nil
+}
+
+// GetCollider returns the entity's collider, false if it has none
+func (e *Entity) GetCollider() (Collider, bool) {
+	if !e.world.ready() {
+		return Collider{}, false
+	}
+
+	var size [3]C.float
+	var friction, restitution C.float
+	shape := C.boulder_get_collider(C.EntityID(e.ID), &size[0], &friction, &restitution)
+	if shape < 0 {
+		return Collider{}, false
+	}
+
+	collider := Collider{
+		Shape:       ColliderShape(shape),
+		Friction:    float32(friction),
+		Restitution: float32(restitution),
+		Trigger:     C.boulder_is_collider_trigger(C.EntityID(e.ID)) == 1,
+	}
+	switch collider.Shape {
+	case ColliderBox:
+		collider.Size = Vector3{X: float32(size[0]) * 2, Y: float32(size[1]) * 2, Z: float32(size[2]) * 2}
+	case ColliderSphere:
+		collider.Radius = float32(size[0])
+	case ColliderCapsule:
+		collider.Radius = float32(size[0])
+		collider.Height = 2 * (float32(size[1]) + float32(size[0]))
+	}
+	return collider, true
+}
+
+// AddCollider adds a collider from its settings, e.g. ones returned by GetCollider
+func (e *Entity) AddCollider(collider Collider) error {
+	var err error
+	switch collider.Shape {
+	case ColliderBox:
+		err = e.AddBoxCollider(collider.Size, collider.Friction, collider.Restitution)
+	case ColliderSphere:
+		err = e.AddSphereCollider(collider.Radius, collider.Friction, collider.Restitution)
+	case ColliderCapsule:
+		err = e.AddCapsuleCollider(collider.Radius, collider.Height, collider.Friction, collider.Restitution)
+	case ColliderMesh:
+		err = e.AddMeshCollider(collider.Friction, collider.Restitution)
+	default:
+		err = errors.New("unknown collider shape")
+	}
+	if err != nil || !collider.Trigger {
+		return err
+	}
+	return e.SetTrigger(true)
+}
+
+// AddTriggerVolume makes the entity a trigger volume of the given shape (friction and
+// restitution are ignored), e.g. for checkpoints, pickups and damage zones. Bodies with mass
+// pass through it, and PollCollisionEvents reports EnterTrigger when one starts overlapping
+// it and ExitTrigger when it leaves. Triggers don't set each other off, nor do static
+// colliders; give the trigger a physics body to move it around.
+func (e *Entity) AddTriggerVolume(shape Collider) error {
+	shape.Trigger = true
+	return e.AddCollider(shape)
+}
+
+// SetTrigger turns the entity's collider into a trigger volume or back into a solid one.
+// Contacts and overlaps it had end with an exit event.
+func (e *Entity) SetTrigger(trigger bool) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	cTrigger := C.int(0)
+	if trigger {
+		cTrigger = 1
+	}
+	if ret := C.boulder_set_collider_trigger(C.EntityID(e.ID), cTrigger); ret != 0 {
+		return lastError("failed to set collider trigger")
+	}
+	return nil
+}
+
+// IsTrigger returns whether the entity's collider is a trigger volume
+func (e *Entity) IsTrigger() bool {
+	if !e.world.ready() {
+		return false
+	}
+	return C.boulder_is_collider_trigger(C.EntityID(e.ID)) == 1
+}
+
+// Fluid densities for buoyancy volumes, in kg/m^3
+const (
+	DensityWater    = 1000
+	DensitySeaWater = 1025
+)
+
+// AddBuoyancyVolume turns an entity into a water region: a box of the given size centered
+// on its transform. Buoyant bodies inside are pushed up and slowed by drag (the fraction
+// of velocity removed per second when fully submerged).
+func (e *Entity) AddBuoyancyVolume(size Vector3, density, drag float32) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_add_buoyancy_volume(C.EntityID(e.ID),
+		C.float(size.X/2), C.float(size.Y/2), C.float(size.Z/2), C.float(density), C.float(drag)); ret != 0 {
+		return lastError("failed to add buoyancy volume")
+	}
+
+	return nil
+}
+
+// SetBuoyancy makes an entity's physics body float. The body displaces volume (m^3) when
+// fully submerged; height is used to work out how much of it is under the surface. A body
+// floats when its mass is less than density * volume.
+func (e *Entity) SetBuoyancy(volume, height float32) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_set_buoyancy(C.EntityID(e.ID), C.float(volume), C.float(height)); ret != 0 {
+		return lastError("failed to set buoyancy")
+	}
+
+	return nil
+}
+
+// SoftBodySettings controls how a soft body wobbles
+type SoftBodySettings struct {
+	Stiffness float32 // Spring strength pulling the shape back
+	Damping   float32 // How quickly the wobble dies down
+	Amount    float32 // How far the shape lags behind acceleration
+}
+
+// DefaultSoftBodySettings returns settings for a jelly-like prop
+func DefaultSoftBodySettings() SoftBodySettings {
+	return SoftBodySettings{
+		Stiffness: 120,
+		Damping:   6,
+		Amount:    0.02,
+	}
+}
+
+// AddSoftBody makes an entity's model wobble as it moves, for jiggly props. It only
+// affects rendering, so it works with or without a physics body.
+func (e *Entity) AddSoftBody(settings SoftBodySettings) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_add_soft_body(C.EntityID(e.ID),
+		C.float(settings.Stiffness), C.float(settings.Damping), C.float(settings.Amount)); ret != 0 {
+		return lastError("failed to add soft body")
+	}
+
+	return nil
+}
+
+// RemoveSoftBody stops an entity's model from wobbling
+func (e *Entity) RemoveSoftBody() error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_remove_soft_body(C.EntityID(e.ID)); ret != 0 {
+		return lastError("failed to remove soft body")
+	}
+
+	return nil
+}
+
 // ApplyForce applies a force to an entity's physics body
 func (e *Entity) ApplyForce(force Vector3) error {
-	if !e.world.engine.initialized {
-		return errors.New("engine not initialized")
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
 	}
 
 	if ret := C.boulder_apply_force(C.EntityID(e.ID),
 		C.float(force.X), C.float(force.Y), C.float(force.Z)); ret != 0 {
-		return errors.New("failed to apply force")
+		return lastError("failed to apply force")
+	}
+
+	return nil
+}
+
+// World snapshot methods
+
+// SaveSnapshot captures the transform and physics state of every entity. The snapshot is
+// written into buf when it is large enough, so callers saving every frame can reuse buffers.
+func (w *World) SaveSnapshot(buf []byte) ([]byte, error) {
+	defer lockThread()()
+	if !w.ready() {
+		return nil, errNotInitialized
+	}
+
+	size := int(C.boulder_world_snapshot_size())
+	if size == 0 {
+		return nil, lastError("failed to size world snapshot")
+	}
+	if cap(buf) < size {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+
+	var written C.uint32_t
+	if ret := C.boulder_world_save_snapshot(unsafe.Pointer(&buf[0]), C.uint32_t(size), &written); ret != 0 {
+		return nil, lastError("failed to save world snapshot")
+	}
+
+	return buf[:written], nil
+}
+
+// LoadSnapshot restores the transform and physics state saved by SaveSnapshot. Entities
+// created after the snapshot are left untouched and destroyed entities are not revived.
+func (w *World) LoadSnapshot(data []byte) error {
+	defer lockThread()()
+	if !w.ready() {
+		return errNotInitialized
+	}
+	if len(data) == 0 {
+		return errors.New("empty world snapshot")
+	}
+
+	if ret := C.boulder_world_load_snapshot(unsafe.Pointer(&data[0]), C.uint32_t(len(data))); ret != 0 {
+		return lastError("failed to load world snapshot")
 	}
 
 	return nil
@@ -230,18 +769,155 @@ func (e *Entity) ApplyForce(force Vector3) error {
 
 // Model component methods
 
-// LoadModel loads a 3D model for an entity
+// LoadModel loads a 3D model for an entity, along with the textures its materials use
 func (e *Entity) LoadModel(path string) error {
-	if !e.world.engine.initialized {
-		return errors.New("engine not initialized")
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
 	}
 
 	cPath := C.CString(path)
 	defer C.free(unsafe.Pointer(cPath))
 
 	if ret := C.boulder_load_model(C.EntityID(e.ID), cPath); ret != 0 {
-		return errors.New("failed to load model")
+		return lastError("failed to load model")
+	}
+
+	e.loadModelTextures()
+	return nil
+}
+
+// GetModelMeshCount returns how many meshes the entity's model has
+func (e *Entity) GetModelMeshCount() int {
+	if !e.world.ready() {
+		return 0
+	}
+	return max(0, int(C.boulder_get_model_mesh_count(C.EntityID(e.ID))))
+}
+
+// SetModelVisible shows or hides the entity's model without unloading it
+func (e *Entity) SetModelVisible(visible bool) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	cVisible := C.int(0)
+	if visible {
+		cVisible = 1
+	}
+	if ret := C.boulder_set_model_visible(C.EntityID(e.ID), cVisible); ret != 0 {
+		return lastError("failed to set model visibility")
+	}
+
+	return nil
+}
+
+// copyMesh copies one mesh of source's model onto this entity, recentered on its centroid.
+// Returns the centroid in the source model's space.
+func (e *Entity) copyMesh(source *Entity, mesh int) (Vector3, error) {
+	defer lockThread()()
+	if !e.world.ready() {
+		return Vector3{}, errNotInitialized
+	}
+
+	var cx, cy, cz C.float
+	if ret := C.boulder_copy_mesh(C.EntityID(source.ID), C.int(mesh), C.EntityID(e.ID), &cx, &cy, &cz); ret != 0 {
+		return Vector3{}, lastError("failed to copy mesh")
+	}
+
+	return Vector3{X: float32(cx), Y: float32(cy), Z: float32(cz)}, nil
+}
+
+// LODTarget describes one generated level of detail
+type LODTarget struct {
+	Ratio    float32 // Fraction of triangles to keep (0-1)
+	MaxError float32 // Maximum deviation allowed, relative to the mesh size (e.g. 0.01)
+}
+
+// ModelImportSettings controls the optimization applied to models as they are loaded
+type ModelImportSettings struct {
+	OptimizeVertexCache bool        // Reorder indices and vertices for the GPU caches
+	LODs                []LODTarget // Extra LODs generated after LOD 0, from most to least detailed
+}
+
+// DefaultModelImportSettings returns settings that optimize meshes and generate three LODs
+func DefaultModelImportSettings() ModelImportSettings {
+	return ModelImportSettings{
+		OptimizeVertexCache: true,
+		LODs: []LODTarget{
+			{Ratio: 0.5, MaxError: 0.01},
+			{Ratio: 0.25, MaxError: 0.02},
+			{Ratio: 0.1, MaxError: 0.05},
+		},
+	}
+}
+
+// SetModelImportSettings sets how models loaded from now on are optimized. LODs stop early
+// once a mesh can't be simplified further within MaxError.
+func (w *World) SetModelImportSettings(settings ModelImportSettings) error {
+	if !w.ready() {
+		return errNotInitialized
+	}
+
+	ratios := make([]C.float, len(settings.LODs))
+	maxErrors := make([]C.float, len(settings.LODs))
+	for i, lod := range settings.LODs {
+		if lod.Ratio <= 0 || lod.Ratio > 1 {
+			return errors.New("lod ratio must be between 0 and 1")
+		}
+		ratios[i] = C.float(lod.Ratio)
+		maxErrors[i] = C.float(lod.MaxError)
 	}
 
+	optimize := C.int(0)
+	if settings.OptimizeVertexCache {
+		optimize = 1
+	}
+
+	var ratioPtr, errorPtr *C.float
+	if len(ratios) > 0 {
+		ratioPtr, errorPtr = &ratios[0], &maxErrors[0]
+	}
+	C.boulder_set_model_import_settings(optimize, ratioPtr, errorPtr, C.int(len(ratios)))
 	return nil
 }
+
+// GetModelLODCount returns how many LODs the entity's model has, including LOD 0
+func (e *Entity) GetModelLODCount() int {
+	if !e.world.ready() {
+		return 0
+	}
+	return int(C.boulder_get_model_lod_count(C.EntityID(e.ID)))
+}
+
+// SetModelLOD selects the LOD drawn for the entity's model. Meshes with fewer LODs draw
+// their smallest one.
+func (e *Entity) SetModelLOD(lod int) error {
+	defer lockThread()()
+	if !e.world.ready() {
+		return errNotInitialized
+	}
+
+	if ret := C.boulder_set_model_lod(C.EntityID(e.ID), C.int(lod)); ret != 0 {
+		return lastError("failed to set model lod")
+	}
+
+	return nil
+}
+
+// GetModelLOD returns the LOD drawn for the entity's model
+func (e *Entity) GetModelLOD() int {
+	if !e.world.ready() {
+		return -1
+	}
+	return int(C.boulder_get_model_lod(C.EntityID(e.ID)))
+}
+
+// GetModelTriangleCount returns the number of triangles drawn at a LOD
+func (e *Entity) GetModelTriangleCount(lod int) int {
+	if !e.world.ready() {
+		return 0
+	}
+	return max(0, int(C.boulder_get_model_triangle_count(C.EntityID(e.ID), C.int(lod))))
+}
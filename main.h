@@ -161,10 +161,18 @@ public:
         return m_config;
     }
 
+    // Set a function called with every message logged, e.g. to forward logs elsewhere.
+    // It runs on the logging thread with the logger locked, so it must not log.
+    void setListener(std::function<void(Level, std::string_view)> listener) {
+        std::lock_guard<std::mutex> lock(m_mutex);
+        m_listener = std::move(listener);
+    }
+
 private:
     Config m_config;
     std::ofstream m_logFile;
     std::mutex m_mutex;
+    std::function<void(Level, std::string_view)> m_listener;
 
     // Convert level to string
     std::string_view levelToString(Level level) const {
@@ -253,6 +261,10 @@ private:
             m_logFile << fullMessage << std::endl;
             m_logFile.flush();
         }
+
+        if (m_listener) {
+            m_listener(level, message);
+        }
     }
 };
 
@@ -2,10 +2,20 @@
 #include "main.h"
 #include <cstring>
 #include <algorithm>
+#include <cmath>
+#include <limits>
 #include <shaderc/shaderc.hpp>
 
+#define STB_TRUETYPE_IMPLEMENTATION
+#include <stb_truetype.h>
+
 namespace boulder {
 
+struct UIFont {
+    std::vector<uint8_t> data; // stbtt_fontinfo points into it
+    stbtt_fontinfo info;
+};
+
 // Embedded shader sources (will be compiled at runtime)
 static const char* UI_VERTEX_SHADER = R"(
 #version 450
@@ -17,8 +27,21 @@ layout(push_constant) uniform PushConstants {
 
 layout(location = 0) in vec2 inPosition;
 layout(location = 1) in vec4 inColor;
+layout(location = 2) in vec2 inLocal;
+layout(location = 3) in vec2 inHalfSize;
+layout(location = 4) in vec4 inShape;
+layout(location = 5) in vec4 inBorderColor;
+layout(location = 6) in vec4 inClipRect;
+layout(location = 7) in vec4 inGlyph;
 
 layout(location = 0) out vec4 fragColor;
+layout(location = 1) out vec2 fragLocal;
+layout(location = 2) flat out vec2 fragHalfSize;
+layout(location = 3) flat out vec4 fragShape;
+layout(location = 4) flat out vec4 fragBorderColor;
+layout(location = 5) out vec2 fragScreen;
+layout(location = 6) flat out vec4 fragClipRect;
+layout(location = 7) flat out vec4 fragGlyph;
 
 void main() {
     // Convert screen-space coordinates to NDC (-1 to 1)
@@ -28,6 +51,13 @@ void main() {
 
     gl_Position = vec4(ndc, 0.0, 1.0);
     fragColor = inColor;
+    fragLocal = inLocal;
+    fragHalfSize = inHalfSize;
+    fragShape = inShape;
+    fragBorderColor = inBorderColor;
+    fragScreen = inPosition;
+    fragClipRect = inClipRect;
+    fragGlyph = inGlyph;
 }
 )";
 
@@ -35,11 +65,80 @@ static const char* UI_FRAGMENT_SHADER = R"(
 #version 450
 
 layout(location = 0) in vec4 fragColor;
+layout(location = 1) in vec2 fragLocal;
+layout(location = 2) flat in vec2 fragHalfSize;
+// Corner radius, border width, edge softness, radial sweep
+layout(location = 3) flat in vec4 fragShape;
+layout(location = 4) flat in vec4 fragBorderColor;
+layout(location = 5) in vec2 fragScreen;
+layout(location = 6) flat in vec4 fragClipRect;
+// Text: atlas pixel at the quad's top-left, then 1
+layout(location = 7) flat in vec4 fragGlyph;
 
 layout(location = 0) out vec4 outColor;
 
+// Text coverage, one byte per pixel
+layout(set = 0, binding = 0) readonly buffer Atlas {
+    uint texels[];
+} atlas;
+
+const float TAU = 6.28318530718;
+const int ATLAS_SIZE = 1024;
+
+// Signed distance to the edge of a rounded rect centered on the origin
+float roundedRectDistance(vec2 p, vec2 halfSize, float radius) {
+    vec2 q = abs(p) - halfSize + radius;
+    return length(max(q, 0.0)) + min(max(q.x, q.y), 0.0) - radius;
+}
+
 void main() {
-    outColor = fragColor;
+    if (any(lessThan(fragScreen, fragClipRect.xy)) || any(greaterThanEqual(fragScreen, fragClipRect.zw))) {
+        discard;
+    }
+
+    // Glyph quads sit on whole pixels, so each fragment covers one atlas pixel
+    if (fragGlyph.z > 0.0) {
+        vec2 pixel = clamp(floor(fragLocal + fragHalfSize), vec2(0.0), fragHalfSize * 2.0 - 1.0);
+        ivec2 texel = ivec2(fragGlyph.xy + pixel);
+        int index = texel.y * ATLAS_SIZE + texel.x;
+        float coverage = float((atlas.texels[index >> 2] >> ((index & 3) * 8)) & 0xffu) / 255.0;
+        outColor = vec4(fragColor.rgb, fragColor.a * coverage);
+        return;
+    }
+
+    float radius = min(fragShape.x, min(fragHalfSize.x, fragHalfSize.y));
+    float distance = roundedRectDistance(fragLocal, fragHalfSize, radius);
+
+    // Shadows fade out across their softness instead of having an edge
+    float softness = fragShape.z;
+    if (softness > 0.0) {
+        float alpha = 1.0 - smoothstep(-softness, softness, distance);
+        outColor = vec4(fragColor.rgb, fragColor.a * alpha);
+        return;
+    }
+
+    // Antialiased edge, one pixel wide
+    float coverage = 1.0 - smoothstep(-0.5, 0.5, distance);
+
+    vec4 color = fragColor;
+    float border = fragShape.y;
+    float sweep = fragShape.w;
+    if (sweep != 0.0) {
+        // Radial fill: keep the part swept clockwise from the top (counterclockwise when
+        // negative), blending from the fill color to the border color along the sweep
+        float turn = atan(fragLocal.x, -fragLocal.y) / TAU;
+        if (turn < 0.0) {
+            turn += 1.0;
+        }
+        if (sweep < 0.0) {
+            turn = 1.0 - turn;
+        }
+        coverage *= clamp((abs(sweep) - turn) * TAU * length(fragLocal) + 0.5, 0.0, 1.0);
+        color = mix(fragColor, fragBorderColor, turn);
+    } else if (border > 0.0) {
+        color = mix(fragColor, fragBorderColor, smoothstep(-border - 0.5, -border + 0.5, distance));
+    }
+    outColor = vec4(color.rgb, color.a * coverage);
 }
 )";
 
@@ -95,6 +194,21 @@ void UIRenderer::cleanup() {
             vkFreeMemory(m_device, m_indexBufferMemory, nullptr);
             m_indexBufferMemory = nullptr;
         }
+        if (m_atlasBuffer) {
+            vkDestroyBuffer(m_device, m_atlasBuffer, nullptr);
+            m_atlasBuffer = nullptr;
+        }
+        if (m_atlasMemory) {
+            vkFreeMemory(m_device, m_atlasMemory, nullptr);
+            m_atlasMemory = nullptr;
+            m_atlasPixels = nullptr;
+        }
+        m_glyphs.clear();
+        if (m_descriptorPool) {
+            vkDestroyDescriptorPool(m_device, m_descriptorPool, nullptr);
+            m_descriptorPool = nullptr;
+            m_descriptorSet = nullptr;
+        }
         if (m_pipeline) {
             vkDestroyPipeline(m_device, m_pipeline, nullptr);
             m_pipeline = nullptr;
@@ -103,6 +217,10 @@ void UIRenderer::cleanup() {
             vkDestroyPipelineLayout(m_device, m_pipelineLayout, nullptr);
             m_pipelineLayout = nullptr;
         }
+        if (m_descriptorSetLayout) {
+            vkDestroyDescriptorSetLayout(m_device, m_descriptorSetLayout, nullptr);
+            m_descriptorSetLayout = nullptr;
+        }
         if (m_vertShader) {
             vkDestroyShaderModule(m_device, m_vertShader, nullptr);
             m_vertShader = nullptr;
@@ -126,6 +244,7 @@ uint64_t UIRenderer::createButton(const glm::vec2& position, const glm::vec2& si
     button.pressedColor = pressedColor;
     button.state = ButtonState::Normal;
     button.enabled = true;
+    button.style = m_defaultStyle;
     button.onClick = nullptr;
 
     m_buttons[button.id] = button;
@@ -136,7 +255,42 @@ uint64_t UIRenderer::createButton(const glm::vec2& position, const glm::vec2& si
 
 void UIRenderer::destroyButton(uint64_t buttonId) {
     m_buttons.erase(buttonId);
+    if (m_focusedButtonId == buttonId) {
+        m_focusedButtonId = 0;
+        m_focusChanged = true;
+    }
+    updateVertexBuffer();
+}
+
+uint64_t UIRenderer::createProgressBar(const glm::vec2& position, const glm::vec2& size) {
+    UIProgressBar bar;
+    bar.id = m_nextProgressBarId++;
+    bar.position = position;
+    bar.size = size;
+
+    m_progressBars[bar.id] = bar;
     updateVertexBuffer();
+
+    return bar.id;
+}
+
+void UIRenderer::destroyProgressBar(uint64_t barId) {
+    if (m_progressBars.erase(barId) > 0) {
+        updateVertexBuffer();
+    }
+}
+
+const UIProgressBar* UIRenderer::getProgressBar(uint64_t barId) const {
+    auto it = m_progressBars.find(barId);
+    return it != m_progressBars.end() ? &it->second : nullptr;
+}
+
+void UIRenderer::setProgressBar(const UIProgressBar& bar) {
+    auto it = m_progressBars.find(bar.id);
+    if (it != m_progressBars.end()) {
+        it->second = bar;
+        updateVertexBuffer();
+    }
 }
 
 void UIRenderer::setButtonCallback(uint64_t buttonId, std::function<void()> callback) {
@@ -169,7 +323,289 @@ void UIRenderer::setButtonEnabled(uint64_t buttonId, bool enabled) {
     }
 }
 
+void UIRenderer::setButtonColors(uint64_t buttonId, const glm::vec4& normalColor,
+                                 const glm::vec4& hoverColor, const glm::vec4& pressedColor) {
+    auto it = m_buttons.find(buttonId);
+    if (it != m_buttons.end()) {
+        it->second.normalColor = normalColor;
+        it->second.hoverColor = hoverColor;
+        it->second.pressedColor = pressedColor;
+        updateVertexBuffer();
+    }
+}
+
+void UIRenderer::setButtonStyle(uint64_t buttonId, const UIStyle& style) {
+    auto it = m_buttons.find(buttonId);
+    if (it != m_buttons.end()) {
+        it->second.style = style;
+        updateVertexBuffer();
+    }
+}
+
+void UIRenderer::setButtonOpacity(uint64_t buttonId, float opacity) {
+    auto it = m_buttons.find(buttonId);
+    if (it != m_buttons.end()) {
+        it->second.opacity = std::clamp(opacity, 0.0f, 1.0f);
+        updateVertexBuffer();
+    }
+}
+
+void UIRenderer::setButtonClip(uint64_t buttonId, const glm::vec4& clipRect) {
+    auto it = m_buttons.find(buttonId);
+    if (it != m_buttons.end()) {
+        it->second.clipped = true;
+        it->second.clipRect = clipRect;
+        updateVertexBuffer();
+    }
+}
+
+void UIRenderer::clearButtonClip(uint64_t buttonId) {
+    auto it = m_buttons.find(buttonId);
+    if (it != m_buttons.end()) {
+        it->second.clipped = false;
+        updateVertexBuffer();
+    }
+}
+
+void UIRenderer::setButtonVisible(uint64_t buttonId, bool visible) {
+    auto it = m_buttons.find(buttonId);
+    if (it == m_buttons.end()) {
+        return;
+    }
+
+    it->second.visible = visible;
+    if (!visible) {
+        if (m_pressedButtonId == buttonId) {
+            m_pressedButtonId = 0;
+        }
+        if (m_focusedButtonId == buttonId) {
+            m_focusedButtonId = 0;
+            m_focusChanged = true;
+        }
+    }
+    updateButtonStates();
+}
+
+const UIButton* UIRenderer::getButton(uint64_t buttonId) const {
+    auto it = m_buttons.find(buttonId);
+    return it == m_buttons.end() ? nullptr : &it->second;
+}
+
+void UIRenderer::setButtonLabel(uint64_t buttonId, const std::string& label) {
+    auto it = m_buttons.find(buttonId);
+    if (it != m_buttons.end()) {
+        it->second.label = label;
+    }
+}
+
+const std::string* UIRenderer::getButtonLabel(uint64_t buttonId) const {
+    auto it = m_buttons.find(buttonId);
+    if (it == m_buttons.end()) {
+        return nullptr;
+    }
+    return &it->second.label;
+}
+
+bool UIRenderer::takeFocusChanged() {
+    bool changed = m_focusChanged;
+    m_focusChanged = false;
+    return changed;
+}
+
+bool UIRenderer::canFocus(const UIButton& button) const {
+    return button.enabled && button.focusable && button.visible && !isBlocked(button);
+}
+
+std::vector<uint64_t> UIRenderer::focusOrder() const {
+    auto containerIndex = [this](uint64_t container) -> size_t {
+        auto it = std::find(m_containers.begin(), m_containers.end(), container);
+        return it == m_containers.end() ? 0 : static_cast<size_t>(it - m_containers.begin()) + 1;
+    };
+
+    std::vector<uint64_t> order;
+    for (const auto& [id, button] : m_buttons) {
+        if (canFocus(button)) {
+            order.push_back(id);
+        }
+    }
+
+    std::sort(order.begin(), order.end(), [&](uint64_t a, uint64_t b) {
+        const UIButton& first = m_buttons.at(a);
+        const UIButton& second = m_buttons.at(b);
+        size_t firstContainer = containerIndex(first.container);
+        size_t secondContainer = containerIndex(second.container);
+        if (firstContainer != secondContainer) {
+            return firstContainer < secondContainer;
+        }
+        if (first.position.y != second.position.y) {
+            return first.position.y < second.position.y;
+        }
+        if (first.position.x != second.position.x) {
+            return first.position.x < second.position.x;
+        }
+        return a < b;
+    });
+    return order;
+}
+
+bool UIRenderer::moveFocus(FocusDirection direction) {
+    std::vector<uint64_t> order = focusOrder();
+    if (order.empty()) {
+        return false;
+    }
+
+    auto current = m_buttons.find(m_focusedButtonId);
+    if (current == m_buttons.end() || !canFocus(current->second)) {
+        setFocus(direction == FocusDirection::Previous ? order.back() : order.front());
+        return true;
+    }
+
+    if (direction == FocusDirection::Next || direction == FocusDirection::Previous) {
+        auto it = std::find(order.begin(), order.end(), m_focusedButtonId);
+        size_t index = static_cast<size_t>(it - order.begin());
+        size_t count = order.size();
+        index = direction == FocusDirection::Next ? (index + 1) % count : (index + count - 1) % count;
+        setFocus(order[index]);
+        return true;
+    }
+
+    glm::vec2 axis;
+    switch (direction) {
+        case FocusDirection::Up:
+            axis = {0.0f, -1.0f};
+            break;
+        case FocusDirection::Down:
+            axis = {0.0f, 1.0f};
+            break;
+        case FocusDirection::Left:
+            axis = {-1.0f, 0.0f};
+            break;
+        default:
+            axis = {1.0f, 0.0f};
+            break;
+    }
+
+    // The nearest button that way, favouring ones in line with the current one; buttons in
+    // the same container are tried first
+    const UIButton& from = current->second;
+    glm::vec2 origin = from.position + from.size * 0.5f;
+    for (bool sameContainer : {true, false}) {
+        uint64_t best = 0;
+        float bestScore = std::numeric_limits<float>::max();
+        for (uint64_t id : order) {
+            const UIButton& button = m_buttons.at(id);
+            if (id == m_focusedButtonId || (sameContainer && button.container != from.container)) {
+                continue;
+            }
+
+            glm::vec2 offset = button.position + button.size * 0.5f - origin;
+            float along = glm::dot(offset, axis);
+            if (along <= 0.0f) {
+                continue;
+            }
+            float across = std::abs(offset.x * axis.y - offset.y * axis.x);
+            float score = along + across * 2.0f;
+            if (score < bestScore) {
+                bestScore = score;
+                best = id;
+            }
+        }
+        if (best != 0) {
+            setFocus(best);
+            return true;
+        }
+    }
+    return false;
+}
+
+void UIRenderer::setFocus(uint64_t buttonId) {
+    if (buttonId != 0 && m_buttons.find(buttonId) == m_buttons.end()) {
+        return;
+    }
+    if (m_focusedButtonId != buttonId) {
+        m_focusedButtonId = buttonId;
+        m_focusChanged = true;
+    }
+    m_focusVisible = buttonId != 0;
+    updateVertexBuffer();
+}
+
+bool UIRenderer::activateFocused() {
+    auto it = m_buttons.find(m_focusedButtonId);
+    if (it == m_buttons.end() || !it->second.enabled || isBlocked(it->second)) {
+        return false;
+    }
+    if (it->second.onClick) {
+        it->second.onClick();
+    }
+    return true;
+}
+
+void UIRenderer::setButtonFocusable(uint64_t buttonId, bool focusable) {
+    auto it = m_buttons.find(buttonId);
+    if (it != m_buttons.end()) {
+        it->second.focusable = focusable;
+    }
+}
+
+void UIRenderer::setFocusColor(const glm::vec4& color) {
+    m_focusColor = color;
+    updateVertexBuffer();
+}
+
+uint64_t UIRenderer::createContainer() {
+    uint64_t id = m_nextContainerId++;
+    m_containers.push_back(id);
+    return id;
+}
+
+void UIRenderer::destroyContainer(uint64_t containerId) {
+    m_containers.erase(std::remove(m_containers.begin(), m_containers.end(), containerId), m_containers.end());
+    for (auto& [id, button] : m_buttons) {
+        if (button.container == containerId) {
+            button.container = 0;
+        }
+    }
+    for (auto& [id, label] : m_labels) {
+        if (label.container == containerId) {
+            label.container = 0;
+        }
+    }
+    if (m_modalContainer == containerId) {
+        setModal(0, m_modalDimColor);
+    }
+}
+
+void UIRenderer::setButtonContainer(uint64_t buttonId, uint64_t containerId) {
+    auto it = m_buttons.find(buttonId);
+    if (it != m_buttons.end()) {
+        it->second.container = containerId;
+    }
+}
+
+void UIRenderer::setModal(uint64_t containerId, const glm::vec4& dimColor) {
+    m_modalContainer = containerId;
+    m_modalDimColor = dimColor;
+
+    // Nothing under the modal layer stays pressed or focused
+    auto pressed = m_buttons.find(m_pressedButtonId);
+    if (pressed != m_buttons.end() && isBlocked(pressed->second)) {
+        m_pressedButtonId = 0;
+    }
+    auto focused = m_buttons.find(m_focusedButtonId);
+    if (focused != m_buttons.end() && isBlocked(focused->second)) {
+        m_focusedButtonId = 0;
+        m_focusChanged = true;
+        m_focusVisible = false;
+    }
+    updateButtonStates();
+}
+
 void UIRenderer::handleMouseMove(float x, float y) {
+    // The pointer takes over from navigation once it moves
+    if (m_focusVisible && m_mousePosition != glm::vec2(x, y)) {
+        m_focusVisible = false;
+    }
     m_mousePosition = glm::vec2(x, y);
     updateButtonStates();
 }
@@ -178,7 +614,7 @@ void UIRenderer::handleMouseDown(float x, float y) {
     m_mousePosition = glm::vec2(x, y);
 
     for (auto& [id, button] : m_buttons) {
-        if (button.enabled && isPointInButton(m_mousePosition, button)) {
+        if (button.enabled && button.visible && !isBlocked(button) && isPointInButton(m_mousePosition, button)) {
             button.state = ButtonState::Pressed;
             m_pressedButtonId = id;
             updateVertexBuffer();
@@ -209,12 +645,14 @@ void UIRenderer::handleMouseUp(float x, float y) {
 
 void UIRenderer::render(VkCommandBuffer commandBuffer, const VkExtent2D& swapchainExtent,
                        VkImage swapchainImage, VkImageView swapchainImageView) {
-    if (m_buttons.empty()) {
+    if (m_quadCount == 0) {
         return;
     }
 
     // Bind the UI pipeline
     vkCmdBindPipeline(commandBuffer, VK_PIPELINE_BIND_POINT_GRAPHICS, m_pipeline);
+    vkCmdBindDescriptorSets(commandBuffer, VK_PIPELINE_BIND_POINT_GRAPHICS, m_pipelineLayout, 0, 1,
+                            &m_descriptorSet, 0, nullptr);
 
     // Update push constants with screen size
     UIPushConstants pushConstants;
@@ -227,14 +665,17 @@ void UIRenderer::render(VkCommandBuffer commandBuffer, const VkExtent2D& swapcha
     vkCmdBindVertexBuffers(commandBuffer, 0, 1, &m_vertexBuffer, &offset);
     vkCmdBindIndexBuffer(commandBuffer, m_indexBuffer, 0, VK_INDEX_TYPE_UINT16);
 
-    // Draw all buttons
-    uint32_t indexCount = static_cast<uint32_t>(m_buttons.size() * 6);
+    // Draw all buttons, bars, text and the focus ring
+    uint32_t indexCount = m_quadCount * 6;
     vkCmdDrawIndexed(commandBuffer, indexCount, 1, 0, 0, 0);
 }
 
 void UIRenderer::updateScreenSize(uint32_t width, uint32_t height) {
     m_screenWidth = width;
     m_screenHeight = height;
+    if (m_modalContainer != 0) {
+        updateVertexBuffer(); // The dim color covers the whole screen
+    }
 }
 
 bool UIRenderer::createShaders() {
@@ -296,9 +737,28 @@ bool UIRenderer::createPipeline(VkFormat swapchainFormat) {
     pushConstantRange.offset = 0;
     pushConstantRange.size = sizeof(UIPushConstants);
 
+    // The text atlas
+    VkDescriptorSetLayoutBinding atlasBinding{};
+    atlasBinding.binding = 0;
+    atlasBinding.descriptorType = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
+    atlasBinding.descriptorCount = 1;
+    atlasBinding.stageFlags = VK_SHADER_STAGE_FRAGMENT_BIT;
+
+    VkDescriptorSetLayoutCreateInfo setLayoutInfo{};
+    setLayoutInfo.sType = VK_STRUCTURE_TYPE_DESCRIPTOR_SET_LAYOUT_CREATE_INFO;
+    setLayoutInfo.bindingCount = 1;
+    setLayoutInfo.pBindings = &atlasBinding;
+
+    if (vkCreateDescriptorSetLayout(m_device, &setLayoutInfo, nullptr, &m_descriptorSetLayout) != VK_SUCCESS) {
+        Logger::get().error("Failed to create UI descriptor set layout");
+        return false;
+    }
+
     // Create pipeline layout
     VkPipelineLayoutCreateInfo layoutInfo{};
     layoutInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_LAYOUT_CREATE_INFO;
+    layoutInfo.setLayoutCount = 1;
+    layoutInfo.pSetLayouts = &m_descriptorSetLayout;
     layoutInfo.pushConstantRangeCount = 1;
     layoutInfo.pPushConstantRanges = &pushConstantRange;
 
@@ -328,23 +788,22 @@ bool UIRenderer::createPipeline(VkFormat swapchainFormat) {
     bindingDescription.stride = sizeof(UIVertex);
     bindingDescription.inputRate = VK_VERTEX_INPUT_RATE_VERTEX;
 
-    VkVertexInputAttributeDescription attributeDescriptions[2];
-    // Position
-    attributeDescriptions[0].binding = 0;
-    attributeDescriptions[0].location = 0;
-    attributeDescriptions[0].format = VK_FORMAT_R32G32_SFLOAT;
-    attributeDescriptions[0].offset = offsetof(UIVertex, position);
-    // Color
-    attributeDescriptions[1].binding = 0;
-    attributeDescriptions[1].location = 1;
-    attributeDescriptions[1].format = VK_FORMAT_R32G32B32A32_SFLOAT;
-    attributeDescriptions[1].offset = offsetof(UIVertex, color);
+    VkVertexInputAttributeDescription attributeDescriptions[8] = {
+        {0, 0, VK_FORMAT_R32G32_SFLOAT, offsetof(UIVertex, position)},
+        {1, 0, VK_FORMAT_R32G32B32A32_SFLOAT, offsetof(UIVertex, color)},
+        {2, 0, VK_FORMAT_R32G32_SFLOAT, offsetof(UIVertex, local)},
+        {3, 0, VK_FORMAT_R32G32_SFLOAT, offsetof(UIVertex, halfSize)},
+        {4, 0, VK_FORMAT_R32G32B32A32_SFLOAT, offsetof(UIVertex, shape)},
+        {5, 0, VK_FORMAT_R32G32B32A32_SFLOAT, offsetof(UIVertex, borderColor)},
+        {6, 0, VK_FORMAT_R32G32B32A32_SFLOAT, offsetof(UIVertex, clipRect)},
+        {7, 0, VK_FORMAT_R32G32B32A32_SFLOAT, offsetof(UIVertex, glyph)},
+    };
 
     VkPipelineVertexInputStateCreateInfo vertexInputInfo{};
     vertexInputInfo.sType = VK_STRUCTURE_TYPE_PIPELINE_VERTEX_INPUT_STATE_CREATE_INFO;
     vertexInputInfo.vertexBindingDescriptionCount = 1;
     vertexInputInfo.pVertexBindingDescriptions = &bindingDescription;
-    vertexInputInfo.vertexAttributeDescriptionCount = 2;
+    vertexInputInfo.vertexAttributeDescriptionCount = 8;
     vertexInputInfo.pVertexAttributeDescriptions = attributeDescriptions;
 
     // Input assembly
@@ -434,10 +893,9 @@ bool UIRenderer::createPipeline(VkFormat swapchainFormat) {
 }
 
 bool UIRenderer::createBuffers() {
-    // Create vertex buffer (start with space for 100 buttons)
-    const size_t maxButtons = 100;
-    const size_t vertexBufferSize = maxButtons * 4 * sizeof(UIVertex);  // 4 vertices per button
-    const size_t indexBufferSize = maxButtons * 6 * sizeof(uint16_t);   // 6 indices per button
+    // Create vertex buffer (space for MAX_QUADS quads: buttons, bars, glyphs and the focus ring)
+    const size_t vertexBufferSize = MAX_QUADS * 4 * sizeof(UIVertex);  // 4 vertices per quad
+    const size_t indexBufferSize = MAX_QUADS * 6 * sizeof(uint16_t);   // 6 indices per quad
 
     // Vertex buffer
     VkBufferCreateInfo vertexBufferInfo{};
@@ -500,7 +958,7 @@ bool UIRenderer::createBuffers() {
     vkMapMemory(m_device, m_indexBufferMemory, 0, indexBufferSize, 0, &indexData);
     uint16_t* indices = static_cast<uint16_t*>(indexData);
 
-    for (size_t i = 0; i < maxButtons; ++i) {
+    for (size_t i = 0; i < MAX_QUADS; ++i) {
         uint16_t baseVertex = static_cast<uint16_t>(i * 4);
         size_t baseIndex = i * 6;
 
@@ -515,47 +973,328 @@ bool UIRenderer::createBuffers() {
 
     vkUnmapMemory(m_device, m_indexBufferMemory);
 
+    // Text atlas, mapped for as long as it exists
+    const VkDeviceSize atlasSize = ATLAS_SIZE * ATLAS_SIZE;
+    VkBufferCreateInfo atlasBufferInfo{};
+    atlasBufferInfo.sType = VK_STRUCTURE_TYPE_BUFFER_CREATE_INFO;
+    atlasBufferInfo.size = atlasSize;
+    atlasBufferInfo.usage = VK_BUFFER_USAGE_STORAGE_BUFFER_BIT;
+    atlasBufferInfo.sharingMode = VK_SHARING_MODE_EXCLUSIVE;
+
+    if (vkCreateBuffer(m_device, &atlasBufferInfo, nullptr, &m_atlasBuffer) != VK_SUCCESS) {
+        Logger::get().error("Failed to create UI text atlas");
+        return false;
+    }
+
+    VkMemoryRequirements atlasMemReqs;
+    vkGetBufferMemoryRequirements(m_device, m_atlasBuffer, &atlasMemReqs);
+
+    VkMemoryAllocateInfo atlasAllocInfo{};
+    atlasAllocInfo.sType = VK_STRUCTURE_TYPE_MEMORY_ALLOCATE_INFO;
+    atlasAllocInfo.allocationSize = atlasMemReqs.size;
+    atlasAllocInfo.memoryTypeIndex = findMemoryType(atlasMemReqs.memoryTypeBits,
+        VK_MEMORY_PROPERTY_HOST_VISIBLE_BIT | VK_MEMORY_PROPERTY_HOST_COHERENT_BIT);
+
+    if (vkAllocateMemory(m_device, &atlasAllocInfo, nullptr, &m_atlasMemory) != VK_SUCCESS) {
+        Logger::get().error("Failed to allocate UI text atlas memory");
+        return false;
+    }
+
+    vkBindBufferMemory(m_device, m_atlasBuffer, m_atlasMemory, 0);
+
+    void* atlasData;
+    if (vkMapMemory(m_device, m_atlasMemory, 0, atlasSize, 0, &atlasData) != VK_SUCCESS) {
+        Logger::get().error("Failed to map UI text atlas");
+        return false;
+    }
+    m_atlasPixels = static_cast<uint8_t*>(atlasData);
+    memset(m_atlasPixels, 0, atlasSize);
+
+    VkDescriptorPoolSize poolSize{};
+    poolSize.type = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
+    poolSize.descriptorCount = 1;
+
+    VkDescriptorPoolCreateInfo poolInfo{};
+    poolInfo.sType = VK_STRUCTURE_TYPE_DESCRIPTOR_POOL_CREATE_INFO;
+    poolInfo.maxSets = 1;
+    poolInfo.poolSizeCount = 1;
+    poolInfo.pPoolSizes = &poolSize;
+
+    if (vkCreateDescriptorPool(m_device, &poolInfo, nullptr, &m_descriptorPool) != VK_SUCCESS) {
+        Logger::get().error("Failed to create UI descriptor pool");
+        return false;
+    }
+
+    VkDescriptorSetAllocateInfo setInfo{};
+    setInfo.sType = VK_STRUCTURE_TYPE_DESCRIPTOR_SET_ALLOCATE_INFO;
+    setInfo.descriptorPool = m_descriptorPool;
+    setInfo.descriptorSetCount = 1;
+    setInfo.pSetLayouts = &m_descriptorSetLayout;
+
+    if (vkAllocateDescriptorSets(m_device, &setInfo, &m_descriptorSet) != VK_SUCCESS) {
+        Logger::get().error("Failed to allocate UI descriptor set");
+        return false;
+    }
+
+    VkDescriptorBufferInfo atlasInfo{};
+    atlasInfo.buffer = m_atlasBuffer;
+    atlasInfo.offset = 0;
+    atlasInfo.range = atlasSize;
+
+    VkWriteDescriptorSet write{};
+    write.sType = VK_STRUCTURE_TYPE_WRITE_DESCRIPTOR_SET;
+    write.dstSet = m_descriptorSet;
+    write.dstBinding = 0;
+    write.descriptorCount = 1;
+    write.descriptorType = VK_DESCRIPTOR_TYPE_STORAGE_BUFFER;
+    write.pBufferInfo = &atlasInfo;
+    vkUpdateDescriptorSets(m_device, 1, &write, 0, nullptr);
+
     Logger::get().info("UI buffers created successfully");
     return true;
 }
 
-void UIRenderer::updateVertexBuffer() {
-    if (!m_vertexBuffer || m_buttons.empty()) {
-        return;
+// Clip rect for the shader; unclipped buttons get one larger than any screen
+static glm::vec4 drawClipRect(const UIButton& button) {
+    if (button.clipped) {
+        return button.clipRect;
     }
+    constexpr float unbounded = 1.0e9f;
+    return {-unbounded, -unbounded, unbounded, unbounded};
+}
 
-    // Build vertex data for all buttons
-    std::vector<UIVertex> vertices;
-    vertices.reserve(m_buttons.size() * 4);
+void UIRenderer::addQuad(std::vector<UIVertex>& vertices, const glm::vec2& center, const glm::vec2& halfSize,
+                         float margin, const glm::vec4& color, const glm::vec4& shape, const glm::vec4& borderColor,
+                         const glm::vec4& clipRect, const glm::vec4* cornerColors, const glm::vec4& glyph) {
+    // The quad covers the rect plus a margin for anything drawn outside it (shadow blur)
+    glm::vec2 extent = halfSize + glm::vec2(margin);
+    glm::vec2 corners[4] = {
+        {-extent.x, -extent.y}, // Top-left
+        {extent.x, -extent.y},  // Top-right
+        {extent.x, extent.y},   // Bottom-right
+        {-extent.x, extent.y},  // Bottom-left
+    };
+    for (int i = 0; i < 4; i++) {
+        const glm::vec4& cornerColor = cornerColors ? cornerColors[i] : color;
+        vertices.push_back({center + corners[i], cornerColor, corners[i], halfSize, shape, borderColor, clipRect, glyph});
+    }
+}
 
-    for (const auto& [id, button] : m_buttons) {
-        glm::vec4 color;
-        switch (button.state) {
-            case ButtonState::Pressed:
-                color = button.pressedColor;
+void UIRenderer::addProgressBar(std::vector<UIVertex>& vertices, const UIProgressBar& bar) {
+    const UIStyle& style = bar.style;
+    auto fade = [&](glm::vec4 color) {
+        color.a *= bar.opacity;
+        return color;
+    };
+
+    bool radial = bar.fill == FillMode::Clockwise || bar.fill == FillMode::CounterClockwise;
+    glm::vec2 halfSize = bar.size * 0.5f;
+    glm::vec2 center = bar.position + halfSize;
+    float radius = radial ? std::min(halfSize.x, halfSize.y) : style.cornerRadius;
+    glm::vec4 unclipped = {-1.0e9f, -1.0e9f, 1.0e9f, 1.0e9f};
+
+    if (style.shadowColor.a > 0.0f) {
+        addQuad(vertices, center + style.shadowOffset, halfSize, style.shadowBlur, fade(style.shadowColor),
+                {radius, 0.0f, style.shadowBlur * 0.5f, 0.0f}, glm::vec4(0.0f), unclipped);
+    }
+    addQuad(vertices, center, halfSize, 0.0f, fade(bar.backgroundColor),
+            {radius, style.borderWidth, 0.0f, 0.0f}, fade(style.borderColor), unclipped);
+
+    // The trail and fill sit inside the border
+    glm::vec2 innerHalf = glm::max(halfSize - glm::vec2(style.borderWidth), glm::vec2(0.0f));
+    float innerRadius = std::max(radius - style.borderWidth, 0.0f);
+    glm::vec2 innerMin = center - innerHalf;
+    glm::vec2 innerMax = center + innerHalf;
+
+    auto addFill = [&](float fraction, const glm::vec4& startColor, const glm::vec4& endColor) {
+        fraction = std::clamp(fraction, 0.0f, 1.0f);
+        if (fraction <= 0.0f) {
+            return;
+        }
+
+        if (radial) {
+            float sweep = bar.fill == FillMode::Clockwise ? fraction : -fraction;
+            addQuad(vertices, center, innerHalf, 0.0f, fade(startColor),
+                    {innerRadius, 0.0f, 0.0f, sweep}, fade(endColor), unclipped);
+            return;
+        }
+
+        // A linear fill is the whole inner shape clipped to the filled part, so rounded
+        // ends stay rounded; the gradient runs along the fill direction
+        glm::vec4 clip = {innerMin.x, innerMin.y, innerMax.x, innerMax.y};
+        glm::vec2 extent = innerMax - innerMin;
+        glm::vec4 start = fade(startColor);
+        glm::vec4 end = fade(endColor);
+        glm::vec4 colors[4]; // Top-left, top-right, bottom-right, bottom-left
+        switch (bar.fill) {
+            case FillMode::RightToLeft:
+                clip.x = innerMax.x - extent.x * fraction;
+                colors[0] = colors[3] = end;
+                colors[1] = colors[2] = start;
+                break;
+            case FillMode::BottomToTop:
+                clip.y = innerMax.y - extent.y * fraction;
+                colors[0] = colors[1] = end;
+                colors[2] = colors[3] = start;
                 break;
-            case ButtonState::Hovered:
-                color = button.hoverColor;
+            case FillMode::TopToBottom:
+                clip.w = innerMin.y + extent.y * fraction;
+                colors[0] = colors[1] = start;
+                colors[2] = colors[3] = end;
                 break;
-            case ButtonState::Normal:
+            case FillMode::LeftToRight:
             default:
-                color = button.normalColor;
+                clip.z = innerMin.x + extent.x * fraction;
+                colors[0] = colors[3] = start;
+                colors[1] = colors[2] = end;
                 break;
         }
+        addQuad(vertices, center, innerHalf, 0.0f, start, {innerRadius, 0.0f, 0.0f, 0.0f},
+                glm::vec4(0.0f), clip, colors);
+    };
 
-        // If disabled, darken the color
-        if (!button.enabled) {
-            color *= 0.5f;
+    if (bar.trail > bar.value) {
+        addFill(bar.trail, bar.trailColor, bar.trailColor);
+    }
+    addFill(bar.value, bar.fillStartColor, bar.fillEndColor);
+}
+
+void UIRenderer::addButton(std::vector<UIVertex>& vertices, uint64_t id, const UIButton& button) {
+    glm::vec4 color;
+    switch (button.state) {
+        case ButtonState::Pressed:
+            color = button.pressedColor;
+            break;
+        case ButtonState::Hovered:
+            color = button.hoverColor;
+            break;
+        case ButtonState::Normal:
+        default:
+            color = button.normalColor;
+            break;
+    }
+
+    // A button focused by navigation looks hovered
+    if (m_focusVisible && id == m_focusedButtonId && button.state == ButtonState::Normal) {
+        color = button.hoverColor;
+    }
+
+    // If disabled, darken the color
+    if (!button.enabled) {
+        color *= 0.5f;
+    }
+    color.a *= button.opacity;
+
+    const UIStyle& style = button.style;
+    glm::vec4 borderColor = style.borderColor;
+    if (!button.enabled) {
+        borderColor *= 0.5f;
+    }
+    borderColor.a *= button.opacity;
+
+    glm::vec2 halfSize = button.size * 0.5f;
+    glm::vec2 center = button.position + halfSize;
+    glm::vec4 clipRect = drawClipRect(button);
+
+    // Drop shadow under the button, fading out over the blur
+    if (style.shadowColor.a > 0.0f) {
+        glm::vec4 shadowColor = style.shadowColor;
+        shadowColor.a *= button.opacity;
+        float softness = style.shadowBlur * 0.5f;
+        addQuad(vertices, center + style.shadowOffset, halfSize, style.shadowBlur, shadowColor,
+                {style.cornerRadius, 0.0f, softness, 0.0f}, glm::vec4(0.0f), clipRect);
+    }
+
+    addQuad(vertices, center, halfSize, 0.0f, color,
+            {style.cornerRadius, style.borderWidth, 0.0f, 0.0f}, borderColor, clipRect);
+
+    glm::vec4 textColor = button.text.color;
+    if (!button.enabled) {
+        textColor *= 0.5f;
+    }
+    textColor.a *= button.opacity;
+    addText(vertices, button.text, button.position, button.size, textColor, clipRect);
+}
+
+void UIRenderer::buildVertices(std::vector<UIVertex>& vertices) {
+    const glm::vec4 unclipped = {-1.0e9f, -1.0e9f, 1.0e9f, 1.0e9f};
+
+    // Everything outside the modal container first, then the dim color over it and the
+    // modal container's buttons and labels on top
+    for (bool modalLayer : {false, true}) {
+        if (modalLayer) {
+            if (m_modalContainer == 0) {
+                break;
+            }
+            glm::vec2 halfScreen = glm::vec2(m_screenWidth, m_screenHeight) * 0.5f;
+            addQuad(vertices, halfScreen, halfScreen, 0.0f, m_modalDimColor, glm::vec4(0.0f), glm::vec4(0.0f),
+                    unclipped);
         }
 
-        // Create quad vertices (top-left, top-right, bottom-right, bottom-left)
-        glm::vec2 topLeft = button.position;
-        glm::vec2 bottomRight = button.position + button.size;
+        for (const auto& [id, button] : m_buttons) {
+            if (button.visible && inModal(button.container) == modalLayer) {
+                addButton(vertices, id, button);
+            }
+        }
 
-        vertices.push_back({topLeft, color});
-        vertices.push_back({{bottomRight.x, topLeft.y}, color});
-        vertices.push_back({bottomRight, color});
-        vertices.push_back({{topLeft.x, bottomRight.y}, color});
+        if (!modalLayer) {
+            for (const auto& [id, bar] : m_progressBars) {
+                if (bar.visible) {
+                    addProgressBar(vertices, bar);
+                }
+            }
+        }
+
+        for (const auto& [id, label] : m_labels) {
+            if (label.visible && inModal(label.container) == modalLayer) {
+                glm::vec4 color = label.text.color;
+                color.a *= label.opacity;
+                addText(vertices, label.text, label.position, label.size, color, unclipped);
+            }
+        }
+    }
+
+    // Focus ring: a border-only rect just outside the focused button, following its corners
+    auto focused = m_buttons.find(m_focusedButtonId);
+    if (m_focusVisible && focused != m_buttons.end() && focused->second.visible) {
+        const UIButton& button = focused->second;
+        float w = FOCUS_RING_WIDTH;
+        glm::vec2 halfSize = button.size * 0.5f + glm::vec2(w);
+        glm::vec4 ringColor = m_focusColor;
+        ringColor.a *= button.opacity;
+        float radius = button.style.cornerRadius > 0.0f ? button.style.cornerRadius + w : 0.0f;
+        addQuad(vertices, button.position + button.size * 0.5f, halfSize, 0.0f, glm::vec4(0.0f),
+                {radius, w, 0.0f, 0.0f}, ringColor, drawClipRect(button));
+    }
+}
+
+void UIRenderer::updateVertexBuffer() {
+    if (!m_vertexBuffer) {
+        return;
+    }
+
+    std::vector<UIVertex> vertices;
+    vertices.reserve((m_buttons.size() * 2 + m_progressBars.size() * 4 + 1) * 4);
+    buildVertices(vertices);
+
+    // Out of atlas space: start it over with just the glyphs on screen
+    if (m_atlasFull) {
+        resetAtlas();
+        vertices.clear();
+        buildVertices(vertices);
+        if (m_atlasFull) {
+            Logger::get().error("UI text has more glyphs than fit in the atlas, the rest are not drawn");
+            m_atlasFull = false;
+        }
+    }
+
+    if (vertices.size() > MAX_QUADS * 4) {
+        Logger::get().error("UI has more than {} quads, the rest are not drawn", MAX_QUADS);
+        vertices.resize(MAX_QUADS * 4);
+    }
+    m_quadCount = static_cast<uint32_t>(vertices.size() / 4);
+    if (vertices.empty()) {
+        return;
     }
 
     // Upload to GPU
@@ -565,6 +1304,299 @@ void UIRenderer::updateVertexBuffer() {
     vkUnmapMemory(m_device, m_vertexBufferMemory);
 }
 
+// Decodes the UTF-8 character at i and moves past it; malformed bytes decode as U+FFFD
+static uint32_t nextCodepoint(const std::string& text, size_t& i) {
+    unsigned char c = static_cast<unsigned char>(text[i++]);
+    if (c < 0x80) {
+        return c;
+    }
+
+    uint32_t codepoint;
+    int extra;
+    if ((c & 0xE0) == 0xC0) {
+        codepoint = c & 0x1F;
+        extra = 1;
+    } else if ((c & 0xF0) == 0xE0) {
+        codepoint = c & 0x0F;
+        extra = 2;
+    } else if ((c & 0xF8) == 0xF0) {
+        codepoint = c & 0x07;
+        extra = 3;
+    } else {
+        return 0xFFFD;
+    }
+    for (; extra > 0; extra--) {
+        if (i >= text.size() || (static_cast<unsigned char>(text[i]) & 0xC0) != 0x80) {
+            return 0xFFFD;
+        }
+        codepoint = (codepoint << 6) | (static_cast<unsigned char>(text[i++]) & 0x3F);
+    }
+    return codepoint > 0x10FFFF ? 0xFFFD : codepoint;
+}
+
+// Line widths and vertical metrics of text, in pixels
+struct TextLayout {
+    int pixelSize;
+    float scale;      // Font units to pixels
+    float ascent;     // Top of the first line to its baseline
+    float lineHeight; // Baseline to baseline
+    float height;     // Top of the first line to the bottom of the last
+    std::vector<float> lineWidths;
+};
+
+static TextLayout layoutText(const UIFont& font, const UIText& text) {
+    TextLayout layout;
+    layout.pixelSize = std::max(1, static_cast<int>(std::lround(text.size)));
+    layout.scale = stbtt_ScaleForPixelHeight(&font.info, static_cast<float>(layout.pixelSize));
+
+    int ascent, descent, lineGap;
+    stbtt_GetFontVMetrics(&font.info, &ascent, &descent, &lineGap);
+    layout.ascent = ascent * layout.scale;
+    layout.lineHeight = (ascent - descent + lineGap) * layout.scale;
+
+    float width = 0.0f;
+    uint32_t previous = 0;
+    for (size_t i = 0; i < text.text.size();) {
+        uint32_t codepoint = nextCodepoint(text.text, i);
+        if (codepoint == '\n') {
+            layout.lineWidths.push_back(width);
+            width = 0.0f;
+            previous = 0;
+            continue;
+        }
+
+        int advance, bearing;
+        stbtt_GetCodepointHMetrics(&font.info, codepoint, &advance, &bearing);
+        if (previous != 0) {
+            width += stbtt_GetCodepointKernAdvance(&font.info, previous, codepoint) * layout.scale;
+        }
+        width += advance * layout.scale;
+        previous = codepoint;
+    }
+    layout.lineWidths.push_back(width);
+
+    layout.height = (layout.lineWidths.size() - 1) * layout.lineHeight + (ascent - descent) * layout.scale;
+    return layout;
+}
+
+// Offset that places something in space according to an alignment
+static float alignOffset(TextAlign align, float space) {
+    switch (align) {
+        case TextAlign::Center:
+            return space * 0.5f;
+        case TextAlign::End:
+            return space;
+        case TextAlign::Start:
+        default:
+            return 0.0f;
+    }
+}
+
+const UIFont* UIRenderer::findFont(uint64_t fontId, uint64_t& resolvedId) const {
+    resolvedId = fontId != 0 ? fontId : m_defaultFont;
+    auto it = m_fonts.find(resolvedId);
+    return it == m_fonts.end() ? nullptr : it->second.get();
+}
+
+glm::vec2 UIRenderer::measureText(const UIText& text) {
+    uint64_t fontId;
+    const UIFont* font = findFont(text.font, fontId);
+    if (!font || text.text.empty()) {
+        return glm::vec2(0.0f);
+    }
+
+    TextLayout layout = layoutText(*font, text);
+    return {*std::max_element(layout.lineWidths.begin(), layout.lineWidths.end()), layout.height};
+}
+
+void UIRenderer::addText(std::vector<UIVertex>& vertices, const UIText& text, const glm::vec2& position,
+                         const glm::vec2& size, const glm::vec4& color, const glm::vec4& clipRect) {
+    if (text.text.empty() || color.a <= 0.0f) {
+        return;
+    }
+    uint64_t fontId;
+    const UIFont* font = findFont(text.font, fontId);
+    if (!font) {
+        return;
+    }
+
+    TextLayout layout = layoutText(*font, text);
+    float top = position.y + alignOffset(text.verticalAlign, size.y - layout.height);
+    size_t line = 0;
+    float penX = position.x + alignOffset(text.align, size.x - layout.lineWidths[0]);
+    float baseline = top + layout.ascent;
+    uint32_t previous = 0;
+
+    for (size_t i = 0; i < text.text.size();) {
+        uint32_t codepoint = nextCodepoint(text.text, i);
+        if (codepoint == '\n') {
+            line++;
+            penX = position.x + alignOffset(text.align, size.x - layout.lineWidths[line]);
+            baseline = top + layout.ascent + line * layout.lineHeight;
+            previous = 0;
+            continue;
+        }
+
+        if (previous != 0) {
+            penX += stbtt_GetCodepointKernAdvance(&font->info, previous, codepoint) * layout.scale;
+        }
+        previous = codepoint;
+
+        const UIGlyph* glyph = getGlyph(*font, fontId, layout.pixelSize, codepoint);
+        if (!glyph) {
+            // The atlas is full; the text is drawn again once it starts over
+            return;
+        }
+        if (glyph->size.x > 0 && glyph->size.y > 0) {
+            // Whole pixels, so each fragment samples exactly one atlas pixel
+            glm::vec2 topLeft = glm::round(glm::vec2(penX, baseline)) + glyph->offset;
+            glm::vec2 halfSize = glm::vec2(glyph->size) * 0.5f;
+            addQuad(vertices, topLeft + halfSize, halfSize, 0.0f, color, glm::vec4(0.0f), glm::vec4(0.0f),
+                    clipRect, nullptr,
+                    {static_cast<float>(glyph->atlasPosition.x), static_cast<float>(glyph->atlasPosition.y), 1.0f, 0.0f});
+        }
+        penX += glyph->advance;
+    }
+}
+
+const UIGlyph* UIRenderer::getGlyph(const UIFont& font, uint64_t fontId, int pixelSize, uint32_t codepoint) {
+    uint64_t key = (fontId << 37) | (static_cast<uint64_t>(std::min(pixelSize, 0xFFFF)) << 21) | codepoint;
+    auto it = m_glyphs.find(key);
+    if (it != m_glyphs.end()) {
+        return &it->second;
+    }
+    if (m_atlasFull || !m_atlasPixels) {
+        return nullptr;
+    }
+
+    float scale = stbtt_ScaleForPixelHeight(&font.info, static_cast<float>(pixelSize));
+    UIGlyph glyph;
+    int advance, bearing;
+    stbtt_GetCodepointHMetrics(&font.info, codepoint, &advance, &bearing);
+    glyph.advance = advance * scale;
+
+    int x0, y0, x1, y1;
+    stbtt_GetCodepointBitmapBox(&font.info, static_cast<int>(codepoint), scale, scale, &x0, &y0, &x1, &y1);
+    glyph.size = {x1 - x0, y1 - y0};
+    glyph.offset = {static_cast<float>(x0), static_cast<float>(y0)};
+
+    if (glyph.size.x >= ATLAS_SIZE || glyph.size.y >= ATLAS_SIZE) {
+        // Too big for the atlas, so only its advance is used
+        glyph.size = glm::ivec2(0);
+    } else if (glyph.size.x > 0 && glyph.size.y > 0) {
+        // Shelves of glyphs, a pixel apart so they don't bleed into each other
+        if (m_atlasCursor.x + glyph.size.x + 1 > ATLAS_SIZE) {
+            m_atlasCursor = {0, m_atlasCursor.y + m_atlasShelfHeight};
+            m_atlasShelfHeight = 0;
+        }
+        if (m_atlasCursor.y + glyph.size.y + 1 > ATLAS_SIZE) {
+            m_atlasFull = true;
+            return nullptr;
+        }
+
+        glyph.atlasPosition = m_atlasCursor;
+        stbtt_MakeCodepointBitmap(&font.info, m_atlasPixels + m_atlasCursor.y * ATLAS_SIZE + m_atlasCursor.x,
+                                  glyph.size.x, glyph.size.y, ATLAS_SIZE, scale, scale, static_cast<int>(codepoint));
+        m_atlasCursor.x += glyph.size.x + 1;
+        m_atlasShelfHeight = std::max(m_atlasShelfHeight, glyph.size.y + 1);
+    }
+    return &m_glyphs.emplace(key, glyph).first->second;
+}
+
+void UIRenderer::resetAtlas() {
+    // Frames in flight may still read glyphs that are about to be overwritten
+    vkDeviceWaitIdle(m_device);
+    memset(m_atlasPixels, 0, ATLAS_SIZE * ATLAS_SIZE);
+    m_glyphs.clear();
+    m_atlasCursor = glm::ivec2(0);
+    m_atlasShelfHeight = 0;
+    m_atlasFull = false;
+}
+
+uint64_t UIRenderer::loadFont(const uint8_t* data, size_t size) {
+    if (!data || size == 0) {
+        return 0;
+    }
+
+    auto font = std::make_unique<UIFont>();
+    font->data.assign(data, data + size);
+    int offset = stbtt_GetFontOffsetForIndex(font->data.data(), 0);
+    if (offset < 0 || !stbtt_InitFont(&font->info, font->data.data(), offset)) {
+        Logger::get().error("Failed to read font");
+        return 0;
+    }
+
+    uint64_t id = m_nextFontId++;
+    m_fonts[id] = std::move(font);
+    if (m_defaultFont == 0) {
+        // Text waiting for a default font can be drawn now
+        m_defaultFont = id;
+        updateVertexBuffer();
+    }
+    return id;
+}
+
+void UIRenderer::destroyFont(uint64_t fontId) {
+    if (m_fonts.erase(fontId) == 0) {
+        return;
+    }
+
+    // The glyphs' pixels stay in the atlas until it starts over
+    for (auto it = m_glyphs.begin(); it != m_glyphs.end();) {
+        it = (it->first >> 37) == fontId ? m_glyphs.erase(it) : std::next(it);
+    }
+    if (m_defaultFont == fontId) {
+        m_defaultFont = 0;
+    }
+    updateVertexBuffer();
+}
+
+void UIRenderer::setDefaultFont(uint64_t fontId) {
+    if (fontId == 0 || m_fonts.count(fontId)) {
+        m_defaultFont = fontId;
+        updateVertexBuffer();
+    }
+}
+
+void UIRenderer::setButtonText(uint64_t buttonId, const UIText& text) {
+    auto it = m_buttons.find(buttonId);
+    if (it != m_buttons.end()) {
+        it->second.text = text;
+        updateVertexBuffer();
+    }
+}
+
+uint64_t UIRenderer::createLabel(const glm::vec2& position, const glm::vec2& size) {
+    UILabel label;
+    label.id = m_nextLabelId++;
+    label.position = position;
+    label.size = size;
+    label.text.align = TextAlign::Start;
+    label.text.verticalAlign = TextAlign::Start;
+
+    m_labels[label.id] = label;
+    return label.id;
+}
+
+void UIRenderer::destroyLabel(uint64_t labelId) {
+    if (m_labels.erase(labelId) > 0) {
+        updateVertexBuffer();
+    }
+}
+
+const UILabel* UIRenderer::getLabel(uint64_t labelId) const {
+    auto it = m_labels.find(labelId);
+    return it != m_labels.end() ? &it->second : nullptr;
+}
+
+void UIRenderer::setLabel(const UILabel& label) {
+    auto it = m_labels.find(label.id);
+    if (it != m_labels.end()) {
+        it->second = label;
+        updateVertexBuffer();
+    }
+}
+
 uint32_t UIRenderer::findMemoryType(uint32_t typeFilter, VkMemoryPropertyFlags properties) {
     VkPhysicalDeviceMemoryProperties memProperties;
     vkGetPhysicalDeviceMemoryProperties(m_physicalDevice, &memProperties);
@@ -581,6 +1613,10 @@ uint32_t UIRenderer::findMemoryType(uint32_t typeFilter, VkMemoryPropertyFlags p
 }
 
 bool UIRenderer::isPointInButton(const glm::vec2& point, const UIButton& button) {
+    if (button.clipped && (point.x < button.clipRect.x || point.x >= button.clipRect.z ||
+                           point.y < button.clipRect.y || point.y >= button.clipRect.w)) {
+        return false;
+    }
     return point.x >= button.position.x &&
            point.x <= button.position.x + button.size.x &&
            point.y >= button.position.y &&
@@ -591,7 +1627,7 @@ void UIRenderer::updateButtonStates() {
     m_hoveredButtonId = 0;
 
     for (auto& [id, button] : m_buttons) {
-        if (!button.enabled) {
+        if (!button.enabled || !button.visible || isBlocked(button)) {
             button.state = ButtonState::Normal;
             continue;
         }
@@ -604,6 +1640,10 @@ void UIRenderer::updateButtonStates() {
         if (isPointInButton(m_mousePosition, button)) {
             button.state = ButtonState::Hovered;
             m_hoveredButtonId = id;
+            if (m_focusedButtonId != id) {
+                m_focusedButtonId = id;
+                m_focusChanged = true;
+            }
         } else {
             button.state = ButtonState::Normal;
         }
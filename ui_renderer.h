@@ -1,8 +1,10 @@
 #pragma once
 
 #include <vector>
+#include <map>
 #include <unordered_map>
 #include <functional>
+#include <memory>
 #include <string>
 #include "volk.h"
 #include <glm/glm.hpp>
@@ -16,6 +18,43 @@ enum class ButtonState {
     Pressed
 };
 
+// Focus navigation directions
+enum class FocusDirection {
+    Up,
+    Down,
+    Left,
+    Right,
+    Next,     // Reading order: by container, then top to bottom and left to right
+    Previous
+};
+
+// Rounded corners, border and drop shadow of a widget
+struct UIStyle {
+    float cornerRadius = 0.0f;
+    float borderWidth = 0.0f;                // Drawn inside the widget's rect
+    glm::vec4 borderColor = {0.0f, 0.0f, 0.0f, 0.0f};
+    glm::vec4 shadowColor = {0.0f, 0.0f, 0.0f, 0.0f}; // Transparent for no shadow
+    glm::vec2 shadowOffset = {0.0f, 0.0f};
+    float shadowBlur = 0.0f;                 // Pixels the shadow's edge fades over
+};
+
+// Where text sits in its box: left, center or right; top, middle or bottom
+enum class TextAlign {
+    Start,
+    Center,
+    End
+};
+
+// Text drawn in a box, on a button or as a label
+struct UIText {
+    std::string text;        // UTF-8; '\n' starts a new line
+    uint64_t font = 0;       // 0 for the default font
+    float size = 16.0f;      // Pixel height of the font
+    glm::vec4 color = {1.0f, 1.0f, 1.0f, 1.0f};
+    TextAlign align = TextAlign::Center;
+    TextAlign verticalAlign = TextAlign::Center;
+};
+
 // UI Button structure
 struct UIButton {
     uint64_t id;
@@ -26,13 +65,79 @@ struct UIButton {
     glm::vec4 pressedColor;  // RGBA color when pressed
     ButtonState state;
     bool enabled;
+    std::string label;       // Accessible name, announced when the button takes focus
+    bool focusable = true;   // Reached by keyboard and controller navigation
+    bool visible = true;     // Hidden buttons are not drawn, hovered, clicked or focused
+    float opacity = 1.0f;    // Multiplies the alpha of every color
+    UIStyle style;
+    bool clipped = false;    // Drawn and hit only inside clipRect, e.g. in a scroll view
+    glm::vec4 clipRect = {0.0f, 0.0f, 0.0f, 0.0f}; // Min x, min y, max x, max y
+    uint64_t container = 0;  // Container that orders its focus, 0 for none
+    UIText text;             // Drawn on the button, centered unless aligned otherwise
     std::function<void()> onClick;
 };
 
-// Vertex format for UI quads
+// Direction a progress bar fills in
+enum class FillMode {
+    LeftToRight,
+    RightToLeft,
+    BottomToTop,
+    TopToBottom,
+    Clockwise,        // Radial, from the top
+    CounterClockwise  // Radial, from the top
+};
+
+// Progress bar: a background with a fill drawn over it, linear or radial. The fill blends
+// from fillStartColor at the empty end to fillEndColor at the full end.
+struct UIProgressBar {
+    uint64_t id;
+    glm::vec2 position;
+    glm::vec2 size;
+    float value = 0.0f;      // Filled fraction, 0 to 1
+    float trail = 0.0f;      // Fraction drawn behind the fill in trailColor, e.g. health just lost
+    FillMode fill = FillMode::LeftToRight;
+    glm::vec4 backgroundColor = {0.1f, 0.1f, 0.1f, 0.8f};
+    glm::vec4 fillStartColor = {0.2f, 0.8f, 0.3f, 1.0f};
+    glm::vec4 fillEndColor = {0.2f, 0.8f, 0.3f, 1.0f};
+    glm::vec4 trailColor = {1.0f, 1.0f, 1.0f, 0.6f};
+    UIStyle style;           // The fill sits inside the border
+    bool visible = true;
+    float opacity = 1.0f;
+};
+
+// Text that takes no input, aligned in a box (top-left by default). Labels are drawn over
+// buttons and progress bars.
+struct UILabel {
+    uint64_t id;
+    glm::vec2 position;
+    glm::vec2 size;
+    UIText text;
+    bool visible = true;
+    float opacity = 1.0f;
+    uint64_t container = 0;  // Drawn with the container's buttons when it is modal
+};
+
+// A glyph rasterized into the text atlas at one pixel size
+struct UIGlyph {
+    glm::ivec2 atlasPosition{0}; // Top-left pixel in the atlas
+    glm::ivec2 size{0};          // Pixels; zero for glyphs with no outline, like spaces
+    glm::vec2 offset{0.0f};      // From the pen position on the baseline to the top-left
+    float advance = 0.0f;
+};
+
+struct UIFont;
+
+// Vertex format for UI quads. The fragment shader cuts a rounded rect out of each quad
+// from its distance to the rect's edge.
 struct UIVertex {
-    glm::vec2 position;  // Screen-space position
-    glm::vec4 color;     // Vertex color
+    glm::vec2 position;     // Screen-space position
+    glm::vec4 color;        // Fill color
+    glm::vec2 local;        // Position relative to the rect's center
+    glm::vec2 halfSize;     // Half the rect's size
+    glm::vec4 shape;        // Corner radius, border width, edge softness (shadows), unused
+    glm::vec4 borderColor;
+    glm::vec4 clipRect;     // Min x, min y, max x, max y; fragments outside are discarded
+    glm::vec4 glyph;        // Text quads: atlas pixel at the top-left, then 1; zero otherwise
 };
 
 // Push constants for UI rendering
@@ -64,6 +169,70 @@ public:
     void setButtonPosition(uint64_t buttonId, const glm::vec2& position);
     void setButtonSize(uint64_t buttonId, const glm::vec2& size);
     void setButtonEnabled(uint64_t buttonId, bool enabled);
+    void setButtonColors(uint64_t buttonId, const glm::vec4& normalColor,
+                         const glm::vec4& hoverColor, const glm::vec4& pressedColor);
+
+    void setButtonStyle(uint64_t buttonId, const UIStyle& style);
+    void setDefaultStyle(const UIStyle& style) { m_defaultStyle = style; }
+    const UIStyle& getDefaultStyle() const { return m_defaultStyle; }
+    void setButtonOpacity(uint64_t buttonId, float opacity);
+    void setButtonVisible(uint64_t buttonId, bool visible);
+    void setButtonClip(uint64_t buttonId, const glm::vec4& clipRect);
+    void clearButtonClip(uint64_t buttonId);
+    const UIButton* getButton(uint64_t buttonId) const;
+
+    void setButtonText(uint64_t buttonId, const UIText& text);
+
+    void setButtonLabel(uint64_t buttonId, const std::string& label);
+    const std::string* getButtonLabel(uint64_t buttonId) const;
+
+    // Focus: the button last hovered, touched or navigated to. It stays focused when the
+    // pointer leaves so it can be announced and activated. Navigation shows a ring around
+    // it until the pointer moves again.
+    uint64_t getFocusedButton() const { return m_focusedButtonId; }
+    uint64_t getHoveredButton() const { return m_hoveredButtonId; } // Under the pointer, not pressed
+    uint64_t getPressedButton() const { return m_pressedButtonId; }
+    bool takeFocusChanged();
+    bool moveFocus(FocusDirection direction);
+    void setFocus(uint64_t buttonId);
+    bool activateFocused();
+    void setButtonFocusable(uint64_t buttonId, bool focusable);
+    void setFocusColor(const glm::vec4& color);
+
+    // Containers group buttons for focus order: Next and Previous go through a container's
+    // buttons before the next container's, and directional moves stay in the container
+    // while it has a button that way. Containers are ordered by creation.
+    uint64_t createContainer();
+    void destroyContainer(uint64_t containerId);
+    void setButtonContainer(uint64_t buttonId, uint64_t containerId);
+
+    // Modal layer: while a container is modal only its buttons are hovered, pressed and
+    // focused. Everything else is drawn under a full-screen dim color, with the container's
+    // buttons and labels on top. 0 clears it.
+    void setModal(uint64_t containerId, const glm::vec4& dimColor);
+    uint64_t getModal() const { return m_modalContainer; }
+
+    // Progress bars are drawn over buttons and do not take input. Change one by getting a
+    // copy, editing it and setting it back.
+    uint64_t createProgressBar(const glm::vec2& position, const glm::vec2& size);
+    void destroyProgressBar(uint64_t barId);
+    const UIProgressBar* getProgressBar(uint64_t barId) const;
+    void setProgressBar(const UIProgressBar& bar);
+
+    // Fonts are TrueType or OpenType files; the data is copied. The first font loaded is
+    // the default until another is set. Glyphs are rasterized into an atlas the first time
+    // they are drawn at a size.
+    uint64_t loadFont(const uint8_t* data, size_t size);
+    void destroyFont(uint64_t fontId);
+    void setDefaultFont(uint64_t fontId);
+    uint64_t getDefaultFont() const { return m_defaultFont; }
+    glm::vec2 measureText(const UIText& text);
+
+    // Labels, changed like progress bars
+    uint64_t createLabel(const glm::vec2& position, const glm::vec2& size);
+    void destroyLabel(uint64_t labelId);
+    const UILabel* getLabel(uint64_t labelId) const;
+    void setLabel(const UILabel& label);
 
     // Input handling
     void handleMouseMove(float x, float y);
@@ -77,6 +246,12 @@ public:
     // Update screen size (call when window resizes)
     void updateScreenSize(uint32_t width, uint32_t height);
 
+    // Live buttons, labels, progress bars and containers, and fonts, for leak checks
+    size_t getElementCount() const {
+        return m_buttons.size() + m_labels.size() + m_progressBars.size() + m_containers.size();
+    }
+    size_t getFontCount() const { return m_fonts.size(); }
+
 private:
     // Vulkan resources
     VkDevice m_device = nullptr;
@@ -92,12 +267,47 @@ private:
     VkCommandPool m_commandPool = nullptr;
     VkQueue m_graphicsQueue = nullptr;
 
+    // Text atlas: one byte of coverage per pixel in a mapped storage buffer. Glyphs are
+    // only added to unused space, so frames in flight never see their texels change; when
+    // the atlas is full the GPU is waited on and it starts over.
+    VkDescriptorSetLayout m_descriptorSetLayout = nullptr;
+    VkDescriptorPool m_descriptorPool = nullptr;
+    VkDescriptorSet m_descriptorSet = nullptr;
+    VkBuffer m_atlasBuffer = nullptr;
+    VkDeviceMemory m_atlasMemory = nullptr;
+    uint8_t* m_atlasPixels = nullptr;
+    glm::ivec2 m_atlasCursor{0};  // Where the next glyph goes on the current shelf
+    int m_atlasShelfHeight = 0;
+    bool m_atlasFull = false;
+    std::unordered_map<uint64_t, std::unique_ptr<UIFont>> m_fonts;
+    uint64_t m_nextFontId = 1;
+    uint64_t m_defaultFont = 0;
+    std::unordered_map<uint64_t, UIGlyph> m_glyphs; // By font, pixel size and codepoint
+
     // UI state
     std::unordered_map<uint64_t, UIButton> m_buttons;
     uint64_t m_nextButtonId = 1;
+    std::map<uint64_t, UIProgressBar> m_progressBars; // By id, so later bars draw on top
+    uint64_t m_nextProgressBarId = 1;
+    std::map<uint64_t, UILabel> m_labels;
+    uint64_t m_nextLabelId = 1;
     glm::vec2 m_mousePosition = {0.0f, 0.0f};
     uint64_t m_hoveredButtonId = 0;
     uint64_t m_pressedButtonId = 0;
+    uint64_t m_focusedButtonId = 0;
+    bool m_focusChanged = false;
+    bool m_focusVisible = false;
+    glm::vec4 m_focusColor = {1.0f, 1.0f, 1.0f, 1.0f};
+    std::vector<uint64_t> m_containers; // In creation order
+    uint64_t m_nextContainerId = 1;
+    uint64_t m_modalContainer = 0;
+    glm::vec4 m_modalDimColor = {0.0f, 0.0f, 0.0f, 0.5f};
+    uint32_t m_quadCount = 0;
+    UIStyle m_defaultStyle; // Given to new buttons
+
+    static constexpr size_t MAX_QUADS = 4096; // Each glyph of text is a quad
+    static constexpr int ATLAS_SIZE = 1024;   // Pixels along each side; must match the fragment shader
+    static constexpr float FOCUS_RING_WIDTH = 2.0f; // Pixels
     uint32_t m_screenWidth = 800;
     uint32_t m_screenHeight = 600;
 
@@ -106,9 +316,25 @@ private:
     bool createPipeline(VkFormat swapchainFormat);
     bool createBuffers();
     void updateVertexBuffer();
+    void addQuad(std::vector<UIVertex>& vertices, const glm::vec2& center, const glm::vec2& halfSize,
+                 float margin, const glm::vec4& color, const glm::vec4& shape, const glm::vec4& borderColor,
+                 const glm::vec4& clipRect, const glm::vec4* cornerColors = nullptr,
+                 const glm::vec4& glyph = glm::vec4(0.0f));
+    void addText(std::vector<UIVertex>& vertices, const UIText& text, const glm::vec2& position,
+                 const glm::vec2& size, const glm::vec4& color, const glm::vec4& clipRect);
+    const UIFont* findFont(uint64_t fontId, uint64_t& resolvedId) const;
+    const UIGlyph* getGlyph(const UIFont& font, uint64_t fontId, int pixelSize, uint32_t codepoint);
+    void resetAtlas();
+    void buildVertices(std::vector<UIVertex>& vertices);
+    void addButton(std::vector<UIVertex>& vertices, uint64_t id, const UIButton& button);
+    void addProgressBar(std::vector<UIVertex>& vertices, const UIProgressBar& bar);
     uint32_t findMemoryType(uint32_t typeFilter, VkMemoryPropertyFlags properties);
     bool isPointInButton(const glm::vec2& point, const UIButton& button);
     void updateButtonStates();
+    bool canFocus(const UIButton& button) const;
+    bool inModal(uint64_t container) const { return m_modalContainer != 0 && container == m_modalContainer; }
+    bool isBlocked(const UIButton& button) const { return m_modalContainer != 0 && button.container != m_modalContainer; }
+    std::vector<uint64_t> focusOrder() const;
 };
 
 } // namespace boulder